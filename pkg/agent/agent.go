@@ -0,0 +1,160 @@
+// Package agent runs forge in pull mode: a daemon on each node fetches its
+// module from a git repository or an HTTP endpoint, applies it locally on a
+// schedule and reports the outcome to a central server.
+package agent
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+)
+
+const (
+	// DefaultInterval is how often the module is pulled and applied
+	DefaultInterval = 30 * time.Minute
+	// DefaultModule is the module file looked up in a git repository
+	DefaultModule = "module.yaml"
+)
+
+// Config configures an agent
+type Config struct {
+	// Source is a git repository (ending in .git, or git@, git:// or git+
+	// URLs), a git::<repository>//<path>?ref=<ref> address or the HTTP(S)
+	// URL of a module file
+	Source string `yaml:"source" json:"source"`
+	// Ref is the branch or tag checked out from a git source
+	Ref string `yaml:"ref,omitempty" json:"ref,omitempty"`
+	// Module is the module file within a git source
+	Module   string        `yaml:"module,omitempty" json:"module,omitempty"`
+	Interval time.Duration `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// Splay delays each run by a random duration up to this, so nodes
+	// sharing a schedule do not all pull at once
+	Splay time.Duration `yaml:"splay,omitempty" json:"splay,omitempty"`
+	// Dir is where sources are checked out
+	Dir string `yaml:"dir" json:"dir"`
+	// Node names this node in reports
+	Node string `yaml:"node" json:"node"`
+	// ReportURL receives a JSON report after every run; ReportToken is sent
+	// as a bearer token with it
+	ReportURL   string `yaml:"report_url,omitempty" json:"report_url,omitempty"`
+	ReportToken string `yaml:"report_token,omitempty" json:"report_token,omitempty"`
+	// Version is the forge release the agent runs, sent with its reports
+	Version string `yaml:"-" json:"-"`
+}
+
+// Validate checks the agent configuration
+func (c *Config) Validate() error {
+	if c.Source == "" {
+		return fmt.Errorf("agent source is required")
+	}
+	if _, err := sourceKind(c.Source); err != nil {
+		return err
+	}
+	if c.Interval < 0 || c.Splay < 0 {
+		return fmt.Errorf("agent interval and splay must not be negative")
+	}
+	if c.Dir == "" {
+		return fmt.Errorf("agent dir is required")
+	}
+	return nil
+}
+
+// ApplyFunc applies the module file at a path, fetched at a revision, to
+// this node
+type ApplyFunc func(ctx context.Context, modulePath, revision string) error
+
+// Agent pulls and applies a module on a schedule
+type Agent struct {
+	config   Config
+	source   Source
+	apply    ApplyFunc
+	reporter *Reporter
+	logger   *log.Logger
+}
+
+// NewAgent creates an agent that applies the fetched module with apply
+func NewAgent(config Config, apply ApplyFunc, logger *log.Logger) (*Agent, error) {
+	if config.Interval == 0 {
+		config.Interval = DefaultInterval
+	}
+	if config.Module == "" {
+		config.Module = DefaultModule
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	source, err := NewSource(config)
+	if err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = log.Default()
+	}
+	return &Agent{
+		config:   config,
+		source:   source,
+		apply:    apply,
+		reporter: NewReporter(config.ReportURL, config.ReportToken),
+		logger:   logger,
+	}, nil
+}
+
+// RunOnce fetches the module, applies it and reports the outcome. The
+// report is returned even when the run fails.
+func (a *Agent) RunOnce(ctx context.Context) *Report {
+	report := &Report{
+		Node:      a.config.Node,
+		Version:   a.config.Version,
+		Protocol:  ProtocolVersion,
+		Source:    a.config.Source,
+		StartedAt: time.Now(),
+	}
+
+	modulePath, revision, err := a.source.Fetch(ctx)
+	report.Revision = revision
+	if err != nil {
+		report.fail(fmt.Errorf("failed to fetch module: %w", err))
+	} else if err := a.apply(ctx, modulePath, revision); err != nil {
+		report.fail(err)
+	} else {
+		report.Status = StatusSucceeded
+	}
+	report.Duration = time.Since(report.StartedAt)
+
+	if err := a.reporter.Send(ctx, report); err != nil {
+		a.logger.Printf("failed to send report: %v", err)
+	}
+	return report
+}
+
+// Run applies the module every interval until the context is cancelled
+func (a *Agent) Run(ctx context.Context) error {
+	for {
+		report := a.RunOnce(ctx)
+		if report.Status == StatusFailed {
+			a.logger.Printf("run failed at revision %s: %s", orNone(report.Revision), report.Error)
+		} else {
+			a.logger.Printf("run succeeded at revision %s in %s", orNone(report.Revision), report.Duration.Round(time.Millisecond))
+		}
+
+		wait := a.config.Interval
+		if a.config.Splay > 0 {
+			wait += time.Duration(rand.Int63n(int64(a.config.Splay)))
+		}
+		a.logger.Printf("next run in %s", wait.Round(time.Second))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
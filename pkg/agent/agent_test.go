@@ -0,0 +1,210 @@
+package agent
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "git", config: Config{Source: "https://github.com/org/infra.git", Dir: "/var/lib/forge"}},
+		{name: "git ssh", config: Config{Source: "git@github.com:org/infra", Dir: "/var/lib/forge"}},
+		{name: "git address", config: Config{Source: "git::https://github.com/org/infra.git//web?ref=v1.4.0", Dir: "/var/lib/forge"}},
+		{name: "invalid git address", config: Config{Source: "git::https://github.com/org/infra.git?ref=-x", Dir: "/var/lib/forge"}, wantErr: true},
+		{name: "http", config: Config{Source: "https://config.example.com/web.yaml", Dir: "/var/lib/forge"}},
+		{name: "missing source", config: Config{Dir: "/var/lib/forge"}, wantErr: true},
+		{name: "unsupported source", config: Config{Source: "/srv/module.yaml", Dir: "/var/lib/forge"}, wantErr: true},
+		{name: "missing dir", config: Config{Source: "https://config.example.com/web.yaml"}, wantErr: true},
+		{name: "negative interval", config: Config{Source: "https://config.example.com/web.yaml", Dir: "/d", Interval: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestHTTPSource_Fetch(t *testing.T) {
+	module := "kind: Module\n"
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, module)
+	}))
+
+	source, err := NewSource(Config{Source: server.URL + "/web.yaml", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, revision, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != module {
+		t.Errorf("module = %q, want %q", data, module)
+	}
+
+	// Unchanged modules are revalidated, then served from the cache when
+	// the server goes away
+	_, again, err := source.Fetch(context.Background())
+	if err != nil || again != revision {
+		t.Errorf("Fetch() = %s, %v, want revision %s", again, err, revision)
+	}
+	server.Close()
+	_, offline, err := source.Fetch(context.Background())
+	if err != nil || offline != revision {
+		t.Errorf("offline Fetch() = %s, %v, want revision %s", offline, err, revision)
+	}
+	if requests != 2 {
+		t.Errorf("requests = %d, want 2", requests)
+	}
+}
+
+func TestGitSource_Fetch(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	commit := func(content string) string {
+		if err := os.WriteFile(filepath.Join(repo, "web.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "web.yaml")
+		git("commit", "-q", "-m", "update")
+		return git("rev-parse", "HEAD")
+	}
+	git("init", "-q", "-b", "main")
+	first := commit("version: 1\n")
+
+	source, err := NewSource(Config{Source: "git+file://" + repo, Ref: "main", Module: "web.yaml", Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, revision, err := source.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if revision != first {
+		t.Errorf("revision = %s, want %s", revision, first)
+	}
+
+	second := commit("version: 2\n")
+	if _, revision, err = source.Fetch(context.Background()); err != nil || revision != second {
+		t.Errorf("Fetch() = %s, %v, want revision %s", revision, err, second)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "version: 2\n" {
+		t.Errorf("module = %q after pulling", data)
+	}
+
+	// A git address stays at the commit it names
+	pinned, err := NewSource(Config{Source: "git::file://" + repo + "//web.yaml?ref=" + first, Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, revision, err = pinned.Fetch(context.Background())
+	if err != nil || revision != first {
+		t.Fatalf("Fetch() = %s, %v, want revision %s", revision, err, first)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "version: 1\n" {
+		t.Errorf("module = %q at the pinned commit", data)
+	}
+	if _, err := NewSource(Config{Source: "git::file://" + repo, Ref: "main", Dir: t.TempDir()}); err == nil {
+		t.Error("NewSource() accepted a ref besides the one in the address")
+	}
+}
+
+func TestAgent_RunOnce(t *testing.T) {
+	modules := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "kind: Module\n")
+	}))
+	defer modules.Close()
+
+	var reports []Report
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var report Report
+		if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+			t.Errorf("failed to decode report: %v", err)
+		}
+		reports = append(reports, report)
+	}))
+	defer server.Close()
+
+	var applied []string
+	applyErr := error(nil)
+	apply := func(ctx context.Context, modulePath, revision string) error {
+		applied = append(applied, modulePath)
+		return applyErr
+	}
+	config := Config{Source: modules.URL + "/web.yaml", Dir: t.TempDir(), Node: "web1", ReportURL: server.URL, ReportToken: "token", Version: "1.4.2"}
+	agent, err := NewAgent(config, apply, log.New(io.Discard, "", 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := agent.RunOnce(context.Background())
+	if report.Status != StatusSucceeded || report.Revision == "" || len(applied) != 1 {
+		t.Errorf("RunOnce() = %+v, applied %v", report, applied)
+	}
+
+	applyErr = errors.New("apply failed on 1 host(s)")
+	report = agent.RunOnce(context.Background())
+	if report.Status != StatusFailed || report.Error != "apply failed on 1 host(s)" {
+		t.Errorf("RunOnce() = %+v", report)
+	}
+
+	if len(reports) != 2 || reports[0].Node != "web1" || reports[0].Status != StatusSucceeded || reports[1].Status != StatusFailed {
+		t.Errorf("reports = %+v", reports)
+	}
+	if reports[0].Version != "1.4.2" || reports[0].Protocol != ProtocolVersion {
+		t.Errorf("report version = %q, protocol %d", reports[0].Version, reports[0].Protocol)
+	}
+}
+
+func TestReporter_Refused(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUpgradeRequired)
+		io.WriteString(w, `{"error": "agent speaks protocol 9-9, server speaks 1-1; upgrade the server"}`)
+	}))
+	defer server.Close()
+
+	err := NewReporter(server.URL, "").Send(context.Background(), &Report{Node: "web1", Protocol: 9})
+	if err == nil || !strings.Contains(err.Error(), "upgrade the server") {
+		t.Errorf("Send() error = %v, want the server's reason", err)
+	}
+}
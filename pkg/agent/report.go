@@ -0,0 +1,91 @@
+package agent
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Run statuses
+const (
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+)
+
+// ProtocolVersion is the version of the report payload this agent sends.
+// The server refuses reports in a protocol it does not speak.
+const ProtocolVersion = 1
+
+// Report is sent to the central server after every run
+type Report struct {
+	Node string `json:"node"`
+	// Version is the forge release the agent runs, and Protocol the
+	// version of the payload. Reports without one are protocol 1.
+	Version   string        `json:"version,omitempty"`
+	Protocol  int           `json:"protocol,omitempty"`
+	Source    string        `json:"source"`
+	Revision  string        `json:"revision,omitempty"`
+	Status    string        `json:"status"`
+	Error     string        `json:"error,omitempty"`
+	StartedAt time.Time     `json:"started_at"`
+	Duration  time.Duration `json:"duration"`
+}
+
+func (r *Report) fail(err error) {
+	r.Status = StatusFailed
+	r.Error = err.Error()
+}
+
+// Reporter posts reports as JSON to the central server
+type Reporter struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewReporter creates a reporter; an empty URL sends nothing
+func NewReporter(url, token string) *Reporter {
+	return &Reporter{
+		url:    url,
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Send posts a report
+func (r *Reporter) Send(ctx context.Context, report *Report) error {
+	if r.url == "" {
+		return nil
+	}
+	body, err := json.Marshal(report)
+	if err != nil {
+		return fmt.Errorf("failed to encode report: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create report request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.token != "" {
+		req.Header.Set("Authorization", "Bearer "+r.token)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send report: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var refusal struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(resp.Body).Decode(&refusal) == nil && refusal.Error != "" {
+			return fmt.Errorf("report server returned %s: %s", resp.Status, refusal.Error)
+		}
+		return fmt.Errorf("report server returned %s", resp.Status)
+	}
+	return nil
+}
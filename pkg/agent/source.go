@@ -0,0 +1,208 @@
+package agent
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/gitsource"
+)
+
+// Source kinds
+const (
+	SourceGit  = "git"
+	SourceHTTP = "http"
+)
+
+// Source fetches the module an agent applies
+type Source interface {
+	// Fetch brings the local copy up to date and returns the path of the
+	// module file and the revision it is at
+	Fetch(ctx context.Context) (string, string, error)
+}
+
+// sourceKind tells git repositories from module files served over HTTP
+func sourceKind(source string) (string, error) {
+	switch {
+	case gitsource.IsAddress(source):
+		if _, err := gitsource.ParseAddress(source); err != nil {
+			return "", err
+		}
+		return SourceGit, nil
+	case gitsource.IsRepository(source):
+		return SourceGit, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return SourceHTTP, nil
+	default:
+		return "", fmt.Errorf("unsupported agent source %q, must be a git repository or an http(s) URL", source)
+	}
+}
+
+// NewSource returns the source for a configuration
+func NewSource(config Config) (Source, error) {
+	kind, err := sourceKind(config.Source)
+	if err != nil {
+		return nil, err
+	}
+	if gitsource.IsAddress(config.Source) {
+		if config.Ref != "" {
+			return nil, fmt.Errorf("the ref of agent source %s is set with ?ref= in the address", config.Source)
+		}
+		address, err := gitsource.ParseAddress(config.Source)
+		if err != nil {
+			return nil, err
+		}
+		return &AddressSource{
+			Address: address,
+			fetcher: gitsource.NewFetcher(filepath.Join(config.Dir, "git")),
+		}, nil
+	}
+	if kind == SourceGit {
+		return &GitSource{
+			URL:    strings.TrimPrefix(config.Source, "git+"),
+			Ref:    config.Ref,
+			Module: config.Module,
+			Dir:    filepath.Join(config.Dir, "checkout"),
+		}, nil
+	}
+	return &HTTPSource{
+		URL:    config.Source,
+		Path:   filepath.Join(config.Dir, "module.yaml"),
+		client: &http.Client{Timeout: 60 * time.Second},
+	}, nil
+}
+
+// GitSource keeps a shallow clone of a repository with the git command
+type GitSource struct {
+	URL    string
+	Ref    string
+	Module string
+	Dir    string
+}
+
+// Fetch clones the repository on first use and resets it to the latest
+// commit of the ref afterwards, discarding any local changes
+func (s *GitSource) Fetch(ctx context.Context) (string, string, error) {
+	if _, err := os.Stat(filepath.Join(s.Dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(s.Dir), 0755); err != nil {
+			return "", "", fmt.Errorf("failed to create %s: %w", filepath.Dir(s.Dir), err)
+		}
+		args := []string{"clone", "--depth", "1"}
+		if s.Ref != "" {
+			args = append(args, "--branch", s.Ref)
+		}
+		if _, err := gitsource.Git(ctx, "", append(args, "--", s.URL, s.Dir)...); err != nil {
+			return "", "", err
+		}
+	} else {
+		ref := s.Ref
+		if ref == "" {
+			ref = "HEAD"
+		}
+		if _, err := gitsource.Git(ctx, s.Dir, "fetch", "--depth", "1", "origin", ref); err != nil {
+			return "", "", err
+		}
+		if _, err := gitsource.Git(ctx, s.Dir, "reset", "--hard", "FETCH_HEAD"); err != nil {
+			return "", "", err
+		}
+	}
+
+	revision, err := gitsource.Git(ctx, s.Dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", "", err
+	}
+	return filepath.Join(s.Dir, s.Module), revision, nil
+}
+
+// AddressSource fetches a module named by a git address, such as
+// git::https://example.com/infra.git//web?ref=v1.4.0. A commit ref must be
+// the commit fetched, and signed=true requires a trusted signature.
+type AddressSource struct {
+	Address *gitsource.Address
+
+	fetcher *gitsource.Fetcher
+}
+
+// Fetch brings the checkout up to date with the ref of the address. The
+// revision is the commit checked out.
+func (s *AddressSource) Fetch(ctx context.Context) (string, string, error) {
+	checkout, err := s.fetcher.Fetch(ctx, s.Address)
+	if err != nil {
+		return "", "", err
+	}
+	return checkout.File, checkout.Commit, nil
+}
+
+// HTTPSource downloads a module file, revalidating the cached copy with its ETag
+type HTTPSource struct {
+	URL  string
+	Path string
+
+	client *http.Client
+	etag   string
+}
+
+// Fetch downloads the module when it changed. The revision is the SHA-256
+// of the module file. A cached copy is used when the server is unreachable.
+func (s *HTTPSource) Fetch(ctx context.Context) (string, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to create request: %w", err)
+	}
+	if s.etag != "" {
+		req.Header.Set("If-None-Match", s.etag)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		if revision, cacheErr := s.cached(); cacheErr == nil {
+			return s.Path, revision, nil
+		}
+		return "", "", fmt.Errorf("failed to download %s: %w", s.URL, err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		revision, err := s.cached()
+		return s.Path, revision, err
+	case http.StatusOK:
+	default:
+		return "", "", fmt.Errorf("failed to download %s: %s", s.URL, resp.Status)
+	}
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to download %s: %w", s.URL, err)
+	}
+	if err := os.MkdirAll(filepath.Dir(s.Path), 0755); err != nil {
+		return "", "", fmt.Errorf("failed to create %s: %w", filepath.Dir(s.Path), err)
+	}
+	if err := os.WriteFile(s.Path, data, 0600); err != nil {
+		return "", "", fmt.Errorf("failed to save module: %w", err)
+	}
+	s.etag = resp.Header.Get("ETag")
+	return s.Path, checksum(data), nil
+}
+
+// cached returns the revision of the last downloaded module
+func (s *HTTPSource) cached() (string, error) {
+	data, err := os.ReadFile(s.Path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read cached module: %w", err)
+	}
+	return checksum(data), nil
+}
+
+// checksum returns the abbreviated SHA-256 of data
+func checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])[:12]
+}
@@ -0,0 +1,213 @@
+// Package api exposes plan, apply and drift detection as a gRPC service, so
+// other tooling can drive forge and follow runs as they progress instead of
+// shelling out to the CLI.
+//
+// Messages are encoded as JSON rather than protocol buffers, so this is not a
+// service stock clients generated from a .proto file can call. Go programs
+// use Client; clients in other languages call the methods of ServiceName
+// (/forge.api.v1.Forge/Plan and so on) with a serializer that writes each
+// message as a JSON object with the fields of the types below. The server
+// reads JSON whether the content-type is application/grpc or
+// application/grpc+json. gRPC framing, metadata and status codes are
+// otherwise standard.
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"google.golang.org/grpc/encoding"
+)
+
+// ServiceName is the fully qualified name of the gRPC service
+const ServiceName = "forge.api.v1.Forge"
+
+// DefaultAddr is the address the API listens on unless configured
+// otherwise. It is only reachable from the machine the API runs on; other
+// addresses need a token.
+const DefaultAddr = "127.0.0.1:9090"
+
+// Run actions
+const (
+	ActionPlan  = "plan"
+	ActionApply = "apply"
+	ActionDrift = "drift"
+)
+
+// Run statuses reported once a run is over
+const (
+	StatusSucceeded = "succeeded"
+	StatusPartial   = "partial"
+	StatusFailed    = "failed"
+)
+
+var runIDPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// RunRequest asks for a module to be planned, applied or checked for drift
+type RunRequest struct {
+	// RunID tags the run's events; one is generated when empty. Clients
+	// choose it to subscribe to StreamEvents before starting the run.
+	RunID string `json:"run_id,omitempty"`
+	// Module is the module document
+	Module string `json:"module"`
+	// Inventory is the inventory document; without one the run targets the
+	// machine the API runs on
+	Inventory string   `json:"inventory,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	Hosts     []string `json:"hosts,omitempty"`
+}
+
+// Validate checks the request
+func (r *RunRequest) Validate() error {
+	if r.Module == "" {
+		return fmt.Errorf("module is required")
+	}
+	if r.RunID != "" && !runIDPattern.MatchString(r.RunID) {
+		return fmt.Errorf("invalid run id %q", r.RunID)
+	}
+	if r.Inventory == "" && (len(r.Groups) > 0 || len(r.Hosts) > 0) {
+		return fmt.Errorf("groups and hosts can only be selected from an inventory")
+	}
+	return nil
+}
+
+// Change is a planned or applied change to one resource
+type Change struct {
+	// Resource is the resource's type and name, as in file.motd
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	// Properties are the properties that differ from the desired state
+	Properties []string `json:"properties,omitempty"`
+	Error      string   `json:"error,omitempty"`
+	// Audit is set when the resource is only audited and the change is
+	// not applied
+	Audit bool `json:"audit,omitempty"`
+}
+
+// HostPlan is the plan for one host
+type HostPlan struct {
+	Host     string `json:"host"`
+	ToCreate int    `json:"to_create"`
+	ToUpdate int    `json:"to_update"`
+	ToDelete int    `json:"to_delete"`
+	// Deviations counts the audited resources that are not as described
+	Deviations int `json:"deviations,omitempty"`
+	// Changes lists the resources that are not up to date
+	Changes []Change `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// HasChanges reports whether the host is out of date, including audited
+// resources that deviate
+func (p HostPlan) HasChanges() bool {
+	return p.ToCreate+p.ToUpdate+p.ToDelete+p.Deviations > 0
+}
+
+// HostResult is the outcome of applying a plan on one host
+type HostResult struct {
+	Host    string   `json:"host"`
+	Status  string   `json:"status"`
+	Changes []Change `json:"changes,omitempty"`
+	Error   string   `json:"error,omitempty"`
+}
+
+// PlanResponse is the outcome of a plan
+type PlanResponse struct {
+	RunID      string     `json:"run_id"`
+	HasChanges bool       `json:"has_changes"`
+	Hosts      []HostPlan `json:"hosts"`
+	Error      string     `json:"error,omitempty"`
+}
+
+// ApplyResponse is the outcome of an apply
+type ApplyResponse struct {
+	RunID  string `json:"run_id"`
+	Status string `json:"status"`
+	// Plans are the plans that were applied
+	Plans []HostPlan   `json:"plans"`
+	Hosts []HostResult `json:"hosts,omitempty"`
+	Error string       `json:"error,omitempty"`
+}
+
+// DriftResponse is the outcome of a drift check
+type DriftResponse struct {
+	RunID   string `json:"run_id"`
+	Drifted bool   `json:"drifted"`
+	// Hosts lists the hosts that drifted or could not be checked
+	Hosts []HostPlan `json:"hosts,omitempty"`
+	Error string     `json:"error,omitempty"`
+}
+
+// StreamEventsRequest subscribes to events
+type StreamEventsRequest struct {
+	// RunID limits the stream to one run, which ends with it; without one
+	// events of every run are streamed until the client cancels
+	RunID string `json:"run_id,omitempty"`
+	// Types limits the stream to some event types
+	Types []string `json:"types,omitempty"`
+}
+
+// newHostPlan summarizes a host's plan
+func newHostPlan(host string, plan *core.Plan) HostPlan {
+	hostPlan := HostPlan{Host: host}
+	if plan == nil {
+		return hostPlan
+	}
+	summary := plan.Summary()
+	hostPlan.ToCreate = summary.ToCreate
+	hostPlan.ToUpdate = summary.ToUpdate
+	hostPlan.ToDelete = summary.ToDelete
+	hostPlan.Deviations = summary.Deviations
+	for _, change := range plan.Changes {
+		if change.Action == core.ActionNoOp && change.Error == nil {
+			continue
+		}
+		hostPlan.Changes = append(hostPlan.Changes, newChange(change, change.Error))
+	}
+	return hostPlan
+}
+
+// newChange describes a change; property values are left out since they
+// may hold secrets
+func newChange(change core.Change, err error) Change {
+	described := Change{
+		Resource: change.Resource.ResourceID(),
+		Action:   change.Action.String(),
+		Audit:    change.Audit,
+	}
+	if change.Diff != nil {
+		for property := range change.Diff.Changes {
+			described.Properties = append(described.Properties, property)
+		}
+		sort.Strings(described.Properties)
+	}
+	if err != nil {
+		described.Error = err.Error()
+	}
+	return described
+}
+
+// Codec encodes messages as JSON; it is registered for the "json" content-subtype
+type Codec struct{}
+
+// Marshal encodes a message
+func (Codec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes a message
+func (Codec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Name returns the content-subtype of the codec
+func (Codec) Name() string {
+	return "json"
+}
+
+func init() {
+	encoding.RegisterCodec(Codec{})
+}
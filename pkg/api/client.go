@@ -0,0 +1,102 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ataiva-software/forge/pkg/events"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client calls the API from Go
+type Client struct {
+	conn  grpc.ClientConnInterface
+	token string
+}
+
+// NewClient creates a client on an existing connection. The token is sent
+// as a bearer token when set.
+func NewClient(conn grpc.ClientConnInterface, token string) *Client {
+	return &Client{conn: conn, token: token}
+}
+
+// Dial connects a client to an API address without TLS
+func Dial(addr, token string) (*Client, *grpc.ClientConn, error) {
+	conn, err := grpc.NewClient(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to connect to %s: %w", addr, err)
+	}
+	return NewClient(conn, token), conn, nil
+}
+
+// Plan plans a module without changing any host
+func (c *Client) Plan(ctx context.Context, request *RunRequest) (*PlanResponse, error) {
+	response := new(PlanResponse)
+	if err := c.invoke(ctx, "Plan", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Apply plans a module and applies the plans
+func (c *Client) Apply(ctx context.Context, request *RunRequest) (*ApplyResponse, error) {
+	response := new(ApplyResponse)
+	if err := c.invoke(ctx, "Apply", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// Drift reports the hosts whose state no longer matches a module
+func (c *Client) Drift(ctx context.Context, request *RunRequest) (*DriftResponse, error) {
+	response := new(DriftResponse)
+	if err := c.invoke(ctx, "Drift", request, response); err != nil {
+		return nil, err
+	}
+	return response, nil
+}
+
+// StreamEvents calls handle with every event until the stream ends, which
+// for a stream of one run is when the run finishes
+func (c *Client) StreamEvents(ctx context.Context, request *StreamEventsRequest, handle func(*events.Event) error) error {
+	desc := &serviceDesc.Streams[0]
+	stream, err := c.conn.NewStream(c.context(ctx), desc, "/"+ServiceName+"/"+desc.StreamName, grpc.CallContentSubtype(Codec{}.Name()))
+	if err != nil {
+		return err
+	}
+	if err := stream.SendMsg(request); err != nil {
+		return err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	for {
+		event := new(events.Event)
+		if err := stream.RecvMsg(event); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+		if err := handle(event); err != nil {
+			return err
+		}
+	}
+}
+
+// invoke makes a unary call
+func (c *Client) invoke(ctx context.Context, method string, request, response interface{}) error {
+	return c.conn.Invoke(c.context(ctx), "/"+ServiceName+"/"+method, request, response, grpc.CallContentSubtype(Codec{}.Name()))
+}
+
+// context adds the token to outgoing calls
+func (c *Client) context(ctx context.Context) context.Context {
+	if c.token == "" {
+		return ctx
+	}
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+c.token)
+}
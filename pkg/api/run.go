@@ -0,0 +1,301 @@
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/limits"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// eventSource is the source of every event the API publishes
+const eventSource = "forge"
+
+// Run records the progress of one request. Every step is published as an
+// event and collected for the response. A nil Run records nothing, so code
+// shared with the CLI can report to one unconditionally.
+type Run struct {
+	ID      string
+	Action  string
+	publish func(*events.Event)
+
+	mu      sync.Mutex
+	plans   []HostPlan
+	results []HostResult
+	status  string
+}
+
+// newRun creates a run that publishes its events with publish
+func newRun(id, action string, publish func(*events.Event)) *Run {
+	if id == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		id = time.Now().UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+	}
+	return &Run{ID: id, Action: action, publish: publish}
+}
+
+// Planned records the plan of a host, or why it could not be planned
+func (r *Run) Planned(host string, plan *core.Plan, err error) {
+	if r == nil {
+		return
+	}
+	hostPlan := newHostPlan(host, plan)
+	if err != nil {
+		hostPlan.Error = err.Error()
+	}
+	r.mu.Lock()
+	r.plans = append(r.plans, hostPlan)
+	r.mu.Unlock()
+
+	if err != nil {
+		r.emit(events.EventTypePlanFailed, map[string]interface{}{"host": host, "plan": hostPlan, "error": err.Error()})
+		return
+	}
+	r.emit(events.EventTypePlanCompleted, map[string]interface{}{"host": host, "plan": hostPlan})
+	if r.Action == ActionDrift && hostPlan.HasChanges() {
+		r.emit(events.EventTypeDriftDetected, map[string]interface{}{"host": host, "changes": hostPlan.Changes})
+	}
+}
+
+// Applying records that the plans of hosts are about to be applied
+func (r *Run) Applying(hosts []string) {
+	if r == nil {
+		return
+	}
+	r.emit(events.EventTypeApplyStarted, map[string]interface{}{"hosts": hosts})
+}
+
+// Applied records the outcome of applying a host's plan
+func (r *Run) Applied(host string, result *core.ExecutionResult, err error) {
+	if r == nil {
+		return
+	}
+	hostResult := HostResult{Host: host, Status: string(executor.HostSucceeded)}
+	if result != nil {
+		for _, changeResult := range result.Changes {
+			change := newChange(changeResult.Change, changeResult.Error)
+			hostResult.Changes = append(hostResult.Changes, change)
+			eventType := events.EventTypeResourceCompleted
+			if !changeResult.Success {
+				eventType = events.EventTypeResourceFailed
+			}
+			r.emit(eventType, map[string]interface{}{"host": host, "change": change})
+		}
+	}
+	switch {
+	case errors.Is(err, executor.ErrHostUnreachable):
+		hostResult.Status = string(executor.HostUnreachable)
+		hostResult.Error = err.Error()
+	case err != nil:
+		hostResult.Status = string(executor.HostFailed)
+		hostResult.Error = err.Error()
+	case result != nil && result.Summary.Failed > 0:
+		hostResult.Status = string(executor.HostFailed)
+		hostResult.Error = fmt.Sprintf("%d change(s) failed", result.Summary.Failed)
+	}
+	r.mu.Lock()
+	r.results = append(r.results, hostResult)
+	r.mu.Unlock()
+
+	eventType := events.EventTypeApplyCompleted
+	if hostResult.Status != string(executor.HostSucceeded) {
+		eventType = events.EventTypeApplyFailed
+	}
+	r.emit(eventType, map[string]interface{}{"host": host, "result": hostResult})
+}
+
+// Output publishes a line a resource's command printed on a host while it
+// ran. Lines are not collected for the response.
+func (r *Run) Output(host string, line types.OutputLine) {
+	if r == nil {
+		return
+	}
+	r.emit(events.EventTypeResourceOutput, map[string]interface{}{
+		"host":     host,
+		"resource": line.Resource,
+		"stream":   line.Stream,
+		"line":     line.Line,
+	})
+}
+
+// SetStatus records the overall status of the run, which otherwise follows
+// from whether it returned an error
+func (r *Run) SetStatus(status string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.status = status
+	r.mu.Unlock()
+}
+
+// start announces the run
+func (r *Run) start() {
+	r.emit(events.EventTypePlanStarted, map[string]interface{}{"action": r.Action})
+}
+
+// finish closes the run with the error it returned, if any
+func (r *Run) finish(err error) string {
+	r.mu.Lock()
+	status := r.status
+	if err != nil {
+		status = StatusFailed
+	} else if status == "" {
+		status = StatusSucceeded
+	}
+	r.status = status
+	r.mu.Unlock()
+
+	data := map[string]interface{}{"status": status}
+	if err != nil {
+		data["error"] = err.Error()
+	}
+	r.emit(events.EventTypeRunFinished, data)
+	return status
+}
+
+// emit publishes an event tagged with the run
+func (r *Run) emit(eventType events.EventType, data map[string]interface{}) {
+	event := events.NewEvent(eventType, eventSource, data)
+	event.Tags["run_id"] = r.ID
+	event.Tags["action"] = r.Action
+	r.publish(event)
+}
+
+// sortedPlans returns the plans recorded so far in host order
+func (r *Run) sortedPlans() []HostPlan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	plans := append([]HostPlan{}, r.plans...)
+	sort.Slice(plans, func(i, j int) bool { return plans[i].Host < plans[j].Host })
+	return plans
+}
+
+// planResponse builds the response to a plan
+func (r *Run) planResponse(err error) *PlanResponse {
+	response := &PlanResponse{RunID: r.ID, Hosts: r.sortedPlans(), Error: errorString(err)}
+	for _, plan := range response.Hosts {
+		if plan.HasChanges() {
+			response.HasChanges = true
+		}
+	}
+	return response
+}
+
+// applyResponse builds the response to an apply
+func (r *Run) applyResponse(err error) *ApplyResponse {
+	r.mu.Lock()
+	results := append([]HostResult{}, r.results...)
+	status := r.status
+	r.mu.Unlock()
+	sort.Slice(results, func(i, j int) bool { return results[i].Host < results[j].Host })
+	return &ApplyResponse{RunID: r.ID, Status: status, Plans: r.sortedPlans(), Hosts: results, Error: errorString(err)}
+}
+
+// driftResponse builds the response to a drift check
+func (r *Run) driftResponse(err error) *DriftResponse {
+	response := &DriftResponse{RunID: r.ID, Error: errorString(err)}
+	for _, plan := range r.sortedPlans() {
+		if plan.HasChanges() {
+			response.Drifted = true
+		}
+		if plan.HasChanges() || plan.Error != "" {
+			response.Hosts = append(response.Hosts, plan)
+		}
+	}
+	return response
+}
+
+func errorString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// subscription is one StreamEvents call
+type subscription struct {
+	runID string
+	types map[events.EventType]bool
+	// events holds what the subscriber has yet to be sent, spilling to disk
+	// once it falls far behind
+	events *limits.Queue[*events.Event]
+	// dropped is closed when the subscriber fell too far behind
+	dropped chan struct{}
+}
+
+// wants reports whether the subscription streams an event
+func (s *subscription) wants(event *events.Event) bool {
+	if s.runID != "" && event.Tags["run_id"] != s.runID {
+		return false
+	}
+	return len(s.types) == 0 || s.types[event.Type] || event.Type == events.EventTypeRunFinished
+}
+
+// broker fans events out to subscriptions. Events slow subscribers fall
+// behind on are spilled to disk, and subscribers whose spilled events pass
+// the limit are dropped rather than holding up runs.
+type broker struct {
+	limits limits.Config
+	logger *log.Logger
+
+	mu            sync.Mutex
+	subscriptions map[*subscription]bool
+}
+
+func newBroker(config limits.Config, logger *log.Logger) *broker {
+	return &broker{limits: config, logger: logger, subscriptions: make(map[*subscription]bool)}
+}
+
+// subscribe starts a subscription
+func (b *broker) subscribe(request StreamEventsRequest) *subscription {
+	sub := &subscription{
+		runID: request.RunID,
+		types: make(map[events.EventType]bool),
+		events: limits.NewQueue[*events.Event](b.limits, func(format string, args ...interface{}) {
+			b.logger.Printf("event stream: "+format, args...)
+		}),
+		dropped: make(chan struct{}),
+	}
+	for _, eventType := range request.Types {
+		sub.types[events.EventType(eventType)] = true
+	}
+	b.mu.Lock()
+	b.subscriptions[sub] = true
+	b.mu.Unlock()
+	return sub
+}
+
+// unsubscribe ends a subscription
+func (b *broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	delete(b.subscriptions, sub)
+	b.mu.Unlock()
+	sub.events.Close()
+}
+
+// publish delivers an event to every subscription that wants it
+func (b *broker) publish(event *events.Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for sub := range b.subscriptions {
+		if !sub.wants(event) {
+			continue
+		}
+		if err := sub.events.Push(event); err != nil {
+			b.logger.Printf("event stream: dropping a subscriber: %v", err)
+			close(sub.dropped)
+			delete(b.subscriptions, sub)
+		}
+	}
+}
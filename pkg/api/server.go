@@ -0,0 +1,344 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/limits"
+	"github.com/ataiva-software/forge/pkg/server"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gopkg.in/yaml.v3"
+)
+
+// shutdownTimeout is how long in-flight calls may take to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// Config configures the API server
+type Config struct {
+	Addr string
+	// Token is required as a bearer token on every call when set. It must
+	// be set unless the API listens on a loopback address.
+	Token string
+	// Limits bounds the events kept for stream subscribers that fall behind
+	Limits limits.Config
+}
+
+// Job is a run ready to be carried out
+type Job struct {
+	Action    string
+	Request   *RunRequest
+	Module    *core.Module
+	Inventory *inventory.Inventory
+	// Run records the progress of the job
+	Run *Run
+}
+
+// RunFunc carries out a job. Plans are reported to the job's run as hosts
+// are planned, and results as they are applied; drift checks and plans must
+// not change the hosts.
+type RunFunc func(ctx context.Context, job Job) error
+
+// Service is the gRPC service implemented by Server
+type Service interface {
+	Plan(ctx context.Context, request *RunRequest) (*PlanResponse, error)
+	Apply(ctx context.Context, request *RunRequest) (*ApplyResponse, error)
+	Drift(ctx context.Context, request *RunRequest) (*DriftResponse, error)
+	StreamEvents(request *StreamEventsRequest, stream grpc.ServerStream) error
+}
+
+// Server serves the API
+type Server struct {
+	config Config
+	run    RunFunc
+	broker *broker
+	// slot is held by the run in progress; runs are carried out one at a time
+	slot   chan struct{}
+	done   chan struct{}
+	grpc   *grpc.Server
+	logger *log.Logger
+}
+
+// NewServer creates a server that carries out runs with run
+func NewServer(config Config, run RunFunc, logger *log.Logger) (*Server, error) {
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+	if config.Token == "" && !server.IsLoopback(config.Addr) {
+		return nil, fmt.Errorf("api.token is required to listen on %s; without one the API only listens on a loopback address such as %s", config.Addr, DefaultAddr)
+	}
+	if run == nil {
+		return nil, fmt.Errorf("a run function is required")
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	s := &Server{
+		config: config,
+		run:    run,
+		broker: newBroker(config.Limits, logger),
+		slot:   make(chan struct{}, 1),
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+	s.grpc = grpc.NewServer(
+		// Messages are JSON whatever content-subtype a client sends, so
+		// clients that always send application/grpc can call the API too
+		grpc.ForceServerCodec(Codec{}),
+		grpc.ChainUnaryInterceptor(s.authorizeUnary),
+		grpc.ChainStreamInterceptor(s.authorizeStream),
+	)
+	s.grpc.RegisterService(&serviceDesc, s)
+	return s, nil
+}
+
+// Serve serves the API on a listener until Stop is called
+func (s *Server) Serve(listener net.Listener) error {
+	return s.grpc.Serve(listener)
+}
+
+// ListenAndServe serves the API until the context is done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	listener, err := net.Listen("tcp", s.config.Addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on %s: %w", s.config.Addr, err)
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- s.Serve(listener)
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+	s.Stop()
+	return nil
+}
+
+// Stop ends event streams and waits for runs in progress to finish
+func (s *Server) Stop() {
+	select {
+	case <-s.done:
+		return
+	default:
+		close(s.done)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		s.grpc.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(shutdownTimeout):
+		s.grpc.Stop()
+	}
+}
+
+// Plan plans a module without changing any host
+func (s *Server) Plan(ctx context.Context, request *RunRequest) (*PlanResponse, error) {
+	run, err := s.execute(ctx, ActionPlan, request)
+	if run == nil {
+		return nil, err
+	}
+	return run.planResponse(err), nil
+}
+
+// Apply plans a module and applies the plans
+func (s *Server) Apply(ctx context.Context, request *RunRequest) (*ApplyResponse, error) {
+	run, err := s.execute(ctx, ActionApply, request)
+	if run == nil {
+		return nil, err
+	}
+	return run.applyResponse(err), nil
+}
+
+// Drift reports the hosts whose state no longer matches a module
+func (s *Server) Drift(ctx context.Context, request *RunRequest) (*DriftResponse, error) {
+	run, err := s.execute(ctx, ActionDrift, request)
+	if run == nil {
+		return nil, err
+	}
+	return run.driftResponse(err), nil
+}
+
+// StreamEvents sends events as runs progress
+func (s *Server) StreamEvents(request *StreamEventsRequest, stream grpc.ServerStream) error {
+	sub := s.broker.subscribe(*request)
+	defer s.broker.unsubscribe(sub)
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-s.done:
+			return status.Error(codes.Unavailable, "the server is shutting down")
+		case <-sub.dropped:
+			return status.Error(codes.ResourceExhausted, "the client fell too far behind the event stream")
+		case <-sub.events.Ready():
+			for {
+				event, ok, err := sub.events.Pop()
+				if err != nil {
+					return status.Error(codes.Internal, err.Error())
+				}
+				if !ok {
+					break
+				}
+				if err := stream.SendMsg(event); err != nil {
+					return err
+				}
+				if request.RunID != "" && event.Type == events.EventTypeRunFinished {
+					return nil
+				}
+			}
+		}
+	}
+}
+
+// execute carries out a run. A nil run means the request was rejected with
+// the returned status; otherwise the error is the one the run failed with.
+func (s *Server) execute(ctx context.Context, action string, request *RunRequest) (*Run, error) {
+	if err := request.Validate(); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	job, err := newJob(action, request)
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	select {
+	case s.slot <- struct{}{}:
+	case <-ctx.Done():
+		return nil, status.FromContextError(ctx.Err()).Err()
+	}
+	defer func() { <-s.slot }()
+
+	job.Run = newRun(request.RunID, action, s.broker.publish)
+	s.logger.Printf("%s %s started", action, job.Run.ID)
+	job.Run.start()
+	err = s.run(ctx, job)
+	outcome := job.Run.finish(err)
+	if err != nil {
+		s.logger.Printf("%s %s %s: %v", action, job.Run.ID, outcome, err)
+	} else {
+		s.logger.Printf("%s %s %s", action, job.Run.ID, outcome)
+	}
+	return job.Run, err
+}
+
+// newJob parses the documents of a request
+func newJob(action string, request *RunRequest) (Job, error) {
+	var module core.Module
+	if err := yaml.Unmarshal([]byte(request.Module), &module); err != nil {
+		return Job{}, fmt.Errorf("failed to parse module: %w", err)
+	}
+	if err := module.Validate(); err != nil {
+		return Job{}, fmt.Errorf("invalid module: %w", err)
+	}
+
+	inv := inventory.Local()
+	if request.Inventory != "" {
+		inv = &inventory.Inventory{}
+		if err := yaml.Unmarshal([]byte(request.Inventory), inv); err != nil {
+			return Job{}, fmt.Errorf("failed to parse inventory: %w", err)
+		}
+		if err := inv.Validate(); err != nil {
+			return Job{}, fmt.Errorf("invalid inventory: %w", err)
+		}
+		selected, err := inv.Select(request.Groups, request.Hosts)
+		if err != nil {
+			return Job{}, err
+		}
+		inv = selected
+	}
+	return Job{Action: action, Request: request, Module: &module, Inventory: inv}, nil
+}
+
+// authorize checks the bearer token of a call
+func (s *Server) authorize(ctx context.Context) error {
+	if s.config.Token == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, value := range md.Get("authorization") {
+		if subtle.ConstantTimeCompare([]byte(value), []byte("Bearer "+s.config.Token)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "a valid bearer token is required")
+}
+
+func (s *Server) authorizeUnary(ctx context.Context, request interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	if err := s.authorize(ctx); err != nil {
+		return nil, err
+	}
+	return handler(ctx, request)
+}
+
+func (s *Server) authorizeStream(srv interface{}, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := s.authorize(stream.Context()); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+// serviceDesc describes the service to gRPC in place of generated code
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*Service)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "Plan", Handler: unaryHandler("Plan", func(service Service, ctx context.Context, request *RunRequest) (interface{}, error) {
+			return service.Plan(ctx, request)
+		})},
+		{MethodName: "Apply", Handler: unaryHandler("Apply", func(service Service, ctx context.Context, request *RunRequest) (interface{}, error) {
+			return service.Apply(ctx, request)
+		})},
+		{MethodName: "Drift", Handler: unaryHandler("Drift", func(service Service, ctx context.Context, request *RunRequest) (interface{}, error) {
+			return service.Drift(ctx, request)
+		})},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "StreamEvents",
+			ServerStreams: true,
+			Handler: func(srv interface{}, stream grpc.ServerStream) error {
+				request := new(StreamEventsRequest)
+				if err := stream.RecvMsg(request); err != nil {
+					return err
+				}
+				return srv.(Service).StreamEvents(request, stream)
+			},
+		},
+	},
+}
+
+// unaryHandler decodes a run request and passes it through the interceptors to call
+func unaryHandler(method string, call func(Service, context.Context, *RunRequest) (interface{}, error)) grpc.MethodHandler {
+	return func(srv interface{}, ctx context.Context, decode func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+		request := new(RunRequest)
+		if err := decode(request); err != nil {
+			return nil, err
+		}
+		handler := func(ctx context.Context, request interface{}) (interface{}, error) {
+			return call(srv.(Service), ctx, request.(*RunRequest))
+		}
+		if interceptor == nil {
+			return handler(ctx, request)
+		}
+		info := &grpc.UnaryServerInfo{Server: srv, FullMethod: "/" + ServiceName + "/" + method}
+		return interceptor(ctx, request, info, handler)
+	}
+}
@@ -0,0 +1,261 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/limits"
+	"github.com/ataiva-software/forge/pkg/types"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const testModule = `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: file
+      name: motd
+      path: /etc/motd
+      content: hello
+`
+
+// fakeRun plans a change to file.motd on localhost and applies it
+func fakeRun(ctx context.Context, job Job) error {
+	plan := &core.Plan{Changes: []core.Change{{
+		Action:   core.ActionUpdate,
+		Resource: types.Resource{Type: "file", Name: "motd"},
+		Diff:     &types.ResourceDiff{Changes: map[string]interface{}{"content": "hello"}},
+	}}}
+	job.Run.Planned("localhost", plan, nil)
+	job.Run.Planned("db1", nil, errors.New("host unreachable"))
+	if job.Action != ActionApply {
+		return nil
+	}
+	job.Run.Applying([]string{"localhost"})
+	job.Run.Output("localhost", types.OutputLine{Resource: "shell.migrate", Stream: "stdout", Line: "migrating"})
+	job.Run.Applied("localhost", &core.ExecutionResult{Changes: []core.ChangeResult{{Change: plan.Changes[0], Success: true}}}, nil)
+	job.Run.SetStatus(StatusPartial)
+	return nil
+}
+
+func TestNewServer_RequiresToken(t *testing.T) {
+	noop := func(context.Context, Job) error { return nil }
+	if _, err := NewServer(Config{}, noop, nil); err != nil {
+		t.Errorf("NewServer() on the default address error = %v", err)
+	}
+	if _, err := NewServer(Config{Addr: ":9090"}, noop, nil); err == nil {
+		t.Error("NewServer() on every interface without a token expected an error")
+	}
+	if _, err := NewServer(Config{Addr: ":9090", Token: "s3cret"}, noop, nil); err != nil {
+		t.Errorf("NewServer() with a token error = %v", err)
+	}
+}
+
+func newTestClient(t *testing.T, token string, run RunFunc) (*Server, *Client) {
+	t.Helper()
+	srv, err := NewServer(Config{Token: token}, run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := bufconn.Listen(1 << 20)
+	go srv.Serve(listener)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return listener.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return srv, NewClient(conn, token)
+}
+
+func TestServer_Runs(t *testing.T) {
+	_, client := newTestClient(t, "", fakeRun)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	plan, err := client.Plan(ctx, &RunRequest{Module: testModule})
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	want := []HostPlan{
+		{Host: "db1", Error: "host unreachable"},
+		{Host: "localhost", ToUpdate: 1, Changes: []Change{{Resource: "file.motd", Action: "update", Properties: []string{"content"}}}},
+	}
+	if !plan.HasChanges || plan.RunID == "" || !reflect.DeepEqual(plan.Hosts, want) {
+		t.Errorf("Plan() = %+v", plan)
+	}
+
+	drift, err := client.Drift(ctx, &RunRequest{Module: testModule})
+	if err != nil {
+		t.Fatalf("Drift() error = %v", err)
+	}
+	if !drift.Drifted || len(drift.Hosts) != 2 {
+		t.Errorf("Drift() = %+v", drift)
+	}
+
+	apply, err := client.Apply(ctx, &RunRequest{Module: testModule})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if apply.Status != StatusPartial || len(apply.Hosts) != 1 || apply.Hosts[0].Status != "succeeded" {
+		t.Errorf("Apply() = %+v", apply)
+	}
+
+	_, err = client.Plan(ctx, &RunRequest{Module: "kind: [", RunID: "bad"})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("Plan() with an invalid module error = %v, want InvalidArgument", err)
+	}
+}
+
+// rawCodec sends and receives message bytes as they are, with no
+// content-subtype, as stock gRPC clients with their own serializers do
+type rawCodec struct{}
+
+func (rawCodec) Marshal(v interface{}) ([]byte, error)      { return v.([]byte), nil }
+func (rawCodec) Unmarshal(data []byte, v interface{}) error { *v.(*[]byte) = data; return nil }
+func (rawCodec) Name() string                               { return "" }
+
+func TestServer_PlainContentType(t *testing.T) {
+	_, client := newTestClient(t, "", fakeRun)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	request := []byte(fmt.Sprintf(`{"module": %q}`, testModule))
+	var response []byte
+	if err := client.conn.Invoke(ctx, "/"+ServiceName+"/Plan", request, &response, grpc.ForceCodec(rawCodec{})); err != nil {
+		t.Fatalf("Invoke() error = %v", err)
+	}
+	var plan PlanResponse
+	if err := json.Unmarshal(response, &plan); err != nil || !plan.HasChanges {
+		t.Errorf("Plan response = %s, error = %v", response, err)
+	}
+}
+
+func TestServer_RunError(t *testing.T) {
+	_, client := newTestClient(t, "", func(ctx context.Context, job Job) error {
+		return errors.New("planning failed on 1 host(s)")
+	})
+	apply, err := client.Apply(context.Background(), &RunRequest{Module: testModule})
+	if err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if apply.Status != StatusFailed || apply.Error != "planning failed on 1 host(s)" {
+		t.Errorf("Apply() = %+v", apply)
+	}
+}
+
+func TestServer_StreamEvents(t *testing.T) {
+	srv, client := newTestClient(t, "", fakeRun)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	received := make(chan []events.EventType, 1)
+	go func() {
+		var types []events.EventType
+		err := client.StreamEvents(ctx, &StreamEventsRequest{RunID: "run-1"}, func(event *events.Event) error {
+			if event.Tags["run_id"] != "run-1" {
+				t.Errorf("event of run %q", event.Tags["run_id"])
+			}
+			types = append(types, event.Type)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("StreamEvents() error = %v", err)
+		}
+		received <- types
+	}()
+
+	for subscribed := false; !subscribed; time.Sleep(10 * time.Millisecond) {
+		srv.broker.mu.Lock()
+		subscribed = len(srv.broker.subscriptions) == 1
+		srv.broker.mu.Unlock()
+	}
+	if _, err := client.Plan(ctx, &RunRequest{Module: testModule, RunID: "other"}); err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if _, err := client.Apply(ctx, &RunRequest{Module: testModule, RunID: "run-1"}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []events.EventType{
+		events.EventTypePlanStarted,
+		events.EventTypePlanCompleted,
+		events.EventTypePlanFailed,
+		events.EventTypeApplyStarted,
+		events.EventTypeResourceOutput,
+		events.EventTypeResourceCompleted,
+		events.EventTypeApplyCompleted,
+		events.EventTypeRunFinished,
+	}
+	select {
+	case got := <-received:
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("events = %v, want %v", got, want)
+		}
+	case <-ctx.Done():
+		t.Fatal("the stream did not end with the run")
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	_, client := newTestClient(t, "secret", fakeRun)
+	if _, err := client.Plan(context.Background(), &RunRequest{Module: testModule}); err != nil {
+		t.Fatalf("Plan() with the token error = %v", err)
+	}
+
+	client.token = "wrong"
+	_, err := client.Plan(context.Background(), &RunRequest{Module: testModule})
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("Plan() with a wrong token error = %v, want Unauthenticated", err)
+	}
+	err = client.StreamEvents(context.Background(), &StreamEventsRequest{}, func(*events.Event) error { return nil })
+	if status.Code(err) != codes.Unauthenticated {
+		t.Errorf("StreamEvents() with a wrong token error = %v, want Unauthenticated", err)
+	}
+}
+
+func TestBroker_SpillsSlowSubscribers(t *testing.T) {
+	b := newBroker(limits.Config{EventQueue: 2, EventSpillBytes: 512, SpillDir: t.TempDir()}, log.New(io.Discard, "", 0))
+	sub := b.subscribe(StreamEventsRequest{})
+	defer b.unsubscribe(sub)
+
+	for i := 0; i < 4; i++ {
+		b.publish(&events.Event{ID: fmt.Sprint(i), Type: events.EventTypeResourceOutput})
+	}
+	for i := 0; i < 4; i++ {
+		event, ok, err := sub.events.Pop()
+		if err != nil || !ok || event.ID != fmt.Sprint(i) {
+			t.Fatalf("Pop() = %+v, %v, %v, want event %d", event, ok, err, i)
+		}
+	}
+
+	// Past the spill limit the subscriber is dropped
+	for i := 0; i < 20; i++ {
+		b.publish(&events.Event{ID: fmt.Sprint(i), Type: events.EventTypeResourceOutput})
+	}
+	select {
+	case <-sub.dropped:
+	default:
+		t.Error("a subscriber past the spill limit was not dropped")
+	}
+}
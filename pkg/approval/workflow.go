@@ -2,11 +2,19 @@ package approval
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+// Buckets of the controller store that keep workflows and requests
+const (
+	workflowsBucket = "approval_workflows"
+	requestsBucket  = "approval_requests"
 )
 
 // Status represents the status of an approval request
@@ -84,6 +92,7 @@ type ApprovalManager struct {
 	workflows map[string]*Workflow
 	requests  map[string]*ApprovalRequest
 	enabled   bool
+	store     store.Store
 	mu        sync.RWMutex
 }
 
@@ -96,6 +105,64 @@ func NewApprovalManager() *ApprovalManager {
 	}
 }
 
+// Migrations upgrades the approval workflows and requests kept in a store
+func Migrations() []store.Migration {
+	return []store.Migration{
+		{
+			Version:     1,
+			Description: "keep approval workflows and requests in the store",
+			Up:          func(store.Store) error { return nil },
+		},
+	}
+}
+
+// UseStore migrates and loads the workflows and requests kept in a
+// controller store and keeps every later change there, so requests outlive
+// the process
+func (m *ApprovalManager) UseStore(s store.Store) error {
+	if _, err := store.Migrate(s, "approvals", Migrations()); err != nil {
+		return err
+	}
+	workflows, err := s.Keys(workflowsBucket)
+	if err != nil {
+		return err
+	}
+	requests, err := s.Keys(requestsBucket)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, name := range workflows {
+		var workflow Workflow
+		if err := store.GetJSON(s, workflowsBucket, name, &workflow); err != nil {
+			return err
+		}
+		m.workflows[name] = &workflow
+	}
+	for _, id := range requests {
+		var request ApprovalRequest
+		if err := store.GetJSON(s, requestsBucket, id, &request); err != nil {
+			return err
+		}
+		m.requests[id] = &request
+	}
+	m.store = s
+	return nil
+}
+
+// save keeps an object in the store, if there is one; the lock must be held
+func (m *ApprovalManager) save(bucket, key string, v interface{}) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := store.PutJSON(m.store, bucket, key, v); err != nil {
+		return fmt.Errorf("failed to save approval data: %w", err)
+	}
+	return nil
+}
+
 // IsEnabled returns whether approval workflows are enabled
 func (m *ApprovalManager) IsEnabled() bool {
 	m.mu.RLock()
@@ -135,10 +202,45 @@ func (m *ApprovalManager) CreateWorkflow(workflow *Workflow) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 	
+	if err := m.save(workflowsBucket, workflow.Name, workflow); err != nil {
+		return err
+	}
 	m.workflows[workflow.Name] = workflow
 	return nil
 }
 
+// ReplaceWorkflows makes the given workflows the only ones, such as those of
+// the configuration file, removing stored workflows that are not among them
+func (m *ApprovalManager) ReplaceWorkflows(workflows []*Workflow) error {
+	names := make(map[string]bool, len(workflows))
+	for _, workflow := range workflows {
+		for _, stage := range workflow.Stages {
+			if stage.Required < 1 || stage.Required > len(stage.Approvers) {
+				return fmt.Errorf("workflow %s: stage %s requires %d approval(s) of %d approver(s)", workflow.Name, stage.Name, stage.Required, len(stage.Approvers))
+			}
+		}
+		if err := m.CreateWorkflow(workflow); err != nil {
+			return fmt.Errorf("workflow %s: %w", workflow.Name, err)
+		}
+		names[workflow.Name] = true
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for name := range m.workflows {
+		if names[name] {
+			continue
+		}
+		if m.store != nil {
+			if err := m.store.Delete(workflowsBucket, name); err != nil && !errors.Is(err, store.ErrNotFound) {
+				return fmt.Errorf("failed to save approval data: %w", err)
+			}
+		}
+		delete(m.workflows, name)
+	}
+	return nil
+}
+
 // GetWorkflows returns all workflows
 func (m *ApprovalManager) GetWorkflows() []*Workflow {
 	m.mu.RLock()
@@ -211,8 +313,11 @@ func (m *ApprovalManager) SubmitRequest(ctx context.Context, user, action string
 	}
 	
 	m.mu.Lock()
+	defer m.mu.Unlock()
+	if err := m.save(requestsBucket, requestID, request); err != nil {
+		return "", err
+	}
 	m.requests[requestID] = request
-	m.mu.Unlock()
 	
 	return requestID, nil
 }
@@ -258,6 +363,9 @@ func (m *ApprovalManager) processApproval(ctx context.Context, requestID, approv
 	
 	if request.IsExpired() {
 		request.Status = StatusExpired
+		if err := m.save(requestsBucket, request.ID, request); err != nil {
+			return err
+		}
 		return fmt.Errorf("request has expired")
 	}
 	
@@ -296,7 +404,7 @@ func (m *ApprovalManager) processApproval(ctx context.Context, requestID, approv
 	// If rejected, mark as rejected
 	if decision == DecisionReject {
 		request.Status = StatusRejected
-		return nil
+		return m.save(requestsBucket, request.ID, request)
 	}
 	
 	// Check if current stage is complete
@@ -312,7 +420,7 @@ func (m *ApprovalManager) processApproval(ctx context.Context, requestID, approv
 		}
 	}
 	
-	return nil
+	return m.save(requestsBucket, request.ID, request)
 }
 
 // countStageApprovals counts approvals for a specific stage
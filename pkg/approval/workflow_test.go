@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/store"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
@@ -181,6 +182,52 @@ func TestApprovalManager_ApproveRequest(t *testing.T) {
 	}
 }
 
+func TestApprovalManager_UseStore(t *testing.T) {
+	kv := store.NewMemory()
+	manager := NewApprovalManager()
+	if err := manager.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	
+	workflow := &Workflow{
+		Name:   "two-stage",
+		Stages: []Stage{{Name: "review", Approvers: []string{"alice"}, Required: 1}, {Name: "ops", Approvers: []string{"bob"}, Required: 1}},
+	}
+	if err := manager.CreateWorkflow(workflow); err != nil {
+		t.Fatalf("Failed to create workflow: %v", err)
+	}
+	module := &core.Module{Metadata: core.ModuleMetadata{Name: "test"}}
+	ctx := context.Background()
+	requestID, err := manager.SubmitRequest(ctx, "user1", "apply", module)
+	if err != nil {
+		t.Fatalf("Failed to submit request: %v", err)
+	}
+	if err := manager.ApproveRequest(ctx, requestID, "alice", "ok"); err != nil {
+		t.Fatalf("Failed to approve request: %v", err)
+	}
+	
+	// A new manager picks up where the first one stopped
+	restarted := NewApprovalManager()
+	if err := restarted.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	request, err := restarted.GetRequest(requestID)
+	if err != nil {
+		t.Fatalf("Failed to get request: %v", err)
+	}
+	if request.Status != StatusPending || request.CurrentStage != 1 || len(request.Approvals) != 1 {
+		t.Errorf("Expected the request pending in its second stage, got %+v", request)
+	}
+	if err := restarted.ApproveRequest(ctx, requestID, "bob", "ok"); err != nil {
+		t.Fatalf("Failed to approve request: %v", err)
+	}
+	
+	var stored ApprovalRequest
+	if err := store.GetJSON(kv, requestsBucket, requestID, &stored); err != nil || stored.Status != StatusApproved {
+		t.Errorf("Expected the approval to be stored, got %s, %v", stored.Status, err)
+	}
+}
+
 func TestApprovalManager_RejectRequest(t *testing.T) {
 	manager := NewApprovalManager()
 	
@@ -458,3 +505,35 @@ func TestApprovalRequest_IsExpired(t *testing.T) {
 		t.Error("Expected request to not be expired")
 	}
 }
+
+func TestApprovalManager_ReplaceWorkflows(t *testing.T) {
+	kv := store.NewMemory()
+	manager := NewApprovalManager()
+	if err := manager.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	old := &Workflow{Name: "old", Stages: []Stage{{Name: "review", Approvers: []string{"alice"}, Required: 1}}}
+	if err := manager.CreateWorkflow(old); err != nil {
+		t.Fatalf("Failed to create workflow: %v", err)
+	}
+	
+	invalid := []*Workflow{{Name: "prod", Stages: []Stage{{Name: "review", Approvers: []string{"alice"}, Required: 2}}}}
+	if err := manager.ReplaceWorkflows(invalid); err == nil {
+		t.Error("Expected an error for a stage requiring more approvals than it has approvers")
+	}
+	
+	prod := []*Workflow{{
+		Name:       "prod",
+		Stages:     []Stage{{Name: "review", Approvers: []string{"alice", "bob"}, Required: 1}},
+		Conditions: []Condition{{Field: "environment", Operator: "equals", Value: "production"}},
+	}}
+	if err := manager.ReplaceWorkflows(prod); err != nil {
+		t.Fatalf("Failed to replace workflows: %v", err)
+	}
+	if workflows := manager.GetWorkflows(); len(workflows) != 1 || workflows[0].Name != "prod" {
+		t.Errorf("Expected only the prod workflow, got %+v", workflows)
+	}
+	if keys, _ := kv.Keys(workflowsBucket); len(keys) != 1 || keys[0] != "prod" {
+		t.Errorf("Expected only the prod workflow to be stored, got %v", keys)
+	}
+}
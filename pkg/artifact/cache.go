@@ -0,0 +1,215 @@
+// Package artifact downloads remote files on the controller once and serves
+// them to every target from a local cache.
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// DefaultCacheDir is where downloaded artifacts are kept between runs
+const DefaultCacheDir = ".chisel/artifacts"
+
+// Artifact is a downloaded file in the cache
+type Artifact struct {
+	URL    string
+	Path   string
+	SHA256 string
+	Size   int64
+}
+
+// fetch is a download shared by every caller asking for the same URL
+type fetch struct {
+	done     chan struct{}
+	artifact *Artifact
+	err      error
+}
+
+// Cache downloads artifacts once per run and keeps those pinned by a
+// checksum on disk across runs. It is safe for concurrent use.
+type Cache struct {
+	dir    string
+	client *http.Client
+
+	mu        sync.Mutex
+	fetches   map[string]*fetch
+	downloads int
+}
+
+// NewCache creates an artifact cache in dir
+func NewCache(dir string) *Cache {
+	return &Cache{
+		dir:     dir,
+		client:  http.DefaultClient,
+		fetches: make(map[string]*fetch),
+	}
+}
+
+// IsURL reports whether a source refers to a remote artifact rather than a local file
+func IsURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// Fetch returns the artifact for a URL, downloading it on first use.
+// Concurrent callers for the same URL share a single download. When checksum
+// is set, as a SHA-256 hex digest optionally prefixed with "sha256:", the
+// download is verified against it and a matching file from an earlier run is
+// reused.
+func (c *Cache) Fetch(ctx context.Context, rawURL, checksum string) (*Artifact, error) {
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	key := rawURL + "#" + checksum
+
+	c.mu.Lock()
+	if f, ok := c.fetches[key]; ok {
+		c.mu.Unlock()
+		select {
+		case <-f.done:
+			return f.artifact, f.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	f := &fetch{done: make(chan struct{})}
+	c.fetches[key] = f
+	c.mu.Unlock()
+
+	f.artifact, f.err = c.fetch(ctx, rawURL, checksum)
+	if f.err != nil {
+		// Forget failed downloads so a later call can retry
+		c.mu.Lock()
+		delete(c.fetches, key)
+		c.mu.Unlock()
+	}
+	close(f.done)
+
+	return f.artifact, f.err
+}
+
+// Resolve returns the artifact for a source: URLs are fetched through the
+// cache and local files are used in place. A nil cache only resolves local files.
+func (c *Cache) Resolve(ctx context.Context, source, checksum string) (*Artifact, error) {
+	if IsURL(source) {
+		if c == nil {
+			return nil, fmt.Errorf("cannot download %s without an artifact cache", source)
+		}
+		return c.Fetch(ctx, source, checksum)
+	}
+
+	artifact, err := inspect(source, source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", source, err)
+	}
+	checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:"))
+	if checksum != "" && artifact.SHA256 != checksum {
+		return nil, fmt.Errorf("%s has checksum %s, expected %s", source, artifact.SHA256, checksum)
+	}
+	return artifact, nil
+}
+
+// Downloads returns how many artifacts were downloaded rather than served from the cache
+func (c *Cache) Downloads() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.downloads
+}
+
+// fetch returns a pinned artifact from disk or downloads it
+func (c *Cache) fetch(ctx context.Context, rawURL, checksum string) (*Artifact, error) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !IsURL(rawURL) {
+		return nil, fmt.Errorf("invalid artifact URL %s", rawURL)
+	}
+	name := path.Base(parsed.Path)
+	if name == "." || name == "/" {
+		name = "artifact"
+	}
+	sum := sha256.Sum256([]byte(rawURL))
+	target := filepath.Join(c.dir, hex.EncodeToString(sum[:8]), name)
+
+	if checksum != "" {
+		if artifact, err := inspect(rawURL, target); err == nil && artifact.SHA256 == checksum {
+			return artifact, nil
+		}
+	}
+
+	if err := c.download(ctx, rawURL, target); err != nil {
+		return nil, err
+	}
+	artifact, err := inspect(rawURL, target)
+	if err != nil {
+		return nil, err
+	}
+	if checksum != "" && artifact.SHA256 != checksum {
+		os.Remove(target)
+		return nil, fmt.Errorf("artifact %s has checksum %s, expected %s", rawURL, artifact.SHA256, checksum)
+	}
+	return artifact, nil
+}
+
+// download writes a URL to target through a temporary file
+func (c *Cache) download(ctx context.Context, rawURL, target string) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create artifact cache: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), ".download-*")
+	if err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, resp.Body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+
+	c.mu.Lock()
+	c.downloads++
+	c.mu.Unlock()
+	return nil
+}
+
+// inspect checksums a cached file
+func inspect(rawURL, name string) (*Artifact, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read artifact %s: %w", name, err)
+	}
+	return &Artifact{URL: rawURL, Path: name, SHA256: hex.EncodeToString(h.Sum(nil)), Size: size}, nil
+}
@@ -0,0 +1,149 @@
+package artifact
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+const payload = "release-1.2.3"
+
+func payloadSum() string {
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// newServer serves payload and counts requests
+func newServer(t *testing.T) (*httptest.Server, *int32) {
+	t.Helper()
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if r.URL.Path == "/missing.tar.gz" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(payload))
+	}))
+	t.Cleanup(server.Close)
+	return server, &requests
+}
+
+func TestCache_FetchOnce(t *testing.T) {
+	server, requests := newServer(t)
+	cache := NewCache(t.TempDir())
+	url := server.URL + "/app-1.2.3.tar.gz"
+
+	// Many hosts asking at once share one download
+	var wg sync.WaitGroup
+	artifacts := make([]*Artifact, 50)
+	for i := range artifacts {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			artifact, err := cache.Fetch(context.Background(), url, "")
+			if err != nil {
+				t.Errorf("Fetch() error = %v", err)
+				return
+			}
+			artifacts[i] = artifact
+		}(i)
+	}
+	wg.Wait()
+
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("Expected 1 download, got %d", got)
+	}
+	if artifacts[0].SHA256 != payloadSum() || artifacts[0].Size != int64(len(payload)) {
+		t.Errorf("artifact = %+v", artifacts[0])
+	}
+	if filepath.Base(artifacts[0].Path) != "app-1.2.3.tar.gz" {
+		t.Errorf("Expected the file name to be kept, got %s", artifacts[0].Path)
+	}
+}
+
+func TestCache_PinnedArtifactsPersist(t *testing.T) {
+	server, requests := newServer(t)
+	dir := t.TempDir()
+	url := server.URL + "/app.tar.gz"
+
+	if _, err := NewCache(dir).Fetch(context.Background(), url, "sha256:"+payloadSum()); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+
+	// A later run reuses the pinned download
+	cache := NewCache(dir)
+	if _, err := cache.Fetch(context.Background(), url, payloadSum()); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if got := atomic.LoadInt32(requests); got != 1 {
+		t.Errorf("Expected pinned artifact to be reused, got %d downloads", got)
+	}
+	if cache.Downloads() != 0 {
+		t.Errorf("Downloads() = %d, want 0", cache.Downloads())
+	}
+
+	// Unpinned artifacts are downloaded again
+	if _, err := cache.Fetch(context.Background(), url, ""); err != nil {
+		t.Fatalf("Fetch() error = %v", err)
+	}
+	if cache.Downloads() != 1 {
+		t.Errorf("Downloads() = %d, want 1", cache.Downloads())
+	}
+}
+
+func TestCache_FetchErrors(t *testing.T) {
+	server, _ := newServer(t)
+	cache := NewCache(t.TempDir())
+
+	tests := []struct {
+		name     string
+		url      string
+		checksum string
+		wantErr  string
+	}{
+		{name: "not found", url: server.URL + "/missing.tar.gz", wantErr: "404"},
+		{name: "checksum mismatch", url: server.URL + "/app.tar.gz", checksum: strings.Repeat("0", 64), wantErr: "expected"},
+		{name: "not a URL", url: "ftp://example.com/app.tar.gz", wantErr: "invalid artifact URL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := cache.Fetch(context.Background(), tt.url, tt.checksum)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Fetch() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCache_Resolve(t *testing.T) {
+	local := filepath.Join(t.TempDir(), "app.tar.gz")
+	if err := os.WriteFile(local, []byte(payload), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var cache *Cache
+	artifact, err := cache.Resolve(context.Background(), local, payloadSum())
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if artifact.Path != local {
+		t.Errorf("Expected local files to be used in place, got %s", artifact.Path)
+	}
+
+	if _, err := cache.Resolve(context.Background(), local, strings.Repeat("0", 64)); err == nil {
+		t.Error("Expected error for checksum mismatch")
+	}
+	if _, err := cache.Resolve(context.Background(), "https://example.com/app.tar.gz", ""); err == nil {
+		t.Error("Expected error for URL without a cache")
+	}
+}
@@ -0,0 +1,152 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// DefaultValueLimit is the longest value, in bytes, a diff summary keeps
+// before truncating it
+const DefaultValueLimit = 256
+
+// DiffSummary stands in for the changes of a resource in an audit entry,
+// which can be whole files
+type DiffSummary struct {
+	// Count is the number of changed properties
+	Count int `json:"count"`
+	// Keys are the changed properties, sorted
+	Keys   []string                 `json:"keys"`
+	Values map[string]ChangeSummary `json:"values,omitempty"`
+	// Blob references the full changes when they were stored, see DiffBlobs
+	Blob string `json:"blob,omitempty"`
+}
+
+// ChangeSummary is the old and new value of a changed property, truncated
+// past the value limit; the hashes of truncated values still tell two
+// values apart
+type ChangeSummary struct {
+	From      string `json:"from,omitempty"`
+	To        string `json:"to,omitempty"`
+	FromHash  string `json:"from_hash,omitempty"`
+	ToHash    string `json:"to_hash,omitempty"`
+	Truncated bool   `json:"truncated,omitempty"`
+}
+
+// SummarizeChanges summarizes the changes of a resource diff, keeping at
+// most limit bytes of each value
+func SummarizeChanges(changes map[string]interface{}, limit int) *DiffSummary {
+	if len(changes) == 0 {
+		return nil
+	}
+	summary := &DiffSummary{Count: len(changes), Values: make(map[string]ChangeSummary, len(changes))}
+	for key, change := range changes {
+		summary.Keys = append(summary.Keys, key)
+
+		var from, to interface{}
+		if fromTo, ok := change.(map[string]interface{}); ok {
+			from, to = fromTo["from"], fromTo["to"]
+		} else {
+			to = change
+		}
+		var value ChangeSummary
+		value.From, value.FromHash = truncateValue(from, limit)
+		value.To, value.ToHash = truncateValue(to, limit)
+		value.Truncated = value.FromHash != "" || value.ToHash != ""
+		summary.Values[key] = value
+	}
+	sort.Strings(summary.Keys)
+	return summary
+}
+
+// truncateValue formats a value, cutting it at limit bytes and returning
+// the hash of the whole value when it was cut
+func truncateValue(value interface{}, limit int) (string, string) {
+	if value == nil {
+		return "", ""
+	}
+	var text string
+	if v := reflect.ValueOf(value); v.Kind() == reflect.String {
+		text = v.String()
+	} else {
+		data, err := json.Marshal(value)
+		if err != nil {
+			text = fmt.Sprint(value)
+		} else {
+			text = string(data)
+		}
+	}
+	if limit <= 0 || len(text) <= limit {
+		return text, ""
+	}
+	cut := strings.ToValidUTF8(text[:limit], "")
+	return cut + "...", HashBytes([]byte(text))
+}
+
+// Sealer encrypts the full diffs stored beside the audit log, bound to
+// their reference
+type Sealer interface {
+	Seal(data []byte, name string) ([]byte, error)
+	Open(data []byte, name string) ([]byte, error)
+}
+
+// DiffBlobs stores full resource diffs as encrypted files in a directory,
+// named by the hash of their contents, so audit entries can reference them
+// without embedding them
+type DiffBlobs struct {
+	dir    string
+	sealer Sealer
+}
+
+// NewDiffBlobs creates a store of full diffs in dir, encrypted with sealer
+func NewDiffBlobs(dir string, sealer Sealer) *DiffBlobs {
+	return &DiffBlobs{dir: dir, sealer: sealer}
+}
+
+// Put stores the changes of a resource and returns their reference
+func (b *DiffBlobs) Put(changes map[string]interface{}) (string, error) {
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode diff: %w", err)
+	}
+	ref := HashBytes(data)
+	sealed, err := b.sealer.Seal(data, "audit-diffs/"+ref)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt diff: %w", err)
+	}
+	if err := os.MkdirAll(b.dir, 0700); err != nil {
+		return "", fmt.Errorf("failed to create diff directory: %w", err)
+	}
+	if err := os.WriteFile(b.path(ref), sealed, 0600); err != nil {
+		return "", fmt.Errorf("failed to write diff: %w", err)
+	}
+	return ref, nil
+}
+
+// Get reads the changes stored under a reference
+func (b *DiffBlobs) Get(ref string) (map[string]interface{}, error) {
+	if ref == "" || strings.Trim(ref, "0123456789abcdef") != "" {
+		return nil, fmt.Errorf("invalid diff reference '%s'", ref)
+	}
+	sealed, err := os.ReadFile(b.path(ref))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read diff: %w", err)
+	}
+	data, err := b.sealer.Open(sealed, "audit-diffs/"+ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt diff %s: %w", ref, err)
+	}
+	var changes map[string]interface{}
+	if err := json.Unmarshal(data, &changes); err != nil {
+		return nil, fmt.Errorf("failed to decode diff %s: %w", ref, err)
+	}
+	return changes, nil
+}
+
+func (b *DiffBlobs) path(ref string) string {
+	return filepath.Join(b.dir, ref+".json")
+}
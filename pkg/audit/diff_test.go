@@ -0,0 +1,111 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestSummarizeChanges(t *testing.T) {
+	content := strings.Repeat("x", 300)
+	summary := SummarizeChanges(map[string]interface{}{
+		"content": map[string]interface{}{"from": "old\n", "to": content},
+		"state":   map[string]interface{}{"from": types.StateAbsent, "to": types.StatePresent},
+		"groups":  []interface{}{"wheel", "docker"},
+	}, 20)
+
+	if summary.Count != 3 || !reflect.DeepEqual(summary.Keys, []string{"content", "groups", "state"}) {
+		t.Errorf("summary = %d changes of %v", summary.Count, summary.Keys)
+	}
+	tests := []struct {
+		key  string
+		want ChangeSummary
+	}{
+		{key: "content", want: ChangeSummary{From: "old\n", To: strings.Repeat("x", 20) + "...", ToHash: HashBytes([]byte(content)), Truncated: true}},
+		{key: "state", want: ChangeSummary{From: "absent", To: "present"}},
+		{key: "groups", want: ChangeSummary{To: `["wheel","docker"]`}},
+	}
+	for _, tt := range tests {
+		if got := summary.Values[tt.key]; got != tt.want {
+			t.Errorf("%s = %+v, want %+v", tt.key, got, tt.want)
+		}
+	}
+
+	if SummarizeChanges(nil, 16) != nil {
+		t.Error("SummarizeChanges(nil) is not nil")
+	}
+	// Truncation does not split a character
+	if got := SummarizeChanges(map[string]interface{}{"motd": "héllo"}, 2).Values["motd"].To; got != "h..." {
+		t.Errorf("truncated %q", got)
+	}
+}
+
+// reverseSealer stands in for encryption by reversing data
+type reverseSealer struct{}
+
+func reverse(data []byte) []byte {
+	out := make([]byte, len(data))
+	for i, b := range data {
+		out[len(data)-1-i] = b
+	}
+	return out
+}
+
+func (reverseSealer) Seal(data []byte, name string) ([]byte, error) { return reverse(data), nil }
+func (reverseSealer) Open(data []byte, name string) ([]byte, error) { return reverse(data), nil }
+
+func TestAuditLogger_FullDiffs(t *testing.T) {
+	dir := t.TempDir()
+	logger := NewAuditLogger(filepath.Join(dir, "audit.log"))
+	defer logger.Close()
+	blobs := NewDiffBlobs(filepath.Join(dir, "diffs"), reverseSealer{})
+	logger.SetDiffBlobs(blobs)
+	logger.SetValueLimit(8)
+
+	changes := map[string]interface{}{"content": map[string]interface{}{"from": "", "to": "password=hunter2\n"}}
+	resource := &types.Resource{Type: "file", Name: "app"}
+	diff := &types.ResourceDiff{Action: types.ActionUpdate, Changes: changes}
+	if err := logger.LogHostResourceChange(context.Background(), "web1", resource, diff, true, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("hunter2")) {
+		t.Errorf("audit log holds the full diff: %s", data)
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.Host != "web1" || entry.Changes != nil || entry.Diff == nil || entry.Diff.Blob == "" {
+		t.Fatalf("entry = %+v", entry)
+	}
+
+	blob, err := os.ReadFile(filepath.Join(dir, "diffs", entry.Diff.Blob+".json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(blob, []byte("hunter2")) {
+		t.Error("diff blob is not sealed")
+	}
+	full, err := blobs.Get(entry.Diff.Blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(full, changes) {
+		t.Errorf("Get() = %v, want %v", full, changes)
+	}
+	if _, err := blobs.Get("../audit"); err == nil {
+		t.Error("Get() accepted a path as reference")
+	}
+}
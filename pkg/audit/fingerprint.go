@@ -0,0 +1,121 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"time"
+)
+
+// Fingerprint describes the environment an execution ran in, so a past run
+// can be reproduced or analyzed after the fact
+type Fingerprint struct {
+	ControllerVersion string    `json:"controller_version" yaml:"controller_version"`
+	ModuleHash        string    `json:"module_hash,omitempty" yaml:"module_hash,omitempty"`
+	ModuleSource      string    `json:"module_source,omitempty" yaml:"module_source,omitempty"`
+	ModuleRevision    string    `json:"module_revision,omitempty" yaml:"module_revision,omitempty"`
+	InventoryHash     string    `json:"inventory_hash,omitempty" yaml:"inventory_hash,omitempty"`
+	PolicyHash        string    `json:"policy_hash,omitempty" yaml:"policy_hash,omitempty"`
+	GoVersion         string    `json:"go_version" yaml:"go_version"`
+	OS                string    `json:"os" yaml:"os"`
+	Arch              string    `json:"arch" yaml:"arch"`
+	Hostname          string    `json:"hostname,omitempty" yaml:"hostname,omitempty"`
+	CreatedAt         time.Time `json:"created_at" yaml:"created_at"`
+}
+
+// FingerprintOptions lists the inputs of an execution to fingerprint
+type FingerprintOptions struct {
+	ControllerVersion string
+	ModuleFile        string
+	// ModuleSource and ModuleRevision record where a module fetched from
+	// version control came from and the commit it was at
+	ModuleSource   string
+	ModuleRevision string
+	InventoryFile  string
+	PolicyFiles    []string
+}
+
+// NewFingerprint captures the controller environment and hashes the execution inputs.
+// Inputs that are not set are left empty.
+func NewFingerprint(opts FingerprintOptions) (*Fingerprint, error) {
+	fingerprint := &Fingerprint{
+		ControllerVersion: opts.ControllerVersion,
+		ModuleSource:      opts.ModuleSource,
+		ModuleRevision:    opts.ModuleRevision,
+		GoVersion:         runtime.Version(),
+		OS:                runtime.GOOS,
+		Arch:              runtime.GOARCH,
+		CreatedAt:         time.Now(),
+	}
+
+	if hostname, err := os.Hostname(); err == nil {
+		fingerprint.Hostname = hostname
+	}
+
+	var err error
+	if opts.ModuleFile != "" {
+		if fingerprint.ModuleHash, err = HashFile(opts.ModuleFile); err != nil {
+			return nil, fmt.Errorf("failed to hash module: %w", err)
+		}
+	}
+	if opts.InventoryFile != "" {
+		if fingerprint.InventoryHash, err = HashFile(opts.InventoryFile); err != nil {
+			return nil, fmt.Errorf("failed to hash inventory: %w", err)
+		}
+	}
+	if len(opts.PolicyFiles) > 0 {
+		if fingerprint.PolicyHash, err = HashFiles(opts.PolicyFiles); err != nil {
+			return nil, fmt.Errorf("failed to hash policy set: %w", err)
+		}
+	}
+
+	return fingerprint, nil
+}
+
+// ID returns a digest identifying the fingerprinted inputs and environment.
+// The capture time and hostname are not part of the ID.
+func (f *Fingerprint) ID() string {
+	h := sha256.New()
+	for _, part := range []string{f.ControllerVersion, f.ModuleHash, f.InventoryHash, f.PolicyHash, f.GoVersion, f.OS, f.Arch} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// HashBytes returns the hex encoded SHA-256 digest of data
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// HashFile returns the hex encoded SHA-256 digest of a file's contents
+func HashFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	return HashBytes(data), nil
+}
+
+// HashFiles returns a single digest over a set of files, independent of the order given
+func HashFiles(paths []string) (string, error) {
+	sorted := append([]string{}, paths...)
+	sort.Strings(sorted)
+
+	h := sha256.New()
+	for _, path := range sorted {
+		fileHash, err := HashFile(path)
+		if err != nil {
+			return "", err
+		}
+		h.Write([]byte(path))
+		h.Write([]byte{0})
+		h.Write([]byte(fileHash))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
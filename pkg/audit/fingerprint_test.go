@@ -0,0 +1,113 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func writeTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestNewFingerprint(t *testing.T) {
+	tempDir := t.TempDir()
+	module := writeTestFile(t, tempDir, "module.yaml", "kind: Module\n")
+	inventory := writeTestFile(t, tempDir, "inventory.yaml", "kind: Inventory\n")
+	policyA := writeTestFile(t, tempDir, "a.rego", "package a\n")
+	policyB := writeTestFile(t, tempDir, "b.rego", "package b\n")
+
+	fingerprint, err := NewFingerprint(FingerprintOptions{
+		ControllerVersion: "1.2.3",
+		ModuleFile:        module,
+		InventoryFile:     inventory,
+		PolicyFiles:       []string{policyA, policyB},
+	})
+	if err != nil {
+		t.Fatalf("NewFingerprint() error = %v", err)
+	}
+
+	if fingerprint.ControllerVersion != "1.2.3" {
+		t.Errorf("Expected controller version 1.2.3, got %s", fingerprint.ControllerVersion)
+	}
+	if fingerprint.ModuleHash != HashBytes([]byte("kind: Module\n")) {
+		t.Errorf("Unexpected module hash %s", fingerprint.ModuleHash)
+	}
+	if fingerprint.InventoryHash == "" || fingerprint.PolicyHash == "" {
+		t.Error("Expected inventory and policy hashes to be set")
+	}
+	if fingerprint.GoVersion != runtime.Version() || fingerprint.OS != runtime.GOOS || fingerprint.Arch != runtime.GOARCH {
+		t.Error("Expected Go and OS details to match the runtime")
+	}
+
+	// Policy set hash does not depend on the order files are given in
+	reordered, err := NewFingerprint(FingerprintOptions{
+		ControllerVersion: "1.2.3",
+		ModuleFile:        module,
+		InventoryFile:     inventory,
+		PolicyFiles:       []string{policyB, policyA},
+	})
+	if err != nil {
+		t.Fatalf("NewFingerprint() error = %v", err)
+	}
+	if reordered.ID() != fingerprint.ID() {
+		t.Error("Expected identical inputs to produce the same fingerprint ID")
+	}
+
+	// Changing an input changes the ID
+	writeTestFile(t, tempDir, "module.yaml", "kind: Module\nchanged: true\n")
+	changed, err := NewFingerprint(FingerprintOptions{ControllerVersion: "1.2.3", ModuleFile: module, InventoryFile: inventory, PolicyFiles: []string{policyA, policyB}})
+	if err != nil {
+		t.Fatalf("NewFingerprint() error = %v", err)
+	}
+	if changed.ID() == fingerprint.ID() {
+		t.Error("Expected a changed module to produce a different fingerprint ID")
+	}
+}
+
+func TestNewFingerprint_MissingFile(t *testing.T) {
+	_, err := NewFingerprint(FingerprintOptions{ModuleFile: filepath.Join(t.TempDir(), "missing.yaml")})
+	if err == nil {
+		t.Error("Expected error for missing module file")
+	}
+}
+
+func TestAuditLogger_LogExecution(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := NewAuditLogger(logPath)
+	defer logger.Close()
+
+	fingerprint, err := NewFingerprint(FingerprintOptions{ControllerVersion: "dev"})
+	if err != nil {
+		t.Fatalf("NewFingerprint() error = %v", err)
+	}
+
+	if err := logger.LogExecution(context.Background(), "web", fingerprint, true, nil, nil); err != nil {
+		t.Fatalf("LogExecution() error = %v", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatalf("Failed to read audit log: %v", err)
+	}
+
+	var entry AuditEntry
+	if err := json.Unmarshal(data, &entry); err != nil {
+		t.Fatalf("Failed to parse audit entry: %v", err)
+	}
+
+	if entry.EventType != EventTypeExecution {
+		t.Errorf("Expected event type %s, got %s", EventTypeExecution, entry.EventType)
+	}
+	if entry.Fingerprint == nil || entry.Fingerprint.ID() != fingerprint.ID() {
+		t.Error("Expected fingerprint to be recorded in the audit entry")
+	}
+}
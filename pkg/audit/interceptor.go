@@ -0,0 +1,44 @@
+package audit
+
+import (
+	"context"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Interceptor returns an interceptor recording every apply a provider
+// makes as it happens, with how long it took and how it failed, so an
+// interrupted run still leaves a record of what it changed. Reads and
+// diffs change nothing and are not recorded. A record that cannot be
+// written is passed to onError rather than failing the change.
+func (l *AuditLogger) Interceptor(onError func(error)) types.Interceptor {
+	return func(ctx context.Context, op *types.Operation, next types.Invoker) (*types.OperationResult, error) {
+		result, err := next(ctx, op)
+		if op.Kind != types.OperationApply || !l.IsEnabled() {
+			return result, err
+		}
+
+		entry := &AuditEntry{
+			Timestamp:  time.Now(),
+			EventType:  EventTypeProviderApply,
+			Host:       op.Host,
+			ResourceID: op.Resource.ResourceID(),
+			Success:    err == nil,
+			Metadata:   map[string]interface{}{"duration_ms": time.Since(op.Started).Milliseconds()},
+		}
+		if op.Diff != nil {
+			entry.Action = string(op.Diff.Action)
+		}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		if user := getUserFromContext(ctx); user != "" {
+			entry.User = user
+		}
+		if writeErr := l.writeEntry(entry); writeErr != nil && onError != nil {
+			onError(writeErr)
+		}
+		return result, err
+	}
+}
@@ -22,6 +22,8 @@ const (
 	EventTypeSystemEvent      EventType = "system_event"
 	EventTypeAuthentication   EventType = "authentication"
 	EventTypeAuthorization    EventType = "authorization"
+	EventTypeExecution        EventType = "execution"
+	EventTypeProviderApply    EventType = "provider_apply"
 )
 
 // AuditEntry represents a single audit log entry
@@ -30,16 +32,21 @@ type AuditEntry struct {
 	EventType       EventType              `json:"event_type"`
 	User            string                 `json:"user,omitempty"`
 	Action          string                 `json:"action,omitempty"`
+	Host            string                 `json:"host,omitempty"`
 	ResourceID      string                 `json:"resource_id,omitempty"`
 	ModuleName      string                 `json:"module_name,omitempty"`
 	Success         bool                   `json:"success"`
 	Message         string                 `json:"message,omitempty"`
 	Error           string                 `json:"error,omitempty"`
+	// Changes holds the raw changes of entries written before they were
+	// summarized in Diff
 	Changes         map[string]interface{} `json:"changes,omitempty"`
+	Diff            *DiffSummary           `json:"diff,omitempty"`
 	PolicyViolation *PolicyViolation       `json:"policy_violation,omitempty"`
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 	SessionID       string                 `json:"session_id,omitempty"`
 	RemoteAddr      string                 `json:"remote_addr,omitempty"`
+	Fingerprint     *Fingerprint           `json:"fingerprint,omitempty"`
 }
 
 // PolicyViolation represents a policy violation in audit logs
@@ -71,6 +78,8 @@ type AuditLogger struct {
 	file        *os.File
 	maxFileSize int64 // Maximum file size in bytes before rotation
 	maxFiles    int   // Maximum number of rotated files to keep
+	valueLimit  int   // Longest value kept in diff summaries
+	diffs       *DiffBlobs
 }
 
 // NewAuditLogger creates a new audit logger
@@ -80,6 +89,7 @@ func NewAuditLogger(filePath string) *AuditLogger {
 		enabled:     true,
 		maxFileSize: 100 * 1024 * 1024, // 100MB default
 		maxFiles:    10,                 // Keep 10 rotated files
+		valueLimit:  DefaultValueLimit,
 	}
 }
 
@@ -124,19 +134,55 @@ func (l *AuditLogger) SetMaxFiles(count int) {
 	l.maxFiles = count
 }
 
+// SetValueLimit sets the longest value, in bytes, kept in the diff summary
+// of a resource change
+func (l *AuditLogger) SetValueLimit(limit int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.valueLimit = limit
+}
+
+// SetDiffBlobs stores the full changes of every resource change in blobs,
+// referenced from its diff summary
+func (l *AuditLogger) SetDiffBlobs(blobs *DiffBlobs) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.diffs = blobs
+}
+
 // LogResourceChange logs a resource change event
 func (l *AuditLogger) LogResourceChange(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff, success bool, err error) error {
+	return l.LogHostResourceChange(ctx, "", resource, diff, success, err)
+}
+
+// LogHostResourceChange logs a resource change event on a host. The
+// changes are summarized, with the full changes stored separately when
+// diff blobs are set.
+func (l *AuditLogger) LogHostResourceChange(ctx context.Context, host string, resource *types.Resource, diff *types.ResourceDiff, success bool, err error) error {
 	if !l.IsEnabled() {
 		return nil
 	}
 	
+	l.mu.RLock()
+	valueLimit, diffs := l.valueLimit, l.diffs
+	l.mu.RUnlock()
+	
 	entry := &AuditEntry{
 		Timestamp:  time.Now(),
 		EventType:  EventTypeResourceChange,
+		Host:       host,
 		ResourceID: resource.ResourceID(),
 		Action:     string(diff.Action),
 		Success:    success,
-		Changes:    diff.Changes,
+		Diff:       SummarizeChanges(diff.Changes, valueLimit),
+	}
+	
+	if entry.Diff != nil && diffs != nil {
+		ref, blobErr := diffs.Put(diff.Changes)
+		if blobErr != nil {
+			return blobErr
+		}
+		entry.Diff.Blob = ref
 	}
 	
 	if err != nil {
@@ -226,6 +272,39 @@ func (l *AuditLogger) LogSystemEvent(ctx context.Context, action, message string
 	return l.writeEntry(entry)
 }
 
+// LogExecution logs a module execution together with its environment fingerprint
+func (l *AuditLogger) LogExecution(ctx context.Context, moduleName string, fingerprint *Fingerprint, success bool, err error, metadata map[string]interface{}) error {
+	if !l.IsEnabled() {
+		return nil
+	}
+
+	entry := &AuditEntry{
+		Timestamp:   time.Now(),
+		EventType:   EventTypeExecution,
+		Action:      "apply",
+		ModuleName:  moduleName,
+		Success:     success,
+		Metadata:    metadata,
+		Fingerprint: fingerprint,
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	// Extract user from context if available
+	if user := getUserFromContext(ctx); user != "" {
+		entry.User = user
+	}
+
+	// Extract session ID from context if available
+	if sessionID := getSessionIDFromContext(ctx); sessionID != "" {
+		entry.SessionID = sessionID
+	}
+
+	return l.writeEntry(entry)
+}
+
 // LogAuthentication logs an authentication event
 func (l *AuditLogger) LogAuthentication(ctx context.Context, user string, success bool, method string, err error) error {
 	if !l.IsEnabled() {
@@ -3,6 +3,7 @@ package audit
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"os"
 	"path/filepath"
 	"strings"
@@ -367,3 +368,41 @@ func TestAuditEntry_Validate(t *testing.T) {
 		})
 	}
 }
+
+func TestAuditLogger_Interceptor(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "audit.log")
+	logger := NewAuditLogger(logPath)
+	defer logger.Close()
+	intercept := logger.Interceptor(func(err error) { t.Errorf("onError(%v)", err) })
+
+	resource := &types.Resource{Type: "file", Name: "motd"}
+	failed := func(ctx context.Context, op *types.Operation) (*types.OperationResult, error) {
+		return nil, errors.New("permission denied")
+	}
+	read := &types.Operation{Kind: types.OperationRead, Host: "web1", Resource: resource, Started: time.Now()}
+	if _, err := intercept(context.Background(), read, failed); err == nil {
+		t.Fatal("Interceptor() swallowed the read's error")
+	}
+	apply := &types.Operation{Kind: types.OperationApply, Host: "web1", Resource: resource,
+		Diff: &types.ResourceDiff{Action: types.ActionUpdate}, Started: time.Now()}
+	if _, err := intercept(context.Background(), apply, failed); err == nil || err.Error() != "permission denied" {
+		t.Fatalf("Interceptor() error = %v, want the apply's error", err)
+	}
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("audit log has %d entries, want only the apply:\n%s", len(lines), data)
+	}
+	var entry AuditEntry
+	if err := json.Unmarshal([]byte(lines[0]), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry.EventType != EventTypeProviderApply || entry.Host != "web1" || entry.ResourceID != "file.motd" ||
+		entry.Action != string(types.ActionUpdate) || entry.Success || entry.Error != "permission denied" {
+		t.Errorf("entry = %+v", entry)
+	}
+}
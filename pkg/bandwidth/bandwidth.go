@@ -0,0 +1,205 @@
+// Package bandwidth limits how fast data is sent to targets and describes
+// the off-peak windows in which large transfers should run.
+package bandwidth
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/clock"
+)
+
+// Limiter spreads transfers so that, on average, no more than its rate in
+// bytes per second is sent. It is safe for concurrent use; a nil Limiter
+// does not limit.
+type Limiter struct {
+	rate float64
+
+	mu   sync.Mutex
+	free time.Time
+
+	now   func() time.Time
+	sleep func(ctx context.Context, d time.Duration) error
+}
+
+// NewLimiter creates a limiter for a rate in bytes per second. A rate of
+// zero or less returns nil, which does not limit.
+func NewLimiter(bytesPerSecond int64) *Limiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &Limiter{
+		rate:  float64(bytesPerSecond),
+		now:   time.Now,
+		sleep: clock.Sleep,
+	}
+}
+
+// Rate returns the limit in bytes per second
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// Wait blocks until n more bytes may be sent. The first transfer goes out
+// at once; each later one waits until the time the earlier ones were due
+// to take at the configured rate has passed.
+func (l *Limiter) Wait(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := l.now()
+	start := l.free
+	if start.Before(now) {
+		start = now
+	}
+	l.free = start.Add(time.Duration(float64(n) / l.rate * float64(time.Second)))
+	l.mu.Unlock()
+
+	if wait := start.Sub(now); wait > 0 {
+		return l.sleep(ctx, wait)
+	}
+	return nil
+}
+
+// ParseRate parses a rate such as "512K", "10MB/s" or "20Mbit" into bytes
+// per second. Byte units are powers of 1024; bit units are powers of 1000.
+func ParseRate(s string) (int64, error) {
+	value := strings.TrimSuffix(strings.ToLower(strings.TrimSpace(s)), "/s")
+
+	bits := false
+	switch {
+	case strings.HasSuffix(value, "bit"):
+		value, bits = strings.TrimSuffix(value, "bit"), true
+	case strings.HasSuffix(value, "bps"):
+		value, bits = strings.TrimSuffix(value, "bps"), true
+	case strings.HasSuffix(value, "ib"):
+		value = strings.TrimSuffix(value, "ib")
+	case strings.HasSuffix(value, "b"):
+		value = strings.TrimSuffix(value, "b")
+	}
+
+	base := 1024.0
+	if bits {
+		base = 1000
+	}
+	multiplier := 1.0
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k':
+			multiplier = base
+		case 'm':
+			multiplier = base * base
+		case 'g':
+			multiplier = base * base * base
+		}
+		if multiplier != 1 {
+			value = value[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid bandwidth %q", s)
+	}
+	rate := number * multiplier
+	if bits {
+		rate /= 8
+	}
+	if rate < 1 {
+		return 0, fmt.Errorf("invalid bandwidth %q: less than one byte per second", s)
+	}
+	return int64(rate), nil
+}
+
+// FormatRate formats a rate in bytes per second for display
+func FormatRate(bytesPerSecond int64) string {
+	units := []string{"B/s", "KB/s", "MB/s", "GB/s"}
+	value := float64(bytesPerSecond)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(value, 'f', -1, 64) + units[unit]
+}
+
+// Window is a daily time window, such as an off-peak period for transfers.
+// A window whose end is before its start wraps past midnight.
+type Window struct {
+	Start time.Duration
+	End   time.Duration
+}
+
+// ParseWindow parses a window such as "22:00-06:00"
+func ParseWindow(s string) (Window, error) {
+	from, to, ok := strings.Cut(strings.TrimSpace(s), "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid window %q: expected HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return Window{}, fmt.Errorf("invalid window %q: %w", s, err)
+	}
+	if start == end {
+		return Window{}, fmt.Errorf("invalid window %q: start and end are the same", s)
+	}
+	return Window{Start: start, End: end}, nil
+}
+
+// Contains reports whether t falls inside the window
+func (w Window) Contains(t time.Time) bool {
+	clock := sinceMidnight(t)
+	if w.Start < w.End {
+		return clock >= w.Start && clock < w.End
+	}
+	return clock >= w.Start || clock < w.End
+}
+
+// Next returns when the window next opens, or t if it is open
+func (w Window) Next(t time.Time) time.Time {
+	if w.Contains(t) {
+		return t
+	}
+	wait := w.Start - sinceMidnight(t)
+	if wait < 0 {
+		wait += 24 * time.Hour
+	}
+	return t.Add(wait)
+}
+
+// String returns the window as HH:MM-HH:MM
+func (w Window) String() string {
+	return formatClock(w.Start) + "-" + formatClock(w.End)
+}
+
+// parseClock parses HH:MM into the time since midnight
+func parseClock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// formatClock formats the time since midnight as HH:MM
+func formatClock(d time.Duration) string {
+	return fmt.Sprintf("%02d:%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+}
+
+// sinceMidnight returns the wall-clock time of day of t
+func sinceMidnight(t time.Time) time.Duration {
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
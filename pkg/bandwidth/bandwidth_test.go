@@ -0,0 +1,157 @@
+package bandwidth
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{input: "1024", want: 1024},
+		{input: "512K", want: 512 * 1024},
+		{input: "10MB/s", want: 10 * 1024 * 1024},
+		{input: "1.5MiB", want: 1572864},
+		{input: "1G", want: 1 << 30},
+		{input: "20Mbit", want: 2500000},
+		{input: "100kbps", want: 12500},
+		{input: "", wantErr: true},
+		{input: "fast", wantErr: true},
+		{input: "-1M", wantErr: true},
+		{input: "1bit", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseRate(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseRate(%q) = %d, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseRate(%q) = %d, %v, want %d", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatRate(t *testing.T) {
+	if got := FormatRate(10 * 1024 * 1024); got != "10MB/s" {
+		t.Errorf("FormatRate() = %s, want 10MB/s", got)
+	}
+	if got := FormatRate(512); got != "512B/s" {
+		t.Errorf("FormatRate() = %s, want 512B/s", got)
+	}
+}
+
+func TestLimiter_Wait(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+	limiter := NewLimiter(1000)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(ctx context.Context, d time.Duration) error {
+		slept = append(slept, d)
+		return nil
+	}
+
+	// Three 500 byte transfers at 1000 B/s: the first goes at once and each
+	// later one waits for the ones before it
+	for i := 0; i < 3; i++ {
+		if err := limiter.Wait(context.Background(), 500); err != nil {
+			t.Fatalf("Wait() error = %v", err)
+		}
+	}
+	want := []time.Duration{500 * time.Millisecond, time.Second}
+	if len(slept) != len(want) || slept[0] != want[0] || slept[1] != want[1] {
+		t.Errorf("slept %v, want %v", slept, want)
+	}
+
+	// After an idle period the next transfer goes at once
+	now = now.Add(time.Minute)
+	slept = nil
+	limiter.Wait(context.Background(), 500)
+	if len(slept) != 0 {
+		t.Errorf("Expected no wait after idling, slept %v", slept)
+	}
+}
+
+func TestLimiter_Unlimited(t *testing.T) {
+	var limiter *Limiter
+	if NewLimiter(0) != nil {
+		t.Error("Expected a zero rate to mean no limit")
+	}
+	if err := limiter.Wait(context.Background(), 1<<30); err != nil {
+		t.Errorf("Wait() error = %v", err)
+	}
+	if limiter.Rate() != 0 {
+		t.Errorf("Rate() = %d, want 0", limiter.Rate())
+	}
+}
+
+func TestLimiter_Cancelled(t *testing.T) {
+	limiter := NewLimiter(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	limiter.Wait(ctx, 10)
+	if err := limiter.Wait(ctx, 10); err != context.Canceled {
+		t.Errorf("Wait() error = %v, want context.Canceled", err)
+	}
+}
+
+func TestWindow(t *testing.T) {
+	at := func(clock string) time.Time {
+		t, _ := time.Parse("15:04", clock)
+		return time.Date(2024, 1, 1, t.Hour(), t.Minute(), 0, 0, time.UTC)
+	}
+
+	night, err := ParseWindow("22:00-06:00")
+	if err != nil {
+		t.Fatalf("ParseWindow() error = %v", err)
+	}
+	if night.String() != "22:00-06:00" {
+		t.Errorf("String() = %s", night.String())
+	}
+
+	tests := []struct {
+		window   string
+		clock    string
+		contains bool
+		opensIn  time.Duration
+	}{
+		{window: "22:00-06:00", clock: "23:30", contains: true},
+		{window: "22:00-06:00", clock: "05:59", contains: true},
+		{window: "22:00-06:00", clock: "06:00", opensIn: 16 * time.Hour},
+		{window: "22:00-06:00", clock: "12:15", opensIn: 9*time.Hour + 45*time.Minute},
+		{window: "01:00-05:00", clock: "03:00", contains: true},
+		{window: "01:00-05:00", clock: "23:00", opensIn: 2 * time.Hour},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.window+"@"+tt.clock, func(t *testing.T) {
+			window, err := ParseWindow(tt.window)
+			if err != nil {
+				t.Fatalf("ParseWindow() error = %v", err)
+			}
+			now := at(tt.clock)
+			if got := window.Contains(now); got != tt.contains {
+				t.Errorf("Contains() = %v, want %v", got, tt.contains)
+			}
+			if got := window.Next(now).Sub(now); got != tt.opensIn {
+				t.Errorf("Next() is %v away, want %v", got, tt.opensIn)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"22:00", "25:00-06:00", "06:00-06:00"} {
+		if _, err := ParseWindow(invalid); err == nil {
+			t.Errorf("ParseWindow(%q) expected error", invalid)
+		}
+	}
+}
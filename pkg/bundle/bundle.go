@@ -0,0 +1,429 @@
+// Package bundle packs a module and every local file it needs into a single
+// archive that can be applied without network access on the targets.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/templating"
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// ManifestFile is the name of the manifest inside a bundle
+	ManifestFile = "manifest.yaml"
+
+	// ModuleFile is the name of the bundled module inside a bundle
+	ModuleFile = "module.yaml"
+
+	// DefaultBundleFile is the archive written when no output is given
+	DefaultBundleFile = "chisel-bundle.tar.gz"
+)
+
+// Manifest describes the contents of a bundle
+type Manifest struct {
+	Module    string    `yaml:"module"`
+	Version   string    `yaml:"version"`
+	CreatedAt time.Time `yaml:"created_at"`
+	Files     []File    `yaml:"files"`
+}
+
+// File is a file packed into a bundle
+type File struct {
+	Path   string `yaml:"path"`
+	Source string `yaml:"source"`
+	SHA256 string `yaml:"sha256"`
+	Size   int64  `yaml:"size"`
+}
+
+// Options controls what is packed into a bundle
+type Options struct {
+	// Packages maps package resource names to pre-downloaded .deb or .rpm
+	// files, for resources that do not set a source themselves
+	Packages map[string]string
+
+	// Artifacts downloads sources given by URL. Without it only local files
+	// can be bundled.
+	Artifacts *artifact.Cache
+}
+
+// Create packs a module, its template files and its package files into a
+// gzipped tarball. Paths in the bundled module are rewritten to point into
+// the bundle.
+func Create(moduleFile, output string, opts Options) (*Manifest, error) {
+	// The module is packed with its !vault values encrypted, and decrypted
+	// when the bundle is applied
+	module, err := core.LoadModuleFromFileEncrypted(moduleFile)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{
+		Module:    module.Metadata.Name,
+		Version:   module.Metadata.Version,
+		CreatedAt: time.Now().UTC(),
+	}
+	packed := make(map[string]string)
+
+	// pack records a file, downloading it if it is a URL, and returns its
+	// path inside the bundle
+	pack := func(dir, source, checksum string) (string, error) {
+		if bundled, ok := packed[source]; ok {
+			return bundled, nil
+		}
+		resolved, err := opts.Artifacts.Resolve(context.Background(), source, checksum)
+		if err != nil {
+			return "", err
+		}
+		bundled := path.Join(dir, resolved.SHA256[:12]+"-"+filepath.Base(resolved.Path))
+		packed[source] = bundled
+		manifest.Files = append(manifest.Files, File{Path: bundled, Source: resolved.Path, SHA256: resolved.SHA256, Size: resolved.Size})
+		return bundled, nil
+	}
+
+	// packIncludes records the templates a template includes from dir, and
+	// those they include in turn, under the bundle directory of dir
+	templateDirs := make(map[string]string)
+	included := make(map[string]bool)
+	var packIncludes func(dir, text string) error
+	packIncludes = func(dir, text string) error {
+		names, err := templating.Includes(text)
+		if err != nil || len(names) == 0 {
+			return err
+		}
+		bundledDir, ok := templateDirs[dir]
+		if !ok {
+			sum := sha256.Sum256([]byte(dir))
+			bundledDir = path.Join("templates", hex.EncodeToString(sum[:])[:12])
+			templateDirs[dir] = bundledDir
+		}
+		for _, name := range names {
+			rel := filepath.Clean(filepath.FromSlash(name))
+			if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				return fmt.Errorf("template %s is included from outside the template directory %s and cannot be bundled", name, dir)
+			}
+			bundled := path.Join(bundledDir, filepath.ToSlash(rel))
+			if included[bundled] {
+				continue
+			}
+			local := filepath.Join(dir, rel)
+			sum, size, err := checksumFile(local)
+			if err != nil {
+				return fmt.Errorf("failed to read included template %s: %w", name, err)
+			}
+			included[bundled] = true
+			manifest.Files = append(manifest.Files, File{Path: bundled, Source: local, SHA256: sum, Size: size})
+
+			content, err := os.ReadFile(local)
+			if err != nil {
+				return fmt.Errorf("failed to read included template %s: %w", name, err)
+			}
+			if err := packIncludes(dir, string(content)); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+		return nil
+	}
+
+	resources := make([]*types.Resource, 0, len(module.Spec.Resources)+len(module.Spec.Handlers))
+	for i := range module.Spec.Resources {
+		resources = append(resources, &module.Spec.Resources[i])
+	}
+	for i := range module.Spec.Handlers {
+		resources = append(resources, &module.Spec.Handlers[i].Resource)
+	}
+
+	for _, resource := range resources {
+		switch resource.Type {
+		case "file":
+			var templates []string
+			if text, ok := resource.Properties["template"].(string); ok {
+				templates = append(templates, text)
+			}
+			for _, key := range []string{"template_file", "source"} {
+				value, ok := resource.Properties[key].(string)
+				if !ok {
+					continue
+				}
+				checksum, _ := resource.Properties["checksum"].(string)
+				bundled, err := pack("files", value, checksum)
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", resource.ResourceID(), err)
+				}
+				resource.Properties[key] = bundled
+				if key == "template_file" {
+					content, err := os.ReadFile(packedSource(manifest, bundled))
+					if err != nil {
+						return nil, fmt.Errorf("%s: %w", resource.ResourceID(), err)
+					}
+					templates = append(templates, string(content))
+				}
+			}
+
+			// The directory templates include from is on this machine; the
+			// templates they include are packed, and unpacked they include
+			// from the bundle
+			dir, _ := resource.Properties["template_dir"].(string)
+			delete(resource.Properties, "template_dir")
+			if dir == "" {
+				continue
+			}
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			for _, text := range templates {
+				if err := packIncludes(dir, text); err != nil {
+					return nil, fmt.Errorf("%s: %w", resource.ResourceID(), err)
+				}
+			}
+			if bundledDir, ok := templateDirs[dir]; ok {
+				resource.Properties["template_dir"] = bundledDir
+			}
+		case "pkg":
+			source, ok := resource.Properties["source"].(string)
+			if !ok {
+				source, ok = opts.Packages[resource.Name]
+			}
+			if ok {
+				if resource.Properties == nil {
+					resource.Properties = make(map[string]interface{})
+				}
+				bundled, err := pack("packages", source, "")
+				if err != nil {
+					return nil, fmt.Errorf("%s: %w", resource.ResourceID(), err)
+				}
+				resource.Properties["source"] = bundled
+			}
+		}
+	}
+
+	if err := CheckOffline(module); err != nil {
+		return nil, err
+	}
+
+	moduleData, err := core.MarshalEncrypted(module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal module: %w", err)
+	}
+	sort.Slice(manifest.Files, func(i, j int) bool {
+		return manifest.Files[i].Path < manifest.Files[j].Path
+	})
+	manifestData, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal manifest: %w", err)
+	}
+
+	if err := writeArchive(output, manifestData, moduleData, manifest.Files); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// packedSource returns the local file packed at a path in the bundle
+func packedSource(manifest *Manifest, bundled string) string {
+	for _, file := range manifest.Files {
+		if file.Path == bundled {
+			return file.Source
+		}
+	}
+	return ""
+}
+
+// Extract unpacks a bundle into dir, verifies every file against the
+// manifest and returns the bundled module with paths resolved into dir
+func Extract(bundleFile, dir string) (*core.Module, *Manifest, error) {
+	if err := extractArchive(bundleFile, dir); err != nil {
+		return nil, nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return nil, nil, fmt.Errorf("bundle has no manifest: %w", err)
+	}
+	var manifest Manifest
+	if err := yaml.Unmarshal(data, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse bundle manifest: %w", err)
+	}
+
+	for _, file := range manifest.Files {
+		sum, _, err := checksumFile(filepath.Join(dir, filepath.FromSlash(file.Path)))
+		if err != nil {
+			return nil, nil, fmt.Errorf("bundle is missing %s: %w", file.Path, err)
+		}
+		if sum != file.SHA256 {
+			return nil, nil, fmt.Errorf("bundle file %s does not match its checksum", file.Path)
+		}
+	}
+
+	module, err := core.LoadModuleFromFile(filepath.Join(dir, ModuleFile))
+	if err != nil {
+		return nil, nil, err
+	}
+	resolvePaths(module, dir)
+
+	return module, &manifest, nil
+}
+
+// CheckOffline returns an error listing every resource that would need
+// network access on the target: packages installed from a repository and
+// repository keys fetched from a URL
+func CheckOffline(module *core.Module) error {
+	resources := append([]types.Resource(nil), module.Spec.Resources...)
+	for _, handler := range module.Spec.Handlers {
+		resources = append(resources, handler.Resource)
+	}
+
+	var problems []string
+	for _, resource := range resources {
+		switch resource.Type {
+		case "pkg":
+			if packageState(resource) == "absent" {
+				continue
+			}
+			if _, ok := resource.Properties["source"]; !ok {
+				problems = append(problems, fmt.Sprintf("%s has no bundled package file", resource.ResourceID()))
+			}
+		case "repo":
+			if _, ok := resource.Properties["key_url"]; ok {
+				problems = append(problems, fmt.Sprintf("%s fetches its key from a URL, use an inline key", resource.ResourceID()))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("module cannot be applied offline:\n  %s", strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+// resolvePaths rewrites bundle-relative paths in a module to paths in dir
+func resolvePaths(module *core.Module, dir string) {
+	resolve := func(resource *types.Resource) {
+		var keys []string
+		switch resource.Type {
+		case "file":
+			keys = []string{"template_file", "source", "template_dir"}
+		case "pkg":
+			keys = []string{"source"}
+		}
+		for _, key := range keys {
+			if value, ok := resource.Properties[key].(string); ok && !filepath.IsAbs(value) {
+				resource.Properties[key] = filepath.Join(dir, filepath.FromSlash(value))
+			}
+		}
+	}
+	for i := range module.Spec.Resources {
+		resolve(&module.Spec.Resources[i])
+	}
+	for i := range module.Spec.Handlers {
+		resolve(&module.Spec.Handlers[i].Resource)
+	}
+}
+
+// packageState returns the desired state of a package resource
+func packageState(resource types.Resource) string {
+	if resource.State != "" {
+		return string(resource.State)
+	}
+	state, _ := resource.Properties["state"].(string)
+	return state
+}
+
+// checksumFile returns the SHA-256 checksum and size of a file
+func checksumFile(name string) (string, int64, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return "", 0, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return hex.EncodeToString(h.Sum(nil)), size, nil
+}
+
+// writeArchive writes the manifest, module and packed files as a gzipped tarball
+func writeArchive(output string, manifest, module []byte, files []File) error {
+	if dir := filepath.Dir(output); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create bundle directory: %w", err)
+		}
+	}
+	out, err := os.Create(output)
+	if err != nil {
+		return fmt.Errorf("failed to create bundle %s: %w", output, err)
+	}
+	defer out.Close()
+
+	gz := gzip.NewWriter(out)
+	tw := tar.NewWriter(gz)
+
+	writeEntry := func(name string, size int64, body io.Reader) error {
+		header := &tar.Header{Name: name, Mode: 0644, Size: size, ModTime: time.Now()}
+		if err := tw.WriteHeader(header); err != nil {
+			return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+		}
+		if _, err := io.Copy(tw, body); err != nil {
+			return fmt.Errorf("failed to write %s to bundle: %w", name, err)
+		}
+		return nil
+	}
+
+	if err := writeEntry(ManifestFile, int64(len(manifest)), strings.NewReader(string(manifest))); err != nil {
+		return err
+	}
+	if err := writeEntry(ModuleFile, int64(len(module)), strings.NewReader(string(module))); err != nil {
+		return err
+	}
+	for _, file := range files {
+		f, err := os.Open(file.Source)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", file.Source, err)
+		}
+		err = writeEntry(file.Path, file.Size, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return fmt.Errorf("failed to finish bundle: %w", err)
+	}
+	return out.Close()
+}
+
+// extractArchive unpacks a bundle into dir
+func extractArchive(bundleFile, dir string) error {
+	in, err := os.Open(bundleFile)
+	if err != nil {
+		return fmt.Errorf("failed to open bundle %s: %w", bundleFile, err)
+	}
+	defer in.Close()
+
+	if err := artifact.ExtractArchive(in, dir); err != nil {
+		return fmt.Errorf("failed to read bundle %s: %w", bundleFile, err)
+	}
+	return nil
+}
@@ -0,0 +1,328 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/templating"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// writeModule writes a module with a template and a package to dir
+func writeModule(t *testing.T, dir string) string {
+	t.Helper()
+
+	files := map[string]string{
+		"nginx.conf.tmpl":         "listen {{ .port }};\n",
+		"nginx_1.18.0_amd64.deb":  "!<arch>",
+		"openssl_3.0.2_amd64.deb": "!<arch>openssl",
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	module := `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: pkg
+      name: nginx
+      state: present
+      source: ` + filepath.Join(dir, "nginx_1.18.0_amd64.deb") + `
+    - type: pkg
+      name: openssl
+      state: present
+    - type: pkg
+      name: apache2
+      state: absent
+    - type: file
+      name: nginx-conf
+      path: /etc/nginx/nginx.conf
+      template_file: ` + filepath.Join(dir, "nginx.conf.tmpl") + `
+      vars:
+        port: 80
+`
+	moduleFile := filepath.Join(dir, "module.yaml")
+	if err := os.WriteFile(moduleFile, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return moduleFile
+}
+
+func TestCreateAndExtract(t *testing.T) {
+	dir := t.TempDir()
+	moduleFile := writeModule(t, dir)
+	output := filepath.Join(dir, "out", DefaultBundleFile)
+
+	manifest, err := Create(moduleFile, output, Options{
+		Packages: map[string]string{"openssl": filepath.Join(dir, "openssl_3.0.2_amd64.deb")},
+	})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	if manifest.Module != "web" || len(manifest.Files) != 3 {
+		t.Fatalf("manifest = %+v, want module web with 3 files", manifest)
+	}
+
+	extractDir := t.TempDir()
+	module, _, err := Extract(output, extractDir)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	for _, resource := range module.Spec.Resources {
+		var value string
+		switch resource.ResourceID() {
+		case "pkg.nginx", "pkg.openssl":
+			value = resource.Properties["source"].(string)
+		case "file.nginx-conf":
+			value = resource.Properties["template_file"].(string)
+		default:
+			continue
+		}
+		if !strings.HasPrefix(value, extractDir) {
+			t.Errorf("%s points to %s, want a path in the bundle", resource.ResourceID(), value)
+		}
+		if _, err := os.Stat(value); err != nil {
+			t.Errorf("%s: %v", resource.ResourceID(), err)
+		}
+	}
+}
+
+func TestCreateAndExtract_Includes(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"site.conf.tmpl":         `server { {{include "partials/listen.tmpl" .}} }`,
+		"partials/listen.tmpl":   `listen {{.port}};{{include "partials/tls.tmpl" .}}`,
+		"partials/tls.tmpl":      ` ssl on;`,
+		"partials/unused.tmpl":   `unused`,
+		"nginx_1.18.0_amd64.deb": "!<arch>",
+	}
+	for name, content := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	module := `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: file
+      name: site
+      path: /etc/nginx/sites-enabled/site.conf
+      template_file: ` + filepath.Join(dir, "site.conf.tmpl") + `
+      vars:
+        port: 80
+    - type: file
+      name: inline
+      path: /etc/nginx/listen.conf
+      template: '{{include "partials/listen.tmpl" .}}'
+      vars:
+        port: 8080
+`
+	moduleFile := filepath.Join(dir, "module.yaml")
+	if err := os.WriteFile(moduleFile, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	output := filepath.Join(t.TempDir(), DefaultBundleFile)
+
+	manifest, err := Create(moduleFile, output, Options{})
+	if err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+	// The template file and the two templates it includes, once
+	if len(manifest.Files) != 3 {
+		t.Errorf("manifest files = %+v, want the template and its 2 includes", manifest.Files)
+	}
+
+	// Unpacked, the templates include from the bundle alone
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+	extractDir := t.TempDir()
+	extracted, _, err := Extract(output, extractDir)
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+	want := map[string]string{
+		"file.site":   "server { listen 80; ssl on; }",
+		"file.inline": "listen 8080; ssl on;",
+	}
+	for _, resource := range extracted.Spec.Resources {
+		templateDir, _ := resource.Properties["template_dir"].(string)
+		if !strings.HasPrefix(templateDir, extractDir) {
+			t.Errorf("%s includes from %s, want a directory in the bundle", resource.ResourceID(), templateDir)
+		}
+		engine := templating.NewTemplateEngine()
+		engine.SetBaseDir(templateDir)
+		var got string
+		if file, ok := resource.Properties["template_file"].(string); ok {
+			got, err = engine.RenderFile(file, resource.Properties["vars"].(map[string]interface{}))
+		} else {
+			got, err = engine.Render(resource.Properties["template"].(string), resource.Properties["vars"].(map[string]interface{}))
+		}
+		if err != nil || got != want[resource.ResourceID()] {
+			t.Errorf("%s renders %q, %v; want %q", resource.ResourceID(), got, err, want[resource.ResourceID()])
+		}
+	}
+}
+
+func TestCreate_RejectsIncludesOutsideTemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	module := `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: file
+      name: motd
+      path: /etc/motd
+      template: '{{include "../shared/motd.tmpl" .}}'
+`
+	moduleFile := filepath.Join(dir, "module.yaml")
+	if err := os.WriteFile(moduleFile, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err := Create(moduleFile, filepath.Join(dir, DefaultBundleFile), Options{})
+	if err == nil || !strings.Contains(err.Error(), "outside the template directory") {
+		t.Errorf("Create() error = %v, want an include outside the template directory refused", err)
+	}
+}
+
+func TestCreate_RequiresBundledPackages(t *testing.T) {
+	dir := t.TempDir()
+	moduleFile := writeModule(t, dir)
+
+	_, err := Create(moduleFile, filepath.Join(dir, DefaultBundleFile), Options{})
+	if err == nil || !strings.Contains(err.Error(), "pkg.openssl has no bundled package file") {
+		t.Errorf("Create() error = %v, want missing package error", err)
+	}
+}
+
+func TestExtract_DetectsTampering(t *testing.T) {
+	dir := t.TempDir()
+	moduleFile := writeModule(t, dir)
+	output := filepath.Join(dir, DefaultBundleFile)
+	if _, err := Create(moduleFile, output, Options{
+		Packages: map[string]string{"openssl": filepath.Join(dir, "openssl_3.0.2_amd64.deb")},
+	}); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	_, manifest, err := Extract(output, t.TempDir())
+	if err != nil {
+		t.Fatalf("Extract() error = %v", err)
+	}
+
+	// Replace a packed file but keep the original manifest
+	if err := rewriteArchive(output, manifest.Files[0].Path, "tampered"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Extract(output, t.TempDir()); err == nil || !strings.Contains(err.Error(), "does not match its checksum") {
+		t.Errorf("Extract() error = %v, want checksum error", err)
+	}
+}
+
+func TestExtract_RejectsEscapingEntries(t *testing.T) {
+	output := filepath.Join(t.TempDir(), DefaultBundleFile)
+	f, err := os.Create(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	gz := gzip.NewWriter(f)
+	tw := tar.NewWriter(gz)
+	tw.WriteHeader(&tar.Header{Name: "../evil", Mode: 0644, Size: 1, Typeflag: tar.TypeReg})
+	tw.Write([]byte("x"))
+	tw.Close()
+	gz.Close()
+	f.Close()
+
+	if _, _, err := Extract(output, t.TempDir()); err == nil || !strings.Contains(err.Error(), "escapes the archive") {
+		t.Errorf("Extract() error = %v, want escape error", err)
+	}
+}
+
+func TestCheckOffline(t *testing.T) {
+	module := &core.Module{
+		Spec: core.ModuleSpec{
+			Resources: []types.Resource{
+				{Type: "repo", Name: "docker", Properties: map[string]interface{}{"key_url": "https://example.com/gpg"}},
+				{Type: "pkg", Name: "curl", State: types.StateAbsent},
+			},
+			Handlers: []core.Handler{
+				{Name: "install", Resource: types.Resource{Type: "pkg", Name: "htop", Properties: map[string]interface{}{"state": "latest"}}},
+			},
+		},
+	}
+
+	err := CheckOffline(module)
+	if err == nil {
+		t.Fatal("Expected offline check to fail")
+	}
+	for _, want := range []string{"repo.docker fetches its key", "pkg.htop has no bundled package file"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "pkg.curl") {
+		t.Errorf("absent packages need no bundled file: %v", err)
+	}
+}
+
+// rewriteArchive replaces the content of one entry in a bundle
+func rewriteArchive(bundleFile, name, content string) error {
+	dir, err := os.MkdirTemp("", "bundle")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	if err := extractArchive(bundleFile, dir); err != nil {
+		return err
+	}
+
+	manifest, err := os.ReadFile(filepath.Join(dir, ManifestFile))
+	if err != nil {
+		return err
+	}
+	module, err := os.ReadFile(filepath.Join(dir, ModuleFile))
+	if err != nil {
+		return err
+	}
+	entries, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil {
+		return err
+	}
+
+	var files []File
+	for _, entry := range entries {
+		rel, _ := filepath.Rel(dir, entry)
+		if filepath.ToSlash(rel) == name {
+			if err := os.WriteFile(entry, []byte(content), 0644); err != nil {
+				return err
+			}
+		}
+		info, err := os.Stat(entry)
+		if err != nil {
+			return err
+		}
+		files = append(files, File{Path: filepath.ToSlash(rel), Source: entry, Size: info.Size()})
+	}
+	return writeArchive(bundleFile, manifest, module, files)
+}
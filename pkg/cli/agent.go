@@ -0,0 +1,141 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/agent"
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/gitsource"
+	"github.com/ataiva-software/forge/pkg/inventory"
+)
+
+var agentOnce bool
+
+// agentCmd represents the agent command
+var agentCmd = &cobra.Command{
+	Use:   "agent",
+	Short: "Pull and apply a module on this node periodically",
+	Long: `Run forge as a daemon that pulls a module from a git repository or an
+HTTP endpoint and applies it to this machine on a schedule, without SSH.
+This is the pull-based counterpart to 'forge apply' pushing from a controller.
+
+After every run a JSON report with the node, the module revision and the
+outcome is posted to --report-url, when one is given.
+
+A git:: address pins the module to a tag or commit and can require it to be
+signed: git::<repository>//<path>?ref=<ref>&signed=true.
+
+Examples:
+  forge agent --source https://github.com/org/infra.git --module web/module.yaml
+  forge agent --source "git::https://github.com/org/infra.git//web?ref=v1.4.0&signed=true"
+  forge agent --source https://config.example.com/web.yaml --interval 15m`,
+	Args: cobra.NoArgs,
+	RunE: runAgent,
+}
+
+func init() {
+	rootCmd.AddCommand(agentCmd)
+
+	hostname, _ := os.Hostname()
+	agentCmd.Flags().String("source", "", "Git repository, git:: address or HTTP(S) URL of the module to apply")
+	agentCmd.Flags().String("ref", "", "Branch or tag to check out from a git source")
+	agentCmd.Flags().String("module", agent.DefaultModule, "Module file within a git source")
+	agentCmd.Flags().Duration("interval", agent.DefaultInterval, "Time between runs")
+	agentCmd.Flags().Duration("splay", 0, "Random delay added to each interval")
+	agentCmd.Flags().String("dir", ".chisel/agent", "Directory where sources are checked out")
+	agentCmd.Flags().String("node", hostname, "Name of this node in reports")
+	agentCmd.Flags().String("report-url", "", "URL that receives a JSON report after every run")
+	agentCmd.Flags().BoolVar(&agentOnce, "once", false, "Run once and exit with the outcome")
+
+	for _, name := range []string{"source", "ref", "module", "interval", "splay", "dir", "node", "report-url"} {
+		viper.BindPFlag("agent."+viperKey(name), agentCmd.Flags().Lookup(name))
+	}
+}
+
+func runAgent(cmd *cobra.Command, args []string) error {
+	config := agent.Config{
+		Source:      viper.GetString("agent.source"),
+		Ref:         viper.GetString("agent.ref"),
+		Module:      viper.GetString("agent.module"),
+		Interval:    viper.GetDuration("agent.interval"),
+		Splay:       viper.GetDuration("agent.splay"),
+		Dir:         viper.GetString("agent.dir"),
+		Node:        viper.GetString("agent.node"),
+		ReportURL:   viper.GetString("agent.report_url"),
+		ReportToken: viper.GetString("agent.report_token"),
+		Version:     cmd.Root().Version,
+	}
+
+	// Runs are unattended
+	applyAutoApprove = true
+	apply := func(ctx context.Context, modulePath, revision string) error {
+		location := moduleLocation{File: modulePath}
+		if gitsource.IsAddress(config.Source) {
+			location.Source, location.Revision = config.Source, revision
+		}
+		return applyLocalModule(ctx, cmd.Root().Version, location)
+	}
+	daemon, err := agent.NewAgent(config, apply, log.New(os.Stderr, "agent: ", log.LstdFlags))
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if agentOnce {
+		if report := daemon.RunOnce(ctx); report.Status == agent.StatusFailed {
+			return fmt.Errorf("agent run failed: %s", report.Error)
+		}
+		return nil
+	}
+	return daemon.Run(ctx)
+}
+
+// applyLocalModule applies a module file to the machine forge runs on
+func applyLocalModule(ctx context.Context, version string, location moduleLocation) error {
+	module, err := core.LoadModuleFromFile(location.File)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	if err := module.ResolveVars(nil); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+		ControllerVersion: version,
+		ModuleFile:        location.File,
+		ModuleSource:      location.Source,
+		ModuleRevision:    location.Revision,
+		PolicyFiles:       viper.GetStringSlice("policy.paths"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint execution: %w", err)
+	}
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	return runApplyHosts(ctx, module, inventory.Local(), fingerprint, webhooks, nil, nil)
+}
+
+// viperKey turns a flag name into a config key
+func viperKey(flag string) string {
+	key := []byte(flag)
+	for i, c := range key {
+		if c == '-' {
+			key[i] = '_'
+		}
+	}
+	return string(key)
+}
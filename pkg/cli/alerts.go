@@ -0,0 +1,204 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/server"
+)
+
+var (
+	alertsServer string
+	alertsState  string
+	alertsModule string
+	alertsNote   string
+	alertsBy     string
+	alertsSince  time.Duration
+)
+
+// alertsCmd represents the alerts command
+var alertsCmd = &cobra.Command{
+	Use:   "alerts",
+	Short: "Acknowledge, resolve and hand over the server's alerts",
+	Long: `Work with the alerts of the central server. Runs that fail, hosts a run
+finds drifted and nodes reporting failed runs open an alert that stays
+open until its condition clears: a later run of the module on the
+inventory succeeds, a run finds the host in sync again or the node reports
+a successful run. The alert is then resolved on its own.
+
+Acknowledge an alert to tell the rest of the rotation someone is on it, or
+resolve it by hand when the server cannot see its condition clear.
+'forge alerts report' summarises what is unresolved for an on-call handover.
+
+Examples:
+  forge alerts list
+  forge alerts ack 20240601T120000-1a2b3c4d --note "looking at nginx on web1"
+  forge alerts resolve 20240601T120000-1a2b3c4d --note "host decommissioned"
+  forge alerts report --since 12h`,
+}
+
+var alertsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List alerts, unresolved ones by default",
+	Args:  cobra.NoArgs,
+	RunE:  runAlertsList,
+}
+
+var alertsAckCmd = &cobra.Command{
+	Use:   "ack <id>",
+	Short: "Acknowledge an alert",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAlertsAck,
+}
+
+var alertsResolveCmd = &cobra.Command{
+	Use:   "resolve <id>",
+	Short: "Resolve an alert by hand",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runAlertsResolve,
+}
+
+var alertsReportCmd = &cobra.Command{
+	Use:   "report",
+	Short: "Summarise unresolved and recently resolved alerts for a handover",
+	Args:  cobra.NoArgs,
+	RunE:  runAlertsReport,
+}
+
+func init() {
+	rootCmd.AddCommand(alertsCmd)
+	alertsCmd.AddCommand(alertsListCmd, alertsAckCmd, alertsResolveCmd, alertsReportCmd)
+
+	alertsCmd.PersistentFlags().StringVar(&alertsServer, "server", "", "URL of the central server (default server.url, or http://localhost"+server.DefaultAddr+")")
+	alertsCmd.PersistentFlags().StringVar(&alertsModule, "module", "", "Only alerts about this module")
+
+	alertsListCmd.Flags().StringVar(&alertsState, "state", server.AlertUnresolved, "open, acknowledged, resolved, unresolved or all")
+
+	for _, cmd := range []*cobra.Command{alertsAckCmd, alertsResolveCmd} {
+		cmd.Flags().StringVar(&alertsNote, "note", "", "Note to leave on the alert")
+		cmd.Flags().StringVar(&alertsBy, "by", "", "Who takes the action (default user@host)")
+	}
+
+	alertsReportCmd.Flags().DurationVar(&alertsSince, "since", 12*time.Hour, "Include alerts resolved this long ago")
+}
+
+// alertsClient returns a client for the server alerts are read from
+func alertsClient() *server.Client {
+	url := alertsServer
+	if url == "" {
+		url = viper.GetString("server.url")
+	}
+	if url == "" {
+		url = "http://localhost" + server.DefaultAddr
+	}
+	return server.NewClient(url, viper.GetString("server.token"))
+}
+
+// alertAction returns the action of --by and --note
+func alertAction() server.AlertAction {
+	by := alertsBy
+	if by == "" {
+		by = triggeredBy()
+	}
+	return server.AlertAction{By: by, Note: alertsNote}
+}
+
+func runAlertsList(cmd *cobra.Command, args []string) error {
+	state := alertsState
+	if state == "all" {
+		state = ""
+	}
+	alerts, err := alertsClient().Alerts(context.Background(), state, alertsModule)
+	if err != nil {
+		return err
+	}
+	if len(alerts) == 0 {
+		fmt.Fprintln(console, "No alerts.")
+		return nil
+	}
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tLEVEL\tMODULE\tOPENED\tSEEN\tMESSAGE")
+	for _, alert := range alerts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\n", alert.ID, alert.State(), alert.Level, orDash(alert.Module),
+			alert.OpenedAt.Local().Format(historyTimeFormat), alert.Occurrences, alert.Message)
+	}
+	return w.Flush()
+}
+
+func runAlertsAck(cmd *cobra.Command, args []string) error {
+	alert, err := alertsClient().AcknowledgeAlert(context.Background(), args[0], alertAction())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Acknowledged %s by %s: %s\n", alert.ID, alert.AcknowledgedBy, alert.Message)
+	return nil
+}
+
+func runAlertsResolve(cmd *cobra.Command, args []string) error {
+	alert, err := alertsClient().ResolveAlert(context.Background(), args[0], alertAction())
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Resolved %s by %s: %s\n", alert.ID, alert.ResolvedBy, alert.Message)
+	return nil
+}
+
+func runAlertsReport(cmd *cobra.Command, args []string) error {
+	alerts, err := alertsClient().Alerts(context.Background(), "", alertsModule)
+	if err != nil {
+		return err
+	}
+	displayAlertsReport(console, alerts, time.Now(), alertsSince)
+	return nil
+}
+
+// displayAlertsReport renders a handover of the unresolved alerts,
+// unacknowledged ones first, and of those resolved within since
+func displayAlertsReport(w io.Writer, alerts []*server.Alert, now time.Time, since time.Duration) {
+	var open, acknowledged, resolved []*server.Alert
+	for _, alert := range alerts {
+		switch alert.State() {
+		case server.AlertOpen:
+			open = append(open, alert)
+		case server.AlertAcknowledged:
+			acknowledged = append(acknowledged, alert)
+		case server.AlertResolved:
+			if now.Sub(*alert.ResolvedAt) <= since {
+				resolved = append(resolved, alert)
+			}
+		}
+	}
+
+	fmt.Fprintf(w, "Alert handover at %s\n", now.Local().Format(historyTimeFormat))
+	fmt.Fprintf(w, "\nUnacknowledged (%d)\n", len(open))
+	for _, alert := range open {
+		fmt.Fprintf(w, "  ✗ %s  %-7s %s\n", alert.ID, alert.Level, alert.Message)
+		fmt.Fprintf(w, "      open for %s, seen %d time(s), last at %s\n", now.Sub(alert.OpenedAt).Round(time.Minute),
+			alert.Occurrences, alert.LastSeen.Local().Format(historyTimeFormat))
+		displayAlertNotes(w, alert)
+	}
+	fmt.Fprintf(w, "\nAcknowledged (%d)\n", len(acknowledged))
+	for _, alert := range acknowledged {
+		fmt.Fprintf(w, "  ⚠ %s  %-7s %s\n", alert.ID, alert.Level, alert.Message)
+		fmt.Fprintf(w, "      open for %s, acknowledged by %s at %s\n", now.Sub(alert.OpenedAt).Round(time.Minute),
+			alert.AcknowledgedBy, alert.AcknowledgedAt.Local().Format(historyTimeFormat))
+		displayAlertNotes(w, alert)
+	}
+	fmt.Fprintf(w, "\nResolved in the last %s (%d)\n", since, len(resolved))
+	for _, alert := range resolved {
+		fmt.Fprintf(w, "  ✓ %s  %-7s %s\n", alert.ID, alert.Level, alert.Message)
+		fmt.Fprintf(w, "      %s at %s\n", alert.Resolution, alert.ResolvedAt.Local().Format(historyTimeFormat))
+	}
+}
+
+// displayAlertNotes renders the notes left on an alert
+func displayAlertNotes(w io.Writer, alert *server.Alert) {
+	for _, note := range alert.Notes {
+		fmt.Fprintf(w, "      %s %s: %s\n", note.Time.Local().Format(historyTimeFormat), note.By, note.Text)
+	}
+}
@@ -0,0 +1,103 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/api"
+	"github.com/ataiva-software/forge/pkg/audit"
+)
+
+// apiCmd represents the api command
+var apiCmd = &cobra.Command{
+	Use:   "api",
+	Short: "Serve a gRPC API to plan, apply and check drift programmatically",
+	Long: `Run forge as a gRPC service so other tooling can plan and apply modules,
+check hosts for drift, and stream the progress of runs as events, instead of
+shelling out to the CLI. Requests carry the module and inventory documents;
+runs are carried out one at a time.
+
+Messages are JSON encoded rather than protocol buffers, so clients generated
+from a .proto file cannot call the API. Go programs use the client in
+pkg/api; clients in other languages call forge.api.v1.Forge with a
+serializer that writes messages as JSON.
+When api.token is configured, every call must send it as a bearer token in
+the authorization metadata. Without a token the API only listens on a
+loopback address.
+
+Examples:
+  forge api
+  forge api --addr :9090    # with api.token set`,
+	Args: cobra.NoArgs,
+	RunE: runAPI,
+}
+
+func init() {
+	rootCmd.AddCommand(apiCmd)
+
+	apiCmd.Flags().String("addr", api.DefaultAddr, "Address to listen on")
+	viper.BindPFlag("api.addr", apiCmd.Flags().Lookup("addr"))
+}
+
+func runAPI(cmd *cobra.Command, args []string) error {
+	version := cmd.Root().Version
+	runLimit, err := runLimits()
+	if err != nil {
+		return err
+	}
+	config := api.Config{
+		Addr:   viper.GetString("api.addr"),
+		Token:  viper.GetString("api.token"),
+		Limits: runLimit,
+	}
+
+	// Calls are unattended; the API carries out one run at a time, so the
+	// apply settings can be switched per run
+	applyAutoApprove = true
+	run := func(ctx context.Context, job api.Job) error {
+		applyDryRun = job.Action != api.ActionApply
+		runObservers = append(runObservers, job.Run)
+		defer unfollow(job.Run)
+
+		if err := applyConfigDefaults(job.Module); err != nil {
+			return err
+		}
+		if err := job.Module.ResolveVars(nil); err != nil {
+			return fmt.Errorf("failed to resolve module variables: %w", err)
+		}
+		fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+			ControllerVersion: version,
+			PolicyFiles:       viper.GetStringSlice("policy.paths"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint execution: %w", err)
+		}
+		fingerprint.ModuleHash = audit.HashBytes([]byte(job.Request.Module))
+		if job.Request.Inventory != "" {
+			fingerprint.InventoryHash = audit.HashBytes([]byte(job.Request.Inventory))
+		}
+		webhooks, err := loadWebhooks()
+		if err != nil {
+			return err
+		}
+		return runApplyHosts(ctx, job.Module, job.Inventory, fingerprint, webhooks, nil, nil)
+	}
+
+	logger := log.New(os.Stderr, "api: ", log.LstdFlags)
+	srv, err := api.NewServer(config, run, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Printf("listening on %s", config.Addr)
+	return srv.ListenAndServe(ctx)
+}
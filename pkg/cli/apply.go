@@ -3,168 +3,502 @@ package cli
 import (
 	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/bandwidth"
+	"github.com/ataiva-software/forge/pkg/bundle"
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/history"
+	"github.com/ataiva-software/forge/pkg/hooks"
 	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/limits"
+	"github.com/ataiva-software/forge/pkg/planfile"
 	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/report"
 	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/transport"
 	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/webhook"
 )
 
 var (
 	applyModuleFile    string
 	applyInventoryFile string
+	applyLocal         bool
 	applyDryRun        bool
 	applyAutoApprove   bool
+	applyApproval      string
+	applyOnUnreachable string
+	applyMaxUnreachable float64
+	applyAuditLog      string
+	applyPolicyFiles   []string
+	applyHealthFile    string
+	applyPreferHealthy bool
+	applyDeferFlapping bool
+	applyExportsFile   string
+	applyBundleFile    string
+	applyArtifactCache string
+	applyBandwidth     string
+	applyTransferWindow string
+	applyWaitForWindow bool
+	applyMaxConnections int
+	applyMaxHostConnections int
+	applyOutputFormat  string
+	applyTargets       []string
+	applyExcludes      []string
+	applyVars          []string
+	applyVarFiles      []string
+)
+
+// recordChecks records dry runs and applies with nothing to change in the
+// execution history. The server's plan runs check the drift of hosts this
+// way; from the command line they would only flood the history.
+var recordChecks bool
+
+const (
+	defaultHealthFile  = ".chisel/health.yaml"
+	defaultExportsFile = ".chisel/exports.yaml"
 )
 
 // applyCmd represents the apply command
 var applyCmd = &cobra.Command{
-	Use:   "apply",
+	Use:   "apply [plan file]",
 	Short: "Apply changes to infrastructure",
 	Long: `Apply changes to bring the infrastructure to the desired state
 defined in the module.
 
 The apply command first creates a plan, shows what changes will be made,
-and then applies those changes (unless --dry-run is specified).`,
+and asks for confirmation before applying them; only "yes" approves. Pass
+--auto-approve to apply without asking, as is needed when forge does not
+run on a terminal, or --dry-run to stop after the plan.
+
+Given a plan file saved with 'forge plan --out', apply uses the module and
+inventory the plan was made from, plans again and applies only if nothing
+changed since: not the module, the inventory, the policies or the state of
+any resource. The saved plan was reviewed already, so it is not asked for
+again.
+
+With --local the module is applied to the machine forge runs on,
+without an inventory or SSH.
+
+With --stack the modules of a stack file are applied to the inventory one
+after another, stopping at the first that fails. Hosts are connected to
+once for the whole stack: the modules share the connections, within
+--max-connections, and the facts gathered through them.
+
+--target limits the run to resources picked by id (file.nginx-conf), type
+(type=pkg) or tag (tag=web), along with the resources they depend on.
+--exclude leaves resources out, along with the resources that depend on
+them. Both can be repeated; a saved plan applies the selection it was
+made with.
+
+--audit-only reads every resource and reports how it deviates, as if it
+had state audit, without changing anything.
+
+With --output json or yaml the plan and the result of every change are
+printed as a machine-readable report; other output goes to stderr.
+
+With --machine every step of the run is printed on stdout as it happens,
+as one JSON event per line: plan.item for each planned change,
+resource.completed or resource.failed for each change applied,
+handler.notified, resource.output and a final run.finished. Output meant
+for people is not printed.`,
+	Args: cobra.MaximumNArgs(1),
 	RunE: runApply,
 }
 
 func init() {
 	rootCmd.AddCommand(applyCmd)
 
-	applyCmd.Flags().StringVarP(&applyModuleFile, "module", "m", "", "Path to module file (required)")
+	applyCmd.Flags().StringVarP(&applyModuleFile, "module", "m", "", "Path to module file, or git::<repository>//<path>?ref=<ref> (required unless --bundle or a plan file is given)")
+	applyCmd.Flags().StringVar(&applyStackFile, "stack", "", "Apply the modules of a stack file in order, sharing connections and facts")
+	applyCmd.Flags().StringVar(&applyBundleFile, "bundle", "", "Apply a bundle created with 'forge bundle create', using only its contents")
 	applyCmd.Flags().StringVarP(&applyInventoryFile, "inventory", "i", "", "Path to inventory file")
+	applyCmd.Flags().BoolVar(&applyLocal, "local", false, "Apply to the machine forge runs on, without SSH")
+	applyCmd.Flags().BoolVar(&inventoryRefresh, "refresh-inventory", false, "Discover the hosts of discovered groups again instead of using cached ones")
+	applyCmd.Flags().BoolVar(&auditOnly, "audit-only", false, "Only report how resources deviate from the module, as if every resource had state audit")
 	applyCmd.Flags().BoolVar(&applyDryRun, "dry-run", false, "Show what would be done without actually applying changes")
 	applyCmd.Flags().BoolVar(&applyAutoApprove, "auto-approve", false, "Skip interactive approval of plan")
+	applyCmd.Flags().StringVar(&applyApproval, "approval", "", "Approved request of an approval workflow the module matches (see 'forge approval')")
+	applyCmd.Flags().StringVarP(&applyOutputFormat, "output", "o", report.FormatText, "Output format (text, json, yaml)")
+	applyCmd.Flags().BoolVar(&machineMode, "machine", false, "Print NDJSON lifecycle events on stdout as they happen instead of human output")
+	applyCmd.Flags().StringArrayVar(&applyTargets, "target", nil, "Only apply these resources: <type>.<name>, type=<type> or tag=<tag> (repeatable)")
+	applyCmd.Flags().StringArrayVar(&applyVars, "var", nil, "Set a module variable, as key=value (repeatable)")
+	applyCmd.Flags().StringArrayVar(&applyVarFiles, "var-file", nil, "Set module variables from a YAML file (repeatable)")
+	applyCmd.Flags().StringArrayVar(&applyExcludes, "exclude", nil, "Leave these resources out: <type>.<name>, type=<type> or tag=<tag> (repeatable)")
+	applyCmd.Flags().StringVar(&applyOnUnreachable, "on-unreachable", "fail", "How unreachable hosts affect the run status (fail, warn, ignore)")
+	applyCmd.Flags().Float64Var(&applyMaxUnreachable, "max-unreachable", 0, "Maximum percentage of unreachable hosts tolerated by warn/ignore (0 = no limit)")
+	applyCmd.Flags().String("serial", "", "Roll out to hosts in waves of this many hosts, or this share of them (e.g. 5, 25%), overriding the module's strategy")
+	applyCmd.Flags().String("canary", "", "Apply to the hosts matching this label selector first (e.g. canary=true), and to the rest once they pass")
+	applyCmd.Flags().Duration("canary-window", 0, "How long the canaries run before their checks decide whether the rest are applied to")
+	applyCmd.Flags().Float64("max-fail-percentage", 0, "Percentage of hosts that may fail before a rolling rollout halts (0 = halt at the first failed wave)")
+	
+	applyCmd.Flags().StringVar(&applyAuditLog, "audit-log", "", "Append an audit record with the execution fingerprint to this file")
+	applyCmd.Flags().Bool("audit-full-diffs", false, "Store the full diff of every change, encrypted, beside the audit log and reference it from the audit record")
+	applyCmd.Flags().StringSliceVar(&applyPolicyFiles, "policy", nil, "Policy files in effect for this run (included in the execution fingerprint)")
+	
+	applyCmd.Flags().StringVar(&applyHealthFile, "health-file", defaultHealthFile, "Path to the per-host health history")
+	applyCmd.Flags().BoolVar(&applyPreferHealthy, "prefer-healthy", false, "Apply to the healthiest hosts first")
+	applyCmd.Flags().BoolVar(&applyDeferFlapping, "defer-flapping", false, "Apply to flapping hosts last")
+	applyCmd.Flags().StringVar(&applyExportsFile, "exports-file", defaultExportsFile, "Path to the store of resources exported by hosts")
+	applyCmd.Flags().StringVar(&applyArtifactCache, "artifact-cache", artifact.DefaultCacheDir, "Directory where the controller caches downloaded artifacts")
+	applyCmd.Flags().StringVar(&applyBandwidth, "bandwidth", "", "Cap the combined rate of transfers to all hosts (e.g. 10MB/s, 50Mbit)")
+	applyCmd.Flags().StringVar(&applyTransferWindow, "transfer-window", "", "Off-peak window for transfers, e.g. 22:00-06:00")
+	applyCmd.Flags().BoolVar(&applyWaitForWindow, "wait-for-window", false, "Wait for the transfer window to open before applying")
+	applyCmd.Flags().IntVar(&applyMaxConnections, "max-connections", 0, "Maximum SSH connections open to all hosts at once (0 = no limit)")
+	applyCmd.Flags().IntVar(&applyMaxHostConnections, "max-connections-per-host", ssh.DefaultMaxConnectionsPerHost, "Maximum SSH connections open to each host")
+	applyCmd.Flags().Float64("connect-rate", 0, "Maximum SSH connections opened per second to all hosts (0 = no limit)")
+	applyCmd.Flags().Duration("host-connect-interval", 0, "Least time between SSH connections opened to one host")
+	applyCmd.Flags().Int("snapshot-threshold", 0, "Snapshot VMs whose plan risk score exceeds this, overriding the inventory (0 = inventory or default)")
+	applyCmd.Flags().String("host-key-policy", "", "How unknown SSH host keys are handled for hosts that do not set one (strict, accept-new, off)")
+	applyCmd.Flags().Bool("osquery", true, "Read packages, users and listening ports through osquery on hosts that have it")
+	applyCmd.Flags().Duration("facts-ttl", facts.DefaultTTL, "How long gathered host facts are reused by later runs (0 = gather on every run)")
 	
-	applyCmd.MarkFlagRequired("module")
+	applyCmd.MarkFlagsMutuallyExclusive("module", "bundle")
+	applyCmd.MarkFlagsMutuallyExclusive("module", "stack")
+	applyCmd.MarkFlagsMutuallyExclusive("bundle", "stack")
+	applyCmd.MarkFlagsMutuallyExclusive("inventory", "local")
+	applyCmd.MarkFlagsMutuallyExclusive("machine", "output")
+
+	viper.BindPFlag("unreachable.action", applyCmd.Flags().Lookup("on-unreachable"))
+	viper.BindPFlag("unreachable.max_percent", applyCmd.Flags().Lookup("max-unreachable"))
+	viper.BindPFlag("rollout.canary", applyCmd.Flags().Lookup("canary"))
+	viper.BindPFlag("rollout.canary_window", applyCmd.Flags().Lookup("canary-window"))
+	viper.BindPFlag("rollout.serial", applyCmd.Flags().Lookup("serial"))
+	viper.BindPFlag("rollout.max_fail_percentage", applyCmd.Flags().Lookup("max-fail-percentage"))
+	viper.BindPFlag("audit.file", applyCmd.Flags().Lookup("audit-log"))
+	viper.BindPFlag("audit.full_diffs", applyCmd.Flags().Lookup("audit-full-diffs"))
+	viper.BindPFlag("policy.paths", applyCmd.Flags().Lookup("policy"))
+	viper.BindPFlag("health.file", applyCmd.Flags().Lookup("health-file"))
+	viper.BindPFlag("scheduling.healthiest_first", applyCmd.Flags().Lookup("prefer-healthy"))
+	viper.BindPFlag("scheduling.defer_flapping", applyCmd.Flags().Lookup("defer-flapping"))
+	viper.BindPFlag("exports.file", applyCmd.Flags().Lookup("exports-file"))
+	viper.BindPFlag("artifacts.dir", applyCmd.Flags().Lookup("artifact-cache"))
+	viper.BindPFlag("transfers.bandwidth", applyCmd.Flags().Lookup("bandwidth"))
+	viper.BindPFlag("transfers.window", applyCmd.Flags().Lookup("transfer-window"))
+	viper.BindPFlag("transfers.wait_for_window", applyCmd.Flags().Lookup("wait-for-window"))
+	viper.BindPFlag("ssh.max_connections", applyCmd.Flags().Lookup("max-connections"))
+	viper.BindPFlag("ssh.max_connections_per_host", applyCmd.Flags().Lookup("max-connections-per-host"))
+	viper.BindPFlag("ssh.connect_rate", applyCmd.Flags().Lookup("connect-rate"))
+	viper.BindPFlag("ssh.host_connect_interval", applyCmd.Flags().Lookup("host-connect-interval"))
+	viper.BindPFlag("snapshots.threshold", applyCmd.Flags().Lookup("snapshot-threshold"))
+	viper.BindPFlag("ssh.host_key_policy", applyCmd.Flags().Lookup("host-key-policy"))
+	viper.BindPFlag("facts.osquery", applyCmd.Flags().Lookup("osquery"))
+	viper.BindPFlag("facts.cache_ttl", applyCmd.Flags().Lookup("facts-ttl"))
 }
 
-func runApply(cmd *cobra.Command, args []string) error {
-	// Load the module
-	module, err := core.LoadModuleFromFile(applyModuleFile)
+func runApply(cmd *cobra.Command, args []string) (err error) {
+	output, err := startReport("apply", applyOutputFormat, cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+	defer func() { err = output.finish(err) }()
+	machine, err := startMachine("apply", cmd.OutOrStdout())
 	if err != nil {
-		return fmt.Errorf("failed to load module: %w", err)
+		return err
 	}
+	defer func() { err = machine.finish(err) }()
 
-	// Load inventory if specified
+	if applyStackFile != "" {
+		return runApplyStack(cmd, args)
+	}
+
+	// A saved plan names the module and inventory it was made from
+	var saved *savedPlan
+	if len(args) == 1 {
+		if applyModuleFile != "" || applyBundleFile != "" || applyInventoryFile != "" || applyLocal || len(applyTargets) > 0 || len(applyExcludes) > 0 || len(applyVars) > 0 || len(applyVarFiles) > 0 || auditOnly {
+			return fmt.Errorf("a saved plan applies to the module, inventory, variables and resources it was made for; --module, --bundle, --inventory, --local, --var, --var-file, --target, --exclude and --audit-only cannot be given with it")
+		}
+		file, err := planfile.Load(args[0], atRestSealer())
+		if err != nil {
+			return err
+		}
+		applyModuleFile, applyInventoryFile, applyLocal = file.ModuleFile, file.InventoryFile, file.Local
+		applyTargets, applyExcludes = file.Targets, file.Excludes
+		auditOnly = file.AuditOnly
+		saved = &savedPlan{file: file}
+		fmt.Fprintf(console, "Applying the plan saved at %s\n", file.CreatedAt.Local().Format("2006-01-02 15:04:05 MST"))
+	} else if applyModuleFile == "" && applyBundleFile == "" {
+		return fmt.Errorf("one of --module, --bundle or a saved plan file is required")
+	}
+
+	var overrides map[string]interface{}
+	if saved != nil {
+		if overrides, err = core.DecryptVars(saved.file.Vars); err != nil {
+			return err
+		}
+	} else if overrides, err = varOverrides(applyVars, applyVarFiles); err != nil {
+		return err
+	}
+
+	// Load the module, unpacking it from the bundle in air-gapped mode or
+	// fetching it from git
+	location := moduleLocation{File: applyModuleFile}
+	var module *core.Module
+	if applyBundleFile != "" {
+		dir, err := os.MkdirTemp("", "chisel-bundle-")
+		if err != nil {
+			return fmt.Errorf("failed to create bundle directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+
+		module, _, err = bundle.Extract(applyBundleFile, dir)
+		if err != nil {
+			return fmt.Errorf("failed to load bundle: %w", err)
+		}
+		if err := bundle.CheckOffline(module); err != nil {
+			return err
+		}
+		location.File = filepath.Join(dir, bundle.ModuleFile)
+	} else {
+		if location, err = locateModule(context.Background(), applyModuleFile); err != nil {
+			return err
+		}
+		module, err = core.LoadModuleFromFile(location.File)
+		if err != nil {
+			return fmt.Errorf("failed to load module: %w", err)
+		}
+	}
+	output.Recorder().SetModule(module.Metadata.Name)
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	if err := module.ResolveVars(overrides); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	if err := selectResources(module, applyTargets, applyExcludes); err != nil {
+		return err
+	}
+
+	// Load inventory if specified; --local targets this machine instead
 	var inv *inventory.Inventory
 	if applyInventoryFile != "" {
-		inv, err = inventory.LoadInventoryFromFile(applyInventoryFile)
+		inv, err = loadInventory(applyInventoryFile)
 		if err != nil {
 			return fmt.Errorf("failed to load inventory: %w", err)
 		}
+	} else if applyLocal {
+		inv = inventory.Local()
+	}
+
+	// Fingerprint the execution environment so the run can be reproduced later
+	fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+		ControllerVersion: cmd.Root().Version,
+		ModuleFile:        location.File,
+		ModuleSource:      location.Source,
+		ModuleRevision:    location.Revision,
+		InventoryFile:     applyInventoryFile,
+		PolicyFiles:       viper.GetStringSlice("policy.paths"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint execution: %w", err)
+	}
+	output.Recorder().SetFingerprint(fingerprint.ID())
+	if saved != nil {
+		if err := saved.file.CheckInputs(fingerprint); err != nil {
+			return err
+		}
+	}
+
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	hookRunner, err := loadHooks()
+	if err != nil {
+		return err
+	}
+	projectHooks, err := startHooks(context.Background(), hookRunner, module, hooks.Run{
+		Command:     "apply",
+		Fingerprint: fingerprint.ID(),
+		Inventory:   applyInventoryFile,
+		DryRun:      applyDryRun,
+	})
+	if err != nil {
+		return err
 	}
+	defer func() { projectHooks.finish(context.Background(), err) }()
+
+	// Apply to every inventory host when an inventory is given
+	if inv != nil {
+		return runApplyHosts(context.Background(), module, inv, fingerprint, webhooks, saved, nil)
+	}
+	if err := checkPolicies(context.Background(), module); err != nil {
+		return err
+	}
+	warnUnchecked(module)
 
 	// Create provider registry and register core providers
-	registry := types.NewProviderRegistry()
 	mockExecutor := ssh.NewMockExecutor()
 	// Connect the mock executor
 	if err := mockExecutor.Connect(context.Background()); err != nil {
 		return fmt.Errorf("failed to connect mock executor: %w", err)
 	}
-	if err := registry.Register(providers.NewFileProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register file provider: %w", err)
-	}
-	if err := registry.Register(providers.NewPkgProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register package provider: %w", err)
-	}
-	if err := registry.Register(providers.NewServiceProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register service provider: %w", err)
+	registry, err := newLocalRegistry(mockExecutor)
+	if err != nil {
+		return err
 	}
-	if err := registry.Register(providers.NewUserProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register user provider: %w", err)
+	registry = registry.WithCache(types.NewStateCache(types.DefaultStateCacheSize))
+
+	runLimit, err := runLimits()
+	if err != nil {
+		return err
 	}
-	if err := registry.Register(providers.NewShellProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register shell provider: %w", err)
+	catalog, err := packageCatalog()
+	if err != nil {
+		return err
 	}
 
 	// Create planner
 	planner := core.NewPlanner(registry)
+	planner.SetSelection(resourceSelection)
+	planner.SetAuditOnly(auditOnly)
+	planner.SetPackages(catalog)
+	outputLimit := runLimit.NewOutput(warnLimit)
+	defer outputLimit.Close()
+	planner.SetOutputLimit(outputLimit)
 
 	// Create plan
-	fmt.Println("Creating execution plan...")
+	fmt.Fprintln(console, "Creating execution plan...")
 	plan, err := planner.CreatePlan(module)
 	if err != nil {
 		return fmt.Errorf("failed to create plan: %w", err)
 	}
+	runObservers.Planned(localHost, plan, nil)
+	sendWebhook(context.Background(), webhooks, webhook.EventPlanCreated, module, planWebhookData(plan))
 
 	// Display plan
 	summary := plan.Summary()
-	fmt.Printf("\nPlan: %d to add, %d to change, %d to destroy\n\n", 
+	fmt.Fprintf(console, "\nPlan: %d to add, %d to change, %d to destroy\n\n", 
 		summary.ToCreate, summary.ToUpdate, summary.ToDelete)
 
 	// Show changes
 	for _, change := range plan.Changes {
 		if change.Error != nil {
-			fmt.Printf("✗ %s.%s\n", change.Resource.Type, change.Resource.Name)
-			fmt.Printf("  Error: %v\n\n", change.Error)
+			fmt.Fprintf(console, "✗ %s.%s\n", change.Resource.Type, change.Resource.Name)
+			fmt.Fprintf(console, "  Error: %v\n\n", change.Error)
 			continue
 		}
 
-		symbol := getChangeSymbol(change.Action)
-		fmt.Printf("%s %s.%s\n", symbol, change.Resource.Type, change.Resource.Name)
+		symbol := getChangeSymbol(change)
+		fmt.Fprintf(console, "%s %s.%s\n", symbol, change.Resource.Type, change.Resource.Name)
 		
 		if change.Action != core.ActionNoOp {
 			displayChangeDiff(change)
 		}
-		fmt.Println()
+		fmt.Fprintln(console)
+	}
+	displayDeviations(summary.Deviations)
+
+	if saved != nil {
+		if err := saved.file.Check(map[string]*core.Plan{localHost: plan}); err != nil {
+			return err
+		}
 	}
 
 	// Check if there are any changes to apply
 	if !plan.HasChanges() {
-		fmt.Println("No changes. Infrastructure is up-to-date.")
+		displayNoChanges(summary.Deviations)
 		return nil
 	}
 
 	// Check for errors in plan
 	if summary.Errors > 0 {
-		fmt.Printf("Cannot apply plan due to %d error(s). Please fix the errors and try again.\n", summary.Errors)
+		fmt.Fprintf(console, "Cannot apply plan due to %d error(s). Please fix the errors and try again.\n", summary.Errors)
 		return fmt.Errorf("plan contains errors")
 	}
 
+	if err := checkTopology(module, !applyDryRun); err != nil {
+		return err
+	}
+
 	// Dry run mode
 	if applyDryRun {
-		fmt.Println("This was a dry run. No changes were actually applied.")
+		fmt.Fprintln(console, "This was a dry run. No changes were actually applied.")
 		return nil
 	}
 
+	if err := requireApproval(context.Background(), module); err != nil {
+		return err
+	}
 	// Ask for confirmation unless auto-approve is set
-	if !applyAutoApprove {
-		fmt.Print("\nDo you want to perform these actions? (yes/no): ")
-		var response string
-		fmt.Scanln(&response)
-		if response != "yes" && response != "y" {
-			fmt.Println("Apply cancelled.")
-			return nil
-		}
+	if approved, err := confirmApply(saved); err != nil || !approved {
+		return err
 	}
 
 	// Apply the plan
-	fmt.Println("\nApplying changes...")
-	executor := core.NewExecutor(registry)
+	fmt.Fprintln(console, "\nApplying changes...")
+	sendWebhook(context.Background(), webhooks, webhook.EventApplyStarted, module, map[string]interface{}{
+		"fingerprint": fingerprint.ID(),
+	})
+	runObservers.Applying([]string{localHost})
+	scheduler := executor.NewScheduler(0)
+	finishRollout := startRollout(module, "", []string{localHost})
 	
-	result, err := executor.ExecutePlan(context.Background(), plan)
+	result, err := scheduler.Execute(streamOutput(context.Background(), localHost), plan, registry)
+	finishRollout()
+	runObservers.Applied(localHost, result, err)
 	if err != nil {
+		recordExecution(context.Background(), module, fingerprint, err, nil, nil)
+		sendWebhook(context.Background(), webhooks, webhook.EventApplyFinished, module, map[string]interface{}{
+			"fingerprint": fingerprint.ID(),
+			"status":      "failed",
+			"error":       err.Error(),
+		})
 		return fmt.Errorf("failed to execute plan: %w", err)
 	}
+	
+	var execErr error
+	if result.Summary.Failed > 0 {
+		execErr = fmt.Errorf("%d change(s) failed", result.Summary.Failed)
+	}
+	localReport := executor.NewRunReport()
+	localReport.Add(executor.HostResult{Host: localHost, Result: result})
+	recordExecution(context.Background(), module, fingerprint, execErr, localReport, map[string]interface{}{
+		"succeeded": result.Summary.Succeeded,
+		"failed":    result.Summary.Failed,
+	})
+	status := report.StatusSucceeded
+	if execErr != nil {
+		status = report.StatusFailed
+	}
+	runObservers.SetStatus(status)
+	sendWebhook(context.Background(), webhooks, webhook.EventApplyFinished, module, map[string]interface{}{
+		"fingerprint": fingerprint.ID(),
+		"status":      status,
+		"succeeded":   result.Summary.Succeeded,
+		"failed":      result.Summary.Failed,
+		"duration":    result.Summary.Duration.String(),
+	})
 
 	// Display results
-	fmt.Printf("\nApply complete! Resources: %d added, %d changed, %d destroyed.\n",
+	fmt.Fprintf(console, "\nApply complete! Resources: %d added, %d changed, %d destroyed.\n",
 		countActionResults(result, core.ActionCreate),
 		countActionResults(result, core.ActionUpdate),
 		countActionResults(result, core.ActionDelete))
 
-	fmt.Printf("Duration: %v\n", result.Summary.Duration)
+	fmt.Fprintf(console, "Duration: %v\n", result.Summary.Duration)
+	displayHandlers(result)
+	fmt.Fprintf(console, "Fingerprint: %s\n", fingerprint.ID())
 
 	// Show any failures
 	if result.Summary.Failed > 0 {
-		fmt.Printf("\nFailed changes:\n")
+		fmt.Fprintf(console, "\nFailed changes:\n")
 		for _, changeResult := range result.Changes {
 			if !changeResult.Success && changeResult.Error != nil {
-				fmt.Printf("✗ %s.%s: %v\n", 
+				fmt.Fprintf(console, "✗ %s.%s: %v\n", 
 					changeResult.Change.Resource.Type, 
 					changeResult.Change.Resource.Name, 
 					changeResult.Error)
@@ -172,20 +506,1217 @@ func runApply(cmd *cobra.Command, args []string) error {
 		}
 	}
 
-	// Show inventory info if loaded
-	if inv != nil {
-		fmt.Printf("\nTargeted %d host groups\n", len(inv.Targets))
+	return nil
+}
+
+// confirmApply asks whether to carry out the plan shown, unless the apply
+// was approved up front with --auto-approve or is of a saved plan that was
+// reviewed. Only "yes" approves, and without a terminal to ask on the apply
+// is refused rather than guessed.
+func confirmApply(saved *savedPlan) (bool, error) {
+	if applyAutoApprove || saved != nil {
+		return true, nil
+	}
+	if machineMode {
+		runObservers.SetStatus(statusCancelled)
+		return false, fmt.Errorf("apply needs approval, which --machine cannot ask for; review the plan and pass --auto-approve")
+	}
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		runObservers.SetStatus(statusCancelled)
+		return false, fmt.Errorf("apply needs approval but there is no terminal to ask on; review the plan and pass --auto-approve")
+	}
+	fmt.Fprint(console, "\nDo you want to perform these actions?\n")
+	fmt.Fprint(console, "  Only 'yes' will be accepted to approve.\n\n  Enter a value: ")
+	var response string
+	fmt.Scanln(&response)
+	if strings.TrimSpace(response) != "yes" {
+		fmt.Fprintln(console, "\nApply cancelled.")
+		runObservers.SetStatus(statusCancelled)
+		return false, nil
 	}
+	return true, nil
+}
 
-	return nil
+// displayNoChanges reports a plan with nothing to apply; with audited
+// resources deviating it is not up to date
+func displayNoChanges(deviations int) {
+	if deviations > 0 {
+		fmt.Fprintln(console, "No changes to apply.")
+		return
+	}
+	fmt.Fprintln(console, "No changes. Infrastructure is up-to-date.")
 }
 
 func countActionResults(result *core.ExecutionResult, action core.Action) int {
 	count := 0
 	for _, changeResult := range result.Changes {
-		if changeResult.Success && changeResult.Change.Action == action {
+		if changeResult.Success && changeResult.Handler == "" && changeResult.Change.Action == action {
 			count++
 		}
 	}
 	return count
 }
+
+// unreachablePolicy builds the unreachable-host policy from flags and config
+func unreachablePolicy() (executor.UnreachablePolicy, error) {
+	policy := executor.UnreachablePolicy{
+		Action:     executor.UnreachableAction(viper.GetString("unreachable.action")),
+		MaxPercent: viper.GetFloat64("unreachable.max_percent"),
+	}
+	if policy.Action == "" {
+		policy.Action = executor.UnreachableFail
+	}
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	return policy, nil
+}
+
+// rolloutStrategy returns the strategy the module rolls out with: its own,
+// with --canary, --canary-window, --serial and --max-fail-percentage, or
+// their config, taking precedence. --canary turns a rolling strategy into a
+// canary one that rolls out the remaining hosts in the same waves. Without
+// a strategy every host is applied to at once.
+func rolloutStrategy(module *core.Module) (*core.Strategy, error) {
+	var strategy *core.Strategy
+	if module.Spec.Strategy != nil {
+		own := *module.Spec.Strategy
+		strategy = &own
+	}
+	if selector := viper.GetString("rollout.canary"); selector != "" {
+		if strategy == nil {
+			strategy = &core.Strategy{}
+		}
+		strategy.Type = core.StrategyCanary
+		strategy.Selector = selector
+	}
+	if viper.IsSet("rollout.canary_window") {
+		if strategy == nil || strategy.Type != core.StrategyCanary {
+			return nil, fmt.Errorf("--canary-window needs a canary rollout, from --canary or the module's strategy")
+		}
+		strategy.Window = viper.GetDuration("rollout.canary_window")
+	}
+	if serial := viper.GetString("rollout.serial"); serial != "" {
+		if strategy == nil {
+			strategy = &core.Strategy{Type: core.StrategyRolling}
+		}
+		strategy.Batch = serial
+	}
+	if viper.IsSet("rollout.max_fail_percentage") {
+		if strategy == nil {
+			return nil, fmt.Errorf("--max-fail-percentage needs a rolling or canary rollout, from --serial, --canary or the module's strategy")
+		}
+		strategy.MaxFailPercentage = viper.GetFloat64("rollout.max_fail_percentage")
+	}
+	if strategy == nil {
+		return nil, nil
+	}
+	if err := strategy.Validate(); err != nil {
+		return nil, fmt.Errorf("rollout strategy: %w", err)
+	}
+	return strategy, nil
+}
+
+// hostSession holds the pooled target and computed plan for one host
+type hostSession struct {
+	target *providers.Target
+	plan   *core.Plan
+}
+
+// runApplyHosts plans and applies a module on every host in the inventory.
+// With a saved plan the plans made are saved to it instead, or must match it
+// before they are applied.
+// A shared host pool keeps connections and facts for later runs; without one
+// the run opens its own and closes it when done.
+func runApplyHosts(ctx context.Context, module *core.Module, inv *inventory.Inventory, fingerprint *audit.Fingerprint, webhooks *webhook.Dispatcher, saved *savedPlan, shared *hostPool) error {
+	if err := checkPolicies(ctx, module); err != nil {
+		return err
+	}
+	policy, err := unreachablePolicy()
+	if err != nil {
+		return err
+	}
+	strategy, err := rolloutStrategy(module)
+	if err != nil {
+		return err
+	}
+	_, window, err := transferSettings()
+	if err != nil {
+		return err
+	}
+	catalog, err := packageCatalog()
+	if err != nil {
+		return err
+	}
+	runLimit, err := runLimits()
+	if err != nil {
+		return err
+	}
+	output := runLimit.NewOutput(warnLimit)
+	defer output.Close()
+	planSizes := runLimit.NewPlans(warnLimit)
+
+	hosts, conflicts, err := inv.Resolve()
+	displayConflicts(conflicts)
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		return fmt.Errorf("inventory does not declare any hosts")
+	}
+
+	quarantine, err := loadQuarantine()
+	if err != nil {
+		return err
+	}
+	hosts, quarantined := quarantine.Filter(hosts)
+	displayQuarantined(quarantined)
+
+	health, err := loadHealth()
+	if err != nil {
+		return err
+	}
+	hosts = health.Order(hosts, inventory.SchedulingPreference{
+		HealthiestFirst: viper.GetBool("scheduling.healthiest_first"),
+		DeferFlapping:   viper.GetBool("scheduling.defer_flapping"),
+	})
+
+	connections := make(map[string]ssh.ConnectionConfig, len(hosts))
+	groups := make(map[string]string, len(hosts))
+	labels := make(map[string]map[string]string, len(hosts))
+	names := make([]string, 0, len(hosts))
+	for _, host := range hosts {
+		connections[host.Name] = withHostKeySettings(host.Connection)
+		groups[host.Name] = host.Group
+		labels[host.Name] = host.Labels
+		names = append(names, host.Name)
+	}
+	if err := resolveBecomePasswords(ctx, connections); err != nil {
+		return err
+	}
+
+	// Collecting resources see what every host in this run will export,
+	// on top of what earlier runs published
+	exports, err := loadExports()
+	if err != nil {
+		return err
+	}
+	pending := exports.Clone()
+	for _, name := range names {
+		pending.Replace(name, module.Metadata.Name, core.ModuleExports(module, name))
+	}
+
+	hostConns := shared
+	if hostConns == nil {
+		hostConns, err = newHostPool()
+		if err != nil {
+			return err
+		}
+		defer hostConns.close()
+	}
+	pool := hostConns.targets
+
+	var mu sync.Mutex
+	sessions := make(map[string]*hostSession)
+	leaders := make(map[string][]string)
+	preflights := make(map[string]*core.PreflightReport)
+	incompatible := make(map[string][]core.Incompatibility)
+
+	runner := executor.NewHostRunner(0, policy)
+	execution := history.NewExecution(module.Metadata.Name, fingerprint.ID())
+	execution.TriggeredBy = triggeredBy()
+	execution.ModuleSource, execution.ModuleRevision = fingerprint.ModuleSource, fingerprint.ModuleRevision
+
+	// Connect to every host and plan
+	fmt.Fprintf(console, "Creating execution plan for %d host(s)...\n", len(names))
+	planHost := func(ctx context.Context, host string) (_ *core.ExecutionResult, err error) {
+		var plan *core.Plan
+		defer func() { runObservers.Planned(host, plan, err) }()
+
+		target, err := pool.Get(ctx, connections[host])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", executor.ErrHostUnreachable, err)
+		}
+
+		// A host whose facts are unknown cannot be told apart by them
+		if module.Spec.Selector != "" && target.System == nil {
+			return nil, fmt.Errorf("cannot match the module's selector: %v", target.FactsErr)
+		}
+
+		if requires := module.Spec.Requires; requires != nil {
+			if unmet := requires.Check(target.System); len(unmet) > 0 {
+				mu.Lock()
+				incompatible[host] = unmet
+				mu.Unlock()
+				return nil, fmt.Errorf("incompatible with the module: %s", describeIncompatible(unmet))
+			}
+		}
+
+		if preflight := module.Spec.Preflight; preflight != nil {
+			result, err := runPreflight(ctx, preflight, host, target)
+			if err != nil {
+				return nil, err
+			}
+			mu.Lock()
+			preflights[host] = result
+			mu.Unlock()
+			if failed := result.Failed(); len(failed) > 0 {
+				return nil, fmt.Errorf("preflight failed: %s", describePreflight(failed))
+			}
+		}
+
+		planner := core.NewPlanner(target.Registry)
+		planner.SetExports(pending)
+		planner.SetFacts(target.Facts)
+		planner.SetSystemFacts(target.System)
+		planner.SetLabels(labels[host])
+		planner.SetPackages(catalog)
+		planner.SetSelection(resourceSelection)
+		planner.SetAuditOnly(auditOnly)
+		planner.SetOutputLimit(output)
+		plan, err = planner.CreatePlan(module)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create plan: %w", err)
+		}
+		planSizes.Add(host, plan.Size())
+
+		leader, err := probeLeader(ctx, inv.Targets[groups[host]].Cluster, target)
+		if err != nil {
+			return nil, err
+		}
+
+		mu.Lock()
+		sessions[host] = &hostSession{target: target, plan: plan}
+		if leader {
+			leaders[groups[host]] = append(leaders[groups[host]], host)
+		}
+		mu.Unlock()
+
+		if count := plan.Summary().Errors; count > 0 {
+			return nil, fmt.Errorf("plan contains %d error(s)", count)
+		}
+		return nil, nil
+	}
+	report := runner.Run(ctx, names, planHost)
+	// Hosts that were briefly down get one more chance once the others are
+	// planned, unless unreachable hosts are ignored anyway
+	if unreachable := report.UnreachableHosts(); len(unreachable) > 0 && policy.Action != executor.UnreachableIgnore {
+		fmt.Fprintf(console, "Retrying %d unreachable host(s)...\n", len(unreachable))
+		report = runner.RetryUnreachable(ctx, report, planHost)
+	}
+	// Dry runs, saved plans and runs cancelled before they apply say
+	// nothing about how the hosts hold up, so they are not recorded
+	recordable := !applyDryRun && (saved == nil || saved.out == "")
+	defer func() {
+		if recordable && ctx.Err() == nil {
+			recordHealth(health, report)
+		}
+	}()
+	execution.AddReport(history.PhasePlan, report, nil)
+
+	for _, entry := range quarantined {
+		report.Add(executor.HostResult{
+			Host:   entry.Host,
+			Status: executor.HostSkipped,
+			Error:  fmt.Errorf("quarantined: %s", entry.Reason),
+		})
+	}
+
+	displayIncompatible(incompatible)
+	displayPreflight(preflights)
+
+	// Display plans for reachable hosts; apply keeps the scheduling order
+	hasChanges := false
+	reachable := make([]string, 0, len(sessions))
+	for _, name := range names {
+		if _, ok := sessions[name]; ok {
+			reachable = append(reachable, name)
+		}
+	}
+	display := append([]string(nil), reachable...)
+	sort.Strings(display)
+
+	plans := make([]*core.Plan, 0, len(display))
+	for _, name := range display {
+		plans = append(plans, sessions[name].plan)
+	}
+	planData := planWebhookData(plans...)
+	planData["hosts"] = len(display)
+	planData["unreachable"] = len(report.Unreachable())
+	sendWebhook(ctx, webhooks, webhook.EventPlanCreated, module, planData)
+
+	var total core.PlanSummary
+	planned := time.Now()
+	for _, name := range display {
+		plan := sessions[name].plan
+		execution.AddPlan(name, plan, planned)
+		summary := plan.Summary()
+		total.ToCreate += summary.ToCreate
+		total.ToUpdate += summary.ToUpdate
+		total.ToDelete += summary.ToDelete
+		total.Deviations += summary.Deviations
+		fmt.Fprintf(console, "\nHost %s - Plan: %d to add, %d to change, %d to destroy\n\n",
+			name, summary.ToCreate, summary.ToUpdate, summary.ToDelete)
+		displayRisk(inv, groups[name], plan.RiskScore())
+		if plan.Unmatched {
+			fmt.Fprintf(console, "Module selector %s does not match this host, nothing to do\n\n", module.Spec.Selector)
+			continue
+		}
+		if len(plan.Skipped) > 0 {
+			fmt.Fprintf(console, "Skipped by when conditions: %s\n\n", strings.Join(plan.Skipped, ", "))
+		}
+		for _, change := range plan.Changes {
+			if change.Error != nil {
+				fmt.Fprintf(console, "✗ %s.%s\n", change.Resource.Type, change.Resource.Name)
+				fmt.Fprintf(console, "  Error: %v\n\n", change.Error)
+				continue
+			}
+			fmt.Fprintf(console, "%s %s.%s\n", getChangeSymbol(change), change.Resource.Type, change.Resource.Name)
+			if change.Action != core.ActionNoOp {
+				displayChangeDiff(change)
+			}
+			fmt.Fprintln(console)
+		}
+		if plan.HasChanges() {
+			hasChanges = true
+		}
+	}
+	displayDeviations(total.Deviations)
+
+	displayUnreachable(report)
+
+	if failed := report.Failed(); len(failed) > 0 {
+		for _, result := range failed {
+			fmt.Fprintf(console, "✗ %s: %v\n", result.Host, result.Error)
+		}
+		return fmt.Errorf("planning failed on %d host(s)", len(failed))
+	}
+
+	if report.Status == executor.RunFailed {
+		return fmt.Errorf("%d host(s) unreachable", len(report.Unreachable()))
+	}
+
+	if len(reachable) == 0 {
+		fmt.Fprintln(console, "\nNo reachable hosts. Nothing to apply.")
+		return nil
+	}
+
+	if saved != nil {
+		byHost := make(map[string]*core.Plan, len(reachable))
+		for _, name := range reachable {
+			byHost[name] = sessions[name].plan
+		}
+		if saved.out != "" {
+			return saved.save(byHost)
+		}
+		if err := saved.file.Check(byHost); err != nil {
+			return err
+		}
+	}
+
+	if !hasChanges {
+		displayNoChanges(total.Deviations)
+		if recordChecks {
+			saveExecution(execution, string(report.Status))
+		}
+		return nil
+	}
+
+	if err := checkTopology(module, !applyDryRun); err != nil {
+		saveExecution(execution, string(executor.RunFailed))
+		return err
+	}
+
+	// Members of cluster groups roll out in quorum-safe batches after the
+	// other hosts, and are never canaries
+	clusters, others := buildClusters(inv, groups, reachable, report.UnreachableHosts(), leaders)
+	var canary *canaryRollout
+	if strategy != nil && strategy.Type == core.StrategyCanary {
+		canaries, rest, err := selectCanaries(strategy, others, sessionLabels(sessions, labels))
+		if err == nil && len(canaries) == 0 {
+			err = fmt.Errorf("no reachable host outside a cluster matches the canary selector %s", strategy.Selector)
+		}
+		if err != nil {
+			saveExecution(execution, string(executor.RunFailed))
+			return err
+		}
+		canary = &canaryRollout{strategy: strategy, hosts: canaries, sessions: sessions, webhooks: webhooks, module: module}
+		others = rest
+	}
+
+	displayTransferWindow(window, time.Now())
+
+	if applyDryRun {
+		fmt.Fprintln(console, "This was a dry run. No changes were actually applied.")
+		if recordChecks {
+			saveExecution(execution, string(report.Status))
+		}
+		return nil
+	}
+
+	if len(display) > 1 {
+		fmt.Fprintf(console, "\nTotal - Plan: %d to add, %d to change, %d to destroy on %d host(s)\n",
+			total.ToCreate, total.ToUpdate, total.ToDelete, len(display))
+	}
+	if err := requireApproval(ctx, module); err != nil {
+		recordable = false
+		return err
+	}
+	if approved, err := confirmApply(saved); err != nil || !approved {
+		recordable = false
+		return err
+	}
+
+	if err := waitForTransferWindow(ctx, window); err != nil {
+		return err
+	}
+
+	if err := snapshotHosts(ctx, inv, groups, reachable, sessions, execution); err != nil {
+		saveExecution(execution, string(executor.RunFailed))
+		return err
+	}
+
+	// Apply the plans on every reachable host
+	finishRollout := startRollout(module, execution.ID, reachable)
+	defer finishRollout()
+	fmt.Fprintln(console, "\nApplying changes...")
+	sendWebhook(ctx, webhooks, webhook.EventApplyStarted, module, map[string]interface{}{
+		"fingerprint": fingerprint.ID(),
+		"hosts":       len(reachable),
+	})
+	runObservers.Applying(reachable)
+	applyHost := func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+		session := sessions[host]
+		result, err := executor.NewScheduler(0).Execute(streamOutput(ctx, host), session.plan, session.target.Registry)
+		runObservers.Applied(host, result, err)
+		return result, err
+	}
+
+	// Canaries are applied to first, and the other hosts roll out in waves
+	// when the strategy has a batch size
+	batches := make(map[string]string)
+	applyReport := executor.NewRunReport()
+	var halted error
+	if canary != nil {
+		for _, host := range canary.hosts {
+			batches[host] = "canary"
+		}
+		canaryReport, err := canary.run(ctx, runner, applyHost)
+		applyReport.Merge(canaryReport)
+		halted = err
+	}
+	switch {
+	case halted != nil:
+		skipHosts(applyReport, others, halted)
+	case strategy != nil && strategy.Batch != "" && len(others) > 0:
+		rolling := executor.Rolling{BatchSize: strategy.BatchSize(len(others)), MaxFailPercent: strategy.MaxFailPercentage}
+		displayRolling(rolling, len(others))
+		for i, batch := range rolling.Batches(others) {
+			for _, host := range batch {
+				batches[host] = fmt.Sprintf("rolling/%d", i+1)
+			}
+		}
+		rollingReport := runner.RunRolling(ctx, others, rolling, applyHost)
+		applyReport.Merge(rollingReport)
+		if skipped := rollingReport.Skipped(); len(skipped) > 0 {
+			halted = skipped[0].Error
+		}
+	default:
+		applyReport.Merge(runner.Run(ctx, others, applyHost))
+	}
+	for _, cluster := range clusters {
+		if halted != nil {
+			skipHosts(applyReport, cluster.Members, halted)
+			continue
+		}
+		displayCluster(cluster)
+		for i, batch := range cluster.Batches() {
+			for _, host := range batch {
+				batches[host] = fmt.Sprintf("%s/%d", cluster.Name, i+1)
+			}
+		}
+		applyReport.Merge(runner.RunCluster(ctx, cluster, applyHost))
+	}
+	applyReport.EndTime = time.Now()
+	applyReport.Status = policy.Evaluate(applyReport)
+	// A rollout that halted did not apply to every host it was meant to
+	if halted != nil {
+		applyReport.Status = executor.RunFailed
+	}
+	execution.AddReport(history.PhaseApply, applyReport, batches)
+	report.Merge(applyReport)
+	report.Status = policy.Evaluate(report)
+	if halted != nil {
+		report.Status = executor.RunFailed
+	}
+	report.Fingerprint = fingerprint
+	runObservers.SetStatus(string(report.Status))
+	publishExports(exports, module, applyReport)
+
+	var execErr error
+	switch {
+	case halted != nil:
+		execErr = halted
+	case report.Status == executor.RunFailed:
+		execErr = fmt.Errorf("apply failed on %d host(s), %d unreachable", len(report.Failed()), len(report.Unreachable()))
+	}
+	recordExecution(ctx, module, fingerprint, execErr, report, map[string]interface{}{
+		"status":      string(report.Status),
+		"hosts":       len(report.Hosts),
+		"failed":      len(report.Failed()),
+		"unreachable": len(report.Unreachable()),
+	})
+	sendWebhook(ctx, webhooks, webhook.EventApplyFinished, module, map[string]interface{}{
+		"fingerprint": fingerprint.ID(),
+		"status":      string(report.Status),
+		"hosts":       len(report.Hosts),
+		"failed":      len(report.Failed()),
+		"unreachable": len(report.Unreachable()),
+	})
+
+	fmt.Fprintf(console, "\nApply complete on %d host(s):\n", len(reachable))
+	for _, result := range report.Hosts {
+		if result.Status == executor.HostUnreachable {
+			continue
+		}
+		if result.Status == executor.HostSkipped {
+			if _, planned := sessions[result.Host]; planned {
+				fmt.Fprintf(console, "  %s: %s (%v)\n", result.Host, result.Status, result.Error)
+			}
+			continue
+		}
+		fmt.Fprintf(console, "  %s: %s (%v)\n", result.Host, result.Status, result.Duration)
+		if result.Result != nil {
+			for _, changeResult := range result.Result.Changes {
+				if !changeResult.Success && changeResult.Error != nil {
+					fmt.Fprintf(console, "    ✗ %s.%s: %v\n",
+						changeResult.Change.Resource.Type,
+						changeResult.Change.Resource.Name,
+						changeResult.Error)
+				}
+			}
+		}
+	}
+	displayUnreachable(report)
+	if shared == nil {
+		displayConnections(hostConns.connections.Metrics())
+	}
+	fmt.Fprintf(console, "\nFingerprint: %s\n", fingerprint.ID())
+	saveExecution(execution, string(report.Status))
+
+	switch report.Status {
+	case executor.RunFailed:
+		return execErr
+	case executor.RunPartial:
+		fmt.Fprintf(warnings(), "\nWarning: apply partially succeeded, %.0f%% of hosts unreachable\n", report.UnreachablePercent())
+	}
+
+	return nil
+}
+
+// hostPool holds the connections and per-host provider instances of a run,
+// or of several runs that share them
+type hostPool struct {
+	connections *ssh.ConnectionPool
+	targets     *providers.TargetPool
+	// auditLog records provider applies as they happen, when configured
+	auditLog *audit.AuditLogger
+}
+
+// newHostPool opens an empty host pool with the configured connection
+// limits, bandwidth cap, command hooks and interceptors
+func newHostPool() (*hostPool, error) {
+	limiter, _, err := transferSettings()
+	if err != nil {
+		return nil, err
+	}
+	connPool, err := connectionPool()
+	if err != nil {
+		return nil, err
+	}
+	hooks, err := commandHooks()
+	if err != nil {
+		return nil, err
+	}
+	// Encrypted keys without a configured passphrase are unlocked interactively
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		ssh.SetPassphrasePrompt(promptPassphrase)
+	}
+
+	// Each host gets its own provider instances; SSH hosts share pooled connections
+	pool := providers.NewTargetPool(providerFactories(), providers.PooledDialer(connPool))
+	pool.SetBandwidth(limiter)
+	pool.SetDebugLogger(debugLogger)
+	pool.SetOsquery(viper.GetBool("facts.osquery"))
+	pool.SetFactsCache(factsCache())
+	pool.SetCommandHooks(hooks...)
+
+	// Provider errors are redacted before anything else sees them, so
+	// the audit log is the outermost interceptor
+	hostConns := &hostPool{connections: connPool, targets: pool}
+	interceptors := []types.Interceptor{outputRedactor.Interceptor()}
+	if path := viper.GetString("audit.file"); path != "" && viper.GetBool("audit.operations") {
+		hostConns.auditLog = audit.NewAuditLogger(path)
+		interceptors = append([]types.Interceptor{hostConns.auditLog.Interceptor(func(err error) {
+			fmt.Fprintf(warnings(), "Warning: failed to write audit log: %v\n", err)
+		})}, interceptors...)
+	}
+	pool.SetInterceptors(interceptors...)
+	return hostConns, nil
+}
+
+// close disconnects from every host of the pool
+func (p *hostPool) close() {
+	p.targets.CloseAll()
+	if p.auditLog != nil {
+		p.auditLog.Close()
+	}
+}
+
+// transferSettings returns the global bandwidth cap and off-peak transfer
+// window from flags and config; either may be nil
+func transferSettings() (*bandwidth.Limiter, *bandwidth.Window, error) {
+	var limiter *bandwidth.Limiter
+	if value := viper.GetString("transfers.bandwidth"); value != "" {
+		rate, err := bandwidth.ParseRate(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		limiter = bandwidth.NewLimiter(rate)
+	}
+
+	var window *bandwidth.Window
+	if value := viper.GetString("transfers.window"); value != "" {
+		parsed, err := bandwidth.ParseWindow(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		window = &parsed
+	}
+	return limiter, window, nil
+}
+
+// displayTransferWindow warns when changes are about to be applied outside the off-peak window
+func displayTransferWindow(window *bandwidth.Window, now time.Time) {
+	if window == nil || window.Contains(now) {
+		return
+	}
+	opens := window.Next(now)
+	fmt.Fprintf(console, "Note: outside the off-peak transfer window %s; it opens at %s (in %s).\n",
+		window, opens.Format("15:04"), strings.TrimSuffix(opens.Sub(now).Round(time.Minute).String(), "0s"))
+	if !viper.GetBool("transfers.wait_for_window") {
+		fmt.Fprintln(console, "Use --wait-for-window to hold the apply until then.")
+	}
+	fmt.Fprintln(console)
+}
+
+// waitForTransferWindow blocks until the off-peak window opens when asked to
+func waitForTransferWindow(ctx context.Context, window *bandwidth.Window) error {
+	if window == nil || !viper.GetBool("transfers.wait_for_window") {
+		return nil
+	}
+	now := time.Now()
+	opens := window.Next(now)
+	if !opens.After(now) {
+		return nil
+	}
+	fmt.Fprintf(console, "\nWaiting for the transfer window to open at %s...\n", opens.Format("15:04"))
+	timer := time.NewTimer(opens.Sub(now))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// providerFactories returns the core provider factories sharing one artifact
+// cache, so artifacts used by many hosts are downloaded once
+func providerFactories() *providers.FactoryRegistry {
+	dir := viper.GetString("artifacts.dir")
+	if dir == "" {
+		dir = artifact.DefaultCacheDir
+	}
+	factories := providers.DefaultFactoryRegistry()
+	factories.SetArtifactCache(artifact.NewCache(dir))
+	return factories
+}
+
+// factsCache returns the cache of host facts kept between runs
+func factsCache() *facts.Cache {
+	dir := viper.GetString("facts.cache_dir")
+	if dir == "" {
+		dir = facts.DefaultCacheDir
+	}
+	return facts.NewCache(dir, viper.GetDuration("facts.cache_ttl"))
+}
+
+// commandHooks returns the hooks every command run on hosts passes: those
+// matching policy.deny_commands are refused
+func commandHooks() ([]transport.CommandHook, error) {
+	patterns := viper.GetStringSlice("policy.deny_commands")
+	if len(patterns) == 0 {
+		return nil, nil
+	}
+	deny, err := transport.DenyCommands(patterns)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy.deny_commands: %w", err)
+	}
+	return []transport.CommandHook{deny}, nil
+}
+
+// connectionPool creates the SSH connection pool with the configured limits
+func connectionPool() (*ssh.ConnectionPool, error) {
+	config := ssh.PoolConfig{
+		MaxConnections:           viper.GetInt("ssh.max_connections"),
+		MaxConnectionsPerHost:    viper.GetInt("ssh.max_connections_per_host"),
+		MaxSessionsPerConnection: viper.GetInt("ssh.max_sessions_per_connection"),
+		ConnectRate:              viper.GetFloat64("ssh.connect_rate"),
+		HostConnectInterval:      viper.GetDuration("ssh.host_connect_interval"),
+	}
+	if err := config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid ssh configuration: %w", err)
+	}
+	return ssh.NewConnectionPool(config), nil
+}
+
+// displayConnections summarizes how the run used SSH connections
+func displayConnections(metrics ssh.PoolMetrics) {
+	if metrics.Dialed == 0 {
+		return
+	}
+	fmt.Fprintf(console, "\nSSH connections: %d opened, %d at most at once, %d evicted\n", metrics.Dialed, metrics.Peak, metrics.Evicted)
+	if metrics.Waits > 0 {
+		fmt.Fprintf(console, "  %d command(s) waited for a connection, %v in total, %v at most\n",
+			metrics.Waits, metrics.WaitTime.Round(time.Millisecond), metrics.LongestWait.Round(time.Millisecond))
+	}
+	if metrics.Throttled > 0 {
+		fmt.Fprintf(console, "  %d connection(s) delayed by the connection rate limits\n", metrics.Throttled)
+	}
+}
+
+// promptPassphrase asks for the passphrase of an encrypted SSH key on the terminal
+func promptPassphrase(key string) ([]byte, error) {
+	fmt.Fprintf(os.Stderr, "Enter passphrase for key '%s': ", key)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	return passphrase, err
+}
+
+// serverHealth is the health history forge server keeps for all its runs,
+// so the scores its dashboard serves follow them
+var serverHealth *inventory.HealthTracker
+
+// loadHealth loads the configured host health history
+func loadHealth() (*inventory.HealthTracker, error) {
+	if serverHealth != nil {
+		return serverHealth, nil
+	}
+	filename := viper.GetString("health.file")
+	if filename == "" {
+		filename = defaultHealthFile
+	}
+	tracker, err := inventory.LoadHealthTracker(filename, inventory.DefaultHealthWindow)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load health history: %w", err)
+	}
+	return tracker, nil
+}
+
+// recordHealth adds the outcome of a run to the health history
+func recordHealth(tracker *inventory.HealthTracker, report *executor.RunReport) {
+	report.RecordHealth(tracker)
+	if err := tracker.Save(); err != nil {
+		fmt.Fprintf(warnings(), "Warning: failed to save health history: %v\n", err)
+	}
+}
+
+// probeLeader runs a cluster's leader probe on a target and reports whether it is the leader
+func probeLeader(ctx context.Context, cluster *inventory.ClusterConfig, target *providers.Target) (bool, error) {
+	if cluster == nil || cluster.LeaderProbe == "" {
+		return false, nil
+	}
+	result, err := target.Connection.Execute(ctx, cluster.LeaderProbe)
+	if err != nil {
+		return false, fmt.Errorf("leader probe failed: %w", err)
+	}
+	return result.ExitCode == 0, nil
+}
+
+// buildClusters groups the reachable members of cluster target groups for a
+// quorum-safe rollout and returns them along with the remaining hosts.
+// Members that were unreachable count as down; those left out of the run
+// are up as far as forge knows.
+func buildClusters(inv *inventory.Inventory, groups map[string]string, reachable, unreachable []string, leaders map[string][]string) ([]executor.Cluster, []string) {
+	down := make(map[string]int)
+	for _, host := range unreachable {
+		down[groups[host]]++
+	}
+	var others []string
+	members := make(map[string][]string)
+	for _, host := range reachable {
+		if inv.Targets[groups[host]].Cluster == nil {
+			others = append(others, host)
+			continue
+		}
+		members[groups[host]] = append(members[groups[host]], host)
+	}
+
+	var clusters []executor.Cluster
+	for _, name := range inv.GroupNames() {
+		if len(members[name]) == 0 {
+			continue
+		}
+		group := inv.Targets[name]
+		total := len(group.Hosts)
+		cluster := executor.Cluster{
+			Name:           name,
+			Members:        members[name],
+			MaxUnavailable: group.Cluster.MaxUnavailable(total, down[name]),
+		}
+		switch found := leaders[name]; len(found) {
+		case 0:
+		case 1:
+			cluster.Leader = found[0]
+		default:
+			sort.Strings(found)
+			fmt.Fprintf(warnings(), "Warning: cluster %s reported %d leaders (%v), applying to members in name order\n", name, len(found), found)
+		}
+		clusters = append(clusters, cluster)
+	}
+	return clusters, others
+}
+
+// displayCluster announces a cluster rollout
+func displayCluster(cluster executor.Cluster) {
+	if cluster.Leader == "" {
+		fmt.Fprintf(console, "Rolling out cluster %s, %d member(s) at a time\n", cluster.Name, cluster.MaxUnavailable)
+		return
+	}
+	fmt.Fprintf(console, "Rolling out cluster %s, %d member(s) at a time, leader %s last\n", cluster.Name, cluster.MaxUnavailable, cluster.Leader)
+}
+
+// skipHosts records hosts a rollout halted before as skipped
+func skipHosts(report *executor.RunReport, hosts []string, reason error) {
+	for _, host := range hosts {
+		report.Add(executor.HostResult{Host: host, Status: executor.HostSkipped, Error: reason})
+	}
+}
+
+// displayRolling announces a rolling rollout
+func displayRolling(rolling executor.Rolling, hosts int) {
+	fmt.Fprintf(console, "Rolling out to %d host(s), %d at a time, halting when more than %v%% fail\n", hosts, rolling.BatchSize, rolling.MaxFailPercent)
+}
+
+// loadExports loads the configured store of exported resources
+func loadExports() (*core.ExportStore, error) {
+	filename := viper.GetString("exports.file")
+	if filename == "" {
+		filename = defaultExportsFile
+	}
+	store, err := core.LoadExportStore(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load exported resources: %w", err)
+	}
+	return store, nil
+}
+
+// publishExports records the exports of every host the module was applied to successfully
+func publishExports(store *core.ExportStore, module *core.Module, report *executor.RunReport) {
+	if len(store.List()) == 0 && len(core.ModuleExports(module, "")) == 0 {
+		return
+	}
+	for _, result := range report.Succeeded() {
+		store.Replace(result.Host, module.Metadata.Name, core.ModuleExports(module, result.Host))
+	}
+	if err := store.Save(); err != nil {
+		fmt.Fprintf(warnings(), "Warning: failed to save exported resources: %v\n", err)
+	}
+}
+
+// displayHandlers lists the handlers that ran during an apply
+func displayHandlers(result *core.ExecutionResult) {
+	for _, changeResult := range result.Changes {
+		if changeResult.Handler == "" {
+			continue
+		}
+		if changeResult.Success {
+			fmt.Fprintf(console, "Handler %s: ran\n", changeResult.Handler)
+		} else {
+			fmt.Fprintf(console, "Handler %s: failed\n", changeResult.Handler)
+		}
+	}
+}
+
+// recordExecution writes the execution and its fingerprint to the audit log,
+// if one is configured, with a summary of every change the report applied
+func recordExecution(ctx context.Context, module *core.Module, fingerprint *audit.Fingerprint, execErr error, report *executor.RunReport, metadata map[string]interface{}) {
+	path := viper.GetString("audit.file")
+	if path == "" {
+		return
+	}
+
+	logger := audit.NewAuditLogger(path)
+	defer logger.Close()
+	if viper.IsSet("audit.value_limit") {
+		logger.SetValueLimit(viper.GetInt("audit.value_limit"))
+	}
+	if viper.GetBool("audit.full_diffs") {
+		sealer := atRestSealer()
+		if sealer.KeyID() == "" {
+			fmt.Fprintln(warnings(), "Warning: full diffs are not stored in the audit log: they need encryption.key_id to be encrypted")
+		} else {
+			logger.SetDiffBlobs(audit.NewDiffBlobs(auditDiffsDir(path), sealer))
+		}
+	}
+
+	if report != nil {
+		for _, host := range report.Hosts {
+			if host.Result == nil {
+				continue
+			}
+			for _, changeResult := range host.Result.Changes {
+				change := changeResult.Change
+				if change.Diff == nil || change.Diff.Action == types.ActionNoop {
+					continue
+				}
+				if err := logger.LogHostResourceChange(ctx, host.Host, &change.Resource, change.Diff, changeResult.Success, changeResult.Error); err != nil {
+					fmt.Fprintf(warnings(), "Warning: failed to write audit log: %v\n", err)
+				}
+			}
+		}
+	}
+
+	if err := logger.LogExecution(ctx, module.Metadata.Name, fingerprint, execErr == nil, execErr, metadata); err != nil {
+		fmt.Fprintf(warnings(), "Warning: failed to write audit log: %v\n", err)
+	}
+}
+
+// auditDiffsDir is the directory the full diffs of an audit log are stored
+// in, unless audit.diffs_dir names another
+func auditDiffsDir(path string) string {
+	if dir := viper.GetString("audit.diffs_dir"); dir != "" {
+		return dir
+	}
+	return path + ".diffs"
+}
+
+// applyConfigDefaults fills in resource properties from the defaults section of the config file
+func applyConfigDefaults(module *core.Module) error {
+	var defaults core.Defaults
+	if err := viper.UnmarshalKey("defaults", &defaults); err != nil {
+		return fmt.Errorf("invalid defaults configuration: %w", err)
+	}
+	if err := module.ApplyDefaults(defaults); err != nil {
+		return fmt.Errorf("invalid defaults configuration: %w", err)
+	}
+	return nil
+}
+
+// packageCatalog returns the built-in package aliases and groups with those
+// of the packages section of the config file
+func packageCatalog() (*core.PackageCatalog, error) {
+	var configured core.PackageCatalog
+	if err := viper.UnmarshalKey("packages", &configured); err != nil {
+		return nil, fmt.Errorf("invalid packages configuration: %w", err)
+	}
+	catalog := core.DefaultPackageCatalog()
+	catalog.Merge(&configured)
+	if err := catalog.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid packages configuration: %w", err)
+	}
+	return catalog, nil
+}
+
+// runLimits returns the limits section of the config file, with the
+// defaults for limits it leaves out
+func runLimits() (limits.Config, error) {
+	var config limits.Config
+	if err := viper.UnmarshalKey("limits", &config); err != nil {
+		return config, fmt.Errorf("invalid limits configuration: %w", err)
+	}
+	return config.WithDefaults(), nil
+}
+
+// warnLimit reports a limit a run reached
+func warnLimit(format string, args ...interface{}) {
+	fmt.Fprintf(warnings(), "Warning: "+format+"\n", args...)
+}
+
+// varOverrides reads the --var-file files in order, then the --var values,
+// each overriding what came before
+func varOverrides(vars, varFiles []string) (map[string]interface{}, error) {
+	return loadVarOverrides(vars, varFiles, core.LoadVarFile)
+}
+
+// loadVarOverrides reads variable overrides, the --var-file files with load
+func loadVarOverrides(vars, varFiles []string, load func(string) (map[string]interface{}, error)) (map[string]interface{}, error) {
+	overrides := make(map[string]interface{})
+	for _, file := range varFiles {
+		values, err := load(file)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			overrides[key] = value
+		}
+	}
+	for _, v := range vars {
+		key, value, err := core.ParseVar(v)
+		if err != nil {
+			return nil, err
+		}
+		overrides[key] = value
+	}
+	return overrides, nil
+}
+
+// loadWebhooks returns the dispatcher for the webhooks in the config file, or nil if none are configured
+func loadWebhooks() (*webhook.Dispatcher, error) {
+	var endpoints []webhook.Endpoint
+	if err := viper.UnmarshalKey("webhooks", &endpoints); err != nil {
+		return nil, fmt.Errorf("invalid webhooks configuration: %w", err)
+	}
+	if len(endpoints) == 0 {
+		return nil, nil
+	}
+	for _, endpoint := range endpoints {
+		addDebugSecret(endpoint.Secret)
+	}
+	dispatcher, err := webhook.NewDispatcher(endpoints)
+	if err != nil {
+		return nil, fmt.Errorf("invalid webhooks configuration: %w", err)
+	}
+	return dispatcher, nil
+}
+
+// sendWebhook delivers a lifecycle event; a failed delivery does not fail the run
+func sendWebhook(ctx context.Context, dispatcher *webhook.Dispatcher, event string, module *core.Module, data map[string]interface{}) {
+	if err := dispatcher.Send(ctx, event, module.Metadata.Name, data); err != nil {
+		fmt.Fprintf(warnings(), "Warning: %v\n", err)
+	}
+}
+
+// planWebhookData summarises plans for the plan.created webhook
+func planWebhookData(plans ...*core.Plan) map[string]interface{} {
+	var total core.PlanSummary
+	for _, plan := range plans {
+		summary := plan.Summary()
+		total.ToCreate += summary.ToCreate
+		total.ToUpdate += summary.ToUpdate
+		total.ToDelete += summary.ToDelete
+		total.Errors += summary.Errors
+	}
+	return map[string]interface{}{
+		"to_create": total.ToCreate,
+		"to_update": total.ToUpdate,
+		"to_delete": total.ToDelete,
+		"errors":    total.Errors,
+	}
+}
+
+// runPreflight checks a module's preflight conditions on a host before anything is planned
+func runPreflight(ctx context.Context, preflight *core.Preflight, host string, target *providers.Target) (*core.PreflightReport, error) {
+	facts := &types.TargetFacts{Host: host}
+	if target.Facts != nil {
+		copied := *target.Facts
+		facts = &copied
+	}
+	if err := providers.GatherPreflightFacts(ctx, target.Connection, facts, preflight.Paths(), preflight.ForbiddenProcesses); err != nil {
+		return nil, err
+	}
+	report := preflight.Check(facts)
+	report.Host = host
+	return report, nil
+}
+
+// describePreflight summarizes failed preflight checks on one line
+func describePreflight(checks []core.PreflightCheck) string {
+	descriptions := make([]string, len(checks))
+	for i, check := range checks {
+		descriptions[i] = check.Name
+		if check.Detail != "" {
+			descriptions[i] += " (" + check.Detail + ")"
+		}
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// displayPreflight shows the preflight checks of every host that ran them
+func displayPreflight(reports map[string]*core.PreflightReport) {
+	if len(reports) == 0 {
+		return
+	}
+	hosts := make([]string, 0, len(reports))
+	for host := range reports {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Fprintf(console, "\nPreflight checks:\n")
+	for _, host := range hosts {
+		fmt.Fprintf(console, "  %s\n", host)
+		for _, check := range reports[host].Checks {
+			symbol := "✓"
+			if !check.Passed {
+				symbol = "✗"
+			}
+			if check.Detail != "" {
+				fmt.Fprintf(console, "    %s %s (%s)\n", symbol, check.Name, check.Detail)
+			} else {
+				fmt.Fprintf(console, "    %s %s\n", symbol, check.Name)
+			}
+		}
+	}
+}
+
+// warnUnchecked warns that a module's host requirements are not checked
+// when no host is connected to, as no facts are gathered
+func warnUnchecked(module *core.Module) {
+	if module.Spec.Requires != nil {
+		fmt.Fprintln(warnings(), "Warning: the module's host requirements are not checked, as no host's facts are gathered")
+	}
+}
+
+// describeIncompatible summarizes the requirements a host does not meet on one line
+func describeIncompatible(unmet []core.Incompatibility) string {
+	descriptions := make([]string, len(unmet))
+	for i, incompatibility := range unmet {
+		descriptions[i] = incompatibility.String()
+	}
+	return strings.Join(descriptions, "; ")
+}
+
+// displayIncompatible shows the requirements each incompatible host does not meet
+func displayIncompatible(incompatible map[string][]core.Incompatibility) {
+	if len(incompatible) == 0 {
+		return
+	}
+	hosts := make([]string, 0, len(incompatible))
+	for host := range incompatible {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	fmt.Fprintf(console, "\nIncompatible hosts (%d):\n", len(hosts))
+	for _, host := range hosts {
+		fmt.Fprintf(console, "  %s\n", host)
+		for _, incompatibility := range incompatible[host] {
+			fmt.Fprintf(console, "    ✗ %s\n", incompatibility)
+		}
+	}
+}
+
+// displayUnreachable lists unreachable hosts separately from the per-host results
+func displayUnreachable(report *executor.RunReport) {
+	unreachable := report.Unreachable()
+	if len(unreachable) == 0 {
+		return
+	}
+
+	fmt.Fprintf(console, "\nUnreachable hosts (%d):\n", len(unreachable))
+	for _, result := range unreachable {
+		fmt.Fprintf(console, "  ! %s: %v\n", result.Host, result.Error)
+	}
+}
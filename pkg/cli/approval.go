@@ -0,0 +1,231 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/approval"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/rbac"
+)
+
+var (
+	approvalComment string
+	approvalAll     bool
+)
+
+// approvalCmd represents the approval command
+var approvalCmd = &cobra.Command{
+	Use:   "approval",
+	Short: "Decide the approval requests applies wait on",
+	Long: `Applies of modules that match a workflow under approval.workflows in the
+config file need approval. Applying one without --approval submits a request
+and stops; once the approvers of every stage approved it, apply again with
+--approval <id>. Requests are kept in the controller store (--store).
+
+Approvers are named by their user name. When users are set up with
+'forge rbac', an approver must also hold the approval:decide permission.
+
+Examples:
+  forge approval list
+  forge approval approve req_1717243200000000000 --comment "change window"
+  forge approval reject req_1717243200000000000 --comment "wrong inventory"`,
+}
+
+var approvalListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List pending approval requests",
+	Args:  cobra.NoArgs,
+	RunE:  runApprovalList,
+}
+
+var approvalApproveCmd = &cobra.Command{
+	Use:   "approve <id>",
+	Short: "Approve a request for its current stage",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApprovalDecide(approval.DecisionApprove),
+}
+
+var approvalRejectCmd = &cobra.Command{
+	Use:   "reject <id>",
+	Short: "Reject a request",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runApprovalDecide(approval.DecisionReject),
+}
+
+func init() {
+	rootCmd.AddCommand(approvalCmd)
+	approvalCmd.AddCommand(approvalListCmd, approvalApproveCmd, approvalRejectCmd)
+
+	approvalListCmd.Flags().BoolVar(&approvalAll, "all", false, "List decided and expired requests too")
+	approvalApproveCmd.Flags().StringVar(&approvalComment, "comment", "", "Why the request is approved")
+	approvalRejectCmd.Flags().StringVar(&approvalComment, "comment", "", "Why the request is rejected")
+}
+
+// approvalManager returns the approval workflows and requests of the
+// controller store, with the workflows of the config file
+func approvalManager() (*approval.ApprovalManager, error) {
+	kv, err := controllerStore()
+	if err != nil {
+		return nil, err
+	}
+	var workflows []*approval.Workflow
+	if err := viper.UnmarshalKey("approval.workflows", &workflows); err != nil {
+		return nil, fmt.Errorf("invalid approval.workflows configuration: %w", err)
+	}
+	manager := approval.NewApprovalManager()
+	if err := manager.UseStore(kv); err != nil {
+		return nil, err
+	}
+	if err := manager.ReplaceWorkflows(workflows); err != nil {
+		return nil, fmt.Errorf("invalid approval.workflows configuration: %w", err)
+	}
+	return manager, nil
+}
+
+// rbacManager returns the roles and users of the controller store
+func rbacManager() (*rbac.RBACManager, error) {
+	kv, err := controllerStore()
+	if err != nil {
+		return nil, err
+	}
+	manager := rbac.NewRBACManager()
+	if err := manager.UseStore(kv); err != nil {
+		return nil, err
+	}
+	return manager, nil
+}
+
+// currentUser names the user running forge
+func currentUser() string {
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// requireApproval holds back an apply of a module that matches an approval
+// workflow. Without --approval it submits a request and stops; with it the
+// request must be approved, for this very module.
+func requireApproval(ctx context.Context, module *core.Module) error {
+	if !viper.IsSet("approval.workflows") && applyApproval == "" {
+		return nil
+	}
+	approvals, err := approvalManager()
+	if err != nil {
+		return err
+	}
+	if !approvals.RequiresApproval(ctx, currentUser(), "apply", module) {
+		return nil
+	}
+
+	if applyApproval == "" {
+		id, err := approvals.SubmitRequest(ctx, currentUser(), "apply", module)
+		if err != nil {
+			return err
+		}
+		return fmt.Errorf("applying %s needs approval: submitted request %s; apply again with --approval %s once it is approved", module.Metadata.Name, id, id)
+	}
+	request, err := approvals.GetRequest(applyApproval)
+	if err != nil {
+		return err
+	}
+	if request.Action != "apply" || !sameModule(request.Module, module) {
+		return fmt.Errorf("approval request %s was not made for this apply of %s", request.ID, module.Metadata.Name)
+	}
+	if request.Status != approval.StatusApproved {
+		return fmt.Errorf("approval request %s is %s, not approved", request.ID, request.Status)
+	}
+	return nil
+}
+
+// sameModule reports whether an approved module is the one being applied,
+// so a request cannot approve a module changed after it was submitted
+func sameModule(approved, module *core.Module) bool {
+	if approved == nil {
+		return false
+	}
+	a, err := json.Marshal(approved)
+	if err != nil {
+		return false
+	}
+	b, err := json.Marshal(module)
+	return err == nil && bytes.Equal(a, b)
+}
+
+func runApprovalList(cmd *cobra.Command, args []string) error {
+	approvals, err := approvalManager()
+	if err != nil {
+		return err
+	}
+	requests := approvals.ListPendingRequests()
+	if approvalAll {
+		requests = approvals.ListRequests()
+	}
+	if len(requests) == 0 {
+		fmt.Fprintln(console, "No approval requests.")
+		return nil
+	}
+	sort.Slice(requests, func(i, j int) bool { return requests[i].CreatedAt.Before(requests[j].CreatedAt) })
+
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tACTION\tMODULE\tWORKFLOW\tSTAGE\tSUBMITTER\tEXPIRES")
+	for _, request := range requests {
+		module := ""
+		if request.Module != nil {
+			module = request.Module.Metadata.Name
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n", request.ID, request.Status, request.Action, module,
+			request.Workflow, request.CurrentStage+1, request.Submitter, request.ExpiresAt.Local().Format(time.RFC3339))
+	}
+	return w.Flush()
+}
+
+// runApprovalDecide approves or rejects a request as the current user
+func runApprovalDecide(decision approval.Decision) func(cmd *cobra.Command, args []string) error {
+	return func(cmd *cobra.Command, args []string) error {
+		approvals, err := approvalManager()
+		if err != nil {
+			return err
+		}
+		roles, err := rbacManager()
+		if err != nil {
+			return err
+		}
+		approver := currentUser()
+		if len(roles.ListUsers()) > 0 && !roles.CheckPermission(cmd.Context(), approver, rbac.PermissionApprovalDecide, args[0]) {
+			return fmt.Errorf("%s does not have the %s permission", approver, rbac.PermissionApprovalDecide)
+		}
+
+		if decision == approval.DecisionReject {
+			err = approvals.RejectRequest(cmd.Context(), args[0], approver, approvalComment)
+		} else {
+			err = approvals.ApproveRequest(cmd.Context(), args[0], approver, approvalComment)
+		}
+		if err != nil {
+			return err
+		}
+		request, err := approvals.GetRequest(args[0])
+		if err != nil {
+			return err
+		}
+		switch request.Status {
+		case approval.StatusApproved:
+			fmt.Fprintf(console, "Approved %s; apply it with --approval %s\n", request.ID, request.ID)
+		case approval.StatusRejected:
+			fmt.Fprintf(console, "Rejected %s\n", request.ID)
+		default:
+			fmt.Fprintf(console, "Recorded the approval of %s by %s; it waits for stage %d\n", request.ID, approver, request.CurrentStage+1)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,58 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/audit"
+)
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Read the audit log",
+}
+
+var auditDiffCmd = &cobra.Command{
+	Use:   "diff <blob>",
+	Short: "Show the full diff an audit record references",
+	Long: `Decrypt and print the full changes of a resource stored with
+--audit-full-diffs. Audit records only summarize changes; the blob field of
+a record's diff names the full changes, which need the vault key they were
+encrypted with.
+
+Examples:
+  forge audit diff 3f9a... --audit-log /var/log/forge/audit.log`,
+	Args: cobra.ExactArgs(1),
+	RunE: runAuditDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+	auditCmd.AddCommand(auditDiffCmd)
+
+	auditDiffCmd.Flags().String("audit-log", "", "The audit log the record is in (default audit.file)")
+}
+
+func runAuditDiff(cmd *cobra.Command, args []string) error {
+	path, _ := cmd.Flags().GetString("audit-log")
+	if path == "" {
+		path = viper.GetString("audit.file")
+	}
+	if path == "" {
+		return fmt.Errorf("no audit log given, use --audit-log or set audit.file")
+	}
+
+	changes, err := audit.NewDiffBlobs(auditDiffsDir(path), atRestSealer()).Get(args[0])
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(changes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode diff: %w", err)
+	}
+	fmt.Fprintln(console, string(data))
+	return nil
+}
@@ -0,0 +1,95 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/bundle"
+	"github.com/spf13/cobra"
+)
+
+var (
+	bundleModuleFile string
+	bundleOutput     string
+	bundlePackages   []string
+)
+
+// bundleCmd represents the bundle command
+var bundleCmd = &cobra.Command{
+	Use:   "bundle",
+	Short: "Package modules for air-gapped environments",
+	Long: `Bundles pack a module together with its template files and
+pre-downloaded packages into a single archive. Apply a bundle with
+'forge apply --bundle' on networks where targets have no internet access.`,
+}
+
+var bundleCreateCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Create a bundle from a module",
+	Args:  cobra.NoArgs,
+	RunE:  runBundleCreate,
+}
+
+var bundleInspectCmd = &cobra.Command{
+	Use:   "inspect <bundle>",
+	Short: "Verify a bundle and list its contents",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runBundleInspect,
+}
+
+func init() {
+	rootCmd.AddCommand(bundleCmd)
+	bundleCmd.AddCommand(bundleCreateCmd, bundleInspectCmd)
+
+	bundleCreateCmd.Flags().StringVarP(&bundleModuleFile, "module", "m", "", "Path to module file (required)")
+	bundleCreateCmd.Flags().StringVarP(&bundleOutput, "output", "o", bundle.DefaultBundleFile, "Path to write the bundle to")
+	bundleCreateCmd.Flags().StringArrayVar(&bundlePackages, "package", nil, "Pre-downloaded package file for a pkg resource, as name=path (repeatable)")
+	bundleCreateCmd.MarkFlagRequired("module")
+}
+
+func runBundleCreate(cmd *cobra.Command, args []string) error {
+	packages := make(map[string]string, len(bundlePackages))
+	for _, entry := range bundlePackages {
+		name, path, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || path == "" {
+			return fmt.Errorf("invalid --package %q, expected name=path", entry)
+		}
+		packages[name] = path
+	}
+
+	manifest, err := bundle.Create(bundleModuleFile, bundleOutput, bundle.Options{
+		Packages:  packages,
+		Artifacts: artifact.NewCache(artifact.DefaultCacheDir),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to create bundle: %w", err)
+	}
+
+	fmt.Fprintf(console, "Created %s for module %s %s with %d file(s)\n",
+		bundleOutput, manifest.Module, manifest.Version, len(manifest.Files))
+	return nil
+}
+
+func runBundleInspect(cmd *cobra.Command, args []string) error {
+	dir, err := os.MkdirTemp("", "chisel-bundle-")
+	if err != nil {
+		return fmt.Errorf("failed to create bundle directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	module, manifest, err := bundle.Extract(args[0], dir)
+	if err != nil {
+		return fmt.Errorf("invalid bundle: %w", err)
+	}
+
+	fmt.Fprintf(console, "Module:    %s %s\n", manifest.Module, manifest.Version)
+	fmt.Fprintf(console, "Created:   %s\n", manifest.CreatedAt.Format("2006-01-02 15:04:05 MST"))
+	fmt.Fprintf(console, "Resources: %d\n", len(module.Spec.Resources))
+	fmt.Fprintf(console, "Files:\n")
+	for _, file := range manifest.Files {
+		fmt.Fprintf(console, "  %-50s %10d  sha256:%s\n", file.Path, file.Size, file.SHA256[:12])
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/webhook"
+)
+
+// selectCanaries splits hosts into those the canary selector of a strategy
+// matches and the rest
+func selectCanaries(strategy *core.Strategy, hosts []string, labels map[string]map[string]string) ([]string, []string, error) {
+	selector, err := inventory.ParseLabelSelector(strategy.Selector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("canary selector: %w", err)
+	}
+	var canaries, rest []string
+	for _, host := range hosts {
+		if selector.Matches(labels[host]) {
+			canaries = append(canaries, host)
+		} else {
+			rest = append(rest, host)
+		}
+	}
+	return canaries, rest, nil
+}
+
+// sessionLabels returns the labels of the planned hosts: those derived from
+// their facts with the ones the inventory declares on top, as module
+// selectors see them
+func sessionLabels(sessions map[string]*hostSession, declared map[string]map[string]string) map[string]map[string]string {
+	labels := make(map[string]map[string]string, len(sessions))
+	for host, session := range sessions {
+		labels[host] = inventory.MergeLabels(session.target.System.Labels(), declared[host])
+	}
+	return labels
+}
+
+// canaryRollout applies a module to its canary hosts before the rest
+type canaryRollout struct {
+	strategy *core.Strategy
+	hosts    []string
+	sessions map[string]*hostSession
+	webhooks *webhook.Dispatcher
+	module   *core.Module
+}
+
+// run applies to the canaries, waits out the window and runs the checks on
+// them. It returns an error when a canary failed, and the rest of the hosts
+// are not to be applied to.
+func (c *canaryRollout) run(ctx context.Context, runner *executor.HostRunner, applyHost executor.HostFunc) (*executor.RunReport, error) {
+	fmt.Fprintf(console, "Applying to %d canary host(s): %s\n", len(c.hosts), strings.Join(c.hosts, ", "))
+	c.phase(ctx, events.EventTypeCanaryStarted, map[string]interface{}{"hosts": c.hosts, "selector": c.strategy.Selector})
+
+	report := runner.Run(ctx, c.hosts, applyHost)
+	if failed := len(report.Failed()) + len(report.Unreachable()); failed > 0 {
+		return report, c.fail(ctx, fmt.Errorf("apply failed on %d of %d canary host(s)", failed, len(c.hosts)))
+	}
+
+	if window := c.strategy.Window; window > 0 {
+		fmt.Fprintf(console, "Waiting %s before checking the canaries...\n", window)
+		c.phase(ctx, events.EventTypeCanaryWaiting, map[string]interface{}{"hosts": c.hosts, "window": window.String()})
+		select {
+		case <-ctx.Done():
+			return report, c.fail(ctx, ctx.Err())
+		case <-time.After(window):
+		}
+	}
+
+	if len(c.strategy.Checks) > 0 {
+		fmt.Fprintf(console, "Checking %d canary host(s)...\n", len(c.hosts))
+		checked := runner.Run(ctx, c.hosts, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			return nil, runCanaryChecks(ctx, c.strategy.HealthChecks(), c.sessions[host].target.Registry)
+		})
+		failed := append(checked.Failed(), checked.Unreachable()...)
+		for _, result := range failed {
+			fmt.Fprintf(console, "  ✗ %s: %v\n", result.Host, result.Error)
+			// The canary applied, but is not healthy
+			applied, _ := report.Get(result.Host)
+			applied.Status = executor.HostFailed
+			applied.Error = result.Error
+			applied.Attempts = 0
+			report.Add(applied)
+		}
+		if len(failed) > 0 {
+			return report, c.fail(ctx, fmt.Errorf("checks failed on %d of %d canary host(s)", len(failed), len(c.hosts)))
+		}
+	}
+
+	fmt.Fprintln(console, "Canaries passed, promoting to the remaining hosts")
+	c.phase(ctx, events.EventTypeCanaryPromoted, map[string]interface{}{"hosts": c.hosts})
+	return report, nil
+}
+
+// fail announces that the canaries failed
+func (c *canaryRollout) fail(ctx context.Context, err error) error {
+	c.phase(ctx, events.EventTypeCanaryFailed, map[string]interface{}{"hosts": c.hosts, "error": err.Error()})
+	return fmt.Errorf("canary failed: %w", err)
+}
+
+// phase announces a phase of the rollout to the run observers, and to
+// webhooks subscribed to it
+func (c *canaryRollout) phase(ctx context.Context, eventType events.EventType, data map[string]interface{}) {
+	runObservers.Phase(eventType, data)
+	switch eventType {
+	case events.EventTypeCanaryStarted, events.EventTypeCanaryPromoted, events.EventTypeCanaryFailed:
+		sendWebhook(ctx, c.webhooks, string(eventType), c.module, data)
+	}
+}
+
+// runCanaryChecks waits for every check to hold on a host, in order
+func runCanaryChecks(ctx context.Context, checks []types.Resource, registry *types.ProviderRegistry) error {
+	provider, err := registry.Get("wait_for")
+	if err != nil {
+		return err
+	}
+	for i := range checks {
+		check, err := core.WithSecrets(checks[i])
+		if err != nil {
+			return fmt.Errorf("check %s: %w", check.Name, err)
+		}
+		if err := provider.Validate(&check); err != nil {
+			return fmt.Errorf("check %s: %w", check.Name, err)
+		}
+		// Apply checks the condition before it waits, so it returns at once
+		// on a host that is already healthy
+		diff := &types.ResourceDiff{ResourceID: check.ResourceID(), Action: types.ActionUpdate}
+		if err := provider.Apply(ctx, &check, diff); err != nil {
+			return fmt.Errorf("check %s: %w", check.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/debuglog"
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/redact"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/transport"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+var (
+	debugEnabled bool
+	debugFile    string
+
+	// debugLogger is set when --debug is given; a nil logger logs nothing
+	debugLogger *debuglog.Logger
+
+	// outputRedactor redacts the secrets looked up in this run from values
+	// forge prints, such as those explain shows
+	outputRedactor = redact.New()
+)
+
+func init() {
+	rootCmd.PersistentFlags().BoolVar(&debugEnabled, "debug", false, "log every provider decision and command run, with sensitive values redacted")
+	rootCmd.PersistentFlags().StringVar(&debugFile, "debug-file", "", "write the debug log to this file instead of stderr")
+
+	viper.BindPFlag("debug.enabled", rootCmd.PersistentFlags().Lookup("debug"))
+	viper.BindPFlag("debug.file", rootCmd.PersistentFlags().Lookup("debug-file"))
+}
+
+// setupDebugLog creates the debug logger when debugging is enabled. The log
+// goes to stderr, or to the debug file so it stays apart from normal output.
+func setupDebugLog(cmd *cobra.Command, args []string) error {
+	if !viper.GetBool("debug.enabled") && viper.GetString("debug.file") == "" {
+		return nil
+	}
+
+	var out io.Writer = os.Stderr
+	if path := viper.GetString("debug.file"); path != "" {
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return fmt.Errorf("failed to open debug log: %w", err)
+		}
+		out = file
+	}
+
+	debugLogger = debuglog.New(out, redact.New())
+	debugLogger.Printf("cli", "%s %s", cmd.CommandPath(), strings.Join(args, " "))
+	return nil
+}
+
+// preRun runs the checks and setup shared by every command
+func preRun(cmd *cobra.Command, args []string) error {
+	if err := checkRequiredVersion(cmd, args); err != nil {
+		return err
+	}
+	return setupDebugLog(cmd, args)
+}
+
+// addDebugSecret registers a configured secret so neither the debug log nor
+// the values forge prints show it
+func addDebugSecret(secret string) {
+	outputRedactor.AddSecret(secret)
+	if debugLogger != nil {
+		debugLogger.Redactor().AddSecret(secret)
+	}
+}
+
+// newLocalRegistry builds the provider registry for runs without an
+// inventory, logging its commands and decisions when debugging. There is no
+// host to detect a package manager or init system on, so packages and
+// services are planned for the default ones.
+func newLocalRegistry(executor ssh.Executor) (*types.ProviderRegistry, error) {
+	executor = transport.NewDebugTransport(executor, debugLogger)
+	registry, err := providerFactories().NewRegistry(executor)
+	if err != nil {
+		return nil, err
+	}
+	if err := providers.UsePackageManager(registry, providers.DefaultPackageManager); err != nil {
+		return nil, err
+	}
+	if err := providers.UseInitSystem(registry, providers.DefaultInitSystem); err != nil {
+		return nil, err
+	}
+	return debuglog.WrapRegistry(registry, debugLogger)
+}
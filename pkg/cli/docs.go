@@ -0,0 +1,154 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/docsite"
+)
+
+var (
+	docsProject string
+	docsOutput  string
+	docsTitle   string
+)
+
+// docsCmd represents the docs command
+var docsCmd = &cobra.Command{
+	Use:   "docs",
+	Short: "Generate project documentation",
+}
+
+var docsBuildCmd = &cobra.Command{
+	Use:   "build",
+	Short: "Render the project's modules as a static HTML site",
+	Long: `Render every module of the project as a static HTML site for an internal
+wiki: an index of the modules and a page per module with its owners,
+labels, variables, resources, handlers, compliance mappings and dependency
+graph. Each dependency graph is also written as a Graphviz .dot file.
+
+Modules are the YAML files of kind Module under the project's module_path,
+found from chisel.yaml in the working directory or its parents, or the
+file given with --project. Owners and compliance mappings are declared in
+module metadata:
+
+  metadata:
+    name: web
+    owners: [platform-team]
+    compliance:
+      cis-ubuntu-20.04: ["5.2.1", "6.1.2"]
+
+Frameworks forge has built-in checks for also show the check results.
+
+Examples:
+  forge docs build
+  forge docs build --project infra/chisel.yaml --output public/forge`,
+	RunE: runDocsBuild,
+}
+
+func init() {
+	rootCmd.AddCommand(docsCmd)
+	docsCmd.AddCommand(docsBuildCmd)
+
+	docsBuildCmd.Flags().StringVar(&docsProject, "project", "", "Path to the project file (default: chisel.yaml in the working directory or its parents)")
+	docsBuildCmd.Flags().StringVarP(&docsOutput, "output", "o", "site", "Directory to write the site to")
+	docsBuildCmd.Flags().StringVar(&docsTitle, "title", "", "Title of the site (default: the project name)")
+}
+
+func runDocsBuild(cmd *cobra.Command, args []string) error {
+	path := docsProject
+	if path == "" {
+		found, ok := findProjectFile()
+		if !ok {
+			return fmt.Errorf("no %s found in the working directory or its parents, pass --project", projectFile)
+		}
+		path = found
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var project ProjectConfig
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+
+	modulePath := project.Spec.ModulePath
+	if modulePath == "" {
+		modulePath = "./modules"
+	}
+	if !filepath.IsAbs(modulePath) {
+		modulePath = filepath.Join(filepath.Dir(path), modulePath)
+	}
+	sources, err := projectModules(modulePath)
+	if err != nil {
+		return err
+	}
+	if len(sources) == 0 {
+		return fmt.Errorf("no modules found in %s", modulePath)
+	}
+
+	title := docsTitle
+	if title == "" {
+		title = project.Metadata.Name
+	}
+	if title == "" {
+		title = "Modules"
+	}
+	site, err := docsite.Build(context.Background(), title, sources)
+	if err != nil {
+		return err
+	}
+	if err := site.Write(docsOutput); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Documented %d module(s) in %s\n", len(site.Modules), filepath.Join(docsOutput, "index.html"))
+	return nil
+}
+
+// projectModules loads the module files under a directory. YAML files of
+// other kinds, such as variable files, are left out.
+func projectModules(dir string) ([]docsite.Source, error) {
+	var sources []docsite.Source
+	err := filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		ext := strings.ToLower(filepath.Ext(path))
+		if entry.IsDir() || (ext != ".yaml" && ext != ".yml") {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		var header struct {
+			Kind string `yaml:"kind"`
+		}
+		if yaml.Unmarshal(data, &header) != nil || header.Kind != "Module" {
+			return nil
+		}
+		// Encrypted values stay encrypted, so they are not published
+		module, err := core.LoadModuleFromFileEncrypted(path)
+		if err != nil {
+			return fmt.Errorf("failed to load module: %w", err)
+		}
+		relative, err := filepath.Rel(dir, path)
+		if err != nil {
+			relative = path
+		}
+		sources = append(sources, docsite.Source{File: relative, Module: module})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to find modules in %s: %w", dir, err)
+	}
+	return sources, nil
+}
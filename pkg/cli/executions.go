@@ -0,0 +1,169 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/history"
+)
+
+var (
+	timelineFormat string
+	timelineOutput string
+)
+
+// executionsCmd represents the executions command
+var executionsCmd = &cobra.Command{
+	Use:   "executions",
+	Short: "Inspect recorded executions",
+	Long: `Every apply records when each host and resource started and finished.
+Use these commands to find where an apply spent its time, such as a slow
+batch or resources that ran one after another.`,
+}
+
+var executionsListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List recorded executions",
+	Args:  cobra.NoArgs,
+	RunE:  runExecutionsList,
+}
+
+var executionsTimelineCmd = &cobra.Command{
+	Use:   "timeline <id>",
+	Short: "Render the timeline of an execution",
+	Long: `Render a Gantt-style timeline of an execution, with a row per host
+and concurrent resource changes on separate rows.
+
+The id may be a full execution ID, a unique prefix of one, or "latest".
+The html format is a self-contained page; the json format is the Chrome
+trace event format, which Perfetto (ui.perfetto.dev) and speedscope open
+as a flame chart.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExecutionsTimeline,
+}
+
+var executionsSnapshotsCmd = &cobra.Command{
+	Use:   "snapshots <id>",
+	Short: "List the VM snapshots taken during an execution",
+	Long: `List the snapshots taken of hosts before risky changes were applied,
+with how to roll each host back. The id may be a full execution ID, a unique
+prefix of one, or "latest".`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExecutionsSnapshots,
+}
+
+func init() {
+	rootCmd.AddCommand(executionsCmd)
+	executionsCmd.AddCommand(executionsListCmd, executionsTimelineCmd, executionsSnapshotsCmd)
+
+	rootCmd.PersistentFlags().String("executions-dir", history.DefaultDir, "directory of executions recorded as files by earlier versions, imported into the store")
+	viper.BindPFlag("executions.dir", rootCmd.PersistentFlags().Lookup("executions-dir"))
+
+	executionsTimelineCmd.Flags().StringVar(&timelineFormat, "format", history.FormatHTML, "Timeline format (html, json)")
+	executionsTimelineCmd.Flags().StringVarP(&timelineOutput, "output", "o", "", "Write the timeline to a file instead of stdout")
+}
+
+// executionStore returns the store of recorded executions
+func executionStore() (*history.Store, error) {
+	kv, err := controllerStore()
+	if err != nil {
+		return nil, err
+	}
+	return history.NewStore(kv), nil
+}
+
+// saveExecution records an execution, warning if it cannot be written
+func saveExecution(execution *history.Execution, status string) {
+	execution.Finish(status)
+	executions, err := executionStore()
+	if err == nil {
+		err = executions.Save(execution)
+	}
+	if err != nil {
+		fmt.Fprintf(warnings(), "Warning: failed to record execution: %v\n", err)
+		return
+	}
+	fmt.Fprintf(console, "Execution: %s\n", execution.ID)
+}
+
+// loadExecution reads a recorded execution by ID, ID prefix or "latest"
+func loadExecution(id string) (*history.Execution, error) {
+	executions, err := executionStore()
+	if err != nil {
+		return nil, err
+	}
+	return executions.Load(id)
+}
+
+func runExecutionsList(cmd *cobra.Command, args []string) error {
+	executions, err := executionStore()
+	if err != nil {
+		return err
+	}
+	list, err := executions.List()
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		fmt.Fprintln(console, "No executions recorded.")
+		return nil
+	}
+
+	for _, execution := range list {
+		fmt.Fprintf(console, "%s  %-20s %-10s %3d host(s)  %v\n",
+			execution.ID,
+			execution.Module,
+			execution.Status,
+			len(execution.Hosts()),
+			execution.EndTime.Sub(execution.StartTime).Round(time.Millisecond))
+	}
+	return nil
+}
+
+func runExecutionsTimeline(cmd *cobra.Command, args []string) error {
+	execution, err := loadExecution(args[0])
+	if err != nil {
+		return err
+	}
+
+	var w io.Writer = console
+	if timelineOutput != "" {
+		file, err := os.Create(timelineOutput)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", timelineOutput, err)
+		}
+		defer file.Close()
+		w = file
+	}
+
+	if err := history.WriteTimeline(w, execution, timelineFormat); err != nil {
+		return fmt.Errorf("failed to render timeline: %w", err)
+	}
+	if timelineOutput != "" {
+		fmt.Fprintf(console, "Wrote timeline of execution %s to %s\n", execution.ID, timelineOutput)
+	}
+	return nil
+}
+
+func runExecutionsSnapshots(cmd *cobra.Command, args []string) error {
+	execution, err := loadExecution(args[0])
+	if err != nil {
+		return err
+	}
+	if len(execution.Snapshots) == 0 {
+		fmt.Fprintf(console, "No snapshots were taken during execution %s.\n", execution.ID)
+		return nil
+	}
+
+	for _, taken := range execution.Snapshots {
+		fmt.Fprintf(console, "%s  %s %s of %s  %s\n", taken.Host, taken.Provider, taken.ID, taken.VM, taken.CreatedAt.Format(time.RFC3339))
+		if taken.Restore != "" {
+			fmt.Fprintf(console, "  restore: %s\n", taken.Restore)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/planfile"
+	"github.com/ataiva-software/forge/pkg/policy"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+var (
+	explainPlanFile string
+	explainHost     string
+)
+
+// explainCmd represents the explain command
+var explainCmd = &cobra.Command{
+	Use:   "explain <resource>",
+	Short: "Explain why a saved plan changes a resource",
+	Long: `Explain the decision a saved plan made for one resource: the action on each
+host, the properties that differ with their current and desired values,
+the policies the resource was checked against and the compliance controls
+its module implements, and the template and variables its content is
+rendered from.
+
+The module is loaded again with the variables the plan was made with.
+Values that look sensitive, and secrets the module looks up, are shown as
+[REDACTED].
+
+Examples:
+  forge plan -m web.yaml -i inventory.yaml --out web.plan
+  forge explain file.nginx-conf --plan web.plan
+  forge explain file.nginx-conf --plan web.plan --host web1`,
+	Args: cobra.ExactArgs(1),
+	RunE: runExplain,
+}
+
+func init() {
+	rootCmd.AddCommand(explainCmd)
+
+	explainCmd.Flags().StringVar(&explainPlanFile, "plan", "", "The plan file saved with forge plan --out (required)")
+	explainCmd.Flags().StringVar(&explainHost, "host", "", "Only explain the plan of this host")
+	explainCmd.MarkFlagRequired("plan")
+}
+
+func runExplain(cmd *cobra.Command, args []string) error {
+	id := args[0]
+	file, err := planfile.Load(explainPlanFile, atRestSealer())
+	if err != nil {
+		return err
+	}
+
+	// Loading the module decrypts its values, so they are redacted below
+	location, err := locateModule(context.Background(), file.ModuleFile)
+	if err != nil {
+		return err
+	}
+	module, err := core.LoadModuleFromFile(location.File)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	vars, err := core.DecryptVars(file.Vars)
+	if err != nil {
+		return err
+	}
+	if err := module.ResolveVars(vars); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	var resource *types.Resource
+	for i := range module.Spec.Resources {
+		if module.Spec.Resources[i].ResourceID() == id {
+			resource = &module.Spec.Resources[i]
+			break
+		}
+	}
+
+	changes := file.ResourceChanges(id)
+	if explainHost != "" {
+		change, ok := changes[explainHost]
+		if !ok {
+			return fmt.Errorf("%s was not planned for host %s", id, explainHost)
+		}
+		changes = map[string]planfile.Change{explainHost: change}
+	}
+	if resource == nil && len(changes) == 0 {
+		return fmt.Errorf("%s is not in the plan or in module %s", id, file.ModuleFile)
+	}
+
+	fmt.Fprintf(console, "%s in the plan saved at %s from %s\n", id, file.CreatedAt.Local().Format("2006-01-02 15:04:05 MST"), file.ModuleFile)
+	if len(file.Vars) > 0 {
+		fmt.Fprintf(console, "Planned with variables: %s\n", strings.Join(sortedKeys(file.Vars), ", "))
+	}
+	fmt.Fprintln(console)
+
+	explainChanges(id, changes)
+	if resource == nil {
+		fmt.Fprintf(console, "%s is no longer in the module; plan again\n", id)
+		return nil
+	}
+	explainTemplate(resource)
+	return explainPolicies(context.Background(), module, resource)
+}
+
+// explainChanges prints the action planned on each host and the properties
+// that differ, current and desired
+func explainChanges(id string, changes map[string]planfile.Change) {
+	fmt.Fprintln(console, "Decision:")
+	if len(changes) == 0 {
+		fmt.Fprintf(console, "  %s was not planned on any host, it was left out or its when condition was false\n\n", id)
+		return
+	}
+	for _, host := range sortedKeys(changes) {
+		change := changes[host]
+		fmt.Fprintf(console, "  %s: %s\n", host, change.Action)
+		if change.Diff == nil {
+			continue
+		}
+		if change.Diff.Reason != "" {
+			fmt.Fprintf(console, "    reason: %s\n", outputRedactor.Redact(change.Diff.Reason))
+		}
+		for _, key := range change.Diff.ChangedKeys() {
+			fmt.Fprintf(console, "    %s\n", explainValue(key, change.Diff.Changes[key]))
+		}
+	}
+	fmt.Fprintln(console)
+}
+
+// explainValue renders a property for explain output, current and desired
+// when it changes, with secrets and sensitive-looking values redacted
+func explainValue(key string, value interface{}) string {
+	if transition, ok := value.(map[string]interface{}); ok {
+		from, hasFrom := transition["from"]
+		to, hasTo := transition["to"]
+		if hasFrom && hasTo && len(transition) == 2 {
+			return fmt.Sprintf("%s:\n      current: %s\n      desired: %s", key, redactValue(key, from), redactValue(key, to))
+		}
+	}
+	return fmt.Sprintf("%s: %s", key, redactValue(key, value))
+}
+
+// redactValue formats the value of a property with its secrets redacted.
+// The key is redacted along with it, so values of keys such as password
+// are redacted whatever they look like.
+func redactValue(key string, value interface{}) string {
+	prefix := key + ": "
+	return strings.TrimPrefix(outputRedactor.Redact(prefix+fmt.Sprint(value)), prefix)
+}
+
+// explainTemplate prints the template a resource's content is rendered
+// from and the variables it is rendered with
+func explainTemplate(resource *types.Resource) {
+	template, hasTemplate := resource.Properties["template"].(string)
+	templateFile, hasTemplateFile := resource.Properties["template_file"].(string)
+	if !hasTemplate && !hasTemplateFile {
+		return
+	}
+
+	fmt.Fprintln(console, "Template inputs:")
+	if hasTemplate {
+		fmt.Fprintf(console, "  template: inline, %d line(s)\n", strings.Count(strings.TrimRight(template, "\n"), "\n")+1)
+	}
+	if hasTemplateFile {
+		fmt.Fprintf(console, "  template_file: %s\n", templateFile)
+	}
+	if dir, ok := resource.Properties["template_dir"].(string); ok {
+		fmt.Fprintf(console, "  template_dir: %s\n", dir)
+	}
+	vars, _ := resource.Properties["vars"].(map[string]interface{})
+	for _, key := range sortedKeys(vars) {
+		fmt.Fprintf(console, "  vars.%s\n", explainValue(key, vars[key]))
+	}
+	if _, ok := vars["facts"]; !ok {
+		fmt.Fprintln(console, "  facts: gathered from each host when it is planned")
+	}
+	fmt.Fprintln(console)
+}
+
+// explainPolicies prints the policies a resource is checked against, with
+// any rule it violates, and the compliance controls of its module
+func explainPolicies(ctx context.Context, module *core.Module, resource *types.Resource) error {
+	fmt.Fprintln(console, "Policies:")
+	paths := viper.GetStringSlice("policy.paths")
+	if len(paths) == 0 {
+		fmt.Fprintln(console, "  none configured (policy.paths)")
+	} else {
+		engine := policy.NewPolicyEngine()
+		if err := engine.LoadFromConfig(&policy.PolicyConfig{Enabled: true, PolicyPaths: paths}); err != nil {
+			return err
+		}
+		result, err := engine.EvaluateResource(ctx, resource)
+		if err != nil {
+			return err
+		}
+		violated := make(map[string][]policy.PolicyViolation)
+		for _, violation := range result.Violations {
+			violated[violation.Policy] = append(violated[violation.Policy], violation)
+		}
+		for _, name := range engine.GetLoadedPolicies() {
+			if len(violated[name]) == 0 {
+				fmt.Fprintf(console, "  ✓ %s\n", name)
+				continue
+			}
+			for _, violation := range violated[name] {
+				fmt.Fprintf(console, "  ✗ %s: %s: %s\n", name, violation.Rule, violation.Message)
+			}
+		}
+	}
+	if deny := viper.GetStringSlice("policy.deny_commands"); len(deny) > 0 {
+		fmt.Fprintf(console, "  commands checked against %d deny pattern(s) (policy.deny_commands) when applied\n", len(deny))
+	}
+
+	if len(module.Metadata.Compliance) > 0 {
+		fmt.Fprintln(console, "\nCompliance controls of the module:")
+		for _, framework := range sortedKeys(module.Metadata.Compliance) {
+			fmt.Fprintf(console, "  %s: %s\n", framework, strings.Join(module.Metadata.Compliance[framework], ", "))
+		}
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
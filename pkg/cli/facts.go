@@ -0,0 +1,124 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+var (
+	factsInventoryFile string
+	factsLocal         bool
+	factsHost          string
+	factsRefresh       bool
+)
+
+// factsCmd represents the facts command
+var factsCmd = &cobra.Command{
+	Use:   "facts",
+	Short: "Show the facts gathered about hosts",
+	Long: `Connect to hosts and print the facts plan and apply gather about them: OS
+family, distribution and version, kernel, architecture, hostname, CPUs,
+memory, IP addresses, virtualization, cloud provider and datacenter. These
+are the values file templates see as .facts and when conditions are
+evaluated against, and they give hosts the labels module selectors match.
+
+Facts are cached for facts.cache_ttl (10 minutes by default); --refresh
+gathers them again.
+
+Examples:
+  forge facts --local
+  forge facts -i inventory.yaml --host web1 --refresh`,
+	Args: cobra.NoArgs,
+	RunE: runFacts,
+}
+
+func init() {
+	rootCmd.AddCommand(factsCmd)
+
+	factsCmd.Flags().StringVarP(&factsInventoryFile, "inventory", "i", "", "Path to inventory file")
+	factsCmd.Flags().BoolVar(&factsLocal, "local", false, "Show the facts of the machine forge runs on, without SSH")
+	factsCmd.Flags().StringVar(&factsHost, "host", "", "Only show this inventory host")
+	factsCmd.Flags().BoolVar(&factsRefresh, "refresh", false, "Gather the facts again instead of using cached ones")
+
+	factsCmd.MarkFlagsMutuallyExclusive("inventory", "local")
+	factsCmd.MarkFlagsMutuallyExclusive("host", "local")
+}
+
+func runFacts(cmd *cobra.Command, args []string) error {
+	if factsInventoryFile == "" && !factsLocal {
+		return fmt.Errorf("pick the hosts to show: --inventory or --local")
+	}
+
+	inv := inventory.Local()
+	if factsInventoryFile != "" {
+		var err error
+		if inv, err = loadInventory(factsInventoryFile); err != nil {
+			return fmt.Errorf("failed to load inventory: %w", err)
+		}
+	}
+	hosts, conflicts, err := inv.Resolve()
+	displayConflicts(conflicts)
+	if err != nil {
+		return err
+	}
+	connections := make(map[string]ssh.ConnectionConfig)
+	for _, host := range hosts {
+		if factsHost == "" || host.Name == factsHost {
+			connections[host.Name] = withHostKeySettings(host.Connection)
+		}
+	}
+	if len(connections) == 0 {
+		return fmt.Errorf("host %s not found in the inventory", factsHost)
+	}
+
+	ctx := context.Background()
+	if err := resolveBecomePasswords(ctx, connections); err != nil {
+		return err
+	}
+	connPool, err := connectionPool()
+	if err != nil {
+		return err
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		ssh.SetPassphrasePrompt(promptPassphrase)
+	}
+	cache := factsCache()
+	pool := providers.NewTargetPool(providerFactories(), providers.PooledDialer(connPool))
+	pool.SetDebugLogger(debugLogger)
+	pool.SetOsquery(false)
+	pool.SetFactsCache(cache)
+	defer pool.CloseAll()
+
+	gathered := make(map[string]*facts.Facts, len(connections))
+	for name, config := range connections {
+		if factsRefresh {
+			if err := cache.Forget(config.Host); err != nil {
+				return err
+			}
+		}
+		target, err := pool.Get(ctx, config)
+		if err != nil {
+			return fmt.Errorf("failed to connect to %s: %w", name, err)
+		}
+		if target.System == nil {
+			return fmt.Errorf("failed to gather facts of %s", name)
+		}
+		gathered[name] = target.System
+	}
+
+	data, err := yaml.Marshal(gathered)
+	if err != nil {
+		return fmt.Errorf("failed to marshal facts: %w", err)
+	}
+	fmt.Fprint(console, string(data))
+	return nil
+}
@@ -0,0 +1,136 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/ataiva-software/forge/pkg/history"
+)
+
+// historyTimeFormat is how times are shown in history reports
+const historyTimeFormat = "2006-01-02 15:04:05"
+
+var (
+	historySince  string
+	historyUntil  string
+	historyModule string
+	historyHost   string
+)
+
+// historyCmd represents the history command
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Report what runs changed on hosts",
+}
+
+var historyDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show what actually changed on hosts in a time window",
+	Long: `List every resource that applies changed in a time window, with the old
+and new values of its properties and who triggered the run, grouped by
+execution. Plans, dry runs and failed changes are left out, so the report
+can be used for audits and incident timelines.
+
+--since and --until take a duration back from now (7d, 12h, 30m), a date
+(2024-05-01) or an RFC 3339 time. Sensitive values are redacted.
+
+Examples:
+  forge history diff --since 7d --module web
+  forge history diff --since 2024-05-01 --until 2024-05-02 --host web1`,
+	Args: cobra.NoArgs,
+	RunE: runHistoryDiff,
+}
+
+func init() {
+	rootCmd.AddCommand(historyCmd)
+	historyCmd.AddCommand(historyDiffCmd)
+
+	historyDiffCmd.Flags().StringVar(&historySince, "since", "7d", "Start of the time window")
+	historyDiffCmd.Flags().StringVar(&historyUntil, "until", "", "End of the time window (default now)")
+	historyDiffCmd.Flags().StringVar(&historyModule, "module", "", "Only show changes made by this module")
+	historyDiffCmd.Flags().StringVar(&historyHost, "host", "", "Only show changes made to this host")
+}
+
+func runHistoryDiff(cmd *cobra.Command, args []string) error {
+	now := time.Now()
+	filter := history.ChangeFilter{Module: historyModule, Host: historyHost}
+	var err error
+	if filter.Since, err = history.ParseSince(historySince, now); err != nil {
+		return fmt.Errorf("invalid --since: %w", err)
+	}
+	if historyUntil != "" {
+		if filter.Until, err = history.ParseSince(historyUntil, now); err != nil {
+			return fmt.Errorf("invalid --until: %w", err)
+		}
+	}
+
+	store, err := executionStore()
+	if err != nil {
+		return err
+	}
+	executions, err := store.List()
+	if err != nil {
+		return err
+	}
+	changes := history.Diff(executions, filter)
+	if len(changes) == 0 {
+		fmt.Fprintf(console, "No changes since %s.\n", filter.Since.Local().Format(historyTimeFormat))
+		return nil
+	}
+
+	hosts := make(map[string]bool)
+	for i, change := range changes {
+		hosts[change.Host] = true
+		if i == 0 || change.Execution != changes[i-1].Execution {
+			by := ""
+			if change.TriggeredBy != "" {
+				by = " by " + change.TriggeredBy
+			}
+			fmt.Fprintf(console, "\n%s  %s  %s%s\n", change.Time.Local().Format(historyTimeFormat), change.Module, change.Execution, by)
+		}
+		fmt.Fprintf(console, "  %s  %s %s\n", change.Host, historySymbol(change.Action), change.Resource)
+		keys := make([]string, 0, len(change.Values))
+		for key := range change.Values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(console, "      %s: %s\n", key, change.Values[key])
+		}
+	}
+	fmt.Fprintf(console, "\n%d change(s) on %d host(s) since %s\n", len(changes), len(hosts), filter.Since.Local().Format(historyTimeFormat))
+	return nil
+}
+
+// historySymbol marks a recorded action like plan output does
+func historySymbol(action string) string {
+	switch action {
+	case "create":
+		return "+"
+	case "update":
+		return "~"
+	case "delete":
+		return "-"
+	case "handler":
+		return "↻"
+	default:
+		return "?"
+	}
+}
+
+// triggeredBy names who started a run, as user@host
+func triggeredBy() string {
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if hostname, err := os.Hostname(); err == nil {
+		name += "@" + strings.SplitN(hostname, ".", 2)[0]
+	}
+	return name
+}
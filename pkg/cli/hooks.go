@@ -0,0 +1,96 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/hooks"
+	"github.com/ataiva-software/forge/pkg/report"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// loadHooks returns the runner for the hooks in the config file, or nil if
+// none are configured
+func loadHooks() (*hooks.Runner, error) {
+	var config hooks.Config
+	if err := viper.UnmarshalKey("hooks", &config); err != nil {
+		return nil, fmt.Errorf("invalid hooks configuration: %w", err)
+	}
+	if len(config.PrePlan)+len(config.PostApply)+len(config.OnFailure) == 0 {
+		return nil, nil
+	}
+	for _, hook := range append(append(config.PrePlan, config.PostApply...), config.OnFailure...) {
+		addDebugSecret(hook.Secret)
+	}
+	runner, err := hooks.NewRunner(config, console)
+	if err != nil {
+		return nil, fmt.Errorf("invalid hooks configuration: %w", err)
+	}
+	return runner, nil
+}
+
+// runHooks follows a run for its project hooks. It runs the pre_plan hooks
+// when started, and after the run the post_apply hooks if changes were
+// applied or the on_failure hooks if it failed.
+type runHooks struct {
+	runner *hooks.Runner
+	run    hooks.Run
+
+	applying bool
+	status   string
+}
+
+// startHooks runs the pre_plan hooks of a run and follows it from then on.
+// A failing pre_plan hook fails the run.
+func startHooks(ctx context.Context, runner *hooks.Runner, module *core.Module, run hooks.Run) (*runHooks, error) {
+	run.Module, run.ModuleVersion = module.Metadata.Name, module.Metadata.Version
+	run.TriggeredBy = triggeredBy()
+	h := &runHooks{runner: runner, run: run}
+	if err := runner.Run(ctx, hooks.PrePlan, run); err != nil {
+		h.finish(ctx, err)
+		return nil, err
+	}
+	runObservers = append(runObservers, h)
+	return h, nil
+}
+
+// finish runs the post_apply or on_failure hooks for a run that ended with
+// err. Their failures are reported but do not change the run's outcome.
+func (h *runHooks) finish(ctx context.Context, err error) {
+	unfollow(h)
+
+	run := h.run
+	var event hooks.Event
+	switch {
+	case err != nil:
+		event, run.Status, run.Error = hooks.OnFailure, report.StatusFailed, err.Error()
+	case h.status == report.StatusFailed:
+		event, run.Status = hooks.OnFailure, h.status
+	case h.applying && !run.DryRun:
+		event, run.Status = hooks.PostApply, h.status
+		if run.Status == "" {
+			run.Status = report.StatusSucceeded
+		}
+	default:
+		return
+	}
+	if hookErr := h.runner.Run(ctx, event, run); hookErr != nil {
+		fmt.Fprintf(warnings(), "Warning: %v\n", hookErr)
+	}
+}
+
+func (h *runHooks) Planned(host string, plan *core.Plan, err error) {}
+
+func (h *runHooks) Applying(hosts []string) {
+	h.applying = true
+}
+
+func (h *runHooks) Applied(host string, result *core.ExecutionResult, err error) {}
+
+func (h *runHooks) Output(host string, line types.OutputLine) {}
+
+func (h *runHooks) SetStatus(status string) {
+	h.status = status
+}
@@ -0,0 +1,226 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	cryptossh "golang.org/x/crypto/ssh"
+	"golang.org/x/term"
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+var (
+	hostkeysFingerprint string
+	hostkeysTimeout     time.Duration
+)
+
+// hostkeysCmd represents the hostkeys command
+var hostkeysCmd = &cobra.Command{
+	Use:   "hostkeys",
+	Short: "Manage trusted SSH host keys",
+	Long: `Manage the SSH host keys forge trusts, kept in an OpenSSH known_hosts
+file (~/.ssh/known_hosts unless --known-hosts or ssh.known_hosts is set).
+
+Hosts are given as host or host:port. With the default accept-new policy a
+host's key is trusted the first time forge connects to it; with the strict
+policy keys must be trusted beforehand with 'forge hostkeys trust'.`,
+}
+
+var hostkeysListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List trusted host keys",
+	Args:  cobra.NoArgs,
+	RunE:  runHostkeysList,
+}
+
+var hostkeysScanCmd = &cobra.Command{
+	Use:   "scan <host>...",
+	Short: "Show the fingerprints of the keys hosts present",
+	Args:  cobra.MinimumNArgs(1),
+	RunE:  runHostkeysScan,
+}
+
+var hostkeysTrustCmd = &cobra.Command{
+	Use:   "trust <host>",
+	Short: "Trust the key a host presents",
+	Long: `Fetch the key a host presents and add it to the known hosts file.
+
+Pass the fingerprint obtained out of band (for example with
+'ssh-keygen -lf /etc/ssh/ssh_host_ed25519_key.pub' on the host) with
+--fingerprint, and the key is only trusted if it matches. Without it the
+fingerprint is shown for confirmation on a terminal.`,
+	Args: cobra.ExactArgs(1),
+	RunE: runHostkeysTrust,
+}
+
+var hostkeysRemoveCmd = &cobra.Command{
+	Use:   "remove <host>",
+	Short: "Forget the trusted keys of a host",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runHostkeysRemove,
+}
+
+func init() {
+	rootCmd.AddCommand(hostkeysCmd)
+	hostkeysCmd.AddCommand(hostkeysListCmd, hostkeysScanCmd, hostkeysTrustCmd, hostkeysRemoveCmd)
+
+	rootCmd.PersistentFlags().String("known-hosts", "", "known_hosts file of trusted SSH host keys (default is ~/.ssh/known_hosts)")
+	viper.BindPFlag("ssh.known_hosts", rootCmd.PersistentFlags().Lookup("known-hosts"))
+
+	hostkeysCmd.PersistentFlags().DurationVar(&hostkeysTimeout, "timeout", 10*time.Second, "Timeout for connecting to hosts")
+	hostkeysTrustCmd.Flags().StringVar(&hostkeysFingerprint, "fingerprint", "", "Expected SHA256 fingerprint of the host key")
+}
+
+// knownHosts returns the configured store of trusted host keys
+func knownHosts() *ssh.KnownHosts {
+	return ssh.OpenKnownHosts(viper.GetString("ssh.known_hosts"))
+}
+
+// withHostKeySettings applies the configured known hosts file and host key
+// policy to a connection that does not set its own
+func withHostKeySettings(config ssh.ConnectionConfig) ssh.ConnectionConfig {
+	if config.KnownHostsFile == "" {
+		config.KnownHostsFile = viper.GetString("ssh.known_hosts")
+	}
+	if config.HostKeyPolicy == "" && !config.StrictHostCheck {
+		config.HostKeyPolicy = viper.GetString("ssh.host_key_policy")
+	}
+	return config
+}
+
+// hostAddress adds the default SSH port to a host without one
+func hostAddress(host string) string {
+	if _, _, err := net.SplitHostPort(host); err == nil {
+		return host
+	}
+	return net.JoinHostPort(host, "22")
+}
+
+func runHostkeysList(cmd *cobra.Command, args []string) error {
+	store := knownHosts()
+	hosts, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(console, "No host keys trusted in %s.\n", store.Path())
+		return nil
+	}
+
+	for _, host := range hosts {
+		fmt.Fprintf(console, "%-40s %-22s %s\n", strings.Join(host.Hosts, ","), host.Key.Type(), cryptossh.FingerprintSHA256(host.Key))
+	}
+	return nil
+}
+
+func runHostkeysScan(cmd *cobra.Command, args []string) error {
+	store := knownHosts()
+	failed := 0
+	for _, host := range args {
+		address := hostAddress(host)
+		key, err := ssh.ScanHostKey(context.Background(), address, hostkeysTimeout)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %v\n", host, err)
+			failed++
+			continue
+		}
+		fmt.Fprintf(console, "%-40s %-22s %s  %s\n", address, key.Type(), cryptossh.FingerprintSHA256(key), trustStatus(store, address, key))
+	}
+	if failed > 0 {
+		return fmt.Errorf("failed to scan %d of %d host(s)", failed, len(args))
+	}
+	return nil
+}
+
+// trustStatus describes how a scanned key relates to the trusted and
+// revoked keys
+func trustStatus(store *ssh.KnownHosts, address string, key cryptossh.PublicKey) string {
+	revoked, err := store.Revoked(address)
+	if err != nil {
+		return "unknown"
+	}
+	for _, known := range revoked {
+		if cryptossh.FingerprintSHA256(known) == cryptossh.FingerprintSHA256(key) {
+			return "REVOKED"
+		}
+	}
+	trusted, err := store.Lookup(address)
+	if err != nil {
+		return "unknown"
+	}
+	status := "untrusted"
+	for _, known := range trusted {
+		if known.Type() != key.Type() {
+			continue
+		}
+		if cryptossh.FingerprintSHA256(known) == cryptossh.FingerprintSHA256(key) {
+			return "trusted"
+		}
+		status = "CHANGED"
+	}
+	return status
+}
+
+func runHostkeysTrust(cmd *cobra.Command, args []string) error {
+	store := knownHosts()
+	address := hostAddress(args[0])
+	key, err := ssh.ScanHostKey(context.Background(), address, hostkeysTimeout)
+	if err != nil {
+		return err
+	}
+	fingerprint := cryptossh.FingerprintSHA256(key)
+
+	switch trustStatus(store, address, key) {
+	case "trusted":
+		fmt.Fprintf(console, "Host key %s for %s is already trusted.\n", fingerprint, address)
+		return nil
+	case "CHANGED":
+		return fmt.Errorf("%s already has a different trusted %s key; remove it first with 'forge hostkeys remove %s'", address, key.Type(), args[0])
+	case "REVOKED":
+		return fmt.Errorf("host key %s of %s is revoked in %s and cannot be trusted", fingerprint, address, store.Path())
+	}
+
+	if hostkeysFingerprint != "" {
+		if hostkeysFingerprint != fingerprint {
+			return fmt.Errorf("host key fingerprint of %s is %s, not %s", address, fingerprint, hostkeysFingerprint)
+		}
+	} else {
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return fmt.Errorf("host key of %s is %s %s; pass --fingerprint to trust it non-interactively", address, key.Type(), fingerprint)
+		}
+		fmt.Fprintf(console, "The %s host key of %s has fingerprint %s.\n", key.Type(), address, fingerprint)
+		fmt.Fprint(console, "Do you want to trust it? (yes/no): ")
+		var response string
+		fmt.Scanln(&response)
+		if response != "yes" && response != "y" {
+			fmt.Fprintln(console, "Host key not trusted.")
+			return nil
+		}
+	}
+
+	if err := store.Add(address, key); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Trusted %s host key %s for %s in %s\n", key.Type(), fingerprint, address, store.Path())
+	return nil
+}
+
+func runHostkeysRemove(cmd *cobra.Command, args []string) error {
+	store := knownHosts()
+	address := hostAddress(args[0])
+	removed, err := store.Remove(address)
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return fmt.Errorf("no trusted host keys for %s in %s", address, store.Path())
+	}
+	fmt.Fprintf(console, "Removed %d host key(s) for %s from %s\n", removed, address, store.Path())
+	return nil
+}
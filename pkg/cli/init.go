@@ -206,24 +206,24 @@ Visit https://github.com/ataiva-software/forge for more information.
 		return fmt.Errorf("failed to create README: %w", err)
 	}
 
-	fmt.Printf("✅ Initialized Forge project '%s'\n", projectName)
-	fmt.Printf("📁 Project structure:\n")
-	fmt.Printf("   %s/\n", projectName)
-	fmt.Printf("   ├── chisel.yaml\n")
-	fmt.Printf("   ├── README.md\n")
-	fmt.Printf("   ├── inventory/\n")
-	fmt.Printf("   │   └── hosts.yaml\n")
-	fmt.Printf("   ├── modules/\n")
-	fmt.Printf("   │   └── webserver.yaml\n")
-	fmt.Printf("   ├── templates/\n")
-	fmt.Printf("   └── plans/\n")
-	fmt.Printf("\n")
-	fmt.Printf("🚀 Next steps:\n")
-	fmt.Printf("   cd %s\n", projectName)
-	fmt.Printf("   # Edit inventory/hosts.yaml with your target hosts\n")
-	fmt.Printf("   # Customize modules/webserver.yaml for your needs\n")
-	fmt.Printf("   # Create a plan: chisel plan --module modules/webserver.yaml --inventory inventory/hosts.yaml\n")
-	fmt.Printf("   # Apply changes: chisel apply --module modules/webserver.yaml --inventory inventory/hosts.yaml\n")
+	fmt.Fprintf(console, "✅ Initialized Forge project '%s'\n", projectName)
+	fmt.Fprintf(console, "📁 Project structure:\n")
+	fmt.Fprintf(console, "   %s/\n", projectName)
+	fmt.Fprintf(console, "   ├── chisel.yaml\n")
+	fmt.Fprintf(console, "   ├── README.md\n")
+	fmt.Fprintf(console, "   ├── inventory/\n")
+	fmt.Fprintf(console, "   │   └── hosts.yaml\n")
+	fmt.Fprintf(console, "   ├── modules/\n")
+	fmt.Fprintf(console, "   │   └── webserver.yaml\n")
+	fmt.Fprintf(console, "   ├── templates/\n")
+	fmt.Fprintf(console, "   └── plans/\n")
+	fmt.Fprintf(console, "\n")
+	fmt.Fprintf(console, "🚀 Next steps:\n")
+	fmt.Fprintf(console, "   cd %s\n", projectName)
+	fmt.Fprintf(console, "   # Edit inventory/hosts.yaml with your target hosts\n")
+	fmt.Fprintf(console, "   # Customize modules/webserver.yaml for your needs\n")
+	fmt.Fprintf(console, "   # Create a plan: chisel plan --module modules/webserver.yaml --inventory inventory/hosts.yaml\n")
+	fmt.Fprintf(console, "   # Apply changes: chisel apply --module modules/webserver.yaml --inventory inventory/hosts.yaml\n")
 
 	return nil
 }
@@ -257,9 +257,10 @@ type Metadata struct {
 }
 
 type ProjectSpec struct {
-	ModulePath string `yaml:"module_path"`
-	Inventory  string `yaml:"inventory"`
-	Templates  string `yaml:"templates"`
+	ModulePath      string `yaml:"module_path"`
+	Inventory       string `yaml:"inventory"`
+	Templates       string `yaml:"templates"`
+	RequiredVersion string `yaml:"required_version,omitempty"`
 }
 
 type InventoryConfig struct {
@@ -0,0 +1,372 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+var (
+	inventoryFile        string
+	inventoryMerge       string
+	inventoryRefresh     bool
+	inventorySelector    string
+	inventoryListOutput  string
+	inventoryGraphOutput string
+)
+
+// inventoryCmd represents the inventory command
+var inventoryCmd = &cobra.Command{
+	Use:   "inventory",
+	Short: "Inspect inventories",
+}
+
+var inventoryResolveCmd = &cobra.Command{
+	Use:   "resolve",
+	Short: "Show every host once, as runs will see it",
+	Long: `Merge the hosts of every target group into the view plan and apply use.
+A host listed by several groups takes its connection settings from the
+group chosen by the inventory's merge strategy (first by default, or last),
+and the labels of all of them. Settings the groups disagree on are listed
+as conflicts; with the error strategy they stop every run.`,
+	Args: cobra.NoArgs,
+	RunE: runInventoryResolve,
+}
+
+var inventoryRefreshCmd = &cobra.Command{
+	Use:   "refresh",
+	Short: "Discover the hosts of discovered groups again",
+	Long: `Ask the cloud provider of every target group with discover settings for
+its hosts, replacing those cached in inventory.cache_dir (.chisel/inventory).
+Runs use cached hosts for inventory.cache_ttl (5 minutes by default), so
+repeated plans do not call the provider's API every time; refresh after
+instances were added or removed, or pass --refresh-inventory to a run.`,
+	Args: cobra.NoArgs,
+	RunE: runInventoryRefresh,
+}
+
+var inventoryListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the hosts runs will target, with their labels and groups",
+	Long: `List every host of the inventory once, as plan and apply resolve it, with
+the groups it belongs to and its labels. --selector limits the list to the
+hosts whose labels match, such as role=web or role=web AND env!=staging, to
+check which hosts a selection picks. Labels derived from the facts last
+gathered from a host, such as os_family=debian, are matched too.
+
+Examples:
+  forge inventory list -i inventory.yaml --selector role=web
+  forge inventory list -i inventory.yaml -o json`,
+	Args: cobra.NoArgs,
+	RunE: runInventoryList,
+}
+
+var inventoryGraphCmd = &cobra.Command{
+	Use:   "graph",
+	Short: "Show which hosts belong to which groups",
+	Long: `Show the target groups with their member hosts as a tree, marking hosts
+whose connection settings come from another group. --selector limits the
+graph to the hosts whose labels match, and to the groups they belong to.`,
+	Args: cobra.NoArgs,
+	RunE: runInventoryGraph,
+}
+
+func init() {
+	rootCmd.AddCommand(inventoryCmd)
+	inventoryCmd.AddCommand(inventoryResolveCmd)
+	inventoryCmd.AddCommand(inventoryRefreshCmd)
+	inventoryCmd.AddCommand(inventoryListCmd)
+	inventoryCmd.AddCommand(inventoryGraphCmd)
+
+	inventoryCmd.PersistentFlags().StringVarP(&inventoryFile, "inventory", "i", "", "Path to inventory file (required)")
+	inventoryCmd.MarkPersistentFlagRequired("inventory")
+	inventoryResolveCmd.Flags().StringVar(&inventoryMerge, "merge", "", "Merge strategy overriding the inventory's (first, last, error)")
+	for _, cmd := range []*cobra.Command{inventoryListCmd, inventoryGraphCmd} {
+		cmd.Flags().StringVarP(&inventorySelector, "selector", "l", "", "Only show hosts whose labels match, as key=value, key!=value or key joined by AND")
+	}
+	inventoryListCmd.Flags().StringVarP(&inventoryListOutput, "output", "o", "table", "Output format (table, json)")
+	inventoryGraphCmd.Flags().StringVarP(&inventoryGraphOutput, "output", "o", "tree", "Output format (tree, json)")
+}
+
+func runInventoryResolve(cmd *cobra.Command, args []string) error {
+	inv, err := loadInventory(inventoryFile)
+	if err != nil {
+		return fmt.Errorf("failed to load inventory: %w", err)
+	}
+	if inventoryMerge != "" {
+		inv.Merge = inventoryMerge
+	}
+
+	hosts, conflicts, err := inv.Resolve()
+	if err != nil && len(conflicts) == 0 {
+		return err
+	}
+	displayHosts(hosts)
+
+	if len(conflicts) > 0 {
+		fmt.Fprintln(console)
+		displayConflicts(conflicts)
+	}
+	return err
+}
+
+func runInventoryRefresh(cmd *cobra.Command, args []string) error {
+	inventoryRefresh = true
+	inv, err := loadInventory(inventoryFile)
+	if err != nil {
+		return fmt.Errorf("failed to load inventory: %w", err)
+	}
+
+	refreshed := 0
+	for _, name := range inv.GroupNames() {
+		group := inv.Targets[name]
+		if group.Discover == nil {
+			continue
+		}
+		refreshed++
+		fmt.Fprintf(console, "%s: discovered %d host(s) with %s\n", name, len(group.Hosts), group.Discover.Provider)
+	}
+	if refreshed == 0 {
+		fmt.Fprintln(console, "The inventory has no groups with discover settings.")
+	}
+	return nil
+}
+
+func runInventoryList(cmd *cobra.Command, args []string) error {
+	if inventoryListOutput != "table" && inventoryListOutput != "json" {
+		return fmt.Errorf("unknown output format %q, must be table or json", inventoryListOutput)
+	}
+	inv, hosts, err := selectedHosts()
+	if err != nil {
+		return err
+	}
+
+	if inventoryListOutput == "json" {
+		listed := make([]listedHost, len(hosts))
+		for i, host := range hosts {
+			listed[i] = listedHost{
+				Name: host.Name, Group: host.Group, Groups: host.Groups, Labels: host.Labels,
+				Transport: host.Connection.TransportName(), User: host.Connection.User, Port: hostPort(host),
+			}
+		}
+		return printJSON(listed)
+	}
+	if len(hosts) == 0 {
+		fmt.Fprintf(console, "No hosts of %d target group(s) match\n", len(inv.Targets))
+		return nil
+	}
+	displayHosts(hosts)
+	return nil
+}
+
+func runInventoryGraph(cmd *cobra.Command, args []string) error {
+	if inventoryGraphOutput != "tree" && inventoryGraphOutput != "json" {
+		return fmt.Errorf("unknown output format %q, must be tree or json", inventoryGraphOutput)
+	}
+	inv, hosts, err := selectedHosts()
+	if err != nil {
+		return err
+	}
+
+	graph := inventory.NewGraph(inv, hosts)
+	if inventoryGraphOutput == "json" {
+		return printJSON(graph)
+	}
+	if len(graph.Groups) == 0 {
+		fmt.Fprintf(console, "No hosts of %d target group(s) match\n", len(inv.Targets))
+		return nil
+	}
+	settings := make(map[string]string, len(graph.Hosts))
+	for _, host := range graph.Hosts {
+		settings[host.Name] = host.Group
+	}
+	for _, group := range graph.Groups {
+		fmt.Fprint(console, group.Name)
+		if len(group.Labels) > 0 {
+			fmt.Fprintf(console, "  %s", formatLabels(group.Labels))
+		}
+		if group.Discover != "" {
+			fmt.Fprintf(console, "  (discovered with %s)", group.Discover)
+		}
+		fmt.Fprintln(console)
+		for i, host := range group.Hosts {
+			branch := "├──"
+			if i == len(group.Hosts)-1 {
+				branch = "└──"
+			}
+			if from := settings[host]; from != group.Name {
+				fmt.Fprintf(console, "%s %s (settings from %s)\n", branch, host, from)
+			} else {
+				fmt.Fprintf(console, "%s %s\n", branch, host)
+			}
+		}
+	}
+	return nil
+}
+
+// listedHost is a host as inventory list prints it in JSON; connection
+// secrets are left out
+type listedHost struct {
+	Name      string            `json:"name"`
+	Group     string            `json:"group"`
+	Groups    []string          `json:"groups"`
+	Transport string            `json:"transport"`
+	User      string            `json:"user,omitempty"`
+	Port      string            `json:"port,omitempty"`
+	Labels    map[string]string `json:"labels,omitempty"`
+}
+
+// selectedHosts resolves the inventory's hosts, limited to those matching
+// --selector. The selector sees the labels derived from the facts last
+// gathered from a host, as module selectors do. Conflicts between groups
+// are shown on stderr, so they do not end up in JSON output.
+func selectedHosts() (*inventory.Inventory, []inventory.Host, error) {
+	var selector *inventory.LabelSelector
+	if inventorySelector != "" {
+		parsed, err := inventory.ParseLabelSelector(inventorySelector)
+		if err != nil {
+			return nil, nil, err
+		}
+		selector = parsed
+	}
+	inv, err := loadInventory(inventoryFile)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load inventory: %w", err)
+	}
+	hosts, conflicts, err := inv.Resolve()
+	for _, conflict := range conflicts {
+		fmt.Fprintf(os.Stderr, "Warning: %s\n", conflict)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	if selector != nil {
+		cache := factsCache()
+		var selected []inventory.Host
+		for _, host := range hosts {
+			known, _ := cache.Last(host.Connection.Host)
+			if selector.Matches(inventory.MergeLabels(known.Labels(), host.Labels)) {
+				selected = append(selected, host)
+			}
+		}
+		hosts = selected
+	}
+	return inv, hosts, nil
+}
+
+// displayHosts prints hosts as a table
+func displayHosts(hosts []inventory.Host) {
+	if len(hosts) == 0 {
+		return
+	}
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "HOST\tGROUPS\tTRANSPORT\tUSER\tPORT\tLABELS")
+	for _, host := range hosts {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n", host.Name, describeGroups(host), host.Connection.TransportName(),
+			orDash(host.Connection.User), orDash(hostPort(host)), formatLabels(host.Labels))
+	}
+	w.Flush()
+}
+
+// hostPort returns the port a host is reached on over SSH, empty for
+// other transports
+func hostPort(host inventory.Host) string {
+	if host.Connection.TransportName() != ssh.TransportSSH {
+		return ""
+	}
+	if host.Connection.Port == 0 {
+		return "22"
+	}
+	return fmt.Sprint(host.Connection.Port)
+}
+
+// printJSON prints a value as indented JSON
+func printJSON(value interface{}) error {
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode JSON: %w", err)
+	}
+	fmt.Fprintln(console, string(data))
+	return nil
+}
+
+// loadInventory loads an inventory and discovers the hosts of its groups
+// with discover settings, from the cache unless --refresh-inventory is set
+func loadInventory(path string) (*inventory.Inventory, error) {
+	inv, err := inventory.LoadInventoryFromFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := inv.Discover(context.Background(), inventory.DiscoverOptions{Cache: inventoryCache(), Refresh: inventoryRefresh}); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// inventoryCache returns the cache of discovered hosts
+func inventoryCache() *inventory.DiscoveryCache {
+	dir := viper.GetString("inventory.cache_dir")
+	if dir == "" {
+		dir = inventory.DefaultCacheDir
+	}
+	ttl := inventory.DefaultCacheTTL
+	if viper.IsSet("inventory.cache_ttl") {
+		ttl = viper.GetDuration("inventory.cache_ttl")
+	}
+	return inventory.NewDiscoveryCache(dir, ttl)
+}
+
+// displayConflicts warns about settings that groups sharing a host disagree on
+func displayConflicts(conflicts []inventory.Conflict) {
+	if len(conflicts) == 0 {
+		return
+	}
+	fmt.Fprintf(console, "Inventory conflicts (%d):\n", len(conflicts))
+	for _, conflict := range conflicts {
+		fmt.Fprintf(console, "  ⚠ %s\n", conflict)
+	}
+	fmt.Fprintln(console)
+}
+
+// describeGroups lists a host's groups with the one its settings come from first
+func describeGroups(host inventory.Host) string {
+	groups := []string{host.Group}
+	for _, group := range host.Groups {
+		if group != host.Group {
+			groups = append(groups, group)
+		}
+	}
+	if len(groups) == 1 {
+		return host.Group
+	}
+	return fmt.Sprintf("%s (+%s)", groups[0], strings.Join(groups[1:], ","))
+}
+
+// formatLabels renders labels as sorted key=value pairs
+func formatLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(labels))
+	for key, value := range labels {
+		pairs = append(pairs, key+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
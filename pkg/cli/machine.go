@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/report"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// machineMode is set by --machine
+var machineMode bool
+
+// machineSource is the source of the events machine mode prints
+const machineSource = "forge"
+
+// machineOutput prints the lifecycle of a run as NDJSON events on stdout,
+// one per line as they happen, for wrappers building their own interface
+// around the CLI. Output meant for people is discarded meanwhile, except
+// warnings, which go to stderr. Property
+// values are left out of the events, since they may hold secrets.
+type machineOutput struct {
+	command string
+	console io.Writer
+
+	mu     sync.Mutex
+	out    io.Writer
+	status string
+}
+
+// startMachine starts printing the events of a command to out, or returns
+// nil without --machine
+func startMachine(command string, out io.Writer) (*machineOutput, error) {
+	if !machineMode {
+		return nil, nil
+	}
+	m := &machineOutput{command: command, console: console, out: out}
+	console = io.Discard
+	runObservers = append(runObservers, m)
+	m.emit(events.EventTypePlanStarted, map[string]interface{}{"command": command})
+	return m, nil
+}
+
+// finish prints the event ending a command that returned err, and returns err
+func (m *machineOutput) finish(err error) error {
+	if m == nil {
+		return err
+	}
+	console = m.console
+	unfollow(m)
+
+	m.mu.Lock()
+	status := m.status
+	m.mu.Unlock()
+	data := map[string]interface{}{"command": m.command}
+	if err != nil {
+		if status != report.StatusCancelled {
+			status = report.StatusFailed
+		}
+		data["error"] = err.Error()
+	} else if status == "" {
+		status = report.StatusSucceeded
+	}
+	data["status"] = status
+	m.emit(events.EventTypeRunFinished, data)
+	return err
+}
+
+// emit prints one event as a line of JSON
+func (m *machineOutput) emit(eventType events.EventType, data map[string]interface{}) {
+	event := events.NewEvent(eventType, machineSource, data)
+	line, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.out.Write(append(line, '\n'))
+}
+
+// Planned prints an event for every item of a host's plan, then the plan's summary
+func (m *machineOutput) Planned(host string, plan *core.Plan, err error) {
+	if err != nil {
+		m.emit(events.EventTypePlanFailed, map[string]interface{}{"host": host, "error": err.Error()})
+		return
+	}
+	if plan == nil {
+		return
+	}
+	for _, change := range plan.Changes {
+		data := describeMachineChange(host, change)
+		data["action"] = change.Action.String()
+		if change.Audit {
+			data["audit"] = true
+		}
+		if change.Error != nil {
+			data["error"] = change.Error.Error()
+		}
+		m.emit(events.EventTypePlanItem, data)
+	}
+	summary := plan.Summary()
+	data := map[string]interface{}{
+		"host":       host,
+		"to_create":  summary.ToCreate,
+		"to_update":  summary.ToUpdate,
+		"to_delete":  summary.ToDelete,
+		"deviations": summary.Deviations,
+		"errors":     summary.Errors,
+	}
+	if len(plan.Skipped) > 0 {
+		data["skipped"] = plan.Skipped
+	}
+	m.emit(events.EventTypePlanCompleted, data)
+}
+
+func (m *machineOutput) Applying(hosts []string) {
+	m.emit(events.EventTypeApplyStarted, map[string]interface{}{"hosts": hosts})
+}
+
+// Changed prints the result of a change or handler as soon as it is known,
+// and the handlers a successful change notifies
+func (m *machineOutput) Changed(host string, result core.ChangeResult) {
+	data := describeMachineChange(host, result.Change)
+	data["action"] = result.Change.Action.String()
+	data["success"] = result.Success
+	data["duration_ms"] = result.Duration.Milliseconds()
+	if result.Handler != "" {
+		data["handler"] = result.Handler
+	}
+	eventType := events.EventTypeResourceCompleted
+	if !result.Success {
+		eventType = events.EventTypeResourceFailed
+		if result.Error != nil {
+			data["error"] = result.Error.Error()
+		}
+	}
+	m.emit(eventType, data)
+
+	notify := result.Change.Resource.Notify
+	if result.Success && result.Handler == "" && result.Change.Action != core.ActionNoOp && len(notify) > 0 {
+		m.emit(events.EventTypeHandlerNotified, map[string]interface{}{
+			"host":     host,
+			"resource": result.Change.Resource.ResourceID(),
+			"handlers": notify,
+		})
+	}
+}
+
+// Applied prints the outcome of a host's apply
+func (m *machineOutput) Applied(host string, result *core.ExecutionResult, err error) {
+	data := map[string]interface{}{"host": host}
+	if result != nil {
+		data["succeeded"] = result.Summary.Succeeded
+		data["failed"] = result.Summary.Failed
+		data["duration_ms"] = result.Summary.Duration.Milliseconds()
+	}
+	eventType := events.EventTypeApplyCompleted
+	switch {
+	case err != nil:
+		eventType = events.EventTypeApplyFailed
+		data["error"] = err.Error()
+	case result != nil && result.Summary.Failed > 0:
+		eventType = events.EventTypeApplyFailed
+	}
+	m.emit(eventType, data)
+}
+
+func (m *machineOutput) Output(host string, line types.OutputLine) {
+	m.emit(events.EventTypeResourceOutput, map[string]interface{}{
+		"host":     host,
+		"resource": line.Resource,
+		"stream":   line.Stream,
+		"line":     line.Line,
+	})
+}
+
+func (m *machineOutput) Phase(eventType events.EventType, data map[string]interface{}) {
+	m.emit(eventType, data)
+}
+
+func (m *machineOutput) SetStatus(status string) {
+	m.mu.Lock()
+	m.status = status
+	m.mu.Unlock()
+}
+
+// describeMachineChange names the resource of a change and the properties
+// it changes, without their values
+func describeMachineChange(host string, change core.Change) map[string]interface{} {
+	data := map[string]interface{}{
+		"host":     host,
+		"resource": change.Resource.ResourceID(),
+	}
+	if change.Diff != nil && len(change.Diff.Changes) > 0 {
+		properties := make([]string, 0, len(change.Diff.Changes))
+		for property := range change.Diff.Changes {
+			properties = append(properties, property)
+		}
+		sort.Strings(properties)
+		data["properties"] = properties
+	}
+	return data
+}
@@ -0,0 +1,268 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/forgetest"
+	"github.com/ataiva-software/forge/pkg/gitsource"
+	"github.com/ataiva-software/forge/pkg/registry"
+)
+
+// moduleTestDir is where module tests are looked for when no path is given
+const moduleTestDir = "tests"
+
+var (
+	moduleInstallSource string
+	moduleInstallFile   string
+	moduleUpgrade       bool
+)
+
+// moduleCmd represents the module command
+var moduleCmd = &cobra.Command{
+	Use:   "module",
+	Short: "Work with modules",
+}
+
+var moduleTestCmd = &cobra.Command{
+	Use:   "test [fixture or directory...]",
+	Short: "Unit test modules against scripted command fixtures",
+	Long: `Run module tests without any servers. Each fixture (a *.test.yaml file)
+names a module, scripts what the commands its providers run print and exit
+with, and states the plan, the apply outcome and the commands it expects.
+Providers validate, diff and apply against the scripted results instead of a
+host.
+
+Directories are searched for fixtures; with no arguments the tests directory
+is used. The command fails when any expectation does not hold.`,
+	RunE: runModuleTest,
+}
+
+var moduleInstallCmd = &cobra.Command{
+	Use:   "install [name[@version]]",
+	Short: "Install the modules a project uses from git repositories and registries",
+	Long: `Install the modules listed in the requirements file (modules.yaml) into the
+module cache, and record the version each resolved to in the lockfile
+(modules.lock). Commit both files: later installs, on any machine, fetch
+the locked versions, and a locked version whose files changed upstream is
+refused.
+
+A module's source is a git repository, whose version tags (v1.2.0 or
+1.2.0) are its versions, or an HTTP registry serving
+<registry>/<name>/index.yaml. The version is a constraint such as
+"~> 1.2" or ">= 1.0, < 2.0"; the newest matching version is installed.
+
+Given a module, it is added to the requirements file (or its version and
+source changed) and installed. --upgrade moves every module, or the one
+given, to the newest version its constraint allows.
+
+Modules import installed modules with source: module:<name>.
+
+Examples:
+  forge module install nginx@"~> 1.2" --source https://github.com/org/forge-nginx.git
+  forge module install postgres --source https://modules.example.com
+  forge module install
+  forge module install --upgrade`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: runModuleInstall,
+}
+
+func init() {
+	rootCmd.AddCommand(moduleCmd)
+	moduleCmd.AddCommand(moduleTestCmd, moduleInstallCmd)
+
+	moduleInstallCmd.Flags().StringVar(&moduleInstallSource, "source", "", "Git repository or registry URL of the module given")
+	moduleInstallCmd.Flags().StringVar(&moduleInstallFile, "module", "", "Module file within the module given (default module.yaml)")
+	moduleInstallCmd.Flags().BoolVar(&moduleUpgrade, "upgrade", false, "Install the newest allowed versions instead of the locked ones")
+	moduleInstallCmd.Flags().String("requirements", registry.DefaultRequirementsFile, "Requirements file listing the modules to install")
+	moduleInstallCmd.Flags().String("lock", registry.DefaultLockFile, "Lockfile recording the installed versions")
+	moduleInstallCmd.Flags().String("cache", registry.DefaultCacheDir, "Directory installed modules are kept in")
+	viper.BindPFlag("modules.requirements", moduleInstallCmd.Flags().Lookup("requirements"))
+	viper.BindPFlag("modules.lock", moduleInstallCmd.Flags().Lookup("lock"))
+	viper.BindPFlag("modules.cache", moduleInstallCmd.Flags().Lookup("cache"))
+
+	core.SetModuleResolver(installedModule)
+}
+
+// installedModule returns the module file of a module installed from a
+// registry, as locked in the lockfile
+func installedModule(name string) (string, error) {
+	lock, err := registry.LoadLock(viper.GetString("modules.lock"))
+	if err != nil {
+		return "", err
+	}
+	return registry.NewInstaller(viper.GetString("modules.cache")).Path(lock, name)
+}
+
+// moduleLocation is the local module file of a --module argument, and for
+// modules fetched from git, the address and the commit fetched
+type moduleLocation struct {
+	File     string
+	Source   string
+	Revision string
+	// Pinned is the --module argument that loads the same module again:
+	// the address with its ref set to the commit fetched, or the file
+	Pinned string
+}
+
+// locateModule returns where the module of a --module argument is, fetching
+// git::<repository>//<path>?ref=<ref> addresses into the git cache first.
+// Local paths are returned as given.
+func locateModule(ctx context.Context, module string) (moduleLocation, error) {
+	if !gitsource.IsAddress(module) {
+		return moduleLocation{File: module, Pinned: module}, nil
+	}
+	address, err := gitsource.ParseAddress(module)
+	if err != nil {
+		return moduleLocation{}, err
+	}
+	fetcher := gitsource.NewFetcher(viper.GetString("modules.git_cache"))
+	fetcher.VerifySignatures = viper.GetBool("modules.verify_signatures")
+	checkout, err := fetcher.Fetch(ctx, address)
+	if err != nil {
+		return moduleLocation{}, fmt.Errorf("failed to fetch module: %w", err)
+	}
+	fmt.Fprintf(console, "Fetched %s at %s\n", module, checkout.Commit[:12])
+	pinned := *address
+	pinned.Ref = checkout.Commit
+	return moduleLocation{File: checkout.File, Source: module, Revision: checkout.Commit, Pinned: pinned.String()}, nil
+}
+
+func runModuleInstall(cmd *cobra.Command, args []string) error {
+	requirementsFile := viper.GetString("modules.requirements")
+	lockFile := viper.GetString("modules.lock")
+	requirements, err := registry.LoadRequirements(requirementsFile)
+	if err != nil {
+		return err
+	}
+	lock, err := registry.LoadLock(lockFile)
+	if err != nil {
+		return err
+	}
+
+	only := ""
+	if len(args) == 1 {
+		name, version, _ := strings.Cut(args[0], "@")
+		requirement := registry.Requirement{Name: name, Source: moduleInstallSource, Version: version, Module: moduleInstallFile}
+		for _, existing := range requirements.Modules {
+			if existing.Name != name {
+				continue
+			}
+			if requirement.Source == "" {
+				requirement.Source = existing.Source
+			}
+			if requirement.Module == "" {
+				requirement.Module = existing.Module
+			}
+			if !strings.Contains(args[0], "@") {
+				requirement.Version = existing.Version
+			}
+		}
+		if requirement.Source == "" {
+			return fmt.Errorf("module %s is not in %s; give its --source", name, requirementsFile)
+		}
+		if err := requirement.Validate(); err != nil {
+			return err
+		}
+		requirements.Set(requirement)
+		only = name
+	}
+	if len(requirements.Modules) == 0 {
+		return fmt.Errorf("no modules to install; add one with 'forge module install <name> --source <url>'")
+	}
+
+	installer := registry.NewInstaller(viper.GetString("modules.cache"))
+	ctx := context.Background()
+	for _, requirement := range requirements.Modules {
+		previous, wasLocked := lock.Get(requirement.Name)
+		previousVersion := ""
+		if wasLocked {
+			previousVersion = previous.Version
+		}
+		locked, err := installer.Install(ctx, requirement, lock, moduleUpgrade && (only == "" || only == requirement.Name))
+		if err != nil {
+			return err
+		}
+		lock.Set(*locked)
+
+		switch {
+		case !wasLocked:
+			fmt.Fprintf(console, "+ %s %s (%s)\n", locked.Name, locked.Version, shortRevision(locked.Revision))
+		case previousVersion != locked.Version:
+			fmt.Fprintf(console, "~ %s %s -> %s (%s)\n", locked.Name, previousVersion, locked.Version, shortRevision(locked.Revision))
+		default:
+			fmt.Fprintf(console, "  %s %s\n", locked.Name, locked.Version)
+		}
+	}
+	lock.Prune(requirements)
+
+	if only != "" {
+		if err := requirements.Save(requirementsFile); err != nil {
+			return err
+		}
+	}
+	if err := lock.Save(lockFile); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "\n%d module(s) installed into %s; versions locked in %s\n", len(requirements.Modules), installer.CacheDir, lockFile)
+	return nil
+}
+
+// shortRevision abbreviates a git commit; registry archive URLs are kept
+func shortRevision(revision string) string {
+	if len(revision) == 40 && !strings.Contains(revision, "/") {
+		return revision[:12]
+	}
+	return revision
+}
+
+func runModuleTest(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{moduleTestDir}
+	}
+	files, err := forgetest.FindFixtures(args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("no fixtures (*%s) found in %v", forgetest.FixtureSuffix, args)
+	}
+
+	failed := 0
+	for _, file := range files {
+		fixture, err := forgetest.LoadFixture(file)
+		if err != nil {
+			return err
+		}
+		report, err := forgetest.Run(context.Background(), fixture, providerFactories())
+		if err != nil {
+			failed++
+			fmt.Fprintf(console, "✗ %s (%s)\n  Error: %v\n", fixture.Name, file, err)
+			continue
+		}
+		if report.Passed() {
+			fmt.Fprintf(console, "✓ %s\n", fixture.Name)
+		} else {
+			failed++
+			fmt.Fprintf(console, "✗ %s (%s)\n", fixture.Name, file)
+			for _, failure := range report.Failures {
+				fmt.Fprintf(console, "  %s\n", failure)
+			}
+		}
+		if verbose || !report.Passed() {
+			for _, command := range report.Commands {
+				fmt.Fprintf(console, "    $ %s\n", command)
+			}
+		}
+	}
+
+	fmt.Fprintf(console, "\n%d passed, %d failed\n", len(files)-failed, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d module test(s) failed", failed)
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"os"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/events"
+	"github.com/ataiva-software/forge/pkg/report"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// runObserver follows the progress of a run, to answer an API call or to
+// build a report
+type runObserver interface {
+	Planned(host string, plan *core.Plan, err error)
+	Applying(hosts []string)
+	Applied(host string, result *core.ExecutionResult, err error)
+	Output(host string, line types.OutputLine)
+	SetStatus(status string)
+}
+
+// observers passes the progress of a run on to every observer
+type observers []runObserver
+
+func (o observers) Planned(host string, plan *core.Plan, err error) {
+	for _, observer := range o {
+		observer.Planned(host, plan, err)
+	}
+}
+
+func (o observers) Applying(hosts []string) {
+	for _, observer := range o {
+		observer.Applying(hosts)
+	}
+}
+
+func (o observers) Applied(host string, result *core.ExecutionResult, err error) {
+	for _, observer := range o {
+		observer.Applied(host, result, err)
+	}
+}
+
+func (o observers) Output(host string, line types.OutputLine) {
+	for _, observer := range o {
+		observer.Output(host, line)
+	}
+}
+
+func (o observers) SetStatus(status string) {
+	for _, observer := range o {
+		observer.SetStatus(status)
+	}
+}
+
+// resultObserver is a run observer that also follows every change and
+// handler as it is applied, rather than each host's results at the end
+type resultObserver interface {
+	Changed(host string, result core.ChangeResult)
+}
+
+// Changed passes a result on to the observers following results
+func (o observers) Changed(host string, result core.ChangeResult) {
+	for _, observer := range o {
+		if following, ok := observer.(resultObserver); ok {
+			following.Changed(host, result)
+		}
+	}
+}
+
+// phaseObserver is a run observer that also follows the phases of a
+// rollout, such as canaries being promoted
+type phaseObserver interface {
+	Phase(eventType events.EventType, data map[string]interface{})
+}
+
+// Phase passes a rollout phase on to the observers following phases
+func (o observers) Phase(eventType events.EventType, data map[string]interface{}) {
+	for _, observer := range o {
+		if following, ok := observer.(phaseObserver); ok {
+			following.Phase(eventType, data)
+		}
+	}
+}
+
+// runObservers follow the run in progress
+var runObservers observers
+
+// unfollow removes an observer from the run observers, leaving the others
+// following the run
+func unfollow(observer runObserver) {
+	for i, following := range runObservers {
+		if following == observer {
+			runObservers = append(runObservers[:i:i], runObservers[i+1:]...)
+			return
+		}
+	}
+}
+
+// streamOutput returns a context in which the lines the commands of a
+// host's resources print, and the results of its changes, are passed on to
+// the run observers as they happen
+func streamOutput(ctx context.Context, host string) context.Context {
+	if len(runObservers) == 0 {
+		return ctx
+	}
+	following := runObservers
+	ctx = core.WithResultStream(ctx, func(result core.ChangeResult) {
+		following.Changed(host, result)
+	})
+	return types.WithOutputStream(ctx, func(line types.OutputLine) {
+		following.Output(host, line)
+	})
+}
+
+// localHost names the machine forge runs on in reports of runs without an
+// inventory
+const localHost = "localhost"
+
+// statusCancelled is the status of a run whose plan was not approved
+const statusCancelled = report.StatusCancelled
+
+// console is where commands print output meant for people. Structured
+// output moves it to stderr and machine mode discards it, so that stdout
+// carries nothing but the report or the events.
+var console io.Writer = os.Stdout
+
+// warnings returns where warnings are printed: the console, except in
+// machine mode, which discards the console but keeps warnings on stderr
+func warnings() io.Writer {
+	if machineMode {
+		return os.Stderr
+	}
+	return console
+}
+
+// reportOutput prints the report of a command in a structured format.
+// While the command runs, output meant for people goes to stderr.
+type reportOutput struct {
+	format   string
+	recorder *report.Recorder
+	out      io.Writer
+	console  io.Writer
+}
+
+// startReport starts recording a report for the text, json or yaml format,
+// to be written to out; text output needs no report, so nil is returned
+// for it
+func startReport(command, format string, out io.Writer) (*reportOutput, error) {
+	if err := report.ValidateFormat(format); err != nil {
+		return nil, err
+	}
+	if format == report.FormatText {
+		return nil, nil
+	}
+	output := &reportOutput{format: format, recorder: report.NewRecorder(command), out: out, console: console}
+	console = os.Stderr
+	runObservers = append(runObservers, output.recorder)
+	return output, nil
+}
+
+// Recorder returns the recorder of the report, nil for text output
+func (o *reportOutput) Recorder() *report.Recorder {
+	if o == nil {
+		return nil
+	}
+	return o.recorder
+}
+
+// finish prints the report of a command that ended with err and returns err
+func (o *reportOutput) finish(err error) error {
+	if o == nil {
+		return err
+	}
+	console = o.console
+	unfollow(o.recorder)
+	if writeErr := report.Write(o.out, o.recorder.Report(err), o.format); writeErr != nil {
+		return writeErr
+	}
+	return err
+}
@@ -3,20 +3,34 @@ package cli
 import (
 	"context"
 	"fmt"
-	"os"
+	"strings"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/audit"
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/hooks"
 	"github.com/ataiva-software/forge/pkg/inventory"
-	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/planfile"
+	"github.com/ataiva-software/forge/pkg/report"
 	"github.com/ataiva-software/forge/pkg/ssh"
-	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/vault"
+	"github.com/ataiva-software/forge/pkg/webhook"
 )
 
 var (
 	planModuleFile    string
 	planInventoryFile string
+	planLocal         bool
 	planOutputFile    string
+	planOutputFormat  string
+	planTargets       []string
+	planExcludes      []string
+	planVars          []string
+	planVarFiles      []string
+
+	// planModule is where the module planned was loaded from
+	planModule moduleLocation
 )
 
 // planCmd represents the plan command
@@ -27,116 +41,240 @@ var planCmd = &cobra.Command{
 the infrastructure to the desired state defined in the module.
 
 The plan command reads a module file and optionally an inventory file,
-then shows what actions will be taken without actually applying them.`,
+then shows what actions will be taken without actually applying them.
+
+With --output json or yaml the plan is printed as a machine-readable
+report, with the resource id, action, changed properties and reason of
+every change; other output goes to stderr.
+
+With --out the plan is saved for 'forge apply <file>', which applies
+exactly that plan and refuses to run if the module, inventory or the
+state of any resource changed since. Saving a plan with --inventory or
+--local connects to the hosts to read their current state.
+
+--target limits the plan to resources picked by id (file.nginx-conf), type
+(type=pkg) or tag (tag=web), along with the resources they depend on.
+--exclude leaves resources out, along with the resources that depend on
+them. Both can be repeated.
+
+--audit-only plans every resource as if it had state audit, reporting
+how it deviates without ever applying it.`,
 	RunE: runPlan,
 }
 
 func init() {
 	rootCmd.AddCommand(planCmd)
 
-	planCmd.Flags().StringVarP(&planModuleFile, "module", "m", "", "Path to module file (required)")
+	planCmd.Flags().StringVarP(&planModuleFile, "module", "m", "", "Path to module file, or git::<repository>//<path>?ref=<ref> (required)")
 	planCmd.Flags().StringVarP(&planInventoryFile, "inventory", "i", "", "Path to inventory file")
-	planCmd.Flags().StringVarP(&planOutputFile, "output", "o", "", "Path to save plan output (JSON format)")
+	planCmd.Flags().BoolVar(&planLocal, "local", false, "Plan for the machine forge runs on, without SSH")
+	planCmd.Flags().BoolVar(&inventoryRefresh, "refresh-inventory", false, "Discover the hosts of discovered groups again instead of using cached ones")
+	planCmd.Flags().BoolVar(&auditOnly, "audit-only", false, "Only report how resources deviate from the module, as if every resource had state audit")
+	planCmd.Flags().StringVar(&planOutputFile, "out", "", "Save the plan to this file for 'forge apply <file>'")
+	planCmd.Flags().StringVarP(&planOutputFormat, "output", "o", report.FormatText, "Output format (text, json, yaml); a file name saves the plan, as --out, but is deprecated")
+	planCmd.Flags().BoolVar(&machineMode, "machine", false, "Print NDJSON lifecycle events on stdout as they happen instead of human output")
+	planCmd.Flags().StringArrayVar(&planVars, "var", nil, "Set a module variable, as key=value (repeatable)")
+	planCmd.Flags().StringArrayVar(&planVarFiles, "var-file", nil, "Set module variables from a YAML file (repeatable)")
+	planCmd.Flags().StringArrayVar(&planTargets, "target", nil, "Only plan these resources: <type>.<name>, type=<type> or tag=<tag> (repeatable)")
+	planCmd.Flags().StringArrayVar(&planExcludes, "exclude", nil, "Leave these resources out: <type>.<name>, type=<type> or tag=<tag> (repeatable)")
 	
+	planCmd.MarkFlagsMutuallyExclusive("inventory", "local")
+	planCmd.MarkFlagsMutuallyExclusive("machine", "output")
 	planCmd.MarkFlagRequired("module")
 }
 
-func runPlan(cmd *cobra.Command, args []string) error {
-	// Load the module
-	module, err := core.LoadModuleFromFile(planModuleFile)
+func runPlan(cmd *cobra.Command, args []string) (err error) {
+	// --output used to name the file the plan is saved to; a value that is
+	// not a format still does, until it is removed
+	if report.ValidateFormat(planOutputFormat) != nil && planOutputFile == "" {
+		fmt.Fprintf(warnings(), "Warning: --output %s to save the plan is deprecated, use --out %s\n", planOutputFormat, planOutputFormat)
+		planOutputFile, planOutputFormat = planOutputFormat, report.FormatText
+	}
+	output, err := startReport("plan", planOutputFormat, cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+	defer func() { err = output.finish(err) }()
+	machine, err := startMachine("plan", cmd.OutOrStdout())
+	if err != nil {
+		return err
+	}
+	defer func() { err = machine.finish(err) }()
+
+	// Load the module, fetching it first when it is given as a git address
+	if planModule, err = locateModule(context.Background(), planModuleFile); err != nil {
+		return err
+	}
+	module, err := core.LoadModuleFromFile(planModule.File)
 	if err != nil {
 		return fmt.Errorf("failed to load module: %w", err)
 	}
+	output.Recorder().SetModule(module.Metadata.Name)
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	overrides, err := varOverrides(planVars, planVarFiles)
+	if err != nil {
+		return err
+	}
+	if err := module.ResolveVars(overrides); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	if err := selectResources(module, planTargets, planExcludes); err != nil {
+		return err
+	}
+	hookRunner, err := loadHooks()
+	if err != nil {
+		return err
+	}
+	projectHooks, err := startHooks(context.Background(), hookRunner, module, hooks.Run{
+		Command:   "plan",
+		Inventory: planInventoryFile,
+		DryRun:    true,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { projectHooks.finish(context.Background(), err) }()
+
+	// Plans saved for hosts are made against the state they are in now
+	if planOutputFile != "" && (planInventoryFile != "" || planLocal) {
+		return savePlanForHosts(cmd, module)
+	}
+	if err := checkPolicies(context.Background(), module); err != nil {
+		return err
+	}
 
 	// Load inventory if specified
 	var inv *inventory.Inventory
 	if planInventoryFile != "" {
-		inv, err = inventory.LoadInventoryFromFile(planInventoryFile)
+		inv, err = loadInventory(planInventoryFile)
 		if err != nil {
 			return fmt.Errorf("failed to load inventory: %w", err)
 		}
 	}
 
+	warnUnchecked(module)
+
 	// Create provider registry and register core providers
-	registry := types.NewProviderRegistry()
 	mockExecutor := ssh.NewMockExecutor()
 	// Connect the mock executor
 	if err := mockExecutor.Connect(context.Background()); err != nil {
 		return fmt.Errorf("failed to connect mock executor: %w", err)
 	}
-	if err := registry.Register(providers.NewFileProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register file provider: %w", err)
-	}
-	if err := registry.Register(providers.NewPkgProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register package provider: %w", err)
-	}
-	if err := registry.Register(providers.NewServiceProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register service provider: %w", err)
-	}
-	if err := registry.Register(providers.NewUserProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register user provider: %w", err)
+	registry, err := newLocalRegistry(mockExecutor)
+	if err != nil {
+		return err
 	}
-	if err := registry.Register(providers.NewShellProvider(mockExecutor)); err != nil {
-		return fmt.Errorf("failed to register shell provider: %w", err)
+	catalog, err := packageCatalog()
+	if err != nil {
+		return err
 	}
 
 	// Create planner
 	planner := core.NewPlanner(registry)
+	planner.SetSelection(resourceSelection)
+	planner.SetAuditOnly(auditOnly)
+	planner.SetPackages(catalog)
 
 	// Create plan
 	plan, err := planner.CreatePlan(module)
 	if err != nil {
 		return fmt.Errorf("failed to create plan: %w", err)
 	}
+	runObservers.Planned(localHost, plan, nil)
+
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	sendWebhook(context.Background(), webhooks, webhook.EventPlanCreated, module, planWebhookData(plan))
 
 	// Display plan summary
 	summary := plan.Summary()
-	fmt.Printf("Plan: %d to add, %d to change, %d to destroy\n\n", 
+	fmt.Fprintf(console, "Plan: %d to add, %d to change, %d to destroy\n\n", 
 		summary.ToCreate, summary.ToUpdate, summary.ToDelete)
 
 	// Display changes
 	for _, change := range plan.Changes {
 		if change.Error != nil {
-			fmt.Printf("✗ %s.%s\n", change.Resource.Type, change.Resource.Name)
-			fmt.Printf("  Error: %v\n\n", change.Error)
+			fmt.Fprintf(console, "✗ %s.%s\n", change.Resource.Type, change.Resource.Name)
+			fmt.Fprintf(console, "  Error: %v\n\n", change.Error)
 			continue
 		}
 
-		symbol := getChangeSymbol(change.Action)
-		fmt.Printf("%s %s.%s\n", symbol, change.Resource.Type, change.Resource.Name)
+		symbol := getChangeSymbol(change)
+		fmt.Fprintf(console, "%s %s.%s\n", symbol, change.Resource.Type, change.Resource.Name)
 		
 		if change.Action != core.ActionNoOp {
 			displayChangeDiff(change)
 		}
-		fmt.Println()
+		fmt.Fprintln(console)
+	}
+	displayDeviations(summary.Deviations)
+
+	if plan.HasChanges() {
+		if err := checkTopology(module, false); err != nil {
+			return err
+		}
 	}
 
 	// Show inventory info if loaded
 	if inv != nil {
-		fmt.Printf("Inventory: %d target groups\n", len(inv.Targets))
-		for name, group := range inv.Targets {
+		fmt.Fprintf(console, "Inventory: %d target groups\n", len(inv.Targets))
+		for _, name := range inv.GroupNames() {
+			group := inv.Targets[name]
 			hosts, _ := group.GetHosts()
 			if len(hosts) > 0 {
-				fmt.Printf("  %s: %d hosts\n", name, len(hosts))
+				fmt.Fprintf(console, "  %s: %d hosts\n", name, len(hosts))
 			} else {
-				fmt.Printf("  %s: selector '%s'\n", name, group.Selector)
+				fmt.Fprintf(console, "  %s: selector '%s'\n", name, group.Selector)
 			}
 		}
+
+		hosts, conflicts, err := inv.Resolve()
+		if len(conflicts) > 0 {
+			fmt.Fprintln(console)
+			displayConflicts(conflicts)
+		}
+		if err != nil {
+			return err
+		}
+
+		quarantine, err := loadQuarantine()
+		if err != nil {
+			return err
+		}
+		_, quarantined := quarantine.Filter(hosts)
+		if len(quarantined) > 0 {
+			fmt.Fprintln(console)
+			displayQuarantined(quarantined)
+		}
 	}
 
 	// Save plan to file if requested
 	if planOutputFile != "" {
-		if err := savePlanToFile(plan, planOutputFile); err != nil {
-			return fmt.Errorf("failed to save plan: %w", err)
+		fingerprint, err := planFingerprint(cmd)
+		if err != nil {
+			return err
+		}
+		saved, err := newSavedPlan(planfile.New(fingerprint, planModule.Pinned, "", false))
+		if err != nil {
+			return err
+		}
+		if err := saved.save(map[string]*core.Plan{localHost: plan}); err != nil {
+			return err
 		}
-		fmt.Printf("\nPlan saved to: %s\n", planOutputFile)
 	}
 
 	return nil
 }
 
-func getChangeSymbol(action core.Action) string {
-	switch action {
+func getChangeSymbol(change core.Change) string {
+	if change.Deviates() {
+		return "!"
+	}
+	switch change.Action {
 	case core.ActionCreate:
 		return "+"
 	case core.ActionUpdate:
@@ -156,45 +294,174 @@ func displayChangeDiff(change core.Change) {
 	}
 
 	// Display the diff information
-	switch change.Action {
-	case core.ActionCreate:
-		fmt.Printf("  (will be created)\n")
-	case core.ActionUpdate:
-		fmt.Printf("  (will be updated)\n")
-	case core.ActionDelete:
-		fmt.Printf("  (will be destroyed)\n")
+	switch {
+	case change.Audit:
+		fmt.Fprintf(console, "  (deviates, audit only)\n")
+	case change.Action == core.ActionCreate:
+		fmt.Fprintf(console, "  (will be created)\n")
+	case change.Action == core.ActionUpdate:
+		fmt.Fprintf(console, "  (will be updated)\n")
+	case change.Action == core.ActionDelete:
+		fmt.Fprintf(console, "  (will be destroyed)\n")
 	}
 
 	// Show some key properties
 	if path, ok := change.Resource.Properties["path"]; ok {
-		fmt.Printf("  path: %v\n", path)
+		fmt.Fprintf(console, "  path: %v\n", path)
 	}
 	if state, ok := change.Resource.Properties["state"]; ok {
-		fmt.Printf("  state: %v\n", state)
+		if _, changed := change.Diff.Changes["state"]; !changed {
+			fmt.Fprintf(console, "  state: %v\n", state)
+		}
+	}
+
+	// Show changed attributes in key order so output is stable between runs
+	for _, key := range change.Diff.ChangedKeys() {
+		fmt.Fprintf(console, "  %s: %s\n", key, outputRedactor.Redact(formatDiffValue(change.Diff.Changes[key])))
+	}
+	if len(change.Resource.Notify) > 0 {
+		fmt.Fprintf(console, "  notifies: %s\n", strings.Join(change.Resource.Notify, ", "))
+	}
+	if len(change.Resource.Defaulted) > 0 {
+		fmt.Fprintf(console, "  from defaults: %s\n", strings.Join(change.Resource.Defaulted, ", "))
+	}
+}
+
+// displayDeviations notes how many audited resources deviate from the module
+func displayDeviations(count int) {
+	if count > 0 {
+		fmt.Fprintf(console, "Audit: %d resource(s) deviate from the module and are left unchanged\n\n", count)
+	}
+}
+
+// formatDiffValue renders a single diff entry, using "from -> to" for transitions
+func formatDiffValue(value interface{}) string {
+	if transition, ok := value.(map[string]interface{}); ok {
+		from, hasFrom := transition["from"]
+		to, hasTo := transition["to"]
+		if hasFrom && hasTo && len(transition) == 2 {
+			return fmt.Sprintf("%v -> %v", from, to)
+		}
+	}
+	// fmt prints map keys in sorted order
+	return fmt.Sprintf("%v", value)
+}
+
+// savedPlan ties a run to a plan file: with out set the plans made are
+// saved to it, otherwise they must match the plans in the file
+type savedPlan struct {
+	file *planfile.File
+	out  string
+}
+
+// newSavedPlan saves the plans of this run, with the variables and
+// selection they were made with, to --out. Variables from !vault values are
+// saved encrypted, as they are in their var files.
+func newSavedPlan(file *planfile.File) (*savedPlan, error) {
+	file.Targets, file.Excludes = planTargets, planExcludes
+	file.AuditOnly = auditOnly
+	overrides, err := loadVarOverrides(planVars, planVarFiles, core.LoadVarFileEncrypted)
+	if err != nil {
+		return nil, err
+	}
+	if len(overrides) > 0 {
+		file.Vars = overrides
+	}
+	return &savedPlan{file: file, out: planOutputFile}, nil
+}
+
+// save records the plan of every host and writes the plan file. Diffs show
+// the content of the files the plans change, which may hold decrypted
+// values and secrets, so a plan file that is not encrypted whole has its
+// diffs encrypted with the default vault key, or redacted without one.
+func (p *savedPlan) save(plans map[string]*core.Plan) error {
+	for host, plan := range plans {
+		if err := p.file.AddHost(host, plan); err != nil {
+			return fmt.Errorf("cannot save the plan: %w", err)
+		}
+	}
+	sealer := atRestSealer()
+	if sealer.KeyID() == "" {
+		if _, err := vaultKey(vault.DefaultKeyID); err == nil {
+			if err := p.file.SealDiffs(vault.NewSealer(vault.KeyFunc(vaultKey), vault.DefaultKeyID)); err != nil {
+				return err
+			}
+		} else {
+			p.file.RedactDiffs(outputRedactor.Redact)
+		}
+	}
+	if err := p.file.Write(p.out, sealer); err != nil {
+		return err
 	}
+	fmt.Fprintf(console, "\nPlan saved to: %s\n", p.out)
+	fmt.Fprintf(console, "To apply exactly this plan, run: forge apply %s\n", p.out)
+	return nil
 }
 
-func savePlanToFile(plan *core.Plan, filename string) error {
-	// For now, just save as JSON
-	// TODO: Implement proper plan serialization
-	file, err := os.Create(filename)
+// planFingerprint fingerprints the inputs of the plan being saved
+func planFingerprint(cmd *cobra.Command) (*audit.Fingerprint, error) {
+	fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+		ControllerVersion: cmd.Root().Version,
+		ModuleFile:        planModule.File,
+		ModuleSource:      planModule.Source,
+		ModuleRevision:    planModule.Revision,
+		InventoryFile:     planInventoryFile,
+		PolicyFiles:       viper.GetStringSlice("policy.paths"),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to fingerprint plan: %w", err)
+	}
+	return fingerprint, nil
+}
+
+// savePlanForHosts plans the module on the inventory hosts, or this
+// machine, the way apply does and saves the plans instead of applying them
+func savePlanForHosts(cmd *cobra.Command, module *core.Module) error {
+	inv := inventory.Local()
+	if planInventoryFile != "" {
+		var err error
+		inv, err = loadInventory(planInventoryFile)
+		if err != nil {
+			return fmt.Errorf("failed to load inventory: %w", err)
+		}
+	}
+	fingerprint, err := planFingerprint(cmd)
+	if err != nil {
+		return err
+	}
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	saved, err := newSavedPlan(planfile.New(fingerprint, planModule.Pinned, planInventoryFile, planLocal))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
+	return runApplyHosts(context.Background(), module, inv, fingerprint, webhooks, saved, nil)
+}
 
-	// Simple JSON-like output for now
-	fmt.Fprintf(file, "{\n")
-	fmt.Fprintf(file, "  \"changes\": %d,\n", len(plan.Changes))
-	fmt.Fprintf(file, "  \"summary\": {\n")
-	summary := plan.Summary()
-	fmt.Fprintf(file, "    \"to_create\": %d,\n", summary.ToCreate)
-	fmt.Fprintf(file, "    \"to_update\": %d,\n", summary.ToUpdate)
-	fmt.Fprintf(file, "    \"to_delete\": %d,\n", summary.ToDelete)
-	fmt.Fprintf(file, "    \"no_changes\": %d,\n", summary.NoChanges)
-	fmt.Fprintf(file, "    \"errors\": %d\n", summary.Errors)
-	fmt.Fprintf(file, "  }\n")
-	fmt.Fprintf(file, "}\n")
+// auditOnly audits every resource of the run, as if it had state audit
+var auditOnly bool
+
+// resourceSelection limits the run to the resources picked by --target and
+// --exclude; nil selects every resource
+var resourceSelection *core.Selection
 
+// selectResources parses --target and --exclude and checks them against the
+// module, so a selector matching nothing fails before any host is contacted
+func selectResources(module *core.Module, targets, excludes []string) error {
+	selection, err := core.NewSelection(targets, excludes)
+	if err != nil {
+		return err
+	}
+	if selection.Empty() {
+		return nil
+	}
+	selected, excluded, err := selection.Filter(module.Spec.Resources)
+	if err != nil {
+		return err
+	}
+	resourceSelection = selection
+	fmt.Fprintf(console, "Selected %d of %d resource(s); left out: %s\n\n", len(selected), len(module.Spec.Resources), strings.Join(excluded, ", "))
 	return nil
 }
@@ -0,0 +1,37 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/policy"
+)
+
+// checkPolicies evaluates a module against the policy files in effect and
+// refuses to run it when any rule is violated
+func checkPolicies(ctx context.Context, module *core.Module) error {
+	paths := viper.GetStringSlice("policy.paths")
+	if len(paths) == 0 {
+		return nil
+	}
+	engine := policy.NewPolicyEngine()
+	if err := engine.LoadFromConfig(&policy.PolicyConfig{Enabled: true, PolicyPaths: paths}); err != nil {
+		return err
+	}
+	result, err := engine.EvaluateModule(ctx, module)
+	if err != nil {
+		return err
+	}
+	if result.Allowed {
+		return nil
+	}
+
+	fmt.Fprintf(console, "Policy violations (%d):\n", len(result.Violations))
+	for _, violation := range result.Violations {
+		fmt.Fprintf(console, "  ✗ %s\n", violation.String())
+	}
+	fmt.Fprintln(console)
+	return fmt.Errorf("module violates %d policy rule(s)", len(result.Violations))
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/inventory"
+)
+
+const defaultQuarantineFile = ".chisel/quarantine.yaml"
+
+var (
+	quarantineReason  string
+	quarantineExpires time.Duration
+	quarantineBy      string
+)
+
+// quarantineCmd represents the quarantine command
+var quarantineCmd = &cobra.Command{
+	Use:   "quarantine",
+	Short: "Manage quarantined hosts",
+	Long: `Quarantined hosts are skipped in every plan and apply until they are
+released or their quarantine expires. Use this to keep hosts under
+investigation from breaking every run.`,
+}
+
+var quarantineAddCmd = &cobra.Command{
+	Use:   "add <host>",
+	Short: "Quarantine a host",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runQuarantineAdd,
+}
+
+var quarantineRemoveCmd = &cobra.Command{
+	Use:   "remove <host>",
+	Short: "Release a host from quarantine",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runQuarantineRemove,
+}
+
+var quarantineListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List quarantined hosts",
+	Args:  cobra.NoArgs,
+	RunE:  runQuarantineList,
+}
+
+func init() {
+	rootCmd.AddCommand(quarantineCmd)
+	quarantineCmd.AddCommand(quarantineAddCmd, quarantineRemoveCmd, quarantineListCmd)
+
+	quarantineCmd.PersistentFlags().String("file", defaultQuarantineFile, "Path to the quarantine list")
+	viper.BindPFlag("quarantine.file", quarantineCmd.PersistentFlags().Lookup("file"))
+
+	quarantineAddCmd.Flags().StringVar(&quarantineReason, "reason", "", "Why the host is quarantined (required)")
+	quarantineAddCmd.Flags().DurationVar(&quarantineExpires, "expires", 0, "Release the host automatically after this duration (e.g. 24h)")
+	quarantineAddCmd.Flags().StringVar(&quarantineBy, "by", os.Getenv("USER"), "Who quarantined the host")
+	quarantineAddCmd.MarkFlagRequired("reason")
+}
+
+// loadQuarantine loads the configured quarantine list
+func loadQuarantine() (*inventory.QuarantineList, error) {
+	filename := viper.GetString("quarantine.file")
+	if filename == "" {
+		filename = defaultQuarantineFile
+	}
+	list, err := inventory.LoadQuarantineList(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load quarantine list: %w", err)
+	}
+	return list, nil
+}
+
+func runQuarantineAdd(cmd *cobra.Command, args []string) error {
+	list, err := loadQuarantine()
+	if err != nil {
+		return err
+	}
+
+	entry, err := list.Add(args[0], quarantineReason, quarantineBy, quarantineExpires)
+	if err != nil {
+		return err
+	}
+	if err := list.Save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(console, "Quarantined %s\n", entry)
+	return nil
+}
+
+func runQuarantineRemove(cmd *cobra.Command, args []string) error {
+	list, err := loadQuarantine()
+	if err != nil {
+		return err
+	}
+
+	if err := list.Remove(args[0]); err != nil {
+		return err
+	}
+	if err := list.Save(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(console, "Released %s from quarantine\n", args[0])
+	return nil
+}
+
+func runQuarantineList(cmd *cobra.Command, args []string) error {
+	list, err := loadQuarantine()
+	if err != nil {
+		return err
+	}
+
+	entries := list.List()
+	if len(entries) == 0 {
+		fmt.Fprintln(console, "No hosts are quarantined.")
+		return nil
+	}
+
+	now := time.Now()
+	for _, entry := range entries {
+		status := "active"
+		if !entry.IsActive(now) {
+			status = "expired"
+		}
+		expires := "never"
+		if !entry.ExpiresAt.IsZero() {
+			expires = entry.ExpiresAt.Format(time.RFC3339)
+		}
+		fmt.Fprintf(console, "%-30s %-8s expires: %-25s by: %-10s reason: %s\n",
+			entry.Host, status, expires, entry.By, entry.Reason)
+	}
+
+	return nil
+}
+
+// displayQuarantined lists hosts skipped because they are quarantined
+func displayQuarantined(entries []*inventory.QuarantineEntry) {
+	if len(entries) == 0 {
+		return
+	}
+
+	fmt.Fprintf(console, "Quarantined hosts skipped (%d):\n", len(entries))
+	for _, entry := range entries {
+		fmt.Fprintf(console, "  ⊘ %s\n", entry)
+	}
+	fmt.Fprintln(console)
+}
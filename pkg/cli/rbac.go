@@ -0,0 +1,180 @@
+package cli
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/ataiva-software/forge/pkg/rbac"
+)
+
+var rbacUserRoles []string
+
+// rbacCmd represents the rbac command
+var rbacCmd = &cobra.Command{
+	Use:   "rbac",
+	Short: "Manage the users and roles kept in the controller store",
+	Long: `Manage who may do what. Users are named by their user name and hold
+roles; roles grant permissions such as approval:decide, which approvers
+of approval requests need. The default roles are admin, operator,
+approver and readonly.
+
+Until the first user is added anyone may manage users; after that only
+users holding the user:manage permission may.
+
+Examples:
+  forge rbac add-user alice --role admin
+  forge rbac add-user bob --role approver
+  forge rbac assign bob operator
+  forge rbac users`,
+}
+
+var rbacRolesCmd = &cobra.Command{
+	Use:   "roles",
+	Short: "List roles and their permissions",
+	Args:  cobra.NoArgs,
+	RunE:  runRBACRoles,
+}
+
+var rbacUsersCmd = &cobra.Command{
+	Use:   "users",
+	Short: "List users and their roles",
+	Args:  cobra.NoArgs,
+	RunE:  runRBACUsers,
+}
+
+var rbacAddUserCmd = &cobra.Command{
+	Use:   "add-user <name>",
+	Short: "Add a user",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRBACAddUser,
+}
+
+var rbacRemoveUserCmd = &cobra.Command{
+	Use:   "remove-user <name>",
+	Short: "Remove a user",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runRBACRemoveUser,
+}
+
+var rbacAssignCmd = &cobra.Command{
+	Use:   "assign <user> <role>",
+	Short: "Give a user a role",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runRBACAssign,
+}
+
+var rbacRevokeCmd = &cobra.Command{
+	Use:   "revoke <user> <role>",
+	Short: "Take a role from a user",
+	Args:  cobra.ExactArgs(2),
+	RunE:  runRBACRevoke,
+}
+
+func init() {
+	rootCmd.AddCommand(rbacCmd)
+	rbacCmd.AddCommand(rbacRolesCmd, rbacUsersCmd, rbacAddUserCmd, rbacRemoveUserCmd, rbacAssignCmd, rbacRevokeCmd)
+
+	rbacAddUserCmd.Flags().StringSliceVar(&rbacUserRoles, "role", nil, "Role to give the user, repeatable")
+}
+
+// managedRBAC returns the roles and users for a command that changes them,
+// once the current user may manage users
+func managedRBAC(cmd *cobra.Command) (*rbac.RBACManager, error) {
+	manager, err := rbacManager()
+	if err != nil {
+		return nil, err
+	}
+	if len(manager.ListUsers()) > 0 && !manager.CheckPermission(cmd.Context(), currentUser(), rbac.PermissionUserManage, "") {
+		return nil, fmt.Errorf("%s does not have the %s permission", currentUser(), rbac.PermissionUserManage)
+	}
+	return manager, nil
+}
+
+func runRBACRoles(cmd *cobra.Command, args []string) error {
+	manager, err := rbacManager()
+	if err != nil {
+		return err
+	}
+	roles := manager.ListRoles()
+	sort.Slice(roles, func(i, j int) bool { return roles[i].Name < roles[j].Name })
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tPERMISSIONS")
+	for _, role := range roles {
+		permissions := make([]string, len(role.Permissions))
+		for i, permission := range role.Permissions {
+			permissions[i] = permission.String()
+		}
+		fmt.Fprintf(w, "%s\t%s\n", role.Name, strings.Join(permissions, ", "))
+	}
+	return w.Flush()
+}
+
+func runRBACUsers(cmd *cobra.Command, args []string) error {
+	manager, err := rbacManager()
+	if err != nil {
+		return err
+	}
+	users := manager.ListUsers()
+	if len(users) == 0 {
+		fmt.Fprintln(console, "No users; add one with forge rbac add-user.")
+		return nil
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].Username < users[j].Username })
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "USER\tACTIVE\tROLES")
+	for _, user := range users {
+		fmt.Fprintf(w, "%s\t%t\t%s\n", user.Username, user.Active, strings.Join(user.Roles, ", "))
+	}
+	return w.Flush()
+}
+
+func runRBACAddUser(cmd *cobra.Command, args []string) error {
+	manager, err := managedRBAC(cmd)
+	if err != nil {
+		return err
+	}
+	if err := manager.CreateUser(&rbac.User{Username: args[0], Roles: rbacUserRoles, Active: true}); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Added %s\n", args[0])
+	return nil
+}
+
+func runRBACRemoveUser(cmd *cobra.Command, args []string) error {
+	manager, err := managedRBAC(cmd)
+	if err != nil {
+		return err
+	}
+	if err := manager.DeleteUser(args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Removed %s\n", args[0])
+	return nil
+}
+
+func runRBACAssign(cmd *cobra.Command, args []string) error {
+	manager, err := managedRBAC(cmd)
+	if err != nil {
+		return err
+	}
+	if err := manager.AssignRole(args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Gave %s the role %s\n", args[0], args[1])
+	return nil
+}
+
+func runRBACRevoke(cmd *cobra.Command, args []string) error {
+	manager, err := managedRBAC(cmd)
+	if err != nil {
+		return err
+	}
+	if err := manager.RevokeRole(args[0], args[1]); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Took the role %s from %s\n", args[1], args[0])
+	return nil
+}
@@ -20,17 +20,16 @@ var rootCmd = &cobra.Command{
 	Long: `Forge is a modern, agentless configuration management and infrastructure 
 orchestration tool written in Go. It combines the best features of Terraform's 
 plan/apply workflow, Ansible's agentless approach, and Puppet's resource model 
-into a fast, typed, and secure platform.`,
-orchestration tool written in Go. It combines the best features of Terraform's 
-plan/apply workflow, Ansible's agentless approach, and Puppet's resource model 
 into a fast, typed, and secure platform.`,
 	Version: "", // Will be set by Execute()
+	PersistentPreRunE: preRun,
 }
 
 // Execute adds all child commands to the root command and sets flags appropriately.
 // This is called by main.main(). It only needs to happen once to the rootCmd.
 func Execute(version string) error {
 	rootCmd.Version = version
+	defer closeStore()
 	return rootCmd.Execute()
 }
 
@@ -0,0 +1,222 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/server"
+)
+
+// scheduleTimeFormat is how schedule times are shown and may be given
+const scheduleTimeFormat = "2006-01-02 15:04"
+
+var (
+	scheduleKind      string
+	scheduleModule    string
+	scheduleInventory string
+	scheduleGroups    []string
+	scheduleHosts     []string
+	scheduleStart     string
+	scheduleEvery     string
+	scheduleDuration  string
+	scheduleDisabled  bool
+	calendarFrom      string
+	calendarDays      int
+)
+
+// scheduleCmd represents the schedule command
+var scheduleCmd = &cobra.Command{
+	Use:   "schedule",
+	Short: "Manage the server's scheduled operations and windows",
+	Long: `Manage what the central server runs on a schedule: drift checks (plans)
+and applies of a stored module to a stored inventory, and the maintenance
+and freeze windows around them.
+
+While a freeze window is open, applies to its inventory (or to every
+inventory, when it names none) are refused and scheduled applies are
+skipped. 'forge schedule calendar' shows the upcoming occurrences of every
+schedule and flags applies that fall in a freeze window.
+
+Schedules start at --start, an RFC 3339 time or a local "YYYY-MM-DD HH:MM",
+and repeat --every interval such as 6h or 7d.
+
+Examples:
+  forge schedule set nightly-drift --kind drift --module web --inventory prod --start "2024-06-01 02:00" --every 1d
+  forge schedule set weekly-apply --kind apply --module web --inventory prod --start "2024-06-02 03:00" --every 7d
+  forge schedule set year-end --kind freeze --start "2024-12-20 00:00" --duration 14d
+  forge schedule calendar --days 14`,
+}
+
+var scheduleListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List schedules",
+	Args:  cobra.NoArgs,
+	RunE:  runScheduleList,
+}
+
+var scheduleSetCmd = &cobra.Command{
+	Use:   "set <name>",
+	Short: "Create or replace a schedule",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runScheduleSet,
+}
+
+var scheduleDeleteCmd = &cobra.Command{
+	Use:   "delete <name>",
+	Short: "Delete a schedule",
+	Args:  cobra.ExactArgs(1),
+	RunE:  runScheduleDelete,
+}
+
+var scheduleCalendarCmd = &cobra.Command{
+	Use:   "calendar",
+	Short: "Show upcoming scheduled operations and windows",
+	Args:  cobra.NoArgs,
+	RunE:  runScheduleCalendar,
+}
+
+func init() {
+	rootCmd.AddCommand(scheduleCmd)
+	scheduleCmd.AddCommand(scheduleListCmd, scheduleSetCmd, scheduleDeleteCmd, scheduleCalendarCmd)
+
+	scheduleCmd.PersistentFlags().String("server", "http://localhost"+server.DefaultAddr, "URL of the central server")
+	viper.BindPFlag("server.url", scheduleCmd.PersistentFlags().Lookup("server"))
+
+	scheduleSetCmd.Flags().StringVar(&scheduleKind, "kind", "", "drift, apply, maintenance or freeze")
+	scheduleSetCmd.Flags().StringVar(&scheduleModule, "module", "", "Stored module to check or apply")
+	scheduleSetCmd.Flags().StringVar(&scheduleInventory, "inventory", "", "Stored inventory to run on, or the only one a window covers")
+	scheduleSetCmd.Flags().StringSliceVar(&scheduleGroups, "group", nil, "Limit runs to these inventory groups")
+	scheduleSetCmd.Flags().StringSliceVar(&scheduleHosts, "host", nil, "Limit runs to these hosts")
+	scheduleSetCmd.Flags().StringVar(&scheduleStart, "start", "", "First occurrence")
+	scheduleSetCmd.Flags().StringVar(&scheduleEvery, "every", "", "Repeat interval, such as 6h or 7d; once when empty")
+	scheduleSetCmd.Flags().StringVar(&scheduleDuration, "duration", "", "How long a window stays open")
+	scheduleSetCmd.Flags().BoolVar(&scheduleDisabled, "disabled", false, "Keep the schedule without running it")
+	scheduleSetCmd.MarkFlagRequired("kind")
+	scheduleSetCmd.MarkFlagRequired("start")
+
+	scheduleCalendarCmd.Flags().StringVar(&calendarFrom, "from", "", "Start of the calendar (default now)")
+	scheduleCalendarCmd.Flags().IntVar(&calendarDays, "days", 7, "Number of days to show")
+}
+
+// serverClient returns a client for the configured central server
+func serverClient() *server.Client {
+	return server.NewClient(viper.GetString("server.url"), viper.GetString("server.token"))
+}
+
+// parseScheduleTime parses an RFC 3339 time or a local YYYY-MM-DD HH:MM
+func parseScheduleTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation(scheduleTimeFormat, value, time.Local)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid time %q, use RFC 3339 or %q", value, scheduleTimeFormat)
+	}
+	return t, nil
+}
+
+func runScheduleList(cmd *cobra.Command, args []string) error {
+	schedules, err := serverClient().Schedules(context.Background())
+	if err != nil {
+		return err
+	}
+	if len(schedules) == 0 {
+		fmt.Fprintln(console, "No schedules.")
+		return nil
+	}
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tKIND\tMODULE\tINVENTORY\tSTART\tEVERY\tDURATION\tSTATE")
+	for _, schedule := range schedules {
+		state := "enabled"
+		if schedule.Disabled {
+			state = "disabled"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n", schedule.Name, schedule.Kind, orDash(schedule.Module),
+			orDash(schedule.Inventory), schedule.Start.Local().Format(scheduleTimeFormat), orDash(schedule.Every),
+			orDash(schedule.Duration), state)
+	}
+	return w.Flush()
+}
+
+func runScheduleSet(cmd *cobra.Command, args []string) error {
+	start, err := parseScheduleTime(scheduleStart)
+	if err != nil {
+		return fmt.Errorf("invalid --start: %w", err)
+	}
+	schedule := &server.Schedule{
+		Name:      args[0],
+		Kind:      scheduleKind,
+		Module:    scheduleModule,
+		Inventory: scheduleInventory,
+		Groups:    scheduleGroups,
+		Hosts:     scheduleHosts,
+		Start:     start,
+		Every:     scheduleEvery,
+		Duration:  scheduleDuration,
+		Disabled:  scheduleDisabled,
+	}
+	if err := schedule.Validate(); err != nil {
+		return err
+	}
+	if _, err := serverClient().PutSchedule(context.Background(), schedule); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Saved schedule %s\n", schedule.Name)
+	return nil
+}
+
+func runScheduleDelete(cmd *cobra.Command, args []string) error {
+	if err := serverClient().DeleteSchedule(context.Background(), args[0]); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Deleted schedule %s\n", args[0])
+	return nil
+}
+
+func runScheduleCalendar(cmd *cobra.Command, args []string) error {
+	from := time.Now()
+	if calendarFrom != "" {
+		var err error
+		if from, err = parseScheduleTime(calendarFrom); err != nil {
+			return fmt.Errorf("invalid --from: %w", err)
+		}
+	}
+	if calendarDays <= 0 {
+		return fmt.Errorf("--days must be positive")
+	}
+	to := from.AddDate(0, 0, calendarDays)
+
+	events, err := serverClient().Calendar(context.Background(), from, to)
+	if err != nil {
+		return err
+	}
+	if len(events) == 0 {
+		fmt.Fprintf(console, "Nothing scheduled until %s.\n", to.Local().Format(scheduleTimeFormat))
+		return nil
+	}
+
+	conflicts := 0
+	w := tabwriter.NewWriter(console, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "START\tEND\tKIND\tSCHEDULE\tMODULE\tINVENTORY\tCONFLICTS")
+	for _, event := range events {
+		end := "-"
+		if event.End != nil {
+			end = event.End.Local().Format(scheduleTimeFormat)
+		}
+		if len(event.Conflicts) > 0 {
+			conflicts++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", event.Start.Local().Format(scheduleTimeFormat), end, event.Kind,
+			event.Schedule, orDash(event.Module), orDash(event.Inventory), orDash(strings.Join(event.Conflicts, ", ")))
+	}
+	w.Flush()
+	if conflicts > 0 {
+		fmt.Fprintf(console, "\n%d scheduled apply(s) fall in a freeze window and will be skipped.\n", conflicts)
+	}
+	return nil
+}
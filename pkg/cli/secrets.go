@@ -0,0 +1,325 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/secrets"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/templating"
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+var secretsKeyID string
+
+// secretsCmd represents the secrets command
+var secretsCmd = &cobra.Command{
+	Use:   "secrets",
+	Short: "Keep secrets in an encrypted file alongside modules",
+	Long: `Keep secrets in a YAML file encrypted with a vault key, so it can be
+committed next to the modules that use them. Modules, templates and become
+passwords reference a secret as ${secret:file://<name>}, read from
+secrets.file.path (` + secrets.DefaultSecretsFile + ` by default), or as
+${secret:file://<file>#<name>} from another file.
+
+The file is a map of names to values, encrypted whole with AES-256-GCM under
+the vault key it names; see 'forge vault' for where keys are read from.
+create and edit open the decrypted file in $VISUAL or $EDITOR and encrypt it
+again when the editor exits. rekey encrypts files again with another key.`,
+}
+
+var secretsCreateCmd = &cobra.Command{
+	Use:   "create [file]",
+	Short: "Create an encrypted secrets file in an editor",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runSecretsCreate,
+}
+
+var secretsEditCmd = &cobra.Command{
+	Use:   "edit [file]",
+	Short: "Edit an encrypted secrets file in an editor",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runSecretsEdit,
+}
+
+var secretsRekeyCmd = &cobra.Command{
+	Use:   "rekey [file...]",
+	Short: "Encrypt secrets files again with another vault key",
+	RunE:  runSecretsRekey,
+}
+
+func init() {
+	rootCmd.AddCommand(secretsCmd)
+	secretsCmd.AddCommand(secretsCreateCmd, secretsEditCmd, secretsRekeyCmd)
+
+	secretsCreateCmd.Flags().StringVar(&secretsKeyID, "key-id", "", "Id of the vault key to encrypt with (default secrets.file.key_id, then default)")
+	secretsRekeyCmd.Flags().StringVar(&secretsKeyID, "key-id", "", "Id of the vault key to encrypt with (required)")
+	secretsRekeyCmd.MarkFlagRequired("key-id")
+
+	templating.SetSecretLookup(lookupSecret)
+	core.SetSecretResolver(lookupSecret)
+}
+
+// secretsFileArg returns the secrets file named on the command line, or the
+// configured one
+func secretsFileArg(args []string) string {
+	if len(args) == 1 {
+		return args[0]
+	}
+	if path := viper.GetString("secrets.file.path"); path != "" {
+		return path
+	}
+	return secrets.DefaultSecretsFile
+}
+
+func runSecretsCreate(cmd *cobra.Command, args []string) error {
+	path := secretsFileArg(args)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("secrets file %s already exists; use forge secrets edit", path)
+	}
+	keyID := secretsKeyID
+	if keyID == "" {
+		keyID = viper.GetString("secrets.file.key_id")
+	}
+	file := secrets.NewSecretsFile(path, keyID)
+	// Check the key before the secrets are typed in
+	if _, err := vaultKey(file.KeyID); err != nil {
+		return err
+	}
+
+	template := fmt.Sprintf("# Secrets as name: value, encrypted with vault key %s when saved.\n# Reference them as ${secret:file://<name>}.\n", file.KeyID)
+	values, _, err := editSecrets([]byte(template))
+	if err != nil {
+		return err
+	}
+	file.Values = values
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", filepath.Dir(path), err)
+	}
+	if err := file.Save(vault.KeyFunc(vaultKey)); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Created %s with %d secret(s), encrypted with vault key %s\n", path, len(values), file.KeyID)
+	return nil
+}
+
+func runSecretsEdit(cmd *cobra.Command, args []string) error {
+	path := secretsFileArg(args)
+	file, err := secrets.LoadSecretsFile(path, vault.KeyFunc(vaultKey))
+	if err != nil {
+		return err
+	}
+	plaintext, err := file.Plaintext()
+	if err != nil {
+		return err
+	}
+	values, changed, err := editSecrets(plaintext)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Fprintf(console, "No changes to %s\n", path)
+		return nil
+	}
+	file.Values = values
+	if err := file.Save(vault.KeyFunc(vaultKey)); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "Saved %s with %d secret(s), encrypted with vault key %s\n", path, len(values), file.KeyID)
+	return nil
+}
+
+func runSecretsRekey(cmd *cobra.Command, args []string) error {
+	if len(args) == 0 {
+		args = []string{secretsFileArg(nil)}
+	}
+	keys := vault.KeyFunc(vaultKey)
+	if _, err := keys.Key(secretsKeyID); err != nil {
+		return err
+	}
+	for _, path := range args {
+		file, err := secrets.LoadSecretsFile(path, keys)
+		if err != nil {
+			return err
+		}
+		previous := file.KeyID
+		file.KeyID = secretsKeyID
+		if err := file.Save(keys); err != nil {
+			return err
+		}
+		fmt.Fprintf(console, "Encrypted %s with vault key %s (was %s)\n", path, secretsKeyID, previous)
+	}
+	return nil
+}
+
+// editSecrets opens secrets in the user's editor, from a private temporary
+// directory removed afterwards, until they parse. It returns the secrets
+// and whether the text was changed.
+func editSecrets(plaintext []byte) (map[string]string, bool, error) {
+	dir, err := os.MkdirTemp("", "forge-secrets-")
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to create a directory to edit in: %w", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "secrets.yaml")
+	if err := os.WriteFile(path, plaintext, 0600); err != nil {
+		return nil, false, fmt.Errorf("failed to write secrets to edit: %w", err)
+	}
+
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+	}
+	for {
+		// Run the editor through the shell, as git does, so it can have
+		// arguments
+		edit := exec.Command("sh", "-c", editor+` "$1"`, "sh", path)
+		edit.Stdin, edit.Stdout, edit.Stderr = os.Stdin, os.Stdout, os.Stderr
+		if err := edit.Run(); err != nil {
+			return nil, false, fmt.Errorf("editor %s failed, nothing saved: %w", editor, err)
+		}
+		edited, err := os.ReadFile(path)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to read edited secrets: %w", err)
+		}
+		values, err := secrets.ParseSecrets(edited)
+		if err == nil {
+			return values, !bytes.Equal(edited, plaintext), nil
+		}
+		if !term.IsTerminal(int(os.Stdin.Fd())) {
+			return nil, false, fmt.Errorf("invalid secrets, nothing saved: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "Invalid secrets: %v\nEdit again? Answering no discards the changes [Y/n]: ", err)
+		var response string
+		fmt.Scanln(&response)
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(response)), "n") {
+			return nil, false, fmt.Errorf("invalid secrets, nothing saved")
+		}
+	}
+}
+
+var (
+	openSecrets   *secrets.SecretsManager
+	openSecretsMu sync.Mutex
+)
+
+// secretsManager returns a secrets manager with the providers configured
+// under the secrets key, created on first use so a Vault login is shared
+// by every lookup of the process
+func secretsManager() (*secrets.SecretsManager, error) {
+	openSecretsMu.Lock()
+	defer openSecretsMu.Unlock()
+	if openSecrets != nil {
+		return openSecrets, nil
+	}
+
+	manager := secrets.NewSecretsManager()
+	if address := viper.GetString("secrets.vault.address"); address != "" {
+		secretID := viper.GetString("secrets.vault.secret_id")
+		if file := viper.GetString("secrets.vault.secret_id_file"); file != "" && secretID == "" {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read the Vault secret_id: %w", err)
+			}
+			secretID = strings.TrimSpace(string(data))
+		}
+		provider, err := secrets.NewVaultProvider(secrets.VaultConfig{
+			Address:      address,
+			Namespace:    viper.GetString("secrets.vault.namespace"),
+			Token:        viper.GetString("secrets.vault.token"),
+			RoleID:       viper.GetString("secrets.vault.role_id"),
+			SecretID:     secretID,
+			AppRoleMount: viper.GetString("secrets.vault.approle_mount"),
+			KVVersion:    viper.GetInt("secrets.vault.kv_version"),
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err := manager.RegisterProvider(provider); err != nil {
+			return nil, err
+		}
+	}
+	if err := manager.RegisterProvider(secrets.NewFileProvider(secrets.FileConfig{
+		Path:  viper.GetString("secrets.file.path"),
+		KeyID: viper.GetString("secrets.file.key_id"),
+		Keys:  vault.KeyFunc(vaultKey),
+	})); err != nil {
+		return nil, err
+	}
+	if viper.IsSet("secrets.env") {
+		var config secrets.EnvConfig
+		if err := viper.UnmarshalKey("secrets.env", &config); err != nil {
+			return nil, fmt.Errorf("invalid secrets.env configuration: %w", err)
+		}
+		if err := manager.RegisterProvider(secrets.NewEnvProvider(config)); err != nil {
+			return nil, err
+		}
+	}
+	if viper.IsSet("secrets.aws") {
+		var config secrets.AWSConfig
+		if err := viper.UnmarshalKey("secrets.aws", &config); err != nil {
+			return nil, fmt.Errorf("invalid secrets.aws configuration: %w", err)
+		}
+		if err := manager.RegisterProvider(secrets.NewAWSSecretsProvider(config)); err != nil {
+			return nil, err
+		}
+		if err := manager.RegisterProvider(secrets.NewSSMParameterProvider(config)); err != nil {
+			return nil, err
+		}
+	}
+	openSecrets = manager
+	return manager, nil
+}
+
+// lookupSecret looks up a secret a file template reads with the secret
+// function, or a module or var file references as ${secret:...}, keeping it
+// out of the debug log
+func lookupSecret(reference string) (string, error) {
+	manager, err := secretsManager()
+	if err != nil {
+		return "", err
+	}
+	secret, err := manager.GetSecret(context.Background(), reference)
+	if err != nil {
+		return "", fmt.Errorf("failed to look up secret %s: %w", reference, err)
+	}
+	addDebugSecret(secret.Value)
+	return secret.Value, nil
+}
+
+// resolveBecomePasswords replaces ${secret:provider://path} references in
+// the connections' become passwords with the secrets they name
+func resolveBecomePasswords(ctx context.Context, connections map[string]ssh.ConnectionConfig) error {
+	var manager *secrets.SecretsManager
+	for host, config := range connections {
+		if !strings.Contains(config.BecomePassword, "${secret:") {
+			continue
+		}
+		if manager == nil {
+			var err error
+			if manager, err = secretsManager(); err != nil {
+				return err
+			}
+		}
+		resolved, err := manager.ResolveSecrets(ctx, config.BecomePassword)
+		if err != nil {
+			return fmt.Errorf("%s: become_password: %w", host, err)
+		}
+		config.BecomePassword = resolved.(string)
+		connections[host] = config
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/sudoers"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+var (
+	sudoersUser          string
+	sudoersBecomeUser    string
+	sudoersModuleFile    string
+	sudoersProviders     []string
+	sudoersInventoryFile string
+	sudoersHost          string
+)
+
+// securityCmd represents the security command
+var securityCmd = &cobra.Command{
+	Use:   "security",
+	Short: "Review and tighten the privileges forge runs with",
+}
+
+var sudoersProfileCmd = &cobra.Command{
+	Use:   "sudoers-profile",
+	Short: "Print a sudoers profile allowing the programs the providers run as root",
+	Long: `Print a sudoers snippet letting the connecting user run, as root and
+without a password, only the programs forge's providers need root for. Each
+provider gets its own Cmnd_Alias, so the profile can be reviewed and trimmed
+per provider.
+
+The profile keeps forge from running anything else as root, but it is not
+least privilege: sudoers allows the programs with any arguments, and most
+providers need programs such as tee, rm, chmod, dpkg or systemctl that can
+write any file or start any unit. A warning lists them. Treat the connecting
+user as able to become root.
+
+Hosts using the profile need become: true and become_allowlist: true in their
+connection settings. forge then runs only the listed programs through sudo,
+and everything else as the connecting user.
+
+With --module the profile covers the providers the module's resources and
+handlers use, plus the programs of its shell commands. With --host the
+programs are resolved to their paths on that host; otherwise each is allowed
+from /usr/bin, /usr/sbin, /bin and /sbin. Programs elsewhere are refused,
+since the connecting user may be able to replace them.
+
+Examples:
+  forge security sudoers-profile --user deploy > forge.sudoers
+  forge security sudoers-profile -m module.yaml -i inventory.yaml --host web1
+  visudo -cf forge.sudoers && sudo install -m 0440 forge.sudoers /etc/sudoers.d/forge`,
+	RunE: runSudoersProfile,
+}
+
+func init() {
+	rootCmd.AddCommand(securityCmd)
+	securityCmd.AddCommand(sudoersProfileCmd)
+
+	sudoersProfileCmd.Flags().StringVar(&sudoersUser, "user", "", "User forge connects as (default: the host's connection user)")
+	sudoersProfileCmd.Flags().StringVar(&sudoersBecomeUser, "become-user", "", "User the programs run as (default: the host's become_user or root)")
+	sudoersProfileCmd.Flags().StringVarP(&sudoersModuleFile, "module", "m", "", "Limit the profile to what a module uses")
+	sudoersProfileCmd.Flags().StringArrayVar(&sudoersProviders, "provider", nil, "Limit the profile to a provider (repeatable)")
+	sudoersProfileCmd.Flags().StringVarP(&sudoersInventoryFile, "inventory", "i", "", "Path to inventory file")
+	sudoersProfileCmd.Flags().StringVar(&sudoersHost, "host", "", "Inventory host to resolve program paths on")
+
+	sudoersProfileCmd.MarkFlagsRequiredTogether("inventory", "host")
+}
+
+func runSudoersProfile(cmd *cobra.Command, args []string) error {
+	registry, err := providerFactories().NewRegistry(ssh.NewMockExecutor())
+	if err != nil {
+		return err
+	}
+
+	var resources []types.Resource
+	if sudoersModuleFile != "" {
+		module, err := core.LoadModuleFromFile(sudoersModuleFile)
+		if err != nil {
+			return fmt.Errorf("failed to load module: %w", err)
+		}
+		resources = append(resources, module.Spec.Resources...)
+		for _, handler := range module.Spec.Handlers {
+			resources = append(resources, handler.Resource)
+		}
+		if resources == nil {
+			resources = []types.Resource{}
+		}
+	}
+	aliases, err := providers.PrivilegedAliases(registry, resources)
+	if err != nil {
+		return err
+	}
+	if aliases, err = selectAliases(aliases, sudoersProviders); err != nil {
+		return err
+	}
+
+	profile := sudoers.Profile{User: sudoersUser, RunAs: sudoersBecomeUser}
+	var paths func(string) []string
+	if sudoersInventoryFile != "" {
+		inv, err := loadInventory(sudoersInventoryFile)
+		if err != nil {
+			return fmt.Errorf("failed to load inventory: %w", err)
+		}
+		config, err := hostConnection(inv, sudoersHost)
+		if err != nil {
+			return err
+		}
+		if profile.User == "" {
+			profile.User = config.User
+		}
+		if profile.RunAs == "" {
+			profile.RunAs = config.BecomeUser
+		}
+		if paths, err = hostProgramPaths(context.Background(), config, aliases); err != nil {
+			return err
+		}
+	}
+	if profile.User == "" {
+		return fmt.Errorf("pick the user forge connects as: --user, or --inventory and --host")
+	}
+	profile.Aliases = aliases
+
+	rendered, err := profile.Render(paths)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console, "# Sudoers profile generated by forge security sudoers-profile.")
+	fmt.Fprintln(console, "# Use it with become: true and become_allowlist: true on the host's connection.")
+	fmt.Fprint(console, rendered)
+
+	if unsafe := profile.Unsafe(); len(unsafe) > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: the profile allows %s with any arguments, which can run any program or write any file as %s; the connecting user can use them to become %s\n",
+			strings.Join(unsafe, ", "), profileRunAs(profile), profileRunAs(profile))
+	}
+	return nil
+}
+
+// profileRunAs returns who the programs of a profile run as
+func profileRunAs(profile sudoers.Profile) string {
+	if profile.RunAs == "" {
+		return "root"
+	}
+	return profile.RunAs
+}
+
+// selectAliases keeps the aliases of the named providers, or all of them
+// when none are named
+func selectAliases(aliases []sudoers.Alias, names []string) ([]sudoers.Alias, error) {
+	if len(names) == 0 {
+		return aliases, nil
+	}
+	byName := make(map[string]sudoers.Alias, len(aliases))
+	for _, alias := range aliases {
+		byName[alias.Name] = alias
+	}
+	var selected []sudoers.Alias
+	for _, name := range names {
+		alias, ok := byName[sudoers.AliasName(name)]
+		if !ok {
+			return nil, fmt.Errorf("unknown provider %s", name)
+		}
+		selected = append(selected, alias)
+	}
+	return selected, nil
+}
+
+// hostProgramPaths connects to a host and looks up where the aliases'
+// programs are installed on it, without escalating. They are only looked
+// up in sudoers.DefaultDirs, never in directories of the connecting user's
+// PATH. Programs the host does not have, such as another distribution's
+// package manager, are dropped from the aliases.
+func hostProgramPaths(ctx context.Context, config ssh.ConnectionConfig, aliases []sudoers.Alias) (func(string) []string, error) {
+	seen := make(map[string]bool)
+	var programs []string
+	for _, alias := range aliases {
+		for _, program := range alias.Programs {
+			if !seen[program] {
+				seen[program] = true
+				programs = append(programs, program)
+			}
+		}
+	}
+	sort.Strings(programs)
+
+	connection, err := providers.DefaultDialer(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", sudoersHost, err)
+	}
+	defer connection.Close()
+	if err := connection.Connect(ctx); err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %w", sudoersHost, err)
+	}
+
+	var script strings.Builder
+	for _, program := range programs {
+		quoted := "'" + strings.ReplaceAll(program, "'", `'"'"'`) + "'"
+		fmt.Fprintf(&script, "printf '%%s %%s\\n' %s \"$(PATH=%s command -v %s)\"\n", quoted, strings.Join(sudoers.DefaultDirs, ":"), quoted)
+	}
+	result, err := connection.Execute(ctx, script.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up programs on %s: %w", sudoersHost, err)
+	}
+	found := make(map[string]string)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		program, path, ok := strings.Cut(line, " ")
+		if ok && strings.HasPrefix(path, "/") {
+			found[program] = path
+		}
+	}
+
+	for i := range aliases {
+		var present []string
+		for _, program := range aliases[i].Programs {
+			if _, ok := found[program]; ok {
+				present = append(present, program)
+			}
+		}
+		aliases[i].Programs = present
+	}
+	return func(program string) []string {
+		return []string{found[program]}
+	}, nil
+}
@@ -0,0 +1,149 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/update"
+	"gopkg.in/yaml.v3"
+)
+
+// projectFile is the project configuration that may pin the required version
+const projectFile = "chisel.yaml"
+
+var (
+	selfUpdateChannel string
+	selfUpdateVersion string
+	selfUpdateCheck   bool
+)
+
+// selfUpdateCmd represents the self-update command
+var selfUpdateCmd = &cobra.Command{
+	Use:   "self-update",
+	Short: "Update forge to the latest release",
+	Long: `Download the latest release from the configured channel (stable or beta)
+and replace the running binary. The channel manifest must carry a valid
+signature from the release signing key and every download is checked
+against the checksum in the signed manifest.
+
+Use --version to install a specific release, for example to match the
+required_version of a project.`,
+	Args: cobra.NoArgs,
+	RunE: runSelfUpdate,
+}
+
+func init() {
+	rootCmd.AddCommand(selfUpdateCmd)
+
+	selfUpdateCmd.Flags().StringVar(&selfUpdateChannel, "channel", update.ChannelStable, "Release channel to update from (stable, beta)")
+	selfUpdateCmd.Flags().StringVar(&selfUpdateVersion, "version", "", "Install this version instead of the latest")
+	selfUpdateCmd.Flags().BoolVar(&selfUpdateCheck, "check", false, "Only report whether an update is available")
+
+	viper.BindPFlag("update.channel", selfUpdateCmd.Flags().Lookup("channel"))
+}
+
+func runSelfUpdate(cmd *cobra.Command, args []string) error {
+	keyValue := viper.GetString("update.public_key")
+	if keyValue == "" {
+		keyValue = update.ReleasePublicKey
+	}
+	key, err := update.ParsePublicKey(keyValue)
+	if err != nil {
+		return fmt.Errorf("%w; set update.public_key in the config file", err)
+	}
+	updater, err := update.NewUpdater(viper.GetString("update.url"), viper.GetString("update.channel"), key)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	manifest, err := updater.Manifest(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check for updates: %w", err)
+	}
+	release, asset, err := manifest.Select(selfUpdateVersion)
+	if err != nil {
+		return err
+	}
+
+	current := cmd.Root().Version
+	if currentVersion, err := update.ParseVersion(current); err == nil && selfUpdateVersion == "" {
+		latest, _ := update.ParseVersion(release.Version)
+		if latest.Compare(currentVersion) <= 0 {
+			fmt.Fprintf(console, "forge %s is up to date on the %s channel\n", currentVersion, updater.Channel)
+			return nil
+		}
+	}
+	if selfUpdateCheck {
+		fmt.Fprintf(console, "forge %s is available on the %s channel (current: %s)\n", release.Version, updater.Channel, current)
+		return nil
+	}
+
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to locate the running binary: %w", err)
+	}
+	if resolved, err := filepath.EvalSymlinks(executable); err == nil {
+		executable = resolved
+	}
+
+	fmt.Fprintf(console, "Downloading forge %s for %s/%s...\n", release.Version, asset.OS, asset.Arch)
+	data, err := updater.Download(ctx, *asset)
+	if err != nil {
+		return err
+	}
+	if err := update.Install(executable, data); err != nil {
+		return err
+	}
+	fmt.Fprintf(console, "✅ Updated %s from %s to %s\n", executable, current, release.Version)
+	return nil
+}
+
+// checkRequiredVersion fails when the nearest chisel.yaml pins a version
+// constraint that this binary does not satisfy
+func checkRequiredVersion(cmd *cobra.Command, args []string) error {
+	// Updating is how a failed check is fixed
+	if cmd == selfUpdateCmd {
+		return nil
+	}
+
+	path, ok := findProjectFile()
+	if !ok {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	var project ProjectConfig
+	if err := yaml.Unmarshal(data, &project); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	if err := update.CheckRequired(project.Spec.RequiredVersion, cmd.Root().Version); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+// findProjectFile looks for chisel.yaml in the working directory and its parents
+func findProjectFile() (string, bool) {
+	dir, err := os.Getwd()
+	if err != nil {
+		return "", false
+	}
+	for {
+		path := filepath.Join(dir, projectFile)
+		if _, err := os.Stat(path); err == nil {
+			return path, true
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", false
+		}
+		dir = parent
+	}
+}
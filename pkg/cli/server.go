@@ -0,0 +1,181 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/notifications"
+	"github.com/ataiva-software/forge/pkg/secrets"
+	"github.com/ataiva-software/forge/pkg/server"
+	"github.com/ataiva-software/forge/pkg/webhook"
+)
+
+// serverCmd represents the server command
+var serverCmd = &cobra.Command{
+	Use:   "server",
+	Short: "Run the central server with its REST API and dashboard",
+	Long: `Run forge as a control plane. The server stores modules and inventories,
+keeps a registry of nodes, and plans or applies stored modules to the hosts
+of stored inventories on request, one run at a time. Nodes, documents and
+the history of runs are kept in the controller store (--store) and survive
+restarts.
+
+Agents report to the server by pointing --report-url at /api/v1/reports.
+When server.token is configured, every API request must send it as a
+bearer token. Without a token the server only listens on a loopback
+address. Requests that change something must be sent as application/json,
+or application/yaml for modules and inventories.
+
+Examples:
+  forge server
+  curl -X PUT -H 'Content-Type: application/yaml' --data-binary @module.yaml http://localhost:8080/api/v1/modules/web
+  curl -X POST -H 'Content-Type: application/json' http://localhost:8080/api/v1/runs \
+    -d '{"action": "plan", "module": "web", "inventory": "prod", "groups": ["web"]}'`,
+	Args: cobra.NoArgs,
+	RunE: runServer,
+}
+
+func init() {
+	rootCmd.AddCommand(serverCmd)
+
+	serverCmd.Flags().String("addr", server.DefaultAddr, "Address to listen on")
+	serverCmd.Flags().String("dir", server.DefaultDir, "Directory of state kept as files by earlier versions, imported into the store")
+
+	viper.BindPFlag("server.addr", serverCmd.Flags().Lookup("addr"))
+	viper.BindPFlag("server.dir", serverCmd.Flags().Lookup("dir"))
+}
+
+func runServer(cmd *cobra.Command, args []string) error {
+	version := cmd.Root().Version
+	kv, err := controllerStore()
+	if err != nil {
+		return err
+	}
+	config := server.Config{
+		Addr:    viper.GetString("server.addr"),
+		Store:   kv,
+		Dir:     viper.GetString("server.dir"),
+		Token:   viper.GetString("server.token"),
+		Version: version,
+	}
+	// Runs send their own lifecycle webhooks; drift.detected goes out once
+	// the server has seen which hosts a run left drifted
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	if webhooks != nil {
+		config.DriftChannels = append(config.DriftChannels, webhook.NewDriftChannel(webhooks))
+	}
+	// Runs record into the health history the dashboard serves
+	if config.Health, err = loadHealth(); err != nil {
+		return err
+	}
+	serverHealth = config.Health
+	// Alerts are emailed as they open
+	if config.Notifications, err = loadNotifications(); err != nil {
+		return err
+	}
+
+	// Runs are unattended; the server carries out one at a time, so the
+	// apply settings can be switched per run. Plan runs are recorded, as
+	// they are what watch and alerts read drift from.
+	applyAutoApprove = true
+	recordChecks = true
+	run := func(ctx context.Context, job server.Job) error {
+		applyDryRun = job.Run.Action == server.ActionPlan
+		applyApproval = job.Run.Approval
+		if err := applyConfigDefaults(job.Module); err != nil {
+			return err
+		}
+		if err := job.Module.ResolveVars(nil); err != nil {
+			return fmt.Errorf("failed to resolve module variables: %w", err)
+		}
+		fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+			ControllerVersion: version,
+			PolicyFiles:       viper.GetStringSlice("policy.paths"),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to fingerprint execution: %w", err)
+		}
+		fingerprint.ModuleHash = audit.HashBytes(job.ModuleData)
+		fingerprint.InventoryHash = audit.HashBytes(job.InventoryData)
+		webhooks, err := loadWebhooks()
+		if err != nil {
+			return err
+		}
+		return runApplyHosts(ctx, job.Module, job.Inventory, fingerprint, webhooks, nil, nil)
+	}
+
+	logger := log.New(os.Stderr, "server: ", log.LstdFlags)
+	srv, err := server.NewServer(config, run, logger)
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	logger.Printf("listening on %s, keeping state in %s", config.Addr, storeDescription())
+	return srv.ListenAndServe(ctx)
+}
+
+// emailChannelConfig configures one of the notifications.email channels
+type emailChannelConfig struct {
+	Name string `mapstructure:"name"`
+	// Levels limits the channel to alerts of these levels
+	Levels                       []notifications.NotificationLevel `mapstructure:"levels"`
+	notifications.EmailAPIConfig `mapstructure:",squash"`
+}
+
+// loadNotifications builds the email channels of notifications.email, or
+// returns nil when there are none
+func loadNotifications() (*notifications.NotificationManager, error) {
+	var channels []emailChannelConfig
+	if err := viper.UnmarshalKey("notifications.email", &channels); err != nil {
+		return nil, fmt.Errorf("invalid notifications configuration: %w", err)
+	}
+	if len(channels) == 0 {
+		return nil, nil
+	}
+
+	manager := notifications.NewNotificationManager(nil)
+	var keys *secrets.SecretsManager
+	for i, channel := range channels {
+		if channel.Name == "" {
+			channel.Name = fmt.Sprintf("email-%d", i+1)
+		}
+		for _, level := range channel.Levels {
+			switch level {
+			case notifications.LevelInfo, notifications.LevelWarning, notifications.LevelError, notifications.LevelCritical:
+			default:
+				return nil, fmt.Errorf("invalid notifications configuration: email channel %s: unknown level '%s', must be one of: info, warning, error, critical", channel.Name, level)
+			}
+		}
+		if channel.APIKeySecret != "" && keys == nil {
+			var err error
+			if keys, err = secretsManager(); err != nil {
+				return nil, err
+			}
+		}
+		addDebugSecret(channel.APIKey)
+		email, err := notifications.NewEmailAPIChannel(channel.Name, channel.EmailAPIConfig, keys)
+		if err != nil {
+			return nil, fmt.Errorf("invalid notifications configuration: %w", err)
+		}
+		if err := manager.AddChannel(email); err != nil {
+			return nil, err
+		}
+		if err := manager.AddRule(notifications.NotificationRule{Name: channel.Name, Enabled: true, Channels: []string{channel.Name}, Levels: channel.Levels}); err != nil {
+			return nil, err
+		}
+	}
+	return manager, nil
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/history"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/snapshot"
+)
+
+// snapshotConfig returns the snapshot configuration of a host's group and the
+// risk score above which it is snapshotted; nil if the group takes none
+func snapshotConfig(inv *inventory.Inventory, group string) (*snapshot.Config, int) {
+	config := inv.Targets[group].Snapshot
+	if config == nil {
+		return nil, 0
+	}
+	if threshold := viper.GetInt("snapshots.threshold"); threshold > 0 {
+		return config, threshold
+	}
+	return config, config.RiskThreshold()
+}
+
+// displayRisk notes when a host's plan is risky enough to be snapshotted
+func displayRisk(inv *inventory.Inventory, group string, score int) {
+	if config, threshold := snapshotConfig(inv, group); config != nil && score > threshold {
+		fmt.Fprintf(console, "Risk score %d exceeds %d: the VM will be snapshotted with %s before applying\n\n", score, threshold, config.Provider)
+	}
+}
+
+// snapshotHosts snapshots every host whose plan risk score exceeds its
+// group's threshold, in parallel, and records the snapshots with the
+// execution. Nothing is applied if any snapshot fails.
+func snapshotHosts(ctx context.Context, inv *inventory.Inventory, groups map[string]string, hosts []string, sessions map[string]*hostSession, execution *history.Execution) error {
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		taken  []snapshot.Snapshot
+		failed []error
+	)
+	for _, host := range hosts {
+		config, threshold := snapshotConfig(inv, groups[host])
+		if config == nil || sessions[host].plan.RiskScore() <= threshold {
+			continue
+		}
+
+		wg.Add(1)
+		go func(host string, config *snapshot.Config) {
+			defer wg.Done()
+			result, err := snapshot.Take(ctx, config, host, "forge-"+execution.ID)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = append(failed, err)
+				return
+			}
+			taken = append(taken, *result)
+		}(host, config)
+	}
+	wg.Wait()
+
+	sort.Slice(taken, func(i, j int) bool { return taken[i].Host < taken[j].Host })
+	if len(taken) > 0 {
+		fmt.Fprintln(console, "\nSnapshots taken before applying:")
+	}
+	for _, result := range taken {
+		execution.AddSnapshot(result)
+		fmt.Fprintf(console, "  %s: %s snapshot %s of %s\n", result.Host, result.Provider, result.ID, result.VM)
+	}
+
+	if len(failed) > 0 {
+		for _, err := range failed {
+			fmt.Fprintf(console, "✗ %v\n", err)
+		}
+		return fmt.Errorf("%d snapshot(s) failed, no changes were applied", len(failed))
+	}
+	return nil
+}
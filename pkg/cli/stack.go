@@ -0,0 +1,126 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/gitsource"
+	"github.com/ataiva-software/forge/pkg/hooks"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/report"
+	"github.com/ataiva-software/forge/pkg/webhook"
+)
+
+var applyStackFile string
+
+// runApplyStack applies the modules of a stack to the inventory one after
+// another. The modules share one pool of connections and the facts gathered
+// through it, so hosts are connected to once for the whole stack, within
+// the connection limits, and disconnected from when the last module is done.
+func runApplyStack(cmd *cobra.Command, args []string) error {
+	if len(args) > 0 || applyModuleFile != "" || applyBundleFile != "" || applyLocal || applyApproval != "" ||
+		len(applyTargets) > 0 || len(applyExcludes) > 0 || len(applyVars) > 0 || len(applyVarFiles) > 0 {
+		return fmt.Errorf("a stack sets the modules and their variables; a plan file, --module, --bundle, --local, --approval, --var, --var-file, --target and --exclude cannot be given with --stack")
+	}
+	if applyOutputFormat != report.FormatText {
+		return fmt.Errorf("--output %s reports a single module and cannot be given with --stack", applyOutputFormat)
+	}
+	if applyInventoryFile == "" {
+		return fmt.Errorf("--inventory is required with --stack")
+	}
+
+	stack, err := core.LoadStackFromFile(applyStackFile)
+	if err != nil {
+		return err
+	}
+	inv, err := loadInventory(applyInventoryFile)
+	if err != nil {
+		return fmt.Errorf("failed to load inventory: %w", err)
+	}
+	webhooks, err := loadWebhooks()
+	if err != nil {
+		return err
+	}
+	hookRunner, err := loadHooks()
+	if err != nil {
+		return err
+	}
+
+	shared, err := newHostPool()
+	if err != nil {
+		return err
+	}
+	defer shared.close()
+	defer func() { displayConnections(shared.connections.Metrics()) }()
+
+	ctx := context.Background()
+	for i, entry := range stack.Spec.Modules {
+		// Reads are cached per module, as the modules before may have
+		// changed what the next one reads
+		if i > 0 {
+			shared.targets.ForgetStates()
+		}
+		fmt.Fprintf(console, "\n==> Module %d/%d of stack %s: %s\n", i+1, len(stack.Spec.Modules), stack.Metadata.Name, entry.Source)
+		if err := applyStackModule(ctx, cmd, entry, stackModuleSource(applyStackFile, entry.Source), inv, webhooks, hookRunner, shared); err != nil {
+			return fmt.Errorf("stack %s stopped at %s: %w", stack.Metadata.Name, entry.Source, err)
+		}
+	}
+	return nil
+}
+
+// stackModuleSource resolves the source of a stack's module relative to the
+// stack file; git addresses and absolute paths are used as they are
+func stackModuleSource(stackFile, source string) string {
+	if gitsource.IsAddress(source) || filepath.IsAbs(source) {
+		return source
+	}
+	return filepath.Join(filepath.Dir(stackFile), source)
+}
+
+// applyStackModule applies one module of a stack over the shared host pool
+func applyStackModule(ctx context.Context, cmd *cobra.Command, entry core.StackModule, source string, inv *inventory.Inventory, webhooks *webhook.Dispatcher, hookRunner *hooks.Runner, shared *hostPool) (err error) {
+	location, err := locateModule(ctx, source)
+	if err != nil {
+		return err
+	}
+	module, err := core.LoadModuleFromFile(location.File)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	if err := module.ResolveVars(entry.Vars); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+
+	fingerprint, err := audit.NewFingerprint(audit.FingerprintOptions{
+		ControllerVersion: cmd.Root().Version,
+		ModuleFile:        location.File,
+		ModuleSource:      location.Source,
+		ModuleRevision:    location.Revision,
+		InventoryFile:     applyInventoryFile,
+		PolicyFiles:       viper.GetStringSlice("policy.paths"),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to fingerprint execution: %w", err)
+	}
+
+	projectHooks, err := startHooks(ctx, hookRunner, module, hooks.Run{
+		Command:     "apply",
+		Fingerprint: fingerprint.ID(),
+		Inventory:   applyInventoryFile,
+		DryRun:      applyDryRun,
+	})
+	if err != nil {
+		return err
+	}
+	defer func() { projectHooks.finish(ctx, err) }()
+
+	return runApplyHosts(ctx, module, inv, fingerprint, webhooks, nil, shared)
+}
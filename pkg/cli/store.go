@@ -0,0 +1,117 @@
+package cli
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/history"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+var (
+	openStore   store.Store
+	openStoreMu sync.Mutex
+)
+
+// storeCmd represents the store command
+var storeCmd = &cobra.Command{
+	Use:   "store",
+	Short: "Maintain the controller store",
+}
+
+var storeRekeyCmd = &cobra.Command{
+	Use:   "rekey",
+	Short: "Encrypt the stored executions and reports with the current key",
+	Long: `Encrypt every stored execution, drift report and run again with the
+vault key named by encryption.key_id. Run it after pointing
+encryption.key_id at a new key, keeping the old key available until it
+finishes, or after turning encryption on to encrypt what was stored before.`,
+	Args: cobra.NoArgs,
+	RunE: runStoreRekey,
+}
+
+func init() {
+	rootCmd.AddCommand(storeCmd)
+	storeCmd.AddCommand(storeRekeyCmd)
+
+	rootCmd.PersistentFlags().String("store", store.DefaultURL, "controller store: a bbolt file, or a postgres:// or s3:// URL to share it between controllers")
+	viper.BindPFlag("store.url", rootCmd.PersistentFlags().Lookup("store"))
+}
+
+// atRestSealer seals saved plans and stored executions and reports with the
+// vault key encryption.key_id; without one they are stored as they are, but
+// encrypted ones are still read
+func atRestSealer() *vault.Sealer {
+	return vault.NewSealer(vault.KeyFunc(vaultKey), viper.GetString("encryption.key_id"))
+}
+
+// sealedBuckets returns the store buckets encrypted at rest
+func sealedBuckets() []string {
+	if viper.IsSet("encryption.buckets") {
+		return viper.GetStringSlice("encryption.buckets")
+	}
+	return store.DefaultSealedBuckets
+}
+
+// controllerStore returns the configured store, opening and migrating it
+// on first use; a bbolt file can only be open once, so every command and
+// server in the process shares it
+func controllerStore() (store.Store, error) {
+	openStoreMu.Lock()
+	defer openStoreMu.Unlock()
+	if openStore != nil {
+		return openStore, nil
+	}
+
+	opened, err := store.Open(viper.GetString("store.url"))
+	if err != nil {
+		return nil, err
+	}
+	kv := store.NewSealed(opened, atRestSealer(), sealedBuckets())
+	if _, err := store.Migrate(kv, "executions", history.Migrations(viper.GetString("executions.dir"))); err != nil {
+		kv.Close()
+		return nil, err
+	}
+	openStore = kv
+	return kv, nil
+}
+
+func runStoreRekey(cmd *cobra.Command, args []string) error {
+	if atRestSealer().KeyID() == "" {
+		return fmt.Errorf("set encryption.key_id to the vault key to encrypt the store with")
+	}
+	kv, err := controllerStore()
+	if err != nil {
+		return err
+	}
+
+	count, err := kv.(*store.Sealed).Rekey()
+	if err != nil {
+		return fmt.Errorf("failed to rekey the store after %d value(s): %w", count, err)
+	}
+	fmt.Fprintf(console, "Encrypted %d value(s) in %s with vault key %s\n", count, storeDescription(), atRestSealer().KeyID())
+	return nil
+}
+
+// closeStore releases the store once the command is done
+func closeStore() {
+	openStoreMu.Lock()
+	defer openStoreMu.Unlock()
+	if openStore != nil {
+		openStore.Close()
+		openStore = nil
+	}
+}
+
+// storeDescription names the configured store without its password
+func storeDescription() string {
+	raw := viper.GetString("store.url")
+	if u, err := url.Parse(raw); err == nil && u.User != nil {
+		return u.Redacted()
+	}
+	return raw
+}
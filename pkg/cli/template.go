@@ -0,0 +1,382 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+	"gopkg.in/yaml.v3"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/textdiff"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+var (
+	templateModuleFile    string
+	templateInventoryFile string
+	templateLocal         bool
+	templateHost          string
+	templateResource      string
+	templateVars          []string
+	templateVarFiles      []string
+	templateContext       int
+	templateTarget        string
+	templateFactsFile     string
+	templateOutputDir     string
+)
+
+// templateCmd represents the template command
+var templateCmd = &cobra.Command{
+	Use:   "template",
+	Short: "Work with file templates",
+}
+
+var templateDiffCmd = &cobra.Command{
+	Use:   "diff",
+	Short: "Show how a rendered file differs from the copy on a host",
+	Long: `Render a file resource's template, template_file or content the way apply
+would for a host, read the file it would replace on that host and print a
+unified diff of the two. Nothing is planned or changed, so it is a quick way
+to check a template edit against a live file.
+
+The host is picked from the inventory with --host, or is the machine forge
+runs on with --local. Module variables, --var and --var-file are applied as
+for plan and apply.
+
+Examples:
+  forge template diff -m module.yaml -i inventory.yaml --host web1 --resource file.app-config
+  forge template diff -m module.yaml --local --resource file.motd --var env=staging`,
+	RunE: runTemplateDiff,
+}
+
+var templateRenderCmd = &cobra.Command{
+	Use:   "render",
+	Short: "Render a module's file templates for a host without connecting to it",
+	Long: `Render the template, template_file and content of every file resource of a
+module the way apply would for a host, and print them for review. Nothing
+is read from or changed on the host.
+
+Templates see the facts last gathered from the host, however old, or those
+of --facts-file, a YAML file in the format of the facts cache. Resources
+whose when condition is false for those facts are left out. Module
+variables, --var and --var-file are applied as for plan and apply.
+
+With --output-dir each file is written under the directory at its path on
+the host instead, ready for a recursive diff or review.
+
+Examples:
+  forge template render -m module.yaml -i inventory.yaml --target web1
+  forge template render -m module.yaml --target web1 --facts-file web1.yaml --output-dir rendered/
+  forge template render -m module.yaml --target localhost --resource file.motd --var env=staging`,
+	RunE: runTemplateRender,
+}
+
+func init() {
+	rootCmd.AddCommand(templateCmd)
+	templateCmd.AddCommand(templateDiffCmd)
+
+	templateDiffCmd.Flags().StringVarP(&templateModuleFile, "module", "m", "", "Path to module file, or git::<repository>//<path>?ref=<ref> (required)")
+	templateDiffCmd.Flags().StringVarP(&templateInventoryFile, "inventory", "i", "", "Path to inventory file")
+	templateDiffCmd.Flags().BoolVar(&templateLocal, "local", false, "Compare with the machine forge runs on, without SSH")
+	templateDiffCmd.Flags().StringVar(&templateHost, "host", "", "Inventory host to compare with")
+	templateDiffCmd.Flags().StringVar(&templateResource, "resource", "", "File resource to render, as file.<name> (required)")
+	templateDiffCmd.Flags().StringArrayVar(&templateVars, "var", nil, "Set a module variable, as key=value (repeatable)")
+	templateDiffCmd.Flags().StringArrayVar(&templateVarFiles, "var-file", nil, "Set module variables from a YAML file (repeatable)")
+	templateDiffCmd.Flags().IntVar(&templateContext, "context", textdiff.DefaultContext, "Unchanged lines shown around each change")
+
+	templateDiffCmd.MarkFlagsMutuallyExclusive("inventory", "local")
+	templateDiffCmd.MarkFlagsMutuallyExclusive("host", "local")
+	templateDiffCmd.MarkFlagsRequiredTogether("inventory", "host")
+	templateDiffCmd.MarkFlagRequired("module")
+	templateDiffCmd.MarkFlagRequired("resource")
+
+	templateCmd.AddCommand(templateRenderCmd)
+	templateRenderCmd.Flags().StringVarP(&templateModuleFile, "module", "m", "", "Path to module file, or git::<repository>//<path>?ref=<ref> (required)")
+	templateRenderCmd.Flags().StringVarP(&templateInventoryFile, "inventory", "i", "", "Path to inventory file the target is looked up in")
+	templateRenderCmd.Flags().StringVar(&templateTarget, "target", "", "Host to render for (required)")
+	templateRenderCmd.Flags().StringVar(&templateResource, "resource", "", "Only render this file resource, as file.<name>")
+	templateRenderCmd.Flags().StringVar(&templateFactsFile, "facts-file", "", "Render with the facts in this YAML file instead of cached ones")
+	templateRenderCmd.Flags().StringVar(&templateOutputDir, "output-dir", "", "Write the rendered files under this directory instead of printing them")
+	templateRenderCmd.Flags().StringArrayVar(&templateVars, "var", nil, "Set a module variable, as key=value (repeatable)")
+	templateRenderCmd.Flags().StringArrayVar(&templateVarFiles, "var-file", nil, "Set module variables from a YAML file (repeatable)")
+
+	templateRenderCmd.MarkFlagRequired("module")
+	templateRenderCmd.MarkFlagRequired("target")
+}
+
+func runTemplateDiff(cmd *cobra.Command, args []string) error {
+	if templateInventoryFile == "" && !templateLocal {
+		return fmt.Errorf("pick the host to compare with: --inventory and --host, or --local")
+	}
+
+	location, err := locateModule(context.Background(), templateModuleFile)
+	if err != nil {
+		return err
+	}
+	module, err := core.LoadModuleFromFile(location.File)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	overrides, err := varOverrides(templateVars, templateVarFiles)
+	if err != nil {
+		return err
+	}
+	if err := module.ResolveVars(overrides); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	resource, err := findFileResource(module, templateResource)
+	if err != nil {
+		return err
+	}
+
+	inv := inventory.Local()
+	host := localHost
+	if templateInventoryFile != "" {
+		if inv, err = loadInventory(templateInventoryFile); err != nil {
+			return fmt.Errorf("failed to load inventory: %w", err)
+		}
+		host = templateHost
+	}
+	config, err := hostConnection(inv, host)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	resolved := map[string]ssh.ConnectionConfig{host: config}
+	if err := resolveBecomePasswords(ctx, resolved); err != nil {
+		return err
+	}
+	config = resolved[host]
+	connPool, err := connectionPool()
+	if err != nil {
+		return err
+	}
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		ssh.SetPassphrasePrompt(promptPassphrase)
+	}
+	pool := providers.NewTargetPool(providerFactories(), providers.PooledDialer(connPool))
+	pool.SetDebugLogger(debugLogger)
+	pool.SetFactsCache(factsCache())
+	defer pool.CloseAll()
+
+	target, err := pool.Get(ctx, config)
+	if err != nil {
+		return fmt.Errorf("failed to connect to %s: %w", host, err)
+	}
+	if requires := module.Spec.Requires; requires != nil {
+		if unmet := requires.Check(target.System); len(unmet) > 0 {
+			return fmt.Errorf("%s is incompatible with the module: %s", host, describeIncompatible(unmet))
+		}
+	}
+	// Templates see the host's facts and secrets as they do in plan and apply
+	rendered, err := core.WithSecrets(core.WithFacts(*resource, target.System))
+	if err != nil {
+		return fmt.Errorf("%s: %w", resource.ResourceID(), err)
+	}
+	preview, err := providers.PreviewFile(ctx, target.Connection, &rendered)
+	if err != nil {
+		return err
+	}
+
+	from, to := host+":"+preview.Path, resource.ResourceID()
+	if !preview.Exists {
+		from = "/dev/null"
+	}
+	if resource.State == types.StateAbsent {
+		to = "/dev/null"
+	}
+	diff := textdiff.Unified(from, to, preview.Current, preview.Desired, templateContext)
+	if diff == "" && preview.Exists == (resource.State != types.StateAbsent) {
+		fmt.Fprintf(console, "No changes: %s on %s matches %s\n", preview.Path, host, resource.ResourceID())
+		return nil
+	}
+	if diff == "" {
+		// An empty file that is to be created or removed
+		diff = fmt.Sprintf("--- %s\n+++ %s\n", from, to)
+	}
+	// Secrets the template looked up are not shown, on either side
+	fmt.Fprint(console, outputRedactor.Redact(diff))
+	return nil
+}
+
+func runTemplateRender(cmd *cobra.Command, args []string) error {
+	location, err := locateModule(context.Background(), templateModuleFile)
+	if err != nil {
+		return err
+	}
+	module, err := core.LoadModuleFromFile(location.File)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := applyConfigDefaults(module); err != nil {
+		return err
+	}
+	overrides, err := varOverrides(templateVars, templateVarFiles)
+	if err != nil {
+		return err
+	}
+	if err := module.ResolveVars(overrides); err != nil {
+		return fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	if templateResource != "" {
+		if _, err := findFileResource(module, templateResource); err != nil {
+			return err
+		}
+	}
+
+	// Facts are cached under the address forge connects to
+	address := templateTarget
+	if templateInventoryFile != "" {
+		inv, err := loadInventory(templateInventoryFile)
+		if err != nil {
+			return fmt.Errorf("failed to load inventory: %w", err)
+		}
+		config, err := hostConnection(inv, templateTarget)
+		if err != nil {
+			return err
+		}
+		address = config.Host
+	}
+	system, err := renderFacts(address)
+	if err != nil {
+		return err
+	}
+
+	resources, skipped, err := module.ForTarget(system)
+	if err != nil {
+		return err
+	}
+	rendered := 0
+	for i := range resources {
+		resource := &resources[i]
+		if resource.Type != "file" || resource.State == types.StateAbsent {
+			continue
+		}
+		if templateResource != "" && resource.ResourceID() != templateResource {
+			continue
+		}
+		if _, hasSource := resource.Properties["source"]; hasSource {
+			if templateResource != "" {
+				return fmt.Errorf("resource %s copies a source artifact; only template, template_file and content can be rendered", templateResource)
+			}
+			continue
+		}
+		withSecrets, err := core.WithSecrets(*resource)
+		if err != nil {
+			return fmt.Errorf("%s: %w", resource.ResourceID(), err)
+		}
+		content, err := providers.RenderFile(&withSecrets)
+		if err != nil {
+			return err
+		}
+		path, _ := resource.Properties["path"].(string)
+		if templateOutputDir != "" {
+			if err := writeRendered(templateOutputDir, path, content); err != nil {
+				return err
+			}
+			fmt.Fprintf(console, "%s -> %s\n", resource.ResourceID(), filepath.Join(templateOutputDir, path))
+		} else {
+			fmt.Fprintf(console, "==> %s: %s <==\n", resource.ResourceID(), path)
+			fmt.Fprint(console, content)
+			if content != "" && !strings.HasSuffix(content, "\n") {
+				fmt.Fprintln(console)
+			}
+			fmt.Fprintln(console)
+		}
+		rendered++
+	}
+
+	for _, id := range skipped {
+		if templateResource == "" || id == templateResource {
+			fmt.Fprintf(os.Stderr, "Skipped %s: its when condition is false on %s\n", id, templateTarget)
+		}
+	}
+	if rendered == 0 && (templateResource == "" || len(skipped) == 0) {
+		fmt.Fprintf(os.Stderr, "Module %s has no files to render for %s\n", module.Metadata.Name, templateTarget)
+	}
+	return nil
+}
+
+// renderFacts returns the facts of --facts-file, or those last gathered
+// from a host. Without either, templates see empty facts and every when
+// condition is taken to hold.
+func renderFacts(host string) (*facts.Facts, error) {
+	if templateFactsFile != "" {
+		data, err := os.ReadFile(templateFactsFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read facts: %w", err)
+		}
+		var system facts.Facts
+		if err := yaml.Unmarshal(data, &system); err != nil {
+			return nil, fmt.Errorf("failed to parse facts file %s: %w", templateFactsFile, err)
+		}
+		if system.Host == "" {
+			system.Host = host
+		}
+		return &system, nil
+	}
+	if system, ok := factsCache().Last(host); ok {
+		fmt.Fprintf(os.Stderr, "Using the facts gathered from %s at %s\n", templateTarget, system.GatheredAt.Local().Format("2006-01-02 15:04:05 MST"))
+		return system, nil
+	}
+	fmt.Fprintf(os.Stderr, "Warning: no facts of %s are cached, so .facts is empty and when conditions are not evaluated; run forge facts for it once or pass --facts-file\n", templateTarget)
+	return nil, nil
+}
+
+// writeRendered writes a rendered file under dir at its path on the host.
+// Paths that climb out of dir, such as /etc/../../x, are refused.
+func writeRendered(dir, path, content string) error {
+	target := filepath.Join(dir, filepath.FromSlash(path))
+	if rel, err := filepath.Rel(dir, target); err != nil || !filepath.IsLocal(rel) {
+		return fmt.Errorf("path %s of a rendered file escapes %s", path, dir)
+	}
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", path, err)
+	}
+	if err := os.WriteFile(target, []byte(content), 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", target, err)
+	}
+	return nil
+}
+
+// findFileResource returns the file resource with the given id
+func findFileResource(module *core.Module, id string) (*types.Resource, error) {
+	for i := range module.Spec.Resources {
+		resource := &module.Spec.Resources[i]
+		if resource.ResourceID() != id {
+			continue
+		}
+		if resource.Type != "file" {
+			return nil, fmt.Errorf("resource %s is not a file resource", id)
+		}
+		return resource, nil
+	}
+	return nil, fmt.Errorf("resource %s not found in module %s", id, module.Metadata.Name)
+}
+
+// hostConnection returns the connection settings of an inventory host
+func hostConnection(inv *inventory.Inventory, name string) (ssh.ConnectionConfig, error) {
+	hosts, conflicts, err := inv.Resolve()
+	displayConflicts(conflicts)
+	if err != nil {
+		return ssh.ConnectionConfig{}, err
+	}
+	for _, host := range hosts {
+		if host.Name == name {
+			return withHostKeySettings(host.Connection), nil
+		}
+	}
+	return ssh.ConnectionConfig{}, fmt.Errorf("host %s not found in the inventory", name)
+}
@@ -0,0 +1,109 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/topology"
+)
+
+// topologyMode returns policy.topology: warn unless configured otherwise.
+// Rollouts are only seen by other forge processes through a shared store; a
+// bbolt file is held by the process applying, so with one there is nothing
+// to check and the mode is off, and block is refused.
+func topologyMode() (string, error) {
+	mode := viper.GetString("policy.topology")
+	if mode == "" {
+		mode = topology.ModeWarn
+	}
+	if err := topology.ValidateMode(mode); err != nil {
+		return "", fmt.Errorf("policy.topology: %w", err)
+	}
+	if !store.Shared(viper.GetString("store.url")) {
+		if mode == topology.ModeBlock {
+			return "", fmt.Errorf("policy.topology: block needs a postgres:// or s3:// store shared by every forge process, not %s", storeDescription())
+		}
+		return topology.ModeOff, nil
+	}
+	return mode, nil
+}
+
+// checkTopology warns about modules depending on the module that are
+// rolling out while it is about to change. With policy.topology set to
+// block an apply is refused instead; plans and dry runs only warn.
+func checkTopology(module *core.Module, applying bool) error {
+	mode, err := topologyMode()
+	if err != nil || mode == topology.ModeOff {
+		return err
+	}
+	// Without the store there is nothing to check against, which only a
+	// blocking policy must not let through; it is not a conflict
+	unchecked := func(reason string, err error) error {
+		if mode == topology.ModeBlock && applying {
+			return fmt.Errorf("cannot check the rollouts of modules depending on %s, %s: %w", module.Metadata.Name, reason, err)
+		}
+		fmt.Fprintf(warnings(), "Warning: cannot check the rollouts of modules depending on %s, %s: %v\n", module.Metadata.Name, reason, err)
+		return nil
+	}
+	kv, err := controllerStore()
+	if err != nil {
+		return unchecked("the controller store could not be opened", err)
+	}
+	conflicts, err := topology.NewTracker(kv).Conflicts(module.Metadata.Name)
+	if err != nil {
+		return unchecked("the rollouts could not be read", err)
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+
+	fmt.Fprintf(warnings(), "\nWarning: %d module(s) depending on %s are rolling out:\n", len(conflicts), module.Metadata.Name)
+	for _, conflict := range conflicts {
+		fmt.Fprintf(warnings(), "  ⚠ %s\n", conflict)
+	}
+	if mode != topology.ModeBlock {
+		fmt.Fprintln(warnings())
+		return nil
+	}
+	if !applying {
+		fmt.Fprintln(warnings(), "  Applying is blocked until they finish (policy.topology: block)")
+		fmt.Fprintln(warnings())
+		return nil
+	}
+	return fmt.Errorf("refusing to change %s while %d module(s) depending on it are rolling out (policy.topology: block)", module.Metadata.Name, len(conflicts))
+}
+
+// startRollout records that the module is rolling out to hosts, so applies
+// of the modules it depends on can warn about it. The returned function
+// records that the rollout finished. Failing to record it only warns.
+func startRollout(module *core.Module, id string, hosts []string) func() {
+	done := func() {}
+	mode, err := topologyMode()
+	if err != nil || mode == topology.ModeOff {
+		return done
+	}
+	kv, err := controllerStore()
+	if err != nil {
+		fmt.Fprintf(warnings(), "Warning: failed to record rollout: %v\n", err)
+		return done
+	}
+	tracker := topology.NewTracker(kv)
+	rollout, err := tracker.Start(topology.Rollout{
+		ID:          id,
+		Module:      module.Metadata.Name,
+		DependsOn:   module.Metadata.DependsOn,
+		Hosts:       hosts,
+		TriggeredBy: triggeredBy(),
+	})
+	if err != nil {
+		fmt.Fprintf(warnings(), "Warning: %v\n", err)
+		return done
+	}
+	return func() {
+		if err := tracker.Finish(rollout.ID); err != nil {
+			fmt.Fprintf(warnings(), "Warning: %v\n", err)
+		}
+	}
+}
@@ -0,0 +1,257 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/secrets"
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+// defaultVaultKeyFile is where the project's default key is kept
+const defaultVaultKeyFile = ".chisel/vault.key"
+
+var (
+	vaultKeyID   string
+	vaultKeyFile string
+	vaultForce   bool
+	vaultKMSKey  string
+
+	// vaultKeys caches the keys loaded while decrypting
+	vaultKeys   = make(map[string][]byte)
+	vaultKeysMu sync.Mutex
+)
+
+// vaultCmd represents the vault command
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Encrypt values to keep in module and var files",
+	Long: `Encrypt single values so they can sit in module and var files next to
+the rest of the configuration, tagged !vault:
+
+  spec:
+    vars:
+      db_password: !vault |
+        $FORGE_VAULT;1;AES256-GCM;default
+        3q2+7w...
+
+Values are decrypted when the file is loaded, with the key they name. The key
+with id <id> is read from the FORGE_VAULT_KEY_<ID> environment variable, the
+file at vault.keys.<id>.file, the key wrapped by AWS KMS at vault.keys.<id>.kms
+or the secret at vault.keys.<id>.secret in the config file; the default key
+also from ` + defaultVaultKeyFile + `. Use a key per environment to keep
+production values from staging operators.`,
+}
+
+var vaultKeygenCmd = &cobra.Command{
+	Use:   "keygen",
+	Short: "Generate a vault key",
+	Long: `Generate a vault key and write it to a file. With --kms the key is
+generated by AWS KMS and printed wrapped under the KMS key, to be set as
+vault.keys.<id>.kms in the config file; only those allowed to decrypt with
+the KMS key can use it. KMS is reached with the secrets.aws configuration.`,
+	Args: cobra.NoArgs,
+	RunE:  runVaultKeygen,
+}
+
+var vaultEncryptCmd = &cobra.Command{
+	Use:   "encrypt [value]",
+	Short: "Encrypt a value, read from stdin when not given",
+	Args:  cobra.MaximumNArgs(1),
+	RunE:  runVaultEncrypt,
+}
+
+var vaultDecryptCmd = &cobra.Command{
+	Use:   "decrypt",
+	Short: "Decrypt a value read from stdin",
+	Args:  cobra.NoArgs,
+	RunE:  runVaultDecrypt,
+}
+
+func init() {
+	rootCmd.AddCommand(vaultCmd)
+	vaultCmd.AddCommand(vaultKeygenCmd, vaultEncryptCmd, vaultDecryptCmd)
+
+	vaultKeygenCmd.Flags().StringVar(&vaultKeyFile, "out", defaultVaultKeyFile, "File to write the key to, - for stdout")
+	vaultKeygenCmd.Flags().BoolVar(&vaultForce, "force", false, "Overwrite an existing key file")
+	vaultKeygenCmd.Flags().StringVar(&vaultKMSKey, "kms", "", "KMS key to wrap the key with, such as alias/forge")
+	vaultKeygenCmd.Flags().StringVar(&vaultKeyID, "key-id", vault.DefaultKeyID, "Id of the key, which a KMS-wrapped key is bound to")
+	vaultEncryptCmd.Flags().StringVar(&vaultKeyID, "key-id", vault.DefaultKeyID, "Id of the key to encrypt with")
+
+	core.SetDecrypter(decryptVaultValue)
+}
+
+func runVaultKeygen(cmd *cobra.Command, args []string) error {
+	if vaultKMSKey != "" {
+		kms, err := kmsKeys()
+		if err != nil {
+			return err
+		}
+		wrapped, err := kms.GenerateKey(cmd.Context(), vaultKMSKey, vaultKeyID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(console, "vault:\n  keys:\n    %s:\n      kms: %s\n", vaultKeyID, wrapped)
+		return nil
+	}
+
+	key, err := vault.GenerateKey()
+	if err != nil {
+		return err
+	}
+	if vaultKeyFile == "-" {
+		fmt.Fprintln(console, key)
+		return nil
+	}
+	if _, err := os.Stat(vaultKeyFile); err == nil && !vaultForce {
+		return fmt.Errorf("key file %s already exists; use --force to replace it", vaultKeyFile)
+	}
+	if err := os.MkdirAll(filepath.Dir(vaultKeyFile), 0700); err != nil {
+		return fmt.Errorf("failed to create key directory: %w", err)
+	}
+	if err := os.WriteFile(vaultKeyFile, []byte(key+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write key file %s: %w", vaultKeyFile, err)
+	}
+	fmt.Fprintf(console, "Wrote vault key to %s; keep it out of version control\n", vaultKeyFile)
+	return nil
+}
+
+func runVaultEncrypt(cmd *cobra.Command, args []string) error {
+	var plaintext string
+	if len(args) == 1 {
+		plaintext = args[0]
+	} else {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return fmt.Errorf("failed to read value: %w", err)
+		}
+		plaintext = strings.TrimSuffix(string(data), "\n")
+	}
+
+	key, err := vaultKey(vaultKeyID)
+	if err != nil {
+		return err
+	}
+	value, err := vault.Encrypt(key, vaultKeyID, plaintext)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console, vault.Tag + " |")
+	for _, line := range strings.Split(strings.TrimSuffix(value, "\n"), "\n") {
+		fmt.Fprintln(console, "  " + line)
+	}
+	return nil
+}
+
+func runVaultDecrypt(cmd *cobra.Command, args []string) error {
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return fmt.Errorf("failed to read value: %w", err)
+	}
+	value := strings.TrimPrefix(strings.TrimSpace(string(data)), vault.Tag+" |")
+	plaintext, err := vault.Decrypt(value, vault.KeyFunc(vaultKey))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(console, plaintext)
+	return nil
+}
+
+// decryptVaultValue decrypts a !vault value from a module or var file and
+// keeps the plaintext out of the debug log
+func decryptVaultValue(value string) (string, error) {
+	plaintext, err := vault.Decrypt(value, vault.KeyFunc(vaultKey))
+	if err != nil {
+		return "", err
+	}
+	addDebugSecret(plaintext)
+	return plaintext, nil
+}
+
+// vaultKey returns the key with the given id from the environment, the
+// config file or the project's key file
+func vaultKey(id string) ([]byte, error) {
+	vaultKeysMu.Lock()
+	defer vaultKeysMu.Unlock()
+	if key, ok := vaultKeys[id]; ok {
+		return key, nil
+	}
+
+	encoded, source, err := readVaultKey(id)
+	if err != nil {
+		return nil, err
+	}
+	key, err := vault.ParseKey(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", source, err)
+	}
+	vaultKeys[id] = key
+	return key, nil
+}
+
+// readVaultKey finds the encoded key with the given id and says where it
+// came from
+func readVaultKey(id string) (string, string, error) {
+	env := "FORGE_VAULT_KEY_" + strings.ToUpper(strings.ReplaceAll(id, "-", "_"))
+	if encoded := os.Getenv(env); encoded != "" {
+		return encoded, env, nil
+	}
+
+	file := viper.GetString("vault.keys." + id + ".file")
+	if file == "" && id == vault.DefaultKeyID {
+		if _, err := os.Stat(defaultVaultKeyFile); err == nil {
+			file = defaultVaultKeyFile
+		}
+	}
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to read vault key %s: %w", id, err)
+		}
+		return string(data), file, nil
+	}
+
+	if wrapped := viper.GetString("vault.keys." + id + ".kms"); wrapped != "" {
+		kms, err := kmsKeys()
+		if err != nil {
+			return "", "", err
+		}
+		encoded, err := kms.UnwrapKey(context.Background(), wrapped, id)
+		if err != nil {
+			return "", "", err
+		}
+		return encoded, "vault.keys." + id + ".kms", nil
+	}
+
+	if path := viper.GetString("vault.keys." + id + ".secret"); path != "" {
+		manager, err := secretsManager()
+		if err != nil {
+			return "", "", err
+		}
+		secret, err := manager.GetSecret(context.Background(), path)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to fetch vault key %s: %w", id, err)
+		}
+		return secret.Value, path, nil
+	}
+
+	return "", "", fmt.Errorf("no vault key %s; set %s, vault.keys.%s.file, vault.keys.%s.kms or vault.keys.%s.secret", id, env, id, id, id)
+}
+
+// kmsKeys returns the AWS KMS client vault keys are wrapped with, which
+// reaches AWS like the aws secrets provider
+func kmsKeys() (*secrets.KMSKeys, error) {
+	var config secrets.AWSConfig
+	if err := viper.UnmarshalKey("secrets.aws", &config); err != nil {
+		return nil, fmt.Errorf("invalid secrets.aws configuration: %w", err)
+	}
+	return secrets.NewKMSKeys(config), nil
+}
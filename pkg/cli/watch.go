@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"golang.org/x/term"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/server"
+)
+
+// watchNotices is how many of the most recent notifications watch shows
+const watchNotices = 10
+
+var (
+	watchModuleFile string
+	watchServer     string
+	watchRetry      time.Duration
+	watchOnce       bool
+)
+
+// watchCmd represents the watch command
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Continuously show the drift, runs and notifications of a module",
+	Long: `Follow a module through the central server: the drift each of its hosts
+had when last checked, the runs queued or in progress, its unresolved
+alerts and the most recent notifications, such as runs finishing, drift
+being found and agents reporting failures. The view is redrawn whenever the
+server reports a change, until interrupted; a lost connection is retried
+every --retry.
+
+Run 'forge server' on the controller to watch local runs; drift comes from
+the executions recorded in the controller store.
+
+Examples:
+  forge watch --module web.yaml
+  forge watch --module web.yaml --server https://forge.internal:8080 --retry 10s
+  forge watch --module web.yaml --once`,
+	Args: cobra.NoArgs,
+	RunE: runWatch,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+
+	watchCmd.Flags().StringVarP(&watchModuleFile, "module", "m", "", "Path to the module file to watch")
+	watchCmd.Flags().StringVar(&watchServer, "server", "", "URL of the central server (default server.url, or http://localhost"+server.DefaultAddr+")")
+	watchCmd.Flags().DurationVar(&watchRetry, "retry", 5*time.Second, "How long to wait before reconnecting to the server")
+	watchCmd.Flags().BoolVar(&watchOnce, "once", false, "Show the status once and exit")
+	watchCmd.MarkFlagRequired("module")
+}
+
+func runWatch(cmd *cobra.Command, args []string) error {
+	module, err := core.LoadModuleFromFile(watchModuleFile)
+	if err != nil {
+		return fmt.Errorf("failed to load module: %w", err)
+	}
+	if watchRetry <= 0 {
+		return fmt.Errorf("--retry must be positive")
+	}
+	url := watchServer
+	if url == "" {
+		url = viper.GetString("server.url")
+	}
+	if url == "" {
+		url = "http://localhost" + server.DefaultAddr
+	}
+	client := server.NewClient(url, viper.GetString("server.token"))
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if watchOnce {
+		status, err := client.Status(ctx, module.Metadata.Name)
+		if err != nil {
+			return err
+		}
+		displayWatch(os.Stdout, url, status)
+		return nil
+	}
+
+	// Redraw in place on a terminal; otherwise append each view
+	clear := term.IsTerminal(int(os.Stdout.Fd()))
+	draw := func(show func(w io.Writer)) {
+		var view bytes.Buffer
+		if clear {
+			view.WriteString("\033[H\033[2J")
+		}
+		show(&view)
+		os.Stdout.Write(view.Bytes())
+	}
+	for {
+		err := client.WatchStatus(ctx, module.Metadata.Name, func(status *server.Status) {
+			draw(func(w io.Writer) { displayWatch(w, url, status) })
+		})
+		if ctx.Err() != nil {
+			return nil
+		}
+		draw(func(w io.Writer) {
+			fmt.Fprintf(w, "forge watch %s: %v (reconnecting in %s)\n", module.Metadata.Name, err, watchRetry)
+		})
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(watchRetry):
+		}
+	}
+}
+
+// displayWatch renders the status of a module
+func displayWatch(w io.Writer, url string, status *server.Status) {
+	fmt.Fprintf(w, "forge watch %s on %s at %s\n", status.Module, url, status.Time.Local().Format("15:04:05"))
+
+	fmt.Fprintf(w, "\nDrift\n")
+	if len(status.Drift) == 0 {
+		fmt.Fprintf(w, "  No checks recorded yet\n")
+	}
+	for _, host := range status.Drift {
+		checked := host.CheckedAt.Local().Format(historyTimeFormat)
+		if host.Drifted() {
+			fmt.Fprintf(w, "  ✗ %-20s %d drifted: %s  (checked %s)\n", host.Host, len(host.Resources), strings.Join(host.Resources, ", "), checked)
+		} else {
+			fmt.Fprintf(w, "  ✓ %-20s in sync  (checked %s)\n", host.Host, checked)
+		}
+	}
+
+	fmt.Fprintf(w, "\nActive runs\n")
+	if len(status.Active) == 0 {
+		fmt.Fprintf(w, "  None\n")
+	}
+	for _, run := range status.Active {
+		since := run.CreatedAt
+		if run.StartedAt != nil {
+			since = *run.StartedAt
+		}
+		fmt.Fprintf(w, "  %-8s %-6s %s on %s  (%s for %s)\n", run.Status, run.Action, run.ID, run.Inventory, run.Status, status.Time.Sub(since).Round(time.Second))
+	}
+
+	fmt.Fprintf(w, "\nUnresolved alerts\n")
+	if len(status.Alerts) == 0 {
+		fmt.Fprintf(w, "  None\n")
+	}
+	for _, alert := range status.Alerts {
+		state := "open"
+		if alert.AcknowledgedAt != nil {
+			state = "ack " + alert.AcknowledgedBy
+		}
+		fmt.Fprintf(w, "  %s  %-7s %s  (%s)\n", alert.OpenedAt.Local().Format(historyTimeFormat), alert.Level, alert.Message, state)
+	}
+
+	fmt.Fprintf(w, "\nNotifications\n")
+	if len(status.Notices) == 0 {
+		fmt.Fprintf(w, "  None\n")
+	}
+	for i, notice := range status.Notices {
+		if i == watchNotices {
+			break
+		}
+		fmt.Fprintf(w, "  %s  %-7s %s\n", notice.Time.Local().Format(historyTimeFormat), notice.Level, notice.Message)
+	}
+}
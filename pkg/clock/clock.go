@@ -0,0 +1,19 @@
+// Package clock waits in ways that give up when a context is done
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Sleep sleeps for d or until the context is done
+func Sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
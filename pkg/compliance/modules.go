@@ -3,6 +3,7 @@ package compliance
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 	"sync"
 
@@ -123,6 +124,7 @@ func (m *ComplianceManager) GetLoadedModules() []string {
 	for name := range m.modules {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -144,12 +146,14 @@ func (m *ComplianceManager) CheckCompliance(ctx context.Context, module *core.Mo
 		return nil, fmt.Errorf("no compliance modules loaded")
 	}
 	
-	// Use the first loaded module
-	for _, complianceModule := range m.modules {
-		return complianceModule.CheckCompliance(ctx, module)
+	// Use the first loaded module by name
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
 	}
+	sort.Strings(names)
 	
-	return nil, fmt.Errorf("no compliance modules available")
+	return m.modules[names[0]].CheckCompliance(ctx, module)
 }
 
 // CheckAllCompliance checks compliance against all loaded modules
@@ -172,7 +176,14 @@ func (m *ComplianceManager) CheckAllCompliance(ctx context.Context, module *core
 	
 	results := make([]*ComplianceResult, 0, len(m.modules))
 	
-	for _, complianceModule := range m.modules {
+	names := make([]string, 0, len(m.modules))
+	for name := range m.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	for _, name := range names {
+		complianceModule := m.modules[name]
 		result, err := complianceModule.CheckCompliance(ctx, module)
 		if err != nil {
 			return nil, fmt.Errorf("compliance check failed for %s: %w", complianceModule.Framework(), err)
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// loadData reads the data files of the resources generated from one, in
+// dir, the module's directory, and loops them over the file's entries as
+// if they were listed in with_items. Entries are checked for the fields
+// the data source requires, so a bad file fails when the module is loaded.
+func (m *Module) loadData(dir string) error {
+	for i := range m.Spec.Resources {
+		resource := &m.Spec.Resources[i]
+		if resource.WithData == nil {
+			continue
+		}
+		if err := resource.Validate(); err != nil {
+			return fmt.Errorf("resource %s: %w", resource.ResourceID(), err)
+		}
+		if dir == "" {
+			return fmt.Errorf("resource %s: with_data is only supported in module files on disk", resource.ResourceID())
+		}
+		items, err := readData(dir, resource.WithData)
+		if err != nil {
+			return fmt.Errorf("resource %s: with_data %s: %w", resource.ResourceID(), resource.WithData.File, err)
+		}
+		resource.WithItems, resource.WithData = items, nil
+	}
+	return nil
+}
+
+// readData returns the entries of a data source
+func readData(dir string, source *types.DataSource) ([]interface{}, error) {
+	if filepath.IsAbs(source.File) || !filepath.IsLocal(source.File) {
+		return nil, fmt.Errorf("must be a path inside the module's directory")
+	}
+	data, err := os.ReadFile(filepath.Join(dir, source.File))
+	if err != nil {
+		return nil, err
+	}
+
+	var items []interface{}
+	switch strings.ToLower(filepath.Ext(source.File)) {
+	case ".csv":
+		if source.Key != "" {
+			return nil, fmt.Errorf("key is not supported for CSV files")
+		}
+		items, err = parseCSV(data)
+	case ".yaml", ".yml", ".json":
+		// JSON is YAML, and decoding it as YAML keeps integers integers
+		items, err = parseDataList(data, source.Key)
+	default:
+		return nil, fmt.Errorf("unsupported file type, must be .yaml, .yml, .json or .csv")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	for i, item := range items {
+		if len(source.Required) == 0 {
+			break
+		}
+		fields, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("entry %d is not a map", i)
+		}
+		for _, field := range source.Required {
+			if value, ok := fields[field]; !ok || value == nil || value == "" {
+				return nil, fmt.Errorf("entry %d does not set required field %s", i, field)
+			}
+		}
+	}
+	return items, nil
+}
+
+// parseDataList decodes a YAML or JSON list, at the top level or under key
+func parseDataList(data []byte, key string) ([]interface{}, error) {
+	var document interface{}
+	if err := decodeYAML(data, &document); err != nil {
+		return nil, err
+	}
+	if key != "" {
+		fields, ok := document.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("key %s: the file is not a map", key)
+		}
+		if document, ok = fields[key]; !ok {
+			return nil, fmt.Errorf("key %s not found", key)
+		}
+	}
+	items, ok := document.([]interface{})
+	if !ok {
+		if key != "" {
+			return nil, fmt.Errorf("key %s is not a list", key)
+		}
+		return nil, fmt.Errorf("the file is not a list; set key to use a list inside it")
+	}
+	return items, nil
+}
+
+// parseCSV decodes CSV rows into maps keyed by the header row
+func parseCSV(data []byte) ([]interface{}, error) {
+	reader := csv.NewReader(bytes.NewReader(data))
+	reader.TrimLeadingSpace = true
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("the file has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	for i, column := range header {
+		header[i] = strings.TrimSpace(column)
+		if header[i] == "" {
+			return nil, fmt.Errorf("column %d has no name", i+1)
+		}
+	}
+
+	items := []interface{}{}
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return items, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		item := make(map[string]interface{}, len(header))
+		for i, column := range header {
+			item[column] = row[i]
+		}
+		items = append(items, item)
+	}
+}
@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func writeDataModule(t *testing.T, files map[string]string, resource string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	module := `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  vars:
+    root: /etc/nginx/sites-enabled
+  resources:
+` + resource
+	path := filepath.Join(dir, "module.yaml")
+	if err := os.WriteFile(path, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestModule_WithData(t *testing.T) {
+	resource := `    - type: file
+      name: vhost-${item.name}
+      path: ${var:root}/${item.name}.conf
+      content: "listen ${item.port}; server_name ${item.domain};"
+      with_data: {file: %s, key: "%s", required: [name, domain]}
+`
+	tests := []struct {
+		name  string
+		files map[string]string
+		file  string
+		key   string
+		want  map[string]string
+	}{
+		{
+			name:  "YAML under a key",
+			files: map[string]string{"sites.yaml": "sites:\n  - {name: shop, domain: shop.example.com, port: 8080}\n  - {name: blog, domain: blog.example.com, port: 8081}\n"},
+			file:  "sites.yaml",
+			key:   "sites",
+			want: map[string]string{
+				"file.vhost-shop": "listen 8080; server_name shop.example.com;",
+				"file.vhost-blog": "listen 8081; server_name blog.example.com;",
+			},
+		},
+		{
+			name:  "JSON list",
+			files: map[string]string{"sites.json": `[{"name": "shop", "domain": "shop.example.com", "port": 8080}]`},
+			file:  "sites.json",
+			want:  map[string]string{"file.vhost-shop": "listen 8080; server_name shop.example.com;"},
+		},
+		{
+			name:  "CSV rows",
+			files: map[string]string{"sites.csv": "name, domain, port\nshop, shop.example.com, 8080\nblog, blog.example.com, 8081\n"},
+			file:  "sites.csv",
+			want: map[string]string{
+				"file.vhost-shop": "listen 8080; server_name shop.example.com;",
+				"file.vhost-blog": "listen 8081; server_name blog.example.com;",
+			},
+		},
+		{
+			name:  "empty list",
+			files: map[string]string{"sites.csv": "name,domain,port\n"},
+			file:  "sites.csv",
+			want:  map[string]string{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module, err := LoadModuleFromFile(writeDataModule(t, tt.files, fmt.Sprintf(resource, tt.file, tt.key)))
+			if err != nil {
+				t.Fatalf("LoadModuleFromFile() error = %v", err)
+			}
+			if err := module.ResolveVars(nil); err != nil {
+				t.Fatalf("ResolveVars() error = %v", err)
+			}
+			got := make(map[string]string)
+			for _, resource := range module.Spec.Resources {
+				got[resource.ResourceID()] = resource.Properties["content"].(string)
+				if !strings.HasPrefix(resource.Properties["path"].(string), "/etc/nginx/sites-enabled/") {
+					t.Errorf("%s path = %v", resource.ResourceID(), resource.Properties["path"])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resources = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModule_WithData_Errors(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		source  string
+		wantErr string
+	}{
+		{name: "missing file", source: "{file: sites.yaml}", wantErr: "with_data sites.yaml"},
+		{name: "outside the module", source: "{file: ../sites.yaml}", wantErr: "inside the module's directory"},
+		{name: "unsupported type", files: map[string]string{"sites.txt": "shop"}, source: "{file: sites.txt}", wantErr: "unsupported file type"},
+		{name: "not a list", files: map[string]string{"sites.yaml": "sites: []"}, source: "{file: sites.yaml}", wantErr: "set key"},
+		{name: "unknown key", files: map[string]string{"sites.yaml": "sites: []"}, source: "{file: sites.yaml, key: vhosts}", wantErr: "key vhosts not found"},
+		{name: "required field", files: map[string]string{"sites.yaml": "- {name: shop}"}, source: "{file: sites.yaml, required: [name, domain]}", wantErr: "entry 0 does not set required field domain"},
+		{name: "ragged CSV", files: map[string]string{"sites.csv": "name,domain\nshop\n"}, source: "{file: sites.csv}", wantErr: "wrong number of fields"},
+		{name: "with loop", files: map[string]string{"sites.yaml": "[]"}, source: "{file: sites.yaml}\n      with_items: [a]", wantErr: "cannot be combined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := "    - type: file\n      name: vhost-${item.name}\n      path: /etc/site\n      with_data: " + tt.source + "\n"
+			_, err := LoadModuleFromFile(writeDataModule(t, tt.files, resource))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("LoadModuleFromFile() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,116 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Defaults are property values for every resource of a type that does not
+// set them itself, keyed by resource type, such as a default owner for
+// files or a default state for packages
+type Defaults map[string]map[string]interface{}
+
+// reservedDefaults are the resource fields that identify a resource or wire
+// it to others, which cannot be defaulted
+var reservedDefaults = map[string]bool{
+	"type":       true,
+	"name":       true,
+	"import":     true,
+	"depends_on": true,
+	"notify":     true,
+	"only_if":    true,
+	"not_if":     true,
+	"export":     true,
+	"collect":    true,
+
+	"become":        true,
+	"become_user":   true,
+	"become_method": true,
+}
+
+// Validate checks the defaults only set properties
+func (d Defaults) Validate() error {
+	for resourceType, properties := range d {
+		for key := range properties {
+			if reservedDefaults[key] {
+				return fmt.Errorf("defaults.%s: %s cannot have a default", resourceType, key)
+			}
+		}
+	}
+	return nil
+}
+
+// ApplyDefaults fills in the properties that the module's resources and
+// handlers leave unset. A value set on a resource always takes precedence
+// over a default; the properties taken from defaults are recorded in each
+// resource's Defaulted list.
+func (m *Module) ApplyDefaults(defaults Defaults) error {
+	if err := defaults.Validate(); err != nil {
+		return err
+	}
+	for i := range m.Spec.Resources {
+		defaults.apply(&m.Spec.Resources[i])
+	}
+	for i := range m.Spec.Handlers {
+		defaults.apply(&m.Spec.Handlers[i].Resource)
+	}
+	return nil
+}
+
+// apply fills in a resource's unset properties
+func (d Defaults) apply(resource *types.Resource) {
+	properties := d[resource.Type]
+	if len(properties) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(properties))
+	for key := range properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if _, set := resource.Properties[key]; set {
+			continue
+		}
+		// state has its own field on resources
+		if key == "state" {
+			if resource.State != "" {
+				continue
+			}
+			if state, ok := properties[key].(string); ok {
+				resource.State = types.ResourceState(state)
+				resource.Defaulted = append(resource.Defaulted, key)
+				continue
+			}
+		}
+		if resource.Properties == nil {
+			resource.Properties = make(map[string]interface{})
+		}
+		resource.Properties[key] = copyDefault(properties[key])
+		resource.Defaulted = append(resource.Defaulted, key)
+	}
+}
+
+// copyDefault copies maps and lists so resources never share a default value
+func copyDefault(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyDefault(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyDefault(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
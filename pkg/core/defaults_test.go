@@ -0,0 +1,115 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestModule_ApplyDefaults(t *testing.T) {
+	defaults := Defaults{
+		"file": {"owner": "app", "group": "app", "mode": "0640"},
+		"pkg":  {"state": "latest"},
+		"shell": {
+			"timeout":     "5m",
+			"environment": map[string]interface{}{"LANG": "C"},
+		},
+	}
+
+	module := &Module{
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{Type: "file", Name: "config", Properties: map[string]interface{}{"path": "/etc/app.conf", "mode": "0600"}},
+				{Type: "pkg", Name: "nginx"},
+				{Type: "pkg", Name: "curl", State: types.StatePresent},
+				{Type: "shell", Name: "one", Properties: map[string]interface{}{"command": "true"}},
+				{Type: "shell", Name: "two", Properties: map[string]interface{}{"command": "true"}},
+				{Type: "service", Name: "nginx"},
+			},
+			Handlers: []Handler{
+				{Name: "write", Resource: types.Resource{Type: "file", Name: "marker"}},
+			},
+		},
+	}
+	if err := module.ApplyDefaults(defaults); err != nil {
+		t.Fatalf("ApplyDefaults() error = %v", err)
+	}
+
+	tests := []struct {
+		name          string
+		resource      types.Resource
+		wantProps     map[string]interface{}
+		wantState     types.ResourceState
+		wantDefaulted []string
+	}{
+		{
+			name:          "explicit values win",
+			resource:      module.Spec.Resources[0],
+			wantProps:     map[string]interface{}{"path": "/etc/app.conf", "mode": "0600", "owner": "app", "group": "app"},
+			wantDefaulted: []string{"group", "owner"},
+		},
+		{
+			name:          "default state",
+			resource:      module.Spec.Resources[1],
+			wantState:     "latest",
+			wantDefaulted: []string{"state"},
+		},
+		{
+			name:      "explicit state",
+			resource:  module.Spec.Resources[2],
+			wantState: types.StatePresent,
+		},
+		{
+			name:          "handler resource",
+			resource:      module.Spec.Handlers[0].Resource,
+			wantProps:     map[string]interface{}{"owner": "app", "group": "app", "mode": "0640"},
+			wantDefaulted: []string{"group", "mode", "owner"},
+		},
+		{
+			name:     "no defaults for type",
+			resource: module.Spec.Resources[5],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.wantProps != nil && !reflect.DeepEqual(tt.resource.Properties, tt.wantProps) {
+				t.Errorf("Properties = %v, want %v", tt.resource.Properties, tt.wantProps)
+			}
+			if tt.resource.State != tt.wantState {
+				t.Errorf("State = %q, want %q", tt.resource.State, tt.wantState)
+			}
+			if !reflect.DeepEqual(tt.resource.Defaulted, tt.wantDefaulted) {
+				t.Errorf("Defaulted = %v, want %v", tt.resource.Defaulted, tt.wantDefaulted)
+			}
+		})
+	}
+
+	// Each resource gets its own copy of a default map
+	module.Spec.Resources[3].Properties["environment"].(map[string]interface{})["LANG"] = "en_US.UTF-8"
+	if env := module.Spec.Resources[4].Properties["environment"].(map[string]interface{}); env["LANG"] != "C" {
+		t.Errorf("Expected defaults not to be shared between resources, got %v", env)
+	}
+}
+
+func TestDefaults_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		defaults Defaults
+		wantErr  bool
+	}{
+		{name: "empty", defaults: nil},
+		{name: "properties", defaults: Defaults{"file": {"owner": "root", "state": "present"}}},
+		{name: "name", defaults: Defaults{"file": {"name": "x"}}, wantErr: true},
+		{name: "depends_on", defaults: Defaults{"pkg": {"depends_on": []interface{}{"repo.epel"}}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.defaults.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,274 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// DecryptFunc decrypts a value tagged !vault in a module or var file
+type DecryptFunc func(value string) (string, error)
+
+// SecretResolver returns the secret a ${secret:provider://path} reference
+// in a module or var file names
+type SecretResolver func(reference string) (string, error)
+
+var (
+	decrypterMu    sync.Mutex
+	decrypter      DecryptFunc
+	secretResolver SecretResolver
+)
+
+// secretReference matches ${secret:provider://path} in a string
+var secretReference = regexp.MustCompile(`\$\{secret:([^}]+)\}`)
+
+// SetDecrypter sets how encrypted values in module and var files are
+// decrypted when they are loaded. nil leaves them undecryptable, so files
+// holding them fail to load.
+func SetDecrypter(decrypt DecryptFunc) {
+	decrypterMu.Lock()
+	defer decrypterMu.Unlock()
+	decrypter = decrypt
+}
+
+// SetSecretResolver sets how ${secret:provider://path} references in module
+// and var files are resolved. They are kept as they are written when the
+// files are loaded, and only resolved into the copy of a resource its
+// provider reads and applies, so loaded modules and the resources of plans
+// keep the references. nil leaves them as they are written.
+func SetSecretResolver(resolve SecretResolver) {
+	decrypterMu.Lock()
+	defer decrypterMu.Unlock()
+	secretResolver = resolve
+}
+
+// decodeYAML decodes a module or var file into out, decrypting !vault
+// values on the way so they read as plain strings
+func decodeYAML(data []byte, out interface{}) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	if err := decryptNode(&document); err != nil {
+		return err
+	}
+	if document.Kind == 0 {
+		return nil
+	}
+	return document.Decode(out)
+}
+
+// decodeYAMLEncrypted decodes a var file into out like decodeYAML, but
+// keeps !vault values encrypted
+func decodeYAMLEncrypted(data []byte, out interface{}) error {
+	var document yaml.Node
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	keepEncrypted(&document)
+	if document.Kind == 0 {
+		return nil
+	}
+	return document.Decode(out)
+}
+
+// MarshalEncrypted encodes a module loaded by LoadModuleFromFileEncrypted
+// as YAML, with the values kept encrypted tagged !vault again, so they are
+// decrypted when the module is loaded
+func MarshalEncrypted(module *Module) ([]byte, error) {
+	var document yaml.Node
+	if err := document.Encode(module); err != nil {
+		return nil, err
+	}
+	if err := tagEncrypted(&document); err != nil {
+		return nil, err
+	}
+	return yaml.Marshal(&document)
+}
+
+// tagEncrypted tags the encrypted scalars under node !vault. An encrypted
+// value interpolated into a longer string would not be decrypted, so it is
+// refused.
+func tagEncrypted(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && vault.Contains(node.Value) {
+		if !vault.IsEncrypted([]byte(node.Value)) {
+			return fmt.Errorf("an encrypted value is part of a longer string, which cannot be kept encrypted; give it a variable of its own")
+		}
+		node.Tag = vault.Tag
+		node.Style = yaml.LiteralStyle
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := tagEncrypted(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// keepEncrypted untags the !vault scalars under node, so they decode as
+// their ciphertext
+func keepEncrypted(node *yaml.Node) {
+	if node.Kind == yaml.ScalarNode && node.Tag == vault.Tag {
+		node.Tag = "!!str"
+		node.Style = 0
+	}
+	for _, child := range node.Content {
+		keepEncrypted(child)
+	}
+}
+
+// DecryptVars returns a copy of variables read by LoadVarFileEncrypted with
+// the values kept encrypted decrypted
+func DecryptVars(vars map[string]interface{}) (map[string]interface{}, error) {
+	if vars == nil {
+		return nil, nil
+	}
+	decrypterMu.Lock()
+	decrypt := decrypter
+	decrypterMu.Unlock()
+	decrypted := make(map[string]interface{}, len(vars))
+	for key, value := range vars {
+		value, err := decryptValue(value, decrypt)
+		if err != nil {
+			return nil, fmt.Errorf("variable %s: %w", key, err)
+		}
+		decrypted[key] = value
+	}
+	return decrypted, nil
+}
+
+// decryptValue decrypts the encrypted strings in a variable's value
+func decryptValue(value interface{}, decrypt DecryptFunc) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !vault.IsEncrypted([]byte(v)) {
+			return v, nil
+		}
+		if decrypt == nil {
+			return nil, fmt.Errorf("encrypted value but no vault keys are configured")
+		}
+		return decrypt(v)
+	case map[string]interface{}:
+		decrypted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := decryptValue(item, decrypt)
+			if err != nil {
+				return nil, err
+			}
+			decrypted[key] = value
+		}
+		return decrypted, nil
+	case []interface{}:
+		decrypted := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := decryptValue(item, decrypt)
+			if err != nil {
+				return nil, err
+			}
+			decrypted[i] = value
+		}
+		return decrypted, nil
+	default:
+		return value, nil
+	}
+}
+
+// decryptNode replaces the !vault scalars under node with their plaintext
+func decryptNode(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode && node.Tag == vault.Tag {
+		decrypterMu.Lock()
+		decrypt := decrypter
+		decrypterMu.Unlock()
+		if decrypt == nil {
+			return fmt.Errorf("line %d: encrypted value but no vault keys are configured", node.Line)
+		}
+		plaintext, err := decrypt(node.Value)
+		if err != nil {
+			return fmt.Errorf("line %d: %w", node.Line, err)
+		}
+		node.Tag = "!!str"
+		node.Style = 0
+		node.Value = plaintext
+		return nil
+	}
+	for _, child := range node.Content {
+		if err := decryptNode(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithSecrets returns a copy of a resource with the ${secret:...} references
+// in its properties and conditions replaced by the secrets they name. The
+// copy shares nothing with the resource, which keeps its references.
+func WithSecrets(resource types.Resource) (types.Resource, error) {
+	decrypterMu.Lock()
+	resolve := secretResolver
+	decrypterMu.Unlock()
+	if resolve == nil {
+		return resource, nil
+	}
+	properties, err := resolveSecrets(resource.Properties, resolve)
+	if err != nil {
+		return resource, err
+	}
+	resource.Properties, _ = properties.(map[string]interface{})
+	for _, condition := range []*string{&resource.OnlyIf, &resource.NotIf} {
+		value, err := resolveSecrets(*condition, resolve)
+		if err != nil {
+			return resource, err
+		}
+		*condition = value.(string)
+	}
+	return resource, nil
+}
+
+// resolveSecrets replaces the secret references in a property value
+func resolveSecrets(value interface{}, resolve SecretResolver) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if !secretReference.MatchString(v) {
+			return v, nil
+		}
+		var failed error
+		result := secretReference.ReplaceAllStringFunc(v, func(match string) string {
+			secret, err := resolve(secretReference.FindStringSubmatch(match)[1])
+			if err != nil && failed == nil {
+				failed = err
+			}
+			return secret
+		})
+		return result, failed
+	case map[string]interface{}:
+		if v == nil {
+			return v, nil
+		}
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := resolveSecrets(item, resolve)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			resolved[key] = value
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := resolveSecrets(item, resolve)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			resolved[i] = value
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
@@ -0,0 +1,221 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+// useVaultKey makes module loading decrypt with a fresh default key and
+// returns it
+func useVaultKey(t *testing.T) []byte {
+	t.Helper()
+	encoded, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := vault.ParseKey(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := vault.KeyFunc(func(id string) ([]byte, error) {
+		if id != vault.DefaultKeyID {
+			return nil, fmt.Errorf("no vault key %s", id)
+		}
+		return key, nil
+	})
+	SetDecrypter(func(value string) (string, error) {
+		return vault.Decrypt(value, keys)
+	})
+	t.Cleanup(func() { SetDecrypter(nil) })
+	return key
+}
+
+// vaultBlock returns an encrypted value as an indented !vault block
+func vaultBlock(t *testing.T, key []byte, plaintext string) string {
+	t.Helper()
+	value, err := vault.Encrypt(key, vault.DefaultKeyID, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	indent := "      "
+	return "!vault |\n" + strings.TrimRight(indent+strings.ReplaceAll(value, "\n", "\n"+indent), " ")
+}
+
+func TestLoadModuleFromFile_Encrypted(t *testing.T) {
+	key := useVaultKey(t)
+	dir := writeModules(t, map[string]string{
+		"site.yaml": "spec:\n  vars:\n    password: " + vaultBlock(t, key, "hunter2") + "    user: app\n" +
+			"  resources:\n    - type: file\n      name: creds\n      path: /etc/app/creds\n      content: \"${var:user}:${var:password}\"\n",
+	})
+
+	module, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if got := module.Spec.Vars["password"]; got != "hunter2" {
+		t.Errorf("password = %v, want it decrypted", got)
+	}
+	if err := module.ResolveVars(nil); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+	if got := module.Spec.Resources[0].Properties["content"]; got != "app:hunter2" {
+		t.Errorf("content = %v", got)
+	}
+
+	varFile := filepath.Join(dir, "production.yaml")
+	if err := os.WriteFile(varFile, []byte("password: "+strings.Replace(vaultBlock(t, key, "s3cret"), "      ", "  ", -1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := LoadVarFile(varFile)
+	if err != nil {
+		t.Fatalf("LoadVarFile: %v", err)
+	}
+	if vars["password"] != "s3cret" {
+		t.Errorf("var file password = %v, want it decrypted", vars["password"])
+	}
+}
+
+func TestLoadModuleFromFile_EncryptedErrors(t *testing.T) {
+	encoded, _ := vault.GenerateKey()
+	otherKey, _ := vault.ParseKey(encoded)
+	spec := "spec:\n  vars:\n    password: " + vaultBlock(t, otherKey, "hunter2") + "  resources: []\n"
+	dir := writeModules(t, map[string]string{"site.yaml": spec})
+
+	_, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "line 8: encrypted value but no vault keys are configured") {
+		t.Errorf("LoadModuleFromFile without keys = %v", err)
+	}
+
+	useVaultKey(t)
+	_, err = LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err == nil || !strings.Contains(err.Error(), "wrong key or corrupt value") {
+		t.Errorf("LoadModuleFromFile with another key = %v", err)
+	}
+}
+
+func TestLoadModuleFromFileEncrypted(t *testing.T) {
+	key := useVaultKey(t)
+	dir := writeModules(t, map[string]string{
+		"site.yaml": "spec:\n  vars:\n    password: " + vaultBlock(t, key, "hunter2") + "    user: app\n" +
+			"  resources:\n    - type: file\n      name: creds\n      path: /etc/app/creds\n      content: \"${var:user}:${var:password}\"\n",
+		"vars.yaml": "password: " + strings.Replace(vaultBlock(t, key, "s3cret"), "      ", "  ", -1) + "nested:\n  list: [plain]\n",
+	})
+
+	module, err := LoadModuleFromFileEncrypted(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFileEncrypted: %v", err)
+	}
+	if got, _ := module.Spec.Vars["password"].(string); !vault.IsEncrypted([]byte(got)) {
+		t.Errorf("password = %v, want it kept encrypted", got)
+	}
+	data, err := MarshalEncrypted(module)
+	if err != nil {
+		t.Fatalf("MarshalEncrypted: %v", err)
+	}
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "password: !vault |") {
+		t.Errorf("marshalled module = %s", data)
+	}
+
+	// Written out, it loads and decrypts like the module it came from
+	if err := os.WriteFile(filepath.Join(dir, "written.yaml"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	written, err := LoadModuleFromFile(filepath.Join(dir, "written.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if got := written.Spec.Vars["password"]; got != "hunter2" {
+		t.Errorf("written password = %v", got)
+	}
+
+	// Interpolated into a longer string, it cannot be kept encrypted
+	if err := module.ResolveVars(nil); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+	if _, err := MarshalEncrypted(module); err == nil || !strings.Contains(err.Error(), "part of a longer string") {
+		t.Errorf("MarshalEncrypted of an interpolated value = %v", err)
+	}
+
+	vars, err := LoadVarFileEncrypted(filepath.Join(dir, "vars.yaml"))
+	if err != nil {
+		t.Fatalf("LoadVarFileEncrypted: %v", err)
+	}
+	if got, _ := vars["password"].(string); !vault.IsEncrypted([]byte(got)) {
+		t.Errorf("var file password = %v, want it kept encrypted", got)
+	}
+	decrypted, err := DecryptVars(vars)
+	if err != nil {
+		t.Fatalf("DecryptVars: %v", err)
+	}
+	if decrypted["password"] != "s3cret" || decrypted["nested"].(map[string]interface{})["list"].([]interface{})[0] != "plain" {
+		t.Errorf("DecryptVars = %v", decrypted)
+	}
+	if _, ok := vars["password"].(string); !ok || vars["password"] == "s3cret" {
+		t.Errorf("DecryptVars changed the variables it decrypted")
+	}
+
+	SetDecrypter(nil)
+	if _, err := DecryptVars(vars); err == nil || !strings.Contains(err.Error(), "variable password: encrypted value but no vault keys are configured") {
+		t.Errorf("DecryptVars without keys = %v", err)
+	}
+}
+
+func TestLoadModuleFromFile_SecretReferences(t *testing.T) {
+	spec := "spec:\n  vars:\n    dsn: \"postgres://app:${secret:file://db_password}@db/${secret:file://db_name}\"\n" +
+		"  resources:\n    - type: file\n      name: token\n      path: /etc/app/token\n      content: ${secret:file://missing}\n" +
+		"    - type: file\n      name: dsn\n      path: /etc/app/dsn\n      content: ${var:dsn}\n      vars:\n        list: [\"${secret:file://db_name}\"]\n"
+	dir := writeModules(t, map[string]string{"site.yaml": spec, "vars.yaml": "token: ${secret:file://db_password}\n"})
+
+	secrets := map[string]string{"file://db_password": "hunter2", "file://db_name": "orders"}
+	SetSecretResolver(func(reference string) (string, error) {
+		if secret, ok := secrets[reference]; ok {
+			return secret, nil
+		}
+		return "", fmt.Errorf("no secret %s", reference)
+	})
+	t.Cleanup(func() { SetSecretResolver(nil) })
+
+	// References are kept as they are written when the files are loaded
+	module, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if got := module.Spec.Vars["dsn"]; got != "postgres://app:${secret:file://db_password}@db/${secret:file://db_name}" {
+		t.Errorf("dsn = %v, want it unresolved", got)
+	}
+	vars, err := LoadVarFile(filepath.Join(dir, "vars.yaml"))
+	if err != nil || vars["token"] != "${secret:file://db_password}" {
+		t.Errorf("LoadVarFile = %v, %v", vars, err)
+	}
+	if err := module.ResolveVars(nil); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+
+	// and resolved into a copy of a resource
+	_, err = WithSecrets(module.Spec.Resources[0])
+	if err == nil || !strings.Contains(err.Error(), "content: no secret file://missing") {
+		t.Errorf("WithSecrets with a missing secret = %v", err)
+	}
+	resource := module.Spec.Resources[1]
+	resolved, err := WithSecrets(resource)
+	if err != nil {
+		t.Fatalf("WithSecrets: %v", err)
+	}
+	if got := resolved.Properties["content"]; got != "postgres://app:hunter2@db/orders" {
+		t.Errorf("content = %v", got)
+	}
+	if got := resolved.Properties["vars"].(map[string]interface{})["list"].([]interface{})[0]; got != "orders" {
+		t.Errorf("vars.list[0] = %v", got)
+	}
+	if got := resource.Properties["content"]; got != "postgres://app:${secret:file://db_password}@db/${secret:file://db_name}" {
+		t.Errorf("resource content = %v, want it unresolved", got)
+	}
+	if got := resource.Properties["vars"].(map[string]interface{})["list"].([]interface{})[0]; got != "${secret:file://db_name}" {
+		t.Errorf("resource vars.list[0] = %v, want it unresolved", got)
+	}
+}
@@ -13,6 +13,7 @@ type ChangeResult struct {
 	Change    Change        `json:"change"`
 	Success   bool          `json:"success"`
 	Error     error         `json:"error,omitempty"`
+	Handler   string        `json:"handler,omitempty"`
 	Duration  time.Duration `json:"duration"`
 	StartTime time.Time     `json:"start_time"`
 	EndTime   time.Time     `json:"end_time"`
@@ -63,6 +64,21 @@ func (er *ExecutionResult) Finalize() {
 	er.Summary.Duration = er.Summary.EndTime.Sub(er.Summary.StartTime)
 }
 
+type resultStreamKey struct{}
+
+// WithResultStream returns a context in which executors pass the result of
+// each change and handler to stream as soon as it is known
+func WithResultStream(ctx context.Context, stream func(ChangeResult)) context.Context {
+	return context.WithValue(ctx, resultStreamKey{}, stream)
+}
+
+// StreamResult passes a result to the result stream of a context, if it has one
+func StreamResult(ctx context.Context, result ChangeResult) {
+	if stream, _ := ctx.Value(resultStreamKey{}).(func(ChangeResult)); stream != nil {
+		stream(result)
+	}
+}
+
 // Executor executes plans by applying changes
 type Executor struct {
 	registry *types.ProviderRegistry
@@ -78,9 +94,15 @@ func NewExecutor(registry *types.ProviderRegistry) *Executor {
 // ExecutePlan executes all changes in a plan
 func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan) (*ExecutionResult, error) {
 	result := NewExecutionResult()
+	ctx = plan.limitOutput(ctx)
 	
 	// Execute each change in the plan
 	for _, change := range plan.Changes {
+		// Plan changes using registered output now that it is known
+		if change.Deferred && change.Error == nil {
+			change = plan.planDeferred(change)
+		}
+		
 		// Skip changes that have errors from planning phase
 		if change.Error != nil {
 			changeResult := ChangeResult{
@@ -91,11 +113,17 @@ func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan) (*ExecutionResul
 			}
 			changeResult.EndTime = changeResult.StartTime
 			result.AddChangeResult(changeResult)
+			StreamResult(ctx, changeResult)
 			continue
 		}
 		
-		// Skip no-op changes
-		if change.Action == ActionNoOp {
+		// Skip no-op changes and audited resources, which are never changed
+		if change.Action == ActionNoOp || change.Audit {
+			plan.register(change.Resource, types.CommandOutput{}, false)
+			// An audited resource is left as it is, whatever its plan
+			if change.Audit {
+				change.Action = ActionNoOp
+			}
 			changeResult := ChangeResult{
 				Change:    change,
 				Success:   true,
@@ -103,12 +131,16 @@ func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan) (*ExecutionResul
 			}
 			changeResult.EndTime = changeResult.StartTime
 			result.AddChangeResult(changeResult)
+			StreamResult(ctx, changeResult)
 			continue
 		}
 		
-		// Execute the change
-		changeResult := e.executeChange(ctx, change)
+		// Execute the change, capturing the output it registers
+		var output types.CommandOutput
+		changeResult := e.executeChange(types.WithOutputCapture(ctx, &output), change)
+		plan.register(change.Resource, output, true)
 		result.AddChangeResult(changeResult)
+		StreamResult(ctx, changeResult)
 		
 		// Stop execution on failure (fail-fast behavior)
 		if !changeResult.Success {
@@ -116,6 +148,9 @@ func (e *Executor) ExecutePlan(ctx context.Context, plan *Plan) (*ExecutionResul
 		}
 	}
 	
+	// Run handlers notified by applied changes
+	e.RunHandlers(ctx, plan, result)
+	
 	result.Finalize()
 	return result, nil
 }
@@ -139,8 +174,16 @@ func (e *Executor) executeChange(ctx context.Context, change Change) ChangeResul
 		return result
 	}
 	
-	// Apply the change using the provider
-	if err := provider.Apply(ctx, &change.Resource, change.Diff); err != nil {
+	// Apply the change using the provider, with the secrets it references
+	resource, err := WithSecrets(change.Resource)
+	if err != nil {
+		result.Success = false
+		result.Error = fmt.Errorf("failed to resolve secrets: %w", err)
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime)
+		return result
+	}
+	if err := provider.Apply(ctx, &resource, change.Diff); err != nil {
 		result.Success = false
 		result.Error = fmt.Errorf("failed to apply change: %w", err)
 	} else {
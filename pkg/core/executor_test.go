@@ -115,3 +115,25 @@ func TestExecutionResult_Summary(t *testing.T) {
 		t.Errorf("Expected 1 failed, got %d", summary.Failed)
 	}
 }
+
+func TestExecutor_ResultStream(t *testing.T) {
+	provider := &countingProvider{resourceType: "file", applied: make(map[string]int)}
+	registry := types.NewProviderRegistry()
+	registry.Register(provider)
+	plan := NewPlan()
+	plan.Handlers = []Handler{{Name: "reload", Resource: types.Resource{Type: "file", Name: "reload"}}}
+	plan.AddChange(Change{Action: ActionUpdate, Resource: types.Resource{Type: "file", Name: "conf", Notify: []string{"reload"}}})
+	plan.AddChange(Change{Action: ActionNoOp, Resource: types.Resource{Type: "file", Name: "motd"}})
+
+	var streamed []string
+	ctx := WithResultStream(context.Background(), func(result ChangeResult) {
+		streamed = append(streamed, result.Change.Resource.ResourceID()+":"+result.Handler)
+	})
+	if _, err := NewExecutor(registry).ExecutePlan(ctx, plan); err != nil {
+		t.Fatalf("ExecutePlan() error = %v", err)
+	}
+	want := []string{"file.conf:", "file.motd:", "file.reload:reload"}
+	if fmt.Sprint(streamed) != fmt.Sprint(want) {
+		t.Errorf("streamed %v, want %v", streamed, want)
+	}
+}
@@ -0,0 +1,223 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// ExportedResource is data a resource on one host publishes to a collection
+type ExportedResource struct {
+	Host       string                 `yaml:"host" json:"host"`
+	Module     string                 `yaml:"module" json:"module"`
+	Collection string                 `yaml:"collection" json:"collection"`
+	ResourceID string                 `yaml:"resource" json:"resource"`
+	Data       map[string]interface{} `yaml:"data,omitempty" json:"data,omitempty"`
+}
+
+// Values returns the exported data as seen by templates, with the exporting
+// host and resource added under "host" and "resource"
+func (e ExportedResource) Values() map[string]interface{} {
+	values := make(map[string]interface{}, len(e.Data)+2)
+	for key, value := range e.Data {
+		values[key] = value
+	}
+	values["host"] = e.Host
+	values["resource"] = e.ResourceID
+	return values
+}
+
+// ModuleExports returns the resources a module exports when applied to a host
+func ModuleExports(module *Module, host string) []ExportedResource {
+	var exports []ExportedResource
+	for _, resource := range module.Spec.Resources {
+		if resource.Export == nil {
+			continue
+		}
+		exports = append(exports, ExportedResource{
+			Host:       host,
+			Module:     module.Metadata.Name,
+			Collection: resource.Export.Collection,
+			ResourceID: resource.ResourceID(),
+			Data:       resource.Export.Data,
+		})
+	}
+	return exports
+}
+
+// ExportStore holds exported resources from every host, keyed by host and module
+type ExportStore struct {
+	mu       sync.RWMutex
+	entries  map[string][]ExportedResource
+	filePath string
+}
+
+// NewExportStore creates an empty in-memory export store
+func NewExportStore() *ExportStore {
+	return &ExportStore{
+		entries: make(map[string][]ExportedResource),
+	}
+}
+
+// LoadExportStore loads exported resources from a YAML file. A missing file
+// yields an empty store that will be created on Save.
+func LoadExportStore(filename string) (*ExportStore, error) {
+	store := NewExportStore()
+	store.filePath = filename
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return store, nil
+		}
+		return nil, fmt.Errorf("failed to read exports file %s: %w", filename, err)
+	}
+
+	var exports []ExportedResource
+	if err := yaml.Unmarshal(data, &exports); err != nil {
+		return nil, fmt.Errorf("failed to parse exports file %s: %w", filename, err)
+	}
+
+	for _, export := range exports {
+		if export.Host == "" || export.Collection == "" {
+			return nil, fmt.Errorf("invalid exports file %s: entry without host or collection", filename)
+		}
+		key := exportKey(export.Host, export.Module)
+		store.entries[key] = append(store.entries[key], export)
+	}
+
+	return store, nil
+}
+
+// Save writes the store back to the file it was loaded from
+func (s *ExportStore) Save() error {
+	if s.filePath == "" {
+		return fmt.Errorf("export store has no backing file")
+	}
+	return s.SaveToFile(s.filePath)
+}
+
+// SaveToFile writes the store to a YAML file
+func (s *ExportStore) SaveToFile(filename string) error {
+	data, err := yaml.Marshal(s.List())
+	if err != nil {
+		return fmt.Errorf("failed to marshal exports: %w", err)
+	}
+
+	if dir := filepath.Dir(filename); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", filename, err)
+		}
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write exports file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// Replace sets the exports of a module on a host, dropping what it exported before
+func (s *ExportStore) Replace(host, module string, exports []ExportedResource) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := exportKey(host, module)
+	if len(exports) == 0 {
+		delete(s.entries, key)
+		return
+	}
+	s.entries[key] = append([]ExportedResource(nil), exports...)
+}
+
+// Clone returns an in-memory copy of the store, e.g. to overlay pending exports during planning
+func (s *ExportStore) Clone() *ExportStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	clone := NewExportStore()
+	for key, exports := range s.entries {
+		clone.entries[key] = append([]ExportedResource(nil), exports...)
+	}
+	return clone
+}
+
+// List returns every exported resource sorted by collection, host and resource
+func (s *ExportStore) List() []ExportedResource {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var exports []ExportedResource
+	for _, entries := range s.entries {
+		exports = append(exports, entries...)
+	}
+	sort.Slice(exports, func(i, j int) bool {
+		a, b := exports[i], exports[j]
+		if a.Collection != b.Collection {
+			return a.Collection < b.Collection
+		}
+		if a.Host != b.Host {
+			return a.Host < b.Host
+		}
+		return a.ResourceID < b.ResourceID
+	})
+	return exports
+}
+
+// Collect returns the exported resources in a collection, sorted by host and resource
+func (s *ExportStore) Collect(collection string) []ExportedResource {
+	var collected []ExportedResource
+	for _, export := range s.List() {
+		if export.Collection == collection {
+			collected = append(collected, export)
+		}
+	}
+	return collected
+}
+
+// withCollected returns a copy of the resource whose template vars include the
+// collections it collects under "exports", e.g. {{ range .exports.backends }}
+func withCollected(resource types.Resource, store *ExportStore) types.Resource {
+	if len(resource.Collect) == 0 {
+		return resource
+	}
+	if store == nil {
+		store = NewExportStore()
+	}
+
+	collections := make(map[string]interface{}, len(resource.Collect))
+	for _, collection := range resource.Collect {
+		values := make([]interface{}, 0)
+		for _, export := range store.Collect(collection) {
+			values = append(values, export.Values())
+		}
+		collections[collection] = values
+	}
+
+	vars := make(map[string]interface{})
+	if existing, ok := resource.Properties["vars"].(map[string]interface{}); ok {
+		for key, value := range existing {
+			vars[key] = value
+		}
+	}
+	vars["exports"] = collections
+
+	properties := make(map[string]interface{}, len(resource.Properties)+1)
+	for key, value := range resource.Properties {
+		properties[key] = value
+	}
+	properties["vars"] = vars
+	resource.Properties = properties
+
+	return resource
+}
+
+// exportKey identifies the exports of one module on one host
+func exportKey(host, module string) string {
+	return host + "/" + module
+}
@@ -0,0 +1,140 @@
+package core
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func exportingModule() *Module {
+	return &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "app", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{
+					Type:   "service",
+					Name:   "app",
+					Export: &types.Export{Collection: "backends", Data: map[string]interface{}{"port": 8080}},
+				},
+				{Type: "pkg", Name: "nginx"},
+			},
+		},
+	}
+}
+
+func TestModuleExports(t *testing.T) {
+	exports := ModuleExports(exportingModule(), "web1")
+	if len(exports) != 1 {
+		t.Fatalf("Expected 1 export, got %d", len(exports))
+	}
+
+	values := exports[0].Values()
+	if values["host"] != "web1" || values["resource"] != "service.app" || values["port"] != 8080 {
+		t.Errorf("Unexpected export values %v", values)
+	}
+}
+
+func TestExportStore_Collect(t *testing.T) {
+	store := NewExportStore()
+	store.Replace("web2", "app", ModuleExports(exportingModule(), "web2"))
+	store.Replace("web1", "app", ModuleExports(exportingModule(), "web1"))
+	store.Replace("db1", "db", []ExportedResource{{Host: "db1", Module: "db", Collection: "databases", ResourceID: "service.postgres"}})
+
+	backends := store.Collect("backends")
+	if len(backends) != 2 || backends[0].Host != "web1" || backends[1].Host != "web2" {
+		t.Fatalf("Collect() = %+v, want web1 and web2 in order", backends)
+	}
+
+	// Replacing with nothing withdraws the host's exports
+	store.Replace("web2", "app", nil)
+	if got := store.Collect("backends"); len(got) != 1 {
+		t.Errorf("Expected 1 backend after withdrawal, got %d", len(got))
+	}
+
+	// Clones are independent
+	clone := store.Clone()
+	clone.Replace("web3", "app", ModuleExports(exportingModule(), "web3"))
+	if len(store.Collect("backends")) != 1 || len(clone.Collect("backends")) != 2 {
+		t.Error("Expected clone changes not to affect the original store")
+	}
+}
+
+func TestExportStore_SaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", "exports.yaml")
+
+	store, err := LoadExportStore(filename)
+	if err != nil {
+		t.Fatalf("LoadExportStore() error = %v", err)
+	}
+	store.Replace("web1", "app", ModuleExports(exportingModule(), "web1"))
+	if err := store.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadExportStore(filename)
+	if err != nil {
+		t.Fatalf("LoadExportStore() error = %v", err)
+	}
+	backends := loaded.Collect("backends")
+	if len(backends) != 1 || backends[0].Data["port"] != 8080 {
+		t.Errorf("Unexpected loaded exports %+v", backends)
+	}
+
+	if err := NewExportStore().Save(); err == nil {
+		t.Error("Expected error saving store without backing file")
+	}
+}
+
+func TestPlanner_CollectsExports(t *testing.T) {
+	store := NewExportStore()
+	store.Replace("web1", "app", ModuleExports(exportingModule(), "web1"))
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "lb", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{
+					Type:    "mock",
+					Name:    "haproxy",
+					Collect: []string{"backends", "databases"},
+					Properties: map[string]interface{}{
+						"vars": map[string]interface{}{"mode": "http"},
+					},
+				},
+			},
+		},
+	}
+
+	registry := types.NewProviderRegistry()
+	registry.Register(&countingProvider{resourceType: "mock", applied: map[string]int{}})
+
+	planner := NewPlanner(registry)
+	planner.SetExports(store)
+
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+
+	vars := plan.Changes[0].Resource.Properties["vars"].(map[string]interface{})
+	if vars["mode"] != "http" {
+		t.Errorf("Expected existing vars to be kept, got %v", vars)
+	}
+	exports := vars["exports"].(map[string]interface{})
+	if backends := exports["backends"].([]interface{}); len(backends) != 1 {
+		t.Errorf("Expected 1 collected backend, got %v", backends)
+	}
+	if databases := exports["databases"].([]interface{}); len(databases) != 0 {
+		t.Errorf("Expected empty collection for databases, got %v", databases)
+	}
+
+	// The module itself is not modified
+	if _, ok := module.Spec.Resources[0].Properties["vars"].(map[string]interface{})["exports"]; ok {
+		t.Error("Expected module resource vars to be left untouched")
+	}
+}
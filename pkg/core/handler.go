@@ -0,0 +1,133 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Handler is a resource that runs once at the end of an apply, and only when
+// a resource that notifies it has changed
+type Handler struct {
+	Name     string         `yaml:"name" json:"name"`
+	Resource types.Resource `yaml:"resource" json:"resource"`
+}
+
+// Validate validates the handler configuration
+func (h *Handler) Validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("name is required")
+	}
+	if err := h.Resource.Validate(); err != nil {
+		return fmt.Errorf("resource: %w", err)
+	}
+	return nil
+}
+
+// validateHandlers checks handler names are unique and every notify target exists
+func validateHandlers(handlers []Handler, resources []types.Resource) error {
+	names := make(map[string]bool, len(handlers))
+	for i := range handlers {
+		if err := handlers[i].Validate(); err != nil {
+			return fmt.Errorf("handler[%d]: %w", i, err)
+		}
+		if names[handlers[i].Name] {
+			return fmt.Errorf("duplicate handler %s", handlers[i].Name)
+		}
+		names[handlers[i].Name] = true
+	}
+
+	for i := range resources {
+		for _, name := range resources[i].Notify {
+			if !names[name] {
+				return fmt.Errorf("resource %s notifies unknown handler %s", resources[i].ResourceID(), name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// NotifiedHandlers returns the handlers notified by changes that were applied
+// successfully, in the order the handlers are defined. Each handler is returned once.
+func (p *Plan) NotifiedHandlers(result *ExecutionResult) []Handler {
+	notified := make(map[string]bool)
+	for _, changeResult := range result.Changes {
+		if !changeResult.Success || changeResult.Handler != "" || changeResult.Change.Action == ActionNoOp {
+			continue
+		}
+		for _, name := range changeResult.Change.Resource.Notify {
+			notified[name] = true
+		}
+	}
+
+	handlers := make([]Handler, 0, len(notified))
+	for _, handler := range p.Handlers {
+		if notified[handler.Name] {
+			handlers = append(handlers, handler)
+		}
+	}
+	return handlers
+}
+
+// RunHandlers runs the handlers notified during execution and adds their results
+func (e *Executor) RunHandlers(ctx context.Context, plan *Plan, result *ExecutionResult) {
+	for _, handler := range plan.NotifiedHandlers(result) {
+		handled := e.runHandler(ctx, handler)
+		result.AddChangeResult(handled)
+		StreamResult(ctx, handled)
+	}
+}
+
+// runHandler plans and applies a single handler resource
+func (e *Executor) runHandler(ctx context.Context, handler Handler) ChangeResult {
+	resource := handler.Resource
+	result := ChangeResult{
+		Change:    Change{Action: ActionUpdate, Resource: resource},
+		Handler:   handler.Name,
+		StartTime: time.Now(),
+	}
+
+	finish := func(err error) ChangeResult {
+		result.Success = err == nil
+		if err != nil {
+			result.Error = fmt.Errorf("handler %s: %w", handler.Name, err)
+		}
+		result.EndTime = time.Now()
+		result.Duration = result.EndTime.Sub(result.StartTime)
+		return result
+	}
+
+	provider, err := e.registry.Get(resource.Type)
+	if err != nil {
+		return finish(fmt.Errorf("no provider found for resource type: %s", resource.Type))
+	}
+	resource, err = WithSecrets(resource)
+	if err != nil {
+		return finish(fmt.Errorf("failed to resolve secrets: %w", err))
+	}
+	if err := provider.Validate(&resource); err != nil {
+		return finish(fmt.Errorf("resource validation failed: %w", err))
+	}
+
+	current, err := provider.Read(ctx, &resource)
+	if err != nil {
+		return finish(fmt.Errorf("failed to read current state: %w", err))
+	}
+	diff, err := provider.Diff(ctx, &resource, current)
+	if err != nil {
+		return finish(fmt.Errorf("failed to calculate diff: %w", err))
+	}
+	result.Change.Diff = diff
+
+	if diff.Action == types.ActionNoop {
+		result.Change.Action = ActionNoOp
+		return finish(nil)
+	}
+	if err := provider.Apply(ctx, &resource, diff); err != nil {
+		return finish(fmt.Errorf("failed to apply change: %w", err))
+	}
+	return finish(nil)
+}
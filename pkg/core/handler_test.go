@@ -0,0 +1,132 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// countingProvider always reports a pending update and counts applies per resource
+type countingProvider struct {
+	resourceType string
+	applied      map[string]int
+}
+
+func (p *countingProvider) Type() string { return p.resourceType }
+
+func (p *countingProvider) Validate(resource *types.Resource) error { return nil }
+
+func (p *countingProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (p *countingProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	return &types.ResourceDiff{ResourceID: resource.ResourceID(), Action: types.ActionUpdate}, nil
+}
+
+func (p *countingProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	p.applied[resource.ResourceID()]++
+	return nil
+}
+
+func TestModule_ValidateHandlers(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []types.Resource
+		handlers  []Handler
+		wantErr   string
+	}{
+		{
+			name:      "valid notify",
+			resources: []types.Resource{{Type: "file", Name: "conf", Notify: []string{"restart-nginx"}}},
+			handlers:  []Handler{{Name: "restart-nginx", Resource: types.Resource{Type: "service", Name: "nginx"}}},
+		},
+		{
+			name:      "unknown handler",
+			resources: []types.Resource{{Type: "file", Name: "conf", Notify: []string{"restart-nginx"}}},
+			wantErr:   "notifies unknown handler restart-nginx",
+		},
+		{
+			name: "duplicate handler",
+			handlers: []Handler{
+				{Name: "restart-nginx", Resource: types.Resource{Type: "service", Name: "nginx"}},
+				{Name: "restart-nginx", Resource: types.Resource{Type: "service", Name: "nginx"}},
+			},
+			wantErr: "duplicate handler restart-nginx",
+		},
+		{
+			name:     "handler without name",
+			handlers: []Handler{{Resource: types.Resource{Type: "service", Name: "nginx"}}},
+			wantErr:  "name is required",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module := &Module{
+				APIVersion: "ataiva.com/chisel/v1",
+				Kind:       "Module",
+				Metadata:   ModuleMetadata{Name: "test", Version: "1.0.0"},
+				Spec:       ModuleSpec{Resources: tt.resources, Handlers: tt.handlers},
+			}
+
+			err := module.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExecutor_RunHandlers(t *testing.T) {
+	provider := &countingProvider{resourceType: "test", applied: make(map[string]int)}
+	registry := types.NewProviderRegistry()
+	if err := registry.Register(provider); err != nil {
+		t.Fatalf("Failed to register provider: %v", err)
+	}
+
+	plan := NewPlan()
+	plan.Handlers = []Handler{
+		{Name: "restart", Resource: types.Resource{Type: "test", Name: "restart"}},
+		{Name: "reload", Resource: types.Resource{Type: "test", Name: "reload"}},
+	}
+	plan.AddChange(Change{
+		Action:   ActionUpdate,
+		Resource: types.Resource{Type: "test", Name: "a", Notify: []string{"restart"}},
+		Diff:     &types.ResourceDiff{Action: types.ActionUpdate},
+	})
+	plan.AddChange(Change{
+		Action:   ActionUpdate,
+		Resource: types.Resource{Type: "test", Name: "b", Notify: []string{"restart"}},
+		Diff:     &types.ResourceDiff{Action: types.ActionUpdate},
+	})
+	plan.AddChange(Change{
+		Action:   ActionNoOp,
+		Resource: types.Resource{Type: "test", Name: "c", Notify: []string{"reload"}},
+	})
+
+	result, err := NewExecutor(registry).ExecutePlan(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if provider.applied["test.restart"] != 1 {
+		t.Errorf("Expected restart handler to run once, ran %d times", provider.applied["test.restart"])
+	}
+	if provider.applied["test.reload"] != 0 {
+		t.Errorf("Expected reload handler not to run for unchanged resource")
+	}
+
+	last := result.Changes[len(result.Changes)-1]
+	if last.Handler != "restart" || !last.Success {
+		t.Errorf("Expected successful restart handler result last, got %+v", last)
+	}
+}
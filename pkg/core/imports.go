@@ -0,0 +1,314 @@
+package core
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// importTimeout bounds fetching a module imported by URL
+const importTimeout = 30 * time.Second
+
+// moduleSourcePrefix marks an import of an installed module, as module:<name>
+const moduleSourcePrefix = "module:"
+
+// importNamePattern is what an import name may look like; it prefixes
+// resource and handler names, so it cannot contain dots
+var importNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// ModuleResolver returns the module file of an installed module
+type ModuleResolver func(name string) (string, error)
+
+var (
+	moduleResolverMu sync.Mutex
+	moduleResolver   ModuleResolver
+)
+
+// SetModuleResolver sets how module:<name> import sources find installed
+// modules. nil leaves them unresolvable.
+func SetModuleResolver(resolve ModuleResolver) {
+	moduleResolverMu.Lock()
+	defer moduleResolverMu.Unlock()
+	moduleResolver = resolve
+}
+
+// Import composes another module file into a module
+type Import struct {
+	// Name namespaces the imported resources, as <type>.<name>.<resource>,
+	// and handlers, as <name>.<handler>, and tags the imported resources
+	Name string `yaml:"name"`
+	// Source is a module file path, relative to the importing module, an
+	// http(s) URL, or module:<name> for a module installed from a registry
+	Source string `yaml:"source"`
+	// Checksum pins the source as a SHA-256 hex digest, optionally prefixed
+	// with "sha256:"
+	Checksum string `yaml:"checksum,omitempty"`
+	// Vars override the imported module's variables; they can reference the
+	// importing module's variables as ${var:name}
+	Vars map[string]interface{} `yaml:"vars,omitempty"`
+}
+
+// Validate validates the import
+func (i *Import) Validate() error {
+	if !importNamePattern.MatchString(i.Name) {
+		return fmt.Errorf("name %q must be letters, digits, '_' and '-'", i.Name)
+	}
+	if i.Source == "" {
+		return fmt.Errorf("source is required")
+	}
+	return nil
+}
+
+// isURL reports whether a module source is fetched over HTTP
+func isURL(source string) bool {
+	return strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://")
+}
+
+// location resolves the import's source against the module importing it
+func (i *Import) location(importer string) (string, error) {
+	if name, ok := strings.CutPrefix(i.Source, moduleSourcePrefix); ok {
+		moduleResolverMu.Lock()
+		resolve := moduleResolver
+		moduleResolverMu.Unlock()
+		if resolve == nil {
+			return "", fmt.Errorf("installed modules are not available")
+		}
+		return resolve(name)
+	}
+	if isURL(i.Source) {
+		return i.Source, nil
+	}
+	if isURL(importer) {
+		base, err := url.Parse(importer)
+		if err != nil {
+			return "", err
+		}
+		ref, err := url.Parse(i.Source)
+		if err != nil {
+			return "", err
+		}
+		return base.ResolveReference(ref).String(), nil
+	}
+	source := i.Source
+	if !filepath.IsAbs(source) {
+		source = filepath.Join(filepath.Dir(importer), source)
+	}
+	return filepath.Abs(source)
+}
+
+// resolveImports loads the modules m imports, recursively, and merges them
+// into m. Each imported module has its variables resolved with the
+// import's vars; references to m's variables pass through to be resolved
+// with m's. stack holds the modules being imported, to detect cycles.
+func (m *Module) resolveImports(source string, stack []string) error {
+	names := make(map[string]bool, len(m.Spec.Imports))
+	var resources []types.Resource
+	var handlers []Handler
+	for i := range m.Spec.Imports {
+		imp := &m.Spec.Imports[i]
+		if err := imp.Validate(); err != nil {
+			return fmt.Errorf("spec.imports[%d]: %w", i, err)
+		}
+		if names[imp.Name] {
+			return fmt.Errorf("spec.imports: duplicate import %s", imp.Name)
+		}
+		names[imp.Name] = true
+
+		location, err := imp.location(source)
+		if err != nil {
+			return fmt.Errorf("import %s: invalid source %s: %w", imp.Name, imp.Source, err)
+		}
+		for j, importing := range stack {
+			if importing == location {
+				return fmt.Errorf("import cycle: %s", strings.Join(append(stack[j:], location), " -> "))
+			}
+		}
+
+		imported, err := loadImport(location, imp.Checksum, m.encrypted)
+		if err != nil {
+			return fmt.Errorf("import %s: %w", imp.Name, err)
+		}
+		if err := imported.resolveImports(location, append(append([]string(nil), stack...), location)); err != nil {
+			return fmt.Errorf("import %s: %w", imp.Name, err)
+		}
+		if err := imported.ResolveVars(imp.Vars); err != nil {
+			return fmt.Errorf("import %s: %w", imp.Name, err)
+		}
+		if !isURL(location) {
+			imported.rebasePaths(filepath.Dir(location))
+		}
+
+		namespaced := imported.namespace(imp.Name)
+		resources = append(resources, namespaced.Spec.Resources...)
+		handlers = append(handlers, namespaced.Spec.Handlers...)
+		m.mergePreflight(imported.Spec.Preflight)
+		if err := m.mergeRequires(imported.Spec.Requires); err != nil {
+			return fmt.Errorf("import %s: %w", imp.Name, err)
+		}
+	}
+
+	m.Spec.Resources = append(resources, m.Spec.Resources...)
+	m.Spec.Handlers = append(handlers, m.Spec.Handlers...)
+	m.Spec.Imports = nil
+	return nil
+}
+
+// namespace prefixes the names of the module's resources and handlers, and
+// the depends_on and notify entries pointing at them, with name and tags its
+// resources with it
+func (m *Module) namespace(name string) *Module {
+	resources := make([]*types.Resource, 0, len(m.Spec.Resources)+len(m.Spec.Handlers))
+	for i := range m.Spec.Resources {
+		resources = append(resources, &m.Spec.Resources[i])
+	}
+	for i := range m.Spec.Handlers {
+		handler := &m.Spec.Handlers[i]
+		handler.Name = name + "." + handler.Name
+		resources = append(resources, &handler.Resource)
+	}
+
+	renamed := make(map[string]string, len(resources))
+	for _, resource := range resources {
+		id := resource.ResourceID()
+		if resource.Import == "" {
+			resource.Import = name
+		} else {
+			resource.Import = name + "." + resource.Import
+		}
+		renamed[id] = resource.ResourceID()
+	}
+	for _, resource := range resources {
+		namespaceResource(resource, name, renamed)
+	}
+	return m
+}
+
+// namespaceResource rewrites a resource's depends_on and notify entries and
+// tags for an import. Dependencies on resources the import does not declare
+// are left for the importing module to provide.
+func namespaceResource(resource *types.Resource, name string, renamed map[string]string) {
+	for i, dependency := range resource.DependsOn {
+		if id, ok := renamed[dependency]; ok {
+			resource.DependsOn[i] = id
+		}
+	}
+	for i, handler := range resource.Notify {
+		resource.Notify[i] = name + "." + handler
+	}
+	for _, tag := range resource.Tags {
+		if tag == name {
+			return
+		}
+	}
+	resource.Tags = append(resource.Tags, name)
+}
+
+// rebasePaths makes the relative paths of an imported module's files,
+// templates and packages relative to dir, the imported module's directory,
+// as they are to the module file rather than to where forge runs
+func (m *Module) rebasePaths(dir string) {
+	rebase := func(resource *types.Resource) {
+		var keys []string
+		switch resource.Type {
+		case "file":
+			keys = []string{"template_file", "source"}
+		case "pkg", "sync":
+			keys = []string{"source"}
+		}
+		for _, key := range keys {
+			value, ok := resource.Properties[key].(string)
+			// A value starting with a variable may well be absolute
+			if !ok || value == "" || filepath.IsAbs(value) || strings.Contains(value, "://") || strings.HasPrefix(value, "${") {
+				continue
+			}
+			resource.Properties[key] = filepath.Join(dir, value)
+		}
+	}
+	for i := range m.Spec.Resources {
+		rebase(&m.Spec.Resources[i])
+	}
+	for i := range m.Spec.Handlers {
+		rebase(&m.Spec.Handlers[i].Resource)
+	}
+}
+
+// mergePreflight adds an imported module's preflight checks to m's. A kernel
+// constraint set by m takes precedence.
+func (m *Module) mergePreflight(imported *Preflight) {
+	if imported == nil {
+		return
+	}
+	if m.Spec.Preflight == nil {
+		m.Spec.Preflight = &Preflight{}
+	}
+	if m.Spec.Preflight.Kernel == "" {
+		m.Spec.Preflight.Kernel = imported.Kernel
+	}
+	m.Spec.Preflight.Disk = append(m.Spec.Preflight.Disk, imported.Disk...)
+	m.Spec.Preflight.ForbiddenProcesses = append(m.Spec.Preflight.ForbiddenProcesses, imported.ForbiddenProcesses...)
+}
+
+// mergeRequires adds an imported module's host requirements to m's
+func (m *Module) mergeRequires(imported *Requirements) error {
+	if imported == nil {
+		return nil
+	}
+	if m.Spec.Requires == nil {
+		m.Spec.Requires = &Requirements{}
+	}
+	return m.Spec.Requires.merge(imported)
+}
+
+// loadImport reads and parses an imported module file, verifying its
+// checksum when one is given
+func loadImport(location, checksum string, encrypted bool) (*Module, error) {
+	var data []byte
+	var err error
+	if isURL(location) {
+		data, err = fetchImport(location)
+	} else {
+		data, err = os.ReadFile(location)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read module %s: %w", location, err)
+	}
+
+	if checksum = strings.ToLower(strings.TrimPrefix(checksum, "sha256:")); checksum != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != checksum {
+			return nil, fmt.Errorf("module %s has checksum %s, expected %s", location, actual, checksum)
+		}
+	}
+	return decodeModule(location, data, encrypted)
+}
+
+// fetchImport downloads a module imported by URL
+func fetchImport(rawURL string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
@@ -0,0 +1,236 @@
+package core
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const moduleHeader = "apiVersion: ataiva.com/chisel/v1\nkind: Module\nmetadata:\n  name: %s\n  version: 1.0.0\n"
+
+// writeModules writes module files, named by their key, into a directory
+func writeModules(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for name, spec := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		content := strings.Replace(moduleHeader, "%s", strings.TrimSuffix(filepath.Base(name), ".yaml"), 1) + spec
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+// webModule is a reusable nginx module with a port variable and a handler
+const webModule = `spec:
+  vars:
+    port: 80
+  resources:
+    - type: pkg
+      name: nginx
+      state: present
+    - type: file
+      name: nginx-conf
+      path: /etc/nginx/conf.d/site.conf
+      content: "listen ${var:port};"
+      depends_on: [pkg.nginx]
+      notify: [restart]
+    - type: file
+      name: logo
+      path: /var/www/logo.png
+      source: files/logo.png
+  handlers:
+    - name: restart
+      resource:
+        type: service
+        name: nginx
+        state: restarted
+`
+
+func TestLoadModuleFromFile_Imports(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"modules/web.yaml": webModule,
+		"site.yaml": `spec:
+  vars:
+    port: 8080
+  imports:
+    - name: web
+      source: modules/web.yaml
+      vars:
+        port: ${var:port}
+    - name: admin
+      source: modules/web.yaml
+  resources:
+    - type: file
+      name: index
+      path: /var/www/index.html
+      content: hello
+      depends_on: [pkg.web.nginx]
+      notify: [web.restart]
+`,
+	})
+
+	module, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if len(module.Spec.Imports) != 0 {
+		t.Errorf("Imports = %v, want them composed in", module.Spec.Imports)
+	}
+	var ids []string
+	for _, resource := range module.Spec.Resources {
+		ids = append(ids, resource.ResourceID())
+	}
+	want := "pkg.web.nginx,file.web.nginx-conf,file.web.logo,pkg.admin.nginx,file.admin.nginx-conf,file.admin.logo,file.index"
+	if got := strings.Join(ids, ","); got != want {
+		t.Errorf("resources = %s, want the imported ones first, namespaced", got)
+	}
+	conf := module.Spec.Resources[1]
+	if len(conf.Tags) != 1 || conf.Tags[0] != "web" || conf.Notify[0] != "web.restart" || conf.DependsOn[0] != "pkg.web.nginx" {
+		t.Errorf("imported resource = %+v, want it tagged, depending on pkg.web.nginx and notifying web.restart", conf)
+	}
+	if conf.Name != "nginx-conf" || module.Spec.Handlers[0].Resource.Name != "nginx" {
+		t.Errorf("imported names = %s, %s, want them kept for the providers", conf.Name, module.Spec.Handlers[0].Resource.Name)
+	}
+	if module.Spec.Handlers[0].Name != "web.restart" || module.Spec.Handlers[1].Name != "admin.restart" {
+		t.Errorf("handlers = %s, %s, want web.restart and admin.restart", module.Spec.Handlers[0].Name, module.Spec.Handlers[1].Name)
+	}
+	if got := module.Spec.Resources[2].Properties["source"]; got != filepath.Join(dir, "modules", "files", "logo.png") {
+		t.Errorf("source = %v, want it next to the imported module", got)
+	}
+
+	if err := module.ResolveVars(map[string]interface{}{"port": 9000}); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+	if got := module.Spec.Resources[1].Properties["content"]; got != "listen 9000;" {
+		t.Errorf("content = %v, want the importer's port", got)
+	}
+}
+
+func TestLoadModuleFromFile_ImportErrors(t *testing.T) {
+	sum := sha256.Sum256([]byte("other"))
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  string
+	}{
+		{
+			name: "cycle",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: a\n      source: a.yaml\n  resources: []\n",
+				"a.yaml":    "spec:\n  imports:\n    - name: site\n      source: site.yaml\n  resources: []\n",
+			},
+			want: "import cycle:",
+		},
+		{
+			name: "checksum",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: web\n      source: web.yaml\n      checksum: sha256:" + hex.EncodeToString(sum[:]) + "\n  resources: []\n",
+				"web.yaml":  webModule,
+			},
+			want: "expected " + hex.EncodeToString(sum[:]),
+		},
+		{
+			name: "imported resource by its own id",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: web\n      source: web.yaml\n  resources:\n    - type: file\n      name: index\n      path: /var/www/index.html\n      depends_on: [pkg.nginx]\n",
+				"web.yaml":  webModule,
+			},
+			want: "depends on unknown resource pkg.nginx",
+		},
+		{
+			name: "undeclared variable",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: web\n      source: web.yaml\n      vars:\n        listen: 80\n  resources: []\n",
+				"web.yaml":  webModule,
+			},
+			want: "import web: variable listen is not declared",
+		},
+		{
+			name: "invalid name",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: web.app\n      source: web.yaml\n  resources: []\n",
+			},
+			want: "spec.imports[0]: name \"web.app\"",
+		},
+		{
+			name: "missing file",
+			files: map[string]string{
+				"site.yaml": "spec:\n  imports:\n    - name: web\n      source: web.yaml\n  resources: []\n",
+			},
+			want: "import web: failed to read module",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := writeModules(t, tt.files)
+			_, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("LoadModuleFromFile = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadModuleFromFile_ImportURL(t *testing.T) {
+	base := strings.Replace(moduleHeader, "%s", "base", 1) + "spec:\n  resources:\n    - type: pkg\n      name: curl\n      state: present\n"
+	web := strings.Replace(moduleHeader, "%s", "web", 1) + "spec:\n  imports:\n    - name: base\n      source: base.yaml\n  resources: []\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/modules/web.yaml":
+			w.Write([]byte(web))
+		case "/modules/base.yaml":
+			w.Write([]byte(base))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	sum := sha256.Sum256([]byte(web))
+	dir := writeModules(t, map[string]string{
+		"site.yaml": "spec:\n  imports:\n    - name: web\n      source: " + server.URL + "/modules/web.yaml\n      checksum: " + hex.EncodeToString(sum[:]) + "\n  resources: []\n",
+	})
+	module, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if len(module.Spec.Resources) != 1 || module.Spec.Resources[0].ResourceID() != "pkg.web.base.curl" {
+		t.Fatalf("resources = %+v, want pkg.web.base.curl from the nested import", module.Spec.Resources)
+	}
+	if tags := strings.Join(module.Spec.Resources[0].Tags, ","); tags != "base,web" {
+		t.Errorf("tags = %s, want both imports", tags)
+	}
+}
+
+func TestLoadModuleFromFile_ImportInstalled(t *testing.T) {
+	dir := writeModules(t, map[string]string{
+		"cache/web/1.2.0/module.yaml": webModule,
+		"site.yaml":                   "spec:\n  imports:\n    - name: web\n      source: module:web\n  resources: []\n",
+	})
+	if _, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml")); err == nil || !strings.Contains(err.Error(), "installed modules are not available") {
+		t.Errorf("LoadModuleFromFile without a resolver = %v", err)
+	}
+
+	SetModuleResolver(func(name string) (string, error) {
+		return filepath.Join(dir, "cache", name, "1.2.0", "module.yaml"), nil
+	})
+	defer SetModuleResolver(nil)
+	module, err := LoadModuleFromFile(filepath.Join(dir, "site.yaml"))
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if len(module.Spec.Resources) != 3 || module.Spec.Handlers[0].Name != "web.restart" {
+		t.Errorf("module = %+v, want the installed module imported", module.Spec)
+	}
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// itemPattern matches ${item} references to the current loop item; dots
+// reach into map items, as in ${item.name}
+var itemPattern = regexp.MustCompile(`\$\{item((?:\.[A-Za-z0-9_-]+)*)\}`)
+
+// loopItems returns the items a resource loops over, nil when it has no loop
+func loopItems(resource *types.Resource) (interface{}, error) {
+	if resource.WithItems != nil && resource.Loop != nil {
+		return nil, fmt.Errorf("with_items and loop cannot both be set")
+	}
+	if resource.WithItems != nil {
+		return resource.WithItems, nil
+	}
+	return resource.Loop, nil
+}
+
+// hasLoops reports whether any resource is still to be expanded
+func (m *Module) hasLoops() bool {
+	for i := range m.Spec.Resources {
+		if m.Spec.Resources[i].WithItems != nil || m.Spec.Resources[i].Loop != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// expandLoops replaces every resource with a with_items or loop list by one
+// resource per item, in place. The list is given inline or as a single
+// ${var:name} reference; ${item} and ${item.field} references in the
+// resource's name and properties take each item's values.
+func (m *Module) expandLoops() error {
+	if !m.hasLoops() {
+		return nil
+	}
+	expanded := make([]types.Resource, 0, len(m.Spec.Resources))
+	for _, resource := range m.Spec.Resources {
+		items, err := loopItems(&resource)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", resource.ResourceID(), err)
+		}
+		if items == nil {
+			expanded = append(expanded, resource)
+			continue
+		}
+		resources, err := m.expandLoop(resource, items)
+		if err != nil {
+			return fmt.Errorf("resource %s: %w", resource.ResourceID(), err)
+		}
+		expanded = append(expanded, resources...)
+	}
+	m.Spec.Resources = expanded
+	return nil
+}
+
+// expandLoop returns the resources a loop expands into
+func (m *Module) expandLoop(resource types.Resource, items interface{}) ([]types.Resource, error) {
+	items, err := m.interpolate(items)
+	if err != nil {
+		return nil, fmt.Errorf("with_items: %w", err)
+	}
+	list, ok := items.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("with_items must be a list or a ${var:name} reference to one, got %T", items)
+	}
+	if !itemPattern.MatchString(resource.Name) {
+		return nil, fmt.Errorf("the name of a looped resource must reference ${item} so each item gets its own resource")
+	}
+
+	resource.WithItems, resource.Loop = nil, nil
+	resources := make([]types.Resource, 0, len(list))
+	for i, item := range list {
+		expanded, err := withItem(resource, item)
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %w", i, err)
+		}
+		resources = append(resources, expanded)
+	}
+	return resources, nil
+}
+
+// withItem returns a copy of the resource with its item references replaced
+func withItem(resource types.Resource, item interface{}) (types.Resource, error) {
+	name, err := substituteItem(resource.Name, item)
+	if err != nil {
+		return resource, fmt.Errorf("name: %w", err)
+	}
+	resource.Name = fmt.Sprint(name)
+
+	properties, err := substituteItem(resource.Properties, item)
+	if err != nil {
+		return resource, err
+	}
+	if resource.Properties != nil {
+		resource.Properties = properties.(map[string]interface{})
+	}
+	if resource.Export != nil {
+		data, err := substituteItem(resource.Export.Data, item)
+		if err != nil {
+			return resource, fmt.Errorf("export: %w", err)
+		}
+		export := *resource.Export
+		if export.Data != nil {
+			export.Data = data.(map[string]interface{})
+		}
+		resource.Export = &export
+	}
+
+	lists := []*[]string{&resource.DependsOn, &resource.Notify, &resource.Tags, &resource.Collect}
+	for _, list := range lists {
+		values := make([]string, len(*list))
+		for i, value := range *list {
+			substituted, err := substituteItem(value, item)
+			if err != nil {
+				return resource, err
+			}
+			values[i] = fmt.Sprint(substituted)
+		}
+		if *list != nil {
+			*list = values
+		}
+	}
+	for _, condition := range []*string{&resource.OnlyIf, &resource.NotIf, &resource.When} {
+		value, err := substituteItem(*condition, item)
+		if err != nil {
+			return resource, err
+		}
+		*condition = fmt.Sprint(value)
+	}
+	resource.Defaulted = append([]string(nil), resource.Defaulted...)
+	return resource, nil
+}
+
+// substituteItem replaces item references in a value, copying maps and
+// lists. A string that is a single reference takes the item's value as is,
+// so lists and numbers keep their type.
+func substituteItem(value interface{}, item interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if match := itemPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			return lookupItem(item, match[1])
+		}
+		var err error
+		result := itemPattern.ReplaceAllStringFunc(v, func(reference string) string {
+			found, lookupErr := lookupItem(item, itemPattern.FindStringSubmatch(reference)[1])
+			if lookupErr != nil && err == nil {
+				err = lookupErr
+			}
+			return fmt.Sprint(found)
+		})
+		return result, err
+	case map[string]interface{}:
+		substituted := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			value, err := substituteItem(value, item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			substituted[key] = value
+		}
+		return substituted, nil
+	case []interface{}:
+		substituted := make([]interface{}, len(v))
+		for i, value := range v {
+			value, err := substituteItem(value, item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			substituted[i] = value
+		}
+		return substituted, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookupItem returns the value at a path such as ".name" in an item
+func lookupItem(item interface{}, path string) (interface{}, error) {
+	value := item
+	reference := "item"
+	for _, field := range strings.Split(path, ".")[1:] {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s is not a map", reference)
+		}
+		reference += "." + field
+		if value, ok = fields[field]; !ok {
+			return nil, fmt.Errorf("undefined %s", reference)
+		}
+	}
+	if value == nil {
+		return nil, fmt.Errorf("%s has no value", reference)
+	}
+	return copyDefault(value), nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestModule_ExpandLoops(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "module.yaml")
+	err := os.WriteFile(path, []byte(`apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: base
+  version: 1.0.0
+spec:
+  vars:
+    users:
+      - name: alice
+        groups: [admin, dev]
+      - name: bob
+        groups: [dev]
+  resources:
+    - type: pkg
+      name: ${item}
+      state: present
+      with_items: [git, curl]
+      tags: [tools]
+    - type: user
+      name: ${item.name}
+      state: present
+      groups: ${item.groups}
+      home: /home/${item.name}
+      depends_on: [pkg.git]
+      loop: ${var:users}
+    - type: file
+      name: motd
+      path: /etc/motd
+      content: welcome
+      depends_on: [user.alice, user.bob]
+`), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Resources depending on looped ones load before the loops are expanded
+	module, err := LoadModuleFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile: %v", err)
+	}
+	if _, err := NewPlanner(types.NewProviderRegistry()).CreatePlan(module); err == nil || !strings.Contains(err.Error(), "looped resources") {
+		t.Errorf("CreatePlan before ResolveVars = %v", err)
+	}
+	if err := module.ResolveVars(nil); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+
+	var ids []string
+	for _, resource := range module.Spec.Resources {
+		ids = append(ids, resource.ResourceID())
+		if resource.WithItems != nil || resource.Loop != nil {
+			t.Errorf("%s still loops", resource.ResourceID())
+		}
+	}
+	want := []string{"pkg.git", "pkg.curl", "user.alice", "user.bob", "file.motd"}
+	if !reflect.DeepEqual(ids, want) {
+		t.Fatalf("resources = %v, want %v", ids, want)
+	}
+	if err := module.Validate(); err != nil {
+		t.Errorf("Validate after expanding: %v", err)
+	}
+
+	alice := module.Spec.Resources[2]
+	if !reflect.DeepEqual(alice.Properties["groups"], []interface{}{"admin", "dev"}) || alice.Properties["home"] != "/home/alice" {
+		t.Errorf("alice = %v", alice.Properties)
+	}
+	bob := module.Spec.Resources[3]
+	if !reflect.DeepEqual(bob.Properties["groups"], []interface{}{"dev"}) || !reflect.DeepEqual(bob.DependsOn, []string{"pkg.git"}) {
+		t.Errorf("bob = %v depends on %v", bob.Properties, bob.DependsOn)
+	}
+	// Each expanded resource has its own copy of the lists
+	module.Spec.Resources[0].Tags[0] = "changed"
+	if module.Spec.Resources[1].Tags[0] != "tools" {
+		t.Error("expanded resources share their tags")
+	}
+}
+
+func TestModule_ExpandLoops_Errors(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource types.Resource
+		want     string
+	}{
+		{
+			name:     "name without item",
+			resource: types.Resource{Type: "pkg", Name: "tools", WithItems: []interface{}{"git"}},
+			want:     "must reference ${item}",
+		},
+		{
+			name:     "not a list",
+			resource: types.Resource{Type: "pkg", Name: "${item}", WithItems: "git"},
+			want:     "with_items must be a list",
+		},
+		{
+			name:     "both forms",
+			resource: types.Resource{Type: "pkg", Name: "${item}", WithItems: []interface{}{"git"}, Loop: []interface{}{"curl"}},
+			want:     "with_items and loop cannot both be set",
+		},
+		{
+			name:     "missing field",
+			resource: types.Resource{Type: "user", Name: "${item.name}", Loop: []interface{}{map[string]interface{}{"uid": 1000}}},
+			want:     "item 0: name: undefined item.name",
+		},
+		{
+			name:     "undefined list",
+			resource: types.Resource{Type: "pkg", Name: "${item}", WithItems: "${var:missing}"},
+			want:     "undefined variable missing",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module := &Module{Spec: ModuleSpec{Resources: []types.Resource{tt.resource}}}
+			err := module.ResolveVars(nil)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ResolveVars = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
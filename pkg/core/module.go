@@ -3,8 +3,10 @@ package core
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"regexp"
 
+	"github.com/ataiva-software/forge/pkg/inventory"
 	"github.com/ataiva-software/forge/pkg/types"
 	"gopkg.in/yaml.v3"
 )
@@ -15,6 +17,10 @@ type Module struct {
 	Kind       string         `yaml:"kind"`
 	Metadata   ModuleMetadata `yaml:"metadata"`
 	Spec       ModuleSpec     `yaml:"spec"`
+
+	// encrypted is set on modules loaded with their !vault values kept
+	// encrypted, and on the modules they import
+	encrypted bool
 }
 
 // ModuleMetadata contains metadata about the module
@@ -23,11 +29,34 @@ type ModuleMetadata struct {
 	Version     string            `yaml:"version"`
 	Description string            `yaml:"description,omitempty"`
 	Labels      map[string]string `yaml:"labels,omitempty"`
+	// Owners are the teams or people responsible for the module
+	Owners []string `yaml:"owners,omitempty"`
+	// Compliance maps compliance frameworks, such as cis-ubuntu-20.04, to
+	// the controls the module implements
+	Compliance map[string][]string `yaml:"compliance,omitempty"`
+	// DependsOn names the modules whose services this module's services
+	// depend on, such as a web module on its database module
+	DependsOn []string `yaml:"depends_on,omitempty"`
 }
 
 // ModuleSpec contains the module specification
 type ModuleSpec struct {
+	// Vars are the module's variables and their default values, referenced
+	// as ${var:name} in properties and as {{ .name }} in templates
+	Vars map[string]interface{} `yaml:"vars,omitempty"`
+	// Selector limits the module to hosts whose labels match, such as
+	// os_family=redhat AND cloud=aws. Hosts have the labels the inventory
+	// declares and those derived from their facts.
+	Selector string `yaml:"selector,omitempty"`
+	// Imports are other module files composed into this one when it is loaded
+	Imports   []Import         `yaml:"imports,omitempty"`
 	Resources []types.Resource `yaml:"resources"`
+	Handlers  []Handler        `yaml:"handlers,omitempty"`
+	Preflight *Preflight       `yaml:"preflight,omitempty"`
+	// Requires limits the hosts the module can be applied to by their facts
+	Requires *Requirements `yaml:"requires,omitempty"`
+	// Strategy rolls the module out to hosts in waves
+	Strategy *Strategy `yaml:"strategy,omitempty"`
 }
 
 // Validate validates the module configuration
@@ -62,6 +91,18 @@ func (m *Module) Validate() error {
 		return fmt.Errorf("metadata.version must be valid semver")
 	}
 
+	for _, dependency := range m.Metadata.DependsOn {
+		if dependency == "" || dependency == m.Metadata.Name {
+			return fmt.Errorf("metadata.depends_on must name other modules")
+		}
+	}
+
+	if m.Spec.Selector != "" {
+		if _, err := inventory.ParseLabelSelector(m.Spec.Selector); err != nil {
+			return fmt.Errorf("spec.selector: %w", err)
+		}
+	}
+
 	// Validate resources
 	for i, resource := range m.Spec.Resources {
 		if err := resource.Validate(); err != nil {
@@ -69,28 +110,135 @@ func (m *Module) Validate() error {
 		}
 	}
 
+	// Validate dependencies between resources; looped resources only exist
+	// once variables are resolved, so until then they are checked at plan time
+	if !m.hasLoops() {
+		if err := types.ValidateDependencies(m.Spec.Resources); err != nil {
+			return fmt.Errorf("spec.resources: %w", err)
+		}
+	}
+
+	// Validate handlers and notify references
+	if err := validateHandlers(m.Spec.Handlers, m.Spec.Resources); err != nil {
+		return fmt.Errorf("spec.handlers: %w", err)
+	}
+
+	// Validate preflight conditions
+	if m.Spec.Preflight != nil {
+		if err := m.Spec.Preflight.Validate(); err != nil {
+			return fmt.Errorf("spec.preflight: %w", err)
+		}
+	}
+
+	// Validate host requirements
+	if m.Spec.Requires != nil {
+		if err := m.Spec.Requires.Validate(); err != nil {
+			return fmt.Errorf("spec.requires: %w", err)
+		}
+	}
+
+	// Validate rollout strategy
+	if m.Spec.Strategy != nil {
+		if err := m.Spec.Strategy.Validate(); err != nil {
+			return fmt.Errorf("spec.strategy: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // LoadModuleFromFile loads a module from a YAML file
 func LoadModuleFromFile(filename string) (*Module, error) {
+	return loadModuleFile(filename, false)
+}
+
+// LoadModuleFromFileEncrypted loads a module like LoadModuleFromFile, but
+// keeps its !vault values encrypted, as their ciphertext, so the module can
+// be written out without its secrets by MarshalEncrypted
+func LoadModuleFromFileEncrypted(filename string) (*Module, error) {
+	return loadModuleFile(filename, true)
+}
+
+// loadModuleFile loads a module file and the modules it imports
+func loadModuleFile(filename string, encrypted bool) (*Module, error) {
 	data, err := os.ReadFile(filename)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read module file %s: %w", filename, err)
 	}
 
-	var module Module
-	if err := yaml.Unmarshal(data, &module); err != nil {
-		return nil, fmt.Errorf("failed to parse module file %s: %w", filename, err)
+	module, err := decodeModule(filename, data, encrypted)
+	if err != nil {
+		return nil, err
+	}
+
+	// Imports are composed in before validation, so references between
+	// the modules are checked
+	source, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve module file %s: %w", filename, err)
+	}
+	if err := module.resolveImports(source, []string{source}); err != nil {
+		return nil, fmt.Errorf("invalid module in file %s: %w", filename, err)
 	}
 
 	if err := module.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid module in file %s: %w", filename, err)
 	}
 
+	return module, nil
+}
+
+// parseModule decodes a module file read from source
+func parseModule(source string, data []byte) (*Module, error) {
+	return decodeModule(source, data, false)
+}
+
+// decodeModule decodes a module file read from source, decrypting its
+// !vault values unless they are to be kept encrypted
+func decodeModule(source string, data []byte, encrypted bool) (*Module, error) {
+	decode := decodeYAML
+	if encrypted {
+		decode = decodeYAMLEncrypted
+	}
+	module := Module{encrypted: encrypted}
+	if err := decode(data, &module); err != nil {
+		return nil, fmt.Errorf("failed to parse module file %s: %w", source, err)
+	}
+	var dir string
+	if !isURL(source) {
+		if abs, err := filepath.Abs(filepath.Dir(source)); err == nil {
+			dir = abs
+			module.setTemplateDirs(dir)
+		}
+	}
+	if err := module.loadData(dir); err != nil {
+		return nil, fmt.Errorf("invalid module in file %s: %w", source, err)
+	}
 	return &module, nil
 }
 
+// setTemplateDirs has the file templates of the module include templates
+// from dir, the module's directory, unless they set template_dir
+func (m *Module) setTemplateDirs(dir string) {
+	set := func(resource *types.Resource) {
+		if resource.Type != "file" {
+			return
+		}
+		_, hasTemplate := resource.Properties["template"]
+		_, hasTemplateFile := resource.Properties["template_file"]
+		_, hasDir := resource.Properties["template_dir"]
+		if (hasTemplate || hasTemplateFile) && !hasDir {
+			resource.Properties["template_dir"] = dir
+		}
+	}
+	for i := range m.Spec.Resources {
+		set(&m.Spec.Resources[i])
+	}
+	for i := range m.Spec.Handlers {
+		set(&m.Spec.Handlers[i].Resource)
+	}
+}
+
 // SaveModuleToFile saves a module to a YAML file
 func (m *Module) SaveToFile(filename string) error {
 	if err := m.Validate(); err != nil {
@@ -1,6 +1,8 @@
 package core
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/ataiva-software/forge/pkg/types"
@@ -124,6 +126,20 @@ func TestModule_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "metadata.version must be valid semver",
 		},
+		{
+			name: "depends on itself",
+			module: Module{
+				APIVersion: "ataiva.com/chisel/v1",
+				Kind:       "Module",
+				Metadata: ModuleMetadata{
+					Name:      "web",
+					Version:   "1.0.0",
+					DependsOn: []string{"db", "web"},
+				},
+			},
+			wantErr: true,
+			errMsg:  "metadata.depends_on must name other modules",
+		},
 	}
 
 	for _, tt := range tests {
@@ -212,3 +228,43 @@ func TestLoadModuleFromFile(t *testing.T) {
 		})
 	}
 }
+
+func TestLoadModuleFromFile_TemplateDir(t *testing.T) {
+	dir := t.TempDir()
+	module := `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: file
+      name: config
+      path: /etc/app.conf
+      template: '{{ include "partials/app.tmpl" . }}'
+    - type: file
+      name: pinned
+      path: /etc/other.conf
+      template_file: other.tmpl
+      template_dir: /srv/templates
+    - type: file
+      name: plain
+      path: /etc/plain.conf
+      content: plain
+`
+	filename := filepath.Join(dir, "module.yaml")
+	if err := os.WriteFile(filename, []byte(module), 0644); err != nil {
+		t.Fatal(err)
+	}
+	got, err := LoadModuleFromFile(filename)
+	if err != nil {
+		t.Fatalf("LoadModuleFromFile() error = %v", err)
+	}
+
+	want := map[string]interface{}{"config": dir, "pinned": "/srv/templates", "plain": nil}
+	for _, resource := range got.Spec.Resources {
+		if dir := resource.Properties["template_dir"]; dir != want[resource.Name] {
+			t.Errorf("%s template_dir = %v, want %v", resource.Name, dir, want[resource.Name])
+		}
+	}
+}
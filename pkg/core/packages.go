@@ -0,0 +1,241 @@
+package core
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// PlatformDefault is the platform key used when no other key matches a target
+const PlatformDefault = "default"
+
+// PackageCatalog maps package aliases and virtual package groups to the
+// package names of each platform, so one pkg resource installs the right
+// packages on every distribution. Platforms are keyed by distribution
+// (ubuntu, rocky), distribution family (debian, redhat), OS family (darwin)
+// or default, the most specific key winning.
+type PackageCatalog struct {
+	// Aliases name one package, such as apache: {debian: apache2, redhat: httpd}
+	Aliases map[string]map[string]string `yaml:"aliases,omitempty" mapstructure:"aliases"`
+	// Groups name several packages, which may themselves be aliases
+	Groups map[string]map[string][]string `yaml:"groups,omitempty" mapstructure:"groups"`
+}
+
+// DefaultPackageCatalog returns the built-in aliases of packages whose names
+// differ between the common distributions
+func DefaultPackageCatalog() *PackageCatalog {
+	return &PackageCatalog{
+		Aliases: map[string]map[string]string{
+			"apache":      {types.DistroDebian: "apache2", types.DistroRedHat: "httpd", types.DistroSUSE: "apache2", types.DistroArch: "apache", types.DistroAlpine: "apache2", types.OSFamilyDarwin: "httpd"},
+			"cron":        {types.DistroDebian: "cron", types.DistroRedHat: "cronie", types.DistroSUSE: "cron", types.DistroArch: "cronie", types.DistroAlpine: "cronie"},
+			"ssh-server":  {types.DistroDebian: "openssh-server", types.DistroRedHat: "openssh-server", types.DistroSUSE: "openssh-server", types.DistroArch: "openssh", types.DistroAlpine: "openssh-server"},
+			"python3-pip": {types.DistroDebian: "python3-pip", types.DistroRedHat: "python3-pip", types.DistroSUSE: "python3-pip", types.DistroArch: "python-pip", types.DistroAlpine: "py3-pip"},
+			"vim":         {types.DistroDebian: "vim", types.DistroRedHat: "vim-enhanced", types.DistroSUSE: "vim", types.DistroArch: "vim", types.DistroAlpine: "vim", types.OSFamilyDarwin: "vim"},
+		},
+		Groups: map[string]map[string][]string{
+			"build-tools": {
+				types.DistroDebian: {"build-essential"},
+				types.DistroRedHat: {"gcc", "gcc-c++", "make"},
+				types.DistroSUSE:   {"gcc", "gcc-c++", "make"},
+				types.DistroArch:   {"base-devel"},
+				types.DistroAlpine: {"build-base"},
+			},
+		},
+	}
+}
+
+// Merge adds the aliases and groups of other, replacing the platforms it
+// names and keeping the rest
+func (c *PackageCatalog) Merge(other *PackageCatalog) {
+	if other == nil {
+		return
+	}
+	if c.Aliases == nil {
+		c.Aliases = make(map[string]map[string]string)
+	}
+	if c.Groups == nil {
+		c.Groups = make(map[string]map[string][]string)
+	}
+	for name, platforms := range other.Aliases {
+		if c.Aliases[name] == nil {
+			c.Aliases[name] = make(map[string]string)
+		}
+		for platform, pkg := range platforms {
+			c.Aliases[name][platform] = pkg
+		}
+	}
+	for name, platforms := range other.Groups {
+		if c.Groups[name] == nil {
+			c.Groups[name] = make(map[string][]string)
+		}
+		for platform, packages := range platforms {
+			c.Groups[name][platform] = packages
+		}
+	}
+}
+
+// Validate checks that no name is both an alias and a group and that every
+// platform names a package
+func (c *PackageCatalog) Validate() error {
+	for _, name := range sortedKeys(c.Aliases) {
+		if _, ok := c.Groups[name]; ok {
+			return fmt.Errorf("packages: %s is both an alias and a group", name)
+		}
+		for platform, pkg := range c.Aliases[name] {
+			if strings.TrimSpace(pkg) == "" {
+				return fmt.Errorf("packages.aliases.%s.%s: package name is empty", name, platform)
+			}
+		}
+	}
+	for _, name := range sortedKeys(c.Groups) {
+		for platform, packages := range c.Groups[name] {
+			for _, pkg := range packages {
+				if strings.TrimSpace(pkg) == "" {
+					return fmt.Errorf("packages.groups.%s.%s: package name is empty", name, platform)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// Resolve returns the packages a name stands for on a target. Names that
+// are neither aliases nor groups are packages themselves. On a target whose
+// platform is unknown, nil facts, only default entries apply and names
+// without one are kept.
+func (c *PackageCatalog) Resolve(name string, facts *types.TargetFacts) ([]string, error) {
+	if c == nil {
+		return []string{name}, nil
+	}
+	if platforms, ok := c.Groups[name]; ok {
+		packages, ok := platforms[platformKey(platforms, facts)]
+		if !ok && facts == nil {
+			return []string{name}, nil
+		}
+		if !ok {
+			return nil, fmt.Errorf("package group %s has no packages for %s", name, describePlatform(facts))
+		}
+		var resolved []string
+		for _, member := range packages {
+			pkg, err := c.resolveAlias(member, facts)
+			if err != nil {
+				return nil, fmt.Errorf("package group %s: %w", name, err)
+			}
+			resolved = append(resolved, pkg)
+		}
+		return resolved, nil
+	}
+	pkg, err := c.resolveAlias(name, facts)
+	if err != nil {
+		return nil, err
+	}
+	return []string{pkg}, nil
+}
+
+// resolveAlias returns the package an alias stands for on a target
+func (c *PackageCatalog) resolveAlias(name string, facts *types.TargetFacts) (string, error) {
+	platforms, ok := c.Aliases[name]
+	if !ok {
+		return name, nil
+	}
+	pkg, ok := platforms[platformKey(platforms, facts)]
+	if !ok && facts == nil {
+		return name, nil
+	}
+	if !ok {
+		return "", fmt.Errorf("package alias %s has no package for %s", name, describePlatform(facts))
+	}
+	return pkg, nil
+}
+
+// platformKey returns the most specific key of platforms that matches the
+// target, or "" when none does
+func platformKey[V any](platforms map[string]V, facts *types.TargetFacts) string {
+	var keys []string
+	if facts != nil {
+		keys = append(keys, facts.Distribution, facts.DistroFamily, facts.OSFamily)
+	}
+	for _, key := range append(keys, PlatformDefault) {
+		if _, ok := platforms[key]; ok && key != "" {
+			return key
+		}
+	}
+	return ""
+}
+
+// describePlatform names a target's platform in errors
+func describePlatform(facts *types.TargetFacts) string {
+	if facts == nil {
+		return "a target whose platform is unknown"
+	}
+	switch {
+	case facts.Distribution != "" && facts.DistroFamily != "" && facts.DistroFamily != facts.Distribution:
+		return fmt.Sprintf("%s (%s family)", facts.Distribution, facts.DistroFamily)
+	case facts.Distribution != "":
+		return facts.Distribution
+	default:
+		return facts.OSFamily
+	}
+}
+
+// sortedKeys returns the keys of a map in order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// withPackages resolves the name of a package resource, or the packages it
+// lists, through the catalog for the target, recording the packages it
+// stands for in its packages property. Resources installed from a file keep
+// their names.
+func withPackages(resource types.Resource, catalog *PackageCatalog, facts *types.TargetFacts) (types.Resource, error) {
+	if resource.Type != "pkg" || catalog == nil {
+		return resource, nil
+	}
+	if _, ok := resource.Properties["source"]; ok {
+		return resource, nil
+	}
+	names := []string{resource.Name}
+	listed, isList := resource.Properties["packages"].([]interface{})
+	if isList {
+		names = nil
+		for _, item := range listed {
+			name, ok := item.(string)
+			if !ok {
+				// The provider rejects the list when it validates it
+				return resource, nil
+			}
+			names = append(names, name)
+		}
+	} else if _, ok := resource.Properties["packages"]; ok {
+		return resource, nil
+	}
+	var packages []string
+	for _, name := range names {
+		resolved, err := catalog.Resolve(name, facts)
+		if err != nil {
+			return resource, err
+		}
+		packages = append(packages, resolved...)
+	}
+	if !isList && len(packages) == 1 && packages[0] == resource.Name {
+		return resource, nil
+	}
+	if _, ok := resource.Properties["version"]; ok && len(packages) > 1 {
+		return resource, fmt.Errorf("package group %s cannot be pinned to a version", resource.Name)
+	}
+
+	properties := make(map[string]interface{}, len(resource.Properties)+1)
+	for key, value := range resource.Properties {
+		properties[key] = value
+	}
+	properties["packages"] = packages
+	resource.Properties = properties
+	return resource, nil
+}
@@ -0,0 +1,133 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestPackageCatalog_Resolve(t *testing.T) {
+	catalog := DefaultPackageCatalog()
+	catalog.Merge(&PackageCatalog{
+		Aliases: map[string]map[string]string{
+			"apache": {"ubuntu": "apache2-bin"},
+			"jq":     {PlatformDefault: "jq"},
+		},
+		Groups: map[string]map[string][]string{
+			"web": {types.DistroDebian: {"apache", "jq"}, types.DistroRedHat: {"apache", "vim"}},
+		},
+	})
+
+	ubuntu := &types.TargetFacts{OSFamily: types.OSFamilyLinux, Distribution: "ubuntu", DistroFamily: types.DistroDebian}
+	debian := &types.TargetFacts{OSFamily: types.OSFamilyLinux, Distribution: "debian", DistroFamily: types.DistroDebian}
+	rocky := &types.TargetFacts{OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat}
+	mac := &types.TargetFacts{OSFamily: types.OSFamilyDarwin}
+
+	tests := []struct {
+		name    string
+		pkg     string
+		facts   *types.TargetFacts
+		want    []string
+		wantErr string
+	}{
+		{name: "distribution wins over family", pkg: "apache", facts: ubuntu, want: []string{"apache2-bin"}},
+		{name: "family", pkg: "apache", facts: debian, want: []string{"apache2"}},
+		{name: "like a family", pkg: "apache", facts: rocky, want: []string{"httpd"}},
+		{name: "OS family", pkg: "apache", facts: mac, want: []string{"httpd"}},
+		{name: "default", pkg: "jq", facts: rocky, want: []string{"jq"}},
+		{name: "plain package", pkg: "nginx", facts: rocky, want: []string{"nginx"}},
+		{name: "group of aliases", pkg: "web", facts: rocky, want: []string{"httpd", "vim-enhanced"}},
+		{name: "built-in group", pkg: "build-tools", facts: debian, want: []string{"build-essential"}},
+		{name: "default on unknown platform", pkg: "jq", want: []string{"jq"}},
+		{name: "alias on unknown platform", pkg: "apache", want: []string{"apache"}},
+		{name: "group on unknown platform", pkg: "web", want: []string{"web"}},
+		{name: "no package for platform", pkg: "cron", facts: mac, wantErr: "package alias cron has no package for darwin"},
+		{name: "group without platform", pkg: "web", facts: mac, wantErr: "package group web has no packages for darwin"},
+		{
+			name:    "unknown distribution",
+			pkg:     "cron",
+			facts:   &types.TargetFacts{OSFamily: types.OSFamilyLinux, Distribution: "gentoo", DistroFamily: "gentoo"},
+			wantErr: "package alias cron has no package for gentoo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := catalog.Resolve(tt.pkg, tt.facts)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Resolve() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Resolve() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPackageCatalog_Validate(t *testing.T) {
+	if err := DefaultPackageCatalog().Validate(); err != nil {
+		t.Errorf("default catalog: %v", err)
+	}
+	both := &PackageCatalog{
+		Aliases: map[string]map[string]string{"web": {PlatformDefault: "nginx"}},
+		Groups:  map[string]map[string][]string{"web": {PlatformDefault: {"nginx"}}},
+	}
+	if err := both.Validate(); err == nil || !strings.Contains(err.Error(), "both an alias and a group") {
+		t.Errorf("Validate() = %v", err)
+	}
+	empty := &PackageCatalog{Aliases: map[string]map[string]string{"web": {types.DistroDebian: ""}}}
+	if err := empty.Validate(); err == nil || !strings.Contains(err.Error(), "packages.aliases.web.debian") {
+		t.Errorf("Validate() = %v", err)
+	}
+}
+
+func TestPlanner_ResolvesPackages(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&countingProvider{resourceType: "pkg"})
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "web", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{Type: "pkg", Name: "apache", State: types.StatePresent},
+				{Type: "pkg", Name: "nginx", State: types.StatePresent},
+				{Type: "pkg", Name: "build-tools", State: types.StatePresent, Properties: map[string]interface{}{"version": "1.0"}},
+				{Type: "pkg", Name: "web", State: types.StatePresent, Properties: map[string]interface{}{"packages": []interface{}{"apache", "certbot", "build-tools"}}},
+			},
+		},
+	}
+
+	planner := NewPlanner(registry)
+	planner.SetFacts(&types.TargetFacts{Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat})
+	planner.SetPackages(DefaultPackageCatalog())
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got := plan.Changes[0].Resource.Properties["packages"]; !reflect.DeepEqual(got, []string{"httpd"}) {
+		t.Errorf("apache packages = %v, want [httpd]", got)
+	}
+	if _, ok := module.Spec.Resources[0].Properties["packages"]; ok {
+		t.Error("resolving packages changed the module")
+	}
+	if _, ok := plan.Changes[1].Resource.Properties["packages"]; ok {
+		t.Error("a plain package was given a packages list")
+	}
+	if err := plan.Changes[2].Error; err == nil || !strings.Contains(err.Error(), "cannot be pinned to a version") {
+		t.Errorf("pinned group error = %v", err)
+	}
+	want := []string{"httpd", "certbot", "gcc", "gcc-c++", "make"}
+	if got := plan.Changes[3].Resource.Properties["packages"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("listed packages = %v, want %v", got, want)
+	}
+}
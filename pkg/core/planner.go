@@ -4,6 +4,9 @@ import (
 	"context"
 	"fmt"
 
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/limits"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
@@ -39,11 +42,37 @@ type Change struct {
 	Resource types.Resource        `json:"resource"`
 	Diff     *types.ResourceDiff   `json:"diff,omitempty"`
 	Error    error                 `json:"error,omitempty"`
+	// State is the current state read when planning, nil when the
+	// resource does not exist
+	State    map[string]interface{} `json:"-"`
+	// Deferred changes use output registered by other resources, so they
+	// are planned again when applied, once that output is known
+	Deferred bool `json:"deferred,omitempty"`
+	// Audit changes are only reported, never applied: the resource has
+	// state audit or the run is audit only
+	Audit bool `json:"audit,omitempty"`
+}
+
+// Deviates reports whether an audited resource is not in the state its
+// properties describe
+func (c Change) Deviates() bool {
+	return c.Audit && c.Action != ActionNoOp && c.Error == nil
 }
 
 // Plan represents a collection of planned changes
 type Plan struct {
-	Changes []Change `json:"changes"`
+	Changes  []Change  `json:"changes"`
+	Handlers []Handler `json:"handlers,omitempty"`
+	// Excluded lists the resources --target and --exclude left out
+	Excluded []string `json:"excluded,omitempty"`
+	// Skipped lists the resources whose when condition is false on the target
+	Skipped []string `json:"skipped,omitempty"`
+	// Unmatched is set when the module's selector does not match the
+	// target's labels, so every resource is skipped
+	Unmatched bool `json:"unmatched,omitempty"`
+
+	// run is shared by the changes while the plan is applied
+	run *planRun
 }
 
 // PlanSummary provides a summary of planned changes
@@ -53,6 +82,8 @@ type PlanSummary struct {
 	ToDelete  int `json:"to_delete"`
 	NoChanges int `json:"no_changes"`
 	Errors    int `json:"errors"`
+	// Deviations counts the audited resources that are not as described
+	Deviations int `json:"deviations,omitempty"`
 }
 
 // NewPlan creates a new empty plan
@@ -62,6 +93,15 @@ func NewPlan() *Plan {
 	}
 }
 
+// Single returns a plan of one of the plan's changes, which registers and
+// uses output along with the rest of the plan when applied
+func (p *Plan) Single(change Change) *Plan {
+	single := NewPlan()
+	single.AddChange(change)
+	single.run = p.run
+	return single
+}
+
 // AddChange adds a change to the plan
 func (p *Plan) AddChange(change Change) {
 	p.Changes = append(p.Changes, change)
@@ -76,6 +116,10 @@ func (p *Plan) Summary() PlanSummary {
 			summary.Errors++
 			continue
 		}
+		if change.Deviates() {
+			summary.Deviations++
+			continue
+		}
 		
 		switch change.Action {
 		case ActionCreate:
@@ -92,10 +136,23 @@ func (p *Plan) Summary() PlanSummary {
 	return summary
 }
 
+// Size estimates the memory the plan takes: the properties, current state
+// and changes of its resources
+func (p *Plan) Size() int64 {
+	var size int64
+	for _, change := range p.Changes {
+		size += limits.SizeOf(change.Resource.Properties) + limits.SizeOf(change.State)
+		if change.Diff != nil {
+			size += limits.SizeOf(change.Diff.Changes) + int64(len(change.Diff.Reason))
+		}
+	}
+	return size
+}
+
 // HasChanges returns true if the plan has any changes that need to be applied
 func (p *Plan) HasChanges() bool {
 	for _, change := range p.Changes {
-		if change.Action != ActionNoOp && change.Error == nil {
+		if change.Action != ActionNoOp && change.Error == nil && !change.Audit {
 			return true
 		}
 	}
@@ -105,6 +162,14 @@ func (p *Plan) HasChanges() bool {
 // Planner creates execution plans for modules
 type Planner struct {
 	registry *types.ProviderRegistry
+	exports  *ExportStore
+	facts    *types.TargetFacts
+	selection *Selection
+	packages *PackageCatalog
+	system   *facts.Facts
+	labels   map[string]string
+	output   *limits.Output
+	audit    bool
 }
 
 // NewPlanner creates a new planner with the given provider registry
@@ -114,17 +179,125 @@ func NewPlanner(registry *types.ProviderRegistry) *Planner {
 	}
 }
 
+// SetExports sets the exported resources that collecting resources can consume
+func (p *Planner) SetExports(exports *ExportStore) {
+	p.exports = exports
+}
+
+// SetFacts sets the target facts that provider capabilities are checked against
+func (p *Planner) SetFacts(facts *types.TargetFacts) {
+	p.facts = facts
+}
+
+// SetSystemFacts sets the facts about the target's system that when
+// conditions are evaluated against and file templates see as .facts
+func (p *Planner) SetSystemFacts(system *facts.Facts) {
+	p.system = system
+}
+
+// SetLabels sets the labels the inventory declares for the target, which
+// module selectors match along with the labels derived from its facts
+func (p *Planner) SetLabels(labels map[string]string) {
+	p.labels = labels
+}
+
+// SetOutputLimit sets how much of the output of the commands resources run
+// is kept in memory while the plan is applied; nil keeps all of it
+func (p *Planner) SetOutputLimit(output *limits.Output) {
+	p.output = output
+}
+
+// SetAuditOnly makes every resource audited, as if it had state audit, so
+// the plan only reports deviations
+func (p *Planner) SetAuditOnly(audit bool) {
+	p.audit = audit
+}
+
+// SetPackages sets the catalog package resource names are resolved through
+// for the target's platform
+func (p *Planner) SetPackages(catalog *PackageCatalog) {
+	p.packages = catalog
+}
+
+// SetSelection limits plans to the selected resources
+func (p *Planner) SetSelection(selection *Selection) {
+	p.selection = selection
+}
+
+// validateChecks validates the canary checks of a strategy as wait_for
+// resources, so a mistake in one fails the plan instead of a canary that
+// applied fine
+func (p *Planner) validateChecks(strategy *Strategy) error {
+	if strategy == nil || len(strategy.Checks) == 0 {
+		return nil
+	}
+	provider, err := p.registry.Get("wait_for")
+	if err != nil {
+		return fmt.Errorf("no provider found for resource type: wait_for")
+	}
+	for _, check := range strategy.HealthChecks() {
+		resolved, err := WithSecrets(check)
+		if err != nil {
+			return fmt.Errorf("checks %s: failed to resolve secrets: %w", check.Name, err)
+		}
+		if err := provider.Validate(&resolved); err != nil {
+			return fmt.Errorf("checks %s: %w", check.Name, err)
+		}
+	}
+	return nil
+}
+
 // CreatePlan creates an execution plan for the given module
 func (p *Planner) CreatePlan(module *Module) (*Plan, error) {
+	if module.hasLoops() {
+		return nil, fmt.Errorf("invalid module: looped resources are expanded when its variables are resolved")
+	}
 	if err := module.Validate(); err != nil {
 		return nil, fmt.Errorf("invalid module: %w", err)
 	}
+	if err := p.validateChecks(module.Spec.Strategy); err != nil {
+		return nil, fmt.Errorf("invalid module: strategy: %w", err)
+	}
 	
+	if !p.selects(module) {
+		plan := NewPlan()
+		plan.Unmatched = true
+		for _, resource := range module.Spec.Resources {
+			plan.Skipped = append(plan.Skipped, resource.ResourceID())
+		}
+		return plan, nil
+	}
+
+	resources, excluded, err := p.selection.Filter(module.Spec.Resources)
+	if err != nil {
+		return nil, err
+	}
+	resources, skipped, err := filterWhen(resources, p.system, module.Spec.Vars)
+	if err != nil {
+		return nil, err
+	}
+	deferred, registered, err := deferRegistered(module.Spec.Resources, resources, skipped)
+	if err != nil {
+		return nil, err
+	}
+
 	plan := NewPlan()
+	plan.Handlers = module.Spec.Handlers
+	plan.Excluded = excluded
+	plan.Skipped = skipped
+	plan.run = &planRun{planner: p, vars: module.Spec.Vars, registered: registered}
 	
 	// Process each resource in the module
-	for _, resource := range module.Spec.Resources {
-		change, err := p.planResource(resource)
+	for i, resource := range resources {
+		if deps, ok := deferred[i]; ok {
+			plan.AddChange(deferredChange(resource, deps))
+			continue
+		}
+		var change Change
+		resource, err = p.prepare(resource)
+		if err == nil {
+			change, err = p.planResource(resource)
+		}
 		if err != nil {
 			change = Change{
 				Action:   ActionNoOp,
@@ -138,28 +311,68 @@ func (p *Planner) CreatePlan(module *Module) (*Plan, error) {
 	return plan, nil
 }
 
+// selects reports whether the module's selector matches the target.
+// Without facts only the declared labels are matched, so a selector on a
+// derived label does not match a host whose facts are unknown.
+func (p *Planner) selects(module *Module) bool {
+	if module.Spec.Selector == "" {
+		return true
+	}
+	selector, err := inventory.ParseLabelSelector(module.Spec.Selector)
+	if err != nil {
+		return true
+	}
+	return selector.Matches(inventory.MergeLabels(p.system.Labels(), p.labels))
+}
+
+// prepare adds collected exports, facts and the target's package names to a
+// resource before it is planned
+func (p *Planner) prepare(resource types.Resource) (types.Resource, error) {
+	return withPackages(WithFacts(withCollected(resource, p.exports), p.system), p.packages, p.facts)
+}
+
 // planResource creates a plan for a single resource
 func (p *Planner) planResource(resource types.Resource) (Change, error) {
+	// Audited resources are checked against the provider's default state
+	audit := p.audit || resource.State == types.StateAudit
+	if resource.State == types.StateAudit {
+		resource.State = ""
+	}
+
 	// Get the provider for this resource type
 	provider, err := p.registry.Get(resource.Type)
 	if err != nil {
 		return Change{}, fmt.Errorf("no provider found for resource type: %s", resource.Type)
 	}
 	
+	// The provider sees the secrets the resource references, the plan only
+	// the references
+	resolved, err := WithSecrets(resource)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to resolve secrets: %w", err)
+	}
+
 	// Validate the resource
-	if err := provider.Validate(&resource); err != nil {
+	if err := provider.Validate(&resolved); err != nil {
 		return Change{}, fmt.Errorf("resource validation failed: %w", err)
 	}
 	
+	// Check the provider supports the target before running commands on it
+	if p.facts != nil {
+		if err := types.ProviderCapabilities(provider).Check(p.facts); err != nil {
+			return Change{}, fmt.Errorf("provider %s not supported on target %s: %w", resource.Type, p.facts.Host, err)
+		}
+	}
+	
 	// Read current state
 	ctx := context.Background()
-	currentState, err := provider.Read(ctx, &resource)
+	currentState, err := provider.Read(ctx, &resolved)
 	if err != nil {
 		return Change{}, fmt.Errorf("failed to read current state: %w", err)
 	}
 	
 	// Calculate diff
-	diff, err := provider.Diff(ctx, &resource, currentState)
+	diff, err := provider.Diff(ctx, &resolved, currentState)
 	if err != nil {
 		return Change{}, fmt.Errorf("failed to calculate diff: %w", err)
 	}
@@ -171,13 +384,16 @@ func (p *Planner) planResource(resource types.Resource) (Change, error) {
 		Action:   action,
 		Resource: resource,
 		Diff:     diff,
+		State:    currentState,
+		Audit:    audit,
 	}, nil
 }
 
 // determineAction determines what action should be taken based on the resource and diff
 func (p *Planner) determineAction(resource types.Resource, currentState map[string]interface{}, diff *types.ResourceDiff) Action {
-	// Check if resource should be absent
-	if state, ok := resource.Properties["state"].(string); ok && state == "absent" {
+	// Check if resource should be absent; a wait_for that is waits for its
+	// condition to stop holding and deletes nothing
+	if state, ok := resource.Properties["state"].(string); ok && state == "absent" && resource.Type != "wait_for" {
 		if currentState == nil {
 			return ActionNoOp // Already absent
 		}
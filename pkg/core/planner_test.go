@@ -1,6 +1,8 @@
 package core
 
 import (
+	"context"
+	"fmt"
 	"testing"
 
 	"github.com/ataiva-software/forge/pkg/types"
@@ -52,6 +54,21 @@ func TestPlan_Summary(t *testing.T) {
 	}
 }
 
+func TestPlan_Size(t *testing.T) {
+	plan := NewPlan()
+	plan.AddChange(Change{
+		Action:   ActionUpdate,
+		Resource: types.Resource{Type: "file", Name: "motd", Properties: map[string]interface{}{"content": "0123456789"}},
+		State:    map[string]interface{}{"content": "01234"},
+		Diff:     &types.ResourceDiff{Action: types.ActionUpdate, Reason: "drift"},
+	})
+
+	// "content" is counted with each of its two values
+	if size := plan.Size(); size != 7+10+7+5+5 {
+		t.Errorf("Size() = %d, want 34", size)
+	}
+}
+
 func TestPlanner_CreatePlan(t *testing.T) {
 	// Create a mock provider registry
 	registry := types.NewProviderRegistry()
@@ -122,3 +139,181 @@ func TestAction_String(t *testing.T) {
 		})
 	}
 }
+
+// linuxOnlyProvider is a counting provider that declares it needs Linux and systemctl
+type linuxOnlyProvider struct {
+	countingProvider
+}
+
+func (p *linuxOnlyProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{OSFamilies: []string{types.OSFamilyLinux}, Commands: []string{"systemctl"}}
+}
+
+func TestPlanner_CreatePlanChecksCapabilities(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&linuxOnlyProvider{countingProvider{resourceType: "service"}})
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "test-module", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{{Type: "service", Name: "nginx", State: types.StateRunning}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		facts   *types.TargetFacts
+		wantErr string
+	}{
+		{name: "no facts", facts: nil},
+		{
+			name:  "supported",
+			facts: &types.TargetFacts{Host: "web1", OSFamily: types.OSFamilyLinux, Commands: map[string]bool{"systemctl": true}},
+		},
+		{
+			name:    "wrong OS",
+			facts:   &types.TargetFacts{Host: "mac1", OSFamily: types.OSFamilyDarwin},
+			wantErr: "provider service not supported on target mac1: requires linux, target runs darwin",
+		},
+		{
+			name:    "missing command",
+			facts:   &types.TargetFacts{Host: "box1", OSFamily: types.OSFamilyLinux},
+			wantErr: "provider service not supported on target box1: requires command systemctl",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := NewPlanner(registry)
+			planner.SetFacts(tt.facts)
+			plan, err := planner.CreatePlan(module)
+			if err != nil {
+				t.Fatalf("CreatePlan() error = %v", err)
+			}
+
+			changeErr := plan.Changes[0].Error
+			if tt.wantErr == "" {
+				if changeErr != nil {
+					t.Errorf("Unexpected change error: %v", changeErr)
+				}
+				return
+			}
+			if changeErr == nil || changeErr.Error() != tt.wantErr {
+				t.Errorf("Change error = %v, want %q", changeErr, tt.wantErr)
+			}
+		})
+	}
+}
+
+// urlProvider is a counting provider that requires a url property
+type urlProvider struct {
+	countingProvider
+}
+
+func (p *urlProvider) Validate(resource *types.Resource) error {
+	if _, ok := resource.Properties["url"].(string); !ok {
+		return fmt.Errorf("url is required")
+	}
+	return nil
+}
+
+func TestPlanner_CreatePlanValidatesCanaryChecks(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&urlProvider{countingProvider{resourceType: "wait_for"}})
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "test-module", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{{Type: "wait_for", Name: "up", Properties: map[string]interface{}{"url": "http://localhost/"}}},
+			Strategy: &Strategy{
+				Type:     StrategyCanary,
+				Selector: "canary=true",
+				Checks:   []types.Resource{{Name: "health", Properties: map[string]interface{}{"uri": "http://localhost/health"}}},
+			},
+		},
+	}
+
+	_, err := NewPlanner(registry).CreatePlan(module)
+	if err == nil || err.Error() != "invalid module: strategy: checks health: url is required" {
+		t.Errorf("CreatePlan() error = %v, want the check's validation error", err)
+	}
+
+	module.Spec.Strategy.Checks[0].Properties = map[string]interface{}{"url": "http://localhost/health"}
+	if _, err := NewPlanner(registry).CreatePlan(module); err != nil {
+		t.Errorf("CreatePlan() error = %v", err)
+	}
+}
+
+func TestPlanner_Audit(t *testing.T) {
+	provider := &countingProvider{resourceType: "file", applied: make(map[string]int)}
+	registry := types.NewProviderRegistry()
+	registry.Register(provider)
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "test", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{Type: "file", Name: "sshd-config", State: types.StateAudit, Notify: []string{"reload"}},
+				{Type: "file", Name: "motd"},
+			},
+			Handlers: []Handler{{Name: "reload", Resource: types.Resource{Type: "file", Name: "reload"}}},
+		},
+	}
+
+	planner := NewPlanner(registry)
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+	audited := plan.Changes[0]
+	if !audited.Audit || !audited.Deviates() || audited.Resource.State != "" {
+		t.Errorf("audited change = %+v, want a deviation checked against the default state", audited)
+	}
+	if plan.Changes[1].Audit {
+		t.Error("a resource without state audit is audited")
+	}
+	if summary := plan.Summary(); summary.Deviations != 1 || summary.ToUpdate != 1 {
+		t.Errorf("Summary() = %+v, want 1 deviation and 1 update", summary)
+	}
+
+	result, err := NewExecutor(registry).ExecutePlan(context.Background(), plan)
+	if err != nil {
+		t.Fatalf("ExecutePlan() error = %v", err)
+	}
+	if provider.applied["file.sshd-config"] != 0 || provider.applied["file.reload"] != 0 {
+		t.Errorf("audited resource was applied or notified its handler: %v", provider.applied)
+	}
+	if provider.applied["file.motd"] != 1 || result.Summary.Failed != 0 {
+		t.Errorf("enforced resource was not applied: %v, %+v", provider.applied, result.Summary)
+	}
+
+	// Audit only runs audit every resource
+	planner.SetAuditOnly(true)
+	plan, err = planner.CreatePlan(module)
+	if err != nil {
+		t.Fatalf("CreatePlan() error = %v", err)
+	}
+	if summary := plan.Summary(); summary.Deviations != 2 || plan.HasChanges() {
+		t.Errorf("audit only Summary() = %+v, HasChanges() = %v", summary, plan.HasChanges())
+	}
+}
+
+func TestPlanner_DetermineActionWaitFor(t *testing.T) {
+	planner := NewPlanner(types.NewProviderRegistry())
+	diff := &types.ResourceDiff{Action: types.ActionUpdate}
+	current := map[string]interface{}{"met": true}
+
+	wait := types.Resource{Type: "wait_for", Name: "lock", Properties: map[string]interface{}{"state": "absent", "path": "/run/lock"}}
+	if action := planner.determineAction(wait, current, diff); action != ActionUpdate {
+		t.Errorf("determineAction() of an absent wait_for = %s, want update", action)
+	}
+	file := types.Resource{Type: "file", Name: "lock", Properties: map[string]interface{}{"state": "absent", "path": "/run/lock"}}
+	if action := planner.determineAction(file, current, diff); action != ActionDelete {
+		t.Errorf("determineAction() of an absent file = %s, want delete", action)
+	}
+}
@@ -0,0 +1,203 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/update"
+)
+
+// Preflight declares conditions a host must meet before any resource of the
+// module is applied to it
+type Preflight struct {
+	// Kernel is a version constraint on the kernel release, such as ">= 5.4"
+	Kernel string `yaml:"kernel,omitempty"`
+	// Disk requires free space at paths
+	Disk []DiskCheck `yaml:"disk,omitempty"`
+	// ForbiddenProcesses are processes that must not be running, such as a
+	// package manager holding a lock
+	ForbiddenProcesses []string `yaml:"forbidden_processes,omitempty"`
+}
+
+// DiskCheck requires free space on the filesystem holding a path
+type DiskCheck struct {
+	Path    string `yaml:"path"`
+	MinFree string `yaml:"min_free"`
+}
+
+// PreflightCheck is the outcome of one preflight condition on a host
+type PreflightCheck struct {
+	Name   string
+	Passed bool
+	Detail string
+}
+
+// PreflightReport is the outcome of the preflight conditions on a host
+type PreflightReport struct {
+	Host   string
+	Checks []PreflightCheck
+}
+
+// Passed reports whether every check passed
+func (r *PreflightReport) Passed() bool {
+	for _, check := range r.Checks {
+		if !check.Passed {
+			return false
+		}
+	}
+	return true
+}
+
+// Failed returns the checks that did not pass
+func (r *PreflightReport) Failed() []PreflightCheck {
+	var failed []PreflightCheck
+	for _, check := range r.Checks {
+		if !check.Passed {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Validate validates the preflight conditions
+func (p *Preflight) Validate() error {
+	if p.Kernel != "" {
+		if _, err := update.ParseConstraint(p.Kernel); err != nil {
+			return fmt.Errorf("kernel: %w", err)
+		}
+	}
+	for i, disk := range p.Disk {
+		if disk.Path == "" {
+			return fmt.Errorf("disk[%d]: path is required", i)
+		}
+		if _, err := parseSize(disk.MinFree); err != nil {
+			return fmt.Errorf("disk[%d]: %w", i, err)
+		}
+	}
+	for i, process := range p.ForbiddenProcesses {
+		if process == "" {
+			return fmt.Errorf("forbidden_processes[%d]: process name is required", i)
+		}
+	}
+	return nil
+}
+
+// Paths returns the paths whose free space is checked
+func (p *Preflight) Paths() []string {
+	paths := make([]string, len(p.Disk))
+	for i, disk := range p.Disk {
+		paths[i] = disk.Path
+	}
+	return paths
+}
+
+// Check evaluates the conditions against a host's facts. The preflight must be valid.
+func (p *Preflight) Check(facts *types.TargetFacts) *PreflightReport {
+	report := &PreflightReport{Host: facts.Host}
+
+	if p.Kernel != "" {
+		check := PreflightCheck{Name: fmt.Sprintf("kernel %s", p.Kernel)}
+		constraint, _ := update.ParseConstraint(p.Kernel)
+		version, err := kernelVersion(facts.Kernel)
+		switch {
+		case err != nil:
+			check.Detail = err.Error()
+		case constraint.Check(version):
+			check.Passed = true
+			check.Detail = fmt.Sprintf("running %s", facts.Kernel)
+		default:
+			check.Detail = fmt.Sprintf("running %s", facts.Kernel)
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	for _, disk := range p.Disk {
+		check := PreflightCheck{Name: fmt.Sprintf("free disk on %s >= %s", disk.Path, disk.MinFree)}
+		required, _ := parseSize(disk.MinFree)
+		free, ok := facts.FreeDisk[disk.Path]
+		if !ok {
+			check.Detail = "path not found"
+		} else {
+			check.Passed = free >= required
+			check.Detail = fmt.Sprintf("%s free", formatSize(free))
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	if len(p.ForbiddenProcesses) > 0 {
+		check := PreflightCheck{Name: fmt.Sprintf("no %s running", strings.Join(p.ForbiddenProcesses, ", "))}
+		var running []string
+		for _, process := range p.ForbiddenProcesses {
+			if facts.Processes[process] {
+				running = append(running, process)
+			}
+		}
+		sort.Strings(running)
+		check.Passed = len(running) == 0
+		if !check.Passed {
+			check.Detail = fmt.Sprintf("running: %s", strings.Join(running, ", "))
+		}
+		report.Checks = append(report.Checks, check)
+	}
+
+	return report
+}
+
+var kernelVersionPattern = regexp.MustCompile(`^\d+(\.\d+){0,2}`)
+
+// kernelVersion takes the version from a kernel release such as
+// "5.15.0-91-generic". The distribution suffix is not a pre-release, so it is
+// dropped rather than sorting the release before 5.15.0.
+func kernelVersion(release string) (update.Version, error) {
+	match := kernelVersionPattern.FindString(strings.TrimSpace(release))
+	if match == "" {
+		return update.Version{}, fmt.Errorf("unknown kernel release %q", release)
+	}
+	return update.ParseVersion(match)
+}
+
+// parseSize parses a size such as "500M", "2GB" or "1.5GiB" into bytes.
+// Units are powers of 1024.
+func parseSize(s string) (int64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	value = strings.TrimSuffix(strings.TrimSuffix(value, "b"), "i")
+
+	multiplier := int64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			value = value[:n-1]
+		}
+	}
+
+	number, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	if err != nil || number <= 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return int64(number * float64(multiplier)), nil
+}
+
+// formatSize formats a size in bytes for display
+func formatSize(bytes int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(bytes)
+	unit := 0
+	for value >= 1024 && unit < len(units)-1 {
+		value /= 1024
+		unit++
+	}
+	return strconv.FormatFloat(value, 'f', 1, 64) + units[unit]
+}
@@ -0,0 +1,124 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestPreflight_Check(t *testing.T) {
+	preflight := &Preflight{
+		Kernel:             ">= 5.4",
+		Disk:               []DiskCheck{{Path: "/var", MinFree: "2GB"}},
+		ForbiddenProcesses: []string{"apt-get", "dpkg"},
+	}
+	if err := preflight.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		facts      types.TargetFacts
+		wantFailed []string
+	}{
+		{
+			name: "all pass",
+			facts: types.TargetFacts{
+				Kernel:   "5.15.0-91-generic",
+				FreeDisk: map[string]int64{"/var": 3 << 30},
+			},
+		},
+		{
+			name: "old kernel",
+			facts: types.TargetFacts{
+				Kernel:   "4.19.0-26-amd64",
+				FreeDisk: map[string]int64{"/var": 3 << 30},
+			},
+			wantFailed: []string{"kernel >= 5.4"},
+		},
+		{
+			name: "low disk and busy package manager",
+			facts: types.TargetFacts{
+				Kernel:    "6.1.0",
+				FreeDisk:  map[string]int64{"/var": 1 << 30},
+				Processes: map[string]bool{"dpkg": true},
+			},
+			wantFailed: []string{"free disk on /var >= 2GB", "no apt-get, dpkg running"},
+		},
+		{
+			name:       "missing facts",
+			facts:      types.TargetFacts{},
+			wantFailed: []string{"kernel >= 5.4", "free disk on /var >= 2GB"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report := preflight.Check(&tt.facts)
+			if len(report.Checks) != 3 {
+				t.Fatalf("Expected 3 checks, got %d", len(report.Checks))
+			}
+			failed := report.Failed()
+			if len(failed) != len(tt.wantFailed) {
+				t.Fatalf("Failed() = %+v, want %v", failed, tt.wantFailed)
+			}
+			for i, check := range failed {
+				if check.Name != tt.wantFailed[i] {
+					t.Errorf("Failed()[%d] = %q, want %q", i, check.Name, tt.wantFailed[i])
+				}
+			}
+			if report.Passed() != (len(tt.wantFailed) == 0) {
+				t.Errorf("Passed() = %v", report.Passed())
+			}
+		})
+	}
+}
+
+func TestPreflight_Validate(t *testing.T) {
+	tests := []struct {
+		name      string
+		preflight Preflight
+		wantErr   bool
+	}{
+		{name: "empty", preflight: Preflight{}},
+		{name: "kernel", preflight: Preflight{Kernel: "~> 5.15"}},
+		{name: "bad kernel", preflight: Preflight{Kernel: ">= five"}, wantErr: true},
+		{name: "disk", preflight: Preflight{Disk: []DiskCheck{{Path: "/", MinFree: "1.5GiB"}}}},
+		{name: "disk without path", preflight: Preflight{Disk: []DiskCheck{{MinFree: "1G"}}}, wantErr: true},
+		{name: "bad size", preflight: Preflight{Disk: []DiskCheck{{Path: "/", MinFree: "lots"}}}, wantErr: true},
+		{name: "empty process", preflight: Preflight{ForbiddenProcesses: []string{""}}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.preflight.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int64
+	}{
+		{input: "512", want: 512},
+		{input: "500M", want: 500 << 20},
+		{input: "2GB", want: 2 << 30},
+		{input: "1.5GiB", want: 3 << 29},
+		{input: "1t", want: 1 << 40},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseSize(tt.input)
+			if err != nil {
+				t.Fatalf("parseSize() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("parseSize() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// registeredRef matches uses of registered output in when conditions and
+// templates, as in .registered.version.stdout
+var registeredRef = regexp.MustCompile(`\.registered\.([A-Za-z_][A-Za-z0-9_]*)`)
+
+// registeredVarPattern matches ${registered:name.field} references in
+// properties, as in ${registered:version.stdout}
+var registeredVarPattern = regexp.MustCompile(`\$\{registered:([A-Za-z_][A-Za-z0-9_]*)((?:\.[A-Za-z0-9_]+)*)\}`)
+
+// planRun is what the changes of a plan share while it is applied: the
+// output registered so far, and what deferred resources are planned with
+type planRun struct {
+	planner *Planner
+	vars    map[string]interface{}
+
+	mu         sync.Mutex
+	registered map[string]interface{}
+}
+
+// register records the output of a resource under its register name
+func (r *planRun) register(name string, output map[string]interface{}) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.registered[name] = output
+}
+
+// snapshot returns the output registered so far
+func (r *planRun) snapshot() map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	registered := make(map[string]interface{}, len(r.registered))
+	for name, output := range r.registered {
+		registered[name] = output
+	}
+	return registered
+}
+
+// registeredOutput returns the variable a command's output is registered
+// as. ran is false when the resource had nothing to do, so the command did
+// not run.
+func registeredOutput(output types.CommandOutput, ran bool) map[string]interface{} {
+	stdout := strings.TrimRight(output.Stdout, "\n")
+	lines := make([]interface{}, 0)
+	if stdout != "" {
+		for _, line := range strings.Split(stdout, "\n") {
+			lines = append(lines, line)
+		}
+	}
+	return map[string]interface{}{
+		"stdout":       stdout,
+		"stdout_lines": lines,
+		"stderr":       strings.TrimRight(output.Stderr, "\n"),
+		"exit_code":    output.ExitCode,
+		"changed":      ran,
+		"skipped":      !ran,
+	}
+}
+
+// registeredUses returns the names of the registered output a resource
+// uses in its when condition, templates and properties, sorted
+func registeredUses(resource types.Resource) []string {
+	names := make(map[string]bool)
+	for _, match := range registeredRef.FindAllStringSubmatch(resource.When, -1) {
+		names[match[1]] = true
+	}
+	var scan func(value interface{})
+	scan = func(value interface{}) {
+		switch v := value.(type) {
+		case string:
+			for _, match := range registeredRef.FindAllStringSubmatch(v, -1) {
+				names[match[1]] = true
+			}
+			for _, match := range registeredVarPattern.FindAllStringSubmatch(v, -1) {
+				names[match[1]] = true
+			}
+		case map[string]interface{}:
+			for _, item := range v {
+				scan(item)
+			}
+		case []interface{}:
+			for _, item := range v {
+				scan(item)
+			}
+		}
+	}
+	scan(resource.Properties)
+	scan(resource.OnlyIf)
+	scan(resource.NotIf)
+
+	uses := make([]string, 0, len(names))
+	for name := range names {
+		uses = append(uses, name)
+	}
+	sort.Strings(uses)
+	return uses
+}
+
+// deferRegistered finds the resources that use registered output. They are
+// deferred: planned once the resources registering it have run, which they
+// are made to depend on. A template_file cannot be searched for uses, so a
+// file rendering one is deferred when it depends on a registering resource.
+// The output of registering resources whose when condition is false is
+// registered as skipped up front. all is every resource of the module,
+// resources the ones planned and skipped the ids of those left out by when
+// conditions; the dependencies of each deferred resource are returned by
+// its index in resources.
+func deferRegistered(all, resources []types.Resource, skipped []string) (map[int][]string, map[string]interface{}, error) {
+	registrars := make(map[string]types.Resource)
+	for _, resource := range all {
+		if resource.Register == "" {
+			continue
+		}
+		if other, ok := registrars[resource.Register]; ok {
+			return nil, nil, fmt.Errorf("output registered as %s by both %s and %s", resource.Register, other.ResourceID(), resource.ResourceID())
+		}
+		registrars[resource.Register] = resource
+	}
+
+	registered := make(map[string]interface{})
+	wasSkipped := make(map[string]bool, len(skipped))
+	for _, id := range skipped {
+		wasSkipped[id] = true
+	}
+	for name, resource := range registrars {
+		if wasSkipped[resource.ResourceID()] {
+			registered[name] = registeredOutput(types.CommandOutput{}, false)
+		}
+	}
+	planned := make(map[string]bool, len(resources))
+	for _, resource := range resources {
+		planned[resource.ResourceID()] = true
+	}
+
+	deferred := make(map[int][]string)
+	for i, resource := range resources {
+		uses := registeredUses(resource)
+		if _, ok := resource.Properties["template_file"]; ok {
+			for _, dep := range resource.DependsOn {
+				for name, registrar := range registrars {
+					if registrar.ResourceID() == dep {
+						uses = append(uses, name)
+					}
+				}
+			}
+		}
+		if len(uses) == 0 {
+			continue
+		}
+
+		deps := make([]string, 0)
+		for _, name := range uses {
+			registrar, ok := registrars[name]
+			switch {
+			case !ok:
+				return nil, nil, fmt.Errorf("resource %s uses output registered as %s, which no resource registers", resource.ResourceID(), name)
+			case registrar.ResourceID() == resource.ResourceID():
+				return nil, nil, fmt.Errorf("resource %s uses the output it registers itself", resource.ResourceID())
+			case planned[registrar.ResourceID()]:
+				deps = append(deps, registrar.ResourceID())
+			case !wasSkipped[registrar.ResourceID()]:
+				return nil, nil, fmt.Errorf("resource %s uses the output of %s, which this run leaves out", resource.ResourceID(), registrar.ResourceID())
+			}
+		}
+		deferred[i] = deps
+	}
+	return deferred, registered, nil
+}
+
+// deferredChange is the change planned for a deferred resource until the
+// resources it depends on for output have run
+func deferredChange(resource types.Resource, deps []string) Change {
+	dependsOn := append([]string{}, resource.DependsOn...)
+	for _, dep := range deps {
+		found := false
+		for _, existing := range dependsOn {
+			found = found || existing == dep
+		}
+		if !found {
+			dependsOn = append(dependsOn, dep)
+		}
+	}
+	resource.DependsOn = dependsOn
+
+	after := "the output it uses is registered"
+	if len(deps) > 0 {
+		after = strings.Join(deps, ", ")
+	}
+	return Change{
+		Action:   ActionUpdate,
+		Resource: resource,
+		Deferred: true,
+		Diff: &types.ResourceDiff{
+			ResourceID: resource.ResourceID(),
+			Action:     types.ActionUpdate,
+			Reason:     "uses registered output",
+			Changes:    map[string]interface{}{"deferred": "planned when applied, after " + after},
+		},
+	}
+}
+
+// planDeferred plans a deferred change with the output registered so far.
+// Failures are returned as the change's error.
+func (p *Plan) planDeferred(change Change) Change {
+	if p.run == nil {
+		change.Error = fmt.Errorf("resource uses registered output, which is only known while its plan is applied")
+		return change
+	}
+	registered := p.run.snapshot()
+	resource, err := withRegistered(change.Resource, registered)
+	if err == nil && strings.TrimSpace(resource.When) != "" {
+		var holds bool
+		holds, err = evaluateWhen(resource.When, p.run.planner.system, p.run.vars, registered)
+		if err == nil && !holds {
+			return Change{
+				Action:   ActionNoOp,
+				Resource: resource,
+				Diff: &types.ResourceDiff{
+					ResourceID: resource.ResourceID(),
+					Action:     types.ActionNoop,
+					Reason:     "when condition is false",
+				},
+			}
+		}
+	}
+	if err == nil {
+		resource, err = p.run.planner.prepare(resource)
+	}
+	var planned Change
+	if err == nil {
+		planned, err = p.run.planner.planResource(resource)
+	}
+	if err != nil {
+		return Change{Action: ActionNoOp, Resource: resource, Error: err}
+	}
+	return planned
+}
+
+// withRegistered interpolates ${registered:name.field} references into a
+// resource's properties and commands, and adds the registered output to
+// the template variables of a file resource as registered
+func withRegistered(resource types.Resource, registered map[string]interface{}) (types.Resource, error) {
+	properties, err := interpolateRegistered(resource.Properties, registered)
+	if err != nil {
+		return resource, err
+	}
+	resource.Properties, _ = properties.(map[string]interface{})
+	for _, condition := range []*string{&resource.OnlyIf, &resource.NotIf} {
+		value, err := interpolateRegistered(*condition, registered)
+		if err != nil {
+			return resource, err
+		}
+		*condition = value.(string)
+	}
+
+	_, hasTemplate := resource.Properties["template"]
+	_, hasTemplateFile := resource.Properties["template_file"]
+	if !hasTemplate && !hasTemplateFile {
+		return resource, nil
+	}
+	existing, _ := resource.Properties["vars"].(map[string]interface{})
+	vars := make(map[string]interface{}, len(existing)+1)
+	for key, value := range existing {
+		vars[key] = value
+	}
+	vars["registered"] = registered
+	resource.Properties["vars"] = vars
+	return resource, nil
+}
+
+// interpolateRegistered replaces ${registered:name.field} references in a
+// property value. A string that is a single reference takes the value as
+// is, so stdout_lines stays a list; references within a string are
+// formatted into it. The copy it returns shares nothing with value.
+func interpolateRegistered(value interface{}, registered map[string]interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if match := registeredVarPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			return lookupRegistered(match, registered)
+		}
+		var err error
+		result := registeredVarPattern.ReplaceAllStringFunc(v, func(reference string) string {
+			found, lookupErr := lookupRegistered(registeredVarPattern.FindStringSubmatch(reference), registered)
+			if lookupErr != nil && err == nil {
+				err = lookupErr
+			}
+			return fmt.Sprint(found)
+		})
+		return result, err
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := interpolateRegistered(item, registered)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			resolved[key] = value
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := interpolateRegistered(item, registered)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			resolved[i] = value
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookupRegistered returns the registered output a reference names: the
+// whole output without a field, or one of its fields
+func lookupRegistered(match []string, registered map[string]interface{}) (interface{}, error) {
+	output, ok := registered[match[1]].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("no output registered as %s", match[1])
+	}
+	field := strings.TrimPrefix(match[2], ".")
+	if field == "" {
+		return output, nil
+	}
+	value, ok := output[field]
+	if !ok {
+		return nil, fmt.Errorf("registered output has no field %s, must be one of: changed, exit_code, skipped, stderr, stdout, stdout_lines", field)
+	}
+	return value, nil
+}
+
+// register records the output of a resource that registers it
+func (p *Plan) register(resource types.Resource, output types.CommandOutput, ran bool) {
+	if resource.Register == "" || p.run == nil {
+		return
+	}
+	p.run.register(resource.Register, registeredOutput(output, ran))
+}
+
+// limitOutput returns a context in which the commands of the plan's
+// resources keep their output within the run's limit as they print it
+func (p *Plan) limitOutput(ctx context.Context) context.Context {
+	if p.run == nil || p.run.planner.output == nil {
+		return ctx
+	}
+	output := p.run.planner.output
+	return types.WithOutputBuffers(ctx, func(resource, stream string) types.OutputBuffer {
+		return output.Buffer(resource + " " + stream)
+	})
+}
@@ -0,0 +1,240 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/limits"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// outputProvider runs commands that print their output property, and
+// records the properties of everything it applies
+type outputProvider struct {
+	resourceType string
+	applied      map[string]map[string]interface{}
+}
+
+func (p *outputProvider) Type() string { return p.resourceType }
+
+func (p *outputProvider) Validate(resource *types.Resource) error { return nil }
+
+func (p *outputProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (p *outputProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	if resource.Properties["unchanged"] == true {
+		return &types.ResourceDiff{ResourceID: resource.ResourceID(), Action: types.ActionNoop}, nil
+	}
+	return &types.ResourceDiff{ResourceID: resource.ResourceID(), Action: types.ActionUpdate}, nil
+}
+
+func (p *outputProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	output, _ := resource.Properties["output"].(string)
+	if buffers := types.OutputBuffers(ctx); buffers != nil {
+		stdout := buffers(resource.ResourceID(), "stdout")
+		io.WriteString(stdout, output)
+		output = stdout.String()
+	}
+	types.CaptureOutput(ctx, types.CommandOutput{Stdout: output, ExitCode: 0})
+	p.applied[resource.ResourceID()] = resource.Properties
+	return nil
+}
+
+func registerModule(resources ...types.Resource) *Module {
+	return &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "app", Version: "1.0.0"},
+		Spec:       ModuleSpec{Resources: resources},
+	}
+}
+
+func TestPlanner_Register(t *testing.T) {
+	shell := &outputProvider{resourceType: "shell", applied: make(map[string]map[string]interface{})}
+	file := &outputProvider{resourceType: "file", applied: make(map[string]map[string]interface{})}
+	registry := types.NewProviderRegistry()
+	registry.Register(shell)
+	registry.Register(file)
+
+	module := registerModule(
+		types.Resource{Type: "shell", Name: "version", Register: "version", Properties: map[string]interface{}{"output": "1.2.3\n"}},
+		types.Resource{Type: "shell", Name: "check", Register: "check", Properties: map[string]interface{}{"unchanged": true}},
+		types.Resource{Type: "file", Name: "release", When: `eq .registered.version.stdout "1.2.3"`, Properties: map[string]interface{}{"path": "/etc/release", "content": "release ${registered:version.stdout}"}},
+		types.Resource{Type: "file", Name: "page", Properties: map[string]interface{}{"path": "/var/www/index.html", "template": "{{ .registered.version.stdout }}"}},
+		types.Resource{Type: "file", Name: "unchecked", When: ".registered.check.changed", Properties: map[string]interface{}{"path": "/etc/checked"}},
+		types.Resource{Type: "file", Name: "motd", Properties: map[string]interface{}{"path": "/etc/motd"}},
+	)
+	planner := NewPlanner(registry)
+	planner.SetSystemFacts(&facts.Facts{Host: "web1", OSFamily: types.OSFamilyLinux})
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var deferred []string
+	for _, change := range plan.Changes {
+		if change.Deferred {
+			deferred = append(deferred, change.Resource.ResourceID())
+		}
+	}
+	if !reflect.DeepEqual(deferred, []string{"file.release", "file.page", "file.unchecked"}) {
+		t.Fatalf("deferred %v", deferred)
+	}
+	release := plan.Changes[2]
+	if !reflect.DeepEqual(release.Resource.DependsOn, []string{"shell.version"}) || release.Action != ActionUpdate {
+		t.Errorf("file.release = %s depending on %v", release.Action, release.Resource.DependsOn)
+	}
+	if module.Spec.Resources[2].DependsOn != nil {
+		t.Error("planning changed the module")
+	}
+
+	result, err := NewExecutor(registry).ExecutePlan(context.Background(), plan)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Summary.Failed != 0 {
+		t.Fatalf("apply failed: %+v", result.Changes)
+	}
+	if got := file.applied["file.release"]["content"]; got != "release 1.2.3" {
+		t.Errorf("file.release content = %v", got)
+	}
+	vars, _ := file.applied["file.page"]["vars"].(map[string]interface{})
+	registered, _ := vars["registered"].(map[string]interface{})
+	if version, _ := registered["version"].(map[string]interface{}); version["stdout"] != "1.2.3" {
+		t.Errorf("file.page template vars = %v", vars)
+	}
+	// check had nothing to do, so its output is registered as skipped
+	if _, applied := file.applied["file.unchecked"]; applied {
+		t.Error("file.unchecked applied although check did not run")
+	}
+	if got := result.Changes[4]; got.Change.Action != ActionNoOp || got.Change.Diff.Reason != "when condition is false" {
+		t.Errorf("file.unchecked result = %s: %v", got.Change.Action, got.Change.Diff)
+	}
+}
+
+func TestPlanner_OutputLimit(t *testing.T) {
+	shell := &outputProvider{resourceType: "shell", applied: make(map[string]map[string]interface{})}
+	file := &outputProvider{resourceType: "file", applied: make(map[string]map[string]interface{})}
+	registry := types.NewProviderRegistry()
+	registry.Register(shell)
+	registry.Register(file)
+
+	module := registerModule(
+		types.Resource{Type: "shell", Name: "dump", Register: "dump", Properties: map[string]interface{}{"output": strings.Repeat("x", 64)}},
+		types.Resource{Type: "file", Name: "copy", Properties: map[string]interface{}{"path": "/tmp/dump", "content": "${registered:dump.stdout}"}},
+	)
+	var warnings []string
+	planner := NewPlanner(registry)
+	planner.SetSystemFacts(&facts.Facts{Host: "web1", OSFamily: types.OSFamilyLinux})
+	planner.SetOutputLimit(limits.Config{OutputBytes: 16, SpillDir: t.TempDir()}.NewOutput(func(format string, args ...interface{}) {
+		warnings = append(warnings, fmt.Sprintf(format, args...))
+	}))
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewExecutor(registry).ExecutePlan(context.Background(), plan); err != nil {
+		t.Fatal(err)
+	}
+
+	content, _ := file.applied["file.copy"]["content"].(string)
+	if !strings.HasPrefix(content, strings.Repeat("x", 16)+"\n[48 more bytes in ") {
+		t.Errorf("file.copy content = %q, want the first 16 bytes and a note", content)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0], "shell.dump stdout") {
+		t.Errorf("warnings = %q", warnings)
+	}
+}
+
+func TestPlanner_RegisterErrors(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&outputProvider{resourceType: "shell"})
+	registry.Register(&outputProvider{resourceType: "file"})
+	version := types.Resource{Type: "shell", Name: "version", Register: "version"}
+
+	tests := []struct {
+		name      string
+		resources []types.Resource
+		targets   []string
+		wantErr   string
+	}{
+		{
+			name:      "unknown name",
+			resources: []types.Resource{version, {Type: "file", Name: "release", Properties: map[string]interface{}{"content": "${registered:versoin.stdout}"}}},
+			wantErr:   "resource file.release uses output registered as versoin, which no resource registers",
+		},
+		{
+			name:      "registered twice",
+			resources: []types.Resource{version, {Type: "shell", Name: "other", Register: "version"}},
+			wantErr:   "output registered as version by both shell.version and shell.other",
+		},
+		{
+			name:      "own output",
+			resources: []types.Resource{{Type: "shell", Name: "version", Register: "version", When: ".registered.version.changed"}},
+			wantErr:   "uses the output it registers itself",
+		},
+		{
+			name:      "registrar left out",
+			resources: []types.Resource{version, {Type: "file", Name: "release", When: ".registered.version.changed"}},
+			targets:   []string{"file.release"},
+			wantErr:   "resource file.release uses the output of shell.version, which this run leaves out",
+		},
+		{
+			name:      "not a shell",
+			resources: []types.Resource{{Type: "file", Name: "release", Register: "release"}},
+			wantErr:   "register is only supported on shell resources",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := NewPlanner(registry)
+			if tt.targets != nil {
+				selection, err := NewSelection(tt.targets, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				planner.SetSelection(selection)
+			}
+			_, err := planner.CreatePlan(registerModule(tt.resources...))
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CreatePlan() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInterpolateRegistered(t *testing.T) {
+	registered := map[string]interface{}{
+		"users": registeredOutput(types.CommandOutput{Stdout: "alice\nbob\n"}, true),
+	}
+	tests := []struct {
+		value   interface{}
+		want    interface{}
+		wantErr string
+	}{
+		{value: "${registered:users.stdout_lines}", want: []interface{}{"alice", "bob"}},
+		{value: "exit ${registered:users.exit_code}", want: "exit 0"},
+		{value: "${registered:users.stdout}", want: "alice\nbob"},
+		{value: "${registered:users.output}", wantErr: "registered output has no field output"},
+		{value: "${registered:groups.stdout}", wantErr: "no output registered as groups"},
+	}
+	for _, tt := range tests {
+		got, err := interpolateRegistered(tt.value, registered)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("interpolateRegistered(%v) error = %v, want %q", tt.value, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("interpolateRegistered(%v) = %#v, %v, want %#v", tt.value, got, err, tt.want)
+		}
+	}
+}
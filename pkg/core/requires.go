@@ -0,0 +1,226 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/facts"
+)
+
+// Requirements declare the hosts a module is compatible with. They are
+// checked against each host's facts before it is planned, so a host the
+// module does not support is reported up front instead of failing part of
+// the way through the run.
+type Requirements struct {
+	// OSFamily lists the supported distribution families, such as debian
+	// or redhat (rhel also names it), or OS families such as darwin
+	OSFamily []string `yaml:"os_family,omitempty"`
+	// Distribution lists the supported distributions, such as ubuntu
+	Distribution []string `yaml:"distribution,omitempty"`
+	// Architecture lists the supported architectures, such as x86_64 or
+	// arm64; amd64 and aarch64 name the same as x86_64 and arm64
+	Architecture []string `yaml:"architecture,omitempty"`
+	MinMemoryMB  int64    `yaml:"min_memory_mb,omitempty"`
+	MinCPUs      int      `yaml:"min_cpus,omitempty"`
+}
+
+// Incompatibility is a requirement a host does not meet
+type Incompatibility struct {
+	Requirement string
+	// Detail describes what the host has instead
+	Detail string
+}
+
+func (i Incompatibility) String() string {
+	return fmt.Sprintf("%s (%s)", i.Requirement, i.Detail)
+}
+
+// Validate validates the requirements
+func (r *Requirements) Validate() error {
+	lists := []struct {
+		name   string
+		values []string
+	}{
+		{"os_family", r.OSFamily},
+		{"distribution", r.Distribution},
+		{"architecture", r.Architecture},
+	}
+	for _, list := range lists {
+		for i, value := range list.values {
+			if strings.TrimSpace(value) == "" {
+				return fmt.Errorf("%s[%d] must not be empty", list.name, i)
+			}
+		}
+	}
+	if r.MinMemoryMB < 0 {
+		return fmt.Errorf("min_memory_mb must not be negative")
+	}
+	if r.MinCPUs < 0 {
+		return fmt.Errorf("min_cpus must not be negative")
+	}
+	return nil
+}
+
+// Check returns the requirements a host's facts do not meet. Facts that
+// could not be gathered do not meet a requirement on them.
+func (r *Requirements) Check(host *facts.Facts) []Incompatibility {
+	if host == nil {
+		host = &facts.Facts{}
+	}
+	var unmet []Incompatibility
+
+	if len(r.OSFamily) > 0 && !matchesOSFamily(r.OSFamily, host) {
+		family := host.DistroFamily
+		if family == "" {
+			family = host.OSFamily
+		}
+		unmet = append(unmet, Incompatibility{
+			Requirement: "os_family " + strings.Join(r.OSFamily, ", "),
+			Detail:      describeFact("os_family", family),
+		})
+	}
+	if len(r.Distribution) > 0 && !containsFold(r.Distribution, host.Distribution) {
+		unmet = append(unmet, Incompatibility{
+			Requirement: "distribution " + strings.Join(r.Distribution, ", "),
+			Detail:      describeFact("distribution", host.Distribution),
+		})
+	}
+	if len(r.Architecture) > 0 && !matchesArchitecture(r.Architecture, host.Architecture) {
+		unmet = append(unmet, Incompatibility{
+			Requirement: "architecture " + strings.Join(r.Architecture, ", "),
+			Detail:      describeFact("architecture", host.Architecture),
+		})
+	}
+	if r.MinMemoryMB > 0 && host.MemoryMB < r.MinMemoryMB {
+		detail := fmt.Sprintf("has %d MB", host.MemoryMB)
+		if host.MemoryMB == 0 {
+			detail = "memory is unknown"
+		}
+		unmet = append(unmet, Incompatibility{Requirement: fmt.Sprintf("memory >= %d MB", r.MinMemoryMB), Detail: detail})
+	}
+	if r.MinCPUs > 0 && host.CPUs < r.MinCPUs {
+		detail := fmt.Sprintf("has %d", host.CPUs)
+		if host.CPUs == 0 {
+			detail = "CPUs are unknown"
+		}
+		unmet = append(unmet, Incompatibility{Requirement: fmt.Sprintf("CPUs >= %d", r.MinCPUs), Detail: detail})
+	}
+	return unmet
+}
+
+// merge adds the requirements of an imported module, so hosts must meet
+// both: each list keeps only the values both allow, a list left empty by
+// one is taken from the other, and the larger of each minimum applies. Lists
+// that allow nothing in common are an error, as no host could meet them.
+func (r *Requirements) merge(imported *Requirements) error {
+	lists := []struct {
+		name      string
+		values    *[]string
+		imported  []string
+		normalize func(string) string
+	}{
+		{"os_family", &r.OSFamily, imported.OSFamily, func(family string) string {
+			return facts.DistroFamily(strings.ToLower(family), nil)
+		}},
+		{"distribution", &r.Distribution, imported.Distribution, strings.ToLower},
+		{"architecture", &r.Architecture, imported.Architecture, normalizeArchitecture},
+	}
+	for _, list := range lists {
+		merged, err := intersect(*list.values, list.imported, list.normalize)
+		if err != nil {
+			return fmt.Errorf("requires %s: %w", list.name, err)
+		}
+		*list.values = merged
+	}
+	if imported.MinMemoryMB > r.MinMemoryMB {
+		r.MinMemoryMB = imported.MinMemoryMB
+	}
+	if imported.MinCPUs > r.MinCPUs {
+		r.MinCPUs = imported.MinCPUs
+	}
+	return nil
+}
+
+// intersect returns the values of a that b also allows, compared by their
+// normalized names; an empty list allows any value
+func intersect(a, b []string, normalize func(string) string) ([]string, error) {
+	if len(a) == 0 {
+		return b, nil
+	}
+	if len(b) == 0 {
+		return a, nil
+	}
+	allowed := make(map[string]bool, len(b))
+	for _, value := range b {
+		allowed[normalize(value)] = true
+	}
+	var both []string
+	for _, value := range a {
+		if allowed[normalize(value)] {
+			both = append(both, value)
+		}
+	}
+	if len(both) == 0 {
+		return nil, fmt.Errorf("%s and the imported %s have nothing in common", strings.Join(a, ", "), strings.Join(b, ", "))
+	}
+	return both, nil
+}
+
+// matchesOSFamily reports whether a host is of one of the families: its
+// distribution family, with aliases such as rhel resolved, or its OS family
+func matchesOSFamily(families []string, host *facts.Facts) bool {
+	for _, family := range families {
+		family = strings.ToLower(family)
+		if family == host.OSFamily && family != "" {
+			return true
+		}
+		if host.DistroFamily != "" && facts.DistroFamily(family, nil) == host.DistroFamily {
+			return true
+		}
+	}
+	return false
+}
+
+// architectureAliases maps the names package managers use for an
+// architecture to the one uname reports
+var architectureAliases = map[string]string{
+	"amd64": "x86_64",
+	"arm64": "aarch64",
+}
+
+// normalizeArchitecture returns the name uname reports for an architecture
+func normalizeArchitecture(name string) string {
+	name = strings.ToLower(name)
+	if alias, ok := architectureAliases[name]; ok {
+		return alias
+	}
+	return name
+}
+
+// matchesArchitecture reports whether an architecture is one of the listed
+func matchesArchitecture(architectures []string, architecture string) bool {
+	for _, candidate := range architectures {
+		if architecture != "" && normalizeArchitecture(candidate) == normalizeArchitecture(architecture) {
+			return true
+		}
+	}
+	return false
+}
+
+// containsFold reports whether value is in the list, ignoring case
+func containsFold(list []string, value string) bool {
+	for _, item := range list {
+		if value != "" && strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// describeFact describes the value of a fact for an incompatibility
+func describeFact(name, value string) string {
+	if value == "" {
+		return name + " is unknown"
+	}
+	return "is " + value
+}
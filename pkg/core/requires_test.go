@@ -0,0 +1,127 @@
+package core
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestRequirements_Check(t *testing.T) {
+	requires := &Requirements{
+		OSFamily:     []string{"debian", "rhel"},
+		Architecture: []string{"amd64"},
+		MinMemoryMB:  2048,
+		MinCPUs:      2,
+	}
+	if err := requires.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	tests := []struct {
+		name      string
+		facts     *facts.Facts
+		wantUnmet []string
+	}{
+		{
+			name: "compatible",
+			facts: &facts.Facts{
+				OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat,
+				Architecture: "x86_64", CPUs: 4, MemoryMB: 7956,
+			},
+		},
+		{
+			name: "other family and too little memory",
+			facts: &facts.Facts{
+				OSFamily: types.OSFamilyLinux, Distribution: "opensuse-leap", DistroFamily: types.DistroSUSE,
+				Architecture: "x86_64", CPUs: 2, MemoryMB: 1024,
+			},
+			wantUnmet: []string{"os_family debian, rhel (is suse)", "memory >= 2048 MB (has 1024 MB)"},
+		},
+		{
+			name: "other architecture",
+			facts: &facts.Facts{
+				OSFamily: types.OSFamilyLinux, Distribution: "ubuntu", DistroFamily: types.DistroDebian,
+				Architecture: "aarch64", CPUs: 1, MemoryMB: 4096,
+			},
+			wantUnmet: []string{"architecture amd64 (is aarch64)", "CPUs >= 2 (has 1)"},
+		},
+		{
+			name: "missing facts",
+			wantUnmet: []string{
+				"os_family debian, rhel (os_family is unknown)",
+				"architecture amd64 (architecture is unknown)",
+				"memory >= 2048 MB (memory is unknown)",
+				"CPUs >= 2 (CPUs are unknown)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var unmet []string
+			for _, incompatibility := range requires.Check(tt.facts) {
+				unmet = append(unmet, incompatibility.String())
+			}
+			if !reflect.DeepEqual(unmet, tt.wantUnmet) {
+				t.Errorf("Check() = %q, want %q", unmet, tt.wantUnmet)
+			}
+		})
+	}
+}
+
+func TestRequirements_CheckOSAndDistribution(t *testing.T) {
+	mac := &facts.Facts{OSFamily: types.OSFamilyDarwin, Architecture: "arm64"}
+	if unmet := (&Requirements{OSFamily: []string{"darwin"}, Architecture: []string{"aarch64"}}).Check(mac); len(unmet) > 0 {
+		t.Errorf("Check() of a darwin host = %v", unmet)
+	}
+
+	ubuntu := &facts.Facts{OSFamily: types.OSFamilyLinux, Distribution: "ubuntu", DistroFamily: types.DistroDebian}
+	if unmet := (&Requirements{Distribution: []string{"Ubuntu"}}).Check(ubuntu); len(unmet) > 0 {
+		t.Errorf("Check() of an ubuntu host = %v", unmet)
+	}
+	if unmet := (&Requirements{Distribution: []string{"debian"}}).Check(ubuntu); len(unmet) != 1 {
+		t.Errorf("Check() matched ubuntu against distribution debian")
+	}
+}
+
+func TestRequirements_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		requires Requirements
+		wantErr  bool
+	}{
+		{name: "empty", requires: Requirements{}},
+		{name: "families", requires: Requirements{OSFamily: []string{"debian"}, MinMemoryMB: 512}},
+		{name: "empty family", requires: Requirements{OSFamily: []string{" "}}, wantErr: true},
+		{name: "negative memory", requires: Requirements{MinMemoryMB: -1}, wantErr: true},
+		{name: "negative cpus", requires: Requirements{MinCPUs: -2}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.requires.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRequirements_Merge(t *testing.T) {
+	requires := &Requirements{OSFamily: []string{"debian", "rhel"}, Architecture: []string{"amd64", "arm64"}, MinMemoryMB: 1024}
+	if err := requires.merge(&Requirements{OSFamily: []string{"redhat", "suse"}, Distribution: []string{"rocky"}, Architecture: []string{"x86_64"}, MinMemoryMB: 2048, MinCPUs: 2}); err != nil {
+		t.Fatalf("merge() error = %v", err)
+	}
+	want := &Requirements{OSFamily: []string{"rhel"}, Distribution: []string{"rocky"}, Architecture: []string{"amd64"}, MinMemoryMB: 2048, MinCPUs: 2}
+	if !reflect.DeepEqual(requires, want) {
+		t.Errorf("merge() = %+v, want %+v", requires, want)
+	}
+
+	// An importer cannot widen what the imported module supports
+	requires = &Requirements{OSFamily: []string{"debian"}}
+	err := requires.merge(&Requirements{OSFamily: []string{"redhat"}})
+	if err == nil || err.Error() != "requires os_family: debian and the imported redhat have nothing in common" {
+		t.Errorf("merge() error = %v", err)
+	}
+}
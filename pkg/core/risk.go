@@ -0,0 +1,37 @@
+package core
+
+// actionRisk weighs how disruptive each kind of change is
+var actionRisk = map[Action]int{
+	ActionCreate: 1,
+	ActionUpdate: 2,
+	ActionDelete: 4,
+}
+
+// typeRisk weighs resource types whose changes are hard to undo or can cut
+// off access to the host; other types weigh 1
+var typeRisk = map[string]int{
+	"firewall": 4,
+	"pkg":      3,
+	"repo":     3,
+	"user":     2,
+	"service":  2,
+	"shell":    2,
+}
+
+// RiskScore rates how disruptive applying the plan could be, as the sum over
+// its changes of the action weight times the resource type weight. Changes
+// that could not be planned are not counted.
+func (p *Plan) RiskScore() int {
+	score := 0
+	for _, change := range p.Changes {
+		if change.Error != nil {
+			continue
+		}
+		weight, ok := typeRisk[change.Resource.Type]
+		if !ok {
+			weight = 1
+		}
+		score += actionRisk[change.Action] * weight
+	}
+	return score
+}
@@ -0,0 +1,44 @@
+package core
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestPlan_RiskScore(t *testing.T) {
+	change := func(action Action, resourceType string) Change {
+		return Change{Action: action, Resource: types.Resource{Type: resourceType, Name: "x"}}
+	}
+
+	tests := []struct {
+		name    string
+		changes []Change
+		want    int
+	}{
+		{name: "empty"},
+		{name: "no-op", changes: []Change{change(ActionNoOp, "pkg")}},
+		{name: "create file", changes: []Change{change(ActionCreate, "file")}, want: 1},
+		{name: "update package", changes: []Change{change(ActionUpdate, "pkg")}, want: 6},
+		{name: "delete firewall rule", changes: []Change{change(ActionDelete, "firewall")}, want: 16},
+		{
+			name: "sum of changes",
+			changes: []Change{
+				change(ActionCreate, "file"),
+				change(ActionUpdate, "service"),
+				{Action: ActionDelete, Resource: types.Resource{Type: "user", Name: "old"}, Error: errors.New("failed")},
+			},
+			want: 5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan := &Plan{Changes: tt.changes}
+			if got := plan.RiskScore(); got != tt.want {
+				t.Errorf("RiskScore() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
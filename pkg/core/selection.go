@@ -0,0 +1,184 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Selector picks resources by id (file.nginx-conf), type (type=pkg) or
+// tag (tag=web)
+type Selector struct {
+	Kind  string
+	Value string
+}
+
+// Selector kinds
+const (
+	SelectID   = "id"
+	SelectType = "type"
+	SelectTag  = "tag"
+)
+
+// ParseSelector parses a --target or --exclude value
+func ParseSelector(s string) (Selector, error) {
+	if key, value, ok := strings.Cut(s, "="); ok {
+		if value == "" {
+			return Selector{}, fmt.Errorf("selector %q has no value", s)
+		}
+		switch key {
+		case SelectType, SelectTag:
+			return Selector{Kind: key, Value: value}, nil
+		}
+		return Selector{}, fmt.Errorf("unknown selector %q, must be type=<type> or tag=<tag>", key)
+	}
+	if resourceType, name, ok := strings.Cut(s, "."); ok && resourceType != "" && name != "" {
+		return Selector{Kind: SelectID, Value: s}, nil
+	}
+	return Selector{}, fmt.Errorf("invalid selector %q, must be <type>.<name>, type=<type> or tag=<tag>", s)
+}
+
+// Matches reports whether the selector picks a resource
+func (s Selector) Matches(resource types.Resource) bool {
+	switch s.Kind {
+	case SelectID:
+		return resource.ResourceID() == s.Value
+	case SelectType:
+		return resource.Type == s.Value
+	case SelectTag:
+		for _, tag := range resource.Tags {
+			if tag == s.Value {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (s Selector) String() string {
+	if s.Kind == SelectID {
+		return s.Value
+	}
+	return s.Kind + "=" + s.Value
+}
+
+// Selection limits a run to the targeted resources, less the excluded ones.
+// Without targets every resource is targeted.
+type Selection struct {
+	Targets  []Selector
+	Excludes []Selector
+}
+
+// NewSelection parses --target and --exclude values
+func NewSelection(targets, excludes []string) (*Selection, error) {
+	selection := &Selection{}
+	for _, s := range targets {
+		selector, err := ParseSelector(s)
+		if err != nil {
+			return nil, fmt.Errorf("--target: %w", err)
+		}
+		selection.Targets = append(selection.Targets, selector)
+	}
+	for _, s := range excludes {
+		selector, err := ParseSelector(s)
+		if err != nil {
+			return nil, fmt.Errorf("--exclude: %w", err)
+		}
+		selection.Excludes = append(selection.Excludes, selector)
+	}
+	return selection, nil
+}
+
+// Empty reports whether the selection keeps every resource
+func (s *Selection) Empty() bool {
+	return s == nil || (len(s.Targets) == 0 && len(s.Excludes) == 0)
+}
+
+// Filter returns the selected resources in module order and the ids of
+// those left out. Targeted resources bring the resources they depend on;
+// excluded resources take the resources depending on them, so nothing runs
+// without what it depends on. A selector that matches nothing is an error,
+// as it is most likely a typo.
+func (s *Selection) Filter(resources []types.Resource) ([]types.Resource, []string, error) {
+	if s.Empty() {
+		return resources, nil, nil
+	}
+	index := make(map[string]int, len(resources))
+	for i, resource := range resources {
+		index[resource.ResourceID()] = i
+	}
+
+	keep := make([]bool, len(resources))
+	if len(s.Targets) == 0 {
+		for i := range keep {
+			keep[i] = true
+		}
+	}
+	for _, selector := range s.Targets {
+		matched := false
+		for i, resource := range resources {
+			if selector.Matches(resource) {
+				matched = true
+				keepWithDependencies(resources, index, i, keep)
+			}
+		}
+		if !matched {
+			return nil, nil, fmt.Errorf("--target %s matches no resource", selector)
+		}
+	}
+
+	dropped := make([]bool, len(resources))
+	for _, selector := range s.Excludes {
+		matched := false
+		for i, resource := range resources {
+			if selector.Matches(resource) {
+				matched = true
+				dropped[i] = true
+			}
+		}
+		if !matched {
+			return nil, nil, fmt.Errorf("--exclude %s matches no resource", selector)
+		}
+	}
+	// Drop what depends on a dropped resource until nothing more is dropped
+	for changed := true; changed; {
+		changed = false
+		for i, resource := range resources {
+			if dropped[i] {
+				continue
+			}
+			for _, dep := range resource.DependsOn {
+				if j, ok := index[dep]; ok && dropped[j] {
+					dropped[i] = true
+					changed = true
+					break
+				}
+			}
+		}
+	}
+
+	var selected []types.Resource
+	var left []string
+	for i, resource := range resources {
+		if keep[i] && !dropped[i] {
+			selected = append(selected, resource)
+		} else {
+			left = append(left, resource.ResourceID())
+		}
+	}
+	return selected, left, nil
+}
+
+// keepWithDependencies marks a resource and, transitively, its dependencies
+func keepWithDependencies(resources []types.Resource, index map[string]int, i int, keep []bool) {
+	if keep[i] {
+		return
+	}
+	keep[i] = true
+	for _, dep := range resources[i].DependsOn {
+		if j, ok := index[dep]; ok {
+			keepWithDependencies(resources, index, j, keep)
+		}
+	}
+}
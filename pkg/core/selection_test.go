@@ -0,0 +1,177 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    Selector
+		wantErr string
+	}{
+		{input: "file.nginx-conf", want: Selector{Kind: SelectID, Value: "file.nginx-conf"}},
+		{input: "type=pkg", want: Selector{Kind: SelectType, Value: "pkg"}},
+		{input: "tag=web", want: Selector{Kind: SelectTag, Value: "web"}},
+		{input: "tag=", wantErr: "has no value"},
+		{input: "name=nginx", wantErr: "unknown selector"},
+		{input: "nginx", wantErr: "invalid selector"},
+		{input: ".nginx", wantErr: "invalid selector"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseSelector(tt.input)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseSelector(%q) error = %v, want %q", tt.input, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSelector(%q): %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSelector(%q) = %+v, want %+v", tt.input, got, tt.want)
+			}
+			if got.String() != tt.input {
+				t.Errorf("String() = %q, want %q", got.String(), tt.input)
+			}
+		})
+	}
+}
+
+// selectionResources is a web stack: the config needs the package, the
+// service needs the config, and the motd stands alone
+func selectionResources() []types.Resource {
+	return []types.Resource{
+		{Type: "pkg", Name: "nginx", Tags: []string{"web"}},
+		{Type: "file", Name: "nginx-conf", Tags: []string{"web"}, DependsOn: []string{"pkg.nginx"}},
+		{Type: "service", Name: "nginx", DependsOn: []string{"file.nginx-conf"}},
+		{Type: "file", Name: "motd"},
+	}
+}
+
+func TestSelection_Filter(t *testing.T) {
+	tests := []struct {
+		name         string
+		targets      []string
+		excludes     []string
+		wantSelected string
+		wantExcluded string
+		wantErr      string
+	}{
+		{
+			name:         "no selection",
+			wantSelected: "pkg.nginx,file.nginx-conf,service.nginx,file.motd",
+		},
+		{
+			name:         "target brings its dependencies",
+			targets:      []string{"file.nginx-conf"},
+			wantSelected: "pkg.nginx,file.nginx-conf",
+			wantExcluded: "service.nginx,file.motd",
+		},
+		{
+			name:         "target by type",
+			targets:      []string{"type=file"},
+			wantSelected: "pkg.nginx,file.nginx-conf,file.motd",
+			wantExcluded: "service.nginx",
+		},
+		{
+			name:         "target by tag",
+			targets:      []string{"tag=web"},
+			wantSelected: "pkg.nginx,file.nginx-conf",
+			wantExcluded: "service.nginx,file.motd",
+		},
+		{
+			name:         "exclude takes its dependents",
+			excludes:     []string{"pkg.nginx"},
+			wantSelected: "file.motd",
+			wantExcluded: "pkg.nginx,file.nginx-conf,service.nginx",
+		},
+		{
+			name:         "exclude wins over target",
+			targets:      []string{"type=file"},
+			excludes:     []string{"file.motd"},
+			wantSelected: "pkg.nginx,file.nginx-conf",
+			wantExcluded: "service.nginx,file.motd",
+		},
+		{
+			name:    "target matching nothing",
+			targets: []string{"file.nginx"},
+			wantErr: "--target file.nginx matches no resource",
+		},
+		{
+			name:     "exclude matching nothing",
+			excludes: []string{"tag=db"},
+			wantErr:  "--exclude tag=db matches no resource",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selection, err := NewSelection(tt.targets, tt.excludes)
+			if err != nil {
+				t.Fatalf("NewSelection: %v", err)
+			}
+			selected, excluded, err := selection.Filter(selectionResources())
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("Filter error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Filter: %v", err)
+			}
+			var ids []string
+			for _, resource := range selected {
+				ids = append(ids, resource.ResourceID())
+			}
+			if got := strings.Join(ids, ","); got != tt.wantSelected {
+				t.Errorf("selected = %s, want %s", got, tt.wantSelected)
+			}
+			if got := strings.Join(excluded, ","); got != tt.wantExcluded {
+				t.Errorf("excluded = %s, want %s", got, tt.wantExcluded)
+			}
+		})
+	}
+}
+
+func TestNewSelection_Invalid(t *testing.T) {
+	if _, err := NewSelection([]string{"nginx"}, nil); err == nil || !strings.HasPrefix(err.Error(), "--target") {
+		t.Errorf("NewSelection error = %v, want a --target error", err)
+	}
+	if _, err := NewSelection(nil, []string{"owner=ops"}); err == nil || !strings.HasPrefix(err.Error(), "--exclude") {
+		t.Errorf("NewSelection error = %v, want an --exclude error", err)
+	}
+}
+
+func TestPlanner_CreatePlanWithSelection(t *testing.T) {
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "web", Version: "1.0.0"},
+		Spec:       ModuleSpec{Resources: selectionResources()},
+	}
+	selection, err := NewSelection([]string{"tag=web"}, nil)
+	if err != nil {
+		t.Fatalf("NewSelection: %v", err)
+	}
+
+	planner := NewPlanner(types.NewProviderRegistry())
+	planner.SetSelection(selection)
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatalf("CreatePlan: %v", err)
+	}
+	if len(plan.Changes) != 2 || plan.Changes[1].Resource.ResourceID() != "file.nginx-conf" {
+		t.Errorf("Changes = %+v, want pkg.nginx and file.nginx-conf", plan.Changes)
+	}
+	if got := strings.Join(plan.Excluded, ","); got != "service.nginx,file.motd" {
+		t.Errorf("Excluded = %s", got)
+	}
+}
@@ -0,0 +1,79 @@
+package core
+
+import (
+	"fmt"
+	"os"
+)
+
+// Stack is a list of modules applied one after another to the same hosts
+type Stack struct {
+	APIVersion string        `yaml:"apiVersion"`
+	Kind       string        `yaml:"kind"`
+	Metadata   StackMetadata `yaml:"metadata"`
+	Spec       StackSpec     `yaml:"spec"`
+}
+
+// StackMetadata contains metadata about the stack
+type StackMetadata struct {
+	Name        string `yaml:"name"`
+	Description string `yaml:"description,omitempty"`
+}
+
+// StackSpec contains the stack specification
+type StackSpec struct {
+	// Modules are applied in the order they are listed
+	Modules []StackModule `yaml:"modules"`
+}
+
+// StackModule is a module of a stack
+type StackModule struct {
+	// Source is a module file path, relative to the stack file, or a
+	// git::<repository>//<path>?ref=<ref> address
+	Source string `yaml:"source"`
+	// Vars set the module's variables
+	Vars map[string]interface{} `yaml:"vars,omitempty"`
+}
+
+// Validate validates the stack configuration
+func (s *Stack) Validate() error {
+	if s.APIVersion == "" {
+		return fmt.Errorf("apiVersion is required")
+	}
+	if s.APIVersion != "ataiva.com/chisel/v1" {
+		return fmt.Errorf("apiVersion must be ataiva.com/chisel/v1")
+	}
+	if s.Kind == "" {
+		return fmt.Errorf("kind is required")
+	}
+	if s.Kind != "Stack" {
+		return fmt.Errorf("kind must be Stack")
+	}
+	if s.Metadata.Name == "" {
+		return fmt.Errorf("metadata.name is required")
+	}
+	if len(s.Spec.Modules) == 0 {
+		return fmt.Errorf("spec.modules must list at least one module")
+	}
+	for i, module := range s.Spec.Modules {
+		if module.Source == "" {
+			return fmt.Errorf("spec.modules[%d]: source is required", i)
+		}
+	}
+	return nil
+}
+
+// LoadStackFromFile loads a stack from a YAML file
+func LoadStackFromFile(filename string) (*Stack, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read stack file %s: %w", filename, err)
+	}
+	var stack Stack
+	if err := decodeYAML(data, &stack); err != nil {
+		return nil, fmt.Errorf("failed to parse stack file %s: %w", filename, err)
+	}
+	if err := stack.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid stack in file %s: %w", filename, err)
+	}
+	return &stack, nil
+}
@@ -0,0 +1,81 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadStackFromFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "stack.yaml")
+	stack := `apiVersion: ataiva.com/chisel/v1
+kind: Stack
+metadata:
+  name: web
+spec:
+  modules:
+    - source: base/module.yaml
+    - source: git::https://example.com/modules.git//nginx/module.yaml?ref=v1
+      vars:
+        port: 8080
+`
+	if err := os.WriteFile(path, []byte(stack), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := LoadStackFromFile(path)
+	if err != nil {
+		t.Fatalf("LoadStackFromFile() error = %v", err)
+	}
+	if loaded.Metadata.Name != "web" || len(loaded.Spec.Modules) != 2 {
+		t.Fatalf("LoadStackFromFile() = %+v", loaded)
+	}
+	if loaded.Spec.Modules[0].Source != "base/module.yaml" {
+		t.Errorf("Modules[0].Source = %q", loaded.Spec.Modules[0].Source)
+	}
+	if port := loaded.Spec.Modules[1].Vars["port"]; port != 8080 {
+		t.Errorf("Modules[1].Vars[port] = %v, want 8080", port)
+	}
+}
+
+func TestStack_Validate(t *testing.T) {
+	valid := func() *Stack {
+		return &Stack{
+			APIVersion: "ataiva.com/chisel/v1",
+			Kind:       "Stack",
+			Metadata:   StackMetadata{Name: "web"},
+			Spec:       StackSpec{Modules: []StackModule{{Source: "module.yaml"}}},
+		}
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(*Stack)
+		wantErr string
+	}{
+		{name: "valid", modify: func(*Stack) {}},
+		{name: "module kind", modify: func(s *Stack) { s.Kind = "Module" }, wantErr: "kind must be Stack"},
+		{name: "no name", modify: func(s *Stack) { s.Metadata.Name = "" }, wantErr: "metadata.name is required"},
+		{name: "no modules", modify: func(s *Stack) { s.Spec.Modules = nil }, wantErr: "at least one module"},
+		{name: "no source", modify: func(s *Stack) { s.Spec.Modules[0].Source = "" }, wantErr: "spec.modules[0]: source is required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stack := valid()
+			tt.modify(stack)
+			err := stack.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Rollout strategies
+const (
+	// StrategyRolling applies a module to hosts in waves
+	StrategyRolling = "rolling"
+	// StrategyCanary applies a module to a few labeled hosts first, and to
+	// the rest once they have run for a while and their checks pass
+	StrategyCanary = "canary"
+)
+
+// Strategy describes how a module is rolled out across hosts. Without one
+// every host is applied to at once.
+type Strategy struct {
+	// Type is the kind of rollout, rolling or canary
+	Type string `yaml:"type"`
+	// Batch is how many hosts each wave applies to, as a count such as 5 or
+	// a share of the hosts such as 25%. A canary rollout applies to the
+	// hosts after the canaries in waves when it is set.
+	Batch string `yaml:"batch,omitempty"`
+	// MaxFailPercentage is the share of hosts that may fail before the
+	// rollout halts. Zero halts it at the first wave with a failure.
+	MaxFailPercentage float64 `yaml:"max_fail_percentage,omitempty"`
+
+	// Selector picks the canary hosts by their labels, such as canary=true
+	Selector string `yaml:"selector,omitempty"`
+	// Window is how long the canaries run before the checks decide whether
+	// the rest of the hosts are applied to
+	Window time.Duration `yaml:"window,omitempty"`
+	// Checks are wait_for resources that must succeed on every canary, such
+	// as an HTTP health endpoint answering 200
+	Checks []types.Resource `yaml:"checks,omitempty"`
+}
+
+// Validate validates the strategy
+func (s *Strategy) Validate() error {
+	switch s.Type {
+	case StrategyRolling:
+		if _, _, err := parseBatch(s.Batch); err != nil {
+			return err
+		}
+		if s.Selector != "" || s.Window != 0 || len(s.Checks) > 0 {
+			return fmt.Errorf("selector, window and checks only apply to the canary strategy")
+		}
+	case StrategyCanary:
+		if s.Selector == "" {
+			return fmt.Errorf("selector is required to pick the canary hosts")
+		}
+		if _, err := inventory.ParseLabelSelector(s.Selector); err != nil {
+			return fmt.Errorf("selector: %w", err)
+		}
+		if s.Batch != "" {
+			if _, _, err := parseBatch(s.Batch); err != nil {
+				return err
+			}
+		}
+		if s.Window < 0 {
+			return fmt.Errorf("window must not be negative")
+		}
+		for i, check := range s.Checks {
+			if check.Name == "" {
+				return fmt.Errorf("checks[%d]: name is required", i)
+			}
+			if check.Type != "" && check.Type != "wait_for" {
+				return fmt.Errorf("checks[%d]: type must be wait_for, got '%s'", i, check.Type)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid type '%s', must be one of: rolling, canary", s.Type)
+	}
+	if s.MaxFailPercentage < 0 || s.MaxFailPercentage > 100 {
+		return fmt.Errorf("max_fail_percentage must be between 0 and 100, got %v", s.MaxFailPercentage)
+	}
+	return nil
+}
+
+// BatchSize returns how many of the given number of hosts each wave applies
+// to. A share of the hosts is rounded up, so every wave has at least one;
+// without a batch every host is in one wave.
+func (s *Strategy) BatchSize(hosts int) int {
+	count, percent, err := parseBatch(s.Batch)
+	if err != nil {
+		return hosts
+	}
+	if percent > 0 {
+		count = int(math.Ceil(float64(hosts) * percent / 100))
+	}
+	if count < 1 {
+		count = 1
+	}
+	return count
+}
+
+// HealthChecks returns the canary checks as wait_for resources
+func (s *Strategy) HealthChecks() []types.Resource {
+	checks := make([]types.Resource, len(s.Checks))
+	for i, check := range s.Checks {
+		check.Type = "wait_for"
+		checks[i] = check
+	}
+	return checks
+}
+
+// parseBatch parses a batch size, either a count of hosts or a percentage
+// of them
+func parseBatch(batch string) (int, float64, error) {
+	batch = strings.TrimSpace(batch)
+	if batch == "" {
+		return 0, 0, fmt.Errorf("batch is required")
+	}
+	if value, ok := strings.CutSuffix(batch, "%"); ok {
+		percent, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil || percent <= 0 || percent > 100 {
+			return 0, 0, fmt.Errorf("invalid batch '%s', a percentage must be above 0%% and at most 100%%", batch)
+		}
+		return 0, percent, nil
+	}
+	count, err := strconv.Atoi(batch)
+	if err != nil || count < 1 {
+		return 0, 0, fmt.Errorf("invalid batch '%s', must be a number of hosts or a percentage such as 25%%", batch)
+	}
+	return count, 0, nil
+}
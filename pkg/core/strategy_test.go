@@ -0,0 +1,126 @@
+package core
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestStrategy_BatchSize(t *testing.T) {
+	tests := []struct {
+		batch string
+		hosts int
+		want  int
+	}{
+		{batch: "5", hosts: 20, want: 5},
+		{batch: "25%", hosts: 20, want: 5},
+		{batch: "25%", hosts: 10, want: 3},
+		{batch: "10%", hosts: 3, want: 1},
+		{batch: "100%", hosts: 7, want: 7},
+	}
+
+	for _, tt := range tests {
+		strategy := &Strategy{Type: StrategyRolling, Batch: tt.batch}
+		if err := strategy.Validate(); err != nil {
+			t.Fatalf("Validate(%q) error = %v", tt.batch, err)
+		}
+		if got := strategy.BatchSize(tt.hosts); got != tt.want {
+			t.Errorf("BatchSize(%q, %d) = %d, want %d", tt.batch, tt.hosts, got, tt.want)
+		}
+	}
+}
+
+func TestStrategy_Validate(t *testing.T) {
+	invalid := []Strategy{
+		{Type: "blue-green", Batch: "5"},
+		{Type: StrategyRolling},
+		{Type: StrategyRolling, Batch: "0"},
+		{Type: StrategyRolling, Batch: "0%"},
+		{Type: StrategyRolling, Batch: "150%"},
+		{Type: StrategyRolling, Batch: "half"},
+		{Type: StrategyRolling, Batch: "5", MaxFailPercentage: 120},
+		{Type: StrategyRolling, Batch: "5", Selector: "canary=true"},
+		{Type: StrategyCanary},
+		{Type: StrategyCanary, Selector: "canary=true", Batch: "none"},
+		{Type: StrategyCanary, Selector: "canary=true", Window: -time.Minute},
+		{Type: StrategyCanary, Selector: "canary=true", Checks: []types.Resource{{Type: "shell", Name: "health"}}},
+		{Type: StrategyCanary, Selector: "canary=true", Checks: []types.Resource{{Properties: map[string]interface{}{"port": 80}}}},
+	}
+	for _, strategy := range invalid {
+		if err := strategy.Validate(); err == nil {
+			t.Errorf("Validate(%+v) expected an error", strategy)
+		}
+	}
+}
+
+func TestModule_Strategy(t *testing.T) {
+	module, err := parseModule("module.yaml", []byte(`apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  strategy:
+    type: rolling
+    batch: 5
+    max_fail_percentage: 10
+  resources:
+    - type: file
+      name: motd
+      path: /etc/motd
+      content: hello
+`))
+	if err != nil {
+		t.Fatalf("parseModule() error = %v", err)
+	}
+	if err := module.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+	strategy := module.Spec.Strategy
+	if strategy == nil || strategy.BatchSize(20) != 5 || strategy.MaxFailPercentage != 10 {
+		t.Errorf("Strategy = %+v, want batches of 5 halting above 10%%", strategy)
+	}
+}
+
+func TestModule_CanaryStrategy(t *testing.T) {
+	module, err := parseModule("module.yaml", []byte(`apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  strategy:
+    type: canary
+    selector: canary=true
+    window: 10m
+    batch: 25%
+    checks:
+      - name: health
+        url: http://localhost:8080/health
+        status: 200
+  resources:
+    - type: file
+      name: motd
+      path: /etc/motd
+      content: hello
+`))
+	if err != nil {
+		t.Fatalf("parseModule() error = %v", err)
+	}
+	if err := module.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	strategy := module.Spec.Strategy
+	if strategy.Window != 10*time.Minute || strategy.BatchSize(8) != 2 {
+		t.Errorf("Strategy = %+v, want a 10m window and batches of 2", strategy)
+	}
+	checks := strategy.HealthChecks()
+	if len(checks) != 1 || checks[0].Type != "wait_for" || checks[0].Properties["url"] != "http://localhost:8080/health" {
+		t.Errorf("HealthChecks() = %+v, want a wait_for on the health URL", checks)
+	}
+	if strategy.Checks[0].Type != "" {
+		t.Error("HealthChecks() changed the strategy's checks")
+	}
+}
@@ -0,0 +1,195 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// varPattern matches ${var:name} references; dots in the name reach into
+// map variables, as in ${var:db.host}
+var varPattern = regexp.MustCompile(`\$\{var:([A-Za-z_][A-Za-z0-9_]*(?:\.[A-Za-z0-9_-]+)*)\}`)
+
+// ParseVar parses a --var key=value override
+func ParseVar(s string) (string, string, error) {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || key == "" {
+		return "", "", fmt.Errorf("invalid variable %q, must be key=value", s)
+	}
+	return key, value, nil
+}
+
+// LoadVarFile reads variable overrides from a YAML file of key: value pairs
+func LoadVarFile(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read var file %s: %w", filename, err)
+	}
+	vars := make(map[string]interface{})
+	if err := decodeYAML(data, &vars); err != nil {
+		return nil, fmt.Errorf("failed to parse var file %s: %w", filename, err)
+	}
+	return vars, nil
+}
+
+// LoadVarFileEncrypted reads a var file like LoadVarFile, but keeps its
+// !vault values encrypted, as their ciphertext, so the variables can be
+// saved without their secrets. DecryptVars decrypts them.
+func LoadVarFileEncrypted(filename string) (map[string]interface{}, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read var file %s: %w", filename, err)
+	}
+	vars := make(map[string]interface{})
+	if err := decodeYAMLEncrypted(data, &vars); err != nil {
+		return nil, fmt.Errorf("failed to parse var file %s: %w", filename, err)
+	}
+	return vars, nil
+}
+
+// ResolveVars sets the module's variables from spec.vars, overridden by
+// overrides, expands looped resources into one resource per item, then
+// interpolates ${var:name} references in the properties of its resources
+// and handlers. Templates of file resources see the
+// variables too, under the resource's own vars, which take precedence.
+// Overrides must name declared variables, and every reference must resolve
+// to a value, so typos fail before anything is planned.
+func (m *Module) ResolveVars(overrides map[string]interface{}) error {
+	keys := make([]string, 0, len(overrides))
+	for key := range overrides {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if _, declared := m.Spec.Vars[key]; !declared {
+			return fmt.Errorf("variable %s is not declared in spec.vars", key)
+		}
+		m.Spec.Vars[key] = overrides[key]
+	}
+
+	if err := m.expandLoops(); err != nil {
+		return err
+	}
+	for i := range m.Spec.Resources {
+		if err := m.resolveResourceVars(&m.Spec.Resources[i]); err != nil {
+			return fmt.Errorf("resource %s: %w", m.Spec.Resources[i].ResourceID(), err)
+		}
+	}
+	for i := range m.Spec.Handlers {
+		if err := m.resolveResourceVars(&m.Spec.Handlers[i].Resource); err != nil {
+			return fmt.Errorf("handler %s: %w", m.Spec.Handlers[i].Name, err)
+		}
+	}
+	return nil
+}
+
+// resolveResourceVars interpolates the variables into one resource
+func (m *Module) resolveResourceVars(resource *types.Resource) error {
+	if resource.Properties != nil {
+		properties, err := m.interpolate(resource.Properties)
+		if err != nil {
+			return err
+		}
+		resource.Properties = properties.(map[string]interface{})
+	}
+	for _, condition := range []*string{&resource.OnlyIf, &resource.NotIf, &resource.When} {
+		value, err := m.interpolate(*condition)
+		if err != nil {
+			return err
+		}
+		*condition = fmt.Sprint(value)
+	}
+	if resource.Export != nil && resource.Export.Data != nil {
+		data, err := m.interpolate(resource.Export.Data)
+		if err != nil {
+			return err
+		}
+		resource.Export.Data = data.(map[string]interface{})
+	}
+
+	_, hasTemplate := resource.Properties["template"]
+	_, hasTemplateFile := resource.Properties["template_file"]
+	if len(m.Spec.Vars) == 0 || (!hasTemplate && !hasTemplateFile) {
+		return nil
+	}
+	vars := make(map[string]interface{}, len(m.Spec.Vars))
+	for key, value := range m.Spec.Vars {
+		vars[key] = copyDefault(value)
+	}
+	if own, ok := resource.Properties["vars"].(map[string]interface{}); ok {
+		for key, value := range own {
+			vars[key] = value
+		}
+	}
+	resource.Properties["vars"] = vars
+	return nil
+}
+
+// interpolate replaces variable references in a property value. A string
+// that is a single reference takes the variable's value as is, so lists and
+// numbers keep their type; references within a string are formatted into it.
+func (m *Module) interpolate(value interface{}) (interface{}, error) {
+	switch v := value.(type) {
+	case string:
+		if match := varPattern.FindStringSubmatch(v); match != nil && match[0] == v {
+			return m.lookupVar(match[1])
+		}
+		var err error
+		result := varPattern.ReplaceAllStringFunc(v, func(reference string) string {
+			found, lookupErr := m.lookupVar(varPattern.FindStringSubmatch(reference)[1])
+			if lookupErr != nil && err == nil {
+				err = lookupErr
+			}
+			return fmt.Sprint(found)
+		})
+		return result, err
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			value, err := m.interpolate(item)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			resolved[key] = value
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(v))
+		for i, item := range v {
+			value, err := m.interpolate(item)
+			if err != nil {
+				return nil, fmt.Errorf("[%d]: %w", i, err)
+			}
+			resolved[i] = value
+		}
+		return resolved, nil
+	default:
+		return value, nil
+	}
+}
+
+// lookupVar returns the value of a variable, following dots into maps
+func (m *Module) lookupVar(name string) (interface{}, error) {
+	parts := strings.Split(name, ".")
+	value, declared := m.Spec.Vars[parts[0]]
+	if !declared {
+		return nil, fmt.Errorf("undefined variable %s", parts[0])
+	}
+	for i, part := range parts[1:] {
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("variable %s is not a map", strings.Join(parts[:i+1], "."))
+		}
+		if value, ok = fields[part]; !ok {
+			return nil, fmt.Errorf("undefined variable %s", strings.Join(parts[:i+2], "."))
+		}
+	}
+	if value == nil {
+		return nil, fmt.Errorf("variable %s has no value; set it with --var or --var-file", name)
+	}
+	return copyDefault(value), nil
+}
@@ -0,0 +1,145 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// varsModule declares an environment, a port and a database map and uses
+// them in a package, a config file template and a handler
+func varsModule() *Module {
+	return &Module{
+		Spec: ModuleSpec{
+			Vars: map[string]interface{}{
+				"env":      "production",
+				"port":     8080,
+				"packages": []interface{}{"nginx", "curl"},
+				"db":       map[string]interface{}{"host": "db.internal"},
+				"release":  nil,
+			},
+			Resources: []types.Resource{
+				{Type: "pkg", Name: "tools", Properties: map[string]interface{}{"names": "${var:packages}"}},
+				{
+					Type:   "file",
+					Name:   "config",
+					OnlyIf: "test ${var:env} = production",
+					Properties: map[string]interface{}{
+						"path":     "/etc/app/${var:env}.conf",
+						"template": "port: {{ .port }}",
+						"vars":     map[string]interface{}{"port": 9090, "db": "${var:db.host}:5432"},
+					},
+				},
+			},
+			Handlers: []Handler{{Name: "restart", Resource: types.Resource{Type: "shell", Name: "restart", Properties: map[string]interface{}{"command": "restart --port ${var:port}"}}}},
+		},
+	}
+}
+
+func TestModule_ResolveVars(t *testing.T) {
+	module := varsModule()
+	if err := module.ResolveVars(map[string]interface{}{"env": "staging"}); err != nil {
+		t.Fatalf("ResolveVars: %v", err)
+	}
+
+	tools := module.Spec.Resources[0].Properties["names"]
+	if !reflect.DeepEqual(tools, []interface{}{"nginx", "curl"}) {
+		t.Errorf("names = %#v, want the list itself", tools)
+	}
+	config := module.Spec.Resources[1]
+	if got := config.Properties["path"]; got != "/etc/app/staging.conf" {
+		t.Errorf("path = %v, want the override", got)
+	}
+	if config.OnlyIf != "test staging = production" {
+		t.Errorf("only_if = %q", config.OnlyIf)
+	}
+	wantVars := map[string]interface{}{
+		"env":      "staging",
+		"port":     9090,
+		"packages": []interface{}{"nginx", "curl"},
+		"db":       "db.internal:5432",
+		"release":  nil,
+	}
+	if got := config.Properties["vars"]; !reflect.DeepEqual(got, wantVars) {
+		t.Errorf("template vars = %#v, want %#v", got, wantVars)
+	}
+	if got := module.Spec.Handlers[0].Resource.Properties["command"]; got != "restart --port 8080" {
+		t.Errorf("handler command = %v", got)
+	}
+	if _, ok := module.Spec.Resources[0].Properties["vars"]; ok {
+		t.Error("resources without templates should not get vars")
+	}
+}
+
+func TestModule_ResolveVarsErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		reference string
+		overrides map[string]interface{}
+		want      string
+	}{
+		{name: "undeclared override", reference: "x", overrides: map[string]interface{}{"region": "eu"}, want: "variable region is not declared in spec.vars"},
+		{name: "undefined", reference: "${var:region}", want: "resource file.motd: content: undefined variable region"},
+		{name: "undefined field", reference: "${var:db.port}", want: "undefined variable db.port"},
+		{name: "not a map", reference: "${var:env.name}", want: "variable env is not a map"},
+		{name: "no value", reference: "release ${var:release}", want: "variable release has no value"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			module := varsModule()
+			module.Spec.Resources = append(module.Spec.Resources, types.Resource{Type: "file", Name: "motd", Properties: map[string]interface{}{"content": tt.reference}})
+			err := module.ResolveVars(tt.overrides)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("ResolveVars = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestModule_ResolveVarsWithoutVars(t *testing.T) {
+	module := &Module{Spec: ModuleSpec{Resources: []types.Resource{{Type: "file", Name: "motd", Properties: map[string]interface{}{"content": "${var:env}"}}}}}
+	if err := module.ResolveVars(map[string]interface{}{"env": "staging"}); err == nil {
+		t.Error("expected an override of an undeclared variable to fail")
+	}
+	if err := module.ResolveVars(nil); err == nil || !strings.Contains(err.Error(), "undefined variable env") {
+		t.Errorf("ResolveVars = %v, want the reference to fail", err)
+	}
+	module.Spec.Resources[0].Properties["content"] = "hi"
+	if err := module.ResolveVars(nil); err != nil {
+		t.Errorf("ResolveVars: %v", err)
+	}
+}
+
+func TestParseVar(t *testing.T) {
+	key, value, err := ParseVar("env=a=b")
+	if err != nil || key != "env" || value != "a=b" {
+		t.Errorf("ParseVar = %q, %q, %v", key, value, err)
+	}
+	for _, invalid := range []string{"env", "=staging"} {
+		if _, _, err := ParseVar(invalid); err == nil {
+			t.Errorf("ParseVar(%q): expected an error", invalid)
+		}
+	}
+}
+
+func TestLoadVarFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "staging.yaml")
+	if err := os.WriteFile(path, []byte("env: staging\nport: 8443\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	vars, err := LoadVarFile(path)
+	if err != nil {
+		t.Fatalf("LoadVarFile: %v", err)
+	}
+	if vars["env"] != "staging" || vars["port"] != 8443 {
+		t.Errorf("vars = %v", vars)
+	}
+	if _, err := LoadVarFile(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
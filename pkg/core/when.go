@@ -0,0 +1,131 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/templating"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// evaluateWhen reports whether a when condition holds on a target. The
+// condition is a template expression such as
+// eq .facts.distro_family "debian", with the target's facts as .facts and
+// the module's variables as .vars and, for resources planned while the
+// run is applied, the output registered so far as .registered; surrounding
+// braces are optional.
+func evaluateWhen(condition string, system *facts.Facts, vars, registered map[string]interface{}) (bool, error) {
+	expression := strings.TrimSpace(condition)
+	if strings.HasPrefix(expression, "{{") && strings.HasSuffix(expression, "}}") {
+		expression = strings.TrimSpace(expression[2 : len(expression)-2])
+	}
+	if expression == "" {
+		return false, fmt.Errorf("when condition is empty")
+	}
+	data := map[string]interface{}{
+		"facts": system.Map(),
+		"vars":  vars,
+	}
+	if registered != nil {
+		data["registered"] = registered
+	}
+	output, err := templating.NewTemplateEngine().Render("{{if "+expression+"}}true{{end}}", data)
+	if err != nil {
+		return false, fmt.Errorf("when %q: %w", condition, err)
+	}
+	return output == "true", nil
+}
+
+// filterWhen leaves out the resources whose when condition is false on the
+// target, returning the ids of those it skipped. Skipped resources have
+// nothing to do, so resources that depend on them no longer wait for them.
+// Without facts the conditions cannot be evaluated and every resource is kept.
+// Conditions on registered output are kept to evaluate when it is known.
+func filterWhen(resources []types.Resource, system *facts.Facts, vars map[string]interface{}) ([]types.Resource, []string, error) {
+	if system == nil {
+		return resources, nil, nil
+	}
+	kept := make([]types.Resource, 0, len(resources))
+	skipped := make(map[string]bool)
+	var ids []string
+	for _, resource := range resources {
+		if strings.TrimSpace(resource.When) == "" || registeredRef.MatchString(resource.When) {
+			kept = append(kept, resource)
+			continue
+		}
+		holds, err := evaluateWhen(resource.When, system, vars, nil)
+		if err != nil {
+			return nil, nil, fmt.Errorf("resource %s: %w", resource.ResourceID(), err)
+		}
+		if holds {
+			kept = append(kept, resource)
+			continue
+		}
+		skipped[resource.ResourceID()] = true
+		ids = append(ids, resource.ResourceID())
+	}
+	if len(ids) == 0 {
+		return kept, nil, nil
+	}
+
+	for i := range kept {
+		var dependsOn []string
+		for _, dep := range kept[i].DependsOn {
+			if !skipped[dep] {
+				dependsOn = append(dependsOn, dep)
+			}
+		}
+		if len(dependsOn) != len(kept[i].DependsOn) {
+			kept[i].DependsOn = dependsOn
+		}
+	}
+	return kept, ids, nil
+}
+
+// ForTarget returns the module's resources that apply to a target with the
+// system facts, the facts added to their template variables as planning
+// would, and the ids of those their when conditions leave out. Nothing is
+// read from the target, so templates can be rendered offline.
+func (m *Module) ForTarget(system *facts.Facts) ([]types.Resource, []string, error) {
+	resources, skipped, err := filterWhen(m.Spec.Resources, system, m.Spec.Vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	prepared := make([]types.Resource, len(resources))
+	for i, resource := range resources {
+		prepared[i] = WithFacts(resource, system)
+	}
+	return prepared, skipped, nil
+}
+
+// WithFacts adds the target's facts to the template variables of a file
+// resource as facts, unless the resource sets a facts variable of its own
+func WithFacts(resource types.Resource, system *facts.Facts) types.Resource {
+	if system == nil {
+		return resource
+	}
+	_, hasTemplate := resource.Properties["template"]
+	_, hasTemplateFile := resource.Properties["template_file"]
+	if !hasTemplate && !hasTemplateFile {
+		return resource
+	}
+	existing, _ := resource.Properties["vars"].(map[string]interface{})
+	if _, ok := existing["facts"]; ok {
+		return resource
+	}
+
+	vars := make(map[string]interface{}, len(existing)+1)
+	for key, value := range existing {
+		vars[key] = value
+	}
+	vars["facts"] = system.Map()
+
+	properties := make(map[string]interface{}, len(resource.Properties)+1)
+	for key, value := range resource.Properties {
+		properties[key] = value
+	}
+	properties["vars"] = vars
+	resource.Properties = properties
+	return resource
+}
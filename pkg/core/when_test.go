@@ -0,0 +1,192 @@
+package core
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestEvaluateWhen(t *testing.T) {
+	ubuntu := &facts.Facts{Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "ubuntu", DistroFamily: types.DistroDebian, CPUs: 4, MemoryMB: 8192}
+	vars := map[string]interface{}{"env": "production"}
+
+	tests := []struct {
+		name      string
+		condition string
+		want      bool
+		wantErr   string
+	}{
+		{name: "family", condition: `eq .facts.distro_family "debian"`, want: true},
+		{name: "other family", condition: `eq .facts.distro_family "redhat"`},
+		{name: "braces", condition: `{{ ne .facts.distribution "debian" }}`, want: true},
+		{name: "numbers", condition: `ge .facts.cpus 4`, want: true},
+		{name: "variables and facts", condition: `and (eq .vars.env "production") (gt .facts.memory_mb 16384)`},
+		{name: "value", condition: `.facts.distribution`, want: true},
+		{name: "empty", condition: " ", wantErr: "when condition is empty"},
+		{name: "syntax", condition: `eq .facts.cpus (`, wantErr: "failed to parse template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evaluateWhen(tt.condition, ubuntu, vars, nil)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("evaluateWhen() error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("evaluateWhen() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("evaluateWhen() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanner_When(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&countingProvider{resourceType: "pkg"})
+	registry.Register(&countingProvider{resourceType: "file"})
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "web", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Resources: []types.Resource{
+				{Type: "pkg", Name: "apache2", State: types.StatePresent, When: `eq .facts.distro_family "debian"`},
+				{Type: "pkg", Name: "httpd", State: types.StatePresent, When: `eq .facts.distro_family "redhat"`},
+				{
+					Type: "file", Name: "site", State: types.StatePresent, DependsOn: []string{"pkg.apache2", "pkg.httpd"},
+					Properties: map[string]interface{}{"path": "/etc/site.conf", "template": "listen {{ .facts.primary_ip }}"},
+				},
+			},
+		},
+	}
+
+	planner := NewPlanner(registry)
+	planner.SetSystemFacts(&facts.Facts{Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat, IPAddresses: []string{"10.0.0.5"}})
+	plan, err := planner.CreatePlan(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var ids []string
+	for _, change := range plan.Changes {
+		ids = append(ids, change.Resource.ResourceID())
+	}
+	if !reflect.DeepEqual(ids, []string{"pkg.httpd", "file.site"}) || !reflect.DeepEqual(plan.Skipped, []string{"pkg.apache2"}) {
+		t.Fatalf("planned %v, skipped %v", ids, plan.Skipped)
+	}
+	site := plan.Changes[1].Resource
+	if !reflect.DeepEqual(site.DependsOn, []string{"pkg.httpd"}) {
+		t.Errorf("file.site depends on %v", site.DependsOn)
+	}
+	vars, _ := site.Properties["vars"].(map[string]interface{})
+	if hostFacts, _ := vars["facts"].(map[string]interface{}); hostFacts["primary_ip"] != "10.0.0.5" {
+		t.Errorf("template vars = %v", vars)
+	}
+	if len(module.Spec.Resources[2].DependsOn) != 2 || module.Spec.Resources[2].Properties["vars"] != nil {
+		t.Error("planning changed the module")
+	}
+
+	// Without facts the conditions cannot be evaluated
+	plan, err = NewPlanner(registry).CreatePlan(module)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Changes) != 3 || plan.Skipped != nil {
+		t.Errorf("plan without facts has %d changes, skipped %v", len(plan.Changes), plan.Skipped)
+	}
+
+	module.Spec.Resources[0].When = "eq .facts.cpus ("
+	if _, err := planner.CreatePlan(module); err == nil || !strings.Contains(err.Error(), "resource pkg.apache2: when") {
+		t.Errorf("CreatePlan() with a broken condition = %v", err)
+	}
+}
+
+func TestPlanner_Selector(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(&countingProvider{resourceType: "pkg"})
+
+	module := &Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata:   ModuleMetadata{Name: "web", Version: "1.0.0"},
+		Spec: ModuleSpec{
+			Selector:  "os_family=redhat AND cloud=aws",
+			Resources: []types.Resource{{Type: "pkg", Name: "httpd", State: types.StatePresent}},
+		},
+	}
+	rocky := &facts.Facts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroRedHat, Cloud: facts.CloudAWS}
+
+	tests := []struct {
+		name    string
+		system  *facts.Facts
+		labels  map[string]string
+		matches bool
+	}{
+		{name: "derived labels", system: rocky, matches: true},
+		{name: "declared label wins", system: rocky, labels: map[string]string{"cloud": "on-prem"}},
+		{name: "other family", system: &facts.Facts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroDebian, Cloud: facts.CloudAWS}},
+		{name: "declared label fills in", system: &facts.Facts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroRedHat}, labels: map[string]string{"cloud": "aws"}, matches: true},
+		{name: "without facts"},
+		{name: "without facts, declared labels", labels: map[string]string{"os_family": "redhat", "cloud": "aws"}, matches: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			planner := NewPlanner(registry)
+			planner.SetSystemFacts(tt.system)
+			planner.SetLabels(tt.labels)
+			plan, err := planner.CreatePlan(module)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.matches {
+				if plan.Unmatched || len(plan.Changes) != 1 {
+					t.Errorf("plan = %+v, want the module planned", plan)
+				}
+				return
+			}
+			if !plan.Unmatched || len(plan.Changes) != 0 || !reflect.DeepEqual(plan.Skipped, []string{"pkg.httpd"}) {
+				t.Errorf("plan = %+v, want every resource skipped", plan)
+			}
+		})
+	}
+
+	module.Spec.Selector = "cloud="
+	if err := module.Validate(); err == nil || !strings.Contains(err.Error(), "spec.selector") {
+		t.Errorf("Validate() with a broken selector = %v", err)
+	}
+}
+
+func TestModule_ForTarget(t *testing.T) {
+	module := &Module{
+		Spec: ModuleSpec{
+			Vars: map[string]interface{}{"env": "staging"},
+			Resources: []types.Resource{
+				{Type: "file", Name: "apt", When: `eq .facts.distro_family "debian"`, Properties: map[string]interface{}{"path": "/etc/apt.conf", "content": "x"}},
+				{Type: "file", Name: "site", When: `eq .vars.env "staging"`, Properties: map[string]interface{}{"path": "/etc/site.conf", "template": "{{ .facts.hostname }}"}},
+			},
+		},
+	}
+
+	resources, skipped, err := module.ForTarget(&facts.Facts{Host: "web1", DistroFamily: types.DistroRedHat, Hostname: "web1.example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resources) != 1 || resources[0].Name != "site" || !reflect.DeepEqual(skipped, []string{"file.apt"}) {
+		t.Fatalf("ForTarget() = %v, skipped %v", resources, skipped)
+	}
+	vars, _ := resources[0].Properties["vars"].(map[string]interface{})
+	if hostFacts, _ := vars["facts"].(map[string]interface{}); hostFacts["hostname"] != "web1.example.com" {
+		t.Errorf("template vars = %v", vars)
+	}
+	if module.Spec.Resources[1].Properties["vars"] != nil {
+		t.Error("ForTarget() changed the module")
+	}
+}
@@ -0,0 +1,97 @@
+package debuglog
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/redact"
+)
+
+// maxValueLength caps how much of a single command or output is logged;
+// file uploads in particular send large base64 payloads
+const maxValueLength = 4096
+
+// Logger writes debug records with every message passed through a
+// redactor. A nil logger discards everything, so callers need not check
+// whether debugging is enabled. It is safe for concurrent use.
+type Logger struct {
+	out      *syncWriter
+	redactor *redact.Redactor
+	prefix   string
+	now      func() time.Time
+}
+
+// syncWriter serialises writes from loggers sharing an output
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// New creates a debug logger writing to w. A nil redactor applies only the
+// built-in redaction patterns.
+func New(w io.Writer, redactor *redact.Redactor) *Logger {
+	if redactor == nil {
+		redactor = redact.New()
+	}
+	return &Logger{
+		out:      &syncWriter{w: w},
+		redactor: redactor,
+		now:      time.Now,
+	}
+}
+
+// With returns a logger that labels records with a prefix, such as the host
+// they concern, and shares this logger's output and redactor
+func (l *Logger) With(prefix string) *Logger {
+	if l == nil {
+		return nil
+	}
+	child := *l
+	if child.prefix != "" {
+		prefix = child.prefix + " " + prefix
+	}
+	child.prefix = prefix
+	return &child
+}
+
+// Redactor returns the logger's redactor, so secrets known at runtime can be
+// registered with it
+func (l *Logger) Redactor() *redact.Redactor {
+	if l == nil {
+		return nil
+	}
+	return l.redactor
+}
+
+// Printf writes a record for a component such as "exec" or "provider"
+func (l *Logger) Printf(component, format string, args ...interface{}) {
+	if l == nil {
+		return
+	}
+	message := l.redactor.Redact(fmt.Sprintf(format, args...))
+
+	var b strings.Builder
+	b.WriteString(l.now().UTC().Format(time.RFC3339Nano))
+	if l.prefix != "" {
+		b.WriteString(" [" + l.prefix + "]")
+	}
+	b.WriteString(" " + component + ": ")
+	// Indent continuation lines so multi-line output stays one record
+	b.WriteString(strings.ReplaceAll(strings.TrimRight(message, "\n"), "\n", "\n    "))
+	b.WriteString("\n")
+
+	l.out.mu.Lock()
+	defer l.out.mu.Unlock()
+	io.WriteString(l.out.w, b.String())
+}
+
+// Truncate shortens long values for logging, noting how much was dropped
+func Truncate(value string) string {
+	if len(value) <= maxValueLength {
+		return value
+	}
+	return fmt.Sprintf("%s... (%d more bytes)", value[:maxValueLength], len(value)-maxValueLength)
+}
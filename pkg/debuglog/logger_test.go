@@ -0,0 +1,103 @@
+package debuglog
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/redact"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// stubProvider returns a fixed diff for every resource
+type stubProvider struct{}
+
+func (stubProvider) Type() string                            { return "user" }
+func (stubProvider) Validate(resource *types.Resource) error { return nil }
+func (stubProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return map[string]interface{}{"exists": false}, nil
+}
+func (stubProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	return &types.ResourceDiff{Action: types.ActionCreate, Reason: "user does not exist", Changes: map[string]interface{}{"password": "s3cr3t-pw"}}, nil
+}
+func (stubProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	return nil
+}
+func (stubProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{OSFamilies: []string{types.OSFamilyLinux}}
+}
+
+func newTestLogger(out *strings.Builder, redactor *redact.Redactor) *Logger {
+	logger := New(out, redactor)
+	logger.now = func() time.Time { return time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC) }
+	return logger
+}
+
+func TestLogger_Printf(t *testing.T) {
+	var out strings.Builder
+	logger := newTestLogger(&out, redact.New("hunter22")).With("web1")
+
+	logger.Printf("exec", "stdout: %s", "user=admin\npassword=hunter22\n")
+	want := "2024-05-01T12:00:00Z [web1] exec: stdout: user=admin\n    password=[REDACTED]\n"
+	if out.String() != want {
+		t.Errorf("Printf() wrote %q, want %q", out.String(), want)
+	}
+
+	var nilLogger *Logger
+	nilLogger.Printf("exec", "ignored")
+	if nilLogger.With("web1") != nil || nilLogger.Redactor() != nil {
+		t.Error("Expected a nil logger to stay nil")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	if Truncate("short") != "short" {
+		t.Error("Expected short values to be kept")
+	}
+	got := Truncate(strings.Repeat("a", maxValueLength+10))
+	if !strings.HasSuffix(got, "... (10 more bytes)") {
+		t.Errorf("Truncate() = %q", got[maxValueLength:])
+	}
+}
+
+func TestWrapRegistry(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	registry.Register(stubProvider{})
+
+	if wrapped, _ := WrapRegistry(registry, nil); wrapped != registry {
+		t.Error("Expected a registry without a logger to be returned unchanged")
+	}
+
+	var out strings.Builder
+	wrapped, err := WrapRegistry(registry, newTestLogger(&out, nil))
+	if err != nil {
+		t.Fatalf("WrapRegistry() error = %v", err)
+	}
+	provider, err := wrapped.Get("user")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if caps := types.ProviderCapabilities(provider); len(caps.OSFamilies) != 1 {
+		t.Errorf("Expected capabilities to be passed through, got %+v", caps)
+	}
+
+	ctx := context.Background()
+	resource := &types.Resource{Type: "user", Name: "deploy", Properties: map[string]interface{}{"shell": "/bin/bash"}}
+	provider.Validate(resource)
+	current, _ := provider.Read(ctx, resource)
+	diff, _ := provider.Diff(ctx, resource, current)
+	provider.Apply(ctx, resource, diff)
+
+	for _, want := range []string{
+		"provider: user.deploy validate properties={shell:/bin/bash} error=<nil>",
+		"provider: user.deploy read state={exists:false}",
+		`provider: user.deploy decision action=create reason="user does not exist" changes={password:[REDACTED]}`,
+		"provider: user.deploy apply action=create",
+		"provider: user.deploy apply done error=<nil>",
+	} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("Expected log to contain %q, got:\n%s", want, out.String())
+		}
+	}
+}
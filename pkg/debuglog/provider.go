@@ -0,0 +1,107 @@
+package debuglog
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Provider wraps a provider and logs each decision it makes: validation,
+// the state it reads, the diff it computes and the outcome of applying it
+type Provider struct {
+	types.Provider
+	logger *Logger
+}
+
+// NewProvider wraps a provider with a debug logger
+func NewProvider(provider types.Provider, logger *Logger) *Provider {
+	return &Provider{
+		Provider: provider,
+		logger:   logger,
+	}
+}
+
+// Validate validates the resource and logs its properties and the result
+func (p *Provider) Validate(resource *types.Resource) error {
+	err := p.Provider.Validate(resource)
+	p.logger.Printf("provider", "%s validate properties=%s error=%v", resource.ResourceID(), formatMap(resource.Properties), err)
+	return err
+}
+
+// Read reads the current state and logs it
+func (p *Provider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	state, err := p.Provider.Read(ctx, resource)
+	if err != nil {
+		p.logger.Printf("provider", "%s read error=%v", resource.ResourceID(), err)
+		return state, err
+	}
+	p.logger.Printf("provider", "%s read state=%s", resource.ResourceID(), formatMap(state))
+	return state, nil
+}
+
+// Diff computes the diff and logs the decision with its reason and changes
+func (p *Provider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff, err := p.Provider.Diff(ctx, resource, current)
+	if err != nil {
+		p.logger.Printf("provider", "%s diff error=%v", resource.ResourceID(), err)
+		return diff, err
+	}
+	if diff != nil {
+		p.logger.Printf("provider", "%s decision action=%s reason=%q changes=%s", resource.ResourceID(), diff.Action, diff.Reason, formatMap(diff.Changes))
+	}
+	return diff, nil
+}
+
+// Apply applies the diff and logs the outcome
+func (p *Provider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	action := types.DiffAction("")
+	if diff != nil {
+		action = diff.Action
+	}
+	p.logger.Printf("provider", "%s apply action=%s", resource.ResourceID(), action)
+	err := p.Provider.Apply(ctx, resource, diff)
+	p.logger.Printf("provider", "%s apply done error=%v", resource.ResourceID(), err)
+	return err
+}
+
+// Capabilities returns the capabilities of the wrapped provider
+func (p *Provider) Capabilities() types.Capabilities {
+	return types.ProviderCapabilities(p.Provider)
+}
+
+// WrapRegistry returns a registry whose providers log their decisions. A
+// nil logger returns the registry unchanged.
+func WrapRegistry(registry *types.ProviderRegistry, logger *Logger) (*types.ProviderRegistry, error) {
+	if logger == nil {
+		return registry, nil
+	}
+	wrapped := types.NewProviderRegistry()
+	for _, resourceType := range registry.Types() {
+		provider, err := registry.Get(resourceType)
+		if err != nil {
+			return nil, err
+		}
+		if err := wrapped.Register(NewProvider(provider, logger)); err != nil {
+			return nil, fmt.Errorf("failed to wrap %s provider: %w", resourceType, err)
+		}
+	}
+	return wrapped, nil
+}
+
+// formatMap renders a map with sorted keys, truncating long values
+func formatMap(values map[string]interface{}) string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		parts = append(parts, fmt.Sprintf("%s:%s", key, Truncate(fmt.Sprintf("%v", values[key]))))
+	}
+	return "{" + strings.Join(parts, " ") + "}"
+}
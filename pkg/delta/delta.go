@@ -0,0 +1,237 @@
+// Package delta implements rsync-style delta transfer: the receiver sends a
+// signature of the blocks it already has, the sender finds those blocks at any
+// offset in the new data with a rolling checksum, and only the remaining
+// bytes are sent.
+package delta
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// DefaultBlockSize is the block size used for signatures
+const DefaultBlockSize = 128 * 1024
+
+// strongLen is the number of hex characters of SHA-256 kept per block
+const strongLen = 32
+
+// Block is the signature of one block of the receiver's data
+type Block struct {
+	Weak   uint32
+	Strong string
+}
+
+// Signature describes the receiver's data block by block
+type Signature struct {
+	BlockSize int
+	Blocks    []Block
+}
+
+// Op is one step of rebuilding the new data: either copy a block of the old
+// data, or insert literal bytes
+type Op struct {
+	// Block is the index of the old block to copy, or -1 for literal data
+	Block int
+	Data  []byte
+}
+
+// Delta is the list of operations that turns the old data into the new data
+type Delta struct {
+	BlockSize int
+	Ops       []Op
+}
+
+// WeakSum returns the rsync weak checksum of a block
+func WeakSum(block []byte) uint32 {
+	var a, b uint32
+	n := uint32(len(block))
+	for i, x := range block {
+		a += uint32(x)
+		b += (n - uint32(i)) * uint32(x)
+	}
+	return (a & 0xffff) | (b&0xffff)<<16
+}
+
+// StrongSum returns the strong checksum of a block
+func StrongSum(block []byte) string {
+	sum := sha256.Sum256(block)
+	return hex.EncodeToString(sum[:])[:strongLen]
+}
+
+// NewSignature computes the signature of data
+func NewSignature(data []byte, blockSize int) Signature {
+	sig := Signature{BlockSize: blockSize}
+	for start := 0; start < len(data); start += blockSize {
+		end := start + blockSize
+		if end > len(data) {
+			end = len(data)
+		}
+		block := data[start:end]
+		sig.Blocks = append(sig.Blocks, Block{Weak: WeakSum(block), Strong: StrongSum(block)})
+	}
+	return sig
+}
+
+// Compute finds the blocks of the signature in data and returns the delta
+// that rebuilds data from the receiver's blocks plus literal bytes
+func Compute(sig Signature, data []byte) Delta {
+	delta := Delta{BlockSize: sig.BlockSize}
+	size := sig.BlockSize
+	if size <= 0 || len(sig.Blocks) == 0 {
+		delta.addLiteral(data)
+		return delta
+	}
+
+	index := make(map[uint32][]int)
+	for i, block := range sig.Blocks {
+		index[block.Weak] = append(index[block.Weak], i)
+	}
+
+	// Only full-size blocks are matched; a short last block is sent as literal data
+	literalStart := 0
+	pos := 0
+	var a, b uint32
+	rolling := false
+
+	for pos+size <= len(data) {
+		window := data[pos : pos+size]
+		if !rolling {
+			a, b = sums(window)
+			rolling = true
+		}
+
+		if match := lookup(sig, index, a, b, window); match >= 0 {
+			delta.addLiteral(data[literalStart:pos])
+			delta.Ops = append(delta.Ops, Op{Block: match})
+			pos += size
+			literalStart = pos
+			rolling = false
+			continue
+		}
+
+		// Roll the window one byte forward
+		if pos+size < len(data) {
+			out, in := uint32(data[pos]), uint32(data[pos+size])
+			a = a - out + in
+			b = b - uint32(size)*out + a
+		}
+		pos++
+	}
+	delta.addLiteral(data[literalStart:])
+	return delta
+}
+
+// Patch rebuilds the new data from the old data and a delta
+func Patch(old []byte, delta Delta) ([]byte, error) {
+	var out []byte
+	for _, op := range delta.Ops {
+		if op.Block < 0 {
+			out = append(out, op.Data...)
+			continue
+		}
+		start := op.Block * delta.BlockSize
+		if start >= len(old) {
+			return nil, fmt.Errorf("delta references block %d beyond the old data", op.Block)
+		}
+		end := start + delta.BlockSize
+		if end > len(old) {
+			end = len(old)
+		}
+		out = append(out, old[start:end]...)
+	}
+	return out, nil
+}
+
+// LiteralBytes returns how many bytes of the delta are sent as literal data
+func (d Delta) LiteralBytes() int {
+	total := 0
+	for _, op := range d.Ops {
+		total += len(op.Data)
+	}
+	return total
+}
+
+// Encode writes the delta in the line format read by the receiver: "B <index>"
+// copies an old block and "D <base64>" inserts literal bytes
+func (d Delta) Encode(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	for _, op := range d.Ops {
+		var err error
+		if op.Block >= 0 {
+			_, err = fmt.Fprintf(bw, "B %d\n", op.Block)
+		} else {
+			_, err = fmt.Fprintf(bw, "D %s\n", base64.StdEncoding.EncodeToString(op.Data))
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// ParseSignature parses a signature with one "<weak> <strong>" line per block
+func ParseSignature(output string, blockSize int) (Signature, error) {
+	sig := Signature{BlockSize: blockSize}
+	for i, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		if line == "" {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return Signature{}, fmt.Errorf("invalid signature line %d: %q", i+1, line)
+		}
+		weak, err := strconv.ParseUint(fields[0], 10, 32)
+		if err != nil {
+			return Signature{}, fmt.Errorf("invalid weak checksum on line %d: %w", i+1, err)
+		}
+		if len(fields[1]) != strongLen {
+			return Signature{}, fmt.Errorf("invalid strong checksum on line %d", i+1)
+		}
+		sig.Blocks = append(sig.Blocks, Block{Weak: uint32(weak), Strong: fields[1]})
+	}
+	return sig, nil
+}
+
+// addLiteral appends literal bytes, merging with a preceding literal
+func (d *Delta) addLiteral(data []byte) {
+	if len(data) == 0 {
+		return
+	}
+	if n := len(d.Ops); n > 0 && d.Ops[n-1].Block < 0 {
+		d.Ops[n-1].Data = append(d.Ops[n-1].Data, data...)
+		return
+	}
+	d.Ops = append(d.Ops, Op{Block: -1, Data: append([]byte(nil), data...)})
+}
+
+// sums returns the two halves of the weak checksum of a block
+func sums(block []byte) (uint32, uint32) {
+	var a, b uint32
+	n := uint32(len(block))
+	for i, x := range block {
+		a += uint32(x)
+		b += (n - uint32(i)) * uint32(x)
+	}
+	return a, b
+}
+
+// lookup returns the index of the signature block matching the window, or -1
+func lookup(sig Signature, index map[uint32][]int, a, b uint32, window []byte) int {
+	candidates, ok := index[(a&0xffff)|(b&0xffff)<<16]
+	if !ok {
+		return -1
+	}
+	strong := StrongSum(window)
+	for _, i := range candidates {
+		if sig.Blocks[i].Strong == strong {
+			return i
+		}
+	}
+	return -1
+}
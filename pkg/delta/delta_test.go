@@ -0,0 +1,109 @@
+package delta
+
+import (
+	"bytes"
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func randomData(seed int64, n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(seed)).Read(data)
+	return data
+}
+
+func TestComputeAndPatch(t *testing.T) {
+	const blockSize = 64
+	old := randomData(1, 20*blockSize+10)
+
+	modified := append([]byte(nil), old...)
+	copy(modified[5*blockSize+3:], []byte("changed"))
+
+	tests := []struct {
+		name       string
+		old        []byte
+		new        []byte
+		maxLiteral int
+	}{
+		{name: "identical", old: old, new: old, maxLiteral: 10},
+		{name: "block changed", old: old, new: modified, maxLiteral: blockSize + 10},
+		{name: "bytes inserted at start", old: old, new: append([]byte("prefix"), old...), maxLiteral: 6 + 10},
+		{name: "bytes appended", old: old, new: append(append([]byte(nil), old...), "suffix"...), maxLiteral: 10 + 6},
+		{name: "middle removed", old: old, new: append(append([]byte(nil), old[:3*blockSize]...), old[4*blockSize+7:]...), maxLiteral: blockSize + 10},
+		{name: "no old data", old: nil, new: old, maxLiteral: len(old)},
+		{name: "unrelated data", old: old, new: randomData(2, len(old)), maxLiteral: len(old)},
+		{name: "shorter than a block", old: old, new: []byte("tiny"), maxLiteral: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := Compute(NewSignature(tt.old, blockSize), tt.new)
+			got, err := Patch(tt.old, d)
+			if err != nil {
+				t.Fatalf("Patch() error = %v", err)
+			}
+			if !bytes.Equal(got, tt.new) {
+				t.Fatalf("Patch() rebuilt %d bytes that differ from the %d expected", len(got), len(tt.new))
+			}
+			if d.LiteralBytes() > tt.maxLiteral {
+				t.Errorf("LiteralBytes() = %d, want at most %d", d.LiteralBytes(), tt.maxLiteral)
+			}
+		})
+	}
+}
+
+func TestWeakSumRolls(t *testing.T) {
+	data := randomData(3, 200)
+	const size = 32
+
+	a, b := sums(data[:size])
+	for pos := 0; pos+size < len(data); pos++ {
+		out, in := uint32(data[pos]), uint32(data[pos+size])
+		a = a - out + in
+		b = b - size*out + a
+		if got, want := (a&0xffff)|(b&0xffff)<<16, WeakSum(data[pos+1:pos+1+size]); got != want {
+			t.Fatalf("rolled checksum at %d = %d, want %d", pos+1, got, want)
+		}
+	}
+}
+
+func TestPatch_BlockOutOfRange(t *testing.T) {
+	if _, err := Patch([]byte("abc"), Delta{BlockSize: 4, Ops: []Op{{Block: 1}}}); err == nil {
+		t.Error("Expected error for a block beyond the old data")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	d := Delta{BlockSize: 4, Ops: []Op{{Block: 2}, {Block: -1, Data: []byte("hi")}}}
+	var buf bytes.Buffer
+	if err := d.Encode(&buf); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	if want := "B 2\nD aGk=\n"; buf.String() != want {
+		t.Errorf("Encode() = %q, want %q", buf.String(), want)
+	}
+}
+
+func TestParseSignature(t *testing.T) {
+	sig := NewSignature([]byte("hello world"), 4)
+	var lines []string
+	for _, block := range sig.Blocks {
+		lines = append(lines, strconv.FormatUint(uint64(block.Weak), 10)+" "+block.Strong)
+	}
+
+	parsed, err := ParseSignature(strings.Join(lines, "\n")+"\n", 4)
+	if err != nil {
+		t.Fatalf("ParseSignature() error = %v", err)
+	}
+	if len(parsed.Blocks) != 3 || parsed.Blocks[2] != sig.Blocks[2] {
+		t.Errorf("ParseSignature() = %+v, want %+v", parsed, sig)
+	}
+
+	for _, invalid := range []string{"1", "x " + strings.Repeat("a", 32), "1 abc"} {
+		if _, err := ParseSignature(invalid, 4); err == nil {
+			t.Errorf("ParseSignature(%q) expected error", invalid)
+		}
+	}
+}
@@ -0,0 +1,168 @@
+package docsite
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/executor"
+)
+
+// Graph layout, in pixels
+const (
+	nodeWidth   = 180
+	nodeHeight  = 28
+	columnWidth = 240
+	rowHeight   = 44
+	graphMargin = 12
+)
+
+// Node is a resource in a dependency graph, placed in the column of its
+// level: the longest chain of resources it runs after
+type Node struct {
+	ID    string
+	Type  string
+	Level int
+	Row   int
+}
+
+// X returns the left of the node in the SVG drawing
+func (n Node) X() int { return graphMargin + n.Level*columnWidth }
+
+// Y returns the top of the node in the SVG drawing
+func (n Node) Y() int { return graphMargin + n.Row*rowHeight }
+
+// Edge is an ordering between two resources. Implicit edges come from the
+// type ordering forge adds, such as packages before services, rather than
+// depends_on.
+type Edge struct {
+	From     Node
+	To       Node
+	Implicit bool
+}
+
+// X1 returns the left of an edge, on the right side of the node it leaves
+func (e Edge) X1() int { return e.From.X() + nodeWidth }
+
+// Y1 returns the height an edge leaves its node at
+func (e Edge) Y1() int { return e.From.Y() + nodeHeight/2 }
+
+// X2 returns the right of an edge, on the left side of the node it enters
+func (e Edge) X2() int { return e.To.X() }
+
+// Y2 returns the height an edge enters its node at
+func (e Edge) Y2() int { return e.To.Y() + nodeHeight/2 }
+
+// Graph is the order a module's resources are applied in
+type Graph struct {
+	Nodes []Node
+	Edges []Edge
+	// External lists depends_on entries naming resources the module does
+	// not have, as they are shown but not drawn
+	External []string
+	Width    int
+	Height   int
+}
+
+// BuildGraph returns the dependency graph of a module's resources, with the
+// explicit depends_on edges and the implicit ones the scheduler adds
+func BuildGraph(module *core.Module) (*Graph, error) {
+	known := make(map[string]bool, len(module.Spec.Resources))
+	for _, resource := range module.Spec.Resources {
+		known[resource.ResourceID()] = true
+	}
+
+	graph := &Graph{}
+	plan := &core.Plan{}
+	for _, resource := range module.Spec.Resources {
+		var deps []string
+		for _, dep := range resource.DependsOn {
+			if known[dep] {
+				deps = append(deps, dep)
+			} else {
+				graph.External = append(graph.External, fmt.Sprintf("%s depends on %s", resource.ResourceID(), dep))
+			}
+		}
+		resource.DependsOn = deps
+		plan.Changes = append(plan.Changes, core.Change{Resource: resource})
+	}
+
+	edges, err := executor.NewScheduler(0).Graph(plan)
+	if err != nil {
+		return nil, fmt.Errorf("failed to order resources of module %s: %w", module.Metadata.Name, err)
+	}
+
+	levels := make([]int, len(plan.Changes))
+	for changed := true; changed; {
+		changed = false
+		for from, tos := range edges {
+			for _, to := range tos {
+				if levels[to] < levels[from]+1 {
+					levels[to] = levels[from] + 1
+					changed = true
+				}
+			}
+		}
+	}
+
+	rows := make(map[int]int)
+	for i, change := range plan.Changes {
+		graph.Nodes = append(graph.Nodes, Node{
+			ID:    change.Resource.ResourceID(),
+			Type:  change.Resource.Type,
+			Level: levels[i],
+			Row:   rows[levels[i]],
+		})
+		rows[levels[i]]++
+	}
+
+	froms := make([]int, 0, len(edges))
+	for from := range edges {
+		froms = append(froms, from)
+	}
+	sort.Ints(froms)
+	for _, from := range froms {
+		tos := append([]int{}, edges[from]...)
+		sort.Ints(tos)
+		for _, to := range tos {
+			explicit := false
+			for _, dep := range plan.Changes[to].Resource.DependsOn {
+				explicit = explicit || dep == graph.Nodes[from].ID
+			}
+			graph.Edges = append(graph.Edges, Edge{From: graph.Nodes[from], To: graph.Nodes[to], Implicit: !explicit})
+		}
+	}
+
+	columns, height := 0, 0
+	for level, count := range rows {
+		if level+1 > columns {
+			columns = level + 1
+		}
+		if count > height {
+			height = count
+		}
+	}
+	graph.Width = 2*graphMargin + max(columns-1, 0)*columnWidth + nodeWidth
+	graph.Height = 2*graphMargin + max(height-1, 0)*rowHeight + nodeHeight
+	return graph, nil
+}
+
+// DOT returns the graph in the Graphviz DOT language, for tools that draw
+// or analyse graphs
+func (g *Graph) DOT(name string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "digraph %q {\n  rankdir=LR;\n  node [shape=box];\n", name)
+	for _, node := range g.Nodes {
+		fmt.Fprintf(&b, "  %q;\n", node.ID)
+	}
+	for _, edge := range g.Edges {
+		if edge.Implicit {
+			fmt.Fprintf(&b, "  %q -> %q [style=dashed];\n", edge.From.ID, edge.To.ID)
+		} else {
+			fmt.Fprintf(&b, "  %q -> %q;\n", edge.From.ID, edge.To.ID)
+		}
+	}
+	b.WriteString("}\n")
+	return b.String()
+}
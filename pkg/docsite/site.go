@@ -0,0 +1,264 @@
+// Package docsite renders the modules of a project as a static HTML site:
+// an index of the modules and a page per module with its owners, variables,
+// resources, handlers, compliance mappings and dependency graph
+package docsite
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/compliance"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+// Source is a module to document and the file it was loaded from. Modules
+// loaded with their !vault values kept encrypted have those values left out
+// of the site.
+type Source struct {
+	File   string
+	Module *core.Module
+}
+
+// Site is the documentation of a project's modules
+type Site struct {
+	Title     string
+	Generated time.Time
+	Modules   []*ModuleDoc
+}
+
+// ModuleDoc is the documentation page of a module
+type ModuleDoc struct {
+	// Slug names the page and graph files of the module
+	Slug        string
+	File        string
+	Name        string
+	Version     string
+	Description string
+	Owners      []string
+	DependsOn   []string
+	Labels      []Label
+	Variables   []Variable
+	Resources   []ResourceDoc
+	Handlers    []HandlerDoc
+	Compliance  []FrameworkDoc
+	Graph       *Graph
+}
+
+// Label is a module label
+type Label struct {
+	Key   string
+	Value string
+}
+
+// Variable is a module variable and its default value as JSON
+type Variable struct {
+	Name    string
+	Default string
+}
+
+// ResourceDoc describes a resource of a module
+type ResourceDoc struct {
+	ID        string
+	Type      string
+	State     string
+	When      string
+	Register  string
+	Tags      []string
+	DependsOn []string
+	Notify    []string
+}
+
+// HandlerDoc describes a handler and the resource it applies when notified
+type HandlerDoc struct {
+	Name     string
+	Resource string
+}
+
+// FrameworkDoc is a compliance framework a module maps controls to. Result
+// is the outcome of forge's built-in checks, for the frameworks it has them.
+type FrameworkDoc struct {
+	Framework string
+	Controls  []string
+	Result    *compliance.ComplianceResult
+}
+
+// slugPattern matches runs of characters left out of page file names
+var slugPattern = regexp.MustCompile(`[^a-z0-9.-]+`)
+
+// Build documents the modules, sorted by name
+func Build(ctx context.Context, title string, sources []Source) (*Site, error) {
+	site := &Site{Title: title, Generated: time.Now().UTC()}
+	slugs := make(map[string]int)
+	for _, source := range sources {
+		doc, err := documentModule(ctx, source)
+		if err != nil {
+			return nil, err
+		}
+		slug := strings.Trim(slugPattern.ReplaceAllString(strings.ToLower(doc.Name), "-"), "-")
+		if slug == "" {
+			slug = "module"
+		}
+		// Modules may share a name in different directories
+		if slugs[slug]++; slugs[slug] > 1 {
+			slug = fmt.Sprintf("%s-%d", slug, slugs[slug])
+		}
+		doc.Slug = slug
+		site.Modules = append(site.Modules, doc)
+	}
+	sort.SliceStable(site.Modules, func(i, j int) bool {
+		return site.Modules[i].Name < site.Modules[j].Name
+	})
+	return site, nil
+}
+
+// EncryptedPlaceholder stands in for a !vault value in a variable's default
+const EncryptedPlaceholder = "(encrypted)"
+
+// redactEncrypted replaces the values of a variable that are kept encrypted,
+// for modules loaded with core.LoadModuleFromFileEncrypted
+func redactEncrypted(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		if vault.Contains(v) {
+			return EncryptedPlaceholder
+		}
+		return v
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactEncrypted(item)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactEncrypted(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// documentModule returns the documentation of one module
+func documentModule(ctx context.Context, source Source) (*ModuleDoc, error) {
+	module := source.Module
+	doc := &ModuleDoc{
+		File:        source.File,
+		Name:        module.Metadata.Name,
+		Version:     module.Metadata.Version,
+		Description: module.Metadata.Description,
+		Owners:      module.Metadata.Owners,
+		DependsOn:   module.Metadata.DependsOn,
+	}
+
+	for key, value := range module.Metadata.Labels {
+		doc.Labels = append(doc.Labels, Label{Key: key, Value: value})
+	}
+	sort.Slice(doc.Labels, func(i, j int) bool { return doc.Labels[i].Key < doc.Labels[j].Key })
+
+	for name, value := range module.Spec.Vars {
+		encoded, err := json.Marshal(redactEncrypted(value))
+		if err != nil {
+			encoded = []byte(fmt.Sprint(value))
+		}
+		doc.Variables = append(doc.Variables, Variable{Name: name, Default: string(encoded)})
+	}
+	sort.Slice(doc.Variables, func(i, j int) bool { return doc.Variables[i].Name < doc.Variables[j].Name })
+
+	for _, resource := range module.Spec.Resources {
+		doc.Resources = append(doc.Resources, ResourceDoc{
+			ID:        resource.ResourceID(),
+			Type:      resource.Type,
+			State:     string(resource.State),
+			When:      resource.When,
+			Register:  resource.Register,
+			Tags:      resource.Tags,
+			DependsOn: resource.DependsOn,
+			Notify:    resource.Notify,
+		})
+	}
+	for _, handler := range module.Spec.Handlers {
+		doc.Handlers = append(doc.Handlers, HandlerDoc{Name: handler.Name, Resource: handler.Resource.ResourceID()})
+	}
+
+	frameworks := make([]string, 0, len(module.Metadata.Compliance))
+	for framework := range module.Metadata.Compliance {
+		frameworks = append(frameworks, framework)
+	}
+	sort.Strings(frameworks)
+	for _, framework := range frameworks {
+		mapping := FrameworkDoc{Framework: framework, Controls: module.Metadata.Compliance[framework]}
+		// Frameworks without built-in checks are documented as mapped
+		manager := compliance.NewComplianceManager()
+		if err := manager.LoadModule(framework); err == nil {
+			result, err := manager.CheckCompliance(ctx, module)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check module %s against %s: %w", module.Metadata.Name, framework, err)
+			}
+			mapping.Result = result
+		}
+		doc.Compliance = append(doc.Compliance, mapping)
+	}
+
+	graph, err := BuildGraph(module)
+	if err != nil {
+		return nil, err
+	}
+	doc.Graph = graph
+	return doc, nil
+}
+
+// Write writes the site into dir: index.html, and a page and a Graphviz
+// graph per module
+func (s *Site) Write(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create %s: %w", dir, err)
+	}
+	if err := writeFile(filepath.Join(dir, "index.html"), func(w io.Writer) error {
+		return pages.ExecuteTemplate(w, "index", s)
+	}); err != nil {
+		return err
+	}
+	for _, doc := range s.Modules {
+		page := map[string]interface{}{"Site": s, "Module": doc}
+		if err := writeFile(filepath.Join(dir, doc.Slug+".html"), func(w io.Writer) error {
+			return pages.ExecuteTemplate(w, "module", page)
+		}); err != nil {
+			return err
+		}
+		dot := doc.Graph.DOT(doc.Name)
+		if err := writeFile(filepath.Join(dir, doc.Slug+".dot"), func(w io.Writer) error {
+			_, err := io.WriteString(w, dot)
+			return err
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeFile creates a file and writes it with write
+func writeFile(path string, write func(io.Writer) error) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create %s: %w", path, err)
+	}
+	if err := write(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	return nil
+}
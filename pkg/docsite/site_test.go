@@ -0,0 +1,131 @@
+package docsite
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func testModule() *core.Module {
+	return &core.Module{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Module",
+		Metadata: core.ModuleMetadata{
+			Name:       "Web Server",
+			Version:    "1.2.0",
+			Labels:     map[string]string{"tier": "frontend"},
+			Owners:     []string{"platform-team", "alice@example.com"},
+			Compliance: map[string][]string{"cis-ubuntu-20.04": {"5.2.1"}, "pci-dss": {"2.2"}},
+		},
+		Spec: core.ModuleSpec{
+			Vars: map[string]interface{}{
+				"port":  8080,
+				"hosts": []interface{}{"a", "b"},
+				"db":    map[string]interface{}{"user": "app", "password": "$FORGE_VAULT;1;AES256-GCM;default\nc2VjcmV0\n"},
+			},
+			Resources: []types.Resource{
+				{Type: "pkg", Name: "nginx", State: types.StatePresent},
+				{Type: "file", Name: "config", State: types.StatePresent, Properties: map[string]interface{}{"path": "/etc/nginx/nginx.conf", "mode": "0644"}},
+				{Type: "service", Name: "nginx", State: types.StateRunning, DependsOn: []string{"file.config", "shell.external"}},
+			},
+			Handlers: []core.Handler{{Name: "restart nginx", Resource: types.Resource{Type: "service", Name: "nginx", State: types.StateRestarted}}},
+		},
+	}
+}
+
+func TestBuildGraph(t *testing.T) {
+	graph, err := BuildGraph(testModule())
+	if err != nil {
+		t.Fatalf("BuildGraph() error = %v", err)
+	}
+
+	levels := make(map[string]int)
+	for _, node := range graph.Nodes {
+		levels[node.ID] = node.Level
+	}
+	wantLevels := map[string]int{"pkg.nginx": 0, "file.config": 0, "service.nginx": 1}
+	if !reflect.DeepEqual(levels, wantLevels) {
+		t.Errorf("levels = %v, want %v", levels, wantLevels)
+	}
+
+	edges := make(map[string]bool)
+	for _, edge := range graph.Edges {
+		edges[edge.From.ID+" -> "+edge.To.ID] = edge.Implicit
+	}
+	wantEdges := map[string]bool{"file.config -> service.nginx": false, "pkg.nginx -> service.nginx": true}
+	if !reflect.DeepEqual(edges, wantEdges) {
+		t.Errorf("edges = %v, want %v", edges, wantEdges)
+	}
+	if want := []string{"service.nginx depends on shell.external"}; !reflect.DeepEqual(graph.External, want) {
+		t.Errorf("External = %v, want %v", graph.External, want)
+	}
+
+	dot := graph.DOT("web")
+	for _, line := range []string{`"file.config" -> "service.nginx";`, `"pkg.nginx" -> "service.nginx" [style=dashed];`} {
+		if !strings.Contains(dot, line) {
+			t.Errorf("DOT() = %s, want line %s", dot, line)
+		}
+	}
+}
+
+func TestBuild(t *testing.T) {
+	other := testModule()
+	other.Metadata.Name = "web server"
+	site, err := Build(context.Background(), "Infra", []Source{
+		{File: "web/module.yaml", Module: testModule()},
+		{File: "web2/module.yaml", Module: other},
+	})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	if len(site.Modules) != 2 || site.Modules[0].Slug != "web-server" || site.Modules[1].Slug != "web-server-2" {
+		t.Fatalf("Build() slugs = %v", site.Modules)
+	}
+
+	doc := site.Modules[0]
+	wantVars := []Variable{
+		{Name: "db", Default: `{"password":"(encrypted)","user":"app"}`},
+		{Name: "hosts", Default: `["a","b"]`},
+		{Name: "port", Default: "8080"},
+	}
+	if !reflect.DeepEqual(doc.Variables, wantVars) {
+		t.Errorf("Variables = %v, want %v", doc.Variables, wantVars)
+	}
+	if len(doc.Compliance) != 2 || doc.Compliance[0].Framework != "cis-ubuntu-20.04" || doc.Compliance[1].Framework != "pci-dss" {
+		t.Fatalf("Compliance = %v", doc.Compliance)
+	}
+	// Only frameworks with built-in checks have results
+	if doc.Compliance[0].Result == nil || doc.Compliance[1].Result != nil {
+		t.Errorf("Compliance results = %v, %v", doc.Compliance[0].Result, doc.Compliance[1].Result)
+	}
+
+	dir := t.TempDir()
+	if err := site.Write(dir); err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	index, err := os.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(index), `<a href="web-server.html">Web Server</a>`) {
+		t.Errorf("index.html does not link the module:\n%s", index)
+	}
+	page, err := os.ReadFile(filepath.Join(dir, "web-server.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"platform-team, alice@example.com", "<code>service.nginx</code>", "restart nginx", `<span class="tag">5.2.1</span>`, "<svg", `class="implicit"`} {
+		if !strings.Contains(string(page), want) {
+			t.Errorf("module page does not contain %q", want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "web-server-2.dot")); err != nil {
+		t.Errorf("graph not written: %v", err)
+	}
+}
@@ -0,0 +1,128 @@
+package docsite
+
+import (
+	"html/template"
+	"strings"
+)
+
+// labelLength is how many characters of a resource id fit in a graph node
+const labelLength = 24
+
+var pages = template.Must(template.New("site").Funcs(template.FuncMap{
+	"join": strings.Join,
+	"label": func(id string) string {
+		if runes := []rune(id); len(runes) > labelLength {
+			return string(runes[:labelLength-1]) + "…"
+		}
+		return id
+	},
+	"nodeWidth":  func() int { return nodeWidth },
+	"nodeHeight": func() int { return nodeHeight },
+	"add":        func(a, b int) int { return a + b },
+}).Parse(`{{define "head"}}<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 24px; color: #222; max-width: 1100px; }
+h1 { font-size: 22px; margin-bottom: 4px; }
+h2 { font-size: 17px; margin-top: 28px; border-bottom: 1px solid #ddd; padding-bottom: 4px; }
+.meta { color: #666; margin-bottom: 16px; }
+a { color: #1565c0; }
+code { font-size: 12px; background: #f5f5f5; padding: 1px 4px; border-radius: 3px; }
+table { border-collapse: collapse; font-size: 13px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #eee; vertical-align: top; }
+.tag { display: inline-block; font-size: 11px; background: #e3f2fd; border-radius: 3px; padding: 0 4px; margin-right: 2px; }
+.passed { color: #2e7d32; }
+.failed { color: #c62828; }
+.graph { overflow-x: auto; }
+.graph rect { fill: #f5f5f5; stroke: #555; }
+.graph text { font-size: 11px; font-family: monospace; }
+.graph line { stroke: #555; marker-end: url(#arrow); }
+.graph line.implicit { stroke: #999; stroke-dasharray: 4 3; }
+</style>
+</head>
+<body>
+{{end}}
+
+{{define "index"}}{{template "head" .Title}}
+<h1>{{.Title}}</h1>
+<div class="meta">{{len .Modules}} module(s) &middot; generated {{.Generated.Format "2006-01-02 15:04 MST"}}</div>
+<table>
+<tr><th>Module</th><th>Version</th><th>Owners</th><th>Resources</th><th>Compliance</th><th>Description</th></tr>
+{{range .Modules}}<tr>
+<td><a href="{{.Slug}}.html">{{.Name}}</a></td>
+<td>{{.Version}}</td>
+<td>{{join .Owners ", "}}</td>
+<td>{{len .Resources}}</td>
+<td>{{range .Compliance}}<span class="tag">{{.Framework}}</span>{{end}}</td>
+<td>{{.Description}}</td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+{{end}}
+
+{{define "module"}}{{with .Module}}{{template "head" .Name}}
+<div class="meta"><a href="index.html">{{$.Site.Title}}</a></div>
+<h1>{{.Name}} <small>{{.Version}}</small></h1>
+<div class="meta"><code>{{.File}}</code></div>
+{{if .Description}}<p>{{.Description}}</p>{{end}}
+<table>
+<tr><th>Owners</th><td>{{if .Owners}}{{join .Owners ", "}}{{else}}none listed{{end}}</td></tr>
+{{if .DependsOn}}<tr><th>Depends on</th><td>{{join .DependsOn ", "}}</td></tr>{{end}}
+{{range .Labels}}<tr><th>{{.Key}}</th><td>{{.Value}}</td></tr>
+{{end}}</table>
+
+<h2>Variables</h2>
+{{if .Variables}}<table>
+<tr><th>Name</th><th>Default</th></tr>
+{{range .Variables}}<tr><td><code>{{.Name}}</code></td><td><code>{{.Default}}</code></td></tr>
+{{end}}</table>{{else}}<p>The module has no variables.</p>{{end}}
+
+<h2>Resources</h2>
+<table>
+<tr><th>Resource</th><th>State</th><th>Depends on</th><th>Notifies</th><th>When</th><th>Tags</th></tr>
+{{range .Resources}}<tr>
+<td><code>{{.ID}}</code>{{if .Register}}<br>registers <code>{{.Register}}</code>{{end}}</td>
+<td>{{.State}}</td>
+<td>{{join .DependsOn ", "}}</td>
+<td>{{join .Notify ", "}}</td>
+<td>{{if .When}}<code>{{.When}}</code>{{end}}</td>
+<td>{{range .Tags}}<span class="tag">{{.}}</span>{{end}}</td>
+</tr>
+{{end}}</table>
+
+{{if .Handlers}}<h2>Handlers</h2>
+<table>
+<tr><th>Handler</th><th>Resource</th></tr>
+{{range .Handlers}}<tr><td>{{.Name}}</td><td><code>{{.Resource}}</code></td></tr>
+{{end}}</table>{{end}}
+
+<h2>Compliance</h2>
+{{if .Compliance}}<table>
+<tr><th>Framework</th><th>Controls</th><th>Built-in checks</th></tr>
+{{range .Compliance}}<tr>
+<td>{{.Framework}}</td>
+<td>{{range .Controls}}<span class="tag">{{.}}</span>{{end}}</td>
+<td>{{with .Result}}{{if .Compliant}}<span class="passed">{{.Passed}}/{{.Total}} passed</span>{{else}}<span class="failed">{{.Failed}} of {{.Total}} failed</span>
+{{range .Violations}}<br>{{.Control}} {{.Resource}}: {{.Message}}{{end}}{{end}}{{else}}none{{end}}</td>
+</tr>
+{{end}}</table>{{else}}<p>The module maps no compliance controls.</p>{{end}}
+
+<h2>Dependency graph</h2>
+<p class="meta">Resources are applied left to right. Solid edges are depends_on, dashed ones the implicit type ordering. Also as <a href="{{.Slug}}.dot">Graphviz</a>.</p>
+{{with .Graph}}<div class="graph">
+<svg xmlns="http://www.w3.org/2000/svg" width="{{.Width}}" height="{{.Height}}">
+<defs><marker id="arrow" viewBox="0 0 10 10" refX="10" refY="5" markerWidth="6" markerHeight="6" orient="auto"><path d="M0,0 L10,5 L0,10 z" fill="#555"/></marker></defs>
+{{range .Edges}}<line x1="{{.X1}}" y1="{{.Y1}}" x2="{{.X2}}" y2="{{.Y2}}"{{if .Implicit}} class="implicit"{{end}}/>
+{{end}}{{range .Nodes}}<g><title>{{.ID}}</title><rect x="{{.X}}" y="{{.Y}}" width="{{nodeWidth}}" height="{{nodeHeight}}" rx="4"/><text x="{{add .X 8}}" y="{{add .Y 18}}">{{label .ID}}</text></g>
+{{end}}</svg>
+</div>
+{{range .External}}<p class="meta">{{.}}, which is not in the module</p>
+{{end}}{{end}}
+</body>
+</html>
+{{end}}{{end}}
+`))
@@ -7,9 +7,13 @@ import (
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/store"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
+// reportsBucket keeps the drift history in the controller store
+const reportsBucket = "drift_reports"
+
 // DriftScheduler manages scheduled drift detection for multiple modules
 type DriftScheduler struct {
 	planner  *core.Planner
@@ -30,6 +34,7 @@ type DriftScheduler struct {
 	recentReports []*DriftReport
 	maxReports    int
 	reportsMu     sync.RWMutex
+	store         store.Store
 	
 	// Configuration
 	checkInterval time.Duration
@@ -233,6 +238,52 @@ func (s *DriftScheduler) Disable() {
 	s.enabled = false
 }
 
+// Migrations upgrades the drift history kept in a store
+func Migrations() []store.Migration {
+	return []store.Migration{
+		{
+			Version:     1,
+			Description: "keep drift reports in the store",
+			Up:          func(store.Store) error { return nil },
+		},
+	}
+}
+
+// UseStore migrates and loads the most recent drift reports kept in a
+// controller store and keeps every later report there, so the drift
+// history outlives the process
+func (s *DriftScheduler) UseStore(kv store.Store) error {
+	if _, err := store.Migrate(kv, "drift", Migrations()); err != nil {
+		return err
+	}
+	keys, err := kv.Keys(reportsBucket)
+	if err != nil {
+		return err
+	}
+	if len(keys) > s.maxReports {
+		keys = keys[len(keys)-s.maxReports:]
+	}
+	reports := make([]*DriftReport, 0, len(keys))
+	for _, key := range keys {
+		var report DriftReport
+		if err := store.GetJSON(kv, reportsBucket, key, &report); err != nil {
+			return err
+		}
+		reports = append(reports, &report)
+	}
+	
+	s.reportsMu.Lock()
+	defer s.reportsMu.Unlock()
+	s.recentReports = reports
+	s.store = kv
+	return nil
+}
+
+// reportKey orders stored reports by time
+func reportKey(report *DriftReport) string {
+	return report.Timestamp.UTC().Format("20060102T150405.000000000") + "-" + report.ModuleName
+}
+
 // GetRecentReports returns the most recent drift reports
 func (s *DriftScheduler) GetRecentReports(limit int) []*DriftReport {
 	s.reportsMu.RLock()
@@ -336,19 +387,29 @@ func (s *DriftScheduler) runDriftDetectionForModule(ctx context.Context, schedul
 	
 	// Store report if successful
 	if report != nil {
-		s.addReport(report)
+		if err := s.RecordReport(report); err != nil {
+			s.mu.Lock()
+			scheduledModule.ErrorCount++
+			s.mu.Unlock()
+		}
 	}
 }
 
-// addReport adds a report to the recent reports list
-func (s *DriftScheduler) addReport(report *DriftReport) {
+// RecordReport adds a report to the recent reports and the drift history,
+// whether the scheduler or a run elsewhere found it
+func (s *DriftScheduler) RecordReport(report *DriftReport) error {
 	s.reportsMu.Lock()
 	defer s.reportsMu.Unlock()
 	
+	var err error
+	if s.store != nil {
+		err = store.PutJSON(s.store, reportsBucket, reportKey(report), report)
+	}
 	s.recentReports = append(s.recentReports, report)
 	
 	// Keep only the most recent reports
 	if len(s.recentReports) > s.maxReports {
 		s.recentReports = s.recentReports[1:]
 	}
+	return err
 }
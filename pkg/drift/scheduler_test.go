@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/store"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
@@ -274,6 +275,38 @@ func TestDriftScheduler_ScheduleExecution(t *testing.T) {
 	// This is actually correct behavior, so we'll just check that the module ran
 }
 
+func TestDriftScheduler_UseStore(t *testing.T) {
+	registry := types.NewProviderRegistry()
+	planner := core.NewPlanner(registry)
+	kv := store.NewMemory()
+	
+	scheduler := NewDriftScheduler(planner, registry)
+	if err := scheduler.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	base := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	for i, module := range []string{"web", "db", "web"} {
+		report := &DriftReport{ModuleName: module, Timestamp: base.Add(time.Duration(i) * time.Minute), DriftDetected: i}
+		if err := scheduler.RecordReport(report); err != nil {
+			t.Fatalf("Failed to add report: %v", err)
+		}
+	}
+	
+	// A new scheduler loads the most recent reports, oldest first
+	restarted := NewDriftScheduler(planner, registry)
+	restarted.maxReports = 2
+	if err := restarted.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	reports := restarted.GetRecentReports(0)
+	if len(reports) != 2 || reports[0].ModuleName != "db" || reports[1].DriftDetected != 2 {
+		t.Errorf("Expected the two most recent reports, got %+v", reports)
+	}
+	if keys, _ := kv.Keys(reportsBucket); len(keys) != 3 {
+		t.Errorf("Expected the whole history to stay stored, got %d reports", len(keys))
+	}
+}
+
 func TestDriftScheduleConfig_Validate(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -18,15 +18,23 @@ const (
 	EventTypeResourceCompleted EventType = "resource.completed"
 	EventTypeResourceFailed    EventType = "resource.failed"
 	EventTypeResourceSkipped   EventType = "resource.skipped"
+	EventTypeResourceOutput    EventType = "resource.output"
 	EventTypePlanStarted       EventType = "plan.started"
 	EventTypePlanCompleted     EventType = "plan.completed"
 	EventTypePlanFailed        EventType = "plan.failed"
+	EventTypePlanItem          EventType = "plan.item"
 	EventTypeApplyStarted      EventType = "apply.started"
 	EventTypeApplyCompleted    EventType = "apply.completed"
 	EventTypeApplyFailed       EventType = "apply.failed"
+	EventTypeHandlerNotified   EventType = "handler.notified"
 	EventTypeDriftDetected     EventType = "drift.detected"
+	EventTypeCanaryStarted     EventType = "canary.started"
+	EventTypeCanaryWaiting     EventType = "canary.waiting"
+	EventTypeCanaryPromoted    EventType = "canary.promoted"
+	EventTypeCanaryFailed      EventType = "canary.failed"
 	EventTypeRollbackStarted   EventType = "rollback.started"
 	EventTypeRollbackCompleted EventType = "rollback.completed"
+	EventTypeRunFinished       EventType = "run.finished"
 )
 
 // Event represents a system event
@@ -0,0 +1,99 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Cluster describes the reachable members of a clustered service for a
+// quorum-safe rollout
+type Cluster struct {
+	Name    string
+	Members []string
+
+	// Leader is the member reported as leader by the probe, if any. It is
+	// applied to last, on its own.
+	Leader string
+
+	// MaxUnavailable is how many members may be applied to at once
+	MaxUnavailable int
+}
+
+// Batches returns the members in rollout order: followers in sorted batches of
+// at most MaxUnavailable, then the leader alone
+func (c Cluster) Batches() [][]string {
+	size := c.MaxUnavailable
+	if size < 1 {
+		size = 1
+	}
+
+	var followers []string
+	hasLeader := false
+	for _, member := range c.Members {
+		if member == c.Leader {
+			hasLeader = true
+			continue
+		}
+		followers = append(followers, member)
+	}
+	sort.Strings(followers)
+
+	var batches [][]string
+	for start := 0; start < len(followers); start += size {
+		end := start + size
+		if end > len(followers) {
+			end = len(followers)
+		}
+		batches = append(batches, followers[start:end])
+	}
+	if hasLeader {
+		batches = append(batches, []string{c.Leader})
+	}
+	return batches
+}
+
+// RunCluster applies fn to a cluster batch by batch. It refuses to start when
+// no member can be taken down without losing quorum, and stops at the first
+// batch with a failure; members not yet applied to are reported as skipped.
+func (r *HostRunner) RunCluster(ctx context.Context, cluster Cluster, fn HostFunc) *RunReport {
+	report := NewRunReport()
+
+	if cluster.MaxUnavailable < 1 {
+		r.skip(report, cluster.Members, fmt.Errorf("cluster %s: no members can be applied to without losing quorum", cluster.Name))
+		report.EndTime = time.Now()
+		report.Status = r.policy.Evaluate(report)
+		return report
+	}
+
+	batches := cluster.Batches()
+	for i, batch := range batches {
+		batchReport := r.Run(ctx, batch, fn)
+		report.Merge(batchReport)
+
+		if len(batchReport.Failed()) > 0 || len(batchReport.Unreachable()) > 0 {
+			var remaining []string
+			for _, rest := range batches[i+1:] {
+				remaining = append(remaining, rest...)
+			}
+			r.skip(report, remaining, fmt.Errorf("cluster %s: halted after a member failed", cluster.Name))
+			break
+		}
+	}
+
+	report.EndTime = time.Now()
+	report.Status = r.policy.Evaluate(report)
+	return report
+}
+
+// skip records hosts as skipped for the given reason
+func (r *HostRunner) skip(report *RunReport, hosts []string, reason error) {
+	for _, host := range hosts {
+		report.Add(HostResult{
+			Host:   host,
+			Status: HostSkipped,
+			Error:  reason,
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+)
+
+func TestCluster_Batches(t *testing.T) {
+	tests := []struct {
+		name    string
+		cluster Cluster
+		want    [][]string
+	}{
+		{
+			name:    "leader last",
+			cluster: Cluster{Members: []string{"etcd2", "etcd1", "etcd3"}, Leader: "etcd1", MaxUnavailable: 1},
+			want:    [][]string{{"etcd2"}, {"etcd3"}, {"etcd1"}},
+		},
+		{
+			name:    "batches of two",
+			cluster: Cluster{Members: []string{"a", "b", "c", "d", "e"}, Leader: "c", MaxUnavailable: 2},
+			want:    [][]string{{"a", "b"}, {"d", "e"}, {"c"}},
+		},
+		{
+			name:    "no leader found",
+			cluster: Cluster{Members: []string{"b", "a"}, MaxUnavailable: 1},
+			want:    [][]string{{"a"}, {"b"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.cluster.Batches(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Batches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostRunner_RunCluster(t *testing.T) {
+	cluster := Cluster{Name: "etcd", Members: []string{"etcd1", "etcd2", "etcd3"}, Leader: "etcd1", MaxUnavailable: 1}
+
+	t.Run("applies one member at a time, leader last", func(t *testing.T) {
+		var mu sync.Mutex
+		var order []string
+
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		report := runner.RunCluster(context.Background(), cluster, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			mu.Lock()
+			order = append(order, host)
+			mu.Unlock()
+			return core.NewExecutionResult(), nil
+		})
+
+		if report.Status != RunSucceeded {
+			t.Errorf("Expected succeeded status, got %s", report.Status)
+		}
+		if !reflect.DeepEqual(order, []string{"etcd2", "etcd3", "etcd1"}) {
+			t.Errorf("Expected leader last, got %v", order)
+		}
+	})
+
+	t.Run("halts after a failure", func(t *testing.T) {
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		report := runner.RunCluster(context.Background(), cluster, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			if host == "etcd2" {
+				return nil, errors.New("boom")
+			}
+			return core.NewExecutionResult(), nil
+		})
+
+		if len(report.Failed()) != 1 {
+			t.Fatalf("Expected 1 failed member, got %d", len(report.Failed()))
+		}
+		for _, host := range []string{"etcd3", "etcd1"} {
+			result, ok := report.Get(host)
+			if !ok || result.Status != HostSkipped {
+				t.Errorf("Expected %s to be skipped, got %+v", host, result)
+			}
+		}
+	})
+
+	t.Run("refuses when quorum is at risk", func(t *testing.T) {
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		called := false
+		report := runner.RunCluster(context.Background(), Cluster{Name: "etcd", Members: []string{"etcd1", "etcd2"}}, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			called = true
+			return core.NewExecutionResult(), nil
+		})
+
+		if called {
+			t.Error("Expected no member to be applied to")
+		}
+		if len(report.Hosts) != 2 || report.Hosts[0].Status != HostSkipped {
+			t.Errorf("Expected all members skipped, got %+v", report.Hosts)
+		}
+	})
+}
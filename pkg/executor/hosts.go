@@ -0,0 +1,340 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+)
+
+// ErrHostUnreachable marks errors caused by a host that could not be contacted.
+// Host functions should wrap connection failures with it so the runner can
+// report them separately from apply failures.
+var ErrHostUnreachable = errors.New("host unreachable")
+
+// HostStatus represents the outcome of a run on a single host
+type HostStatus string
+
+const (
+	HostSucceeded   HostStatus = "succeeded"
+	HostFailed      HostStatus = "failed"
+	HostUnreachable HostStatus = "unreachable"
+	HostSkipped     HostStatus = "skipped"
+)
+
+// RunStatus represents the overall outcome of a multi-host run
+type RunStatus string
+
+const (
+	RunSucceeded RunStatus = "succeeded"
+	RunPartial   RunStatus = "partial"
+	RunFailed    RunStatus = "failed"
+)
+
+// UnreachableAction controls how unreachable hosts affect the run status
+type UnreachableAction string
+
+const (
+	UnreachableFail   UnreachableAction = "fail"
+	UnreachableWarn   UnreachableAction = "warn"
+	UnreachableIgnore UnreachableAction = "ignore"
+)
+
+// UnreachablePolicy decides how unreachable hosts affect the overall run status
+type UnreachablePolicy struct {
+	Action UnreachableAction `yaml:"action" json:"action"`
+
+	// MaxPercent is the highest share of unreachable hosts tolerated by the
+	// warn and ignore actions before the run is considered failed. Zero means
+	// no limit.
+	MaxPercent float64 `yaml:"max_percent,omitempty" json:"max_percent,omitempty"`
+}
+
+// DefaultUnreachablePolicy returns the default policy, which fails the run on any unreachable host
+func DefaultUnreachablePolicy() UnreachablePolicy {
+	return UnreachablePolicy{Action: UnreachableFail}
+}
+
+// Validate validates the unreachable policy
+func (p UnreachablePolicy) Validate() error {
+	switch p.Action {
+	case UnreachableFail, UnreachableWarn, UnreachableIgnore:
+	default:
+		return fmt.Errorf("invalid unreachable action '%s', must be one of: fail, warn, ignore", p.Action)
+	}
+	if p.MaxPercent < 0 || p.MaxPercent > 100 {
+		return fmt.Errorf("max unreachable percent must be between 0 and 100, got %v", p.MaxPercent)
+	}
+	return nil
+}
+
+// Evaluate computes the overall run status for a report under this policy.
+// Hosts that failed for any reason other than being unreachable always fail the run.
+func (p UnreachablePolicy) Evaluate(report *RunReport) RunStatus {
+	if len(report.Failed()) > 0 {
+		return RunFailed
+	}
+
+	unreachable := len(report.Unreachable())
+	if unreachable == 0 {
+		return RunSucceeded
+	}
+
+	if p.MaxPercent > 0 && report.UnreachablePercent() > p.MaxPercent {
+		return RunFailed
+	}
+
+	switch p.Action {
+	case UnreachableIgnore:
+		return RunSucceeded
+	case UnreachableWarn:
+		return RunPartial
+	default:
+		return RunFailed
+	}
+}
+
+// HostResult represents the result of a run on a single host
+type HostResult struct {
+	Host      string                `json:"host"`
+	Status    HostStatus            `json:"status"`
+	Error     error                 `json:"error,omitempty"`
+	Result    *core.ExecutionResult `json:"result,omitempty"`
+	Attempts  int                   `json:"attempts"`
+	Duration  time.Duration         `json:"duration"`
+	StartTime time.Time             `json:"start_time"`
+	EndTime   time.Time             `json:"end_time"`
+}
+
+// RunReport collects the per-host results of a multi-host run
+type RunReport struct {
+	Hosts       []HostResult       `json:"hosts"`
+	Status      RunStatus          `json:"status"`
+	StartTime   time.Time          `json:"start_time"`
+	EndTime     time.Time          `json:"end_time"`
+	Fingerprint *audit.Fingerprint `json:"fingerprint,omitempty"`
+}
+
+// NewRunReport creates a new empty run report
+func NewRunReport() *RunReport {
+	return &RunReport{
+		Hosts:     make([]HostResult, 0),
+		StartTime: time.Now(),
+	}
+}
+
+// Add adds or replaces the result for a host, keeping hosts sorted by name
+func (r *RunReport) Add(result HostResult) {
+	for i := range r.Hosts {
+		if r.Hosts[i].Host == result.Host {
+			result.Attempts += r.Hosts[i].Attempts
+			r.Hosts[i] = result
+			return
+		}
+	}
+	r.Hosts = append(r.Hosts, result)
+	sort.Slice(r.Hosts, func(i, j int) bool {
+		return r.Hosts[i].Host < r.Hosts[j].Host
+	})
+}
+
+// Merge overlays the results of another report onto this one, e.g. after a retry
+func (r *RunReport) Merge(other *RunReport) {
+	for _, result := range other.Hosts {
+		r.Add(result)
+	}
+	if other.EndTime.After(r.EndTime) {
+		r.EndTime = other.EndTime
+	}
+	if r.Fingerprint == nil {
+		r.Fingerprint = other.Fingerprint
+	}
+}
+
+// Get returns the result for a host
+func (r *RunReport) Get(host string) (HostResult, bool) {
+	for _, result := range r.Hosts {
+		if result.Host == host {
+			return result, true
+		}
+	}
+	return HostResult{}, false
+}
+
+// Succeeded returns the hosts that completed successfully
+func (r *RunReport) Succeeded() []HostResult {
+	return r.withStatus(HostSucceeded)
+}
+
+// Failed returns the hosts that were reached but failed
+func (r *RunReport) Failed() []HostResult {
+	return r.withStatus(HostFailed)
+}
+
+// Unreachable returns the hosts that could not be contacted
+func (r *RunReport) Unreachable() []HostResult {
+	return r.withStatus(HostUnreachable)
+}
+
+// Skipped returns the hosts that were not applied to, such as those left
+// after a rollout halted
+func (r *RunReport) Skipped() []HostResult {
+	return r.withStatus(HostSkipped)
+}
+
+// UnreachableHosts returns the names of unreachable hosts, for scheduling retries
+func (r *RunReport) UnreachableHosts() []string {
+	var hosts []string
+	for _, result := range r.Unreachable() {
+		hosts = append(hosts, result.Host)
+	}
+	return hosts
+}
+
+// UnreachablePercent returns the share of hosts that were unreachable, from 0 to 100
+func (r *RunReport) UnreachablePercent() float64 {
+	total := 0
+	for _, result := range r.Hosts {
+		if result.Status != HostSkipped {
+			total++
+		}
+	}
+	if total == 0 {
+		return 0
+	}
+	return float64(len(r.Unreachable())) * 100 / float64(total)
+}
+
+// RecordHealth adds the outcome of every attempted host to the health
+// tracker. Skipped hosts are not recorded.
+func (r *RunReport) RecordHealth(tracker *inventory.HealthTracker) {
+	for _, result := range r.Hosts {
+		if result.Status == HostSkipped {
+			continue
+		}
+		tracker.Record(result.Host, result.Status == HostSucceeded, result.Duration)
+	}
+}
+
+func (r *RunReport) withStatus(status HostStatus) []HostResult {
+	var results []HostResult
+	for _, result := range r.Hosts {
+		if result.Status == status {
+			results = append(results, result)
+		}
+	}
+	return results
+}
+
+// HostFunc runs against a single host. Connection failures should be wrapped
+// with ErrHostUnreachable.
+type HostFunc func(ctx context.Context, host string) (*core.ExecutionResult, error)
+
+// HostRunner runs a function across many hosts with bounded concurrency
+type HostRunner struct {
+	maxConcurrency int
+	policy         UnreachablePolicy
+}
+
+// NewHostRunner creates a new host runner
+func NewHostRunner(maxConcurrency int, policy UnreachablePolicy) *HostRunner {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 10 // default
+	}
+	if policy.Action == "" {
+		policy.Action = UnreachableFail
+	}
+
+	return &HostRunner{
+		maxConcurrency: maxConcurrency,
+		policy:         policy,
+	}
+}
+
+// Policy returns the unreachable policy used by the runner
+func (r *HostRunner) Policy() UnreachablePolicy {
+	return r.policy
+}
+
+// Run executes fn on every host and returns a report whose status is
+// evaluated against the runner's unreachable policy. Hosts are started in
+// the order given, so callers can schedule preferred hosts first.
+func (r *HostRunner) Run(ctx context.Context, hosts []string, fn HostFunc) *RunReport {
+	report := NewRunReport()
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	semaphore := make(chan struct{}, r.maxConcurrency)
+
+	for _, host := range hosts {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(host string) {
+			defer wg.Done()
+			defer func() { <-semaphore }()
+
+			result := r.runHost(ctx, host, fn)
+
+			mu.Lock()
+			report.Add(result)
+			mu.Unlock()
+		}(host)
+	}
+
+	wg.Wait()
+
+	report.EndTime = time.Now()
+	report.Status = r.policy.Evaluate(report)
+	return report
+}
+
+// RetryUnreachable re-runs fn on the hosts that were unreachable in a previous
+// report and merges the new results into it, so hosts that were briefly down
+// still take part in the run.
+func (r *HostRunner) RetryUnreachable(ctx context.Context, report *RunReport, fn HostFunc) *RunReport {
+	hosts := report.UnreachableHosts()
+	if len(hosts) == 0 {
+		return report
+	}
+
+	retry := r.Run(ctx, hosts, fn)
+	report.Merge(retry)
+	report.Status = r.policy.Evaluate(report)
+	return report
+}
+
+// runHost runs fn on a single host and classifies the outcome
+func (r *HostRunner) runHost(ctx context.Context, host string, fn HostFunc) HostResult {
+	result := HostResult{
+		Host:      host,
+		Attempts:  1,
+		StartTime: time.Now(),
+	}
+
+	execResult, err := fn(ctx, host)
+	result.Result = execResult
+	result.EndTime = time.Now()
+	result.Duration = result.EndTime.Sub(result.StartTime)
+
+	switch {
+	case errors.Is(err, ErrHostUnreachable):
+		result.Status = HostUnreachable
+		result.Error = err
+	case err != nil:
+		result.Status = HostFailed
+		result.Error = err
+	case execResult != nil && execResult.Summary.Failed > 0:
+		result.Status = HostFailed
+		result.Error = fmt.Errorf("%d change(s) failed", execResult.Summary.Failed)
+	default:
+		result.Status = HostSucceeded
+	}
+
+	return result
+}
@@ -0,0 +1,206 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+)
+
+func TestUnreachablePolicy_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  UnreachablePolicy
+		wantErr bool
+	}{
+		{"fail", UnreachablePolicy{Action: UnreachableFail}, false},
+		{"warn with limit", UnreachablePolicy{Action: UnreachableWarn, MaxPercent: 10}, false},
+		{"ignore", UnreachablePolicy{Action: UnreachableIgnore}, false},
+		{"invalid action", UnreachablePolicy{Action: "explode"}, true},
+		{"negative percent", UnreachablePolicy{Action: UnreachableWarn, MaxPercent: -1}, true},
+		{"percent over 100", UnreachablePolicy{Action: UnreachableWarn, MaxPercent: 101}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Validate()
+			if tt.wantErr && err == nil {
+				t.Error("Expected error but got none")
+			}
+			if !tt.wantErr && err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestUnreachablePolicy_Evaluate(t *testing.T) {
+	report := func(statuses ...HostStatus) *RunReport {
+		r := NewRunReport()
+		for i, status := range statuses {
+			r.Add(HostResult{Host: fmt.Sprintf("host%d", i), Status: status})
+		}
+		return r
+	}
+
+	tests := []struct {
+		name   string
+		policy UnreachablePolicy
+		report *RunReport
+		want   RunStatus
+	}{
+		{
+			name:   "all succeeded",
+			policy: UnreachablePolicy{Action: UnreachableFail},
+			report: report(HostSucceeded, HostSucceeded),
+			want:   RunSucceeded,
+		},
+		{
+			name:   "fail on unreachable",
+			policy: UnreachablePolicy{Action: UnreachableFail},
+			report: report(HostSucceeded, HostUnreachable),
+			want:   RunFailed,
+		},
+		{
+			name:   "warn on unreachable",
+			policy: UnreachablePolicy{Action: UnreachableWarn},
+			report: report(HostSucceeded, HostUnreachable),
+			want:   RunPartial,
+		},
+		{
+			name:   "ignore within limit",
+			policy: UnreachablePolicy{Action: UnreachableIgnore, MaxPercent: 25},
+			report: report(HostSucceeded, HostSucceeded, HostSucceeded, HostUnreachable),
+			want:   RunSucceeded,
+		},
+		{
+			name:   "ignore over limit",
+			policy: UnreachablePolicy{Action: UnreachableIgnore, MaxPercent: 25},
+			report: report(HostSucceeded, HostUnreachable, HostUnreachable),
+			want:   RunFailed,
+		},
+		{
+			name:   "failures always fail",
+			policy: UnreachablePolicy{Action: UnreachableIgnore},
+			report: report(HostSucceeded, HostFailed),
+			want:   RunFailed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.policy.Evaluate(tt.report); got != tt.want {
+				t.Errorf("Evaluate() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHostRunner_Run(t *testing.T) {
+	runner := NewHostRunner(2, UnreachablePolicy{Action: UnreachableWarn})
+
+	report := runner.Run(context.Background(), []string{"web2", "web1", "db1", "db2"}, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+		switch host {
+		case "db1":
+			return nil, fmt.Errorf("%w: connection refused", ErrHostUnreachable)
+		case "db2":
+			result := core.NewExecutionResult()
+			result.AddChangeResult(core.ChangeResult{Success: false, Error: errors.New("boom")})
+			return result, nil
+		default:
+			return core.NewExecutionResult(), nil
+		}
+	})
+
+	if len(report.Hosts) != 4 {
+		t.Fatalf("Expected 4 host results, got %d", len(report.Hosts))
+	}
+	if report.Hosts[0].Host != "db1" {
+		t.Errorf("Expected hosts sorted by name, first is %s", report.Hosts[0].Host)
+	}
+	if got := report.UnreachableHosts(); len(got) != 1 || got[0] != "db1" {
+		t.Errorf("Expected db1 unreachable, got %v", got)
+	}
+	if len(report.Failed()) != 1 {
+		t.Errorf("Expected 1 failed host, got %d", len(report.Failed()))
+	}
+	if len(report.Succeeded()) != 2 {
+		t.Errorf("Expected 2 succeeded hosts, got %d", len(report.Succeeded()))
+	}
+	if report.Status != RunFailed {
+		t.Errorf("Expected failed status due to db2, got %s", report.Status)
+	}
+}
+
+func TestHostRunner_RetryUnreachable(t *testing.T) {
+	runner := NewHostRunner(1, UnreachablePolicy{Action: UnreachableFail})
+
+	down := map[string]bool{"web2": true}
+	fn := func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+		if down[host] {
+			return nil, fmt.Errorf("%w: timeout", ErrHostUnreachable)
+		}
+		return core.NewExecutionResult(), nil
+	}
+
+	report := runner.Run(context.Background(), []string{"web1", "web2"}, fn)
+	if report.Status != RunFailed {
+		t.Fatalf("Expected failed status, got %s", report.Status)
+	}
+
+	down["web2"] = false
+	report = runner.RetryUnreachable(context.Background(), report, fn)
+
+	if report.Status != RunSucceeded {
+		t.Errorf("Expected succeeded status after retry, got %s", report.Status)
+	}
+	result, ok := report.Get("web2")
+	if !ok {
+		t.Fatal("Expected result for web2")
+	}
+	if result.Attempts != 2 {
+		t.Errorf("Expected 2 attempts for web2, got %d", result.Attempts)
+	}
+}
+
+func TestHostRunner_RunOrder(t *testing.T) {
+	runner := NewHostRunner(1, DefaultUnreachablePolicy())
+
+	var mu sync.Mutex
+	var started []string
+	hosts := []string{"web3", "web1", "web2"}
+	runner.Run(context.Background(), hosts, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+		mu.Lock()
+		started = append(started, host)
+		mu.Unlock()
+		return core.NewExecutionResult(), nil
+	})
+
+	for i := range hosts {
+		if started[i] != hosts[i] {
+			t.Fatalf("Expected hosts started in order %v, got %v", hosts, started)
+		}
+	}
+}
+
+func TestRunReport_RecordHealth(t *testing.T) {
+	report := NewRunReport()
+	report.Add(HostResult{Host: "web1", Status: HostSucceeded})
+	report.Add(HostResult{Host: "web2", Status: HostUnreachable})
+	report.Add(HostResult{Host: "web3", Status: HostSkipped})
+
+	tracker := inventory.NewHealthTracker(0)
+	report.RecordHealth(tracker)
+
+	scores := tracker.Scores()
+	if len(scores) != 2 {
+		t.Fatalf("Expected skipped host to be ignored, got %+v", scores)
+	}
+	if scores[0].SuccessRate != 1 || scores[1].SuccessRate != 0 {
+		t.Errorf("Unexpected scores %+v", scores)
+	}
+}
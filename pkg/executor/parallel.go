@@ -3,6 +3,7 @@ package executor
 import (
 	"context"
 	"fmt"
+	"sort"
 	"sync"
 	"time"
 
@@ -237,46 +238,40 @@ func (g *DependencyGraph) AddEdge(from, to string) {
 // TopologicalSort performs a topological sort and returns batches of resources
 // that can be executed in parallel
 func (g *DependencyGraph) TopologicalSort() ([][]*types.ResourceDiff, error) {
-	// Calculate in-degrees
-	inDegree := make(map[string]int)
+	// Number the nodes in sorted order so batches are deterministic
+	nodes := make([]string, 0, len(g.nodes))
 	for node := range g.nodes {
-		inDegree[node] = 0
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	index := make(map[string]int, len(nodes))
+	for i, node := range nodes {
+		index[node] = i
 	}
 	
-	for _, neighbors := range g.edges {
+	edges := make(map[int][]int)
+	for from, neighbors := range g.edges {
 		for _, neighbor := range neighbors {
-			inDegree[neighbor]++
+			i, fromKnown := index[from]
+			j, toKnown := index[neighbor]
+			if fromKnown && toKnown {
+				edges[i] = append(edges[i], j)
+			}
 		}
 	}
 	
 	var batches [][]*types.ResourceDiff
-	visited := make(map[string]bool)
-	
-	// Process nodes in batches
-	for len(visited) < len(g.nodes) {
-		var currentBatch []*types.ResourceDiff
-		
-		// Find all nodes with in-degree 0
-		for node := range g.nodes {
-			if !visited[node] && inDegree[node] == 0 {
-				currentBatch = append(currentBatch, g.nodes[node])
-				visited[node] = true
-			}
-		}
-		
-		if len(currentBatch) == 0 {
-			// Circular dependency detected
-			return nil, fmt.Errorf("circular dependency detected")
-		}
-		
-		batches = append(batches, currentBatch)
-		
-		// Update in-degrees for next iteration
-		for _, resource := range currentBatch {
-			for _, neighbor := range g.edges[resource.ResourceID] {
-				inDegree[neighbor]--
-			}
+	batched := 0
+	for _, level := range types.GraphLevels(len(nodes), edges) {
+		batch := make([]*types.ResourceDiff, len(level))
+		for i, node := range level {
+			batch[i] = g.nodes[nodes[node]]
 		}
+		batches = append(batches, batch)
+		batched += len(level)
+	}
+	if batched < len(nodes) {
+		return nil, fmt.Errorf("circular dependency detected")
 	}
 	
 	return batches, nil
@@ -0,0 +1,64 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Rolling describes a rollout that applies to hosts in waves and halts once
+// too many of them fail
+type Rolling struct {
+	// BatchSize is how many hosts each wave applies to
+	BatchSize int
+
+	// MaxFailPercent is the share of hosts, from 0 to 100, that may fail or
+	// be unreachable before the rollout halts. Zero halts it at the first
+	// wave with a failure.
+	MaxFailPercent float64
+}
+
+// Batches returns the hosts in waves of at most BatchSize, in the order given
+func (r Rolling) Batches(hosts []string) [][]string {
+	size := r.BatchSize
+	if size < 1 {
+		size = len(hosts)
+	}
+
+	var batches [][]string
+	for start := 0; start < len(hosts); start += size {
+		end := start + size
+		if end > len(hosts) {
+			end = len(hosts)
+		}
+		batches = append(batches, hosts[start:end])
+	}
+	return batches
+}
+
+// RunRolling applies fn to hosts wave by wave. After each wave it halts if
+// the hosts that failed or were unreachable so far pass MaxFailPercent of
+// all the hosts; hosts not yet applied to are reported as skipped.
+func (r *HostRunner) RunRolling(ctx context.Context, hosts []string, rolling Rolling, fn HostFunc) *RunReport {
+	report := NewRunReport()
+
+	batches := rolling.Batches(hosts)
+	for i, batch := range batches {
+		report.Merge(r.Run(ctx, batch, fn))
+
+		failed := len(report.Failed()) + len(report.Unreachable())
+		percent := float64(failed) / float64(len(hosts)) * 100
+		if failed > 0 && percent > rolling.MaxFailPercent && i < len(batches)-1 {
+			var remaining []string
+			for _, rest := range batches[i+1:] {
+				remaining = append(remaining, rest...)
+			}
+			r.skip(report, remaining, fmt.Errorf("rollout halted after wave %d: %.0f%% of hosts failed, more than the %v%% allowed", i+1, percent, rolling.MaxFailPercent))
+			break
+		}
+	}
+
+	report.EndTime = time.Now()
+	report.Status = r.policy.Evaluate(report)
+	return report
+}
@@ -0,0 +1,84 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+)
+
+func TestRolling_Batches(t *testing.T) {
+	rolling := Rolling{BatchSize: 2}
+	got := rolling.Batches([]string{"web3", "web1", "web2", "web4", "web5"})
+	want := [][]string{{"web3", "web1"}, {"web2", "web4"}, {"web5"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Batches() = %v, want %v", got, want)
+	}
+}
+
+func TestHostRunner_RunRolling(t *testing.T) {
+	hosts := []string{"web1", "web2", "web3", "web4", "web5", "web6"}
+	failing := func(failed ...string) HostFunc {
+		return func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			for _, name := range failed {
+				if host == name {
+					return nil, errors.New("boom")
+				}
+			}
+			return core.NewExecutionResult(), nil
+		}
+	}
+
+	t.Run("applies in waves", func(t *testing.T) {
+		var mu sync.Mutex
+		var order []string
+
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		report := runner.RunRolling(context.Background(), hosts, Rolling{BatchSize: 1}, func(ctx context.Context, host string) (*core.ExecutionResult, error) {
+			mu.Lock()
+			order = append(order, host)
+			mu.Unlock()
+			return core.NewExecutionResult(), nil
+		})
+
+		if report.Status != RunSucceeded {
+			t.Errorf("Expected succeeded status, got %s", report.Status)
+		}
+		if !reflect.DeepEqual(order, hosts) {
+			t.Errorf("Expected hosts in order, got %v", order)
+		}
+	})
+
+	t.Run("halts at the first failed wave", func(t *testing.T) {
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		report := runner.RunRolling(context.Background(), hosts, Rolling{BatchSize: 2}, failing("web2"))
+
+		if len(report.Failed()) != 1 || len(report.Succeeded()) != 1 {
+			t.Fatalf("Expected the first wave only, got %+v", report.Hosts)
+		}
+		if skipped := report.Skipped(); len(skipped) != 4 {
+			t.Errorf("Expected 4 hosts skipped, got %+v", skipped)
+		}
+	})
+
+	t.Run("tolerates failures up to the limit", func(t *testing.T) {
+		runner := NewHostRunner(10, DefaultUnreachablePolicy())
+		report := runner.RunRolling(context.Background(), hosts, Rolling{BatchSize: 2, MaxFailPercent: 20}, failing("web1", "web4"))
+
+		// web1 fails 17% of the hosts, within the limit; web4 makes it 33%
+		if len(report.Failed()) != 2 || len(report.Succeeded()) != 2 {
+			t.Fatalf("Expected two waves applied, got %+v", report.Hosts)
+		}
+		for _, host := range []string{"web5", "web6"} {
+			if result, ok := report.Get(host); !ok || result.Status != HostSkipped {
+				t.Errorf("Expected %s to be skipped, got %+v", host, result)
+			}
+		}
+		if report.Status != RunFailed {
+			t.Errorf("Expected failed status, got %s", report.Status)
+		}
+	})
+}
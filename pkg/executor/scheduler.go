@@ -0,0 +1,240 @@
+package executor
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// implicitDependencies lists, per resource type, the types it implicitly runs after
+// when no explicit depends_on edge says otherwise
+var implicitDependencies = map[string][]string{
+	"file":      {"user"},
+	"file_edit": {"pkg", "file", "user"},
+	"pkg":       {"repo"},
+	"service":   {"pkg", "file", "file_edit", "sync"},
+	"shell":     {"pkg", "file", "user"},
+	"sync":      {"user"},
+	"wait_for":  {"pkg", "file", "service"},
+}
+
+// Scheduler orders plan changes into a DAG using explicit depends_on edges
+// plus implicit type ordering, and executes independent branches in parallel
+type Scheduler struct {
+	maxConcurrency int
+	implicit       bool
+}
+
+// NewScheduler creates a new DAG scheduler
+func NewScheduler(maxConcurrency int) *Scheduler {
+	if maxConcurrency <= 0 {
+		maxConcurrency = 10 // default
+	}
+
+	return &Scheduler{
+		maxConcurrency: maxConcurrency,
+		implicit:       true,
+	}
+}
+
+// SetImplicitOrdering enables or disables implicit type-based ordering
+func (s *Scheduler) SetImplicitOrdering(enabled bool) {
+	s.implicit = enabled
+}
+
+// Graph builds the dependency graph for a plan. Edges point from a change to
+// the changes that depend on it; indexes refer to plan.Changes.
+func (s *Scheduler) Graph(plan *core.Plan) (map[int][]int, error) {
+	index := make(map[string]int, len(plan.Changes))
+	for i, change := range plan.Changes {
+		index[change.Resource.ResourceID()] = i
+	}
+
+	edges := make(map[int][]int, len(plan.Changes))
+	hasEdge := func(from, to int) bool {
+		for _, n := range edges[from] {
+			if n == to {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Explicit depends_on edges
+	for i, change := range plan.Changes {
+		for _, dep := range change.Resource.DependsOn {
+			j, exists := index[dep]
+			if !exists {
+				return nil, fmt.Errorf("resource %s depends on unknown resource %s", change.Resource.ResourceID(), dep)
+			}
+			if !hasEdge(j, i) {
+				edges[j] = append(edges[j], i)
+			}
+		}
+	}
+
+	if err := checkAcyclic(plan, edges); err != nil {
+		return nil, err
+	}
+
+	// Implicit edges never override explicit ones: skip any that would close a cycle
+	if s.implicit {
+		for i, change := range plan.Changes {
+			for _, depType := range implicitDependencies[change.Resource.Type] {
+				for j, other := range plan.Changes {
+					if i == j || other.Resource.Type != depType || hasEdge(j, i) {
+						continue
+					}
+					if reachable(edges, i, j) {
+						continue
+					}
+					edges[j] = append(edges[j], i)
+				}
+			}
+		}
+	}
+
+	return edges, nil
+}
+
+// Batches groups plan changes into batches that can run in parallel, in dependency order.
+// Changes within a batch keep their plan order.
+func (s *Scheduler) Batches(plan *core.Plan) ([][]core.Change, error) {
+	edges, err := s.Graph(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	levels := types.GraphLevels(len(plan.Changes), edges)
+	batches := make([][]core.Change, len(levels))
+	for i, level := range levels {
+		for _, idx := range level {
+			batches[i] = append(batches[i], plan.Changes[idx])
+		}
+	}
+	return batches, nil
+}
+
+// Execute applies a plan batch by batch. Changes whose dependencies failed are
+// not applied and are reported as failed; independent branches continue.
+func (s *Scheduler) Execute(ctx context.Context, plan *core.Plan, registry *types.ProviderRegistry) (*core.ExecutionResult, error) {
+	edges, err := s.Graph(plan)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reverse edges so each change knows its prerequisites
+	prerequisites := make(map[int][]int)
+	for from, tos := range edges {
+		for _, to := range tos {
+			prerequisites[to] = append(prerequisites[to], from)
+		}
+	}
+
+	executor := core.NewExecutor(registry)
+	result := core.NewExecutionResult()
+	failed := make(map[int]bool)
+
+	for _, level := range types.GraphLevels(len(plan.Changes), edges) {
+		results := make([]core.ChangeResult, len(level))
+
+		semaphore := make(chan struct{}, s.maxConcurrency)
+		var wg sync.WaitGroup
+
+		for pos, idx := range level {
+			change := plan.Changes[idx]
+
+			if dep, blocked := firstFailed(prerequisites[idx], failed); blocked {
+				now := time.Now()
+				results[pos] = core.ChangeResult{
+					Change:    change,
+					Success:   false,
+					Error:     fmt.Errorf("skipped: dependency %s failed", plan.Changes[dep].Resource.ResourceID()),
+					StartTime: now,
+					EndTime:   now,
+				}
+				core.StreamResult(ctx, results[pos])
+				continue
+			}
+
+			wg.Add(1)
+			go func(pos int, change core.Change) {
+				defer wg.Done()
+
+				semaphore <- struct{}{}
+				defer func() { <-semaphore }()
+
+				changeResult, err := executor.ExecutePlan(ctx, plan.Single(change))
+				if err != nil {
+					results[pos] = core.ChangeResult{Change: change, Error: err}
+					core.StreamResult(ctx, results[pos])
+					return
+				}
+				results[pos] = changeResult.Changes[0]
+			}(pos, change)
+		}
+
+		wg.Wait()
+
+		for pos, idx := range level {
+			if !results[pos].Success {
+				failed[idx] = true
+			}
+			result.AddChangeResult(results[pos])
+		}
+	}
+
+	// Run handlers notified by applied changes
+	executor.RunHandlers(ctx, plan, result)
+
+	result.Finalize()
+	return result, nil
+}
+
+// firstFailed returns the first prerequisite that failed, if any
+func firstFailed(prerequisites []int, failed map[int]bool) (int, bool) {
+	for _, p := range prerequisites {
+		if failed[p] {
+			return p, true
+		}
+	}
+	return 0, false
+}
+
+// reachable reports whether to can be reached from from by following edges
+func reachable(edges map[int][]int, from, to int) bool {
+	visited := make(map[int]bool)
+	stack := []int{from}
+	for len(stack) > 0 {
+		n := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if n == to {
+			return true
+		}
+		if visited[n] {
+			continue
+		}
+		visited[n] = true
+		stack = append(stack, edges[n]...)
+	}
+	return false
+}
+
+// checkAcyclic returns an error naming the changes on a cycle of the graph,
+// if it has one
+func checkAcyclic(plan *core.Plan, edges map[int][]int) error {
+	cycle := types.GraphCycle(len(plan.Changes), edges)
+	if cycle == nil {
+		return nil
+	}
+	ids := make([]string, len(cycle))
+	for k, i := range cycle {
+		ids[k] = plan.Changes[i].Resource.ResourceID()
+	}
+	return fmt.Errorf("circular dependency detected: %s", strings.Join(ids, " -> "))
+}
@@ -0,0 +1,214 @@
+package executor
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// recordingProvider records applied resources and fails those listed in failures
+type recordingProvider struct {
+	resourceType string
+	failures     map[string]bool
+
+	mu      *sync.Mutex
+	applied *[]string
+}
+
+func (p *recordingProvider) Type() string { return p.resourceType }
+
+func (p *recordingProvider) Validate(resource *types.Resource) error { return nil }
+
+func (p *recordingProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return map[string]interface{}{}, nil
+}
+
+func (p *recordingProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	return &types.ResourceDiff{ResourceID: resource.ResourceID(), Action: types.ActionCreate}, nil
+}
+
+func (p *recordingProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	*p.applied = append(*p.applied, resource.ResourceID())
+	if p.failures[resource.ResourceID()] {
+		return errors.New("apply failed")
+	}
+	return nil
+}
+
+func newTestPlan(resources ...types.Resource) *core.Plan {
+	plan := core.NewPlan()
+	for _, resource := range resources {
+		plan.AddChange(core.Change{Action: core.ActionCreate, Resource: resource})
+	}
+	return plan
+}
+
+func batchIDs(batches [][]core.Change) [][]string {
+	ids := make([][]string, len(batches))
+	for i, batch := range batches {
+		for _, change := range batch {
+			ids[i] = append(ids[i], change.Resource.ResourceID())
+		}
+	}
+	return ids
+}
+
+func TestScheduler_Batches(t *testing.T) {
+	tests := []struct {
+		name      string
+		implicit  bool
+		resources []types.Resource
+		expected  [][]string
+		wantErr   bool
+	}{
+		{
+			name:     "explicit chain",
+			implicit: false,
+			resources: []types.Resource{
+				{Type: "service", Name: "nginx", DependsOn: []string{"file.conf"}},
+				{Type: "file", Name: "conf", DependsOn: []string{"pkg.nginx"}},
+				{Type: "pkg", Name: "nginx"},
+			},
+			expected: [][]string{{"pkg.nginx"}, {"file.conf"}, {"service.nginx"}},
+		},
+		{
+			name:     "independent resources run together",
+			implicit: false,
+			resources: []types.Resource{
+				{Type: "pkg", Name: "nginx"},
+				{Type: "pkg", Name: "git"},
+				{Type: "service", Name: "nginx", DependsOn: []string{"pkg.nginx"}},
+			},
+			expected: [][]string{{"pkg.nginx", "pkg.git"}, {"service.nginx"}},
+		},
+		{
+			name:     "implicit type ordering",
+			implicit: true,
+			resources: []types.Resource{
+				{Type: "service", Name: "nginx"},
+				{Type: "pkg", Name: "nginx"},
+				{Type: "user", Name: "deploy"},
+			},
+			expected: [][]string{{"pkg.nginx", "user.deploy"}, {"service.nginx"}},
+		},
+		{
+			name:     "explicit edge wins over implicit ordering",
+			implicit: true,
+			resources: []types.Resource{
+				{Type: "pkg", Name: "app", DependsOn: []string{"service.db"}},
+				{Type: "service", Name: "db"},
+			},
+			expected: [][]string{{"service.db"}, {"pkg.app"}},
+		},
+		{
+			name:     "cycle",
+			implicit: false,
+			resources: []types.Resource{
+				{Type: "pkg", Name: "a", DependsOn: []string{"pkg.b"}},
+				{Type: "pkg", Name: "b", DependsOn: []string{"pkg.a"}},
+			},
+			wantErr: true,
+		},
+		{
+			name:     "unknown dependency",
+			implicit: false,
+			resources: []types.Resource{
+				{Type: "pkg", Name: "a", DependsOn: []string{"pkg.missing"}},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			scheduler := NewScheduler(4)
+			scheduler.SetImplicitOrdering(tt.implicit)
+
+			batches, err := scheduler.Batches(newTestPlan(tt.resources...))
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Expected error but got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			got := batchIDs(batches)
+			if len(got) != len(tt.expected) {
+				t.Fatalf("Expected %d batches, got %d: %v", len(tt.expected), len(got), got)
+			}
+			for i := range tt.expected {
+				if strings.Join(got[i], ",") != strings.Join(tt.expected[i], ",") {
+					t.Errorf("Batch %d: expected %v, got %v", i, tt.expected[i], got[i])
+				}
+			}
+		})
+	}
+}
+
+func TestScheduler_Execute(t *testing.T) {
+	var mu sync.Mutex
+	var applied []string
+
+	registry := types.NewProviderRegistry()
+	for _, resourceType := range []string{"pkg", "file", "service"} {
+		provider := &recordingProvider{
+			resourceType: resourceType,
+			failures:     map[string]bool{"pkg.nginx": true},
+			mu:           &mu,
+			applied:      &applied,
+		}
+		if err := registry.Register(provider); err != nil {
+			t.Fatalf("Failed to register provider: %v", err)
+		}
+	}
+
+	plan := newTestPlan(
+		types.Resource{Type: "pkg", Name: "nginx"},
+		types.Resource{Type: "pkg", Name: "git"},
+		types.Resource{Type: "file", Name: "conf", DependsOn: []string{"pkg.nginx"}},
+		types.Resource{Type: "service", Name: "nginx", DependsOn: []string{"file.conf"}},
+	)
+
+	scheduler := NewScheduler(2)
+	scheduler.SetImplicitOrdering(false)
+
+	result, err := scheduler.Execute(context.Background(), plan, registry)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if result.Summary.Total != 4 {
+		t.Errorf("Expected 4 results, got %d", result.Summary.Total)
+	}
+	if result.Summary.Succeeded != 1 {
+		t.Errorf("Expected 1 success, got %d", result.Summary.Succeeded)
+	}
+	if result.Summary.Failed != 3 {
+		t.Errorf("Expected 3 failures, got %d", result.Summary.Failed)
+	}
+
+	// Dependents of the failed package must not be applied
+	for _, id := range applied {
+		if id == "file.conf" || id == "service.nginx" {
+			t.Errorf("Dependent %s should have been skipped", id)
+		}
+	}
+
+	for _, changeResult := range result.Changes {
+		if changeResult.Change.Resource.Name == "conf" {
+			if changeResult.Error == nil || !strings.Contains(changeResult.Error.Error(), "dependency pkg.nginx failed") {
+				t.Errorf("Expected skipped dependency error, got %v", changeResult.Error)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package facts
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultCacheDir is where gathered facts are kept between runs
+	DefaultCacheDir = ".chisel/facts"
+	// DefaultTTL is how long cached facts are used before they are gathered again
+	DefaultTTL = 10 * time.Minute
+)
+
+// Cache keeps the facts of each host in a file for a TTL, so runs in quick
+// succession do not gather them again. A zero TTL turns the cache off.
+type Cache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewCache creates a cache of facts in a directory
+func NewCache(dir string, ttl time.Duration) *Cache {
+	return &Cache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// path returns the file a host's facts are kept in
+func (c *Cache) path(host string) string {
+	return filepath.Join(c.dir, url.PathEscape(host)+".yaml")
+}
+
+// Get returns the cached facts of a host while they are younger than the TTL
+func (c *Cache) Get(host string) (*Facts, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+	facts, ok := c.Last(host)
+	if !ok || c.now().Sub(facts.GatheredAt) >= c.ttl {
+		return nil, false
+	}
+	return facts, true
+}
+
+// Last returns the facts last gathered from a host however old they are,
+// for rendering offline what a run would
+func (c *Cache) Last(host string) (*Facts, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(host))
+	if err != nil {
+		return nil, false
+	}
+	var facts Facts
+	// A damaged cache file is gathered again and overwritten
+	if err := yaml.Unmarshal(data, &facts); err != nil || facts.Host != host {
+		return nil, false
+	}
+	return &facts, true
+}
+
+// Put stores the facts of a host
+func (c *Cache) Put(facts *Facts) error {
+	if c == nil || c.ttl <= 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(facts)
+	if err != nil {
+		return fmt.Errorf("failed to marshal facts of %s: %w", facts.Host, err)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create facts cache %s: %w", c.dir, err)
+	}
+	if err := os.WriteFile(c.path(facts.Host), data, 0644); err != nil {
+		return fmt.Errorf("failed to write facts of %s: %w", facts.Host, err)
+	}
+	return nil
+}
+
+// Forget removes the cached facts of a host, so the next run gathers them
+func (c *Cache) Forget(host string) error {
+	if c == nil {
+		return nil
+	}
+	if err := os.Remove(c.path(host)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to forget facts of %s: %w", host, err)
+	}
+	return nil
+}
+
+// Gather returns the cached facts of a host, gathering and caching them
+// when there are none or they have expired. A nil cache always gathers.
+func (c *Cache) Gather(ctx context.Context, executor ssh.Executor, host string) (*Facts, error) {
+	if facts, ok := c.Get(host); ok {
+		return facts, nil
+	}
+	facts, err := Gather(ctx, executor, host)
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Put(facts); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
@@ -0,0 +1,111 @@
+package facts
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// countingExecutor answers the facts script and counts how often it ran
+type countingExecutor struct {
+	runs int
+}
+
+func (e *countingExecutor) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	e.runs++
+	return &ssh.ExecuteResult{Stdout: "os_family=Linux\ndistribution=debian\ncpus=2\n"}, nil
+}
+
+func (e *countingExecutor) Connect(ctx context.Context) error { return nil }
+func (e *countingExecutor) Close() error                      { return nil }
+
+func TestCache_Gather(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewCache(dir, time.Minute)
+	cache.now = func() time.Time { return now }
+	executor := &countingExecutor{}
+	ctx := context.Background()
+
+	first, err := cache.Gather(ctx, executor, "db1:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "db1:2222.yaml")); err != nil {
+		t.Errorf("facts were not cached: %v", err)
+	}
+
+	// Facts gathered just now are younger than the TTL
+	now = first.GatheredAt.Add(30 * time.Second)
+	second, err := cache.Gather(ctx, executor, "db1:2222")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if executor.runs != 1 || second.DistroFamily != "debian" || second.CPUs != 2 {
+		t.Errorf("cached Gather() ran %d times and returned %+v", executor.runs, second)
+	}
+
+	now = first.GatheredAt.Add(time.Minute)
+	if _, err := cache.Gather(ctx, executor, "db1:2222"); err != nil {
+		t.Fatal(err)
+	}
+	if executor.runs != 2 {
+		t.Errorf("expired facts were not gathered again, %d runs", executor.runs)
+	}
+
+	if err := cache.Forget("db1:2222"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cache.Get("db1:2222"); ok {
+		t.Error("forgotten facts are still cached")
+	}
+	if err := cache.Forget("db1:2222"); err != nil {
+		t.Errorf("forgetting uncached facts: %v", err)
+	}
+}
+
+func TestCache_Disabled(t *testing.T) {
+	dir := t.TempDir()
+	executor := &countingExecutor{}
+	for _, cache := range []*Cache{nil, NewCache(dir, 0)} {
+		for i := 0; i < 2; i++ {
+			if _, err := cache.Gather(context.Background(), executor, "web1"); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if executor.runs != 4 {
+		t.Errorf("disabled caches ran the script %d times, want 4", executor.runs)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("a disabled cache wrote %d file(s)", len(entries))
+	}
+}
+
+func TestCache_Last(t *testing.T) {
+	cache := NewCache(t.TempDir(), time.Minute)
+	gathered := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	if err := cache.Put(&Facts{Host: "web1", DistroFamily: "debian", GatheredAt: gathered}); err != nil {
+		t.Fatal(err)
+	}
+
+	cache.now = func() time.Time { return gathered.Add(24 * time.Hour) }
+	if _, ok := cache.Get("web1"); ok {
+		t.Error("Get() returned expired facts")
+	}
+	facts, ok := cache.Last("web1")
+	if !ok || facts.DistroFamily != "debian" {
+		t.Errorf("Last() = %+v, %v, want the expired facts", facts, ok)
+	}
+	if _, ok := cache.Last("web2"); ok {
+		t.Error("Last() returned facts of a host never gathered")
+	}
+	var disabled *Cache
+	if _, ok := disabled.Last("web1"); ok {
+		t.Error("Last() of a nil cache returned facts")
+	}
+}
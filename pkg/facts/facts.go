@@ -0,0 +1,292 @@
+// Package facts gathers what a target's system is — its OS, distribution,
+// architecture, memory, CPUs and addresses — so modules can render templates
+// and pick resources for it, and caches the facts between runs.
+package facts
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Facts describe a target's system
+type Facts struct {
+	Host string `yaml:"host" json:"host"`
+
+	// OSFamily is the lower-cased kernel name, such as linux or darwin
+	OSFamily string `yaml:"os_family" json:"os_family"`
+	// Distribution is the ID of /etc/os-release, such as ubuntu or rocky,
+	// DistroFamily the family it belongs to, such as debian or redhat, and
+	// Version its VERSION_ID. On macOS Version is the product version.
+	Distribution string `yaml:"distribution,omitempty" json:"distribution,omitempty"`
+	DistroFamily string `yaml:"distro_family,omitempty" json:"distro_family,omitempty"`
+	Version      string `yaml:"version,omitempty" json:"version,omitempty"`
+
+	Kernel       string   `yaml:"kernel,omitempty" json:"kernel,omitempty"`
+	Architecture string   `yaml:"architecture,omitempty" json:"architecture,omitempty"`
+	Hostname     string   `yaml:"hostname,omitempty" json:"hostname,omitempty"`
+	CPUs         int      `yaml:"cpus,omitempty" json:"cpus,omitempty"`
+	MemoryMB     int64    `yaml:"memory_mb,omitempty" json:"memory_mb,omitempty"`
+	IPAddresses  []string `yaml:"ip_addresses,omitempty" json:"ip_addresses,omitempty"`
+
+	// Virtualization is the hypervisor or container the target runs in, as
+	// systemd-detect-virt names it, such as kvm or docker, or physical.
+	// Cloud is the provider whose instance it is, such as aws or gcp, and
+	// Datacenter the zone or region the provider reports for it.
+	Virtualization string `yaml:"virtualization,omitempty" json:"virtualization,omitempty"`
+	Cloud          string `yaml:"cloud,omitempty" json:"cloud,omitempty"`
+	Datacenter     string `yaml:"datacenter,omitempty" json:"datacenter,omitempty"`
+
+	GatheredAt time.Time `yaml:"gathered_at" json:"gathered_at"`
+}
+
+// script prints the facts as key=value lines in a single round trip. Each
+// fact falls back to the commands macOS and busybox systems have. Cloud
+// instances are recognised by their DMI vendor and asked for their zone by
+// the provider's metadata service.
+const script = `echo "os_family=$(uname -s)"
+echo "kernel=$(uname -r)"
+echo "architecture=$(uname -m)"
+echo "hostname=$(hostname 2>/dev/null || uname -n)"
+(. /etc/os-release && echo "distribution=$ID" && echo "like=$ID_LIKE" && echo "version=$VERSION_ID") 2>/dev/null
+command -v sw_vers >/dev/null 2>&1 && echo "version=$(sw_vers -productVersion)"
+echo "cpus=$(nproc 2>/dev/null || getconf _NPROCESSORS_ONLN 2>/dev/null || sysctl -n hw.ncpu 2>/dev/null)"
+awk '/^MemTotal:/ {print "memory_kb=" $2}' /proc/meminfo 2>/dev/null || echo "memory_bytes=$(sysctl -n hw.memsize 2>/dev/null)"
+{ hostname -I 2>/dev/null || { command -v ip >/dev/null 2>&1 && ip -o addr show scope global | awk '{sub("/.*", "", $4); print $4}'; } || ifconfig 2>/dev/null | awk '$1 == "inet" {sub("addr:", "", $2); print $2}'; } | tr ' ' '\n' | sed -n 's/^\([0-9a-fA-F.:][0-9a-fA-F.:]*\)$/ip=\1/p'
+echo "virtualization=$(systemd-detect-virt 2>/dev/null)"
+vendor=$(cat /sys/class/dmi/id/sys_vendor 2>/dev/null)
+echo "vendor=$vendor"
+echo "product=$(cat /sys/class/dmi/id/product_name 2>/dev/null)"
+echo "hypervisor=$(head -c 3 /sys/hypervisor/uuid 2>/dev/null)"
+if command -v curl >/dev/null 2>&1; then case "$vendor" in
+Amazon*|Xen) token=$(curl -sf -m 2 -X PUT -H "X-aws-ec2-metadata-token-ttl-seconds: 60" http://169.254.169.254/latest/api/token) && echo "zone=$(curl -sf -m 2 -H "X-aws-ec2-metadata-token: $token" http://169.254.169.254/latest/meta-data/placement/availability-zone)";;
+Google) echo "zone=$(curl -sf -m 2 -H "Metadata-Flavor: Google" http://169.254.169.254/computeMetadata/v1/instance/zone)";;
+Microsoft*) echo "zone=$(curl -sf -m 2 -H "Metadata: true" "http://169.254.169.254/metadata/instance/compute/location?api-version=2021-02-01&format=text")";;
+esac; fi
+true`
+
+// Gather collects the facts of the target an executor runs commands on
+func Gather(ctx context.Context, executor ssh.Executor, host string) (*Facts, error) {
+	result, err := executor.Execute(ctx, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather facts: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to gather facts: %s", strings.TrimSpace(result.Stderr))
+	}
+	return parse(host, result.Stdout, time.Now())
+}
+
+// parse reads the output of the facts script
+func parse(host, output string, now time.Time) (*Facts, error) {
+	facts := &Facts{Host: host, GatheredAt: now.UTC()}
+	var like, vendor, product, hypervisor string
+	for _, line := range strings.Split(output, "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), "=")
+		if !ok || value == "" {
+			continue
+		}
+		value = strings.Trim(value, `"`)
+		switch key {
+		case "os_family":
+			facts.OSFamily = strings.ToLower(value)
+		case "kernel":
+			facts.Kernel = value
+		case "architecture":
+			facts.Architecture = value
+		case "hostname":
+			facts.Hostname = value
+		case "distribution":
+			facts.Distribution = strings.ToLower(value)
+		case "like":
+			like = strings.ToLower(value)
+		case "version":
+			facts.Version = value
+		case "cpus":
+			facts.CPUs, _ = strconv.Atoi(value)
+		case "memory_kb":
+			if kilobytes, err := strconv.ParseInt(value, 10, 64); err == nil {
+				facts.MemoryMB = kilobytes / 1024
+			}
+		case "memory_bytes":
+			if bytes, err := strconv.ParseInt(value, 10, 64); err == nil {
+				facts.MemoryMB = bytes / (1024 * 1024)
+			}
+		case "ip":
+			if !isLoopback(value) && !contains(facts.IPAddresses, value) {
+				facts.IPAddresses = append(facts.IPAddresses, value)
+			}
+		case "virtualization":
+			facts.Virtualization = strings.ToLower(value)
+			if facts.Virtualization == "none" {
+				facts.Virtualization = "physical"
+			}
+		case "vendor":
+			vendor = value
+		case "product":
+			product = value
+		case "hypervisor":
+			hypervisor = value
+		case "zone":
+			// GCE answers with projects/<number>/zones/<zone>
+			facts.Datacenter = value[strings.LastIndex(value, "/")+1:]
+		}
+	}
+	if facts.OSFamily == "" {
+		return nil, fmt.Errorf("failed to gather facts: could not determine OS family")
+	}
+	if facts.Distribution != "" {
+		facts.DistroFamily = DistroFamily(facts.Distribution, strings.Fields(like))
+	}
+	facts.Cloud = cloudProvider(vendor, product, hypervisor)
+	return facts, nil
+}
+
+// cloudProvider names the cloud provider whose instance the DMI system
+// vendor and product name describe, or returns "" outside a cloud. Older
+// Xen-based EC2 instances are only told apart by their hypervisor UUID.
+func cloudProvider(vendor, product, hypervisor string) string {
+	switch {
+	case strings.HasPrefix(vendor, "Amazon") || strings.EqualFold(hypervisor, "ec2"):
+		return CloudAWS
+	case vendor == "Google" || strings.HasPrefix(product, "Google Compute Engine"):
+		return CloudGCP
+	case vendor == "Microsoft Corporation" && product == "Virtual Machine":
+		// Hyper-V outside Azure looks the same, but has no metadata service
+		return CloudAzure
+	case vendor == "DigitalOcean":
+		return CloudDigitalOcean
+	case vendor == "Hetzner":
+		return CloudHetzner
+	case strings.HasPrefix(product, "OpenStack"):
+		return CloudOpenStack
+	}
+	return ""
+}
+
+// Cloud providers recognised from a target's DMI data
+const (
+	CloudAWS          = "aws"
+	CloudGCP          = "gcp"
+	CloudAzure        = "azure"
+	CloudDigitalOcean = "digitalocean"
+	CloudHetzner      = "hetzner"
+	CloudOpenStack    = "openstack"
+)
+
+// isLoopback reports whether an address only reaches the target itself
+func isLoopback(address string) bool {
+	return strings.HasPrefix(address, "127.") || address == "::1"
+}
+
+// contains reports whether a list holds a value
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// distroFamilies maps os-release IDs to the family they belong to
+var distroFamilies = map[string]string{
+	"debian":    types.DistroDebian,
+	"ubuntu":    types.DistroDebian,
+	"linuxmint": types.DistroDebian,
+	"raspbian":  types.DistroDebian,
+	"rhel":      types.DistroRedHat,
+	"centos":    types.DistroRedHat,
+	"fedora":    types.DistroRedHat,
+	"amzn":      types.DistroRedHat,
+	"suse":      types.DistroSUSE,
+	"sles":      types.DistroSUSE,
+	"opensuse":  types.DistroSUSE,
+	"arch":      types.DistroArch,
+	"archarm":   types.DistroArch,
+	"manjaro":   types.DistroArch,
+	"alpine":    types.DistroAlpine,
+}
+
+// DistroFamily returns the family of a distribution from its os-release ID,
+// or from the IDs it is like; unknown distributions are their own family
+func DistroFamily(id string, like []string) string {
+	for _, candidate := range append([]string{id}, like...) {
+		if family, ok := distroFamilies[candidate]; ok {
+			return family
+		}
+		// opensuse-leap, opensuse-tumbleweed
+		if prefix, _, ok := strings.Cut(candidate, "-"); ok {
+			if family, ok := distroFamilies[prefix]; ok {
+				return family
+			}
+		}
+	}
+	return id
+}
+
+// Map returns the facts keyed as templates and when conditions see them,
+// such as .facts.distro_family. Nil facts map every key to its zero value.
+func (f *Facts) Map() map[string]interface{} {
+	if f == nil {
+		f = &Facts{}
+	}
+	addresses := append([]string{}, f.IPAddresses...)
+	primary := ""
+	if len(addresses) > 0 {
+		primary = addresses[0]
+	}
+	return map[string]interface{}{
+		"host":           f.Host,
+		"os_family":      f.OSFamily,
+		"distribution":   f.Distribution,
+		"distro_family":  f.DistroFamily,
+		"version":        f.Version,
+		"kernel":         f.Kernel,
+		"architecture":   f.Architecture,
+		"hostname":       f.Hostname,
+		"cpus":           f.CPUs,
+		"memory_mb":      f.MemoryMB,
+		"ip_addresses":   addresses,
+		"primary_ip":     primary,
+		"virtualization": f.Virtualization,
+		"cloud":          f.Cloud,
+		"datacenter":     f.Datacenter,
+	}
+}
+
+// Labels returns the labels the facts give a target, which module selectors
+// match along with the labels the inventory declares: os, os_family (the
+// distribution family, or the OS family where there is none),
+// distribution, arch, virtualization, cloud and datacenter. Facts that are
+// unknown give no label.
+func (f *Facts) Labels() map[string]string {
+	if f == nil {
+		return map[string]string{}
+	}
+	family := f.DistroFamily
+	if family == "" {
+		family = f.OSFamily
+	}
+	candidates := map[string]string{
+		"os":             f.OSFamily,
+		"os_family":      family,
+		"distribution":   f.Distribution,
+		"arch":           f.Architecture,
+		"virtualization": f.Virtualization,
+		"cloud":          f.Cloud,
+		"datacenter":     f.Datacenter,
+	}
+	labels := make(map[string]string, len(candidates))
+	for key, value := range candidates {
+		if value != "" {
+			labels[key] = value
+		}
+	}
+	return labels
+}
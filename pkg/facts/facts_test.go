@@ -0,0 +1,192 @@
+package facts
+
+import (
+	"context"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestParse(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		output string
+		want   *Facts
+	}{
+		{
+			name: "ubuntu",
+			output: `os_family=Linux
+kernel=6.8.0-31-generic
+architecture=x86_64
+hostname=web1
+distribution=ubuntu
+like=debian
+version=24.04
+cpus=4
+memory_kb=8147412
+ip=10.0.0.5
+ip=fd00::5
+ip=10.0.0.5
+`,
+			want: &Facts{
+				Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "ubuntu", DistroFamily: types.DistroDebian,
+				Version: "24.04", Kernel: "6.8.0-31-generic", Architecture: "x86_64", Hostname: "web1",
+				CPUs: 4, MemoryMB: 7956, IPAddresses: []string{"10.0.0.5", "fd00::5"}, GatheredAt: now,
+			},
+		},
+		{
+			name: "rocky quotes its ids",
+			output: `os_family=Linux
+distribution="rocky"
+like="rhel centos fedora"
+version="9.3"
+`,
+			want: &Facts{Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat, Version: "9.3", GatheredAt: now},
+		},
+		{
+			name: "macOS",
+			output: `os_family=Darwin
+architecture=arm64
+version=14.4
+cpus=8
+memory_bytes=17179869184
+ip=192.168.1.20
+ip=127.0.0.1
+`,
+			want: &Facts{
+				Host: "web1", OSFamily: types.OSFamilyDarwin, Version: "14.4", Architecture: "arm64",
+				CPUs: 8, MemoryMB: 16384, IPAddresses: []string{"192.168.1.20"}, GatheredAt: now,
+			},
+		},
+		{
+			name: "EC2 instance",
+			output: `os_family=Linux
+distribution=amzn
+version=2023
+virtualization=amazon
+vendor=Amazon EC2
+product=t3.micro
+zone=eu-west-1a
+`,
+			want: &Facts{
+				Host: "web1", OSFamily: types.OSFamilyLinux, Distribution: "amzn", DistroFamily: types.DistroRedHat, Version: "2023",
+				Virtualization: "amazon", Cloud: CloudAWS, Datacenter: "eu-west-1a", GatheredAt: now,
+			},
+		},
+		{
+			name: "GCE instance",
+			output: `os_family=Linux
+virtualization=kvm
+vendor=Google
+product=Google Compute Engine
+zone=projects/123456/zones/us-central1-a
+`,
+			want: &Facts{Host: "web1", OSFamily: types.OSFamilyLinux, Virtualization: "kvm", Cloud: CloudGCP, Datacenter: "us-central1-a", GatheredAt: now},
+		},
+		{
+			name: "bare metal",
+			output: `os_family=Linux
+virtualization=none
+vendor=Dell Inc.
+product=PowerEdge R650
+`,
+			want: &Facts{Host: "web1", OSFamily: types.OSFamilyLinux, Virtualization: "physical", GatheredAt: now},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parse("web1", tt.output, now)
+			if err != nil {
+				t.Fatalf("parse() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parse("web1", "kernel=6.8.0\n", now); err == nil {
+		t.Error("parse() without an OS family succeeded")
+	}
+}
+
+func TestDistroFamily(t *testing.T) {
+	tests := []struct {
+		id   string
+		like []string
+		want string
+	}{
+		{id: "debian", want: types.DistroDebian},
+		{id: "rocky", like: []string{"rhel", "centos", "fedora"}, want: types.DistroRedHat},
+		{id: "opensuse-leap", like: []string{"suse", "opensuse"}, want: types.DistroSUSE},
+		{id: "opensuse-tumbleweed", want: types.DistroSUSE},
+		{id: "gentoo", want: "gentoo"},
+	}
+	for _, tt := range tests {
+		if got := DistroFamily(tt.id, tt.like); got != tt.want {
+			t.Errorf("DistroFamily(%s, %v) = %s, want %s", tt.id, tt.like, got, tt.want)
+		}
+	}
+}
+
+func TestFacts_Map(t *testing.T) {
+	facts := &Facts{Host: "web1", OSFamily: types.OSFamilyLinux, CPUs: 2, IPAddresses: []string{"10.0.0.5", "10.0.1.5"}}
+	values := facts.Map()
+	if values["primary_ip"] != "10.0.0.5" || values["cpus"] != 2 || values["os_family"] != types.OSFamilyLinux {
+		t.Errorf("Map() = %v", values)
+	}
+	values["ip_addresses"].([]string)[0] = "changed"
+	if facts.IPAddresses[0] != "10.0.0.5" {
+		t.Error("Map() shares the address list")
+	}
+
+	var missing *Facts
+	if values := missing.Map(); values["distro_family"] != "" || values["primary_ip"] != "" {
+		t.Errorf("nil Map() = %v", values)
+	}
+}
+
+func TestFacts_Labels(t *testing.T) {
+	facts := &Facts{
+		OSFamily: types.OSFamilyLinux, Distribution: "rocky", DistroFamily: types.DistroRedHat,
+		Architecture: "x86_64", Virtualization: "kvm", Cloud: CloudAWS, Datacenter: "eu-west-1a",
+	}
+	want := map[string]string{
+		"os": "linux", "os_family": "redhat", "distribution": "rocky", "arch": "x86_64",
+		"virtualization": "kvm", "cloud": "aws", "datacenter": "eu-west-1a",
+	}
+	if got := facts.Labels(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Labels() = %v, want %v", got, want)
+	}
+
+	macOS := &Facts{OSFamily: types.OSFamilyDarwin, Architecture: "arm64"}
+	if got := macOS.Labels(); !reflect.DeepEqual(got, map[string]string{"os": "darwin", "os_family": "darwin", "arch": "arm64"}) {
+		t.Errorf("Labels() = %v", got)
+	}
+
+	var missing *Facts
+	if got := missing.Labels(); len(got) != 0 {
+		t.Errorf("nil Labels() = %v", got)
+	}
+}
+
+func TestGather_Local(t *testing.T) {
+	if runtime.GOOS != "linux" && runtime.GOOS != "darwin" {
+		t.Skip("needs a POSIX shell")
+	}
+	facts, err := Gather(context.Background(), &ssh.LocalExecutor{}, "localhost")
+	if err != nil {
+		t.Fatalf("Gather() error = %v", err)
+	}
+	if facts.OSFamily != runtime.GOOS {
+		t.Errorf("OSFamily = %s, want %s", facts.OSFamily, runtime.GOOS)
+	}
+	if facts.CPUs < 1 || facts.MemoryMB < 1 || facts.Architecture == "" || facts.Kernel == "" {
+		t.Errorf("Gather() = %+v", facts)
+	}
+}
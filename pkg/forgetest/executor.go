@@ -0,0 +1,157 @@
+// Package forgetest lets module authors unit test modules without servers:
+// providers run against a MockExecutor that answers commands from scripted
+// fixtures instead of a host.
+package forgetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// Result is what a scripted command prints and exits with
+type Result struct {
+	Stdout   string `yaml:"stdout"`
+	Stderr   string `yaml:"stderr"`
+	ExitCode int    `yaml:"exit_code"`
+}
+
+// Command scripts the result of the commands it matches
+type Command struct {
+	// Match is the exact command; Pattern is a regular expression
+	Match   string `yaml:"match"`
+	Pattern string `yaml:"pattern"`
+	Result  `yaml:",inline"`
+	// Times limits how often the command answers, so a check can report a
+	// package missing before apply and installed after; 0 is unlimited
+	Times int `yaml:"times"`
+
+	re   *regexp.Regexp
+	used int
+}
+
+// compile checks a command and prepares its pattern
+func (c *Command) compile() error {
+	switch {
+	case c.Match != "" && c.Pattern != "":
+		return fmt.Errorf("command has both match and pattern")
+	case c.Match == "" && c.Pattern == "":
+		return fmt.Errorf("command needs match or pattern")
+	case c.Pattern != "":
+		re, err := regexp.Compile(c.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid pattern %q: %w", c.Pattern, err)
+		}
+		c.re = re
+	}
+	return nil
+}
+
+// matches reports whether the command answers a command line
+func (c *Command) matches(command string) bool {
+	if c.Times > 0 && c.used >= c.Times {
+		return false
+	}
+	if c.re != nil {
+		return c.re.MatchString(command)
+	}
+	return c.Match == command
+}
+
+// MockExecutor is an ssh.MockExecutor that answers commands from scripted
+// fixtures and records every command it is asked to run
+type MockExecutor struct {
+	*ssh.MockExecutor
+	commands  []*Command
+	fallback  Result
+	strict    bool
+	mu        sync.Mutex
+	calls     []string
+	unmatched []string
+}
+
+// NewMockExecutor creates an executor that answers with the first command
+// that matches. Commands nothing matches get an empty, successful result,
+// or fail when strict is set.
+func NewMockExecutor(commands []Command, strict bool) (*MockExecutor, error) {
+	m := &MockExecutor{MockExecutor: ssh.NewMockExecutor(), strict: strict}
+	if err := m.SetCommands(commands); err != nil {
+		return nil, err
+	}
+	m.SetResponder(m.answer)
+	return m, nil
+}
+
+// SetCommands replaces the scripted commands, as when the host changed
+func (m *MockExecutor) SetCommands(commands []Command) error {
+	scripted := make([]*Command, 0, len(commands))
+	for i := range commands {
+		command := commands[i]
+		if err := command.compile(); err != nil {
+			return fmt.Errorf("command %d: %w", i+1, err)
+		}
+		scripted = append(scripted, &command)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.commands = scripted
+	return nil
+}
+
+// SetDefault sets the result of commands nothing matches
+func (m *MockExecutor) SetDefault(result Result) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.fallback = result
+}
+
+// answer answers a command from the fixtures
+func (m *MockExecutor) answer(command string) (*ssh.ExecuteResult, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.calls = append(m.calls, command)
+
+	for _, scripted := range m.commands {
+		if scripted.matches(command) {
+			scripted.used++
+			return result(command, scripted.Result), nil
+		}
+	}
+	m.unmatched = append(m.unmatched, command)
+	if m.strict {
+		return nil, fmt.Errorf("no fixture for command %q", command)
+	}
+	return result(command, m.fallback), nil
+}
+
+// ExecuteWithInput answers a command from the fixtures, discarding its input
+func (m *MockExecutor) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ssh.ExecuteResult, error) {
+	return m.Execute(ctx, command)
+}
+
+// Commands returns the commands run so far, in order
+func (m *MockExecutor) Commands() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.calls...)
+}
+
+// Unmatched returns the commands no fixture answered
+func (m *MockExecutor) Unmatched() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]string(nil), m.unmatched...)
+}
+
+func result(command string, r Result) *ssh.ExecuteResult {
+	return &ssh.ExecuteResult{Command: command, Stdout: r.Stdout, Stderr: r.Stderr, ExitCode: r.ExitCode}
+}
+
+var (
+	_ ssh.Executor      = (*MockExecutor)(nil)
+	_ ssh.InputExecutor = (*MockExecutor)(nil)
+)
@@ -0,0 +1,326 @@
+package forgetest
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// FixtureSuffix marks the fixture files found when a directory is tested
+const FixtureSuffix = ".test.yaml"
+
+// Fixture scripts the commands a module's providers run and states what
+// planning and applying the module against them must do
+type Fixture struct {
+	Name string `yaml:"name"`
+	// Module is the module file, relative to the fixture file
+	Module string `yaml:"module"`
+	// Vars override the module's variables, as --var does
+	Vars map[string]interface{} `yaml:"vars"`
+	// PackageManager is the package manager the scripted host uses: apt
+	// (the default), dnf, yum, zypper, apk, pacman or brew
+	PackageManager string `yaml:"package_manager"`
+	// InitSystem is the init system the scripted host runs: systemd (the
+	// default), openrc, sysvinit or launchd
+	InitSystem string    `yaml:"init_system"`
+	Commands   []Command `yaml:"commands"`
+	// Default is the result of commands nothing matches; with Strict they
+	// fail instead
+	Default Result `yaml:"default"`
+	Strict  bool   `yaml:"strict"`
+	Expect  Expect `yaml:"expect"`
+
+	path string
+}
+
+// Expect states what a fixture must observe
+type Expect struct {
+	// Plan maps resource IDs such as pkg.nginx to the planned action:
+	// create, update, delete, no-op, or error when validation or diffing
+	// fails. Resources left out are not checked.
+	Plan map[string]string `yaml:"plan"`
+	// Apply is succeeded or failed; the plan is not applied when empty
+	Apply string `yaml:"apply"`
+	// Commands are patterns that some command run must match
+	Commands []string `yaml:"commands"`
+	// NotCommands are patterns that no command run may match
+	NotCommands []string `yaml:"not_commands"`
+}
+
+// Apply expectations
+const (
+	ApplySucceeded = "succeeded"
+	ApplyFailed    = "failed"
+)
+
+// actionError is the planned action of a resource whose plan failed
+const actionError = "error"
+
+// LoadFixture reads a fixture file
+func LoadFixture(path string) (*Fixture, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read fixture: %w", err)
+	}
+	var fixture Fixture
+	if err := yaml.Unmarshal(data, &fixture); err != nil {
+		return nil, fmt.Errorf("failed to parse fixture %s: %w", path, err)
+	}
+	fixture.path = path
+	if fixture.Name == "" {
+		fixture.Name = strings.TrimSuffix(filepath.Base(path), FixtureSuffix)
+	}
+	if err := fixture.validate(); err != nil {
+		return nil, fmt.Errorf("invalid fixture %s: %w", path, err)
+	}
+	return &fixture, nil
+}
+
+// FindFixtures expands directories to the fixture files below them, sorted
+func FindFixtures(paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to find fixtures: %w", err)
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+		var found []string
+		err = filepath.WalkDir(path, func(file string, entry os.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !entry.IsDir() && strings.HasSuffix(file, FixtureSuffix) {
+				found = append(found, file)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to find fixtures: %w", err)
+		}
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+	return files, nil
+}
+
+// validate checks a fixture before it runs
+func (f *Fixture) validate() error {
+	if f.Module == "" {
+		return fmt.Errorf("module is required")
+	}
+	for id, action := range f.Expect.Plan {
+		switch action {
+		case "create", "update", "delete", "no-op", actionError:
+		default:
+			return fmt.Errorf("unknown action %q for %s", action, id)
+		}
+	}
+	switch f.Expect.Apply {
+	case "", ApplySucceeded, ApplyFailed:
+	default:
+		return fmt.Errorf("apply must be %s or %s, got %q", ApplySucceeded, ApplyFailed, f.Expect.Apply)
+	}
+	for _, pattern := range append(append([]string(nil), f.Expect.Commands...), f.Expect.NotCommands...) {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid command pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// ModulePath returns the module file the fixture tests
+func (f *Fixture) ModulePath() string {
+	if filepath.IsAbs(f.Module) || f.path == "" {
+		return f.Module
+	}
+	return filepath.Join(filepath.Dir(f.path), f.Module)
+}
+
+// Report is the outcome of running a fixture
+type Report struct {
+	Name     string
+	Plan     *core.Plan
+	Result   *core.ExecutionResult
+	Commands []string
+	// Failures are the expectations that did not hold
+	Failures []string
+}
+
+// Passed reports whether every expectation held
+func (r *Report) Passed() bool {
+	return len(r.Failures) == 0
+}
+
+func (r *Report) failf(format string, args ...interface{}) {
+	r.Failures = append(r.Failures, fmt.Sprintf(format, args...))
+}
+
+// Run plans the fixture's module against its scripted commands, applies the
+// plan when the fixture expects an apply outcome, and checks the
+// expectations. Errors are problems running the fixture, not failed
+// expectations.
+func Run(ctx context.Context, fixture *Fixture, factories *providers.FactoryRegistry) (*Report, error) {
+	if factories == nil {
+		factories = providers.DefaultFactoryRegistry()
+	}
+	module, err := core.LoadModuleFromFile(fixture.ModulePath())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module: %w", err)
+	}
+	if err := module.ResolveVars(fixture.Vars); err != nil {
+		return nil, fmt.Errorf("failed to resolve module variables: %w", err)
+	}
+	mock, err := NewMockExecutor(fixture.Commands, fixture.Strict)
+	if err != nil {
+		return nil, err
+	}
+	mock.SetDefault(fixture.Default)
+	if err := mock.Connect(ctx); err != nil {
+		return nil, err
+	}
+	defer mock.Close()
+	registry, err := factories.NewRegistry(mock)
+	if err != nil {
+		return nil, err
+	}
+	packageManager := fixture.PackageManager
+	if packageManager == "" {
+		packageManager = providers.DefaultPackageManager
+	}
+	if err := providers.UsePackageManager(registry, packageManager); err != nil {
+		return nil, err
+	}
+	initSystem := fixture.InitSystem
+	if initSystem == "" {
+		initSystem = providers.DefaultInitSystem
+	}
+	if err := providers.UseInitSystem(registry, initSystem); err != nil {
+		return nil, err
+	}
+
+	report := &Report{Name: fixture.Name}
+	report.Plan, err = core.NewPlanner(registry).CreatePlan(module)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create plan: %w", err)
+	}
+	checkPlan(report, fixture.Expect.Plan)
+
+	if fixture.Expect.Apply != "" {
+		checkApply(ctx, report, fixture.Expect.Apply, registry)
+	}
+
+	report.Commands = mock.Commands()
+	checkCommands(report, fixture.Expect)
+	if fixture.Strict {
+		for _, command := range mock.Unmatched() {
+			report.failf("no fixture for command %q", command)
+		}
+	}
+	return report, nil
+}
+
+// checkPlan compares the planned actions with the expected ones
+func checkPlan(report *Report, expected map[string]string) {
+	planned := make(map[string]core.Change)
+	for _, change := range report.Plan.Changes {
+		planned[change.Resource.ResourceID()] = change
+	}
+	ids := make([]string, 0, len(expected))
+	for id := range expected {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		change, ok := planned[id]
+		if !ok {
+			report.failf("plan: %s is not in the module", id)
+			continue
+		}
+		got := change.Action.String()
+		if change.Error != nil {
+			got = actionError
+		}
+		if got == expected[id] {
+			continue
+		}
+		if change.Error != nil {
+			report.failf("plan: %s: want %s, got error: %v", id, expected[id], change.Error)
+		} else {
+			report.failf("plan: %s: want %s, got %s", id, expected[id], got)
+		}
+	}
+}
+
+// checkApply applies the plan and compares the outcome with the expected one
+func checkApply(ctx context.Context, report *Report, expected string, registry *types.ProviderRegistry) {
+	if errors := report.Plan.Summary().Errors; errors > 0 {
+		report.failf("apply: the plan has %d error(s) and cannot be applied", errors)
+		return
+	}
+	result, err := executor.NewScheduler(0).Execute(ctx, report.Plan, registry)
+	report.Result = result
+
+	got := ApplySucceeded
+	var reason string
+	switch {
+	case err != nil:
+		got, reason = ApplyFailed, err.Error()
+	case result.Summary.Failed > 0:
+		got = ApplyFailed
+		for _, change := range result.Changes {
+			if !change.Success && change.Error != nil {
+				reason = fmt.Sprintf("%s: %v", change.Change.Resource.ResourceID(), change.Error)
+				break
+			}
+		}
+	}
+	if got == expected {
+		return
+	}
+	if reason != "" {
+		report.failf("apply: want %s, got %s: %s", expected, got, reason)
+	} else {
+		report.failf("apply: want %s, got %s", expected, got)
+	}
+}
+
+// checkCommands checks the commands run against the expected patterns
+func checkCommands(report *Report, expect Expect) {
+	for _, pattern := range expect.Commands {
+		re := regexp.MustCompile(pattern)
+		found := false
+		for _, command := range report.Commands {
+			if re.MatchString(command) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			report.failf("commands: nothing run matches %q", pattern)
+		}
+	}
+	for _, pattern := range expect.NotCommands {
+		re := regexp.MustCompile(pattern)
+		for _, command := range report.Commands {
+			if re.MatchString(command) {
+				report.failf("commands: %q must not run, it matches %q", command, pattern)
+				break
+			}
+		}
+	}
+}
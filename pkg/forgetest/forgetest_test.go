@@ -0,0 +1,172 @@
+package forgetest
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMockExecutor(t *testing.T) {
+	mock, err := NewMockExecutor([]Command{
+		{Match: "systemctl is-active nginx", Result: Result{Stdout: "inactive\n", ExitCode: 3}, Times: 1},
+		{Match: "systemctl is-active nginx", Result: Result{Stdout: "active\n"}},
+		{Pattern: `^cat /etc/`, Result: Result{Stdout: "config"}},
+	}, false)
+	if err != nil {
+		t.Fatalf("NewMockExecutor: %v", err)
+	}
+	ctx := context.Background()
+	if _, err := mock.Execute(ctx, "true"); err == nil {
+		t.Error("expected an error before Connect")
+	}
+	mock.Connect(ctx)
+	mock.SetDefault(Result{ExitCode: 1})
+
+	tests := []struct {
+		command  string
+		stdout   string
+		exitCode int
+	}{
+		{command: "systemctl is-active nginx", stdout: "inactive\n", exitCode: 3},
+		{command: "systemctl is-active nginx", stdout: "active\n"},
+		{command: "systemctl is-active nginx", stdout: "active\n"},
+		{command: "cat /etc/hosts", stdout: "config"},
+		{command: "uname", exitCode: 1},
+	}
+	for _, tt := range tests {
+		result, err := mock.Execute(ctx, tt.command)
+		if err != nil {
+			t.Fatalf("Execute(%q): %v", tt.command, err)
+		}
+		if result.Stdout != tt.stdout || result.ExitCode != tt.exitCode {
+			t.Errorf("Execute(%q) = %q, %d, want %q, %d", tt.command, result.Stdout, result.ExitCode, tt.stdout, tt.exitCode)
+		}
+	}
+
+	if got := mock.Commands(); len(got) != len(tests) {
+		t.Errorf("Commands = %v, want every command recorded", got)
+	}
+	if got := mock.Unmatched(); len(got) != 1 || got[0] != "uname" {
+		t.Errorf("Unmatched = %v, want [uname]", got)
+	}
+}
+
+func TestMockExecutor_Strict(t *testing.T) {
+	mock, err := NewMockExecutor(nil, true)
+	if err != nil {
+		t.Fatalf("NewMockExecutor: %v", err)
+	}
+	mock.Connect(context.Background())
+	if _, err := mock.Execute(context.Background(), "uname"); err == nil {
+		t.Error("expected a strict executor to fail unmatched commands")
+	}
+}
+
+func TestNewMockExecutor_Invalid(t *testing.T) {
+	tests := []Command{
+		{},
+		{Match: "a", Pattern: "a"},
+		{Pattern: "("},
+	}
+	for _, command := range tests {
+		if _, err := NewMockExecutor([]Command{command}, false); err == nil {
+			t.Errorf("NewMockExecutor(%+v) succeeded, want an error", command)
+		}
+	}
+}
+
+func TestRun(t *testing.T) {
+	files, err := FindFixtures([]string{"testdata"})
+	if err != nil {
+		t.Fatalf("FindFixtures: %v", err)
+	}
+	if len(files) != 2 {
+		t.Fatalf("FindFixtures = %v, want the two fixtures", files)
+	}
+	for _, file := range files {
+		fixture, err := LoadFixture(file)
+		if err != nil {
+			t.Fatalf("LoadFixture: %v", err)
+		}
+		t.Run(fixture.Name, func(t *testing.T) {
+			report, err := Run(context.Background(), fixture, nil)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			if !report.Passed() {
+				t.Errorf("failures: %v\ncommands: %v", report.Failures, report.Commands)
+			}
+		})
+	}
+}
+
+func TestRun_Failures(t *testing.T) {
+	module, _ := filepath.Abs("testdata/web.yaml")
+	tests := []struct {
+		name    string
+		fixture Fixture
+		want    []string
+	}{
+		{
+			name: "wrong plan",
+			fixture: Fixture{Module: module, Default: Result{Stdout: "1\n"}, Expect: Expect{
+				Plan: map[string]string{"pkg.nginx": "create", "pkg.apache": "create"},
+			}},
+			want: []string{"pkg.apache is not in the module", "pkg.nginx: want create, got no-op"},
+		},
+		{
+			name: "failed install",
+			fixture: Fixture{
+				Module:   module,
+				Commands: []Command{{Pattern: "install", Result: Result{Stderr: "E: Unable to locate package", ExitCode: 100}}},
+				Expect:   Expect{Apply: ApplySucceeded},
+			},
+			want: []string{"apply: want succeeded, got failed"},
+		},
+		{
+			name:    "commands",
+			fixture: Fixture{Module: module, Default: Result{Stdout: "1\n"}, Expect: Expect{Commands: []string{"apt-get"}, NotCommands: []string{"dpkg"}}},
+			want:    []string{`nothing run matches "apt-get"`, `must not run, it matches "dpkg"`},
+		},
+		{
+			name:    "strict",
+			fixture: Fixture{Module: module, Strict: true},
+			want:    []string{"no fixture for command"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := Run(context.Background(), &tt.fixture, nil)
+			if err != nil {
+				t.Fatalf("Run: %v", err)
+			}
+			failures := strings.Join(report.Failures, "\n")
+			for _, want := range tt.want {
+				if !strings.Contains(failures, want) {
+					t.Errorf("failures = %q, want %q", failures, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFixture_Invalid(t *testing.T) {
+	tests := map[string]string{
+		"no module":      "name: x\n",
+		"unknown action": "module: web.yaml\nexpect:\n  plan:\n    pkg.nginx: install\n",
+		"unknown apply":  "module: web.yaml\nexpect:\n  apply: ok\n",
+		"bad pattern":    "module: web.yaml\nexpect:\n  commands: ['(']\n",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "x"+FixtureSuffix)
+			os.WriteFile(path, []byte(content), 0644)
+			if _, err := LoadFixture(path); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
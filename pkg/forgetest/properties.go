@@ -0,0 +1,314 @@
+package forgetest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// propertyTimeout bounds each provider call, so a provider that waits or
+// retries against the mock cannot hang the test
+const propertyTimeout = 10 * time.Second
+
+// PropertyCase is a resource a provider is checked with. Before scripts the
+// host before the change; After, when set, scripts it once the change is
+// applied, so the test can check that the provider converges.
+type PropertyCase struct {
+	Name     string
+	Resource types.Resource
+	Before   []Command
+	After    []Command
+}
+
+// CheckProvider asserts the invariants every provider must keep, against
+// fresh providers from factory bound to a MockExecutor:
+//
+//   - Validate accepts every case, and whatever Validate accepts, even with
+//     a property removed or of another type, Read, Diff and Apply handle
+//     without panicking
+//   - Diff is stable: the same resource and state give the same diff, and
+//     Diff leaves both unchanged
+//   - Apply then Read converges: against the After script, Diff finds
+//     nothing left to do
+func CheckProvider(t *testing.T, factory providers.Factory, cases []PropertyCase) {
+	t.Helper()
+	if len(cases) == 0 {
+		t.Fatal("no property cases given")
+	}
+	for _, c := range cases {
+		c := c
+		t.Run(c.Name, func(t *testing.T) {
+			for _, failure := range CheckCase(factory, c) {
+				t.Error(failure)
+			}
+		})
+	}
+}
+
+// CheckProviders runs CheckProvider for every type registered in factories.
+// Every type needs cases, so new providers cannot go unchecked.
+func CheckProviders(t *testing.T, factories *providers.FactoryRegistry, cases map[string][]PropertyCase) {
+	t.Helper()
+	for _, resourceType := range factories.Types() {
+		factory, _ := factories.Factory(resourceType)
+		t.Run(resourceType, func(t *testing.T) {
+			if len(cases[resourceType]) == 0 {
+				t.Fatalf("no property cases for provider %s", resourceType)
+			}
+			CheckProvider(t, factory, cases[resourceType])
+		})
+	}
+}
+
+// CheckCase checks the invariants of CheckProvider for one case and
+// returns the ones that do not hold
+func CheckCase(factory providers.Factory, c PropertyCase) []string {
+	provider, _, err := newProvider(factory, c.Before)
+	if err != nil {
+		return []string{err.Error()}
+	}
+	resource := copyResource(c.Resource)
+	if err := provider.Validate(&resource); err != nil {
+		return []string{fmt.Sprintf("Validate rejects the case: %v", err)}
+	}
+
+	var failures []string
+	for _, check := range []func(providers.Factory, PropertyCase) ([]string, error){checkStableDiff, checkConverges, checkMutations} {
+		found, err := guard(func() ([]string, error) { return check(factory, c) })
+		if err != nil {
+			failures = append(failures, err.Error())
+		}
+		failures = append(failures, found...)
+	}
+	return failures
+}
+
+// guard turns a panic in a check into an error
+func guard(check func() ([]string, error)) (failures []string, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return check()
+}
+
+// newProvider creates a provider bound to a connected mock scripted with commands
+func newProvider(factory providers.Factory, commands []Command) (types.Provider, *MockExecutor, error) {
+	mock, err := NewMockExecutor(commands, false)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid script: %w", err)
+	}
+	mock.Connect(context.Background())
+	provider := factory(mock)
+	if provider == nil {
+		return nil, nil, fmt.Errorf("factory returned no provider")
+	}
+	return provider, mock, nil
+}
+
+// checkStableDiff diffs the state read twice and compares the results
+func checkStableDiff(factory providers.Factory, c PropertyCase) ([]string, error) {
+	provider, _, err := newProvider(factory, c.Before)
+	if err != nil {
+		return nil, err
+	}
+	resource := copyResource(c.Resource)
+	ctx, cancel := context.WithTimeout(context.Background(), propertyTimeout)
+	defer cancel()
+
+	state, err := provider.Read(ctx, &resource)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	wantResource := copyResource(resource)
+	wantState := copyValue(state)
+
+	var failures []string
+	first, firstErr := provider.Diff(ctx, &resource, state)
+	second, secondErr := provider.Diff(ctx, &resource, state)
+	if fmt.Sprint(firstErr) != fmt.Sprint(secondErr) || !reflect.DeepEqual(first, second) {
+		failures = append(failures, fmt.Sprintf("Diff is not stable: %+v, %v then %+v, %v", first, firstErr, second, secondErr))
+	}
+	if !reflect.DeepEqual(resource, wantResource) {
+		failures = append(failures, fmt.Sprintf("Diff changed the resource: %+v was %+v", resource, wantResource))
+	}
+	if !reflect.DeepEqual(state, wantState) {
+		failures = append(failures, fmt.Sprintf("Diff changed the state: %v was %v", state, wantState))
+	}
+	return failures, nil
+}
+
+// checkConverges applies the case and checks nothing is left to do after,
+// when the case scripts the host after the change
+func checkConverges(factory providers.Factory, c PropertyCase) ([]string, error) {
+	if c.After == nil {
+		return nil, nil
+	}
+	provider, mock, err := newProvider(factory, c.Before)
+	if err != nil {
+		return nil, err
+	}
+	resource := copyResource(c.Resource)
+	ctx, cancel := context.WithTimeout(context.Background(), propertyTimeout)
+	defer cancel()
+
+	state, err := provider.Read(ctx, &resource)
+	if err != nil {
+		return nil, fmt.Errorf("Read: %w", err)
+	}
+	diff, err := provider.Diff(ctx, &resource, state)
+	if err != nil {
+		return nil, fmt.Errorf("Diff: %w", err)
+	}
+	if pending(diff) {
+		if err := provider.Apply(ctx, &resource, diff); err != nil {
+			return nil, fmt.Errorf("Apply: %w (commands: %q)", err, mock.Commands())
+		}
+	}
+
+	if err := mock.SetCommands(c.After); err != nil {
+		return nil, fmt.Errorf("invalid script: %w", err)
+	}
+	state, err = provider.Read(ctx, &resource)
+	if err != nil {
+		return nil, fmt.Errorf("Read after Apply: %w", err)
+	}
+	diff, err = provider.Diff(ctx, &resource, state)
+	if err != nil {
+		return nil, fmt.Errorf("Diff after Apply: %w", err)
+	}
+	if pending(diff) {
+		return []string{fmt.Sprintf("after Apply, Diff still wants to %s: %s %v", diff.Action, diff.Reason, diff.Changes)}, nil
+	}
+	return nil, nil
+}
+
+// pending reports whether a diff leaves anything to do
+func pending(diff *types.ResourceDiff) bool {
+	return diff != nil && diff.Action != types.ActionNoop && diff.Action != ""
+}
+
+// mutations are what a property is replaced with to probe Validate
+var mutations = []struct {
+	name  string
+	value interface{}
+}{
+	{"removed", nil},
+	{"an empty string", ""},
+	{"a number", 42},
+	{"a boolean", true},
+	{"a list", []interface{}{"x"}},
+	{"a map", map[string]interface{}{"x": "y"}},
+}
+
+// checkMutations removes each property or changes its type, and checks that
+// whatever Validate accepts the rest of the provider copes with
+func checkMutations(factory providers.Factory, c PropertyCase) ([]string, error) {
+	keys := make([]string, 0, len(c.Resource.Properties))
+	for key := range c.Resource.Properties {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var failures []string
+	for _, key := range keys {
+		for _, mutation := range mutations {
+			resource := copyResource(c.Resource)
+			if mutation.value == nil {
+				delete(resource.Properties, key)
+			} else {
+				if reflect.TypeOf(mutation.value) == reflect.TypeOf(resource.Properties[key]) {
+					continue
+				}
+				resource.Properties[key] = copyValue(mutation.value)
+			}
+
+			provider, _, err := newProvider(factory, c.Before)
+			if err != nil {
+				return nil, err
+			}
+			if err := provider.Validate(&resource); err != nil {
+				continue
+			}
+			if stage, panicked := exercise(provider, &resource); panicked != nil {
+				failures = append(failures, fmt.Sprintf("Validate accepts %s as %s, but %s panics: %v", key, mutation.name, stage, panicked))
+			}
+		}
+	}
+	return failures, nil
+}
+
+// exercise reads, diffs and applies a resource, returning the stage that
+// panicked and its value
+func exercise(provider types.Provider, resource *types.Resource) (stage string, panicked interface{}) {
+	defer func() {
+		if r := recover(); r != nil {
+			panicked = r
+		}
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), propertyTimeout)
+	defer cancel()
+
+	stage = "Read"
+	state, err := provider.Read(ctx, resource)
+	if err != nil {
+		return "", nil
+	}
+	stage = "Diff"
+	diff, err := provider.Diff(ctx, resource, state)
+	if err != nil || !pending(diff) {
+		return "", nil
+	}
+	stage = "Apply"
+	provider.Apply(ctx, resource, diff)
+	return "", nil
+}
+
+// copyResource copies a resource deeply enough that changes to the copy's
+// properties leave the original alone
+func copyResource(resource types.Resource) types.Resource {
+	copied := resource
+	if resource.Properties != nil {
+		copied.Properties = copyValue(resource.Properties).(map[string]interface{})
+	}
+	copied.DependsOn = append([]string(nil), resource.DependsOn...)
+	copied.Notify = append([]string(nil), resource.Notify...)
+	copied.Collect = append([]string(nil), resource.Collect...)
+	copied.Tags = append([]string(nil), resource.Tags...)
+	copied.Defaulted = append([]string(nil), resource.Defaulted...)
+	if resource.Export != nil {
+		export := *resource.Export
+		if export.Data != nil {
+			export.Data = copyValue(export.Data).(map[string]interface{})
+		}
+		copied.Export = &export
+	}
+	return copied
+}
+
+// copyValue deeply copies the maps and lists of a decoded value
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			copied[key] = copyValue(item)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, item := range v {
+			copied[i] = copyValue(item)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -0,0 +1,139 @@
+package forgetest
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/providers"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func resource(resourceType, name string, properties map[string]interface{}) types.Resource {
+	return types.Resource{Type: resourceType, Name: name, Properties: properties}
+}
+
+// TestProviderProperties checks every core provider; cases without After
+// scripts only check Validate and Diff
+func TestProviderProperties(t *testing.T) {
+	source := t.TempDir()
+	cases := map[string][]PropertyCase{
+		"file": {{
+			Name:     "content",
+			Resource: resource("file", "motd", map[string]interface{}{"path": "/etc/motd", "content": "hi\n", "mode": "0644", "owner": "root", "group": "root"}),
+			Before:   []Command{{Match: "test -f '/etc/motd'", Result: Result{ExitCode: 1}}},
+			After: []Command{
+				{Pattern: "^stat ", Result: Result{Stdout: "3:644:root:root\n"}},
+				{Match: "cat '/etc/motd'", Result: Result{Stdout: "hi\n"}},
+			},
+		}},
+		"file_edit": {{
+			Name:     "line",
+			Resource: resource("file_edit", "sshd", map[string]interface{}{"path": "/etc/ssh/sshd_config", "line": "PermitRootLogin no", "regexp": "^PermitRootLogin"}),
+			Before:   []Command{{Pattern: "cat '/etc/ssh/sshd_config'$", Result: Result{Stdout: "Port 22\nPermitRootLogin yes\n"}}},
+			After:    []Command{{Pattern: "cat '/etc/ssh/sshd_config'$", Result: Result{Stdout: "Port 22\nPermitRootLogin no\n"}}},
+		}},
+		"firewall": {{Name: "rules", Resource: resource("firewall", "web", map[string]interface{}{"backend": "ufw", "rules": []interface{}{map[string]interface{}{"port": 443}}})}},
+		"pkg": {{
+			Name:     "present",
+			Resource: resource("pkg", "nginx", map[string]interface{}{"state": "present", "version": "1.18.0"}),
+			Before:   []Command{{Pattern: "^uname -s", Result: Result{Stdout: "Linux\ncommand:apt-get\n"}}},
+			After: []Command{
+				{Pattern: "^uname -s", Result: Result{Stdout: "Linux\ncommand:apt-get\n"}},
+				{Pattern: "^dpkg-query -W .* 'nginx'", Result: Result{Stdout: "1.18.0\n"}},
+			},
+		}},
+		"repo": {{Name: "apt", Resource: resource("repo", "nginx", map[string]interface{}{"state": "present", "manager": "apt", "uri": "http://nginx.org/packages/ubuntu", "suite": "jammy", "components": []interface{}{"nginx"}})}},
+		"service": {{
+			Name:     "running",
+			Resource: resource("service", "nginx", map[string]interface{}{"state": "running", "enabled": true}),
+			Before: []Command{
+				{Pattern: "^uname -s", Result: Result{Stdout: "Linux\ninit:systemd\n"}},
+				{Match: "systemctl is-active 'nginx'", Result: Result{Stdout: "inactive\n", ExitCode: 3}},
+				{Match: "systemctl is-enabled 'nginx'", Result: Result{Stdout: "disabled\n", ExitCode: 1}},
+			},
+			After: []Command{
+				{Pattern: "^uname -s", Result: Result{Stdout: "Linux\ninit:systemd\n"}},
+				{Match: "systemctl is-active 'nginx'", Result: Result{Stdout: "active\n"}},
+				{Match: "systemctl is-enabled 'nginx'", Result: Result{Stdout: "enabled\n"}},
+			},
+		}},
+		"shell": {{
+			Name:     "creates",
+			Resource: resource("shell", "init", map[string]interface{}{"command": "touch /tmp/done", "creates": "/tmp/done"}),
+			Before:   []Command{{Match: "test -e '/tmp/done'", Result: Result{ExitCode: 1}}},
+			After:    []Command{{Match: "test -e '/tmp/done'"}},
+		}},
+		"sync": {{Name: "directory", Resource: resource("sync", "site", map[string]interface{}{"path": "/var/www/site", "source": source})}},
+		"user": {{
+			Name:     "present",
+			Resource: resource("user", "deploy", map[string]interface{}{"state": "present", "uid": 1001, "home": "/home/deploy", "shell": "/bin/bash"}),
+			Before:   []Command{{Match: "id -u 'deploy' 2>/dev/null", Result: Result{ExitCode: 1}}},
+			After: []Command{
+				{Match: "id -u 'deploy' 2>/dev/null", Result: Result{Stdout: "1001\n"}},
+				{Match: "getent passwd 'deploy'", Result: Result{Stdout: "deploy:x:1001:1001::/home/deploy:/bin/bash\n"}},
+				{Match: "groups 'deploy'", Result: Result{Stdout: "deploy : deploy\n"}},
+			},
+		}},
+		"wait_for": {{Name: "port", Resource: resource("wait_for", "db", map[string]interface{}{"port": 5432, "host": "db.internal", "timeout": 1})}},
+	}
+	CheckProviders(t, providers.DefaultFactoryRegistry(), cases)
+}
+
+// buggyProvider breaks every invariant CheckProvider asserts
+type buggyProvider struct {
+	connection *MockExecutor
+	diffs      int
+}
+
+func (p *buggyProvider) Type() string { return "buggy" }
+
+func (p *buggyProvider) Validate(resource *types.Resource) error { return nil }
+
+func (p *buggyProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	result, err := p.connection.Execute(ctx, "cat /etc/motd")
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{"content": result.Stdout}, nil
+}
+
+func (p *buggyProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	p.diffs++
+	resource.Properties["diffed"] = p.diffs
+	if current["content"] == resource.Properties["content"].(string) {
+		return &types.ResourceDiff{Action: types.ActionNoop}, nil
+	}
+	return &types.ResourceDiff{Action: types.ActionUpdate, Reason: fmt.Sprintf("content differs (diff %d)", p.diffs)}, nil
+}
+
+func (p *buggyProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	return nil
+}
+
+func TestCheckCase(t *testing.T) {
+	factory := func(connection ssh.Executor) types.Provider {
+		return &buggyProvider{connection: connection.(*MockExecutor)}
+	}
+	c := PropertyCase{
+		Name:     "motd",
+		Resource: resource("buggy", "motd", map[string]interface{}{"content": "hi"}),
+		Before:   []Command{{Match: "cat /etc/motd", Result: Result{Stdout: "old"}}},
+		After:    []Command{{Match: "cat /etc/motd", Result: Result{Stdout: "still old"}}},
+	}
+
+	failures := strings.Join(CheckCase(factory, c), "\n")
+	for _, want := range []string{
+		"Diff is not stable",
+		"Diff changed the resource",
+		"after Apply, Diff still wants to update",
+		"Validate accepts content as removed, but Diff panics",
+		"Validate accepts content as a number, but Diff panics",
+	} {
+		if !strings.Contains(failures, want) {
+			t.Errorf("failures =\n%s\nwant %q", failures, want)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+// Package gitsource fetches modules named by git addresses, such as
+// git::https://example.com/infra.git//modules/web?ref=v1.4.0, into a cache
+// of checkouts that is brought up to date on every fetch.
+package gitsource
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Prefix marks a git address
+	Prefix = "git::"
+	// DefaultCacheDir is where repositories are checked out
+	DefaultCacheDir = ".chisel/git"
+	// ModuleFile is the module file looked up in a directory of a repository
+	ModuleFile = "module.yaml"
+)
+
+// refPattern is what a ref may look like, so it cannot be taken for an
+// option of git
+var refPattern = regexp.MustCompile(`^[A-Za-z0-9_.][A-Za-z0-9_./-]*$`)
+
+// commitPattern matches refs that name a commit by its hash
+var commitPattern = regexp.MustCompile(`^[0-9a-f]{7,40}$`)
+
+// Address names a module in a git repository
+type Address struct {
+	// URL is the repository, as git clone takes it
+	URL string
+	// Path is the module file, or the directory holding module.yaml, within
+	// the repository
+	Path string
+	// Ref is the branch, tag or commit checked out; empty for the default
+	// branch
+	Ref string
+	// Signed requires the tag or commit to carry a signature git trusts
+	Signed bool
+}
+
+// IsAddress reports whether a module argument is a git address
+func IsAddress(s string) bool {
+	return strings.HasPrefix(s, Prefix)
+}
+
+// IsRepository reports whether a source is the URL of a git repository as
+// git clone takes it, such as git@example.com:infra.git or
+// git+https://example.com/infra, rather than a git address
+func IsRepository(source string) bool {
+	return strings.HasPrefix(source, "git@") || strings.HasPrefix(source, "git://") ||
+		strings.HasPrefix(source, "git+") || strings.HasSuffix(source, ".git")
+}
+
+// ParseAddress parses git::<url>[//<path>][?ref=<ref>][&signed=true]
+func ParseAddress(s string) (*Address, error) {
+	rest, ok := strings.CutPrefix(s, Prefix)
+	if !ok {
+		return nil, fmt.Errorf("git address %q must start with %s", s, Prefix)
+	}
+	rest, query, _ := strings.Cut(rest, "?")
+
+	// The path follows the first // after the scheme's
+	start := 0
+	if i := strings.Index(rest, "://"); i >= 0 {
+		start = i + 3
+	}
+	address := &Address{URL: rest}
+	if i := strings.Index(rest[start:], "//"); i >= 0 {
+		address.URL = rest[:start+i]
+		address.Path = rest[start+i+2:]
+	}
+	if address.URL == "" {
+		return nil, fmt.Errorf("git address %q names no repository", s)
+	}
+	if strings.HasPrefix(address.URL, "-") {
+		return nil, fmt.Errorf("invalid repository %q in git address", address.URL)
+	}
+	if address.Path != "" {
+		address.Path = path.Clean(address.Path)
+		if path.IsAbs(address.Path) || address.Path == ".." || strings.HasPrefix(address.Path, "../") {
+			return nil, fmt.Errorf("path %q in git address %q leaves the repository", address.Path, s)
+		}
+	}
+
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, fmt.Errorf("invalid options in git address %q: %w", s, err)
+	}
+	for key, value := range values {
+		switch key {
+		case "ref":
+			address.Ref = value[0]
+			if !refPattern.MatchString(address.Ref) || strings.Contains(address.Ref, "..") {
+				return nil, fmt.Errorf("invalid ref %q in git address %q", address.Ref, s)
+			}
+		case "signed":
+			if address.Signed, err = parseBool(value[0]); err != nil {
+				return nil, fmt.Errorf("invalid signed option in git address %q: %w", s, err)
+			}
+		default:
+			return nil, fmt.Errorf("unknown option %s in git address %q, must be ref or signed", key, s)
+		}
+	}
+	return address, nil
+}
+
+// parseBool accepts true and false
+func parseBool(s string) (bool, error) {
+	switch s {
+	case "true", "1":
+		return true, nil
+	case "false", "0":
+		return false, nil
+	}
+	return false, fmt.Errorf("%q is not true or false", s)
+}
+
+// String returns the address as ParseAddress takes it
+func (a *Address) String() string {
+	s := Prefix + a.URL
+	if a.Path != "" {
+		s += "//" + a.Path
+	}
+	var options []string
+	if a.Ref != "" {
+		options = append(options, "ref="+a.Ref)
+	}
+	if a.Signed {
+		options = append(options, "signed=true")
+	}
+	if len(options) > 0 {
+		s += "?" + strings.Join(options, "&")
+	}
+	return s
+}
+
+// moduleFile returns the module file within the repository
+func (a *Address) moduleFile() string {
+	switch ext := path.Ext(a.Path); {
+	case a.Path == "" || a.Path == ".":
+		return ModuleFile
+	case ext == ".yaml" || ext == ".yml":
+		return a.Path
+	default:
+		return path.Join(a.Path, ModuleFile)
+	}
+}
+
+// Checkout is a module checked out from a git address
+type Checkout struct {
+	Address *Address
+	// File is the local path of the module file
+	File string
+	// Commit is the full hash of the commit checked out
+	Commit string
+}
+
+// Fetcher keeps a checkout of each repository it fetches from
+type Fetcher struct {
+	CacheDir string
+	// VerifySignatures requires every fetched ref to be signed, as if each
+	// address asked for it
+	VerifySignatures bool
+}
+
+// NewFetcher creates a fetcher with checkouts in a cache directory
+func NewFetcher(cacheDir string) *Fetcher {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir
+	}
+	return &Fetcher{CacheDir: cacheDir}
+}
+
+// dir returns where a repository is checked out
+func (f *Fetcher) dir(repository string) string {
+	sum := sha256.Sum256([]byte(repository))
+	return filepath.Join(f.CacheDir, hex.EncodeToString(sum[:])[:16])
+}
+
+// Fetch brings the checkout of an address up to date with its ref,
+// discarding local changes, and verifies what it checked out: a commit
+// ref must be the commit found, and signed refs must carry a good
+// signature.
+func (f *Fetcher) Fetch(ctx context.Context, address *Address) (*Checkout, error) {
+	dir := f.dir(address.URL)
+	if _, err := os.Stat(filepath.Join(dir, ".git")); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create %s: %w", dir, err)
+		}
+		if _, err := Git(ctx, dir, "init", "--quiet"); err != nil {
+			return nil, err
+		}
+		if _, err := Git(ctx, dir, "remote", "add", "origin", address.URL); err != nil {
+			return nil, err
+		}
+	} else if _, err := Git(ctx, dir, "remote", "set-url", "origin", address.URL); err != nil {
+		return nil, err
+	}
+
+	ref := address.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if _, err := Git(ctx, dir, "fetch", "--quiet", "--depth", "1", "--force", "origin", ref); err != nil {
+		if !commitPattern.MatchString(ref) {
+			return nil, fmt.Errorf("failed to fetch %s of %s: %w", ref, address.URL, err)
+		}
+		// Abbreviated hashes, and servers that do not serve commits by hash,
+		// need the whole history
+		args := []string{"fetch", "--quiet", "--force", "--tags", "origin", "+refs/heads/*:refs/remotes/origin/*"}
+		if shallow, _ := Git(ctx, dir, "rev-parse", "--is-shallow-repository"); shallow == "true" {
+			args = append(args, "--unshallow")
+		}
+		if _, err := Git(ctx, dir, args...); err != nil {
+			return nil, fmt.Errorf("failed to fetch %s: %w", address.URL, err)
+		}
+		if _, err := Git(ctx, dir, "update-ref", "FETCH_HEAD", ref+"^{commit}"); err != nil {
+			return nil, fmt.Errorf("commit %s is not in %s", ref, address.URL)
+		}
+	}
+	commit, err := Git(ctx, dir, "rev-parse", "FETCH_HEAD^{commit}")
+	if err != nil {
+		return nil, err
+	}
+	if commitPattern.MatchString(ref) && !strings.HasPrefix(commit, ref) {
+		return nil, fmt.Errorf("ref %s of %s is commit %s, not the commit it names", ref, address.URL, commit)
+	}
+
+	if address.Signed || f.VerifySignatures {
+		if err := verify(ctx, dir, commit); err != nil {
+			return nil, fmt.Errorf("%s of %s is not signed by a trusted key: %w", ref, address.URL, err)
+		}
+	}
+
+	if _, err := Git(ctx, dir, "checkout", "--quiet", "--force", "--detach", commit); err != nil {
+		return nil, err
+	}
+	if _, err := Git(ctx, dir, "clean", "--quiet", "-ffdx"); err != nil {
+		return nil, err
+	}
+
+	file := filepath.Join(dir, filepath.FromSlash(address.moduleFile()))
+	if _, err := os.Stat(file); err != nil {
+		return nil, fmt.Errorf("no module at %s in %s at %s", address.moduleFile(), address.URL, commit[:12])
+	}
+	return &Checkout{Address: address, File: file, Commit: commit}, nil
+}
+
+// verify checks the signature of the fetched tag, or of the commit when the
+// ref is not a signed tag
+func verify(ctx context.Context, dir, commit string) error {
+	if kind, err := Git(ctx, dir, "cat-file", "-t", "FETCH_HEAD"); err == nil && kind == "tag" {
+		if _, err := Git(ctx, dir, "verify-tag", "FETCH_HEAD"); err == nil {
+			return nil
+		}
+	}
+	_, err := Git(ctx, dir, "verify-commit", commit)
+	return err
+}
+
+// Git runs a git command in dir and returns its trimmed output. Git is
+// never let prompt for credentials, so a command fails rather than wait.
+func Git(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0")
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("git %s: %w: %s", args[0], err, message)
+		}
+		return "", fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,160 @@
+package gitsource
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		want    Address
+		wantErr string
+	}{
+		{address: "git::https://example.com/infra.git", want: Address{URL: "https://example.com/infra.git"}},
+		{address: "git::https://example.com/infra.git//modules/web?ref=v1.4.0", want: Address{URL: "https://example.com/infra.git", Path: "modules/web", Ref: "v1.4.0"}},
+		{address: "git::git@example.com:ops/infra.git//web/site.yaml?ref=main&signed=true", want: Address{URL: "git@example.com:ops/infra.git", Path: "web/site.yaml", Ref: "main", Signed: true}},
+		{address: "git::file:///srv/infra//modules/./web/?ref=0a1b2c3d", want: Address{URL: "file:///srv/infra", Path: "modules/web", Ref: "0a1b2c3d"}},
+		{address: "https://example.com/infra.git", wantErr: "must start with git::"},
+		{address: "git:://web", wantErr: "names no repository"},
+		{address: "git::--upload-pack=evil", wantErr: "invalid repository"},
+		{address: "git::https://example.com/infra.git//../etc", wantErr: "leaves the repository"},
+		{address: "git::https://example.com/infra.git?ref=--orphan", wantErr: "invalid ref"},
+		{address: "git::https://example.com/infra.git?ref=a..b", wantErr: "invalid ref"},
+		{address: "git::https://example.com/infra.git?signed=maybe", wantErr: "invalid signed option"},
+		{address: "git::https://example.com/infra.git?depth=1", wantErr: "unknown option depth"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			got, err := ParseAddress(tt.address)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ParseAddress error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseAddress: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("ParseAddress = %+v, want %+v", *got, tt.want)
+			}
+			if again, err := ParseAddress(got.String()); err != nil || *again != *got {
+				t.Errorf("ParseAddress(%s) = %+v, %v", got.String(), again, err)
+			}
+		})
+	}
+}
+
+// gitRepo creates a repository and returns its URL and a function that
+// runs git in it
+func gitRepo(t *testing.T) (string, func(args ...string) string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) string {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com", "-c", "commit.gpgsign=false", "-c", "tag.gpgsign=false"}, args...)...)
+		cmd.Dir = repo
+		output, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+		return strings.TrimSpace(string(output))
+	}
+	git("init", "-q", "-b", "main")
+	return "file://" + repo, func(args ...string) string {
+		if args[0] == "write" {
+			path := filepath.Join(repo, args[1])
+			os.MkdirAll(filepath.Dir(path), 0755)
+			if err := os.WriteFile(path, []byte(args[2]), 0644); err != nil {
+				t.Fatal(err)
+			}
+			git("add", args[1])
+			git("commit", "-q", "-m", args[1])
+			return git("rev-parse", "HEAD")
+		}
+		return git(args...)
+	}
+}
+
+func TestFetcher_Fetch(t *testing.T) {
+	url, repo := gitRepo(t)
+	first := repo("write", "modules/web/module.yaml", "version: 1.0.0\n")
+	repo("tag", "v1.0.0")
+	second := repo("write", "modules/web/module.yaml", "version: 1.1.0\n")
+	repo("write", "site.yml", "version: 2.0.0\n")
+
+	fetcher := NewFetcher(t.TempDir())
+	tests := []struct {
+		name       string
+		address    string
+		wantCommit string
+		wantModule string
+		wantErr    string
+	}{
+		{name: "tag", address: "git::" + url + "//modules/web?ref=v1.0.0", wantCommit: first, wantModule: "version: 1.0.0\n"},
+		{name: "branch", address: "git::" + url + "//modules/web?ref=main", wantModule: "version: 1.1.0\n"},
+		{name: "commit", address: "git::" + url + "//modules/web?ref=" + second[:12], wantCommit: second, wantModule: "version: 1.1.0\n"},
+		{name: "default branch and file", address: "git::" + url + "//site.yml", wantModule: "version: 2.0.0\n"},
+		{name: "back to the tag", address: "git::" + url + "//modules/web?ref=v1.0.0", wantCommit: first, wantModule: "version: 1.0.0\n"},
+		{name: "missing ref", address: "git::" + url + "?ref=v9.9.9", wantErr: "failed to fetch v9.9.9"},
+		{name: "missing commit", address: "git::" + url + "?ref=0123456789ab", wantErr: "commit 0123456789ab is not in"},
+		{name: "missing module", address: "git::" + url + "//modules/db?ref=main", wantErr: "no module at modules/db/module.yaml"},
+		{name: "unsigned", address: "git::" + url + "//modules/web?ref=v1.0.0&signed=true", wantErr: "is not signed by a trusted key"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			address, err := ParseAddress(tt.address)
+			if err != nil {
+				t.Fatal(err)
+			}
+			checkout, err := fetcher.Fetch(context.Background(), address)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("Fetch error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Fetch: %v", err)
+			}
+			if tt.wantCommit != "" && checkout.Commit != tt.wantCommit {
+				t.Errorf("Commit = %s, want %s", checkout.Commit, tt.wantCommit)
+			}
+			if len(checkout.Commit) != 40 {
+				t.Errorf("Commit = %q, want a full hash", checkout.Commit)
+			}
+			if data, err := os.ReadFile(checkout.File); err != nil || string(data) != tt.wantModule {
+				t.Errorf("module = %q, %v, want %q", data, err, tt.wantModule)
+			}
+		})
+	}
+
+	// Local changes to a checkout are discarded on the next fetch
+	address, _ := ParseAddress("git::" + url + "//modules/web?ref=main")
+	checkout, _ := fetcher.Fetch(context.Background(), address)
+	os.WriteFile(checkout.File, []byte("tampered\n"), 0644)
+	os.WriteFile(filepath.Join(filepath.Dir(checkout.File), "extra.yaml"), []byte("extra\n"), 0644)
+	if checkout, err := fetcher.Fetch(context.Background(), address); err != nil {
+		t.Fatalf("Fetch: %v", err)
+	} else if data, _ := os.ReadFile(checkout.File); string(data) != "version: 1.1.0\n" {
+		t.Errorf("module after a local change = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(checkout.File), "extra.yaml")); !os.IsNotExist(err) {
+		t.Errorf("untracked file kept after fetch: %v", err)
+	}
+
+	// A fetcher that verifies signatures refuses unsigned refs even when the
+	// address does not ask for it
+	fetcher.VerifySignatures = true
+	if _, err := fetcher.Fetch(context.Background(), address); err == nil || !strings.Contains(err.Error(), "not signed") {
+		t.Errorf("Fetch of an unsigned ref with VerifySignatures = %v", err)
+	}
+}
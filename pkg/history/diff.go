@@ -0,0 +1,147 @@
+package history
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/redact"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// maxValueLength limits how much of a changed value is recorded
+const maxValueLength = 120
+
+// Change is a change an execution made to a host
+type Change struct {
+	Time        time.Time `json:"time"`
+	Execution   string    `json:"execution"`
+	Module      string    `json:"module"`
+	TriggeredBy string    `json:"triggered_by,omitempty"`
+	Host        string    `json:"host"`
+	Resource    string    `json:"resource"`
+	Action      string    `json:"action"`
+	Handler     bool      `json:"handler,omitempty"`
+	// Values maps changed properties to their old and new values
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// ChangeFilter selects the changes returned by Diff; empty fields match everything
+type ChangeFilter struct {
+	Since  time.Time
+	Until  time.Time
+	Module string
+	Host   string
+}
+
+// Diff returns the changes executions actually made to hosts, oldest first.
+// Plans and failed or unchanged resources are left out.
+func Diff(executions []*Execution, filter ChangeFilter) []Change {
+	var changes []Change
+	for _, execution := range executions {
+		if filter.Module != "" && execution.Module != filter.Module {
+			continue
+		}
+		for _, span := range execution.Spans {
+			if span.Phase != PhaseApply || span.Resource == "" || span.Status != StatusSucceeded || span.Action == "no-op" {
+				continue
+			}
+			if filter.Host != "" && span.Host != filter.Host {
+				continue
+			}
+			if !filter.Since.IsZero() && span.Start.Before(filter.Since) {
+				continue
+			}
+			if !filter.Until.IsZero() && span.Start.After(filter.Until) {
+				continue
+			}
+			change := Change{
+				Time:        span.Start,
+				Execution:   execution.ID,
+				Module:      execution.Module,
+				TriggeredBy: execution.TriggeredBy,
+				Host:        span.Host,
+				Resource:    span.Resource,
+				Action:      span.Action,
+				Handler:     span.Handler,
+				Values:      span.Changes,
+			}
+			if span.Handler {
+				change.Action = "handler"
+			}
+			changes = append(changes, change)
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changes[i].Time.Before(changes[j].Time)
+	})
+	return changes
+}
+
+// ParseSince parses the start of a time window: a duration back from now
+// such as 7d, 12h or 30m, a date such as 2024-05-01, or an RFC 3339 time
+func ParseSince(value string, now time.Time) (time.Time, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return time.Time{}, fmt.Errorf("invalid number of days %q", value)
+		}
+		return now.AddDate(0, 0, -n), nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		if duration < 0 {
+			return time.Time{}, fmt.Errorf("invalid duration %q", value)
+		}
+		return now.Add(-duration), nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02", value, now.Location()); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("invalid time %q, use a duration such as 7d or 12h, a date or an RFC 3339 time", value)
+}
+
+// describeChanges formats the changed properties of a resource diff
+func describeChanges(diff *types.ResourceDiff) map[string]string {
+	if diff == nil || len(diff.Changes) == 0 {
+		return nil
+	}
+	redactor := redact.New()
+	changes := make(map[string]string, len(diff.Changes))
+	for _, key := range diff.ChangedKeys() {
+		value := redactor.Redact(formatValue(diff.Changes[key]))
+		// Properties with a sensitive name, such as password, are hidden whole
+		if probe := key + "=value"; redactor.Redact(probe) != probe {
+			value = redact.Placeholder
+		}
+		if runes := []rune(value); len(runes) > maxValueLength {
+			value = string(runes[:maxValueLength]) + "..."
+		}
+		changes[key] = value
+	}
+	return changes
+}
+
+// formatValue renders a property change, as "old -> new" for a transition
+func formatValue(value interface{}) string {
+	if transition, ok := value.(map[string]interface{}); ok {
+		from, hasFrom := transition["from"]
+		to, hasTo := transition["to"]
+		if hasFrom && hasTo && len(transition) == 2 {
+			return formatScalar(from) + " -> " + formatScalar(to)
+		}
+	}
+	return formatScalar(value)
+}
+
+// formatScalar renders a value on one line, quoting multi-line strings
+func formatScalar(value interface{}) string {
+	if text, ok := value.(string); ok && strings.ContainsAny(text, "\r\n") {
+		return strconv.Quote(text)
+	}
+	return fmt.Sprintf("%v", value)
+}
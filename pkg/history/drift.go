@@ -0,0 +1,71 @@
+package history
+
+import (
+	"sort"
+	"time"
+)
+
+// HostDrift is how far a host was from a module when an execution last
+// looked at it
+type HostDrift struct {
+	Host      string    `json:"host"`
+	Execution string    `json:"execution"`
+	CheckedAt time.Time `json:"checked_at"`
+	// Resources differ from the module: planned changes of a plan or dry
+	// run, or changes an apply failed to make
+	Resources []string `json:"resources,omitempty"`
+}
+
+// Drifted reports whether the host differs from the module
+func (d HostDrift) Drifted() bool {
+	return len(d.Resources) > 0
+}
+
+// Drift returns the drift of every host of a module from the most recent
+// execution that reached it, sorted by host. executions must be most
+// recent first, as List returns them.
+func Drift(executions []*Execution, module string) []HostDrift {
+	seen := make(map[string]bool)
+	var drift []HostDrift
+	for _, execution := range executions {
+		if execution.Module != module {
+			continue
+		}
+		applied := make(map[string]bool)
+		unreached := make(map[string]bool)
+		for _, span := range execution.Spans {
+			// Hosts skipped by the apply, such as after a failed batch,
+			// still have their plan
+			if span.Phase == PhaseApply && span.Status != StatusSkipped {
+				applied[span.Host] = true
+			}
+			if span.Status == StatusUnreachable {
+				unreached[span.Host] = true
+			}
+		}
+		for _, host := range execution.Hosts() {
+			if seen[host] || unreached[host] {
+				continue
+			}
+			seen[host] = true
+			hostDrift := HostDrift{Host: host, Execution: execution.ID, CheckedAt: execution.EndTime}
+			for _, span := range execution.Spans {
+				if span.Host != host || span.Resource == "" || span.Handler {
+					continue
+				}
+				if applied[host] {
+					if span.Phase == PhaseApply && span.Status == StatusFailed {
+						hostDrift.Resources = append(hostDrift.Resources, span.Resource)
+					}
+				} else if span.Phase == PhasePlan {
+					hostDrift.Resources = append(hostDrift.Resources, span.Resource)
+				}
+			}
+			drift = append(drift, hostDrift)
+		}
+	}
+	sort.Slice(drift, func(i, j int) bool {
+		return drift[i].Host < drift[j].Host
+	})
+	return drift
+}
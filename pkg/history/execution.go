@@ -0,0 +1,202 @@
+package history
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/snapshot"
+)
+
+// Phases of an execution
+const (
+	PhasePlan  = "plan"
+	PhaseApply = "apply"
+)
+
+// Span statuses, matching the host statuses of a run report
+const (
+	StatusSucceeded   = "succeeded"
+	StatusFailed      = "failed"
+	StatusSkipped     = "skipped"
+	StatusUnreachable = "unreachable"
+)
+
+// Execution records when each part of a run happened, so it can be
+// inspected after the fact
+type Execution struct {
+	ID          string `json:"id"`
+	Module      string `json:"module"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// ModuleSource is the git address the module was fetched from, and
+	// ModuleRevision the commit it was at
+	ModuleSource   string `json:"module_source,omitempty"`
+	ModuleRevision string `json:"module_revision,omitempty"`
+	// TriggeredBy names who started the execution, such as user@host
+	TriggeredBy string    `json:"triggered_by,omitempty"`
+	Status      string    `json:"status"`
+	StartTime   time.Time `json:"start_time"`
+	EndTime     time.Time `json:"end_time"`
+	Spans       []Span    `json:"spans"`
+	// Snapshots were taken of hosts before risky changes were applied
+	Snapshots []snapshot.Snapshot `json:"snapshots,omitempty"`
+}
+
+// Span is a timed unit of work: a host's plan or apply, or one resource
+// change within it
+type Span struct {
+	Host     string `json:"host"`
+	Phase    string `json:"phase"`
+	Batch    string `json:"batch,omitempty"`
+	Resource string `json:"resource,omitempty"`
+	Action   string `json:"action,omitempty"`
+	Handler  bool   `json:"handler,omitempty"`
+	Status   string `json:"status"`
+	Error    string `json:"error,omitempty"`
+	// Changes maps the properties a resource change set to their old and
+	// new values, with sensitive values redacted
+	Changes map[string]string `json:"changes,omitempty"`
+	Start   time.Time         `json:"start"`
+	End     time.Time         `json:"end"`
+}
+
+// Duration returns how long the span took
+func (s Span) Duration() time.Duration {
+	return s.End.Sub(s.Start)
+}
+
+// NewExecution starts recording an execution of a module
+func NewExecution(module, fingerprint string) *Execution {
+	now := time.Now()
+	return &Execution{
+		ID:          newExecutionID(now),
+		Module:      module,
+		Fingerprint: fingerprint,
+		StartTime:   now,
+		Spans:       make([]Span, 0),
+	}
+}
+
+// AddReport records a host phase from a run report. batches maps hosts to
+// the rollout batch they were applied in, if any.
+func (e *Execution) AddReport(phase string, report *executor.RunReport, batches map[string]string) {
+	for _, result := range report.Hosts {
+		start, end := result.StartTime, result.EndTime
+		if start.IsZero() {
+			// Skipped hosts never started; show them at the end of the phase
+			start, end = report.EndTime, report.EndTime
+		}
+		span := Span{
+			Host:   result.Host,
+			Phase:  phase,
+			Batch:  batches[result.Host],
+			Status: string(result.Status),
+			Start:  start,
+			End:    end,
+		}
+		if result.Error != nil {
+			span.Error = result.Error.Error()
+		}
+		e.Spans = append(e.Spans, span)
+		e.AddResult(result.Host, phase, batches[result.Host], result.Result)
+	}
+}
+
+// AddResult records the resource changes of a plan execution on a host
+func (e *Execution) AddResult(host, phase, batch string, result *core.ExecutionResult) {
+	if result == nil {
+		return
+	}
+	for _, change := range result.Changes {
+		span := Span{
+			Host:     host,
+			Phase:    phase,
+			Batch:    batch,
+			Resource: change.Change.Resource.ResourceID(),
+			Action:   change.Change.Action.String(),
+			Handler:  change.Handler != "",
+			Status:   StatusSucceeded,
+			Start:    change.StartTime,
+			End:      change.EndTime,
+		}
+		if change.Handler != "" {
+			span.Resource = change.Handler
+		} else {
+			span.Changes = describeChanges(change.Change.Diff)
+		}
+		if !change.Success {
+			span.Status = StatusFailed
+		}
+		if change.Error != nil {
+			span.Error = change.Error.Error()
+		}
+		e.Spans = append(e.Spans, span)
+	}
+}
+
+// AddPlan records the changes planned for a host at a time, leaving out
+// resources that are already as the module describes them
+func (e *Execution) AddPlan(host string, plan *core.Plan, at time.Time) {
+	for _, change := range plan.Changes {
+		if change.Action == core.ActionNoOp && change.Error == nil {
+			continue
+		}
+		span := Span{
+			Host:     host,
+			Phase:    PhasePlan,
+			Resource: change.Resource.ResourceID(),
+			Action:   change.Action.String(),
+			Status:   StatusSucceeded,
+			Changes:  describeChanges(change.Diff),
+			Start:    at,
+			End:      at,
+		}
+		if change.Error != nil {
+			span.Status = StatusFailed
+			span.Error = change.Error.Error()
+		}
+		e.Spans = append(e.Spans, span)
+	}
+}
+
+// AddSnapshot records a snapshot taken during the execution
+func (e *Execution) AddSnapshot(taken snapshot.Snapshot) {
+	e.Snapshots = append(e.Snapshots, taken)
+}
+
+// Finish records the outcome of the execution and orders its spans
+func (e *Execution) Finish(status string) {
+	e.Status = status
+	e.EndTime = time.Now()
+	for _, span := range e.Spans {
+		if span.End.After(e.EndTime) {
+			e.EndTime = span.End
+		}
+	}
+	sort.SliceStable(e.Spans, func(i, j int) bool {
+		return e.Spans[i].Start.Before(e.Spans[j].Start)
+	})
+}
+
+// Hosts returns the hosts in the execution in the order they started
+func (e *Execution) Hosts() []string {
+	seen := make(map[string]bool)
+	var hosts []string
+	for _, span := range e.Spans {
+		if !seen[span.Host] {
+			seen[span.Host] = true
+			hosts = append(hosts, span.Host)
+		}
+	}
+	return hosts
+}
+
+// newExecutionID returns a sortable unique ID such as "20240501T120000-1a2b3c4d"
+func newExecutionID(now time.Time) string {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+}
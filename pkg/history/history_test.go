@@ -0,0 +1,387 @@
+package history
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+var base = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func at(ms int) time.Time {
+	return base.Add(time.Duration(ms) * time.Millisecond)
+}
+
+func change(name string, start, end int, success bool) core.ChangeResult {
+	return core.ChangeResult{
+		Change:    core.Change{Action: core.ActionCreate, Resource: types.Resource{Type: "pkg", Name: name}},
+		Success:   success,
+		StartTime: at(start),
+		EndTime:   at(end),
+	}
+}
+
+// testExecution builds an execution with two hosts: web1 applies two
+// packages one after the other, web2 fails and db1 is skipped
+func testExecution() *Execution {
+	report := &executor.RunReport{
+		StartTime: at(0),
+		EndTime:   at(400),
+		Hosts: []executor.HostResult{
+			{
+				Host: "web1", Status: executor.HostSucceeded, StartTime: at(0), EndTime: at(300),
+				Result: &core.ExecutionResult{Changes: []core.ChangeResult{
+					change("nginx", 10, 200, true),
+					change("curl", 200, 290, true),
+					{Handler: "reload nginx", Success: true, StartTime: at(290), EndTime: at(300)},
+				}},
+			},
+			{
+				Host: "web2", Status: executor.HostFailed, StartTime: at(50), EndTime: at(400),
+				Error: errors.New("1 resource failed"),
+				Result: &core.ExecutionResult{Changes: []core.ChangeResult{
+					change("nginx", 60, 400, false),
+				}},
+			},
+			{Host: "db1", Status: executor.HostSkipped},
+		},
+	}
+
+	execution := &Execution{ID: "20240501T120000-00000001", Module: "web", StartTime: base}
+	execution.AddReport(PhaseApply, report, map[string]string{"web1": "web/1", "web2": "web/1"})
+	execution.Finish("failed")
+	return execution
+}
+
+func TestExecution_AddReport(t *testing.T) {
+	execution := testExecution()
+
+	if len(execution.Spans) != 7 {
+		t.Fatalf("Expected 7 spans, got %d", len(execution.Spans))
+	}
+	if hosts := execution.Hosts(); strings.Join(hosts, ",") != "web1,web2,db1" {
+		t.Errorf("Expected hosts in start order, got %v", hosts)
+	}
+
+	var handler, failed, skipped *Span
+	for i := range execution.Spans {
+		span := &execution.Spans[i]
+		switch {
+		case span.Handler:
+			handler = span
+		case span.Resource == "pkg.nginx" && span.Host == "web2":
+			failed = span
+		case span.Host == "db1":
+			skipped = span
+		}
+	}
+	if handler == nil || handler.Resource != "reload nginx" || handler.Batch != "web/1" {
+		t.Errorf("Expected a handler span in batch web/1, got %+v", handler)
+	}
+	if failed == nil || failed.Status != StatusFailed || failed.Duration() != 340*time.Millisecond {
+		t.Errorf("Expected a failed 340ms span, got %+v", failed)
+	}
+	if skipped == nil || skipped.Status != StatusSkipped || !skipped.Start.Equal(at(400)) {
+		t.Errorf("Expected the skipped host at the end of the phase, got %+v", skipped)
+	}
+	if execution.Status != "failed" || execution.EndTime.Before(at(400)) {
+		t.Errorf("Unexpected execution outcome %s ending %v", execution.Status, execution.EndTime)
+	}
+}
+
+func TestLanes(t *testing.T) {
+	tests := []struct {
+		name      string
+		spans     [][2]int
+		wantLanes []int
+		wantCount int
+	}{
+		{name: "none", wantLanes: []int{}, wantCount: 0},
+		{name: "sequential", spans: [][2]int{{0, 10}, {10, 20}, {20, 30}}, wantLanes: []int{0, 0, 0}, wantCount: 1},
+		{name: "overlapping", spans: [][2]int{{0, 10}, {5, 15}, {12, 20}}, wantLanes: []int{0, 1, 0}, wantCount: 2},
+		{name: "unordered", spans: [][2]int{{20, 30}, {0, 25}, {0, 5}}, wantLanes: []int{1, 0, 1}, wantCount: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans := make([]Span, len(tt.spans))
+			for i, s := range tt.spans {
+				spans[i] = Span{Start: at(s[0]), End: at(s[1])}
+			}
+			assigned, count := lanes(spans)
+			if count != tt.wantCount {
+				t.Errorf("Expected %d lanes, got %d", tt.wantCount, count)
+			}
+			for i := range assigned {
+				if assigned[i] != tt.wantLanes[i] {
+					t.Errorf("Expected lanes %v, got %v", tt.wantLanes, assigned)
+					break
+				}
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	summaries := Summarize(testExecution())
+	if len(summaries) != 3 {
+		t.Fatalf("Expected 3 host summaries, got %d", len(summaries))
+	}
+	web2, web1 := summaries[0], summaries[1]
+	if web2.Host != "web2" || web1.Host != "web1" {
+		t.Fatalf("Expected hosts slowest first, got %s, %s", web2.Host, web1.Host)
+	}
+	if web1.Resources != 3 || web1.Busy != 290*time.Millisecond {
+		t.Errorf("Expected web1 to spend 290ms in 3 resources, got %v in %d", web1.Busy, web1.Resources)
+	}
+	if web1.Parallelism < 0.96 || web1.Parallelism > 0.97 {
+		t.Errorf("Expected web1 to run serially, got parallelism %.2f", web1.Parallelism)
+	}
+
+	slowest := Slowest(testExecution(), 2)
+	if len(slowest) != 2 || slowest[0].Host != "web2" || slowest[1].Resource != "pkg.nginx" {
+		t.Errorf("Unexpected slowest resources %+v", slowest)
+	}
+}
+
+func TestWriteTimeline(t *testing.T) {
+	execution := testExecution()
+	execution.Spans[0].Error = "<script>"
+
+	var html bytes.Buffer
+	if err := WriteTimeline(&html, execution, FormatHTML); err != nil {
+		t.Fatalf("WriteTimeline(html) error = %v", err)
+	}
+	for _, want := range []string{"Execution 20240501T120000-00000001", "reload nginx", "bar failed", "Slowest resources"} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("Expected HTML timeline to contain %q", want)
+		}
+	}
+	if strings.Contains(html.String(), "<script>") {
+		t.Error("Expected span errors to be escaped")
+	}
+
+	var trace bytes.Buffer
+	if err := WriteTimeline(&trace, execution, FormatTrace); err != nil {
+		t.Fatalf("WriteTimeline(json) error = %v", err)
+	}
+	var decoded struct {
+		TraceEvents []traceEvent `json:"traceEvents"`
+	}
+	if err := json.Unmarshal(trace.Bytes(), &decoded); err != nil {
+		t.Fatalf("Trace is not valid JSON: %v", err)
+	}
+	// One metadata event per host plus one per span
+	if len(decoded.TraceEvents) != 3+len(execution.Spans) {
+		t.Fatalf("Expected %d trace events, got %d", 3+len(execution.Spans), len(decoded.TraceEvents))
+	}
+	for _, event := range decoded.TraceEvents {
+		if event.Name == "pkg.curl" {
+			if event.Timestamp != 200000 || event.Duration != 90000 || event.TID != 2 {
+				t.Errorf("Unexpected curl event %+v", event)
+			}
+		}
+	}
+
+	if err := WriteTimeline(&trace, execution, "svg"); err == nil {
+		t.Error("Expected an error for an unknown format")
+	}
+}
+
+func TestStore(t *testing.T) {
+	store := NewStore(store.NewMemory())
+
+	if _, err := store.Load(Latest); err == nil {
+		t.Error("Expected an error loading from an empty store")
+	}
+
+	for _, id := range []string{"20240501T120000-aaaa0001", "20240501T130000-bbbb0002", "20240501T130000-bbbb0003"} {
+		execution := testExecution()
+		execution.ID = id
+		if err := store.Save(execution); err != nil {
+			t.Fatalf("Save() error = %v", err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		id      string
+		want    string
+		wantErr bool
+	}{
+		{name: "exact", id: "20240501T120000-aaaa0001", want: "20240501T120000-aaaa0001"},
+		{name: "prefix", id: "20240501T12", want: "20240501T120000-aaaa0001"},
+		{name: "latest", id: Latest, want: "20240501T130000-bbbb0003"},
+		{name: "ambiguous", id: "20240501T13", wantErr: true},
+		{name: "missing", id: "2023", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			execution, err := store.Load(tt.id)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Load() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && execution.ID != tt.want {
+				t.Errorf("Load() = %s, want %s", execution.ID, tt.want)
+			}
+		})
+	}
+
+	loaded, err := store.Load(Latest)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if len(loaded.Spans) != 7 || !loaded.Spans[0].Start.Equal(base) {
+		t.Errorf("Expected spans to round trip, got %+v", loaded.Spans)
+	}
+
+	executions, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(executions) != 3 || executions[0].ID != "20240501T130000-bbbb0003" {
+		t.Errorf("Expected executions newest first, got %d", len(executions))
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	dir := t.TempDir()
+	execution := testExecution()
+	execution.ID = "20240501T120000-aaaa0001"
+	data, _ := json.Marshal(execution)
+	if err := os.WriteFile(filepath.Join(dir, execution.ID+".json"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an execution"), 0644)
+
+	kv := store.NewMemory()
+	if _, err := store.Migrate(kv, "executions", Migrations(dir)); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	executions, err := NewStore(kv).List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(executions) != 1 || executions[0].ID != execution.ID || len(executions[0].Spans) != 7 {
+		t.Errorf("Expected the recorded execution to be imported, got %+v", executions)
+	}
+
+	// A missing directory has nothing to import
+	if _, err := store.Migrate(store.NewMemory(), "executions", Migrations(filepath.Join(dir, "missing"))); err != nil {
+		t.Errorf("Migrate() error = %v", err)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	execution := testExecution()
+	execution.TriggeredBy = "alice@laptop"
+	execution.AddResult("db1", PhaseApply, "", &core.ExecutionResult{Changes: []core.ChangeResult{{
+		Change: core.Change{
+			Action:   core.ActionUpdate,
+			Resource: types.Resource{Type: "user", Name: "app"},
+			Diff: &types.ResourceDiff{Changes: map[string]interface{}{
+				"shell":    map[string]interface{}{"from": "/bin/sh", "to": "/bin/bash"},
+				"password": map[string]interface{}{"from": "hunter2", "to": "swordfish"},
+			}},
+		},
+		Success:   true,
+		StartTime: at(500),
+		EndTime:   at(600),
+	}}})
+
+	tests := []struct {
+		name   string
+		filter ChangeFilter
+		want   []string
+	}{
+		{name: "all", want: []string{"web1 pkg.nginx create", "web1 pkg.curl create", "web1 reload nginx handler", "db1 user.app update"}},
+		{name: "host", filter: ChangeFilter{Host: "db1"}, want: []string{"db1 user.app update"}},
+		{name: "window", filter: ChangeFilter{Since: at(100), Until: at(400)}, want: []string{"web1 pkg.curl create", "web1 reload nginx handler"}},
+		{name: "other module", filter: ChangeFilter{Module: "db"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, change := range Diff([]*Execution{execution}, tt.filter) {
+				got = append(got, change.Host+" "+change.Resource+" "+change.Action)
+			}
+			if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	changes := Diff([]*Execution{execution}, ChangeFilter{Host: "db1"})
+	if changes[0].TriggeredBy != "alice@laptop" || changes[0].Execution != execution.ID {
+		t.Errorf("Diff() = %+v", changes[0])
+	}
+	values := changes[0].Values
+	if values["shell"] != "/bin/sh -> /bin/bash" || values["password"] != "[REDACTED]" {
+		t.Errorf("Values = %v", values)
+	}
+}
+
+func TestParseSince(t *testing.T) {
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value   string
+		want    time.Time
+		wantErr bool
+	}{
+		{value: "7d", want: time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)},
+		{value: "90m", want: time.Date(2024, 5, 8, 10, 30, 0, 0, time.UTC)},
+		{value: "2024-05-01", want: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)},
+		{value: "2024-05-01T08:00:00Z", want: time.Date(2024, 5, 1, 8, 0, 0, 0, time.UTC)},
+		{value: "-1d", wantErr: true},
+		{value: "last week", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := ParseSince(tt.value, now)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSince() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !got.Equal(tt.want) {
+				t.Errorf("ParseSince() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDrift(t *testing.T) {
+	applied := testExecution()
+
+	// A later dry run reached web1, with one change planned, but not db1
+	checked := &Execution{ID: "20240501T130000-00000002", Module: "web", StartTime: at(1000)}
+	checked.AddReport(PhasePlan, &executor.RunReport{Hosts: []executor.HostResult{
+		{Host: "web1", Status: executor.HostSucceeded, StartTime: at(1000), EndTime: at(1100)},
+		{Host: "db1", Status: executor.HostUnreachable, StartTime: at(1000), EndTime: at(1100)},
+	}}, nil)
+	checked.AddPlan("web1", &core.Plan{Changes: []core.Change{
+		{Action: core.ActionUpdate, Resource: types.Resource{Type: "pkg", Name: "curl"}},
+		{Action: core.ActionNoOp, Resource: types.Resource{Type: "pkg", Name: "nginx"}},
+	}}, at(1100))
+	checked.Finish("succeeded")
+
+	var got []string
+	for _, hostDrift := range Drift([]*Execution{checked, applied}, "web") {
+		got = append(got, hostDrift.Host+" "+hostDrift.Execution[16:]+" "+strings.Join(hostDrift.Resources, ","))
+	}
+	want := []string{"db1 00000001 ", "web1 00000002 pkg.curl", "web2 00000001 pkg.nginx"}
+	if strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("Drift() = %q, want %q", got, want)
+	}
+	if drift := Drift([]*Execution{checked, applied}, "db"); len(drift) != 0 {
+		t.Errorf("Drift() of another module = %v", drift)
+	}
+}
@@ -0,0 +1,155 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+// DefaultDir is where executions were recorded as JSON files before they
+// moved to the controller store; they are imported from there
+const DefaultDir = ".chisel/executions"
+
+// Latest selects the most recent execution in Store.Load
+const Latest = "latest"
+
+// bucket holds executions in the controller store, keyed by ID
+const bucket = "executions"
+
+// Store keeps executions in the controller store
+type Store struct {
+	kv store.Store
+}
+
+// NewStore creates a store of executions backed by kv
+func NewStore(kv store.Store) *Store {
+	return &Store{kv: kv}
+}
+
+// Migrations upgrades executions kept in a store; the first imports the
+// JSON files of an execution directory
+func Migrations(dir string) []store.Migration {
+	return []store.Migration{
+		{
+			Version:     1,
+			Description: "import executions recorded in " + dir,
+			Up: func(kv store.Store) error {
+				return importDir(kv, dir)
+			},
+		},
+	}
+}
+
+// importDir copies the executions recorded as JSON files in dir into kv
+func importDir(kv store.Store, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, ".json") {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			return fmt.Errorf("failed to read execution %s: %w", name, err)
+		}
+		if err := kv.Put(bucket, strings.TrimSuffix(name, ".json"), data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Save writes an execution to the store
+func (s *Store) Save(execution *Execution) error {
+	data, err := json.Marshal(execution)
+	if err != nil {
+		return fmt.Errorf("failed to encode execution: %w", err)
+	}
+	if err := s.kv.Put(bucket, execution.ID, data); err != nil {
+		return fmt.Errorf("failed to write execution: %w", err)
+	}
+	return nil
+}
+
+// Load reads an execution by ID, by a prefix unique to one execution, or
+// the most recent one with Latest
+func (s *Store) Load(id string) (*Execution, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no executions recorded")
+	}
+
+	var matches []string
+	if id == Latest {
+		matches = ids[len(ids)-1:]
+	} else {
+		for _, candidate := range ids {
+			if candidate == id {
+				matches = []string{candidate}
+				break
+			}
+			if strings.HasPrefix(candidate, id) {
+				matches = append(matches, candidate)
+			}
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, fmt.Errorf("execution %s not found", id)
+	case 1:
+		return s.read(matches[0])
+	default:
+		return nil, fmt.Errorf("execution ID %s is ambiguous, it matches %d executions", id, len(matches))
+	}
+}
+
+// List returns every recorded execution, most recent first
+func (s *Store) List() ([]*Execution, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+	executions := make([]*Execution, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		execution, err := s.read(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		executions = append(executions, execution)
+	}
+	return executions, nil
+}
+
+// ids returns the recorded execution IDs, oldest first
+func (s *Store) ids() ([]string, error) {
+	ids, err := s.kv.Keys(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read execution store: %w", err)
+	}
+	return ids, nil
+}
+
+// read loads one execution
+func (s *Store) read(id string) (*Execution, error) {
+	var execution Execution
+	if err := store.GetJSON(s.kv, bucket, id, &execution); err != nil {
+		return nil, fmt.Errorf("failed to read execution %s: %w", id, err)
+	}
+	return &execution, nil
+}
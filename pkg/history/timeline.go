@@ -0,0 +1,345 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"sort"
+	"time"
+)
+
+// Timeline formats
+const (
+	FormatHTML  = "html"
+	FormatTrace = "json"
+)
+
+// slowestLimit is how many of the slowest resources the timeline lists
+const slowestLimit = 10
+
+// WriteTimeline renders an execution as a timeline in the given format
+func WriteTimeline(w io.Writer, execution *Execution, format string) error {
+	switch format {
+	case FormatHTML, "":
+		return WriteHTML(w, execution)
+	case FormatTrace:
+		return WriteTrace(w, execution)
+	default:
+		return fmt.Errorf("unknown timeline format %q, must be one of: html, json", format)
+	}
+}
+
+// lanes assigns spans that overlap in time to separate lanes, so concurrent
+// work is drawn side by side. It returns the lane of each span and the
+// number of lanes.
+func lanes(spans []Span) ([]int, int) {
+	order := make([]int, len(spans))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return spans[order[a]].Start.Before(spans[order[b]].Start)
+	})
+
+	assigned := make([]int, len(spans))
+	var ends []time.Time
+	for _, i := range order {
+		lane := -1
+		for l, end := range ends {
+			if !spans[i].Start.Before(end) {
+				lane = l
+				break
+			}
+		}
+		if lane == -1 {
+			lane = len(ends)
+			ends = append(ends, time.Time{})
+		}
+		ends[lane] = spans[i].End
+		assigned[i] = lane
+	}
+	return assigned, len(ends)
+}
+
+// traceEvent is an event in the Chrome trace event format, which Perfetto,
+// speedscope and chrome://tracing display as a flame chart
+type traceEvent struct {
+	Name      string                 `json:"name"`
+	Category  string                 `json:"cat,omitempty"`
+	Phase     string                 `json:"ph"`
+	Timestamp int64                  `json:"ts"`
+	Duration  int64                  `json:"dur,omitempty"`
+	PID       int                    `json:"pid"`
+	TID       int                    `json:"tid"`
+	Args      map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteTrace writes the execution in the Chrome trace event format, with a
+// process per host and a thread per lane of concurrent work
+func WriteTrace(w io.Writer, execution *Execution) error {
+	events := []traceEvent{}
+	for pid, host := range execution.Hosts() {
+		events = append(events, traceEvent{
+			Name: "process_name", Phase: "M", PID: pid + 1,
+			Args: map[string]interface{}{"name": host},
+		})
+
+		spans := hostSpans(execution, host)
+		assigned, _ := lanes(spans)
+		for i, span := range spans {
+			args := map[string]interface{}{"status": span.Status}
+			if span.Action != "" {
+				args["action"] = span.Action
+			}
+			if span.Batch != "" {
+				args["batch"] = span.Batch
+			}
+			if span.Error != "" {
+				args["error"] = span.Error
+			}
+			events = append(events, traceEvent{
+				Name:      spanName(span),
+				Category:  span.Phase,
+				Phase:     "X",
+				Timestamp: span.Start.Sub(execution.StartTime).Microseconds(),
+				Duration:  span.Duration().Microseconds(),
+				PID:       pid + 1,
+				TID:       assigned[i] + 1,
+				Args:      args,
+			})
+		}
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]interface{}{
+		"traceEvents":     events,
+		"displayTimeUnit": "ms",
+		"otherData": map[string]string{
+			"execution": execution.ID,
+			"module":    execution.Module,
+			"status":    execution.Status,
+		},
+	})
+}
+
+// hostSpans returns the spans of one host
+func hostSpans(execution *Execution, host string) []Span {
+	var spans []Span
+	for _, span := range execution.Spans {
+		if span.Host == host {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// spanName labels a span with its resource, or its phase for a host span
+func spanName(span Span) string {
+	if span.Resource == "" {
+		if span.Batch != "" {
+			return fmt.Sprintf("%s (batch %s)", span.Phase, span.Batch)
+		}
+		return span.Phase
+	}
+	if span.Handler {
+		return "handler " + span.Resource
+	}
+	return span.Resource
+}
+
+// HostSummary describes how much of a host's apply ran concurrently
+type HostSummary struct {
+	Host string
+	// Wall is the elapsed time of the host's apply
+	Wall time.Duration
+	// Busy is the total time spent in resource changes
+	Busy time.Duration
+	// Parallelism is Busy divided by Wall: around 1 means the resources
+	// ran one after another
+	Parallelism float64
+	Resources   int
+}
+
+// Summarize returns the apply summary of each host, slowest first
+func Summarize(execution *Execution) []HostSummary {
+	byHost := make(map[string]*HostSummary)
+	for _, span := range execution.Spans {
+		if span.Phase != PhaseApply {
+			continue
+		}
+		summary, ok := byHost[span.Host]
+		if !ok {
+			summary = &HostSummary{Host: span.Host}
+			byHost[span.Host] = summary
+		}
+		if span.Resource == "" {
+			summary.Wall += span.Duration()
+		} else {
+			summary.Busy += span.Duration()
+			summary.Resources++
+		}
+	}
+
+	summaries := make([]HostSummary, 0, len(byHost))
+	for _, summary := range byHost {
+		if summary.Wall > 0 {
+			summary.Parallelism = float64(summary.Busy) / float64(summary.Wall)
+		}
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		if summaries[i].Wall != summaries[j].Wall {
+			return summaries[i].Wall > summaries[j].Wall
+		}
+		return summaries[i].Host < summaries[j].Host
+	})
+	return summaries
+}
+
+// Slowest returns the resource spans that took longest
+func Slowest(execution *Execution, limit int) []Span {
+	var spans []Span
+	for _, span := range execution.Spans {
+		if span.Resource != "" {
+			spans = append(spans, span)
+		}
+	}
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].Duration() > spans[j].Duration()
+	})
+	if len(spans) > limit {
+		spans = spans[:limit]
+	}
+	return spans
+}
+
+// timelineRow is a row of bars in the HTML timeline
+type timelineRow struct {
+	Label string
+	Host  bool
+	Bars  []timelineBar
+}
+
+// timelineBar is a span positioned as percentages of the execution
+type timelineBar struct {
+	Left   float64
+	Width  float64
+	Status string
+	Title  string
+	Label  string
+}
+
+// WriteHTML writes the execution as a self-contained HTML Gantt chart: a
+// row for each host's phases, followed by its resource changes with work
+// that overlapped in time on separate rows
+func WriteHTML(w io.Writer, execution *Execution) error {
+	total := execution.EndTime.Sub(execution.StartTime)
+	if total <= 0 {
+		total = time.Millisecond
+	}
+	bar := func(span Span) timelineBar {
+		left := float64(span.Start.Sub(execution.StartTime)) / float64(total) * 100
+		width := float64(span.Duration()) / float64(total) * 100
+		title := fmt.Sprintf("%s on %s: %s, %s", spanName(span), span.Host, span.Status, span.Duration().Round(time.Millisecond))
+		if span.Error != "" {
+			title += " - " + span.Error
+		}
+		return timelineBar{Left: left, Width: width, Status: span.Status, Title: title, Label: spanName(span)}
+	}
+
+	var rows []timelineRow
+	for _, host := range execution.Hosts() {
+		hostRow := timelineRow{Label: host, Host: true}
+		var resources []Span
+		for _, span := range hostSpans(execution, host) {
+			if span.Resource == "" {
+				hostRow.Bars = append(hostRow.Bars, bar(span))
+			} else {
+				resources = append(resources, span)
+			}
+		}
+		rows = append(rows, hostRow)
+
+		assigned, count := lanes(resources)
+		laneRows := make([]timelineRow, count)
+		for i, span := range resources {
+			laneRows[assigned[i]].Bars = append(laneRows[assigned[i]].Bars, bar(span))
+		}
+		rows = append(rows, laneRows...)
+	}
+
+	var ticks []timelineTick
+	for i := 0; i <= 4; i++ {
+		ticks = append(ticks, timelineTick{
+			Left:  float64(i) * 25,
+			Label: (total * time.Duration(i) / 4).Round(time.Millisecond).String(),
+		})
+	}
+
+	return timelineTemplate.Execute(w, map[string]interface{}{
+		"Execution": execution,
+		"Duration":  total.Round(time.Millisecond),
+		"Rows":      rows,
+		"Ticks":     ticks,
+		"Hosts":     Summarize(execution),
+		"Slowest":   Slowest(execution, slowestLimit),
+	})
+}
+
+// timelineTick is a time axis label
+type timelineTick struct {
+	Left  float64
+	Label string
+}
+
+var timelineTemplate = template.Must(template.New("timeline").Funcs(template.FuncMap{
+	"ms": func(d time.Duration) string { return d.Round(time.Millisecond).String() },
+	"pct": func(f float64) template.CSS {
+		return template.CSS(fmt.Sprintf("%.4f%%", f))
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Execution {{.Execution.ID}}</title>
+<style>
+body { font-family: -apple-system, BlinkMacSystemFont, sans-serif; margin: 24px; color: #222; }
+h1 { font-size: 20px; margin-bottom: 4px; }
+.meta { color: #666; margin-bottom: 16px; }
+.chart { position: relative; border-left: 1px solid #ccc; margin-left: 200px; }
+.axis { position: relative; height: 18px; margin-left: 200px; font-size: 11px; color: #666; }
+.axis span { position: absolute; transform: translateX(-50%); }
+.row { position: relative; height: 18px; margin: 2px 0; }
+.row.host { margin-top: 10px; height: 22px; }
+.label { position: absolute; right: 100%; width: 192px; padding-right: 8px; text-align: right; font-size: 12px; white-space: nowrap; overflow: hidden; text-overflow: ellipsis; }
+.row.host .label { font-weight: bold; }
+.bar { position: absolute; top: 2px; bottom: 2px; min-width: 2px; border-radius: 2px; font-size: 10px; color: #fff; overflow: hidden; white-space: nowrap; padding-left: 2px; box-sizing: border-box; }
+.row.host .bar { opacity: 0.45; }
+.succeeded { background: #2e7d32; }
+.failed { background: #c62828; }
+.unreachable { background: #6a1b9a; }
+.skipped { background: #9e9e9e; }
+table { border-collapse: collapse; margin-top: 24px; font-size: 13px; }
+th, td { text-align: left; padding: 4px 12px 4px 0; border-bottom: 1px solid #eee; }
+</style>
+</head>
+<body>
+<h1>Execution {{.Execution.ID}}</h1>
+<div class="meta">Module {{.Execution.Module}} &middot; {{.Execution.Status}} &middot; {{.Duration}} &middot; started {{.Execution.StartTime.Format "2006-01-02 15:04:05 MST"}}</div>
+<div class="axis">{{range .Ticks}}<span style="left: {{pct .Left}}">{{.Label}}</span>{{end}}</div>
+<div class="chart">
+{{range .Rows}}<div class="row{{if .Host}} host{{end}}"><div class="label">{{.Label}}</div>{{range .Bars}}<div class="bar {{.Status}}" style="left: {{pct .Left}}; width: {{pct .Width}}" title="{{.Title}}">{{.Label}}</div>{{end}}</div>
+{{end}}</div>
+{{if .Hosts}}<table>
+<tr><th>Host</th><th>Apply time</th><th>Time in resources</th><th>Resources</th><th>Parallelism</th></tr>
+{{range .Hosts}}<tr><td>{{.Host}}</td><td>{{ms .Wall}}</td><td>{{ms .Busy}}</td><td>{{.Resources}}</td><td>{{printf "%.2f" .Parallelism}}</td></tr>
+{{end}}</table>{{end}}
+{{if .Slowest}}<table>
+<tr><th>Slowest resources</th><th>Host</th><th>Action</th><th>Duration</th><th>Status</th></tr>
+{{range .Slowest}}<tr><td>{{.Resource}}</td><td>{{.Host}}</td><td>{{.Action}}</td><td>{{ms .Duration}}</td><td>{{.Status}}</td></tr>
+{{end}}</table>{{end}}
+</body>
+</html>
+`))
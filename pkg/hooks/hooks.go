@@ -0,0 +1,231 @@
+// Package hooks runs the commands and webhooks a project configures around
+// its runs: before planning, after a successful apply and when a run fails.
+// They integrate runs with other systems, such as updating a ticket or
+// warming a cache, without changing modules.
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/webhook"
+)
+
+// Event is when hooks run
+type Event string
+
+const (
+	// PrePlan hooks run before a module is planned; a failing one stops the run
+	PrePlan Event = "pre_plan"
+	// PostApply hooks run after an apply succeeded
+	PostApply Event = "post_apply"
+	// OnFailure hooks run after a plan or apply failed
+	OnFailure Event = "on_failure"
+)
+
+// DefaultTimeout bounds a hook command without a timeout of its own
+const DefaultTimeout = 5 * time.Minute
+
+// Hook is a local command or a webhook. Commands run with the run's context
+// in FORGE_ environment variables; webhooks receive it as the data of a
+// signed payload, as lifecycle webhooks do.
+type Hook struct {
+	// Command is run with /bin/sh -c on the machine forge runs on
+	Command string `mapstructure:"command" yaml:"command,omitempty"`
+	// Webhook is the URL the run's context is posted to
+	Webhook string `mapstructure:"webhook" yaml:"webhook,omitempty"`
+	// Secret signs webhook payloads, as for lifecycle webhooks
+	Secret  string        `mapstructure:"secret" yaml:"secret,omitempty"`
+	Timeout time.Duration `mapstructure:"timeout" yaml:"timeout,omitempty"`
+}
+
+// String describes the hook in messages
+func (h Hook) String() string {
+	if h.Webhook != "" {
+		return h.Webhook
+	}
+	return h.Command
+}
+
+// Validate checks the hook configuration
+func (h Hook) Validate() error {
+	switch {
+	case h.Command == "" && h.Webhook == "":
+		return fmt.Errorf("a hook needs a command or a webhook")
+	case h.Command != "" && h.Webhook != "":
+		return fmt.Errorf("a hook has either a command or a webhook, not both")
+	case h.Timeout < 0:
+		return fmt.Errorf("hook timeout must not be negative")
+	case h.Webhook != "":
+		return webhook.Endpoint{URL: h.Webhook}.Validate()
+	}
+	return nil
+}
+
+// Config is the hooks section of the project configuration
+type Config struct {
+	PrePlan   []Hook `mapstructure:"pre_plan" yaml:"pre_plan,omitempty"`
+	PostApply []Hook `mapstructure:"post_apply" yaml:"post_apply,omitempty"`
+	OnFailure []Hook `mapstructure:"on_failure" yaml:"on_failure,omitempty"`
+}
+
+// hooks returns the hooks of an event
+func (c Config) hooks(event Event) []Hook {
+	switch event {
+	case PrePlan:
+		return c.PrePlan
+	case PostApply:
+		return c.PostApply
+	case OnFailure:
+		return c.OnFailure
+	}
+	return nil
+}
+
+// Validate checks every hook
+func (c Config) Validate() error {
+	for _, event := range []Event{PrePlan, PostApply, OnFailure} {
+		for i, hook := range c.hooks(event) {
+			if err := hook.Validate(); err != nil {
+				return fmt.Errorf("hooks.%s[%d]: %w", event, i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Run is the context of the run hooks are told about
+type Run struct {
+	// Command is the forge command of the run, plan or apply
+	Command       string
+	Module        string
+	ModuleVersion string
+	Fingerprint   string
+	Inventory     string
+	TriggeredBy   string
+	DryRun        bool
+	// Status and Error are set for post_apply and on_failure hooks
+	Status string
+	Error  string
+}
+
+// fields returns the run's context by name, leaving out what is not known
+func (r Run) fields(event Event) map[string]string {
+	fields := map[string]string{
+		"hook":           string(event),
+		"command":        r.Command,
+		"module":         r.Module,
+		"module_version": r.ModuleVersion,
+		"fingerprint":    r.Fingerprint,
+		"inventory":      r.Inventory,
+		"triggered_by":   r.TriggeredBy,
+		"dry_run":        strconv.FormatBool(r.DryRun),
+		"status":         r.Status,
+		"error":          r.Error,
+	}
+	for name, value := range fields {
+		if value == "" {
+			delete(fields, name)
+		}
+	}
+	return fields
+}
+
+// Env returns the run's context as FORGE_ environment variables, such as
+// FORGE_MODULE and FORGE_STATUS
+func (r Run) Env(event Event) []string {
+	fields := r.fields(event)
+	env := make([]string, 0, len(fields))
+	for name, value := range fields {
+		env = append(env, "FORGE_"+strings.ToUpper(name)+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// Runner runs the configured hooks
+type Runner struct {
+	config Config
+	output io.Writer
+}
+
+// NewRunner creates a runner for the hooks in config. Hook commands print
+// to output.
+func NewRunner(config Config, output io.Writer) (*Runner, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	if output == nil {
+		output = io.Discard
+	}
+	return &Runner{config: config, output: output}, nil
+}
+
+// Run runs the hooks of an event in order, stopping at the first that
+// fails. A nil runner runs nothing.
+func (r *Runner) Run(ctx context.Context, event Event, run Run) error {
+	if r == nil {
+		return nil
+	}
+	for _, hook := range r.config.hooks(event) {
+		var err error
+		if hook.Webhook != "" {
+			err = r.post(ctx, event, hook, run)
+		} else {
+			err = r.command(ctx, event, hook, run)
+		}
+		if err != nil {
+			return fmt.Errorf("%s hook %s failed: %w", event, hook, err)
+		}
+	}
+	return nil
+}
+
+// command runs a hook command with the run's context in its environment
+func (r *Runner) command(ctx context.Context, event Event, hook Hook, run Run) error {
+	timeout := hook.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", hook.Command)
+	cmd.Env = append(os.Environ(), run.Env(event)...)
+	cmd.Stdout, cmd.Stderr = r.output, r.output
+	// Children left holding the output open do not keep the run waiting
+	cmd.WaitDelay = time.Second
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return fmt.Errorf("timed out after %s", timeout)
+		}
+		return err
+	}
+	return nil
+}
+
+// post delivers the run's context to a hook webhook
+func (r *Runner) post(ctx context.Context, event Event, hook Hook, run Run) error {
+	dispatcher, err := webhook.NewDispatcher([]webhook.Endpoint{{URL: hook.Webhook, Secret: hook.Secret}})
+	if err != nil {
+		return err
+	}
+	if hook.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, hook.Timeout)
+		defer cancel()
+	}
+	data := make(map[string]interface{})
+	for name, value := range run.fields(event) {
+		data[name] = value
+	}
+	data["dry_run"] = run.DryRun
+	return dispatcher.Send(ctx, "hook."+string(event), run.Module, data)
+}
@@ -0,0 +1,111 @@
+package hooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/webhook"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr string
+	}{
+		{name: "command", config: Config{PrePlan: []Hook{{Command: "true"}}}},
+		{name: "webhook", config: Config{OnFailure: []Hook{{Webhook: "https://example.com/hook"}}}},
+		{name: "empty", config: Config{PostApply: []Hook{{}}}, wantErr: "hooks.post_apply[0]: a hook needs a command or a webhook"},
+		{name: "both", config: Config{PrePlan: []Hook{{Command: "true", Webhook: "https://example.com"}}}, wantErr: "not both"},
+		{name: "bad url", config: Config{OnFailure: []Hook{{Webhook: "example.com"}}}, wantErr: "must start with http://"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.config.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRun_Env(t *testing.T) {
+	run := Run{Command: "apply", Module: "web", ModuleVersion: "1.2.0", Status: "failed", Error: "1 change(s) failed"}
+	want := []string{
+		"FORGE_COMMAND=apply",
+		"FORGE_DRY_RUN=false",
+		"FORGE_ERROR=1 change(s) failed",
+		"FORGE_HOOK=on_failure",
+		"FORGE_MODULE=web",
+		"FORGE_MODULE_VERSION=1.2.0",
+		"FORGE_STATUS=failed",
+	}
+	if env := run.Env(OnFailure); !reflect.DeepEqual(env, want) {
+		t.Errorf("Env() = %q, want %q", env, want)
+	}
+}
+
+func TestRunner_Commands(t *testing.T) {
+	var output bytes.Buffer
+	runner, err := NewRunner(Config{
+		PrePlan: []Hook{
+			{Command: `echo "$FORGE_HOOK $FORGE_MODULE"`},
+			{Command: "exit 3"},
+			{Command: "echo not reached"},
+		},
+		PostApply: []Hook{{Command: "sleep 5", Timeout: 50 * time.Millisecond}},
+	}, &output)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = runner.Run(context.Background(), PrePlan, Run{Module: "web"})
+	if err == nil || !strings.Contains(err.Error(), "pre_plan hook exit 3 failed: exit status 3") {
+		t.Errorf("Run() error = %v, want the failing hook", err)
+	}
+	if output.String() != "pre_plan web\n" {
+		t.Errorf("output = %q, want the hooks before the failing one only", output.String())
+	}
+
+	if err := runner.Run(context.Background(), PostApply, Run{}); err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Run() error = %v, want a timeout", err)
+	}
+	if err := runner.Run(context.Background(), OnFailure, Run{}); err != nil {
+		t.Errorf("Run() without hooks error = %v", err)
+	}
+}
+
+func TestRunner_Webhook(t *testing.T) {
+	var payload webhook.Payload
+	var signature string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signature = r.Header.Get(webhook.HeaderSignature)
+		json.NewDecoder(r.Body).Decode(&payload)
+	}))
+	defer server.Close()
+
+	runner, err := NewRunner(Config{PostApply: []Hook{{Webhook: server.URL, Secret: "s3cret"}}}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := runner.Run(context.Background(), PostApply, Run{Command: "apply", Module: "web", Status: "succeeded"}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if payload.Event != "hook.post_apply" || payload.Module != "web" || payload.Data["status"] != "succeeded" || payload.Data["dry_run"] != false {
+		t.Errorf("payload = %+v", payload)
+	}
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("signature = %q, want the payload signed", signature)
+	}
+}
@@ -1,18 +1,32 @@
 package inventory
 
 import (
+	"bytes"
 	"context"
+	"encoding/xml"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 
+	"github.com/ataiva-software/forge/pkg/sigv4"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
+// discoverTimeout bounds each request to a cloud provider's API
+const discoverTimeout = 30 * time.Second
+
 // AWSInventoryProvider discovers targets from AWS EC2 instances
 type AWSInventoryProvider struct {
 	region   string
 	profile  string
 	roleArn  string
+	endpoint string
+	client   *http.Client
 	mockMode bool
 }
 
@@ -22,15 +36,28 @@ func NewAWSInventoryProvider(region, profile, roleArn string) *AWSInventoryProvi
 		region:   region,
 		profile:  profile,
 		roleArn:  roleArn,
+		client:   &http.Client{Timeout: discoverTimeout},
 		mockMode: false,
 	}
 }
 
+// SetEndpoint sets the base URL of the EC2 API, such as a VPC endpoint or
+// LocalStack; empty is https://ec2.<region>.amazonaws.com
+func (a *AWSInventoryProvider) SetEndpoint(endpoint string) {
+	a.endpoint = endpoint
+}
+
 // Type returns the provider type
 func (a *AWSInventoryProvider) Type() string {
 	return "aws"
 }
 
+// Scope returns the region, profile, role and endpoint the provider
+// discovers with
+func (a *AWSInventoryProvider) Scope() string {
+	return a.region + "/" + a.profile + "/" + a.roleArn + "/" + a.endpoint
+}
+
 // Validate validates the provider configuration
 func (a *AWSInventoryProvider) Validate() error {
 	if a.region == "" {
@@ -63,7 +90,7 @@ func (a *AWSInventoryProvider) discoverMock(ctx context.Context, selector string
 	}
 	
 	// Mock EC2 instances
-	mockInstances := []mockEC2Instance{
+	mockInstances := []ec2Instance{
 		{
 			InstanceID:       "i-1234567890abcdef0",
 			PublicIPAddress:  "203.0.113.1",
@@ -89,7 +116,7 @@ func (a *AWSInventoryProvider) discoverMock(ctx context.Context, selector string
 	}
 	
 	// Filter instances based on selector
-	var matchingInstances []mockEC2Instance
+	var matchingInstances []ec2Instance
 	for _, instance := range mockInstances {
 		if a.instanceMatchesSelector(instance, selectorMap) {
 			matchingInstances = append(matchingInstances, instance)
@@ -99,42 +126,166 @@ func (a *AWSInventoryProvider) discoverMock(ctx context.Context, selector string
 	// Convert to targets
 	var targets []types.Target
 	for _, instance := range matchingInstances {
-		target := types.Target{
-			Host: instance.PublicIPAddress,
-			Port: 22, // Default SSH port
-			User: "ec2-user", // Default EC2 user
-			Labels: make(map[string]string),
-		}
-		
-		// Copy tags as labels
-		for key, value := range instance.Tags {
-			target.Labels[key] = value
-		}
-		
-		// Add AWS-specific labels
-		target.Labels["aws:instance-id"] = instance.InstanceID
-		target.Labels["aws:private-ip"] = instance.PrivateIPAddress
-		target.Labels["aws:region"] = a.region
-		target.Labels["aws:state"] = instance.State
-		
-		targets = append(targets, target)
+		targets = append(targets, a.instanceTarget(instance))
 	}
 	
 	return targets, nil
 }
 
-// discoverReal discovers real EC2 instances (would use AWS SDK)
-func (a *AWSInventoryProvider) discoverReal(ctx context.Context, selector string) ([]types.Target, error) {
-	// In a real implementation, this would use the AWS SDK:
-	// - Create EC2 client with region and credentials
-	// - Call DescribeInstances with filters based on selector
-	// - Convert EC2 instances to targets
+// instanceTarget returns the target of an instance, reached on its public
+// address, or its private one when it has none
+func (a *AWSInventoryProvider) instanceTarget(instance ec2Instance) types.Target {
+	host := instance.PublicIPAddress
+	if host == "" {
+		host = instance.PrivateIPAddress
+	}
+	target := types.Target{
+		Host: host,
+		Port: 22, // Default SSH port
+		User: "ec2-user", // Default EC2 user
+		Labels: make(map[string]string),
+	}
 	
-	return nil, fmt.Errorf("AWS SDK integration not available in test environment")
+	// Copy tags as labels
+	for key, value := range instance.Tags {
+		target.Labels[key] = value
+	}
+	
+	// Add AWS-specific labels
+	target.Labels["aws:instance-id"] = instance.InstanceID
+	target.Labels["aws:private-ip"] = instance.PrivateIPAddress
+	target.Labels["aws:region"] = a.region
+	target.Labels["aws:state"] = instance.State
+	return target
+}
+
+// describeInstancesResponse is the part of an EC2 DescribeInstances
+// response discovery reads
+type describeInstancesResponse struct {
+	Reservations []struct {
+		Instances []struct {
+			InstanceID       string `xml:"instanceId"`
+			State            string `xml:"instanceState>name"`
+			PrivateIPAddress string `xml:"privateIpAddress"`
+			PublicIPAddress  string `xml:"ipAddress"`
+			Tags             []struct {
+				Key   string `xml:"key"`
+				Value string `xml:"value"`
+			} `xml:"tagSet>item"`
+		} `xml:"instancesSet>item"`
+	} `xml:"reservationSet>item"`
+	NextToken string `xml:"nextToken"`
+}
+
+// discoverReal lists the running EC2 instances of the region whose tags
+// match the selector
+func (a *AWSInventoryProvider) discoverReal(ctx context.Context, selector string) ([]types.Target, error) {
+	selectorMap, err := parseAWSSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	credentials, err := sigv4.FindCredentials(a.profile)
+	if err != nil {
+		return nil, err
+	}
+	if a.roleArn != "" {
+		if credentials, _, err = sigv4.AssumeRole(ctx, a.client, credentials, a.region, sigv4.RoleRequest{ARN: a.roleArn}, time.Now()); err != nil {
+			return nil, err
+		}
+	}
+
+	// EC2 filters on the tags, so only matching instances are listed
+	form := url.Values{
+		"Action":          {"DescribeInstances"},
+		"Version":         {"2016-11-15"},
+		"Filter.1.Name":   {"instance-state-name"},
+		"Filter.1.Value.1": {"running"},
+	}
+	keys := make([]string, 0, len(selectorMap))
+	for key := range selectorMap {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for i, key := range keys {
+		filter := "Filter." + strconv.Itoa(i+2)
+		form.Set(filter+".Name", "tag:"+key)
+		form.Set(filter+".Value.1", selectorMap[key])
+	}
+
+	var targets []types.Target
+	for {
+		page, err := a.describeInstances(ctx, credentials, form)
+		if err != nil {
+			return nil, err
+		}
+		for _, reservation := range page.Reservations {
+			for _, item := range reservation.Instances {
+				instance := ec2Instance{
+					InstanceID:       item.InstanceID,
+					PublicIPAddress:  item.PublicIPAddress,
+					PrivateIPAddress: item.PrivateIPAddress,
+					State:            item.State,
+					Tags:             make(map[string]string, len(item.Tags)),
+				}
+				for _, tag := range item.Tags {
+					instance.Tags[tag.Key] = tag.Value
+				}
+				// The filters already matched; this guards against an
+				// endpoint that ignores them
+				if a.instanceMatchesSelector(instance, selectorMap) {
+					targets = append(targets, a.instanceTarget(instance))
+				}
+			}
+		}
+		if page.NextToken == "" {
+			return targets, nil
+		}
+		form.Set("NextToken", page.NextToken)
+	}
+}
+
+// describeInstances makes a DescribeInstances request of the EC2 query API
+func (a *AWSInventoryProvider) describeInstances(ctx context.Context, credentials sigv4.Credentials, form url.Values) (*describeInstancesResponse, error) {
+	endpoint := a.endpoint
+	if endpoint == "" {
+		endpoint = "https://ec2." + a.region + ".amazonaws.com"
+	}
+	body := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	sigv4.Sign(req, body, credentials, a.region, "ec2", time.Now())
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EC2 instances: %w", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to describe EC2 instances: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Code    string `xml:"Errors>Error>Code"`
+			Message string `xml:"Errors>Error>Message"`
+		}
+		if xml.Unmarshal(data, &failure) == nil && failure.Code != "" {
+			return nil, fmt.Errorf("failed to describe EC2 instances: %s: %s", failure.Code, failure.Message)
+		}
+		return nil, fmt.Errorf("failed to describe EC2 instances: EC2 returned %s", resp.Status)
+	}
+	var page describeInstancesResponse
+	if err := xml.Unmarshal(data, &page); err != nil {
+		return nil, fmt.Errorf("invalid response from EC2: %w", err)
+	}
+	return &page, nil
 }
 
 // instanceMatchesSelector checks if an instance matches the selector
-func (a *AWSInventoryProvider) instanceMatchesSelector(instance mockEC2Instance, selector map[string]string) bool {
+func (a *AWSInventoryProvider) instanceMatchesSelector(instance ec2Instance, selector map[string]string) bool {
 	// If no selector, match all running instances
 	if len(selector) == 0 {
 		return instance.State == "running"
@@ -186,8 +337,8 @@ func parseAWSSelector(selector string) (map[string]string, error) {
 	return result, nil
 }
 
-// mockEC2Instance represents a mock EC2 instance for testing
-type mockEC2Instance struct {
+// ec2Instance is an EC2 instance, as discovered or mocked
+type ec2Instance struct {
 	InstanceID       string
 	PublicIPAddress  string
 	PrivateIPAddress string
@@ -2,6 +2,12 @@ package inventory
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -157,18 +163,70 @@ func TestAWSInventoryProvider_DiscoverWithInvalidSelector(t *testing.T) {
 	}
 }
 
-func TestAWSInventoryProvider_DiscoverWithoutMockMode(t *testing.T) {
-	provider := NewAWSInventoryProvider("us-west-2", "", "")
-	
-	// Don't set mock mode - this should fail in test environment
-	ctx := context.Background()
-	_, err := provider.Discover(ctx, "")
-	
-	// We expect this to fail in test environment without AWS credentials
-	if err == nil {
-		t.Log("AWS discovery succeeded (unexpected in test environment without credentials)")
-	} else {
-		t.Logf("AWS discovery failed as expected in test environment: %v", err)
+func TestAWSInventoryProvider_DiscoverEC2(t *testing.T) {
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	var forms []url.Values
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") {
+			t.Errorf("Authorization = %q, want a SigV4 signature", r.Header.Get("Authorization"))
+		}
+		r.ParseForm()
+		forms = append(forms, r.PostForm)
+		if r.PostForm.Get("NextToken") == "" {
+			fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0a</instanceId><instanceState><name>running</name></instanceState>
+<privateIpAddress>10.0.1.10</privateIpAddress><ipAddress>203.0.113.1</ipAddress>
+<tagSet><item><key>Role</key><value>web</value></item><item><key>Name</key><value>web-1</value></item></tagSet>
+</item></instancesSet></item></reservationSet><nextToken>page2</nextToken></DescribeInstancesResponse>`)
+			return
+		}
+		fmt.Fprint(w, `<DescribeInstancesResponse><reservationSet><item><instancesSet><item>
+<instanceId>i-0b</instanceId><instanceState><name>running</name></instanceState>
+<privateIpAddress>10.0.1.11</privateIpAddress>
+<tagSet><item><key>Role</key><value>web</value></item></tagSet>
+</item></instancesSet></item></reservationSet></DescribeInstancesResponse>`)
+	}))
+	defer server.Close()
+
+	provider := NewAWSInventoryProvider("eu-west-1", "", "")
+	provider.SetEndpoint(server.URL)
+	targets, err := provider.Discover(context.Background(), "Role=web")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(targets) != 2 || targets[0].Host != "203.0.113.1" || targets[1].Host != "10.0.1.11" {
+		t.Fatalf("targets = %+v, want both pages, the second reached on its private address", targets)
+	}
+	if labels := targets[0].Labels; labels["Name"] != "web-1" || labels["aws:instance-id"] != "i-0a" || labels["aws:region"] != "eu-west-1" {
+		t.Errorf("labels = %v", labels)
+	}
+	if len(forms) != 2 || forms[0].Get("Action") != "DescribeInstances" || forms[0].Get("Filter.1.Value.1") != "running" ||
+		forms[0].Get("Filter.2.Name") != "tag:Role" || forms[0].Get("Filter.2.Value.1") != "web" || forms[1].Get("NextToken") != "page2" {
+		t.Errorf("requests = %v, want running instances filtered by tag, then the next page", forms)
+	}
+}
+
+func TestAWSInventoryProvider_DiscoverErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `<Response><Errors><Error><Code>UnauthorizedOperation</Code><Message>not allowed</Message></Error></Errors></Response>`)
+	}))
+	defer server.Close()
+	provider := NewAWSInventoryProvider("eu-west-1", "", "")
+	provider.SetEndpoint(server.URL)
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", filepath.Join(t.TempDir(), "credentials"))
+	if _, err := provider.Discover(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "no AWS credentials") {
+		t.Errorf("Discover without credentials = %v", err)
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIDEXAMPLE")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "secret")
+	if _, err := provider.Discover(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "UnauthorizedOperation: not allowed") {
+		t.Errorf("Discover denied = %v", err)
 	}
 }
 
@@ -2,17 +2,30 @@ package inventory
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
 	"strings"
 
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
+// Azure Resource Manager API versions discovery lists with
+const (
+	azureComputeAPIVersion = "2024-03-01"
+	azureNetworkAPIVersion = "2023-09-01"
+)
+
 // AzureInventoryProvider discovers targets from Azure VMs
 type AzureInventoryProvider struct {
 	subscriptionID string
 	resourceGroup  string
 	region         string
+	endpoint       string
+	client         *http.Client
 	mockMode       bool
 }
 
@@ -22,15 +35,28 @@ func NewAzureInventoryProvider(subscriptionID, resourceGroup, region string) *Az
 		subscriptionID: subscriptionID,
 		resourceGroup:  resourceGroup,
 		region:         region,
+		client:         &http.Client{Timeout: discoverTimeout},
 		mockMode:       false,
 	}
 }
 
+// SetEndpoint sets the base URL of Azure Resource Manager, such as that of
+// a sovereign cloud; empty is https://management.azure.com
+func (a *AzureInventoryProvider) SetEndpoint(endpoint string) {
+	a.endpoint = endpoint
+}
+
 // Type returns the provider type
 func (a *AzureInventoryProvider) Type() string {
 	return "azure"
 }
 
+// Scope returns the subscription, resource group, region and endpoint the
+// provider discovers in
+func (a *AzureInventoryProvider) Scope() string {
+	return a.subscriptionID + "/" + a.resourceGroup + "/" + a.region + "/" + a.endpoint
+}
+
 // Validate validates the provider configuration
 func (a *AzureInventoryProvider) Validate() error {
 	if a.subscriptionID == "" {
@@ -71,7 +97,7 @@ func (a *AzureInventoryProvider) discoverMock(ctx context.Context, selector stri
 	}
 	
 	// Mock Azure VMs
-	mockVMs := []mockAzureVM{
+	mockVMs := []azureVM{
 		{
 			Name:              "web-vm-1",
 			ResourceGroup:     a.resourceGroup,
@@ -101,7 +127,7 @@ func (a *AzureInventoryProvider) discoverMock(ctx context.Context, selector stri
 	}
 	
 	// Filter VMs based on selector
-	var matchingVMs []mockAzureVM
+	var matchingVMs []azureVM
 	for _, vm := range mockVMs {
 		if a.vmMatchesSelector(vm, selectorMap) {
 			matchingVMs = append(matchingVMs, vm)
@@ -111,44 +137,267 @@ func (a *AzureInventoryProvider) discoverMock(ctx context.Context, selector stri
 	// Convert to targets
 	var targets []types.Target
 	for _, vm := range matchingVMs {
-		target := types.Target{
-			Host: vm.PublicIPAddress,
-			Port: 22, // Default SSH port
-			User: "azureuser", // Default Azure user
-			Labels: make(map[string]string),
-		}
-		
-		// Copy tags as labels
-		for key, value := range vm.Tags {
-			target.Labels[key] = value
-		}
-		
-		// Add Azure-specific labels
-		target.Labels["azure:vm-name"] = vm.Name
-		target.Labels["azure:resource-group"] = vm.ResourceGroup
-		target.Labels["azure:location"] = vm.Location
-		target.Labels["azure:private-ip"] = vm.PrivateIPAddress
-		target.Labels["azure:power-state"] = vm.PowerState
-		target.Labels["azure:subscription-id"] = a.subscriptionID
-		
-		targets = append(targets, target)
+		targets = append(targets, a.vmTarget(vm))
 	}
 	
 	return targets, nil
 }
 
-// discoverReal discovers real Azure VMs (would use Azure SDK)
-func (a *AzureInventoryProvider) discoverReal(ctx context.Context, selector string) ([]types.Target, error) {
-	// In a real implementation, this would use the Azure SDK:
-	// - Create Azure client with subscription and credentials
-	// - Call compute.VirtualMachinesClient.List with filters based on selector
-	// - Convert Azure VMs to targets
+// vmTarget returns the target of a VM, reached on its public address, or
+// its private one when it has none
+func (a *AzureInventoryProvider) vmTarget(vm azureVM) types.Target {
+	host := vm.PublicIPAddress
+	if host == "" {
+		host = vm.PrivateIPAddress
+	}
+	target := types.Target{
+		Host: host,
+		Port: 22, // Default SSH port
+		User: "azureuser", // Default Azure user
+		Labels: make(map[string]string),
+	}
+	
+	// Copy tags as labels
+	for key, value := range vm.Tags {
+		target.Labels[key] = value
+	}
 	
-	return nil, fmt.Errorf("Azure SDK integration not available in test environment")
+	// Add Azure-specific labels
+	target.Labels["azure:vm-name"] = vm.Name
+	target.Labels["azure:resource-group"] = vm.ResourceGroup
+	target.Labels["azure:location"] = vm.Location
+	target.Labels["azure:private-ip"] = vm.PrivateIPAddress
+	target.Labels["azure:power-state"] = vm.PowerState
+	target.Labels["azure:subscription-id"] = a.subscriptionID
+	return target
+}
+
+// discoverReal lists the running VMs of the resource group in the region
+// whose tags match the selector, with the addresses of their primary
+// network interfaces. It signs in as the service principal in
+// AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET.
+func (a *AzureInventoryProvider) discoverReal(ctx context.Context, selector string) ([]types.Target, error) {
+	selectorMap, err := parseAzureSelector(selector)
+	if err != nil {
+		return nil, fmt.Errorf("invalid selector: %w", err)
+	}
+	token, err := a.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	group := "/subscriptions/" + url.PathEscape(a.subscriptionID) + "/resourceGroups/" + url.PathEscape(a.resourceGroup)
+	var vms []struct {
+		ID         string            `json:"id"`
+		Name       string            `json:"name"`
+		Location   string            `json:"location"`
+		Tags       map[string]string `json:"tags"`
+		Properties struct {
+			InstanceView struct {
+				Statuses []struct {
+					Code          string `json:"code"`
+					DisplayStatus string `json:"displayStatus"`
+				} `json:"statuses"`
+			} `json:"instanceView"`
+			NetworkProfile struct {
+				NetworkInterfaces []struct {
+					ID         string `json:"id"`
+					Properties struct {
+						Primary bool `json:"primary"`
+					} `json:"properties"`
+				} `json:"networkInterfaces"`
+			} `json:"networkProfile"`
+		} `json:"properties"`
+	}
+	if err := a.list(ctx, token, group+"/providers/Microsoft.Compute/virtualMachines?$expand=instanceView&api-version="+azureComputeAPIVersion, &vms); err != nil {
+		return nil, fmt.Errorf("failed to list VMs: %w", err)
+	}
+	var interfaces []struct {
+		ID         string `json:"id"`
+		Properties struct {
+			IPConfigurations []struct {
+				Properties struct {
+					Primary          bool   `json:"primary"`
+					PrivateIPAddress string `json:"privateIPAddress"`
+					PublicIPAddress  *struct {
+						ID string `json:"id"`
+					} `json:"publicIPAddress"`
+				} `json:"properties"`
+			} `json:"ipConfigurations"`
+		} `json:"properties"`
+	}
+	if err := a.list(ctx, token, group+"/providers/Microsoft.Network/networkInterfaces?api-version="+azureNetworkAPIVersion, &interfaces); err != nil {
+		return nil, fmt.Errorf("failed to list network interfaces: %w", err)
+	}
+	var publicIPs []struct {
+		ID         string `json:"id"`
+		Properties struct {
+			IPAddress string `json:"ipAddress"`
+		} `json:"properties"`
+	}
+	if err := a.list(ctx, token, group+"/providers/Microsoft.Network/publicIPAddresses?api-version="+azureNetworkAPIVersion, &publicIPs); err != nil {
+		return nil, fmt.Errorf("failed to list public IP addresses: %w", err)
+	}
+
+	// Resource IDs are case-insensitive
+	public := make(map[string]string, len(publicIPs))
+	for _, ip := range publicIPs {
+		public[strings.ToLower(ip.ID)] = ip.Properties.IPAddress
+	}
+	type addresses struct{ private, public string }
+	byInterface := make(map[string]addresses, len(interfaces))
+	for _, nic := range interfaces {
+		for i, config := range nic.Properties.IPConfigurations {
+			if i > 0 && !config.Properties.Primary {
+				continue
+			}
+			found := addresses{private: config.Properties.PrivateIPAddress}
+			if config.Properties.PublicIPAddress != nil {
+				found.public = public[strings.ToLower(config.Properties.PublicIPAddress.ID)]
+			}
+			byInterface[strings.ToLower(nic.ID)] = found
+		}
+	}
+
+	var targets []types.Target
+	for _, item := range vms {
+		if !sameAzureLocation(item.Location, a.region) {
+			continue
+		}
+		vm := azureVM{Name: item.Name, ResourceGroup: a.resourceGroup, Location: item.Location, Tags: item.Tags}
+		for _, status := range item.Properties.InstanceView.Statuses {
+			if strings.HasPrefix(status.Code, "PowerState/") {
+				vm.PowerState = status.DisplayStatus
+			}
+		}
+		for i, nic := range item.Properties.NetworkProfile.NetworkInterfaces {
+			if i == 0 || nic.Properties.Primary {
+				found := byInterface[strings.ToLower(nic.ID)]
+				vm.PrivateIPAddress, vm.PublicIPAddress = found.private, found.public
+			}
+		}
+		if vm.PrivateIPAddress == "" && vm.PublicIPAddress == "" {
+			continue
+		}
+		if a.vmMatchesSelector(vm, selectorMap) {
+			targets = append(targets, a.vmTarget(vm))
+		}
+	}
+	return targets, nil
+}
+
+// sameAzureLocation reports whether two locations are the same, whether
+// named like eastus or East US
+func sameAzureLocation(a, b string) bool {
+	normalize := func(location string) string {
+		return strings.ToLower(strings.ReplaceAll(location, " ", ""))
+	}
+	return normalize(a) == normalize(b)
+}
+
+// token signs in to Microsoft Entra ID as a service principal and returns
+// an access token for Azure Resource Manager
+func (a *AzureInventoryProvider) token(ctx context.Context) (string, error) {
+	tenant, clientID, secret := os.Getenv("AZURE_TENANT_ID"), os.Getenv("AZURE_CLIENT_ID"), os.Getenv("AZURE_CLIENT_SECRET")
+	if tenant == "" || clientID == "" || secret == "" {
+		return "", fmt.Errorf("no Azure credentials in AZURE_TENANT_ID, AZURE_CLIENT_ID and AZURE_CLIENT_SECRET")
+	}
+	authority := os.Getenv("AZURE_AUTHORITY_HOST")
+	if authority == "" {
+		authority = "https://login.microsoftonline.com"
+	}
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {clientID},
+		"client_secret": {secret},
+		"scope":         {a.managementEndpoint() + "/.default"},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(authority, "/")+"/"+url.PathEscape(tenant)+"/oauth2/v2.0/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	var result struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := a.do(req, &result); err != nil {
+		if result.Error != "" {
+			return "", fmt.Errorf("failed to sign in to Azure: %s: %s", result.Error, result.ErrorDescription)
+		}
+		return "", fmt.Errorf("failed to sign in to Azure: %w", err)
+	}
+	return result.AccessToken, nil
+}
+
+// managementEndpoint returns the base URL of Azure Resource Manager
+func (a *AzureInventoryProvider) managementEndpoint() string {
+	if a.endpoint == "" {
+		return "https://management.azure.com"
+	}
+	return strings.TrimSuffix(a.endpoint, "/")
+}
+
+// list reads every page of an Azure Resource Manager list into out, a
+// pointer to a slice
+func (a *AzureInventoryProvider) list(ctx context.Context, token, path string, out interface{}) error {
+	var items []json.RawMessage
+	next := a.managementEndpoint() + path
+	for next != "" {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, next, nil)
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		var page struct {
+			Value    []json.RawMessage `json:"value"`
+			NextLink string            `json:"nextLink"`
+			Error    *struct {
+				Code    string `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		if err := a.do(req, &page); err != nil {
+			if page.Error != nil {
+				return fmt.Errorf("%s: %s", page.Error.Code, page.Error.Message)
+			}
+			return err
+		}
+		items = append(items, page.Value...)
+		next = page.NextLink
+	}
+	data, err := json.Marshal(items)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, out)
+}
+
+// do sends a request and decodes its JSON response into out, which holds
+// the error a failed request describes
+func (a *AzureInventoryProvider) do(req *http.Request, out interface{}) error {
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	decodeErr := json.Unmarshal(data, out)
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", req.URL.Host, resp.Status)
+	}
+	if decodeErr != nil {
+		return fmt.Errorf("invalid response from %s: %w", req.URL.Host, decodeErr)
+	}
+	return nil
 }
 
 // vmMatchesSelector checks if a VM matches the selector
-func (a *AzureInventoryProvider) vmMatchesSelector(vm mockAzureVM, selector map[string]string) bool {
+func (a *AzureInventoryProvider) vmMatchesSelector(vm azureVM, selector map[string]string) bool {
 	// If no selector, match all running VMs
 	if len(selector) == 0 {
 		return vm.PowerState == "VM running"
@@ -200,8 +449,8 @@ func parseAzureSelector(selector string) (map[string]string, error) {
 	return result, nil
 }
 
-// mockAzureVM represents a mock Azure VM for testing
-type mockAzureVM struct {
+// azureVM is an Azure VM, as discovered or mocked
+type azureVM struct {
 	Name              string
 	ResourceGroup     string
 	Location          string
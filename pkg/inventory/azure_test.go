@@ -2,6 +2,10 @@ package inventory
 
 import (
 	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -168,18 +172,98 @@ func TestAzureInventoryProvider_DiscoverWithInvalidSelector(t *testing.T) {
 	}
 }
 
-func TestAzureInventoryProvider_DiscoverWithoutMockMode(t *testing.T) {
-	provider := NewAzureInventoryProvider("subscription-123", "my-rg", "eastus")
-	
-	// Don't set mock mode - this should fail in test environment
-	ctx := context.Background()
-	_, err := provider.Discover(ctx, "")
-	
-	// We expect this to fail in test environment without Azure credentials
-	if err == nil {
-		t.Log("Azure discovery succeeded (unexpected in test environment without credentials)")
-	} else {
-		t.Logf("Azure discovery failed as expected in test environment: %v", err)
+func TestAzureInventoryProvider_DiscoverVMs(t *testing.T) {
+	group := "/subscriptions/sub-1/resourceGroups/my-rg/providers"
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tenant-1/oauth2/v2.0/token" {
+			r.ParseForm()
+			if r.PostForm.Get("client_secret") != "s3cret" || r.PostForm.Get("scope") != server.URL+"/.default" {
+				t.Errorf("token request = %v", r.PostForm)
+			}
+			fmt.Fprint(w, `{"access_token": "token-1"}`)
+			return
+		}
+		if r.Header.Get("Authorization") != "Bearer token-1" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		switch r.URL.Path {
+		case group + "/Microsoft.Compute/virtualMachines":
+			if r.URL.Query().Get("page") == "" {
+				fmt.Fprintf(w, `{"value": [
+{"name": "web-1", "location": "eastus", "tags": {"Role": "web"}, "properties": {
+  "instanceView": {"statuses": [{"code": "ProvisioningState/succeeded"}, {"code": "PowerState/running", "displayStatus": "VM running"}]},
+  "networkProfile": {"networkInterfaces": [{"id": "%[1]s/Microsoft.Network/networkInterfaces/web-1-nic"}]}}},
+{"name": "web-2", "location": "eastus", "tags": {"Role": "web"}, "properties": {
+  "instanceView": {"statuses": [{"code": "PowerState/deallocated", "displayStatus": "VM deallocated"}]},
+  "networkProfile": {"networkInterfaces": [{"id": "%[1]s/Microsoft.Network/networkInterfaces/web-2-nic"}]}}}
+], "nextLink": "%[2]s%[1]s/Microsoft.Compute/virtualMachines?page=2"}`, group, server.URL)
+				return
+			}
+			fmt.Fprintf(w, `{"value": [
+{"name": "web-3", "location": "East US", "tags": {"Role": "web"}, "properties": {
+  "instanceView": {"statuses": [{"code": "PowerState/running", "displayStatus": "VM running"}]},
+  "networkProfile": {"networkInterfaces": [{"id": "%[1]s/Microsoft.Network/networkInterfaces/WEB-3-NIC"}]}}},
+{"name": "web-4", "location": "westeurope", "tags": {"Role": "web"}, "properties": {
+  "instanceView": {"statuses": [{"code": "PowerState/running", "displayStatus": "VM running"}]}}}
+]}`, group)
+		case group + "/Microsoft.Network/networkInterfaces":
+			fmt.Fprintf(w, `{"value": [
+{"id": "%[1]s/Microsoft.Network/networkInterfaces/web-1-nic", "properties": {"ipConfigurations": [
+  {"properties": {"primary": true, "privateIPAddress": "10.0.1.10", "publicIPAddress": {"id": "%[1]s/Microsoft.Network/publicIPAddresses/web-1-ip"}}}]}},
+{"id": "%[1]s/Microsoft.Network/networkInterfaces/web-2-nic", "properties": {"ipConfigurations": [{"properties": {"primary": true, "privateIPAddress": "10.0.1.11"}}]}},
+{"id": "%[1]s/Microsoft.Network/networkInterfaces/web-3-nic", "properties": {"ipConfigurations": [{"properties": {"primary": true, "privateIPAddress": "10.0.1.12"}}]}}
+]}`, group)
+		case group + "/Microsoft.Network/publicIPAddresses":
+			fmt.Fprintf(w, `{"value": [{"id": "%s/Microsoft.Network/publicIPAddresses/web-1-ip", "properties": {"ipAddress": "20.1.2.3"}}]}`, group)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "s3cret")
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+
+	provider := NewAzureInventoryProvider("sub-1", "my-rg", "eastus")
+	provider.SetEndpoint(server.URL)
+	targets, err := provider.Discover(context.Background(), "Role=web")
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	if len(targets) != 2 || targets[0].Host != "20.1.2.3" || targets[1].Host != "10.0.1.12" {
+		t.Fatalf("targets = %+v, want the running VMs of eastus", targets)
+	}
+	if labels := targets[0].Labels; labels["azure:vm-name"] != "web-1" || labels["azure:private-ip"] != "10.0.1.10" || labels["azure:power-state"] != "VM running" {
+		t.Errorf("labels = %v", labels)
+	}
+}
+
+func TestAzureInventoryProvider_DiscoverErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/token") {
+			fmt.Fprint(w, `{"access_token": "token-1"}`)
+			return
+		}
+		w.WriteHeader(http.StatusForbidden)
+		fmt.Fprint(w, `{"error": {"code": "AuthorizationFailed", "message": "not allowed"}}`)
+	}))
+	defer server.Close()
+	provider := NewAzureInventoryProvider("sub-1", "my-rg", "eastus")
+	provider.SetEndpoint(server.URL)
+
+	t.Setenv("AZURE_CLIENT_SECRET", "")
+	if _, err := provider.Discover(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "no Azure credentials") {
+		t.Errorf("Discover without credentials = %v", err)
+	}
+
+	t.Setenv("AZURE_TENANT_ID", "tenant-1")
+	t.Setenv("AZURE_CLIENT_ID", "client-1")
+	t.Setenv("AZURE_CLIENT_SECRET", "s3cret")
+	t.Setenv("AZURE_AUTHORITY_HOST", server.URL)
+	if _, err := provider.Discover(context.Background(), ""); err == nil || !strings.Contains(err.Error(), "AuthorizationFailed: not allowed") {
+		t.Errorf("Discover denied = %v", err)
 	}
 }
 
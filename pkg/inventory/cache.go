@@ -0,0 +1,123 @@
+package inventory
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultCacheDir is where discovered targets are kept between runs
+	DefaultCacheDir = ".chisel/inventory"
+	// DefaultCacheTTL is how long discovered targets are used before the
+	// provider is asked again
+	DefaultCacheTTL = 5 * time.Minute
+)
+
+// ScopedInventory is a dynamic inventory whose targets depend on more than
+// its type, such as the region or account it discovers in. The scope keeps
+// the cached targets of differently configured providers apart.
+type ScopedInventory interface {
+	DynamicInventory
+	Scope() string
+}
+
+// Discovery is the targets a provider discovered for a selector
+type Discovery struct {
+	Provider     string         `yaml:"provider"`
+	Scope        string         `yaml:"scope,omitempty"`
+	Selector     string         `yaml:"selector,omitempty"`
+	DiscoveredAt time.Time      `yaml:"discovered_at"`
+	Targets      []types.Target `yaml:"targets"`
+}
+
+// DiscoveryCache keeps discovered targets in files for a TTL, so repeated
+// runs against a cloud inventory do not ask its API every time. A zero TTL
+// turns the cache off.
+type DiscoveryCache struct {
+	dir string
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewDiscoveryCache creates a cache of discovered targets in a directory
+func NewDiscoveryCache(dir string, ttl time.Duration) *DiscoveryCache {
+	return &DiscoveryCache{dir: dir, ttl: ttl, now: time.Now}
+}
+
+// path returns the file the targets of a provider and selector are kept in
+func (c *DiscoveryCache) path(provider, scope, selector string) string {
+	sum := sha256.Sum256([]byte(scope + "\x00" + selector))
+	return filepath.Join(c.dir, provider+"-"+hex.EncodeToString(sum[:8])+".yaml")
+}
+
+// Get returns the cached targets of a provider and selector while they are
+// younger than the TTL
+func (c *DiscoveryCache) Get(provider, scope, selector string) (*Discovery, bool) {
+	if c == nil || c.ttl <= 0 {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(provider, scope, selector))
+	if err != nil {
+		return nil, false
+	}
+	var discovery Discovery
+	// A damaged cache file is discovered again and overwritten
+	if err := yaml.Unmarshal(data, &discovery); err != nil || discovery.Provider != provider || discovery.Scope != scope || discovery.Selector != selector {
+		return nil, false
+	}
+	if c.now().Sub(discovery.DiscoveredAt) >= c.ttl {
+		return nil, false
+	}
+	return &discovery, true
+}
+
+// Put stores the targets a provider discovered for a selector
+func (c *DiscoveryCache) Put(provider, scope, selector string, targets []types.Target) error {
+	if c == nil || c.ttl <= 0 {
+		return nil
+	}
+	data, err := yaml.Marshal(Discovery{Provider: provider, Scope: scope, Selector: selector, DiscoveredAt: c.now().UTC(), Targets: targets})
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s inventory: %w", provider, err)
+	}
+	if err := os.MkdirAll(c.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create inventory cache %s: %w", c.dir, err)
+	}
+	if err := os.WriteFile(c.path(provider, scope, selector), data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s inventory: %w", provider, err)
+	}
+	return nil
+}
+
+// Clear removes every cached discovery and returns how many there were
+func (c *DiscoveryCache) Clear() (int, error) {
+	if c == nil {
+		return 0, nil
+	}
+	entries, err := os.ReadDir(c.dir)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read inventory cache %s: %w", c.dir, err)
+	}
+	removed := 0
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".yaml") {
+			continue
+		}
+		if err := os.Remove(filepath.Join(c.dir, entry.Name())); err != nil {
+			return removed, fmt.Errorf("failed to clear inventory cache: %w", err)
+		}
+		removed++
+	}
+	return removed, nil
+}
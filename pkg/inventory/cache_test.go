@@ -0,0 +1,144 @@
+package inventory
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// countingInventory counts how often targets are discovered
+type countingInventory struct {
+	MockDynamicInventory
+	discoveries int
+}
+
+func (c *countingInventory) Discover(ctx context.Context, selector string) ([]types.Target, error) {
+	c.discoveries++
+	return c.MockDynamicInventory.Discover(ctx, selector)
+}
+
+func TestInventoryRegistry_Cache(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	cache := NewDiscoveryCache(t.TempDir(), time.Minute)
+	cache.now = func() time.Time { return now }
+	provider := &countingInventory{MockDynamicInventory: MockDynamicInventory{
+		inventoryType: "test",
+		targets: []types.Target{
+			{Host: "10.0.0.1", Labels: map[string]string{"role": "web"}},
+			{Host: "10.0.0.2", Labels: map[string]string{"role": "db"}},
+		},
+	}}
+	registry := NewInventoryRegistry()
+	registry.SetCache(cache)
+	if err := registry.Register(provider); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	first, err := registry.Discover(ctx, "test", "role=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now = now.Add(30 * time.Second)
+	second, err := registry.Discover(ctx, "test", "role=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if provider.discoveries != 1 || !reflect.DeepEqual(first, second) {
+		t.Errorf("cached Discover() asked the provider %d times and returned %v", provider.discoveries, second)
+	}
+
+	// Other selectors are cached apart
+	if db, err := registry.Discover(ctx, "test", "role=db"); err != nil || len(db) != 1 || db[0].Host != "10.0.0.2" {
+		t.Errorf("Discover(role=db) = %v, %v", db, err)
+	}
+
+	registry.SetRefresh(true)
+	if _, err := registry.Discover(ctx, "test", "role=web"); err != nil {
+		t.Fatal(err)
+	}
+	registry.SetRefresh(false)
+	now = now.Add(59 * time.Second)
+	if _, err := registry.Discover(ctx, "test", "role=web"); err != nil {
+		t.Fatal(err)
+	}
+	if provider.discoveries != 3 {
+		t.Errorf("refreshed targets were not cached again, %d discoveries", provider.discoveries)
+	}
+
+	now = now.Add(time.Minute)
+	if _, err := registry.Discover(ctx, "test", "role=web"); err != nil {
+		t.Fatal(err)
+	}
+	if provider.discoveries != 4 {
+		t.Errorf("expired targets were not discovered again, %d discoveries", provider.discoveries)
+	}
+
+	if removed, err := cache.Clear(); err != nil || removed != 2 {
+		t.Errorf("Clear() = %d, %v, want 2 discoveries removed", removed, err)
+	}
+	if _, ok := cache.Get("test", "", "role=web"); ok {
+		t.Error("cleared targets are still cached")
+	}
+}
+
+func TestInventory_Discover(t *testing.T) {
+	inv := &Inventory{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Inventory",
+		Targets: map[string]TargetGroup{
+			"web": {
+				Selector:   "Role=web",
+				Discover:   &DiscoverConfig{Provider: "aws", Region: "eu-west-1"},
+				Connection: ssh.ConnectionConfig{User: "ec2-user", Port: 22, PrivateKeyPath: "~/.ssh/id_ed25519"},
+				Labels:     map[string]string{"env": "production"},
+			},
+		},
+	}
+	if err := inv.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	// The targets are taken from the cache, as the provider cannot be reached
+	cache := NewDiscoveryCache(t.TempDir(), time.Minute)
+	scope := NewAWSInventoryProvider("eu-west-1", "", "").Scope()
+	if err := cache.Put("aws", scope, "Role=web", []types.Target{
+		{Host: "203.0.113.1", Labels: map[string]string{"Role": "web", "env": "staging"}},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := inv.Discover(context.Background(), DiscoverOptions{Cache: cache}); err != nil {
+		t.Fatalf("Discover() error = %v", err)
+	}
+	hosts := inv.ResolveHosts()
+	if len(hosts) != 1 || hosts[0].Name != "203.0.113.1" || !reflect.DeepEqual(hosts[0].Labels, map[string]string{"Role": "web", "env": "production"}) {
+		t.Errorf("ResolveHosts() = %+v", hosts)
+	}
+	if err := inv.Validate(); err != nil {
+		t.Errorf("Validate() of the discovered inventory error = %v", err)
+	}
+
+	if err := inv.Discover(context.Background(), DiscoverOptions{Cache: cache, Refresh: true}); err == nil {
+		t.Error("Discover() with refresh used the cache")
+	}
+}
+
+func TestTargetGroup_ValidateDiscover(t *testing.T) {
+	tests := []struct {
+		name  string
+		group TargetGroup
+	}{
+		{name: "hosts", group: TargetGroup{Hosts: []string{"web1"}, Discover: &DiscoverConfig{Provider: "aws", Region: "eu-west-1"}}},
+		{name: "unknown provider", group: TargetGroup{Discover: &DiscoverConfig{Provider: "gcp"}}},
+		{name: "no region", group: TargetGroup{Discover: &DiscoverConfig{Provider: "aws"}}},
+	}
+	for _, tt := range tests {
+		if err := tt.group.Validate("web"); err == nil {
+			t.Errorf("%s: Validate() accepted the group", tt.name)
+		}
+	}
+}
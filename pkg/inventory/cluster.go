@@ -0,0 +1,37 @@
+package inventory
+
+import "fmt"
+
+// ClusterConfig marks a target group as members of a clustered service, such as
+// etcd or patroni, so applies can keep the cluster quorate
+type ClusterConfig struct {
+	// LeaderProbe runs on every member before apply and exits 0 on the current leader
+	LeaderProbe string `yaml:"leader_probe,omitempty" json:"leader_probe,omitempty"`
+
+	// Quorum is the number of members that must stay available. Zero means a
+	// majority of the group.
+	Quorum int `yaml:"quorum,omitempty" json:"quorum,omitempty"`
+}
+
+// Validate validates the cluster configuration for a group of the given size
+func (c *ClusterConfig) Validate(members int) error {
+	// Zero is a quorum left out; one of every member could never take one down
+	if c.Quorum < 0 || (c.Quorum > 0 && c.Quorum >= members) {
+		return fmt.Errorf("cluster quorum must be between 1 and %d, or left out for a majority, got %d", members-1, c.Quorum)
+	}
+	return nil
+}
+
+// QuorumSize returns the number of members that must stay available
+func (c *ClusterConfig) QuorumSize(members int) int {
+	if c.Quorum > 0 {
+		return c.Quorum
+	}
+	return members/2 + 1
+}
+
+// MaxUnavailable returns how many members may be taken down at once without
+// losing quorum, given how many are already down
+func (c *ClusterConfig) MaxUnavailable(members, down int) int {
+	return members - c.QuorumSize(members) - down
+}
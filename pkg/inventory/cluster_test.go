@@ -0,0 +1,46 @@
+package inventory
+
+import "testing"
+
+func TestClusterConfig_MaxUnavailable(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ClusterConfig
+		members int
+		down    int
+		want    int
+	}{
+		{name: "three members", members: 3, want: 1},
+		{name: "four members", members: 4, want: 1},
+		{name: "five members", members: 5, want: 2},
+		{name: "five members one down", members: 5, down: 1, want: 1},
+		{name: "three members one down", members: 3, down: 1, want: 0},
+		{name: "explicit quorum", config: ClusterConfig{Quorum: 2}, members: 5, want: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.MaxUnavailable(tt.members, tt.down); got != tt.want {
+				t.Errorf("MaxUnavailable() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClusterConfig_Validate(t *testing.T) {
+	if err := (&ClusterConfig{Quorum: 4}).Validate(3); err == nil {
+		t.Error("Expected error for quorum larger than the group")
+	}
+	if err := (&ClusterConfig{Quorum: 3}).Validate(3); err == nil {
+		t.Error("Expected error for quorum of every member")
+	}
+	if err := (&ClusterConfig{Quorum: 2}).Validate(3); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+	if err := (&ClusterConfig{Quorum: -1}).Validate(3); err == nil {
+		t.Error("Expected error for negative quorum")
+	}
+	if err := (&ClusterConfig{LeaderProbe: "true"}).Validate(3); err != nil {
+		t.Errorf("Validate() error = %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"context"
+	"fmt"
+)
+
+// DiscoverConfig discovers the hosts of a target group from a cloud
+// provider. The group's selector picks the instances by their tags.
+type DiscoverConfig struct {
+	// Provider is aws or azure
+	Provider string `yaml:"provider"`
+	Region   string `yaml:"region,omitempty"`
+	// Profile and RoleARN are the AWS credentials to discover with
+	Profile string `yaml:"profile,omitempty"`
+	RoleARN string `yaml:"role_arn,omitempty"`
+	// SubscriptionID and ResourceGroup are the Azure VMs to discover
+	SubscriptionID string `yaml:"subscription_id,omitempty"`
+	ResourceGroup  string `yaml:"resource_group,omitempty"`
+	// Endpoint is the base URL of the EC2 or Azure Resource Manager API,
+	// for a VPC endpoint, LocalStack or a sovereign cloud
+	Endpoint string `yaml:"endpoint,omitempty"`
+}
+
+// inventory returns the dynamic inventory the settings describe
+func (c DiscoverConfig) inventory() (DynamicInventory, error) {
+	switch c.Provider {
+	case "aws":
+		provider := NewAWSInventoryProvider(c.Region, c.Profile, c.RoleARN)
+		provider.SetEndpoint(c.Endpoint)
+		return provider, nil
+	case "azure":
+		provider := NewAzureInventoryProvider(c.SubscriptionID, c.ResourceGroup, c.Region)
+		provider.SetEndpoint(c.Endpoint)
+		return provider, nil
+	default:
+		return nil, fmt.Errorf("unknown discover provider '%s', must be aws or azure", c.Provider)
+	}
+}
+
+// Validate checks the discovery settings
+func (c DiscoverConfig) Validate() error {
+	provider, err := c.inventory()
+	if err != nil {
+		return err
+	}
+	return provider.Validate()
+}
+
+// DiscoverOptions controls how the hosts of discovered groups are found
+type DiscoverOptions struct {
+	// Cache keeps discovered targets between runs; nil always discovers
+	Cache *DiscoveryCache
+	// Refresh discovers again, replacing the cached targets
+	Refresh bool
+}
+
+// Discover fills in the hosts of the groups with discover settings, from
+// their provider or from the cache while it is fresh. The tags of each
+// discovered instance become its labels, under the group's own labels.
+func (i *Inventory) Discover(ctx context.Context, options DiscoverOptions) error {
+	for _, name := range i.GroupNames() {
+		group := i.Targets[name]
+		if group.Discover == nil {
+			continue
+		}
+		provider, err := group.Discover.inventory()
+		if err != nil {
+			return fmt.Errorf("target group '%s': %w", name, err)
+		}
+		registry := NewInventoryRegistry()
+		registry.SetCache(options.Cache)
+		registry.SetRefresh(options.Refresh)
+		if err := registry.Register(provider); err != nil {
+			return fmt.Errorf("target group '%s': %w", name, err)
+		}
+		targets, err := registry.Discover(ctx, provider.Type(), group.Selector)
+		if err != nil {
+			return fmt.Errorf("target group '%s': failed to discover hosts: %w", name, err)
+		}
+
+		group.Hosts = make([]string, 0, len(targets))
+		group.hostLabels = make(map[string]map[string]string, len(targets))
+		for _, target := range targets {
+			group.Hosts = append(group.Hosts, target.Host)
+			group.hostLabels[target.Host] = target.Labels
+		}
+		i.Targets[name] = group
+	}
+	return nil
+}
+
+// labelsOf returns the labels of a host of the group: those discovered for
+// it, overridden by the group's
+func (tg *TargetGroup) labelsOf(host string) map[string]string {
+	discovered := tg.hostLabels[host]
+	if len(discovered) == 0 {
+		return tg.Labels
+	}
+	labels := make(map[string]string, len(discovered)+len(tg.Labels))
+	for key, value := range discovered {
+		labels[key] = value
+	}
+	for key, value := range tg.Labels {
+		labels[key] = value
+	}
+	return labels
+}
@@ -23,6 +23,8 @@ type DynamicInventory interface {
 // InventoryRegistry manages dynamic inventory providers
 type InventoryRegistry struct {
 	providers map[string]DynamicInventory
+	cache     *DiscoveryCache
+	refresh   bool
 }
 
 // NewInventoryRegistry creates a new inventory registry
@@ -51,14 +53,43 @@ func (r *InventoryRegistry) Register(provider DynamicInventory) error {
 	return nil
 }
 
-// Discover discovers targets using the specified provider and selector
+// SetCache has discovered targets kept in a cache and used while they are
+// fresh
+func (r *InventoryRegistry) SetCache(cache *DiscoveryCache) {
+	r.cache = cache
+}
+
+// SetRefresh has every discovery ask its provider again, replacing what is
+// cached
+func (r *InventoryRegistry) SetRefresh(refresh bool) {
+	r.refresh = refresh
+}
+
+// Discover discovers targets using the specified provider and selector,
+// from the cache while the targets last discovered are fresh
 func (r *InventoryRegistry) Discover(ctx context.Context, providerType, selector string) ([]types.Target, error) {
 	provider, exists := r.providers[providerType]
 	if !exists {
 		return nil, fmt.Errorf("no provider found for type: %s", providerType)
 	}
-	
-	return provider.Discover(ctx, selector)
+
+	var scope string
+	if scoped, ok := provider.(ScopedInventory); ok {
+		scope = scoped.Scope()
+	}
+	if !r.refresh {
+		if discovery, ok := r.cache.Get(providerType, scope, selector); ok {
+			return discovery.Targets, nil
+		}
+	}
+	targets, err := provider.Discover(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.cache.Put(providerType, scope, selector, targets); err != nil {
+		return nil, err
+	}
+	return targets, nil
 }
 
 // ListProviders returns a list of registered provider types
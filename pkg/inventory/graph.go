@@ -0,0 +1,51 @@
+package inventory
+
+// Graph is the group membership of an inventory's hosts: the groups with
+// the hosts they list, and each host with every group it belongs to
+type Graph struct {
+	Groups []GraphGroup `json:"groups"`
+	Hosts  []GraphHost  `json:"hosts"`
+}
+
+// GraphGroup is a target group and its member hosts
+type GraphGroup struct {
+	Name   string            `json:"name"`
+	Labels map[string]string `json:"labels,omitempty"`
+	// Discover names the provider the group's hosts are discovered with
+	Discover string   `json:"discover,omitempty"`
+	Hosts    []string `json:"hosts"`
+}
+
+// GraphHost is a host and the groups it belongs to
+type GraphHost struct {
+	Name string `json:"name"`
+	// Group is the group its connection settings come from
+	Group  string            `json:"group"`
+	Groups []string          `json:"groups"`
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// NewGraph builds the membership graph of resolved hosts. Groups none of
+// the hosts belong to are left out, so a graph of selected hosts shows only
+// the groups that matter to them.
+func NewGraph(i *Inventory, hosts []Host) *Graph {
+	graph := &Graph{Groups: []GraphGroup{}, Hosts: make([]GraphHost, 0, len(hosts))}
+	members := make(map[string][]string)
+	for _, host := range hosts {
+		graph.Hosts = append(graph.Hosts, GraphHost{Name: host.Name, Group: host.Group, Groups: host.Groups, Labels: host.Labels})
+		for _, group := range host.Groups {
+			members[group] = append(members[group], host.Name)
+		}
+	}
+	for _, name := range i.GroupNames() {
+		if len(members[name]) == 0 {
+			continue
+		}
+		group := GraphGroup{Name: name, Labels: i.Targets[name].Labels, Hosts: members[name]}
+		if discover := i.Targets[name].Discover; discover != nil {
+			group.Discover = discover.Provider
+		}
+		graph.Groups = append(graph.Groups, group)
+	}
+	return graph
+}
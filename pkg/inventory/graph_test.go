@@ -0,0 +1,56 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+func TestNewGraph(t *testing.T) {
+	inv := &Inventory{
+		Targets: map[string]TargetGroup{
+			"db": {
+				Hosts:  []string{"db1"},
+				Labels: map[string]string{"role": "db"},
+			},
+			"prod": {
+				Hosts:  []string{"web1", "db1"},
+				Labels: map[string]string{"env": "production"},
+			},
+			"web": {
+				Hosts:      []string{"web1", "web2"},
+				Connection: ssh.ConnectionConfig{User: "ubuntu"},
+				Labels:     map[string]string{"role": "web"},
+			},
+		},
+	}
+	hosts, _, err := inv.Resolve()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph := NewGraph(inv, hosts)
+	wantGroups := []GraphGroup{
+		{Name: "db", Labels: map[string]string{"role": "db"}, Hosts: []string{"db1"}},
+		{Name: "prod", Labels: map[string]string{"env": "production"}, Hosts: []string{"db1", "web1"}},
+		{Name: "web", Labels: map[string]string{"role": "web"}, Hosts: []string{"web1", "web2"}},
+	}
+	if !reflect.DeepEqual(graph.Groups, wantGroups) {
+		t.Errorf("Groups = %+v, want %+v", graph.Groups, wantGroups)
+	}
+	if len(graph.Hosts) != 3 || graph.Hosts[0].Name != "db1" || !reflect.DeepEqual(graph.Hosts[0].Groups, []string{"db", "prod"}) {
+		t.Errorf("Hosts = %+v", graph.Hosts)
+	}
+
+	// Selected hosts leave the groups none of them belong to out
+	selector, err := ParseLabelSelector("role=web")
+	if err != nil {
+		t.Fatal(err)
+	}
+	selected := SelectByLabels(hosts, selector)
+	graph = NewGraph(inv, selected)
+	if len(graph.Hosts) != 2 || len(graph.Groups) != 2 || graph.Groups[0].Name != "prod" || !reflect.DeepEqual(graph.Groups[0].Hosts, []string{"web1"}) {
+		t.Errorf("graph of web hosts = %+v", graph)
+	}
+}
@@ -0,0 +1,235 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultHealthWindow is the number of recent runs kept per host
+	DefaultHealthWindow = 20
+
+	// FlapThreshold is the number of success/failure transitions within the
+	// window at which a host is considered flapping
+	FlapThreshold = 3
+
+	// referenceLatency is the run duration at which the latency component of
+	// the score is halved
+	referenceLatency = 10 * time.Second
+
+	// unknownHealthScore is the score of hosts without history, so they run
+	// after proven hosts but before unhealthy ones
+	unknownHealthScore = 50
+)
+
+// HealthSample records the outcome of a single run on a host
+type HealthSample struct {
+	Time    time.Time     `yaml:"time" json:"time"`
+	Success bool          `yaml:"success" json:"success"`
+	Latency time.Duration `yaml:"latency" json:"latency"`
+}
+
+// HealthScore summarizes the recent history of a host. Score ranges from 0
+// to 100 and weighs success rate over latency.
+type HealthScore struct {
+	Host           string        `json:"host"`
+	Samples        int           `json:"samples"`
+	SuccessRate    float64       `json:"success_rate"`
+	AverageLatency time.Duration `json:"average_latency"`
+	Transitions    int           `json:"transitions"`
+	Flapping       bool          `json:"flapping"`
+	Score          float64       `json:"score"`
+	LastSeen       time.Time     `json:"last_seen,omitempty"`
+}
+
+// SchedulingPreference controls the order in which hosts are scheduled
+type SchedulingPreference struct {
+	// HealthiestFirst schedules hosts with higher scores first
+	HealthiestFirst bool `yaml:"healthiest_first" json:"healthiest_first"`
+
+	// DeferFlapping moves flapping hosts to the end of the schedule
+	DeferFlapping bool `yaml:"defer_flapping" json:"defer_flapping"`
+}
+
+// HealthTracker keeps a sliding window of run outcomes per host
+type HealthTracker struct {
+	mu       sync.RWMutex
+	window   int
+	samples  map[string][]HealthSample
+	filePath string
+}
+
+// NewHealthTracker creates an empty in-memory tracker keeping window samples per host
+func NewHealthTracker(window int) *HealthTracker {
+	if window <= 0 {
+		window = DefaultHealthWindow
+	}
+	return &HealthTracker{
+		window:  window,
+		samples: make(map[string][]HealthSample),
+	}
+}
+
+// LoadHealthTracker loads host health history from a YAML file. A missing
+// file yields an empty tracker that will be created on Save.
+func LoadHealthTracker(filename string, window int) (*HealthTracker, error) {
+	tracker := NewHealthTracker(window)
+	tracker.filePath = filename
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return tracker, nil
+		}
+		return nil, fmt.Errorf("failed to read health file %s: %w", filename, err)
+	}
+
+	var samples map[string][]HealthSample
+	if err := yaml.Unmarshal(data, &samples); err != nil {
+		return nil, fmt.Errorf("failed to parse health file %s: %w", filename, err)
+	}
+
+	for host, history := range samples {
+		tracker.samples[host] = tracker.trim(history)
+	}
+
+	return tracker, nil
+}
+
+// Save writes the health history back to the file it was loaded from
+func (t *HealthTracker) Save() error {
+	if t.filePath == "" {
+		return fmt.Errorf("health tracker has no backing file")
+	}
+	return t.SaveToFile(t.filePath)
+}
+
+// SaveToFile writes the health history to a YAML file
+func (t *HealthTracker) SaveToFile(filename string) error {
+	t.mu.RLock()
+	data, err := yaml.Marshal(t.samples)
+	t.mu.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed to marshal health history: %w", err)
+	}
+
+	if dir := filepath.Dir(filename); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", filename, err)
+		}
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write health file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// Record adds the outcome of a run on a host, dropping the oldest sample
+// once the window is full
+func (t *HealthTracker) Record(host string, success bool, latency time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	history := append(t.samples[host], HealthSample{
+		Time:    time.Now(),
+		Success: success,
+		Latency: latency,
+	})
+	t.samples[host] = t.trim(history)
+}
+
+// Score computes the health score of a host from its recent history
+func (t *HealthTracker) Score(host string) HealthScore {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	return scoreSamples(host, t.samples[host])
+}
+
+// Scores returns the health score of every tracked host, sorted by host
+func (t *HealthTracker) Scores() []HealthScore {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	scores := make([]HealthScore, 0, len(t.samples))
+	for host, history := range t.samples {
+		scores = append(scores, scoreSamples(host, history))
+	}
+	sort.Slice(scores, func(i, j int) bool {
+		return scores[i].Host < scores[j].Host
+	})
+	return scores
+}
+
+// Order returns hosts in scheduling order for the given preference. The
+// sort is stable, so hosts with equal standing keep their inventory order.
+func (t *HealthTracker) Order(hosts []Host, pref SchedulingPreference) []Host {
+	ordered := make([]Host, len(hosts))
+	copy(ordered, hosts)
+	if !pref.HealthiestFirst && !pref.DeferFlapping {
+		return ordered
+	}
+
+	scores := make(map[string]HealthScore, len(hosts))
+	for _, host := range hosts {
+		scores[host.Name] = t.Score(host.Name)
+	}
+
+	sort.SliceStable(ordered, func(i, j int) bool {
+		a, b := scores[ordered[i].Name], scores[ordered[j].Name]
+		if pref.DeferFlapping && a.Flapping != b.Flapping {
+			return !a.Flapping
+		}
+		if pref.HealthiestFirst {
+			return a.Score > b.Score
+		}
+		return false
+	})
+	return ordered
+}
+
+// trim keeps only the most recent window samples
+func (t *HealthTracker) trim(history []HealthSample) []HealthSample {
+	if len(history) <= t.window {
+		return history
+	}
+	return append([]HealthSample(nil), history[len(history)-t.window:]...)
+}
+
+// scoreSamples summarizes a host's history into a health score
+func scoreSamples(host string, history []HealthSample) HealthScore {
+	score := HealthScore{Host: host, Samples: len(history)}
+	if len(history) == 0 {
+		score.Score = unknownHealthScore
+		return score
+	}
+
+	successes := 0
+	var totalLatency time.Duration
+	for i, sample := range history {
+		if sample.Success {
+			successes++
+		}
+		totalLatency += sample.Latency
+		if i > 0 && sample.Success != history[i-1].Success {
+			score.Transitions++
+		}
+	}
+
+	score.SuccessRate = float64(successes) / float64(len(history))
+	score.AverageLatency = totalLatency / time.Duration(len(history))
+	score.Flapping = score.Transitions >= FlapThreshold
+	score.LastSeen = history[len(history)-1].Time
+
+	latencyFactor := float64(referenceLatency) / float64(referenceLatency+score.AverageLatency)
+	score.Score = 80*score.SuccessRate + 20*latencyFactor
+	return score
+}
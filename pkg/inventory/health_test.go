@@ -0,0 +1,124 @@
+package inventory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestHealthTracker_Score(t *testing.T) {
+	tests := []struct {
+		name         string
+		outcomes     []bool
+		latency      time.Duration
+		wantRate     float64
+		wantFlapping bool
+		minScore     float64
+		maxScore     float64
+	}{
+		{name: "no history", outcomes: nil, minScore: 50, maxScore: 50},
+		{name: "always succeeds fast", outcomes: []bool{true, true, true}, latency: 0, wantRate: 1, minScore: 100, maxScore: 100},
+		{name: "always succeeds slowly", outcomes: []bool{true, true}, latency: 10 * time.Second, wantRate: 1, minScore: 90, maxScore: 90},
+		{name: "always fails", outcomes: []bool{false, false}, latency: 0, wantRate: 0, minScore: 20, maxScore: 20},
+		{name: "flapping", outcomes: []bool{true, false, true, false}, latency: 0, wantRate: 0.5, wantFlapping: true, minScore: 60, maxScore: 60},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tracker := NewHealthTracker(0)
+			for _, success := range tt.outcomes {
+				tracker.Record("web1", success, tt.latency)
+			}
+
+			score := tracker.Score("web1")
+			if score.Samples != len(tt.outcomes) {
+				t.Errorf("Samples = %d, want %d", score.Samples, len(tt.outcomes))
+			}
+			if score.SuccessRate != tt.wantRate {
+				t.Errorf("SuccessRate = %v, want %v", score.SuccessRate, tt.wantRate)
+			}
+			if score.Flapping != tt.wantFlapping {
+				t.Errorf("Flapping = %v, want %v", score.Flapping, tt.wantFlapping)
+			}
+			if score.Score < tt.minScore || score.Score > tt.maxScore {
+				t.Errorf("Score = %v, want between %v and %v", score.Score, tt.minScore, tt.maxScore)
+			}
+		})
+	}
+}
+
+func TestHealthTracker_Window(t *testing.T) {
+	tracker := NewHealthTracker(3)
+	tracker.Record("web1", false, 0)
+	for i := 0; i < 3; i++ {
+		tracker.Record("web1", true, 0)
+	}
+
+	score := tracker.Score("web1")
+	if score.Samples != 3 || score.SuccessRate != 1 {
+		t.Errorf("Expected old failure to fall out of the window, got %+v", score)
+	}
+}
+
+func TestHealthTracker_Order(t *testing.T) {
+	tracker := NewHealthTracker(0)
+	for _, success := range []bool{true, false, true, false} {
+		tracker.Record("flappy", success, 0)
+	}
+	tracker.Record("good", true, 0)
+	tracker.Record("bad", false, 0)
+
+	hosts := []Host{{Name: "bad"}, {Name: "flappy"}, {Name: "new"}, {Name: "good"}}
+
+	tests := []struct {
+		name string
+		pref SchedulingPreference
+		want []string
+	}{
+		{name: "no preference", pref: SchedulingPreference{}, want: []string{"bad", "flappy", "new", "good"}},
+		{name: "healthiest first", pref: SchedulingPreference{HealthiestFirst: true}, want: []string{"good", "flappy", "new", "bad"}},
+		{name: "defer flapping", pref: SchedulingPreference{DeferFlapping: true}, want: []string{"bad", "new", "good", "flappy"}},
+		{name: "both", pref: SchedulingPreference{HealthiestFirst: true, DeferFlapping: true}, want: []string{"good", "new", "bad", "flappy"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ordered := tracker.Order(hosts, tt.pref)
+			for i, host := range ordered {
+				if host.Name != tt.want[i] {
+					t.Fatalf("Order() = %v, want %v", ordered, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestHealthTracker_SaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", "health.yaml")
+
+	tracker, err := LoadHealthTracker(filename, 0)
+	if err != nil {
+		t.Fatalf("LoadHealthTracker() error = %v", err)
+	}
+	tracker.Record("web1", true, 2*time.Second)
+	tracker.Record("web2", false, time.Second)
+	if err := tracker.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	loaded, err := LoadHealthTracker(filename, 0)
+	if err != nil {
+		t.Fatalf("LoadHealthTracker() error = %v", err)
+	}
+	scores := loaded.Scores()
+	if len(scores) != 2 || scores[0].Host != "web1" || scores[1].Host != "web2" {
+		t.Fatalf("Scores() = %+v", scores)
+	}
+	if scores[0].AverageLatency != 2*time.Second || scores[1].SuccessRate != 0 {
+		t.Errorf("Unexpected loaded scores %+v", scores)
+	}
+
+	if err := NewHealthTracker(0).Save(); err == nil {
+		t.Error("Expected error saving tracker without backing file")
+	}
+}
@@ -3,7 +3,9 @@ package inventory
 import (
 	"fmt"
 	"os"
+	"sort"
 
+	"github.com/ataiva-software/forge/pkg/snapshot"
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"gopkg.in/yaml.v3"
 )
@@ -13,6 +15,9 @@ type Inventory struct {
 	APIVersion string                 `yaml:"apiVersion"`
 	Kind       string                 `yaml:"kind"`
 	Targets    map[string]TargetGroup `yaml:"targets"`
+	// Merge is the strategy for hosts listed by several groups: first
+	// (default), last or error
+	Merge string `yaml:"merge,omitempty"`
 }
 
 // TargetGroup represents a group of target hosts
@@ -20,6 +25,33 @@ type TargetGroup struct {
 	Hosts      []string              `yaml:"hosts,omitempty"`
 	Selector   string                `yaml:"selector,omitempty"`
 	Connection ssh.ConnectionConfig  `yaml:"connection"`
+	Cluster    *ClusterConfig        `yaml:"cluster,omitempty"`
+	Labels     map[string]string     `yaml:"labels,omitempty"`
+	// Snapshot snapshots the group's VMs before applies whose plan is risky
+	Snapshot *snapshot.Config `yaml:"snapshot,omitempty"`
+	// Discover finds the group's hosts with a cloud provider instead of
+	// listing them
+	Discover *DiscoverConfig `yaml:"discover,omitempty"`
+
+	// hostLabels are the labels of discovered hosts
+	hostLabels map[string]map[string]string
+}
+
+// LocalGroup is the target group of the inventory returned by Local
+const LocalGroup = "local"
+
+// Local returns an inventory of the machine forge runs on, reached without SSH
+func Local() *Inventory {
+	return &Inventory{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Inventory",
+		Targets: map[string]TargetGroup{
+			LocalGroup: {
+				Hosts:      []string{"localhost"},
+				Connection: ssh.ConnectionConfig{Transport: ssh.TransportLocal},
+			},
+		},
+	}
 }
 
 // Validate validates the inventory configuration
@@ -45,34 +77,64 @@ func (i *Inventory) Validate() error {
 		return fmt.Errorf("at least one target group is required")
 	}
 
-	for name, group := range i.Targets {
+	for _, name := range i.GroupNames() {
+		group := i.Targets[name]
 		if err := group.Validate(name); err != nil {
 			return err
 		}
 	}
 
-	return nil
+	return validateMerge(i.Merge)
 }
 
 // Validate validates a target group
 func (tg *TargetGroup) Validate(name string) error {
-	// Must have either hosts or selector, but not both
+	// Must have either hosts or selector, but not both; discovered groups
+	// have their hosts filled in, and select them with the selector
 	hasHosts := len(tg.Hosts) > 0
 	hasSelector := tg.Selector != ""
+	discovered := tg.hostLabels != nil
 
-	if hasHosts && hasSelector {
+	if tg.Discover != nil {
+		if hasHosts && !discovered {
+			return fmt.Errorf("target group '%s': cannot specify both hosts and discover", name)
+		}
+		if err := tg.Discover.Validate(); err != nil {
+			return fmt.Errorf("target group '%s': %w", name, err)
+		}
+	} else if hasHosts && hasSelector {
 		return fmt.Errorf("target group '%s': cannot specify both hosts and selector", name)
-	}
-
-	if !hasHosts && !hasSelector {
+	} else if !hasHosts && !hasSelector {
 		return fmt.Errorf("target group '%s': must specify either hosts or selector", name)
 	}
 
-	// Validate connection config
-	if err := tg.Connection.Validate(); err != nil {
+	// Validate connection config; hosts listed in the group supply the host
+	connection := tg.Connection
+	if connection.Host == "" && hasHosts {
+		connection.Host = tg.Hosts[0]
+	} else if connection.Host == "" && tg.Discover != nil {
+		// Discovered hosts are not known until the group is discovered
+		connection.Host = name
+	}
+	if err := connection.Validate(); err != nil {
 		return fmt.Errorf("target group '%s': %w", name, err)
 	}
 
+	if tg.Cluster != nil {
+		if !hasHosts {
+			return fmt.Errorf("target group '%s': cluster groups must list their hosts", name)
+		}
+		if err := tg.Cluster.Validate(len(tg.Hosts)); err != nil {
+			return fmt.Errorf("target group '%s': %w", name, err)
+		}
+	}
+
+	if tg.Snapshot != nil {
+		if err := tg.Snapshot.Validate(); err != nil {
+			return fmt.Errorf("target group '%s': %w", name, err)
+		}
+	}
+
 	return nil
 }
 
@@ -127,3 +189,46 @@ func (i *Inventory) SaveToFile(filename string) error {
 
 	return nil
 }
+
+// GroupNames returns the target group names in sorted order
+func (i *Inventory) GroupNames() []string {
+	names := make([]string, 0, len(i.Targets))
+	for name := range i.Targets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Host is a single statically-declared host with its effective connection settings
+type Host struct {
+	Name       string
+	Group      string
+	Connection ssh.ConnectionConfig
+	Labels     map[string]string
+	// Groups lists every group the host belongs to once merged; Group is
+	// the one its settings come from
+	Groups []string
+}
+
+// ResolveHosts returns every statically-declared host in the inventory,
+// ordered by group name and then by position within the group
+func (i *Inventory) ResolveHosts() []Host {
+	var hosts []Host
+	for _, groupName := range i.GroupNames() {
+		group := i.Targets[groupName]
+		for _, hostName := range group.Hosts {
+			connection := group.Connection
+			connection.Host = hostName
+			hosts = append(hosts, Host{
+				Name:       hostName,
+				Group:      groupName,
+				Connection: connection,
+				Labels:     group.labelsOf(hostName),
+				Groups:     []string{groupName},
+			})
+		}
+	}
+
+	return hosts
+}
@@ -3,6 +3,7 @@ package inventory
 import (
 	"testing"
 
+	"github.com/ataiva-software/forge/pkg/snapshot"
 	"github.com/ataiva-software/forge/pkg/ssh"
 )
 
@@ -135,6 +136,39 @@ func TestInventory_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "target group 'webservers': must specify either hosts or selector",
 		},
+		{
+			name: "docker group takes host from hosts list",
+			inventory: Inventory{
+				APIVersion: "ataiva.com/chisel/v1",
+				Kind:       "Inventory",
+				Targets: map[string]TargetGroup{
+					"containers": {
+						Hosts: []string{"web-1", "web-2"},
+						Connection: ssh.ConnectionConfig{
+							Transport: ssh.TransportDocker,
+							User:      "app",
+						},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid snapshot config",
+			inventory: Inventory{
+				APIVersion: "ataiva.com/chisel/v1",
+				Kind:       "Inventory",
+				Targets: map[string]TargetGroup{
+					"db": {
+						Hosts:      []string{"db1"},
+						Connection: ssh.ConnectionConfig{User: "ubuntu", Port: 22, PrivateKeyPath: "~/.ssh/id_rsa"},
+						Snapshot:   &snapshot.Config{Provider: "xen"},
+					},
+				},
+			},
+			wantErr: true,
+			errMsg:  "target group 'db': unknown snapshot provider 'xen', must be one of: command, proxmox, vsphere, aws",
+		},
 	}
 
 	for _, tt := range tests {
@@ -241,3 +275,79 @@ func TestTargetGroup_GetHosts(t *testing.T) {
 		})
 	}
 }
+
+func TestInventory_ResolveHosts(t *testing.T) {
+	inv := &Inventory{
+		Targets: map[string]TargetGroup{
+			"web": {
+				Hosts:      []string{"web1", "web2"},
+				Connection: ssh.ConnectionConfig{Host: "ignored", User: "ubuntu", Port: 2222},
+			},
+			"db": {
+				Hosts:      []string{"db1"},
+				Connection: ssh.ConnectionConfig{User: "admin"},
+			},
+			"dynamic": {
+				Selector: "role=cache",
+			},
+		},
+	}
+
+	hosts := inv.ResolveHosts()
+	if len(hosts) != 3 {
+		t.Fatalf("Expected 3 hosts, got %d", len(hosts))
+	}
+
+	want := []struct{ name, group, user string }{
+		{"db1", "db", "admin"},
+		{"web1", "web", "ubuntu"},
+		{"web2", "web", "ubuntu"},
+	}
+	for i, w := range want {
+		if hosts[i].Name != w.name || hosts[i].Group != w.group {
+			t.Errorf("hosts[%d] = %s/%s, want %s/%s", i, hosts[i].Group, hosts[i].Name, w.group, w.name)
+		}
+		if hosts[i].Connection.Host != w.name {
+			t.Errorf("hosts[%d] connection host = %s, want %s", i, hosts[i].Connection.Host, w.name)
+		}
+		if hosts[i].Connection.User != w.user {
+			t.Errorf("hosts[%d] connection user = %s, want %s", i, hosts[i].Connection.User, w.user)
+		}
+	}
+	if hosts[1].Connection.Port != 2222 {
+		t.Errorf("Expected group port to carry over, got %d", hosts[1].Connection.Port)
+	}
+}
+
+func TestInventory_GroupNames(t *testing.T) {
+	inv := &Inventory{
+		Targets: map[string]TargetGroup{
+			"web":   {Hosts: []string{"web1"}},
+			"db":    {Hosts: []string{"db1"}},
+			"cache": {Hosts: []string{"cache1"}},
+		},
+	}
+
+	names := inv.GroupNames()
+	want := []string{"cache", "db", "web"}
+	for i := range want {
+		if names[i] != want[i] {
+			t.Errorf("GroupNames()[%d] = %s, want %s", i, names[i], want[i])
+		}
+	}
+}
+
+func TestLocal(t *testing.T) {
+	inv := Local()
+	if err := inv.Validate(); err != nil {
+		t.Fatalf("Validate() error = %v", err)
+	}
+
+	hosts := inv.ResolveHosts()
+	if len(hosts) != 1 || hosts[0].Name != "localhost" || hosts[0].Group != LocalGroup {
+		t.Fatalf("ResolveHosts() = %+v", hosts)
+	}
+	if hosts[0].Connection.TransportName() != ssh.TransportLocal {
+		t.Errorf("Expected the local transport, got %s", hosts[0].Connection.TransportName())
+	}
+}
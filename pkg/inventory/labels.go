@@ -0,0 +1,112 @@
+package inventory
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// LabelSelector picks hosts by their labels, such as
+// os_family=redhat AND cloud=aws. Every term must hold: key=value and
+// key!=value compare a label, and a bare key requires the label to be set.
+type LabelSelector struct {
+	terms []labelTerm
+}
+
+type labelTerm struct {
+	key    string
+	value  string
+	negate bool
+	exists bool
+}
+
+// andSeparator splits selector terms on AND, in any case, or on commas
+var andSeparator = regexp.MustCompile(`(?i)\s+and\s+|\s*,\s*`)
+
+// ParseLabelSelector parses a label selector
+func ParseLabelSelector(s string) (*LabelSelector, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("label selector is empty")
+	}
+	selector := &LabelSelector{}
+	for _, term := range andSeparator.Split(strings.TrimSpace(s), -1) {
+		parsed, err := parseLabelTerm(term)
+		if err != nil {
+			return nil, fmt.Errorf("label selector %q: %w", s, err)
+		}
+		selector.terms = append(selector.terms, parsed)
+	}
+	return selector, nil
+}
+
+func parseLabelTerm(term string) (labelTerm, error) {
+	if key, value, ok := strings.Cut(term, "!="); ok {
+		return newLabelTerm(term, key, value, true)
+	}
+	if key, value, ok := strings.Cut(term, "="); ok {
+		return newLabelTerm(term, key, value, false)
+	}
+	if term == "" || strings.ContainsAny(term, " \t") {
+		return labelTerm{}, fmt.Errorf("invalid term %q, must be key=value, key!=value or key", term)
+	}
+	return labelTerm{key: term, exists: true}, nil
+}
+
+func newLabelTerm(term, key, value string, negate bool) (labelTerm, error) {
+	key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+	if key == "" || value == "" || strings.ContainsAny(key+value, " \t") {
+		return labelTerm{}, fmt.Errorf("invalid term %q, must be key=value, key!=value or key", term)
+	}
+	return labelTerm{key: key, value: value, negate: negate}, nil
+}
+
+// Matches reports whether labels satisfy every term of the selector
+func (s *LabelSelector) Matches(labels map[string]string) bool {
+	for _, term := range s.terms {
+		value, ok := labels[term.key]
+		switch {
+		case term.exists:
+			if !ok {
+				return false
+			}
+		case term.negate:
+			if ok && value == term.value {
+				return false
+			}
+		default:
+			if !ok || value != term.value {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (s *LabelSelector) String() string {
+	terms := make([]string, len(s.terms))
+	for i, term := range s.terms {
+		switch {
+		case term.exists:
+			terms[i] = term.key
+		case term.negate:
+			terms[i] = term.key + "!=" + term.value
+		default:
+			terms[i] = term.key + "=" + term.value
+		}
+	}
+	return strings.Join(terms, " AND ")
+}
+
+// MergeLabels returns the labels derived from a host's facts with those
+// the inventory declares for it on top, so a hand-maintained label always
+// wins over a derived one
+func MergeLabels(derived, declared map[string]string) map[string]string {
+	merged := make(map[string]string, len(derived)+len(declared))
+	for key, value := range derived {
+		merged[key] = value
+	}
+	for key, value := range declared {
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,61 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLabelSelector_Matches(t *testing.T) {
+	labels := map[string]string{"os_family": "redhat", "cloud": "aws", "datacenter": "eu-west-1a"}
+
+	tests := []struct {
+		selector string
+		want     bool
+	}{
+		{selector: "os_family=redhat", want: true},
+		{selector: "os_family=redhat AND cloud=aws", want: true},
+		{selector: "os_family=redhat and cloud=gcp", want: false},
+		{selector: "os_family=redhat, cloud!=gcp", want: true},
+		{selector: "cloud!=aws", want: false},
+		{selector: "role!=db", want: true},
+		{selector: "datacenter", want: true},
+		{selector: "role", want: false},
+	}
+	for _, tt := range tests {
+		selector, err := ParseLabelSelector(tt.selector)
+		if err != nil {
+			t.Fatalf("ParseLabelSelector(%q) error = %v", tt.selector, err)
+		}
+		if got := selector.Matches(labels); got != tt.want {
+			t.Errorf("%q.Matches() = %v, want %v", tt.selector, got, tt.want)
+		}
+	}
+
+	for _, invalid := range []string{"", "os_family=", "=redhat", "os_family=redhat AND", "cloud aws"} {
+		if _, err := ParseLabelSelector(invalid); err == nil {
+			t.Errorf("ParseLabelSelector(%q) succeeded", invalid)
+		}
+	}
+}
+
+func TestLabelSelector_String(t *testing.T) {
+	selector, err := ParseLabelSelector("os_family=redhat and cloud!=gcp,datacenter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := selector.String(); got != "os_family=redhat AND cloud!=gcp AND datacenter" {
+		t.Errorf("String() = %q", got)
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	derived := map[string]string{"os_family": "redhat", "cloud": "aws"}
+	declared := map[string]string{"cloud": "on-prem", "role": "web"}
+	want := map[string]string{"os_family": "redhat", "cloud": "on-prem", "role": "web"}
+	if got := MergeLabels(derived, declared); !reflect.DeepEqual(got, want) {
+		t.Errorf("MergeLabels() = %v, want %v", got, want)
+	}
+	if derived["cloud"] != "aws" {
+		t.Error("MergeLabels() modified the derived labels")
+	}
+}
@@ -0,0 +1,203 @@
+package inventory
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Merge strategies for hosts that appear in more than one target group
+const (
+	// MergeFirst keeps the settings of the first group, in name order
+	MergeFirst = "first"
+	// MergeLast keeps the settings of the last group, in name order
+	MergeLast = "last"
+	// MergeError refuses to run while any host has conflicting settings
+	MergeError = "error"
+)
+
+// Conflict is a setting that groups sharing a host disagree on
+type Conflict struct {
+	Host  string
+	Field string
+	// Values maps each group to its value for the setting
+	Values map[string]string
+	// Winner is the group whose value is used; empty with the error strategy
+	Winner string
+}
+
+// String describes the conflict
+func (c Conflict) String() string {
+	groups := make([]string, 0, len(c.Values))
+	for group := range c.Values {
+		groups = append(groups, group)
+	}
+	sort.Strings(groups)
+	values := make([]string, len(groups))
+	for i, group := range groups {
+		values[i] = fmt.Sprintf("%s=%q", group, c.Values[group])
+	}
+	message := fmt.Sprintf("%s: %s differs between groups (%s)", c.Host, c.Field, strings.Join(values, ", "))
+	if c.Winner != "" {
+		message += ", using " + c.Winner
+	}
+	return message
+}
+
+// ConflictError is returned by the error merge strategy
+type ConflictError struct {
+	Conflicts []Conflict
+}
+
+func (e *ConflictError) Error() string {
+	return fmt.Sprintf("%d inventory conflict(s), first: %s", len(e.Conflicts), e.Conflicts[0])
+}
+
+// mergeFields are the connection settings compared between groups sharing
+// a host. Secrets are compared but their values are never shown.
+var mergeFields = []struct {
+	name   string
+	secret bool
+	value  func(h Host) string
+}{
+	{name: "transport", value: func(h Host) string { return h.Connection.TransportName() }},
+	{name: "user", value: func(h Host) string { return h.Connection.User }},
+	{name: "port", value: func(h Host) string {
+		if h.Connection.Port == 0 {
+			return "22"
+		}
+		return strconv.Itoa(h.Connection.Port)
+	}},
+	{name: "password", secret: true, value: func(h Host) string { return h.Connection.Password }},
+	{name: "private_key_path", value: func(h Host) string { return h.Connection.PrivateKeyPath }},
+	{name: "become", value: func(h Host) string { return strconv.FormatBool(h.Connection.Become) }},
+	{name: "become_user", value: func(h Host) string { return h.Connection.BecomeUser }},
+	{name: "become_method", value: func(h Host) string { return h.Connection.BecomeMethod }},
+	{name: "become_allowlist", value: func(h Host) string { return strconv.FormatBool(h.Connection.BecomeAllowlist) }},
+	{name: "bandwidth", value: func(h Host) string { return h.Connection.Bandwidth }},
+}
+
+// Resolve returns every host in the inventory once. A host listed by several
+// groups keeps the connection of the group chosen by the inventory's merge
+// strategy and the labels of all of them; settings they disagree on are
+// returned as conflicts.
+func (i *Inventory) Resolve() ([]Host, []Conflict, error) {
+	return MergeHosts(i.ResolveHosts(), i.Merge)
+}
+
+// MergeHosts deduplicates hosts by name with a merge strategy, in the order
+// each host first appears
+func MergeHosts(hosts []Host, strategy string) ([]Host, []Conflict, error) {
+	if err := validateMerge(strategy); err != nil {
+		return nil, nil, err
+	}
+
+	var order []string
+	byName := make(map[string][]Host)
+	for _, host := range hosts {
+		if _, seen := byName[host.Name]; !seen {
+			order = append(order, host.Name)
+		}
+		byName[host.Name] = append(byName[host.Name], host)
+	}
+
+	merged := make([]Host, 0, len(order))
+	var conflicts []Conflict
+	for _, name := range order {
+		host, hostConflicts := mergeHost(byName[name], strategy)
+		merged = append(merged, host)
+		conflicts = append(conflicts, hostConflicts...)
+	}
+
+	if strategy == MergeError && len(conflicts) > 0 {
+		for i := range conflicts {
+			conflicts[i].Winner = ""
+		}
+		return nil, conflicts, &ConflictError{Conflicts: conflicts}
+	}
+	return merged, conflicts, nil
+}
+
+// mergeHost merges the entries of one host
+func mergeHost(entries []Host, strategy string) (Host, []Conflict) {
+	winner := entries[0]
+	if strategy == MergeLast {
+		winner = entries[len(entries)-1]
+	}
+
+	host := winner
+	host.Groups = nil
+	host.Labels = make(map[string]string)
+	for _, entry := range entries {
+		host.Groups = append(host.Groups, entry.Group)
+		for key, value := range entry.Labels {
+			if _, exists := host.Labels[key]; !exists {
+				host.Labels[key] = value
+			}
+		}
+	}
+	for key, value := range winner.Labels {
+		host.Labels[key] = value
+	}
+	if len(entries) == 1 {
+		return host, nil
+	}
+
+	var conflicts []Conflict
+	for _, field := range mergeFields {
+		values := make(map[string]string, len(entries))
+		distinct := make(map[string]bool)
+		for _, entry := range entries {
+			value := field.value(entry)
+			distinct[value] = true
+			if field.secret && value != "" {
+				value = "(set)"
+			}
+			values[entry.Group] = value
+		}
+		if len(distinct) > 1 {
+			conflicts = append(conflicts, Conflict{Host: host.Name, Field: field.name, Values: values, Winner: winner.Group})
+		}
+	}
+
+	keys := make(map[string]bool)
+	for _, entry := range entries {
+		for key := range entry.Labels {
+			keys[key] = true
+		}
+	}
+	sortedKeys := make([]string, 0, len(keys))
+	for key := range keys {
+		sortedKeys = append(sortedKeys, key)
+	}
+	sort.Strings(sortedKeys)
+	for _, key := range sortedKeys {
+		values := make(map[string]string)
+		distinct := make(map[string]bool)
+		chosen := ""
+		for _, entry := range entries {
+			if value, ok := entry.Labels[key]; ok {
+				values[entry.Group] = value
+				distinct[value] = true
+				if chosen == "" || entry.Group == winner.Group {
+					chosen = entry.Group
+				}
+			}
+		}
+		if len(distinct) > 1 {
+			conflicts = append(conflicts, Conflict{Host: host.Name, Field: "label " + key, Values: values, Winner: chosen})
+		}
+	}
+	return host, conflicts
+}
+
+// validateMerge checks a merge strategy; empty means first
+func validateMerge(strategy string) error {
+	switch strategy {
+	case "", MergeFirst, MergeLast, MergeError:
+		return nil
+	default:
+		return fmt.Errorf("unknown merge strategy %q, must be first, last or error", strategy)
+	}
+}
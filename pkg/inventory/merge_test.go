@@ -0,0 +1,122 @@
+package inventory
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+func TestInventory_Resolve(t *testing.T) {
+	inv := &Inventory{
+		Targets: map[string]TargetGroup{
+			"app": {
+				Hosts:      []string{"web1", "app1"},
+				Connection: ssh.ConnectionConfig{User: "deploy", Port: 22},
+				Labels:     map[string]string{"role": "app", "team": "payments"},
+			},
+			"web": {
+				Hosts:      []string{"web1", "web2"},
+				Connection: ssh.ConnectionConfig{User: "ubuntu"},
+				Labels:     map[string]string{"role": "web", "tier": "frontend"},
+			},
+		},
+	}
+
+	tests := []struct {
+		name          string
+		merge         string
+		wantGroup     string
+		wantUser      string
+		wantRole      string
+		wantErr       bool
+		wantConflicts []string
+	}{
+		{
+			name:      "first",
+			wantGroup: "app",
+			wantUser:  "deploy",
+			wantRole:  "app",
+			wantConflicts: []string{
+				`web1: user differs between groups (app="deploy", web="ubuntu"), using app`,
+				`web1: label role differs between groups (app="app", web="web"), using app`,
+			},
+		},
+		{
+			name:      "last",
+			merge:     MergeLast,
+			wantGroup: "web",
+			wantUser:  "ubuntu",
+			wantRole:  "web",
+			wantConflicts: []string{
+				`web1: user differs between groups (app="deploy", web="ubuntu"), using web`,
+				`web1: label role differs between groups (app="app", web="web"), using web`,
+			},
+		},
+		{name: "error", merge: MergeError, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inv.Merge = tt.merge
+			hosts, conflicts, err := inv.Resolve()
+			if tt.wantErr {
+				var conflictErr *ConflictError
+				if !errors.As(err, &conflictErr) || len(conflictErr.Conflicts) != 2 {
+					t.Fatalf("Resolve() error = %v, want a conflict error", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Resolve() error = %v", err)
+			}
+
+			var names []string
+			for _, host := range hosts {
+				names = append(names, host.Name)
+			}
+			if want := []string{"web1", "app1", "web2"}; !reflect.DeepEqual(names, want) {
+				t.Errorf("hosts = %v, want %v", names, want)
+			}
+
+			web1 := hosts[0]
+			if web1.Group != tt.wantGroup || web1.Connection.User != tt.wantUser || web1.Connection.Host != "web1" {
+				t.Errorf("web1 = %s/%s@%s", web1.Group, web1.Connection.User, web1.Connection.Host)
+			}
+			if !reflect.DeepEqual(web1.Groups, []string{"app", "web"}) {
+				t.Errorf("Groups = %v", web1.Groups)
+			}
+			wantLabels := map[string]string{"role": tt.wantRole, "team": "payments", "tier": "frontend"}
+			if !reflect.DeepEqual(web1.Labels, wantLabels) {
+				t.Errorf("Labels = %v, want %v", web1.Labels, wantLabels)
+			}
+
+			var got []string
+			for _, conflict := range conflicts {
+				got = append(got, conflict.String())
+			}
+			if !reflect.DeepEqual(got, tt.wantConflicts) {
+				t.Errorf("conflicts = %q, want %q", got, tt.wantConflicts)
+			}
+		})
+	}
+}
+
+func TestMergeHosts_HidesSecrets(t *testing.T) {
+	hosts := []Host{
+		{Name: "db1", Group: "a", Connection: ssh.ConnectionConfig{Password: "hunter2"}},
+		{Name: "db1", Group: "b", Connection: ssh.ConnectionConfig{Password: "swordfish"}},
+	}
+	_, conflicts, err := MergeHosts(hosts, MergeFirst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(conflicts) != 1 || conflicts[0].String() != `db1: password differs between groups (a="(set)", b="(set)"), using a` {
+		t.Errorf("conflicts = %v", conflicts)
+	}
+
+	if _, _, err := MergeHosts(hosts, "union"); err == nil {
+		t.Error("Expected an error for an unknown strategy")
+	}
+}
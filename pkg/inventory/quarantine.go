@@ -0,0 +1,204 @@
+package inventory
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// QuarantineEntry records why and until when a host is excluded from runs
+type QuarantineEntry struct {
+	Host      string    `yaml:"host" json:"host"`
+	Reason    string    `yaml:"reason" json:"reason"`
+	By        string    `yaml:"by,omitempty" json:"by,omitempty"`
+	CreatedAt time.Time `yaml:"created_at" json:"created_at"`
+	ExpiresAt time.Time `yaml:"expires_at,omitempty" json:"expires_at,omitempty"`
+}
+
+// IsActive reports whether the entry still applies at the given time
+func (e *QuarantineEntry) IsActive(now time.Time) bool {
+	return e.ExpiresAt.IsZero() || now.Before(e.ExpiresAt)
+}
+
+// String returns a human readable description of the entry
+func (e *QuarantineEntry) String() string {
+	if e.ExpiresAt.IsZero() {
+		return fmt.Sprintf("%s (%s)", e.Host, e.Reason)
+	}
+	return fmt.Sprintf("%s (%s, until %s)", e.Host, e.Reason, e.ExpiresAt.Format(time.RFC3339))
+}
+
+// QuarantineList manages hosts that are skipped in all runs
+type QuarantineList struct {
+	mu       sync.RWMutex
+	entries  map[string]*QuarantineEntry
+	filePath string
+}
+
+// NewQuarantineList creates an empty in-memory quarantine list
+func NewQuarantineList() *QuarantineList {
+	return &QuarantineList{
+		entries: make(map[string]*QuarantineEntry),
+	}
+}
+
+// LoadQuarantineList loads a quarantine list from a YAML file. A missing
+// file yields an empty list that will be created on Save.
+func LoadQuarantineList(filename string) (*QuarantineList, error) {
+	list := NewQuarantineList()
+	list.filePath = filename
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return list, nil
+		}
+		return nil, fmt.Errorf("failed to read quarantine file %s: %w", filename, err)
+	}
+
+	var entries []*QuarantineEntry
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse quarantine file %s: %w", filename, err)
+	}
+
+	for _, entry := range entries {
+		if entry.Host == "" {
+			return nil, fmt.Errorf("invalid quarantine file %s: entry without host", filename)
+		}
+		list.entries[entry.Host] = entry
+	}
+
+	return list, nil
+}
+
+// Save writes the quarantine list back to the file it was loaded from
+func (q *QuarantineList) Save() error {
+	if q.filePath == "" {
+		return fmt.Errorf("quarantine list has no backing file")
+	}
+	return q.SaveToFile(q.filePath)
+}
+
+// SaveToFile writes the quarantine list to a YAML file
+func (q *QuarantineList) SaveToFile(filename string) error {
+	data, err := yaml.Marshal(q.List())
+	if err != nil {
+		return fmt.Errorf("failed to marshal quarantine list: %w", err)
+	}
+
+	if dir := filepath.Dir(filename); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create directory for %s: %w", filename, err)
+		}
+	}
+
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write quarantine file %s: %w", filename, err)
+	}
+
+	return nil
+}
+
+// Add quarantines a host. A zero ttl quarantines the host until it is removed.
+func (q *QuarantineList) Add(host, reason, by string, ttl time.Duration) (*QuarantineEntry, error) {
+	if host == "" {
+		return nil, fmt.Errorf("host cannot be empty")
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("a reason is required to quarantine %s", host)
+	}
+	if ttl < 0 {
+		return nil, fmt.Errorf("quarantine duration cannot be negative")
+	}
+
+	entry := &QuarantineEntry{
+		Host:      host,
+		Reason:    reason,
+		By:        by,
+		CreatedAt: time.Now(),
+	}
+	if ttl > 0 {
+		entry.ExpiresAt = entry.CreatedAt.Add(ttl)
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.entries[host] = entry
+
+	return entry, nil
+}
+
+// Remove releases a host from quarantine
+func (q *QuarantineList) Remove(host string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if _, exists := q.entries[host]; !exists {
+		return fmt.Errorf("host %s is not quarantined", host)
+	}
+	delete(q.entries, host)
+	return nil
+}
+
+// Check returns the active quarantine entry for a host, if any
+func (q *QuarantineList) Check(host string) (*QuarantineEntry, bool) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	entry, exists := q.entries[host]
+	if !exists || !entry.IsActive(time.Now()) {
+		return nil, false
+	}
+	return entry, true
+}
+
+// List returns all entries, including expired ones, sorted by host
+func (q *QuarantineList) List() []*QuarantineEntry {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+
+	entries := make([]*QuarantineEntry, 0, len(q.entries))
+	for _, entry := range q.entries {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Host < entries[j].Host
+	})
+	return entries
+}
+
+// Prune removes expired entries and returns how many were removed
+func (q *QuarantineList) Prune() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	removed := 0
+	for host, entry := range q.entries {
+		if !entry.IsActive(now) {
+			delete(q.entries, host)
+			removed++
+		}
+	}
+	return removed
+}
+
+// Filter splits hosts into those that may run and the active quarantine
+// entries for those that must be skipped
+func (q *QuarantineList) Filter(hosts []Host) ([]Host, []*QuarantineEntry) {
+	var allowed []Host
+	var skipped []*QuarantineEntry
+	for _, host := range hosts {
+		if entry, quarantined := q.Check(host.Name); quarantined {
+			skipped = append(skipped, entry)
+			continue
+		}
+		allowed = append(allowed, host)
+	}
+	return allowed, skipped
+}
@@ -0,0 +1,111 @@
+package inventory
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestQuarantineList_AddCheckRemove(t *testing.T) {
+	list := NewQuarantineList()
+
+	if _, err := list.Add("web1", "", "ops", 0); err == nil {
+		t.Error("Expected error when reason is missing")
+	}
+	if _, err := list.Add("", "disk failure", "ops", 0); err == nil {
+		t.Error("Expected error when host is missing")
+	}
+
+	if _, err := list.Add("web1", "disk failure", "ops", 0); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	entry, quarantined := list.Check("web1")
+	if !quarantined {
+		t.Fatal("Expected web1 to be quarantined")
+	}
+	if entry.Reason != "disk failure" || entry.By != "ops" {
+		t.Errorf("Unexpected entry: %+v", entry)
+	}
+
+	if _, quarantined := list.Check("web2"); quarantined {
+		t.Error("Expected web2 not to be quarantined")
+	}
+
+	if err := list.Remove("web1"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, quarantined := list.Check("web1"); quarantined {
+		t.Error("Expected web1 to be released")
+	}
+	if err := list.Remove("web1"); err == nil {
+		t.Error("Expected error removing host that is not quarantined")
+	}
+}
+
+func TestQuarantineList_Expiry(t *testing.T) {
+	list := NewQuarantineList()
+	entry, err := list.Add("web1", "investigating", "", time.Hour)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, quarantined := list.Check("web1"); !quarantined {
+		t.Fatal("Expected web1 to be quarantined before expiry")
+	}
+
+	entry.ExpiresAt = time.Now().Add(-time.Minute)
+	if _, quarantined := list.Check("web1"); quarantined {
+		t.Error("Expected expired quarantine to be ignored")
+	}
+
+	if removed := list.Prune(); removed != 1 {
+		t.Errorf("Expected 1 pruned entry, got %d", removed)
+	}
+	if len(list.List()) != 0 {
+		t.Error("Expected list to be empty after prune")
+	}
+}
+
+func TestQuarantineList_Filter(t *testing.T) {
+	list := NewQuarantineList()
+	list.Add("web2", "kernel panic", "", 0)
+
+	allowed, skipped := list.Filter([]Host{{Name: "web1"}, {Name: "web2"}, {Name: "web3"}})
+	if len(allowed) != 2 || allowed[0].Name != "web1" || allowed[1].Name != "web3" {
+		t.Errorf("Unexpected allowed hosts: %+v", allowed)
+	}
+	if len(skipped) != 1 || skipped[0].Host != "web2" {
+		t.Errorf("Unexpected skipped hosts: %+v", skipped)
+	}
+}
+
+func TestQuarantineList_SaveAndLoad(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "state", "quarantine.yaml")
+
+	list, err := LoadQuarantineList(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error loading missing file: %v", err)
+	}
+	list.Add("db1", "replication broken", "alice", 2*time.Hour)
+	list.Add("web1", "disk failure", "bob", 0)
+
+	if err := list.Save(); err != nil {
+		t.Fatalf("Unexpected error saving: %v", err)
+	}
+
+	loaded, err := LoadQuarantineList(filename)
+	if err != nil {
+		t.Fatalf("Unexpected error loading: %v", err)
+	}
+
+	entries := loaded.List()
+	if len(entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Host != "db1" || entries[0].ExpiresAt.IsZero() {
+		t.Errorf("Unexpected first entry: %+v", entries[0])
+	}
+	if entries[1].Host != "web1" || !entries[1].ExpiresAt.IsZero() {
+		t.Errorf("Unexpected second entry: %+v", entries[1])
+	}
+}
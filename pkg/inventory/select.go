@@ -0,0 +1,76 @@
+package inventory
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Select returns a copy of the inventory limited to the named groups and
+// hosts. Empty lists select everything; unknown names are an error.
+func (i *Inventory) Select(groups, hosts []string) (*Inventory, error) {
+	selected := *i
+	selected.Targets = make(map[string]TargetGroup)
+
+	for _, name := range groups {
+		if _, ok := i.Targets[name]; !ok {
+			return nil, fmt.Errorf("target group %s not found in inventory", name)
+		}
+	}
+	wantGroups := toSet(groups)
+	wantHosts := toSet(hosts)
+	found := make(map[string]bool)
+
+	for _, name := range i.GroupNames() {
+		if len(wantGroups) > 0 && !wantGroups[name] {
+			continue
+		}
+		group := i.Targets[name]
+		if len(wantHosts) > 0 {
+			var kept []string
+			for _, host := range group.Hosts {
+				if wantHosts[host] {
+					kept = append(kept, host)
+					found[host] = true
+				}
+			}
+			if len(kept) == 0 {
+				continue
+			}
+			group.Hosts = kept
+		}
+		selected.Targets[name] = group
+	}
+
+	var missing []string
+	for _, host := range hosts {
+		if !found[host] {
+			missing = append(missing, host)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("hosts not found in the selected groups: %s", strings.Join(missing, ", "))
+	}
+	if len(selected.Targets) == 0 {
+		return nil, fmt.Errorf("no hosts selected")
+	}
+	return &selected, nil
+}
+
+// SelectByLabels returns the hosts whose labels match a selector, in order
+func SelectByLabels(hosts []Host, selector *LabelSelector) []Host {
+	var selected []Host
+	for _, host := range hosts {
+		if selector.Matches(host.Labels) {
+			selected = append(selected, host)
+		}
+	}
+	return selected
+}
+
+func toSet(values []string) map[string]bool {
+	set := make(map[string]bool, len(values))
+	for _, value := range values {
+		set[value] = true
+	}
+	return set
+}
@@ -0,0 +1,55 @@
+package inventory
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestInventory_Select(t *testing.T) {
+	inv := &Inventory{
+		APIVersion: "ataiva.com/chisel/v1",
+		Kind:       "Inventory",
+		Targets: map[string]TargetGroup{
+			"db":  {Hosts: []string{"db1", "db2"}},
+			"web": {Hosts: []string{"web1", "web2"}},
+		},
+	}
+
+	tests := []struct {
+		name    string
+		groups  []string
+		hosts   []string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{name: "everything", want: map[string][]string{"db": {"db1", "db2"}, "web": {"web1", "web2"}}},
+		{name: "group", groups: []string{"web"}, want: map[string][]string{"web": {"web1", "web2"}}},
+		{name: "hosts", hosts: []string{"web2", "db1"}, want: map[string][]string{"db": {"db1"}, "web": {"web2"}}},
+		{name: "host outside group", groups: []string{"db"}, hosts: []string{"web1"}, wantErr: true},
+		{name: "unknown group", groups: []string{"cache"}, wantErr: true},
+		{name: "unknown host", hosts: []string{"web3"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			selected, err := inv.Select(tt.groups, tt.hosts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Select() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			got := make(map[string][]string)
+			for name, group := range selected.Targets {
+				got[name] = group.Hosts
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if len(inv.Targets["web"].Hosts) != 2 {
+		t.Error("Select() modified the original inventory")
+	}
+}
@@ -0,0 +1,177 @@
+// Package limits bounds the memory one run takes on the controller, so an
+// enormous run cannot exhaust a controller that also serves the dashboard
+// and the API. Command output and event queues past their limits are
+// spilled to disk; plans past theirs are reported, since they must stay in
+// memory to be applied as planned.
+package limits
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// Defaults
+const (
+	DefaultOutputBytes     = 1 << 20
+	DefaultPlanBytes       = 256 << 20
+	DefaultEventQueue      = 256
+	DefaultEventSpillBytes = 64 << 20
+)
+
+// Config sets the limits. Zero values take the defaults.
+type Config struct {
+	// OutputBytes is how much of a command's stdout or stderr is kept in
+	// memory for the rest of the run; the whole output is spilled to disk
+	OutputBytes int64 `mapstructure:"output_bytes" yaml:"output_bytes,omitempty"`
+	// PlanBytes is how large the plans of all hosts of a run may grow
+	// before a warning names the largest
+	PlanBytes int64 `mapstructure:"plan_bytes" yaml:"plan_bytes,omitempty"`
+	// EventQueue is how many events a stream subscriber may fall behind by
+	// in memory before further events are spilled to disk
+	EventQueue int `mapstructure:"event_queue" yaml:"event_queue,omitempty"`
+	// EventSpillBytes is how much a subscriber's spilled events may take on
+	// disk before the subscriber is dropped
+	EventSpillBytes int64 `mapstructure:"event_spill_bytes" yaml:"event_spill_bytes,omitempty"`
+	// SpillDir is the directory spilled data is written to, the system's
+	// temporary directory by default
+	SpillDir string `mapstructure:"spill_dir" yaml:"spill_dir,omitempty"`
+}
+
+// WithDefaults returns the config with unset limits set to the defaults
+func (c Config) WithDefaults() Config {
+	if c.OutputBytes <= 0 {
+		c.OutputBytes = DefaultOutputBytes
+	}
+	if c.PlanBytes <= 0 {
+		c.PlanBytes = DefaultPlanBytes
+	}
+	if c.EventQueue <= 0 {
+		c.EventQueue = DefaultEventQueue
+	}
+	if c.EventSpillBytes <= 0 {
+		c.EventSpillBytes = DefaultEventSpillBytes
+	}
+	if c.SpillDir == "" {
+		c.SpillDir = os.TempDir()
+	}
+	return c
+}
+
+// Warner reports a limit that was reached
+type Warner func(format string, args ...interface{})
+
+// Output keeps the output of commands within OutputBytes while they print
+// it. Longer output is written whole to a file in the spill directory, and
+// its start is kept with a note naming the file. Close removes the files.
+type Output struct {
+	limit int64
+	dir   string
+	warn  Warner
+
+	mu    sync.Mutex
+	files []string
+}
+
+// NewOutput creates an output limit; warn is told of each spill
+func (c Config) NewOutput(warn Warner) *Output {
+	c = c.WithDefaults()
+	if warn == nil {
+		warn = func(string, ...interface{}) {}
+	}
+	return &Output{limit: c.OutputBytes, dir: c.SpillDir, warn: warn}
+}
+
+// Buffer returns a buffer that collects one stream of a command's output
+// within the limit. name describes the output, such as the resource and
+// stream it came from.
+func (o *Output) Buffer(name string) *Buffer {
+	return &Buffer{output: o, name: name}
+}
+
+// Close removes the files output was spilled to
+func (o *Output) Close() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for _, file := range o.files {
+		os.Remove(file)
+	}
+	o.files = nil
+}
+
+// create creates a spill file that Close removes
+func (o *Output) create() (*os.File, error) {
+	file, err := os.CreateTemp(o.dir, "forge-output-*.log")
+	if err != nil {
+		return nil, err
+	}
+	o.mu.Lock()
+	o.files = append(o.files, file.Name())
+	o.mu.Unlock()
+	return file, nil
+}
+
+// Buffer collects a command's output, keeping up to the limit in memory and
+// spilling all of it to a file once it passes the limit. Writes never fail,
+// so a command is not cut short by a full disk.
+type Buffer struct {
+	output *Output
+	name   string
+
+	kept bytes.Buffer
+	size int64
+	file *os.File
+	err  error
+	done bool
+}
+
+// Write collects p
+func (b *Buffer) Write(p []byte) (int, error) {
+	limit := b.output.limit
+	if b.size+int64(len(p)) > limit && b.file == nil && b.err == nil {
+		b.file, b.err = b.output.create()
+		if b.err == nil {
+			_, b.err = b.file.Write(b.kept.Bytes())
+		}
+	}
+	if b.file != nil && b.err == nil {
+		_, b.err = b.file.Write(p)
+	}
+	if room := limit - int64(b.kept.Len()); room > 0 {
+		b.kept.Write(p[:min(room, int64(len(p)))])
+	}
+	b.size += int64(len(p))
+	return len(p), nil
+}
+
+// String returns the output kept in memory, followed by a note when some of
+// it is not. It finishes the spill file, so it is called once the command
+// is done.
+func (b *Buffer) String() string {
+	limit := b.output.limit
+	if b.size <= limit {
+		return b.kept.String()
+	}
+	if b.file != nil && !b.done {
+		if err := b.file.Close(); b.err == nil {
+			b.err = err
+		}
+	}
+	more := b.size - limit
+	if b.err != nil {
+		if !b.done {
+			b.output.warn("%s printed %d bytes, kept the first %d; failed to spill the rest to disk: %v", b.name, b.size, limit, b.err)
+		}
+		b.done = true
+		return b.kept.String() + fmt.Sprintf("\n[%d more bytes not kept]", more)
+	}
+	if !b.done {
+		b.output.warn("%s printed %d bytes, kept the first %d in memory and all of it in %s until the run ends", b.name, b.size, limit, b.file.Name())
+	}
+	b.done = true
+	return b.kept.String() + fmt.Sprintf("\n[%d more bytes in %s]", more, b.file.Name())
+}
@@ -0,0 +1,142 @@
+package limits
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+)
+
+// recorder collects warnings
+type recorder struct {
+	warnings []string
+}
+
+func (r *recorder) warn(format string, args ...interface{}) {
+	r.warnings = append(r.warnings, fmt.Sprintf(format, args...))
+}
+
+func TestConfig_WithDefaults(t *testing.T) {
+	config := Config{OutputBytes: 10}.WithDefaults()
+	if config.OutputBytes != 10 || config.PlanBytes != DefaultPlanBytes || config.EventQueue != DefaultEventQueue || config.SpillDir == "" {
+		t.Errorf("WithDefaults() = %+v", config)
+	}
+}
+
+func TestOutput_Buffer(t *testing.T) {
+	var warnings recorder
+	dir := t.TempDir()
+	output := Config{OutputBytes: 8, SpillDir: dir}.NewOutput(warnings.warn)
+
+	short := output.Buffer("shell.short stdout")
+	fmt.Fprint(short, "1234")
+	fmt.Fprint(short, "5678")
+	if got := short.String(); got != "12345678" || len(warnings.warnings) != 0 {
+		t.Errorf("String() of output within the limit = %q, warnings %q", got, warnings.warnings)
+	}
+
+	long := output.Buffer("shell.long stdout")
+	fmt.Fprint(long, "xxxxx")
+	fmt.Fprint(long, "xxxyyyyyy")
+	fmt.Fprint(long, "yyyyyy")
+	got := long.String()
+	if !strings.HasPrefix(got, "xxxxxxxx\n[12 more bytes in ") {
+		t.Fatalf("String() = %q, want the first 8 bytes and a note", got)
+	}
+	path := strings.TrimSuffix(got[strings.Index(got, " in ")+4:], "]")
+	spilled, err := os.ReadFile(path)
+	if err != nil || string(spilled) != "xxxxxxxxyyyyyyyyyyyy" {
+		t.Errorf("spill file = %q, %v, want the whole output", spilled, err)
+	}
+	if len(warnings.warnings) != 1 || !strings.Contains(warnings.warnings[0], "shell.long stdout printed 20 bytes") {
+		t.Errorf("warnings = %q", warnings.warnings)
+	}
+
+	output.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("spill file left after Close(): %v", err)
+	}
+}
+
+func TestPlans_Add(t *testing.T) {
+	var warnings recorder
+	plans := Config{PlanBytes: 100}.NewPlans(warnings.warn)
+	plans.Add("web1", 40)
+	plans.Add("web2", 50)
+	if len(warnings.warnings) != 0 {
+		t.Fatalf("warned within the limit: %q", warnings.warnings)
+	}
+	plans.Add("web3", 30)
+	plans.Add("web4", 30)
+	if plans.Total() != 150 {
+		t.Errorf("Total() = %d, want 150", plans.Total())
+	}
+	if len(warnings.warnings) != 1 {
+		t.Fatalf("warnings = %q, want one", warnings.warnings)
+	}
+	if !strings.Contains(warnings.warnings[0], "largest: web2 (50 B), web1 (40 B), web3 (30 B)") {
+		t.Errorf("warning = %q, want the largest plans named", warnings.warnings[0])
+	}
+}
+
+func TestSizeOf(t *testing.T) {
+	value := map[string]interface{}{
+		"content": "hello",
+		"lines":   []interface{}{"a", "b"},
+		"mode":    420,
+	}
+	// keys 7+5+4, strings 5+1+1, one number
+	if got := SizeOf(value); got != 31 {
+		t.Errorf("SizeOf() = %d, want 31", got)
+	}
+}
+
+func TestQueue_Spill(t *testing.T) {
+	var warnings recorder
+	queue := NewQueue[map[string]interface{}](Config{EventQueue: 2, EventSpillBytes: 64, SpillDir: t.TempDir()}, warnings.warn)
+	defer queue.Close()
+
+	for i := 0; i < 4; i++ {
+		if err := queue.Push(map[string]interface{}{"n": i}); err != nil {
+			t.Fatalf("Push(%d) error = %v", i, err)
+		}
+	}
+	if queue.Len() != 4 || len(warnings.warnings) != 1 {
+		t.Fatalf("Len() = %d, warnings %q, want 4 items and a warning about spilling", queue.Len(), warnings.warnings)
+	}
+
+	// Taking one off memory does not let newer items jump the spilled ones
+	item, ok, err := queue.Pop()
+	if err != nil || !ok || item["n"] != 0 {
+		t.Fatalf("Pop() = %v, %v, %v, want item 0", item, ok, err)
+	}
+	if err := queue.Push(map[string]interface{}{"n": 4}); err != nil {
+		t.Fatalf("Push(4) error = %v", err)
+	}
+
+	// Spilled items come back decoded from JSON, so numbers are float64
+	for want := 1; want <= 4; want++ {
+		item, ok, err := queue.Pop()
+		if err != nil || !ok || fmt.Sprint(item["n"]) != fmt.Sprint(want) {
+			t.Fatalf("Pop() = %v, %v, %v, want item %d", item, ok, err, want)
+		}
+	}
+	if _, ok, _ := queue.Pop(); ok {
+		t.Error("Pop() of an empty queue returned an item")
+	}
+}
+
+func TestQueue_Full(t *testing.T) {
+	queue := NewQueue[string](Config{EventQueue: 1, EventSpillBytes: 10, SpillDir: t.TempDir()}, nil)
+	defer queue.Close()
+
+	for _, item := range []string{"a", "bb", "cc"} {
+		if err := queue.Push(item); err != nil {
+			t.Fatalf("Push(%q) error = %v", item, err)
+		}
+	}
+	if err := queue.Push("dd"); !errors.Is(err, ErrQueueFull) {
+		t.Errorf("Push() past the spill limit error = %v, want ErrQueueFull", err)
+	}
+}
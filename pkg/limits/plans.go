@@ -0,0 +1,123 @@
+package limits
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// largestShown is how many of the largest plans a warning names
+const largestShown = 3
+
+// Plans adds up the size of the plans of a run's hosts and warns once when
+// they pass PlanBytes, naming the hosts with the largest plans
+type Plans struct {
+	limit int64
+	warn  Warner
+
+	mu     sync.Mutex
+	total  int64
+	sizes  map[string]int64
+	warned bool
+}
+
+// NewPlans creates a plan size limit; warn is told when it is passed
+func (c Config) NewPlans(warn Warner) *Plans {
+	c = c.WithDefaults()
+	if warn == nil {
+		warn = func(string, ...interface{}) {}
+	}
+	return &Plans{limit: c.PlanBytes, warn: warn, sizes: make(map[string]int64)}
+}
+
+// Add records the size of a host's plan
+func (p *Plans) Add(host string, size int64) {
+	if p == nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.total += size - p.sizes[host]
+	p.sizes[host] = size
+	if p.warned || p.total <= p.limit {
+		return
+	}
+	p.warned = true
+	p.warn("the plans of %d host(s) take about %s in memory, over the limit of %s; largest: %s. Plan fewer hosts at once or move large file contents to source",
+		len(p.sizes), formatBytes(p.total), formatBytes(p.limit), p.largest())
+}
+
+// Total returns the size of the plans recorded so far
+func (p *Plans) Total() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.total
+}
+
+// largest describes the largest plans
+func (p *Plans) largest() string {
+	hosts := make([]string, 0, len(p.sizes))
+	for host := range p.sizes {
+		hosts = append(hosts, host)
+	}
+	sort.Slice(hosts, func(i, j int) bool {
+		if p.sizes[hosts[i]] != p.sizes[hosts[j]] {
+			return p.sizes[hosts[i]] > p.sizes[hosts[j]]
+		}
+		return hosts[i] < hosts[j]
+	})
+	if len(hosts) > largestShown {
+		hosts = hosts[:largestShown]
+	}
+	described := make([]string, len(hosts))
+	for i, host := range hosts {
+		described[i] = fmt.Sprintf("%s (%s)", host, formatBytes(p.sizes[host]))
+	}
+	return strings.Join(described, ", ")
+}
+
+// SizeOf estimates the memory a value decoded from YAML or JSON takes: the
+// length of its strings and keys, and a word for every other value
+func SizeOf(value interface{}) int64 {
+	switch v := value.(type) {
+	case string:
+		return int64(len(v))
+	case []byte:
+		return int64(len(v))
+	case map[string]interface{}:
+		var size int64
+		for key, item := range v {
+			size += int64(len(key)) + SizeOf(item)
+		}
+		return size
+	case []interface{}:
+		var size int64
+		for _, item := range v {
+			size += SizeOf(item)
+		}
+		return size
+	case []string:
+		var size int64
+		for _, item := range v {
+			size += int64(len(item))
+		}
+		return size
+	default:
+		return 8
+	}
+}
+
+// formatBytes formats a size in bytes with a binary unit
+func formatBytes(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	div, exp := int64(unit), 0
+	for n := size / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(size)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,176 @@
+package limits
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// ErrQueueFull is returned when a queue's spill file reached its limit
+var ErrQueueFull = errors.New("queue is full")
+
+// Queue is a first-in first-out queue that keeps up to EventQueue items in
+// memory and spills the rest, encoded as JSON lines, to a file in the spill
+// directory. Items come out in the order they went in, decoded from JSON
+// when they were spilled. It is safe for concurrent use.
+type Queue[T any] struct {
+	limit      int
+	spillLimit int64
+	dir        string
+	warn       Warner
+
+	mu     sync.Mutex
+	memory []T
+	// Items past the memory limit are appended to writer and read back
+	// from reader; spilled counts those not read yet
+	file     string
+	writer   *os.File
+	reader   *bufio.Reader
+	readFile *os.File
+	spilled  int
+	written  int64
+	ready    chan struct{}
+	closed   bool
+}
+
+// NewQueue creates a queue; warn is told when it starts spilling to disk
+func NewQueue[T any](c Config, warn Warner) *Queue[T] {
+	c = c.WithDefaults()
+	if warn == nil {
+		warn = func(string, ...interface{}) {}
+	}
+	return &Queue[T]{
+		limit:      c.EventQueue,
+		spillLimit: c.EventSpillBytes,
+		dir:        c.SpillDir,
+		warn:       warn,
+		ready:      make(chan struct{}, 1),
+	}
+}
+
+// Push adds an item to the queue. Once the queue spilled EventSpillBytes
+// to disk, it refuses items with ErrQueueFull.
+func (q *Queue[T]) Push(item T) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return fmt.Errorf("queue is closed")
+	}
+	if q.spilled == 0 && len(q.memory) < q.limit {
+		q.memory = append(q.memory, item)
+		q.signal()
+		return nil
+	}
+
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Errorf("failed to spill item: %w", err)
+	}
+	if q.written+int64(len(data))+1 > q.spillLimit {
+		return ErrQueueFull
+	}
+	if q.writer == nil {
+		if err := q.openSpill(); err != nil {
+			return err
+		}
+		q.warn("%d items queued in memory, spilling further items to %s", len(q.memory), q.file)
+	}
+	if _, err := q.writer.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to spill item: %w", err)
+	}
+	q.written += int64(len(data)) + 1
+	q.spilled++
+	q.signal()
+	return nil
+}
+
+// Pop takes the oldest item off the queue; ok is false when it is empty
+func (q *Queue[T]) Pop() (item T, ok bool, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.memory) > 0 {
+		item, q.memory = q.memory[0], q.memory[1:]
+		if len(q.memory) == 0 {
+			q.memory = nil
+		}
+		return item, true, nil
+	}
+	if q.spilled == 0 {
+		return item, false, nil
+	}
+
+	line, err := q.reader.ReadBytes('\n')
+	if err != nil {
+		return item, false, fmt.Errorf("failed to read spilled item: %w", err)
+	}
+	q.spilled--
+	if q.spilled == 0 {
+		// Start over, so the spill file does not grow for ever
+		q.removeSpill()
+	}
+	if err := json.Unmarshal(line, &item); err != nil {
+		return item, false, fmt.Errorf("failed to decode spilled item: %w", err)
+	}
+	return item, true, nil
+}
+
+// Ready returns a channel that receives when items may have been pushed
+// since the last Pop that found the queue empty
+func (q *Queue[T]) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Len returns the number of items queued, in memory and on disk
+func (q *Queue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.memory) + q.spilled
+}
+
+// Close empties the queue and removes its spill file
+func (q *Queue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.closed = true
+	q.memory = nil
+	q.removeSpill()
+}
+
+// signal wakes a consumer waiting on Ready
+func (q *Queue[T]) signal() {
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// openSpill creates the spill file
+func (q *Queue[T]) openSpill() error {
+	writer, err := os.CreateTemp(q.dir, "forge-queue-*.jsonl")
+	if err != nil {
+		return fmt.Errorf("failed to create spill file: %w", err)
+	}
+	readFile, err := os.Open(writer.Name())
+	if err != nil {
+		writer.Close()
+		os.Remove(writer.Name())
+		return fmt.Errorf("failed to open spill file: %w", err)
+	}
+	q.file, q.writer, q.readFile, q.reader = writer.Name(), writer, readFile, bufio.NewReader(readFile)
+	return nil
+}
+
+// removeSpill closes and removes the spill file, if there is one
+func (q *Queue[T]) removeSpill() {
+	if q.writer == nil {
+		return
+	}
+	q.writer.Close()
+	q.readFile.Close()
+	os.Remove(q.file)
+	q.file, q.writer, q.readFile, q.reader = "", nil, nil, nil
+	q.spilled, q.written = 0, 0
+}
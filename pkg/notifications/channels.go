@@ -69,19 +69,8 @@ func NewEmailChannel(name, smtpHost string, smtpPort int, username, password, fr
 // Send sends a notification via email
 func (e *EmailChannel) Send(ctx context.Context, notification *Notification) error {
 	// Create email message
-	subject := fmt.Sprintf("[Chisel %s] %s", strings.ToUpper(string(notification.Level)), notification.Title)
-	body := fmt.Sprintf("Time: %s\nLevel: %s\nTitle: %s\n\nMessage:\n%s\n",
-		notification.Timestamp.Format(time.RFC3339),
-		notification.Level,
-		notification.Title,
-		notification.Message)
-	
-	if len(notification.Data) > 0 {
-		body += "\nAdditional Data:\n"
-		for k, v := range notification.Data {
-			body += fmt.Sprintf("  %s: %v\n", k, v)
-		}
-	}
+	subject := emailSubject(notification)
+	body := emailText(notification)
 	
 	// Create MIME message
 	message := fmt.Sprintf("To: %s\r\nSubject: %s\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%s",
@@ -0,0 +1,120 @@
+package notifications
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Delivery statuses
+const (
+	// DeliveryAccepted means the channel's service took the notification
+	DeliveryAccepted = "accepted"
+	// DeliveryFailed means sending the notification failed
+	DeliveryFailed = "failed"
+)
+
+// Delivery is what became of a notification sent through a channel
+type Delivery struct {
+	Channel string `json:"channel"`
+	// Provider is the service that delivered it, such as sendgrid
+	Provider string `json:"provider,omitempty"`
+	Status   string `json:"status"`
+	// MessageID is the ID the provider gave the message, to look its
+	// delivery up there
+	MessageID string    `json:"message_id,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	Time      time.Time `json:"time"`
+}
+
+// DeliveringChannel is a notification channel that reports what its
+// service made of each notification
+type DeliveringChannel interface {
+	NotificationChannel
+	// Deliver sends a notification and returns its delivery, also when
+	// sending fails
+	Deliver(ctx context.Context, notification *Notification) (*Delivery, error)
+}
+
+// ChannelMetrics counts the deliveries of a channel
+type ChannelMetrics struct {
+	Channel  string `json:"channel"`
+	Type     string `json:"type"`
+	Accepted int    `json:"accepted"`
+	Failed   int    `json:"failed"`
+	// LastDelivery is the most recent delivery, with its message ID or error
+	LastDelivery *Delivery `json:"last_delivery,omitempty"`
+}
+
+// deliveryMetrics records the deliveries of every channel
+type deliveryMetrics struct {
+	channels map[string]*ChannelMetrics
+	mu       sync.Mutex
+}
+
+// newDeliveryMetrics creates empty delivery metrics
+func newDeliveryMetrics() *deliveryMetrics {
+	return &deliveryMetrics{channels: make(map[string]*ChannelMetrics)}
+}
+
+// record counts a delivery through a channel. Channels that do not report
+// deliveries pass a nil delivery, which is filled in from err.
+func (d *deliveryMetrics) record(channel NotificationChannel, delivery *Delivery, err error) {
+	if delivery == nil {
+		delivery = &Delivery{Channel: channel.Name(), Status: DeliveryAccepted, Time: time.Now()}
+		if err != nil {
+			delivery.Status = DeliveryFailed
+			delivery.Error = err.Error()
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	metrics, ok := d.channels[channel.Name()]
+	if !ok {
+		metrics = &ChannelMetrics{Channel: channel.Name(), Type: channel.Type()}
+		d.channels[channel.Name()] = metrics
+	}
+	if delivery.Status == DeliveryFailed {
+		metrics.Failed++
+	} else {
+		metrics.Accepted++
+	}
+	metrics.LastDelivery = delivery
+}
+
+// snapshot returns a copy of the metrics of every channel, sorted by name
+func (d *deliveryMetrics) snapshot() []ChannelMetrics {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	snapshot := make([]ChannelMetrics, 0, len(d.channels))
+	for _, metrics := range d.channels {
+		copied := *metrics
+		if metrics.LastDelivery != nil {
+			last := *metrics.LastDelivery
+			copied.LastDelivery = &last
+		}
+		snapshot = append(snapshot, copied)
+	}
+	sort.Slice(snapshot, func(i, j int) bool { return snapshot[i].Channel < snapshot[j].Channel })
+	return snapshot
+}
+
+// deliver sends a notification through a channel and records its delivery
+func (m *NotificationManager) deliver(ctx context.Context, channel NotificationChannel, notification *Notification) error {
+	var delivery *Delivery
+	var err error
+	if deliveringChannel, ok := channel.(DeliveringChannel); ok {
+		delivery, err = deliveringChannel.Deliver(ctx, notification)
+	} else {
+		err = channel.Send(ctx, notification)
+	}
+	m.metrics.record(channel, delivery, err)
+	return err
+}
+
+// Metrics returns the deliveries of each channel that has sent notifications
+func (m *NotificationManager) Metrics() []ChannelMetrics {
+	return m.metrics.snapshot()
+}
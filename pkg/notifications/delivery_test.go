@@ -0,0 +1,49 @@
+package notifications
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNotificationManager_Metrics(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Message-Id", "sg-1")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	email, err := NewEmailAPIChannel("email", EmailAPIConfig{
+		Provider: "sendgrid",
+		From:     "ops@example.com",
+		To:       []string{"oncall@example.com"},
+		APIKey:   "key",
+		Endpoint: server.URL,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failing := NewTestNotificationChannel("failing", "test")
+	failing.SetShouldFail(true)
+
+	manager := NewNotificationManager(nil)
+	manager.AddChannel(email)
+	manager.AddChannel(failing)
+	manager.AddRule(NotificationRule{Name: "all", Enabled: true, Channels: []string{"email", "failing"}})
+
+	for i := 0; i < 2; i++ {
+		manager.Send(context.Background(), NewNotification("Drift detected", "web-01 drifted", LevelWarning))
+	}
+
+	metrics := manager.Metrics()
+	if len(metrics) != 2 {
+		t.Fatalf("Metrics() = %+v", metrics)
+	}
+	if got := metrics[0]; got.Channel != "email" || got.Type != "email_sendgrid" || got.Accepted != 2 || got.Failed != 0 || got.LastDelivery.MessageID != "sg-1" {
+		t.Errorf("email metrics = %+v", got)
+	}
+	if got := metrics[1]; got.Channel != "failing" || got.Accepted != 0 || got.Failed != 2 || got.LastDelivery.Error != "test channel failure" {
+		t.Errorf("failing metrics = %+v", got)
+	}
+}
@@ -0,0 +1,399 @@
+package notifications
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/secrets"
+	"github.com/ataiva-software/forge/pkg/sigv4"
+)
+
+// Email providers an EmailAPIChannel delivers through
+const (
+	EmailProviderSES      = "ses"
+	EmailProviderSendGrid = "sendgrid"
+	EmailProviderMailgun  = "mailgun"
+)
+
+// emailAPITimeout bounds each request when the config sets no timeout
+const emailAPITimeout = 30 * time.Second
+
+// defaultEmailTemplate renders the HTML body when the config has no template
+const defaultEmailTemplate = `<html><body style="font-family: sans-serif">
+<h2>{{.Title}}</h2>
+<p><strong>Level:</strong> {{.Level}}<br><strong>Time:</strong> {{.Timestamp.Format "2006-01-02T15:04:05Z07:00"}}</p>
+<p style="white-space: pre-wrap">{{.Message}}</p>
+{{- if .Data}}
+<table>{{range $key, $value := .Data}}<tr><th align="left">{{$key}}</th><td>{{$value}}</td></tr>{{end}}</table>
+{{- end}}
+</body></html>`
+
+// EmailAPIConfig configures email delivery through a provider's HTTP API
+type EmailAPIConfig struct {
+	// Provider is ses, sendgrid or mailgun
+	Provider string   `mapstructure:"provider"`
+	From     string   `mapstructure:"from"`
+	To       []string `mapstructure:"to"`
+	// APIKey authenticates with the provider; for SES it is the secret
+	// access key of AccessKeyID
+	APIKey string `mapstructure:"api_key"`
+	// APIKeySecret names a secret holding the API key instead, such as
+	// vault://mail/sendgrid. It is read on every send, so a rotated key is
+	// picked up without restarting.
+	APIKeySecret string `mapstructure:"api_key_secret"`
+	// AccessKeyID and SessionToken are the SES credentials besides the
+	// secret key; without them SES uses AWS_ACCESS_KEY_ID,
+	// AWS_SECRET_ACCESS_KEY and AWS_SESSION_TOKEN
+	AccessKeyID  string `mapstructure:"access_key_id"`
+	SessionToken string `mapstructure:"session_token"`
+	// Region is the AWS region of SES, defaulting to AWS_REGION, then
+	// us-east-1; for Mailgun, eu sends through its EU region
+	Region string `mapstructure:"region"`
+	// Domain is the Mailgun sending domain
+	Domain string `mapstructure:"domain"`
+	// Endpoint is the base URL of the provider's API; it defaults to the
+	// provider's own
+	Endpoint string `mapstructure:"endpoint"`
+	// HTMLTemplate is an html/template rendering the body from the
+	// notification; a summary of its title, level, message and data is
+	// used when empty
+	HTMLTemplate string        `mapstructure:"html_template"`
+	Timeout      time.Duration `mapstructure:"timeout"`
+}
+
+// EmailAPIChannel sends notifications via email through the API of SES,
+// SendGrid or Mailgun, and reports the message ID each one accepted
+type EmailAPIChannel struct {
+	name       string
+	config     EmailAPIConfig
+	secrets    *secrets.SecretsManager
+	template   *template.Template
+	httpClient *http.Client
+	now        func() time.Time
+}
+
+// NewEmailAPIChannel creates a new email notification channel delivering
+// through a provider's API. secretsManager resolves the config's
+// APIKeySecret and may be nil when it has none.
+func NewEmailAPIChannel(name string, config EmailAPIConfig, secretsManager *secrets.SecretsManager) (*EmailAPIChannel, error) {
+	switch config.Provider {
+	case EmailProviderSES:
+		if config.Region == "" {
+			config.Region = os.Getenv("AWS_REGION")
+		}
+		if config.Region == "" {
+			config.Region = "us-east-1"
+		}
+		if config.Endpoint == "" {
+			config.Endpoint = "https://email." + config.Region + ".amazonaws.com"
+		}
+	case EmailProviderSendGrid:
+		if config.Endpoint == "" {
+			config.Endpoint = "https://api.sendgrid.com"
+		}
+	case EmailProviderMailgun:
+		if config.Domain == "" {
+			return nil, fmt.Errorf("mailgun email channel %s needs a domain", name)
+		}
+		if config.Endpoint == "" {
+			config.Endpoint = "https://api.mailgun.net"
+			if config.Region == "eu" {
+				config.Endpoint = "https://api.eu.mailgun.net"
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unknown email provider '%s', must be one of: %s, %s, %s",
+			config.Provider, EmailProviderSES, EmailProviderSendGrid, EmailProviderMailgun)
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+
+	if config.From == "" || len(config.To) == 0 {
+		return nil, fmt.Errorf("email channel %s needs a sender and recipients", name)
+	}
+	if config.APIKeySecret != "" && secretsManager == nil {
+		return nil, fmt.Errorf("email channel %s reads its API key from %s, but no secrets manager is configured", name, config.APIKeySecret)
+	}
+	// SES falls back to the AWS environment; the others need a key
+	if config.APIKey == "" && config.APIKeySecret == "" && config.Provider != EmailProviderSES {
+		return nil, fmt.Errorf("%s email channel %s needs an API key", config.Provider, name)
+	}
+
+	source := config.HTMLTemplate
+	if source == "" {
+		source = defaultEmailTemplate
+	}
+	tmpl, err := template.New(name).Option("missingkey=zero").Parse(source)
+	if err != nil {
+		return nil, fmt.Errorf("invalid HTML template of email channel %s: %w", name, err)
+	}
+
+	timeout := config.Timeout
+	if timeout == 0 {
+		timeout = emailAPITimeout
+	}
+	return &EmailAPIChannel{
+		name:       name,
+		config:     config,
+		secrets:    secretsManager,
+		template:   tmpl,
+		httpClient: &http.Client{Timeout: timeout},
+		now:        time.Now,
+	}, nil
+}
+
+// Send sends a notification via email
+func (e *EmailAPIChannel) Send(ctx context.Context, notification *Notification) error {
+	_, err := e.Deliver(ctx, notification)
+	return err
+}
+
+// Deliver sends a notification via email and returns what the provider
+// made of it, which is also returned when it failed
+func (e *EmailAPIChannel) Deliver(ctx context.Context, notification *Notification) (*Delivery, error) {
+	delivery := &Delivery{Channel: e.name, Provider: e.config.Provider, Status: DeliveryAccepted}
+	messageID, err := e.deliver(ctx, notification)
+	delivery.Time = e.now()
+	if err != nil {
+		delivery.Status = DeliveryFailed
+		delivery.Error = err.Error()
+		return delivery, err
+	}
+	delivery.MessageID = messageID
+	return delivery, nil
+}
+
+// deliver sends a notification to the provider and returns the ID it gave
+// the message
+func (e *EmailAPIChannel) deliver(ctx context.Context, notification *Notification) (string, error) {
+	apiKey, err := e.apiKey(ctx)
+	if err != nil {
+		return "", err
+	}
+	var html bytes.Buffer
+	if err := e.template.Execute(&html, notification); err != nil {
+		return "", fmt.Errorf("failed to render email: %w", err)
+	}
+	subject := emailSubject(notification)
+	text := emailText(notification)
+
+	switch e.config.Provider {
+	case EmailProviderSES:
+		return e.sendSES(ctx, apiKey, subject, text, html.String())
+	case EmailProviderSendGrid:
+		return e.sendSendGrid(ctx, apiKey, subject, text, html.String())
+	default:
+		return e.sendMailgun(ctx, apiKey, subject, text, html.String())
+	}
+}
+
+// apiKey returns the API key, reading it from the secrets manager when the
+// config names a secret
+func (e *EmailAPIChannel) apiKey(ctx context.Context) (string, error) {
+	if e.config.APIKeySecret == "" {
+		return e.config.APIKey, nil
+	}
+	secret, err := e.secrets.GetSecret(ctx, e.config.APIKeySecret)
+	if err != nil {
+		return "", fmt.Errorf("failed to read API key: %w", err)
+	}
+	return secret.Value, nil
+}
+
+// sendSES sends an email through the SES v2 API
+func (e *EmailAPIChannel) sendSES(ctx context.Context, apiKey, subject, text, html string) (string, error) {
+	content := func(data string) map[string]string {
+		return map[string]string{"Data": data, "Charset": "UTF-8"}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"FromEmailAddress": e.config.From,
+		"Destination":      map[string]interface{}{"ToAddresses": e.config.To},
+		"Content": map[string]interface{}{
+			"Simple": map[string]interface{}{
+				"Subject": content(subject),
+				"Body":    map[string]interface{}{"Text": content(text), "Html": content(html)},
+			},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SES request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+"/v2/email/outbound-emails", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create SES request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	credentials := sigv4.EnvCredentials()
+	if e.config.AccessKeyID != "" {
+		credentials = sigv4.Credentials{AccessKey: e.config.AccessKeyID, SecretKey: apiKey, SessionToken: e.config.SessionToken}
+	}
+	if credentials.AccessKey == "" || credentials.SecretKey == "" {
+		return "", fmt.Errorf("SES needs an access key ID and secret key, or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	sigv4.Sign(req, body, credentials, e.config.Region, "ses", e.now())
+
+	_, resp, err := e.do(req, "SES")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		MessageID string `json:"MessageId"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return "", fmt.Errorf("failed to parse SES response: %w", err)
+	}
+	return result.MessageID, nil
+}
+
+// sendSendGrid sends an email through the SendGrid v3 mail API
+func (e *EmailAPIChannel) sendSendGrid(ctx context.Context, apiKey, subject, text, html string) (string, error) {
+	to := make([]map[string]string, len(e.config.To))
+	for i, address := range e.config.To {
+		to[i] = map[string]string{"email": address}
+	}
+	body, err := json.Marshal(map[string]interface{}{
+		"personalizations": []map[string]interface{}{{"to": to}},
+		"from":             map[string]string{"email": e.config.From},
+		"subject":          subject,
+		"content": []map[string]string{
+			{"type": "text/plain", "value": text},
+			{"type": "text/html", "value": html},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal SendGrid request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.config.Endpoint+"/v3/mail/send", bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("failed to create SendGrid request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+
+	header, _, err := e.do(req, "SendGrid")
+	if err != nil {
+		return "", err
+	}
+	// SendGrid accepts the mail with an empty body and names it in a header
+	return header.Get("X-Message-Id"), nil
+}
+
+// sendMailgun sends an email through the Mailgun messages API
+func (e *EmailAPIChannel) sendMailgun(ctx context.Context, apiKey, subject, text, html string) (string, error) {
+	form := url.Values{
+		"from":    {e.config.From},
+		"to":      e.config.To,
+		"subject": {subject},
+		"text":    {text},
+		"html":    {html},
+	}
+	endpoint := e.config.Endpoint + "/v3/" + url.PathEscape(e.config.Domain) + "/messages"
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create Mailgun request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth("api", apiKey)
+
+	_, resp, err := e.do(req, "Mailgun")
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(resp, &result); err != nil {
+		return "", fmt.Errorf("failed to parse Mailgun response: %w", err)
+	}
+	return result.ID, nil
+}
+
+// do sends a request to a provider and returns the headers and body of its
+// response
+func (e *EmailAPIChannel) do(req *http.Request, provider string) (http.Header, []byte, error) {
+	resp, err := e.httpClient.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to send to %s: %w", provider, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, nil, apiError(provider, resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read %s response: %w", provider, err)
+	}
+	return resp.Header, body, nil
+}
+
+// apiError describes a failed response, with the message of the JSON error
+// the providers send when there is one
+func apiError(provider string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Message    string `json:"message"`
+		AWSMessage string `json:"Message"`
+		Errors     []struct {
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	message := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &e) == nil {
+		switch {
+		case e.Message != "":
+			message = e.Message
+		case e.AWSMessage != "":
+			message = e.AWSMessage
+		case len(e.Errors) > 0:
+			message = e.Errors[0].Message
+		}
+	}
+	return fmt.Errorf("%s returned status %d: %s", provider, resp.StatusCode, message)
+}
+
+// Type returns the channel type
+func (e *EmailAPIChannel) Type() string {
+	return "email_" + e.config.Provider
+}
+
+// Name returns the channel name
+func (e *EmailAPIChannel) Name() string {
+	return e.name
+}
+
+// emailSubject returns the subject of a notification's email
+func emailSubject(notification *Notification) string {
+	return fmt.Sprintf("[Chisel %s] %s", strings.ToUpper(string(notification.Level)), notification.Title)
+}
+
+// emailText returns the plain text body of a notification's email
+func emailText(notification *Notification) string {
+	body := fmt.Sprintf("Time: %s\nLevel: %s\nTitle: %s\n\nMessage:\n%s\n",
+		notification.Timestamp.Format(time.RFC3339),
+		notification.Level,
+		notification.Title,
+		notification.Message)
+
+	if len(notification.Data) > 0 {
+		keys := make([]string, 0, len(notification.Data))
+		for k := range notification.Data {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		body += "\nAdditional Data:\n"
+		for _, k := range keys {
+			body += fmt.Sprintf("  %s: %v\n", k, notification.Data[k])
+		}
+	}
+	return body
+}
@@ -0,0 +1,189 @@
+package notifications
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/secrets"
+)
+
+// keyProvider is a secrets provider holding API keys in memory
+type keyProvider map[string]string
+
+func (k keyProvider) Type() string { return "keys" }
+
+func (k keyProvider) GetSecret(ctx context.Context, path string) (*secrets.Secret, error) {
+	value, ok := k[path]
+	if !ok {
+		return nil, fmt.Errorf("secret %s not found", path)
+	}
+	return &secrets.Secret{Path: path, Value: value}, nil
+}
+
+func (k keyProvider) SetSecret(ctx context.Context, path, value string) error { return nil }
+
+func (k keyProvider) DeleteSecret(ctx context.Context, path string) error { return nil }
+
+func (k keyProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func TestNewEmailAPIChannel(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  EmailAPIConfig
+		wantErr string
+	}{
+		{name: "sendgrid", config: EmailAPIConfig{Provider: "sendgrid", From: "ops@example.com", To: []string{"oncall@example.com"}, APIKey: "key"}},
+		{name: "ses from environment", config: EmailAPIConfig{Provider: "ses", From: "ops@example.com", To: []string{"oncall@example.com"}}},
+		{name: "unknown provider", config: EmailAPIConfig{Provider: "postmark"}, wantErr: "must be one of: ses, sendgrid, mailgun"},
+		{name: "mailgun without domain", config: EmailAPIConfig{Provider: "mailgun", From: "ops@example.com", To: []string{"oncall@example.com"}, APIKey: "key"}, wantErr: "needs a domain"},
+		{name: "no recipients", config: EmailAPIConfig{Provider: "sendgrid", From: "ops@example.com", APIKey: "key"}, wantErr: "needs a sender and recipients"},
+		{name: "no key", config: EmailAPIConfig{Provider: "sendgrid", From: "ops@example.com", To: []string{"oncall@example.com"}}, wantErr: "needs an API key"},
+		{name: "secret without manager", config: EmailAPIConfig{Provider: "sendgrid", From: "ops@example.com", To: []string{"oncall@example.com"}, APIKeySecret: "keys://sendgrid"}, wantErr: "no secrets manager is configured"},
+		{name: "bad template", config: EmailAPIConfig{Provider: "sendgrid", From: "ops@example.com", To: []string{"oncall@example.com"}, APIKey: "key", HTMLTemplate: "{{.Title"}, wantErr: "invalid HTML template"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewEmailAPIChannel("email", tt.config, nil)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("NewEmailAPIChannel() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("NewEmailAPIChannel() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEmailAPIChannel_Deliver(t *testing.T) {
+	notification := NewNotification("Drift detected", "web-01 drifted", LevelWarning)
+	notification.AddData("host", "web-01")
+
+	tests := []struct {
+		name   string
+		config EmailAPIConfig
+		// check inspects the request and writes the provider's response
+		check func(t *testing.T, r *http.Request, body []byte, w http.ResponseWriter)
+		want  string
+	}{
+		{
+			name:   "sendgrid",
+			config: EmailAPIConfig{Provider: "sendgrid", APIKeySecret: "keys://sendgrid"},
+			check: func(t *testing.T, r *http.Request, body []byte, w http.ResponseWriter) {
+				if r.URL.Path != "/v3/mail/send" || r.Header.Get("Authorization") != "Bearer SG.rotated" {
+					t.Errorf("request = %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+				}
+				var mail struct {
+					Subject string `json:"subject"`
+					Content []struct {
+						Type  string `json:"type"`
+						Value string `json:"value"`
+					} `json:"content"`
+				}
+				json.Unmarshal(body, &mail)
+				if mail.Subject != "[Chisel WARNING] Drift detected" || len(mail.Content) != 2 || !strings.Contains(mail.Content[1].Value, "<h2>Drift detected</h2>") {
+					t.Errorf("mail = %s", body)
+				}
+				w.Header().Set("X-Message-Id", "sg-1")
+				w.WriteHeader(http.StatusAccepted)
+			},
+			want: "sg-1",
+		},
+		{
+			name:   "mailgun",
+			config: EmailAPIConfig{Provider: "mailgun", APIKey: "key-1", Domain: "mg.example.com", HTMLTemplate: "<b>{{.Title}}</b> on {{index .Data \"host\"}}"},
+			check: func(t *testing.T, r *http.Request, body []byte, w http.ResponseWriter) {
+				user, password, _ := r.BasicAuth()
+				if r.URL.Path != "/v3/mg.example.com/messages" || user != "api" || password != "key-1" {
+					t.Errorf("request = %s as %s:%s", r.URL.Path, user, password)
+				}
+				form, _ := url.ParseQuery(string(body))
+				if form.Get("html") != "<b>Drift detected</b> on web-01" || !strings.Contains(form.Get("text"), "host: web-01") {
+					t.Errorf("form = %v", form)
+				}
+				w.Write([]byte(`{"id": "<mg-1@mg.example.com>", "message": "Queued. Thank you."}`))
+			},
+			want: "<mg-1@mg.example.com>",
+		},
+		{
+			name:   "ses",
+			config: EmailAPIConfig{Provider: "ses", Region: "eu-west-1", AccessKeyID: "AKID", APIKey: "secret"},
+			check: func(t *testing.T, r *http.Request, body []byte, w http.ResponseWriter) {
+				auth := r.Header.Get("Authorization")
+				if r.URL.Path != "/v2/email/outbound-emails" || !strings.HasPrefix(auth, "AWS4-HMAC-SHA256 Credential=AKID/") || !strings.Contains(auth, "/eu-west-1/ses/aws4_request") {
+					t.Errorf("request = %s signed with %q", r.URL.Path, auth)
+				}
+				if !strings.Contains(string(body), `"ToAddresses":["oncall@example.com"]`) {
+					t.Errorf("body = %s", body)
+				}
+				w.Write([]byte(`{"MessageId": "ses-1"}`))
+			},
+			want: "ses-1",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				body, _ := io.ReadAll(r.Body)
+				tt.check(t, r, body, w)
+			}))
+			defer server.Close()
+
+			manager := secrets.NewSecretsManager()
+			manager.RegisterProvider(keyProvider{"sendgrid": "SG.rotated"})
+			config := tt.config
+			config.From = "ops@example.com"
+			config.To = []string{"oncall@example.com"}
+			config.Endpoint = server.URL
+			channel, err := NewEmailAPIChannel("email", config, manager)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			delivery, err := channel.Deliver(context.Background(), notification)
+			if err != nil {
+				t.Fatalf("Deliver() error = %v", err)
+			}
+			if delivery.Status != DeliveryAccepted || delivery.MessageID != tt.want || delivery.Provider != tt.config.Provider {
+				t.Errorf("Deliver() = %+v, want message %s", delivery, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmailAPIChannel_DeliverFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"errors": [{"message": "The provided authorization grant is invalid"}]}`))
+	}))
+	defer server.Close()
+
+	channel, err := NewEmailAPIChannel("email", EmailAPIConfig{
+		Provider: "sendgrid",
+		From:     "ops@example.com",
+		To:       []string{"oncall@example.com"},
+		APIKey:   "revoked",
+		Endpoint: server.URL,
+		Timeout:  time.Second,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delivery, err := channel.Deliver(context.Background(), NewNotification("Run failed", "apply failed", LevelError))
+	want := "SendGrid returned status 401: The provided authorization grant is invalid"
+	if err == nil || err.Error() != want {
+		t.Errorf("Deliver() error = %v, want %q", err, want)
+	}
+	if delivery == nil || delivery.Status != DeliveryFailed || delivery.Error != want {
+		t.Errorf("Deliver() = %+v", delivery)
+	}
+}
@@ -22,6 +22,9 @@ type NotificationManager struct {
 	// Configuration
 	enabled     bool
 	rateLimiter *RateLimiter
+	
+	// Deliveries of each channel
+	metrics *deliveryMetrics
 }
 
 // NotificationRule defines when and how to send notifications
@@ -57,6 +60,7 @@ func NewNotificationManager(eventBus *events.EventBus) *NotificationManager {
 		rules:       make([]NotificationRule, 0),
 		enabled:     true,
 		rateLimiter: NewRateLimiter(100, time.Minute, 10), // Default rate limit
+		metrics:     newDeliveryMetrics(),
 	}
 	
 	if eventBus != nil {
@@ -168,7 +172,7 @@ func (m *NotificationManager) Send(ctx context.Context, notification *Notificati
 			continue
 		}
 		
-		if err := channel.Send(ctx, notification); err != nil {
+		if err := m.deliver(ctx, channel, notification); err != nil {
 			errors = append(errors, fmt.Errorf("failed to send to channel '%s': %w", channelName, err))
 		}
 	}
@@ -201,7 +205,7 @@ func (m *NotificationManager) SendToChannels(ctx context.Context, notification *
 			continue
 		}
 		
-		if err := channel.Send(ctx, notification); err != nil {
+		if err := m.deliver(ctx, channel, notification); err != nil {
 			errors = append(errors, fmt.Errorf("failed to send to channel '%s': %w", channelName, err))
 		}
 	}
@@ -0,0 +1,413 @@
+// Package planfile saves the plans forge computes so they can be reviewed
+// and applied later, exactly as planned.
+package planfile
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// FormatVersion is the layout of plan files this forge writes and reads
+const FormatVersion = 1
+
+// File is a saved plan: the inputs it was computed from and, for every
+// host, the planned changes with digests of each resource and of the state
+// it was in when planned
+type File struct {
+	FormatVersion int       `json:"format_version"`
+	CreatedAt     time.Time `json:"created_at"`
+	ModuleFile    string    `json:"module_file"`
+	InventoryFile string    `json:"inventory_file,omitempty"`
+	// Local is set when the plan was made for the machine forge runs on
+	Local bool `json:"local,omitempty"`
+	// Targets and Excludes are the --target and --exclude selectors planned with
+	Targets  []string `json:"targets,omitempty"`
+	Excludes []string `json:"excludes,omitempty"`
+	// AuditOnly is set when the plan was made with --audit-only
+	AuditOnly bool `json:"audit_only,omitempty"`
+	// Vars are the --var and --var-file overrides planned with
+	Vars        map[string]interface{} `json:"vars,omitempty"`
+	Fingerprint *audit.Fingerprint     `json:"fingerprint"`
+	Hosts       []Host                 `json:"hosts"`
+}
+
+// Host is the plan of one host
+type Host struct {
+	Name    string   `json:"name"`
+	Changes []Change `json:"changes"`
+}
+
+// Change is one planned change
+type Change struct {
+	Resource string `json:"resource"`
+	Action   string `json:"action"`
+	// Digest covers the resource as planned; StateDigest the state it was in
+	Digest      string              `json:"digest"`
+	StateDigest string              `json:"state_digest"`
+	Diff        *types.ResourceDiff `json:"diff,omitempty"`
+	// SealedDiff is the diff encrypted by SealDiffs
+	SealedDiff string `json:"sealed_diff,omitempty"`
+	// Audit changes are only reported, never applied
+	Audit bool `json:"audit,omitempty"`
+}
+
+// New creates an empty plan file for the inputs a fingerprint describes
+func New(fingerprint *audit.Fingerprint, moduleFile, inventoryFile string, local bool) *File {
+	return &File{
+		FormatVersion: FormatVersion,
+		CreatedAt:     time.Now().UTC(),
+		ModuleFile:    moduleFile,
+		InventoryFile: inventoryFile,
+		Local:         local,
+		Fingerprint:   fingerprint,
+	}
+}
+
+// AddHost records the plan of a host. Plans with errors cannot be applied,
+// so they are refused.
+func (f *File) AddHost(name string, plan *core.Plan) error {
+	if count := plan.Summary().Errors; count > 0 {
+		return fmt.Errorf("plan for %s contains %d error(s)", name, count)
+	}
+	host := Host{Name: name, Changes: make([]Change, 0, len(plan.Changes))}
+	for _, change := range plan.Changes {
+		saved, err := newChange(change)
+		if err != nil {
+			return err
+		}
+		host.Changes = append(host.Changes, saved)
+	}
+	f.Hosts = append(f.Hosts, host)
+	sort.Slice(f.Hosts, func(i, j int) bool { return f.Hosts[i].Name < f.Hosts[j].Name })
+	return nil
+}
+
+// newChange digests a planned change
+func newChange(change core.Change) (Change, error) {
+	id := change.Resource.ResourceID()
+	resourceDigest, err := digest(change.Resource)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to digest %s: %w", id, err)
+	}
+	stateDigest, err := digest(change.State)
+	if err != nil {
+		return Change{}, fmt.Errorf("failed to digest the state of %s: %w", id, err)
+	}
+	return Change{
+		Resource:    id,
+		Action:      change.Action.String(),
+		Digest:      resourceDigest,
+		StateDigest: stateDigest,
+		Diff:        change.Diff,
+		Audit:       change.Audit,
+	}, nil
+}
+
+// digest hashes a value's JSON encoding, which orders map keys
+func digest(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return audit.HashBytes(data), nil
+}
+
+// Sealer encrypts plan files, or their diffs, at rest; plans carry the
+// diffs of the files they change, which may hold secrets. Each is sealed
+// under a name, so a sealed diff only opens as the change it was saved for.
+type Sealer interface {
+	Seal(data []byte, name string) ([]byte, error)
+	Open(data []byte, name string) ([]byte, error)
+}
+
+// sealedPlan is the name plan files are sealed under
+const sealedPlan = "plan"
+
+// diffName is the name the diff of a change to a host is sealed under
+func diffName(host string, change *Change) string {
+	return "plan/" + host + "/" + change.Resource
+}
+
+// SealDiffs encrypts the diff of every change with the sealer, for plan
+// files that are not sealed whole. Load opens them again.
+func (f *File) SealDiffs(sealer Sealer) error {
+	for i := range f.Hosts {
+		for j := range f.Hosts[i].Changes {
+			change := &f.Hosts[i].Changes[j]
+			if change.Diff == nil {
+				continue
+			}
+			data, err := json.Marshal(change.Diff)
+			if err != nil {
+				return fmt.Errorf("failed to encode the diff of %s: %w", change.Resource, err)
+			}
+			sealed, err := sealer.Seal(data, diffName(f.Hosts[i].Name, change))
+			if err != nil {
+				return fmt.Errorf("failed to encrypt the diff of %s: %w", change.Resource, err)
+			}
+			change.Diff, change.SealedDiff = nil, string(sealed)
+		}
+	}
+	return nil
+}
+
+// RedactDiffs replaces the secrets in the diff of every change, for plan
+// files no key can seal
+func (f *File) RedactDiffs(redact func(string) string) {
+	for i := range f.Hosts {
+		for j := range f.Hosts[i].Changes {
+			change := &f.Hosts[i].Changes[j]
+			if change.Diff == nil {
+				continue
+			}
+			// The diff is shared with the plan it was saved from
+			diff := *change.Diff
+			diff.Reason = redact(diff.Reason)
+			diff.Changes = make(map[string]interface{}, len(change.Diff.Changes))
+			for key, value := range change.Diff.Changes {
+				diff.Changes[key] = redactValue(value, redact)
+			}
+			change.Diff = &diff
+		}
+	}
+}
+
+// redactValue redacts the strings in a diff value
+func redactValue(value interface{}, redact func(string) string) interface{} {
+	switch v := value.(type) {
+	case string:
+		return redact(v)
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			redacted[key] = redactValue(item, redact)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, item := range v {
+			redacted[i] = redactValue(item, redact)
+		}
+		return redacted
+	case []string:
+		redacted := make([]string, len(v))
+		for i, item := range v {
+			redacted[i] = redact(item)
+		}
+		return redacted
+	default:
+		return value
+	}
+}
+
+// Write saves the plan file, sealed when a sealer is given
+func (f *File) Write(path string, sealer Sealer) error {
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode plan: %w", err)
+	}
+	data = append(data, '\n')
+	if sealer != nil {
+		if data, err = sealer.Seal(data, sealedPlan); err != nil {
+			return fmt.Errorf("failed to encrypt plan: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("failed to save plan: %w", err)
+	}
+	return nil
+}
+
+// Load reads a plan file, opening it with the sealer when it is sealed
+func Load(path string, sealer Sealer) (*File, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read plan: %w", err)
+	}
+	if sealer != nil {
+		if data, err = sealer.Open(data, sealedPlan); err != nil {
+			return nil, fmt.Errorf("failed to decrypt plan %s: %w", path, err)
+		}
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("%s is not a plan file: %w", path, err)
+	}
+	if f.FormatVersion != FormatVersion {
+		return nil, fmt.Errorf("plan file %s has format version %d, this forge reads version %d", path, f.FormatVersion, FormatVersion)
+	}
+	if f.ModuleFile == "" || f.Fingerprint == nil {
+		return nil, fmt.Errorf("plan file %s does not name its module", path)
+	}
+	for i := range f.Hosts {
+		for j := range f.Hosts[i].Changes {
+			if err := openDiff(f.Hosts[i].Name, &f.Hosts[i].Changes[j], sealer); err != nil {
+				return nil, fmt.Errorf("plan file %s: %w", path, err)
+			}
+		}
+	}
+	return &f, nil
+}
+
+// openDiff decrypts the diff of a change sealed by SealDiffs
+func openDiff(host string, change *Change, sealer Sealer) error {
+	if change.SealedDiff == "" {
+		return nil
+	}
+	if sealer == nil {
+		return fmt.Errorf("the diff of %s is encrypted, but no keys are configured", change.Resource)
+	}
+	data, err := sealer.Open([]byte(change.SealedDiff), diffName(host, change))
+	if err != nil {
+		return fmt.Errorf("failed to decrypt the diff of %s: %w", change.Resource, err)
+	}
+	var diff types.ResourceDiff
+	if err := json.Unmarshal(data, &diff); err != nil {
+		return fmt.Errorf("the diff of %s is corrupt: %w", change.Resource, err)
+	}
+	change.Diff, change.SealedDiff = &diff, ""
+	return nil
+}
+
+// HostNames returns the hosts in the plan, sorted
+func (f *File) HostNames() []string {
+	names := make([]string, 0, len(f.Hosts))
+	for _, host := range f.Hosts {
+		names = append(names, host.Name)
+	}
+	return names
+}
+
+// ResourceChanges returns the planned changes of a resource on each host
+// it was planned for, keyed by host
+func (f *File) ResourceChanges(resource string) map[string]Change {
+	changes := make(map[string]Change)
+	for _, host := range f.Hosts {
+		for _, change := range host.Changes {
+			if change.Resource == resource {
+				changes[host.Name] = change
+			}
+		}
+	}
+	return changes
+}
+
+// StaleError lists how things changed since a plan was saved
+type StaleError struct {
+	Reasons []string
+}
+
+func (e *StaleError) Error() string {
+	return "the saved plan no longer matches, plan again:\n  " + strings.Join(e.Reasons, "\n  ")
+}
+
+// CheckInputs compares the inputs of an apply with those the plan was made
+// from: the forge version and the module, inventory and policy files
+func (f *File) CheckInputs(current *audit.Fingerprint) error {
+	var reasons []string
+	saved := f.Fingerprint
+	if saved.ControllerVersion != current.ControllerVersion {
+		reasons = append(reasons, fmt.Sprintf("planned with forge %s, applying with %s", saved.ControllerVersion, current.ControllerVersion))
+	}
+	if saved.ModuleHash != current.ModuleHash {
+		reasons = append(reasons, fmt.Sprintf("module %s changed since planning", f.ModuleFile))
+	}
+	if saved.InventoryHash != current.InventoryHash {
+		reasons = append(reasons, fmt.Sprintf("inventory %s changed since planning", f.InventoryFile))
+	}
+	if saved.PolicyHash != current.PolicyHash {
+		reasons = append(reasons, "policies in effect changed since planning")
+	}
+	if len(reasons) > 0 {
+		return &StaleError{Reasons: reasons}
+	}
+	return nil
+}
+
+// Check compares fresh plans of the hosts with the saved ones. Any host,
+// resource, action or state that differs makes the saved plan stale.
+func (f *File) Check(plans map[string]*core.Plan) error {
+	var reasons []string
+	saved := make(map[string]bool, len(f.Hosts))
+	for _, host := range f.Hosts {
+		saved[host.Name] = true
+		plan, ok := plans[host.Name]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%s: not planned this time", host.Name))
+			continue
+		}
+		reasons = append(reasons, checkHost(host, plan)...)
+	}
+	var extra []string
+	for name := range plans {
+		if !saved[name] {
+			extra = append(extra, name)
+		}
+	}
+	sort.Strings(extra)
+	for _, name := range extra {
+		reasons = append(reasons, fmt.Sprintf("%s: not in the saved plan", name))
+	}
+	if len(reasons) > 0 {
+		return &StaleError{Reasons: reasons}
+	}
+	return nil
+}
+
+// checkHost compares a fresh plan of a host with its saved plan
+func checkHost(host Host, plan *core.Plan) []string {
+	var reasons []string
+	fresh := make(map[string]core.Change, len(plan.Changes))
+	for _, change := range plan.Changes {
+		fresh[change.Resource.ResourceID()] = change
+	}
+	for _, savedChange := range host.Changes {
+		change, ok := fresh[savedChange.Resource]
+		if !ok {
+			reasons = append(reasons, fmt.Sprintf("%s: %s is no longer in the module", host.Name, savedChange.Resource))
+			continue
+		}
+		delete(fresh, savedChange.Resource)
+		if change.Error != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %s now fails to plan: %v", host.Name, savedChange.Resource, change.Error))
+			continue
+		}
+		current, err := newChange(change)
+		if err != nil {
+			reasons = append(reasons, fmt.Sprintf("%s: %v", host.Name, err))
+			continue
+		}
+		switch {
+		case current.Digest != savedChange.Digest:
+			reasons = append(reasons, fmt.Sprintf("%s: %s is defined differently than when planned", host.Name, savedChange.Resource))
+		case current.StateDigest != savedChange.StateDigest:
+			reasons = append(reasons, fmt.Sprintf("%s: state of %s changed since planning", host.Name, savedChange.Resource))
+		case current.Audit != savedChange.Audit:
+			reasons = append(reasons, fmt.Sprintf("%s: %s would now be %s", host.Name, savedChange.Resource, auditedOrApplied(current.Audit)))
+		case current.Action != savedChange.Action:
+			reasons = append(reasons, fmt.Sprintf("%s: %s would now %s instead of %s", host.Name, savedChange.Resource, current.Action, savedChange.Action))
+		}
+	}
+	for _, change := range plan.Changes {
+		if _, added := fresh[change.Resource.ResourceID()]; added {
+			reasons = append(reasons, fmt.Sprintf("%s: %s is not in the saved plan", host.Name, change.Resource.ResourceID()))
+		}
+	}
+	return reasons
+}
+
+// auditedOrApplied describes how a change is carried out
+func auditedOrApplied(audit bool) string {
+	if audit {
+		return "audited instead of applied"
+	}
+	return "applied instead of audited"
+}
@@ -0,0 +1,284 @@
+package planfile
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/audit"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+// testPlan plans an installed nginx and a missing motd file
+func testPlan(nginxVersion string) *core.Plan {
+	plan := core.NewPlan()
+	plan.AddChange(core.Change{
+		Action:   core.ActionNoOp,
+		Resource: types.Resource{Type: "pkg", Name: "nginx", Properties: map[string]interface{}{"state": "present"}},
+		State:    map[string]interface{}{"installed": true, "version": nginxVersion},
+	})
+	plan.AddChange(core.Change{
+		Action:   core.ActionCreate,
+		Resource: types.Resource{Type: "file", Name: "motd", Properties: map[string]interface{}{"path": "/etc/motd", "content": "hi"}},
+	})
+	return plan
+}
+
+func TestFile_RoundTrip(t *testing.T) {
+	fingerprint := &audit.Fingerprint{ControllerVersion: "1.0.0", ModuleHash: "m"}
+	f := New(fingerprint, "web.yaml", "inventory.yaml", false)
+	f.Targets = []string{"tag=web"}
+	if err := f.AddHost("web2", testPlan("1.18")); err != nil {
+		t.Fatalf("AddHost: %v", err)
+	}
+	if err := f.AddHost("web1", testPlan("1.18")); err != nil {
+		t.Fatalf("AddHost: %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "plan.bin")
+	if err := f.Write(path, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	loaded, err := Load(path, nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if got := strings.Join(loaded.HostNames(), ","); got != "web1,web2" {
+		t.Errorf("HostNames = %s, want sorted hosts", got)
+	}
+	if loaded.ModuleFile != "web.yaml" || loaded.Targets[0] != "tag=web" || loaded.Hosts[0].Changes[1].Action != "create" {
+		t.Errorf("loaded = %+v", loaded)
+	}
+	if err := loaded.Check(map[string]*core.Plan{"web1": testPlan("1.18"), "web2": testPlan("1.18")}); err != nil {
+		t.Errorf("Check of unchanged plans: %v", err)
+	}
+	if err := loaded.CheckInputs(&audit.Fingerprint{ControllerVersion: "1.0.0", ModuleHash: "m"}); err != nil {
+		t.Errorf("CheckInputs of unchanged inputs: %v", err)
+	}
+}
+
+func TestFile_ResourceChanges(t *testing.T) {
+	f := New(&audit.Fingerprint{}, "web.yaml", "", false)
+	if err := f.AddHost("web1", testPlan("1.18")); err != nil {
+		t.Fatalf("AddHost: %v", err)
+	}
+	if err := f.AddHost("web2", testPlan("1.18")); err != nil {
+		t.Fatalf("AddHost: %v", err)
+	}
+
+	changes := f.ResourceChanges("file.motd")
+	if len(changes) != 2 || changes["web1"].Action != "create" || changes["web2"].Diff != nil {
+		t.Errorf("ResourceChanges(file.motd) = %+v", changes)
+	}
+	if changes := f.ResourceChanges("file.missing"); len(changes) != 0 {
+		t.Errorf("ResourceChanges(file.missing) = %+v, want none", changes)
+	}
+}
+
+func TestFile_AddHostWithErrors(t *testing.T) {
+	plan := testPlan("1.18")
+	plan.Changes[0].Error = errors.New("validation failed")
+	if err := New(&audit.Fingerprint{}, "web.yaml", "", false).AddHost("web1", plan); err == nil {
+		t.Error("expected a plan with errors to be refused")
+	}
+}
+
+func TestFile_Check(t *testing.T) {
+	f := New(&audit.Fingerprint{}, "web.yaml", "", false)
+	f.AddHost("web1", testPlan("1.18"))
+
+	tests := []struct {
+		name  string
+		plans func() map[string]*core.Plan
+		want  string
+	}{
+		{
+			name:  "state changed",
+			plans: func() map[string]*core.Plan { return map[string]*core.Plan{"web1": testPlan("1.20")} },
+			want:  "web1: state of pkg.nginx changed since planning",
+		},
+		{
+			name: "resource changed",
+			plans: func() map[string]*core.Plan {
+				plan := testPlan("1.18")
+				plan.Changes[1].Resource.Properties["content"] = "bye"
+				return map[string]*core.Plan{"web1": plan}
+			},
+			want: "web1: file.motd is defined differently than when planned",
+		},
+		{
+			name: "action changed",
+			plans: func() map[string]*core.Plan {
+				plan := testPlan("1.18")
+				plan.Changes[1].Action = core.ActionUpdate
+				return map[string]*core.Plan{"web1": plan}
+			},
+			want: "web1: file.motd would now update instead of create",
+		},
+		{
+			name: "audited",
+			plans: func() map[string]*core.Plan {
+				plan := testPlan("1.18")
+				plan.Changes[1].Audit = true
+				return map[string]*core.Plan{"web1": plan}
+			},
+			want: "web1: file.motd would now be audited instead of applied",
+		},
+		{
+			name: "resource removed and added",
+			plans: func() map[string]*core.Plan {
+				plan := testPlan("1.18")
+				plan.Changes[1].Resource.Name = "issue"
+				return map[string]*core.Plan{"web1": plan}
+			},
+			want: "web1: file.motd is no longer in the module\n  web1: file.issue is not in the saved plan",
+		},
+		{
+			name:  "hosts changed",
+			plans: func() map[string]*core.Plan { return map[string]*core.Plan{"web2": testPlan("1.18")} },
+			want:  "web1: not planned this time\n  web2: not in the saved plan",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := f.Check(tt.plans())
+			var stale *StaleError
+			if !errors.As(err, &stale) {
+				t.Fatalf("Check = %v, want a StaleError", err)
+			}
+			if !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Check =\n%v\nwant\n%s", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestFile_CheckInputs(t *testing.T) {
+	f := New(&audit.Fingerprint{ControllerVersion: "1.0.0", ModuleHash: "m", InventoryHash: "i"}, "web.yaml", "inventory.yaml", false)
+	err := f.CheckInputs(&audit.Fingerprint{ControllerVersion: "1.1.0", ModuleHash: "m2", InventoryHash: "i", PolicyHash: "p"})
+	for _, want := range []string{"planned with forge 1.0.0, applying with 1.1.0", "module web.yaml changed", "policies in effect changed"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("CheckInputs = %v, want %q", err, want)
+		}
+	}
+	if err != nil && strings.Contains(err.Error(), "inventory") {
+		t.Errorf("CheckInputs = %v, the inventory did not change", err)
+	}
+}
+
+func TestFile_Sealed(t *testing.T) {
+	encoded, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := vault.ParseKey(encoded)
+	keyring := vault.KeyFunc(func(id string) ([]byte, error) { return key, nil })
+
+	f := New(&audit.Fingerprint{ModuleHash: "m"}, "web.yaml", "", true)
+	if err := f.AddHost("localhost", testPlan("1.18")); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.bin")
+	if err := f.Write(path, vault.NewSealer(keyring, "default")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if !vault.IsEncrypted(data) || strings.Contains(string(data), "nginx") {
+		t.Fatalf("sealed plan = %s", data)
+	}
+
+	if _, err := Load(path, nil); err == nil {
+		t.Error("Load without a sealer read a sealed plan")
+	}
+	if _, err := Load(path, vault.NewSealer(nil, "")); err == nil || !strings.Contains(err.Error(), "no keys are configured") {
+		t.Errorf("Load without keys = %v", err)
+	}
+	loaded, err := Load(path, vault.NewSealer(keyring, ""))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if loaded.Hosts[0].Name != "localhost" || len(loaded.Hosts[0].Changes) != 2 {
+		t.Errorf("loaded = %+v", loaded)
+	}
+}
+
+func TestFile_SealedDiffs(t *testing.T) {
+	encoded, err := vault.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, _ := vault.ParseKey(encoded)
+	keyring := vault.KeyFunc(func(id string) ([]byte, error) { return key, nil })
+
+	plan := testPlan("1.18")
+	plan.Changes[1].Diff = &types.ResourceDiff{ResourceID: "file.motd", Action: types.ActionCreate, Changes: map[string]interface{}{"content": "password=hunter2"}}
+	f := New(&audit.Fingerprint{ModuleHash: "m"}, "web.yaml", "", true)
+	if err := f.AddHost("localhost", plan); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.SealDiffs(vault.NewSealer(keyring, "default")); err != nil {
+		t.Fatalf("SealDiffs: %v", err)
+	}
+	path := filepath.Join(t.TempDir(), "plan.json")
+	if err := f.Write(path, nil); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if strings.Contains(string(data), "hunter2") || !strings.Contains(string(data), "file.motd") {
+		t.Fatalf("plan with sealed diffs = %s", data)
+	}
+
+	if _, err := Load(path, vault.NewSealer(nil, "")); err == nil || !strings.Contains(err.Error(), "the diff of file.motd") {
+		t.Errorf("Load without keys = %v", err)
+	}
+	loaded, err := Load(path, vault.NewSealer(keyring, ""))
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if diff := loaded.Hosts[0].Changes[1].Diff; diff == nil || diff.Changes["content"] != "password=hunter2" {
+		t.Errorf("opened diff = %+v", diff)
+	}
+
+	// A sealed diff does not open as the diff of another change
+	f.Hosts[0].Changes[0].SealedDiff = f.Hosts[0].Changes[1].SealedDiff
+	if err := f.Write(path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Load(path, vault.NewSealer(keyring, "")); err == nil {
+		t.Error("Load opened a diff moved to another change")
+	}
+
+	f = New(&audit.Fingerprint{ModuleHash: "m"}, "web.yaml", "", true)
+	if err := f.AddHost("localhost", plan); err != nil {
+		t.Fatal(err)
+	}
+	f.RedactDiffs(func(s string) string { return strings.ReplaceAll(s, "hunter2", "[REDACTED]") })
+	if got := f.Hosts[0].Changes[1].Diff.Changes["content"]; got != "password=[REDACTED]" {
+		t.Errorf("redacted content = %v", got)
+	}
+}
+
+func TestLoad_Invalid(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]*File{
+		"old format": {FormatVersion: 99, ModuleFile: "web.yaml", Fingerprint: &audit.Fingerprint{}},
+		"no module":  {FormatVersion: FormatVersion, Fingerprint: &audit.Fingerprint{}},
+	}
+	for name, f := range tests {
+		path := filepath.Join(dir, name)
+		if err := f.Write(path, nil); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+		if _, err := Load(path, nil); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := Load(filepath.Join(dir, "missing"), nil); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"sync"
 
@@ -121,6 +122,7 @@ func (e *PolicyEngine) GetLoadedPolicies() []string {
 	for name := range e.policies {
 		names = append(names, name)
 	}
+	sort.Strings(names)
 	return names
 }
 
@@ -144,8 +146,9 @@ func (e *PolicyEngine) EvaluateResource(ctx context.Context, resource *types.Res
 		Violations: make([]PolicyViolation, 0),
 	}
 	
-	// Evaluate against each policy
-	for policyName, policyContent := range policies {
+	// Evaluate against each policy in name order so violations are reported deterministically
+	for _, policyName := range sortedPolicyNames(policies) {
+		policyContent := policies[policyName]
 		violations, err := e.evaluateResourceAgainstPolicy(ctx, resource, policyName, policyContent)
 		if err != nil {
 			return nil, fmt.Errorf("failed to evaluate policy %s: %w", policyName, err)
@@ -193,7 +196,8 @@ func (e *PolicyEngine) EvaluateModule(ctx context.Context, module *core.Module)
 	}
 	
 	// Also evaluate module-level policies
-	for policyName, policyContent := range policies {
+	for _, policyName := range sortedPolicyNames(policies) {
+		policyContent := policies[policyName]
 		violations, err := e.evaluateModuleAgainstPolicy(ctx, module, policyName, policyContent)
 		if err != nil {
 			return nil, fmt.Errorf("failed to evaluate module policy %s: %w", policyName, err)
@@ -210,6 +214,16 @@ func (e *PolicyEngine) EvaluateModule(ctx context.Context, module *core.Module)
 	return result, nil
 }
 
+// sortedPolicyNames returns policy names in sorted order
+func sortedPolicyNames(policies map[string]string) []string {
+	names := make([]string, 0, len(policies))
+	for name := range policies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
 // evaluateResourceAgainstPolicy evaluates a resource against a specific policy
 func (e *PolicyEngine) evaluateResourceAgainstPolicy(ctx context.Context, resource *types.Resource, policyName, policyContent string) ([]PolicyViolation, error) {
 	// In a real implementation, this would use OPA (Open Policy Agent)
@@ -245,6 +259,20 @@ func (e *PolicyEngine) evaluateResourceAgainstPolicy(ctx context.Context, resour
 		}
 	}
 	
+	if strings.Contains(policyContent, "chisel.shell") {
+		// Shell policy evaluation
+		if resource.Type == "shell" && strings.Contains(policyContent, "deny_raw_command") {
+			if _, raw := resource.Properties["command"]; raw {
+				violations = append(violations, PolicyViolation{
+					Policy:   policyName,
+					Rule:     "deny_raw_command",
+					Message:  fmt.Sprintf("Shell %s runs a raw command string; use args instead", resource.Name),
+					Resource: resource.ResourceID(),
+				})
+			}
+		}
+	}
+	
 	if strings.Contains(policyContent, "chisel.compliance") {
 		// Compliance policy evaluation
 		if resource.Type == "service" {
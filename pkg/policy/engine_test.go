@@ -188,6 +188,46 @@ deny[msg] {
 	}
 }
 
+func TestPolicyEngine_DenyRawShellCommand(t *testing.T) {
+	engine := NewPolicyEngine()
+	policyContent := `
+package chisel.shell
+
+deny_raw_command[msg] {
+	input.resource.type == "shell"
+	input.resource.properties.command
+	msg := "shell resources must use args instead of command"
+}
+`
+	if err := engine.LoadPolicy("shell", policyContent); err != nil {
+		t.Fatalf("Failed to load policy: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		allowed    bool
+	}{
+		{name: "raw command", properties: map[string]interface{}{"command": "systemctl restart app"}},
+		{name: "argv", properties: map[string]interface{}{"args": []interface{}{"systemctl", "restart", "app"}}, allowed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "shell", Name: "restart", Properties: tt.properties}
+			result, err := engine.EvaluateResource(context.Background(), resource)
+			if err != nil {
+				t.Fatalf("Failed to evaluate resource: %v", err)
+			}
+			if result.Allowed != tt.allowed {
+				t.Errorf("Allowed = %v, want %v (violations: %v)", result.Allowed, tt.allowed, result.Violations)
+			}
+			if !tt.allowed && result.Violations[0].Rule != "deny_raw_command" {
+				t.Errorf("Rule = %s, want deny_raw_command", result.Violations[0].Rule)
+			}
+		})
+	}
+}
+
 func TestPolicyEngine_EvaluateModule(t *testing.T) {
 	engine := NewPolicyEngine()
 	
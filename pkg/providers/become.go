@@ -0,0 +1,85 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// becomeProvider runs a provider's commands with the privilege escalation
+// its resource overrides from the target's become settings
+type becomeProvider struct {
+	types.Provider
+	// privileged are the programs become_allowlist escalates for the
+	// provider
+	privileged []string
+}
+
+// withBecome returns a context carrying the resource's become override
+func withBecome(ctx context.Context, resource *types.Resource) context.Context {
+	if resource.Become == nil && resource.BecomeUser == "" && resource.BecomeMethod == "" {
+		return ctx
+	}
+	return ssh.WithBecome(ctx, ssh.BecomeOverride{
+		Enabled: resource.Become,
+		User:    resource.BecomeUser,
+		Method:  resource.BecomeMethod,
+	})
+}
+
+// withPrivileged returns a context carrying the programs the provider runs
+// as root for the resource. A shell command that cannot be listed fails
+// when it is escalated, so the error is left to that.
+func (p *becomeProvider) withPrivileged(ctx context.Context, resource *types.Resource) context.Context {
+	programs := p.privileged
+	if lister, ok := p.Provider.(types.PrivilegedProvider); ok {
+		if found, err := lister.PrivilegedPrograms(resource); err == nil {
+			programs = append(append([]string(nil), programs...), found...)
+		}
+	}
+	return ssh.WithPrivileged(withBecome(ctx, resource), programs)
+}
+
+func (p *becomeProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return p.Provider.Read(p.withPrivileged(ctx, resource), resource)
+}
+
+func (p *becomeProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	return p.Provider.Diff(p.withPrivileged(ctx, resource), resource, current)
+}
+
+func (p *becomeProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	return p.Provider.Apply(p.withPrivileged(ctx, resource), resource, diff)
+}
+
+// Capabilities returns the capabilities of the wrapped provider
+func (p *becomeProvider) Capabilities() types.Capabilities {
+	return types.ProviderCapabilities(p.Provider)
+}
+
+// PrivilegedPrograms returns the programs the wrapped provider runs as root
+// for the resource, when they depend on it
+func (p *becomeProvider) PrivilegedPrograms(resource *types.Resource) ([]string, error) {
+	if lister, ok := p.Provider.(types.PrivilegedProvider); ok {
+		return lister.PrivilegedPrograms(resource)
+	}
+	return nil, nil
+}
+
+// wrapBecome returns a registry whose providers honour per-resource become overrides
+func wrapBecome(registry *types.ProviderRegistry) (*types.ProviderRegistry, error) {
+	wrapped := types.NewProviderRegistry()
+	for _, resourceType := range registry.Types() {
+		provider, err := registry.Get(resourceType)
+		if err != nil {
+			return nil, err
+		}
+		privileged := types.ProviderCapabilities(provider).Privileged
+		if err := wrapped.Register(&becomeProvider{Provider: provider, privileged: privileged}); err != nil {
+			return nil, fmt.Errorf("failed to wrap %s provider: %w", resourceType, err)
+		}
+	}
+	return wrapped, nil
+}
@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// commandRecorder records every command it runs and succeeds with no output,
+// apart from facts of a systemd host
+type commandRecorder struct {
+	MockSSHConnection
+	mu       sync.Mutex
+	commands []string
+}
+
+func (c *commandRecorder) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.commands = append(c.commands, command)
+	if strings.Contains(command, "uname -s") {
+		return &ssh.ExecuteResult{Command: command, Stdout: "Linux\ninit:systemd\n"}, nil
+	}
+	return &ssh.ExecuteResult{Command: command}, nil
+}
+
+// take returns the recorded commands and forgets them
+func (c *commandRecorder) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	commands := c.commands
+	c.commands = nil
+	return commands
+}
+
+func TestTargetPool_Become(t *testing.T) {
+	recorder := &commandRecorder{}
+	dialer := func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		return recorder, nil
+	}
+	pool := NewTargetPool(DefaultFactoryRegistry(), dialer)
+	target, err := pool.Get(context.Background(), ssh.ConnectionConfig{Host: "web1", User: "deploy", Become: true})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	provider, err := target.Registry.Get("service")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := false
+	tests := []struct {
+		name       string
+		resource   types.Resource
+		wantPrefix string
+	}{
+		{
+			name:       "target settings",
+			resource:   types.Resource{Type: "service", Name: "nginx"},
+			wantPrefix: "sudo -n -H -u 'root' -- sh -c ",
+		},
+		{
+			name:       "resource user and method",
+			resource:   types.Resource{Type: "service", Name: "nginx", BecomeUser: "www-data", BecomeMethod: "doas"},
+			wantPrefix: "doas -n -u 'www-data' sh -c ",
+		},
+		{
+			name:     "resource disables become",
+			resource: types.Resource{Type: "service", Name: "nginx", Become: &disabled},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.take()
+			if _, err := provider.Read(context.Background(), &tt.resource); err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			commands := recorder.take()
+			if len(commands) == 0 {
+				t.Fatal("Expected Read to run commands")
+			}
+			for _, command := range commands {
+				if tt.wantPrefix == "" && (strings.HasPrefix(command, "sudo ") || strings.HasPrefix(command, "doas ")) {
+					t.Errorf("ran %q, want it unescalated", command)
+				}
+				if !strings.HasPrefix(command, tt.wantPrefix) {
+					t.Errorf("ran %q, want prefix %q", command, tt.wantPrefix)
+				}
+			}
+		})
+	}
+}
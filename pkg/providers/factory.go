@@ -0,0 +1,474 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/bandwidth"
+	"github.com/ataiva-software/forge/pkg/debuglog"
+	hostfacts "github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/transport"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// Factory creates a provider bound to a target connection
+type Factory func(connection ssh.Executor) types.Provider
+
+// FactoryRegistry holds provider factories so every target gets its own provider instances
+type FactoryRegistry struct {
+	mu        sync.RWMutex
+	factories map[string]Factory
+	artifacts *artifact.Cache
+}
+
+// NewFactoryRegistry creates an empty factory registry
+func NewFactoryRegistry() *FactoryRegistry {
+	return &FactoryRegistry{
+		factories: make(map[string]Factory),
+	}
+}
+
+// DefaultFactoryRegistry returns a factory registry with the core providers registered
+func DefaultFactoryRegistry() *FactoryRegistry {
+	r := NewFactoryRegistry()
+	r.factories["file"] = func(connection ssh.Executor) types.Provider {
+		provider := NewFileProvider(connection)
+		provider.SetArtifactCache(r.ArtifactCache())
+		return provider
+	}
+	r.factories["file_edit"] = func(connection ssh.Executor) types.Provider { return NewFileEditProvider(connection) }
+	r.factories["firewall"] = func(connection ssh.Executor) types.Provider { return NewFirewallProvider(connection) }
+	r.factories["pkg"] = func(connection ssh.Executor) types.Provider {
+		provider := NewPkgProvider(connection)
+		provider.SetArtifactCache(r.ArtifactCache())
+		return provider
+	}
+	r.factories["repo"] = func(connection ssh.Executor) types.Provider { return NewRepoProvider(connection) }
+	r.factories["service"] = func(connection ssh.Executor) types.Provider { return NewServiceProvider(connection) }
+	r.factories["user"] = func(connection ssh.Executor) types.Provider { return NewUserProvider(connection) }
+	r.factories["shell"] = func(connection ssh.Executor) types.Provider { return NewShellProvider(connection) }
+	r.factories["sync"] = func(connection ssh.Executor) types.Provider { return NewSyncProvider(connection) }
+	r.factories["wait_for"] = func(connection ssh.Executor) types.Provider { return NewWaitForProvider(connection) }
+	return r
+}
+
+// SetArtifactCache sets the cache shared by every provider that downloads artifacts,
+// so each artifact is downloaded once by the controller for all targets
+func (r *FactoryRegistry) SetArtifactCache(cache *artifact.Cache) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.artifacts = cache
+}
+
+// ArtifactCache returns the shared artifact cache, if any
+func (r *FactoryRegistry) ArtifactCache() *artifact.Cache {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.artifacts
+}
+
+// Register registers a provider factory for a resource type
+func (r *FactoryRegistry) Register(resourceType string, factory Factory) error {
+	if resourceType == "" {
+		return fmt.Errorf("resource type cannot be empty")
+	}
+	if factory == nil {
+		return fmt.Errorf("factory cannot be nil")
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.factories[resourceType]; exists {
+		return fmt.Errorf("factory for type %s already registered", resourceType)
+	}
+	r.factories[resourceType] = factory
+	return nil
+}
+
+// Types returns all registered resource types in sorted order
+func (r *FactoryRegistry) Types() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	resourceTypes := make([]string, 0, len(r.factories))
+	for t := range r.factories {
+		resourceTypes = append(resourceTypes, t)
+	}
+	sort.Strings(resourceTypes)
+	return resourceTypes
+}
+
+// Factory returns the factory registered for a resource type
+func (r *FactoryRegistry) Factory(resourceType string) (Factory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.factories[resourceType]
+	return factory, ok
+}
+
+// NewRegistry instantiates every registered provider against a connection
+func (r *FactoryRegistry) NewRegistry(connection ssh.Executor) (*types.ProviderRegistry, error) {
+	registry := types.NewProviderRegistry()
+	for _, resourceType := range r.Types() {
+		r.mu.RLock()
+		factory := r.factories[resourceType]
+		r.mu.RUnlock()
+
+		provider := factory(connection)
+		if provider == nil || provider.Type() != resourceType {
+			return nil, fmt.Errorf("factory for type %s returned a mismatched provider", resourceType)
+		}
+		if err := registry.Register(provider); err != nil {
+			return nil, fmt.Errorf("failed to register %s provider: %w", resourceType, err)
+		}
+	}
+	return registry, nil
+}
+
+// Target is a connected target with its own provider instances
+type Target struct {
+	Key        string
+	Connection ssh.Executor
+	Registry   *types.ProviderRegistry
+	// Workspace is the target's scratch directory for this run
+	Workspace *Workspace
+
+	// Facts are checked against provider capabilities at plan time. They are
+	// nil when they could not be gathered, which skips the checks.
+	Facts *types.TargetFacts
+
+	// System describes the target's OS, hardware and addresses for
+	// templates and when conditions. It is nil when it could not be gathered.
+	System *hostfacts.Facts
+
+	// FactsErr is why Facts or System could not be gathered
+	FactsErr error
+
+	// states caches the resource states the providers read
+	states *types.StateCache
+}
+
+// Dialer creates an unconnected executor for a target
+type Dialer func(config *ssh.ConnectionConfig) (ssh.Executor, error)
+
+// DefaultDialer creates the transport selected by the connection configuration
+func DefaultDialer(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+	return transport.New(config)
+}
+
+// PooledDialer creates transports like DefaultDialer, but SSH targets share
+// connections from the pool so commands are multiplexed over them
+func PooledDialer(pool *ssh.ConnectionPool) Dialer {
+	return func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		if config.TransportName() == ssh.TransportSSH {
+			return pool.Executor(config), nil
+		}
+		return DefaultDialer(config)
+	}
+}
+
+// targetEntry tracks a target while its connection is being established
+type targetEntry struct {
+	ready  chan struct{}
+	target *Target
+	err    error
+}
+
+// TargetPool connects to targets on demand and reuses the connection and
+// provider instances for each target. It is safe for concurrent use.
+type TargetPool struct {
+	factories *FactoryRegistry
+	dialer    Dialer
+	bandwidth *bandwidth.Limiter
+	debug     *debuglog.Logger
+	osquery   bool
+	cache     *hostfacts.Cache
+
+	interceptors []types.Interceptor
+	commandHooks []transport.CommandHook
+
+	mu      sync.Mutex
+	targets map[string]*targetEntry
+}
+
+// NewTargetPool creates a new target pool. A nil dialer uses DefaultDialer.
+func NewTargetPool(factories *FactoryRegistry, dialer Dialer) *TargetPool {
+	if dialer == nil {
+		dialer = DefaultDialer
+	}
+	return &TargetPool{
+		factories: factories,
+		dialer:    dialer,
+		osquery:   true,
+		targets:   make(map[string]*targetEntry),
+	}
+}
+
+// SetOsquery turns reading packages, users and listening ports through
+// osquery on targets that have it on or off. It is on by default.
+func (p *TargetPool) SetOsquery(enabled bool) {
+	p.osquery = enabled
+}
+
+// SetFactsCache keeps the system facts of targets between runs. Without a
+// cache they are gathered on every connection.
+func (p *TargetPool) SetFactsCache(cache *hostfacts.Cache) {
+	p.cache = cache
+}
+
+// SetBandwidth caps the combined rate at which commands and files are sent
+// to all targets. Per-target caps come from the connection's bandwidth setting.
+func (p *TargetPool) SetBandwidth(limiter *bandwidth.Limiter) {
+	p.bandwidth = limiter
+}
+
+// SetDebugLogger logs every command run on the pool's targets and every
+// provider decision, labelled with the target's host
+func (p *TargetPool) SetDebugLogger(logger *debuglog.Logger) {
+	p.debug = logger
+}
+
+// SetInterceptors passes every read, diff and apply of the providers of
+// the pool's targets through the interceptors, the first outermost
+func (p *TargetPool) SetInterceptors(interceptors ...types.Interceptor) {
+	p.interceptors = interceptors
+}
+
+// SetCommandHooks has every command run on the pool's targets checked by
+// the hooks first. They see the command before become escalates it.
+func (p *TargetPool) SetCommandHooks(hooks ...transport.CommandHook) {
+	p.commandHooks = hooks
+}
+
+// TargetKey returns the pool key for a connection configuration. A kubectl
+// target's namespace and container are part of it, so the same pod in two
+// namespaces, or two containers of one pod, get their own connections.
+func TargetKey(config ssh.ConnectionConfig) string {
+	key := fmt.Sprintf("%s://%s@%s:%d", config.TransportName(), config.User, config.Host, config.Port)
+	if config.Namespace != "" || config.Container != "" {
+		key += "/" + config.Namespace + "/" + config.Container
+	}
+	return key
+}
+
+// Get returns the target for a connection configuration, connecting on first use.
+// Concurrent callers for the same target share a single connection attempt.
+func (p *TargetPool) Get(ctx context.Context, config ssh.ConnectionConfig) (*Target, error) {
+	key := TargetKey(config)
+
+	p.mu.Lock()
+	if entry, exists := p.targets[key]; exists {
+		p.mu.Unlock()
+		select {
+		case <-entry.ready:
+			return entry.target, entry.err
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	entry := &targetEntry{ready: make(chan struct{})}
+	p.targets[key] = entry
+	p.mu.Unlock()
+
+	entry.target, entry.err = p.connect(ctx, key, config)
+	if entry.err != nil {
+		// Forget failed attempts so a later call can retry
+		p.mu.Lock()
+		delete(p.targets, key)
+		p.mu.Unlock()
+	}
+	close(entry.ready)
+
+	return entry.target, entry.err
+}
+
+// connect opens a connection and builds the target's provider registry
+func (p *TargetPool) connect(ctx context.Context, key string, config ssh.ConnectionConfig) (*Target, error) {
+	connection, err := p.dialer(&config)
+	if err != nil {
+		return nil, err
+	}
+	var hostLimit *bandwidth.Limiter
+	if config.Bandwidth != "" {
+		rate, err := bandwidth.ParseRate(config.Bandwidth)
+		if err != nil {
+			return nil, err
+		}
+		hostLimit = bandwidth.NewLimiter(rate)
+	}
+	// Resources can turn become on or off for their own commands, so every
+	// command passes through the become executor
+	connection = ssh.NewBecomeExecutor(connection, config.BecomeSettings())
+	connection = transport.NewHookedTransport(connection, p.commandHooks...)
+	connection = transport.NewThrottledTransport(connection, hostLimit, p.bandwidth)
+	logger := p.debug.With(config.Host)
+	if logger != nil {
+		logger.Redactor().AddSecret(config.Password)
+		logger.Redactor().AddSecret(config.PrivateKeyPassphrase)
+		logger.Redactor().AddSecret(config.BecomePassword)
+	}
+	connection = transport.NewDebugTransport(connection, logger)
+	if err := connection.Connect(ctx); err != nil {
+		return nil, err
+	}
+
+	workspace := NewWorkspace(connection)
+	base, err := p.factories.NewRegistry(connection)
+	var registry *types.ProviderRegistry
+	if err == nil {
+		useWorkspace(base, workspace)
+		registry, err = wrapBecome(base)
+	}
+	if err == nil {
+		registry, err = debuglog.WrapRegistry(registry, logger)
+	}
+	if err != nil {
+		connection.Close()
+		return nil, err
+	}
+
+	// Interceptors see the operations that reach the providers, not those
+	// the cache answers. Reads are cached for the lifetime of the pool,
+	// which is a single run unless ForgetStates is called between runs.
+	registry = registry.WithInterceptors(config.Host, p.interceptors...)
+	states := types.NewStateCache(types.DefaultStateCacheSize)
+	registry = registry.WithCache(states)
+
+	// Windows targets have no POSIX shell to probe
+	var facts *types.TargetFacts
+	var system *hostfacts.Facts
+	var factsErr error
+	if config.TransportName() == ssh.TransportWinRM {
+		facts = &types.TargetFacts{Host: config.Host, OSFamily: types.OSFamilyWindows}
+		system = &hostfacts.Facts{Host: config.Host, OSFamily: types.OSFamilyWindows, GatheredAt: time.Now().UTC()}
+	} else {
+		commands := RequiredCommands(registry)
+		if p.osquery {
+			commands = append(commands, OsqueryCommand)
+		}
+		var capabilityErr, systemErr error
+		facts, capabilityErr = GatherFacts(ctx, connection, config.Host, commands)
+		if capabilityErr != nil {
+			capabilityErr = fmt.Errorf("failed to probe capabilities: %w", capabilityErr)
+		}
+		system, systemErr = p.cache.Gather(ctx, connection, config.Host)
+		if systemErr != nil {
+			systemErr = fmt.Errorf("failed to gather facts: %w", systemErr)
+		}
+		factsErr = errors.Join(capabilityErr, systemErr)
+	}
+
+	// Providers run the package manager and init system the facts found
+	// instead of probing
+	if manager := packageManagerFor(facts); manager != nil {
+		UsePackageManager(base, manager.name)
+	}
+	if system := initSystemFor(facts); system != nil {
+		UseInitSystem(base, system.name)
+	}
+
+	// Providers answer reads from an osquery snapshot where they can
+	if p.osquery && facts != nil && facts.HasCommand(OsqueryCommand) {
+		if snapshot, err := GatherOsquery(ctx, connection, facts.OSFamily); err == nil {
+			useOsquery(base, snapshot)
+			facts.ListeningPorts = snapshot.ListeningPorts()
+		}
+	}
+
+	return &Target{Key: key, Connection: connection, Registry: registry, Workspace: workspace, Facts: facts, System: system, FactsErr: factsErr, states: states}, nil
+}
+
+// useWorkspace gives the providers that keep scratch files the target's workspace
+func useWorkspace(registry *types.ProviderRegistry, workspace *Workspace) {
+	for _, resourceType := range registry.Types() {
+		if provider, err := registry.Get(resourceType); err == nil {
+			if user, ok := provider.(workspaceUser); ok {
+				user.SetWorkspace(workspace)
+			}
+		}
+	}
+}
+
+// close removes the target's workspace and closes its connection
+func (t *Target) close() error {
+	if err := t.Workspace.Remove(context.Background()); err != nil {
+		t.Connection.Close()
+		return err
+	}
+	return t.Connection.Close()
+}
+
+// Close closes and forgets the target for a connection configuration
+func (p *TargetPool) Close(config ssh.ConnectionConfig) error {
+	key := TargetKey(config)
+
+	p.mu.Lock()
+	entry, exists := p.targets[key]
+	delete(p.targets, key)
+	p.mu.Unlock()
+
+	if !exists {
+		return nil
+	}
+	<-entry.ready
+	if entry.target == nil {
+		return nil
+	}
+	return entry.target.close()
+}
+
+// ForgetStates drops the resource states cached for every target, so a
+// pool kept for several runs reads what an earlier run changed afresh
+func (p *TargetPool) ForgetStates() {
+	p.mu.Lock()
+	entries := make([]*targetEntry, 0, len(p.targets))
+	for _, entry := range p.targets {
+		entries = append(entries, entry)
+	}
+	p.mu.Unlock()
+
+	for _, entry := range entries {
+		<-entry.ready
+		if entry.target != nil && entry.target.states != nil {
+			entry.target.states.Clear()
+		}
+	}
+}
+
+// CloseAll closes every pooled connection
+func (p *TargetPool) CloseAll() error {
+	p.mu.Lock()
+	entries := p.targets
+	p.targets = make(map[string]*targetEntry)
+	p.mu.Unlock()
+
+	keys := make([]string, 0, len(entries))
+	for key := range entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var errors []error
+	for _, key := range keys {
+		entry := entries[key]
+		<-entry.ready
+		if entry.target == nil {
+			continue
+		}
+		if err := entry.target.close(); err != nil {
+			errors = append(errors, fmt.Errorf("failed to close connection %s: %w", key, err))
+		}
+	}
+
+	if len(errors) > 0 {
+		return fmt.Errorf("errors closing connections: %v", errors)
+	}
+	return nil
+}
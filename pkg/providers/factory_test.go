@@ -0,0 +1,281 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/bandwidth"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/transport"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// countingExecutor counts connects and closes, optionally failing to connect
+type countingExecutor struct {
+	MockSSHConnection
+	connects   *int32
+	closes     *int32
+	connectErr error
+}
+
+func (c *countingExecutor) Connect(ctx context.Context) error {
+	atomic.AddInt32(c.connects, 1)
+	return c.connectErr
+}
+
+func (c *countingExecutor) Close() error {
+	atomic.AddInt32(c.closes, 1)
+	return nil
+}
+
+func TestFactoryRegistry_NewRegistry(t *testing.T) {
+	factories := DefaultFactoryRegistry()
+
+	want := []string{"file", "file_edit", "firewall", "pkg", "repo", "service", "shell", "sync", "user", "wait_for"}
+	got := factories.Types()
+	if len(got) != len(want) {
+		t.Fatalf("Types() = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("Types()[%d] = %s, want %s", i, got[i], want[i])
+		}
+	}
+
+	first, err := factories.NewRegistry(&MockSSHConnection{})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+	second, err := factories.NewRegistry(&MockSSHConnection{})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	a, _ := first.Get("file")
+	b, _ := second.Get("file")
+	if a == b {
+		t.Error("Expected each registry to get its own provider instance")
+	}
+}
+
+func TestFactoryRegistry_Register(t *testing.T) {
+	factories := NewFactoryRegistry()
+
+	if err := factories.Register("", func(connection ssh.Executor) types.Provider { return nil }); err == nil {
+		t.Error("Expected error for empty resource type")
+	}
+	if err := factories.Register("file", nil); err == nil {
+		t.Error("Expected error for nil factory")
+	}
+
+	mismatched := func(connection ssh.Executor) types.Provider { return NewShellProvider(connection) }
+	if err := factories.Register("file", mismatched); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := factories.Register("file", mismatched); err == nil {
+		t.Error("Expected error for duplicate registration")
+	}
+	if _, err := factories.NewRegistry(&MockSSHConnection{}); err == nil {
+		t.Error("Expected error for factory returning a provider of another type")
+	}
+}
+
+func TestTargetPool_Get(t *testing.T) {
+	var connects, closes int32
+	dialer := func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		executor := &countingExecutor{connects: &connects, closes: &closes}
+		if config.Host == "down" {
+			executor.connectErr = errors.New("connection refused")
+		}
+		return executor, nil
+	}
+
+	pool := NewTargetPool(DefaultFactoryRegistry(), dialer)
+	ctx := context.Background()
+	config := ssh.ConnectionConfig{Host: "web1", User: "deploy", Port: 22}
+
+	// Concurrent callers share one connection
+	var wg sync.WaitGroup
+	targets := make([]*Target, 10)
+	for i := range targets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			target, err := pool.Get(ctx, config)
+			if err != nil {
+				t.Errorf("Get() error = %v", err)
+				return
+			}
+			targets[i] = target
+		}(i)
+	}
+	wg.Wait()
+
+	if atomic.LoadInt32(&connects) != 1 {
+		t.Errorf("Expected 1 connect, got %d", connects)
+	}
+	for _, target := range targets[1:] {
+		if target != targets[0] {
+			t.Fatal("Expected all callers to receive the same target")
+		}
+	}
+
+	// Different target gets its own connection and providers
+	other, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "web2", User: "deploy", Port: 22})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if other.Registry == targets[0].Registry {
+		t.Error("Expected a separate registry per target")
+	}
+
+	// Failed connections are not cached
+	down := ssh.ConnectionConfig{Host: "down", User: "deploy", Port: 22}
+	if _, err := pool.Get(ctx, down); err == nil {
+		t.Error("Expected error for unreachable target")
+	}
+	if _, err := pool.Get(ctx, down); err == nil {
+		t.Error("Expected error for unreachable target")
+	}
+	if atomic.LoadInt32(&connects) != 4 {
+		t.Errorf("Expected failed target to be retried, got %d connects", connects)
+	}
+
+	if err := pool.CloseAll(); err != nil {
+		t.Fatalf("CloseAll() error = %v", err)
+	}
+	if atomic.LoadInt32(&closes) != 2 {
+		t.Errorf("Expected 2 closes, got %d", closes)
+	}
+}
+
+func TestTargetKey(t *testing.T) {
+	pod := ssh.ConnectionConfig{Transport: "kubectl", Host: "web-0", Namespace: "prod", Container: "app"}
+	keys := map[string]bool{TargetKey(pod): true}
+	for _, modify := range []func(*ssh.ConnectionConfig){
+		func(c *ssh.ConnectionConfig) { c.Namespace = "staging" },
+		func(c *ssh.ConnectionConfig) { c.Container = "sidecar" },
+		func(c *ssh.ConnectionConfig) { c.Namespace, c.Container = "", "" },
+	} {
+		config := pod
+		modify(&config)
+		key := TargetKey(config)
+		if keys[key] {
+			t.Errorf("TargetKey(%+v) = %q, shared with another target", config, key)
+		}
+		keys[key] = true
+	}
+}
+
+func TestTargetPool_Bandwidth(t *testing.T) {
+	dialer := func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		return &MockSSHConnection{}, nil
+	}
+	ctx := context.Background()
+
+	pool := NewTargetPool(DefaultFactoryRegistry(), dialer)
+	unlimited, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "web1"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, ok := unlimited.Connection.(*transport.ThrottledTransport); ok {
+		t.Errorf("Expected an unthrottled connection, got %T", unlimited.Connection)
+	}
+
+	capped, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "branch1", Bandwidth: "512K"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, ok := capped.Connection.(*transport.ThrottledTransport); !ok {
+		t.Errorf("Expected a throttled connection for a host with a bandwidth cap, got %T", capped.Connection)
+	}
+
+	// A global cap throttles every target
+	pool = NewTargetPool(DefaultFactoryRegistry(), dialer)
+	pool.SetBandwidth(bandwidth.NewLimiter(10 * 1024 * 1024))
+	target, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "web1"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if _, ok := target.Connection.(*transport.ThrottledTransport); !ok {
+		t.Errorf("Expected a throttled connection with a global cap, got %T", target.Connection)
+	}
+}
+
+func TestTargetPool_Interceptors(t *testing.T) {
+	dialer := func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		return &MockSSHConnection{}, nil
+	}
+	var mu sync.Mutex
+	var seen []string
+	pool := NewTargetPool(DefaultFactoryRegistry(), dialer)
+	pool.SetInterceptors(func(ctx context.Context, op *types.Operation, next types.Invoker) (*types.OperationResult, error) {
+		mu.Lock()
+		seen = append(seen, string(op.Kind)+" "+op.Resource.ResourceID()+" on "+op.Host)
+		mu.Unlock()
+		return next(ctx, op)
+	})
+	deny, err := transport.DenyCommands([]string{"^shutdown"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool.SetCommandHooks(deny)
+
+	ctx := context.Background()
+	target, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "web1"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	provider, err := target.Registry.Get("shell")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resource := &types.Resource{Type: "shell", Name: "halt", Properties: map[string]interface{}{"command": "shutdown -h now"}}
+	err = provider.Apply(ctx, resource, &types.ResourceDiff{Action: types.ActionUpdate})
+	if err == nil || !strings.Contains(err.Error(), "while applying shell.halt") {
+		t.Errorf("Apply() of a denied command error = %v", err)
+	}
+
+	// Reads are intercepted once; the cache answers the second
+	provider.Read(ctx, resource)
+	provider.Read(ctx, resource)
+	want := []string{"apply shell.halt on web1", "read shell.halt on web1"}
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("interceptors saw %q, want %q", seen, want)
+	}
+
+	// Forgotten states are read again, over the same connection
+	pool.ForgetStates()
+	provider.Read(ctx, resource)
+	if again, err := pool.Get(ctx, ssh.ConnectionConfig{Host: "web1"}); err != nil || again != target {
+		t.Errorf("Get() after ForgetStates() = %v, %v; want the same target", again, err)
+	}
+	want = append(want, "read shell.halt on web1")
+	if strings.Join(seen, ",") != strings.Join(want, ",") {
+		t.Errorf("interceptors saw %q, want %q", seen, want)
+	}
+}
+
+func TestPooledDialer(t *testing.T) {
+	dial := PooledDialer(ssh.NewConnectionPool(ssh.PoolConfig{}))
+
+	remote, err := dial(&ssh.ConnectionConfig{Host: "web1", User: "deploy"})
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+	if _, ok := remote.(*ssh.PooledExecutor); !ok {
+		t.Errorf("Expected SSH targets to use the pool, got %T", remote)
+	}
+
+	local, err := dial(&ssh.ConnectionConfig{Host: "localhost", Transport: ssh.TransportLocal})
+	if err != nil {
+		t.Fatalf("dial() error = %v", err)
+	}
+	if _, ok := local.(*ssh.LocalExecutor); !ok {
+		t.Errorf("Expected other transports to be dialed directly, got %T", local)
+	}
+}
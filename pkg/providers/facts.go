@@ -0,0 +1,121 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	hostfacts "github.com/ataiva-software/forge/pkg/facts"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// RequiredCommands returns every command the providers in a registry may run
+func RequiredCommands(registry *types.ProviderRegistry) []string {
+	var all types.Capabilities
+	for _, resourceType := range registry.Types() {
+		provider, err := registry.Get(resourceType)
+		if err != nil {
+			continue
+		}
+		all.Commands = append(all.Commands, types.ProviderCapabilities(provider).Commands...)
+	}
+	return all.RequiredCommands()
+}
+
+// GatherFacts discovers the OS family, distribution and init system of a
+// target and which of the given commands it has, in a single round trip
+func GatherFacts(ctx context.Context, connection ssh.Executor, host string, commands []string) (*types.TargetFacts, error) {
+	script := `uname -s || exit 1; (. /etc/os-release && echo "distro:$ID:$ID_LIKE") 2>/dev/null; ` + initSystemScript
+	if len(commands) > 0 {
+		quoted := make([]string, len(commands))
+		for i, command := range commands {
+			quoted[i] = shellEscape(command)
+		}
+		script += fmt.Sprintf("; for c in %s; do command -v \"$c\" >/dev/null 2>&1 && echo \"command:$c\"; done", strings.Join(quoted, " "))
+	}
+	script += "; true"
+
+	result, err := connection.Execute(ctx, script)
+	if err != nil {
+		return nil, fmt.Errorf("failed to gather facts: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to gather facts: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	return parseFacts(host, result.Stdout)
+}
+
+// parseFacts parses the output of the facts script
+func parseFacts(host, output string) (*types.TargetFacts, error) {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	family := strings.ToLower(strings.TrimSpace(lines[0]))
+	if family == "" {
+		return nil, fmt.Errorf("failed to gather facts: could not determine OS family")
+	}
+
+	facts := &types.TargetFacts{
+		Host:     host,
+		OSFamily: family,
+		Commands: make(map[string]bool),
+	}
+	for _, line := range lines[1:] {
+		line = strings.TrimSpace(line)
+		if command, ok := strings.CutPrefix(line, "command:"); ok {
+			facts.Commands[command] = true
+		} else if system, ok := strings.CutPrefix(line, "init:"); ok {
+			facts.InitSystem = system
+		} else if distro, ok := strings.CutPrefix(line, "distro:"); ok {
+			id, like, _ := strings.Cut(distro, ":")
+			facts.Distribution = strings.ToLower(strings.Trim(id, `"`))
+			facts.DistroFamily = hostfacts.DistroFamily(facts.Distribution, strings.Fields(strings.ToLower(strings.Trim(like, `"`))))
+		}
+	}
+	return facts, nil
+}
+
+// GatherPreflightFacts adds the kernel release, the free disk space at each
+// path and which of the given processes are running to a target's facts, in
+// a single round trip
+func GatherPreflightFacts(ctx context.Context, connection ssh.Executor, facts *types.TargetFacts, paths, processes []string) error {
+	script := `echo "kernel:$(uname -r)"`
+	for _, path := range paths {
+		script += fmt.Sprintf(`; echo "disk:$(df -Pk %s 2>/dev/null | awk 'NR==2 {print $4}'):"%s`, shellEscape(path), shellEscape(path))
+	}
+	if len(processes) > 0 {
+		patterns := make([]string, len(processes))
+		for i, process := range processes {
+			patterns[i] = "-e " + shellEscape(process)
+		}
+		script += fmt.Sprintf("; ps -eo comm= 2>/dev/null | sed 's|.*/||' | grep -x -F %s | sort -u | sed 's/^/process:/'", strings.Join(patterns, " "))
+	}
+	script += "; true"
+
+	result, err := connection.Execute(ctx, script)
+	if err != nil {
+		return fmt.Errorf("failed to gather preflight facts: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to gather preflight facts: %s", strings.TrimSpace(result.Stderr))
+	}
+
+	facts.FreeDisk = make(map[string]int64)
+	facts.Processes = make(map[string]bool)
+	for _, line := range strings.Split(result.Stdout, "\n") {
+		line = strings.TrimSpace(line)
+		if kernel, ok := strings.CutPrefix(line, "kernel:"); ok {
+			facts.Kernel = kernel
+		} else if disk, ok := strings.CutPrefix(line, "disk:"); ok {
+			// Paths that do not exist report no free space and are left out
+			available, path, _ := strings.Cut(disk, ":")
+			if kilobytes, err := strconv.ParseInt(available, 10, 64); err == nil {
+				facts.FreeDisk[path] = kilobytes * 1024
+			}
+		} else if process, ok := strings.CutPrefix(line, "process:"); ok {
+			facts.Processes[process] = true
+		}
+	}
+	return nil
+}
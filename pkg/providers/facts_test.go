@@ -0,0 +1,123 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestGatherFacts(t *testing.T) {
+	script := `uname -s || exit 1; (. /etc/os-release && echo "distro:$ID:$ID_LIKE") 2>/dev/null; ` + initSystemScript + `; for c in 'apt-get' 'systemctl' 'yum'; do command -v "$c" >/dev/null 2>&1 && echo "command:$c"; done; true`
+
+	tests := []struct {
+		name         string
+		result       *ssh.ExecuteResult
+		wantFamily   string
+		wantDistro   [2]string
+		wantInit     string
+		wantCommands map[string]bool
+		wantErr      bool
+	}{
+		{
+			name:         "linux",
+			result:       &ssh.ExecuteResult{ExitCode: 0, Stdout: "Linux\ndistro:ubuntu:debian\ninit:systemd\ncommand:apt-get\ncommand:systemctl\n"},
+			wantFamily:   "linux",
+			wantDistro:   [2]string{"ubuntu", types.DistroDebian},
+			wantInit:     "systemd",
+			wantCommands: map[string]bool{"apt-get": true, "systemctl": true},
+		},
+		{
+			name:         "distribution like another",
+			result:       &ssh.ExecuteResult{ExitCode: 0, Stdout: "Linux\ndistro:rocky:\"rhel centos fedora\"\n"},
+			wantFamily:   "linux",
+			wantDistro:   [2]string{"rocky", types.DistroRedHat},
+			wantCommands: map[string]bool{},
+		},
+		{
+			name:         "suse variant",
+			result:       &ssh.ExecuteResult{ExitCode: 0, Stdout: "Linux\ndistro:opensuse-leap:suse opensuse\n"},
+			wantFamily:   "linux",
+			wantDistro:   [2]string{"opensuse-leap", types.DistroSUSE},
+			wantCommands: map[string]bool{},
+		},
+		{
+			name:         "macOS",
+			result:       &ssh.ExecuteResult{ExitCode: 0, Stdout: "Darwin\ninit:launchd\n"},
+			wantFamily:   "darwin",
+			wantInit:     "launchd",
+			wantCommands: map[string]bool{},
+		},
+		{name: "no shell", result: &ssh.ExecuteResult{ExitCode: 1, Stderr: "'uname' is not recognized"}, wantErr: true},
+		{name: "no output", result: &ssh.ExecuteResult{ExitCode: 0}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &MockSSHConnection{responses: map[string]*ssh.ExecuteResult{script: tt.result}}
+			facts, err := GatherFacts(context.Background(), conn, "web1", []string{"apt-get", "systemctl", "yum"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GatherFacts() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if facts.Host != "web1" || facts.OSFamily != tt.wantFamily {
+				t.Errorf("facts = %+v, want host web1 and family %s", facts, tt.wantFamily)
+			}
+			if distro := [2]string{facts.Distribution, facts.DistroFamily}; distro != tt.wantDistro {
+				t.Errorf("distribution = %v, want %v", distro, tt.wantDistro)
+			}
+			if facts.InitSystem != tt.wantInit {
+				t.Errorf("InitSystem = %q, want %q", facts.InitSystem, tt.wantInit)
+			}
+			if !reflect.DeepEqual(facts.Commands, tt.wantCommands) {
+				t.Errorf("Commands = %v, want %v", facts.Commands, tt.wantCommands)
+			}
+		})
+	}
+}
+
+func TestRequiredCommands(t *testing.T) {
+	registry, err := DefaultFactoryRegistry().NewRegistry(&MockSSHConnection{})
+	if err != nil {
+		t.Fatalf("NewRegistry() error = %v", err)
+	}
+
+	got := RequiredCommands(registry)
+	for _, command := range []string{"apt-get", "brew", "firewall-cmd", "systemctl", "useradd"} {
+		found := false
+		for _, c := range got {
+			if c == command {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("Expected %s in required commands %v", command, got)
+		}
+	}
+}
+
+func TestGatherPreflightFacts(t *testing.T) {
+	script := `echo "kernel:$(uname -r)"; echo "disk:$(df -Pk '/var' 2>/dev/null | awk 'NR==2 {print $4}'):"'/var'; echo "disk:$(df -Pk '/data' 2>/dev/null | awk 'NR==2 {print $4}'):"'/data'; ` +
+		`ps -eo comm= 2>/dev/null | sed 's|.*/||' | grep -x -F -e 'apt-get' -e 'dpkg' | sort -u | sed 's/^/process:/'; true`
+	conn := &MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		script: {ExitCode: 0, Stdout: "kernel:5.15.0-91-generic\ndisk:2048:/var\ndisk::/data\nprocess:dpkg\n"},
+	}}
+
+	facts := &types.TargetFacts{Host: "web1"}
+	if err := GatherPreflightFacts(context.Background(), conn, facts, []string{"/var", "/data"}, []string{"apt-get", "dpkg"}); err != nil {
+		t.Fatalf("GatherPreflightFacts() error = %v", err)
+	}
+	if facts.Kernel != "5.15.0-91-generic" {
+		t.Errorf("Kernel = %q", facts.Kernel)
+	}
+	if !reflect.DeepEqual(facts.FreeDisk, map[string]int64{"/var": 2048 * 1024}) {
+		t.Errorf("FreeDisk = %v", facts.FreeDisk)
+	}
+	if !reflect.DeepEqual(facts.Processes, map[string]bool{"dpkg": true}) {
+		t.Errorf("Processes = %v", facts.Processes)
+	}
+}
@@ -3,10 +3,13 @@ package providers
 import (
 	"context"
 	"fmt"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/delta"
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"github.com/ataiva-software/forge/pkg/templating"
 	"github.com/ataiva-software/forge/pkg/types"
@@ -15,6 +18,8 @@ import (
 // FileProvider manages file resources
 type FileProvider struct {
 	connection ssh.Executor
+	artifacts  *artifact.Cache
+	workspace  *Workspace
 }
 
 // NewFileProvider creates a new file provider
@@ -24,11 +29,29 @@ func NewFileProvider(connection ssh.Executor) *FileProvider {
 	}
 }
 
+// SetArtifactCache sets the cache that remote file sources are downloaded through
+func (p *FileProvider) SetArtifactCache(cache *artifact.Cache) {
+	p.artifacts = cache
+}
+
+// SetWorkspace sets the target workspace where scratch files are uploaded
+func (p *FileProvider) SetWorkspace(workspace *Workspace) {
+	p.workspace = workspace
+}
+
 // Type returns the resource type this provider handles
 func (p *FileProvider) Type() string {
 	return "file"
 }
 
+// Capabilities returns the targets this provider can manage
+func (p *FileProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+		Privileged: []string{"cat", "chattr", "chcon", "chmod", "chown", "findmnt", "getfacl", "ls", "lsattr", "md5sum", "mkdir", "mv", "rm", "setfacl", "sha256sum", "stat", "tee", "test", "touch"},
+	}
+}
+
 // Validate validates the file resource configuration
 func (p *FileProvider) Validate(resource *types.Resource) error {
 	if err := resource.Validate(); err != nil {
@@ -52,6 +75,40 @@ func (p *FileProvider) Validate(resource *types.Resource) error {
 		}
 	}
 
+	// Validate source if provided
+	if source, exists := resource.Properties["source"]; exists {
+		if sourceStr, ok := source.(string); !ok || sourceStr == "" {
+			return fmt.Errorf("file 'source' must be a non-empty string")
+		}
+		for _, key := range []string{"content", "template", "template_file"} {
+			if _, conflict := resource.Properties[key]; conflict {
+				return fmt.Errorf("file 'source' cannot be combined with '%s'", key)
+			}
+		}
+		if checksum, exists := resource.Properties["checksum"]; exists {
+			if _, ok := checksum.(string); !ok {
+				return fmt.Errorf("file 'checksum' must be a string")
+			}
+		}
+	}
+
+	if dir, exists := resource.Properties["template_dir"]; exists {
+		if dirStr, ok := dir.(string); !ok || dirStr == "" {
+			return fmt.Errorf("file 'template_dir' must be a non-empty string")
+		}
+	}
+
+	if force, exists := resource.Properties["force_unlock_immutable"]; exists {
+		if _, ok := force.(bool); !ok {
+			return fmt.Errorf("file 'force_unlock_immutable' must be true or false")
+		}
+	}
+
+	// Validate SELinux context and ACL if provided
+	if err := validateSecurity(resource); err != nil {
+		return err
+	}
+
 	// Validate state
 	if resource.State != "" && resource.State != types.StatePresent && resource.State != types.StateAbsent {
 		return fmt.Errorf("file resource state must be 'present' or 'absent', got '%s'", resource.State)
@@ -82,22 +139,29 @@ func (p *FileProvider) Read(ctx context.Context, resource *types.Resource) (map[
 	current["exists"] = true
 	current["state"] = types.StatePresent
 
-	// Get file stats
-	statCmd := fmt.Sprintf("stat -c '%%s:%%a:%%U:%%G' %s", shellEscape(path))
-	result, err = p.connection.Execute(ctx, statCmd)
+	// Get file stats, and whether the file can be changed
+	result, err = p.connection.Execute(ctx, statCommand(path))
 	if err != nil {
 		return nil, fmt.Errorf("failed to get file stats: %w", err)
 	}
 
 	if result.ExitCode == 0 {
-		parts := strings.Split(strings.TrimSpace(result.Stdout), ":")
-		if len(parts) == 4 {
-			current["size"] = parts[0]
-			current["mode"] = parts[1]
-			current["owner"] = parts[2]
-			current["group"] = parts[3]
+		for _, line := range strings.Split(strings.TrimSpace(result.Stdout), "\n") {
+			if parseProtection(line, current) {
+				continue
+			}
+			parts := strings.Split(line, ":")
+			if len(parts) == 4 {
+				current["size"] = parts[0]
+				current["mode"] = parts[1]
+				current["owner"] = parts[2]
+				current["group"] = parts[3]
+			}
 		}
 	}
+	if err := p.readSecurity(ctx, path, resource, current); err != nil {
+		return nil, err
+	}
 
 	// Get file content if requested
 	if _, needsContent := resource.Properties["content"]; needsContent {
@@ -121,11 +185,38 @@ func (p *FileProvider) Read(ctx context.Context, resource *types.Resource) (map[
 		}
 	}
 
+	// Get the SHA-256 checksum to compare with the source
+	if _, hasSource := resource.Properties["source"]; hasSource {
+		result, err = p.connection.Execute(ctx, fmt.Sprintf("sha256sum %s | cut -d' ' -f1", shellEscape(path)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file checksum: %w", err)
+		}
+		if result.ExitCode == 0 {
+			current["sha256"] = strings.TrimSpace(result.Stdout)
+		}
+	}
+
 	return current, nil
 }
 
-// Diff compares desired vs current state and returns the differences
+// Diff compares desired vs current state and returns the differences. A
+// change to a file on a read-only mount, or to an immutable file, fails.
 func (p *FileProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff, err := p.diffFile(ctx, resource, current)
+	if err != nil || diff.Action == types.ActionNoop {
+		return diff, err
+	}
+	if err := checkWritable(resource, current); err != nil {
+		return nil, err
+	}
+	if immutable, _ := current["immutable"].(bool); immutable {
+		diff.Reason += "; unlocking the immutable file to change it"
+	}
+	return diff, nil
+}
+
+// diffFile compares the file with the resource
+func (p *FileProvider) diffFile(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
 	diff := &types.ResourceDiff{
 		ResourceID: resource.ResourceID(),
 		Changes:    make(map[string]interface{}),
@@ -150,6 +241,16 @@ func (p *FileProvider) Diff(ctx context.Context, resource *types.Resource, curre
 		return diff, nil
 	}
 
+	// Resolve the source now so download failures show up in the plan
+	var source *artifact.Artifact
+	if _, hasSource := resource.Properties["source"]; hasSource {
+		var err error
+		source, err = p.resolveSource(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// File should be present
 	if !exists {
 		diff.Action = types.ActionCreate
@@ -176,10 +277,22 @@ func (p *FileProvider) Diff(ctx context.Context, resource *types.Resource, curre
 		}
 	}
 
+	// Check source
+	if source != nil {
+		currentSum, _ := current["sha256"].(string)
+		if currentSum != source.SHA256 {
+			hasChanges = true
+			diff.Changes["source"] = map[string]interface{}{
+				"from": shortChecksum(currentSum),
+				"to":   shortChecksum(source.SHA256),
+			}
+		}
+	}
+
 	// Check mode
 	if desiredMode, ok := resource.Properties["mode"].(string); ok {
 		currentMode, hasCurrentMode := current["mode"].(string)
-		if !hasCurrentMode || currentMode != desiredMode {
+		if !hasCurrentMode || !sameMode(currentMode, desiredMode) {
 			hasChanges = true
 			diff.Changes["mode"] = map[string]interface{}{
 				"from": currentMode,
@@ -212,6 +325,11 @@ func (p *FileProvider) Diff(ctx context.Context, resource *types.Resource, curre
 		}
 	}
 
+	// Check SELinux context and ACL
+	if diffSecurity(resource, current, diff) {
+		hasChanges = true
+	}
+
 	if hasChanges {
 		diff.Action = types.ActionUpdate
 		diff.Reason = "file properties need to be updated"
@@ -223,9 +341,32 @@ func (p *FileProvider) Diff(ctx context.Context, resource *types.Resource, curre
 	return diff, nil
 }
 
-// Apply applies the changes to bring the resource to desired state
+// Apply applies the changes to bring the resource to desired state. An
+// immutable file the resource allows forge to unlock is unlocked for the
+// change and locked again after it.
 func (p *FileProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
 	path := resource.Properties["path"].(string)
+	if diff.Action == types.ActionNoop {
+		return nil
+	}
+
+	unlocked, err := p.unlockImmutable(ctx, resource)
+	if err != nil {
+		return err
+	}
+	applyErr := p.protectionError(ctx, path, p.applyFile(ctx, resource, diff))
+	// Lock the file again, also when the change failed and left it in place
+	if unlocked && (applyErr != nil || diff.Action != types.ActionDelete) {
+		if err := p.chattr(ctx, "+i", path); err != nil && applyErr == nil {
+			return err
+		}
+	}
+	return applyErr
+}
+
+// applyFile makes the change a diff describes
+func (p *FileProvider) applyFile(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	path := resource.Properties["path"].(string)
 
 	switch diff.Action {
 	case types.ActionDelete:
@@ -258,6 +399,17 @@ func (p *FileProvider) createFile(ctx context.Context, resource *types.Resource)
 		}
 	}
 
+	// Copy remote or local sources as-is
+	if _, hasSource := resource.Properties["source"]; hasSource {
+		if err := p.writeSource(ctx, resource, false); err != nil {
+			return err
+		}
+		if err := p.setFileAttributes(ctx, resource); err != nil {
+			return err
+		}
+		return p.setSecurityAttributes(ctx, resource)
+	}
+
 	// Handle content - check for template first, then regular content
 	content, err := p.resolveContent(resource)
 	if err != nil {
@@ -281,7 +433,10 @@ func (p *FileProvider) createFile(ctx context.Context, resource *types.Resource)
 	}
 
 	// Set permissions and ownership
-	return p.setFileAttributes(ctx, resource)
+	if err := p.setFileAttributes(ctx, resource); err != nil {
+		return err
+	}
+	return p.setSecurityAttributes(ctx, resource)
 }
 
 // resolveContent resolves the content for a file, handling templates if specified
@@ -295,8 +450,7 @@ func (p *FileProvider) resolveContent(resource *types.Resource) (string, error)
 			}
 		}
 		
-		engine := templating.NewTemplateEngine()
-		return engine.Render(templateStr, vars)
+		return p.templateEngine(resource).Render(templateStr, vars)
 	}
 	
 	// Check for template file
@@ -308,8 +462,7 @@ func (p *FileProvider) resolveContent(resource *types.Resource) (string, error)
 			}
 		}
 		
-		engine := templating.NewTemplateEngine()
-		return engine.RenderFile(templateFile, vars)
+		return p.templateEngine(resource).RenderFile(templateFile, vars)
 	}
 	
 	// Fall back to regular content
@@ -320,6 +473,16 @@ func (p *FileProvider) resolveContent(resource *types.Resource) (string, error)
 	return "", nil
 }
 
+// templateEngine returns the engine that renders a resource's template,
+// reading included templates from its template_dir
+func (p *FileProvider) templateEngine(resource *types.Resource) *templating.TemplateEngine {
+	engine := templating.NewTemplateEngine()
+	if dir, ok := resource.Properties["template_dir"].(string); ok {
+		engine.SetBaseDir(dir)
+	}
+	return engine
+}
+
 // updateFile updates an existing file
 func (p *FileProvider) updateFile(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
 	// Update content if changed
@@ -334,6 +497,13 @@ func (p *FileProvider) updateFile(ctx context.Context, resource *types.Resource,
 		}
 	}
 
+	// Copy the source again if it changed
+	if _, ok := diff.Changes["source"]; ok {
+		if err := p.writeSource(ctx, resource, true); err != nil {
+			return err
+		}
+	}
+
 	// Update attributes if changed
 	if _, hasMode := diff.Changes["mode"]; hasMode {
 		if err := p.setFileAttributes(ctx, resource); err != nil {
@@ -351,6 +521,13 @@ func (p *FileProvider) updateFile(ctx context.Context, resource *types.Resource,
 		}
 	}
 
+	// Rewritten files are new files, so their context and ACL are set again too
+	for _, key := range []string{"secontext", "acl", "content", "source"} {
+		if _, changed := diff.Changes[key]; changed {
+			return p.setSecurityAttributes(ctx, resource)
+		}
+	}
+
 	return nil
 }
 
@@ -395,6 +572,64 @@ func (p *FileProvider) writeFileContent(ctx context.Context, path, content strin
 	return nil
 }
 
+// resolveSource returns the local copy of the file's source, downloading it
+// through the artifact cache if it is a URL
+func (p *FileProvider) resolveSource(ctx context.Context, resource *types.Resource) (*artifact.Artifact, error) {
+	source := resource.Properties["source"].(string)
+	checksum, _ := resource.Properties["checksum"].(string)
+	resolved, err := p.artifacts.Resolve(ctx, source, checksum)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve source: %w", err)
+	}
+	return resolved, nil
+}
+
+// writeSource pushes the file's source to the target. Large files that
+// already exist are sent as a delta when the target supports it.
+func (p *FileProvider) writeSource(ctx context.Context, resource *types.Resource, exists bool) error {
+	path := resource.Properties["path"].(string)
+
+	source, err := p.resolveSource(ctx, resource)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(source.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read source %s: %w", source.Path, err)
+	}
+
+	tempPath := path + ".chisel.tmp"
+	sent := false
+	if exists && len(data) >= deltaMinSize {
+		sent = p.syncDelta(ctx, path, tempPath, data, source.SHA256, delta.DefaultBlockSize) == nil
+	}
+	if !sent {
+		if err := uploadFile(ctx, p.connection, tempPath, data); err != nil {
+			return fmt.Errorf("failed to copy source to %s: %w", path, err)
+		}
+	}
+	cmd := fmt.Sprintf("mv %s %s", shellEscape(tempPath), shellEscape(path))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to move temporary file to %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to move temporary file to %s: %s", path, result.Stderr)
+	}
+	return nil
+}
+
+// shortChecksum abbreviates a SHA-256 checksum for display
+func shortChecksum(sum string) string {
+	if sum == "" {
+		return "none"
+	}
+	if len(sum) > 12 {
+		sum = sum[:12]
+	}
+	return "sha256:" + sum
+}
+
 // setFileAttributes sets file mode, owner, and group
 func (p *FileProvider) setFileAttributes(ctx context.Context, resource *types.Resource) error {
 	path := resource.Properties["path"].(string)
@@ -438,6 +673,17 @@ func (p *FileProvider) setFileAttributes(ctx context.Context, resource *types.Re
 	return nil
 }
 
+// sameMode compares octal modes, so 0644 from a module matches the 644
+// stat prints
+func sameMode(a, b string) bool {
+	x, errA := strconv.ParseUint(a, 8, 32)
+	y, errB := strconv.ParseUint(b, 8, 32)
+	if errA != nil || errB != nil {
+		return a == b
+	}
+	return x == y
+}
+
 // shellEscape escapes a string for safe use in shell commands
 func shellEscape(s string) string {
 	// Simple shell escaping - wrap in single quotes and escape any single quotes
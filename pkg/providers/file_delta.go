@@ -0,0 +1,94 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/delta"
+)
+
+// deltaMinSize is the smallest source file sent as a delta; smaller files
+// are cheaper to send whole
+const deltaMinSize = 4 * 1024 * 1024
+
+// deltaMaxLiteral is the share of the file above which a delta is not worth sending
+const deltaMaxLiteral = 0.75
+
+// deltaSignatureScript prints "<weak> <strong>" for every block of a file on the target
+const deltaSignatureScript = `import sys, hashlib, itertools
+n = int(sys.argv[2])
+with open(sys.argv[1], "rb") as f:
+    while True:
+        b = f.read(n)
+        if not b:
+            break
+        weak = (sum(b) & 0xffff) | ((sum(itertools.accumulate(b)) & 0xffff) << 16)
+        print(weak, hashlib.sha256(b).hexdigest()[:32])
+`
+
+// deltaPatchScript rebuilds a file on the target from its old blocks and the
+// delta read from stdin, and verifies the result
+const deltaPatchScript = `import sys, hashlib, base64
+old_path, new_path, n, want = sys.argv[1], sys.argv[2], int(sys.argv[3]), sys.argv[4]
+h = hashlib.sha256()
+with open(old_path, "rb") as old, open(new_path, "wb") as out:
+    for line in sys.stdin:
+        op, arg = line.split()
+        if op == "B":
+            old.seek(int(arg) * n)
+            b = old.read(n)
+        else:
+            b = base64.b64decode(arg)
+        out.write(b)
+        h.update(b)
+if h.hexdigest() != want:
+    sys.exit("checksum mismatch after delta transfer")
+`
+
+// syncDelta writes data to tempPath on the target by sending only the blocks
+// that differ from the file already at path. It returns an error when the
+// target cannot take a delta, in which case the caller sends the whole file.
+func (p *FileProvider) syncDelta(ctx context.Context, path, tempPath string, data []byte, sum string, blockSize int) error {
+	cmd := fmt.Sprintf("python3 -c %s %s %d", shellEscape(deltaSignatureScript), shellEscape(path), blockSize)
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to read block signature of %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to read block signature of %s: %s", path, result.Stderr)
+	}
+	sig, err := delta.ParseSignature(result.Stdout, blockSize)
+	if err != nil {
+		return fmt.Errorf("failed to read block signature of %s: %w", path, err)
+	}
+
+	d := delta.Compute(sig, data)
+	if literal := d.LiteralBytes(); float64(literal) > float64(len(data))*deltaMaxLiteral {
+		return fmt.Errorf("delta for %s would send %d of %d bytes", path, literal, len(data))
+	}
+
+	var encoded bytes.Buffer
+	if err := d.Encode(&encoded); err != nil {
+		return fmt.Errorf("failed to encode delta for %s: %w", path, err)
+	}
+	deltaPath, err := scratchPath(ctx, p.workspace, strings.ReplaceAll(strings.Trim(path, "/"), "/", "_")+".delta", path+".chisel.delta")
+	if err != nil {
+		return err
+	}
+	if err := uploadFile(ctx, p.connection, deltaPath, encoded.Bytes()); err != nil {
+		return fmt.Errorf("failed to send delta for %s: %w", path, err)
+	}
+	cmd = fmt.Sprintf("python3 -c %s %s %s %d %s < %s; status=$?; rm -f %s; exit $status",
+		shellEscape(deltaPatchScript), shellEscape(path), shellEscape(tempPath), blockSize, shellEscape(sum), shellEscape(deltaPath), shellEscape(deltaPath))
+	result, err = p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to apply delta to %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		p.connection.Execute(ctx, fmt.Sprintf("rm -f %s", shellEscape(tempPath)))
+		return fmt.Errorf("failed to apply delta to %s: %s", path, result.Stderr)
+	}
+	return nil
+}
@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// meteredExecutor runs commands locally and records how many bytes were sent
+type meteredExecutor struct {
+	ssh.LocalExecutor
+	sent int
+}
+
+func (c *meteredExecutor) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	c.sent += len(command)
+	return c.LocalExecutor.Execute(ctx, command)
+}
+
+func TestFileProvider_SyncDelta(t *testing.T) {
+	if _, err := exec.LookPath("python3"); err != nil {
+		t.Skip("python3 not available")
+	}
+
+	const blockSize = 4096
+	old := make([]byte, 64*blockSize)
+	rand.New(rand.NewSource(1)).Read(old)
+	updated := append([]byte("inserted header"), old...)
+	copy(updated[20*blockSize:], "patched block")
+	sum := sha256.Sum256(updated)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "large.bin")
+	if err := os.WriteFile(path, old, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &meteredExecutor{}
+	provider := NewFileProvider(conn)
+	tempPath := path + ".chisel.tmp"
+	if err := provider.syncDelta(context.Background(), path, tempPath, updated, hex.EncodeToString(sum[:]), blockSize); err != nil {
+		t.Fatalf("syncDelta() error = %v", err)
+	}
+
+	got, err := os.ReadFile(tempPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, updated) {
+		t.Fatal("Expected the delta to rebuild the new file")
+	}
+	if conn.sent > len(updated)/4 {
+		t.Errorf("Expected only changed blocks to be sent, sent %d bytes for a %d byte file", conn.sent, len(updated))
+	}
+
+	// A wrong checksum is caught on the target and the partial file removed
+	err = provider.syncDelta(context.Background(), path, tempPath, updated, strings.Repeat("0", 64), blockSize)
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Errorf("syncDelta() error = %v, want checksum mismatch", err)
+	}
+	if _, err := os.Stat(tempPath); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be removed")
+	}
+}
+
+func TestFileProvider_SyncDeltaUnavailable(t *testing.T) {
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{}}}
+	provider := NewFileProvider(conn)
+
+	// Without python3 on the target the caller falls back to a full upload
+	conn.responses["python3 -c "+shellEscape(deltaSignatureScript)+" '/data/large.bin' 4096"] = &ssh.ExecuteResult{ExitCode: 127, Stderr: "python3: not found"}
+	err := provider.syncDelta(context.Background(), "/data/large.bin", "/data/large.bin.chisel.tmp", []byte("data"), "", 4096)
+	if err == nil || !strings.Contains(err.Error(), "python3: not found") {
+		t.Errorf("syncDelta() error = %v, want python3 error", err)
+	}
+	if len(conn.commands) != 1 {
+		t.Errorf("Expected no delta to be sent, got commands %q", conn.commands)
+	}
+}
@@ -0,0 +1,359 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// defaultBlockMarker surrounds a managed block; {mark} becomes BEGIN or END
+const defaultBlockMarker = "# {mark} CHISEL MANAGED BLOCK"
+
+// FileEditProvider manages fragments of files that are otherwise owned by
+// someone else: a single line, found by exact match or regular expression,
+// or a block of lines between marker comments.
+type FileEditProvider struct {
+	connection ssh.Executor
+}
+
+// NewFileEditProvider creates a new file_edit provider
+func NewFileEditProvider(connection ssh.Executor) *FileEditProvider {
+	return &FileEditProvider{
+		connection: connection,
+	}
+}
+
+// Type returns the resource type this provider handles
+func (p *FileEditProvider) Type() string {
+	return "file_edit"
+}
+
+// Capabilities returns the targets this provider can manage
+func (p *FileEditProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+		Privileged: []string{"cat", "rm", "tee", "test"},
+	}
+}
+
+// Validate validates the file_edit resource configuration
+func (p *FileEditProvider) Validate(resource *types.Resource) error {
+	path, ok := resource.Properties["path"].(string)
+	if !ok || path == "" {
+		return fmt.Errorf("file_edit resource must have a 'path' property")
+	}
+
+	state := editState(resource)
+	if state != types.StatePresent && state != types.StateAbsent {
+		return fmt.Errorf("invalid file_edit state '%s', must be one of: present, absent", state)
+	}
+
+	_, hasLine := resource.Properties["line"]
+	_, hasRegexp := resource.Properties["regexp"]
+	_, hasBlock := resource.Properties["block"]
+	if hasBlock == (hasLine || hasRegexp) {
+		return fmt.Errorf("file_edit resource must have either 'line' (with an optional 'regexp') or 'block'")
+	}
+
+	for _, key := range []string{"line", "regexp", "block", "marker"} {
+		if value, ok := resource.Properties[key]; ok {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("file_edit '%s' must be a string", key)
+			}
+		}
+	}
+	if value, ok := resource.Properties["create"]; ok {
+		if _, ok := value.(bool); !ok {
+			return fmt.Errorf("file_edit 'create' must be a boolean")
+		}
+	}
+
+	if hasBlock {
+		if _, ok := resource.Properties["marker"]; ok && !strings.Contains(resource.Properties["marker"].(string), "{mark}") {
+			return fmt.Errorf("file_edit 'marker' must contain {mark}")
+		}
+		return nil
+	}
+
+	if _, ok := resource.Properties["marker"]; ok {
+		return fmt.Errorf("file_edit 'marker' can only be used with 'block'")
+	}
+	if line, _ := resource.Properties["line"].(string); state == types.StatePresent && (!hasLine || strings.Contains(line, "\n")) {
+		return fmt.Errorf("file_edit 'line' must be a single line when state is present")
+	}
+	if pattern, ok := resource.Properties["regexp"].(string); ok {
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid file_edit regexp: %w", err)
+		}
+	}
+	return nil
+}
+
+// Read reads the file the fragment belongs to
+func (p *FileEditProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	path := resource.Properties["path"].(string)
+	content, exists, err := p.readFile(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":    path,
+		"exists":  exists,
+		"content": content,
+	}, nil
+}
+
+// Diff reports how the fragment differs from the desired state
+func (p *FileEditProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff := &types.ResourceDiff{
+		ResourceID: resource.ResourceID(),
+		Changes:    make(map[string]interface{}),
+	}
+	path := resource.Properties["path"].(string)
+
+	exists, _ := current["exists"].(bool)
+	if !exists && editState(resource) == types.StateAbsent {
+		diff.Action = types.ActionNoop
+		diff.Reason = fmt.Sprintf("%s does not exist", path)
+		return diff, nil
+	}
+
+	content, _ := current["content"].(string)
+	edit, err := newFileEdit(resource)
+	if err != nil {
+		return nil, err
+	}
+	_, from, to, changed := edit.apply(content)
+	if !changed {
+		diff.Action = types.ActionNoop
+		diff.Reason = fmt.Sprintf("%s already matches", edit.kind)
+		return diff, nil
+	}
+
+	diff.Action = types.ActionUpdate
+	diff.Changes[edit.kind] = map[string]interface{}{
+		"from": from,
+		"to":   to,
+	}
+	switch {
+	case !exists:
+		diff.Reason = fmt.Sprintf("%s will be created with the %s", path, edit.kind)
+	case to == "":
+		diff.Reason = fmt.Sprintf("%s will be removed from %s", edit.kind, path)
+	default:
+		diff.Reason = fmt.Sprintf("%s in %s will be updated", edit.kind, path)
+	}
+	return diff, nil
+}
+
+// Apply edits the file. The file is read again so that changes made since
+// the plan are kept, and written in place so its owner and mode are kept.
+func (p *FileEditProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	switch diff.Action {
+	case types.ActionUpdate:
+	case types.ActionNoop:
+		return nil
+	default:
+		return fmt.Errorf("unsupported action: %s", diff.Action)
+	}
+
+	path := resource.Properties["path"].(string)
+	content, exists, err := p.readFile(ctx, path)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		if editState(resource) == types.StateAbsent {
+			return nil
+		}
+		if create, _ := resource.Properties["create"].(bool); !create {
+			return fmt.Errorf("file %s does not exist; set create: true to create it", path)
+		}
+	}
+
+	edit, err := newFileEdit(resource)
+	if err != nil {
+		return err
+	}
+	updated, _, _, changed := edit.apply(content)
+	if !changed {
+		return nil
+	}
+
+	tempPath := path + ".chisel.tmp"
+	if err := uploadFile(ctx, p.connection, tempPath, []byte(updated)); err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	cmd := fmt.Sprintf("cat %s > %s; status=$?; rm -f %s; exit $status", shellEscape(tempPath), shellEscape(path), shellEscape(tempPath))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to write %s: %s", path, result.Stderr)
+	}
+	return nil
+}
+
+// readFile returns the content of a file on the target and whether it exists
+func (p *FileEditProvider) readFile(ctx context.Context, path string) (string, bool, error) {
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("test -f %s && cat %s", shellEscape(path), shellEscape(path)))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return "", false, nil
+	}
+	return result.Stdout, true, nil
+}
+
+// fileEdit is a line or block edit resolved from a resource
+type fileEdit struct {
+	kind    string
+	present bool
+	line    string
+	pattern *regexp.Regexp
+	block   []string
+	begin   string
+	end     string
+}
+
+// newFileEdit builds the edit described by a validated resource
+func newFileEdit(resource *types.Resource) (*fileEdit, error) {
+	edit := &fileEdit{present: editState(resource) == types.StatePresent}
+
+	if block, ok := resource.Properties["block"].(string); ok {
+		edit.kind = "block"
+		marker := defaultBlockMarker
+		if m, ok := resource.Properties["marker"].(string); ok {
+			marker = m
+		}
+		edit.begin = strings.ReplaceAll(marker, "{mark}", "BEGIN")
+		edit.end = strings.ReplaceAll(marker, "{mark}", "END")
+		if block = strings.TrimSuffix(block, "\n"); block != "" {
+			edit.block = strings.Split(block, "\n")
+		}
+		return edit, nil
+	}
+
+	edit.kind = "line"
+	edit.line, _ = resource.Properties["line"].(string)
+	if pattern, ok := resource.Properties["regexp"].(string); ok {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid file_edit regexp: %w", err)
+		}
+		edit.pattern = re
+	}
+	return edit, nil
+}
+
+// apply returns the content with the edit made, the fragment before and
+// after the edit, and whether anything changed
+func (e *fileEdit) apply(content string) (string, string, string, bool) {
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+
+	var updated []string
+	var from, to string
+	if e.kind == "block" {
+		updated, from, to = e.applyBlock(lines)
+	} else {
+		updated, from, to = e.applyLine(lines)
+	}
+
+	result := strings.Join(updated, "\n")
+	if len(updated) > 0 && (content == "" || strings.HasSuffix(content, "\n")) {
+		result += "\n"
+	}
+	return result, from, to, result != content
+}
+
+// applyLine ensures the line is present or absent. When present with a
+// regexp, the last matching line is replaced; otherwise the line is appended.
+func (e *fileEdit) applyLine(lines []string) ([]string, string, string) {
+	matches := func(line string) bool {
+		if e.pattern != nil {
+			return e.pattern.MatchString(line)
+		}
+		return line == e.line
+	}
+
+	if !e.present {
+		var kept, removed []string
+		for _, line := range lines {
+			if matches(line) {
+				removed = append(removed, line)
+				continue
+			}
+			kept = append(kept, line)
+		}
+		return kept, strings.Join(removed, "\n"), ""
+	}
+
+	for i := len(lines) - 1; i >= 0; i-- {
+		if matches(lines[i]) {
+			from := lines[i]
+			updated := append([]string{}, lines...)
+			updated[i] = e.line
+			return updated, from, e.line
+		}
+	}
+	for _, line := range lines {
+		if line == e.line {
+			return lines, e.line, e.line
+		}
+	}
+	return append(append([]string{}, lines...), e.line), "", e.line
+}
+
+// applyBlock ensures the lines between the markers are the block, or that
+// the markers and everything between them are removed
+func (e *fileEdit) applyBlock(lines []string) ([]string, string, string) {
+	start, stop := -1, -1
+	for i, line := range lines {
+		if start < 0 && line == e.begin {
+			start = i
+		} else if start >= 0 && line == e.end {
+			stop = i
+			break
+		}
+	}
+
+	var from string
+	if stop >= 0 {
+		from = strings.Join(lines[start+1:stop], "\n")
+	}
+
+	var replacement []string
+	to := ""
+	if e.present {
+		replacement = append(append([]string{e.begin}, e.block...), e.end)
+		to = strings.Join(e.block, "\n")
+	}
+
+	if stop < 0 {
+		if !e.present {
+			return lines, "", ""
+		}
+		return append(append([]string{}, lines...), replacement...), from, to
+	}
+	updated := append([]string{}, lines[:start]...)
+	updated = append(updated, replacement...)
+	updated = append(updated, lines[stop+1:]...)
+	return updated, from, to
+}
+
+// editState returns the desired state, defaulting to present
+func editState(resource *types.Resource) types.ResourceState {
+	if resource.State == "" {
+		return types.StatePresent
+	}
+	return resource.State
+}
@@ -0,0 +1,259 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestFileEditProvider_Validate(t *testing.T) {
+	provider := NewFileEditProvider(nil)
+
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		properties map[string]interface{}
+		wantErr    string
+	}{
+		{name: "line", properties: map[string]interface{}{"path": "/etc/hosts", "line": "10.0.0.5 db"}},
+		{name: "line with regexp", properties: map[string]interface{}{"path": "/etc/ssh/sshd_config", "line": "PermitRootLogin no", "regexp": "^#?PermitRootLogin"}},
+		{name: "absent by regexp", state: types.StateAbsent, properties: map[string]interface{}{"path": "/etc/hosts", "regexp": "old-db$"}},
+		{name: "block", properties: map[string]interface{}{"path": "/etc/hosts", "block": "10.0.0.5 db\n10.0.0.6 cache", "create": true}},
+		{name: "block with marker", properties: map[string]interface{}{"path": "/etc/fstab", "block": "", "marker": "## {mark} app mounts"}},
+		{name: "missing path", properties: map[string]interface{}{"line": "x"}, wantErr: "must have a 'path'"},
+		{name: "no edit", properties: map[string]interface{}{"path": "/etc/hosts"}, wantErr: "either 'line'"},
+		{name: "line and block", properties: map[string]interface{}{"path": "/etc/hosts", "line": "x", "block": "y"}, wantErr: "either 'line'"},
+		{name: "regexp without line", properties: map[string]interface{}{"path": "/etc/hosts", "regexp": "^x"}, wantErr: "'line' must be a single line"},
+		{name: "multi-line line", properties: map[string]interface{}{"path": "/etc/hosts", "line": "a\nb"}, wantErr: "'line' must be a single line"},
+		{name: "bad regexp", properties: map[string]interface{}{"path": "/etc/hosts", "line": "x", "regexp": "("}, wantErr: "invalid file_edit regexp"},
+		{name: "marker without mark", properties: map[string]interface{}{"path": "/etc/hosts", "block": "x", "marker": "# managed"}, wantErr: "must contain {mark}"},
+		{name: "marker with line", properties: map[string]interface{}{"path": "/etc/hosts", "line": "x", "marker": "# {mark}"}, wantErr: "only be used with 'block'"},
+		{name: "create not bool", properties: map[string]interface{}{"path": "/etc/hosts", "line": "x", "create": "yes"}, wantErr: "'create' must be a boolean"},
+		{name: "invalid state", state: "running", properties: map[string]interface{}{"path": "/etc/hosts", "line": "x"}, wantErr: "invalid file_edit state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "file_edit", Name: "edit", State: tt.state, Properties: tt.properties}
+			err := provider.Validate(resource)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestFileEdit_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		properties map[string]interface{}
+		content    string
+		want       string
+		from       string
+		to         string
+	}{
+		{
+			name:       "append missing line",
+			properties: map[string]interface{}{"line": "10.0.0.5 db"},
+			content:    "127.0.0.1 localhost\n",
+			want:       "127.0.0.1 localhost\n10.0.0.5 db\n",
+			to:         "10.0.0.5 db",
+		},
+		{
+			name:       "line already present",
+			properties: map[string]interface{}{"line": "10.0.0.5 db"},
+			content:    "10.0.0.5 db\n127.0.0.1 localhost\n",
+			want:       "10.0.0.5 db\n127.0.0.1 localhost\n",
+			from:       "10.0.0.5 db",
+			to:         "10.0.0.5 db",
+		},
+		{
+			name:       "replace last regexp match",
+			properties: map[string]interface{}{"line": "PermitRootLogin no", "regexp": "^#?PermitRootLogin"},
+			content:    "#PermitRootLogin prohibit-password\nPort 22\nPermitRootLogin yes\n",
+			want:       "#PermitRootLogin prohibit-password\nPort 22\nPermitRootLogin no\n",
+			from:       "PermitRootLogin yes",
+			to:         "PermitRootLogin no",
+		},
+		{
+			name:       "regexp without match appends",
+			properties: map[string]interface{}{"line": "PermitRootLogin no", "regexp": "^#?PermitRootLogin"},
+			content:    "Port 22",
+			want:       "Port 22\nPermitRootLogin no",
+			to:         "PermitRootLogin no",
+		},
+		{
+			name:       "create empty file",
+			properties: map[string]interface{}{"line": "vm.swappiness = 10"},
+			content:    "",
+			want:       "vm.swappiness = 10\n",
+			to:         "vm.swappiness = 10",
+		},
+		{
+			name:       "remove exact line",
+			state:      types.StateAbsent,
+			properties: map[string]interface{}{"line": "10.0.0.5 db"},
+			content:    "127.0.0.1 localhost\n10.0.0.5 db\n",
+			want:       "127.0.0.1 localhost\n",
+			from:       "10.0.0.5 db",
+		},
+		{
+			name:       "remove regexp matches",
+			state:      types.StateAbsent,
+			properties: map[string]interface{}{"regexp": "old-db$"},
+			content:    "10.0.0.1 old-db\n127.0.0.1 localhost\n10.0.0.2 old-db\n",
+			want:       "127.0.0.1 localhost\n",
+			from:       "10.0.0.1 old-db\n10.0.0.2 old-db",
+		},
+		{
+			name:       "append block",
+			properties: map[string]interface{}{"block": "10.0.0.5 db\n10.0.0.6 cache\n"},
+			content:    "127.0.0.1 localhost\n",
+			want:       "127.0.0.1 localhost\n# BEGIN CHISEL MANAGED BLOCK\n10.0.0.5 db\n10.0.0.6 cache\n# END CHISEL MANAGED BLOCK\n",
+			to:         "10.0.0.5 db\n10.0.0.6 cache",
+		},
+		{
+			name:       "replace block between markers",
+			properties: map[string]interface{}{"block": "10.0.0.7 db", "marker": "## {mark} app"},
+			content:    "127.0.0.1 localhost\n## BEGIN app\n10.0.0.5 db\n## END app\n::1 localhost\n",
+			want:       "127.0.0.1 localhost\n## BEGIN app\n10.0.0.7 db\n## END app\n::1 localhost\n",
+			from:       "10.0.0.5 db",
+			to:         "10.0.0.7 db",
+		},
+		{
+			name:       "block unchanged",
+			properties: map[string]interface{}{"block": "10.0.0.5 db"},
+			content:    "# BEGIN CHISEL MANAGED BLOCK\n10.0.0.5 db\n# END CHISEL MANAGED BLOCK\n",
+			want:       "# BEGIN CHISEL MANAGED BLOCK\n10.0.0.5 db\n# END CHISEL MANAGED BLOCK\n",
+			from:       "10.0.0.5 db",
+			to:         "10.0.0.5 db",
+		},
+		{
+			name:       "remove block",
+			state:      types.StateAbsent,
+			properties: map[string]interface{}{"block": ""},
+			content:    "a\n# BEGIN CHISEL MANAGED BLOCK\nb\n# END CHISEL MANAGED BLOCK\nc\n",
+			want:       "a\nc\n",
+			from:       "b",
+		},
+		{
+			name:       "unterminated block is appended",
+			properties: map[string]interface{}{"block": "b"},
+			content:    "# BEGIN CHISEL MANAGED BLOCK\n",
+			want:       "# BEGIN CHISEL MANAGED BLOCK\n# BEGIN CHISEL MANAGED BLOCK\nb\n# END CHISEL MANAGED BLOCK\n",
+			to:         "b",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "file_edit", Name: "edit", State: tt.state, Properties: tt.properties}
+			edit, err := newFileEdit(resource)
+			if err != nil {
+				t.Fatalf("newFileEdit() error = %v", err)
+			}
+			got, from, to, changed := edit.apply(tt.content)
+			if got != tt.want {
+				t.Errorf("apply() content = %q, want %q", got, tt.want)
+			}
+			if from != tt.from || to != tt.to {
+				t.Errorf("apply() fragment = %q -> %q, want %q -> %q", from, to, tt.from, tt.to)
+			}
+			if changed != (tt.content != tt.want) {
+				t.Errorf("apply() changed = %v", changed)
+			}
+		})
+	}
+}
+
+func TestFileEditProvider_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "sshd_config")
+	if err := os.WriteFile(path, []byte("Port 22\nPermitRootLogin yes\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	provider := NewFileEditProvider(&ssh.LocalExecutor{})
+	resource := &types.Resource{
+		Type: "file_edit",
+		Name: "root-login",
+		Properties: map[string]interface{}{
+			"path":   path,
+			"line":   "PermitRootLogin no",
+			"regexp": "^#?PermitRootLogin",
+		},
+	}
+
+	current, err := provider.Read(ctx, resource)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	diff, err := provider.Diff(ctx, resource, current)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if diff.Action != types.ActionUpdate {
+		t.Fatalf("Expected update, got %s", diff.Action)
+	}
+	if err := provider.Apply(ctx, resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if string(data) != "Port 22\nPermitRootLogin no\n" {
+		t.Errorf("file = %q", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode to be kept, got %v", info.Mode().Perm())
+	}
+	if _, err := os.Stat(path + ".chisel.tmp"); !os.IsNotExist(err) {
+		t.Error("Expected the temporary file to be removed")
+	}
+
+	current, _ = provider.Read(ctx, resource)
+	diff, _ = provider.Diff(ctx, resource, current)
+	if diff.Action != types.ActionNoop {
+		t.Errorf("Expected noop after apply, got %s", diff.Action)
+	}
+}
+
+func TestFileEditProvider_MissingFile(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "hosts")
+	provider := NewFileEditProvider(&ssh.LocalExecutor{})
+
+	absent := &types.Resource{Type: "file_edit", Name: "old", State: types.StateAbsent, Properties: map[string]interface{}{"path": path, "line": "x"}}
+	current, _ := provider.Read(ctx, absent)
+	if diff, _ := provider.Diff(ctx, absent, current); diff.Action != types.ActionNoop {
+		t.Errorf("Expected noop for absent edit of a missing file, got %s", diff.Action)
+	}
+
+	resource := &types.Resource{Type: "file_edit", Name: "db", Properties: map[string]interface{}{"path": path, "line": "10.0.0.5 db"}}
+	current, _ = provider.Read(ctx, resource)
+	diff, _ := provider.Diff(ctx, resource, current)
+	if err := provider.Apply(ctx, resource, diff); err == nil || !strings.Contains(err.Error(), "set create: true") {
+		t.Errorf("Apply() error = %v, want missing file error", err)
+	}
+
+	resource.Properties["create"] = true
+	if err := provider.Apply(ctx, resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "10.0.0.5 db\n" {
+		t.Errorf("file = %q", data)
+	}
+}
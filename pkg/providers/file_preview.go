@@ -0,0 +1,88 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// FilePreview is what a file resource would write next to what the target
+// has now
+type FilePreview struct {
+	Path string
+	// Desired is the rendered content, empty when the file is to be removed
+	Desired string
+	// Current is the content on the target, empty when Exists is false
+	Current string
+	Exists  bool
+}
+
+// PreviewFile renders a file resource's template or content the way apply
+// does and reads the file it would replace, without changing anything
+func PreviewFile(ctx context.Context, connection ssh.Executor, resource *types.Resource) (*FilePreview, error) {
+	provider := NewFileProvider(connection)
+	if err := checkPreviewable(provider, resource); err != nil {
+		return nil, err
+	}
+
+	preview := &FilePreview{Path: resource.Properties["path"].(string)}
+	if resource.State != types.StateAbsent {
+		desired, err := provider.resolveContent(resource)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render %s: %w", resource.ResourceID(), err)
+		}
+		preview.Desired = desired
+	}
+
+	ctx = ssh.WithPrivileged(withBecome(ctx, resource), provider.Capabilities().Privileged)
+	result, err := connection.Execute(ctx, fmt.Sprintf("test -f %s", shellEscape(preview.Path)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check file existence: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return preview, nil
+	}
+	result, err = connection.Execute(ctx, fmt.Sprintf("cat %s", shellEscape(preview.Path)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file content: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to read %s: %s", preview.Path, result.Stderr)
+	}
+	preview.Current = result.Stdout
+	preview.Exists = true
+	return preview, nil
+}
+
+// RenderFile renders a file resource's template, template_file or content
+// the way apply does, without a target
+func RenderFile(resource *types.Resource) (string, error) {
+	provider := NewFileProvider(nil)
+	if err := checkPreviewable(provider, resource); err != nil {
+		return "", err
+	}
+	rendered, err := provider.resolveContent(resource)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %w", resource.ResourceID(), err)
+	}
+	return rendered, nil
+}
+
+// checkPreviewable validates a file resource whose content can be known
+// without copying anything to the target. Audited resources are validated
+// against the default state, as the planner does.
+func checkPreviewable(provider *FileProvider, resource *types.Resource) error {
+	validated := *resource
+	if validated.State == types.StateAudit {
+		validated.State = ""
+	}
+	if err := provider.Validate(&validated); err != nil {
+		return err
+	}
+	if _, hasSource := resource.Properties["source"]; hasSource {
+		return fmt.Errorf("resource %s copies a source artifact; only template, template_file and content can be previewed", resource.ResourceID())
+	}
+	return nil
+}
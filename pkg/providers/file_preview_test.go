@@ -0,0 +1,125 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestPreviewFile(t *testing.T) {
+	dir := t.TempDir()
+	existing := filepath.Join(dir, "app.conf")
+	if err := os.WriteFile(existing, []byte("port = 80\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	template := func(path string) *types.Resource {
+		return &types.Resource{
+			Type: "file",
+			Name: "app-config",
+			Properties: map[string]interface{}{
+				"path":     path,
+				"template": "port = {{ .port }}\n",
+				"vars":     map[string]interface{}{"port": 8080},
+			},
+		}
+	}
+
+	tests := []struct {
+		name     string
+		resource *types.Resource
+		want     FilePreview
+		wantErr  string
+	}{
+		{
+			name:     "existing file",
+			resource: template(existing),
+			want:     FilePreview{Path: existing, Desired: "port = 8080\n", Current: "port = 80\n", Exists: true},
+		},
+		{
+			name:     "missing file",
+			resource: template(filepath.Join(dir, "new.conf")),
+			want:     FilePreview{Path: filepath.Join(dir, "new.conf"), Desired: "port = 8080\n"},
+		},
+		{
+			name: "audited file",
+			resource: func() *types.Resource {
+				resource := template(existing)
+				resource.State = types.StateAudit
+				return resource
+			}(),
+			want: FilePreview{Path: existing, Desired: "port = 8080\n", Current: "port = 80\n", Exists: true},
+		},
+		{
+			name: "absent file",
+			resource: &types.Resource{
+				Type:       "file",
+				Name:       "old",
+				State:      types.StateAbsent,
+				Properties: map[string]interface{}{"path": existing},
+			},
+			want: FilePreview{Path: existing, Current: "port = 80\n", Exists: true},
+		},
+		{
+			name: "source artifact",
+			resource: &types.Resource{
+				Type: "file",
+				Name: "release",
+				Properties: map[string]interface{}{
+					"path":     filepath.Join(dir, "release.tar.gz"),
+					"source":   "https://releases.example.com/app.tar.gz",
+					"checksum": "sha256:fb04dcb6970e4c3d1873de51fd5a50d7bb46b3383113602665c350ec40b5f990",
+				},
+			},
+			wantErr: "only template, template_file and content can be previewed",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := PreviewFile(context.Background(), &ssh.LocalExecutor{}, tt.resource)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("PreviewFile = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("PreviewFile: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("PreviewFile = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderFile(t *testing.T) {
+	resource := &types.Resource{
+		Type: "file",
+		Name: "motd",
+		Properties: map[string]interface{}{
+			"path":     "/etc/motd",
+			"template": "Welcome to {{ fact \"hostname\" }} ({{ .env }})\n",
+			"vars": map[string]interface{}{
+				"env":   "staging",
+				"facts": map[string]interface{}{"hostname": "web1"},
+			},
+		},
+	}
+	got, err := RenderFile(resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "Welcome to web1 (staging)\n" {
+		t.Errorf("RenderFile() = %q", got)
+	}
+
+	resource.Properties["template"] = "{{ .missing.field }"
+	if _, err := RenderFile(resource); err == nil || !strings.Contains(err.Error(), "failed to render file.motd") {
+		t.Errorf("RenderFile() with a broken template = %v", err)
+	}
+}
@@ -0,0 +1,183 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// WriteProtectedError is returned for a file that cannot be changed because
+// its filesystem is mounted read-only or it is immutable, so the fix can be
+// named instead of failing on the exit code of whichever command ran first
+type WriteProtectedError struct {
+	Path string
+	// Mount is the read-only mount point the file is on, when known
+	Mount string
+	// Immutable is set for files with the immutable attribute (chattr +i)
+	Immutable bool
+	// Err is the failure the protection was found from, if any
+	Err error
+}
+
+func (e *WriteProtectedError) Error() string {
+	switch {
+	case e.Immutable:
+		return fmt.Sprintf("%s is immutable (chattr +i); set force_unlock_immutable: true on the resource to unlock it while it is changed, or run chattr -i %s", e.Path, e.Path)
+	case e.Mount != "":
+		return fmt.Sprintf("%s is on %s, which is mounted read-only; remount it read-write or leave the file out of the module", e.Path, e.Mount)
+	default:
+		return fmt.Sprintf("%s is on a read-only filesystem; remount it read-write or leave the file out of the module", e.Path)
+	}
+}
+
+func (e *WriteProtectedError) Unwrap() error {
+	return e.Err
+}
+
+// statCommand returns the command printing the size, mode, owner and group
+// of an existing file, then the mount it is on and its attributes, so the
+// one round trip also tells whether the file can be changed. Hosts without
+// findmnt or lsattr print nothing for them and are taken to allow writes.
+func statCommand(path string) string {
+	quoted := shellEscape(path)
+	return fmt.Sprintf(`stat -c '%%s:%%a:%%U:%%G' %s && echo "mount:$(findmnt -n -o TARGET,OPTIONS -T %s 2>/dev/null)" && echo "attributes:$(lsattr -d %s 2>/dev/null)"`,
+		quoted, quoted, quoted)
+}
+
+// parseProtection adds to current the read-only mount and the immutable
+// attribute from a mount: or attributes: line of the stat command, and
+// reports whether the line was one
+func parseProtection(line string, current map[string]interface{}) bool {
+	if mount, ok := strings.CutPrefix(line, "mount:"); ok {
+		if target, readOnly := parseMountOptions(mount); readOnly {
+			current["read_only_mount"] = target
+		}
+		return true
+	}
+	if attributes, ok := strings.CutPrefix(line, "attributes:"); ok {
+		if immutableAttribute(attributes) {
+			current["immutable"] = true
+		}
+		return true
+	}
+	return false
+}
+
+// readOnlyMount returns the mount point of a path when it is mounted
+// read-only, or "" when it is not or cannot be told
+func (p *FileProvider) readOnlyMount(ctx context.Context, path string) string {
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("findmnt -n -o TARGET,OPTIONS -T %s", shellEscape(path)))
+	if err != nil || result.ExitCode != 0 {
+		return ""
+	}
+	mount, readOnly := parseMountOptions(result.Stdout)
+	if !readOnly {
+		return ""
+	}
+	return mount
+}
+
+// immutable reports whether a file has the immutable attribute
+func (p *FileProvider) immutable(ctx context.Context, path string) (bool, error) {
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("lsattr -d %s", shellEscape(path)))
+	if err != nil {
+		return false, fmt.Errorf("failed to read the attributes of %s: %w", path, err)
+	}
+	if result.ExitCode != 0 {
+		return false, nil
+	}
+	return immutableAttribute(result.Stdout), nil
+}
+
+// immutableAttribute reports whether the lsattr -d output of a file shows
+// the immutable attribute
+func immutableAttribute(output string) bool {
+	fields := strings.Fields(output)
+	return len(fields) > 0 && strings.Contains(fields[0], "i")
+}
+
+// parseMountOptions parses the TARGET OPTIONS line findmnt prints and
+// reports whether the mount is read-only
+func parseMountOptions(output string) (string, bool) {
+	fields := strings.Fields(strings.TrimSpace(output))
+	if len(fields) != 2 {
+		return "", false
+	}
+	for _, option := range strings.Split(fields[1], ",") {
+		if option == "ro" {
+			return fields[0], true
+		}
+	}
+	return fields[0], false
+}
+
+// checkWritable refuses a change to a file on a read-only mount, or to an
+// immutable file the resource does not allow forge to unlock
+func checkWritable(resource *types.Resource, current map[string]interface{}) error {
+	path := resource.Properties["path"].(string)
+	if mount, ok := current["read_only_mount"].(string); ok {
+		return &WriteProtectedError{Path: path, Mount: mount}
+	}
+	if immutable, _ := current["immutable"].(bool); immutable && !forceUnlockImmutable(resource) {
+		return &WriteProtectedError{Path: path, Immutable: true}
+	}
+	return nil
+}
+
+// forceUnlockImmutable reports whether forge may clear a file's immutable
+// attribute to change it
+func forceUnlockImmutable(resource *types.Resource) bool {
+	force, _ := resource.Properties["force_unlock_immutable"].(bool)
+	return force
+}
+
+// unlockImmutable clears the immutable attribute of a file the resource
+// allows forge to unlock, and reports whether it was set
+func (p *FileProvider) unlockImmutable(ctx context.Context, resource *types.Resource) (bool, error) {
+	path := resource.Properties["path"].(string)
+	if !forceUnlockImmutable(resource) {
+		return false, nil
+	}
+	immutable, err := p.immutable(ctx, path)
+	if err != nil || !immutable {
+		return false, err
+	}
+	if err := p.chattr(ctx, "-i", path); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// chattr changes the attributes of a file
+func (p *FileProvider) chattr(ctx context.Context, change, path string) error {
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("chattr %s %s", change, shellEscape(path)))
+	if err != nil {
+		return fmt.Errorf("failed to run chattr %s on %s: %w", change, path, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to run chattr %s on %s: %s", change, path, result.Stderr)
+	}
+	return nil
+}
+
+// protectionError turns the failure of a change into a WriteProtectedError
+// when the file turns out to be on a read-only filesystem or immutable, as
+// for a new file, whose directory is not looked into before, or when a
+// mount or attribute changed since the plan
+func (p *FileProvider) protectionError(ctx context.Context, path string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if strings.Contains(err.Error(), "Read-only file system") {
+		return &WriteProtectedError{Path: path, Mount: p.readOnlyMount(ctx, filepath.Dir(path)), Err: err}
+	}
+	if strings.Contains(err.Error(), "Operation not permitted") {
+		if immutable, _ := p.immutable(ctx, path); immutable {
+			return &WriteProtectedError{Path: path, Immutable: true, Err: err}
+		}
+	}
+	return err
+}
@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestParseMountOptions(t *testing.T) {
+	tests := []struct {
+		output   string
+		mount    string
+		readOnly bool
+	}{
+		{output: "/ rw,relatime\n", mount: "/"},
+		{output: "/usr ro,nosuid,nodev\n", mount: "/usr", readOnly: true},
+		{output: "/mnt/data rw,errors=remount-ro", mount: "/mnt/data"},
+		{output: "", mount: ""},
+	}
+
+	for _, tt := range tests {
+		mount, readOnly := parseMountOptions(tt.output)
+		if mount != tt.mount || readOnly != tt.readOnly {
+			t.Errorf("parseMountOptions(%q) = %q, %v, want %q, %v", tt.output, mount, readOnly, tt.mount, tt.readOnly)
+		}
+	}
+}
+
+// protectedFile is a file resource with content, read from a host where it
+// has the lsattr and findmnt output given
+func protectedFile(t *testing.T, properties map[string]interface{}, lsattr, findmnt string) (*FileProvider, *recordingConnection, *types.Resource, map[string]interface{}) {
+	t.Helper()
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		statCommand("/etc/resolv.conf"): {Stdout: "20:644:root:root\nmount:" + findmnt + "\nattributes:" + lsattr + "\n"},
+		"cat '/etc/resolv.conf'":        {Stdout: "nameserver 10.0.0.1"},
+		"lsattr -d '/etc/resolv.conf'":  {Stdout: lsattr},
+	}}}
+	properties["path"] = "/etc/resolv.conf"
+	properties["content"] = "nameserver 10.0.0.2"
+	resource := &types.Resource{Type: "file", Name: "resolv", Properties: properties}
+	provider := NewFileProvider(conn)
+	current, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	return provider, conn, resource, current
+}
+
+func TestFileProvider_ReadOnlyMount(t *testing.T) {
+	provider, _, resource, current := protectedFile(t, map[string]interface{}{}, "--------------e------- /etc/resolv.conf", "/ ro,relatime")
+	if current["read_only_mount"] != "/" || current["size"] != "20" {
+		t.Fatalf("Read() = %v, want the stats and read_only_mount /", current)
+	}
+
+	_, err := provider.Diff(context.Background(), resource, current)
+	var protected *WriteProtectedError
+	if !errors.As(err, &protected) || protected.Mount != "/" || !strings.Contains(err.Error(), "mounted read-only") {
+		t.Errorf("Diff() error = %v, want a read-only mount error", err)
+	}
+}
+
+func TestFileProvider_Immutable(t *testing.T) {
+	ctx := context.Background()
+	const immutable = "----i---------e------- /etc/resolv.conf"
+
+	t.Run("refused", func(t *testing.T) {
+		provider, _, resource, current := protectedFile(t, map[string]interface{}{}, immutable, "/ rw,relatime")
+		_, err := provider.Diff(ctx, resource, current)
+		var protected *WriteProtectedError
+		if !errors.As(err, &protected) || !protected.Immutable || !strings.Contains(err.Error(), "force_unlock_immutable") {
+			t.Errorf("Diff() error = %v, want an immutable file error", err)
+		}
+	})
+
+	t.Run("unchanged", func(t *testing.T) {
+		provider, _, resource, current := protectedFile(t, map[string]interface{}{}, immutable, "/ rw,relatime")
+		resource.Properties["content"] = "nameserver 10.0.0.1"
+		diff, err := provider.Diff(ctx, resource, current)
+		if err != nil || diff.Action != types.ActionNoop {
+			t.Errorf("Diff() = %+v, %v, want no change to an immutable file in its desired state", diff, err)
+		}
+	})
+
+	t.Run("unlocked", func(t *testing.T) {
+		provider, conn, resource, current := protectedFile(t, map[string]interface{}{"force_unlock_immutable": true}, immutable, "/ rw,relatime")
+		diff, err := provider.Diff(ctx, resource, current)
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+		if !strings.Contains(diff.Reason, "unlocking") {
+			t.Errorf("Reason = %q, want it to say the file is unlocked", diff.Reason)
+		}
+
+		conn.commands = nil
+		if err := provider.Apply(ctx, resource, diff); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		first, last := conn.commands[1], conn.commands[len(conn.commands)-1]
+		if first != "chattr -i '/etc/resolv.conf'" || last != "chattr +i '/etc/resolv.conf'" {
+			t.Errorf("commands = %q, want the file unlocked first and locked again last", conn.commands)
+		}
+	})
+}
+
+func TestFileProvider_ApplyOnReadOnlyFilesystem(t *testing.T) {
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		"rm -f '/usr/share/motd'":                      {ExitCode: 1, Stderr: "rm: cannot remove '/usr/share/motd': Read-only file system"},
+		"findmnt -n -o TARGET,OPTIONS -T '/usr/share'": {Stdout: "/usr ro,relatime\n"},
+	}}}
+	resource := &types.Resource{Type: "file", Name: "motd", State: types.StateAbsent, Properties: map[string]interface{}{"path": "/usr/share/motd"}}
+
+	err := NewFileProvider(conn).Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionDelete})
+	var protected *WriteProtectedError
+	if !errors.As(err, &protected) || protected.Mount != "/usr" || !strings.Contains(err.Error(), "mounted read-only") {
+		t.Errorf("Apply() error = %v, want a read-only mount error", err)
+	}
+}
+
+func TestFileProvider_ValidateForceUnlock(t *testing.T) {
+	resource := &types.Resource{Type: "file", Name: "resolv", Properties: map[string]interface{}{
+		"path":                   "/etc/resolv.conf",
+		"force_unlock_immutable": "yes",
+	}}
+	if err := NewFileProvider(nil).Validate(resource); err == nil {
+		t.Error("Validate() accepted a force_unlock_immutable that is not a boolean")
+	}
+}
@@ -0,0 +1,287 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// aclEntryPattern matches a normalized ACL entry such as "user:deploy:rwx"
+// or "default:group:web:r-x"
+var aclEntryPattern = regexp.MustCompile(`^(default:)?(user|group|mask|other):([^:]*):([r-][w-][x-])$`)
+
+// aclTagAliases maps the short ACL tags setfacl accepts to their full names
+var aclTagAliases = map[string]string{"u": "user", "g": "group", "m": "mask", "o": "other", "d": "default"}
+
+// validateSecurity checks the secontext and acl properties of a file resource
+func validateSecurity(resource *types.Resource) error {
+	if value, exists := resource.Properties["secontext"]; exists {
+		if secontext, ok := value.(string); !ok || secontext == "" || strings.ContainsAny(secontext, " \t\n") {
+			return fmt.Errorf("file 'secontext' must be a SELinux context or type, e.g. 'httpd_sys_content_t'")
+		}
+	}
+	if _, exists := resource.Properties["acl"]; exists {
+		if _, err := desiredACL(resource); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readSecurity adds the SELinux context and ACL of a file to current,
+// reading each only when the resource manages it
+func (p *FileProvider) readSecurity(ctx context.Context, path string, resource *types.Resource, current map[string]interface{}) error {
+	if _, ok := resource.Properties["secontext"]; ok {
+		result, err := p.connection.Execute(ctx, fmt.Sprintf("ls -Zd %s", shellEscape(path)))
+		if err != nil {
+			return fmt.Errorf("failed to read SELinux context of %s: %w", path, err)
+		}
+		if result.ExitCode == 0 {
+			current["secontext"] = parseSecontext(result.Stdout)
+		}
+	}
+
+	if _, ok := resource.Properties["acl"]; ok {
+		result, err := p.connection.Execute(ctx, fmt.Sprintf("getfacl -cp %s", shellEscape(path)))
+		if err != nil {
+			return fmt.Errorf("failed to read ACL of %s: %w", path, err)
+		}
+		if result.ExitCode == 0 {
+			current["acl"] = parseACL(result.Stdout)
+		}
+	}
+	return nil
+}
+
+// diffSecurity adds changes to the SELinux context and ACL to diff and
+// reports whether there were any
+func diffSecurity(resource *types.Resource, current map[string]interface{}, diff *types.ResourceDiff) bool {
+	changed := false
+
+	if desired, ok := resource.Properties["secontext"].(string); ok {
+		currentContext, _ := current["secontext"].(string)
+		if !secontextMatches(currentContext, desired) {
+			changed = true
+			diff.Changes["secontext"] = map[string]interface{}{
+				"from": currentContext,
+				"to":   desired,
+			}
+		}
+	}
+
+	if _, ok := resource.Properties["acl"]; ok {
+		desired, _ := desiredACL(resource)
+		currentEntries, _ := current["acl"].([]string)
+		compared := managedACL(currentEntries, desired)
+		if strings.Join(compared, ",") != strings.Join(desired, ",") {
+			changed = true
+			diff.Changes["acl"] = map[string]interface{}{
+				"from": strings.Join(compared, ", "),
+				"to":   strings.Join(desired, ", "),
+			}
+		}
+	}
+
+	return changed
+}
+
+// setSecurityAttributes sets the SELinux context and ACL of a file. The ACL
+// is set last because chmod recalculates the ACL mask.
+func (p *FileProvider) setSecurityAttributes(ctx context.Context, resource *types.Resource) error {
+	path := resource.Properties["path"].(string)
+
+	if desired, ok := resource.Properties["secontext"].(string); ok {
+		cmd := fmt.Sprintf("chcon %s %s", shellEscape(desired), shellEscape(path))
+		if !strings.Contains(desired, ":") {
+			cmd = fmt.Sprintf("chcon -t %s %s", shellEscape(desired), shellEscape(path))
+		}
+		result, err := p.connection.Execute(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("failed to set SELinux context on %s: %w", path, err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to set SELinux context on %s: %s", path, result.Stderr)
+		}
+	}
+
+	if _, ok := resource.Properties["acl"]; ok {
+		desired, err := desiredACL(resource)
+		if err != nil {
+			return err
+		}
+		result, err := p.connection.Execute(ctx, fmt.Sprintf("getfacl -cp %s", shellEscape(path)))
+		if err != nil {
+			return fmt.Errorf("failed to read ACL of %s: %w", path, err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to read ACL of %s: %s", path, result.Stderr)
+		}
+
+		// Remove entries that are no longer wanted, then add or update the rest
+		var commands []string
+		wanted := make(map[string]bool)
+		for _, entry := range desired {
+			wanted[aclQualifier(entry)] = true
+		}
+		for _, entry := range managedACL(parseACL(result.Stdout), desired) {
+			if !wanted[aclQualifier(entry)] {
+				commands = append(commands, fmt.Sprintf("setfacl -x %s %s", shellEscape(aclQualifier(entry)), shellEscape(path)))
+			}
+		}
+		if len(desired) > 0 {
+			commands = append(commands, fmt.Sprintf("setfacl -m %s %s", shellEscape(strings.Join(desired, ",")), shellEscape(path)))
+		}
+		for _, cmd := range commands {
+			result, err := p.connection.Execute(ctx, cmd)
+			if err != nil {
+				return fmt.Errorf("failed to set ACL on %s: %w", path, err)
+			}
+			if result.ExitCode != 0 {
+				return fmt.Errorf("failed to set ACL on %s: %s", path, result.Stderr)
+			}
+		}
+	}
+
+	return nil
+}
+
+// desiredACL returns the resource's ACL entries, normalized and sorted
+func desiredACL(resource *types.Resource) ([]string, error) {
+	var raw []string
+	switch value := resource.Properties["acl"].(type) {
+	case []string:
+		raw = value
+	case []interface{}:
+		for _, item := range value {
+			entry, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("file 'acl' entries must be strings like 'user:deploy:rwx'")
+			}
+			raw = append(raw, entry)
+		}
+	default:
+		return nil, fmt.Errorf("file 'acl' must be a list of entries like 'user:deploy:rwx'")
+	}
+
+	entries := make([]string, 0, len(raw))
+	seen := make(map[string]bool)
+	for _, entry := range raw {
+		normalized, err := normalizeACLEntry(entry)
+		if err != nil {
+			return nil, err
+		}
+		if seen[aclQualifier(normalized)] {
+			return nil, fmt.Errorf("file 'acl' lists '%s' more than once", aclQualifier(normalized))
+		}
+		seen[aclQualifier(normalized)] = true
+		entries = append(entries, normalized)
+	}
+	sort.Strings(entries)
+	return entries, nil
+}
+
+// normalizeACLEntry expands short tags and permissions, so "d:u:deploy:rx"
+// becomes "default:user:deploy:r-x"
+func normalizeACLEntry(entry string) (string, error) {
+	parts := strings.Split(strings.TrimSpace(entry), ":")
+	for i, part := range parts {
+		if full, ok := aclTagAliases[part]; ok && (i == 0 || (i == 1 && parts[0] == "default")) {
+			parts[i] = full
+		}
+	}
+	if len(parts) >= 2 {
+		perms := parts[len(parts)-1]
+		normalized := []byte("---")
+		for _, c := range perms {
+			switch c {
+			case 'r':
+				normalized[0] = 'r'
+			case 'w':
+				normalized[1] = 'w'
+			case 'x':
+				normalized[2] = 'x'
+			case '-':
+			default:
+				return "", fmt.Errorf("invalid file 'acl' entry '%s'", entry)
+			}
+		}
+		parts[len(parts)-1] = string(normalized)
+	}
+
+	normalized := strings.Join(parts, ":")
+	match := aclEntryPattern.FindStringSubmatch(normalized)
+	if match == nil {
+		return "", fmt.Errorf("invalid file 'acl' entry '%s', expected e.g. 'user:deploy:rwx' or 'default:group:web:r-x'", entry)
+	}
+	if (match[2] == "mask" || match[2] == "other") && match[3] != "" {
+		return "", fmt.Errorf("invalid file 'acl' entry '%s', %s entries have no name", entry, match[2])
+	}
+	return normalized, nil
+}
+
+// aclQualifier returns an entry without its permissions, as setfacl -x expects
+func aclQualifier(entry string) string {
+	return entry[:strings.LastIndex(entry, ":")]
+}
+
+// managedACL returns the current entries that the desired ACL is compared
+// with: every named entry, plus unnamed entries such as "user::rw-" or the
+// mask only when the desired ACL sets them, since they otherwise follow the mode
+func managedACL(current, desired []string) []string {
+	explicit := make(map[string]bool)
+	for _, entry := range desired {
+		explicit[aclQualifier(entry)] = true
+	}
+
+	managed := []string{}
+	for _, entry := range current {
+		if strings.HasSuffix(aclQualifier(entry), ":") && !explicit[aclQualifier(entry)] {
+			continue
+		}
+		managed = append(managed, entry)
+	}
+	sort.Strings(managed)
+	return managed
+}
+
+// parseACL parses getfacl output into entries, dropping comments and the
+// effective permissions getfacl prints when the mask restricts an entry
+func parseACL(output string) []string {
+	entries := []string{}
+	for _, line := range strings.Split(output, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		entries = append(entries, line)
+	}
+	sort.Strings(entries)
+	return entries
+}
+
+// parseSecontext returns the SELinux context from ls -Z output, which is
+// "context path" on current systems and "mode user group context path" on
+// older ones. Files without a context show "?".
+func parseSecontext(output string) string {
+	for _, field := range strings.Fields(output) {
+		if strings.Count(field, ":") >= 2 {
+			return field
+		}
+	}
+	return ""
+}
+
+// secontextMatches compares a full context with a desired context, or with
+// just the type part when the desired value is a type such as "etc_t"
+func secontextMatches(current, desired string) bool {
+	if strings.Contains(desired, ":") {
+		return current == desired
+	}
+	parts := strings.Split(current, ":")
+	return len(parts) >= 3 && parts[2] == desired
+}
@@ -2,11 +2,16 @@ package providers
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
 
+	"github.com/ataiva-software/forge/pkg/artifact"
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"github.com/ataiva-software/forge/pkg/types"
 )
@@ -38,6 +43,33 @@ func TestFileProvider_Validate(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid file resource with source",
+			resource: &types.Resource{
+				Type: "file",
+				Name: "release",
+				Properties: map[string]interface{}{
+					"path":     "/opt/app/release.tar.gz",
+					"source":   "https://releases.example.com/app-1.2.3.tar.gz",
+					"checksum": "sha256:fb04dcb6970e4c3d1873de51fd5a50d7bb46b3383113602665c350ec40b5f990",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "source with content",
+			resource: &types.Resource{
+				Type: "file",
+				Name: "release",
+				Properties: map[string]interface{}{
+					"path":    "/opt/app/release.tar.gz",
+					"source":  "https://releases.example.com/app-1.2.3.tar.gz",
+					"content": "inline",
+				},
+			},
+			wantErr: true,
+			errMsg:  "file 'source' cannot be combined with 'content'",
+		},
 		{
 			name: "valid file resource with all properties",
 			resource: &types.Resource{
@@ -180,7 +212,7 @@ func TestFileProvider_Read_FileExists(t *testing.T) {
 			"test -f '/etc/test.conf'": {
 				ExitCode: 0, // File exists
 			},
-			"stat -c '%s:%a:%U:%G' '/etc/test.conf'": {
+			statCommand("/etc/test.conf"): {
 				ExitCode: 0,
 				Stdout:   "1024:644:root:root",
 			},
@@ -284,6 +316,34 @@ func TestFileProvider_Diff_DeleteFile(t *testing.T) {
 	}
 }
 
+func TestFileProvider_Diff_ModeAsStatPrintsIt(t *testing.T) {
+	provider := NewFileProvider(nil)
+	resource := &types.Resource{
+		Type: "file",
+		Name: "test-file",
+		Properties: map[string]interface{}{
+			"path": "/etc/test.conf",
+			"mode": "0644",
+		},
+	}
+
+	// stat prints modes without the leading zero
+	current := map[string]interface{}{
+		"path":   "/etc/test.conf",
+		"exists": true,
+		"state":  types.StatePresent,
+		"mode":   "644",
+	}
+
+	diff, err := provider.Diff(context.Background(), resource, current)
+	if err != nil {
+		t.Fatalf("FileProvider.Diff() unexpected error = %v", err)
+	}
+	if diff.Action != types.ActionNoop {
+		t.Errorf("Expected action=noop, got %v with changes %v", diff.Action, diff.Changes)
+	}
+}
+
 func TestFileProvider_Diff_UpdateContent(t *testing.T) {
 	provider := NewFileProvider(nil)
 	resource := &types.Resource{
@@ -585,3 +645,56 @@ func TestFileProvider_Apply_WithTemplate(t *testing.T) {
 		})
 	}
 }
+
+func TestFileProvider_SourceFromArtifactCache(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte("v2"))
+	}))
+	defer server.Close()
+
+	cache := artifact.NewCache(t.TempDir())
+	resource := &types.Resource{
+		Type: "file",
+		Name: "release",
+		Properties: map[string]interface{}{
+			"path":   "/opt/app/release.tar.gz",
+			"source": server.URL + "/release.tar.gz",
+		},
+	}
+
+	// Two hosts with an outdated copy share one download
+	for _, host := range []string{"web1", "web2"} {
+		conn := &recordingConnection{}
+		provider := NewFileProvider(conn)
+		provider.SetArtifactCache(cache)
+
+		diff, err := provider.Diff(context.Background(), resource, map[string]interface{}{"exists": true, "sha256": "0123456789abcdef"})
+		if err != nil {
+			t.Fatalf("%s: Diff() error = %v", host, err)
+		}
+		if diff.Action != types.ActionUpdate {
+			t.Fatalf("%s: Action = %s, want update", host, diff.Action)
+		}
+		want := map[string]interface{}{"from": "sha256:0123456789ab", "to": "sha256:fb04dcb6970e"}
+		if !reflect.DeepEqual(diff.Changes["source"], want) {
+			t.Errorf("%s: source change = %v, want %v", host, diff.Changes["source"], want)
+		}
+
+		if err := provider.Apply(context.Background(), resource, diff); err != nil {
+			t.Fatalf("%s: Apply() error = %v", host, err)
+		}
+		wantCommands := []string{
+			"base64 -d > '/opt/app/release.tar.gz.chisel.tmp' << 'CHISEL_EOF'\ndjI=\nCHISEL_EOF",
+			"mv '/opt/app/release.tar.gz.chisel.tmp' '/opt/app/release.tar.gz'",
+		}
+		if !reflect.DeepEqual(conn.commands, wantCommands) {
+			t.Errorf("%s: commands = %q, want %q", host, conn.commands, wantCommands)
+		}
+	}
+
+	if got := atomic.LoadInt32(&requests); got != 1 {
+		t.Errorf("Expected 1 download for both hosts, got %d", got)
+	}
+}
@@ -0,0 +1,201 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// DefaultFingerprintAlgorithm hashes config files when a fingerprint does
+// not name an algorithm
+const DefaultFingerprintAlgorithm = "sha256"
+
+// fingerprintVariable is the environment variable of the drop-in that
+// records a service's config fingerprint
+const fingerprintVariable = "FORGE_CONFIG_FINGERPRINT"
+
+// fingerprintDropIn is the drop-in file the fingerprint is written to, in
+// the unit's drop-in directory
+const fingerprintDropIn = "forge-fingerprint.conf"
+
+// fingerprintStateDir holds the fingerprints of services on init systems
+// other than systemd, which have no drop-ins, one file per service
+const fingerprintStateDir = "/var/lib/forge/fingerprints"
+
+// fingerprintHashes are the commands config files can be hashed with, by
+// algorithm name. Each prints the hash of every file named on its command
+// line, and of its standard input when none is.
+var fingerprintHashes = map[string]string{
+	"md5":    "md5sum",
+	"sha1":   "sha1sum",
+	"sha256": "sha256sum",
+	"sha512": "sha512sum",
+}
+
+// configFingerprint is what a service's fingerprint covers and how it is
+// computed
+type configFingerprint struct {
+	files     []string
+	algorithm string
+	// restart restarts a running service when the fingerprint changes
+	restart bool
+}
+
+// fingerprintAlgorithms returns the supported algorithm names, sorted
+func fingerprintAlgorithms() []string {
+	names := make([]string, 0, len(fingerprintHashes))
+	for name := range fingerprintHashes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateFingerprint validates the fingerprint property of a service
+func validateFingerprint(resource *types.Resource) error {
+	if _, ok := resource.Properties["fingerprint"]; !ok {
+		return nil
+	}
+	_, err := serviceFingerprint(resource)
+	return err
+}
+
+// serviceFingerprint returns the fingerprint settings of a service, or nil
+// when it has none
+func serviceFingerprint(resource *types.Resource) (*configFingerprint, error) {
+	value, ok := resource.Properties["fingerprint"]
+	if !ok {
+		return nil, nil
+	}
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("service 'fingerprint' must be a map")
+	}
+	fingerprint := &configFingerprint{algorithm: DefaultFingerprintAlgorithm, restart: true}
+	for key, setting := range settings {
+		switch key {
+		case "files":
+			files, ok := setting.([]interface{})
+			if !ok || len(files) == 0 {
+				return nil, fmt.Errorf("service fingerprint 'files' must be a list of paths")
+			}
+			for _, file := range files {
+				name, ok := file.(string)
+				if !ok || !path.IsAbs(name) {
+					return nil, fmt.Errorf("service fingerprint 'files' must be absolute paths, got %v", file)
+				}
+				fingerprint.files = append(fingerprint.files, name)
+			}
+		case "algorithm":
+			algorithm, ok := setting.(string)
+			if _, supported := fingerprintHashes[algorithm]; !ok || !supported {
+				return nil, fmt.Errorf("service fingerprint 'algorithm' must be one of: %s", strings.Join(fingerprintAlgorithms(), ", "))
+			}
+			fingerprint.algorithm = algorithm
+		case "restart":
+			restart, ok := setting.(bool)
+			if !ok {
+				return nil, fmt.Errorf("service fingerprint 'restart' must be a boolean")
+			}
+			fingerprint.restart = restart
+		default:
+			return nil, fmt.Errorf("unknown service 'fingerprint' setting '%s'", key)
+		}
+	}
+	if len(fingerprint.files) == 0 {
+		return nil, fmt.Errorf("service 'fingerprint' requires files")
+	}
+	return fingerprint, nil
+}
+
+// fingerprintPath returns the file a service's fingerprint is written to:
+// a drop-in of its unit with systemd, a file of its own otherwise
+func fingerprintPath(resource *types.Resource, system *initSystem) string {
+	if system.name != "systemd" {
+		return path.Join(fingerprintStateDir, path.Base(resource.Name))
+	}
+	return path.Join(systemdUnitDir, path.Base(unitPath(resource))+".d", fingerprintDropIn)
+}
+
+// fingerprintRecord returns the content of a service's fingerprint file.
+// The drop-in sets it in the unit's environment; other files only hold it.
+func fingerprintRecord(system *initSystem, value string) string {
+	if system.name != "systemd" {
+		return fmt.Sprintf("# Managed by forge: fingerprint of the service's config files\n%s=%s", fingerprintVariable, value)
+	}
+	return fmt.Sprintf("# Managed by forge: fingerprint of the service's config files\n[Service]\nEnvironment=%s=%s", fingerprintVariable, value)
+}
+
+// script returns the command printing the fingerprint recorded in the
+// file and the fingerprint of the config files now, in one round trip.
+// Directories cover every file below them; the hash of each file is listed
+// with its path, sorted, and the list hashed again, so adding, removing,
+// renaming or editing any file changes the fingerprint.
+func (f *configFingerprint) script(record string) string {
+	hash := fingerprintHashes[f.algorithm]
+	quoted := make([]string, len(f.files))
+	for i, file := range f.files {
+		quoted[i] = shellEscape(file)
+	}
+	return fmt.Sprintf(`echo "recorded:$(sed -n 's/^\(Environment=\)\{0,1\}%s=//p' %s 2>/dev/null)"; `+
+		`echo "files:%s:$(find %s -type f -print0 2>/dev/null | LC_ALL=C sort -z | xargs -0 -r %s | %s | cut -d' ' -f1)"`,
+		fingerprintVariable, shellEscape(record), f.algorithm, strings.Join(quoted, " "), hash, hash)
+}
+
+// parseFingerprints reads the recorded and current fingerprints from the
+// output of the fingerprint script
+func parseFingerprints(output string) (recorded, current string) {
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if value, ok := strings.CutPrefix(line, "recorded:"); ok {
+			recorded = value
+		} else if value, ok := strings.CutPrefix(line, "files:"); ok {
+			current = value
+		}
+	}
+	return recorded, current
+}
+
+// readFingerprints returns the fingerprint recorded for a service and the
+// fingerprint of its config files now
+func (p *ServiceProvider) readFingerprints(ctx context.Context, resource *types.Resource, fingerprint *configFingerprint) (string, string, error) {
+	system, err := p.detectInitSystem(ctx)
+	if err != nil {
+		return "", "", err
+	}
+	result, err := p.connection.Execute(ctx, fingerprint.script(fingerprintPath(resource, system)))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to fingerprint config files: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return "", "", fmt.Errorf("failed to fingerprint config files: %s", strings.TrimSpace(result.Stderr))
+	}
+	recorded, current := parseFingerprints(result.Stdout)
+	return recorded, current, nil
+}
+
+// writeFingerprint records a service's fingerprint. With systemd it goes
+// in a drop-in, and systemd is reloaded so the unit's environment shows it.
+func (p *ServiceProvider) writeFingerprint(ctx context.Context, resource *types.Resource, value string) error {
+	system, err := p.detectInitSystem(ctx)
+	if err != nil {
+		return err
+	}
+	record := fingerprintPath(resource, system)
+	cmd := fmt.Sprintf("mkdir -p %s && cat > %s << 'CHISEL_EOF'\n%s\nCHISEL_EOF", shellEscape(path.Dir(record)), shellEscape(record), fingerprintRecord(system, value))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to write fingerprint %s: %w", record, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to write fingerprint %s: %s", record, strings.TrimSpace(result.Stderr))
+	}
+	if system.name != "systemd" {
+		return nil
+	}
+	return p.daemonReload(ctx)
+}
@@ -0,0 +1,147 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestServiceFingerprint(t *testing.T) {
+	files := []interface{}{"/etc/nginx/nginx.conf", "/etc/nginx/conf.d"}
+	tests := []struct {
+		name        string
+		fingerprint interface{}
+		wantErr     string
+	}{
+		{name: "files", fingerprint: map[string]interface{}{"files": files}},
+		{name: "algorithm", fingerprint: map[string]interface{}{"files": files, "algorithm": "sha512", "restart": false}},
+		{name: "not a map", fingerprint: "/etc/nginx/nginx.conf", wantErr: "service 'fingerprint' must be a map"},
+		{name: "no files", fingerprint: map[string]interface{}{"algorithm": "md5"}, wantErr: "service 'fingerprint' requires files"},
+		{name: "relative file", fingerprint: map[string]interface{}{"files": []interface{}{"nginx.conf"}}, wantErr: "must be absolute paths"},
+		{name: "unknown algorithm", fingerprint: map[string]interface{}{"files": files, "algorithm": "crc32"}, wantErr: "must be one of: md5, sha1, sha256, sha512"},
+		{name: "unknown setting", fingerprint: map[string]interface{}{"files": files, "reload": true}, wantErr: "unknown service 'fingerprint' setting 'reload'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "service", Name: "nginx", State: types.StateRunning, Properties: map[string]interface{}{"fingerprint": tt.fingerprint}}
+			err := NewServiceProvider(nil).Validate(resource)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceProvider_Fingerprint(t *testing.T) {
+	resource := &types.Resource{
+		Type:  "service",
+		Name:  "nginx",
+		State: types.StateRunning,
+		Properties: map[string]interface{}{
+			"fingerprint": map[string]interface{}{"files": []interface{}{"/etc/nginx"}},
+		},
+	}
+	fingerprint, _ := serviceFingerprint(resource)
+	script := fingerprint.script("/etc/systemd/system/nginx.service.d/forge-fingerprint.conf")
+
+	tests := []struct {
+		name   string
+		output string
+		want   []string
+	}{
+		{
+			name:   "unchanged",
+			output: "recorded:sha256:aaa\nfiles:sha256:aaa\n",
+		},
+		{
+			name:   "config changed",
+			output: "recorded:sha256:aaa\nfiles:sha256:bbb\n",
+			want: []string{
+				"mkdir -p '/etc/systemd/system/nginx.service.d' && cat > '/etc/systemd/system/nginx.service.d/forge-fingerprint.conf'",
+				"systemctl daemon-reload",
+				"systemctl restart 'nginx'",
+			},
+		},
+		{
+			// The config the running service has is unknown, so it is not
+			// restarted when the fingerprint is first recorded
+			name:   "first recorded",
+			output: "recorded:\nfiles:sha256:bbb\n",
+			want: []string{
+				"mkdir -p '/etc/systemd/system/nginx.service.d' && cat > '/etc/systemd/system/nginx.service.d/forge-fingerprint.conf'",
+				"systemctl daemon-reload",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+				"systemctl is-active 'nginx'":  {Stdout: "active\n"},
+				"systemctl is-enabled 'nginx'": {Stdout: "enabled\n"},
+				script:                         {Stdout: tt.output},
+			}}}
+			provider := NewServiceProvider(conn)
+			provider.SetInitSystem("systemd")
+
+			current, err := provider.Read(context.Background(), resource)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			diff, err := provider.Diff(context.Background(), resource, current)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if (diff.Action == types.ActionUpdate) != (tt.want != nil) {
+				t.Fatalf("Diff() = %s with %v", diff.Action, diff.Changes)
+			}
+			conn.commands = nil
+			if err := provider.Apply(context.Background(), resource, diff); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if len(conn.commands) != len(tt.want) {
+				t.Fatalf("commands = %q, want %q", conn.commands, tt.want)
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(conn.commands[i], prefix) {
+					t.Errorf("command[%d] = %q, want prefix %q", i, conn.commands[i], prefix)
+				}
+			}
+			if tt.want != nil && !strings.Contains(conn.commands[0], "Environment=FORGE_CONFIG_FINGERPRINT=sha256:bbb\n") {
+				t.Errorf("drop-in = %q, want the new fingerprint", conn.commands[0])
+			}
+		})
+	}
+
+	// Other init systems have no drop-ins, so the fingerprint is kept in a
+	// file of its own and nothing is reloaded
+	openrc, _ := initSystemNamed("openrc")
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		openrc.fill(openrc.active, "nginx"):                     {Stdout: "active\n"},
+		openrc.fill(openrc.enabled, "nginx"):                    {Stdout: "enabled\n"},
+		fingerprint.script("/var/lib/forge/fingerprints/nginx"): {Stdout: "recorded:sha256:aaa\nfiles:sha256:bbb\n"},
+	}}}
+	provider := NewServiceProvider(conn)
+	provider.SetInitSystem("openrc")
+	current, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatalf("Read() on openrc error = %v", err)
+	}
+	diff, err := provider.Diff(context.Background(), resource, current)
+	if err != nil || diff.Action != types.ActionUpdate {
+		t.Fatalf("Diff() on openrc = %+v, %v", diff, err)
+	}
+	conn.commands = nil
+	if err := provider.Apply(context.Background(), resource, diff); err != nil {
+		t.Fatalf("Apply() on openrc error = %v", err)
+	}
+	if len(conn.commands) != 2 || !strings.HasPrefix(conn.commands[0], "mkdir -p '/var/lib/forge/fingerprints' && cat > '/var/lib/forge/fingerprints/nginx'") ||
+		!strings.Contains(conn.commands[0], "\nFORGE_CONFIG_FINGERPRINT=sha256:bbb\n") || conn.commands[1] != "rc-service 'nginx' restart" {
+		t.Errorf("commands on openrc = %q", conn.commands)
+	}
+}
@@ -0,0 +1,626 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// defaultFirewallZone is the firewalld zone used when none is given
+const defaultFirewallZone = "public"
+
+// richRulePattern matches the firewalld rich rules written for source-restricted ports
+var richRulePattern = regexp.MustCompile(`source address="([^"]+)" port port="([^"]+)" protocol="([^"]+)" accept`)
+
+// firewallRule is a single allow rule for a port or a named service
+type firewallRule struct {
+	Port     string
+	Protocol string
+	Source   string
+	Service  string
+}
+
+// String returns the canonical form of the rule, used to compare rules across backends
+func (r firewallRule) String() string {
+	if r.Service != "" {
+		return "service:" + r.Service
+	}
+	key := r.Port + "/" + r.Protocol
+	if r.Source != "" {
+		key += " from " + r.Source
+	}
+	return key
+}
+
+// parseRuleKey parses the canonical form produced by firewallRule.String
+func parseRuleKey(key string) firewallRule {
+	if service, ok := strings.CutPrefix(key, "service:"); ok {
+		return firewallRule{Service: service}
+	}
+	var rule firewallRule
+	spec, source, _ := strings.Cut(key, " from ")
+	rule.Source = source
+	rule.Port, rule.Protocol, _ = strings.Cut(spec, "/")
+	return rule
+}
+
+// FirewallProvider manages allow rules with ufw, firewalld or iptables
+type FirewallProvider struct {
+	connection ssh.Executor
+}
+
+// NewFirewallProvider creates a new firewall provider
+func NewFirewallProvider(connection ssh.Executor) *FirewallProvider {
+	return &FirewallProvider{
+		connection: connection,
+	}
+}
+
+// Type returns the resource type this provider handles
+func (p *FirewallProvider) Type() string {
+	return "firewall"
+}
+
+// Capabilities returns the targets this provider can manage
+func (p *FirewallProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux},
+		Commands:   []string{"ufw|firewall-cmd|iptables"},
+		Privileged: []string{"firewall-cmd", "iptables", "ufw"},
+	}
+}
+
+// Validate validates the firewall resource configuration
+func (p *FirewallProvider) Validate(resource *types.Resource) error {
+	switch firewallState(resource) {
+	case types.StatePresent, types.StateAbsent:
+	default:
+		return fmt.Errorf("invalid firewall state '%s', must be one of: present, absent", firewallState(resource))
+	}
+
+	if backend, ok := resource.Properties["backend"]; ok {
+		switch backend {
+		case "ufw", "firewalld", "iptables":
+		default:
+			return fmt.Errorf("invalid firewall backend '%v', must be one of: ufw, firewalld, iptables", backend)
+		}
+	}
+	if zone, ok := resource.Properties["zone"]; ok {
+		if _, ok := zone.(string); !ok {
+			return fmt.Errorf("firewall 'zone' must be a string")
+		}
+	}
+	if purge, ok := resource.Properties["purge"]; ok {
+		if _, ok := purge.(bool); !ok {
+			return fmt.Errorf("firewall 'purge' must be a boolean")
+		}
+	}
+
+	if _, ok := resource.Properties["rules"]; !ok {
+		return fmt.Errorf("firewall resource must have 'rules' property")
+	}
+	_, err := desiredRules(resource)
+	return err
+}
+
+// Read parses the rules currently configured on the target
+func (p *FirewallProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	backend, err := p.backend(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	var rules []firewallRule
+	switch backend {
+	case "ufw":
+		rules, err = p.readUfw(ctx)
+	case "firewalld":
+		rules, err = p.readFirewalld(ctx, firewallZone(resource))
+	default:
+		rules, err = p.readIptables(ctx)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"backend": backend,
+		"rules":   ruleKeys(rules),
+	}, nil
+}
+
+// Diff compares the declared rules with the configured ones
+func (p *FirewallProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff := &types.ResourceDiff{
+		ResourceID: resource.ResourceID(),
+		Changes:    make(map[string]interface{}),
+	}
+
+	desired, err := desiredRules(resource)
+	if err != nil {
+		return nil, err
+	}
+	if backend, _ := current["backend"].(string); backend == "iptables" {
+		for _, rule := range desired {
+			if rule.Service != "" {
+				return nil, fmt.Errorf("iptables does not support service rules, use a port instead of '%s'", rule.Service)
+			}
+		}
+	}
+
+	existing := make(map[string]bool)
+	currentRules, _ := current["rules"].([]string)
+	for _, key := range currentRules {
+		existing[key] = true
+	}
+	declared := make(map[string]bool)
+	for _, key := range ruleKeys(desired) {
+		declared[key] = true
+	}
+
+	var add, remove []string
+	if firewallState(resource) == types.StateAbsent {
+		for _, key := range ruleKeys(desired) {
+			if existing[key] {
+				remove = append(remove, key)
+			}
+		}
+	} else {
+		for _, key := range ruleKeys(desired) {
+			if !existing[key] {
+				add = append(add, key)
+			}
+		}
+		if purge, _ := resource.Properties["purge"].(bool); purge {
+			for _, key := range currentRules {
+				if !declared[key] {
+					remove = append(remove, key)
+				}
+			}
+		}
+	}
+
+	if len(add) > 0 {
+		diff.Changes["add"] = add
+	}
+	if len(remove) > 0 {
+		diff.Changes["remove"] = remove
+	}
+
+	switch {
+	case len(add) == 0 && len(remove) == 0:
+		diff.Action = types.ActionNoop
+		diff.Reason = "firewall rules already in desired state"
+	case firewallState(resource) == types.StateAbsent:
+		diff.Action = types.ActionDelete
+		diff.Reason = "firewall rules need to be removed"
+	default:
+		diff.Action = types.ActionUpdate
+		diff.Reason = "firewall rules differ"
+	}
+
+	return diff, nil
+}
+
+// Apply adds and removes rules so the target matches the declaration
+func (p *FirewallProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	if diff.Action == types.ActionNoop {
+		return nil
+	}
+
+	backend, err := p.backend(ctx, resource)
+	if err != nil {
+		return err
+	}
+	zone := firewallZone(resource)
+
+	remove, _ := diff.Changes["remove"].([]string)
+	for _, key := range remove {
+		if err := p.run(ctx, firewallCommand(backend, zone, parseRuleKey(key), false)); err != nil {
+			return fmt.Errorf("failed to remove firewall rule %s: %w", key, err)
+		}
+	}
+
+	add, _ := diff.Changes["add"].([]string)
+	for _, key := range add {
+		if err := p.run(ctx, firewallCommand(backend, zone, parseRuleKey(key), true)); err != nil {
+			return fmt.Errorf("failed to add firewall rule %s: %w", key, err)
+		}
+	}
+
+	// firewalld rules are written to the permanent configuration and loaded on reload
+	if backend == "firewalld" {
+		if err := p.run(ctx, "firewall-cmd --reload"); err != nil {
+			return fmt.Errorf("failed to reload firewalld: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// backend returns the configured firewall backend, or detects it from the target
+func (p *FirewallProvider) backend(ctx context.Context, resource *types.Resource) (string, error) {
+	if backend, ok := resource.Properties["backend"].(string); ok && backend != "" {
+		return backend, nil
+	}
+
+	cmd := "if command -v ufw >/dev/null 2>&1; then echo ufw; elif command -v firewall-cmd >/dev/null 2>&1; then echo firewalld; else echo iptables; fi"
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return "", fmt.Errorf("failed to detect firewall backend: %w", err)
+	}
+	return strings.TrimSpace(result.Stdout), nil
+}
+
+// run executes a command and fails on a non-zero exit code
+func (p *FirewallProvider) run(ctx context.Context, cmd string) error {
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("%s", strings.TrimSpace(result.Stderr))
+	}
+	return nil
+}
+
+// readUfw reads the rules added to ufw, whether or not it is active
+func (p *FirewallProvider) readUfw(ctx context.Context) ([]firewallRule, error) {
+	result, err := p.connection.Execute(ctx, "ufw show added")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read ufw rules: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to read ufw rules: %s", result.Stderr)
+	}
+	return parseUfwRules(result.Stdout), nil
+}
+
+// readFirewalld reads the permanent ports, services and rich rules of a zone
+func (p *FirewallProvider) readFirewalld(ctx context.Context, zone string) ([]firewallRule, error) {
+	output := make(map[string]string, 3)
+	for _, list := range []string{"ports", "services", "rich-rules"} {
+		cmd := fmt.Sprintf("firewall-cmd --permanent --zone=%s --list-%s", shellEscape(zone), list)
+		result, err := p.connection.Execute(ctx, cmd)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read firewalld %s: %w", list, err)
+		}
+		if result.ExitCode != 0 {
+			return nil, fmt.Errorf("failed to read firewalld %s: %s", list, result.Stderr)
+		}
+		output[list] = result.Stdout
+	}
+	return parseFirewalldRules(output["ports"], output["services"], output["rich-rules"]), nil
+}
+
+// readIptables reads the ACCEPT rules of the INPUT chain
+func (p *FirewallProvider) readIptables(ctx context.Context) ([]firewallRule, error) {
+	result, err := p.connection.Execute(ctx, "iptables -S INPUT")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read iptables rules: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to read iptables rules: %s", result.Stderr)
+	}
+	return parseIptablesRules(result.Stdout), nil
+}
+
+// parseUfwRules parses the output of "ufw show added". Only allow rules are returned.
+func parseUfwRules(output string) []firewallRule {
+	var rules []firewallRule
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 || fields[0] != "ufw" || fields[1] != "allow" {
+			continue
+		}
+		args := fields[2:]
+		if args[0] == "in" {
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			continue
+		}
+
+		// Simple form: "ufw allow 22/tcp", "ufw allow 22" or "ufw allow OpenSSH"
+		if len(args) == 1 {
+			port, protocol, _ := strings.Cut(args[0], "/")
+			if !isPortSpec(port) {
+				rules = append(rules, firewallRule{Service: args[0]})
+				continue
+			}
+			rules = append(rules, firewallRule{Port: normalizePort(port), Protocol: protocolOrAny(protocol)})
+			continue
+		}
+
+		// Extended form: "ufw allow from 10.0.0.0/8 to any port 5432 proto tcp"
+		rule := firewallRule{}
+		for i := 0; i+1 < len(args); i++ {
+			switch args[i] {
+			case "from":
+				if args[i+1] != "any" {
+					rule.Source = args[i+1]
+				}
+			case "port":
+				rule.Port = normalizePort(args[i+1])
+			case "proto":
+				rule.Protocol = args[i+1]
+			}
+		}
+		if rule.Port == "" {
+			continue
+		}
+		rule.Protocol = protocolOrAny(rule.Protocol)
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// parseFirewalldRules parses the output of firewall-cmd --list-ports, --list-services and --list-rich-rules
+func parseFirewalldRules(ports, services, richRules string) []firewallRule {
+	var rules []firewallRule
+	for _, port := range strings.Fields(ports) {
+		number, protocol, _ := strings.Cut(port, "/")
+		rules = append(rules, firewallRule{Port: normalizePort(number), Protocol: protocol})
+	}
+	for _, service := range strings.Fields(services) {
+		rules = append(rules, firewallRule{Service: service})
+	}
+	for _, line := range strings.Split(richRules, "\n") {
+		if match := richRulePattern.FindStringSubmatch(line); match != nil {
+			rules = append(rules, firewallRule{Source: match[1], Port: normalizePort(match[2]), Protocol: match[3]})
+		}
+	}
+	return rules
+}
+
+// parseIptablesRules parses the output of "iptables -S INPUT". Only ACCEPT
+// rules that match a destination port are returned.
+func parseIptablesRules(output string) []firewallRule {
+	var rules []firewallRule
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "-A" || fields[1] != "INPUT" {
+			continue
+		}
+
+		rule := firewallRule{}
+		accept := false
+		for i := 2; i+1 < len(fields); i++ {
+			switch fields[i] {
+			case "-s":
+				if fields[i+1] != "0.0.0.0/0" {
+					rule.Source = fields[i+1]
+				}
+			case "-p":
+				rule.Protocol = fields[i+1]
+			case "--dport":
+				rule.Port = normalizePort(fields[i+1])
+			case "-j":
+				accept = fields[i+1] == "ACCEPT"
+			}
+		}
+		if accept && rule.Port != "" && rule.Protocol != "" {
+			rules = append(rules, rule)
+		}
+	}
+	return rules
+}
+
+// firewallCommand builds the command that adds or removes a rule
+func firewallCommand(backend, zone string, rule firewallRule, add bool) string {
+	switch backend {
+	case "ufw":
+		prefix := "ufw allow"
+		if !add {
+			prefix = "ufw delete allow"
+		}
+		switch {
+		case rule.Service != "":
+			return fmt.Sprintf("%s %s", prefix, shellEscape(rule.Service))
+		case rule.Source != "":
+			cmd := fmt.Sprintf("%s from %s to any port %s", prefix, shellEscape(rule.Source), ufwPort(rule.Port))
+			if rule.Protocol != "any" {
+				cmd += " proto " + rule.Protocol
+			}
+			return cmd
+		case rule.Protocol == "any":
+			return fmt.Sprintf("%s %s", prefix, ufwPort(rule.Port))
+		default:
+			return fmt.Sprintf("%s %s/%s", prefix, ufwPort(rule.Port), rule.Protocol)
+		}
+
+	case "firewalld":
+		action := "add"
+		if !add {
+			action = "remove"
+		}
+		base := fmt.Sprintf("firewall-cmd --permanent --zone=%s", shellEscape(zone))
+		switch {
+		case rule.Service != "":
+			return fmt.Sprintf("%s --%s-service=%s", base, action, shellEscape(rule.Service))
+		case rule.Source != "":
+			richRule := fmt.Sprintf(`rule family="%s" source address="%s" port port="%s" protocol="%s" accept`,
+				addressFamily(rule.Source), rule.Source, rule.Port, rule.Protocol)
+			return fmt.Sprintf("%s --%s-rich-rule=%s", base, action, shellEscape(richRule))
+		default:
+			return fmt.Sprintf("%s --%s-port=%s/%s", base, action, rule.Port, rule.Protocol)
+		}
+
+	default:
+		action := "-A"
+		if !add {
+			action = "-D"
+		}
+		cmd := "iptables " + action + " INPUT"
+		if rule.Source != "" {
+			cmd += " -s " + shellEscape(rule.Source)
+		}
+		return fmt.Sprintf("%s -p %s -m %s --dport %s -j ACCEPT",
+			cmd, rule.Protocol, rule.Protocol, strings.Replace(rule.Port, "-", ":", 1))
+	}
+}
+
+// desiredRules parses the declared rules
+func desiredRules(resource *types.Resource) ([]firewallRule, error) {
+	list, ok := resource.Properties["rules"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("firewall 'rules' must be a list")
+	}
+
+	rules := make([]firewallRule, 0, len(list))
+	for i, item := range list {
+		settings, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("firewall rules[%d] must be a map", i)
+		}
+
+		rule := firewallRule{}
+		if service, ok := settings["service"]; ok {
+			name, ok := service.(string)
+			if !ok || name == "" {
+				return nil, fmt.Errorf("firewall rules[%d]: 'service' must be a non-empty string", i)
+			}
+			if _, hasPort := settings["port"]; hasPort {
+				return nil, fmt.Errorf("firewall rules[%d]: cannot set both 'service' and 'port'", i)
+			}
+			rule.Service = name
+			rules = append(rules, rule)
+			continue
+		}
+
+		port, err := portSpec(settings["port"])
+		if err != nil {
+			return nil, fmt.Errorf("firewall rules[%d]: %w", i, err)
+		}
+		rule.Port = port
+
+		rule.Protocol = "tcp"
+		if protocol, ok := settings["protocol"]; ok {
+			switch protocol {
+			case "tcp", "udp":
+				rule.Protocol = protocol.(string)
+			default:
+				return nil, fmt.Errorf("firewall rules[%d]: invalid protocol '%v', must be one of: tcp, udp", i, protocol)
+			}
+		}
+
+		if source, ok := settings["source"]; ok {
+			address, ok := source.(string)
+			if !ok || address == "" {
+				return nil, fmt.Errorf("firewall rules[%d]: 'source' must be a non-empty string", i)
+			}
+			rule.Source = address
+		}
+
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+// portSpec validates a port or port range and returns it in "80" or "8000-8100" form
+func portSpec(value interface{}) (string, error) {
+	var spec string
+	switch v := value.(type) {
+	case int:
+		spec = strconv.Itoa(v)
+	case string:
+		spec = normalizePort(v)
+	case nil:
+		return "", fmt.Errorf("rule must have 'port' or 'service'")
+	default:
+		return "", fmt.Errorf("'port' must be a number or range")
+	}
+
+	low, high, isRange := strings.Cut(spec, "-")
+	for _, part := range []string{low, high} {
+		if !isRange && part == high {
+			continue
+		}
+		number, err := strconv.Atoi(part)
+		if err != nil || number < 1 || number > 65535 {
+			return "", fmt.Errorf("invalid port '%s'", spec)
+		}
+	}
+	return spec, nil
+}
+
+// isPortSpec reports whether s looks like a port or port range rather than a service name
+func isPortSpec(s string) bool {
+	s = normalizePort(s)
+	low, high, isRange := strings.Cut(s, "-")
+	if _, err := strconv.Atoi(low); err != nil {
+		return false
+	}
+	if isRange {
+		if _, err := strconv.Atoi(high); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizePort converts ufw and iptables "8000:8100" ranges to "8000-8100"
+func normalizePort(port string) string {
+	return strings.Replace(port, ":", "-", 1)
+}
+
+// ufwPort converts a port range to the "8000:8100" form ufw expects
+func ufwPort(port string) string {
+	return strings.Replace(port, "-", ":", 1)
+}
+
+// protocolOrAny returns the protocol, or "any" for rules that match both tcp and udp
+func protocolOrAny(protocol string) string {
+	if protocol == "" {
+		return "any"
+	}
+	return protocol
+}
+
+// addressFamily returns the firewalld rich rule family for a source address
+func addressFamily(source string) string {
+	if strings.Contains(source, ":") {
+		return "ipv6"
+	}
+	return "ipv4"
+}
+
+// ruleKeys returns the canonical keys of rules, sorted and without duplicates
+func ruleKeys(rules []firewallRule) []string {
+	seen := make(map[string]bool, len(rules))
+	keys := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		key := rule.String()
+		if !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// firewallState returns the desired state of the rules, defaulting to present
+func firewallState(resource *types.Resource) types.ResourceState {
+	if resource.State != "" {
+		return resource.State
+	}
+	if state, ok := resource.Properties["state"].(string); ok {
+		return types.ResourceState(state)
+	}
+	return types.StatePresent
+}
+
+// firewallZone returns the firewalld zone for the rules
+func firewallZone(resource *types.Resource) string {
+	if zone, ok := resource.Properties["zone"].(string); ok && zone != "" {
+		return zone
+	}
+	return defaultFirewallZone
+}
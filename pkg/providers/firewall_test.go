@@ -0,0 +1,287 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestFirewallProvider_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		wantErr    bool
+	}{
+		{
+			name:       "port rules",
+			properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": 443}, map[string]interface{}{"port": "8000-8100", "protocol": "udp"}}},
+		},
+		{
+			name:       "service rule",
+			properties: map[string]interface{}{"backend": "firewalld", "rules": []interface{}{map[string]interface{}{"service": "ssh"}}},
+		},
+		{name: "missing rules", properties: map[string]interface{}{}, wantErr: true},
+		{name: "invalid backend", properties: map[string]interface{}{"backend": "pf", "rules": []interface{}{}}, wantErr: true},
+		{name: "invalid port", properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": 70000}}}, wantErr: true},
+		{name: "invalid range", properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": "80-http"}}}, wantErr: true},
+		{name: "invalid protocol", properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": 53, "protocol": "icmp"}}}, wantErr: true},
+		{name: "port and service", properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"port": 22, "service": "ssh"}}}, wantErr: true},
+		{name: "rule without port", properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"source": "10.0.0.0/8"}}}, wantErr: true},
+		{name: "purge not boolean", properties: map[string]interface{}{"purge": "yes", "rules": []interface{}{}}, wantErr: true},
+	}
+
+	provider := NewFirewallProvider(&MockSSHConnection{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "firewall", Name: "web", Properties: tt.properties}
+			err := provider.Validate(resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParseFirewallRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []firewallRule
+		want  []string
+	}{
+		{
+			name: "ufw",
+			rules: parseUfwRules(`Added user rules (see 'ufw status' for running firewall):
+ufw allow 22/tcp
+ufw allow 8000:8100/udp
+ufw allow 53
+ufw allow OpenSSH
+ufw allow from 10.0.0.0/8 to any port 5432 proto tcp
+ufw deny 23/tcp
+`),
+			want: []string{"22/tcp", "53/any", "5432/tcp from 10.0.0.0/8", "8000-8100/udp", "service:OpenSSH"},
+		},
+		{
+			name: "firewalld",
+			rules: parseFirewalldRules("80/tcp 8000-8100/udp\n", "dhcpv6-client ssh\n",
+				`rule family="ipv4" source address="10.0.0.0/8" port port="5432" protocol="tcp" accept
+rule family="ipv4" source address="192.168.0.0/16" service name="http" reject
+`),
+			want: []string{"5432/tcp from 10.0.0.0/8", "80/tcp", "8000-8100/udp", "service:dhcpv6-client", "service:ssh"},
+		},
+		{
+			name: "iptables",
+			rules: parseIptablesRules(`-P INPUT DROP
+-A INPUT -i lo -j ACCEPT
+-A INPUT -m state --state RELATED,ESTABLISHED -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 22 -j ACCEPT
+-A INPUT -s 10.0.0.0/8 -p tcp -m tcp --dport 5432 -j ACCEPT
+-A INPUT -p udp -m udp --dport 8000:8100 -j ACCEPT
+-A INPUT -p tcp -m tcp --dport 23 -j DROP
+`),
+			want: []string{"22/tcp", "5432/tcp from 10.0.0.0/8", "8000-8100/udp"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ruleKeys(tt.rules); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("rules = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRuleKey(t *testing.T) {
+	rules := []firewallRule{
+		{Port: "22", Protocol: "tcp"},
+		{Port: "8000-8100", Protocol: "udp", Source: "10.0.0.0/8"},
+		{Service: "ssh"},
+	}
+	for _, rule := range rules {
+		if got := parseRuleKey(rule.String()); got != rule {
+			t.Errorf("parseRuleKey(%q) = %+v, want %+v", rule.String(), got, rule)
+		}
+	}
+}
+
+func TestFirewallProvider_Diff(t *testing.T) {
+	rules := []interface{}{
+		map[string]interface{}{"port": 80},
+		map[string]interface{}{"port": 443},
+	}
+
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		purge      bool
+		current    []string
+		wantAction types.DiffAction
+		wantAdd    []string
+		wantRemove []string
+	}{
+		{
+			name:       "adds missing rules",
+			current:    []string{"80/tcp"},
+			wantAction: types.ActionUpdate,
+			wantAdd:    []string{"443/tcp"},
+		},
+		{
+			name:       "keeps undeclared rules",
+			current:    []string{"22/tcp", "443/tcp", "80/tcp"},
+			wantAction: types.ActionNoop,
+		},
+		{
+			name:       "purges undeclared rules",
+			purge:      true,
+			current:    []string{"22/tcp", "80/tcp"},
+			wantAction: types.ActionUpdate,
+			wantAdd:    []string{"443/tcp"},
+			wantRemove: []string{"22/tcp"},
+		},
+		{
+			name:       "removes declared rules",
+			state:      types.StateAbsent,
+			current:    []string{"22/tcp", "80/tcp"},
+			wantAction: types.ActionDelete,
+			wantRemove: []string{"80/tcp"},
+		},
+	}
+
+	provider := NewFirewallProvider(&MockSSHConnection{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{
+				Type:       "firewall",
+				Name:       "web",
+				State:      tt.state,
+				Properties: map[string]interface{}{"rules": rules, "purge": tt.purge},
+			}
+			diff, err := provider.Diff(context.Background(), resource, map[string]interface{}{"backend": "ufw", "rules": tt.current})
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if diff.Action != tt.wantAction {
+				t.Errorf("Action = %s, want %s", diff.Action, tt.wantAction)
+			}
+			add, _ := diff.Changes["add"].([]string)
+			if !reflect.DeepEqual(add, tt.wantAdd) {
+				t.Errorf("add = %v, want %v", add, tt.wantAdd)
+			}
+			remove, _ := diff.Changes["remove"].([]string)
+			if !reflect.DeepEqual(remove, tt.wantRemove) {
+				t.Errorf("remove = %v, want %v", remove, tt.wantRemove)
+			}
+		})
+	}
+
+	t.Run("iptables rejects services", func(t *testing.T) {
+		resource := &types.Resource{
+			Type:       "firewall",
+			Name:       "ssh",
+			Properties: map[string]interface{}{"rules": []interface{}{map[string]interface{}{"service": "ssh"}}},
+		}
+		if _, err := provider.Diff(context.Background(), resource, map[string]interface{}{"backend": "iptables"}); err == nil {
+			t.Error("Expected error for service rule on iptables")
+		}
+	})
+}
+
+func TestFirewallProvider_Read(t *testing.T) {
+	conn := &MockSSHConnection{
+		responses: map[string]*ssh.ExecuteResult{
+			"firewall-cmd --permanent --zone='internal' --list-ports":      {ExitCode: 0, Stdout: "80/tcp\n"},
+			"firewall-cmd --permanent --zone='internal' --list-services":   {ExitCode: 0, Stdout: "ssh\n"},
+			"firewall-cmd --permanent --zone='internal' --list-rich-rules": {ExitCode: 0, Stdout: ""},
+		},
+	}
+	provider := NewFirewallProvider(conn)
+	resource := &types.Resource{
+		Type:       "firewall",
+		Name:       "web",
+		Properties: map[string]interface{}{"backend": "firewalld", "zone": "internal", "rules": []interface{}{}},
+	}
+
+	current, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if want := []string{"80/tcp", "service:ssh"}; !reflect.DeepEqual(current["rules"], want) {
+		t.Errorf("rules = %v, want %v", current["rules"], want)
+	}
+}
+
+func TestFirewallProvider_Apply(t *testing.T) {
+	changes := map[string]interface{}{
+		"add":    []string{"443/tcp", "5432/tcp from 10.0.0.0/8", "service:ssh"},
+		"remove": []string{"8000-8100/udp"},
+	}
+
+	tests := []struct {
+		backend string
+		want    []string
+	}{
+		{
+			backend: "ufw",
+			want: []string{
+				"ufw delete allow 8000:8100/udp",
+				"ufw allow 443/tcp",
+				"ufw allow from '10.0.0.0/8' to any port 5432 proto tcp",
+				"ufw allow 'ssh'",
+			},
+		},
+		{
+			backend: "firewalld",
+			want: []string{
+				"firewall-cmd --permanent --zone='public' --remove-port=8000-8100/udp",
+				"firewall-cmd --permanent --zone='public' --add-port=443/tcp",
+				`firewall-cmd --permanent --zone='public' --add-rich-rule='rule family="ipv4" source address="10.0.0.0/8" port port="5432" protocol="tcp" accept'`,
+				"firewall-cmd --permanent --zone='public' --add-service='ssh'",
+				"firewall-cmd --reload",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.backend, func(t *testing.T) {
+			conn := &recordingConnection{}
+			provider := NewFirewallProvider(conn)
+			resource := &types.Resource{
+				Type:       "firewall",
+				Name:       "web",
+				Properties: map[string]interface{}{"backend": tt.backend},
+			}
+			diff := &types.ResourceDiff{Action: types.ActionUpdate, Changes: changes}
+
+			if err := provider.Apply(context.Background(), resource, diff); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+			if !reflect.DeepEqual(conn.commands, tt.want) {
+				t.Errorf("commands = %q, want %q", conn.commands, tt.want)
+			}
+		})
+	}
+
+	t.Run("iptables", func(t *testing.T) {
+		conn := &recordingConnection{}
+		provider := NewFirewallProvider(conn)
+		resource := &types.Resource{Type: "firewall", Name: "web", Properties: map[string]interface{}{"backend": "iptables"}}
+		diff := &types.ResourceDiff{
+			Action:  types.ActionUpdate,
+			Changes: map[string]interface{}{"add": []string{"5432/tcp from 10.0.0.0/8"}, "remove": []string{"8000-8100/udp"}},
+		}
+
+		if err := provider.Apply(context.Background(), resource, diff); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		want := []string{
+			"iptables -D INPUT -p udp -m udp --dport 8000:8100 -j ACCEPT",
+			"iptables -A INPUT -s '10.0.0.0/8' -p tcp -m tcp --dport 5432 -j ACCEPT",
+		}
+		if !reflect.DeepEqual(conn.commands, want) {
+			t.Errorf("commands = %q, want %q", conn.commands, want)
+		}
+	})
+}
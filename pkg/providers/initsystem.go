@@ -0,0 +1,160 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// DefaultInitSystem is assumed where there is no host to detect the init
+// system on, such as plan previews and module tests
+const DefaultInitSystem = "systemd"
+
+// initSystemScript prints the init system running on a host as an init:
+// line of the facts script. Having systemctl installed is not enough, as
+// containers and chroots often have it without systemd running.
+const initSystemScript = `if [ -d /run/systemd/system ]; then echo init:systemd; ` +
+	`elif [ -d /run/openrc ] || command -v openrc-run >/dev/null 2>&1; then echo init:openrc; ` +
+	`elif [ "$(uname -s)" = Darwin ]; then echo init:launchd; ` +
+	`elif [ -d /etc/init.d ]; then echo init:sysvinit; fi`
+
+// initSystem describes how to query and control services with one init
+// system. Commands are format strings taking the shell-escaped service name.
+type initSystem struct {
+	name    string
+	command string
+	// active prints active when the service is running, and enabled prints
+	// enabled when it starts at boot
+	active  string
+	enabled string
+	start   string
+	stop    string
+	restart string
+	reload  string
+	enable  string
+	disable string
+}
+
+// initSystems are the supported init systems
+var initSystems = []*initSystem{
+	{
+		name:    "systemd",
+		command: "systemctl",
+		active:  "systemctl is-active %s",
+		enabled: "systemctl is-enabled %s",
+		start:   "systemctl start %s",
+		stop:    "systemctl stop %s",
+		restart: "systemctl restart %s",
+		reload:  "systemctl reload %s",
+		enable:  "systemctl enable %s",
+		disable: "systemctl disable %s",
+	},
+	{
+		name:    "openrc",
+		command: "rc-service",
+		active:  "rc-service %s status >/dev/null 2>&1 && echo active || echo inactive",
+		enabled: `rc-update show default 2>/dev/null | awk -v name=%s '$1 == name {found = 1} END {print found ? "enabled" : "disabled"}'`,
+		start:   "rc-service %s start",
+		stop:    "rc-service %s stop",
+		restart: "rc-service %s restart",
+		reload:  "rc-service %s reload",
+		enable:  "rc-update add %s default",
+		disable: "rc-update del %s default",
+	},
+	{
+		name:    "sysvinit",
+		command: "service",
+		active:  "service %s status >/dev/null 2>&1 && echo active || echo inactive",
+		// Debian links runlevels under /etc, Red Hat under /etc/rc.d
+		enabled: "ls /etc/rc[2-5].d/S??%[1]s /etc/rc.d/rc[2-5].d/S??%[1]s 2>/dev/null | grep -q . && echo enabled || echo disabled",
+		start:   "service %s start",
+		stop:    "service %s stop",
+		restart: "service %s restart",
+		reload:  "service %s reload",
+		enable:  "if command -v update-rc.d >/dev/null 2>&1; then update-rc.d %[1]s defaults && update-rc.d %[1]s enable; else chkconfig %[1]s on; fi",
+		disable: "if command -v update-rc.d >/dev/null 2>&1; then update-rc.d %[1]s disable; else chkconfig %[1]s off; fi",
+	},
+	{
+		// Services are labels of daemons in /Library/LaunchDaemons, run in
+		// the system domain
+		name:    "launchd",
+		command: "launchctl",
+		active:  "launchctl print system/%s 2>/dev/null | grep -q 'state = running' && echo active || echo inactive",
+		enabled: `[ -f /Library/LaunchDaemons/%[1]s.plist ] && ! launchctl print-disabled system 2>/dev/null | grep -F -q -e '"'%[1]s'" => disabled' -e '"'%[1]s'" => true' && echo enabled || echo disabled`,
+		start:   "launchctl bootstrap system /Library/LaunchDaemons/%[1]s.plist 2>/dev/null; launchctl kickstart system/%[1]s",
+		stop:    "launchctl bootout system/%s",
+		restart: "launchctl kickstart -k system/%s",
+		reload:  "launchctl kill HUP system/%s",
+		enable:  "launchctl enable system/%s",
+		disable: "launchctl disable system/%s",
+	},
+}
+
+// initSystemCommands returns the commands of the supported init systems,
+// as alternatives for provider capabilities
+func initSystemCommands() []string {
+	commands := make([]string, len(initSystems))
+	for i, system := range initSystems {
+		commands[i] = system.command
+	}
+	return commands
+}
+
+// initSystemNames returns the names of the supported init systems
+func initSystemNames() []string {
+	names := make([]string, len(initSystems))
+	for i, system := range initSystems {
+		names[i] = system.name
+	}
+	return names
+}
+
+// initSystemNamed returns the init system with the given name
+func initSystemNamed(name string) (*initSystem, error) {
+	for _, system := range initSystems {
+		if system.name == name {
+			return system, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown init system '%s', must be one of: %s", name, strings.Join(initSystemNames(), ", "))
+}
+
+// initSystemFor returns the init system the facts of a target found
+// running, or nil when there is none of the supported ones
+func initSystemFor(facts *types.TargetFacts) *initSystem {
+	if facts == nil {
+		return nil
+	}
+	system, err := initSystemNamed(facts.InitSystem)
+	if err != nil {
+		return nil
+	}
+	return system
+}
+
+// fill fills one of the init system's commands with a service name
+func (i *initSystem) fill(format, serviceName string) string {
+	return fmt.Sprintf(format, shellEscape(serviceName))
+}
+
+// initSystemUser is implemented by providers that control the target's
+// services
+type initSystemUser interface {
+	SetInitSystem(name string) error
+}
+
+// UseInitSystem tells the providers of a registry which init system the
+// target runs
+func UseInitSystem(registry *types.ProviderRegistry, name string) error {
+	for _, resourceType := range registry.Types() {
+		if provider, err := registry.Get(resourceType); err == nil {
+			if user, ok := provider.(initSystemUser); ok {
+				if err := user.SetInitSystem(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
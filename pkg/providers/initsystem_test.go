@@ -0,0 +1,98 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestServiceProvider_InitSystems(t *testing.T) {
+	tests := []struct {
+		probe      string
+		properties map[string]interface{}
+		want       []string
+		wantErr    string
+	}{
+		{
+			probe: "Linux\ndistro:alpine:\ninit:openrc\n",
+			want: []string{
+				"rc-service 'nginx' status >/dev/null 2>&1 && echo active || echo inactive",
+				`rc-update show default 2>/dev/null | awk -v name='nginx' '$1 == name {found = 1} END {print found ? "enabled" : "disabled"}'`,
+				"rc-service 'nginx' start",
+				"rc-update add 'nginx' default",
+			},
+		},
+		{
+			probe: "Linux\ndistro:devuan:debian\ninit:sysvinit\n",
+			want: []string{
+				"service 'nginx' status >/dev/null 2>&1 && echo active || echo inactive",
+				"ls /etc/rc[2-5].d/S??'nginx' /etc/rc.d/rc[2-5].d/S??'nginx' 2>/dev/null | grep -q . && echo enabled || echo disabled",
+				"service 'nginx' start",
+				"if command -v update-rc.d >/dev/null 2>&1; then update-rc.d 'nginx' defaults && update-rc.d 'nginx' enable; else chkconfig 'nginx' on; fi",
+			},
+		},
+		{
+			probe: "Darwin\ninit:launchd\n",
+			want: []string{
+				"launchctl print system/'nginx' 2>/dev/null | grep -q 'state = running' && echo active || echo inactive",
+				`[ -f /Library/LaunchDaemons/'nginx'.plist ] && ! launchctl print-disabled system 2>/dev/null | grep -F -q -e '"''nginx''" => disabled' -e '"''nginx''" => true' && echo enabled || echo disabled`,
+				"launchctl bootstrap system /Library/LaunchDaemons/'nginx'.plist 2>/dev/null; launchctl kickstart system/'nginx'",
+				"launchctl enable system/'nginx'",
+			},
+		},
+		{probe: "Linux\ndistro:alpine:\ninit:openrc\n", properties: map[string]interface{}{"masked": false}, wantErr: "service 'masked' requires systemd, target runs openrc"},
+		{probe: "Linux\n", wantErr: "no supported init system found"},
+	}
+	for _, tt := range tests {
+		conn := &probedConnection{probe: tt.probe}
+		provider := NewServiceProvider(conn)
+		resource := &types.Resource{Type: "service", Name: "nginx", State: types.StateRunning, Properties: map[string]interface{}{"enabled": true}}
+		for key, value := range tt.properties {
+			resource.Properties[key] = value
+		}
+
+		current, err := provider.Read(context.Background(), resource)
+		var diff *types.ResourceDiff
+		if err == nil {
+			diff, err = provider.Diff(context.Background(), resource, current)
+		}
+		if err == nil {
+			err = provider.Apply(context.Background(), resource, diff)
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: error = %v, want %q", tt.probe, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tt.probe, err)
+		}
+		if !reflect.DeepEqual(conn.commands, tt.want) {
+			t.Errorf("%q: commands = %q, want %q", tt.probe, conn.commands, tt.want)
+		}
+		if conn.probes != 1 {
+			t.Errorf("%q: probed %d times, want once", tt.probe, conn.probes)
+		}
+	}
+}
+
+func TestUseInitSystem(t *testing.T) {
+	registry, err := DefaultFactoryRegistry().NewRegistry(&MockSSHConnection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := UseInitSystem(registry, "upstart"); err == nil || !strings.Contains(err.Error(), "must be one of: systemd, openrc, sysvinit, launchd") {
+		t.Errorf("UseInitSystem(upstart) error = %v", err)
+	}
+	if err := UseInitSystem(registry, "openrc"); err != nil {
+		t.Fatalf("UseInitSystem(openrc) error = %v", err)
+	}
+	provider, _ := registry.Get("service")
+	if system := provider.(*ServiceProvider).system; system == nil || system.name != "openrc" {
+		t.Errorf("init system = %v, want openrc", system)
+	}
+}
@@ -0,0 +1,294 @@
+package providers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// OsqueryCommand is the osquery shell used to read a target's state
+const OsqueryCommand = "osqueryi"
+
+// osqueryQueries are the tables read from a target, by section
+var osqueryQueries = []struct {
+	section string
+	query   string
+}{
+	{"deb", "SELECT name, version FROM deb_packages WHERE status = 'install ok installed'"},
+	{"rpm", "SELECT name, version FROM rpm_packages"},
+	{"brew", "SELECT name, version FROM homebrew_packages"},
+	{"users", "SELECT username, uid, gid, directory, shell FROM users"},
+	{"ports", "SELECT DISTINCT l.port, l.protocol, l.address, p.name AS process FROM listening_ports l LEFT JOIN processes p USING (pid) WHERE l.port > 0"},
+}
+
+// packageSections are the package tables that must all be readable for the
+// snapshot to answer for packages, by OS family
+var packageSections = map[string][]string{
+	types.OSFamilyLinux:  {"deb", "rpm"},
+	types.OSFamilyDarwin: {"brew"},
+}
+
+// osqueryUser is a user's passwd entry as read by osquery
+type osqueryUser struct {
+	uid, gid    int
+	home, shell string
+}
+
+// Osquery is a snapshot of a target's installed packages, users and
+// listening ports, read through osquery in a single round trip instead of
+// a few commands per resource. Providers answer reads from it and fall back
+// to their own commands for anything it does not know, including entries
+// forgotten after a resource changed them. A nil snapshot knows nothing.
+type Osquery struct {
+	mu       sync.Mutex
+	packages map[string]string
+	users    map[string]osqueryUser
+	ports    []types.ListeningPort
+	// portsKnown is set when the listening ports could be read
+	portsKnown bool
+	// forgotten holds the packages and users changed since the snapshot,
+	// and "ports" once a service has changed
+	forgotten map[string]bool
+}
+
+// GatherOsquery reads a snapshot of the target with osqueryi. Tables that
+// cannot be read are left out of the snapshot.
+func GatherOsquery(ctx context.Context, connection ssh.Executor, osFamily string) (*Osquery, error) {
+	var script []string
+	for _, q := range osqueryQueries {
+		script = append(script, fmt.Sprintf("echo '@@%s'; %s --json %s 2>/dev/null || echo '@@failed'", q.section, OsqueryCommand, shellEscape(q.query)))
+	}
+	script = append(script, "true")
+
+	result, err := connection.Execute(ctx, strings.Join(script, "; "))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query osquery: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to query osquery: %s", strings.TrimSpace(result.Stderr))
+	}
+	return parseOsquery(result.Stdout, osFamily), nil
+}
+
+// parseOsquery parses the output of the osquery script
+func parseOsquery(output, osFamily string) *Osquery {
+	sections := make(map[string][]map[string]string)
+	var current string
+	var buffer strings.Builder
+	flush := func() {
+		if current == "" {
+			return
+		}
+		var rows []map[string]string
+		if err := json.Unmarshal([]byte(buffer.String()), &rows); err == nil {
+			sections[current] = rows
+		}
+		buffer.Reset()
+	}
+	for _, line := range strings.Split(output, "\n") {
+		if section, ok := strings.CutPrefix(line, "@@"); ok {
+			if section == "failed" {
+				buffer.Reset()
+				current = ""
+				continue
+			}
+			flush()
+			current = section
+			continue
+		}
+		buffer.WriteString(line)
+		buffer.WriteString("\n")
+	}
+	flush()
+
+	snapshot := &Osquery{forgotten: make(map[string]bool)}
+	if tables, ok := packageSections[osFamily]; ok {
+		packages := make(map[string]string)
+		for _, table := range tables {
+			rows, ok := sections[table]
+			if !ok {
+				packages = nil
+				break
+			}
+			for _, row := range rows {
+				packages[row["name"]] = row["version"]
+			}
+		}
+		snapshot.packages = packages
+	}
+
+	if rows, ok := sections["users"]; ok {
+		snapshot.users = make(map[string]osqueryUser, len(rows))
+		for _, row := range rows {
+			uid, _ := strconv.Atoi(row["uid"])
+			gid, _ := strconv.Atoi(row["gid"])
+			snapshot.users[row["username"]] = osqueryUser{uid: uid, gid: gid, home: row["directory"], shell: row["shell"]}
+		}
+	}
+
+	_, snapshot.portsKnown = sections["ports"]
+	for _, row := range sections["ports"] {
+		port, err := strconv.Atoi(row["port"])
+		if err != nil {
+			continue
+		}
+		snapshot.ports = append(snapshot.ports, types.ListeningPort{
+			Port:     port,
+			Protocol: socketProtocol(row["protocol"]),
+			Address:  row["address"],
+			Process:  row["process"],
+		})
+	}
+	sort.Slice(snapshot.ports, func(i, j int) bool {
+		a, b := snapshot.ports[i], snapshot.ports[j]
+		if a.Port != b.Port {
+			return a.Port < b.Port
+		}
+		if a.Protocol != b.Protocol {
+			return a.Protocol < b.Protocol
+		}
+		return a.Address < b.Address
+	})
+	return snapshot
+}
+
+// socketProtocol names an IP protocol number
+func socketProtocol(number string) string {
+	switch number {
+	case "6":
+		return "tcp"
+	case "17":
+		return "udp"
+	default:
+		return number
+	}
+}
+
+// Package reports whether a package is installed and its version. known is
+// false when the snapshot cannot answer.
+func (o *Osquery) Package(name string) (installed bool, version string, known bool) {
+	if o == nil {
+		return false, "", false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.packages == nil || o.forgotten["pkg:"+name] {
+		return false, "", false
+	}
+	version, installed = o.packages[name]
+	return installed, version, true
+}
+
+// User returns a user's uid, gid, home and shell, or nil if there is no
+// such user. known is false when the snapshot cannot answer.
+func (o *Osquery) User(name string) (info map[string]interface{}, known bool) {
+	if o == nil {
+		return nil, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.users == nil || o.forgotten["user:"+name] {
+		return nil, false
+	}
+	user, exists := o.users[name]
+	if !exists {
+		return nil, true
+	}
+	return map[string]interface{}{
+		"uid":   user.uid,
+		"gid":   user.gid,
+		"home":  user.home,
+		"shell": user.shell,
+	}, true
+}
+
+// ListeningPorts returns the sockets accepting connections when the snapshot was taken
+func (o *Osquery) ListeningPorts() []types.ListeningPort {
+	if o == nil {
+		return nil
+	}
+	return o.ports
+}
+
+// Listening reports whether a TCP socket accepts connections on a loopback
+// address and port, such as 127.0.0.1:8080. known is false when the
+// snapshot cannot answer, as for the addresses of other hosts.
+func (o *Osquery) Listening(address string, port int) (listening bool, known bool) {
+	if o == nil {
+		return false, false
+	}
+	var wildcard string
+	switch address {
+	case "127.0.0.1":
+		wildcard = "0.0.0.0"
+	case "::1":
+		wildcard = "::"
+	default:
+		return false, false
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if !o.portsKnown || o.forgotten["ports"] {
+		return false, false
+	}
+	for _, socket := range o.ports {
+		if socket.Port == port && socket.Protocol == "tcp" && (socket.Address == address || socket.Address == wildcard) {
+			return true, true
+		}
+	}
+	return false, true
+}
+
+// ForgetPackage stops answering for a package, once a resource has changed it
+func (o *Osquery) ForgetPackage(name string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.forgotten["pkg:"+name] = true
+}
+
+// ForgetPorts stops answering for listening ports, once a service has
+// been started, stopped or restarted
+func (o *Osquery) ForgetPorts() {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.forgotten["ports"] = true
+}
+
+// ForgetUser stops answering for a user, once a resource has changed it
+func (o *Osquery) ForgetUser(name string) {
+	if o == nil {
+		return
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.forgotten["user:"+name] = true
+}
+
+// osqueryReader is implemented by providers that answer reads from an osquery snapshot
+type osqueryReader interface {
+	SetOsquery(snapshot *Osquery)
+}
+
+// useOsquery gives the providers that can read from osquery the target's snapshot
+func useOsquery(registry *types.ProviderRegistry, snapshot *Osquery) {
+	for _, resourceType := range registry.Types() {
+		if provider, err := registry.Get(resourceType); err == nil {
+			if reader, ok := provider.(osqueryReader); ok {
+				reader.SetOsquery(snapshot)
+			}
+		}
+	}
+}
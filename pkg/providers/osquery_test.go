@@ -0,0 +1,153 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// fakeOsqueryi answers the osquery script's queries by table; homebrew is
+// missing as it is on Linux. Only packages fully installed are listed, not
+// those removed with their configuration left behind.
+const fakeOsqueryi = `#!/bin/sh
+case "$2" in
+*"deb_packages WHERE status = 'install ok installed'"*) echo '[{"name":"nginx","version":"1.18.0-6ubuntu14"},{"name":"curl","version":"7.81.0-1"}]' ;;
+*rpm_packages*) echo '[]' ;;
+*FROM\ users*) echo '[{"username":"deploy","uid":"1001","gid":"1001","directory":"/home/deploy","shell":"/bin/bash"}]' ;;
+*listening_ports*) echo '[{"port":"443","protocol":"6","address":"0.0.0.0","process":"nginx"},{"port":"22","protocol":"6","address":"0.0.0.0","process":"sshd"}]' ;;
+*) echo "Error: no such table" >&2; exit 1 ;;
+esac
+`
+
+func TestGatherOsquery(t *testing.T) {
+	bin := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bin, OsqueryCommand), []byte(fakeOsqueryi), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	snapshot, err := GatherOsquery(context.Background(), &ssh.LocalExecutor{}, types.OSFamilyLinux)
+	if err != nil {
+		t.Fatalf("GatherOsquery() error = %v", err)
+	}
+
+	if installed, version, known := snapshot.Package("nginx"); !known || !installed || version != "1.18.0-6ubuntu14" {
+		t.Errorf("Package(nginx) = %v, %q, %v", installed, version, known)
+	}
+	if installed, _, known := snapshot.Package("apache2"); !known || installed {
+		t.Errorf("Package(apache2) = %v, %v, want known and absent", installed, known)
+	}
+	info, known := snapshot.User("deploy")
+	if want := map[string]interface{}{"uid": 1001, "gid": 1001, "home": "/home/deploy", "shell": "/bin/bash"}; !known || !reflect.DeepEqual(info, want) {
+		t.Errorf("User(deploy) = %v, %v", info, known)
+	}
+	wantPorts := []types.ListeningPort{
+		{Port: 22, Protocol: "tcp", Address: "0.0.0.0", Process: "sshd"},
+		{Port: 443, Protocol: "tcp", Address: "0.0.0.0", Process: "nginx"},
+	}
+	if !reflect.DeepEqual(snapshot.ListeningPorts(), wantPorts) {
+		t.Errorf("ListeningPorts() = %+v", snapshot.ListeningPorts())
+	}
+
+	// Without homebrew_packages a macOS snapshot cannot answer for packages
+	darwin, err := GatherOsquery(context.Background(), &ssh.LocalExecutor{}, types.OSFamilyDarwin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, known := darwin.Package("nginx"); known {
+		t.Error("Package() known without the homebrew table")
+	}
+}
+
+func TestOsquery_ReadThrough(t *testing.T) {
+	snapshot := parseOsquery("@@deb\n[{\"name\":\"nginx\",\"version\":\"1.18.0\"}]\n@@rpm\n[]\n@@users\n@@failed\n", types.OSFamilyLinux)
+	conn := &recordingConnection{}
+	provider := NewPkgProvider(conn)
+	provider.SetOsquery(snapshot)
+	provider.SetPackageManager("apt")
+	resource := &types.Resource{Type: "pkg", Name: "nginx", State: types.StatePresent}
+
+	state, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["state"] != "present" || state["version"] != "1.18.0" || len(conn.commands) != 0 {
+		t.Errorf("Read() = %v after commands %q, want it answered from the snapshot", state, conn.commands)
+	}
+
+	// Once the package is changed its state is read from the target again
+	if err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionNoop}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := provider.Read(context.Background(), resource); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.commands) == 0 {
+		t.Error("Read() after Apply() ran no commands")
+	}
+
+	// The users table failed, so users are read with commands
+	users := NewUserProvider(conn)
+	users.SetOsquery(snapshot)
+	conn.commands = nil
+	if _, err := users.Read(context.Background(), &types.Resource{Type: "user", Name: "deploy"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.commands) == 0 {
+		t.Error("user Read() ran no commands without a users table")
+	}
+}
+
+func TestOsquery_Listening(t *testing.T) {
+	snapshot := parseOsquery("@@ports\n"+`[{"port":"8080","protocol":"6","address":"127.0.0.1"},{"port":"443","protocol":"6","address":"0.0.0.0"},{"port":"53","protocol":"17","address":"0.0.0.0"}]`+"\n", types.OSFamilyLinux)
+
+	tests := []struct {
+		address   string
+		port      int
+		listening bool
+		known     bool
+	}{
+		{address: "127.0.0.1", port: 8080, listening: true, known: true},
+		{address: "127.0.0.1", port: 443, listening: true, known: true},
+		{address: "::1", port: 8080, known: true},
+		{address: "127.0.0.1", port: 53, known: true},
+		{address: "db.internal", port: 5432},
+	}
+	for _, tt := range tests {
+		listening, known := snapshot.Listening(tt.address, tt.port)
+		if listening != tt.listening || known != tt.known {
+			t.Errorf("Listening(%s, %d) = %v, %v, want %v, %v", tt.address, tt.port, listening, known, tt.listening, tt.known)
+		}
+	}
+
+	// A wait_for on a local port is read from the snapshot, until a
+	// service changes
+	conn := &recordingConnection{}
+	waits := NewWaitForProvider(conn)
+	waits.SetOsquery(snapshot)
+	resource := &types.Resource{Type: "wait_for", Name: "app", Properties: map[string]interface{}{"port": 8080}}
+	state, err := waits.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["met"] != true || len(conn.commands) != 0 {
+		t.Errorf("Read() = %v after commands %q, want it answered from the snapshot", state, conn.commands)
+	}
+
+	services := NewServiceProvider(conn)
+	services.SetOsquery(snapshot)
+	if err := services.Apply(context.Background(), &types.Resource{Type: "service", Name: "app"}, &types.ResourceDiff{Action: types.ActionNoop}); err != nil {
+		t.Fatal(err)
+	}
+	if _, known := snapshot.Listening("127.0.0.1", 8080); known {
+		t.Error("Listening() known after a service changed")
+	}
+	if _, parsed := parseOsquery("@@ports\n@@failed\n", types.OSFamilyLinux).Listening("127.0.0.1", 22); parsed {
+		t.Error("Listening() known without a listening_ports table")
+	}
+}
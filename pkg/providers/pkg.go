@@ -2,10 +2,14 @@ package providers
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
-	"strconv"
+	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 
+	"github.com/ataiva-software/forge/pkg/artifact"
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"github.com/ataiva-software/forge/pkg/types"
 )
@@ -13,6 +17,14 @@ import (
 // PkgProvider manages package resources
 type PkgProvider struct {
 	connection ssh.Executor
+	artifacts  *artifact.Cache
+	workspace  *Workspace
+	osquery    *Osquery
+
+	// manager is the target's package manager, set from its facts or
+	// detected on first use
+	manager   *packageManager
+	managerMu sync.Mutex
 }
 
 // NewPkgProvider creates a new package provider
@@ -22,11 +34,48 @@ func NewPkgProvider(connection ssh.Executor) *PkgProvider {
 	}
 }
 
+// SetArtifactCache sets the cache that package files given by URL are downloaded through
+func (p *PkgProvider) SetArtifactCache(cache *artifact.Cache) {
+	p.artifacts = cache
+}
+
+// SetWorkspace sets the target workspace where scratch files are uploaded
+func (p *PkgProvider) SetWorkspace(workspace *Workspace) {
+	p.workspace = workspace
+}
+
+// SetOsquery sets the snapshot installed packages are read from where it can answer
+func (p *PkgProvider) SetOsquery(snapshot *Osquery) {
+	p.osquery = snapshot
+}
+
+// SetPackageManager sets the package manager the target uses, by name,
+// sparing the provider from probing for it
+func (p *PkgProvider) SetPackageManager(name string) error {
+	manager, err := packageManagerNamed(name)
+	if err != nil {
+		return err
+	}
+	p.managerMu.Lock()
+	defer p.managerMu.Unlock()
+	p.manager = manager
+	return nil
+}
+
 // Type returns the resource type this provider handles
 func (p *PkgProvider) Type() string {
 	return "pkg"
 }
 
+// Capabilities returns the targets this provider can manage
+func (p *PkgProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+		Commands:   []string{strings.Join(packageManagerCommands(), "|")},
+		Privileged: packageManagerPrograms(),
+	}
+}
+
 // Validate validates the package resource configuration
 func (p *PkgProvider) Validate(resource *types.Resource) error {
 	// Check state - can be in State field or Properties map
@@ -61,30 +110,86 @@ func (p *PkgProvider) Validate(resource *types.Resource) error {
 		}
 	}
 	
+	// Validate the packages the resource manages, listed or set when its
+	// name is an alias or group
+	if _, ok := resource.Properties["packages"]; ok {
+		packages, err := packageList(resource.Properties["packages"])
+		if err != nil {
+			return err
+		}
+		if _, ok := resource.Properties["version"]; ok && len(packages) > 1 {
+			return fmt.Errorf("package 'version' cannot pin a list of packages")
+		}
+	}
+	
+	// Validate hold if provided; packages are held at the installed version
+	if hold, ok := resource.Properties["hold"]; ok {
+		held, ok := hold.(bool)
+		if !ok {
+			return fmt.Errorf("package 'hold' must be a boolean")
+		}
+		if held && state != "present" {
+			return fmt.Errorf("package 'hold' requires state present, got '%s'", state)
+		}
+	}
+	
+	// Validate source if provided
+	if source, ok := resource.Properties["source"]; ok {
+		sourceStr, ok := source.(string)
+		if !ok || sourceStr == "" {
+			return fmt.Errorf("package 'source' must be a non-empty string")
+		}
+		if !strings.HasSuffix(sourceStr, ".deb") && !strings.HasSuffix(sourceStr, ".rpm") {
+			return fmt.Errorf("package 'source' must be a .deb or .rpm file, got '%s'", sourceStr)
+		}
+	}
+	
 	return nil
 }
 
-// Read reads the current state of the package
+// Read reads the current state of the package. A group of packages is
+// present when all of them are installed, or, when it is to be removed,
+// while any of them is.
 func (p *PkgProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
-	packageName := resource.Name
+	packageNames := resourcePackages(resource)
+	removing := resource.State == types.StateAbsent || resource.Properties["state"] == "absent"
 	
-	// Detect package manager and check if package is installed
-	isInstalled, version, err := p.isPackageInstalled(ctx, packageName)
-	if err != nil {
-		return nil, fmt.Errorf("failed to check package status: %w", err)
+	installed := 0
+	version := ""
+	for _, packageName := range packageNames {
+		// Detect package manager and check if package is installed
+		isInstalled, packageVersion, err := p.isPackageInstalled(ctx, packageName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check package status: %w", err)
+		}
+		if isInstalled {
+			installed++
+			version = packageVersion
+		}
 	}
 	
 	state := map[string]interface{}{}
 	
-	if isInstalled {
+	if installed == len(packageNames) || (removing && installed > 0) {
 		state["state"] = "present"
-		if version != "" {
+		if version != "" && len(packageNames) == 1 {
 			state["version"] = version
 		}
 	} else {
 		state["state"] = "absent"
 	}
 	
+	// Holds are only read for resources that manage them. Like presence, a
+	// hold counts once every package is held, or while any is when the
+	// packages are to be released.
+	if hold, ok := resource.Properties["hold"].(bool); ok && installed > 0 {
+		held, err := p.heldPackages(ctx, packageNames)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check package hold: %w", err)
+		}
+		state["hold"] = held == len(packageNames) || (!hold && held > 0)
+	}
+	
 	return state, nil
 }
 
@@ -105,14 +210,11 @@ func (p *PkgProvider) Diff(ctx context.Context, resource *types.Resource, curren
 	
 	currentState := current["state"].(string)
 	
-	if desiredState == currentState {
+	switch {
+	case desiredState == currentState:
 		diff.Action = types.ActionNoop
 		diff.Reason = "package already in desired state"
-		return diff, nil
-	}
-	
-	switch desiredState {
-	case "present", "latest":
+	case desiredState == "present" || desiredState == "latest":
 		if currentState == "absent" {
 			diff.Action = types.ActionCreate
 			diff.Reason = "package needs to be installed"
@@ -134,7 +236,7 @@ func (p *PkgProvider) Diff(ctx context.Context, resource *types.Resource, curren
 				diff.Reason = "package already installed"
 			}
 		}
-	case "absent":
+	case desiredState == "absent":
 		if currentState == "present" {
 			diff.Action = types.ActionDelete
 			diff.Reason = "package needs to be removed"
@@ -148,260 +250,342 @@ func (p *PkgProvider) Diff(ctx context.Context, resource *types.Resource, curren
 		}
 	}
 	
+	// Installed packages are held or released in place; new ones are held
+	// once installed
+	if hold, ok := resource.Properties["hold"].(bool); ok && currentState == "present" && desiredState != "absent" {
+		if held, _ := current["hold"].(bool); held != hold {
+			diff.Changes["hold"] = map[string]interface{}{
+				"from": held,
+				"to":   hold,
+			}
+			if diff.Action == types.ActionNoop {
+				diff.Action = types.ActionUpdate
+				diff.Reason = "package hold needs to change"
+			}
+		}
+	}
+	
 	return diff, nil
 }
 
-// Apply applies the changes to bring the package to desired state
+// Apply applies the changes to bring the package to desired state. Every
+// package of the resource is handled by one package manager invocation.
 func (p *PkgProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	packageNames := resourcePackages(resource)
+	defer func() {
+		for _, packageName := range packageNames {
+			p.osquery.ForgetPackage(packageName)
+		}
+	}()
+	// Held packages are released before they are upgraded
+	hold, _ := resource.Properties["hold"].(bool)
+	_, holdChanged := diff.Changes["hold"]
+	if holdChanged && !hold {
+		if err := p.setHold(ctx, packageNames, false); err != nil {
+			return err
+		}
+	}
+	
+	var err error
 	switch diff.Action {
 	case types.ActionCreate:
-		return p.installPackage(ctx, resource)
+		err = p.installPackages(ctx, resource, packageNames)
 	case types.ActionUpdate:
-		return p.updatePackage(ctx, resource)
+		if _, ok := diff.Changes["state"]; ok {
+			err = p.updatePackages(ctx, resource, packageNames)
+		}
 	case types.ActionDelete:
-		return p.removePackage(ctx, resource)
+		return p.removePackages(ctx, packageNames)
 	case types.ActionNoop:
 		return nil
 	default:
 		return fmt.Errorf("unsupported action: %s", diff.Action)
 	}
-}
-
-// isPackageInstalled checks if a package is installed and returns its version
-func (p *PkgProvider) isPackageInstalled(ctx context.Context, packageName string) (bool, string, error) {
-	// Try dpkg (Debian/Ubuntu) first
-	cmd := fmt.Sprintf("dpkg -l %s 2>/dev/null | grep '^ii' | wc -l", shellEscape(packageName))
-	result, err := p.connection.Execute(ctx, cmd)
 	if err != nil {
-		return false, "", err
+		return err
 	}
 	
-	if result.ExitCode == 0 {
-		count, err := strconv.Atoi(strings.TrimSpace(result.Stdout))
-		if err == nil {
-			if count > 0 {
-				// Get version
-				versionCmd := fmt.Sprintf("dpkg -l %s 2>/dev/null | grep '^ii' | awk '{print $3}'", shellEscape(packageName))
-				versionResult, err := p.connection.Execute(ctx, versionCmd)
-				if err == nil && versionResult.ExitCode == 0 {
-					version := strings.TrimSpace(versionResult.Stdout)
-					return true, version, nil
-				}
-				return true, "", nil
-			} else {
-				return false, "", nil
+	if hold && (holdChanged || diff.Action == types.ActionCreate) {
+		return p.setHold(ctx, packageNames, true)
+	}
+	return nil
+}
+
+// resourcePackages returns the packages a resource manages: those it lists
+// or its name resolved to as an alias or group, or the package of that name
+func resourcePackages(resource *types.Resource) []string {
+	if packages, err := packageList(resource.Properties["packages"]); err == nil && len(packages) > 0 {
+		return packages
+	}
+	return []string{resource.Name}
+}
+
+// packageList reads a list of package names
+func packageList(value interface{}) ([]string, error) {
+	var packages []string
+	switch list := value.(type) {
+	case nil:
+		return nil, nil
+	case []string:
+		packages = list
+	case []interface{}:
+		for _, item := range list {
+			name, ok := item.(string)
+			if !ok {
+				return nil, fmt.Errorf("package 'packages' must be a list of package names")
 			}
+			packages = append(packages, name)
 		}
+	default:
+		return nil, fmt.Errorf("package 'packages' must be a list of package names")
 	}
-	
-	// If dpkg fails, try rpm (RedHat/CentOS/Fedora)
-	cmd = fmt.Sprintf("rpm -q %s >/dev/null 2>&1 && echo 1 || echo 0", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	for _, name := range packages {
+		if strings.TrimSpace(name) == "" {
+			return nil, fmt.Errorf("package 'packages' cannot contain an empty name")
+		}
+	}
+	return packages, nil
+}
+
+// isPackageInstalled checks if a package is installed and returns its version
+func (p *PkgProvider) isPackageInstalled(ctx context.Context, packageName string) (bool, string, error) {
+	if installed, version, known := p.osquery.Package(packageName); known {
+		return installed, version, nil
+	}
+
+	manager, err := p.detectManager(ctx)
 	if err != nil {
 		return false, "", err
 	}
-	
-	if result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "1" {
-		// Get version
-		versionCmd := fmt.Sprintf("rpm -q --queryformat '%%{VERSION}' %s 2>/dev/null", shellEscape(packageName))
-		versionResult, err := p.connection.Execute(ctx, versionCmd)
-		if err == nil && versionResult.ExitCode == 0 {
-			version := strings.TrimSpace(versionResult.Stdout)
-			return true, version, nil
-		}
-		return true, "", nil
-	}
-	
-	// If rpm fails, try brew (macOS)
-	cmd = fmt.Sprintf("brew list %s >/dev/null 2>&1 && echo 1 || echo 0", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	result, err := p.connection.Execute(ctx, fmt.Sprintf(manager.query, shellEscape(packageName)))
 	if err != nil {
 		return false, "", err
 	}
-	
-	if result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "1" {
-		return true, "", nil
+	version := strings.TrimSpace(result.Stdout)
+	if result.ExitCode != 0 || version == "" {
+		return false, "", nil
 	}
-	
-	return false, "", nil
+	return true, version, nil
 }
 
-// installPackage installs a package
-func (p *PkgProvider) installPackage(ctx context.Context, resource *types.Resource) error {
-	packageName := resource.Name
-	version := ""
-	
-	if v, ok := resource.Properties["version"]; ok {
-		version = v.(string)
+// installPackages installs packages
+func (p *PkgProvider) installPackages(ctx context.Context, resource *types.Resource, packageNames []string) error {
+	if source, ok := resource.Properties["source"].(string); ok {
+		return p.installFromFile(ctx, packageNames[0], source)
 	}
-	
-	// Try different package managers
-	
-	// Try apt (Debian/Ubuntu)
-	var cmd string
-	if version != "" {
-		cmd = fmt.Sprintf("apt-get update && apt-get install -y %s=%s", shellEscape(packageName), shellEscape(version))
-	} else {
-		cmd = fmt.Sprintf("apt-get update && apt-get install -y %s", shellEscape(packageName))
+
+	manager, err := p.detectManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to install %s: %w", describePackages(packageNames), err)
 	}
-	
-	result, err := p.connection.Execute(ctx, cmd)
+	version, _ := resource.Properties["version"].(string)
+	cmd, err := manager.installCommand(packageNames, version)
 	if err != nil {
-		return fmt.Errorf("failed to install package %s: %w", packageName, err)
+		return fmt.Errorf("failed to install %s: %w", describePackages(packageNames), err)
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	return p.runManager(ctx, "install", packageNames, cmd)
+}
+
+// updatePackages updates packages to the latest version
+func (p *PkgProvider) updatePackages(ctx context.Context, resource *types.Resource, packageNames []string) error {
+	if source, ok := resource.Properties["source"].(string); ok {
+		return p.installFromFile(ctx, packageNames[0], source)
 	}
-	
-	// Try yum (RedHat/CentOS)
-	if version != "" {
-		cmd = fmt.Sprintf("yum install -y %s-%s", shellEscape(packageName), shellEscape(version))
-	} else {
-		cmd = fmt.Sprintf("yum install -y %s", shellEscape(packageName))
+
+	manager, err := p.detectManager(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", describePackages(packageNames), err)
 	}
-	
-	result, err = p.connection.Execute(ctx, cmd)
+	return p.runManager(ctx, "update", packageNames, manager.fill(manager.upgrade, packageNames))
+}
+
+// removePackages removes the packages that are installed; some package
+// managers fail to remove packages that are not
+func (p *PkgProvider) removePackages(ctx context.Context, packageNames []string) error {
+	manager, err := p.detectManager(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to install package %s: %w", packageName, err)
+		return fmt.Errorf("failed to remove %s: %w", describePackages(packageNames), err)
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	var installed []string
+	for _, packageName := range packageNames {
+		isInstalled, _, err := p.isPackageInstalled(ctx, packageName)
+		if err != nil {
+			return fmt.Errorf("failed to check package status: %w", err)
+		}
+		if isInstalled {
+			installed = append(installed, packageName)
+		}
 	}
-	
-	// Try dnf (Fedora)
-	if version != "" {
-		cmd = fmt.Sprintf("dnf install -y %s-%s", shellEscape(packageName), shellEscape(version))
-	} else {
-		cmd = fmt.Sprintf("dnf install -y %s", shellEscape(packageName))
+	if len(installed) == 0 {
+		return nil
 	}
-	
-	result, err = p.connection.Execute(ctx, cmd)
+	return p.runManager(ctx, "remove", installed, manager.fill(manager.remove, installed))
+}
+
+// heldPackages counts the packages held at their installed version
+func (p *PkgProvider) heldPackages(ctx context.Context, packageNames []string) (int, error) {
+	manager, err := p.detectManager(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to install package %s: %w", packageName, err)
+		return 0, err
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	if manager.held == "" {
+		return 0, nil
 	}
-	
-	// Try brew (macOS)
-	cmd = fmt.Sprintf("brew install %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	result, err := p.connection.Execute(ctx, manager.held)
 	if err != nil {
-		return fmt.Errorf("failed to install package %s: %w", packageName, err)
+		return 0, err
 	}
-	
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to install package %s: %s", packageName, result.Stderr)
+		return 0, fmt.Errorf("%s: %s", manager.held, strings.TrimSpace(result.Stderr))
 	}
-	
-	return nil
+	held := manager.parseHeld(result.Stdout)
+	count := 0
+	for _, packageName := range packageNames {
+		if held[packageName] {
+			count++
+		}
+	}
+	return count, nil
 }
 
-// updatePackage updates a package to the latest version
-func (p *PkgProvider) updatePackage(ctx context.Context, resource *types.Resource) error {
-	packageName := resource.Name
-	
-	// Try different package managers
-	
-	// Try apt (Debian/Ubuntu)
-	cmd := fmt.Sprintf("apt-get update && apt-get upgrade -y %s", shellEscape(packageName))
-	result, err := p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to update package %s: %w", packageName, err)
+// setHold holds packages at their installed version, or releases them
+func (p *PkgProvider) setHold(ctx context.Context, packageNames []string, hold bool) error {
+	action := "hold"
+	if !hold {
+		action = "release"
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
-	}
-	
-	// Try yum (RedHat/CentOS)
-	cmd = fmt.Sprintf("yum update -y %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	manager, err := p.detectManager(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to update package %s: %w", packageName, err)
-	}
-	
-	if result.ExitCode == 0 {
-		return nil
+		return fmt.Errorf("failed to %s %s: %w", action, describePackages(packageNames), err)
 	}
-	
-	// Try dnf (Fedora)
-	cmd = fmt.Sprintf("dnf upgrade -y %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	cmd, err := manager.holdCommand(packageNames, hold)
 	if err != nil {
-		return fmt.Errorf("failed to update package %s: %w", packageName, err)
+		return fmt.Errorf("failed to %s %s: %w", action, describePackages(packageNames), err)
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	return p.runManager(ctx, action, packageNames, cmd)
+}
+
+// describePackages names packages in errors
+func describePackages(packageNames []string) string {
+	if len(packageNames) == 1 {
+		return "package " + packageNames[0]
 	}
-	
-	// Try brew (macOS)
-	cmd = fmt.Sprintf("brew upgrade %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	return "packages " + strings.Join(packageNames, ", ")
+}
+
+// runManager runs a package manager command for packages
+func (p *PkgProvider) runManager(ctx context.Context, action string, packageNames []string, cmd string) error {
+	result, err := p.connection.Execute(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to update package %s: %w", packageName, err)
+		return fmt.Errorf("failed to %s %s: %w", action, describePackages(packageNames), err)
 	}
-	
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to update package %s: %s", packageName, result.Stderr)
+		return fmt.Errorf("failed to %s %s: %s", action, describePackages(packageNames), strings.TrimSpace(result.Stderr))
 	}
-	
 	return nil
 }
 
-// removePackage removes a package
-func (p *PkgProvider) removePackage(ctx context.Context, resource *types.Resource) error {
-	packageName := resource.Name
-	
-	// Try different package managers
-	
-	// Try apt (Debian/Ubuntu)
-	cmd := fmt.Sprintf("apt-get remove -y %s", shellEscape(packageName))
-	result, err := p.connection.Execute(ctx, cmd)
+// detectManager returns the target's package manager. Targets whose facts
+// did not name one are probed once, on first use.
+func (p *PkgProvider) detectManager(ctx context.Context) (*packageManager, error) {
+	p.managerMu.Lock()
+	defer p.managerMu.Unlock()
+	if p.manager != nil {
+		return p.manager, nil
+	}
+
+	facts, err := GatherFacts(ctx, p.connection, "", packageManagerCommands())
 	if err != nil {
-		return fmt.Errorf("failed to remove package %s: %w", packageName, err)
+		return nil, fmt.Errorf("failed to detect package manager: %w", err)
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	manager := packageManagerFor(facts)
+	if manager == nil {
+		return nil, fmt.Errorf("no supported package manager found, need one of: %s", strings.Join(packageManagerCommands(), ", "))
 	}
-	
-	// Try yum (RedHat/CentOS)
-	cmd = fmt.Sprintf("yum remove -y %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	p.manager = manager
+	return manager, nil
+}
+
+// installFromFile copies a package file to the target and installs it
+// without contacting any repository. Files given by URL are downloaded
+// once by the controller through the artifact cache.
+func (p *PkgProvider) installFromFile(ctx context.Context, packageName, source string) error {
+	resolved, err := p.artifacts.Resolve(ctx, source, "")
 	if err != nil {
-		return fmt.Errorf("failed to remove package %s: %w", packageName, err)
+		return fmt.Errorf("failed to resolve package file: %w", err)
 	}
-	
-	if result.ExitCode == 0 {
-		return nil
+	data, err := os.ReadFile(resolved.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read package file %s: %w", resolved.Path, err)
 	}
 	
-	// Try dnf (Fedora)
-	cmd = fmt.Sprintf("dnf remove -y %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	// Without the run's workspace the file goes to one of its own, in the
+	// target's temporary directory
+	workspace := p.workspace
+	if workspace == nil {
+		workspace = NewWorkspace(p.connection)
+		defer workspace.Remove(ctx)
+	}
+	remotePath, err := workspace.Path(ctx, filepath.Base(source))
 	if err != nil {
-		return fmt.Errorf("failed to remove package %s: %w", packageName, err)
+		return err
+	}
+	if err := uploadFile(ctx, p.connection, remotePath, data); err != nil {
+		return fmt.Errorf("failed to copy package %s to target: %w", packageName, err)
 	}
 	
-	if result.ExitCode == 0 {
-		return nil
+	install := fmt.Sprintf("rpm -Uvh --replacepkgs %s", shellEscape(remotePath))
+	if strings.HasSuffix(source, ".deb") {
+		install = fmt.Sprintf("dpkg -i %s", shellEscape(remotePath))
 	}
+	cmd := fmt.Sprintf("%s; status=$?; rm -f %s; exit $status", install, shellEscape(remotePath))
 	
-	// Try brew (macOS)
-	cmd = fmt.Sprintf("brew uninstall %s", shellEscape(packageName))
-	result, err = p.connection.Execute(ctx, cmd)
+	result, err := p.connection.Execute(ctx, cmd)
 	if err != nil {
-		return fmt.Errorf("failed to remove package %s: %w", packageName, err)
+		return fmt.Errorf("failed to install package %s: %w", packageName, err)
 	}
-	
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to remove package %s: %s", packageName, result.Stderr)
+		return fmt.Errorf("failed to install package %s from %s: %s", packageName, filepath.Base(source), result.Stderr)
 	}
 	
 	return nil
 }
+
+// uploadChunkSize is how much data uploadFile sends per command, so that
+// bandwidth limits can spread large files over time
+const uploadChunkSize = 1024 * 1024
+
+// uploadFile writes binary data to a path on the target. The data is sent
+// base64 encoded so it survives the heredoc, in chunks for large files.
+func uploadFile(ctx context.Context, connection ssh.Executor, path string, data []byte) error {
+	redirect := ">"
+	for {
+		chunk := data
+		if len(chunk) > uploadChunkSize {
+			chunk = chunk[:uploadChunkSize]
+		}
+		data = data[len(chunk):]
+
+		encoded := base64.StdEncoding.EncodeToString(chunk)
+		var lines []string
+		for len(encoded) > 76 {
+			lines = append(lines, encoded[:76])
+			encoded = encoded[76:]
+		}
+		lines = append(lines, encoded)
+		
+		cmd := fmt.Sprintf("base64 -d %s %s << 'CHISEL_EOF'\n%s\nCHISEL_EOF", redirect, shellEscape(path), strings.Join(lines, "\n"))
+		result, err := connection.Execute(ctx, cmd)
+		if err != nil {
+			return err
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to write %s: %s", path, result.Stderr)
+		}
+
+		if len(data) == 0 {
+			return nil
+		}
+		redirect = ">>"
+	}
+}
@@ -1,7 +1,13 @@
 package providers
 
 import (
+	"bytes"
 	"context"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/ataiva-software/forge/pkg/ssh"
@@ -64,6 +70,30 @@ func TestPkgProvider_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid package resource with source",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "nginx",
+				Properties: map[string]interface{}{
+					"state":  "present",
+					"source": "packages/nginx_1.18.0_amd64.deb",
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "source not a package file",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "nginx",
+				Properties: map[string]interface{}{
+					"state":  "present",
+					"source": "nginx.tar.gz",
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "state not string",
 			resource: types.Resource{
@@ -75,6 +105,56 @@ func TestPkgProvider_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "held list of packages",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "web",
+				Properties: map[string]interface{}{
+					"state":    "present",
+					"packages": []interface{}{"nginx", "certbot"},
+					"hold":     true,
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "version for a list of packages",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "web",
+				Properties: map[string]interface{}{
+					"state":    "present",
+					"packages": []interface{}{"nginx", "certbot"},
+					"version":  "1.18.0",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hold not boolean",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "nginx",
+				Properties: map[string]interface{}{
+					"state": "present",
+					"hold":  "yes",
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "hold while tracking latest",
+			resource: types.Resource{
+				Type: "pkg",
+				Name: "nginx",
+				Properties: map[string]interface{}{
+					"state": "latest",
+					"hold":  true,
+				},
+			},
+			wantErr: true,
+		},
 	}
 
 	for _, tt := range tests {
@@ -114,8 +194,8 @@ func TestPkgProvider_Read(t *testing.T) {
 					"state": "present",
 				},
 			},
-			mockCmd:  "dpkg -l 'nginx' 2>/dev/null | grep '^ii' | wc -l",
-			mockOut:  "1",
+			mockCmd:  `dpkg-query -W -f='${db:Status-Status} ${Version}\n' 'nginx' 2>/dev/null | awk '$1 == "installed" {print $2}'`,
+			mockOut:  "1.18.0",
 			mockExit: 0,
 			want: map[string]interface{}{
 				"state": "present",
@@ -131,8 +211,8 @@ func TestPkgProvider_Read(t *testing.T) {
 					"state": "present",
 				},
 			},
-			mockCmd:  "dpkg -l 'nonexistent' 2>/dev/null | grep '^ii' | wc -l",
-			mockOut:  "0",
+			mockCmd:  `dpkg-query -W -f='${db:Status-Status} ${Version}\n' 'nonexistent' 2>/dev/null | awk '$1 == "installed" {print $2}'`,
+			mockOut:  "",
 			mockExit: 0,
 			want: map[string]interface{}{
 				"state": "absent",
@@ -154,6 +234,7 @@ func TestPkgProvider_Read(t *testing.T) {
 			}
 			
 			provider := NewPkgProvider(mockConn)
+			provider.SetPackageManager("apt")
 			ctx := context.Background()
 			
 			got, err := provider.Read(ctx, &tt.resource)
@@ -325,6 +406,7 @@ func TestPkgProvider_Apply(t *testing.T) {
 			}
 			
 			provider := NewPkgProvider(mockConn)
+			provider.SetPackageManager("apt")
 			ctx := context.Background()
 			
 			err := provider.Apply(ctx, &tt.resource, tt.diff)
@@ -341,3 +423,116 @@ func TestPkgProvider_Apply(t *testing.T) {
 		})
 	}
 }
+
+func TestPkgProvider_ApplyFromSource(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "nginx_1.18.0_amd64.deb")
+	if err := os.WriteFile(source, []byte("!<arch>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		"mktemp -d " + workspaceTemplate: {Stdout: "/tmp/forge.q7x2\n"},
+	}}}
+	provider := NewPkgProvider(conn)
+	resource := &types.Resource{
+		Type: "pkg",
+		Name: "nginx",
+		Properties: map[string]interface{}{
+			"state":  "present",
+			"source": source,
+		},
+	}
+
+	if err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionCreate}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []string{
+		"mktemp -d " + workspaceTemplate,
+		"base64 -d > '/tmp/forge.q7x2/nginx_1.18.0_amd64.deb' << 'CHISEL_EOF'\nITxhcmNoPg==\nCHISEL_EOF",
+		"dpkg -i '/tmp/forge.q7x2/nginx_1.18.0_amd64.deb'; status=$?; rm -f '/tmp/forge.q7x2/nginx_1.18.0_amd64.deb'; exit $status",
+		"rm -rf '/tmp/forge.q7x2'",
+	}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("commands = %q, want %q", conn.commands, want)
+	}
+}
+
+func TestUploadFile_Chunks(t *testing.T) {
+	data := bytes.Repeat([]byte("x"), 2*uploadChunkSize+10)
+	conn := &recordingConnection{}
+
+	if err := uploadFile(context.Background(), conn, "/tmp/large.bin", data); err != nil {
+		t.Fatalf("uploadFile() error = %v", err)
+	}
+
+	wantPrefixes := []string{
+		"base64 -d > '/tmp/large.bin' << 'CHISEL_EOF'\n",
+		"base64 -d >> '/tmp/large.bin' << 'CHISEL_EOF'\n",
+		"base64 -d >> '/tmp/large.bin' << 'CHISEL_EOF'\n",
+	}
+	if len(conn.commands) != len(wantPrefixes) {
+		t.Fatalf("Expected %d commands, got %d", len(wantPrefixes), len(conn.commands))
+	}
+	var decoded []byte
+	for i, command := range conn.commands {
+		if !strings.HasPrefix(command, wantPrefixes[i]) {
+			t.Errorf("command %d = %.60q, want prefix %q", i, command, wantPrefixes[i])
+		}
+		body := strings.TrimSuffix(strings.TrimPrefix(command, wantPrefixes[i]), "\nCHISEL_EOF")
+		chunk, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(body, "\n", ""))
+		if err != nil {
+			t.Fatalf("command %d does not carry base64 data: %v", i, err)
+		}
+		decoded = append(decoded, chunk...)
+	}
+	if !bytes.Equal(decoded, data) {
+		t.Error("Expected the chunks to add up to the uploaded data")
+	}
+}
+
+func TestPkgProvider_ReadPackages(t *testing.T) {
+	snapshot := parseOsquery("@@deb\n[{\"name\":\"gcc\",\"version\":\"12.2\"},{\"name\":\"make\",\"version\":\"4.3\"}]\n@@rpm\n[]\n", types.OSFamilyLinux)
+	provider := NewPkgProvider(&recordingConnection{})
+	provider.SetOsquery(snapshot)
+
+	tests := []struct {
+		name     string
+		state    types.ResourceState
+		packages []interface{}
+		want     string
+	}{
+		{name: "all installed", state: types.StatePresent, packages: []interface{}{"gcc", "make"}, want: "present"},
+		{name: "some missing", state: types.StatePresent, packages: []interface{}{"gcc", "gcc-c++", "make"}, want: "absent"},
+		{name: "some left to remove", state: types.StateAbsent, packages: []interface{}{"gcc", "gcc-c++"}, want: "present"},
+		{name: "none left to remove", state: types.StateAbsent, packages: []interface{}{"gcc-c++"}, want: "absent"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{
+				Type:       "pkg",
+				Name:       "build-tools",
+				State:      tt.state,
+				Properties: map[string]interface{}{"packages": tt.packages},
+			}
+			if err := provider.Validate(resource); err != nil {
+				t.Fatalf("Validate() error = %v", err)
+			}
+			state, err := provider.Read(context.Background(), resource)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state["state"] != tt.want {
+				t.Errorf("Read() state = %v, want %s", state["state"], tt.want)
+			}
+			if _, ok := state["version"]; ok {
+				t.Errorf("Read() reported a version %v for a group", state["version"])
+			}
+		})
+	}
+
+	invalid := &types.Resource{Type: "pkg", Name: "tools", State: types.StatePresent, Properties: map[string]interface{}{"packages": []interface{}{"gcc", ""}}}
+	if err := provider.Validate(invalid); err == nil {
+		t.Error("Validate() accepted an empty package name")
+	}
+}
@@ -0,0 +1,273 @@
+package providers
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// DefaultPackageManager is assumed where there is no host to detect the
+// package manager on, such as plan previews and module tests
+const DefaultPackageManager = "apt"
+
+// packageManager describes how to query, install, upgrade, remove and hold
+// packages with one package manager. Commands are format strings taking
+// the shell-escaped package names and, for installVersion, the version.
+type packageManager struct {
+	name    string
+	command string
+	// families are the distribution or OS families the manager is native to,
+	// preferred over other managers found on the same host
+	families []string
+	// query prints the installed version of a package, and nothing or fails
+	// when it is not installed
+	query   string
+	install string
+	// installVersion is empty when the manager cannot pin versions
+	installVersion string
+	upgrade        string
+	remove         string
+	// held lists the held packages, which parseHeld reads; hold and unhold
+	// are empty when the manager cannot hold packages
+	held      string
+	parseHeld func(output string) map[string]bool
+	hold      string
+	unhold    string
+}
+
+// packageManagers are the supported package managers, in the order they
+// are picked when a host has several and none is native to it
+var packageManagers = []*packageManager{
+	{
+		name:           "apt",
+		command:        "apt-get",
+		families:       []string{types.DistroDebian},
+		query:          `dpkg-query -W -f='${db:Status-Status} ${Version}\n' %s 2>/dev/null | awk '$1 == "installed" {print $2}'`,
+		install:        "apt-get update && apt-get install -y %s",
+		installVersion: "apt-get update && apt-get install -y %s=%s",
+		upgrade:        "apt-get update && apt-get upgrade -y %s",
+		remove:         "apt-get remove -y %s",
+		held:           "apt-mark showhold",
+		parseHeld:      heldNames,
+		hold:           "apt-mark hold %s",
+		unhold:         "apt-mark unhold %s",
+	},
+	{
+		name:           "dnf",
+		command:        "dnf",
+		families:       []string{types.DistroRedHat},
+		query:          "rpm -q --queryformat '%%{VERSION}' %s 2>/dev/null",
+		install:        "dnf install -y %s",
+		installVersion: "dnf install -y %s-%s",
+		upgrade:        "dnf upgrade -y %s",
+		remove:         "dnf remove -y %s",
+		held:           "dnf versionlock list",
+		parseHeld:      versionlockNames,
+		hold:           "dnf versionlock add %s",
+		unhold:         "dnf versionlock delete %s",
+	},
+	{
+		name:           "yum",
+		command:        "yum",
+		families:       []string{types.DistroRedHat},
+		query:          "rpm -q --queryformat '%%{VERSION}' %s 2>/dev/null",
+		install:        "yum install -y %s",
+		installVersion: "yum install -y %s-%s",
+		upgrade:        "yum update -y %s",
+		remove:         "yum remove -y %s",
+		held:           "yum versionlock list",
+		parseHeld:      versionlockNames,
+		hold:           "yum versionlock add %s",
+		unhold:         "yum versionlock delete %s",
+	},
+	{
+		name:           "zypper",
+		command:        "zypper",
+		families:       []string{types.DistroSUSE},
+		query:          "rpm -q --queryformat '%%{VERSION}' %s 2>/dev/null",
+		install:        "zypper --non-interactive install %s",
+		installVersion: "zypper --non-interactive install --oldpackage %s=%s",
+		upgrade:        "zypper --non-interactive update %s",
+		remove:         "zypper --non-interactive remove %s",
+		held:           "zypper --non-interactive locks",
+		parseHeld:      zypperLockNames,
+		hold:           "zypper --non-interactive addlock %s",
+		unhold:         "zypper --non-interactive removelock %s",
+	},
+	{
+		name:           "apk",
+		command:        "apk",
+		families:       []string{types.DistroAlpine},
+		query:          "apk list --installed %[1]s 2>/dev/null | awk -v name=%[1]s 'NR == 1 {print substr($1, length(name) + 2)}'",
+		install:        "apk add %s",
+		installVersion: "apk add %s=%s",
+		upgrade:        "apk add --upgrade %s",
+		remove:         "apk del %s",
+	},
+	{
+		name:     "pacman",
+		command:  "pacman",
+		families: []string{types.DistroArch},
+		query:    "pacman -Q %s 2>/dev/null | awk '{print $2}'",
+		install:  "pacman -S --noconfirm --needed %s",
+		upgrade:  "pacman -Sy --noconfirm %s",
+		remove:   "pacman -R --noconfirm %s",
+	},
+	{
+		name:      "brew",
+		command:   "brew",
+		families:  []string{types.OSFamilyDarwin},
+		query:     "brew list --versions %s 2>/dev/null | awk '{print $2}'",
+		install:   "brew install %s",
+		upgrade:   "brew upgrade %s",
+		remove:    "brew uninstall %s",
+		held:      "brew list --pinned",
+		parseHeld: heldNames,
+		hold:      "brew pin %s",
+		unhold:    "brew unpin %s",
+	},
+}
+
+// packageManagerCommands returns the commands of the supported package
+// managers, as alternatives for provider capabilities
+func packageManagerCommands() []string {
+	commands := make([]string, len(packageManagers))
+	for i, manager := range packageManagers {
+		commands[i] = manager.command
+	}
+	return commands
+}
+
+// packageManagerNamed returns the package manager with the given name
+func packageManagerNamed(name string) (*packageManager, error) {
+	var names []string
+	for _, manager := range packageManagers {
+		if manager.name == name {
+			return manager, nil
+		}
+		names = append(names, manager.name)
+	}
+	return nil, fmt.Errorf("unknown package manager '%s', must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// packageManagerFor picks the package manager of a target from its facts:
+// the one native to its distribution when it has it, otherwise the first
+// one found. It returns nil when the target has none of them.
+func packageManagerFor(facts *types.TargetFacts) *packageManager {
+	if facts == nil {
+		return nil
+	}
+	for _, manager := range packageManagers {
+		for _, family := range manager.families {
+			if (family == facts.DistroFamily || family == facts.OSFamily) && facts.HasCommand(manager.command) {
+				return manager
+			}
+		}
+	}
+	for _, manager := range packageManagers {
+		if facts.HasCommand(manager.command) {
+			return manager
+		}
+	}
+	return nil
+}
+
+// installCommand returns the command installing packages, at a version
+// when one is given for a single package
+func (m *packageManager) installCommand(packageNames []string, version string) (string, error) {
+	if version == "" {
+		return m.fill(m.install, packageNames), nil
+	}
+	if m.installVersion == "" {
+		return "", fmt.Errorf("%s cannot install a specific version of %s", m.name, packageNames[0])
+	}
+	return fmt.Sprintf(m.installVersion, shellEscape(packageNames[0]), shellEscape(version)), nil
+}
+
+// holdCommand returns the command holding packages at their installed
+// version, or releasing them
+func (m *packageManager) holdCommand(packageNames []string, hold bool) (string, error) {
+	if m.hold == "" {
+		return "", fmt.Errorf("%s cannot hold packages", m.name)
+	}
+	if hold {
+		return m.fill(m.hold, packageNames), nil
+	}
+	return m.fill(m.unhold, packageNames), nil
+}
+
+// fill fills a command with the shell-escaped package names
+func (m *packageManager) fill(format string, packageNames []string) string {
+	quoted := make([]string, len(packageNames))
+	for i, name := range packageNames {
+		quoted[i] = shellEscape(name)
+	}
+	return fmt.Sprintf(format, strings.Join(quoted, " "))
+}
+
+// heldNames reads a list of held package names, one per line
+func heldNames(output string) map[string]bool {
+	held := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		if name := strings.TrimSpace(line); name != "" {
+			held[name] = true
+		}
+	}
+	return held
+}
+
+// versionlockNames reads the packages locked by the dnf and yum versionlock
+// plugin, listed as name-[epoch:]version-release.* with yum putting the
+// epoch first
+func versionlockNames(output string) map[string]bool {
+	held := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		line = strings.TrimSpace(line)
+		if epoch, rest, ok := strings.Cut(line, ":"); ok && epoch != "" && strings.Trim(epoch, "0123456789") == "" {
+			line = rest
+		}
+		parts := strings.Split(line, "-")
+		if len(parts) < 3 || strings.Contains(line, " ") {
+			continue
+		}
+		held[strings.Join(parts[:len(parts)-2], "-")] = true
+	}
+	return held
+}
+
+// zypperLockNames reads the package names from the table zypper locks prints
+func zypperLockNames(output string) map[string]bool {
+	held := make(map[string]bool)
+	for _, line := range strings.Split(output, "\n") {
+		// Rows start with the lock's number, after the header
+		fields := strings.Split(line, "|")
+		number := strings.TrimSpace(fields[0])
+		if len(fields) < 2 || number == "" || strings.Trim(number, "0123456789") != "" {
+			continue
+		}
+		held[strings.TrimSpace(fields[1])] = true
+	}
+	return held
+}
+
+// packageManagerUser is implemented by providers that run the target's
+// package manager
+type packageManagerUser interface {
+	SetPackageManager(name string) error
+}
+
+// UsePackageManager tells the providers of a registry which package manager
+// the target uses
+func UsePackageManager(registry *types.ProviderRegistry, name string) error {
+	for _, resourceType := range registry.Types() {
+		if provider, err := registry.Get(resourceType); err == nil {
+			if user, ok := provider.(packageManagerUser); ok {
+				if err := user.SetPackageManager(name); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestPackageManagerFor(t *testing.T) {
+	commands := func(names ...string) map[string]bool {
+		found := make(map[string]bool)
+		for _, name := range names {
+			found[name] = true
+		}
+		return found
+	}
+	tests := []struct {
+		name  string
+		facts *types.TargetFacts
+		want  string
+	}{
+		{name: "ubuntu", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroDebian, Commands: commands("apt-get")}, want: "apt"},
+		{name: "rocky with dnf and yum", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroRedHat, Commands: commands("yum", "dnf")}, want: "dnf"},
+		{name: "centos 7", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroRedHat, Commands: commands("yum")}, want: "yum"},
+		{name: "opensuse", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroSUSE, Commands: commands("zypper")}, want: "zypper"},
+		{name: "alpine", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroAlpine, Commands: commands("apk")}, want: "apk"},
+		{name: "arch with homebrew", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: types.DistroArch, Commands: commands("brew", "pacman")}, want: "pacman"},
+		{name: "macOS", facts: &types.TargetFacts{OSFamily: types.OSFamilyDarwin, Commands: commands("brew")}, want: "brew"},
+		{name: "unknown distribution", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, DistroFamily: "gentoo", Commands: commands("brew")}, want: "brew"},
+		{name: "none", facts: &types.TargetFacts{OSFamily: types.OSFamilyLinux, Commands: commands()}},
+		{name: "no facts"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ""
+			if manager := packageManagerFor(tt.facts); manager != nil {
+				got = manager.name
+			}
+			if got != tt.want {
+				t.Errorf("packageManagerFor() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+// probedConnection answers the facts probe and records the other commands
+type probedConnection struct {
+	recordingConnection
+	probe  string
+	probes int
+}
+
+func (c *probedConnection) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	if strings.HasPrefix(command, "uname -s") {
+		c.probes++
+		return &ssh.ExecuteResult{Command: command, Stdout: c.probe}, nil
+	}
+	return c.recordingConnection.Execute(ctx, command)
+}
+
+func TestPkgProvider_PackageManagers(t *testing.T) {
+	tests := []struct {
+		probe   string
+		version string
+		want    []string
+		wantErr string
+	}{
+		{
+			probe: "Linux\ndistro:opensuse-leap:suse opensuse\ncommand:zypper\n",
+			want: []string{
+				"rpm -q --queryformat '%{VERSION}' 'nginx' 2>/dev/null",
+				"zypper --non-interactive install 'nginx'",
+				"rpm -q --queryformat '%{VERSION}' 'nginx' 2>/dev/null",
+				"zypper --non-interactive remove 'nginx'",
+			},
+		},
+		{
+			probe:   "Linux\ndistro:alpine:\ncommand:apk\n",
+			version: "1.24.0-r6",
+			want: []string{
+				"apk list --installed 'nginx' 2>/dev/null | awk -v name='nginx' 'NR == 1 {print substr($1, length(name) + 2)}'",
+				"apk add 'nginx'='1.24.0-r6'",
+				"apk list --installed 'nginx' 2>/dev/null | awk -v name='nginx' 'NR == 1 {print substr($1, length(name) + 2)}'",
+				"apk del 'nginx'",
+			},
+		},
+		{
+			probe: "Linux\ndistro:arch:\ncommand:pacman\n",
+			want: []string{
+				"pacman -Q 'nginx' 2>/dev/null | awk '{print $2}'",
+				"pacman -S --noconfirm --needed 'nginx'",
+				"pacman -Q 'nginx' 2>/dev/null | awk '{print $2}'",
+				"pacman -R --noconfirm 'nginx'",
+			},
+		},
+		{probe: "Linux\ndistro:arch:\ncommand:pacman\n", version: "1.24.0-1", wantErr: "pacman cannot install a specific version of nginx"},
+		{probe: "Linux\ndistro:gentoo:\n", wantErr: "no supported package manager found"},
+	}
+	for _, tt := range tests {
+		conn := &probedConnection{probe: tt.probe}
+		provider := NewPkgProvider(conn)
+		resource := &types.Resource{Type: "pkg", Name: "nginx", State: types.StatePresent, Properties: map[string]interface{}{}}
+		if tt.version != "" {
+			resource.Properties["version"] = tt.version
+		}
+
+		_, err := provider.Read(context.Background(), resource)
+		if err == nil {
+			err = provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionCreate})
+		}
+		if err == nil {
+			// Only installed packages are removed
+			conn.responses = map[string]*ssh.ExecuteResult{conn.commands[0]: {Stdout: "1.24.0\n"}}
+			err = provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionDelete})
+		}
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: error = %v, want %q", tt.probe, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%q: %v", tt.probe, err)
+		}
+		if !reflect.DeepEqual(conn.commands, tt.want) {
+			t.Errorf("%q: commands = %q, want %q", tt.probe, conn.commands, tt.want)
+		}
+		if conn.probes != 1 {
+			t.Errorf("%q: probed %d times, want once", tt.probe, conn.probes)
+		}
+	}
+
+	// A manager named by the target's facts is used without probing
+	conn := &probedConnection{}
+	provider := NewPkgProvider(conn)
+	if err := provider.SetPackageManager("yum"); err != nil {
+		t.Fatal(err)
+	}
+	latest := &types.ResourceDiff{Action: types.ActionUpdate, Changes: map[string]interface{}{"state": map[string]interface{}{"from": "present", "to": "latest"}}}
+	if err := provider.Apply(context.Background(), &types.Resource{Type: "pkg", Name: "nginx"}, latest); err != nil {
+		t.Fatal(err)
+	}
+	if conn.probes != 0 || !reflect.DeepEqual(conn.commands, []string{"yum update -y 'nginx'"}) {
+		t.Errorf("probed %d times and ran %q", conn.probes, conn.commands)
+	}
+	if err := provider.SetPackageManager("emerge"); err == nil {
+		t.Error("SetPackageManager() accepted an unknown package manager")
+	}
+}
+
+func TestPkgProvider_Batched(t *testing.T) {
+	query := func(name string) string {
+		return `dpkg-query -W -f='${db:Status-Status} ${Version}\n' '` + name + `' 2>/dev/null | awk '$1 == "installed" {print $2}'`
+	}
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		query("nginx"):      {Stdout: "1.18.0\n"},
+		"apt-mark showhold": {Stdout: "nginx\n"},
+	}}}
+	provider := NewPkgProvider(conn)
+	provider.SetPackageManager("apt")
+	resource := &types.Resource{Type: "pkg", Name: "web", State: types.StatePresent, Properties: map[string]interface{}{
+		"packages": []interface{}{"nginx", "certbot"},
+		"hold":     true,
+	}}
+
+	state, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if state["state"] != "absent" || state["hold"] != false {
+		t.Errorf("Read() = %v, want absent and not all held", state)
+	}
+	diff, err := provider.Diff(context.Background(), resource, state)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.commands = nil
+	if err := provider.Apply(context.Background(), resource, diff); err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"apt-get update && apt-get install -y 'nginx' 'certbot'", "apt-mark hold 'nginx' 'certbot'"}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("install commands = %q, want %q", conn.commands, want)
+	}
+
+	// Installed packages are held or released without reinstalling them
+	tests := []struct {
+		hold bool
+		held string
+		want []string
+	}{
+		{hold: true, held: "nginx\n", want: []string{"apt-mark hold 'nginx' 'certbot'"}},
+		{hold: false, held: "certbot\n", want: []string{"apt-mark unhold 'nginx' 'certbot'"}},
+		{hold: true, held: "certbot\nnginx\n"},
+	}
+	conn.responses[query("certbot")] = &ssh.ExecuteResult{Stdout: "2.1.0\n"}
+	for _, tt := range tests {
+		resource.Properties["hold"] = tt.hold
+		conn.responses["apt-mark showhold"] = &ssh.ExecuteResult{Stdout: tt.held}
+		state, err := provider.Read(context.Background(), resource)
+		if err != nil {
+			t.Fatal(err)
+		}
+		diff, err := provider.Diff(context.Background(), resource, state)
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.commands = nil
+		if err := provider.Apply(context.Background(), resource, diff); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(conn.commands, tt.want) {
+			t.Errorf("hold %v with %q held: %s ran %q, want %q", tt.hold, tt.held, diff.Action, conn.commands, tt.want)
+		}
+	}
+
+	// Removing a list removes the packages still installed, in one command
+	delete(conn.responses, query("nginx"))
+	resource.State = types.StateAbsent
+	delete(resource.Properties, "hold")
+	conn.commands = nil
+	if err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionDelete}); err != nil {
+		t.Fatal(err)
+	}
+	if last := conn.commands[len(conn.commands)-1]; last != "apt-get remove -y 'certbot'" {
+		t.Errorf("remove ran %q", conn.commands)
+	}
+
+	// Package managers without holds say so
+	pacman := NewPkgProvider(&recordingConnection{})
+	pacman.SetPackageManager("pacman")
+	err = pacman.Apply(context.Background(), &types.Resource{Type: "pkg", Name: "nginx", Properties: map[string]interface{}{"hold": true}}, &types.ResourceDiff{Action: types.ActionCreate})
+	if err == nil || !strings.Contains(err.Error(), "pacman cannot hold packages") {
+		t.Errorf("hold with pacman = %v", err)
+	}
+}
+
+func TestParseHeld(t *testing.T) {
+	tests := []struct {
+		name   string
+		parse  func(string) map[string]bool
+		output string
+		want   []string
+	}{
+		{name: "apt", parse: heldNames, output: "nginx\nlibssl3\n", want: []string{"libssl3", "nginx"}},
+		{
+			name:   "dnf",
+			parse:  versionlockNames,
+			output: "Last metadata expiration check: 0:12:01 ago on Mon 01 Jan 2024.\nnginx-1:1.20.1-14.el9.*\npython3-pip-0:21.2.3-7.el9.*\n",
+			want:   []string{"nginx", "python3-pip"},
+		},
+		{name: "yum", parse: versionlockNames, output: "Loaded plugins: fastestmirror, versionlock\n0:nginx-1.20.1-10.el7.*\nversionlock list done\n", want: []string{"nginx"}},
+		{
+			name:   "zypper",
+			parse:  zypperLockNames,
+			output: "\n# | Name  | Type    | Repository\n--+-------+---------+-----------\n1 | nginx | package | (any)\n2 | vim   | package | (any)\n",
+			want:   []string{"nginx", "vim"},
+		},
+	}
+	for _, tt := range tests {
+		var got []string
+		for name := range tt.parse(tt.output) {
+			got = append(got, name)
+		}
+		sort.Strings(got)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: held = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
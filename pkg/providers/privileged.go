@@ -0,0 +1,99 @@
+package providers
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ataiva-software/forge/pkg/sudoers"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// PrivilegedAliases returns a sudoers alias for each provider of the
+// registry, listing the programs it runs as root. Given resources, only
+// their providers are included, and the programs of providers such as
+// shell that depend on the resource are added for each of them.
+func PrivilegedAliases(registry *types.ProviderRegistry, resources []types.Resource) ([]sudoers.Alias, error) {
+	resourceTypes := registry.Types()
+	if resources != nil {
+		seen := make(map[string]bool)
+		resourceTypes = nil
+		for _, resource := range resources {
+			if !seen[resource.Type] {
+				seen[resource.Type] = true
+				resourceTypes = append(resourceTypes, resource.Type)
+			}
+		}
+		sort.Strings(resourceTypes)
+	}
+
+	var aliases []sudoers.Alias
+	for _, resourceType := range resourceTypes {
+		provider, err := registry.Get(resourceType)
+		if err != nil {
+			return nil, err
+		}
+		programs := types.ProviderCapabilities(provider).Privileged
+		if lister, ok := provider.(types.PrivilegedProvider); ok {
+			for i := range resources {
+				if resources[i].Type != resourceType {
+					continue
+				}
+				found, err := lister.PrivilegedPrograms(&resources[i])
+				if err != nil {
+					return nil, fmt.Errorf("failed to list the programs of %s: %w", resources[i].ResourceID(), err)
+				}
+				programs = append(programs, found...)
+			}
+		}
+		aliases = append(aliases, sudoers.Alias{Name: sudoers.AliasName(resourceType), Programs: privileged(programs)})
+	}
+	return aliases, nil
+}
+
+// privileged returns the programs along with those the command templates
+// run, sorted, for the privileged programs of providers that pick their
+// commands from a table. Templates are parsed as they are, since the
+// shell-escaped arguments they take never name a program.
+func privileged(programs []string, templates ...string) []string {
+	seen := make(map[string]bool)
+	for _, program := range programs {
+		seen[program] = true
+	}
+	for _, template := range templates {
+		found, err := sudoers.Programs(template)
+		if err != nil {
+			continue
+		}
+		for _, program := range found {
+			seen[program] = true
+		}
+	}
+	all := make([]string, 0, len(seen))
+	for program := range seen {
+		all = append(all, program)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// packageManagerPrograms returns the programs the package managers change
+// packages with. Queries run unprivileged.
+func packageManagerPrograms() []string {
+	var templates []string
+	for _, manager := range packageManagers {
+		templates = append(templates, manager.install, manager.installVersion, manager.upgrade, manager.remove, manager.hold, manager.unhold)
+	}
+	// Packages from a source are installed with dpkg or rpm
+	return privileged([]string{"dpkg", "rm", "rpm", "tee"}, templates...)
+}
+
+// initSystemPrograms returns the programs the init systems control services
+// with. Status queries run unprivileged.
+func initSystemPrograms() []string {
+	var templates []string
+	for _, system := range initSystems {
+		templates = append(templates, system.start, system.stop, system.restart, system.reload, system.enable, system.disable)
+	}
+	// Unit files and config fingerprints are written as files
+	return privileged([]string{"cat", "mkdir", "systemctl", "tee"}, templates...)
+}
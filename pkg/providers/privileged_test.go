@@ -0,0 +1,71 @@
+package providers
+
+import (
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/sudoers"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// hasProgram reports whether an alias lists a program
+func hasProgram(alias sudoers.Alias, program string) bool {
+	for _, listed := range alias.Programs {
+		if listed == program {
+			return true
+		}
+	}
+	return false
+}
+
+func TestPrivilegedAliases(t *testing.T) {
+	registry, err := DefaultFactoryRegistry().NewRegistry(&MockSSHConnection{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := PrivilegedAliases(registry, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	byName := make(map[string]sudoers.Alias)
+	for _, alias := range aliases {
+		byName[alias.Name] = alias
+	}
+	for _, want := range []struct{ alias, program string }{
+		{"FORGE_FILE", "chown"},
+		{"FORGE_FILE_EDIT", "tee"},
+		{"FORGE_PKG", "apt-get"},
+		{"FORGE_PKG", "dnf"},
+		{"FORGE_SERVICE", "systemctl"},
+		{"FORGE_USER", "useradd"},
+	} {
+		if !hasProgram(byName[want.alias], want.program) {
+			t.Errorf("%s = %v, want %s in it", want.alias, byName[want.alias].Programs, want.program)
+		}
+	}
+	if programs := byName["FORGE_SHELL"].Programs; len(programs) != 0 {
+		t.Errorf("FORGE_SHELL without resources = %v, want none", programs)
+	}
+
+	resources := []types.Resource{
+		{Type: "shell", Name: "reload", Properties: map[string]interface{}{"command": "systemctl daemon-reload", "creates": "/etc/done"}},
+		{Type: "file_edit", Name: "motd", Properties: map[string]interface{}{"path": "/etc/motd", "line": "hi"}},
+	}
+	aliases, err = PrivilegedAliases(registry, resources)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(aliases) != 2 || aliases[0].Name != "FORGE_FILE_EDIT" || aliases[1].Name != "FORGE_SHELL" {
+		t.Fatalf("PrivilegedAliases() = %v, want file_edit and shell", aliases)
+	}
+	for _, program := range []string{"systemctl", "test"} {
+		if !hasProgram(aliases[1], program) {
+			t.Errorf("FORGE_SHELL = %v, want %s in it", aliases[1].Programs, program)
+		}
+	}
+
+	resources = []types.Resource{{Type: "shell", Name: "branch", Properties: map[string]interface{}{"command": "case $1 in a) rm /a ;; esac"}}}
+	if _, err := PrivilegedAliases(registry, resources); err == nil {
+		t.Error("expected an error for a command that cannot be listed")
+	}
+}
@@ -0,0 +1,452 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+const (
+	aptSourcesDir = "/etc/apt/sources.list.d"
+	aptKeyringDir = "/etc/apt/keyrings"
+	yumReposDir   = "/etc/yum.repos.d"
+	yumKeyDir     = "/etc/pki/rpm-gpg"
+)
+
+// repoNamePattern restricts repository names to characters safe in file names
+var repoNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// RepoProvider manages package repository definitions and their GPG keys
+type RepoProvider struct {
+	connection ssh.Executor
+}
+
+// NewRepoProvider creates a new repository provider
+func NewRepoProvider(connection ssh.Executor) *RepoProvider {
+	return &RepoProvider{
+		connection: connection,
+	}
+}
+
+// Type returns the resource type this provider handles
+func (p *RepoProvider) Type() string {
+	return "repo"
+}
+
+// Capabilities returns the targets this provider can manage
+func (p *RepoProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux},
+		Commands:   []string{"apt-get|yum"},
+		Privileged: []string{"apt-get", "cat", "curl", "mkdir", "rm", "rpm", "sha256sum", "tee", "yum"},
+	}
+}
+
+// Validate validates the repository resource configuration
+func (p *RepoProvider) Validate(resource *types.Resource) error {
+	if !repoNamePattern.MatchString(resource.Name) {
+		return fmt.Errorf("repo name '%s' may only contain letters, digits, '.', '_' and '-'", resource.Name)
+	}
+
+	switch repoState(resource) {
+	case types.StatePresent, types.StateAbsent:
+	default:
+		return fmt.Errorf("invalid repo state '%s', must be one of: present, absent", repoState(resource))
+	}
+
+	for _, key := range []string{"manager", "uri", "suite", "arch", "description", "key", "key_url"} {
+		if value, ok := resource.Properties[key]; ok {
+			if _, ok := value.(string); !ok {
+				return fmt.Errorf("repo '%s' must be a string", key)
+			}
+		}
+	}
+	for _, key := range []string{"enabled", "refresh"} {
+		if value, ok := resource.Properties[key]; ok {
+			if _, ok := value.(bool); !ok {
+				return fmt.Errorf("repo '%s' must be a boolean", key)
+			}
+		}
+	}
+
+	if repoType, ok := resource.Properties["manager"].(string); ok && repoType != "apt" && repoType != "yum" {
+		return fmt.Errorf("invalid repo manager '%s', must be one of: apt, yum", repoType)
+	}
+
+	if components, ok := resource.Properties["components"]; ok {
+		list, ok := components.([]interface{})
+		if !ok {
+			return fmt.Errorf("repo 'components' must be a list of strings")
+		}
+		for _, component := range list {
+			if _, ok := component.(string); !ok {
+				return fmt.Errorf("repo 'components' must be a list of strings")
+			}
+		}
+	}
+
+	_, hasKey := resource.Properties["key"]
+	_, hasKeyURL := resource.Properties["key_url"]
+	if hasKey && hasKeyURL {
+		return fmt.Errorf("repo cannot set both 'key' and 'key_url'")
+	}
+
+	if repoState(resource) == types.StateAbsent {
+		return nil
+	}
+
+	if uri, _ := resource.Properties["uri"].(string); uri == "" {
+		return fmt.Errorf("repo resource must have 'uri' property")
+	}
+	if repoType, _ := resource.Properties["manager"].(string); repoType == "apt" {
+		if suite, _ := resource.Properties["suite"].(string); suite == "" {
+			return fmt.Errorf("apt repo must have 'suite' property")
+		}
+	}
+
+	return nil
+}
+
+// Read reads the current repository definition and key
+func (p *RepoProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	repoType, err := p.repoType(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+
+	current := map[string]interface{}{
+		"manager": repoType,
+		"state":   types.StateAbsent,
+	}
+
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("cat %s", shellEscape(repoFilePath(resource, repoType))))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repo file: %w", err)
+	}
+	if result.ExitCode == 0 {
+		current["state"] = types.StatePresent
+		current["content"] = strings.TrimRight(result.Stdout, "\n")
+	}
+
+	if !repoHasKey(resource) {
+		return current, nil
+	}
+
+	cmd := fmt.Sprintf("sha256sum %s | cut -d' ' -f1", shellEscape(repoKeyPath(resource, repoType)))
+	result, err = p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read repo key: %w", err)
+	}
+	if checksum := strings.TrimSpace(result.Stdout); result.ExitCode == 0 && checksum != "" {
+		current["key_checksum"] = checksum
+	}
+
+	return current, nil
+}
+
+// Diff compares desired vs current state and returns the differences
+func (p *RepoProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff := &types.ResourceDiff{
+		ResourceID: resource.ResourceID(),
+		Changes:    make(map[string]interface{}),
+	}
+
+	currentState, _ := current["state"].(types.ResourceState)
+	if repoState(resource) == types.StateAbsent {
+		if currentState == types.StatePresent {
+			diff.Action = types.ActionDelete
+			diff.Reason = "repository should be absent but is configured"
+		} else {
+			diff.Action = types.ActionNoop
+			diff.Reason = "repository is already absent"
+		}
+		return diff, nil
+	}
+
+	repoType, _ := current["manager"].(string)
+	if suite, _ := resource.Properties["suite"].(string); repoType == "apt" && suite == "" {
+		return nil, fmt.Errorf("apt repo must have 'suite' property")
+	}
+	desiredContent := renderRepoFile(resource, repoType)
+
+	if currentState != types.StatePresent {
+		diff.Action = types.ActionCreate
+		diff.Reason = "repository is not configured"
+		diff.Changes["state"] = map[string]interface{}{
+			"from": types.StateAbsent,
+			"to":   types.StatePresent,
+		}
+		if repoHasKey(resource) {
+			diff.Changes["key"] = map[string]interface{}{"from": "absent", "to": repoKeyPath(resource, repoType)}
+		}
+		return diff, nil
+	}
+
+	if currentContent, _ := current["content"].(string); currentContent != desiredContent {
+		diff.Changes["content"] = map[string]interface{}{
+			"from": currentContent,
+			"to":   desiredContent,
+		}
+	}
+
+	if repoHasKey(resource) {
+		currentChecksum, hasKey := current["key_checksum"].(string)
+		switch {
+		case !hasKey:
+			diff.Changes["key"] = map[string]interface{}{"from": "absent", "to": repoKeyPath(resource, repoType)}
+		case resource.Properties["key"] != nil && currentChecksum != repoKeyChecksum(resource):
+			diff.Changes["key"] = map[string]interface{}{"from": currentChecksum, "to": repoKeyChecksum(resource)}
+		}
+	}
+
+	if len(diff.Changes) == 0 {
+		diff.Action = types.ActionNoop
+		diff.Reason = "repository already configured"
+		return diff, nil
+	}
+
+	diff.Action = types.ActionUpdate
+	diff.Reason = "repository configuration differs"
+	return diff, nil
+}
+
+// Apply writes or removes the repository definition and key, then refreshes the package cache
+func (p *RepoProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	if diff.Action == types.ActionNoop {
+		return nil
+	}
+
+	repoType, err := p.repoType(ctx, resource)
+	if err != nil {
+		return err
+	}
+
+	switch diff.Action {
+	case types.ActionCreate, types.ActionUpdate:
+		if _, ok := diff.Changes["key"]; ok {
+			if err := p.installKey(ctx, resource, repoType); err != nil {
+				return err
+			}
+		}
+		_, stateChanged := diff.Changes["state"]
+		_, contentChanged := diff.Changes["content"]
+		if stateChanged || contentChanged {
+			if err := p.writeRepoFile(ctx, resource, repoType); err != nil {
+				return err
+			}
+		}
+	case types.ActionDelete:
+		if err := p.removeRepo(ctx, resource, repoType); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported action: %s", diff.Action)
+	}
+
+	if refresh, ok := resource.Properties["refresh"].(bool); ok && !refresh {
+		return nil
+	}
+	return p.refreshCache(ctx, repoType)
+}
+
+// repoType returns the configured package manager, or detects it from the target
+func (p *RepoProvider) repoType(ctx context.Context, resource *types.Resource) (string, error) {
+	if repoType, ok := resource.Properties["manager"].(string); ok && repoType != "" {
+		return repoType, nil
+	}
+
+	result, err := p.connection.Execute(ctx, "command -v apt-get >/dev/null 2>&1 && echo apt || echo yum")
+	if err != nil {
+		return "", fmt.Errorf("failed to detect package manager: %w", err)
+	}
+	if strings.TrimSpace(result.Stdout) == "apt" {
+		return "apt", nil
+	}
+	return "yum", nil
+}
+
+// installKey fetches or writes the repository GPG key
+func (p *RepoProvider) installKey(ctx context.Context, resource *types.Resource, repoType string) error {
+	keyPath := repoKeyPath(resource, repoType)
+
+	var cmd string
+	if keyURL, ok := resource.Properties["key_url"].(string); ok {
+		cmd = fmt.Sprintf("mkdir -p %s && curl -fsSL %s -o %s",
+			shellEscape(path.Dir(keyPath)), shellEscape(keyURL), shellEscape(keyPath))
+	} else {
+		key := strings.TrimRight(resource.Properties["key"].(string), "\n")
+		cmd = fmt.Sprintf("mkdir -p %s && cat > %s << 'CHISEL_EOF'\n%s\nCHISEL_EOF",
+			shellEscape(path.Dir(keyPath)), shellEscape(keyPath), key)
+	}
+	if repoType == "yum" {
+		cmd += fmt.Sprintf(" && rpm --import %s", shellEscape(keyPath))
+	}
+
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to install repo key %s: %w", keyPath, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to install repo key %s: %s", keyPath, result.Stderr)
+	}
+	return nil
+}
+
+// writeRepoFile writes the repository definition
+func (p *RepoProvider) writeRepoFile(ctx context.Context, resource *types.Resource, repoType string) error {
+	filePath := repoFilePath(resource, repoType)
+
+	cmd := fmt.Sprintf("cat > %s << 'CHISEL_EOF'\n%s\nCHISEL_EOF", shellEscape(filePath), renderRepoFile(resource, repoType))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to write repo file %s: %w", filePath, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to write repo file %s: %s", filePath, result.Stderr)
+	}
+	return nil
+}
+
+// removeRepo removes the repository definition and its key
+func (p *RepoProvider) removeRepo(ctx context.Context, resource *types.Resource, repoType string) error {
+	cmd := fmt.Sprintf("rm -f %s %s",
+		shellEscape(repoFilePath(resource, repoType)), shellEscape(repoKeyPath(resource, repoType)))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to remove repo %s: %w", resource.Name, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to remove repo %s: %s", resource.Name, result.Stderr)
+	}
+	return nil
+}
+
+// refreshCache refreshes the package manager metadata after a repository change
+func (p *RepoProvider) refreshCache(ctx context.Context, repoType string) error {
+	cmd := "apt-get update"
+	if repoType == "yum" {
+		cmd = "yum makecache -y"
+	}
+
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to refresh package cache: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to refresh package cache: %s", result.Stderr)
+	}
+	return nil
+}
+
+// repoState returns the desired state of a repository, defaulting to present
+func repoState(resource *types.Resource) types.ResourceState {
+	if resource.State != "" {
+		return resource.State
+	}
+	if state, ok := resource.Properties["state"].(string); ok {
+		return types.ResourceState(state)
+	}
+	return types.StatePresent
+}
+
+// repoHasKey reports whether the resource manages a GPG key
+func repoHasKey(resource *types.Resource) bool {
+	_, hasKey := resource.Properties["key"]
+	_, hasKeyURL := resource.Properties["key_url"]
+	return hasKey || hasKeyURL
+}
+
+// repoKeyChecksum returns the sha256 of an inline key as written to disk
+func repoKeyChecksum(resource *types.Resource) string {
+	key, _ := resource.Properties["key"].(string)
+	sum := sha256.Sum256([]byte(strings.TrimRight(key, "\n") + "\n"))
+	return hex.EncodeToString(sum[:])
+}
+
+// repoFilePath returns where the repository definition is written
+func repoFilePath(resource *types.Resource, repoType string) string {
+	if repoType == "apt" {
+		return path.Join(aptSourcesDir, resource.Name+".list")
+	}
+	return path.Join(yumReposDir, resource.Name+".repo")
+}
+
+// repoKeyPath returns where the repository GPG key is written
+func repoKeyPath(resource *types.Resource, repoType string) string {
+	if repoType == "apt" {
+		return path.Join(aptKeyringDir, resource.Name+".asc")
+	}
+	return path.Join(yumKeyDir, "RPM-GPG-KEY-"+resource.Name)
+}
+
+// renderRepoFile renders the repository definition for the package manager
+func renderRepoFile(resource *types.Resource, repoType string) string {
+	uri, _ := resource.Properties["uri"].(string)
+
+	enabled := true
+	if value, ok := resource.Properties["enabled"].(bool); ok {
+		enabled = value
+	}
+
+	if repoType == "apt" {
+		suite, _ := resource.Properties["suite"].(string)
+		components := []string{"main"}
+		if list, ok := resource.Properties["components"].([]interface{}); ok && len(list) > 0 {
+			components = components[:0]
+			for _, component := range list {
+				components = append(components, component.(string))
+			}
+		}
+
+		var options []string
+		if arch, ok := resource.Properties["arch"].(string); ok && arch != "" {
+			options = append(options, "arch="+arch)
+		}
+		if repoHasKey(resource) {
+			options = append(options, "signed-by="+repoKeyPath(resource, repoType))
+		}
+
+		line := "deb "
+		if len(options) > 0 {
+			line += "[" + strings.Join(options, " ") + "] "
+		}
+		line += fmt.Sprintf("%s %s %s", uri, suite, strings.Join(components, " "))
+		if !enabled {
+			line = "# " + line
+		}
+		return line
+	}
+
+	description := resource.Name
+	if value, ok := resource.Properties["description"].(string); ok && value != "" {
+		description = value
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s]\n", resource.Name)
+	fmt.Fprintf(&b, "name=%s\n", description)
+	fmt.Fprintf(&b, "baseurl=%s\n", uri)
+	fmt.Fprintf(&b, "enabled=%d\n", boolToInt(enabled))
+	if repoHasKey(resource) {
+		fmt.Fprintf(&b, "gpgcheck=1\n")
+		fmt.Fprintf(&b, "gpgkey=file://%s", repoKeyPath(resource, repoType))
+	} else {
+		fmt.Fprintf(&b, "gpgcheck=0")
+	}
+	return b.String()
+}
+
+// boolToInt converts a boolean to the 0/1 form used in ini style files
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
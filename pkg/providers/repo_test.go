@@ -0,0 +1,225 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestRepoProvider_Validate(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoName   string
+		properties map[string]interface{}
+		wantErr    bool
+	}{
+		{name: "apt repo", repoName: "docker", properties: map[string]interface{}{"manager": "apt", "uri": "https://download.docker.com/linux/ubuntu", "suite": "jammy"}},
+		{name: "yum repo", repoName: "docker", properties: map[string]interface{}{"manager": "yum", "uri": "https://download.docker.com/linux/centos/9/x86_64/stable", "key_url": "https://download.docker.com/linux/centos/gpg"}},
+		{name: "absent needs no uri", repoName: "docker", properties: map[string]interface{}{"state": "absent"}},
+		{name: "unsafe name", repoName: "../docker", properties: map[string]interface{}{"uri": "https://example.com"}, wantErr: true},
+		{name: "missing uri", repoName: "docker", properties: map[string]interface{}{"manager": "yum"}, wantErr: true},
+		{name: "apt without suite", repoName: "docker", properties: map[string]interface{}{"manager": "apt", "uri": "https://example.com"}, wantErr: true},
+		{name: "unknown manager", repoName: "docker", properties: map[string]interface{}{"manager": "zypper", "uri": "https://example.com"}, wantErr: true},
+		{name: "key and key url", repoName: "docker", properties: map[string]interface{}{"uri": "https://example.com", "key": "k", "key_url": "https://example.com/k"}, wantErr: true},
+		{name: "components not a list", repoName: "docker", properties: map[string]interface{}{"uri": "https://example.com", "components": "main"}, wantErr: true},
+		{name: "enabled not boolean", repoName: "docker", properties: map[string]interface{}{"uri": "https://example.com", "enabled": "yes"}, wantErr: true},
+		{name: "invalid state", repoName: "docker", properties: map[string]interface{}{"uri": "https://example.com", "state": "running"}, wantErr: true},
+	}
+
+	provider := NewRepoProvider(&MockSSHConnection{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "repo", Name: tt.repoName, Properties: tt.properties}
+			err := provider.Validate(resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestRenderRepoFile(t *testing.T) {
+	tests := []struct {
+		name       string
+		repoType   string
+		properties map[string]interface{}
+		want       string
+	}{
+		{
+			name:       "apt default component",
+			repoType:   "apt",
+			properties: map[string]interface{}{"uri": "https://apt.example.com", "suite": "jammy"},
+			want:       "deb https://apt.example.com jammy main",
+		},
+		{
+			name:     "apt with key and arch",
+			repoType: "apt",
+			properties: map[string]interface{}{
+				"uri": "https://apt.example.com", "suite": "jammy", "arch": "amd64",
+				"components": []interface{}{"main", "contrib"}, "key_url": "https://apt.example.com/key",
+			},
+			want: "deb [arch=amd64 signed-by=/etc/apt/keyrings/example.asc] https://apt.example.com jammy main contrib",
+		},
+		{
+			name:       "apt disabled",
+			repoType:   "apt",
+			properties: map[string]interface{}{"uri": "https://apt.example.com", "suite": "jammy", "enabled": false},
+			want:       "# deb https://apt.example.com jammy main",
+		},
+		{
+			name:       "yum with key",
+			repoType:   "yum",
+			properties: map[string]interface{}{"uri": "https://yum.example.com/el9", "description": "Example", "key": "KEY"},
+			want:       "[example]\nname=Example\nbaseurl=https://yum.example.com/el9\nenabled=1\ngpgcheck=1\ngpgkey=file:///etc/pki/rpm-gpg/RPM-GPG-KEY-example",
+		},
+		{
+			name:       "yum without key",
+			repoType:   "yum",
+			properties: map[string]interface{}{"uri": "https://yum.example.com/el9"},
+			want:       "[example]\nname=example\nbaseurl=https://yum.example.com/el9\nenabled=1\ngpgcheck=0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "repo", Name: "example", Properties: tt.properties}
+			if got := renderRepoFile(resource, tt.repoType); got != tt.want {
+				t.Errorf("renderRepoFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRepoProvider_ReadAndDiff(t *testing.T) {
+	resource := &types.Resource{
+		Type: "repo",
+		Name: "example",
+		Properties: map[string]interface{}{
+			"manager": "apt",
+			"uri":     "https://apt.example.com",
+			"suite":   "jammy",
+			"key":     "KEY",
+		},
+	}
+	content := renderRepoFile(resource, "apt")
+
+	tests := []struct {
+		name        string
+		responses   map[string]*ssh.ExecuteResult
+		wantAction  types.DiffAction
+		wantChanges []string
+	}{
+		{
+			name:        "not configured",
+			responses:   map[string]*ssh.ExecuteResult{},
+			wantAction:  types.ActionCreate,
+			wantChanges: []string{"key", "state"},
+		},
+		{
+			name: "up to date",
+			responses: map[string]*ssh.ExecuteResult{
+				"cat '/etc/apt/sources.list.d/example.list'":                {Stdout: content + "\n"},
+				"sha256sum '/etc/apt/keyrings/example.asc' | cut -d' ' -f1": {Stdout: repoKeyChecksum(resource) + "\n"},
+			},
+			wantAction: types.ActionNoop,
+		},
+		{
+			name: "content and key drifted",
+			responses: map[string]*ssh.ExecuteResult{
+				"cat '/etc/apt/sources.list.d/example.list'":                {Stdout: "deb https://old.example.com jammy main\n"},
+				"sha256sum '/etc/apt/keyrings/example.asc' | cut -d' ' -f1": {Stdout: "deadbeef\n"},
+			},
+			wantAction:  types.ActionUpdate,
+			wantChanges: []string{"content", "key"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := NewRepoProvider(&MockSSHConnection{responses: tt.responses})
+			ctx := context.Background()
+
+			current, err := provider.Read(ctx, resource)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			diff, err := provider.Diff(ctx, resource, current)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+
+			if diff.Action != tt.wantAction {
+				t.Errorf("Diff() action = %s, want %s", diff.Action, tt.wantAction)
+			}
+			if got := diff.ChangedKeys(); strings.Join(got, ",") != strings.Join(tt.wantChanges, ",") {
+				t.Errorf("Diff() changes = %v, want %v", got, tt.wantChanges)
+			}
+		})
+	}
+}
+
+func TestRepoProvider_Apply(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		diff       *types.ResourceDiff
+		want       []string
+	}{
+		{
+			name:       "create yum repo with key",
+			properties: map[string]interface{}{"manager": "yum", "uri": "https://yum.example.com", "key_url": "https://yum.example.com/key"},
+			diff: &types.ResourceDiff{Action: types.ActionCreate, Changes: map[string]interface{}{
+				"state": map[string]interface{}{"from": "absent", "to": "present"},
+				"key":   map[string]interface{}{"from": "absent", "to": "/etc/pki/rpm-gpg/RPM-GPG-KEY-example"},
+			}},
+			want: []string{
+				"mkdir -p '/etc/pki/rpm-gpg' && curl -fsSL 'https://yum.example.com/key' -o '/etc/pki/rpm-gpg/RPM-GPG-KEY-example' && rpm --import",
+				"cat > '/etc/yum.repos.d/example.repo'",
+				"yum makecache -y",
+			},
+		},
+		{
+			name:       "update apt key only without refresh",
+			properties: map[string]interface{}{"manager": "apt", "uri": "https://apt.example.com", "suite": "jammy", "key": "KEY", "refresh": false},
+			diff: &types.ResourceDiff{Action: types.ActionUpdate, Changes: map[string]interface{}{
+				"key": map[string]interface{}{"from": "deadbeef", "to": "cafe"},
+			}},
+			want: []string{
+				"mkdir -p '/etc/apt/keyrings' && cat > '/etc/apt/keyrings/example.asc'",
+			},
+		},
+		{
+			name:       "remove apt repo",
+			properties: map[string]interface{}{"manager": "apt", "state": "absent"},
+			diff:       &types.ResourceDiff{Action: types.ActionDelete},
+			want: []string{
+				"rm -f '/etc/apt/sources.list.d/example.list' '/etc/apt/keyrings/example.asc'",
+				"apt-get update",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn := &recordingConnection{}
+			provider := NewRepoProvider(conn)
+			resource := &types.Resource{Type: "repo", Name: "example", Properties: tt.properties}
+
+			if err := provider.Apply(context.Background(), resource, tt.diff); err != nil {
+				t.Fatalf("Apply() error = %v", err)
+			}
+
+			if len(conn.commands) != len(tt.want) {
+				t.Fatalf("Expected %d commands, got %v", len(tt.want), conn.commands)
+			}
+			for i, prefix := range tt.want {
+				if !strings.HasPrefix(conn.commands[i], prefix) {
+					t.Errorf("command[%d] = %q, want prefix %q", i, conn.commands[i], prefix)
+				}
+			}
+		})
+	}
+}
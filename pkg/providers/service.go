@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"time"
 
+	"github.com/ataiva-software/forge/pkg/clock"
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"github.com/ataiva-software/forge/pkg/types"
 )
@@ -12,20 +15,57 @@ import (
 // ServiceProvider manages service resources
 type ServiceProvider struct {
 	connection ssh.Executor
+	sleep      func(ctx context.Context, d time.Duration) error
+	// osquery's listening ports are forgotten once a service changes
+	osquery *Osquery
+	
+	// system is the target's init system, set from its facts or detected
+	// on first use
+	system   *initSystem
+	systemMu sync.Mutex
 }
 
 // NewServiceProvider creates a new service provider
 func NewServiceProvider(connection ssh.Executor) *ServiceProvider {
 	return &ServiceProvider{
 		connection: connection,
+		sleep:      clock.Sleep,
 	}
 }
 
+// SetOsquery sets the snapshot whose listening ports changing a service
+// makes stale
+func (p *ServiceProvider) SetOsquery(snapshot *Osquery) {
+	p.osquery = snapshot
+}
+
+// SetInitSystem sets the init system the target runs, by name, sparing the
+// provider from probing for it
+func (p *ServiceProvider) SetInitSystem(name string) error {
+	system, err := initSystemNamed(name)
+	if err != nil {
+		return err
+	}
+	p.systemMu.Lock()
+	defer p.systemMu.Unlock()
+	p.system = system
+	return nil
+}
+
 // Type returns the resource type this provider handles
 func (p *ServiceProvider) Type() string {
 	return "service"
 }
 
+// Capabilities returns the targets this provider can manage
+func (p *ServiceProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+		Commands:   []string{strings.Join(initSystemCommands(), "|")},
+		Privileged: initSystemPrograms(),
+	}
+}
+
 // Validate validates the service resource configuration
 func (p *ServiceProvider) Validate(resource *types.Resource) error {
 	// Check state - can be in State field or Properties map
@@ -44,12 +84,14 @@ func (p *ServiceProvider) Validate(resource *types.Resource) error {
 	
 	// Validate state values
 	validStates := map[string]bool{
-		"running": true,
-		"stopped": true,
+		"running":   true,
+		"stopped":   true,
+		"restarted": true,
+		"reloaded":  true,
 	}
 	
 	if !validStates[state] {
-		return fmt.Errorf("invalid service state '%s', must be one of: running, stopped", state)
+		return fmt.Errorf("invalid service state '%s', must be one of: running, stopped, restarted, reloaded", state)
 	}
 	
 	// Validate enabled if provided
@@ -59,12 +101,31 @@ func (p *ServiceProvider) Validate(resource *types.Resource) error {
 		}
 	}
 	
-	return nil
+	if err := validateReadiness(resource); err != nil {
+		return err
+	}
+	
+	if err := validateFingerprint(resource); err != nil {
+		return err
+	}
+	
+	return validateSystemd(resource)
 }
 
 // Read reads the current state of the service
 func (p *ServiceProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
-	serviceName := resource.Name
+	serviceName := unitName(resource)
+	
+	// Masking, unit files and timers are systemd's own
+	if property := systemdProperty(resource); property != "" {
+		system, err := p.detectInitSystem(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if system.name != "systemd" {
+			return nil, fmt.Errorf("service '%s' requires systemd, target runs %s", property, system.name)
+		}
+	}
 	
 	// Check if service is active
 	isActive, err := p.isServiceActive(ctx, serviceName)
@@ -88,6 +149,36 @@ func (p *ServiceProvider) Read(ctx context.Context, resource *types.Resource) (m
 		state["state"] = "stopped"
 	}
 	
+	// Only inspect masking and unit files when the resource manages them
+	if _, ok := resource.Properties["masked"]; ok {
+		isMasked, err := p.isServiceMasked(ctx, serviceName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check service masked status: %w", err)
+		}
+		state["masked"] = isMasked
+	}
+	
+	if _, ok := unitContent(resource); ok {
+		content, exists, err := p.readUnitFile(ctx, resource)
+		if err != nil {
+			return nil, err
+		}
+		if exists {
+			state["unit_file"] = content
+		}
+	}
+	
+	// The fingerprint recorded when the service last picked up its config,
+	// and the one of its config files now
+	if fingerprint, _ := serviceFingerprint(resource); fingerprint != nil {
+		recorded, current, err := p.readFingerprints(ctx, resource, fingerprint)
+		if err != nil {
+			return nil, err
+		}
+		state["fingerprint"] = recorded
+		state["config_fingerprint"] = current
+	}
+	
 	return state, nil
 }
 
@@ -111,8 +202,8 @@ func (p *ServiceProvider) Diff(ctx context.Context, resource *types.Resource, cu
 	
 	hasChanges := false
 	
-	// Check state changes
-	if desiredState != currentState {
+	// Check state changes; restarted and reloaded always trigger an action
+	if desiredState != currentState || desiredState == "restarted" || desiredState == "reloaded" {
 		hasChanges = true
 		diff.Changes["state"] = map[string]interface{}{
 			"from": currentState,
@@ -132,6 +223,51 @@ func (p *ServiceProvider) Diff(ctx context.Context, resource *types.Resource, cu
 		}
 	}
 	
+	// Check masked changes
+	if maskedInterface, ok := resource.Properties["masked"]; ok {
+		desiredMasked := maskedInterface.(bool)
+		currentMasked, _ := current["masked"].(bool)
+		if desiredMasked != currentMasked {
+			hasChanges = true
+			diff.Changes["masked"] = map[string]interface{}{
+				"from": currentMasked,
+				"to":   desiredMasked,
+			}
+		}
+	}
+	
+	// Check unit file changes; content is re-rendered at apply time
+	if desiredContent, ok := unitContent(resource); ok {
+		currentContent, exists := current["unit_file"].(string)
+		if !exists || currentContent != desiredContent {
+			from := "modified"
+			if !exists {
+				from = "absent"
+			}
+			hasChanges = true
+			diff.Changes["unit_file"] = map[string]interface{}{
+				"from": from,
+				"to":   unitPath(resource),
+			}
+		}
+	}
+	
+	// Check config changes since the fingerprint was recorded
+	if _, ok := resource.Properties["fingerprint"]; ok {
+		recorded, _ := current["fingerprint"].(string)
+		configFingerprint, _ := current["config_fingerprint"].(string)
+		if recorded != configFingerprint {
+			if recorded == "" {
+				recorded = "absent"
+			}
+			hasChanges = true
+			diff.Changes["fingerprint"] = map[string]interface{}{
+				"from": recorded,
+				"to":   configFingerprint,
+			}
+		}
+	}
+	
 	if hasChanges {
 		diff.Action = types.ActionUpdate
 		diff.Reason = "service needs to be updated"
@@ -145,6 +281,7 @@ func (p *ServiceProvider) Diff(ctx context.Context, resource *types.Resource, cu
 
 // Apply applies the changes to bring the service to desired state
 func (p *ServiceProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	defer p.osquery.ForgetPorts()
 	switch diff.Action {
 	case types.ActionUpdate:
 		return p.updateService(ctx, resource, diff)
@@ -155,207 +292,180 @@ func (p *ServiceProvider) Apply(ctx context.Context, resource *types.Resource, d
 	}
 }
 
+// desiredServiceState returns the state a service resource asks for
+func desiredServiceState(resource *types.Resource) string {
+	if resource.State != "" {
+		return string(resource.State)
+	}
+	state, _ := resource.Properties["state"].(string)
+	return state
+}
+
 // isServiceActive checks if a service is currently active/running
 func (p *ServiceProvider) isServiceActive(ctx context.Context, serviceName string) (bool, error) {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl is-active %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
+	system, err := p.detectInitSystem(ctx)
 	if err != nil {
 		return false, err
 	}
 	
-	// systemctl is-active returns 0 if active, 3 if inactive
-	if result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
-		return true, nil
-	}
-	
-	// Try service command (SysV init)
-	cmd = fmt.Sprintf("service %s status >/dev/null 2>&1 && echo active || echo inactive", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
+	// Each init system prints active for a running service
+	result, err := p.connection.Execute(ctx, system.fill(system.active, serviceName))
 	if err != nil {
 		return false, err
 	}
 	
-	if result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "active" {
-		return true, nil
-	}
-	
-	return false, nil
+	return strings.TrimSpace(result.Stdout) == "active", nil
 }
 
 // isServiceEnabled checks if a service is enabled to start at boot
 func (p *ServiceProvider) isServiceEnabled(ctx context.Context, serviceName string) (bool, error) {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl is-enabled %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
+	system, err := p.detectInitSystem(ctx)
 	if err != nil {
 		return false, err
 	}
 	
-	// systemctl is-enabled returns 0 if enabled
-	if result.ExitCode == 0 && strings.TrimSpace(result.Stdout) == "enabled" {
-		return true, nil
-	}
-	
-	// For SysV init, check if service exists in runlevel directories
-	cmd = fmt.Sprintf("ls /etc/rc*.d/S*%s 2>/dev/null | wc -l", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
+	result, err := p.connection.Execute(ctx, system.fill(system.enabled, serviceName))
 	if err != nil {
 		return false, err
 	}
 	
-	if result.ExitCode == 0 {
-		count := strings.TrimSpace(result.Stdout)
-		return count != "0", nil
-	}
-	
-	return false, nil
+	return strings.TrimSpace(result.Stdout) == "enabled", nil
 }
 
 // updateService updates the service state and enabled status
 func (p *ServiceProvider) updateService(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
-	serviceName := resource.Name
+	serviceName := unitName(resource)
+	
+	// Deploy the unit file first so state changes use the new definition
+	if _, ok := diff.Changes["unit_file"]; ok {
+		content, _ := unitContent(resource)
+		if err := p.writeUnitFile(ctx, resource, content); err != nil {
+			return err
+		}
+	}
+	
+	// Unmask before starting; masking happens after stopping
+	if maskedChange, ok := diff.Changes["masked"]; ok {
+		change := maskedChange.(map[string]interface{})
+		if !change["to"].(bool) {
+			if err := p.setMasked(ctx, serviceName, false); err != nil {
+				return err
+			}
+		}
+	}
+	
+	// Record the new fingerprint; a running service is restarted below to
+	// pick up its changed config, unless it had none recorded yet
+	restart := false
+	if fingerprintChange, ok := diff.Changes["fingerprint"]; ok {
+		change := fingerprintChange.(map[string]interface{})
+		if err := p.writeFingerprint(ctx, resource, change["to"].(string)); err != nil {
+			return err
+		}
+		fingerprint, _ := serviceFingerprint(resource)
+		restart = fingerprint != nil && fingerprint.restart && change["from"] != "absent"
+	}
 	
 	// Handle state changes
+	desiredState := ""
 	if stateChange, ok := diff.Changes["state"]; ok {
-		change := stateChange.(map[string]interface{})
-		desiredState := change["to"].(string)
-		
+		desiredState = stateChange.(map[string]interface{})["to"].(string)
+	} else if restart && desiredServiceState(resource) == "running" {
+		desiredState = "restarted"
+	}
+	if desiredState != "" {
 		switch desiredState {
 		case "running":
-			if err := p.startService(ctx, serviceName); err != nil {
+			if err := p.controlService(ctx, serviceName, "start"); err != nil {
 				return err
 			}
 		case "stopped":
-			if err := p.stopService(ctx, serviceName); err != nil {
+			if err := p.controlService(ctx, serviceName, "stop"); err != nil {
 				return err
 			}
-		}
-	}
-	
-	// Handle enabled changes
-	if enabledChange, ok := diff.Changes["enabled"]; ok {
-		change := enabledChange.(map[string]interface{})
-		desiredEnabled := change["to"].(bool)
-		
-		if desiredEnabled {
-			if err := p.enableService(ctx, serviceName); err != nil {
+		case "restarted", "reloaded":
+			if err := p.controlService(ctx, serviceName, strings.TrimSuffix(desiredState, "ed")); err != nil {
 				return err
 			}
-		} else {
-			if err := p.disableService(ctx, serviceName); err != nil {
+		}
+		
+		// Dependent resources run next, so wait until the service is ready
+		if ready := serviceReadiness(resource); ready != nil && desiredState != "stopped" {
+			if err := p.waitReady(ctx, serviceName, ready); err != nil {
 				return err
 			}
 		}
 	}
 	
-	return nil
-}
-
-// startService starts a service
-func (p *ServiceProvider) startService(ctx context.Context, serviceName string) error {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl start %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start service %s: %w", serviceName, err)
-	}
-	
-	if result.ExitCode == 0 {
-		return nil
-	}
-	
-	// Try service command (SysV init)
-	cmd = fmt.Sprintf("service %s start", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to start service %s: %w", serviceName, err)
-	}
-	
-	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to start service %s: %s", serviceName, result.Stderr)
-	}
-	
-	return nil
-}
-
-// stopService stops a service
-func (p *ServiceProvider) stopService(ctx context.Context, serviceName string) error {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl stop %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to stop service %s: %w", serviceName, err)
-	}
-	
-	if result.ExitCode == 0 {
-		return nil
-	}
-	
-	// Try service command (SysV init)
-	cmd = fmt.Sprintf("service %s stop", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to stop service %s: %w", serviceName, err)
+	// Handle enabled changes
+	if enabledChange, ok := diff.Changes["enabled"]; ok {
+		change := enabledChange.(map[string]interface{})
+		action := "disable"
+		if change["to"].(bool) {
+			action = "enable"
+		}
+		if err := p.controlService(ctx, serviceName, action); err != nil {
+			return err
+		}
 	}
 	
-	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to stop service %s: %s", serviceName, result.Stderr)
+	if maskedChange, ok := diff.Changes["masked"]; ok {
+		change := maskedChange.(map[string]interface{})
+		if change["to"].(bool) {
+			if err := p.setMasked(ctx, serviceName, true); err != nil {
+				return err
+			}
+		}
 	}
 	
 	return nil
 }
 
-// enableService enables a service to start at boot
-func (p *ServiceProvider) enableService(ctx context.Context, serviceName string) error {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl enable %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
+// controlService starts, stops, restarts, reloads, enables or disables a
+// service with the target's init system
+func (p *ServiceProvider) controlService(ctx context.Context, serviceName, action string) error {
+	system, err := p.detectInitSystem(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to enable service %s: %w", serviceName, err)
+		return err
 	}
 	
-	if result.ExitCode == 0 {
-		return nil
+	formats := map[string]string{
+		"start":   system.start,
+		"stop":    system.stop,
+		"restart": system.restart,
+		"reload":  system.reload,
+		"enable":  system.enable,
+		"disable": system.disable,
 	}
-	
-	// Try chkconfig (SysV init)
-	cmd = fmt.Sprintf("chkconfig %s on", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
+	result, err := p.connection.Execute(ctx, system.fill(formats[action], serviceName))
 	if err != nil {
-		return fmt.Errorf("failed to enable service %s: %w", serviceName, err)
+		return fmt.Errorf("failed to %s service %s: %w", action, serviceName, err)
 	}
 	
 	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to enable service %s: %s", serviceName, result.Stderr)
+		return fmt.Errorf("failed to %s service %s: %s", action, serviceName, strings.TrimSpace(result.Stderr))
 	}
 	
 	return nil
 }
 
-// disableService disables a service from starting at boot
-func (p *ServiceProvider) disableService(ctx context.Context, serviceName string) error {
-	// Try systemctl first (systemd)
-	cmd := fmt.Sprintf("systemctl disable %s", shellEscape(serviceName))
-	result, err := p.connection.Execute(ctx, cmd)
-	if err != nil {
-		return fmt.Errorf("failed to disable service %s: %w", serviceName, err)
+// detectInitSystem returns the target's init system. Targets whose facts
+// did not name one are probed once, on first use.
+func (p *ServiceProvider) detectInitSystem(ctx context.Context) (*initSystem, error) {
+	p.systemMu.Lock()
+	defer p.systemMu.Unlock()
+	if p.system != nil {
+		return p.system, nil
 	}
 	
-	if result.ExitCode == 0 {
-		return nil
-	}
-	
-	// Try chkconfig (SysV init)
-	cmd = fmt.Sprintf("chkconfig %s off", shellEscape(serviceName))
-	result, err = p.connection.Execute(ctx, cmd)
+	facts, err := GatherFacts(ctx, p.connection, "", nil)
 	if err != nil {
-		return fmt.Errorf("failed to disable service %s: %w", serviceName, err)
+		return nil, fmt.Errorf("failed to detect init system: %w", err)
 	}
-	
-	if result.ExitCode != 0 {
-		return fmt.Errorf("failed to disable service %s: %s", serviceName, result.Stderr)
+	system := initSystemFor(facts)
+	if system == nil {
+		return nil, fmt.Errorf("no supported init system found, need one of: %s", strings.Join(initSystemNames(), ", "))
 	}
-	
-	return nil
+	p.system = system
+	return system, nil
 }
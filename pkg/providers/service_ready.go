@@ -0,0 +1,158 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+const (
+	// defaultReadyTimeout is how long a started service has to become ready, in seconds
+	defaultReadyTimeout = 60
+	// defaultReadyInterval is how long to wait between readiness checks, in seconds
+	defaultReadyInterval = 2
+)
+
+// readiness is when a started, restarted or reloaded service counts as
+// ready: active, and accepting connections on port or passing command when
+// they are set
+type readiness struct {
+	host     string
+	port     int
+	command  string
+	timeout  time.Duration
+	interval time.Duration
+}
+
+// validateReadiness validates the service 'ready' property: true, or a map
+// of port, host, command, timeout and interval
+func validateReadiness(resource *types.Resource) error {
+	value, ok := resource.Properties["ready"]
+	if !ok {
+		return nil
+	}
+	if _, ok := value.(bool); ok {
+		return nil
+	}
+	settings, ok := value.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("service 'ready' must be a boolean or a map")
+	}
+	for key, setting := range settings {
+		switch key {
+		case "port":
+			if port, ok := setting.(int); !ok || port < 1 || port > 65535 {
+				return fmt.Errorf("service 'ready.port' must be an integer between 1 and 65535")
+			}
+		case "host", "command":
+			if s, ok := setting.(string); !ok || s == "" {
+				return fmt.Errorf("service 'ready.%s' must be a non-empty string", key)
+			}
+		case "timeout", "interval":
+			if n, ok := setting.(int); !ok || n <= 0 {
+				return fmt.Errorf("service 'ready.%s' must be a positive integer", key)
+			}
+		default:
+			return fmt.Errorf("unknown service 'ready' setting '%s', must be one of: port, host, command, timeout, interval", key)
+		}
+	}
+	if _, ok := settings["host"]; ok {
+		if _, ok := settings["port"]; !ok {
+			return fmt.Errorf("service 'ready.host' can only be used with 'ready.port'")
+		}
+	}
+	return nil
+}
+
+// serviceReadiness returns the readiness checks of a resource, or nil when
+// it does not ask for them
+func serviceReadiness(resource *types.Resource) *readiness {
+	r := &readiness{
+		host:     defaultWaitHost,
+		timeout:  defaultReadyTimeout * time.Second,
+		interval: defaultReadyInterval * time.Second,
+	}
+	switch value := resource.Properties["ready"].(type) {
+	case bool:
+		if !value {
+			return nil
+		}
+	case map[string]interface{}:
+		if host, ok := value["host"].(string); ok {
+			r.host = host
+		}
+		r.port, _ = value["port"].(int)
+		r.command, _ = value["command"].(string)
+		if timeout, ok := value["timeout"].(int); ok {
+			r.timeout = time.Duration(timeout) * time.Second
+		}
+		if interval, ok := value["interval"].(int); ok {
+			r.interval = time.Duration(interval) * time.Second
+		}
+	default:
+		return nil
+	}
+	return r
+}
+
+// waitReady polls a service until it is ready or the readiness timeout
+// passes, so resources that depend on it do not race its start
+func (p *ServiceProvider) waitReady(ctx context.Context, serviceName string, r *readiness) error {
+	var waited time.Duration
+	for {
+		reason, err := p.checkReady(ctx, serviceName, r)
+		if err != nil {
+			return err
+		}
+		if reason == "" {
+			return nil
+		}
+		if waited >= r.timeout {
+			return fmt.Errorf("service %s not ready after %s: %s", serviceName, r.timeout, reason)
+		}
+		if err := p.sleep(ctx, r.interval); err != nil {
+			return err
+		}
+		waited += r.interval
+	}
+}
+
+// checkReady runs the readiness checks once, returning why the service is
+// not ready yet, or "" when it is
+func (p *ServiceProvider) checkReady(ctx context.Context, serviceName string, r *readiness) (string, error) {
+	active, err := p.isServiceActive(ctx, serviceName)
+	if err != nil {
+		return "", fmt.Errorf("failed to check service status: %w", err)
+	}
+	if !active {
+		return "not active", nil
+	}
+
+	if r.port != 0 {
+		result, err := p.connection.Execute(ctx, portProbe(r.host, r.port))
+		if err != nil {
+			return "", fmt.Errorf("failed to check port %s:%d: %w", r.host, r.port, err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Sprintf("port %s:%d not accepting connections", r.host, r.port), nil
+		}
+	}
+
+	if r.command != "" {
+		result, err := p.connection.Execute(ctx, r.command)
+		if err != nil {
+			return "", fmt.Errorf("failed to run readiness command: %w", err)
+		}
+		if result.ExitCode != 0 {
+			reason := fmt.Sprintf("readiness command exited %d", result.ExitCode)
+			if stderr := strings.TrimSpace(result.Stderr); stderr != "" {
+				reason += ": " + stderr
+			}
+			return reason, nil
+		}
+	}
+	return "", nil
+}
@@ -0,0 +1,122 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestServiceProvider_ValidateReady(t *testing.T) {
+	tests := []struct {
+		name    string
+		ready   interface{}
+		wantErr string
+	}{
+		{name: "active only", ready: true},
+		{name: "all checks", ready: map[string]interface{}{"port": 8080, "host": "10.0.0.1", "command": "curl -sf localhost/health", "timeout": 30, "interval": 1}},
+		{name: "not a map", ready: "yes", wantErr: "must be a boolean or a map"},
+		{name: "bad port", ready: map[string]interface{}{"port": 70000}, wantErr: "'ready.port' must be an integer"},
+		{name: "empty command", ready: map[string]interface{}{"command": ""}, wantErr: "'ready.command' must be a non-empty string"},
+		{name: "bad timeout", ready: map[string]interface{}{"timeout": "1m"}, wantErr: "'ready.timeout' must be a positive integer"},
+		{name: "host without port", ready: map[string]interface{}{"host": "10.0.0.1"}, wantErr: "can only be used with 'ready.port'"},
+		{name: "unknown setting", ready: map[string]interface{}{"url": "http://localhost"}, wantErr: "unknown service 'ready' setting 'url'"},
+	}
+
+	provider := NewServiceProvider(&MockSSHConnection{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{
+				Type:       "service",
+				Name:       "app",
+				State:      types.StateRunning,
+				Properties: map[string]interface{}{"ready": tt.ready},
+			}
+			err := provider.Validate(resource)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestServiceProvider_ApplyWaitsUntilReady(t *testing.T) {
+	resource := &types.Resource{
+		Type:  "service",
+		Name:  "app",
+		State: types.StateRestarted,
+		Properties: map[string]interface{}{
+			"ready": map[string]interface{}{"port": 8080, "command": "curl -sf localhost:8080/health", "timeout": 4},
+		},
+	}
+	diff := &types.ResourceDiff{
+		Action:  types.ActionUpdate,
+		Changes: map[string]interface{}{"state": map[string]interface{}{"from": "running", "to": "restarted"}},
+	}
+
+	t.Run("ready after retries", func(t *testing.T) {
+		conn := &scriptedConnection{results: []*ssh.ExecuteResult{
+			{ExitCode: 0},                         // systemctl restart
+			{Stdout: "activating\n", ExitCode: 3}, // systemctl is-active
+			{Stdout: "active\n"},                  // systemctl is-active
+			{ExitCode: 1},                         // port closed
+			{Stdout: "active\n"},                  // systemctl is-active
+			{ExitCode: 0},                         // port open
+			{ExitCode: 0},                         // health command
+		}}
+		provider := NewServiceProvider(conn)
+		provider.SetInitSystem("systemd")
+		var slept []time.Duration
+		provider.sleep = func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		}
+
+		if err := provider.Apply(context.Background(), resource, diff); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if len(slept) != 2 || slept[0] != 2*time.Second {
+			t.Errorf("Expected two 2s waits, got %v", slept)
+		}
+		if last := conn.commands[len(conn.commands)-1]; last != "curl -sf localhost:8080/health" {
+			t.Errorf("last command = %q, want the readiness command", last)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		conn := &scriptedConnection{results: []*ssh.ExecuteResult{{ExitCode: 0}}}
+		provider := NewServiceProvider(conn)
+		provider.SetInitSystem("systemd")
+		provider.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+		err := provider.Apply(context.Background(), resource, diff)
+		if err == nil || err.Error() != "service app not ready after 4s: not active" {
+			t.Errorf("Apply() error = %v", err)
+		}
+	})
+
+	t.Run("not waited for when stopping", func(t *testing.T) {
+		conn := &scriptedConnection{results: []*ssh.ExecuteResult{{ExitCode: 0}}}
+		provider := NewServiceProvider(conn)
+		provider.SetInitSystem("systemd")
+		stop := &types.ResourceDiff{
+			Action:  types.ActionUpdate,
+			Changes: map[string]interface{}{"state": map[string]interface{}{"from": "running", "to": "stopped"}},
+		}
+		if err := provider.Apply(context.Background(), resource, stop); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if len(conn.commands) != 1 {
+			t.Errorf("commands = %q, want only the stop", conn.commands)
+		}
+	})
+}
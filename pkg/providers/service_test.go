@@ -161,6 +161,7 @@ func TestServiceProvider_Read(t *testing.T) {
 			}
 			
 			provider := NewServiceProvider(mockConn)
+			provider.SetInitSystem("systemd")
 			ctx := context.Background()
 			
 			got, err := provider.Read(ctx, &tt.resource)
@@ -234,6 +235,19 @@ func TestServiceProvider_Diff(t *testing.T) {
 			},
 			want: types.ActionNoop,
 		},
+		{
+			name: "restart running service",
+			resource: types.Resource{
+				Type:  "service",
+				Name:  "nginx",
+				State: types.StateRestarted,
+			},
+			current: map[string]interface{}{
+				"state":   "running",
+				"enabled": true,
+			},
+			want: types.ActionUpdate,
+		},
 		{
 			name: "enable service",
 			resource: types.Resource{
@@ -342,6 +356,7 @@ func TestServiceProvider_Apply(t *testing.T) {
 			}
 			
 			provider := NewServiceProvider(mockConn)
+			provider.SetInitSystem("systemd")
 			ctx := context.Background()
 			
 			err := provider.Apply(ctx, &tt.resource, tt.diff)
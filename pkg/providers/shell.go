@@ -3,20 +3,36 @@ package providers
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/ataiva-software/forge/pkg/clock"
 	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/sudoers"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
+// defaultRetryDelay is how long to wait between attempts of a shell
+// command that is retried, in seconds
+const defaultRetryDelay = 5
+
+// envNamePattern matches the environment variable names shell resources may set
+var envNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // ShellProvider manages shell command execution resources
 type ShellProvider struct {
 	connection ssh.Executor
+	sleep      func(ctx context.Context, d time.Duration) error
 }
 
 // NewShellProvider creates a new shell provider
 func NewShellProvider(connection ssh.Executor) *ShellProvider {
 	return &ShellProvider{
 		connection: connection,
+		sleep:      clock.Sleep,
 	}
 }
 
@@ -25,16 +41,70 @@ func (p *ShellProvider) Type() string {
 	return "shell"
 }
 
+// Capabilities returns the targets this provider can manage
+func (p *ShellProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+	}
+}
+
+// PrivilegedPrograms returns the programs a shell resource's command and
+// its unless and only_if checks run, all of which a sudo allowlist
+// profile runs as root
+func (p *ShellProvider) PrivilegedPrograms(resource *types.Resource) ([]string, error) {
+	command, err := shellCommand(resource)
+	if err != nil {
+		return nil, err
+	}
+	scripts := []string{p.buildCommand(resource, command)}
+	for _, key := range []string{"unless", "only_if"} {
+		if check, ok := resource.Properties[key].(string); ok {
+			scripts = append(scripts, check)
+		}
+	}
+	seen := make(map[string]bool)
+	var programs []string
+	for _, script := range scripts {
+		found, err := sudoers.Programs(script)
+		if err != nil {
+			return nil, fmt.Errorf("cannot list the programs of %s: %w", resource.ResourceID(), err)
+		}
+		for _, program := range found {
+			if !seen[program] {
+				seen[program] = true
+				programs = append(programs, program)
+			}
+		}
+	}
+	if _, ok := resource.Properties["creates"]; ok && !seen["test"] {
+		programs = append(programs, "test")
+	}
+	sort.Strings(programs)
+	return programs, nil
+}
+
 // Validate validates the shell resource configuration
 func (p *ShellProvider) Validate(resource *types.Resource) error {
-	// Check required command property
-	command, ok := resource.Properties["command"]
-	if !ok {
+	// Exactly one of a command string or an argv list is required
+	command, hasCommand := resource.Properties["command"]
+	_, hasArgs := resource.Properties["args"]
+	switch {
+	case hasCommand && hasArgs:
+		return fmt.Errorf("shell resource must have either 'command' or 'args', not both")
+	case !hasCommand && !hasArgs:
 		return fmt.Errorf("shell resource must have 'command' property")
+	case hasCommand:
+		if _, ok := command.(string); !ok {
+			return fmt.Errorf("shell 'command' must be a string")
+		}
+	default:
+		if _, err := shellArgs(resource); err != nil {
+			return err
+		}
 	}
-	
-	if _, ok := command.(string); !ok {
-		return fmt.Errorf("shell 'command' must be a string")
+
+	if _, err := shellEnv(resource); err != nil {
+		return err
 	}
 	
 	// Validate optional properties
@@ -73,6 +143,22 @@ func (p *ShellProvider) Validate(resource *types.Resource) error {
 			return fmt.Errorf("shell 'timeout' must be an integer")
 		}
 	}
+
+	if retries, ok := resource.Properties["retries"]; ok {
+		if n, ok := retries.(int); !ok || n < 0 {
+			return fmt.Errorf("shell 'retries' must be a non-negative integer")
+		}
+	}
+
+	if delay, ok := resource.Properties["retry_delay"]; ok {
+		if n, ok := delay.(int); !ok || n < 0 {
+			return fmt.Errorf("shell 'retry_delay' must be a non-negative integer")
+		}
+	}
+
+	if _, err := shellReturns(resource); err != nil {
+		return err
+	}
 	
 	return nil
 }
@@ -185,23 +271,67 @@ func (p *ShellProvider) commandSucceeds(ctx context.Context, command string) (bo
 	return result.ExitCode == 0, nil
 }
 
-// executeCommand executes the shell command with proper context
+// executeCommand executes the shell command with proper context. A command
+// that exits with a code it is not expected to is run again up to retries
+// times, retry_delay seconds apart. While a stream is listening, the output
+// is passed on as it is printed.
 func (p *ShellProvider) executeCommand(ctx context.Context, resource *types.Resource) error {
-	command := resource.Properties["command"].(string)
+	command, err := shellCommand(resource)
+	if err != nil {
+		return err
+	}
+	returns, err := shellReturns(resource)
+	if err != nil {
+		return err
+	}
+	retries, _ := resource.Properties["retries"].(int)
+	delay := defaultRetryDelay
+	if value, ok := resource.Properties["retry_delay"].(int); ok {
+		delay = value
+	}
 	
 	// Build the full command with context
 	fullCommand := p.buildCommand(resource, command)
-	
-	result, err := p.connection.Execute(ctx, fullCommand)
-	if err != nil {
-		return fmt.Errorf("failed to execute command: %w", err)
+
+	if stream := types.OutputStream(ctx); stream != nil {
+		id := resource.ResourceID()
+		ctx = ssh.WithOutputStream(ctx, func(name, line string) {
+			stream(types.OutputLine{Resource: id, Stream: name, Line: line})
+		})
 	}
-	
-	if result.ExitCode != 0 {
-		return fmt.Errorf("command failed with exit code %d: %s", result.ExitCode, result.Stderr)
+	if buffers := types.OutputBuffers(ctx); buffers != nil {
+		id := resource.ResourceID()
+		ctx = ssh.WithOutputBuffers(ctx, func(name string) ssh.OutputBuffer {
+			return buffers(id, name)
+		})
 	}
 	
-	return nil
+	for attempt := 1; ; attempt++ {
+		result, err := p.connection.Execute(ctx, fullCommand)
+		if err != nil {
+			return fmt.Errorf("failed to execute command: %w", err)
+		}
+		
+		// Output is registered for later resources even when the command fails
+		types.CaptureOutput(ctx, types.CommandOutput{Stdout: result.Stdout, Stderr: result.Stderr, ExitCode: result.ExitCode})
+		
+		if returns[result.ExitCode] {
+			return nil
+		}
+		if attempt > retries {
+			err := fmt.Errorf("command failed with exit code %d: %s", result.ExitCode, result.Stderr)
+			if _, custom := resource.Properties["returns"]; custom {
+				err = fmt.Errorf("command failed with exit code %d, expected %s: %s", result.ExitCode, formatReturns(returns), result.Stderr)
+			}
+			if attempt > 1 {
+				err = fmt.Errorf("%w (after %d attempts)", err, attempt)
+			}
+			return err
+		}
+		if err := p.sleep(ctx, time.Duration(delay)*time.Second); err != nil {
+			return err
+		}
+	}
 }
 
 // buildCommand builds the full command with user, cwd, and other context
@@ -228,3 +358,134 @@ func (p *ShellProvider) buildCommand(resource *types.Resource, command string) s
 	
 	return fullCommand
 }
+
+// shellCommand returns the command line of a shell resource. Arguments and
+// environment variables are quoted here, so their values are never parsed
+// by the target's shell.
+func shellCommand(resource *types.Resource) (string, error) {
+	var command string
+	if raw, ok := resource.Properties["command"].(string); ok {
+		command = raw
+	} else {
+		args, err := shellArgs(resource)
+		if err != nil {
+			return "", err
+		}
+		quoted := make([]string, len(args))
+		for i, arg := range args {
+			quoted[i] = shellEscape(arg)
+		}
+		command = strings.Join(quoted, " ")
+	}
+
+	env, err := shellEnv(resource)
+	if err != nil || len(env) == 0 {
+		return command, err
+	}
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	assignments := make([]string, len(names))
+	for i, name := range names {
+		assignments[i] = shellEscape(name + "=" + env[name])
+	}
+	// env runs a program, so a command string runs in a shell of its own
+	if _, raw := resource.Properties["command"].(string); raw {
+		command = "sh -c " + shellEscape(command)
+	}
+	return "env " + strings.Join(assignments, " ") + " " + command, nil
+}
+
+// shellArgs returns the argv list of a shell resource
+func shellArgs(resource *types.Resource) ([]string, error) {
+	list, ok := resource.Properties["args"].([]interface{})
+	if !ok {
+		if args, ok := resource.Properties["args"].([]string); ok && len(args) > 0 {
+			return args, nil
+		}
+		return nil, fmt.Errorf("shell 'args' must be a non-empty list of strings")
+	}
+	if len(list) == 0 {
+		return nil, fmt.Errorf("shell 'args' must be a non-empty list of strings")
+	}
+	args := make([]string, len(list))
+	for i, item := range list {
+		arg, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("shell 'args[%d]' must be a string", i)
+		}
+		args[i] = arg
+	}
+	return args, nil
+}
+
+// shellEnv returns the environment variables of a shell resource, set with
+// env or its longer form environment
+func shellEnv(resource *types.Resource) (map[string]string, error) {
+	key := "env"
+	value, ok := resource.Properties[key]
+	if environment, has := resource.Properties["environment"]; has {
+		if ok {
+			return nil, fmt.Errorf("shell resource must have either 'env' or 'environment', not both")
+		}
+		key, value, ok = "environment", environment, true
+	}
+	if !ok {
+		return nil, nil
+	}
+	entries, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("shell '%s' must be a map of names to values", key)
+	}
+	env := make(map[string]string, len(entries))
+	for name, value := range entries {
+		if !envNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("shell '%s' has an invalid variable name '%s'", key, name)
+		}
+		switch value.(type) {
+		case string, int, bool, float64:
+			env[name] = fmt.Sprint(value)
+		default:
+			return nil, fmt.Errorf("shell '%s.%s' must be a string, number or boolean", key, name)
+		}
+	}
+	return env, nil
+}
+
+// shellReturns returns the exit codes a shell command succeeds with: the
+// returns list, or just 0
+func shellReturns(resource *types.Resource) (map[int]bool, error) {
+	value, ok := resource.Properties["returns"]
+	if !ok {
+		return map[int]bool{0: true}, nil
+	}
+	list, ok := value.([]interface{})
+	if !ok || len(list) == 0 {
+		return nil, fmt.Errorf("shell 'returns' must be a non-empty list of exit codes")
+	}
+	returns := make(map[int]bool, len(list))
+	for _, item := range list {
+		code, ok := item.(int)
+		if !ok || code < 0 || code > 255 {
+			return nil, fmt.Errorf("shell 'returns' must be a non-empty list of exit codes between 0 and 255")
+		}
+		returns[code] = true
+	}
+	return returns, nil
+}
+
+// formatReturns lists exit codes in order
+func formatReturns(returns map[int]bool) string {
+	codes := make([]int, 0, len(returns))
+	for code := range returns {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	formatted := make([]string, len(codes))
+	for i, code := range codes {
+		formatted[i] = strconv.Itoa(code)
+	}
+	return strings.Join(formatted, ", ")
+}
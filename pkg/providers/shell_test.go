@@ -2,7 +2,9 @@ package providers
 
 import (
 	"context"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/ataiva-software/forge/pkg/ssh"
 	"github.com/ataiva-software/forge/pkg/types"
@@ -76,6 +78,105 @@ func TestShellProvider_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "valid shell with args and env",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "migrate",
+				Properties: map[string]interface{}{
+					"args": []interface{}{"/opt/app/bin/migrate", "--to", "latest"},
+					"env":  map[string]interface{}{"APP_ENV": "production", "WORKERS": 4},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "command and args",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "both",
+				Properties: map[string]interface{}{
+					"command": "echo test",
+					"args":    []interface{}{"echo", "test"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "empty args",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "empty",
+				Properties: map[string]interface{}{
+					"args": []interface{}{},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid env name",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "bad-env",
+				Properties: map[string]interface{}{
+					"command": "echo test",
+					"env":     map[string]interface{}{"APP-ENV": "production"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "env and environment",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "both-env",
+				Properties: map[string]interface{}{
+					"command":     "echo test",
+					"env":         map[string]interface{}{"A": "1"},
+					"environment": map[string]interface{}{"B": "2"},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "retries, delay and returns",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "retried",
+				Properties: map[string]interface{}{
+					"command":     "apt-get update",
+					"retries":     3,
+					"retry_delay": 10,
+					"returns":     []interface{}{0, 100},
+					"environment": map[string]interface{}{"DEBIAN_FRONTEND": "noninteractive"},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative retries",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "negative",
+				Properties: map[string]interface{}{
+					"command": "echo test",
+					"retries": -1,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "returns out of range",
+			resource: types.Resource{
+				Type: "shell",
+				Name: "bad-returns",
+				Properties: map[string]interface{}{
+					"command": "echo test",
+					"returns": []interface{}{0, 256},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "creates not string",
 			resource: types.Resource{
@@ -294,6 +395,8 @@ func TestShellProvider_Apply(t *testing.T) {
 		diff     *types.ResourceDiff
 		mockCmds map[string]*ssh.ExecuteResult
 		wantErr  bool
+		// wantOutput is the output registered for later resources
+		wantOutput types.CommandOutput
 	}{
 		{
 			name: "execute command",
@@ -316,7 +419,8 @@ func TestShellProvider_Apply(t *testing.T) {
 					ExitCode: 0,
 				},
 			},
-			wantErr: false,
+			wantErr:    false,
+			wantOutput: types.CommandOutput{Stdout: "hello world"},
 		},
 		{
 			name: "command fails",
@@ -339,7 +443,8 @@ func TestShellProvider_Apply(t *testing.T) {
 					Stderr:   "command failed",
 				},
 			},
-			wantErr: true,
+			wantErr:    true,
+			wantOutput: types.CommandOutput{Stderr: "command failed", ExitCode: 1},
 		},
 		{
 			name: "no action needed",
@@ -367,9 +472,13 @@ func TestShellProvider_Apply(t *testing.T) {
 			}
 			
 			provider := NewShellProvider(mockConn)
-			ctx := context.Background()
+			var output types.CommandOutput
+			ctx := types.WithOutputCapture(context.Background(), &output)
 			
 			err := provider.Apply(ctx, &tt.resource, tt.diff)
+			if output != tt.wantOutput {
+				t.Errorf("ShellProvider.Apply() registered %+v, want %+v", output, tt.wantOutput)
+			}
 			
 			if tt.wantErr {
 				if err == nil {
@@ -383,3 +492,143 @@ func TestShellProvider_Apply(t *testing.T) {
 		})
 	}
 }
+
+func TestShellCommand(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		want       string
+	}{
+		{
+			name:       "command",
+			properties: map[string]interface{}{"command": "echo $HOME"},
+			want:       "echo $HOME",
+		},
+		{
+			name:       "args are quoted",
+			properties: map[string]interface{}{"args": []interface{}{"touch", "/tmp/a file; rm -rf /", "it's"}},
+			want:       `'touch' '/tmp/a file; rm -rf /' 'it'"'"'s'`,
+		},
+		{
+			name: "env with args",
+			properties: map[string]interface{}{
+				"args": []interface{}{"printenv", "GREETING"},
+				"env":  map[string]interface{}{"GREETING": "hello $(whoami)", "A": true},
+			},
+			want: `env 'A=true' 'GREETING=hello $(whoami)' 'printenv' 'GREETING'`,
+		},
+		{
+			name: "environment",
+			properties: map[string]interface{}{
+				"args":        []interface{}{"make"},
+				"environment": map[string]interface{}{"CC": "clang"},
+			},
+			want: `env 'CC=clang' 'make'`,
+		},
+		{
+			name: "env with command",
+			properties: map[string]interface{}{
+				"command": "echo $GREETING",
+				"env":     map[string]interface{}{"GREETING": "hello"},
+			},
+			want: `env 'GREETING=hello' sh -c 'echo $GREETING'`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := shellCommand(&types.Resource{Type: "shell", Name: "test", Properties: tt.properties})
+			if err != nil {
+				t.Fatalf("shellCommand() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("shellCommand() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// sequenceConnection answers every command with the next of its results
+type sequenceConnection struct {
+	MockSSHConnection
+	results  []*ssh.ExecuteResult
+	commands []string
+}
+
+func (c *sequenceConnection) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	c.commands = append(c.commands, command)
+	result := c.results[0]
+	if len(c.results) > 1 {
+		c.results = c.results[1:]
+	}
+	return result, nil
+}
+
+func TestShellProvider_Retries(t *testing.T) {
+	failed := &ssh.ExecuteResult{ExitCode: 1, Stderr: "lock held"}
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		results    []*ssh.ExecuteResult
+		wantRuns   int
+		wantSleeps []time.Duration
+		wantErr    string
+	}{
+		{
+			name:       "succeeds after retrying",
+			properties: map[string]interface{}{"retries": 3, "retry_delay": 2},
+			results:    []*ssh.ExecuteResult{failed, failed, {Stdout: "done"}},
+			wantRuns:   3,
+			wantSleeps: []time.Duration{2 * time.Second, 2 * time.Second},
+		},
+		{
+			name:       "gives up",
+			properties: map[string]interface{}{"retries": 1},
+			results:    []*ssh.ExecuteResult{failed},
+			wantRuns:   2,
+			wantSleeps: []time.Duration{5 * time.Second},
+			wantErr:    "command failed with exit code 1: lock held (after 2 attempts)",
+		},
+		{
+			name:       "expected exit code",
+			properties: map[string]interface{}{"retries": 2, "returns": []interface{}{0, 2}},
+			results:    []*ssh.ExecuteResult{{ExitCode: 2}},
+			wantRuns:   1,
+		},
+		{
+			name:       "unexpected exit code",
+			properties: map[string]interface{}{"returns": []interface{}{2, 0}},
+			results:    []*ssh.ExecuteResult{failed},
+			wantRuns:   1,
+			wantErr:    "command failed with exit code 1, expected 0, 2: lock held",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.properties["command"] = "apt-get update"
+			resource := &types.Resource{Type: "shell", Name: "update", Properties: tt.properties}
+			conn := &sequenceConnection{results: tt.results}
+			provider := NewShellProvider(conn)
+			var sleeps []time.Duration
+			provider.sleep = func(ctx context.Context, d time.Duration) error {
+				sleeps = append(sleeps, d)
+				return nil
+			}
+
+			err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionUpdate})
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Apply() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || err.Error() != tt.wantErr) {
+				t.Errorf("Apply() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(conn.commands) != tt.wantRuns {
+				t.Errorf("ran %d time(s), want %d", len(conn.commands), tt.wantRuns)
+			}
+			if !reflect.DeepEqual(sleeps, tt.wantSleeps) {
+				t.Errorf("slept %v, want %v", sleeps, tt.wantSleeps)
+			}
+		})
+	}
+}
@@ -0,0 +1,591 @@
+package providers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+const (
+	// syncBatchSize is how many paths are passed to a single mkdir, chmod,
+	// chown or rm command
+	syncBatchSize = 100
+	// syncListLimit is how many paths the plan lists for each kind of change
+	syncListLimit = 10
+)
+
+// SyncProvider copies a local directory tree to the target, keeping files
+// that are already up to date and optionally removing files that are not in
+// the source
+type SyncProvider struct {
+	connection ssh.Executor
+}
+
+// NewSyncProvider creates a new sync provider
+func NewSyncProvider(connection ssh.Executor) *SyncProvider {
+	return &SyncProvider{
+		connection: connection,
+	}
+}
+
+// Type returns the resource type this provider handles
+func (p *SyncProvider) Type() string {
+	return "sync"
+}
+
+// Capabilities returns the targets this provider can manage
+func (p *SyncProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux},
+		// The tree is read unprivileged; only its changes need root
+		Privileged: []string{"chmod", "chown", "mkdir", "mv", "rm", "tee", "test"},
+	}
+}
+
+// Validate validates the sync resource configuration
+func (p *SyncProvider) Validate(resource *types.Resource) error {
+	target, ok := resource.Properties["path"].(string)
+	if !ok || target == "" {
+		return fmt.Errorf("sync resource must have a 'path' property")
+	}
+	if path.Clean(target) == "/" {
+		return fmt.Errorf("sync 'path' cannot be the root directory")
+	}
+
+	state := syncState(resource)
+	if state != types.StatePresent && state != types.StateAbsent {
+		return fmt.Errorf("invalid sync state '%s', must be one of: present, absent", state)
+	}
+
+	if state == types.StatePresent {
+		source, ok := resource.Properties["source"].(string)
+		if !ok || source == "" {
+			return fmt.Errorf("sync resource must have a 'source' directory")
+		}
+		if info, err := os.Stat(source); err != nil || !info.IsDir() {
+			return fmt.Errorf("sync 'source' %s is not a directory", source)
+		}
+	}
+
+	for _, key := range []string{"mode", "dir_mode"} {
+		if value, ok := resource.Properties[key]; ok {
+			mode, isString := value.(string)
+			if !isString {
+				return fmt.Errorf("sync '%s' must be a string (e.g., '0644')", key)
+			}
+			if _, err := strconv.ParseUint(mode, 8, 32); err != nil {
+				return fmt.Errorf("invalid sync %s '%s': %w", key, mode, err)
+			}
+		}
+	}
+	for _, key := range []string{"owner", "group"} {
+		if value, ok := resource.Properties[key]; ok {
+			if s, isString := value.(string); !isString || s == "" {
+				return fmt.Errorf("sync '%s' must be a non-empty string", key)
+			}
+		}
+	}
+	if value, ok := resource.Properties["purge"]; ok {
+		if _, isBool := value.(bool); !isBool {
+			return fmt.Errorf("sync 'purge' must be a boolean")
+		}
+	}
+	if _, err := syncExcludes(resource); err != nil {
+		return err
+	}
+	return nil
+}
+
+// syncEntry is a file or directory in a synced tree
+type syncEntry struct {
+	dir   bool
+	mode  string
+	owner string
+	group string
+	sum   string
+}
+
+// Read lists the target directory tree with the checksum of every file
+func (p *SyncProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	target := resource.Properties["path"].(string)
+	entries, exists, err := p.readTarget(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"path":    target,
+		"exists":  exists,
+		"entries": entries,
+	}, nil
+}
+
+// Diff compares the source tree with the target tree and summarises the
+// files that will be added, updated and removed
+func (p *SyncProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff := &types.ResourceDiff{
+		ResourceID: resource.ResourceID(),
+		Changes:    make(map[string]interface{}),
+	}
+	target := resource.Properties["path"].(string)
+	exists, _ := current["exists"].(bool)
+
+	if syncState(resource) == types.StateAbsent {
+		if exists {
+			diff.Action = types.ActionDelete
+			diff.Reason = fmt.Sprintf("directory %s should be absent but exists", target)
+		} else {
+			diff.Action = types.ActionNoop
+			diff.Reason = fmt.Sprintf("directory %s is already absent", target)
+		}
+		return diff, nil
+	}
+
+	remote, _ := current["entries"].(map[string]syncEntry)
+	plan, err := planSync(resource, remote)
+	if err != nil {
+		return nil, err
+	}
+	if plan.empty() {
+		diff.Action = types.ActionNoop
+		diff.Reason = fmt.Sprintf("directory %s is in sync", target)
+		return diff, nil
+	}
+
+	diff.Action = types.ActionUpdate
+	if !exists {
+		diff.Action = types.ActionCreate
+	}
+	diff.Reason = plan.summary()
+	for key, paths := range map[string][]string{
+		"added":      plan.added,
+		"updated":    plan.updated,
+		"attributes": plan.attributes,
+		"removed":    plan.removed,
+	} {
+		if len(paths) > 0 {
+			diff.Changes[key] = syncList(paths)
+		}
+	}
+	return diff, nil
+}
+
+// Apply brings the target tree in line with the source. The target is read
+// again so the changes made are the ones needed now.
+func (p *SyncProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	target := resource.Properties["path"].(string)
+
+	switch diff.Action {
+	case types.ActionNoop:
+		return nil
+	case types.ActionDelete:
+		return p.run(ctx, fmt.Sprintf("rm -rf -- %s", shellEscape(target)), "remove directory "+target)
+	case types.ActionCreate, types.ActionUpdate:
+	default:
+		return fmt.Errorf("unsupported action: %s", diff.Action)
+	}
+
+	remote, _, err := p.readTarget(ctx, target)
+	if err != nil {
+		return err
+	}
+	plan, err := planSync(resource, remote)
+	if err != nil {
+		return err
+	}
+
+	// Remove first so a file can be replaced by a directory of the same name
+	if err := p.batch(ctx, "rm -rf --", target, plan.removals, "remove"); err != nil {
+		return err
+	}
+	if err := p.batch(ctx, "mkdir -p --", target, plan.mkdirs, "create directories in"); err != nil {
+		return err
+	}
+	for _, rel := range plan.uploads {
+		if err := p.upload(ctx, filepath.Join(plan.source, filepath.FromSlash(rel)), path.Join(target, rel)); err != nil {
+			return err
+		}
+	}
+
+	// Ownership first, since chown can clear setuid and setgid bits
+	if chown := syncOwnership(resource); chown != "" {
+		if err := p.batch(ctx, "chown "+shellEscape(chown)+" --", target, plan.chown, "set ownership in"); err != nil {
+			return err
+		}
+	}
+	modes := make([]string, 0, len(plan.chmod))
+	for mode := range plan.chmod {
+		modes = append(modes, mode)
+	}
+	sort.Strings(modes)
+	for _, mode := range modes {
+		if err := p.batch(ctx, "chmod "+mode+" --", target, plan.chmod[mode], "set mode in"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readTarget lists every entry under the target directory, keyed by its
+// slash-separated path relative to it; the directory itself has the key ""
+func (p *SyncProvider) readTarget(ctx context.Context, target string) (map[string]syncEntry, bool, error) {
+	cmd := fmt.Sprintf("test -d %s || exit 3; cd %s && find . -exec stat -c '%%F|%%a|%%U|%%G|%%n' {} + && echo '--' && find . -type f -exec sha256sum {} +",
+		shellEscape(target), shellEscape(target))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read directory %s: %w", target, err)
+	}
+	if result.ExitCode == 3 {
+		return map[string]syncEntry{}, false, nil
+	}
+	if result.ExitCode != 0 {
+		return nil, false, fmt.Errorf("failed to read directory %s: %s", target, result.Stderr)
+	}
+
+	entries := make(map[string]syncEntry)
+	listing, sums, _ := strings.Cut(result.Stdout, "--\n")
+	for _, line := range strings.Split(listing, "\n") {
+		fields := strings.SplitN(line, "|", 5)
+		if len(fields) != 5 {
+			continue
+		}
+		entries[syncRel(fields[4])] = syncEntry{
+			dir:   fields[0] == "directory",
+			mode:  fields[1],
+			owner: fields[2],
+			group: fields[3],
+		}
+	}
+	for _, line := range strings.Split(sums, "\n") {
+		sum, name, ok := strings.Cut(line, "  ")
+		if !ok {
+			continue
+		}
+		rel := syncRel(name)
+		if entry, exists := entries[rel]; exists {
+			entry.sum = sum
+			entries[rel] = entry
+		}
+	}
+	return entries, true, nil
+}
+
+// syncPlan is the set of changes that bring a target tree in line with the source
+type syncPlan struct {
+	source string
+
+	// Changes reported in the plan
+	added      []string
+	updated    []string
+	attributes []string
+	removed    []string
+
+	// Work to do, as paths relative to the target
+	removals []string
+	mkdirs   []string
+	uploads  []string
+	chown    []string
+	chmod    map[string][]string
+}
+
+// planSync compares the local source tree with the target tree
+func planSync(resource *types.Resource, remote map[string]syncEntry) (*syncPlan, error) {
+	source := resource.Properties["source"].(string)
+	excludes, _ := syncExcludes(resource)
+	owner, _ := resource.Properties["owner"].(string)
+	group, _ := resource.Properties["group"].(string)
+	purge, _ := resource.Properties["purge"].(bool)
+
+	plan := &syncPlan{source: source, chmod: make(map[string][]string)}
+	local := make(map[string]bool)
+
+	err := filepath.WalkDir(source, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(source, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = ""
+		}
+		if rel != "" && syncExcluded(rel, excludes) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		local[rel] = true
+
+		mode := syncMode(resource, "mode", info.Mode())
+		if d.IsDir() {
+			mode = syncMode(resource, "dir_mode", info.Mode())
+		}
+		current, exists := remote[rel]
+
+		// A directory replacing a file or a file replacing a directory
+		if exists && current.dir != d.IsDir() {
+			plan.removals = append(plan.removals, rel)
+			exists = false
+		}
+
+		changed := false
+		switch {
+		case !exists && d.IsDir():
+			plan.mkdirs = append(plan.mkdirs, rel)
+			if rel != "" {
+				plan.added = append(plan.added, rel+"/")
+			}
+			changed = true
+		case !exists:
+			plan.uploads = append(plan.uploads, rel)
+			plan.added = append(plan.added, rel)
+			changed = true
+		case !d.IsDir():
+			sum, err := fileSHA256(file)
+			if err != nil {
+				return err
+			}
+			if sum != current.sum {
+				plan.uploads = append(plan.uploads, rel)
+				plan.updated = append(plan.updated, rel)
+				changed = true
+			}
+		}
+
+		attributes := mode != current.mode || (owner != "" && owner != current.owner) || (group != "" && group != current.group)
+		if exists && !changed && attributes {
+			name := rel
+			if d.IsDir() {
+				name += "/"
+			}
+			if rel == "" {
+				name = "./"
+			}
+			plan.attributes = append(plan.attributes, name)
+		}
+		if changed || attributes {
+			plan.chmod[mode] = append(plan.chmod[mode], rel)
+			if owner != "" || group != "" {
+				plan.chown = append(plan.chown, rel)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sync source %s: %w", source, err)
+	}
+
+	if purge {
+		extra := make([]string, 0)
+		for rel := range remote {
+			if rel != "" && !local[rel] && !syncExcluded(rel, excludes) {
+				extra = append(extra, rel)
+			}
+		}
+		sort.Strings(extra)
+		for _, rel := range extra {
+			// Removing a directory removes everything in it
+			if n := len(plan.removed); n > 0 && strings.HasPrefix(rel, strings.TrimSuffix(plan.removed[n-1], "/")+"/") {
+				continue
+			}
+			name := rel
+			if remote[rel].dir {
+				name += "/"
+			}
+			plan.removed = append(plan.removed, name)
+			plan.removals = append(plan.removals, rel)
+		}
+	}
+	sort.Strings(plan.removals)
+	return plan, nil
+}
+
+// empty reports whether the target is already in sync
+func (s *syncPlan) empty() bool {
+	return len(s.added)+len(s.updated)+len(s.attributes)+len(s.removed)+len(s.mkdirs)+len(s.removals) == 0
+}
+
+// summary counts the changes, e.g. "2 to add, 1 to update, 3 to remove"
+func (s *syncPlan) summary() string {
+	var parts []string
+	for _, count := range []struct {
+		n    int
+		verb string
+	}{
+		{len(s.added), "to add"},
+		{len(s.updated), "to update"},
+		{len(s.attributes), "with attribute changes"},
+		{len(s.removed), "to remove"},
+	} {
+		if count.n > 0 {
+			parts = append(parts, fmt.Sprintf("%d %s", count.n, count.verb))
+		}
+	}
+	if len(parts) == 0 {
+		return "directory will be created"
+	}
+	return "files: " + strings.Join(parts, ", ")
+}
+
+// upload copies a local file to the target through a temporary file
+func (p *SyncProvider) upload(ctx context.Context, local, remote string) error {
+	data, err := os.ReadFile(local)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", local, err)
+	}
+	tempPath := remote + ".chisel.tmp"
+	if err := uploadFile(ctx, p.connection, tempPath, data); err != nil {
+		return fmt.Errorf("failed to copy %s: %w", remote, err)
+	}
+	return p.run(ctx, fmt.Sprintf("mv -f %s %s", shellEscape(tempPath), shellEscape(remote)), "move "+remote+" into place")
+}
+
+// batch runs a command on many target paths, a batch at a time
+func (p *SyncProvider) batch(ctx context.Context, command, target string, rels []string, action string) error {
+	for start := 0; start < len(rels); start += syncBatchSize {
+		end := start + syncBatchSize
+		if end > len(rels) {
+			end = len(rels)
+		}
+		args := make([]string, 0, end-start)
+		for _, rel := range rels[start:end] {
+			args = append(args, shellEscape(path.Join(target, rel)))
+		}
+		if err := p.run(ctx, command+" "+strings.Join(args, " "), action+" "+target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// run executes a command and turns a non-zero exit into an error
+func (p *SyncProvider) run(ctx context.Context, cmd, action string) error {
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to %s: %w", action, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to %s: %s", action, result.Stderr)
+	}
+	return nil
+}
+
+// syncOwnership returns the chown argument for the resource, or "" if it sets neither owner nor group
+func syncOwnership(resource *types.Resource) string {
+	owner, _ := resource.Properties["owner"].(string)
+	group, _ := resource.Properties["group"].(string)
+	switch {
+	case owner != "" && group != "":
+		return owner + ":" + group
+	case group != "":
+		return ":" + group
+	default:
+		return owner
+	}
+}
+
+// syncMode returns the mode for an entry as stat prints it: the configured
+// mode if set, otherwise the mode of the local copy
+func syncMode(resource *types.Resource, key string, local fs.FileMode) string {
+	if mode, ok := resource.Properties[key].(string); ok {
+		value, _ := strconv.ParseUint(mode, 8, 32)
+		return strconv.FormatUint(value, 8)
+	}
+	return strconv.FormatUint(uint64(local.Perm()), 8)
+}
+
+// syncExcludes returns the resource's exclude patterns
+func syncExcludes(resource *types.Resource) ([]string, error) {
+	value, ok := resource.Properties["exclude"]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := value.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("sync 'exclude' must be a list of patterns")
+	}
+	patterns := make([]string, 0, len(items))
+	for _, item := range items {
+		pattern, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("sync 'exclude' must be a list of patterns")
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid sync exclude pattern '%s': %w", pattern, err)
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, nil
+}
+
+// syncExcluded reports whether a relative path or its base name matches an exclude pattern
+func syncExcluded(rel string, patterns []string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// syncList renders paths for the plan, listing the first few
+func syncList(paths []string) string {
+	if len(paths) <= syncListLimit {
+		return strings.Join(paths, ", ")
+	}
+	return fmt.Sprintf("%s and %d more", strings.Join(paths[:syncListLimit], ", "), len(paths)-syncListLimit)
+}
+
+// syncRel turns a path printed by find into a key relative to the target
+func syncRel(name string) string {
+	if name == "." {
+		return ""
+	}
+	return strings.TrimPrefix(name, "./")
+}
+
+// syncState returns the desired state, defaulting to present
+func syncState(resource *types.Resource) types.ResourceState {
+	if resource.State == "" {
+		return types.StatePresent
+	}
+	return resource.State
+}
+
+// fileSHA256 returns the hex SHA-256 checksum of a local file
+func fileSHA256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
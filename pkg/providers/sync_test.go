@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// writeTree creates files, with their parent directories, under root
+func writeTree(t *testing.T, root string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		file := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestSyncProvider_Validate(t *testing.T) {
+	source := t.TempDir()
+	provider := NewSyncProvider(nil)
+
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		properties map[string]interface{}
+		wantErr    string
+	}{
+		{name: "valid", properties: map[string]interface{}{"source": source, "path": "/srv/site"}},
+		{name: "all options", properties: map[string]interface{}{"source": source, "path": "/srv/site", "owner": "www-data", "group": "www-data", "mode": "0640", "dir_mode": "0750", "purge": true, "exclude": []interface{}{"*.swp", ".git"}}},
+		{name: "absent needs no source", state: types.StateAbsent, properties: map[string]interface{}{"path": "/srv/site"}},
+		{name: "missing path", properties: map[string]interface{}{"source": source}, wantErr: "'path' property"},
+		{name: "root path", properties: map[string]interface{}{"source": source, "path": "/"}, wantErr: "root directory"},
+		{name: "missing source", properties: map[string]interface{}{"path": "/srv/site"}, wantErr: "'source' directory"},
+		{name: "source not a directory", properties: map[string]interface{}{"source": filepath.Join(source, "missing"), "path": "/srv/site"}, wantErr: "is not a directory"},
+		{name: "invalid mode", properties: map[string]interface{}{"source": source, "path": "/srv/site", "mode": "0999"}, wantErr: "invalid sync mode"},
+		{name: "purge not bool", properties: map[string]interface{}{"source": source, "path": "/srv/site", "purge": "yes"}, wantErr: "'purge' must be a boolean"},
+		{name: "bad exclude", properties: map[string]interface{}{"source": source, "path": "/srv/site", "exclude": []interface{}{"[a"}}, wantErr: "invalid sync exclude pattern"},
+		{name: "invalid state", state: "running", properties: map[string]interface{}{"source": source, "path": "/srv/site"}, wantErr: "invalid sync state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "sync", Name: "site", State: tt.state, Properties: tt.properties}
+			err := provider.Validate(resource)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSyncList(t *testing.T) {
+	if got := syncList([]string{"a", "b"}); got != "a, b" {
+		t.Errorf("syncList() = %q", got)
+	}
+	paths := make([]string, syncListLimit+3)
+	for i := range paths {
+		paths[i] = "f"
+	}
+	if got := syncList(paths); !strings.HasSuffix(got, "f and 3 more") {
+		t.Errorf("syncList() = %q, want the rest counted", got)
+	}
+}
+
+func TestSyncProvider_Lifecycle(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	target := filepath.Join(t.TempDir(), "site")
+	writeTree(t, source, map[string]string{
+		"index.html":     "<h1>hello</h1>",
+		"css/site.css":   "body {}",
+		"img/logo.svg":   "<svg/>",
+		"notes.swp":      "scratch",
+		".git/HEAD":      "ref: refs/heads/main",
+		"js/vendor/a.js": "a()",
+	})
+
+	provider := NewSyncProvider(&ssh.LocalExecutor{})
+	resource := &types.Resource{
+		Type: "sync",
+		Name: "site",
+		Properties: map[string]interface{}{
+			"source":  source,
+			"path":    target,
+			"mode":    "0640",
+			"purge":   true,
+			"exclude": []interface{}{"*.swp", ".git"},
+		},
+	}
+
+	sync := func() *types.ResourceDiff {
+		t.Helper()
+		current, err := provider.Read(ctx, resource)
+		if err != nil {
+			t.Fatalf("Read() error = %v", err)
+		}
+		diff, err := provider.Diff(ctx, resource, current)
+		if err != nil {
+			t.Fatalf("Diff() error = %v", err)
+		}
+		if err := provider.Apply(ctx, resource, diff); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		return diff
+	}
+
+	diff := sync()
+	if diff.Action != types.ActionCreate {
+		t.Fatalf("Expected create, got %s", diff.Action)
+	}
+	if diff.Reason != "files: 8 to add" {
+		t.Errorf("Reason = %q", diff.Reason)
+	}
+	data, err := os.ReadFile(filepath.Join(target, "js", "vendor", "a.js"))
+	if err != nil || string(data) != "a()" {
+		t.Errorf("Expected nested file to be copied, got %q, %v", data, err)
+	}
+	if info, _ := os.Stat(filepath.Join(target, "index.html")); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected mode 0640, got %v", info.Mode().Perm())
+	}
+	for _, name := range []string{"notes.swp", ".git", "index.html.chisel.tmp"} {
+		if _, err := os.Stat(filepath.Join(target, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s not to be copied", name)
+		}
+	}
+
+	if diff := sync(); diff.Action != types.ActionNoop {
+		t.Errorf("Expected noop after apply, got %s: %s", diff.Action, diff.Reason)
+	}
+
+	// Change one file, drop a directory and leave stray files on the target
+	writeTree(t, source, map[string]string{"index.html": "<h1>updated</h1>"})
+	os.RemoveAll(filepath.Join(source, "img"))
+	writeTree(t, target, map[string]string{"stray.txt": "x", "old/a.txt": "x", "old/b.txt": "x", "editor.swp": "x"})
+	os.Chmod(filepath.Join(target, "css", "site.css"), 0600)
+
+	diff = sync()
+	want := map[string]string{
+		"updated":    "index.html",
+		"attributes": "css/site.css",
+		"removed":    "img/, old/, stray.txt",
+	}
+	for key, value := range want {
+		if diff.Changes[key] != value {
+			t.Errorf("Changes[%s] = %v, want %q", key, diff.Changes[key], value)
+		}
+	}
+	data, _ = os.ReadFile(filepath.Join(target, "index.html"))
+	if string(data) != "<h1>updated</h1>" {
+		t.Errorf("index.html = %q", data)
+	}
+	for _, name := range []string{"img", "old", "stray.txt"} {
+		if _, err := os.Stat(filepath.Join(target, name)); !os.IsNotExist(err) {
+			t.Errorf("Expected %s to be purged", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(target, "editor.swp")); err != nil {
+		t.Error("Expected excluded files to be kept by purge")
+	}
+
+	resource.State = types.StateAbsent
+	if diff := sync(); diff.Action != types.ActionDelete {
+		t.Errorf("Expected delete, got %s", diff.Action)
+	}
+	if _, err := os.Stat(target); !os.IsNotExist(err) {
+		t.Error("Expected the target directory to be removed")
+	}
+}
+
+func TestSyncProvider_ReplacesFileWithDirectory(t *testing.T) {
+	ctx := context.Background()
+	source := t.TempDir()
+	target := t.TempDir()
+	writeTree(t, source, map[string]string{"conf/app.conf": "port=80"})
+	writeTree(t, target, map[string]string{"conf": "not a directory"})
+
+	provider := NewSyncProvider(&ssh.LocalExecutor{})
+	resource := &types.Resource{Type: "sync", Name: "conf", Properties: map[string]interface{}{"source": source, "path": target}}
+	current, _ := provider.Read(ctx, resource)
+	diff, err := provider.Diff(ctx, resource, current)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if err := provider.Apply(ctx, resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(target, "conf", "app.conf"))
+	if err != nil || string(data) != "port=80" {
+		t.Errorf("Expected conf/app.conf to be copied, got %q, %v", data, err)
+	}
+}
@@ -0,0 +1,207 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// systemdUnitDir is where managed unit files are written by default
+const systemdUnitDir = "/etc/systemd/system"
+
+// systemdUnitSuffixes are the unit types recognised in resource names
+var systemdUnitSuffixes = []string{".service", ".timer", ".socket", ".target", ".mount", ".path"}
+
+// timerKeys maps timer properties to their [Timer] section directives, in output order
+var timerKeys = []struct {
+	property  string
+	directive string
+}{
+	{"on_calendar", "OnCalendar"},
+	{"on_boot_sec", "OnBootSec"},
+	{"on_unit_active_sec", "OnUnitActiveSec"},
+	{"randomized_delay_sec", "RandomizedDelaySec"},
+	{"unit", "Unit"},
+}
+
+// validateSystemd validates the systemd specific service properties
+func validateSystemd(resource *types.Resource) error {
+	if masked, ok := resource.Properties["masked"]; ok {
+		if _, ok := masked.(bool); !ok {
+			return fmt.Errorf("service 'masked' must be a boolean")
+		}
+	}
+
+	if unitFile, ok := resource.Properties["unit_file"]; ok {
+		if _, ok := unitFile.(string); !ok {
+			return fmt.Errorf("service 'unit_file' must be a string")
+		}
+	}
+
+	if unitPath, ok := resource.Properties["unit_path"]; ok {
+		if p, ok := unitPath.(string); !ok || !path.IsAbs(p) {
+			return fmt.Errorf("service 'unit_path' must be an absolute path")
+		}
+	}
+
+	if timer, ok := resource.Properties["timer"]; ok {
+		if _, ok := resource.Properties["unit_file"]; ok {
+			return fmt.Errorf("service cannot set both 'timer' and 'unit_file'")
+		}
+		settings, ok := timer.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("service 'timer' must be a map")
+		}
+		_, hasCalendar := settings["on_calendar"]
+		_, hasBoot := settings["on_boot_sec"]
+		_, hasActive := settings["on_unit_active_sec"]
+		if !hasCalendar && !hasBoot && !hasActive {
+			return fmt.Errorf("service 'timer' requires on_calendar, on_boot_sec or on_unit_active_sec")
+		}
+	}
+
+	return nil
+}
+
+// systemdProperty returns the first systemd specific property a resource
+// sets, or "" when it sets none
+func systemdProperty(resource *types.Resource) string {
+	for _, property := range []string{"masked", "unit_file", "unit_path", "timer"} {
+		if _, ok := resource.Properties[property]; ok {
+			return property
+		}
+	}
+	return ""
+}
+
+// unitName returns the systemd unit managed by a service resource.
+// Resources with a timer manage the <name>.timer unit.
+func unitName(resource *types.Resource) string {
+	if _, ok := resource.Properties["timer"]; ok && !strings.HasSuffix(resource.Name, ".timer") {
+		return resource.Name + ".timer"
+	}
+	return resource.Name
+}
+
+// unitPath returns where the unit file for a resource is written
+func unitPath(resource *types.Resource) string {
+	if p, ok := resource.Properties["unit_path"].(string); ok && p != "" {
+		return p
+	}
+
+	name := unitName(resource)
+	for _, suffix := range systemdUnitSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return path.Join(systemdUnitDir, name)
+		}
+	}
+	return path.Join(systemdUnitDir, name+".service")
+}
+
+// unitContent returns the desired unit file content, if the resource manages one
+func unitContent(resource *types.Resource) (string, bool) {
+	if content, ok := resource.Properties["unit_file"].(string); ok {
+		return strings.TrimRight(content, "\n"), true
+	}
+	if settings, ok := resource.Properties["timer"].(map[string]interface{}); ok {
+		return renderTimerUnit(resource, settings), true
+	}
+	return "", false
+}
+
+// renderTimerUnit renders a timer unit from the resource's timer settings
+func renderTimerUnit(resource *types.Resource, settings map[string]interface{}) string {
+	description, _ := settings["description"].(string)
+	if description == "" {
+		description = fmt.Sprintf("Timer for %s", strings.TrimSuffix(resource.Name, ".timer"))
+	}
+
+	var b strings.Builder
+	b.WriteString("[Unit]\n")
+	fmt.Fprintf(&b, "Description=%s\n", description)
+	b.WriteString("\n[Timer]\n")
+	for _, key := range timerKeys {
+		if value, ok := settings[key.property]; ok {
+			fmt.Fprintf(&b, "%s=%v\n", key.directive, value)
+		}
+	}
+	if persistent, ok := settings["persistent"].(bool); ok {
+		fmt.Fprintf(&b, "Persistent=%t\n", persistent)
+	}
+	b.WriteString("\n[Install]\n")
+	b.WriteString("WantedBy=timers.target")
+	return b.String()
+}
+
+// readUnitFile returns the current unit file content, or false if it does not exist
+func (p *ServiceProvider) readUnitFile(ctx context.Context, resource *types.Resource) (string, bool, error) {
+	result, err := p.connection.Execute(ctx, fmt.Sprintf("cat %s", shellEscape(unitPath(resource))))
+	if err != nil {
+		return "", false, fmt.Errorf("failed to read unit file: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return "", false, nil
+	}
+	return strings.TrimRight(result.Stdout, "\n"), true, nil
+}
+
+// writeUnitFile writes the unit file and reloads systemd so the change takes effect
+func (p *ServiceProvider) writeUnitFile(ctx context.Context, resource *types.Resource, content string) error {
+	filePath := unitPath(resource)
+
+	cmd := fmt.Sprintf("cat > %s << 'CHISEL_EOF'\n%s\nCHISEL_EOF", shellEscape(filePath), content)
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to write unit file %s: %w", filePath, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to write unit file %s: %s", filePath, result.Stderr)
+	}
+
+	return p.daemonReload(ctx)
+}
+
+// daemonReload reloads the systemd manager configuration
+func (p *ServiceProvider) daemonReload(ctx context.Context) error {
+	result, err := p.connection.Execute(ctx, "systemctl daemon-reload")
+	if err != nil {
+		return fmt.Errorf("failed to reload systemd: %w", err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to reload systemd: %s", result.Stderr)
+	}
+	return nil
+}
+
+// isServiceMasked checks if a unit is masked
+func (p *ServiceProvider) isServiceMasked(ctx context.Context, serviceName string) (bool, error) {
+	cmd := fmt.Sprintf("systemctl is-enabled %s", shellEscape(serviceName))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return false, err
+	}
+
+	// systemctl is-enabled prints "masked" (or "masked-runtime") for masked units
+	return strings.HasPrefix(strings.TrimSpace(result.Stdout), "masked"), nil
+}
+
+// setMasked masks or unmasks a unit
+func (p *ServiceProvider) setMasked(ctx context.Context, serviceName string, masked bool) error {
+	action := "unmask"
+	if masked {
+		action = "mask"
+	}
+
+	cmd := fmt.Sprintf("systemctl %s %s", action, shellEscape(serviceName))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return fmt.Errorf("failed to %s service %s: %w", action, serviceName, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to %s service %s: %s", action, serviceName, result.Stderr)
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// recordingConnection records executed commands and succeeds for all of them
+type recordingConnection struct {
+	MockSSHConnection
+	commands []string
+}
+
+func (r *recordingConnection) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	r.commands = append(r.commands, command)
+	if result, ok := r.responses[command]; ok {
+		return result, nil
+	}
+	return &ssh.ExecuteResult{Command: command, ExitCode: 0}, nil
+}
+
+func TestValidateSystemd(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		wantErr    bool
+	}{
+		{name: "masked", properties: map[string]interface{}{"masked": true}},
+		{name: "masked not boolean", properties: map[string]interface{}{"masked": "yes"}, wantErr: true},
+		{name: "unit file", properties: map[string]interface{}{"unit_file": "[Service]\nExecStart=/bin/true"}},
+		{name: "relative unit path", properties: map[string]interface{}{"unit_file": "", "unit_path": "app.service"}, wantErr: true},
+		{name: "timer", properties: map[string]interface{}{"timer": map[string]interface{}{"on_calendar": "daily"}}},
+		{name: "timer without schedule", properties: map[string]interface{}{"timer": map[string]interface{}{"persistent": true}}, wantErr: true},
+		{
+			name: "timer and unit file",
+			properties: map[string]interface{}{
+				"timer":     map[string]interface{}{"on_calendar": "daily"},
+				"unit_file": "[Timer]",
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "service", Name: "backup", State: types.StateRunning, Properties: tt.properties}
+			err := NewServiceProvider(nil).Validate(resource)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUnitPath(t *testing.T) {
+	tests := []struct {
+		name     string
+		resource types.Resource
+		want     string
+	}{
+		{name: "plain service", resource: types.Resource{Name: "app"}, want: "/etc/systemd/system/app.service"},
+		{name: "explicit suffix", resource: types.Resource{Name: "app.socket"}, want: "/etc/systemd/system/app.socket"},
+		{
+			name:     "timer",
+			resource: types.Resource{Name: "backup", Properties: map[string]interface{}{"timer": map[string]interface{}{}}},
+			want:     "/etc/systemd/system/backup.timer",
+		},
+		{
+			name:     "custom path",
+			resource: types.Resource{Name: "app", Properties: map[string]interface{}{"unit_path": "/lib/systemd/system/app.service"}},
+			want:     "/lib/systemd/system/app.service",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unitPath(&tt.resource); got != tt.want {
+				t.Errorf("unitPath() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderTimerUnit(t *testing.T) {
+	resource := &types.Resource{Name: "backup"}
+	content := renderTimerUnit(resource, map[string]interface{}{
+		"on_calendar": "*-*-* 02:00:00",
+		"persistent":  true,
+		"unit":        "backup.service",
+	})
+
+	for _, line := range []string{
+		"Description=Timer for backup",
+		"OnCalendar=*-*-* 02:00:00",
+		"Unit=backup.service",
+		"Persistent=true",
+		"WantedBy=timers.target",
+	} {
+		if !strings.Contains(content, line) {
+			t.Errorf("Expected timer unit to contain %q, got:\n%s", line, content)
+		}
+	}
+}
+
+func TestServiceProvider_DiffSystemd(t *testing.T) {
+	resource := &types.Resource{
+		Type:  "service",
+		Name:  "app",
+		State: types.StateRunning,
+		Properties: map[string]interface{}{
+			"masked":    false,
+			"unit_file": "[Service]\nExecStart=/usr/bin/app\n",
+		},
+	}
+
+	provider := NewServiceProvider(nil)
+
+	diff, err := provider.Diff(context.Background(), resource, map[string]interface{}{
+		"state":   "running",
+		"enabled": true,
+		"masked":  true,
+	})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if diff.Action != types.ActionUpdate {
+		t.Errorf("Expected update, got %s", diff.Action)
+	}
+	if _, ok := diff.Changes["masked"]; !ok {
+		t.Error("Expected masked change")
+	}
+	if change, ok := diff.Changes["unit_file"].(map[string]interface{}); !ok || change["from"] != "absent" {
+		t.Errorf("Expected unit_file change from absent, got %v", diff.Changes["unit_file"])
+	}
+
+	// Identical unit file and mask state produce no changes
+	diff, err = provider.Diff(context.Background(), resource, map[string]interface{}{
+		"state":     "running",
+		"enabled":   true,
+		"masked":    false,
+		"unit_file": "[Service]\nExecStart=/usr/bin/app",
+	})
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	if diff.Action != types.ActionNoop {
+		t.Errorf("Expected no-op, got %s with %v", diff.Action, diff.Changes)
+	}
+}
+
+func TestServiceProvider_ApplySystemd(t *testing.T) {
+	conn := &recordingConnection{}
+	provider := NewServiceProvider(conn)
+	provider.SetInitSystem("systemd")
+
+	resource := &types.Resource{
+		Type:  "service",
+		Name:  "backup",
+		State: types.StateRunning,
+		Properties: map[string]interface{}{
+			"masked": false,
+			"timer":  map[string]interface{}{"on_calendar": "daily"},
+		},
+	}
+	diff := &types.ResourceDiff{
+		Action: types.ActionUpdate,
+		Changes: map[string]interface{}{
+			"unit_file": map[string]interface{}{"from": "absent", "to": "/etc/systemd/system/backup.timer"},
+			"masked":    map[string]interface{}{"from": true, "to": false},
+			"state":     map[string]interface{}{"from": "stopped", "to": "running"},
+		},
+	}
+
+	if err := provider.Apply(context.Background(), resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+
+	want := []string{
+		"cat > '/etc/systemd/system/backup.timer'",
+		"systemctl daemon-reload",
+		"systemctl unmask 'backup.timer'",
+		"systemctl start 'backup.timer'",
+	}
+	if len(conn.commands) != len(want) {
+		t.Fatalf("Expected %d commands, got %v", len(want), conn.commands)
+	}
+	for i, prefix := range want {
+		if !strings.HasPrefix(conn.commands[i], prefix) {
+			t.Errorf("command[%d] = %q, want prefix %q", i, conn.commands[i], prefix)
+		}
+	}
+}
@@ -14,6 +14,7 @@ import (
 // UserProvider manages user resources
 type UserProvider struct {
 	connection ssh.Executor
+	osquery    *Osquery
 }
 
 // NewUserProvider creates a new user provider
@@ -23,11 +24,25 @@ func NewUserProvider(connection ssh.Executor) *UserProvider {
 	}
 }
 
+// SetOsquery sets the snapshot users are read from where it can answer
+func (p *UserProvider) SetOsquery(snapshot *Osquery) {
+	p.osquery = snapshot
+}
+
 // Type returns the resource type this provider handles
 func (p *UserProvider) Type() string {
 	return "user"
 }
 
+// Capabilities returns the targets this provider can manage
+func (p *UserProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux},
+		Commands:   []string{"useradd"},
+		Privileged: []string{"cat", "chmod", "chown", "chpasswd", "getent", "mkdir", "tee", "useradd", "userdel", "usermod"},
+	}
+}
+
 // Validate validates the user resource configuration
 func (p *UserProvider) Validate(resource *types.Resource) error {
 	// Check state - can be in State field or Properties map
@@ -94,12 +109,23 @@ func (p *UserProvider) Validate(resource *types.Resource) error {
 		}
 	}
 	
-	return nil
+	return validateAccount(resource)
 }
 
 // Read reads the current state of the user
 func (p *UserProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
 	username := resource.Name
+
+	if info, known := p.osquery.User(username); known {
+		state, err := p.readSnapshotUser(ctx, resource, info)
+		if err != nil {
+			return nil, err
+		}
+		if err := p.readAccount(ctx, resource, state); err != nil {
+			return nil, err
+		}
+		return state, nil
+	}
 	
 	// Check if user exists
 	exists, err := p.userExists(ctx, username)
@@ -127,6 +153,10 @@ func (p *UserProvider) Read(ctx context.Context, resource *types.Resource) (map[
 		state[k] = v
 	}
 	
+	if err := p.readAccount(ctx, resource, state); err != nil {
+		return nil, err
+	}
+	
 	return state, nil
 }
 
@@ -199,6 +229,10 @@ func (p *UserProvider) Diff(ctx context.Context, resource *types.Resource, curre
 			}
 		}
 		
+		if diffAccount(resource, current, diff) {
+			hasChanges = true
+		}
+		
 		if hasChanges {
 			diff.Action = types.ActionUpdate
 			diff.Reason = "user properties need to be updated"
@@ -216,6 +250,7 @@ func (p *UserProvider) Diff(ctx context.Context, resource *types.Resource, curre
 
 // Apply applies the changes to bring the user to desired state
 func (p *UserProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	defer p.osquery.ForgetUser(resource.Name)
 	switch diff.Action {
 	case types.ActionCreate:
 		return p.createUser(ctx, resource)
@@ -230,6 +265,25 @@ func (p *UserProvider) Apply(ctx context.Context, resource *types.Resource, diff
 	}
 }
 
+// readSnapshotUser builds a user's state from the osquery snapshot. Group
+// membership is not in the snapshot and is only read when the resource
+// manages it.
+func (p *UserProvider) readSnapshotUser(ctx context.Context, resource *types.Resource, info map[string]interface{}) (map[string]interface{}, error) {
+	if info == nil {
+		return map[string]interface{}{"state": "absent"}, nil
+	}
+	state := map[string]interface{}{"state": "present"}
+	for k, v := range info {
+		state[k] = v
+	}
+	if _, managed := resource.Properties["groups"]; managed {
+		if groups, err := p.userGroups(ctx, resource.Name); err == nil && groups != nil {
+			state["groups"] = groups
+		}
+	}
+	return state, nil
+}
+
 // userExists checks if a user exists
 func (p *UserProvider) userExists(ctx context.Context, username string) (bool, error) {
 	cmd := fmt.Sprintf("id -u %s 2>/dev/null", shellEscape(username))
@@ -270,23 +324,33 @@ func (p *UserProvider) getUserInfo(ctx context.Context, username string) (map[st
 	}
 	
 	// Get groups
-	cmd = fmt.Sprintf("groups %s", shellEscape(username))
-	result, err = p.connection.Execute(ctx, cmd)
-	if err == nil && result.ExitCode == 0 {
-		// Parse groups output: "username : group1 group2 group3"
-		output := strings.TrimSpace(result.Stdout)
-		if colonIndex := strings.Index(output, ":"); colonIndex != -1 {
-			groupsStr := strings.TrimSpace(output[colonIndex+1:])
-			if groupsStr != "" {
-				groups := strings.Fields(groupsStr)
-				info["groups"] = groups
-			}
-		}
+	if groups, err := p.userGroups(ctx, username); err == nil && groups != nil {
+		info["groups"] = groups
 	}
 	
 	return info, nil
 }
 
+// userGroups returns the groups a user belongs to
+func (p *UserProvider) userGroups(ctx context.Context, username string) ([]string, error) {
+	cmd := fmt.Sprintf("groups %s", shellEscape(username))
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return nil, err
+	}
+	if result.ExitCode != 0 {
+		return nil, fmt.Errorf("failed to get groups: %s", result.Stderr)
+	}
+	// Parse groups output: "username : group1 group2 group3"
+	output := strings.TrimSpace(result.Stdout)
+	if colonIndex := strings.Index(output, ":"); colonIndex != -1 {
+		if groupsStr := strings.TrimSpace(output[colonIndex+1:]); groupsStr != "" {
+			return strings.Fields(groupsStr), nil
+		}
+	}
+	return nil, nil
+}
+
 // createUser creates a new user
 func (p *UserProvider) createUser(ctx context.Context, resource *types.Resource) error {
 	username := resource.Name
@@ -329,7 +393,7 @@ func (p *UserProvider) createUser(ctx context.Context, resource *types.Resource)
 		}
 	}
 	
-	return nil
+	return p.applyAccount(ctx, resource, accountChanges(resource))
 }
 
 // updateUser updates an existing user
@@ -390,7 +454,7 @@ func (p *UserProvider) updateUser(ctx context.Context, resource *types.Resource,
 		}
 	}
 	
-	return nil
+	return p.applyAccount(ctx, resource, diff.Changes)
 }
 
 // deleteUser removes a user
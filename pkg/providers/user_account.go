@@ -0,0 +1,257 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/redact"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// expiryLayout is the format of account expiry dates
+const expiryLayout = "2006-01-02"
+
+// expiryNever is the expiry of accounts that do not expire
+const expiryNever = "never"
+
+// validateAccount validates the password, SSH key, locking and expiry
+// properties of a user
+func validateAccount(resource *types.Resource) error {
+	if password, ok := resource.Properties["password"]; ok {
+		hash, ok := password.(string)
+		if !ok {
+			return fmt.Errorf("user 'password' must be a string")
+		}
+		// Crypted hashes look like $id$salt$hash; plain text is never sent
+		if !strings.HasPrefix(hash, "$") || strings.Count(hash, "$") < 3 || strings.ContainsAny(hash, ":\n") {
+			return fmt.Errorf("user 'password' must be a crypted hash, such as the output of mkpasswd -m sha-512")
+		}
+	}
+
+	if keys, ok := resource.Properties["ssh_authorized_keys"]; ok {
+		list, ok := keys.([]interface{})
+		if !ok {
+			return fmt.Errorf("user 'ssh_authorized_keys' must be a list of keys")
+		}
+		for _, key := range list {
+			line, ok := key.(string)
+			if !ok || strings.TrimSpace(line) == "" || strings.Contains(line, "\n") {
+				return fmt.Errorf("user 'ssh_authorized_keys' must be a list of keys, one line each")
+			}
+		}
+	}
+
+	if locked, ok := resource.Properties["locked"]; ok {
+		if _, ok := locked.(bool); !ok {
+			return fmt.Errorf("user 'locked' must be a boolean")
+		}
+	}
+
+	if expires, ok := resource.Properties["expires"]; ok {
+		date, ok := expires.(string)
+		if !ok {
+			return fmt.Errorf("user 'expires' must be a date (YYYY-MM-DD) or never")
+		}
+		if _, err := time.Parse(expiryLayout, date); err != nil && date != expiryNever {
+			return fmt.Errorf("user 'expires' must be a date (YYYY-MM-DD) or never, got %s", date)
+		}
+	}
+
+	return nil
+}
+
+// authorizedKeys returns the keys a user resource asks for
+func authorizedKeys(resource *types.Resource) ([]string, bool) {
+	list, ok := resource.Properties["ssh_authorized_keys"].([]interface{})
+	if !ok {
+		return nil, false
+	}
+	keys := make([]string, 0, len(list))
+	for _, key := range list {
+		if line, ok := key.(string); ok {
+			keys = append(keys, strings.TrimSpace(line))
+		}
+	}
+	return keys, true
+}
+
+// managesShadow reports whether a resource manages anything of the user's
+// shadow entry, which only root can read
+func managesShadow(resource *types.Resource) bool {
+	for _, property := range []string{"password", "locked", "expires"} {
+		if _, ok := resource.Properties[property]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// readAccount adds the password hash, locking, expiry and authorized keys
+// of an existing user to its state, for the ones the resource manages
+func (p *UserProvider) readAccount(ctx context.Context, resource *types.Resource, state map[string]interface{}) error {
+	if state["state"] != "present" {
+		return nil
+	}
+	username := resource.Name
+
+	if managesShadow(resource) {
+		result, err := p.connection.Execute(ctx, fmt.Sprintf("getent shadow %s", shellEscape(username)))
+		if err != nil {
+			return fmt.Errorf("failed to read shadow entry of %s: %w", username, err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to read shadow entry of %s, which needs root: %s", username, strings.TrimSpace(result.Stderr))
+		}
+		// Parse shadow entry: name:password:lastchg:min:max:warn:inactive:expire:
+		// An entry that does not parse leaves the settings unknown, so they
+		// are planned as changes
+		if fields := strings.Split(strings.TrimSpace(result.Stdout), ":"); len(fields) >= 8 {
+			// Locking prefixes the hash with !
+			state["locked"] = strings.HasPrefix(fields[1], "!")
+			state["password"] = strings.TrimLeft(fields[1], "!")
+			state["expires"] = expiryNever
+			if days, err := strconv.ParseInt(fields[7], 10, 64); err == nil && days >= 0 {
+				state["expires"] = time.Unix(days*24*60*60, 0).UTC().Format(expiryLayout)
+			}
+		}
+	}
+
+	if _, ok := authorizedKeys(resource); ok {
+		home, _ := state["home"].(string)
+		keys := make([]string, 0)
+		if home != "" {
+			result, err := p.connection.Execute(ctx, fmt.Sprintf("cat %s 2>/dev/null", shellEscape(path.Join(home, ".ssh", "authorized_keys"))))
+			if err != nil {
+				return fmt.Errorf("failed to read authorized keys of %s: %w", username, err)
+			}
+			// A missing file has no keys
+			if result.ExitCode == 0 {
+				for _, line := range strings.Split(result.Stdout, "\n") {
+					if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+						keys = append(keys, line)
+					}
+				}
+			}
+		}
+		state["ssh_authorized_keys"] = keys
+	}
+	return nil
+}
+
+// diffAccount adds the password, locking, expiry and authorized key
+// changes of a user to its diff and reports whether there were any.
+// Password hashes are redacted.
+func diffAccount(resource *types.Resource, current map[string]interface{}, diff *types.ResourceDiff) bool {
+	hasChanges := false
+
+	if desired, ok := resource.Properties["password"].(string); ok {
+		if currentHash, _ := current["password"].(string); currentHash != desired {
+			from := redact.Placeholder
+			if currentHash == "" {
+				from = "none"
+			}
+			hasChanges = true
+			diff.Changes["password"] = map[string]interface{}{"from": from, "to": redact.Placeholder}
+		}
+	}
+
+	if desired, ok := resource.Properties["locked"].(bool); ok {
+		if currentLocked, _ := current["locked"].(bool); currentLocked != desired {
+			hasChanges = true
+			diff.Changes["locked"] = map[string]interface{}{"from": currentLocked, "to": desired}
+		}
+	}
+
+	if desired, ok := resource.Properties["expires"].(string); ok {
+		if currentExpiry, _ := current["expires"].(string); currentExpiry != desired {
+			hasChanges = true
+			diff.Changes["expires"] = map[string]interface{}{"from": currentExpiry, "to": desired}
+		}
+	}
+
+	if desired, ok := authorizedKeys(resource); ok {
+		currentKeys, _ := current["ssh_authorized_keys"].([]string)
+		if !reflect.DeepEqual(currentKeys, desired) && (len(currentKeys) > 0 || len(desired) > 0) {
+			hasChanges = true
+			diff.Changes["ssh_authorized_keys"] = map[string]interface{}{
+				"from": fmt.Sprintf("%d key(s)", len(currentKeys)),
+				"to":   fmt.Sprintf("%d key(s)", len(desired)),
+			}
+		}
+	}
+
+	return hasChanges
+}
+
+// applyAccount sets the password, locking, expiry and authorized keys of a
+// user that have changes. The password is set first, keeping the account
+// locked if it was, so a lock change applies on top of it.
+func (p *UserProvider) applyAccount(ctx context.Context, resource *types.Resource, changes map[string]interface{}) error {
+	username := shellEscape(resource.Name)
+	var commands []string
+
+	if _, ok := changes["password"]; ok {
+		// printf is a shell builtin, so the hash never shows in the process
+		// list. Accounts without a password also start with !, but are not
+		// locked.
+		hash := resource.Properties["password"].(string)
+		commands = append(commands, fmt.Sprintf(
+			`locked=$(getent shadow %[1]s | cut -d: -f2 | grep -c '^!\$'); printf '%%s\n' %[2]s | chpasswd -e && if [ "$locked" = 1 ]; then usermod -L %[1]s; fi`,
+			username, shellEscape(resource.Name+":"+hash)))
+	}
+
+	if change, ok := changes["locked"]; ok {
+		if change.(map[string]interface{})["to"].(bool) {
+			commands = append(commands, fmt.Sprintf("usermod -L %s", username))
+		} else {
+			commands = append(commands, fmt.Sprintf("usermod -U %s", username))
+		}
+	}
+
+	if change, ok := changes["expires"]; ok {
+		expires := change.(map[string]interface{})["to"].(string)
+		if expires == expiryNever {
+			expires = ""
+		}
+		commands = append(commands, fmt.Sprintf("usermod -e %s %s", shellEscape(expires), username))
+	}
+
+	if _, ok := changes["ssh_authorized_keys"]; ok {
+		keys, _ := authorizedKeys(resource)
+		write := ": >"
+		if len(keys) > 0 {
+			quoted := make([]string, len(keys))
+			for i, key := range keys {
+				quoted[i] = shellEscape(key)
+			}
+			write = fmt.Sprintf("printf '%%s\\n' %s >", strings.Join(quoted, " "))
+		}
+		commands = append(commands, fmt.Sprintf(
+			`home=$(getent passwd %[1]s | cut -d: -f6) && [ -n "$home" ] && mkdir -p "$home/.ssh" && %[2]s "$home/.ssh/authorized_keys" && chmod 700 "$home/.ssh" && chmod 600 "$home/.ssh/authorized_keys" && chown %[1]s: "$home/.ssh" "$home/.ssh/authorized_keys"`,
+			username, write))
+	}
+
+	for _, cmd := range commands {
+		result, err := p.connection.Execute(ctx, cmd)
+		if err != nil {
+			return fmt.Errorf("failed to update account of user %s: %w", resource.Name, err)
+		}
+		if result.ExitCode != 0 {
+			return fmt.Errorf("failed to update account of user %s: %s", resource.Name, strings.TrimSpace(result.Stderr))
+		}
+	}
+	return nil
+}
+
+// accountChanges returns the account settings of a new user as changes, so
+// applyAccount sets every one the resource asks for
+func accountChanges(resource *types.Resource) map[string]interface{} {
+	diff := &types.ResourceDiff{Changes: make(map[string]interface{})}
+	diffAccount(resource, map[string]interface{}{"expires": expiryNever}, diff)
+	return diff.Changes
+}
@@ -0,0 +1,131 @@
+package providers
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+const testHash = "$6$salt$Vb0nJwqY3e2bKhFjVkXx0"
+
+func TestValidateAccount(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties map[string]interface{}
+		wantErr    string
+	}{
+		{name: "all settings", properties: map[string]interface{}{"password": testHash, "ssh_authorized_keys": []interface{}{"ssh-ed25519 AAAA deploy@laptop"}, "locked": true, "expires": "2027-06-30"}},
+		{name: "never expires", properties: map[string]interface{}{"expires": "never"}},
+		{name: "plain password", properties: map[string]interface{}{"password": "hunter2"}, wantErr: "user 'password' must be a crypted hash"},
+		{name: "keys not a list", properties: map[string]interface{}{"ssh_authorized_keys": "ssh-ed25519 AAAA"}, wantErr: "user 'ssh_authorized_keys' must be a list of keys"},
+		{name: "empty key", properties: map[string]interface{}{"ssh_authorized_keys": []interface{}{" "}}, wantErr: "one line each"},
+		{name: "locked not boolean", properties: map[string]interface{}{"locked": "yes"}, wantErr: "user 'locked' must be a boolean"},
+		{name: "bad expiry", properties: map[string]interface{}{"expires": "30/06/2027"}, wantErr: "user 'expires' must be a date (YYYY-MM-DD) or never, got 30/06/2027"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "user", Name: "deploy", State: types.StatePresent, Properties: tt.properties}
+			err := NewUserProvider(nil).Validate(resource)
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Validate() error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserProvider_Account(t *testing.T) {
+	resource := &types.Resource{
+		Type:  "user",
+		Name:  "deploy",
+		State: types.StatePresent,
+		Properties: map[string]interface{}{
+			"password":            testHash,
+			"ssh_authorized_keys": []interface{}{"ssh-ed25519 AAAA deploy@laptop", "ssh-ed25519 BBBB ci"},
+			"locked":              false,
+			"expires":             "2027-06-30",
+		},
+	}
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		"id -u 'deploy' 2>/dev/null":                          {Stdout: "1001\n"},
+		"getent passwd 'deploy'":                              {Stdout: "deploy:x:1001:1001::/home/deploy:/bin/bash\n"},
+		"groups 'deploy'":                                     {Stdout: "deploy : deploy\n"},
+		"getent shadow 'deploy'":                              {Stdout: "deploy:!$6$old$hash:19000:0:99999:7:::\n"},
+		"cat '/home/deploy/.ssh/authorized_keys' 2>/dev/null": {Stdout: "# managed\nssh-ed25519 AAAA deploy@laptop\n"},
+	}}}
+	provider := NewUserProvider(conn)
+
+	current, err := provider.Read(context.Background(), resource)
+	if err != nil {
+		t.Fatalf("Read() error = %v", err)
+	}
+	if current["password"] != "$6$old$hash" || current["locked"] != true || current["expires"] != "never" {
+		t.Errorf("Read() = %v", current)
+	}
+	if keys := current["ssh_authorized_keys"]; !reflect.DeepEqual(keys, []string{"ssh-ed25519 AAAA deploy@laptop"}) {
+		t.Errorf("Read() keys = %v", keys)
+	}
+
+	diff, err := provider.Diff(context.Background(), resource, current)
+	if err != nil {
+		t.Fatalf("Diff() error = %v", err)
+	}
+	want := map[string]interface{}{
+		"password":            map[string]interface{}{"from": "[REDACTED]", "to": "[REDACTED]"},
+		"locked":              map[string]interface{}{"from": true, "to": false},
+		"expires":             map[string]interface{}{"from": "never", "to": "2027-06-30"},
+		"ssh_authorized_keys": map[string]interface{}{"from": "1 key(s)", "to": "2 key(s)"},
+	}
+	if diff.Action != types.ActionUpdate || !reflect.DeepEqual(diff.Changes, want) {
+		t.Fatalf("Diff() = %s with %v", diff.Action, diff.Changes)
+	}
+
+	conn.commands = nil
+	if err := provider.Apply(context.Background(), resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	wantCommands := []string{
+		`locked=$(getent shadow 'deploy' | cut -d: -f2 | grep -c '^!\$'); printf '%s\n' 'deploy:` + testHash + `' | chpasswd -e && if [ "$locked" = 1 ]; then usermod -L 'deploy'; fi`,
+		"usermod -U 'deploy'",
+		"usermod -e '2027-06-30' 'deploy'",
+		`home=$(getent passwd 'deploy' | cut -d: -f6) && [ -n "$home" ] && mkdir -p "$home/.ssh" && printf '%s\n' 'ssh-ed25519 AAAA deploy@laptop' 'ssh-ed25519 BBBB ci' > "$home/.ssh/authorized_keys" && chmod 700 "$home/.ssh" && chmod 600 "$home/.ssh/authorized_keys" && chown 'deploy': "$home/.ssh" "$home/.ssh/authorized_keys"`,
+	}
+	if !reflect.DeepEqual(conn.commands, wantCommands) {
+		t.Errorf("commands =\n%s\nwant\n%s", strings.Join(conn.commands, "\n"), strings.Join(wantCommands, "\n"))
+	}
+
+	// Once applied, nothing is left to change
+	current = map[string]interface{}{
+		"state": "present", "uid": 1001, "gid": 1001, "home": "/home/deploy", "shell": "/bin/bash",
+		"password": testHash, "locked": false, "expires": "2027-06-30",
+		"ssh_authorized_keys": []string{"ssh-ed25519 AAAA deploy@laptop", "ssh-ed25519 BBBB ci"},
+	}
+	if diff, _ := provider.Diff(context.Background(), resource, current); diff.Action != types.ActionNoop {
+		t.Errorf("Diff() after apply = %s with %v", diff.Action, diff.Changes)
+	}
+}
+
+func TestUserProvider_CreateWithAccount(t *testing.T) {
+	resource := &types.Resource{
+		Type:       "user",
+		Name:       "deploy",
+		State:      types.StatePresent,
+		Properties: map[string]interface{}{"expires": "never", "locked": true, "ssh_authorized_keys": []interface{}{}},
+	}
+	conn := &recordingConnection{}
+	provider := NewUserProvider(conn)
+	if err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionCreate}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	// A new account never expires and has no keys file to empty
+	want := []string{"useradd 'deploy'", "usermod -L 'deploy'"}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("commands = %q, want %q", conn.commands, want)
+	}
+}
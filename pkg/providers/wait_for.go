@@ -0,0 +1,282 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/clock"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+const (
+	// defaultWaitHost is the host probed for a port when none is given
+	defaultWaitHost = "127.0.0.1"
+	// defaultWaitTimeout is how long to wait for a condition, in seconds
+	defaultWaitTimeout = 300
+	// defaultWaitInterval is how long to wait between checks, in seconds
+	defaultWaitInterval = 5
+	// waitProbeTimeout bounds a single check, in seconds
+	waitProbeTimeout = 5
+)
+
+// WaitForProvider blocks until a condition holds on the target: a TCP port
+// accepts connections, an HTTP endpoint returns the expected status, or a
+// path exists. With state absent it waits for the condition to stop holding.
+type WaitForProvider struct {
+	connection ssh.Executor
+	osquery    *Osquery
+	sleep      func(ctx context.Context, d time.Duration) error
+}
+
+// NewWaitForProvider creates a new wait_for provider
+func NewWaitForProvider(connection ssh.Executor) *WaitForProvider {
+	return &WaitForProvider{
+		connection: connection,
+		sleep:      clock.Sleep,
+	}
+}
+
+// SetOsquery sets the snapshot local ports are read from where it can answer
+func (p *WaitForProvider) SetOsquery(snapshot *Osquery) {
+	p.osquery = snapshot
+}
+
+// Type returns the resource type this provider handles
+func (p *WaitForProvider) Type() string {
+	return "wait_for"
+}
+
+// Capabilities returns the targets this provider can manage
+func (p *WaitForProvider) Capabilities() types.Capabilities {
+	return types.Capabilities{
+		OSFamilies: []string{types.OSFamilyLinux, types.OSFamilyDarwin},
+	}
+}
+
+// Validate validates the wait_for resource configuration
+func (p *WaitForProvider) Validate(resource *types.Resource) error {
+	switch waitState(resource) {
+	case types.StatePresent, types.StateAbsent:
+	default:
+		return fmt.Errorf("invalid wait_for state '%s', must be one of: present, absent", waitState(resource))
+	}
+
+	conditions := 0
+	for _, key := range []string{"port", "url", "path"} {
+		if _, ok := resource.Properties[key]; ok {
+			conditions++
+		}
+	}
+	if conditions != 1 {
+		return fmt.Errorf("wait_for resource must have exactly one of 'port', 'url' or 'path'")
+	}
+
+	for _, key := range []string{"host", "url", "path"} {
+		if value, ok := resource.Properties[key]; ok {
+			if s, ok := value.(string); !ok || s == "" {
+				return fmt.Errorf("wait_for '%s' must be a non-empty string", key)
+			}
+		}
+	}
+	if _, ok := resource.Properties["host"]; ok {
+		if _, ok := resource.Properties["port"]; !ok {
+			return fmt.Errorf("wait_for 'host' can only be used with 'port'")
+		}
+	}
+	if _, ok := resource.Properties["status"]; ok {
+		if _, ok := resource.Properties["url"]; !ok {
+			return fmt.Errorf("wait_for 'status' can only be used with 'url'")
+		}
+	}
+	if url, ok := resource.Properties["url"].(string); ok {
+		if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Errorf("wait_for 'url' must start with http:// or https://")
+		}
+	}
+
+	limits := []struct {
+		key string
+		max int
+	}{{"port", 65535}, {"status", 599}, {"timeout", 0}, {"interval", 0}}
+	for _, limit := range limits {
+		value, ok := resource.Properties[limit.key]
+		if !ok {
+			continue
+		}
+		n, ok := value.(int)
+		if !ok || n <= 0 || (limit.max > 0 && n > limit.max) {
+			if limit.max > 0 {
+				return fmt.Errorf("wait_for '%s' must be an integer between 1 and %d", limit.key, limit.max)
+			}
+			return fmt.Errorf("wait_for '%s' must be a positive integer", limit.key)
+		}
+	}
+
+	return nil
+}
+
+// Read checks the condition once. Local ports are looked up in the osquery
+// snapshot where it has them; applies always probe.
+func (p *WaitForProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	met, known := false, false
+	if port, ok := resource.Properties["port"].(int); ok {
+		host := defaultWaitHost
+		if h, ok := resource.Properties["host"].(string); ok {
+			host = h
+		}
+		met, known = p.osquery.Listening(host, port)
+	}
+	if !known {
+		var err error
+		if met, err = p.check(ctx, resource); err != nil {
+			return nil, err
+		}
+	}
+	return map[string]interface{}{
+		"condition": waitCondition(resource),
+		"met":       met,
+	}, nil
+}
+
+// Diff always plans a wait: what holds while planning says little about what
+// holds once the resources before it are applied, such as a service restarted
+func (p *WaitForProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	diff := &types.ResourceDiff{
+		ResourceID: resource.ResourceID(),
+		Action:     types.ActionUpdate,
+		Changes:    make(map[string]interface{}),
+	}
+
+	want := waitState(resource) == types.StatePresent
+	met, _ := current["met"].(bool)
+	if met == want {
+		diff.Reason = fmt.Sprintf("will check that %s is still %s", waitCondition(resource), waitDescription(want))
+		return diff, nil
+	}
+
+	diff.Reason = fmt.Sprintf("will wait until %s is %s", waitCondition(resource), waitDescription(want))
+	diff.Changes["condition"] = map[string]interface{}{
+		"from": waitDescription(met),
+		"to":   waitDescription(want),
+	}
+	return diff, nil
+}
+
+// Apply polls the condition until it reaches the desired state or the timeout passes
+func (p *WaitForProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	switch diff.Action {
+	case types.ActionUpdate:
+	case types.ActionNoop:
+		return nil
+	default:
+		return fmt.Errorf("unsupported action: %s", diff.Action)
+	}
+
+	want := waitState(resource) == types.StatePresent
+	timeout := time.Duration(waitSetting(resource, "timeout", defaultWaitTimeout)) * time.Second
+	interval := time.Duration(waitSetting(resource, "interval", defaultWaitInterval)) * time.Second
+
+	var waited time.Duration
+	for {
+		met, err := p.check(ctx, resource)
+		if err != nil {
+			return err
+		}
+		if met == want {
+			return nil
+		}
+		if waited >= timeout {
+			return fmt.Errorf("timed out after %s waiting for %s to be %s", timeout, waitCondition(resource), waitDescription(want))
+		}
+		if err := p.sleep(ctx, interval); err != nil {
+			return err
+		}
+		waited += interval
+	}
+}
+
+// check runs a single probe of the condition on the target
+func (p *WaitForProvider) check(ctx context.Context, resource *types.Resource) (bool, error) {
+	cmd := waitCommand(resource)
+	result, err := p.connection.Execute(ctx, cmd)
+	if err != nil {
+		return false, fmt.Errorf("failed to check %s: %w", waitCondition(resource), err)
+	}
+
+	if _, ok := resource.Properties["url"]; !ok {
+		return result.ExitCode == 0, nil
+	}
+	status, err := strconv.Atoi(strings.TrimSpace(result.Stdout))
+	if err != nil {
+		// No response at all, e.g. connection refused
+		return false, nil
+	}
+	return status == waitSetting(resource, "status", 200), nil
+}
+
+// waitCommand returns the probe for the resource's condition
+func waitCommand(resource *types.Resource) string {
+	if url, ok := resource.Properties["url"].(string); ok {
+		return fmt.Sprintf("if command -v curl >/dev/null 2>&1; then curl -s -o /dev/null -w '%%{http_code}' --max-time %d %s; "+
+			"else wget -S -q -O /dev/null -T %d %s 2>&1 | awk '/^  HTTP\\//{code=$2} END{print code}'; fi",
+			waitProbeTimeout, shellEscape(url), waitProbeTimeout, shellEscape(url))
+	}
+	if path, ok := resource.Properties["path"].(string); ok {
+		return fmt.Sprintf("test -e %s", shellEscape(path))
+	}
+
+	host := defaultWaitHost
+	if h, ok := resource.Properties["host"].(string); ok {
+		host = h
+	}
+	return portProbe(host, resource.Properties["port"].(int))
+}
+
+// portProbe returns a command that succeeds when host accepts connections on port
+func portProbe(host string, port int) string {
+	return fmt.Sprintf("nc -z -w %d %s %d >/dev/null 2>&1 || timeout %d bash -c %s >/dev/null 2>&1",
+		waitProbeTimeout, shellEscape(host), port, waitProbeTimeout, shellEscape(fmt.Sprintf("exec 3<>/dev/tcp/%s/%d", host, port)))
+}
+
+// waitCondition describes the resource's condition for plans and errors
+func waitCondition(resource *types.Resource) string {
+	if url, ok := resource.Properties["url"].(string); ok {
+		return fmt.Sprintf("%s returning %d", url, waitSetting(resource, "status", 200))
+	}
+	if path, ok := resource.Properties["path"].(string); ok {
+		return "path " + path
+	}
+	host := defaultWaitHost
+	if h, ok := resource.Properties["host"].(string); ok {
+		host = h
+	}
+	return fmt.Sprintf("port %s:%v", host, resource.Properties["port"])
+}
+
+// waitDescription names whether a condition holds
+func waitDescription(met bool) string {
+	if met {
+		return "ready"
+	}
+	return "not ready"
+}
+
+// waitSetting returns an integer property or its default
+func waitSetting(resource *types.Resource, key string, fallback int) int {
+	if value, ok := resource.Properties[key].(int); ok {
+		return value
+	}
+	return fallback
+}
+
+// waitState returns the desired state, defaulting to present
+func waitState(resource *types.Resource) types.ResourceState {
+	if resource.State == "" {
+		return types.StatePresent
+	}
+	return resource.State
+}
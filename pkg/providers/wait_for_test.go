@@ -0,0 +1,190 @@
+package providers
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// scriptedConnection returns queued results for each command in turn
+type scriptedConnection struct {
+	MockSSHConnection
+	results  []*ssh.ExecuteResult
+	commands []string
+}
+
+func (s *scriptedConnection) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	s.commands = append(s.commands, command)
+	if len(s.results) == 0 {
+		return &ssh.ExecuteResult{Command: command, ExitCode: 1}, nil
+	}
+	result := s.results[0]
+	s.results = s.results[1:]
+	return result, nil
+}
+
+func TestWaitForProvider_Validate(t *testing.T) {
+	provider := NewWaitForProvider(nil)
+
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		properties map[string]interface{}
+		wantErr    string
+	}{
+		{name: "port", properties: map[string]interface{}{"port": 8080, "timeout": 60, "interval": 2}},
+		{name: "port on another host", properties: map[string]interface{}{"port": 5432, "host": "db.internal"}},
+		{name: "url", properties: map[string]interface{}{"url": "http://localhost:8080/health", "status": 204}},
+		{name: "path absent", state: types.StateAbsent, properties: map[string]interface{}{"path": "/var/lib/app/migrating"}},
+		{name: "no condition", properties: map[string]interface{}{"timeout": 60}, wantErr: "exactly one of"},
+		{name: "two conditions", properties: map[string]interface{}{"port": 80, "path": "/tmp/x"}, wantErr: "exactly one of"},
+		{name: "port out of range", properties: map[string]interface{}{"port": 70000}, wantErr: "'port' must be an integer between 1 and 65535"},
+		{name: "port as string", properties: map[string]interface{}{"port": "80"}, wantErr: "'port' must be an integer"},
+		{name: "negative timeout", properties: map[string]interface{}{"port": 80, "timeout": -1}, wantErr: "'timeout' must be a positive integer"},
+		{name: "host without port", properties: map[string]interface{}{"path": "/tmp/x", "host": "db"}, wantErr: "'host' can only be used with 'port'"},
+		{name: "status without url", properties: map[string]interface{}{"port": 80, "status": 200}, wantErr: "'status' can only be used with 'url'"},
+		{name: "url scheme", properties: map[string]interface{}{"url": "localhost:8080"}, wantErr: "must start with http://"},
+		{name: "invalid state", state: "running", properties: map[string]interface{}{"port": 80}, wantErr: "invalid wait_for state"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resource := &types.Resource{Type: "wait_for", Name: "app", State: tt.state, Properties: tt.properties}
+			err := provider.Validate(resource)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestWaitForProvider_Diff(t *testing.T) {
+	tests := []struct {
+		name       string
+		state      types.ResourceState
+		properties map[string]interface{}
+		result     ssh.ExecuteResult
+		wantAction types.DiffAction
+		wantReason string
+	}{
+		{
+			name:       "port already open",
+			properties: map[string]interface{}{"port": 8080},
+			result:     ssh.ExecuteResult{ExitCode: 0},
+			wantAction: types.ActionUpdate,
+			wantReason: "will check that port 127.0.0.1:8080 is still ready",
+		},
+		{
+			name:       "port closed",
+			properties: map[string]interface{}{"port": 8080},
+			result:     ssh.ExecuteResult{ExitCode: 1},
+			wantAction: types.ActionUpdate,
+			wantReason: "will wait until port 127.0.0.1:8080 is ready",
+		},
+		{
+			name:       "endpoint unhealthy",
+			properties: map[string]interface{}{"url": "http://localhost/health"},
+			result:     ssh.ExecuteResult{Stdout: "503"},
+			wantAction: types.ActionUpdate,
+			wantReason: "will wait until http://localhost/health returning 200 is ready",
+		},
+		{
+			name:       "endpoint with expected status",
+			properties: map[string]interface{}{"url": "http://localhost/health", "status": 204},
+			result:     ssh.ExecuteResult{Stdout: "204"},
+			wantAction: types.ActionUpdate,
+			wantReason: "will check that http://localhost/health returning 204 is still ready",
+		},
+		{
+			name:       "lock file still present",
+			state:      types.StateAbsent,
+			properties: map[string]interface{}{"path": "/var/lib/app/migrating"},
+			result:     ssh.ExecuteResult{ExitCode: 0},
+			wantAction: types.ActionUpdate,
+			wantReason: "will wait until path /var/lib/app/migrating is not ready",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.result
+			provider := NewWaitForProvider(&scriptedConnection{results: []*ssh.ExecuteResult{&result}})
+			resource := &types.Resource{Type: "wait_for", Name: "app", State: tt.state, Properties: tt.properties}
+
+			current, err := provider.Read(context.Background(), resource)
+			if err != nil {
+				t.Fatalf("Read() error = %v", err)
+			}
+			diff, err := provider.Diff(context.Background(), resource, current)
+			if err != nil {
+				t.Fatalf("Diff() error = %v", err)
+			}
+			if diff.Action != tt.wantAction || diff.Reason != tt.wantReason {
+				t.Errorf("Diff() = %s %q, want %s %q", diff.Action, diff.Reason, tt.wantAction, tt.wantReason)
+			}
+		})
+	}
+}
+
+func TestWaitForProvider_Apply(t *testing.T) {
+	resource := &types.Resource{
+		Type:       "wait_for",
+		Name:       "app",
+		Properties: map[string]interface{}{"port": 8080, "timeout": 10, "interval": 2},
+	}
+	diff := &types.ResourceDiff{Action: types.ActionUpdate}
+
+	t.Run("ready after retries", func(t *testing.T) {
+		conn := &scriptedConnection{results: []*ssh.ExecuteResult{{ExitCode: 1}, {ExitCode: 1}, {ExitCode: 0}}}
+		provider := NewWaitForProvider(conn)
+		var slept []time.Duration
+		provider.sleep = func(ctx context.Context, d time.Duration) error {
+			slept = append(slept, d)
+			return nil
+		}
+
+		if err := provider.Apply(context.Background(), resource, diff); err != nil {
+			t.Fatalf("Apply() error = %v", err)
+		}
+		if len(conn.commands) != 3 || len(slept) != 2 || slept[0] != 2*time.Second {
+			t.Errorf("Expected 3 checks 2s apart, got %d checks and sleeps %v", len(conn.commands), slept)
+		}
+		want := "nc -z -w 5 '127.0.0.1' 8080 >/dev/null 2>&1 || timeout 5 bash -c 'exec 3<>/dev/tcp/127.0.0.1/8080' >/dev/null 2>&1"
+		if conn.commands[0] != want {
+			t.Errorf("command = %q, want %q", conn.commands[0], want)
+		}
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		conn := &scriptedConnection{}
+		provider := NewWaitForProvider(conn)
+		provider.sleep = func(ctx context.Context, d time.Duration) error { return nil }
+
+		err := provider.Apply(context.Background(), resource, diff)
+		if err == nil || err.Error() != "timed out after 10s waiting for port 127.0.0.1:8080 to be ready" {
+			t.Errorf("Apply() error = %v", err)
+		}
+		if len(conn.commands) != 6 {
+			t.Errorf("Expected a check at 0, 2, 4, 6, 8 and 10s, got %d", len(conn.commands))
+		}
+	})
+
+	t.Run("cancelled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		provider := NewWaitForProvider(&scriptedConnection{})
+		if err := provider.Apply(ctx, resource, diff); err != context.Canceled {
+			t.Errorf("Apply() error = %v, want context.Canceled", err)
+		}
+	})
+}
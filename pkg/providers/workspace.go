@@ -0,0 +1,101 @@
+package providers
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// workspaceTemplate names the per-run workspace directory created by mktemp
+const workspaceTemplate = `"${TMPDIR:-/tmp}/forge.XXXXXXXX"`
+
+// Workspace is a private scratch directory on a target for the files a run
+// needs only briefly, such as uploaded packages and deltas. It is created on
+// first use, mode 0700 and owned by the user commands run as, and removed
+// with everything in it when the target is closed.
+type Workspace struct {
+	connection ssh.Executor
+
+	mu  sync.Mutex
+	dir string
+}
+
+// NewWorkspace returns the workspace of a target connection
+func NewWorkspace(connection ssh.Executor) *Workspace {
+	return &Workspace{connection: connection}
+}
+
+// Dir returns the workspace directory, creating it on first use
+func (w *Workspace) Dir(ctx context.Context) (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir != "" {
+		return w.dir, nil
+	}
+
+	// Created as the target's become user whatever the calling resource
+	// runs as, so the directory always has the same owner
+	ctx = ssh.WithBecome(ctx, ssh.BecomeOverride{})
+	result, err := w.connection.Execute(ctx, "mktemp -d "+workspaceTemplate)
+	if err != nil {
+		return "", fmt.Errorf("failed to create workspace: %w", err)
+	}
+	dir := strings.TrimSpace(result.Stdout)
+	if result.ExitCode != 0 || dir == "" {
+		return "", fmt.Errorf("failed to create workspace: %s", strings.TrimSpace(result.Stderr))
+	}
+	w.dir = dir
+	return dir, nil
+}
+
+// Path returns the path of a file in the workspace
+func (w *Workspace) Path(ctx context.Context, name string) (string, error) {
+	dir, err := w.Dir(ctx)
+	if err != nil {
+		return "", err
+	}
+	return path.Join(dir, path.Base(name)), nil
+}
+
+// Remove deletes the workspace and its contents. It does nothing if the
+// workspace was never used.
+func (w *Workspace) Remove(ctx context.Context) error {
+	if w == nil {
+		return nil
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.dir == "" {
+		return nil
+	}
+
+	ctx = ssh.WithBecome(ctx, ssh.BecomeOverride{})
+	result, err := w.connection.Execute(ctx, "rm -rf "+shellEscape(w.dir))
+	if err != nil {
+		return fmt.Errorf("failed to remove workspace %s: %w", w.dir, err)
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("failed to remove workspace %s: %s", w.dir, strings.TrimSpace(result.Stderr))
+	}
+	w.dir = ""
+	return nil
+}
+
+// workspaceUser is implemented by providers that keep scratch files in the
+// target's workspace
+type workspaceUser interface {
+	SetWorkspace(workspace *Workspace)
+}
+
+// scratchPath returns where a provider keeps a scratch file: in the
+// workspace when it has one, otherwise at the fallback path
+func scratchPath(ctx context.Context, workspace *Workspace, name, fallback string) (string, error) {
+	if workspace == nil {
+		return fallback, nil
+	}
+	return workspace.Path(ctx, name)
+}
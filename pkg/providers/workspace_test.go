@@ -0,0 +1,97 @@
+package providers
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestWorkspace(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	ctx := context.Background()
+	workspace := NewWorkspace(&ssh.LocalExecutor{})
+
+	// An unused workspace is never created
+	if err := workspace.Remove(ctx); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+
+	path, err := workspace.Path(ctx, "nested/pkg.deb")
+	if err != nil {
+		t.Fatalf("Path() error = %v", err)
+	}
+	dir := filepath.Dir(path)
+	if filepath.Dir(dir) != os.Getenv("TMPDIR") || !strings.HasPrefix(filepath.Base(dir), "forge.") || filepath.Base(path) != "pkg.deb" {
+		t.Errorf("Path() = %s", path)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("workspace was not created: %v", err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("workspace mode = %v, want 0700", info.Mode().Perm())
+	}
+
+	// The directory is created once per run
+	if again, _ := workspace.Dir(ctx); again != dir {
+		t.Errorf("Dir() = %s, want %s", again, dir)
+	}
+
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := workspace.Remove(ctx); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Stat(dir); !os.IsNotExist(err) {
+		t.Errorf("Expected the workspace to be removed, got %v", err)
+	}
+}
+
+func TestTargetPool_Workspace(t *testing.T) {
+	source := filepath.Join(t.TempDir(), "tool.deb")
+	if err := os.WriteFile(source, []byte("!<arch>"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	conn := &recordingConnection{MockSSHConnection: MockSSHConnection{responses: map[string]*ssh.ExecuteResult{
+		"mktemp -d " + workspaceTemplate: {Stdout: "/tmp/forge.k3v9\n"},
+	}}}
+	dialer := func(config *ssh.ConnectionConfig) (ssh.Executor, error) {
+		return conn, nil
+	}
+	pool := NewTargetPool(DefaultFactoryRegistry(), dialer)
+	target, err := pool.Get(context.Background(), ssh.ConnectionConfig{Host: "web1"})
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	provider, err := target.Registry.Get("pkg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.commands = nil
+	resource := &types.Resource{Type: "pkg", Name: "tool", Properties: map[string]interface{}{"state": "present", "source": source}}
+	if err := provider.Apply(context.Background(), resource, &types.ResourceDiff{Action: types.ActionCreate}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	if err := pool.CloseAll(); err != nil {
+		t.Fatalf("CloseAll() error = %v", err)
+	}
+
+	want := []string{
+		"mktemp -d " + workspaceTemplate,
+		"base64 -d > '/tmp/forge.k3v9/tool.deb' << 'CHISEL_EOF'\nITxhcmNoPg==\nCHISEL_EOF",
+		"dpkg -i '/tmp/forge.k3v9/tool.deb'; status=$?; rm -f '/tmp/forge.k3v9/tool.deb'; exit $status",
+		"rm -rf '/tmp/forge.k3v9'",
+	}
+	if !reflect.DeepEqual(conn.commands, want) {
+		t.Errorf("commands = %q, want %q", conn.commands, want)
+	}
+}
@@ -2,9 +2,18 @@ package rbac
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"sync"
 	"time"
+
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+// Buckets of the controller store that keep roles and users
+const (
+	rolesBucket = "rbac_roles"
+	usersBucket = "rbac_users"
 )
 
 // Permission represents a specific permission
@@ -29,6 +38,9 @@ const (
 	// Audit permissions
 	PermissionAuditRead Permission = "audit:read"
 	
+	// Approval permissions
+	PermissionApprovalDecide Permission = "approval:decide"
+	
 	// Policy permissions
 	PermissionPolicyRead  Permission = "policy:read"
 	PermissionPolicyWrite Permission = "policy:write"
@@ -74,6 +86,7 @@ type RBACManager struct {
 	roles   map[string]*Role
 	users   map[string]*User
 	enabled bool
+	store   store.Store
 	mu      sync.RWMutex
 }
 
@@ -91,6 +104,91 @@ func NewRBACManager() *RBACManager {
 	return manager
 }
 
+// Migrations upgrades the roles and users kept in a store; the first adds
+// the default roles
+func Migrations() []store.Migration {
+	return []store.Migration{
+		{
+			Version:     1,
+			Description: "add the default roles",
+			Up: func(s store.Store) error {
+				defaults := &RBACManager{roles: make(map[string]*Role)}
+				defaults.createDefaultRoles()
+				for name, role := range defaults.roles {
+					if _, err := s.Get(rolesBucket, name); err == nil {
+						continue
+					} else if !errors.Is(err, store.ErrNotFound) {
+						return err
+					}
+					if err := store.PutJSON(s, rolesBucket, name, role); err != nil {
+						return err
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// UseStore migrates and loads the roles and users kept in a controller
+// store and keeps every later change there. The stored roles replace the
+// defaults, so a default role that was deleted stays deleted.
+func (m *RBACManager) UseStore(s store.Store) error {
+	if _, err := store.Migrate(s, "rbac", Migrations()); err != nil {
+		return err
+	}
+	roles, err := s.Keys(rolesBucket)
+	if err != nil {
+		return err
+	}
+	users, err := s.Keys(usersBucket)
+	if err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.roles = make(map[string]*Role, len(roles))
+	for _, name := range roles {
+		var role Role
+		if err := store.GetJSON(s, rolesBucket, name, &role); err != nil {
+			return err
+		}
+		m.roles[name] = &role
+	}
+	for _, name := range users {
+		var user User
+		if err := store.GetJSON(s, usersBucket, name, &user); err != nil {
+			return err
+		}
+		m.users[name] = &user
+	}
+	m.store = s
+	return nil
+}
+
+// save keeps a role or user in the store, if there is one; the lock must be held
+func (m *RBACManager) save(bucket, key string, v interface{}) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := store.PutJSON(m.store, bucket, key, v); err != nil {
+		return fmt.Errorf("failed to save RBAC data: %w", err)
+	}
+	return nil
+}
+
+// remove deletes a role or user from the store, if there is one; the lock must be held
+func (m *RBACManager) remove(bucket, key string) error {
+	if m.store == nil {
+		return nil
+	}
+	if err := m.store.Delete(bucket, key); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to save RBAC data: %w", err)
+	}
+	return nil
+}
+
 // createDefaultRoles creates default system roles
 func (m *RBACManager) createDefaultRoles() {
 	// Admin role with all permissions
@@ -110,6 +208,7 @@ func (m *RBACManager) createDefaultRoles() {
 			PermissionAuditRead,
 			PermissionPolicyRead,
 			PermissionPolicyWrite,
+			PermissionApprovalDecide,
 		},
 		CreatedAt: time.Now(),
 		UpdatedAt: time.Now(),
@@ -141,7 +240,21 @@ func (m *RBACManager) createDefaultRoles() {
 		UpdatedAt: time.Now(),
 	}
 	
+	// Approver role that decides approval requests
+	approverRole := &Role{
+		Name:        "approver",
+		Description: "Decides approval requests and reads modules and resources",
+		Permissions: []Permission{
+			PermissionModuleRead,
+			PermissionResourceRead,
+			PermissionApprovalDecide,
+		},
+		CreatedAt: time.Now(),
+		UpdatedAt: time.Now(),
+	}
+	
 	m.roles["admin"] = adminRole
+	m.roles["approver"] = approverRole
 	m.roles["operator"] = operatorRole
 	m.roles["readonly"] = readOnlyRole
 }
@@ -185,6 +298,9 @@ func (m *RBACManager) CreateRole(role *Role) error {
 	role.CreatedAt = now
 	role.UpdatedAt = now
 	
+	if err := m.save(rolesBucket, role.Name, role); err != nil {
+		return err
+	}
 	m.roles[role.Name] = role
 	return nil
 }
@@ -222,6 +338,9 @@ func (m *RBACManager) UpdateRole(role *Role) error {
 	role.CreatedAt = existingRole.CreatedAt
 	role.UpdatedAt = time.Now()
 	
+	if err := m.save(rolesBucket, role.Name, role); err != nil {
+		return err
+	}
 	m.roles[role.Name] = role
 	return nil
 }
@@ -244,6 +363,9 @@ func (m *RBACManager) DeleteRole(name string) error {
 		}
 	}
 	
+	if err := m.remove(rolesBucket, name); err != nil {
+		return err
+	}
 	delete(m.roles, name)
 	return nil
 }
@@ -288,6 +410,9 @@ func (m *RBACManager) CreateUser(user *User) error {
 	user.CreatedAt = now
 	user.UpdatedAt = now
 	
+	if err := m.save(usersBucket, user.Username, user); err != nil {
+		return err
+	}
 	m.users[user.Username] = user
 	return nil
 }
@@ -333,6 +458,9 @@ func (m *RBACManager) UpdateUser(user *User) error {
 	user.LastLogin = existingUser.LastLogin
 	user.UpdatedAt = time.Now()
 	
+	if err := m.save(usersBucket, user.Username, user); err != nil {
+		return err
+	}
 	m.users[user.Username] = user
 	return nil
 }
@@ -346,6 +474,9 @@ func (m *RBACManager) DeleteUser(username string) error {
 		return fmt.Errorf("user '%s' not found", username)
 	}
 	
+	if err := m.remove(usersBucket, username); err != nil {
+		return err
+	}
 	delete(m.users, username)
 	return nil
 }
@@ -406,7 +537,7 @@ func (m *RBACManager) AssignRole(username, roleName string) error {
 	user.Roles = append(user.Roles, roleName)
 	user.UpdatedAt = time.Now()
 	
-	return nil
+	return m.save(usersBucket, username, user)
 }
 
 // RevokeRole revokes a role from a user
@@ -424,7 +555,7 @@ func (m *RBACManager) RevokeRole(username, roleName string) error {
 		if existingRole == roleName {
 			user.Roles = append(user.Roles[:i], user.Roles[i+1:]...)
 			user.UpdatedAt = time.Now()
-			return nil
+			return m.save(usersBucket, username, user)
 		}
 	}
 	
@@ -477,7 +608,7 @@ func (m *RBACManager) UpdateLastLogin(username string) error {
 	}
 	
 	user.LastLogin = time.Now()
-	return nil
+	return m.save(usersBucket, username, user)
 }
 
 // GetUserPermissions returns all permissions for a user
@@ -3,6 +3,8 @@ package rbac
 import (
 	"context"
 	"testing"
+
+	"github.com/ataiva-software/forge/pkg/store"
 )
 
 func TestRBACManager_New(t *testing.T) {
@@ -406,9 +408,61 @@ func TestRBACManager_ListRoles(t *testing.T) {
 	}
 	
 	// List roles
+	// The three replace defaults of the same name, next to the approver role
 	allRoles := manager.ListRoles()
-	if len(allRoles) != 3 {
-		t.Errorf("Expected 3 roles, got %d", len(allRoles))
+	if len(allRoles) != 4 {
+		t.Errorf("Expected 4 roles, got %d", len(allRoles))
+	}
+}
+
+func TestRBACManager_UseStore(t *testing.T) {
+	kv := store.NewMemory()
+	manager := NewRBACManager()
+	if err := manager.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	
+	if err := manager.CreateRole(&Role{Name: "auditor", Permissions: []Permission{PermissionAuditRead}}); err != nil {
+		t.Fatalf("Failed to create role: %v", err)
+	}
+	if err := manager.CreateUser(&User{Username: "alice", Roles: []string{"readonly"}, Active: true}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := manager.AssignRole("alice", "auditor"); err != nil {
+		t.Fatalf("Failed to assign role: %v", err)
+	}
+	if err := manager.CreateUser(&User{Username: "bob", Active: true}); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := manager.DeleteUser("bob"); err != nil {
+		t.Fatalf("Failed to delete user: %v", err)
+	}
+	
+	// A new manager picks up the stored roles and users
+	restarted := NewRBACManager()
+	if err := restarted.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	if !restarted.CheckPermission(context.Background(), "alice", PermissionAuditRead, "") {
+		t.Error("Expected alice to keep the auditor role")
+	}
+	if _, err := restarted.GetUser("bob"); err == nil {
+		t.Error("Expected bob to stay deleted")
+	}
+	if _, err := restarted.GetRole("admin"); err != nil {
+		t.Errorf("Expected the default roles to be stored, got %v", err)
+	}
+	
+	// A deleted default role is not added back
+	if err := restarted.DeleteRole("approver"); err != nil {
+		t.Fatalf("Failed to delete role: %v", err)
+	}
+	again := NewRBACManager()
+	if err := again.UseStore(kv); err != nil {
+		t.Fatalf("Failed to use store: %v", err)
+	}
+	if _, err := again.GetRole("approver"); err == nil {
+		t.Error("Expected the deleted approver role to stay deleted")
 	}
 }
 
@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Installer installs modules into a cache directory, one directory per
+// module version
+type Installer struct {
+	CacheDir string
+
+	// newSource returns the source of a requirement
+	newSource func(Requirement) (source, error)
+}
+
+// NewInstaller creates an installer for a cache directory
+func NewInstaller(cacheDir string) *Installer {
+	if cacheDir == "" {
+		cacheDir = DefaultCacheDir
+	}
+	return &Installer{CacheDir: cacheDir, newSource: newSource}
+}
+
+// dir returns where a version of a module is installed
+func (i *Installer) dir(name, version string) string {
+	return filepath.Join(i.CacheDir, name, version)
+}
+
+// Install makes sure a version of the requirement is installed and returns
+// what to lock. The locked version is kept while it still satisfies the
+// requirement, unless upgrade is set, and must install to the locked
+// checksum; otherwise the newest allowed version is installed.
+func (i *Installer) Install(ctx context.Context, requirement Requirement, lock *Lock, upgrade bool) (*Locked, error) {
+	if err := requirement.Validate(); err != nil {
+		return nil, err
+	}
+	locked, ok := lock.Get(requirement.Name)
+	keep := ok && !upgrade && locked.Source == requirement.Source && locked.Module == requirement.moduleFile() &&
+		requirement.Allows(locked.Version)
+	if keep {
+		if checksum, err := TreeChecksum(i.dir(locked.Name, locked.Version)); err == nil && checksum == locked.Checksum {
+			return locked, nil
+		}
+	}
+
+	src, err := i.newSource(requirement)
+	if err != nil {
+		return nil, err
+	}
+	releases, err := src.Releases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %w", requirement.Name, err)
+	}
+	var chosen *release
+	if keep {
+		chosen = findRelease(releases, locked.Version)
+		if chosen == nil {
+			return nil, fmt.Errorf("module %s: locked version %s is no longer offered by %s", requirement.Name, locked.Version, requirement.Source)
+		}
+	} else if chosen = newestRelease(releases, requirement); chosen == nil {
+		return nil, fmt.Errorf("module %s: no version of %s matches %q", requirement.Name, requirement.Source, requirement.Version)
+	}
+
+	installed, err := i.fetch(ctx, src, requirement, *chosen)
+	if err != nil {
+		return nil, fmt.Errorf("module %s %s: %w", requirement.Name, chosen.Version, err)
+	}
+	if keep && installed.Checksum != locked.Checksum {
+		return nil, fmt.Errorf("module %s %s changed since it was locked: checksum %s, locked %s; check the source, then install with --upgrade to accept it",
+			requirement.Name, locked.Version, installed.Checksum, locked.Checksum)
+	}
+	return installed, nil
+}
+
+// fetch installs a release into the cache, replacing any earlier copy
+func (i *Installer) fetch(ctx context.Context, src source, requirement Requirement, r release) (*Locked, error) {
+	if err := os.MkdirAll(filepath.Join(i.CacheDir, requirement.Name), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache: %w", err)
+	}
+	staging, err := os.MkdirTemp(filepath.Join(i.CacheDir, requirement.Name), ".install-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cache: %w", err)
+	}
+	defer os.RemoveAll(staging)
+
+	tree := filepath.Join(staging, "tree")
+	revision, err := src.Fetch(ctx, r, tree)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(filepath.Join(tree, requirement.moduleFile())); err != nil {
+		return nil, fmt.Errorf("module file %s not found in the release", requirement.moduleFile())
+	}
+	checksum, err := TreeChecksum(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	target := i.dir(requirement.Name, r.Version.String())
+	if err := os.RemoveAll(target); err != nil {
+		return nil, fmt.Errorf("failed to replace %s: %w", target, err)
+	}
+	if err := os.Rename(tree, target); err != nil {
+		return nil, fmt.Errorf("failed to install into %s: %w", target, err)
+	}
+	return &Locked{
+		Name:     requirement.Name,
+		Source:   requirement.Source,
+		Version:  r.Version.String(),
+		Revision: revision,
+		Module:   requirement.moduleFile(),
+		Checksum: checksum,
+	}, nil
+}
+
+// Path returns the module file of an installed module, checking that the
+// installed tree is the one locked
+func (i *Installer) Path(lock *Lock, name string) (string, error) {
+	locked, ok := lock.Get(name)
+	if !ok {
+		return "", fmt.Errorf("module %s is not locked; add it with 'forge module install'", name)
+	}
+	dir := i.dir(locked.Name, locked.Version)
+	checksum, err := TreeChecksum(dir)
+	if os.IsNotExist(err) {
+		return "", fmt.Errorf("module %s %s is not installed; run 'forge module install'", name, locked.Version)
+	}
+	if err != nil {
+		return "", err
+	}
+	if checksum != locked.Checksum {
+		return "", fmt.Errorf("installed module %s %s does not match the lockfile; run 'forge module install' to restore it", name, locked.Version)
+	}
+	return filepath.Join(dir, locked.Module), nil
+}
+
+// findRelease returns the release of a version
+func findRelease(releases []release, version string) *release {
+	for i := range releases {
+		if releases[i].Version.String() == version {
+			return &releases[i]
+		}
+	}
+	return nil
+}
+
+// newestRelease returns the newest release the requirement allows.
+// Pre-releases are only picked when the constraint names one.
+func newestRelease(releases []release, requirement Requirement) *release {
+	var newest *release
+	for i := range releases {
+		r := &releases[i]
+		if r.Version.Prerelease != "" && !strings.Contains(requirement.Version, "-") {
+			continue
+		}
+		if !requirement.Allows(r.Version.String()) {
+			continue
+		}
+		if newest == nil || r.Version.Compare(newest.Version) > 0 {
+			newest = r
+		}
+	}
+	return newest
+}
+
+// TreeChecksum returns the SHA-256 of the files under dir, their paths
+// and contents, as "sha256:<hex>"
+func TreeChecksum(dir string) (string, error) {
+	if _, err := os.Stat(dir); err != nil {
+		return "", err
+	}
+	var files []string
+	err := filepath.WalkDir(dir, func(name string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, name)
+		}
+		return nil
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %w", dir, err)
+	}
+	sort.Strings(files)
+
+	tree := sha256.New()
+	for _, name := range files {
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return "", err
+		}
+		file, err := os.Open(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		content := sha256.New()
+		_, err = io.Copy(content, file)
+		file.Close()
+		if err != nil {
+			return "", fmt.Errorf("failed to read %s: %w", name, err)
+		}
+		fmt.Fprintf(tree, "%s\x00%x\n", filepath.ToSlash(rel), content.Sum(nil))
+	}
+	return "sha256:" + hex.EncodeToString(tree.Sum(nil)), nil
+}
@@ -0,0 +1,224 @@
+// Package registry installs versioned modules from git repositories and
+// HTTP registries into a local cache. A requirements file lists the modules
+// a project uses with version constraints; a lockfile records the version
+// each resolved to, so every apply uses the same module code.
+package registry
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+
+	"github.com/ataiva-software/forge/pkg/update"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// DefaultRequirementsFile lists the modules a project uses
+	DefaultRequirementsFile = "modules.yaml"
+	// DefaultLockFile records the versions they resolved to
+	DefaultLockFile = "modules.lock"
+	// DefaultCacheDir is where installed modules are kept
+	DefaultCacheDir = ".chisel/modules"
+	// DefaultModuleFile is the module file of an installed module
+	DefaultModuleFile = "module.yaml"
+)
+
+// namePattern is what a module name may look like; it is a directory name
+// in the cache
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]*$`)
+
+// Requirement is a module a project uses
+type Requirement struct {
+	Name string `yaml:"name"`
+	// Source is a git repository, whose tags are the versions, or the base
+	// URL of an HTTP registry
+	Source string `yaml:"source"`
+	// Version constrains the versions to install, such as "~> 1.2"; the
+	// newest version is installed when empty
+	Version string `yaml:"version,omitempty"`
+	// Module is the module file in the installed tree, module.yaml by default
+	Module string `yaml:"module,omitempty"`
+}
+
+// Validate validates the requirement
+func (r *Requirement) Validate() error {
+	if !namePattern.MatchString(r.Name) {
+		return fmt.Errorf("module name %q must be letters, digits, '_' and '-'", r.Name)
+	}
+	if r.Source == "" {
+		return fmt.Errorf("module %s: source is required", r.Name)
+	}
+	if _, err := r.constraint(); err != nil {
+		return fmt.Errorf("module %s: %w", r.Name, err)
+	}
+	if _, err := sourceKind(r.Source); err != nil {
+		return fmt.Errorf("module %s: %w", r.Name, err)
+	}
+	return nil
+}
+
+// constraint parses the version constraint; nil means any version
+func (r *Requirement) constraint() (*update.Constraint, error) {
+	if r.Version == "" {
+		return nil, nil
+	}
+	constraint, err := update.ParseConstraint(r.Version)
+	if err != nil {
+		return nil, err
+	}
+	return &constraint, nil
+}
+
+// Allows reports whether a version satisfies the requirement
+func (r *Requirement) Allows(version string) bool {
+	parsed, err := update.ParseVersion(version)
+	if err != nil {
+		return false
+	}
+	constraint, err := r.constraint()
+	return err == nil && (constraint == nil || constraint.Check(parsed))
+}
+
+// moduleFile returns the module file of the installed tree
+func (r *Requirement) moduleFile() string {
+	if r.Module != "" {
+		return r.Module
+	}
+	return DefaultModuleFile
+}
+
+// Requirements is the requirements file
+type Requirements struct {
+	Modules []Requirement `yaml:"modules"`
+}
+
+// LoadRequirements reads a requirements file; a missing file has no modules
+func LoadRequirements(filename string) (*Requirements, error) {
+	var requirements Requirements
+	if err := readYAML(filename, &requirements); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(requirements.Modules))
+	for i := range requirements.Modules {
+		requirement := &requirements.Modules[i]
+		if err := requirement.Validate(); err != nil {
+			return nil, fmt.Errorf("%s: %w", filename, err)
+		}
+		if seen[requirement.Name] {
+			return nil, fmt.Errorf("%s: module %s is listed twice", filename, requirement.Name)
+		}
+		seen[requirement.Name] = true
+	}
+	return &requirements, nil
+}
+
+// Set adds a requirement or replaces the one with the same name
+func (r *Requirements) Set(requirement Requirement) {
+	for i := range r.Modules {
+		if r.Modules[i].Name == requirement.Name {
+			r.Modules[i] = requirement
+			return
+		}
+	}
+	r.Modules = append(r.Modules, requirement)
+}
+
+// Save writes the requirements file
+func (r *Requirements) Save(filename string) error {
+	return writeYAML(filename, r)
+}
+
+// Locked is the version a requirement resolved to
+type Locked struct {
+	Name    string `yaml:"name"`
+	Source  string `yaml:"source"`
+	Version string `yaml:"version"`
+	// Revision is the commit of a git tag or the URL of a registry archive
+	Revision string `yaml:"revision"`
+	Module   string `yaml:"module"`
+	// Checksum is the SHA-256 of the installed tree, checked on every use
+	Checksum string `yaml:"checksum"`
+}
+
+// Lock is the lockfile
+type Lock struct {
+	Modules []Locked `yaml:"modules"`
+}
+
+// LoadLock reads a lockfile; a missing file locks nothing
+func LoadLock(filename string) (*Lock, error) {
+	var lock Lock
+	if err := readYAML(filename, &lock); err != nil {
+		return nil, err
+	}
+	return &lock, nil
+}
+
+// Get returns the locked version of a module
+func (l *Lock) Get(name string) (*Locked, bool) {
+	for i := range l.Modules {
+		if l.Modules[i].Name == name {
+			return &l.Modules[i], true
+		}
+	}
+	return nil, false
+}
+
+// Set records a locked module, keeping the modules sorted by name
+func (l *Lock) Set(locked Locked) {
+	if existing, ok := l.Get(locked.Name); ok {
+		*existing = locked
+		return
+	}
+	l.Modules = append(l.Modules, locked)
+	sort.Slice(l.Modules, func(i, j int) bool { return l.Modules[i].Name < l.Modules[j].Name })
+}
+
+// Prune removes the locked modules that are no longer required
+func (l *Lock) Prune(requirements *Requirements) {
+	required := make(map[string]bool, len(requirements.Modules))
+	for _, requirement := range requirements.Modules {
+		required[requirement.Name] = true
+	}
+	kept := l.Modules[:0]
+	for _, locked := range l.Modules {
+		if required[locked.Name] {
+			kept = append(kept, locked)
+		}
+	}
+	l.Modules = kept
+}
+
+// Save writes the lockfile
+func (l *Lock) Save(filename string) error {
+	return writeYAML(filename, l)
+}
+
+// readYAML decodes a YAML file, leaving out untouched when it is missing
+func readYAML(filename string, out interface{}) error {
+	data, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filename, err)
+	}
+	if err := yaml.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("failed to parse %s: %w", filename, err)
+	}
+	return nil
+}
+
+// writeYAML encodes a value to a YAML file
+func writeYAML(filename string, value interface{}) error {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode %s: %w", filename, err)
+	}
+	if err := os.WriteFile(filename, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", filename, err)
+	}
+	return nil
+}
@@ -0,0 +1,221 @@
+package registry
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// gitRepo creates a repository and returns its path and a function that
+// commits a module.yaml with content and tags it
+func gitRepo(t *testing.T) (string, func(content, tag string)) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	repo := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repo
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, output)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	return repo, func(content, tag string) {
+		if err := os.WriteFile(filepath.Join(repo, "module.yaml"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "module.yaml")
+		git("commit", "-q", "--allow-empty", "-m", tag)
+		git("tag", "-f", tag)
+	}
+}
+
+func TestInstaller_Git(t *testing.T) {
+	repo, release := gitRepo(t)
+	release("version: 1.0.0\n", "v1.0.0")
+	release("version: 1.1.0\n", "v1.1.0")
+	release("version: 2.0.0\n", "v2.0.0")
+	release("version: 2.1.0-rc.1\n", "v2.1.0-rc.1")
+
+	ctx := context.Background()
+	installer := NewInstaller(filepath.Join(t.TempDir(), "cache"))
+	requirement := Requirement{Name: "nginx", Source: "git+file://" + repo, Version: "~> 1.0"}
+	lock := &Lock{}
+
+	locked, err := installer.Install(ctx, requirement, lock, false)
+	if err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+	if locked.Version != "1.1.0" || len(locked.Revision) != 40 || !strings.HasPrefix(locked.Checksum, "sha256:") {
+		t.Fatalf("locked = %+v, want the newest 1.x", locked)
+	}
+	lock.Set(*locked)
+
+	path, err := installer.Path(lock, "nginx")
+	if err != nil {
+		t.Fatalf("Path: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "version: 1.1.0\n" {
+		t.Errorf("installed module = %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(path), ".git")); !os.IsNotExist(err) {
+		t.Error("the clone's .git directory should be removed")
+	}
+
+	// A newer matching version does not move the lock without --upgrade
+	release("version: 1.2.0\n", "v1.2.0")
+	if again, err := installer.Install(ctx, requirement, lock, false); err != nil || again.Version != "1.1.0" {
+		t.Errorf("Install again = %+v, %v, want the locked 1.1.0", again, err)
+	}
+	upgraded, err := installer.Install(ctx, requirement, lock, true)
+	if err != nil || upgraded.Version != "1.2.0" {
+		t.Errorf("Install --upgrade = %+v, %v, want 1.2.0", upgraded, err)
+	}
+
+	// A locked version whose tag moved is refused once it is fetched again
+	release("version: 1.1.0\nchanged: true\n", "v1.1.0")
+	os.RemoveAll(installer.dir("nginx", "1.1.0"))
+	if _, err := installer.Install(ctx, requirement, lock, false); err == nil || !strings.Contains(err.Error(), "changed since it was locked") {
+		t.Errorf("Install of a moved tag = %v", err)
+	}
+
+	if _, err := installer.Install(ctx, Requirement{Name: "nginx", Source: requirement.Source, Version: ">= 3.0"}, &Lock{}, false); err == nil || !strings.Contains(err.Error(), "no version") {
+		t.Errorf("Install of an unmatched constraint = %v", err)
+	}
+	pre, err := installer.Install(ctx, Requirement{Name: "nginx", Source: requirement.Source, Version: ">= 2.1.0-rc.1"}, &Lock{}, false)
+	if err != nil || pre.Version != "2.1.0-rc.1" {
+		t.Errorf("Install of a pre-release = %+v, %v", pre, err)
+	}
+
+	// A source is never taken for an option of git, but for the repository
+	option := Requirement{Name: "nginx", Source: "--upload-pack=touch ran;.git", Version: "~> 1.0"}
+	if _, err := installer.Install(ctx, option, &Lock{}, false); err == nil || !strings.Contains(err.Error(), option.Source) {
+		t.Errorf("Install of a source that looks like an option = %v, want git to name it as the repository", err)
+	}
+}
+
+// archive returns a gzipped tarball of files
+func archive(t *testing.T, files map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, content := range files {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write([]byte(content))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestInstaller_HTTP(t *testing.T) {
+	good := archive(t, map[string]string{"module.yaml": "name: postgres\n", "templates/pg.conf": "port 5432\n"})
+	evil := archive(t, map[string]string{"../escape.yaml": "x"})
+	sum := sha256.Sum256(good)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/modules/postgres/index.yaml":
+			w.Write([]byte("versions:\n  - version: 2.0.0\n    url: postgres-2.0.0.tar.gz\n    checksum: sha256:" + hex.EncodeToString(sum[:]) +
+				"\n  - version: 2.1.0\n    url: /files/evil.tar.gz\n  - version: 1.9.0\n    url: postgres-2.0.0.tar.gz\n    checksum: sha256:00\n"))
+		case "/modules/postgres/postgres-2.0.0.tar.gz":
+			w.Write(good)
+		case "/files/evil.tar.gz":
+			w.Write(evil)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	installer := NewInstaller(t.TempDir())
+	tests := []struct {
+		version string
+		want    string
+	}{
+		{version: "2.0.0"},
+		{version: "2.1.0", want: "escapes the archive"},
+		{version: "1.9.0", want: "expected 00"},
+	}
+	for _, tt := range tests {
+		requirement := Requirement{Name: "postgres", Source: server.URL + "/modules/", Version: tt.version}
+		locked, err := installer.Install(ctx, requirement, &Lock{}, false)
+		if tt.want != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Install %s = %v, want %q", tt.version, err, tt.want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("Install %s: %v", tt.version, err)
+		}
+		if locked.Revision != server.URL+"/modules/postgres/postgres-2.0.0.tar.gz" {
+			t.Errorf("revision = %s", locked.Revision)
+		}
+
+		lock := &Lock{Modules: []Locked{*locked}}
+		path, err := installer.Path(lock, "postgres")
+		if err != nil {
+			t.Fatalf("Path: %v", err)
+		}
+		os.WriteFile(filepath.Join(filepath.Dir(path), "templates", "pg.conf"), []byte("port 6543\n"), 0644)
+		if _, err := installer.Path(lock, "postgres"); err == nil || !strings.Contains(err.Error(), "does not match the lockfile") {
+			t.Errorf("Path of a modified module = %v", err)
+		}
+	}
+}
+
+func TestRequirementsAndLock(t *testing.T) {
+	dir := t.TempDir()
+	requirementsFile := filepath.Join(dir, DefaultRequirementsFile)
+	requirements, err := LoadRequirements(requirementsFile)
+	if err != nil || len(requirements.Modules) != 0 {
+		t.Fatalf("LoadRequirements of a missing file = %+v, %v", requirements, err)
+	}
+	requirements.Set(Requirement{Name: "nginx", Source: "https://github.com/org/nginx.git", Version: "~> 1.2"})
+	requirements.Set(Requirement{Name: "nginx", Source: "https://github.com/org/nginx.git", Version: "~> 1.3"})
+	if err := requirements.Save(requirementsFile); err != nil {
+		t.Fatal(err)
+	}
+	if loaded, err := LoadRequirements(requirementsFile); err != nil || len(loaded.Modules) != 1 || loaded.Modules[0].Version != "~> 1.3" {
+		t.Errorf("LoadRequirements = %+v, %v", loaded, err)
+	}
+
+	lock := &Lock{}
+	lock.Set(Locked{Name: "redis", Version: "1.0.0"})
+	lock.Set(Locked{Name: "nginx", Version: "1.3.0"})
+	lock.Prune(requirements)
+	if len(lock.Modules) != 1 || lock.Modules[0].Name != "nginx" {
+		t.Errorf("lock = %+v, want only the required nginx", lock.Modules)
+	}
+
+	invalid := []struct {
+		content string
+		want    string
+	}{
+		{content: "modules:\n  - name: nginx\n    source: /srv/nginx\n", want: "unsupported source"},
+		{content: "modules:\n  - name: ../nginx\n    source: https://r.example.com\n", want: "module name"},
+		{content: "modules:\n  - name: nginx\n    source: https://r.example.com\n    version: '~> 1'\n", want: "needs at least major.minor"},
+		{content: "modules:\n  - name: a\n    source: https://r.example.com\n  - name: a\n    source: https://r.example.com\n", want: "listed twice"},
+	}
+	for _, tt := range invalid {
+		os.WriteFile(requirementsFile, []byte(tt.content), 0644)
+		if _, err := LoadRequirements(requirementsFile); err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("LoadRequirements(%q) = %v, want %q", tt.content, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,208 @@
+package registry
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/artifact"
+	"github.com/ataiva-software/forge/pkg/gitsource"
+	"github.com/ataiva-software/forge/pkg/update"
+	"gopkg.in/yaml.v3"
+)
+
+// Source kinds
+const (
+	SourceGit  = "git"
+	SourceHTTP = "http"
+)
+
+// fetchTimeout bounds talking to an HTTP registry
+const fetchTimeout = 60 * time.Second
+
+// release is a version a source offers
+type release struct {
+	Version update.Version
+	// ref is the git tag or the archive URL of the version
+	ref string
+	// checksum is the SHA-256 of a registry archive, when the index gives one
+	checksum string
+}
+
+// source lists and fetches the versions of a module
+type source interface {
+	Releases(ctx context.Context) ([]release, error)
+	// Fetch puts the files of a release into dir and returns its revision
+	Fetch(ctx context.Context, r release, dir string) (string, error)
+}
+
+// sourceKind tells git repositories from HTTP registries
+func sourceKind(source string) (string, error) {
+	switch {
+	case gitsource.IsRepository(source):
+		return SourceGit, nil
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		return SourceHTTP, nil
+	default:
+		return "", fmt.Errorf("unsupported source %q, must be a git repository or an http(s) registry URL", source)
+	}
+}
+
+// newSource returns the source of a requirement
+func newSource(requirement Requirement) (source, error) {
+	kind, err := sourceKind(requirement.Source)
+	if err != nil {
+		return nil, err
+	}
+	if kind == SourceGit {
+		return &gitSource{url: strings.TrimPrefix(requirement.Source, "git+")}, nil
+	}
+	return &httpSource{
+		index:  strings.TrimSuffix(requirement.Source, "/") + "/" + url.PathEscape(requirement.Name) + "/index.yaml",
+		client: &http.Client{Timeout: fetchTimeout},
+	}, nil
+}
+
+// gitSource offers the version tags of a git repository
+type gitSource struct {
+	url string
+}
+
+// Releases lists the tags that are versions, such as v1.2.0 or 1.2.0
+func (s *gitSource) Releases(ctx context.Context) ([]release, error) {
+	output, err := gitsource.Git(ctx, "", "ls-remote", "--tags", "--refs", "--", s.url)
+	if err != nil {
+		return nil, err
+	}
+	var releases []release
+	for _, line := range strings.Split(output, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		tag := strings.TrimPrefix(fields[1], "refs/tags/")
+		if version, err := update.ParseVersion(tag); err == nil {
+			releases = append(releases, release{Version: version, ref: tag})
+		}
+	}
+	return releases, nil
+}
+
+// Fetch clones the tag and returns its commit
+func (s *gitSource) Fetch(ctx context.Context, r release, dir string) (string, error) {
+	if _, err := gitsource.Git(ctx, "", "clone", "--quiet", "--depth", "1", "--branch", r.ref, "--", s.url, dir); err != nil {
+		return "", err
+	}
+	revision, err := gitsource.Git(ctx, dir, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, ".git")); err != nil {
+		return "", fmt.Errorf("failed to clean up clone: %w", err)
+	}
+	return revision, nil
+}
+
+// httpSource offers the versions listed in a registry's index of a module,
+// <registry>/<name>/index.yaml:
+//
+//	versions:
+//	  - version: 1.2.0
+//	    url: nginx-1.2.0.tar.gz
+//	    checksum: sha256:3b2c...
+//
+// Archive URLs are relative to the index.
+type httpSource struct {
+	index  string
+	client *http.Client
+}
+
+// registryIndex is a module's index in an HTTP registry
+type registryIndex struct {
+	Versions []struct {
+		Version  string `yaml:"version"`
+		URL      string `yaml:"url"`
+		Checksum string `yaml:"checksum"`
+	} `yaml:"versions"`
+}
+
+// Releases reads the module's index
+func (s *httpSource) Releases(ctx context.Context) ([]release, error) {
+	data, err := s.get(ctx, s.index)
+	if err != nil {
+		return nil, err
+	}
+	var index registryIndex
+	if err := yaml.Unmarshal(data, &index); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.index, err)
+	}
+	base, err := url.Parse(s.index)
+	if err != nil {
+		return nil, err
+	}
+	var releases []release
+	for _, entry := range index.Versions {
+		version, err := update.ParseVersion(entry.Version)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.index, err)
+		}
+		ref, err := url.Parse(entry.URL)
+		if err != nil || entry.URL == "" {
+			return nil, fmt.Errorf("%s: version %s has an invalid url %q", s.index, entry.Version, entry.URL)
+		}
+		releases = append(releases, release{
+			Version:  version,
+			ref:      base.ResolveReference(ref).String(),
+			checksum: strings.ToLower(strings.TrimPrefix(entry.Checksum, "sha256:")),
+		})
+	}
+	return releases, nil
+}
+
+// Fetch downloads and unpacks the release's archive, a gzipped tarball
+func (s *httpSource) Fetch(ctx context.Context, r release, dir string) (string, error) {
+	data, err := s.get(ctx, r.ref)
+	if err != nil {
+		return "", err
+	}
+	if r.checksum != "" {
+		sum := sha256.Sum256(data)
+		if actual := hex.EncodeToString(sum[:]); actual != r.checksum {
+			return "", fmt.Errorf("archive %s has checksum %s, expected %s", r.ref, actual, r.checksum)
+		}
+	}
+	if err := artifact.ExtractArchive(bytes.NewReader(data), dir); err != nil {
+		return "", fmt.Errorf("failed to unpack %s: %w", r.ref, err)
+	}
+	return r.ref, nil
+}
+
+// get downloads a file from the registry
+func (s *httpSource) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,305 @@
+// Package report builds machine-readable reports of plans and applies, for
+// CI pipelines that parse results and gate deployments on them.
+package report
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+	FormatYAML = "yaml"
+)
+
+// Report statuses
+const (
+	// StatusPlanned means changes were planned but not applied
+	StatusPlanned   = "planned"
+	StatusUpToDate  = "up_to_date"
+	StatusCancelled = "cancelled"
+	StatusSucceeded = "succeeded"
+	StatusPartial   = "partial"
+	StatusFailed    = "failed"
+)
+
+// ValidateFormat checks an output format
+func ValidateFormat(format string) error {
+	switch format {
+	case FormatText, FormatJSON, FormatYAML:
+		return nil
+	default:
+		return fmt.Errorf("unknown output format %q, must be text, json or yaml", format)
+	}
+}
+
+// Report is the outcome of a plan or apply
+type Report struct {
+	Command     string  `json:"command" yaml:"command"`
+	Module      string  `json:"module" yaml:"module"`
+	Status      string  `json:"status" yaml:"status"`
+	HasChanges  bool    `json:"has_changes" yaml:"has_changes"`
+	Fingerprint string  `json:"fingerprint,omitempty" yaml:"fingerprint,omitempty"`
+	Summary     Summary `json:"summary" yaml:"summary"`
+	Hosts       []Host  `json:"hosts" yaml:"hosts"`
+	Error       string  `json:"error,omitempty" yaml:"error,omitempty"`
+}
+
+// Summary counts planned and applied changes over every host
+type Summary struct {
+	Hosts    int `json:"hosts" yaml:"hosts"`
+	ToCreate int `json:"to_create" yaml:"to_create"`
+	ToUpdate int `json:"to_update" yaml:"to_update"`
+	ToDelete int `json:"to_delete" yaml:"to_delete"`
+	Errors   int `json:"errors" yaml:"errors"`
+	// Succeeded and Failed count applied changes
+	Succeeded int `json:"succeeded" yaml:"succeeded"`
+	Failed    int `json:"failed" yaml:"failed"`
+}
+
+// Host is the plan of one host and, after an apply, its results
+type Host struct {
+	Name string `json:"name" yaml:"name"`
+	// Status is the outcome of the apply on the host
+	Status string `json:"status,omitempty" yaml:"status,omitempty"`
+	Error  string `json:"error,omitempty" yaml:"error,omitempty"`
+	// Changes are the planned changes; resources already up to date are left out
+	Changes []Change `json:"changes" yaml:"changes"`
+	Results []Result `json:"results,omitempty" yaml:"results,omitempty"`
+}
+
+// Change is a planned change to a resource
+type Change struct {
+	ResourceID string `json:"resource_id" yaml:"resource_id"`
+	Action     string `json:"action" yaml:"action"`
+	Reason     string `json:"reason,omitempty" yaml:"reason,omitempty"`
+	// Changes maps changed properties to their new value, or to their old
+	// and new values
+	Changes map[string]interface{} `json:"changes,omitempty" yaml:"changes,omitempty"`
+	Error   string                 `json:"error,omitempty" yaml:"error,omitempty"`
+	// Audit is set when the resource is only audited, so the change is a
+	// deviation that is not applied
+	Audit bool `json:"audit,omitempty" yaml:"audit,omitempty"`
+}
+
+// Result is the outcome of applying a change, or of running a handler
+type Result struct {
+	ResourceID string  `json:"resource_id" yaml:"resource_id"`
+	Action     string  `json:"action" yaml:"action"`
+	Handler    string  `json:"handler,omitempty" yaml:"handler,omitempty"`
+	Success    bool    `json:"success" yaml:"success"`
+	Error      string  `json:"error,omitempty" yaml:"error,omitempty"`
+	Duration   float64 `json:"duration_seconds" yaml:"duration_seconds"`
+}
+
+// Write encodes a report in a structured format
+func Write(w io.Writer, report *Report, format string) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case FormatYAML:
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(report); err != nil {
+			return err
+		}
+		return encoder.Close()
+	default:
+		return fmt.Errorf("cannot write a report as %q", format)
+	}
+}
+
+// Recorder builds a report as a run progresses. It is safe for concurrent
+// use, and a nil Recorder records nothing.
+type Recorder struct {
+	mu     sync.Mutex
+	report Report
+	hosts  map[string]*Host
+}
+
+// NewRecorder creates a recorder for a command
+func NewRecorder(command string) *Recorder {
+	return &Recorder{
+		report: Report{Command: command},
+		hosts:  make(map[string]*Host),
+	}
+}
+
+// SetModule records the module the run applies
+func (r *Recorder) SetModule(name string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.report.Module = name
+	r.mu.Unlock()
+}
+
+// SetFingerprint records the ID of the execution fingerprint
+func (r *Recorder) SetFingerprint(id string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.report.Fingerprint = id
+	r.mu.Unlock()
+}
+
+// Planned records the plan of a host, or why it could not be planned
+func (r *Recorder) Planned(host string, plan *core.Plan, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.host(host)
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	if plan == nil {
+		return
+	}
+	for _, change := range plan.Changes {
+		if change.Action == core.ActionNoOp && change.Error == nil {
+			continue
+		}
+		planned := Change{ResourceID: change.Resource.ResourceID(), Action: change.Action.String(), Audit: change.Audit}
+		if change.Diff != nil {
+			planned.Reason = change.Diff.Reason
+			planned.Changes = change.Diff.Changes
+		}
+		if change.Error != nil {
+			planned.Error = change.Error.Error()
+		}
+		entry.Changes = append(entry.Changes, planned)
+	}
+}
+
+// Applying records that plans are about to be applied
+func (r *Recorder) Applying(hosts []string) {}
+
+// Output is left out of reports, which carry each change's outcome
+func (r *Recorder) Output(host string, line types.OutputLine) {}
+
+// Applied records the outcome of applying a host's plan
+func (r *Recorder) Applied(host string, result *core.ExecutionResult, err error) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	entry := r.host(host)
+	entry.Status = StatusSucceeded
+	if result != nil {
+		for _, changeResult := range result.Changes {
+			applied := Result{
+				ResourceID: changeResult.Change.Resource.ResourceID(),
+				Action:     changeResult.Change.Action.String(),
+				Handler:    changeResult.Handler,
+				Success:    changeResult.Success,
+				Duration:   changeResult.Duration.Seconds(),
+			}
+			if changeResult.Handler != "" {
+				applied.ResourceID = changeResult.Handler
+				applied.Action = "handler"
+			}
+			if changeResult.Error != nil {
+				applied.Error = changeResult.Error.Error()
+			}
+			entry.Results = append(entry.Results, applied)
+		}
+		if result.Summary.Failed > 0 {
+			entry.Status = StatusFailed
+			entry.Error = fmt.Sprintf("%d change(s) failed", result.Summary.Failed)
+		}
+	}
+	if err != nil {
+		entry.Status = StatusFailed
+		entry.Error = err.Error()
+	}
+}
+
+// SetStatus records the overall status of the run
+func (r *Recorder) SetStatus(status string) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	r.report.Status = status
+	r.mu.Unlock()
+}
+
+// Report returns the report of the run, which ended with err
+func (r *Recorder) Report(err error) *Report {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	report := r.report
+	report.Hosts = make([]Host, 0, len(r.hosts))
+	for _, host := range r.hosts {
+		report.Hosts = append(report.Hosts, *host)
+	}
+	sort.Slice(report.Hosts, func(i, j int) bool { return report.Hosts[i].Name < report.Hosts[j].Name })
+
+	report.Summary = Summary{Hosts: len(report.Hosts)}
+	for _, host := range report.Hosts {
+		for _, change := range host.Changes {
+			switch {
+			case change.Error != "":
+				report.Summary.Errors++
+			case change.Action == core.ActionCreate.String():
+				report.Summary.ToCreate++
+			case change.Action == core.ActionUpdate.String():
+				report.Summary.ToUpdate++
+			case change.Action == core.ActionDelete.String():
+				report.Summary.ToDelete++
+			}
+		}
+		for _, result := range host.Results {
+			if result.Success {
+				report.Summary.Succeeded++
+			} else {
+				report.Summary.Failed++
+			}
+		}
+	}
+	report.HasChanges = report.Summary.ToCreate+report.Summary.ToUpdate+report.Summary.ToDelete > 0
+
+	switch {
+	case err != nil:
+		// A run cancelled for want of approval stays cancelled
+		if report.Status != StatusCancelled {
+			report.Status = StatusFailed
+		}
+		report.Error = err.Error()
+	case report.Status != "":
+	case report.Summary.Errors > 0:
+		report.Status = StatusFailed
+	case !report.HasChanges:
+		report.Status = StatusUpToDate
+	default:
+		report.Status = StatusPlanned
+	}
+	return &report
+}
+
+// host returns the entry of a host, adding it on first use
+func (r *Recorder) host(name string) *Host {
+	entry, ok := r.hosts[name]
+	if !ok {
+		entry = &Host{Name: name, Changes: []Change{}}
+		r.hosts[name] = entry
+	}
+	return entry
+}
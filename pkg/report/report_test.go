@@ -0,0 +1,261 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/types"
+	"gopkg.in/yaml.v3"
+)
+
+func testPlan() *core.Plan {
+	return &core.Plan{Changes: []core.Change{
+		{
+			Action:   core.ActionCreate,
+			Resource: types.Resource{Type: "pkg", Name: "nginx"},
+			Diff: &types.ResourceDiff{
+				Reason:  "package is not installed",
+				Changes: map[string]interface{}{"state": map[string]interface{}{"from": "absent", "to": "present"}},
+			},
+		},
+		{Action: core.ActionUpdate, Resource: types.Resource{Type: "file", Name: "config"}},
+		{Action: core.ActionNoOp, Resource: types.Resource{Type: "service", Name: "nginx"}},
+	}}
+}
+
+func testResult(failed bool) *core.ExecutionResult {
+	result := &core.ExecutionResult{Changes: []core.ChangeResult{
+		{Change: testPlan().Changes[0], Success: true, Duration: 1500 * time.Millisecond},
+		{Change: testPlan().Changes[1], Success: !failed},
+		{Handler: "restart-nginx", Success: true},
+	}}
+	if failed {
+		result.Changes[1].Error = errors.New("permission denied")
+		result.Summary.Failed = 1
+	}
+	return result
+}
+
+func TestRecorder_Report(t *testing.T) {
+	tests := []struct {
+		name       string
+		record     func(r *Recorder)
+		err        error
+		status     string
+		hasChanges bool
+		summary    Summary
+	}{
+		{
+			name:       "plan with changes",
+			record:     func(r *Recorder) { r.Planned("web1", testPlan(), nil) },
+			status:     StatusPlanned,
+			hasChanges: true,
+			summary:    Summary{Hosts: 1, ToCreate: 1, ToUpdate: 1},
+		},
+		{
+			name: "plan without changes",
+			record: func(r *Recorder) {
+				r.Planned("web1", &core.Plan{Changes: testPlan().Changes[2:]}, nil)
+			},
+			status:  StatusUpToDate,
+			summary: Summary{Hosts: 1},
+		},
+		{
+			name: "plan with an error",
+			record: func(r *Recorder) {
+				plan := &core.Plan{Changes: []core.Change{
+					{Action: core.ActionNoOp, Resource: types.Resource{Type: "file", Name: "motd"}, Error: errors.New("path is required")},
+				}}
+				r.Planned("web1", plan, nil)
+			},
+			status:  StatusFailed,
+			summary: Summary{Hosts: 1, Errors: 1},
+		},
+		{
+			name: "apply succeeded",
+			record: func(r *Recorder) {
+				r.Planned("web1", testPlan(), nil)
+				r.Applied("web1", testResult(false), nil)
+				r.SetStatus(StatusSucceeded)
+			},
+			status:     StatusSucceeded,
+			hasChanges: true,
+			summary:    Summary{Hosts: 1, ToCreate: 1, ToUpdate: 1, Succeeded: 3},
+		},
+		{
+			name: "apply partly failed",
+			record: func(r *Recorder) {
+				r.Planned("web1", testPlan(), nil)
+				r.Planned("web2", testPlan(), nil)
+				r.Applied("web1", testResult(false), nil)
+				r.Applied("web2", testResult(true), nil)
+				r.SetStatus(StatusPartial)
+			},
+			status:     StatusPartial,
+			hasChanges: true,
+			summary:    Summary{Hosts: 2, ToCreate: 2, ToUpdate: 2, Succeeded: 5, Failed: 1},
+		},
+		{
+			name: "cancelled",
+			record: func(r *Recorder) {
+				r.Planned("web1", testPlan(), nil)
+				r.SetStatus(StatusCancelled)
+			},
+			status:     StatusCancelled,
+			hasChanges: true,
+			summary:    Summary{Hosts: 1, ToCreate: 1, ToUpdate: 1},
+		},
+		{
+			name: "cancelled without approval",
+			record: func(r *Recorder) {
+				r.Planned("web1", testPlan(), nil)
+				r.SetStatus(StatusCancelled)
+			},
+			err:        errors.New("apply needs approval but there is no terminal to ask on"),
+			status:     StatusCancelled,
+			hasChanges: true,
+			summary:    Summary{Hosts: 1, ToCreate: 1, ToUpdate: 1},
+		},
+		{
+			name:    "run error",
+			record:  func(r *Recorder) {},
+			err:     errors.New("failed to load module"),
+			status:  StatusFailed,
+			summary: Summary{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := NewRecorder("apply")
+			recorder.SetModule("web")
+			tt.record(recorder)
+			report := recorder.Report(tt.err)
+
+			if report.Status != tt.status {
+				t.Errorf("status = %q, want %q", report.Status, tt.status)
+			}
+			if report.HasChanges != tt.hasChanges {
+				t.Errorf("has changes = %v, want %v", report.HasChanges, tt.hasChanges)
+			}
+			if report.Summary != tt.summary {
+				t.Errorf("summary = %+v, want %+v", report.Summary, tt.summary)
+			}
+			if report.Module != "web" || report.Command != "apply" {
+				t.Errorf("module, command = %q, %q", report.Module, report.Command)
+			}
+			if tt.err != nil && report.Error != tt.err.Error() {
+				t.Errorf("error = %q, want %q", report.Error, tt.err.Error())
+			}
+		})
+	}
+}
+
+func TestRecorder_Hosts(t *testing.T) {
+	recorder := NewRecorder("apply")
+	recorder.Planned("web2", testPlan(), nil)
+	recorder.Planned("web1", testPlan(), nil)
+	recorder.Planned("db1", nil, errors.New("connection refused"))
+	recorder.Applied("web1", testResult(false), nil)
+	recorder.Applied("web2", testResult(true), nil)
+	report := recorder.Report(nil)
+
+	if len(report.Hosts) != 3 || report.Hosts[0].Name != "db1" || report.Hosts[2].Name != "web2" {
+		t.Fatalf("hosts = %+v, want db1, web1 and web2", report.Hosts)
+	}
+	if db := report.Hosts[0]; db.Error != "connection refused" || len(db.Changes) != 0 {
+		t.Errorf("db1 = %+v, want the planning error and no changes", db)
+	}
+
+	web1 := report.Hosts[1]
+	if web1.Status != StatusSucceeded {
+		t.Errorf("web1 status = %q, want %q", web1.Status, StatusSucceeded)
+	}
+	if len(web1.Changes) != 2 {
+		t.Fatalf("web1 changes = %+v, want the no-op left out", web1.Changes)
+	}
+	create := web1.Changes[0]
+	if create.ResourceID != "pkg.nginx" || create.Action != "create" || create.Reason != "package is not installed" || create.Changes["state"] == nil {
+		t.Errorf("create = %+v", create)
+	}
+	if len(web1.Results) != 3 {
+		t.Fatalf("web1 results = %+v, want 3", web1.Results)
+	}
+	if result := web1.Results[0]; result.Duration != 1.5 || !result.Success {
+		t.Errorf("result = %+v, want a 1.5s success", result)
+	}
+	if handler := web1.Results[2]; handler.ResourceID != "restart-nginx" || handler.Action != "handler" {
+		t.Errorf("handler = %+v, want the restart-nginx handler", handler)
+	}
+
+	web2 := report.Hosts[2]
+	if web2.Status != StatusFailed || web2.Error != "1 change(s) failed" {
+		t.Errorf("web2 = %q %q, want failed", web2.Status, web2.Error)
+	}
+	if result := web2.Results[1]; result.Success || result.Error != "permission denied" {
+		t.Errorf("result = %+v, want the permission error", result)
+	}
+}
+
+func TestRecorder_Nil(t *testing.T) {
+	var recorder *Recorder
+	recorder.SetModule("web")
+	recorder.SetFingerprint("abc")
+	recorder.Planned("web1", testPlan(), nil)
+	recorder.Applied("web1", testResult(false), nil)
+	recorder.SetStatus(StatusSucceeded)
+}
+
+func TestWrite(t *testing.T) {
+	recorder := NewRecorder("plan")
+	recorder.SetModule("web")
+	recorder.SetFingerprint("abc")
+	recorder.Planned("web1", testPlan(), nil)
+	want := recorder.Report(nil)
+
+	tests := []struct {
+		format    string
+		unmarshal func([]byte, interface{}) error
+	}{
+		{FormatJSON, json.Unmarshal},
+		{FormatYAML, yaml.Unmarshal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := Write(&buf, want, tt.format); err != nil {
+				t.Fatalf("Write: %v", err)
+			}
+			var got Report
+			if err := tt.unmarshal(buf.Bytes(), &got); err != nil {
+				t.Fatalf("unmarshal: %v\n%s", err, buf.String())
+			}
+			if got.Status != want.Status || got.Fingerprint != "abc" || got.Summary != want.Summary {
+				t.Errorf("got %+v, want %+v", got, want)
+			}
+			if len(got.Hosts) != 1 || len(got.Hosts[0].Changes) != 2 || got.Hosts[0].Changes[0].ResourceID != "pkg.nginx" {
+				t.Errorf("hosts = %+v", got.Hosts)
+			}
+		})
+	}
+
+	if err := Write(&bytes.Buffer{}, want, FormatText); err == nil {
+		t.Error("expected an error writing a text report")
+	}
+}
+
+func TestValidateFormat(t *testing.T) {
+	for _, format := range []string{FormatText, FormatJSON, FormatYAML} {
+		if err := ValidateFormat(format); err != nil {
+			t.Errorf("ValidateFormat(%q) = %v", format, err)
+		}
+	}
+	if err := ValidateFormat("xml"); err == nil {
+		t.Error("expected an error for xml")
+	}
+}
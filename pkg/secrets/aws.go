@@ -0,0 +1,609 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/sigv4"
+)
+
+// awsTimeout bounds each request to AWS
+const awsTimeout = 30 * time.Second
+
+// AWSConfig locates the AWS account the aws and ssm providers read from.
+// Credentials come from the profile when one is named, otherwise from
+// AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, then from the AWS_PROFILE or
+// default profile of the shared credentials file. With a role, they are
+// only used to assume it.
+type AWSConfig struct {
+	// Region defaults to AWS_REGION, then us-east-1
+	Region  string `yaml:"region,omitempty" json:"region,omitempty" mapstructure:"region"`
+	Profile string `yaml:"profile,omitempty" json:"profile,omitempty" mapstructure:"profile"`
+	// RoleARN is a role to assume, such as one in the account the secrets
+	// are kept in
+	RoleARN     string `yaml:"role_arn,omitempty" json:"role_arn,omitempty" mapstructure:"role_arn"`
+	ExternalID  string `yaml:"external_id,omitempty" json:"external_id,omitempty" mapstructure:"external_id"`
+	SessionName string `yaml:"session_name,omitempty" json:"session_name,omitempty" mapstructure:"session_name"`
+	// The endpoints default to those of AWS in the region; set them to
+	// reach a VPC endpoint or LocalStack
+	SecretsManagerEndpoint string `yaml:"secretsmanager_endpoint,omitempty" json:"secretsmanager_endpoint,omitempty" mapstructure:"secretsmanager_endpoint"`
+	SSMEndpoint            string `yaml:"ssm_endpoint,omitempty" json:"ssm_endpoint,omitempty" mapstructure:"ssm_endpoint"`
+	STSEndpoint            string `yaml:"sts_endpoint,omitempty" json:"sts_endpoint,omitempty" mapstructure:"sts_endpoint"`
+	KMSEndpoint            string `yaml:"kms_endpoint,omitempty" json:"kms_endpoint,omitempty" mapstructure:"kms_endpoint"`
+	// SSMKMSKeyID is the KMS key parameters the ssm provider writes are
+	// encrypted with, the account's default key when empty
+	SSMKMSKeyID string       `yaml:"ssm_kms_key_id,omitempty" json:"ssm_kms_key_id,omitempty" mapstructure:"ssm_kms_key_id"`
+	Client      *http.Client `yaml:"-" json:"-" mapstructure:"-"`
+}
+
+// awsError is an error returned by an AWS JSON API
+type awsError struct {
+	Type    string
+	Message string
+}
+
+func (e *awsError) Error() string {
+	return e.Type + ": " + e.Message
+}
+
+// isAWSError reports whether err is an AWS error of a type, such as
+// ResourceNotFoundException
+func isAWSError(err error, errorType string) bool {
+	var aerr *awsError
+	return errors.As(err, &aerr) && aerr.Type == errorType
+}
+
+// awsSession signs requests to AWS JSON APIs with credentials found once
+// and, when a role is assumed, refreshed before they expire
+type awsSession struct {
+	config AWSConfig
+	now    func() time.Time
+
+	mu          sync.Mutex
+	credentials sigv4.Credentials
+	expires     time.Time
+}
+
+// newAWSSession fills in the defaults of a config
+func newAWSSession(config AWSConfig) *awsSession {
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: awsTimeout}
+	}
+	return &awsSession{config: config, now: time.Now}
+}
+
+// signingCredentials returns the credentials to sign requests with
+func (s *awsSession) signingCredentials(ctx context.Context) (sigv4.Credentials, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.credentials.AccessKey != "" && (s.expires.IsZero() || s.now().Add(5*time.Minute).Before(s.expires)) {
+		return s.credentials, nil
+	}
+
+	credentials, err := sigv4.FindCredentials(s.config.Profile)
+	if err != nil {
+		return sigv4.Credentials{}, err
+	}
+	var expires time.Time
+	if s.config.RoleARN != "" {
+		credentials, expires, err = sigv4.AssumeRole(ctx, s.config.Client, credentials, s.config.Region, sigv4.RoleRequest{
+			ARN:         s.config.RoleARN,
+			ExternalID:  s.config.ExternalID,
+			SessionName: s.config.SessionName,
+			Endpoint:    s.config.STSEndpoint,
+		}, s.now())
+		if err != nil {
+			return sigv4.Credentials{}, err
+		}
+	}
+	s.credentials = credentials
+	s.expires = expires
+	return credentials, nil
+}
+
+// call makes a request to an AWS JSON API, such as secretsmanager with the
+// target secretsmanager.GetSecretValue, decoding the response into out
+func (s *awsSession) call(ctx context.Context, service, endpoint, target string, in, out interface{}) error {
+	credentials, err := s.signingCredentials(ctx)
+	if err != nil {
+		return err
+	}
+	if endpoint == "" {
+		endpoint = "https://" + service + "." + s.config.Region + ".amazonaws.com"
+	}
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", target)
+	sigv4.Sign(req, body, credentials, s.config.Region, service, s.now())
+
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Type         string `json:"__type"`
+			Message      string `json:"message"`
+			MessageUpper string `json:"Message"`
+		}
+		if json.Unmarshal(data, &failure) != nil || failure.Type == "" {
+			return fmt.Errorf("%s returned %s", service, resp.Status)
+		}
+		// Types may be namespaced, as in com.amazonaws.secretsmanager#ResourceNotFoundException
+		if i := strings.LastIndex(failure.Type, "#"); i >= 0 {
+			failure.Type = failure.Type[i+1:]
+		}
+		if failure.Message == "" {
+			failure.Message = failure.MessageUpper
+		}
+		return &awsError{Type: failure.Type, Message: failure.Message}
+	}
+	if out == nil {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from %s: %w", service, err)
+	}
+	return nil
+}
+
+// awsReference is a secret path split into the name, the version options
+// after ? and the JSON field after #, as in prod/db?stage=AWSPREVIOUS#password
+type awsReference struct {
+	name    string
+	field   string
+	options url.Values
+}
+
+// parseAWSReference splits a secret path, accepting only the named
+// options; paths written to accept none, since versions cannot be written
+func parseAWSReference(path string, options ...string) (awsReference, error) {
+	rest, field, _ := strings.Cut(path, "#")
+	name, query, _ := strings.Cut(rest, "?")
+	reference := awsReference{name: name, field: field}
+	if name == "" {
+		return reference, fmt.Errorf("secret path %q names no secret", path)
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return reference, fmt.Errorf("invalid options in secret path %q: %w", path, err)
+	}
+	for key := range values {
+		known := false
+		for _, option := range options {
+			known = known || key == option
+		}
+		if !known && len(options) == 0 {
+			return reference, fmt.Errorf("secret path %q selects a version, which cannot be written", path)
+		}
+		if !known {
+			return reference, fmt.Errorf("unknown option %s in secret path %q, must be one of: %s", key, path, strings.Join(options, ", "))
+		}
+	}
+	reference.options = values
+	return reference, nil
+}
+
+// jsonField returns a field of a JSON object secret
+func jsonField(name, value, field string) (string, error) {
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(value), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not a JSON object, so it has no field %s", name, field)
+	}
+	found, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", name, field)
+	}
+	return vaultString(found)
+}
+
+// setJSONField returns a JSON object secret with a field set, or removed
+// when remove is true; an empty current value starts a new object
+func setJSONField(name, current, field, value string, remove bool) (string, error) {
+	fields := make(map[string]interface{})
+	if current != "" {
+		if err := json.Unmarshal([]byte(current), &fields); err != nil {
+			return "", fmt.Errorf("secret %s is not a JSON object, so it has no field %s", name, field)
+		}
+	}
+	if remove {
+		if _, ok := fields[field]; !ok {
+			return "", fmt.Errorf("secret %s has no field %s", name, field)
+		}
+		delete(fields, field)
+	} else {
+		fields[field] = value
+	}
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
+
+// awsTime formats the seconds since the epoch AWS JSON APIs return
+func awsTime(seconds float64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(0, int64(seconds*float64(time.Second))).UTC().Format(time.RFC3339)
+}
+
+// AWSSecretsProvider reads and writes secrets in AWS Secrets Manager. Paths
+// name the secret, optionally a version after ?, as stage=AWSPREVIOUS or
+// version=<id>, and a field of a JSON secret after #, as in
+// prod/db?stage=AWSPREVIOUS#password. The AWSCURRENT version is read by
+// default.
+type AWSSecretsProvider struct {
+	session *awsSession
+}
+
+// NewAWSSecretsProvider creates an AWS Secrets Manager provider
+func NewAWSSecretsProvider(config AWSConfig) *AWSSecretsProvider {
+	return &AWSSecretsProvider{session: newAWSSession(config)}
+}
+
+// Type returns the provider type
+func (a *AWSSecretsProvider) Type() string {
+	return "aws"
+}
+
+// secretValue is the response of GetSecretValue
+type secretValue struct {
+	ARN           string   `json:"ARN"`
+	Name          string   `json:"Name"`
+	VersionID     string   `json:"VersionId"`
+	VersionStages []string `json:"VersionStages"`
+	SecretString  string   `json:"SecretString"`
+	SecretBinary  []byte   `json:"SecretBinary"`
+	CreatedDate   float64  `json:"CreatedDate"`
+}
+
+// getSecretValue reads a version of a secret
+func (a *AWSSecretsProvider) getSecretValue(ctx context.Context, reference awsReference) (*secretValue, error) {
+	in := map[string]string{"SecretId": reference.name}
+	if stage := reference.options.Get("stage"); stage != "" {
+		in["VersionStage"] = stage
+	}
+	if version := reference.options.Get("version"); version != "" {
+		in["VersionId"] = version
+	}
+	var out secretValue
+	if err := a.session.call(ctx, "secretsmanager", a.session.config.SecretsManagerEndpoint, "secretsmanager.GetSecretValue", in, &out); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// GetSecret reads a secret, or a field of a JSON secret
+func (a *AWSSecretsProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
+	reference, err := parseAWSReference(path, "stage", "version")
+	if err != nil {
+		return nil, err
+	}
+	out, err := a.getSecretValue(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secret %s: %w", reference.name, err)
+	}
+	value := out.SecretString
+	if out.SecretBinary != nil {
+		value = string(out.SecretBinary)
+	}
+	if reference.field != "" {
+		if value, err = jsonField(reference.name, value, reference.field); err != nil {
+			return nil, err
+		}
+	}
+	return &Secret{
+		Path:  path,
+		Value: value,
+		Metadata: map[string]string{
+			"arn":            out.ARN,
+			"version_id":     out.VersionID,
+			"version_stages": strings.Join(out.VersionStages, ","),
+		},
+		CreatedAt: awsTime(out.CreatedDate),
+	}, nil
+}
+
+// SetSecret stores a new version of a secret, creating the secret if it
+// does not exist. With a field, the other fields of the JSON secret are
+// kept.
+func (a *AWSSecretsProvider) SetSecret(ctx context.Context, path, value string) error {
+	reference, err := parseAWSReference(path)
+	if err != nil {
+		return err
+	}
+	if reference.field != "" {
+		current := ""
+		out, err := a.getSecretValue(ctx, reference)
+		switch {
+		case err == nil:
+			current = out.SecretString
+		case !isAWSError(err, "ResourceNotFoundException"):
+			return fmt.Errorf("failed to read secret %s: %w", reference.name, err)
+		}
+		if value, err = setJSONField(reference.name, current, reference.field, value, false); err != nil {
+			return err
+		}
+	}
+	return a.putSecretValue(ctx, reference.name, value)
+}
+
+// putSecretValue stores a new version of a secret, creating it if needed
+func (a *AWSSecretsProvider) putSecretValue(ctx context.Context, name, value string) error {
+	endpoint := a.session.config.SecretsManagerEndpoint
+	err := a.session.call(ctx, "secretsmanager", endpoint, "secretsmanager.PutSecretValue",
+		map[string]string{"SecretId": name, "SecretString": value}, nil)
+	if isAWSError(err, "ResourceNotFoundException") {
+		err = a.session.call(ctx, "secretsmanager", endpoint, "secretsmanager.CreateSecret",
+			map[string]string{"Name": name, "SecretString": value}, nil)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// DeleteSecret schedules a secret for deletion after the default recovery
+// window, or removes one field of a JSON secret
+func (a *AWSSecretsProvider) DeleteSecret(ctx context.Context, path string) error {
+	reference, err := parseAWSReference(path)
+	if err != nil {
+		return err
+	}
+	if reference.field != "" {
+		out, err := a.getSecretValue(ctx, reference)
+		if err != nil {
+			return fmt.Errorf("failed to read secret %s: %w", reference.name, err)
+		}
+		value, err := setJSONField(reference.name, out.SecretString, reference.field, "", true)
+		if err != nil {
+			return err
+		}
+		return a.putSecretValue(ctx, reference.name, value)
+	}
+	if err := a.session.call(ctx, "secretsmanager", a.session.config.SecretsManagerEndpoint, "secretsmanager.DeleteSecret",
+		map[string]string{"SecretId": reference.name}, nil); err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", reference.name, err)
+	}
+	return nil
+}
+
+// ListSecrets lists the names of the secrets starting with a prefix
+func (a *AWSSecretsProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	names := []string{}
+	next := ""
+	for {
+		in := map[string]interface{}{"MaxResults": 100}
+		if prefix != "" {
+			in["Filters"] = []map[string]interface{}{{"Key": "name", "Values": []string{prefix}}}
+		}
+		if next != "" {
+			in["NextToken"] = next
+		}
+		var out struct {
+			SecretList []struct {
+				Name string `json:"Name"`
+			} `json:"SecretList"`
+			NextToken string `json:"NextToken"`
+		}
+		if err := a.session.call(ctx, "secretsmanager", a.session.config.SecretsManagerEndpoint, "secretsmanager.ListSecrets", in, &out); err != nil {
+			return nil, fmt.Errorf("failed to list secrets: %w", err)
+		}
+		for _, secret := range out.SecretList {
+			if strings.HasPrefix(secret.Name, prefix) {
+				names = append(names, secret.Name)
+			}
+		}
+		if next = out.NextToken; next == "" {
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// SSMParameterProvider reads and writes parameters in AWS Systems Manager
+// Parameter Store, decrypting SecureString parameters. Paths name the
+// parameter, optionally a version or label after ?, as version=3 or
+// label=prod, and a field of a JSON parameter after #. Hierarchical names
+// get their leading slash, so ssm://prod/db/password reads /prod/db/password.
+type SSMParameterProvider struct {
+	session *awsSession
+}
+
+// NewSSMParameterProvider creates a Parameter Store provider
+func NewSSMParameterProvider(config AWSConfig) *SSMParameterProvider {
+	return &SSMParameterProvider{session: newAWSSession(config)}
+}
+
+// Type returns the provider type
+func (p *SSMParameterProvider) Type() string {
+	return "ssm"
+}
+
+// ssmName returns the parameter name of a path
+func ssmName(name string) string {
+	if strings.Contains(name, "/") && !strings.HasPrefix(name, "/") {
+		return "/" + name
+	}
+	return name
+}
+
+// ssmParameter is a parameter as Parameter Store returns it
+type ssmParameter struct {
+	Name             string  `json:"Name"`
+	Type             string  `json:"Type"`
+	Value            string  `json:"Value"`
+	Version          int     `json:"Version"`
+	ARN              string  `json:"ARN"`
+	LastModifiedDate float64 `json:"LastModifiedDate"`
+}
+
+// getParameter reads a parameter, decrypted
+func (p *SSMParameterProvider) getParameter(ctx context.Context, reference awsReference) (*ssmParameter, error) {
+	name := ssmName(reference.name)
+	if version := reference.options.Get("version"); version != "" {
+		name += ":" + version
+	} else if label := reference.options.Get("label"); label != "" {
+		name += ":" + label
+	}
+	var out struct {
+		Parameter ssmParameter `json:"Parameter"`
+	}
+	if err := p.session.call(ctx, "ssm", p.session.config.SSMEndpoint, "AmazonSSM.GetParameter",
+		map[string]interface{}{"Name": name, "WithDecryption": true}, &out); err != nil {
+		return nil, err
+	}
+	return &out.Parameter, nil
+}
+
+// GetSecret reads a parameter, or a field of a JSON parameter
+func (p *SSMParameterProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
+	reference, err := parseAWSReference(path, "version", "label")
+	if err != nil {
+		return nil, err
+	}
+	if reference.options.Get("version") != "" && reference.options.Get("label") != "" {
+		return nil, fmt.Errorf("secret path %q selects both a version and a label", path)
+	}
+	parameter, err := p.getParameter(ctx, reference)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read parameter %s: %w", ssmName(reference.name), err)
+	}
+	value := parameter.Value
+	if reference.field != "" {
+		if value, err = jsonField(parameter.Name, value, reference.field); err != nil {
+			return nil, err
+		}
+	}
+	return &Secret{
+		Path:  path,
+		Value: value,
+		Metadata: map[string]string{
+			"arn":     parameter.ARN,
+			"type":    parameter.Type,
+			"version": strconv.Itoa(parameter.Version),
+		},
+		UpdatedAt: awsTime(parameter.LastModifiedDate),
+	}, nil
+}
+
+// SetSecret writes a parameter as a SecureString, or one field of a JSON
+// parameter, keeping its other fields
+func (p *SSMParameterProvider) SetSecret(ctx context.Context, path, value string) error {
+	reference, err := parseAWSReference(path)
+	if err != nil {
+		return err
+	}
+	if reference.field != "" {
+		current := ""
+		parameter, err := p.getParameter(ctx, reference)
+		switch {
+		case err == nil:
+			current = parameter.Value
+		case !isAWSError(err, "ParameterNotFound"):
+			return fmt.Errorf("failed to read parameter %s: %w", ssmName(reference.name), err)
+		}
+		if value, err = setJSONField(reference.name, current, reference.field, value, false); err != nil {
+			return err
+		}
+	}
+	return p.putParameter(ctx, reference.name, value)
+}
+
+// putParameter writes a parameter as a SecureString
+func (p *SSMParameterProvider) putParameter(ctx context.Context, name, value string) error {
+	in := map[string]interface{}{"Name": ssmName(name), "Value": value, "Type": "SecureString", "Overwrite": true}
+	if p.session.config.SSMKMSKeyID != "" {
+		in["KeyId"] = p.session.config.SSMKMSKeyID
+	}
+	if err := p.session.call(ctx, "ssm", p.session.config.SSMEndpoint, "AmazonSSM.PutParameter", in, nil); err != nil {
+		return fmt.Errorf("failed to write parameter %s: %w", ssmName(name), err)
+	}
+	return nil
+}
+
+// DeleteSecret deletes a parameter, or removes one field of a JSON
+// parameter
+func (p *SSMParameterProvider) DeleteSecret(ctx context.Context, path string) error {
+	reference, err := parseAWSReference(path)
+	if err != nil {
+		return err
+	}
+	if reference.field != "" {
+		parameter, err := p.getParameter(ctx, reference)
+		if err != nil {
+			return fmt.Errorf("failed to read parameter %s: %w", ssmName(reference.name), err)
+		}
+		value, err := setJSONField(reference.name, parameter.Value, reference.field, "", true)
+		if err != nil {
+			return err
+		}
+		return p.putParameter(ctx, reference.name, value)
+	}
+	if err := p.session.call(ctx, "ssm", p.session.config.SSMEndpoint, "AmazonSSM.DeleteParameter",
+		map[string]string{"Name": ssmName(reference.name)}, nil); err != nil {
+		return fmt.Errorf("failed to delete parameter %s: %w", ssmName(reference.name), err)
+	}
+	return nil
+}
+
+// ListSecrets lists the parameters under a path, recursively
+func (p *SSMParameterProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	path := "/" + strings.Trim(prefix, "/")
+	names := []string{}
+	next := ""
+	for {
+		in := map[string]interface{}{"Path": path, "Recursive": true, "MaxResults": 10}
+		if next != "" {
+			in["NextToken"] = next
+		}
+		var out struct {
+			Parameters []ssmParameter `json:"Parameters"`
+			NextToken  string         `json:"NextToken"`
+		}
+		if err := p.session.call(ctx, "ssm", p.session.config.SSMEndpoint, "AmazonSSM.GetParametersByPath", in, &out); err != nil {
+			return nil, fmt.Errorf("failed to list parameters under %s: %w", path, err)
+		}
+		for _, parameter := range out.Parameters {
+			names = append(names, parameter.Name)
+		}
+		if next = out.NextToken; next == "" {
+			break
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
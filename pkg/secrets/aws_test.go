@@ -0,0 +1,407 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// fakeAWS serves the Secrets Manager, Parameter Store and STS calls the
+// providers make from memory
+type fakeAWS struct {
+	mu sync.Mutex
+	// secrets holds the versions of each secret, the latest last
+	secrets    map[string][]string
+	parameters map[string][]string
+	keyIDs     map[string]string
+	// wrapped holds the keys KMS generated, by their ciphertext
+	wrapped map[string]wrappedKey
+	// keys are the access keys requests were signed with, by service
+	keys   map[string][]string
+	assume int
+}
+
+func newFakeAWS() *fakeAWS {
+	return &fakeAWS{
+		secrets:    make(map[string][]string),
+		parameters: make(map[string][]string),
+		keyIDs:     make(map[string]string),
+		wrapped:    make(map[string]wrappedKey),
+		keys:       make(map[string][]string),
+	}
+}
+
+func (f *fakeAWS) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// Credential=<key>/<day>/<region>/<service>/aws4_request
+	credential, _, _ := strings.Cut(strings.TrimPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential="), ",")
+	scope := strings.Split(credential, "/")
+	if len(scope) != 5 {
+		http.Error(w, "unsigned request", http.StatusForbidden)
+		return
+	}
+	f.keys[scope[3]] = append(f.keys[scope[3]], scope[0])
+
+	if scope[3] == "sts" {
+		f.assume++
+		fmt.Fprintf(w, `<AssumeRoleResponse><AssumeRoleResult><Credentials>
+<AccessKeyId>ASIAROLE%d</AccessKeyId><SecretAccessKey>role-secret</SecretAccessKey>
+<SessionToken>role-token</SessionToken><Expiration>2099-01-01T00:00:00Z</Expiration>
+</Credentials></AssumeRoleResult></AssumeRoleResponse>`, f.assume)
+		return
+	}
+
+	var in map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&in)
+	reply := func(out interface{}) { json.NewEncoder(w).Encode(out) }
+	fail := func(errorType string) {
+		w.WriteHeader(http.StatusBadRequest)
+		reply(map[string]string{"__type": "com.amazonaws#" + errorType, "message": "it failed"})
+	}
+	name, _ := in["Name"].(string)
+	id, _ := in["SecretId"].(string)
+
+	switch r.Header.Get("X-Amz-Target") {
+	case "secretsmanager.GetSecretValue":
+		versions := f.secrets[id]
+		if len(versions) == 0 {
+			fail("ResourceNotFoundException")
+			return
+		}
+		version, stages := len(versions), []string{"AWSCURRENT"}
+		switch {
+		case in["VersionStage"] == "AWSPREVIOUS" && len(versions) > 1:
+			version, stages = len(versions)-1, []string{"AWSPREVIOUS"}
+		case in["VersionStage"] != nil && in["VersionStage"] != "AWSCURRENT":
+			fail("ResourceNotFoundException")
+			return
+		case in["VersionId"] != nil:
+			fmt.Sscanf(in["VersionId"].(string), "v%d", &version)
+			if version < 1 || version > len(versions) {
+				fail("ResourceNotFoundException")
+				return
+			}
+		}
+		reply(map[string]interface{}{
+			"ARN": "arn:aws:secretsmanager:us-east-1:123456789012:secret:" + id, "Name": id,
+			"VersionId": fmt.Sprintf("v%d", version), "VersionStages": stages,
+			"SecretString": versions[version-1], "CreatedDate": 1717243200.5,
+		})
+	case "secretsmanager.PutSecretValue":
+		if len(f.secrets[id]) == 0 {
+			fail("ResourceNotFoundException")
+			return
+		}
+		f.secrets[id] = append(f.secrets[id], in["SecretString"].(string))
+		reply(map[string]string{})
+	case "secretsmanager.CreateSecret":
+		f.secrets[name] = []string{in["SecretString"].(string)}
+		reply(map[string]string{})
+	case "secretsmanager.DeleteSecret":
+		delete(f.secrets, id)
+		reply(map[string]string{})
+	case "secretsmanager.ListSecrets":
+		prefix := ""
+		if filters, ok := in["Filters"].([]interface{}); ok {
+			prefix = filters[0].(map[string]interface{})["Values"].([]interface{})[0].(string)
+		}
+		// One secret per page, to follow NextToken
+		var names []string
+		for secret := range f.secrets {
+			if strings.HasPrefix(secret, prefix) {
+				names = append(names, secret)
+			}
+		}
+		sort.Strings(names)
+		start := 0
+		if token, ok := in["NextToken"].(string); ok {
+			fmt.Sscanf(token, "%d", &start)
+		}
+		out := map[string]interface{}{"SecretList": []map[string]string{}}
+		if start < len(names) {
+			out["SecretList"] = []map[string]string{{"Name": names[start]}}
+		}
+		if start+1 < len(names) {
+			out["NextToken"] = fmt.Sprint(start + 1)
+		}
+		reply(out)
+	case "AmazonSSM.GetParameter":
+		if in["WithDecryption"] != true {
+			fail("ValidationException")
+			return
+		}
+		name, selector, _ := strings.Cut(name, ":")
+		versions := f.parameters[name]
+		version := len(versions)
+		if selector == "prod" {
+			version = 1
+		} else if selector != "" {
+			fmt.Sscanf(selector, "%d", &version)
+		}
+		if version < 1 || version > len(versions) {
+			fail("ParameterNotFound")
+			return
+		}
+		reply(map[string]interface{}{"Parameter": map[string]interface{}{
+			"Name": name, "Type": "SecureString", "Value": versions[version-1], "Version": version,
+			"ARN": "arn:aws:ssm:us-east-1:123456789012:parameter" + name, "LastModifiedDate": 1717243200,
+		}})
+	case "AmazonSSM.PutParameter":
+		if in["Type"] != "SecureString" || in["Overwrite"] != true {
+			fail("ValidationException")
+			return
+		}
+		f.parameters[name] = append(f.parameters[name], in["Value"].(string))
+		f.keyIDs[name], _ = in["KeyId"].(string)
+		reply(map[string]int{"Version": len(f.parameters[name])})
+	case "AmazonSSM.DeleteParameter":
+		if _, ok := f.parameters[name]; !ok {
+			fail("ParameterNotFound")
+			return
+		}
+		delete(f.parameters, name)
+		reply(map[string]string{})
+	case "AmazonSSM.GetParametersByPath":
+		path := strings.TrimSuffix(in["Path"].(string), "/") + "/"
+		var parameters []map[string]string
+		for name := range f.parameters {
+			if strings.HasPrefix(name, path) {
+				parameters = append(parameters, map[string]string{"Name": name})
+			}
+		}
+		reply(map[string]interface{}{"Parameters": parameters})
+	case "TrentService.GenerateDataKeyWithoutPlaintext":
+		if in["KeySpec"] != "AES_256" || in["KeyId"] != "alias/forge" {
+			fail("ValidationException")
+			return
+		}
+		blob := fmt.Sprintf("wrapped-%d", len(f.wrapped))
+		plaintext := make([]byte, 32)
+		copy(plaintext, blob)
+		f.wrapped[blob] = wrappedKey{plaintext: plaintext, context: fmt.Sprint(in["EncryptionContext"])}
+		reply(map[string]interface{}{"CiphertextBlob": []byte(blob), "KeyId": in["KeyId"]})
+	case "TrentService.Decrypt":
+		blob, _ := base64.StdEncoding.DecodeString(in["CiphertextBlob"].(string))
+		key, ok := f.wrapped[string(blob)]
+		if !ok || key.context != fmt.Sprint(in["EncryptionContext"]) {
+			fail("InvalidCiphertextException")
+			return
+		}
+		reply(map[string]interface{}{"Plaintext": key.plaintext})
+	default:
+		fail("UnknownOperationException")
+	}
+}
+
+// wrappedKey is a key generated by the fake KMS and the encryption context
+// it is bound to
+type wrappedKey struct {
+	plaintext []byte
+	context   string
+}
+
+// newFakeAWSConfig returns a config reaching a fake AWS for every service
+func newFakeAWSConfig(t *testing.T, fake *fakeAWS) AWSConfig {
+	t.Helper()
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	t.Setenv("AWS_ACCESS_KEY_ID", "AKIAENV")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "env-secret")
+	t.Setenv("AWS_SESSION_TOKEN", "")
+	return AWSConfig{
+		Region:                 "us-east-1",
+		SecretsManagerEndpoint: server.URL,
+		SSMEndpoint:            server.URL,
+		STSEndpoint:            server.URL,
+		KMSEndpoint:            server.URL,
+	}
+}
+
+func TestAWSSecretsProvider(t *testing.T) {
+	fake := newFakeAWS()
+	manager := NewSecretsManager()
+	manager.RegisterProvider(NewAWSSecretsProvider(newFakeAWSConfig(t, fake)))
+	ctx := context.Background()
+
+	if _, err := manager.GetSecret(ctx, "aws://prod/db"); err == nil || !strings.Contains(err.Error(), "ResourceNotFoundException") {
+		t.Errorf("GetSecret of a missing secret = %v", err)
+	}
+	if err := manager.SetSecret(ctx, "aws://prod/api-key", "abc123"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "aws://prod/db#password", "hunter2"); err != nil {
+		t.Fatalf("SetSecret of a field of a new secret: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "aws://prod/db#username", "app"); err != nil {
+		t.Fatalf("SetSecret of a second field: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "aws://prod/db?stage=AWSPREVIOUS#password", "x"); err == nil || !strings.Contains(err.Error(), "cannot be written") {
+		t.Errorf("SetSecret of a version = %v", err)
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "prod/api-key", want: "abc123"},
+		{path: "prod/db", want: `{"password":"hunter2","username":"app"}`},
+		{path: "prod/db#username", want: "app"},
+		{path: "prod/db?stage=AWSPREVIOUS", want: `{"password":"hunter2"}`},
+		{path: "prod/db?version=v1#password", want: "hunter2"},
+		{path: "prod/db#port", wantErr: "has no field port"},
+		{path: "prod/api-key#password", wantErr: "not a JSON object"},
+		{path: "prod/db?stage=PENDING", wantErr: "ResourceNotFoundException"},
+		{path: "prod/db?label=x", wantErr: "unknown option label"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			secret, err := manager.GetSecret(ctx, "aws://"+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetSecret error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || secret.Value != tt.want {
+				t.Fatalf("GetSecret = %+v, %v, want %s", secret, err, tt.want)
+			}
+		})
+	}
+	secret, _ := manager.GetSecret(ctx, "aws://prod/db")
+	if secret.Metadata["version_id"] != "v2" || secret.Metadata["version_stages"] != "AWSCURRENT" || secret.CreatedAt != "2024-06-01T12:00:00Z" {
+		t.Errorf("secret = %+v", secret)
+	}
+
+	manager.SetSecret(ctx, "aws://staging/db", "s3cret")
+	list, err := manager.ListSecrets(ctx, "aws://prod/")
+	if want := []string{"prod/api-key", "prod/db"}; err != nil || !reflect.DeepEqual(list, want) {
+		t.Errorf("ListSecrets = %v, %v, want %v", list, err, want)
+	}
+
+	if err := manager.DeleteSecret(ctx, "aws://prod/db#username"); err != nil {
+		t.Fatalf("DeleteSecret of a field: %v", err)
+	}
+	if secret, _ := manager.GetSecret(ctx, "aws://prod/db"); secret.Value != `{"password":"hunter2"}` {
+		t.Errorf("secret after deleting a field = %s", secret.Value)
+	}
+	if err := manager.DeleteSecret(ctx, "aws://prod/db"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, ok := fake.secrets["prod/db"]; ok {
+		t.Errorf("secret not deleted")
+	}
+	for _, key := range fake.keys["secretsmanager"] {
+		if key != "AKIAENV" {
+			t.Fatalf("signed with %s, want the environment's credentials", key)
+		}
+	}
+}
+
+func TestSSMParameterProvider(t *testing.T) {
+	fake := newFakeAWS()
+	config := newFakeAWSConfig(t, fake)
+	config.SSMKMSKeyID = "alias/forge"
+	manager := NewSecretsManager()
+	manager.RegisterProvider(NewSSMParameterProvider(config))
+	ctx := context.Background()
+
+	if err := manager.SetSecret(ctx, "ssm://prod/db/password", "hunter2"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "ssm://prod/db/password", "correct-horse"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "ssm://prod/app#token", "abc"); err != nil {
+		t.Fatalf("SetSecret of a field: %v", err)
+	}
+	if err := manager.SetSecret(ctx, "ssm://flat", "value"); err != nil {
+		t.Fatalf("SetSecret of a flat name: %v", err)
+	}
+	if fake.keyIDs["/prod/db/password"] != "alias/forge" {
+		t.Errorf("written with key %q, want alias/forge", fake.keyIDs["/prod/db/password"])
+	}
+
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "prod/db/password", want: "correct-horse"},
+		{path: "/prod/db/password", want: "correct-horse"},
+		{path: "prod/db/password?version=1", want: "hunter2"},
+		{path: "prod/db/password?label=prod", want: "hunter2"},
+		{path: "prod/app#token", want: "abc"},
+		{path: "flat", want: "value"},
+		{path: "prod/db/password?version=1&label=prod", wantErr: "both a version and a label"},
+		{path: "prod/db/user", wantErr: "ParameterNotFound"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			secret, err := manager.GetSecret(ctx, "ssm://"+tt.path)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("GetSecret error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || secret.Value != tt.want {
+				t.Fatalf("GetSecret = %+v, %v, want %s", secret, err, tt.want)
+			}
+		})
+	}
+	secret, _ := manager.GetSecret(ctx, "ssm://prod/db/password")
+	if secret.Metadata["version"] != "2" || secret.Metadata["type"] != "SecureString" {
+		t.Errorf("secret = %+v", secret)
+	}
+
+	list, err := manager.ListSecrets(ctx, "ssm://prod")
+	if want := []string{"/prod/app", "/prod/db/password"}; err != nil || !reflect.DeepEqual(list, want) {
+		t.Errorf("ListSecrets = %v, %v, want %v", list, err, want)
+	}
+	if err := manager.DeleteSecret(ctx, "ssm://prod/db/password"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if err := manager.DeleteSecret(ctx, "ssm://prod/db/password"); err == nil || !strings.Contains(err.Error(), "ParameterNotFound") {
+		t.Errorf("DeleteSecret of a missing parameter = %v", err)
+	}
+}
+
+func TestAWSSession_AssumeRole(t *testing.T) {
+	fake := newFakeAWS()
+	config := newFakeAWSConfig(t, fake)
+	config.RoleARN = "arn:aws:iam::123456789012:role/secrets-reader"
+	provider := NewAWSSecretsProvider(config)
+	ctx := context.Background()
+
+	provider.SetSecret(ctx, "prod/db", "hunter2")
+	if _, err := provider.GetSecret(ctx, "prod/db"); err != nil {
+		t.Fatalf("GetSecret: %v", err)
+	}
+	if fake.assume != 1 {
+		t.Errorf("role assumed %d times, want once while its credentials last", fake.assume)
+	}
+	if keys := fake.keys["sts"]; len(keys) != 1 || keys[0] != "AKIAENV" {
+		t.Errorf("STS signed with %v, want the environment's credentials", keys)
+	}
+	for _, key := range fake.keys["secretsmanager"] {
+		if key != "ASIAROLE1" {
+			t.Fatalf("Secrets Manager signed with %s, want the role's credentials", key)
+		}
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", t.TempDir()+"/missing")
+	if _, err := NewAWSSecretsProvider(config).GetSecret(ctx, "prod/db"); err == nil || !strings.Contains(err.Error(), "no AWS credentials") {
+		t.Errorf("GetSecret without credentials = %v", err)
+	}
+}
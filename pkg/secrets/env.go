@@ -0,0 +1,250 @@
+package secrets
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// DefaultEnvFile is the dotenv file env:// references fall back to when
+	// no files are configured; it is skipped when it does not exist
+	DefaultEnvFile = ".env"
+	// DefaultEnvPrefix is prepended to the names env:// references look up
+	// when no prefix is configured
+	DefaultEnvPrefix = "FORGE_SECRET_"
+)
+
+// EnvConfig configures the env provider
+type EnvConfig struct {
+	// Files are dotenv files read, in order, for variables the process
+	// environment does not set; .env when it exists by default
+	Files []string `yaml:"files,omitempty" json:"files,omitempty" mapstructure:"files"`
+	// Prefix is prepended to every name looked up, so env://DB_PASSWORD
+	// with the prefix FORGE_SECRET_ reads FORGE_SECRET_DB_PASSWORD and
+	// references cannot read the rest of the environment. It is
+	// FORGE_SECRET_ by default.
+	Prefix string `yaml:"prefix,omitempty" json:"prefix,omitempty" mapstructure:"prefix"`
+}
+
+// EnvProvider reads secrets from environment variables, for CI pipelines
+// that inject credentials into the job. A path is a variable name, looked
+// up in the process environment and then in the dotenv files, or
+// <file>#<name> to read one of the dotenv files only. It is read-only.
+type EnvProvider struct {
+	config   EnvConfig
+	optional bool
+}
+
+// NewEnvProvider creates a provider for environment variables
+func NewEnvProvider(config EnvConfig) *EnvProvider {
+	provider := &EnvProvider{config: config}
+	if provider.config.Prefix == "" {
+		provider.config.Prefix = DefaultEnvPrefix
+	}
+	if len(provider.config.Files) == 0 {
+		provider.config.Files = []string{DefaultEnvFile}
+		provider.optional = true
+	}
+	return provider
+}
+
+// Type returns the provider type
+func (p *EnvProvider) Type() string {
+	return "env"
+}
+
+// GetSecret returns the value of an environment variable
+func (p *EnvProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
+	if file, name, ok := strings.Cut(path, "#"); ok {
+		if !p.configured(file) {
+			return nil, fmt.Errorf("%s is not one of the env files configured under secrets.env.files", file)
+		}
+		values, err := readEnvFile(file)
+		if err != nil {
+			return nil, err
+		}
+		value, ok := values[p.config.Prefix+name]
+		if !ok {
+			return nil, fmt.Errorf("no variable %s in %s", p.config.Prefix+name, file)
+		}
+		return &Secret{Path: path, Value: value, Metadata: map[string]string{"file": file}}, nil
+	}
+
+	name := p.config.Prefix + path
+	if value, ok := os.LookupEnv(name); ok {
+		return &Secret{Path: path, Value: value, Metadata: map[string]string{"source": "environment"}}, nil
+	}
+	for _, file := range p.config.Files {
+		values, err := p.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := values[name]; ok {
+			return &Secret{Path: path, Value: value, Metadata: map[string]string{"file": file}}, nil
+		}
+	}
+	return nil, fmt.Errorf("environment variable %s is not set", name)
+}
+
+// SetSecret is not supported; the environment is set by whatever runs forge
+func (p *EnvProvider) SetSecret(ctx context.Context, path, value string) error {
+	return fmt.Errorf("the env provider is read-only")
+}
+
+// DeleteSecret is not supported
+func (p *EnvProvider) DeleteSecret(ctx context.Context, path string) error {
+	return fmt.Errorf("the env provider is read-only")
+}
+
+// ListSecrets lists the variables whose names, less the configured prefix,
+// start with a prefix
+func (p *EnvProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	found := make(map[string]bool)
+	add := func(name string) {
+		if trimmed, ok := strings.CutPrefix(name, p.config.Prefix); ok && strings.HasPrefix(trimmed, prefix) {
+			found[trimmed] = true
+		}
+	}
+	for _, variable := range os.Environ() {
+		name, _, _ := strings.Cut(variable, "=")
+		add(name)
+	}
+	for _, file := range p.config.Files {
+		values, err := p.readFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for name := range values {
+			add(name)
+		}
+	}
+	names := make([]string, 0, len(found))
+	for name := range found {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// configured reports whether file is one of the configured dotenv files,
+// the only ones a reference may name
+func (p *EnvProvider) configured(file string) bool {
+	for _, configured := range p.config.Files {
+		if filepath.Clean(configured) == filepath.Clean(file) {
+			return true
+		}
+	}
+	return false
+}
+
+// readFile reads one of the configured dotenv files; the default file may
+// be missing
+func (p *EnvProvider) readFile(file string) (map[string]string, error) {
+	values, err := readEnvFile(file)
+	if err != nil && p.optional && errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	return values, err
+}
+
+// readEnvFile reads a dotenv file. It is read on every lookup, so changes
+// made while forge runs are picked up.
+func readEnvFile(file string) (map[string]string, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read env file: %w", err)
+	}
+	values, err := ParseDotenv(data)
+	if err != nil {
+		return nil, fmt.Errorf("env file %s: %w", file, err)
+	}
+	return values, nil
+}
+
+// ParseDotenv parses the NAME=value lines of a dotenv file. Lines may start
+// with export; blank lines and lines starting with # are skipped. Values in
+// single quotes are taken as they are, values in double quotes have \n, \"
+// and \\ escapes, and unquoted values end at a # that follows a space.
+func ParseDotenv(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for number := 1; scanner.Scan(); number++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimSpace(strings.TrimPrefix(line, "export "))
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || !validEnvName(name) {
+			return nil, fmt.Errorf("line %d: expected NAME=value", number)
+		}
+		value, err := dotenvValue(strings.TrimSpace(value))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", number, err)
+		}
+		values[name] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// dotenvValue unquotes the value of a dotenv line
+func dotenvValue(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "'"):
+		end := strings.Index(value[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated single quote")
+		}
+		return value[1 : end+1], nil
+	case strings.HasPrefix(value, `"`):
+		var unquoted strings.Builder
+		for i := 1; i < len(value); i++ {
+			switch c := value[i]; {
+			case c == '"':
+				return unquoted.String(), nil
+			case c == '\\' && i+1 < len(value):
+				i++
+				switch value[i] {
+				case 'n':
+					unquoted.WriteByte('\n')
+				case 't':
+					unquoted.WriteByte('\t')
+				default:
+					unquoted.WriteByte(value[i])
+				}
+			default:
+				unquoted.WriteByte(c)
+			}
+		}
+		return "", fmt.Errorf("unterminated double quote")
+	}
+	if i := strings.Index(value, " #"); i >= 0 {
+		value = strings.TrimSpace(value[:i])
+	}
+	return value, nil
+}
+
+// validEnvName reports whether name is a shell variable name
+func validEnvName(name string) bool {
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		return false
+	}
+	for _, c := range name {
+		if !(c == '_' || (c >= 'A' && c <= 'Z') || (c >= 'a' && c <= 'z') || (c >= '0' && c <= '9')) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,125 @@
+package secrets
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotenv(t *testing.T) {
+	data := `# deploy credentials
+DB_USER=app
+export DB_PASSWORD = "s3cr\"et\nline"
+API_TOKEN='abc#$def'  
+REGION=eu-west-1 # the primary region
+EMPTY=
+URL=https://example.com/#anchor
+`
+	got, err := ParseDotenv([]byte(data))
+	if err != nil {
+		t.Fatalf("ParseDotenv() error = %v", err)
+	}
+	want := map[string]string{
+		"DB_USER":     "app",
+		"DB_PASSWORD": "s3cr\"et\nline",
+		"API_TOKEN":   "abc#$def",
+		"REGION":      "eu-west-1",
+		"EMPTY":       "",
+		"URL":         "https://example.com/#anchor",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDotenv() = %q, want %q", got, want)
+	}
+
+	for _, invalid := range []string{"NO_VALUE", "1ST=x", "BAD-NAME=x", `OPEN="x`, "OPEN='x"} {
+		if _, err := ParseDotenv([]byte(invalid)); err == nil || !strings.Contains(err.Error(), "line 1") {
+			t.Errorf("ParseDotenv(%q) error = %v", invalid, err)
+		}
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	ci := filepath.Join(dir, "ci.env")
+	if err := os.WriteFile(ci, []byte("CI_DB_PASSWORD=from-file\nCI_API_TOKEN=token\nOTHER=x\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("CI_DB_PASSWORD", "from-environment")
+
+	provider := NewEnvProvider(EnvConfig{Files: []string{ci}, Prefix: "CI_"})
+	if provider.Type() != "env" {
+		t.Errorf("Type() = %s", provider.Type())
+	}
+	tests := []struct {
+		path    string
+		want    string
+		wantErr string
+	}{
+		{path: "DB_PASSWORD", want: "from-environment"},
+		{path: "API_TOKEN", want: "token"},
+		{path: ci + "#DB_PASSWORD", want: "from-file"},
+		{path: "OTHER", wantErr: "CI_OTHER is not set"},
+		{path: filepath.Join(dir, "other.env") + "#DB_PASSWORD", wantErr: "is not one of the env files configured"},
+		{path: "/proc/self/environ#DB_PASSWORD", wantErr: "is not one of the env files configured"},
+	}
+	for _, tt := range tests {
+		secret, err := provider.GetSecret(ctx, tt.path)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("GetSecret(%s) error = %v, want %q", tt.path, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("GetSecret(%s) error = %v", tt.path, err)
+		} else if secret.Value != tt.want {
+			t.Errorf("GetSecret(%s) = %q, want %q", tt.path, secret.Value, tt.want)
+		}
+	}
+
+	names, err := provider.ListSecrets(ctx, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(names, []string{"API_TOKEN", "DB_PASSWORD"}) {
+		t.Errorf("ListSecrets() = %v", names)
+	}
+	if err := provider.SetSecret(ctx, "DB_PASSWORD", "x"); err == nil {
+		t.Error("SetSecret() succeeded on a read-only provider")
+	}
+
+	// A configured file must exist; the default .env may be missing
+	missing := NewEnvProvider(EnvConfig{Files: []string{filepath.Join(dir, "missing.env")}})
+	if _, err := missing.GetSecret(ctx, "UNSET_FORGE_TEST_VARIABLE"); err == nil || !strings.Contains(err.Error(), "failed to read env file") {
+		t.Errorf("GetSecret() with a missing file error = %v", err)
+	}
+	optional := &EnvProvider{config: EnvConfig{Files: []string{filepath.Join(dir, DefaultEnvFile)}, Prefix: DefaultEnvPrefix}, optional: true}
+	if _, err := optional.GetSecret(ctx, "UNSET_FORGE_TEST_VARIABLE"); err == nil || !strings.Contains(err.Error(), "is not set") {
+		t.Errorf("GetSecret() without .env error = %v", err)
+	}
+}
+
+func TestSecretsManager_EnvReferences(t *testing.T) {
+	t.Setenv("FORGE_SECRET_DB_PASSWORD", "s3cret")
+	t.Setenv("FORGE_TEST_DB_PASSWORD", "controller")
+	manager := NewSecretsManager()
+	if err := manager.RegisterProvider(NewEnvProvider(EnvConfig{})); err != nil {
+		t.Fatal(err)
+	}
+	resolved, err := manager.ResolveSecrets(context.Background(), "password=${secret:env://DB_PASSWORD}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved != "password=s3cret" {
+		t.Errorf("ResolveSecrets() = %v", resolved)
+	}
+	// Without a configured prefix the default one keeps the rest of the
+	// environment out of reach
+	if _, err := manager.ResolveSecrets(context.Background(), "${secret:env://FORGE_TEST_DB_PASSWORD}"); err == nil {
+		t.Error("ResolveSecrets() read a variable without the default prefix")
+	}
+}
@@ -0,0 +1,285 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/vault"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultSecretsFile is the secrets file file:// references read when they
+// name no file
+const DefaultSecretsFile = "secrets.enc.yaml"
+
+// SecretsFile is a YAML map of secret names to values, encrypted with a
+// vault key so it can be committed alongside modules
+type SecretsFile struct {
+	Path string
+	// KeyID names the vault key the file is encrypted with
+	KeyID  string
+	Values map[string]string
+}
+
+// NewSecretsFile returns an empty secrets file to be encrypted with the key
+// keyID
+func NewSecretsFile(path, keyID string) *SecretsFile {
+	if keyID == "" {
+		keyID = vault.DefaultKeyID
+	}
+	return &SecretsFile{Path: path, KeyID: keyID, Values: make(map[string]string)}
+}
+
+// LoadSecretsFile decrypts a secrets file with the key it names
+func LoadSecretsFile(path string, keys vault.Keyring) (*SecretsFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	keyID, err := vault.KeyID(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s is not encrypted: %w", path, err)
+	}
+	plaintext, err := vault.Decrypt(string(data), keys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt secrets file %s: %w", path, err)
+	}
+	values, err := ParseSecrets([]byte(plaintext))
+	if err != nil {
+		return nil, fmt.Errorf("secrets file %s: %w", path, err)
+	}
+	return &SecretsFile{Path: path, KeyID: keyID, Values: values}, nil
+}
+
+// ParseSecrets parses the plaintext of a secrets file, a YAML map of
+// secret names to string values
+func ParseSecrets(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	if err := yaml.Unmarshal(data, &values); err != nil {
+		return nil, fmt.Errorf("secrets must be a map of names to values: %w", err)
+	}
+	for name := range values {
+		if name == "" || strings.ContainsAny(name, "#}\n") {
+			return nil, fmt.Errorf("invalid secret name %q", name)
+		}
+	}
+	return values, nil
+}
+
+// Plaintext returns the secrets as YAML, sorted by name
+func (f *SecretsFile) Plaintext() ([]byte, error) {
+	if len(f.Values) == 0 {
+		return nil, nil
+	}
+	return yaml.Marshal(f.Values)
+}
+
+// Save encrypts the secrets with the key KeyID and replaces the file
+func (f *SecretsFile) Save(keys vault.Keyring) error {
+	key, err := keys.Key(f.KeyID)
+	if err != nil {
+		return err
+	}
+	plaintext, err := f.Plaintext()
+	if err != nil {
+		return err
+	}
+	sealed, err := vault.Encrypt(key, f.KeyID, string(plaintext))
+	if err != nil {
+		return err
+	}
+
+	// Write next to the file and rename, so a failed write leaves the old
+	// secrets in place
+	tmp, err := os.CreateTemp(filepath.Dir(f.Path), ".secrets-*")
+	if err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.WriteString(sealed); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), f.Path); err != nil {
+		return fmt.Errorf("failed to write secrets file: %w", err)
+	}
+	return nil
+}
+
+// FileConfig configures the file provider
+type FileConfig struct {
+	// Path is the secrets file read by references that name no file,
+	// secrets.enc.yaml by default
+	Path string
+	// KeyID is the vault key new files are encrypted with
+	KeyID string
+	// Keys finds the vault keys files are encrypted with
+	Keys vault.Keyring
+}
+
+// FileProvider reads and writes secrets in encrypted secrets files. A path
+// is a secret name in the default file, or <file>#<name>.
+type FileProvider struct {
+	config FileConfig
+
+	mu    sync.Mutex
+	files map[string]*loadedFile
+}
+
+// loadedFile is a decrypted secrets file and when it was last modified, so
+// changes made by other processes are picked up
+type loadedFile struct {
+	file    *SecretsFile
+	modTime time.Time
+}
+
+// NewFileProvider creates a provider for encrypted secrets files
+func NewFileProvider(config FileConfig) *FileProvider {
+	if config.Path == "" {
+		config.Path = DefaultSecretsFile
+	}
+	return &FileProvider{config: config, files: make(map[string]*loadedFile)}
+}
+
+// Type returns the provider type
+func (p *FileProvider) Type() string {
+	return "file"
+}
+
+// parseFileReference splits <file>#<name> into the file and the name
+func (p *FileProvider) parseFileReference(path string) (string, string) {
+	if file, name, ok := strings.Cut(path, "#"); ok {
+		return file, name
+	}
+	return p.config.Path, path
+}
+
+// load returns the secrets file at path, decrypting it again when it
+// changed since it was last read. A missing file is empty when create is
+// set.
+func (p *FileProvider) load(path string, create bool) (*SecretsFile, error) {
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) && create {
+		return NewSecretsFile(path, p.config.KeyID), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	if loaded, ok := p.files[path]; ok && loaded.modTime.Equal(info.ModTime()) {
+		return loaded.file, nil
+	}
+	if p.config.Keys == nil {
+		return nil, fmt.Errorf("secrets file %s is encrypted, but no vault keys are configured", path)
+	}
+	file, err := LoadSecretsFile(path, p.config.Keys)
+	if err != nil {
+		return nil, err
+	}
+	p.files[path] = &loadedFile{file: file, modTime: info.ModTime()}
+	return file, nil
+}
+
+// save writes a secrets file and remembers it as read
+func (p *FileProvider) save(file *SecretsFile) error {
+	if p.config.Keys == nil {
+		return fmt.Errorf("no vault keys are configured to encrypt %s", file.Path)
+	}
+	if err := file.Save(p.config.Keys); err != nil {
+		return err
+	}
+	info, err := os.Stat(file.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read secrets file: %w", err)
+	}
+	p.files[file.Path] = &loadedFile{file: file, modTime: info.ModTime()}
+	return nil
+}
+
+// GetSecret returns a secret from a secrets file
+func (p *FileProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fileName, name := p.parseFileReference(path)
+	file, err := p.load(fileName, false)
+	if err != nil {
+		return nil, err
+	}
+	value, ok := file.Values[name]
+	if !ok {
+		return nil, fmt.Errorf("no secret %s in %s", name, fileName)
+	}
+	return &Secret{Path: path, Value: value, Metadata: map[string]string{"file": fileName, "key_id": file.KeyID}}, nil
+}
+
+// SetSecret sets a secret in a secrets file, creating the file when needed
+func (p *FileProvider) SetSecret(ctx context.Context, path, value string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fileName, name := p.parseFileReference(path)
+	if name == "" {
+		return fmt.Errorf("secret path %q names no secret", path)
+	}
+	file, err := p.load(fileName, true)
+	if err != nil {
+		return err
+	}
+	updated := NewSecretsFile(file.Path, file.KeyID)
+	for existing, v := range file.Values {
+		updated.Values[existing] = v
+	}
+	updated.Values[name] = value
+	return p.save(updated)
+}
+
+// DeleteSecret removes a secret from a secrets file
+func (p *FileProvider) DeleteSecret(ctx context.Context, path string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fileName, name := p.parseFileReference(path)
+	file, err := p.load(fileName, false)
+	if err != nil {
+		return err
+	}
+	if _, ok := file.Values[name]; !ok {
+		return fmt.Errorf("no secret %s in %s", name, fileName)
+	}
+	updated := NewSecretsFile(file.Path, file.KeyID)
+	for existing, v := range file.Values {
+		if existing != name {
+			updated.Values[existing] = v
+		}
+	}
+	return p.save(updated)
+}
+
+// ListSecrets lists the secrets of a file whose names start with a prefix
+func (p *FileProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fileName, namePrefix := p.parseFileReference(prefix)
+	file, err := p.load(fileName, false)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for name := range file.Values {
+		if !strings.HasPrefix(name, namePrefix) {
+			continue
+		}
+		if strings.Contains(prefix, "#") {
+			name = fileName + "#" + name
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names, nil
+}
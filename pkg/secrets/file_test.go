@@ -0,0 +1,167 @@
+package secrets
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/vault"
+)
+
+// testKeys returns a keyring with the keys default and prod
+func testKeys(t *testing.T) vault.Keyring {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for _, id := range []string{"default", "prod"} {
+		encoded, err := vault.GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys[id], _ = vault.ParseKey(encoded)
+	}
+	return vault.KeyFunc(func(id string) ([]byte, error) {
+		if key, ok := keys[id]; ok {
+			return key, nil
+		}
+		return nil, fmt.Errorf("no vault key %s", id)
+	})
+}
+
+func TestSecretsFile_SaveAndLoad(t *testing.T) {
+	keys := testKeys(t)
+	path := filepath.Join(t.TempDir(), "secrets.enc.yaml")
+
+	file := NewSecretsFile(path, "prod")
+	file.Values["db_password"] = "s3cret"
+	file.Values["tls_key"] = "-----BEGIN KEY-----\nabc\n-----END KEY-----\n"
+	if err := file.Save(keys); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	data, _ := os.ReadFile(path)
+	if !vault.IsEncrypted(data) || strings.Contains(string(data), "s3cret") {
+		t.Fatalf("saved file is not encrypted:\n%s", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadSecretsFile(path, keys)
+	if err != nil {
+		t.Fatalf("LoadSecretsFile: %v", err)
+	}
+	if loaded.KeyID != "prod" || !reflect.DeepEqual(loaded.Values, file.Values) {
+		t.Errorf("LoadSecretsFile = %+v, want %+v", loaded, file)
+	}
+
+	if _, err := LoadSecretsFile(path, testKeys(t)); err == nil || !strings.Contains(err.Error(), "wrong key") {
+		t.Errorf("LoadSecretsFile with the wrong key = %v", err)
+	}
+	os.WriteFile(path, []byte("db_password: plain\n"), 0600)
+	if _, err := LoadSecretsFile(path, keys); err == nil || !strings.Contains(err.Error(), "is not encrypted") {
+		t.Errorf("LoadSecretsFile of a plaintext file = %v", err)
+	}
+}
+
+func TestParseSecrets(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		want    map[string]string
+		wantErr bool
+	}{
+		{name: "values", data: "a: one\nb: 2\n", want: map[string]string{"a": "one", "b": "2"}},
+		{name: "empty", data: "", want: map[string]string{}},
+		{name: "nested", data: "db:\n  password: x\n", wantErr: true},
+		{name: "list", data: "- a\n", wantErr: true},
+		{name: "name with #", data: "'a#b': x\n", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSecrets([]byte(tt.data))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseSecrets error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSecrets = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFileProvider(t *testing.T) {
+	ctx := context.Background()
+	keys := testKeys(t)
+	dir := t.TempDir()
+	defaultFile := filepath.Join(dir, "secrets.enc.yaml")
+	otherFile := filepath.Join(dir, "prod.enc.yaml")
+	provider := NewFileProvider(FileConfig{Path: defaultFile, Keys: keys})
+
+	if _, err := provider.GetSecret(ctx, "db_password"); err == nil {
+		t.Error("GetSecret from a missing file succeeded")
+	}
+	if err := provider.SetSecret(ctx, "db_password", "s3cret"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := provider.SetSecret(ctx, "db_user", "app"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := provider.SetSecret(ctx, otherFile+"#api_token", "t0ken"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+
+	manager := NewSecretsManager()
+	manager.RegisterProvider(provider)
+	resolved, err := manager.ResolveSecrets(ctx, "postgres://${secret:file://db_user}:${secret:file://db_password}@db/${secret:file://"+otherFile+"#api_token}")
+	if err != nil || resolved != "postgres://app:s3cret@db/t0ken" {
+		t.Errorf("ResolveSecrets = %v, %v", resolved, err)
+	}
+
+	names, err := provider.ListSecrets(ctx, "db_")
+	if err != nil || !reflect.DeepEqual(names, []string{"db_password", "db_user"}) {
+		t.Errorf("ListSecrets = %v, %v", names, err)
+	}
+	names, err = provider.ListSecrets(ctx, otherFile+"#")
+	if err != nil || !reflect.DeepEqual(names, []string{otherFile + "#api_token"}) {
+		t.Errorf("ListSecrets of another file = %v, %v", names, err)
+	}
+
+	if err := provider.DeleteSecret(ctx, "db_user"); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, err := provider.GetSecret(ctx, "db_user"); err == nil || !strings.Contains(err.Error(), "no secret db_user") {
+		t.Errorf("GetSecret of a deleted secret = %v", err)
+	}
+	if err := provider.DeleteSecret(ctx, "db_user"); err == nil {
+		t.Error("DeleteSecret of a missing secret succeeded")
+	}
+
+	// Files changed by other processes are read again
+	file, err := LoadSecretsFile(defaultFile, keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Values["db_password"] = "rotated"
+	if err := file.Save(keys); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Hour)
+	os.Chtimes(defaultFile, later, later)
+	if secret, err := provider.GetSecret(ctx, "db_password"); err != nil || secret.Value != "rotated" {
+		t.Errorf("GetSecret after the file changed = %+v, %v", secret, err)
+	}
+
+	// Files stay encrypted with the key they were created with
+	if file, _ := LoadSecretsFile(otherFile, keys); file.KeyID != "default" {
+		t.Errorf("KeyID = %s, want default", file.KeyID)
+	}
+	unkeyed := NewFileProvider(FileConfig{Path: defaultFile})
+	if _, err := unkeyed.GetSecret(ctx, "db_password"); err == nil || !strings.Contains(err.Error(), "no vault keys are configured") {
+		t.Errorf("GetSecret without keys = %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"strings"
+)
+
+// kmsContextKey names the vault key a wrapped key belongs to in its KMS
+// encryption context
+const kmsContextKey = "forge:vault-key"
+
+// KMSKeys wraps vault keys with AWS KMS, so a key can sit in the config file
+// encrypted under a KMS key and is only unwrapped into memory by those the
+// KMS key policy lets decrypt. A wrapped key is bound to its vault key id
+// through the encryption context, so it cannot stand in for another key.
+type KMSKeys struct {
+	session *awsSession
+}
+
+// NewKMSKeys creates a KMS key wrapper
+func NewKMSKeys(config AWSConfig) *KMSKeys {
+	return &KMSKeys{session: newAWSSession(config)}
+}
+
+// GenerateKey creates a vault key with the given id under a KMS key, such
+// as alias/forge, and returns it wrapped, base64 encoded. The plaintext key
+// never leaves KMS.
+func (k *KMSKeys) GenerateKey(ctx context.Context, kmsKeyID, vaultKeyID string) (string, error) {
+	in := map[string]interface{}{
+		"KeyId":             kmsKeyID,
+		"KeySpec":           "AES_256",
+		"EncryptionContext": map[string]string{kmsContextKey: vaultKeyID},
+	}
+	var out struct {
+		CiphertextBlob []byte `json:"CiphertextBlob"`
+	}
+	if err := k.session.call(ctx, "kms", k.session.config.KMSEndpoint, "TrentService.GenerateDataKeyWithoutPlaintext", in, &out); err != nil {
+		return "", fmt.Errorf("failed to generate vault key %s with KMS key %s: %w", vaultKeyID, kmsKeyID, err)
+	}
+	return base64.StdEncoding.EncodeToString(out.CiphertextBlob), nil
+}
+
+// UnwrapKey decrypts the wrapped vault key with the given id and returns it
+// base64 encoded, like any vault key
+func (k *KMSKeys) UnwrapKey(ctx context.Context, wrapped, vaultKeyID string) (string, error) {
+	blob, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(wrapped), ""))
+	if err != nil {
+		return "", fmt.Errorf("wrapped vault key %s is not base64: %w", vaultKeyID, err)
+	}
+	in := map[string]interface{}{
+		"CiphertextBlob":    blob,
+		"EncryptionContext": map[string]string{kmsContextKey: vaultKeyID},
+	}
+	var out struct {
+		Plaintext []byte `json:"Plaintext"`
+	}
+	if err := k.session.call(ctx, "kms", k.session.config.KMSEndpoint, "TrentService.Decrypt", in, &out); err != nil {
+		return "", fmt.Errorf("failed to unwrap vault key %s with KMS: %w", vaultKeyID, err)
+	}
+	return base64.StdEncoding.EncodeToString(out.Plaintext), nil
+}
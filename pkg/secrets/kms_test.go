@@ -0,0 +1,40 @@
+package secrets
+
+import (
+	"context"
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestKMSKeys(t *testing.T) {
+	fake := newFakeAWS()
+	keys := NewKMSKeys(newFakeAWSConfig(t, fake))
+	ctx := context.Background()
+
+	wrapped, err := keys.GenerateKey(ctx, "alias/forge", "store-2024")
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	encoded, err := keys.UnwrapKey(ctx, wrapped, "store-2024")
+	if err != nil {
+		t.Fatalf("UnwrapKey: %v", err)
+	}
+	if key, _ := base64.StdEncoding.DecodeString(encoded); len(key) != 32 {
+		t.Errorf("unwrapped key = %q, want 32 bytes", encoded)
+	}
+
+	// A wrapped key does not unwrap as another vault key
+	if _, err := keys.UnwrapKey(ctx, wrapped, "default"); err == nil || !strings.Contains(err.Error(), "InvalidCiphertextException") {
+		t.Errorf("UnwrapKey under another id = %v", err)
+	}
+	if _, err := keys.UnwrapKey(ctx, "not base64!", "store-2024"); err == nil || !strings.Contains(err.Error(), "not base64") {
+		t.Errorf("UnwrapKey of a corrupt key = %v", err)
+	}
+	if _, err := keys.GenerateKey(ctx, "alias/other", "store-2024"); err == nil || !strings.Contains(err.Error(), "alias/other") {
+		t.Errorf("GenerateKey with an unknown KMS key = %v", err)
+	}
+	if keys := fake.keys["kms"]; len(keys) != 4 {
+		t.Errorf("KMS requests = %d, want 4 signed ones", len(keys))
+	}
+}
@@ -282,96 +282,14 @@ func parseSecretPath(secretPath string) (string, string, error) {
 	return providerType, path, nil
 }
 
-// VaultProvider implements HashiCorp Vault integration
-type VaultProvider struct {
-	address string
-	token   string
-	// In a real implementation, this would use the Vault API client
-}
-
-// NewVaultProvider creates a new Vault secrets provider
-func NewVaultProvider(address, token string) *VaultProvider {
-	return &VaultProvider{
-		address: address,
-		token:   token,
-	}
-}
-
-// Type returns the provider type
-func (v *VaultProvider) Type() string {
-	return "vault"
-}
-
-// GetSecret retrieves a secret from Vault
-func (v *VaultProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
-	// In a real implementation, this would use the Vault API
-	return nil, fmt.Errorf("Vault integration not implemented in test environment")
-}
-
-// SetSecret sets a secret in Vault
-func (v *VaultProvider) SetSecret(ctx context.Context, path, value string) error {
-	// In a real implementation, this would use the Vault API
-	return fmt.Errorf("Vault integration not implemented in test environment")
-}
-
-// DeleteSecret deletes a secret from Vault
-func (v *VaultProvider) DeleteSecret(ctx context.Context, path string) error {
-	// In a real implementation, this would use the Vault API
-	return fmt.Errorf("Vault integration not implemented in test environment")
-}
-
-// ListSecrets lists secrets from Vault
-func (v *VaultProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
-	// In a real implementation, this would use the Vault API
-	return nil, fmt.Errorf("Vault integration not implemented in test environment")
-}
-
-// AWSSecretsProvider implements AWS Secrets Manager integration
-type AWSSecretsProvider struct {
-	region string
-	// In a real implementation, this would use the AWS SDK
-}
-
-// NewAWSSecretsProvider creates a new AWS Secrets Manager provider
-func NewAWSSecretsProvider(region string) *AWSSecretsProvider {
-	return &AWSSecretsProvider{
-		region: region,
-	}
-}
-
-// Type returns the provider type
-func (a *AWSSecretsProvider) Type() string {
-	return "aws"
-}
-
-// GetSecret retrieves a secret from AWS Secrets Manager
-func (a *AWSSecretsProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
-	// In a real implementation, this would use the AWS SDK
-	return nil, fmt.Errorf("AWS Secrets Manager integration not implemented in test environment")
-}
-
-// SetSecret sets a secret in AWS Secrets Manager
-func (a *AWSSecretsProvider) SetSecret(ctx context.Context, path, value string) error {
-	// In a real implementation, this would use the AWS SDK
-	return fmt.Errorf("AWS Secrets Manager integration not implemented in test environment")
-}
-
-// DeleteSecret deletes a secret from AWS Secrets Manager
-func (a *AWSSecretsProvider) DeleteSecret(ctx context.Context, path string) error {
-	// In a real implementation, this would use the AWS SDK
-	return fmt.Errorf("AWS Secrets Manager integration not implemented in test environment")
-}
-
-// ListSecrets lists secrets from AWS Secrets Manager
-func (a *AWSSecretsProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
-	// In a real implementation, this would use the AWS SDK
-	return nil, fmt.Errorf("AWS Secrets Manager integration not implemented in test environment")
-}
-
 // SecretsConfig represents secrets management configuration
 type SecretsConfig struct {
 	Enabled   bool                   `yaml:"enabled" json:"enabled"`
 	Providers map[string]interface{} `yaml:"providers" json:"providers"`
+	// AWS configures the aws and ssm providers
+	AWS *AWSConfig `yaml:"aws,omitempty" json:"aws,omitempty"`
+	// Env configures the env provider
+	Env *EnvConfig `yaml:"env,omitempty" json:"env,omitempty"`
 }
 
 // DefaultSecretsConfig returns default secrets configuration
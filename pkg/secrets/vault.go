@@ -0,0 +1,609 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// vaultTimeout bounds each request to Vault
+const vaultTimeout = 30 * time.Second
+
+// vaultField is the field a secret path without #field reads and writes
+const vaultField = "value"
+
+// VaultConfig locates a Vault server and how to log in to it
+type VaultConfig struct {
+	// Address defaults to VAULT_ADDR
+	Address string
+	// Namespace is the Vault Enterprise namespace requests are made in,
+	// VAULT_NAMESPACE by default
+	Namespace string
+	// Token is used as it is, VAULT_TOKEN by default when no AppRole is set
+	Token string
+	// RoleID and SecretID log in with AppRole instead of a token
+	RoleID   string
+	SecretID string
+	// AppRoleMount is where AppRole is enabled, approle by default
+	AppRoleMount string
+	// KVVersion is the version of the KV engine assumed when the mount of a
+	// path cannot be looked up, 2 by default. The mount is then taken to be
+	// the first element of the path.
+	KVVersion int
+	Client    *http.Client
+}
+
+// vaultMount is a secrets engine mounted in Vault
+type vaultMount struct {
+	path string
+	// version is the KV version, 0 for engines other than KV, which are
+	// read and written at the path as it is
+	version int
+}
+
+// VaultProvider reads and writes secrets in HashiCorp Vault. Paths name
+// the secret and optionally one of its fields, such as secret/app/db#password;
+// without a field the value field is used, or the only field of the secret.
+// KV version 1 and 2 mounts are told apart by asking Vault. The token is
+// renewed before its lease runs out, and an AppRole login is repeated once
+// it can no longer be renewed.
+type VaultProvider struct {
+	config VaultConfig
+	now    func() time.Time
+
+	mu        sync.Mutex
+	token     string
+	ttl       time.Duration
+	expires   time.Time
+	renewable bool
+	mounts    []vaultMount
+}
+
+// NewVaultProvider creates a Vault secrets provider
+func NewVaultProvider(config VaultConfig) (*VaultProvider, error) {
+	if config.Address == "" {
+		config.Address = os.Getenv("VAULT_ADDR")
+	}
+	if config.Address == "" {
+		return nil, fmt.Errorf("the Vault provider needs an address or VAULT_ADDR")
+	}
+	config.Address = strings.TrimSuffix(config.Address, "/")
+	if config.Namespace == "" {
+		config.Namespace = os.Getenv("VAULT_NAMESPACE")
+	}
+	if (config.RoleID == "") != (config.SecretID == "") {
+		return nil, fmt.Errorf("AppRole login needs both a role_id and a secret_id")
+	}
+	if config.RoleID == "" && config.Token == "" {
+		config.Token = os.Getenv("VAULT_TOKEN")
+	}
+	if config.RoleID == "" && config.Token == "" {
+		return nil, fmt.Errorf("the Vault provider needs a token, VAULT_TOKEN, or an AppRole role_id and secret_id")
+	}
+	if config.AppRoleMount == "" {
+		config.AppRoleMount = "approle"
+	}
+	switch config.KVVersion {
+	case 0:
+		config.KVVersion = 2
+	case 1, 2:
+	default:
+		return nil, fmt.Errorf("invalid KV version %d, must be 1 or 2", config.KVVersion)
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: vaultTimeout}
+	}
+	return &VaultProvider{config: config, now: time.Now}, nil
+}
+
+// Type returns the provider type
+func (v *VaultProvider) Type() string {
+	return "vault"
+}
+
+// GetSecret reads a field of a secret from Vault
+func (v *VaultProvider) GetSecret(ctx context.Context, path string) (*Secret, error) {
+	name, field := splitVaultField(path)
+	data, secret, err := v.read(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if data == nil {
+		return nil, fmt.Errorf("secret %s not found in Vault", name)
+	}
+	if field == "" {
+		field, err = defaultVaultField(name, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	value, ok := data[field]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no field %s", name, field)
+	}
+	secret.Path = path
+	if secret.Value, err = vaultString(value); err != nil {
+		return nil, fmt.Errorf("field %s of secret %s: %w", field, name, err)
+	}
+	return secret, nil
+}
+
+// SetSecret writes a field of a secret to Vault, keeping its other fields
+func (v *VaultProvider) SetSecret(ctx context.Context, path, value string) error {
+	name, field := splitVaultField(path)
+	if field == "" {
+		field = vaultField
+	}
+	data, secret, err := v.read(ctx, name)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		data = make(map[string]interface{})
+	}
+	data[field] = value
+	return v.write(ctx, name, data, secret)
+}
+
+// DeleteSecret deletes a secret from Vault, or only one of its fields. On
+// KV version 2 mounts the latest version is deleted, and can be undeleted.
+func (v *VaultProvider) DeleteSecret(ctx context.Context, path string) error {
+	name, field := splitVaultField(path)
+	if field != "" {
+		data, secret, err := v.read(ctx, name)
+		if err != nil {
+			return err
+		}
+		if _, ok := data[field]; !ok {
+			return fmt.Errorf("secret %s has no field %s", name, field)
+		}
+		delete(data, field)
+		if len(data) > 0 {
+			return v.write(ctx, name, data, secret)
+		}
+	}
+
+	mount, err := v.mount(ctx, name)
+	if err != nil {
+		return err
+	}
+	if err := v.do(ctx, http.MethodDelete, mount.dataPath(name), nil, nil, nil); err != nil {
+		return fmt.Errorf("failed to delete secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// ListSecrets lists the secrets under a prefix; names ending in / hold
+// further secrets
+func (v *VaultProvider) ListSecrets(ctx context.Context, prefix string) ([]string, error) {
+	mount, err := v.mount(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	var response struct {
+		Data struct {
+			Keys []string `json:"keys"`
+		} `json:"data"`
+	}
+	base := prefix
+	if base != "" && !strings.HasSuffix(base, "/") {
+		base += "/"
+	}
+	query := url.Values{"list": {"true"}}
+	if err := v.do(ctx, http.MethodGet, mount.metadataPath(base), query, nil, &response); err != nil {
+		if errors.Is(err, errVaultNotFound) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("failed to list secrets under %s: %w", prefix, err)
+	}
+	paths := make([]string, len(response.Data.Keys))
+	for i, key := range response.Data.Keys {
+		paths[i] = base + key
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// read returns the fields of a secret, nil when it does not exist, and the
+// secret with the metadata Vault keeps about it
+func (v *VaultProvider) read(ctx context.Context, name string) (map[string]interface{}, *Secret, error) {
+	mount, err := v.mount(ctx, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	var response struct {
+		LeaseID       string                 `json:"lease_id"`
+		LeaseDuration int                    `json:"lease_duration"`
+		Renewable     bool                   `json:"renewable"`
+		Data          map[string]interface{} `json:"data"`
+	}
+	secret := &Secret{Path: name, Metadata: map[string]string{"mount": mount.path}}
+	if err := v.do(ctx, http.MethodGet, mount.dataPath(name), nil, nil, &response); err != nil {
+		if errors.Is(err, errVaultNotFound) && mount.version == 2 {
+			// The latest version may be deleted; writes must name it
+			err = v.currentVersion(ctx, mount, name, secret)
+		}
+		if errors.Is(err, errVaultNotFound) {
+			return nil, secret, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read secret %s: %w", name, err)
+		}
+		return nil, secret, nil
+	}
+	if response.LeaseID != "" {
+		secret.Metadata["lease_id"] = response.LeaseID
+		secret.Metadata["lease_duration"] = strconv.Itoa(response.LeaseDuration)
+		secret.Metadata["renewable"] = strconv.FormatBool(response.Renewable)
+	}
+	if mount.version != 2 {
+		return response.Data, secret, nil
+	}
+
+	// KV version 2 wraps the fields with the version's metadata; a deleted
+	// or destroyed latest version comes back without fields
+	var versioned struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			CreatedTime  string `json:"created_time"`
+			DeletionTime string `json:"deletion_time"`
+			Version      int    `json:"version"`
+		} `json:"metadata"`
+	}
+	encoded, _ := json.Marshal(response.Data)
+	if err := json.Unmarshal(encoded, &versioned); err != nil {
+		return nil, nil, fmt.Errorf("failed to parse secret %s: %w", name, err)
+	}
+	secret.Metadata["version"] = strconv.Itoa(versioned.Metadata.Version)
+	secret.UpdatedAt = versioned.Metadata.CreatedTime
+	if versioned.Data == nil || versioned.Metadata.DeletionTime != "" {
+		return nil, secret, nil
+	}
+	return versioned.Data, secret, nil
+}
+
+// currentVersion records the latest version of a secret on a KV version 2
+// mount, deleted or not
+func (v *VaultProvider) currentVersion(ctx context.Context, mount vaultMount, name string, secret *Secret) error {
+	var response struct {
+		Data struct {
+			CurrentVersion int    `json:"current_version"`
+			CreatedTime    string `json:"created_time"`
+			UpdatedTime    string `json:"updated_time"`
+		} `json:"data"`
+	}
+	if err := v.do(ctx, http.MethodGet, mount.metadataPath(name), nil, nil, &response); err != nil {
+		return err
+	}
+	secret.Metadata["version"] = strconv.Itoa(response.Data.CurrentVersion)
+	secret.CreatedAt = response.Data.CreatedTime
+	secret.UpdatedAt = response.Data.UpdatedTime
+	return nil
+}
+
+// write replaces the fields of a secret read before. On KV version 2 mounts
+// the write only goes through if nobody wrote a version in between.
+func (v *VaultProvider) write(ctx context.Context, name string, data map[string]interface{}, read *Secret) error {
+	mount, err := v.mount(ctx, name)
+	if err != nil {
+		return err
+	}
+	var body interface{} = data
+	if mount.version == 2 {
+		version, _ := strconv.Atoi(read.Metadata["version"])
+		body = map[string]interface{}{
+			"data":    data,
+			"options": map[string]interface{}{"cas": version},
+		}
+	}
+	if err := v.do(ctx, http.MethodPost, mount.dataPath(name), nil, body, nil); err != nil {
+		return fmt.Errorf("failed to write secret %s: %w", name, err)
+	}
+	return nil
+}
+
+// mount returns the mount a path is under, asking Vault the first time a
+// mount is used
+func (v *VaultProvider) mount(ctx context.Context, path string) (vaultMount, error) {
+	path = strings.TrimPrefix(path, "/")
+	v.mu.Lock()
+	for _, mount := range v.mounts {
+		if strings.HasPrefix(path, mount.path) || path+"/" == mount.path {
+			v.mu.Unlock()
+			return mount, nil
+		}
+	}
+	v.mu.Unlock()
+
+	var response struct {
+		Data struct {
+			Path    string            `json:"path"`
+			Type    string            `json:"type"`
+			Options map[string]string `json:"options"`
+		} `json:"data"`
+	}
+	var mount vaultMount
+	err := v.do(ctx, http.MethodGet, "sys/internal/ui/mounts/"+path, nil, nil, &response)
+	switch {
+	case err == nil && response.Data.Path != "":
+		mount.path = response.Data.Path
+		if response.Data.Type == "kv" || response.Data.Type == "generic" {
+			mount.version = 1
+			if response.Data.Options["version"] == "2" {
+				mount.version = 2
+			}
+		}
+	case err == nil || errors.Is(err, errVaultNotFound) || errors.Is(err, errVaultForbidden):
+		// Older servers and tokens without access to the path cannot look
+		// the mount up, so assume the configured KV version
+		first, _, _ := strings.Cut(path, "/")
+		if first == "" {
+			return vaultMount{}, fmt.Errorf("empty Vault path")
+		}
+		mount = vaultMount{path: first + "/", version: v.config.KVVersion}
+	default:
+		return vaultMount{}, fmt.Errorf("failed to look up the Vault mount of %s: %w", path, err)
+	}
+
+	v.mu.Lock()
+	v.mounts = append(v.mounts, mount)
+	v.mu.Unlock()
+	return mount, nil
+}
+
+// dataPath returns the API path a secret is read and written at
+func (m vaultMount) dataPath(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if m.version != 2 {
+		return name
+	}
+	return m.path + "data/" + strings.TrimPrefix(name, m.path)
+}
+
+// metadataPath returns the API path the metadata of a secret is read at,
+// and the secrets under a prefix are listed at
+func (m vaultMount) metadataPath(prefix string) string {
+	prefix = strings.TrimPrefix(prefix, "/")
+	if m.version != 2 {
+		return prefix
+	}
+	return m.path + "metadata/" + strings.TrimPrefix(prefix, m.path)
+}
+
+// authenticate returns a token to make requests with, logging in or
+// renewing the token once a third of its lease is left
+func (v *VaultProvider) authenticate(ctx context.Context) (string, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.token == "" {
+		if v.config.RoleID != "" {
+			if err := v.login(ctx); err != nil {
+				return "", err
+			}
+			return v.token, nil
+		}
+		v.token = v.config.Token
+		v.lookupSelf(ctx)
+		return v.token, nil
+	}
+	if v.expires.IsZero() || v.now().Add(v.ttl/3).Before(v.expires) {
+		return v.token, nil
+	}
+
+	err := errors.New("the token is not renewable")
+	if v.renewable {
+		if err = v.renew(ctx); err == nil {
+			return v.token, nil
+		}
+	}
+	if v.config.RoleID != "" {
+		if err := v.login(ctx); err != nil {
+			return "", err
+		}
+		return v.token, nil
+	}
+	if v.now().Before(v.expires) {
+		// Keep using the token until it expires
+		return v.token, nil
+	}
+	return "", fmt.Errorf("the Vault token expired: %w", err)
+}
+
+// vaultAuth is the auth section of a login or renewal response
+type vaultAuth struct {
+	ClientToken   string `json:"client_token"`
+	LeaseDuration int    `json:"lease_duration"`
+	Renewable     bool   `json:"renewable"`
+}
+
+// login logs in with AppRole
+func (v *VaultProvider) login(ctx context.Context) error {
+	var response struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	body := map[string]string{"role_id": v.config.RoleID, "secret_id": v.config.SecretID}
+	if err := v.request(ctx, "", http.MethodPost, "auth/"+v.config.AppRoleMount+"/login", nil, body, &response); err != nil {
+		v.token = ""
+		return fmt.Errorf("failed to log in to Vault with AppRole: %w", err)
+	}
+	if response.Auth.ClientToken == "" {
+		v.token = ""
+		return fmt.Errorf("failed to log in to Vault with AppRole: no token in the response")
+	}
+	v.token = response.Auth.ClientToken
+	v.lease(response.Auth.LeaseDuration, response.Auth.Renewable)
+	return nil
+}
+
+// renew extends the lease of the token
+func (v *VaultProvider) renew(ctx context.Context) error {
+	var response struct {
+		Auth vaultAuth `json:"auth"`
+	}
+	if err := v.request(ctx, v.token, http.MethodPost, "auth/token/renew-self", nil, map[string]string{}, &response); err != nil {
+		return fmt.Errorf("failed to renew the Vault token: %w", err)
+	}
+	v.lease(response.Auth.LeaseDuration, response.Auth.Renewable)
+	return nil
+}
+
+// lookupSelf learns the lease of a configured token so it can be renewed.
+// Tokens that cannot look themselves up are used without renewal.
+func (v *VaultProvider) lookupSelf(ctx context.Context) {
+	var response struct {
+		Data struct {
+			TTL       int  `json:"ttl"`
+			Renewable bool `json:"renewable"`
+		} `json:"data"`
+	}
+	if err := v.request(ctx, v.token, http.MethodGet, "auth/token/lookup-self", nil, nil, &response); err == nil {
+		v.lease(response.Data.TTL, response.Data.Renewable)
+	}
+}
+
+// lease records how long the token is valid for; root tokens never expire
+func (v *VaultProvider) lease(seconds int, renewable bool) {
+	v.ttl = time.Duration(seconds) * time.Second
+	v.renewable = renewable
+	v.expires = time.Time{}
+	if seconds > 0 {
+		v.expires = v.now().Add(v.ttl)
+	}
+}
+
+// errVaultNotFound and errVaultForbidden are returned for 404 and 403
+// responses
+var (
+	errVaultNotFound  = errors.New("not found")
+	errVaultForbidden = errors.New("permission denied")
+)
+
+// do makes an authenticated request to the Vault API
+func (v *VaultProvider) do(ctx context.Context, method, path string, query url.Values, in, out interface{}) error {
+	token, err := v.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+	return v.request(ctx, token, method, path, query, in, out)
+}
+
+// request makes a request to the Vault API with a token, decoding the
+// response into out
+func (v *VaultProvider) request(ctx context.Context, token, method, path string, query url.Values, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	target := v.config.Address + "/v1/" + strings.TrimPrefix(path, "/")
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, method, target, body)
+	if err != nil {
+		return err
+	}
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("X-Vault-Token", token)
+	}
+	if v.config.Namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.config.Namespace)
+	}
+
+	resp, err := v.config.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		return vaultError(resp.StatusCode, data)
+	}
+	if out == nil || len(data) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(data, out); err != nil {
+		return fmt.Errorf("invalid response from Vault: %w", err)
+	}
+	return nil
+}
+
+// vaultError returns the error of a failed response
+func vaultError(status int, data []byte) error {
+	var response struct {
+		Errors []string `json:"errors"`
+	}
+	json.Unmarshal(data, &response)
+	message := strings.Join(response.Errors, "; ")
+	switch status {
+	case http.StatusNotFound:
+		return errVaultNotFound
+	case http.StatusForbidden:
+		if message == "" || message == errVaultForbidden.Error() {
+			return errVaultForbidden
+		}
+		return fmt.Errorf("%w: %s", errVaultForbidden, message)
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(data))
+	}
+	return fmt.Errorf("vault returned %d: %s", status, message)
+}
+
+// splitVaultField splits a path into the secret and the field it names
+// after #
+func splitVaultField(path string) (string, string) {
+	name, field, _ := strings.Cut(path, "#")
+	return strings.TrimPrefix(name, "/"), field
+}
+
+// defaultVaultField returns the field read when a path names none: the
+// value field, or the only field of the secret
+func defaultVaultField(name string, data map[string]interface{}) (string, error) {
+	if _, ok := data[vaultField]; ok || len(data) == 0 {
+		return vaultField, nil
+	}
+	fields := make([]string, 0, len(data))
+	for field := range data {
+		fields = append(fields, field)
+	}
+	if len(fields) == 1 {
+		return fields[0], nil
+	}
+	sort.Strings(fields)
+	return "", fmt.Errorf("secret %s has fields %s; name one as %s#<field>", name, strings.Join(fields, ", "), name)
+}
+
+// vaultString returns a field's value as a string; values other than
+// strings are returned as JSON
+func vaultString(value interface{}) (string, error) {
+	if s, ok := value.(string); ok {
+		return s, nil
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,467 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeVault serves the Vault API calls the provider makes from memory, with
+// a KV version 2 engine at secret/ and a version 1 engine at kv/
+type fakeVault struct {
+	mu sync.Mutex
+	// tokens maps valid tokens to whether they can be renewed
+	tokens     map[string]bool
+	ttl        int
+	namespace  string
+	mountsDeny bool
+	v1         map[string]map[string]interface{}
+	v2         map[string][]map[string]interface{}
+	deleted    map[string]bool
+	logins     int
+	renewals   int
+}
+
+func newFakeVault() *fakeVault {
+	return &fakeVault{
+		tokens:  map[string]bool{"root": false},
+		v1:      make(map[string]map[string]interface{}),
+		v2:      make(map[string][]map[string]interface{}),
+		deleted: make(map[string]bool),
+	}
+}
+
+func (f *fakeVault) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	reply := func(status int, body interface{}) {
+		w.WriteHeader(status)
+		json.NewEncoder(w).Encode(body)
+	}
+	fail := func(status int, message string) {
+		reply(status, map[string][]string{"errors": {message}})
+	}
+	if r.Header.Get("X-Vault-Namespace") != f.namespace {
+		fail(http.StatusForbidden, "wrong namespace")
+		return
+	}
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+	path := strings.TrimPrefix(r.URL.Path, "/v1/")
+
+	if path == "auth/approle/login" {
+		if body["role_id"] != "web" || body["secret_id"] != "s3cret" {
+			fail(http.StatusBadRequest, "invalid role or secret ID")
+			return
+		}
+		f.logins++
+		token := "approle-" + string(rune('0'+f.logins))
+		f.tokens[token] = true
+		reply(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": token, "lease_duration": f.ttl, "renewable": true,
+		}})
+		return
+	}
+	token := r.Header.Get("X-Vault-Token")
+	renewable, ok := f.tokens[token]
+	if !ok {
+		fail(http.StatusForbidden, "permission denied")
+		return
+	}
+
+	switch {
+	case path == "auth/token/lookup-self":
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"ttl": f.ttl, "renewable": renewable}})
+	case path == "auth/token/renew-self":
+		if !renewable {
+			fail(http.StatusBadRequest, "lease is not renewable")
+			return
+		}
+		f.renewals++
+		reply(http.StatusOK, map[string]interface{}{"auth": map[string]interface{}{
+			"client_token": token, "lease_duration": f.ttl, "renewable": true,
+		}})
+	case strings.HasPrefix(path, "sys/internal/ui/mounts/"):
+		if f.mountsDeny {
+			fail(http.StatusForbidden, "permission denied")
+			return
+		}
+		mount := strings.TrimPrefix(path, "sys/internal/ui/mounts/")
+		switch {
+		case strings.HasPrefix(mount, "secret/"):
+			reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"path": "secret/", "type": "kv", "options": map[string]string{"version": "2"},
+			}})
+		case strings.HasPrefix(mount, "kv/"):
+			reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+				"path": "kv/", "type": "kv", "options": map[string]string{},
+			}})
+		default:
+			fail(http.StatusBadRequest, "no mount")
+		}
+	case strings.HasPrefix(path, "secret/data/"):
+		f.serveV2(w, r, strings.TrimPrefix(path, "secret/data/"), body, reply, fail)
+	case strings.HasPrefix(path, "secret/metadata/"):
+		name := strings.TrimPrefix(path, "secret/metadata/")
+		if r.URL.Query().Get("list") == "true" {
+			var names []string
+			for key := range f.v2 {
+				if !f.deleted[key] {
+					names = append(names, key)
+				}
+			}
+			keys := listKeys(name, names)
+			if len(keys) == 0 {
+				fail(http.StatusNotFound, "")
+				return
+			}
+			reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+			return
+		}
+		versions, ok := f.v2[name]
+		if !ok {
+			fail(http.StatusNotFound, "")
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"current_version": len(versions)}})
+	case strings.HasPrefix(path, "kv/"):
+		name := strings.TrimPrefix(path, "kv/")
+		switch {
+		case r.URL.Query().Get("list") == "true":
+			var names []string
+			for key := range f.v1 {
+				names = append(names, key)
+			}
+			keys := listKeys(name, names)
+			if len(keys) == 0 {
+				fail(http.StatusNotFound, "")
+				return
+			}
+			reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"keys": keys}})
+		case r.Method == http.MethodGet:
+			data, ok := f.v1[name]
+			if !ok {
+				fail(http.StatusNotFound, "")
+				return
+			}
+			reply(http.StatusOK, map[string]interface{}{"data": data})
+		case r.Method == http.MethodPost:
+			f.v1[name] = body
+			w.WriteHeader(http.StatusNoContent)
+		case r.Method == http.MethodDelete:
+			delete(f.v1, name)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	default:
+		fail(http.StatusNotFound, "")
+	}
+}
+
+// serveV2 serves reads, writes and deletes of a KV version 2 secret
+func (f *fakeVault) serveV2(w http.ResponseWriter, r *http.Request, name string, body map[string]interface{},
+	reply func(int, interface{}), fail func(int, string)) {
+	versions := f.v2[name]
+	switch r.Method {
+	case http.MethodGet:
+		if len(versions) == 0 || f.deleted[name] {
+			fail(http.StatusNotFound, "")
+			return
+		}
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{
+			"data":     versions[len(versions)-1],
+			"metadata": map[string]interface{}{"version": len(versions), "created_time": "2024-06-01T12:00:00Z"},
+		}})
+	case http.MethodPost:
+		options, _ := body["options"].(map[string]interface{})
+		if cas, ok := options["cas"].(float64); ok && int(cas) != len(versions) {
+			fail(http.StatusBadRequest, "check-and-set parameter did not match the current version")
+			return
+		}
+		data, _ := body["data"].(map[string]interface{})
+		f.v2[name] = append(versions, data)
+		f.deleted[name] = false
+		reply(http.StatusOK, map[string]interface{}{"data": map[string]interface{}{"version": len(versions) + 1}})
+	case http.MethodDelete:
+		f.deleted[name] = true
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// listKeys returns the keys directly under a prefix the way Vault lists
+// them, with folders ending in /
+func listKeys(prefix string, names []string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, name := range names {
+		rest, ok := strings.CutPrefix(name, prefix)
+		if !ok {
+			continue
+		}
+		if folder, _, nested := strings.Cut(rest, "/"); nested {
+			rest = folder + "/"
+		}
+		if !seen[rest] {
+			seen[rest] = true
+			keys = append(keys, rest)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func TestNewVaultProvider(t *testing.T) {
+	for _, env := range []string{"VAULT_ADDR", "VAULT_TOKEN", "VAULT_NAMESPACE"} {
+		t.Setenv(env, "")
+	}
+	tests := []struct {
+		name    string
+		config  VaultConfig
+		wantErr string
+	}{
+		{"token", VaultConfig{Address: "http://vault:8200", Token: "root"}, ""},
+		{"approle", VaultConfig{Address: "http://vault:8200", RoleID: "web", SecretID: "s3cret"}, ""},
+		{"kv version 1", VaultConfig{Address: "http://vault:8200", Token: "root", KVVersion: 1}, ""},
+		{"no address", VaultConfig{Token: "root"}, "needs an address"},
+		{"no credentials", VaultConfig{Address: "http://vault:8200"}, "needs a token"},
+		{"role without secret", VaultConfig{Address: "http://vault:8200", RoleID: "web"}, "both a role_id and a secret_id"},
+		{"unknown kv version", VaultConfig{Address: "http://vault:8200", Token: "root", KVVersion: 3}, "invalid KV version"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewVaultProvider(tt.config)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("NewVaultProvider: %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("NewVaultProvider error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	t.Setenv("VAULT_ADDR", "http://env-vault:8200/")
+	t.Setenv("VAULT_TOKEN", "from-env")
+	provider, err := NewVaultProvider(VaultConfig{})
+	if err != nil {
+		t.Fatalf("NewVaultProvider from the environment: %v", err)
+	}
+	if provider.config.Address != "http://env-vault:8200" || provider.config.Token != "from-env" {
+		t.Errorf("config from the environment = %+v", provider.config)
+	}
+}
+
+func TestVaultProvider_Secrets(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		mount      string
+		mountsDeny bool
+		kvVersion  int
+	}{
+		{"kv version 2", "secret", false, 0},
+		{"kv version 1", "kv", false, 0},
+		{"kv version 2 without mount lookup", "secret", true, 2},
+		{"kv version 1 without mount lookup", "kv", true, 1},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := newFakeVault()
+			fake.mountsDeny = tt.mountsDeny
+			fake.namespace = "team-a"
+			server := httptest.NewServer(fake)
+			defer server.Close()
+			provider, err := NewVaultProvider(VaultConfig{Address: server.URL, Token: "root", Namespace: "team-a", KVVersion: tt.kvVersion})
+			if err != nil {
+				t.Fatalf("NewVaultProvider: %v", err)
+			}
+			manager := NewSecretsManager()
+			manager.RegisterProvider(provider)
+			ctx := context.Background()
+			db := "vault://" + tt.mount + "/app/db"
+
+			if _, err := manager.GetSecret(ctx, db); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("GetSecret of a missing secret = %v, want not found", err)
+			}
+			if err := manager.SetSecret(ctx, db+"#password", "hunter2"); err != nil {
+				t.Fatalf("SetSecret: %v", err)
+			}
+			secret, err := manager.GetSecret(ctx, db)
+			if err != nil || secret.Value != "hunter2" {
+				t.Fatalf("GetSecret of the only field = %+v, %v", secret, err)
+			}
+			if err := manager.SetSecret(ctx, db+"#user", "app"); err != nil {
+				t.Fatalf("SetSecret of a second field: %v", err)
+			}
+			if _, err := manager.GetSecret(ctx, db); err == nil || !strings.Contains(err.Error(), "has fields password, user") {
+				t.Errorf("GetSecret without a field = %v, want the fields listed", err)
+			}
+			for field, want := range map[string]string{"password": "hunter2", "user": "app"} {
+				secret, err := manager.GetSecret(ctx, db+"#"+field)
+				if err != nil || secret.Value != want {
+					t.Errorf("GetSecret #%s = %+v, %v, want %s", field, secret, err, want)
+				}
+			}
+			if _, err := manager.GetSecret(ctx, db+"#port"); err == nil || !strings.Contains(err.Error(), "no field port") {
+				t.Errorf("GetSecret of a missing field = %v", err)
+			}
+			if tt.mount == "secret" {
+				if secret, _ := manager.GetSecret(ctx, db+"#user"); secret.Metadata["version"] != "2" {
+					t.Errorf("version = %q, want 2", secret.Metadata["version"])
+				}
+			}
+
+			if err := manager.SetSecret(ctx, "vault://"+tt.mount+"/app/api", "abc123"); err != nil {
+				t.Fatalf("SetSecret without a field: %v", err)
+			}
+			if secret, err := manager.GetSecret(ctx, "vault://"+tt.mount+"/app/api"); err != nil || secret.Value != "abc123" {
+				t.Errorf("GetSecret of the value field = %+v, %v", secret, err)
+			}
+			manager.SetSecret(ctx, "vault://"+tt.mount+"/app/certs/web", "pem")
+			list, err := manager.ListSecrets(ctx, "vault://"+tt.mount+"/app")
+			want := []string{tt.mount + "/app/api", tt.mount + "/app/certs/", tt.mount + "/app/db"}
+			if err != nil || !reflect.DeepEqual(list, want) {
+				t.Errorf("ListSecrets = %v, %v, want %v", list, err, want)
+			}
+			if list, err := manager.ListSecrets(ctx, "vault://"+tt.mount+"/other/"); err != nil || len(list) != 0 {
+				t.Errorf("ListSecrets of an empty prefix = %v, %v", list, err)
+			}
+
+			if err := manager.DeleteSecret(ctx, db+"#user"); err != nil {
+				t.Fatalf("DeleteSecret of a field: %v", err)
+			}
+			if secret, err := manager.GetSecret(ctx, db); err != nil || secret.Value != "hunter2" {
+				t.Errorf("GetSecret after deleting a field = %+v, %v", secret, err)
+			}
+			if err := manager.DeleteSecret(ctx, db); err != nil {
+				t.Fatalf("DeleteSecret: %v", err)
+			}
+			if _, err := manager.GetSecret(ctx, db); err == nil || !strings.Contains(err.Error(), "not found") {
+				t.Errorf("GetSecret after DeleteSecret = %v, want not found", err)
+			}
+			// A deleted secret can be written again
+			if err := manager.SetSecret(ctx, db+"#password", "correct-horse"); err != nil {
+				t.Fatalf("SetSecret after DeleteSecret: %v", err)
+			}
+			if secret, err := manager.GetSecret(ctx, db); err != nil || secret.Value != "correct-horse" {
+				t.Errorf("GetSecret after writing again = %+v, %v", secret, err)
+			}
+		})
+	}
+}
+
+func TestVaultProvider_Auth(t *testing.T) {
+	fake := newFakeVault()
+	fake.ttl = 60
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	ctx := context.Background()
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	provider, err := NewVaultProvider(VaultConfig{Address: server.URL, RoleID: "web", SecretID: "s3cret"})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	provider.now = func() time.Time { return now }
+	if err := provider.SetSecret(ctx, "secret/app/db", "hunter2"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if fake.logins != 1 || fake.renewals != 0 {
+		t.Fatalf("logins, renewals = %d, %d, want 1, 0", fake.logins, fake.renewals)
+	}
+
+	// The token is renewed once a third of its lease is left
+	now = now.Add(30 * time.Second)
+	provider.GetSecret(ctx, "secret/app/db")
+	if fake.renewals != 0 {
+		t.Errorf("renewed with half the lease left")
+	}
+	now = now.Add(15 * time.Second)
+	if _, err := provider.GetSecret(ctx, "secret/app/db"); err != nil {
+		t.Fatalf("GetSecret: %v", err)
+	}
+	if fake.renewals != 1 || fake.logins != 1 {
+		t.Errorf("logins, renewals = %d, %d, want 1, 1", fake.logins, fake.renewals)
+	}
+
+	// Once the token can no longer be renewed, AppRole logs in again
+	fake.mu.Lock()
+	fake.tokens[provider.token] = false
+	fake.mu.Unlock()
+	now = now.Add(45 * time.Second)
+	if _, err := provider.GetSecret(ctx, "secret/app/db"); err != nil {
+		t.Fatalf("GetSecret after the token expired: %v", err)
+	}
+	if fake.logins != 2 || provider.token != "approle-2" {
+		t.Errorf("logins = %d, token = %s, want a second login", fake.logins, provider.token)
+	}
+
+	wrong, _ := NewVaultProvider(VaultConfig{Address: server.URL, RoleID: "web", SecretID: "wrong"})
+	if _, err := wrong.GetSecret(ctx, "secret/app/db"); err == nil || !strings.Contains(err.Error(), "invalid role or secret ID") {
+		t.Errorf("GetSecret with a wrong secret ID = %v", err)
+	}
+
+	// A configured token is renewed while it can be, then used until it
+	// expires
+	fake.tokens["periodic"] = true
+	tokenProvider, _ := NewVaultProvider(VaultConfig{Address: server.URL, Token: "periodic"})
+	tokenProvider.now = func() time.Time { return now }
+	if _, err := tokenProvider.GetSecret(ctx, "secret/app/db"); err != nil {
+		t.Fatalf("GetSecret with a token: %v", err)
+	}
+	now = now.Add(50 * time.Second)
+	tokenProvider.GetSecret(ctx, "secret/app/db")
+	if fake.renewals != 2 {
+		t.Errorf("renewals = %d, want the token renewed", fake.renewals)
+	}
+	fake.mu.Lock()
+	fake.tokens["periodic"] = false
+	fake.mu.Unlock()
+	now = now.Add(50 * time.Second)
+	if _, err := tokenProvider.GetSecret(ctx, "secret/app/db"); err != nil {
+		t.Errorf("GetSecret before the token expires: %v", err)
+	}
+	now = now.Add(20 * time.Second)
+	if _, err := tokenProvider.GetSecret(ctx, "secret/app/db"); err == nil || !strings.Contains(err.Error(), "token expired") {
+		t.Errorf("GetSecret after the token expired = %v", err)
+	}
+}
+
+func TestVaultProvider_DevServer(t *testing.T) {
+	address := os.Getenv("FORGE_TEST_VAULT_ADDR")
+	if address == "" {
+		t.Skip("FORGE_TEST_VAULT_ADDR is not set; run vault server -dev and set it with FORGE_TEST_VAULT_TOKEN")
+	}
+	provider, err := NewVaultProvider(VaultConfig{Address: address, Token: os.Getenv("FORGE_TEST_VAULT_TOKEN")})
+	if err != nil {
+		t.Fatalf("NewVaultProvider: %v", err)
+	}
+	ctx := context.Background()
+	path := "secret/forge-test/" + time.Now().Format("20060102T150405.000000000")
+	defer provider.DeleteSecret(ctx, path)
+
+	if err := provider.SetSecret(ctx, path+"#password", "hunter2"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	if err := provider.SetSecret(ctx, path+"#user", "app"); err != nil {
+		t.Fatalf("SetSecret: %v", err)
+	}
+	secret, err := provider.GetSecret(ctx, path+"#password")
+	if err != nil || secret.Value != "hunter2" || secret.Metadata["version"] != "2" {
+		t.Fatalf("GetSecret = %+v, %v", secret, err)
+	}
+	list, err := provider.ListSecrets(ctx, "secret/forge-test")
+	if err != nil || len(list) == 0 {
+		t.Errorf("ListSecrets = %v, %v", list, err)
+	}
+	if err := provider.DeleteSecret(ctx, path); err != nil {
+		t.Fatalf("DeleteSecret: %v", err)
+	}
+	if _, err := provider.GetSecret(ctx, path); err == nil {
+		t.Errorf("GetSecret after DeleteSecret succeeded")
+	}
+}
@@ -0,0 +1,397 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/notifications"
+)
+
+// Alert states
+const (
+	// AlertOpen is an alert nobody has acknowledged yet
+	AlertOpen = "open"
+	// AlertAcknowledged is an alert someone is looking into
+	AlertAcknowledged = "acknowledged"
+	// AlertResolved is an alert whose condition cleared or was resolved by hand
+	AlertResolved = "resolved"
+	// AlertUnresolved selects open and acknowledged alerts when listing
+	AlertUnresolved = "unresolved"
+)
+
+// alertRetention is how long resolved alerts are kept
+const alertRetention = 30 * 24 * time.Hour
+
+// alertSendTimeout bounds sending a new alert through the notification
+// channels
+const alertSendTimeout = time.Minute
+
+// Alert is a problem the server noticed that stays open until the
+// condition behind it clears, such as drift a later run remediated, or
+// someone resolves it. Unlike notices, alerts are kept in the store so they
+// can be handed over between on-call shifts.
+type Alert struct {
+	ID string `json:"id"`
+	// Condition names what is wrong, such as drift/web/web1. A condition has
+	// at most one unresolved alert, which is seen again instead of a new one
+	// being opened.
+	Condition string `json:"condition"`
+	Level     string `json:"level"`
+	// Module is the name in the module's metadata, empty for alerts about
+	// nodes
+	Module   string    `json:"module,omitempty"`
+	Message  string    `json:"message"`
+	OpenedAt time.Time `json:"opened_at"`
+	LastSeen time.Time `json:"last_seen"`
+	// Occurrences counts how often the condition was seen while unresolved
+	Occurrences    int        `json:"occurrences"`
+	AcknowledgedBy string     `json:"acknowledged_by,omitempty"`
+	AcknowledgedAt *time.Time `json:"acknowledged_at,omitempty"`
+	// ResolvedBy is empty when the condition cleared by itself
+	ResolvedBy string     `json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time `json:"resolved_at,omitempty"`
+	Resolution string     `json:"resolution,omitempty"`
+	Notes      []Note     `json:"notes,omitempty"`
+}
+
+// Note is a comment left on an alert when acknowledging or resolving it
+type Note struct {
+	Time time.Time `json:"time"`
+	By   string    `json:"by"`
+	Text string    `json:"text"`
+}
+
+// State returns whether the alert is open, acknowledged or resolved
+func (a *Alert) State() string {
+	switch {
+	case a.ResolvedAt != nil:
+		return AlertResolved
+	case a.AcknowledgedAt != nil:
+		return AlertAcknowledged
+	default:
+		return AlertOpen
+	}
+}
+
+// AlertAction acknowledges or resolves an alert
+type AlertAction struct {
+	// By names who took the action, such as alice@laptop
+	By   string `json:"by"`
+	Note string `json:"note,omitempty"`
+}
+
+// alertMatches reports whether an alert is in a state, one of the alert
+// states or unresolved, and about a module; empty values match any
+func alertMatches(alert *Alert, state, module string) bool {
+	if module != "" && alert.Module != "" && alert.Module != module {
+		return false
+	}
+	switch state {
+	case "":
+		return true
+	case AlertUnresolved:
+		return alert.ResolvedAt == nil
+	default:
+		return alert.State() == state
+	}
+}
+
+// validateAlertState checks a state alerts are listed by
+func validateAlertState(state string) error {
+	switch state {
+	case "", AlertOpen, AlertAcknowledged, AlertResolved, AlertUnresolved:
+		return nil
+	default:
+		return &requestError{fmt.Errorf("unknown alert state %q, must be one of: open, acknowledged, resolved, unresolved", state)}
+	}
+}
+
+// raise opens an alert for a condition, or counts it as seen again while
+// its alert is unresolved. Failing to record an alert is only logged.
+func (s *Server) raise(condition, level, module, message string) {
+	s.alertsMu.Lock()
+	defer s.alertsMu.Unlock()
+	now := s.now()
+	alert, err := s.unresolved(condition)
+	if err != nil {
+		s.logger.Printf("alert %s: %v", condition, err)
+		return
+	}
+	if alert == nil {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		alert = &Alert{
+			ID:        now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix),
+			Condition: condition,
+			OpenedAt:  now,
+		}
+		s.pruneAlerts(now)
+	}
+	alert.Level = level
+	alert.Module = module
+	alert.Message = message
+	alert.LastSeen = now
+	alert.Occurrences++
+	if err := s.store.SaveAlert(alert); err != nil {
+		s.logger.Printf("alert %s: %v", condition, err)
+		return
+	}
+	if alert.Occurrences == 1 && s.config.Notifications != nil {
+		go s.sendAlert(*alert)
+	}
+}
+
+// sendAlert sends a newly opened alert through the notification channels,
+// whose metrics count the deliveries. A failed delivery is only logged.
+func (s *Server) sendAlert(alert Alert) {
+	ctx, cancel := context.WithTimeout(context.Background(), alertSendTimeout)
+	defer cancel()
+	notification := notifications.NewNotification("Alert: "+alert.Condition, alert.Message, notifications.NotificationLevel(alert.Level))
+	notification.AddData("alert_id", alert.ID)
+	notification.AddData("condition", alert.Condition)
+	if alert.Module != "" {
+		notification.AddData("module", alert.Module)
+	}
+	if err := s.config.Notifications.Send(ctx, notification); err != nil {
+		s.logger.Printf("alert %s: %v", alert.Condition, err)
+	}
+}
+
+// clear resolves the unresolved alert of a condition that no longer holds
+func (s *Server) clear(condition, resolution string) {
+	s.alertsMu.Lock()
+	defer s.alertsMu.Unlock()
+	alert, err := s.unresolved(condition)
+	if err != nil {
+		s.logger.Printf("alert %s: %v", condition, err)
+		return
+	}
+	if alert == nil {
+		return
+	}
+	resolved := s.now()
+	alert.ResolvedAt = &resolved
+	alert.Resolution = resolution
+	if err := s.store.SaveAlert(alert); err != nil {
+		s.logger.Printf("alert %s: %v", condition, err)
+		return
+	}
+	s.notify(NoticeInfo, alert.Module, "resolved: %s (%s)", alert.Message, resolution)
+}
+
+// unresolved returns the unresolved alert of a condition, or nil
+func (s *Server) unresolved(condition string) (*Alert, error) {
+	alerts, err := s.store.Alerts()
+	if err != nil {
+		return nil, err
+	}
+	for _, alert := range alerts {
+		if alert.Condition == condition && alert.ResolvedAt == nil {
+			return alert, nil
+		}
+	}
+	return nil, nil
+}
+
+// pruneAlerts removes alerts resolved longer than alertRetention ago
+func (s *Server) pruneAlerts(now time.Time) {
+	alerts, err := s.store.Alerts()
+	if err != nil {
+		s.logger.Printf("pruning alerts: %v", err)
+		return
+	}
+	for _, alert := range alerts {
+		if alert.ResolvedAt != nil && now.Sub(*alert.ResolvedAt) > alertRetention {
+			if err := s.store.DeleteAlert(alert.ID); err != nil {
+				s.logger.Printf("pruning alerts: %v", err)
+			}
+		}
+	}
+}
+
+// Alerts returns the alerts in a state about a module, most recently
+// opened first. Alerts about nodes are included for every module.
+func (s *Server) Alerts(state, module string) ([]*Alert, error) {
+	if err := validateAlertState(state); err != nil {
+		return nil, err
+	}
+	alerts, err := s.store.Alerts()
+	if err != nil {
+		return nil, err
+	}
+	matching := make([]*Alert, 0, len(alerts))
+	for _, alert := range alerts {
+		if alertMatches(alert, state, module) {
+			matching = append(matching, alert)
+		}
+	}
+	return matching, nil
+}
+
+// AcknowledgeAlert records that someone is looking into an alert
+func (s *Server) AcknowledgeAlert(id string, action AlertAction) (*Alert, error) {
+	return s.updateAlert(id, action, func(alert *Alert, now time.Time) error {
+		if alert.ResolvedAt != nil {
+			return &requestError{fmt.Errorf("alert %s is already resolved", id)}
+		}
+		if alert.AcknowledgedAt == nil {
+			alert.AcknowledgedAt = &now
+			alert.AcknowledgedBy = action.By
+		}
+		return nil
+	})
+}
+
+// ResolveAlert resolves an alert by hand, such as one whose condition the
+// server cannot see clear
+func (s *Server) ResolveAlert(id string, action AlertAction) (*Alert, error) {
+	alert, err := s.updateAlert(id, action, func(alert *Alert, now time.Time) error {
+		if alert.ResolvedAt != nil {
+			return &requestError{fmt.Errorf("alert %s is already resolved", id)}
+		}
+		alert.ResolvedAt = &now
+		alert.ResolvedBy = action.By
+		alert.Resolution = "resolved by " + action.By
+		return nil
+	})
+	if err == nil {
+		s.notify(NoticeInfo, alert.Module, "resolved by %s: %s", action.By, alert.Message)
+	}
+	return alert, err
+}
+
+// updateAlert changes a stored alert and adds the action's note to it
+func (s *Server) updateAlert(id string, action AlertAction, change func(alert *Alert, now time.Time) error) (*Alert, error) {
+	if strings.TrimSpace(action.By) == "" {
+		return nil, &requestError{errors.New("by is required: name who takes the action")}
+	}
+	s.alertsMu.Lock()
+	defer s.alertsMu.Unlock()
+	alert, err := s.store.Alert(id)
+	if err != nil {
+		return nil, err
+	}
+	now := s.now()
+	if err := change(alert, now); err != nil {
+		return nil, err
+	}
+	if note := strings.TrimSpace(action.Note); note != "" {
+		alert.Notes = append(alert.Notes, Note{Time: now, By: action.By, Text: note})
+	}
+	if err := s.store.SaveAlert(alert); err != nil {
+		return nil, err
+	}
+	return alert, nil
+}
+
+// SaveAlert records an alert
+func (s *Store) SaveAlert(alert *Alert) error {
+	data, err := json.MarshalIndent(alert, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode alert: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(kindAlerts, alert.ID, data)
+}
+
+// Alert returns a recorded alert
+func (s *Store) Alert(id string) (*Alert, error) {
+	if err := validateName("alert", id); err != nil {
+		return nil, err
+	}
+	data, err := s.read(kindAlerts, id)
+	if err != nil {
+		return nil, err
+	}
+	var alert Alert
+	if err := json.Unmarshal(data, &alert); err != nil {
+		return nil, fmt.Errorf("failed to parse alert %s: %w", id, err)
+	}
+	return &alert, nil
+}
+
+// Alerts returns every recorded alert, most recently opened first
+func (s *Store) Alerts() ([]*Alert, error) {
+	ids, err := s.names(kindAlerts)
+	if err != nil {
+		return nil, err
+	}
+	alerts := make([]*Alert, 0, len(ids))
+	for _, id := range ids {
+		alert, err := s.Alert(id)
+		if err != nil {
+			return nil, err
+		}
+		alerts = append(alerts, alert)
+	}
+	sort.SliceStable(alerts, func(i, j int) bool { return alerts[i].OpenedAt.After(alerts[j].OpenedAt) })
+	return alerts, nil
+}
+
+// DeleteAlert removes a recorded alert
+func (s *Store) DeleteAlert(id string) error {
+	if err := validateName("alert", id); err != nil {
+		return err
+	}
+	return s.remove(kindAlerts, id)
+}
+
+func (s *Server) handleListAlerts(w http.ResponseWriter, r *http.Request) {
+	alerts, err := s.Alerts(r.URL.Query().Get("state"), r.URL.Query().Get("module"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, alerts)
+}
+
+func (s *Server) handleGetAlert(w http.ResponseWriter, r *http.Request) {
+	alert, err := s.store.Alert(r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, alert)
+}
+
+func (s *Server) handleAcknowledgeAlert(w http.ResponseWriter, r *http.Request) {
+	s.handleAlertAction(w, r, s.AcknowledgeAlert)
+}
+
+func (s *Server) handleResolveAlert(w http.ResponseWriter, r *http.Request) {
+	s.handleAlertAction(w, r, s.ResolveAlert)
+}
+
+// handleAlertAction decodes an alert action and takes it
+func (s *Server) handleAlertAction(w http.ResponseWriter, r *http.Request, take func(id string, action AlertAction) (*Alert, error)) {
+	var action AlertAction
+	if err := decodeJSON(r, &action); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	alert, err := take(r.PathValue("id"), action)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, alert)
+}
+
+// handleNotifications lists the deliveries of each notification channel
+// alerts were sent through
+func (s *Server) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	metrics := []notifications.ChannelMetrics{}
+	if s.config.Notifications != nil {
+		metrics = s.config.Notifications.Metrics()
+	}
+	writeJSON(w, http.StatusOK, metrics)
+}
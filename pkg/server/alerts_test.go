@@ -0,0 +1,245 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	driftpkg "github.com/ataiva-software/forge/pkg/drift"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/history"
+	"github.com/ataiva-software/forge/pkg/notifications"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestServer_Alerts(t *testing.T) {
+	kv := store.NewMemory()
+	// Each run fails with failure, and otherwise records a check of web1
+	// that finds drifted drifted
+	var failure error
+	drifted := true
+	checks := 0
+	run := func(ctx context.Context, job Job) error {
+		if failure != nil {
+			return failure
+		}
+		execution := history.NewExecution(job.Module.Metadata.Name, "")
+		// Executions are listed in ID order, random within a second
+		checks++
+		execution.ID = fmt.Sprintf("20240601T120000-%08d", checks)
+		execution.AddReport(history.PhasePlan, &executor.RunReport{Hosts: []executor.HostResult{
+			{Host: "web1", Status: executor.HostSucceeded, StartTime: time.Now(), EndTime: time.Now()},
+		}}, nil)
+		plan := &core.Plan{}
+		if drifted {
+			plan.Changes = []core.Change{{Action: core.ActionUpdate, Resource: types.Resource{Type: "pkg", Name: "nginx"}}}
+		}
+		execution.AddPlan("web1", plan, time.Now())
+		execution.Finish("succeeded")
+		return history.NewStore(kv).Save(execution)
+	}
+	s, err := NewServer(Config{Store: kv}, run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+	request(t, handler, http.MethodPut, "/api/v1/modules/site", testModule, nil)
+	request(t, handler, http.MethodPut, "/api/v1/inventories/prod", testInventory, nil)
+	triggerAction := func(action string) {
+		request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "`+action+`", "module": "site", "inventory": "prod"}`, nil)
+		s.execute(context.Background(), <-s.queue)
+	}
+	trigger := func() { triggerAction(ActionPlan) }
+	conditions := func(state string) map[string]*Alert {
+		var alerts []*Alert
+		if code := request(t, handler, http.MethodGet, "/api/v1/alerts?state="+state, "", &alerts); code != http.StatusOK {
+			t.Fatalf("GET alerts = %d", code)
+		}
+		byCondition := make(map[string]*Alert)
+		for _, alert := range alerts {
+			byCondition[alert.Condition] = alert
+		}
+		return byCondition
+	}
+
+	trigger()
+	trigger()
+	failure = errors.New("1 host(s) unreachable")
+	trigger()
+	request(t, handler, http.MethodPost, "/api/v1/reports", `{"node": "db1", "status": "failed", "error": "timeout"}`, nil)
+
+	open := conditions(AlertUnresolved)
+	if len(open) != 3 || open["drift/web/web1"] == nil || open["run/plan/site/prod"] == nil || open["node/db1"] == nil {
+		t.Fatalf("unresolved alerts = %v", open)
+	}
+	drift := open["drift/web/web1"]
+	if drift.Occurrences != 2 || drift.Module != "web" || drift.Level != NoticeWarning || drift.Message != "web drifted on web1: pkg.nginx" {
+		t.Errorf("drift alert = %+v", drift)
+	}
+
+	var acknowledged Alert
+	if code := request(t, handler, http.MethodPost, "/api/v1/alerts/"+drift.ID+"/acknowledge", `{"by": "alice", "note": "looking at nginx"}`, &acknowledged); code != http.StatusOK {
+		t.Fatalf("POST acknowledge = %d", code)
+	}
+	if acknowledged.State() != AlertAcknowledged || acknowledged.AcknowledgedBy != "alice" || len(acknowledged.Notes) != 1 {
+		t.Errorf("acknowledged alert = %+v", acknowledged)
+	}
+	if code := request(t, handler, http.MethodPost, "/api/v1/alerts/"+drift.ID+"/acknowledge", `{}`, nil); code != http.StatusBadRequest {
+		t.Errorf("POST acknowledge without by = %d, want 400", code)
+	}
+	if open := conditions(AlertOpen); len(open) != 2 || open["drift/web/web1"] != nil {
+		t.Errorf("open alerts = %v, want the unacknowledged ones", open)
+	}
+
+	// A successful run that finds web1 in sync clears the run and drift alerts
+	failure, drifted = nil, false
+	trigger()
+	request(t, handler, http.MethodPost, "/api/v1/reports", `{"node": "db1", "status": "succeeded"}`, nil)
+	if open := conditions(AlertUnresolved); len(open) != 0 {
+		t.Errorf("unresolved alerts after the conditions cleared = %v", open)
+	}
+	resolved := conditions(AlertResolved)
+	if alert := resolved["drift/web/web1"]; alert == nil || alert.ResolvedBy != "" || alert.Resolution == "" || alert.AcknowledgedBy != "alice" {
+		t.Errorf("resolved drift alert = %+v", alert)
+	}
+	var status Status
+	request(t, handler, http.MethodGet, "/api/v1/status?module=web", "", &status)
+	if len(status.Alerts) != 0 || status.Notices[0].Message != "resolved: node db1 reported a failed run: timeout (node db1 reported a succeeded run)" {
+		t.Errorf("status alerts = %v, latest notice %+v", status.Alerts, status.Notices[0])
+	}
+
+	// Drift seen again opens a new alert, which can be resolved by hand
+	drifted = true
+	trigger()
+	again := conditions(AlertUnresolved)["drift/web/web1"]
+	if again == nil || again.ID == drift.ID || again.Occurrences != 1 {
+		t.Fatalf("drift alert after it was resolved = %+v", again)
+	}
+	var manual Alert
+	if code := request(t, handler, http.MethodPost, "/api/v1/alerts/"+again.ID+"/resolve", `{"by": "bob", "note": "expected, rolled back upstream"}`, &manual); code != http.StatusOK {
+		t.Fatalf("POST resolve = %d", code)
+	}
+	if manual.State() != AlertResolved || manual.ResolvedBy != "bob" {
+		t.Errorf("resolved alert = %+v", manual)
+	}
+	if code := request(t, handler, http.MethodPost, "/api/v1/alerts/"+again.ID+"/acknowledge", `{"by": "alice"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("acknowledging a resolved alert = %d, want 400", code)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/alerts/20240101T000000-00000000", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET unknown alert = %d, want 404", code)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/alerts?state=snoozed", "", nil); code != http.StatusBadRequest {
+		t.Errorf("GET alerts in an unknown state = %d, want 400", code)
+	}
+
+	// Every run that checked web1 is in the drift history, most recent
+	// first, and a restarted server still has it
+	restarted, err := NewServer(Config{Store: kv}, run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []*driftpkg.DriftReport
+	if code := request(t, restarted.Handler(), http.MethodGet, "/api/v1/drift?module=web", "", &history); code != http.StatusOK {
+		t.Fatalf("GET drift = %d", code)
+	}
+	detected := make([]int, len(history))
+	for i, report := range history {
+		detected[i] = report.DriftDetected
+	}
+	if fmt.Sprint(detected) != "[1 0 1 1]" || history[0].TotalChecked != 1 || history[0].Results[0].ResourceID != "web1/pkg.nginx" {
+		t.Errorf("drift history detected = %v, latest %+v", detected, history[0])
+	}
+	if code := request(t, restarted.Handler(), http.MethodGet, "/api/v1/drift?module=db", "", &history); code != http.StatusOK || len(history) != 0 {
+		t.Errorf("GET drift of another module = %d, %d report(s)", code, len(history))
+	}
+
+	// A plan that succeeds does not clear the alert of failing applies
+	drifted, failure = false, errors.New("apply failed on web1")
+	triggerAction(ActionApply)
+	failure = nil
+	trigger()
+	if open := conditions(AlertUnresolved); open["run/apply/site/prod"] == nil {
+		t.Errorf("unresolved alerts after a successful plan = %v, want the apply alert", open)
+	}
+}
+
+func TestServer_PruneAlerts(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(ctx context.Context, job Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	s.now = func() time.Time { return now }
+
+	s.raise("node/db1", NoticeError, "", "node db1 reported a failed run")
+	s.clear("node/db1", "node db1 reported a succeeded run")
+	now = now.Add(alertRetention + time.Hour)
+	s.raise("node/db2", NoticeError, "", "node db2 reported a failed run")
+
+	alerts, err := s.Alerts("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Condition != "node/db2" {
+		t.Errorf("alerts = %+v, want the old resolved alert pruned", alerts)
+	}
+}
+
+// sentChannel is a notification channel recording what it was sent
+type sentChannel struct {
+	sent chan *notifications.Notification
+}
+
+func (c *sentChannel) Send(ctx context.Context, notification *notifications.Notification) error {
+	c.sent <- notification
+	return nil
+}
+func (c *sentChannel) Type() string { return "test" }
+func (c *sentChannel) Name() string { return "oncall" }
+
+func TestServer_AlertNotifications(t *testing.T) {
+	channel := &sentChannel{sent: make(chan *notifications.Notification, 2)}
+	manager := notifications.NewNotificationManager(nil)
+	manager.AddChannel(channel)
+	manager.AddRule(notifications.NotificationRule{Name: "alerts", Enabled: true, Channels: []string{"oncall"}})
+	s, err := NewServer(Config{Store: store.NewMemory(), Notifications: manager}, func(ctx context.Context, job Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Seeing an open alert again does not send it again
+	s.raise("node/db1", NoticeError, "", "node db1 reported a failed run")
+	s.raise("node/db1", NoticeError, "", "node db1 reported a failed run")
+	select {
+	case sent := <-channel.sent:
+		if sent.Title != "Alert: node/db1" || sent.Level != notifications.LevelError || sent.Data["condition"] != "node/db1" {
+			t.Errorf("sent %+v", sent)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("alert was not sent")
+	}
+	select {
+	case sent := <-channel.sent:
+		t.Errorf("alert sent again: %+v", sent)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	// The delivery is counted once the channel returns
+	var metrics []notifications.ChannelMetrics
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if status := request(t, s.Handler(), http.MethodGet, "/api/v1/notifications", "", &metrics); status != http.StatusOK {
+			t.Fatalf("GET /api/v1/notifications = %d", status)
+		}
+		if len(metrics) > 0 {
+			break
+		}
+	}
+	if len(metrics) != 1 || metrics[0].Channel != "oncall" || metrics[0].Accepted != 1 {
+		t.Errorf("notification metrics = %+v", metrics)
+	}
+}
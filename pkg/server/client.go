@@ -0,0 +1,212 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Client calls the API of a server
+type Client struct {
+	url    string
+	token  string
+	client *http.Client
+}
+
+// NewClient creates a client for the server at baseURL, sending token as a
+// bearer token when set
+func NewClient(baseURL, token string) *Client {
+	return &Client{
+		url:    strings.TrimSuffix(baseURL, "/"),
+		token:  token,
+		client: &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+// Schedules returns the server's schedules
+func (c *Client) Schedules(ctx context.Context) ([]*Schedule, error) {
+	var schedules []*Schedule
+	err := c.do(ctx, http.MethodGet, "/api/v1/schedules", nil, &schedules)
+	return schedules, err
+}
+
+// PutSchedule creates or replaces a schedule
+func (c *Client) PutSchedule(ctx context.Context, schedule *Schedule) (*Schedule, error) {
+	var saved Schedule
+	if err := c.do(ctx, http.MethodPut, "/api/v1/schedules/"+url.PathEscape(schedule.Name), schedule, &saved); err != nil {
+		return nil, err
+	}
+	return &saved, nil
+}
+
+// DeleteSchedule removes a schedule
+func (c *Client) DeleteSchedule(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/api/v1/schedules/"+url.PathEscape(name), nil, nil)
+}
+
+// Calendar returns the occurrences of the server's schedules between from and to
+func (c *Client) Calendar(ctx context.Context, from, to time.Time) ([]Event, error) {
+	query := url.Values{"from": {from.Format(time.RFC3339)}, "to": {to.Format(time.RFC3339)}}
+	var events []Event
+	err := c.do(ctx, http.MethodGet, "/api/v1/calendar?"+query.Encode(), nil, &events)
+	return events, err
+}
+
+// do sends a JSON request and decodes the JSON response into out
+func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("failed to encode request: %w", err)
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&failure) == nil && failure.Error != "" {
+			return fmt.Errorf("server returned %s: %s", resp.Status, failure.Error)
+		}
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// Status returns what the server knows of a module: the drift of its hosts,
+// its runs in progress and recent notices
+func (c *Client) Status(ctx context.Context, module string) (*Status, error) {
+	var status Status
+	if err := c.do(ctx, http.MethodGet, "/api/v1/status?"+url.Values{"module": {module}}.Encode(), nil, &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// Alerts returns the server's alerts in a state, open, acknowledged,
+// resolved or unresolved, about a module; empty values return every alert
+func (c *Client) Alerts(ctx context.Context, state, module string) ([]*Alert, error) {
+	query := url.Values{}
+	if state != "" {
+		query.Set("state", state)
+	}
+	if module != "" {
+		query.Set("module", module)
+	}
+	path := "/api/v1/alerts"
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	var alerts []*Alert
+	err := c.do(ctx, http.MethodGet, path, nil, &alerts)
+	return alerts, err
+}
+
+// AcknowledgeAlert records that someone is looking into an alert
+func (c *Client) AcknowledgeAlert(ctx context.Context, id string, action AlertAction) (*Alert, error) {
+	var alert Alert
+	if err := c.do(ctx, http.MethodPost, "/api/v1/alerts/"+url.PathEscape(id)+"/acknowledge", action, &alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// ResolveAlert resolves an alert by hand
+func (c *Client) ResolveAlert(ctx context.Context, id string, action AlertAction) (*Alert, error) {
+	var alert Alert
+	if err := c.do(ctx, http.MethodPost, "/api/v1/alerts/"+url.PathEscape(id)+"/resolve", action, &alert); err != nil {
+		return nil, err
+	}
+	return &alert, nil
+}
+
+// WatchStatus calls see with the status of a module when the stream opens
+// and again each time it changes, until the context is done or the stream
+// breaks
+func (c *Client) WatchStatus(ctx context.Context, module string, see func(*Status)) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+"/api/v1/status/stream?"+url.Values{"module": {module}}.Encode(), nil)
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	// The stream stays open for as long as it is watched
+	streaming := *c.client
+	streaming.Timeout = 0
+	resp, err := streaming.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to reach server: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Error string `json:"error"`
+		}
+		if json.NewDecoder(io.LimitReader(resp.Body, maxDocumentSize)).Decode(&failure) == nil && failure.Error != "" {
+			return fmt.Errorf("server returned %s: %s", resp.Status, failure.Error)
+		}
+		return fmt.Errorf("server returned %s", resp.Status)
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxDocumentSize)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && data != "":
+			if event == "error" {
+				return fmt.Errorf("server returned an error: %s", data)
+			}
+			var status Status
+			if err := json.Unmarshal([]byte(data), &status); err != nil {
+				return fmt.Errorf("invalid response from server: %w", err)
+			}
+			see(&status)
+			event, data = "", ""
+		}
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("lost the status stream: %w", err)
+	}
+	return errors.New("the server closed the status stream")
+}
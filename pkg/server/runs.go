@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+)
+
+// Run actions
+const (
+	ActionPlan  = "plan"
+	ActionApply = "apply"
+)
+
+// Run statuses
+const (
+	RunQueued    = "queued"
+	RunRunning   = "running"
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// RunRequest asks the server to plan or apply a stored module to the hosts
+// of a stored inventory, optionally limited to some groups and hosts
+type RunRequest struct {
+	Action    string   `json:"action"`
+	Module    string   `json:"module"`
+	Inventory string   `json:"inventory"`
+	Groups    []string `json:"groups,omitempty"`
+	Hosts     []string `json:"hosts,omitempty"`
+	// Approval is the approved request of an approval workflow an apply of
+	// the module needs
+	Approval string `json:"approval,omitempty"`
+}
+
+// Validate checks a run request
+func (r RunRequest) Validate() error {
+	if r.Action != ActionPlan && r.Action != ActionApply {
+		return fmt.Errorf("action must be plan or apply, got %q", r.Action)
+	}
+	if err := validateName("module", r.Module); err != nil {
+		return err
+	}
+	return validateName("inventory", r.Inventory)
+}
+
+// Run is a plan or apply triggered through the server
+type Run struct {
+	ID string `json:"id"`
+	RunRequest
+	// Schedule names the schedule that queued the run
+	Schedule   string     `json:"schedule,omitempty"`
+	Status     string     `json:"status"`
+	Error      string     `json:"error,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	StartedAt  *time.Time `json:"started_at,omitempty"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+}
+
+// Job is everything a RunFunc needs to carry out a run
+type Job struct {
+	Run    *Run
+	Module *core.Module
+	// ModuleData and InventoryData are the documents as they were uploaded
+	ModuleData    []byte
+	Inventory     *inventory.Inventory
+	InventoryData []byte
+}
+
+// RunFunc plans or applies a job, returning why it failed
+type RunFunc func(ctx context.Context, job Job) error
+
+// newRun creates a queued run with a sortable unique ID
+func newRun(request RunRequest, now time.Time) *Run {
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	return &Run{
+		ID:         now.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix),
+		RunRequest: request,
+		Status:     RunQueued,
+		CreatedAt:  now,
+	}
+}
+
+// job loads the module and selected hosts of a run
+func (s *Server) job(run *Run) (Job, error) {
+	module, moduleData, err := s.store.Module(run.Module)
+	if err != nil {
+		return Job{}, err
+	}
+	inv, inventoryData, err := s.store.Inventory(run.Inventory)
+	if err != nil {
+		return Job{}, err
+	}
+	inv, err = inv.Select(run.Groups, run.Hosts)
+	if err != nil {
+		return Job{}, err
+	}
+	return Job{
+		Run:           run,
+		Module:        module,
+		ModuleData:    moduleData,
+		Inventory:     inv,
+		InventoryData: inventoryData,
+	}, nil
+}
+
+// work carries out queued runs one at a time until the context is done
+func (s *Server) work(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-s.queue:
+			s.execute(ctx, id)
+		}
+	}
+}
+
+// execute carries out one run and records its outcome
+func (s *Server) execute(ctx context.Context, id string) {
+	run, err := s.store.Run(id)
+	if err != nil {
+		s.logger.Printf("run %s: %v", id, err)
+		return
+	}
+	run.Status = RunRunning
+	started := s.now()
+	run.StartedAt = &started
+	if err := s.store.SaveRun(run); err != nil {
+		s.logger.Printf("run %s: %v", id, err)
+	}
+	s.logger.Printf("run %s: %s %s on %s", run.ID, run.Action, run.Module, run.Inventory)
+
+	module := run.Module
+	job, err := s.job(run)
+	if err == nil {
+		module = job.Module.Metadata.Name
+		s.notify(NoticeInfo, module, "%s run %s started on %s", run.Action, run.ID, run.Inventory)
+		err = s.run(ctx, job)
+	}
+	finished := s.now()
+	run.FinishedAt = &finished
+	run.Status = RunSucceeded
+	if err != nil {
+		run.Status = RunFailed
+		run.Error = err.Error()
+	}
+	if err := s.store.SaveRun(run); err != nil {
+		s.logger.Printf("run %s: %v", id, err)
+	}
+	s.logger.Printf("run %s: %s", run.ID, run.Status)
+	// Runs of a module on an inventory fail until one of them succeeds; a
+	// plan that succeeds says nothing about whether applies still fail
+	condition := "run/" + run.Action + "/" + run.Module + "/" + run.Inventory
+	if err != nil {
+		s.notify(NoticeError, module, "%s run %s failed: %v", run.Action, run.ID, err)
+		s.raise(condition, NoticeError, module, fmt.Sprintf("%s runs of %s on %s fail: %v", run.Action, run.Module, run.Inventory, err))
+	} else {
+		s.notify(NoticeInfo, module, "%s run %s succeeded", run.Action, run.ID)
+		s.clear(condition, fmt.Sprintf("%s run %s succeeded", run.Action, run.ID))
+	}
+	s.notifyDrift(ctx, run, module)
+	s.recordExecution(run)
+}
+
+// recoverRuns fails runs that a previous server process left unfinished
+func (s *Server) recoverRuns() error {
+	runs, err := s.store.Runs()
+	if err != nil {
+		return err
+	}
+	for _, run := range runs {
+		if run.Status != RunQueued && run.Status != RunRunning {
+			continue
+		}
+		run.Status = RunFailed
+		run.Error = "the server stopped before the run finished"
+		finished := s.now()
+		run.FinishedAt = &finished
+		if err := s.store.SaveRun(run); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,318 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule kinds: drift checks and applies queue runs, maintenance and
+// freeze windows are periods on the calendar
+const (
+	ScheduleDrift       = "drift"
+	ScheduleApply       = "apply"
+	ScheduleMaintenance = "maintenance"
+	ScheduleFreeze      = "freeze"
+)
+
+// RunSkipped is the status of a scheduled apply that fell in a freeze window
+const RunSkipped = "skipped"
+
+// maxOccurrences bounds the occurrences of one schedule in a calendar
+const maxOccurrences = 1000
+
+// scheduleInterval is how often due schedules are looked for
+var scheduleInterval = time.Minute
+
+// Schedule is an operation or window that recurs on the controller's calendar
+type Schedule struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Module and Inventory are what drift checks and applies run on; a
+	// window with an inventory covers only that inventory's runs
+	Module    string   `json:"module,omitempty"`
+	Inventory string   `json:"inventory,omitempty"`
+	Groups    []string `json:"groups,omitempty"`
+	Hosts     []string `json:"hosts,omitempty"`
+	// Start is the first occurrence
+	Start time.Time `json:"start"`
+	// Every repeats the schedule, such as 6h or 7d; empty means once
+	Every string `json:"every,omitempty"`
+	// Duration is how long a window stays open
+	Duration string `json:"duration,omitempty"`
+	Disabled bool   `json:"disabled,omitempty"`
+	// LastQueued is the occurrence the schedule last queued a run for
+	LastQueued *time.Time `json:"last_queued,omitempty"`
+}
+
+// Event is one occurrence of a schedule on the calendar
+type Event struct {
+	Schedule  string     `json:"schedule"`
+	Kind      string     `json:"kind"`
+	Module    string     `json:"module,omitempty"`
+	Inventory string     `json:"inventory,omitempty"`
+	Start     time.Time  `json:"start"`
+	End       *time.Time `json:"end,omitempty"`
+	// Conflicts names the freeze windows a scheduled apply falls in
+	Conflicts []string `json:"conflicts,omitempty"`
+}
+
+// parseInterval parses a duration such as 30m, 12h or 7d
+func parseInterval(value string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(value, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number of days %q", value)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	return time.ParseDuration(value)
+}
+
+// IsWindow reports whether the schedule is a period rather than a run
+func (s *Schedule) IsWindow() bool {
+	return s.Kind == ScheduleMaintenance || s.Kind == ScheduleFreeze
+}
+
+// Validate checks a schedule
+func (s *Schedule) Validate() error {
+	if err := validateName("schedule", s.Name); err != nil {
+		return err
+	}
+	switch s.Kind {
+	case ScheduleDrift, ScheduleApply:
+		if err := validateName("module", s.Module); err != nil {
+			return err
+		}
+		if err := validateName("inventory", s.Inventory); err != nil {
+			return err
+		}
+		if s.Duration != "" {
+			return &requestError{fmt.Errorf("schedule %s: only windows have a duration", s.Name)}
+		}
+	case ScheduleMaintenance, ScheduleFreeze:
+		if s.Inventory != "" {
+			if err := validateName("inventory", s.Inventory); err != nil {
+				return err
+			}
+		}
+		if duration, err := parseInterval(s.Duration); err != nil || duration <= 0 {
+			return &requestError{fmt.Errorf("schedule %s: a window needs a positive duration, such as 4h", s.Name)}
+		}
+	default:
+		return &requestError{fmt.Errorf("schedule %s: kind must be drift, apply, maintenance or freeze, got %q", s.Name, s.Kind)}
+	}
+	if s.Start.IsZero() {
+		return &requestError{fmt.Errorf("schedule %s: a start time is required", s.Name)}
+	}
+	if s.Every != "" {
+		every, err := parseInterval(s.Every)
+		if err != nil || every < time.Minute {
+			return &requestError{fmt.Errorf("schedule %s: every must be at least 1m, got %q", s.Name, s.Every)}
+		}
+	}
+	return nil
+}
+
+// period returns the schedule's repeat interval, zero when it runs once,
+// and its length, zero for runs. The schedule must be valid.
+func (s *Schedule) period() (every, length time.Duration) {
+	if s.Every != "" {
+		every, _ = parseInterval(s.Every)
+	}
+	if s.Duration != "" {
+		length, _ = parseInterval(s.Duration)
+	}
+	return every, length
+}
+
+// Occurrences returns the starts of the occurrences that are under way
+// between from and to, at most maxOccurrences of them
+func (s *Schedule) Occurrences(from, to time.Time) []time.Time {
+	every, length := s.period()
+	var starts []time.Time
+	first := 0
+	if every > 0 && from.After(s.Start) {
+		first = int(from.Sub(s.Start.Add(length)) / every)
+		if first < 0 {
+			first = 0
+		}
+	}
+	for i := first; len(starts) < maxOccurrences; i++ {
+		start := s.Start.Add(time.Duration(i) * every)
+		if !start.Before(to) {
+			break
+		}
+		if end := start.Add(length); end.After(from) || (length == 0 && !start.Before(from)) {
+			starts = append(starts, start)
+		}
+		if every == 0 {
+			break
+		}
+	}
+	return starts
+}
+
+// Latest returns the most recent occurrence at or before t
+func (s *Schedule) Latest(t time.Time) (time.Time, bool) {
+	if t.Before(s.Start) {
+		return time.Time{}, false
+	}
+	every, _ := s.period()
+	if every == 0 {
+		return s.Start, true
+	}
+	return s.Start.Add(t.Sub(s.Start) / every * every), true
+}
+
+// Covers reports whether the window is open at t for a run on inventory
+func (s *Schedule) Covers(inventory string, t time.Time) bool {
+	if !s.IsWindow() || s.Disabled || (s.Inventory != "" && s.Inventory != inventory) {
+		return false
+	}
+	start, ok := s.Latest(t)
+	_, length := s.period()
+	return ok && t.Before(start.Add(length))
+}
+
+// Calendar lists the occurrences of the schedules between from and to in
+// time order, marking the applies that fall in a freeze window
+func Calendar(schedules []*Schedule, from, to time.Time) []Event {
+	var events []Event
+	for _, schedule := range schedules {
+		if schedule.Disabled {
+			continue
+		}
+		_, length := schedule.period()
+		for _, start := range schedule.Occurrences(from, to) {
+			event := Event{
+				Schedule:  schedule.Name,
+				Kind:      schedule.Kind,
+				Module:    schedule.Module,
+				Inventory: schedule.Inventory,
+				Start:     start,
+			}
+			if schedule.IsWindow() {
+				end := start.Add(length)
+				event.End = &end
+			}
+			if schedule.Kind == ScheduleApply {
+				event.Conflicts = freezes(schedules, schedule.Inventory, start)
+			}
+			events = append(events, event)
+		}
+	}
+	sort.SliceStable(events, func(i, j int) bool {
+		if !events[i].Start.Equal(events[j].Start) {
+			return events[i].Start.Before(events[j].Start)
+		}
+		return events[i].Schedule < events[j].Schedule
+	})
+	return events
+}
+
+// freezes names the freeze windows open at t for runs on inventory
+func freezes(schedules []*Schedule, inventory string, t time.Time) []string {
+	var names []string
+	for _, schedule := range schedules {
+		if schedule.Kind == ScheduleFreeze && schedule.Covers(inventory, t) {
+			names = append(names, schedule.Name)
+		}
+	}
+	return names
+}
+
+// frozen returns an error naming the freeze windows that block applying
+// to inventory at t
+func (s *Server) frozen(inventory string, t time.Time) error {
+	schedules, err := s.store.Schedules()
+	if err != nil {
+		return err
+	}
+	if names := freezes(schedules, inventory, t); len(names) > 0 {
+		return fmt.Errorf("inventory %s is frozen by %s", inventory, strings.Join(names, ", "))
+	}
+	return nil
+}
+
+// schedule queues the runs of due schedules until the context is done
+func (s *Server) schedule(ctx context.Context) {
+	ticker := time.NewTicker(scheduleInterval)
+	defer ticker.Stop()
+	for {
+		s.queueDue(s.now())
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// queueDue queues a run for every drift check and apply whose latest
+// occurrence has not been queued yet. Occurrences missed while the server
+// was down are caught up once; applies in a freeze window are recorded as
+// skipped instead.
+func (s *Server) queueDue(now time.Time) {
+	schedules, err := s.store.Schedules()
+	if err != nil {
+		s.logger.Printf("schedules: %v", err)
+		return
+	}
+	for _, schedule := range schedules {
+		if schedule.IsWindow() || schedule.Disabled {
+			continue
+		}
+		occurrence, ok := schedule.Latest(now)
+		if !ok || (schedule.LastQueued != nil && !occurrence.After(*schedule.LastQueued)) {
+			continue
+		}
+		schedule.LastQueued = &occurrence
+		if err := s.store.SaveSchedule(schedule); err != nil {
+			s.logger.Printf("schedule %s: %v", schedule.Name, err)
+			continue
+		}
+
+		action := ActionPlan
+		if schedule.Kind == ScheduleApply {
+			action = ActionApply
+		}
+		run := newRun(RunRequest{
+			Action:    action,
+			Module:    schedule.Module,
+			Inventory: schedule.Inventory,
+			Groups:    schedule.Groups,
+			Hosts:     schedule.Hosts,
+		}, now)
+		run.Schedule = schedule.Name
+		if action == ActionApply {
+			if names := freezes(schedules, schedule.Inventory, now); len(names) > 0 {
+				run.Status = RunSkipped
+				run.Error = "frozen by " + strings.Join(names, ", ")
+				run.FinishedAt = &now
+			}
+		}
+		if run.Status == RunSkipped {
+			err = s.store.SaveRun(run)
+		} else {
+			err = s.enqueue(run)
+		}
+		if err != nil {
+			s.logger.Printf("schedule %s: %v", schedule.Name, err)
+			continue
+		}
+		s.logger.Printf("schedule %s: run %s %s", schedule.Name, run.ID, run.Status)
+	}
+}
+
+// markQueued records a new or changed schedule's past occurrences as
+// queued, so only occurrences from now on queue runs
+func markQueued(schedule *Schedule, now time.Time) {
+	schedule.LastQueued = nil
+	if occurrence, ok := schedule.Latest(now); ok {
+		schedule.LastQueued = &occurrence
+	}
+}
@@ -0,0 +1,216 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+// day is the Monday the schedules in these tests start on
+var day = time.Date(2024, 6, 3, 0, 0, 0, 0, time.UTC)
+
+func TestSchedule_Occurrences(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		from, to time.Time
+		want     []time.Time
+	}{
+		{
+			name:     "every 6h",
+			schedule: Schedule{Kind: ScheduleDrift, Start: day, Every: "6h"},
+			from:     day.Add(5 * time.Hour), to: day.Add(18 * time.Hour),
+			want: []time.Time{day.Add(6 * time.Hour), day.Add(12 * time.Hour)},
+		},
+		{
+			name:     "open window",
+			schedule: Schedule{Kind: ScheduleMaintenance, Start: day.Add(22 * time.Hour), Every: "1d", Duration: "4h"},
+			from:     day.Add(25 * time.Hour), to: day.Add(48 * time.Hour),
+			want: []time.Time{day.Add(22 * time.Hour), day.Add(46 * time.Hour)},
+		},
+		{
+			name:     "once",
+			schedule: Schedule{Kind: ScheduleApply, Start: day.Add(time.Hour)},
+			from:     day, to: day.Add(7 * 24 * time.Hour),
+			want: []time.Time{day.Add(time.Hour)},
+		},
+		{
+			name:     "before start",
+			schedule: Schedule{Kind: ScheduleApply, Start: day.Add(48 * time.Hour), Every: "1d"},
+			from:     day, to: day.Add(24 * time.Hour),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.schedule.Occurrences(tt.from, tt.to); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Occurrences = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSchedule_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		schedule Schedule
+		want     string
+	}{
+		{name: "unknown kind", schedule: Schedule{Name: "x", Kind: "reboot", Start: day}, want: "kind must be"},
+		{name: "run without module", schedule: Schedule{Name: "x", Kind: ScheduleApply, Inventory: "prod", Start: day}, want: "invalid module name"},
+		{name: "window without duration", schedule: Schedule{Name: "x", Kind: ScheduleFreeze, Start: day}, want: "positive duration"},
+		{name: "run with duration", schedule: Schedule{Name: "x", Kind: ScheduleDrift, Module: "web", Inventory: "prod", Start: day, Duration: "1h"}, want: "only windows"},
+		{name: "no start", schedule: Schedule{Name: "x", Kind: ScheduleFreeze, Duration: "1h"}, want: "start time is required"},
+		{name: "too often", schedule: Schedule{Name: "x", Kind: ScheduleDrift, Module: "web", Inventory: "prod", Start: day, Every: "10s"}, want: "at least 1m"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.schedule.Validate(); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Validate = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalendar_Conflicts(t *testing.T) {
+	schedules := []*Schedule{
+		{Name: "nightly", Kind: ScheduleApply, Module: "web", Inventory: "prod", Start: day.Add(2 * time.Hour), Every: "1d"},
+		{Name: "staging", Kind: ScheduleApply, Module: "web", Inventory: "staging", Start: day.Add(3 * time.Hour), Every: "1d"},
+		{Name: "release", Kind: ScheduleFreeze, Inventory: "prod", Start: day.Add(24 * time.Hour), Duration: "1d"},
+		{Name: "old", Kind: ScheduleFreeze, Start: day, Duration: "30d", Disabled: true},
+	}
+	events := Calendar(schedules, day, day.Add(48*time.Hour))
+
+	var got []string
+	for _, event := range events {
+		got = append(got, event.Start.Format("Jan 2 15:04")+" "+event.Schedule+" "+strings.Join(event.Conflicts, ","))
+	}
+	want := []string{
+		"Jun 3 02:00 nightly ",
+		"Jun 3 03:00 staging ",
+		"Jun 4 00:00 release ",
+		"Jun 4 02:00 nightly release",
+		"Jun 4 03:00 staging ",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Calendar = %q, want %q", got, want)
+	}
+	if events[2].End == nil || !events[2].End.Equal(day.Add(48*time.Hour)) {
+		t.Errorf("freeze end = %v", events[2].End)
+	}
+}
+
+func TestServer_Schedules(t *testing.T) {
+	jobs := make(chan Job, 1)
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(ctx context.Context, job Job) error {
+		jobs <- job
+		return nil
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := day.Add(12 * time.Hour)
+	s.now = func() time.Time { return now }
+	handler := s.Handler()
+	request(t, handler, http.MethodPut, "/api/v1/modules/web", testModule, nil)
+	request(t, handler, http.MethodPut, "/api/v1/inventories/prod", testInventory, nil)
+
+	schedules := map[string]string{
+		"drift":  `{"kind": "drift", "module": "web", "inventory": "prod", "start": "2024-06-03T00:00:00Z", "every": "6h"}`,
+		"freeze": `{"kind": "freeze", "inventory": "prod", "start": "2024-06-03T20:00:00Z", "duration": "8h"}`,
+		"apply":  `{"kind": "apply", "module": "web", "inventory": "prod", "start": "2024-06-03T15:00:00Z", "every": "6h"}`,
+	}
+	for name, body := range schedules {
+		if code := request(t, handler, http.MethodPut, "/api/v1/schedules/"+name, body, nil); code != http.StatusOK {
+			t.Fatalf("PUT schedule %s = %d", name, code)
+		}
+	}
+	if code := request(t, handler, http.MethodPut, "/api/v1/schedules/bad", `{"name": "other", "kind": "freeze"}`, nil); code != http.StatusBadRequest {
+		t.Errorf("PUT mismatched schedule = %d, want 400", code)
+	}
+
+	var events []Event
+	request(t, handler, http.MethodGet, "/api/v1/calendar?to=2024-06-04T00:00:00Z", "", &events)
+	if len(events) != 5 {
+		t.Fatalf("calendar = %+v, want 5 events", events)
+	}
+	if last := events[4]; last.Schedule != "apply" || !reflect.DeepEqual(last.Conflicts, []string{"freeze"}) {
+		t.Errorf("apply at 21:00 = %+v, want it in conflict with the freeze", last)
+	}
+
+	// Occurrences before the schedule was saved are not caught up
+	s.queueDue(now)
+	if len(s.queue) != 0 {
+		t.Fatalf("queued %d run(s) for past occurrences", len(s.queue))
+	}
+
+	now = day.Add(18 * time.Hour)
+	s.queueDue(now)
+	s.queueDue(now)
+	if len(s.queue) != 2 {
+		t.Fatalf("queued %d run(s), want a drift check and an apply once", len(s.queue))
+	}
+	run, err := s.store.Run(<-s.queue)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Schedule == "" || run.Module != "web" {
+		t.Errorf("run = %+v, want it queued by a schedule", run)
+	}
+	<-s.queue
+
+	// In the freeze the apply is skipped and manual applies are refused
+	now = day.Add(21 * time.Hour)
+	s.queueDue(now)
+	if len(s.queue) != 0 {
+		t.Errorf("queued %d run(s) in a freeze", len(s.queue))
+	}
+	runs, _ := s.store.Runs()
+	if runs[0].Status != RunSkipped || runs[0].Error != "frozen by freeze" {
+		t.Errorf("run = %+v, want the apply skipped", runs[0])
+	}
+	if code := request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "apply", "module": "web", "inventory": "prod"}`, nil); code != http.StatusConflict {
+		t.Errorf("POST apply in a freeze = %d, want 409", code)
+	}
+	if code := request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "plan", "module": "web", "inventory": "prod"}`, nil); code != http.StatusAccepted {
+		t.Errorf("POST plan in a freeze = %d, want 202", code)
+	}
+}
+
+func TestClient_Schedules(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory(), Token: "s3cret"}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s.Handler())
+	defer ts.Close()
+	ctx := context.Background()
+
+	client := NewClient(ts.URL+"/", "s3cret")
+	freeze := &Schedule{Name: "freeze", Kind: ScheduleFreeze, Start: time.Now().Add(time.Hour).UTC().Truncate(time.Second), Duration: "2h"}
+	if _, err := client.PutSchedule(ctx, freeze); err != nil {
+		t.Fatalf("PutSchedule: %v", err)
+	}
+	schedules, err := client.Schedules(ctx)
+	if err != nil || len(schedules) != 1 || !schedules[0].Start.Equal(freeze.Start) {
+		t.Errorf("Schedules = %+v, %v", schedules, err)
+	}
+	events, err := client.Calendar(ctx, time.Now(), time.Now().Add(24*time.Hour))
+	if err != nil || len(events) != 1 || events[0].End == nil {
+		t.Errorf("Calendar = %+v, %v", events, err)
+	}
+	if err := client.DeleteSchedule(ctx, "freeze"); err != nil {
+		t.Errorf("DeleteSchedule: %v", err)
+	}
+	if err := client.DeleteSchedule(ctx, "freeze"); err == nil || !strings.Contains(err.Error(), "404") {
+		t.Errorf("DeleteSchedule of a missing schedule = %v", err)
+	}
+	if _, err := NewClient(ts.URL, "wrong").Schedules(ctx); err == nil || !strings.Contains(err.Error(), "bearer token") {
+		t.Errorf("Schedules with a wrong token = %v", err)
+	}
+}
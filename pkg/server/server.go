@@ -0,0 +1,710 @@
+// Package server implements the central control plane: a REST API to
+// register nodes, store modules and inventories and trigger runs, next to
+// the web UI dashboard.
+package server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/agent"
+	"github.com/ataiva-software/forge/pkg/drift"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/notifications"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/webui"
+)
+
+// DefaultAddr is the address the server listens on unless configured
+// otherwise. It is only reachable from the machine the server runs on; other
+// addresses need a token.
+const DefaultAddr = "127.0.0.1:8080"
+
+// queueSize is how many runs may wait for the one before them to finish
+const queueSize = 64
+
+// maxDocumentSize limits uploaded modules, inventories and requests
+const maxDocumentSize = 10 << 20
+
+// errQueueFull is returned when a run cannot be queued
+var errQueueFull = errors.New("too many runs are queued")
+
+// Config configures the server
+type Config struct {
+	Addr string
+	// Store keeps nodes, modules, inventories and runs
+	Store store.Store
+	// Dir holds state kept as files by earlier versions, imported into Store
+	Dir string
+	// Token is required as a bearer token on every API request when set. It
+	// must be set unless the server listens on a loopback address.
+	Token   string
+	Version string
+	// DriftChannels are sent the drift report of every run that found
+	// hosts drifted, such as drift.detected webhooks
+	DriftChannels []drift.NotificationChannel
+	// Health is the host health history runs record into, whose scores
+	// the dashboard serves
+	Health *inventory.HealthTracker
+	// Notifications is sent every alert when it opens; the deliveries of
+	// its channels are served by the API and the dashboard
+	Notifications *notifications.NotificationManager
+}
+
+// Server is the control plane
+type Server struct {
+	config Config
+	store  *Store
+	// driftHistory keeps a drift report of every run that checked hosts
+	driftHistory *drift.DriftScheduler
+	// driftNotifier sends reports that found drift to the drift channels
+	driftNotifier *drift.DriftNotifier
+	run           RunFunc
+	dashboard     *webui.WebUIServer
+	queue         chan string
+	logger        *log.Logger
+	now           func() time.Time
+	notices       []Notice
+	noticesMu     sync.Mutex
+	// watchers are woken when what the status streams show may change
+	watchers watchers
+	// alertsMu keeps a condition from opening two alerts at once
+	alertsMu sync.Mutex
+}
+
+// NewServer creates a server that carries out runs with run
+func NewServer(config Config, run RunFunc, logger *log.Logger) (*Server, error) {
+	if config.Addr == "" {
+		config.Addr = DefaultAddr
+	}
+	if config.Token == "" && !IsLoopback(config.Addr) {
+		return nil, fmt.Errorf("server.token is required to listen on %s; without one the server only listens on a loopback address such as %s", config.Addr, DefaultAddr)
+	}
+	if run == nil {
+		return nil, fmt.Errorf("a run function is required")
+	}
+	if config.Store == nil {
+		return nil, fmt.Errorf("a store is required")
+	}
+	if _, err := store.Migrate(config.Store, "server", Migrations(config.Dir)); err != nil {
+		return nil, err
+	}
+	// The scheduler is never started; it only keeps the history
+	driftHistory := drift.NewDriftScheduler(nil, nil)
+	if err := driftHistory.UseStore(config.Store); err != nil {
+		return nil, err
+	}
+	if logger == nil {
+		logger = log.New(io.Discard, "", 0)
+	}
+
+	driftNotifier := drift.NewDriftNotifier(1)
+	for _, channel := range config.DriftChannels {
+		driftNotifier.AddChannel(channel)
+	}
+	driftNotifier.Enable()
+
+	dashboard := webui.NewWebUIServer(config.Addr)
+	if config.Version != "" {
+		dashboard.SetVersion(config.Version)
+	}
+	if config.Health != nil {
+		dashboard.SetHealthTracker(config.Health)
+	}
+	if config.Notifications != nil {
+		dashboard.SetNotifications(config.Notifications)
+	}
+	s := &Server{
+		config:        config,
+		store:         NewStore(config.Store),
+		driftHistory:  driftHistory,
+		driftNotifier: driftNotifier,
+		run:           run,
+		dashboard:     dashboard,
+		queue:         make(chan string, queueSize),
+		logger:        logger,
+		now:           time.Now,
+	}
+	s.store.changed = s.watchers.wake
+
+	names, err := s.store.ModuleNames()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		module, _, err := s.store.Module(name)
+		if err != nil {
+			logger.Printf("skipping stored module: %v", err)
+			continue
+		}
+		dashboard.AddModule(module)
+	}
+	return s, nil
+}
+
+// Store returns the server's store
+func (s *Server) Store() *Store {
+	return s.store
+}
+
+// Handler returns the API and the dashboard
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/v1/health", s.handleHealth)
+	mux.HandleFunc("GET /api/v1/nodes", s.handleListNodes)
+	mux.HandleFunc("POST /api/v1/nodes", s.handleRegisterNode)
+	mux.HandleFunc("GET /api/v1/nodes/{name}", s.handleGetNode)
+	mux.HandleFunc("DELETE /api/v1/nodes/{name}", s.handleDeleteNode)
+	mux.HandleFunc("POST /api/v1/reports", s.handleReport)
+	mux.HandleFunc("GET /api/v1/modules", s.handleListModules)
+	mux.HandleFunc("GET /api/v1/modules/{name}", s.handleGetModule)
+	mux.HandleFunc("PUT /api/v1/modules/{name}", s.handlePutModule)
+	mux.HandleFunc("DELETE /api/v1/modules/{name}", s.handleDeleteModule)
+	mux.HandleFunc("GET /api/v1/inventories", s.handleListInventories)
+	mux.HandleFunc("GET /api/v1/inventories/{name}", s.handleGetInventory)
+	mux.HandleFunc("PUT /api/v1/inventories/{name}", s.handlePutInventory)
+	mux.HandleFunc("DELETE /api/v1/inventories/{name}", s.handleDeleteInventory)
+	mux.HandleFunc("GET /api/v1/runs", s.handleListRuns)
+	mux.HandleFunc("POST /api/v1/runs", s.handleCreateRun)
+	mux.HandleFunc("GET /api/v1/runs/{id}", s.handleGetRun)
+	mux.HandleFunc("GET /api/v1/schedules", s.handleListSchedules)
+	mux.HandleFunc("GET /api/v1/schedules/{name}", s.handleGetSchedule)
+	mux.HandleFunc("PUT /api/v1/schedules/{name}", s.handlePutSchedule)
+	mux.HandleFunc("DELETE /api/v1/schedules/{name}", s.handleDeleteSchedule)
+	mux.HandleFunc("GET /api/v1/calendar", s.handleCalendar)
+	mux.HandleFunc("GET /api/v1/status", s.handleStatus)
+	mux.HandleFunc("GET /api/v1/status/stream", s.handleStatusStream)
+	mux.HandleFunc("GET /api/v1/drift", s.handleDriftHistory)
+	mux.HandleFunc("GET /api/v1/alerts", s.handleListAlerts)
+	mux.HandleFunc("GET /api/v1/alerts/{id}", s.handleGetAlert)
+	mux.HandleFunc("POST /api/v1/alerts/{id}/acknowledge", s.handleAcknowledgeAlert)
+	mux.HandleFunc("POST /api/v1/alerts/{id}/resolve", s.handleResolveAlert)
+	mux.HandleFunc("GET /api/v1/notifications", s.handleNotifications)
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, fmt.Errorf("no endpoint %s %s", r.Method, r.URL.Path))
+	})
+	mux.Handle("/", s.dashboard.Handler())
+	return s.withAuth(withContentType(mux))
+}
+
+// IsLoopback reports whether an address to listen on only accepts
+// connections from the same machine
+func IsLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// documentTypes are the media types modules and inventories are uploaded as
+var documentTypes = map[string]bool{
+	"application/json":   true,
+	"application/yaml":   true,
+	"application/x-yaml": true,
+}
+
+// withContentType requires API requests that change something to say they
+// send JSON, or YAML for uploaded documents. Browsers send neither across
+// sites without asking first, so pages on other sites cannot forge them.
+func withContentType(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if !strings.HasPrefix(r.URL.Path, "/api/") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		document := strings.HasPrefix(r.URL.Path, "/api/v1/modules/") || strings.HasPrefix(r.URL.Path, "/api/v1/inventories/")
+		if mediaType != "application/json" && !(document && documentTypes[mediaType]) {
+			want := "application/json"
+			if document {
+				want = "application/yaml or application/json"
+			}
+			writeError(w, http.StatusUnsupportedMediaType, fmt.Errorf("Content-Type must be %s", want))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// ListenAndServe serves the API and carries out runs until the context is done
+func (s *Server) ListenAndServe(ctx context.Context) error {
+	if err := s.recoverRuns(); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go s.work(ctx)
+	go s.schedule(ctx)
+
+	server := &http.Server{
+		Addr:              s.config.Addr,
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+		// Requests end with the server, so status streams do not hold
+		// up its shutdown
+		BaseContext: func(net.Listener) context.Context { return ctx },
+	}
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+		shutdown, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return server.Shutdown(shutdown)
+	}
+}
+
+// withAuth requires the token on API requests, except health checks
+func (s *Server) withAuth(next http.Handler) http.Handler {
+	if s.config.Token == "" {
+		return next
+	}
+	want := []byte("Bearer " + s.config.Token)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		public := !strings.HasPrefix(r.URL.Path, "/api/") || r.URL.Path == "/api/health" || r.URL.Path == "/api/v1/health"
+		got := []byte(r.Header.Get("Authorization"))
+		if !public && subtle.ConstantTimeCompare(got, want) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			writeError(w, http.StatusUnauthorized, errors.New("a valid bearer token is required"))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"status":  "healthy",
+		"version": s.config.Version,
+		"queued":  len(s.queue),
+	})
+}
+
+func (s *Server) handleListNodes(w http.ResponseWriter, r *http.Request) {
+	nodes, err := s.store.Nodes()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, nodes)
+}
+
+// handleRegisterNode registers a node or updates its address and labels
+func (s *Server) handleRegisterNode(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Name    string            `json:"name"`
+		Address string            `json:"address"`
+		Labels  map[string]string `json:"labels"`
+	}
+	if err := decodeJSON(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	now := s.now()
+	node, err := s.store.Node(request.Name)
+	status := http.StatusOK
+	if errors.Is(err, ErrNotFound) {
+		node, err = &Node{Name: request.Name, RegisteredAt: now}, nil
+		status = http.StatusCreated
+	}
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	node.Address = request.Address
+	node.Labels = request.Labels
+	node.LastSeen = now
+	if err := s.store.SaveNode(node); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, status, node)
+}
+
+func (s *Server) handleGetNode(w http.ResponseWriter, r *http.Request) {
+	node, err := s.store.Node(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, node)
+}
+
+func (s *Server) handleDeleteNode(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteNode(r.PathValue("name")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleReport records the report an agent sends after every run
+func (s *Server) handleReport(w http.ResponseWriter, r *http.Request) {
+	var report agent.Report
+	if err := decodeJSON(r, &report); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if report.Node == "" || report.Status == "" {
+		writeError(w, http.StatusBadRequest, errors.New("report must have a node and a status"))
+		return
+	}
+	if report.Protocol < 0 {
+		writeError(w, http.StatusBadRequest, errors.New("report protocol must be positive"))
+		return
+	}
+	// Agents from before protocols were negotiated send the first one
+	protocol := max(report.Protocol, 1)
+	checkIn := s.dashboard.CheckInAgent(webui.AgentCheckIn{Name: report.Node, Version: report.Version, ProtocolMin: protocol, ProtocolMax: protocol})
+	if checkIn.Status == webui.AgentIncompatible {
+		writeError(w, http.StatusUpgradeRequired, errors.New(checkIn.Message))
+		return
+	}
+	node, err := s.store.RecordReport(&report, s.now())
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	condition := "node/" + report.Node
+	if report.Status == agent.StatusFailed {
+		s.notify(NoticeError, "", "node %s reported a failed run: %s", report.Node, report.Error)
+		s.raise(condition, NoticeError, "", fmt.Sprintf("node %s reported a failed run: %s", report.Node, report.Error))
+	} else {
+		s.clear(condition, fmt.Sprintf("node %s reported a %s run", report.Node, report.Status))
+	}
+	writeJSON(w, http.StatusOK, node)
+}
+
+func (s *Server) handleListModules(w http.ResponseWriter, r *http.Request) {
+	names, err := s.store.ModuleNames()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) handleGetModule(w http.ResponseWriter, r *http.Request) {
+	_, data, err := s.store.Module(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeYAML(w, data)
+}
+
+func (s *Server) handlePutModule(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	module, err := s.store.PutModule(r.PathValue("name"), data)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	s.dashboard.AddModule(module)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":      r.PathValue("name"),
+		"module":    module.Metadata.Name,
+		"version":   module.Metadata.Version,
+		"resources": len(module.Spec.Resources),
+	})
+}
+
+func (s *Server) handleDeleteModule(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteModule(r.PathValue("name")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListInventories(w http.ResponseWriter, r *http.Request) {
+	names, err := s.store.InventoryNames()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, names)
+}
+
+func (s *Server) handleGetInventory(w http.ResponseWriter, r *http.Request) {
+	_, data, err := s.store.Inventory(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeYAML(w, data)
+}
+
+func (s *Server) handlePutInventory(w http.ResponseWriter, r *http.Request) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxDocumentSize))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	inv, err := s.store.PutInventory(r.PathValue("name"), data)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"name":   r.PathValue("name"),
+		"groups": inv.GroupNames(),
+		"hosts":  len(inv.ResolveHosts()),
+	})
+}
+
+func (s *Server) handleDeleteInventory(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteInventory(r.PathValue("name")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleListRuns(w http.ResponseWriter, r *http.Request) {
+	runs, err := s.store.Runs()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, runs)
+}
+
+// handleCreateRun checks a run request and queues it
+func (s *Server) handleCreateRun(w http.ResponseWriter, r *http.Request) {
+	var request RunRequest
+	if err := decodeJSON(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if err := request.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	// Catch missing documents and unknown targets before queueing
+	run := newRun(request, s.now())
+	if _, err := s.job(run); err != nil {
+		status := statusFor(err)
+		if status == http.StatusInternalServerError {
+			status = http.StatusBadRequest
+		}
+		writeError(w, status, err)
+		return
+	}
+
+	if request.Action == ActionApply {
+		if err := s.frozen(request.Inventory, run.CreatedAt); err != nil {
+			writeError(w, http.StatusConflict, err)
+			return
+		}
+	}
+
+	if err := s.enqueue(run); err != nil {
+		status := http.StatusInternalServerError
+		if errors.Is(err, errQueueFull) {
+			status = http.StatusServiceUnavailable
+		}
+		writeError(w, status, err)
+		return
+	}
+	w.Header().Set("Location", "/api/v1/runs/"+run.ID)
+	writeJSON(w, http.StatusAccepted, run)
+}
+
+// enqueue records a run and queues it, failing it when the queue is full
+func (s *Server) enqueue(run *Run) error {
+	if err := s.store.SaveRun(run); err != nil {
+		return err
+	}
+	select {
+	case s.queue <- run.ID:
+		return nil
+	default:
+		run.Status = RunFailed
+		run.Error = errQueueFull.Error()
+		finished := s.now()
+		run.FinishedAt = &finished
+		s.store.SaveRun(run)
+		return errQueueFull
+	}
+}
+
+func (s *Server) handleGetRun(w http.ResponseWriter, r *http.Request) {
+	run, err := s.store.Run(r.PathValue("id"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, run)
+}
+
+func (s *Server) handleListSchedules(w http.ResponseWriter, r *http.Request) {
+	schedules, err := s.store.Schedules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedules)
+}
+
+func (s *Server) handleGetSchedule(w http.ResponseWriter, r *http.Request) {
+	schedule, err := s.store.Schedule(r.PathValue("name"))
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+// handlePutSchedule creates or replaces a schedule; it queues runs from
+// its next occurrence on
+func (s *Server) handlePutSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule Schedule
+	if err := decodeJSON(r, &schedule); err != nil {
+		writeError(w, http.StatusBadRequest, err)
+		return
+	}
+	if schedule.Name == "" {
+		schedule.Name = r.PathValue("name")
+	}
+	if schedule.Name != r.PathValue("name") {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("schedule name %q does not match the URL", schedule.Name))
+		return
+	}
+	if err := schedule.Validate(); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	markQueued(&schedule, s.now())
+	if err := s.store.SaveSchedule(&schedule); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, schedule)
+}
+
+func (s *Server) handleDeleteSchedule(w http.ResponseWriter, r *http.Request) {
+	if err := s.store.DeleteSchedule(r.PathValue("name")); err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleCalendar lists the occurrences of every schedule between from and
+// to, RFC 3339 times defaulting to now and a week later
+func (s *Server) handleCalendar(w http.ResponseWriter, r *http.Request) {
+	from, to := s.now(), time.Time{}
+	for name, value := range map[string]*time.Time{"from": &from, "to": &to} {
+		raw := r.URL.Query().Get(name)
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, fmt.Errorf("invalid %s: %w", name, err))
+			return
+		}
+		*value = t
+	}
+	if to.IsZero() {
+		to = from.Add(7 * 24 * time.Hour)
+	}
+	if !to.After(from) {
+		writeError(w, http.StatusBadRequest, errors.New("to must be after from"))
+		return
+	}
+
+	schedules, err := s.store.Schedules()
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err)
+		return
+	}
+	events := Calendar(schedules, from, to)
+	if events == nil {
+		events = []Event{}
+	}
+	writeJSON(w, http.StatusOK, events)
+}
+
+// recordExecution shows a finished run on the dashboard
+func (s *Server) recordExecution(run *Run) {
+	s.dashboard.AddExecution(&webui.ExecutionRecord{
+		ID:         run.ID,
+		ModuleName: run.Module,
+		Action:     run.Action,
+		Status:     run.Status,
+		StartTime:  *run.StartedAt,
+		EndTime:    *run.FinishedAt,
+		User:       "server",
+		Error:      run.Error,
+	})
+}
+
+// statusFor maps a store error to an HTTP status
+func statusFor(err error) int {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		return http.StatusNotFound
+	case errors.As(err, new(*requestError)):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// decodeJSON reads a JSON request body
+func decodeJSON(r *http.Request, v interface{}) error {
+	if err := json.NewDecoder(io.LimitReader(r.Body, maxDocumentSize)).Decode(v); err != nil {
+		return fmt.Errorf("invalid request body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeYAML(w http.ResponseWriter, data []byte) {
+	w.Header().Set("Content-Type", "application/yaml")
+	w.Write(data)
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
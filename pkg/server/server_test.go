@@ -0,0 +1,414 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/agent"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/webui"
+)
+
+const testModule = `apiVersion: ataiva.com/chisel/v1
+kind: Module
+metadata:
+  name: web
+  version: 1.0.0
+spec:
+  resources:
+    - type: pkg
+      name: nginx
+      state: present
+`
+
+const testInventory = `apiVersion: ataiva.com/chisel/v1
+kind: Inventory
+targets:
+  db:
+    hosts: [db1]
+    connection:
+      user: ubuntu
+      port: 22
+      private_key_path: ~/.ssh/id_ed25519
+  web:
+    hosts: [web1, web2]
+    connection:
+      user: ubuntu
+      port: 22
+      private_key_path: ~/.ssh/id_ed25519
+`
+
+// request sends a request to the handler and decodes a JSON response into out
+func request(t *testing.T, handler http.Handler, method, path, body string, out interface{}) int {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if method == http.MethodPut && (strings.HasPrefix(path, "/api/v1/modules/") || strings.HasPrefix(path, "/api/v1/inventories/")) {
+		req.Header.Set("Content-Type", "application/yaml")
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if out != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+			t.Fatalf("%s %s: failed to decode %q: %v", method, path, rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestServer_Runs(t *testing.T) {
+	jobs := make(chan Job, 1)
+	run := func(ctx context.Context, job Job) error {
+		jobs <- job
+		return errors.New("1 host(s) unreachable")
+	}
+	s, err := NewServer(Config{Store: store.NewMemory()}, run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	if code := request(t, handler, http.MethodPut, "/api/v1/modules/web", testModule, nil); code != http.StatusOK {
+		t.Fatalf("PUT module = %d", code)
+	}
+	if code := request(t, handler, http.MethodPut, "/api/v1/modules/bad", "kind: Module", nil); code != http.StatusBadRequest {
+		t.Errorf("PUT invalid module = %d, want 400", code)
+	}
+	if code := request(t, handler, http.MethodPut, "/api/v1/inventories/prod", testInventory, nil); code != http.StatusOK {
+		t.Fatalf("PUT inventory = %d", code)
+	}
+
+	var modules []string
+	request(t, handler, http.MethodGet, "/api/v1/modules", "", &modules)
+	if !reflect.DeepEqual(modules, []string{"web"}) {
+		t.Errorf("modules = %v", modules)
+	}
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{name: "unknown action", body: `{"action": "destroy", "module": "web", "inventory": "prod"}`, want: http.StatusBadRequest},
+		{name: "unknown module", body: `{"action": "plan", "module": "db", "inventory": "prod"}`, want: http.StatusNotFound},
+		{name: "unknown host", body: `{"action": "plan", "module": "web", "inventory": "prod", "hosts": ["web3"]}`, want: http.StatusBadRequest},
+		{name: "path in name", body: `{"action": "plan", "module": "../web", "inventory": "prod"}`, want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := request(t, handler, http.MethodPost, "/api/v1/runs", tt.body, nil); code != tt.want {
+				t.Errorf("POST run = %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	var queued Run
+	code := request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "apply", "module": "web", "inventory": "prod", "groups": ["web"], "hosts": ["web2"]}`, &queued)
+	if code != http.StatusAccepted || queued.Status != RunQueued {
+		t.Fatalf("POST run = %d, %+v", code, queued)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go s.work(ctx)
+
+	select {
+	case job := <-jobs:
+		if job.Module.Metadata.Name != "web" || job.Run.ID != queued.ID {
+			t.Errorf("job = %+v", job)
+		}
+		if hosts := job.Inventory.ResolveHosts(); len(hosts) != 1 || hosts[0].Name != "web2" {
+			t.Errorf("job hosts = %v, want only web2", hosts)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("run was not carried out")
+	}
+
+	var finished Run
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		request(t, handler, http.MethodGet, "/api/v1/runs/"+queued.ID, "", &finished)
+		if finished.Status == RunFailed {
+			break
+		}
+	}
+	if finished.Status != RunFailed || finished.Error != "1 host(s) unreachable" || finished.FinishedAt == nil {
+		t.Errorf("run = %+v", finished)
+	}
+
+	var runs []Run
+	request(t, handler, http.MethodGet, "/api/v1/runs", "", &runs)
+	if len(runs) != 1 || runs[0].ID != queued.ID {
+		t.Errorf("runs = %+v", runs)
+	}
+}
+
+func TestServer_Nodes(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	var node Node
+	code := request(t, handler, http.MethodPost, "/api/v1/nodes", `{"name": "web1", "address": "10.0.0.5", "labels": {"role": "web"}}`, &node)
+	if code != http.StatusCreated || node.Address != "10.0.0.5" || node.RegisteredAt.IsZero() {
+		t.Fatalf("POST node = %d, %+v", code, node)
+	}
+
+	body, _ := json.Marshal(agent.Report{Node: "web1", Revision: "9f2c1e0", Status: agent.StatusSucceeded})
+	request(t, handler, http.MethodPost, "/api/v1/reports", string(body), nil)
+	body, _ = json.Marshal(agent.Report{Node: "web2", Status: agent.StatusFailed, Error: "boom"})
+	request(t, handler, http.MethodPost, "/api/v1/reports", string(body), nil)
+
+	var nodes []Node
+	request(t, handler, http.MethodGet, "/api/v1/nodes", "", &nodes)
+	if len(nodes) != 2 {
+		t.Fatalf("nodes = %+v", nodes)
+	}
+	if nodes[0].Address != "10.0.0.5" || nodes[0].LastReport == nil || nodes[0].LastReport.Revision != "9f2c1e0" {
+		t.Errorf("web1 = %+v", nodes[0])
+	}
+	if nodes[1].Name != "web2" || nodes[1].LastReport.Error != "boom" {
+		t.Errorf("web2 = %+v", nodes[1])
+	}
+
+	if code := request(t, handler, http.MethodDelete, "/api/v1/nodes/web2", "", nil); code != http.StatusNoContent {
+		t.Errorf("DELETE node = %d", code)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/nodes/web2", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET deleted node = %d", code)
+	}
+}
+
+func TestServer_ReportProtocol(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory(), Version: "1.5.0"}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	body, _ := json.Marshal(agent.Report{Node: "web1", Version: "1.4.2", Protocol: agent.ProtocolVersion, Status: agent.StatusSucceeded})
+	if code := request(t, handler, http.MethodPost, "/api/v1/reports", string(body), nil); code != http.StatusOK {
+		t.Fatalf("POST report = %d", code)
+	}
+	body, _ = json.Marshal(agent.Report{Node: "web2", Version: "9.0.0", Protocol: 99, Status: agent.StatusSucceeded})
+	if code := request(t, handler, http.MethodPost, "/api/v1/reports", string(body), nil); code != http.StatusUpgradeRequired {
+		t.Errorf("POST report in an unknown protocol = %d, want 426", code)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/nodes/web2", "", nil); code != http.StatusNotFound {
+		t.Errorf("GET node of a refused report = %d, want 404", code)
+	}
+
+	agents := s.dashboard.Agents()
+	if len(agents) != 2 || agents[0].Status != webui.AgentOutdated || agents[1].Status != webui.AgentIncompatible {
+		t.Errorf("agents = %+v", agents)
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory(), Token: "s3cret"}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	tests := []struct {
+		path   string
+		header string
+		want   int
+	}{
+		{path: "/api/v1/health", want: http.StatusOK},
+		{path: "/api/v1/nodes", want: http.StatusUnauthorized},
+		{path: "/api/v1/nodes", header: "Bearer wrong", want: http.StatusUnauthorized},
+		{path: "/api/v1/nodes", header: "Bearer s3cret", want: http.StatusOK},
+		{path: "/api/modules", want: http.StatusUnauthorized},
+		{path: "/", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, tt.path, nil)
+		if tt.header != "" {
+			req.Header.Set("Authorization", tt.header)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("GET %s with %q = %d, want %d", tt.path, tt.header, rec.Code, tt.want)
+		}
+	}
+}
+
+func TestServer_DashboardToken(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory(), Token: "s3cret"}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	page := rec.Body.String()
+	if rec.Code != http.StatusOK || !strings.Contains(page, "sessionStorage") || !strings.Contains(page, "'Bearer ' + token") {
+		t.Fatalf("GET / = %d, want the page to send its stored token as a bearer token", rec.Code)
+	}
+
+	// Every endpoint the page loads answers with the token it sends
+	loads := regexp.MustCompile(`load\('([^']+)'\)`).FindAllStringSubmatch(page, -1)
+	if len(loads) == 0 {
+		t.Fatal("the page loads no data")
+	}
+	for _, load := range loads {
+		path := load[1]
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("GET %s without a token = %d, want %d", path, rec.Code, http.StatusUnauthorized)
+		}
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer s3cret")
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusOK || !json.Valid(rec.Body.Bytes()) {
+			t.Errorf("GET %s with the token = %d %s, want JSON", path, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestNewServer_RequiresToken(t *testing.T) {
+	tests := []struct {
+		addr    string
+		token   string
+		wantErr bool
+	}{
+		{addr: ""},
+		{addr: "127.0.0.1:8080"},
+		{addr: "localhost:8080"},
+		{addr: "[::1]:8080"},
+		{addr: ":8080", wantErr: true},
+		{addr: "0.0.0.0:8080", wantErr: true},
+		{addr: "10.0.0.5:8080", wantErr: true},
+		{addr: ":8080", token: "s3cret"},
+	}
+	for _, tt := range tests {
+		_, err := NewServer(Config{Addr: tt.addr, Token: tt.token, Store: store.NewMemory()}, func(context.Context, Job) error { return nil }, nil)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NewServer(%q, token %q) error = %v, wantErr %v", tt.addr, tt.token, err, tt.wantErr)
+		}
+	}
+}
+
+func TestServer_ContentType(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	tests := []struct {
+		method      string
+		path        string
+		contentType string
+		body        string
+		want        int
+	}{
+		{method: http.MethodPost, path: "/api/v1/nodes", body: `{"name": "web1"}`, want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, path: "/api/v1/nodes", contentType: "text/plain", body: `{"name": "web1"}`, want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPost, path: "/api/v1/nodes", contentType: "application/json; charset=utf-8", body: `{"name": "web1"}`, want: http.StatusCreated},
+		{method: http.MethodPost, path: "/api/v1/runs", contentType: "application/yaml", body: `{}`, want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPut, path: "/api/v1/modules/web", contentType: "application/x-www-form-urlencoded", body: testModule, want: http.StatusUnsupportedMediaType},
+		{method: http.MethodPut, path: "/api/v1/modules/web", contentType: "application/yaml", body: testModule, want: http.StatusOK},
+		{method: http.MethodGet, path: "/api/v1/nodes", want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+		if tt.contentType != "" {
+			req.Header.Set("Content-Type", tt.contentType)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		if rec.Code != tt.want {
+			t.Errorf("%s %s as %q = %d, want %d: %s", tt.method, tt.path, tt.contentType, rec.Code, tt.want, rec.Body.String())
+		}
+	}
+}
+
+func TestServer_RecoverRuns(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	interrupted := newRun(RunRequest{Action: ActionApply, Module: "web", Inventory: "prod"}, time.Now())
+	interrupted.Status = RunRunning
+	if err := s.store.SaveRun(interrupted); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.recoverRuns(); err != nil {
+		t.Fatal(err)
+	}
+	run, err := s.store.Run(interrupted.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.Status != RunFailed || run.Error == "" {
+		t.Errorf("run = %+v, want failed", run)
+	}
+}
+
+func TestMigrations(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"modules/web.yaml":                   testModule,
+		"nodes/web1.json":                    `{"name": "web1", "address": "10.0.0.1"}`,
+		"runs/20240501T120000-aaaa0001.json": `{"id": "20240501T120000-aaaa0001", "status": "succeeded"}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		os.MkdirAll(filepath.Dir(path), 0755)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	s, err := NewServer(Config{Store: store.NewMemory(), Dir: dir}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if module, _, err := s.store.Module("web"); err != nil || module.Metadata.Name != "web" {
+		t.Errorf("module = %v, %v, want web imported", module, err)
+	}
+	if node, err := s.store.Node("web1"); err != nil || node.Address != "10.0.0.1" {
+		t.Errorf("node = %+v, %v, want web1 imported", node, err)
+	}
+	if runs, err := s.store.Runs(); err != nil || len(runs) != 1 {
+		t.Errorf("runs = %v, %v, want one imported", runs, err)
+	}
+}
+
+func TestServer_Health(t *testing.T) {
+	tracker := inventory.NewHealthTracker(inventory.DefaultHealthWindow)
+	tracker.Record("web1", true, time.Second)
+	s, err := NewServer(Config{Store: store.NewMemory(), Health: tracker}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var scores []inventory.HealthScore
+	if code := request(t, s.Handler(), http.MethodGet, "/api/inventory/health", "", &scores); code != http.StatusOK {
+		t.Fatalf("GET health = %d", code)
+	}
+	if len(scores) != 1 || scores[0].Host != "web1" {
+		t.Errorf("scores = %+v, want the tracker's", scores)
+	}
+}
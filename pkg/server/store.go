@@ -0,0 +1,453 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/agent"
+	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/store"
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultDir is where the server kept its state as files before it moved
+// to the controller store; the files are imported from there
+const DefaultDir = ".chisel/server"
+
+// ErrNotFound is returned for nodes, modules, inventories, runs and alerts
+// that do not exist
+var ErrNotFound = store.ErrNotFound
+
+// Buckets of the store, one per kind of object
+const (
+	kindNodes       = "nodes"
+	kindModules     = "modules"
+	kindInventories = "inventories"
+	kindRuns        = "runs"
+	kindSchedules   = "schedules"
+	kindAlerts      = "alerts"
+)
+
+// requestError marks errors caused by a name or document a client sent
+type requestError struct {
+	err error
+}
+
+func (e *requestError) Error() string { return e.err.Error() }
+func (e *requestError) Unwrap() error { return e.err }
+
+// namePattern restricts names to ones that are safe as keys and file names
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// Node is a machine registered with the server, directly or by an agent report
+type Node struct {
+	Name         string            `json:"name"`
+	Address      string            `json:"address,omitempty"`
+	Labels       map[string]string `json:"labels,omitempty"`
+	RegisteredAt time.Time         `json:"registered_at"`
+	LastSeen     time.Time         `json:"last_seen"`
+	// LastReport is the most recent run reported by the node's agent
+	LastReport *agent.Report `json:"last_report,omitempty"`
+}
+
+// Store keeps nodes and runs as JSON and modules and inventories as the
+// YAML they were uploaded as, in a bucket per kind of the controller store
+type Store struct {
+	kv store.Store
+	mu sync.Mutex
+	// changed is called after every write, when set
+	changed func()
+}
+
+// NewStore creates a server store backed by kv
+func NewStore(kv store.Store) *Store {
+	return &Store{kv: kv}
+}
+
+// Migrations upgrades the server state kept in a store; the first imports
+// the files the server kept in dir
+func Migrations(dir string) []store.Migration {
+	return []store.Migration{
+		{
+			Version:     1,
+			Description: "import server state kept in " + dir,
+			Up: func(kv store.Store) error {
+				return importDir(kv, dir)
+			},
+		},
+	}
+}
+
+// importDir copies the objects kept as files in a directory per kind into kv
+func importDir(kv store.Store, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	kinds := map[string]string{kindNodes: ".json", kindModules: ".yaml", kindInventories: ".yaml", kindRuns: ".json"}
+	for kind, ext := range kinds {
+		entries, err := os.ReadDir(filepath.Join(dir, kind))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filepath.Join(dir, kind), err)
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || !strings.HasSuffix(name, ext) {
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, kind, name))
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", name, err)
+			}
+			if err := kv.Put(kind, strings.TrimSuffix(name, ext), data); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateName checks that a name can be stored
+func validateName(kind, name string) error {
+	if !namePattern.MatchString(name) {
+		return &requestError{fmt.Errorf("invalid %s name %q: use letters, digits, '.', '_' and '-'", kind, name)}
+	}
+	return nil
+}
+
+// write stores an object
+func (s *Store) write(kind, name string, data []byte) error {
+	if err := s.kv.Put(kind, name, data); err != nil {
+		return fmt.Errorf("failed to write %s %s: %w", strings.TrimSuffix(kind, "s"), name, err)
+	}
+	if s.changed != nil {
+		s.changed()
+	}
+	return nil
+}
+
+// read loads an object, returning ErrNotFound when it does not exist
+func (s *Store) read(kind, name string) ([]byte, error) {
+	data, err := s.kv.Get(kind, name)
+	if errors.Is(err, store.ErrNotFound) {
+		return nil, fmt.Errorf("%s %s: %w", strings.TrimSuffix(kind, "s"), name, ErrNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s %s: %w", kind, name, err)
+	}
+	return data, nil
+}
+
+// remove deletes an object
+func (s *Store) remove(kind, name string) error {
+	err := s.kv.Delete(kind, name)
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("%s %s: %w", strings.TrimSuffix(kind, "s"), name, ErrNotFound)
+	}
+	if err == nil && s.changed != nil {
+		s.changed()
+	}
+	return err
+}
+
+// names lists the objects of a kind in sorted order
+func (s *Store) names(kind string) ([]string, error) {
+	names, err := s.kv.Keys(kind)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s store: %w", kind, err)
+	}
+	return names, nil
+}
+
+// SaveNode registers or updates a node
+func (s *Store) SaveNode(node *Node) error {
+	if err := validateName("node", node.Name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(node, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode node: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(kindNodes, node.Name, data)
+}
+
+// Node returns a registered node
+func (s *Store) Node(name string) (*Node, error) {
+	if err := validateName("node", name); err != nil {
+		return nil, err
+	}
+	data, err := s.read(kindNodes, name)
+	if err != nil {
+		return nil, err
+	}
+	var node Node
+	if err := json.Unmarshal(data, &node); err != nil {
+		return nil, fmt.Errorf("failed to parse node %s: %w", name, err)
+	}
+	return &node, nil
+}
+
+// Nodes returns every registered node, sorted by name
+func (s *Store) Nodes() ([]*Node, error) {
+	names, err := s.names(kindNodes)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]*Node, 0, len(names))
+	for _, name := range names {
+		node, err := s.Node(name)
+		if err != nil {
+			return nil, err
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
+
+// DeleteNode unregisters a node
+func (s *Store) DeleteNode(name string) error {
+	if err := validateName("node", name); err != nil {
+		return err
+	}
+	return s.remove(kindNodes, name)
+}
+
+// RecordReport stores an agent's run report, registering its node on first contact
+func (s *Store) RecordReport(report *agent.Report, now time.Time) (*Node, error) {
+	node, err := s.Node(report.Node)
+	if errors.Is(err, ErrNotFound) {
+		node, err = &Node{Name: report.Node, RegisteredAt: now}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	node.LastSeen = now
+	node.LastReport = report
+	if err := s.SaveNode(node); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// PutModule validates and stores a module under a name
+func (s *Store) PutModule(name string, data []byte) (*core.Module, error) {
+	if err := validateName("module", name); err != nil {
+		return nil, err
+	}
+	module, err := parseModule(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.write(kindModules, name, data); err != nil {
+		return nil, err
+	}
+	return module, nil
+}
+
+// Module returns a stored module and the YAML it was uploaded as
+func (s *Store) Module(name string) (*core.Module, []byte, error) {
+	if err := validateName("module", name); err != nil {
+		return nil, nil, err
+	}
+	data, err := s.read(kindModules, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	module, err := parseModule(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("module %s: %w", name, err)
+	}
+	return module, data, nil
+}
+
+// ModuleNames lists the stored modules
+func (s *Store) ModuleNames() ([]string, error) {
+	return s.names(kindModules)
+}
+
+// DeleteModule removes a stored module
+func (s *Store) DeleteModule(name string) error {
+	if err := validateName("module", name); err != nil {
+		return err
+	}
+	return s.remove(kindModules, name)
+}
+
+// PutInventory validates and stores an inventory under a name
+func (s *Store) PutInventory(name string, data []byte) (*inventory.Inventory, error) {
+	if err := validateName("inventory", name); err != nil {
+		return nil, err
+	}
+	inv, err := parseInventory(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.write(kindInventories, name, data); err != nil {
+		return nil, err
+	}
+	return inv, nil
+}
+
+// Inventory returns a stored inventory and the YAML it was uploaded as
+func (s *Store) Inventory(name string) (*inventory.Inventory, []byte, error) {
+	if err := validateName("inventory", name); err != nil {
+		return nil, nil, err
+	}
+	data, err := s.read(kindInventories, name)
+	if err != nil {
+		return nil, nil, err
+	}
+	inv, err := parseInventory(data)
+	if err != nil {
+		return nil, nil, fmt.Errorf("inventory %s: %w", name, err)
+	}
+	return inv, data, nil
+}
+
+// InventoryNames lists the stored inventories
+func (s *Store) InventoryNames() ([]string, error) {
+	return s.names(kindInventories)
+}
+
+// DeleteInventory removes a stored inventory
+func (s *Store) DeleteInventory(name string) error {
+	if err := validateName("inventory", name); err != nil {
+		return err
+	}
+	return s.remove(kindInventories, name)
+}
+
+// SaveRun records a run
+func (s *Store) SaveRun(run *Run) error {
+	data, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode run: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(kindRuns, run.ID, data)
+}
+
+// Run returns a recorded run
+func (s *Store) Run(id string) (*Run, error) {
+	if err := validateName("run", id); err != nil {
+		return nil, err
+	}
+	data, err := s.read(kindRuns, id)
+	if err != nil {
+		return nil, err
+	}
+	var run Run
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+// Runs returns every recorded run, most recent first
+func (s *Store) Runs() ([]*Run, error) {
+	ids, err := s.names(kindRuns)
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]*Run, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		run, err := s.Run(ids[i])
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// SaveSchedule stores a schedule
+func (s *Store) SaveSchedule(schedule *Schedule) error {
+	if err := validateName("schedule", schedule.Name); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(schedule, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedule: %w", err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.write(kindSchedules, schedule.Name, data)
+}
+
+// Schedule returns a stored schedule
+func (s *Store) Schedule(name string) (*Schedule, error) {
+	if err := validateName("schedule", name); err != nil {
+		return nil, err
+	}
+	data, err := s.read(kindSchedules, name)
+	if err != nil {
+		return nil, err
+	}
+	var schedule Schedule
+	if err := json.Unmarshal(data, &schedule); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule %s: %w", name, err)
+	}
+	return &schedule, nil
+}
+
+// Schedules returns every stored schedule, sorted by name
+func (s *Store) Schedules() ([]*Schedule, error) {
+	names, err := s.names(kindSchedules)
+	if err != nil {
+		return nil, err
+	}
+	schedules := make([]*Schedule, 0, len(names))
+	for _, name := range names {
+		schedule, err := s.Schedule(name)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, schedule)
+	}
+	return schedules, nil
+}
+
+// DeleteSchedule removes a stored schedule
+func (s *Store) DeleteSchedule(name string) error {
+	if err := validateName("schedule", name); err != nil {
+		return err
+	}
+	return s.remove(kindSchedules, name)
+}
+
+// parseModule parses and validates a module document
+func parseModule(data []byte) (*core.Module, error) {
+	var module core.Module
+	if err := yaml.Unmarshal(data, &module); err != nil {
+		return nil, &requestError{fmt.Errorf("failed to parse module: %w", err)}
+	}
+	if err := module.Validate(); err != nil {
+		return nil, &requestError{fmt.Errorf("invalid module: %w", err)}
+	}
+	return &module, nil
+}
+
+// parseInventory parses and validates an inventory document
+func parseInventory(data []byte) (*inventory.Inventory, error) {
+	var inv inventory.Inventory
+	if err := yaml.Unmarshal(data, &inv); err != nil {
+		return nil, &requestError{fmt.Errorf("failed to parse inventory: %w", err)}
+	}
+	if err := inv.Validate(); err != nil {
+		return nil, &requestError{fmt.Errorf("invalid inventory: %w", err)}
+	}
+	return &inv, nil
+}
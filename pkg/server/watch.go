@@ -0,0 +1,283 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	driftpkg "github.com/ataiva-software/forge/pkg/drift"
+	"github.com/ataiva-software/forge/pkg/history"
+)
+
+// maxNotices is how many recent notices the server keeps
+const maxNotices = 100
+
+// Notice levels
+const (
+	NoticeInfo    = "info"
+	NoticeWarning = "warning"
+	NoticeError   = "error"
+)
+
+// Notice is something that happened on the server worth telling the people
+// watching it, such as a run finishing or drift being found. Notices are
+// kept in memory and lost when the server restarts.
+type Notice struct {
+	Time  time.Time `json:"time"`
+	Level string    `json:"level"`
+	// Module is the name in the module's metadata, empty for notices about
+	// every module
+	Module  string `json:"module,omitempty"`
+	Message string `json:"message"`
+}
+
+// Status is what forge watch shows of a module: the drift of its hosts,
+// its runs in progress, its unresolved alerts and the recent notices about it
+type Status struct {
+	Module  string              `json:"module"`
+	Drift   []history.HostDrift `json:"drift"`
+	Active  []*Run              `json:"active"`
+	Alerts  []*Alert            `json:"alerts"`
+	Notices []Notice            `json:"notices"`
+	Time    time.Time           `json:"time"`
+}
+
+// watchers are the status streams open on the server, each woken through
+// its channel when something it shows may have changed
+type watchers struct {
+	mu       sync.Mutex
+	channels map[chan struct{}]bool
+}
+
+// add opens a stream's channel
+func (w *watchers) add() chan struct{} {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.channels == nil {
+		w.channels = make(map[chan struct{}]bool)
+	}
+	changes := make(chan struct{}, 1)
+	w.channels[changes] = true
+	return changes
+}
+
+// remove closes a stream's channel
+func (w *watchers) remove(changes chan struct{}) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	delete(w.channels, changes)
+}
+
+// wake tells every stream to send the status again. A stream still busy
+// with the last change sees this one along with it.
+func (w *watchers) wake() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for changes := range w.channels {
+		select {
+		case changes <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// notify records a notice, dropping the oldest past maxNotices
+func (s *Server) notify(level, module, format string, args ...interface{}) {
+	s.noticesMu.Lock()
+	s.notices = append(s.notices, Notice{Time: s.now(), Level: level, Module: module, Message: fmt.Sprintf(format, args...)})
+	if len(s.notices) > maxNotices {
+		s.notices = s.notices[len(s.notices)-maxNotices:]
+	}
+	s.noticesMu.Unlock()
+	s.watchers.wake()
+}
+
+// Notices returns the recent notices about a module, or every notice when
+// module is empty, most recent first
+func (s *Server) Notices(module string) []Notice {
+	s.noticesMu.Lock()
+	defer s.noticesMu.Unlock()
+	notices := make([]Notice, 0)
+	for i := len(s.notices) - 1; i >= 0; i-- {
+		notice := s.notices[i]
+		if module == "" || notice.Module == "" || notice.Module == module {
+			notices = append(notices, notice)
+		}
+	}
+	return notices
+}
+
+// Status returns the status of a module, named by its metadata or by the
+// name it is stored under
+func (s *Server) Status(module string) (*Status, error) {
+	// Runs name the stored module, executions the module's metadata
+	stored := map[string]bool{module: true}
+	names, err := s.store.ModuleNames()
+	if err != nil {
+		return nil, err
+	}
+	modules := make(map[string]string, len(names))
+	for _, name := range names {
+		if parsed, _, err := s.store.Module(name); err == nil {
+			modules[name] = parsed.Metadata.Name
+		}
+	}
+	if metadataName, ok := modules[module]; ok {
+		module = metadataName
+	}
+	for name, metadataName := range modules {
+		if metadataName == module {
+			stored[name] = true
+		}
+	}
+
+	status := &Status{Module: module, Active: make([]*Run, 0), Time: s.now()}
+	runs, err := s.store.Runs()
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if stored[run.Module] && (run.Status == RunQueued || run.Status == RunRunning) {
+			status.Active = append(status.Active, run)
+		}
+	}
+	if status.Drift, err = s.drift(module); err != nil {
+		return nil, err
+	}
+	if status.Alerts, err = s.Alerts(AlertUnresolved, module); err != nil {
+		return nil, err
+	}
+	status.Notices = s.Notices(module)
+	return status, nil
+}
+
+// drift returns the drift of a module's hosts from the recorded executions
+func (s *Server) drift(module string) ([]history.HostDrift, error) {
+	executions, err := history.NewStore(s.config.Store).List()
+	if err != nil {
+		return nil, err
+	}
+	drift := history.Drift(executions, module)
+	if drift == nil {
+		drift = make([]history.HostDrift, 0)
+	}
+	return drift, nil
+}
+
+// notifyDrift tells watchers and the drift channels about the hosts a run
+// left drifted, and keeps an alert open for each until a run finds it in sync
+func (s *Server) notifyDrift(ctx context.Context, run *Run, module string) {
+	drift, err := s.drift(module)
+	if err != nil {
+		s.logger.Printf("run %s: %v", run.ID, err)
+		return
+	}
+	var drifted []string
+	report := &driftpkg.DriftReport{ModuleName: module, Timestamp: s.now(), Results: make([]driftpkg.DriftResult, 0)}
+	for _, hostDrift := range drift {
+		if hostDrift.CheckedAt.Before(*run.StartedAt) {
+			continue
+		}
+		report.TotalChecked++
+		condition := "drift/" + module + "/" + hostDrift.Host
+		if hostDrift.Drifted() {
+			drifted = append(drifted, hostDrift.Host)
+			report.DriftDetected++
+			for _, resource := range hostDrift.Resources {
+				report.Results = append(report.Results, driftpkg.DriftResult{ResourceID: hostDrift.Host + "/" + resource, HasDrift: true, LastChecked: hostDrift.CheckedAt})
+			}
+			s.raise(condition, NoticeWarning, module, fmt.Sprintf("%s drifted on %s: %s", module, hostDrift.Host, strings.Join(hostDrift.Resources, ", ")))
+		} else {
+			s.clear(condition, fmt.Sprintf("%s is in sync as of run %s", hostDrift.Host, run.ID))
+		}
+	}
+	if len(drifted) > 0 {
+		s.notify(NoticeWarning, module, "drift on %d host(s): %s", len(drifted), strings.Join(drifted, ", "))
+	}
+	if report.TotalChecked > 0 {
+		report.Duration = report.Timestamp.Sub(*run.StartedAt)
+		if err := s.driftHistory.RecordReport(report); err != nil {
+			s.logger.Printf("run %s: %v", run.ID, err)
+		}
+		if err := s.driftNotifier.Notify(ctx, report); err != nil {
+			s.logger.Printf("run %s: %v", run.ID, err)
+		}
+	}
+}
+
+// DriftHistory returns the recent drift reports of a module, or of every
+// module when module is empty, most recent first
+func (s *Server) DriftHistory(module string) []*driftpkg.DriftReport {
+	reports := s.driftHistory.GetRecentReports(0)
+	history := make([]*driftpkg.DriftReport, 0, len(reports))
+	for i := len(reports) - 1; i >= 0; i-- {
+		if module == "" || reports[i].ModuleName == module {
+			history = append(history, reports[i])
+		}
+	}
+	return history
+}
+
+func (s *Server) handleDriftHistory(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, s.DriftHistory(r.URL.Query().Get("module")))
+}
+
+func (s *Server) handleStatus(w http.ResponseWriter, r *http.Request) {
+	module := r.URL.Query().Get("module")
+	if module == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("module is required"))
+		return
+	}
+	status, err := s.Status(module)
+	if err != nil {
+		writeError(w, statusFor(err), err)
+		return
+	}
+	writeJSON(w, http.StatusOK, status)
+}
+
+// handleStatusStream sends the status of a module as server-sent events:
+// once when the stream opens and again whenever runs, alerts or notices
+// change, until the client goes away or the server stops
+func (s *Server) handleStatusStream(w http.ResponseWriter, r *http.Request) {
+	module := r.URL.Query().Get("module")
+	if module == "" {
+		writeError(w, http.StatusBadRequest, fmt.Errorf("module is required"))
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, fmt.Errorf("streaming is not supported"))
+		return
+	}
+	changes := s.watchers.add()
+	defer s.watchers.remove(changes)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	for {
+		status, err := s.Status(module)
+		if err != nil {
+			fmt.Fprintf(w, "event: error\ndata: %s\n\n", strings.ReplaceAll(err.Error(), "\n", " "))
+			flusher.Flush()
+			return
+		}
+		data, err := json.Marshal(status)
+		if err != nil {
+			return
+		}
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		flusher.Flush()
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-changes:
+		}
+	}
+}
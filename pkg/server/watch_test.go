@@ -0,0 +1,152 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/core"
+	driftpkg "github.com/ataiva-software/forge/pkg/drift"
+	"github.com/ataiva-software/forge/pkg/executor"
+	"github.com/ataiva-software/forge/pkg/history"
+	"github.com/ataiva-software/forge/pkg/store"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+func TestServer_Status(t *testing.T) {
+	kv := store.NewMemory()
+	// Plans record the drift of the hosts they reach as executions
+	run := func(ctx context.Context, job Job) error {
+		execution := history.NewExecution(job.Module.Metadata.Name, "")
+		execution.AddReport(history.PhasePlan, &executor.RunReport{Hosts: []executor.HostResult{
+			{Host: "web1", Status: executor.HostSucceeded, StartTime: time.Now(), EndTime: time.Now()},
+		}}, nil)
+		execution.AddPlan("web1", &core.Plan{Changes: []core.Change{
+			{Action: core.ActionUpdate, Resource: types.Resource{Type: "pkg", Name: "nginx"}},
+		}}, time.Now())
+		execution.Finish("succeeded")
+		return history.NewStore(kv).Save(execution)
+	}
+	channel := &recordingChannel{}
+	s, err := NewServer(Config{Store: kv, DriftChannels: []driftpkg.NotificationChannel{channel}}, run, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+
+	// The module is stored as site, but named web
+	request(t, handler, http.MethodPut, "/api/v1/modules/site", testModule, nil)
+	request(t, handler, http.MethodPut, "/api/v1/inventories/prod", testInventory, nil)
+	var checked Run
+	request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "plan", "module": "site", "inventory": "prod"}`, &checked)
+	s.execute(context.Background(), <-s.queue)
+	var queued Run
+	request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "apply", "module": "site", "inventory": "prod"}`, &queued)
+	request(t, handler, http.MethodPost, "/api/v1/reports", `{"node": "db1", "status": "failed", "error": "timeout"}`, nil)
+
+	if len(channel.reports) != 1 || channel.reports[0].ModuleName != "web" || channel.reports[0].DriftDetected != 1 {
+		t.Errorf("drift channel was sent %+v, want the plan's drift", channel.reports)
+	}
+
+	for _, module := range []string{"web", "site"} {
+		var status Status
+		if code := request(t, handler, http.MethodGet, "/api/v1/status?module="+module, "", &status); code != http.StatusOK {
+			t.Fatalf("GET status = %d", code)
+		}
+		if status.Module != "web" {
+			t.Errorf("%s: module = %q, want web", module, status.Module)
+		}
+		if len(status.Drift) != 1 || status.Drift[0].Host != "web1" || strings.Join(status.Drift[0].Resources, ",") != "pkg.nginx" {
+			t.Errorf("%s: drift = %+v", module, status.Drift)
+		}
+		if len(status.Active) != 1 || status.Active[0].ID != queued.ID {
+			t.Errorf("%s: active = %+v, want the queued apply", module, status.Active)
+		}
+		var messages []string
+		for _, notice := range status.Notices {
+			messages = append(messages, notice.Level+": "+notice.Message)
+		}
+		want := []string{
+			"error: node db1 reported a failed run: timeout",
+			"warning: drift on 1 host(s): web1",
+			"info: plan run " + checked.ID + " succeeded",
+			"info: plan run " + checked.ID + " started on prod",
+		}
+		if strings.Join(messages, "\n") != strings.Join(want, "\n") {
+			t.Errorf("%s: notices =\n%s\nwant\n%s", module, strings.Join(messages, "\n"), strings.Join(want, "\n"))
+		}
+	}
+
+	var other Status
+	request(t, handler, http.MethodGet, "/api/v1/status?module=db", "", &other)
+	if len(other.Drift) != 0 || len(other.Active) != 0 || len(other.Notices) != 1 {
+		t.Errorf("status of another module = %+v", other)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/status", "", nil); code != http.StatusBadRequest {
+		t.Errorf("GET status without a module = %d, want 400", code)
+	}
+}
+
+func TestClient_WatchStatus(t *testing.T) {
+	s, err := NewServer(Config{Store: store.NewMemory()}, func(context.Context, Job) error { return nil }, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := s.Handler()
+	request(t, handler, http.MethodPut, "/api/v1/modules/site", testModule, nil)
+	request(t, handler, http.MethodPut, "/api/v1/inventories/prod", testInventory, nil)
+	ts := httptest.NewServer(handler)
+	defer ts.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	statuses := make(chan *Status, 16)
+	done := make(chan error, 1)
+	go func() {
+		done <- NewClient(ts.URL, "").WatchStatus(ctx, "web", func(status *Status) { statuses <- status })
+	}()
+	next := func() *Status {
+		t.Helper()
+		select {
+		case status := <-statuses:
+			return status
+		case <-time.After(5 * time.Second):
+			t.Fatal("no status was streamed")
+			return nil
+		}
+	}
+
+	if status := next(); status.Module != "web" || len(status.Active) != 0 {
+		t.Fatalf("first status = %+v, want web with no runs", status)
+	}
+	// Queueing a run is streamed without asking again
+	var queued Run
+	request(t, handler, http.MethodPost, "/api/v1/runs", `{"action": "apply", "module": "site", "inventory": "prod"}`, &queued)
+	if status := next(); len(status.Active) != 1 || status.Active[0].ID != queued.ID {
+		t.Errorf("status after queueing = %+v, want the queued apply", status.Active)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Errorf("WatchStatus() after cancelling = %v", err)
+	}
+	if code := request(t, handler, http.MethodGet, "/api/v1/status/stream", "", nil); code != http.StatusBadRequest {
+		t.Errorf("GET status stream without a module = %d, want 400", code)
+	}
+}
+
+// recordingChannel keeps the drift reports it is sent
+type recordingChannel struct {
+	reports []*driftpkg.DriftReport
+}
+
+func (c *recordingChannel) Send(ctx context.Context, report *driftpkg.DriftReport) error {
+	c.reports = append(c.reports, report)
+	return nil
+}
+
+func (c *recordingChannel) Type() string { return "recording" }
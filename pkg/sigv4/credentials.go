@@ -0,0 +1,166 @@
+package sigv4
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ProfileCredentials returns the credentials of a profile in the shared
+// credentials file, AWS_SHARED_CREDENTIALS_FILE or ~/.aws/credentials. The
+// profile defaults to AWS_PROFILE, then default.
+func ProfileCredentials(profile string) (Credentials, error) {
+	if profile == "" {
+		profile = os.Getenv("AWS_PROFILE")
+	}
+	if profile == "" {
+		profile = "default"
+	}
+	path := os.Getenv("AWS_SHARED_CREDENTIALS_FILE")
+	if path == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return Credentials{}, fmt.Errorf("failed to find the AWS credentials file: %w", err)
+		}
+		path = filepath.Join(home, ".aws", "credentials")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Credentials{}, fmt.Errorf("failed to read AWS credentials: %w", err)
+	}
+
+	var credentials Credentials
+	found := false
+	section := ""
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			found = found || section == profile
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || section != profile {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "aws_access_key_id":
+			credentials.AccessKey = value
+		case "aws_secret_access_key":
+			credentials.SecretKey = value
+		case "aws_session_token":
+			credentials.SessionToken = value
+		}
+	}
+	if !found {
+		return Credentials{}, fmt.Errorf("no AWS profile %s in %s", profile, path)
+	}
+	if credentials.AccessKey == "" || credentials.SecretKey == "" {
+		return Credentials{}, fmt.Errorf("AWS profile %s in %s has no aws_access_key_id and aws_secret_access_key", profile, path)
+	}
+	return credentials, nil
+}
+
+// FindCredentials returns the credentials of a profile when one is named,
+// otherwise those in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, then those
+// of the AWS_PROFILE or default profile
+func FindCredentials(profile string) (Credentials, error) {
+	if profile != "" {
+		return ProfileCredentials(profile)
+	}
+	if credentials := EnvCredentials(); credentials.AccessKey != "" && credentials.SecretKey != "" {
+		return credentials, nil
+	}
+	credentials, err := ProfileCredentials("")
+	if err != nil {
+		return Credentials{}, fmt.Errorf("no AWS credentials in AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY: %w", err)
+	}
+	return credentials, nil
+}
+
+// RoleRequest names a role to assume and how
+type RoleRequest struct {
+	ARN string
+	// ExternalID is required by roles that third parties assume
+	ExternalID string
+	// SessionName shows in CloudTrail, forge by default
+	SessionName string
+	// Endpoint is the base URL of STS, https://sts.<region>.amazonaws.com
+	// by default
+	Endpoint string
+}
+
+// AssumeRole asks STS for temporary credentials of a role, signing the
+// request with credentials, and returns them with when they expire
+func AssumeRole(ctx context.Context, client *http.Client, credentials Credentials, region string, role RoleRequest, now time.Time) (Credentials, time.Time, error) {
+	if role.SessionName == "" {
+		role.SessionName = "forge"
+	}
+	if role.Endpoint == "" {
+		role.Endpoint = "https://sts." + region + ".amazonaws.com"
+	}
+	form := url.Values{
+		"Action":          {"AssumeRole"},
+		"Version":         {"2011-06-15"},
+		"RoleArn":         {role.ARN},
+		"RoleSessionName": {role.SessionName},
+	}
+	if role.ExternalID != "" {
+		form.Set("ExternalId", role.ExternalID)
+	}
+	body := []byte(form.Encode())
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimSuffix(role.Endpoint, "/")+"/", bytes.NewReader(body))
+	if err != nil {
+		return Credentials{}, time.Time{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	Sign(req, body, credentials, region, "sts", now)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to assume role %s: %w", role.ARN, err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to assume role %s: %w", role.ARN, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		var failure struct {
+			Code    string `xml:"Error>Code"`
+			Message string `xml:"Error>Message"`
+		}
+		if xml.Unmarshal(data, &failure) == nil && failure.Code != "" {
+			return Credentials{}, time.Time{}, fmt.Errorf("failed to assume role %s: %s: %s", role.ARN, failure.Code, failure.Message)
+		}
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to assume role %s: STS returned %s", role.ARN, resp.Status)
+	}
+
+	var result struct {
+		AccessKey    string    `xml:"AssumeRoleResult>Credentials>AccessKeyId"`
+		SecretKey    string    `xml:"AssumeRoleResult>Credentials>SecretAccessKey"`
+		SessionToken string    `xml:"AssumeRoleResult>Credentials>SessionToken"`
+		Expiration   time.Time `xml:"AssumeRoleResult>Credentials>Expiration"`
+	}
+	if err := xml.Unmarshal(data, &result); err != nil {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to parse the credentials of role %s: %w", role.ARN, err)
+	}
+	if result.AccessKey == "" {
+		return Credentials{}, time.Time{}, fmt.Errorf("failed to assume role %s: no credentials in the response", role.ARN)
+	}
+	return Credentials{AccessKey: result.AccessKey, SecretKey: result.SecretKey, SessionToken: result.SessionToken}, result.Expiration, nil
+}
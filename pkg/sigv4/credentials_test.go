@@ -0,0 +1,109 @@
+package sigv4
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProfileCredentials(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "credentials")
+	os.WriteFile(path, []byte(`# shared credentials
+[default]
+aws_access_key_id = AKIADEFAULT
+aws_secret_access_key = default-secret
+
+[ops]
+aws_access_key_id=AKIAOPS
+aws_secret_access_key=ops-secret
+aws_session_token=ops-token
+
+[empty]
+region = eu-west-1
+`), 0600)
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", path)
+	t.Setenv("AWS_PROFILE", "")
+
+	tests := []struct {
+		name    string
+		profile string
+		env     string
+		want    Credentials
+		wantErr string
+	}{
+		{name: "default", want: Credentials{AccessKey: "AKIADEFAULT", SecretKey: "default-secret"}},
+		{name: "named", profile: "ops", want: Credentials{AccessKey: "AKIAOPS", SecretKey: "ops-secret", SessionToken: "ops-token"}},
+		{name: "from AWS_PROFILE", env: "ops", want: Credentials{AccessKey: "AKIAOPS", SecretKey: "ops-secret", SessionToken: "ops-token"}},
+		{name: "missing", profile: "prod", wantErr: "no AWS profile prod"},
+		{name: "without keys", profile: "empty", wantErr: "has no aws_access_key_id"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("AWS_PROFILE", tt.env)
+			got, err := ProfileCredentials(tt.profile)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ProfileCredentials error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ProfileCredentials = %+v, %v, want %+v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAssumeRole(t *testing.T) {
+	var form string
+	sts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm.Encode()
+		if !strings.Contains(r.Header.Get("Authorization"), "/us-west-2/sts/aws4_request") {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.PostForm.Get("RoleArn") != "arn:aws:iam::123456789012:role/forge" {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<ErrorResponse><Error><Code>AccessDenied</Code><Message>not authorized</Message></Error></ErrorResponse>`))
+			return
+		}
+		w.Write([]byte(`<AssumeRoleResponse xmlns="https://sts.amazonaws.com/doc/2011-06-15/">
+  <AssumeRoleResult>
+    <Credentials>
+      <AccessKeyId>ASIAROLE</AccessKeyId>
+      <SecretAccessKey>role-secret</SecretAccessKey>
+      <SessionToken>role-token</SessionToken>
+      <Expiration>2024-06-01T13:00:00Z</Expiration>
+    </Credentials>
+  </AssumeRoleResult>
+</AssumeRoleResponse>`))
+	}))
+	defer sts.Close()
+
+	base := Credentials{AccessKey: "AKIABASE", SecretKey: "base-secret"}
+	role := RoleRequest{ARN: "arn:aws:iam::123456789012:role/forge", ExternalID: "ops", Endpoint: sts.URL}
+	got, expires, err := AssumeRole(context.Background(), sts.Client(), base, "us-west-2", role, time.Now())
+	if err != nil {
+		t.Fatalf("AssumeRole: %v", err)
+	}
+	want := Credentials{AccessKey: "ASIAROLE", SecretKey: "role-secret", SessionToken: "role-token"}
+	if got != want || !expires.Equal(time.Date(2024, 6, 1, 13, 0, 0, 0, time.UTC)) {
+		t.Errorf("AssumeRole = %+v, %v", got, expires)
+	}
+	for _, part := range []string{"Action=AssumeRole", "ExternalId=ops", "RoleSessionName=forge"} {
+		if !strings.Contains(form, part) {
+			t.Errorf("request %s lacks %s", form, part)
+		}
+	}
+
+	role.ARN = "arn:aws:iam::123456789012:role/other"
+	if _, _, err := AssumeRole(context.Background(), sts.Client(), base, "us-west-2", role, time.Now()); err == nil || !strings.Contains(err.Error(), "AccessDenied: not authorized") {
+		t.Errorf("AssumeRole of a role not allowed = %v", err)
+	}
+}
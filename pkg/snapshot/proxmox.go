@@ -0,0 +1,107 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// proxmoxPollInterval is how often a snapshot task is checked for completion
+var proxmoxPollInterval = 2 * time.Second
+
+// proxmoxSnapshotter snapshots QEMU guests through the Proxmox VE API
+type proxmoxSnapshotter struct {
+	client *http.Client
+	url    string
+	node   string
+	token  string
+}
+
+func newProxmox(config *Config) *proxmoxSnapshotter {
+	return &proxmoxSnapshotter{
+		client: &http.Client{Timeout: 30 * time.Second},
+		url:    strings.TrimSuffix(config.URL, "/") + "/api2/json",
+		node:   config.Node,
+		token:  fmt.Sprintf("PVEAPIToken=%s=%s", config.TokenID, config.TokenSecret),
+	}
+}
+
+// Snapshot starts a snapshot task and waits for it to finish. The snapshot
+// name is its ID.
+func (s *proxmoxSnapshotter) Snapshot(ctx context.Context, vm, name string) (string, error) {
+	form := url.Values{"snapname": {name}, "description": {"Taken by forge before apply"}}
+	var task string
+	path := fmt.Sprintf("/nodes/%s/qemu/%s/snapshot", url.PathEscape(s.node), url.PathEscape(vm))
+	if err := s.do(ctx, http.MethodPost, path, form, &task); err != nil {
+		return "", err
+	}
+
+	statusPath := fmt.Sprintf("/nodes/%s/tasks/%s/status", url.PathEscape(s.node), url.PathEscape(task))
+	for {
+		var status struct {
+			Status     string `json:"status"`
+			ExitStatus string `json:"exitstatus"`
+		}
+		if err := s.do(ctx, http.MethodGet, statusPath, nil, &status); err != nil {
+			return "", err
+		}
+		if status.Status == "stopped" {
+			if status.ExitStatus != "OK" {
+				return "", fmt.Errorf("snapshot task %s failed: %s", task, status.ExitStatus)
+			}
+			return name, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(proxmoxPollInterval):
+		}
+	}
+}
+
+func (s *proxmoxSnapshotter) Restore(vm, id string) string {
+	return fmt.Sprintf("qm rollback %s %s (on node %s)", vm, id, s.node)
+}
+
+// do calls the API and decodes the data field of the response
+func (s *proxmoxSnapshotter) do(ctx context.Context, method, path string, form url.Values, data interface{}) error {
+	var body io.Reader
+	if form != nil {
+		body = strings.NewReader(form.Encode())
+	}
+	req, err := http.NewRequestWithContext(ctx, method, s.url+path, body)
+	if err != nil {
+		return fmt.Errorf("failed to create proxmox request: %w", err)
+	}
+	req.Header.Set("Authorization", s.token)
+	if form != nil {
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("proxmox request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("proxmox %s %s returned %s: %s", method, path, resp.Status, strings.TrimSpace(string(message)))
+	}
+	var envelope struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return fmt.Errorf("failed to decode proxmox response: %w", err)
+	}
+	if err := json.Unmarshal(envelope.Data, data); err != nil {
+		return fmt.Errorf("failed to decode proxmox response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+// Package snapshot takes snapshots of virtual machine targets before risky
+// applies, so a host can be rolled back quickly if a change goes wrong.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported snapshot providers
+const (
+	// ProviderCommand runs a command on the controller that prints the snapshot ID
+	ProviderCommand = "command"
+	// ProviderProxmox snapshots Proxmox VE guests through its API
+	ProviderProxmox = "proxmox"
+	// ProviderVSphere snapshots vSphere VMs with govc
+	ProviderVSphere = "vsphere"
+	// ProviderAWS snapshots the EBS volumes of EC2 instances with the aws CLI
+	ProviderAWS = "aws"
+)
+
+// Providers lists every snapshot provider
+var Providers = []string{ProviderCommand, ProviderProxmox, ProviderVSphere, ProviderAWS}
+
+const (
+	// DefaultThreshold is the plan risk score above which a host is
+	// snapshotted when its group does not set one
+	DefaultThreshold = 10
+	// DefaultTimeout bounds taking one snapshot
+	DefaultTimeout = 10 * time.Minute
+)
+
+// Config configures snapshots for the hosts of a target group
+type Config struct {
+	Provider string `yaml:"provider" json:"provider"`
+	// Threshold is the plan risk score above which a host is snapshotted
+	Threshold int `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	// VMs maps inventory hosts to the VM the provider knows them by: the
+	// Proxmox vmid, the vSphere inventory path or the EC2 instance ID.
+	// Hosts that are not listed use their name.
+	VMs     map[string]string `yaml:"vms,omitempty" json:"vms,omitempty"`
+	Timeout time.Duration     `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+
+	// Command is run with sh -c for the command provider. FORGE_VM and
+	// FORGE_SNAPSHOT are set in its environment, and the last line it prints
+	// is the snapshot ID.
+	Command string `yaml:"command,omitempty" json:"command,omitempty"`
+	// Restore is shown with recorded command snapshots as how to roll back
+	Restore string `yaml:"restore,omitempty" json:"restore,omitempty"`
+
+	// URL, Node, TokenID and TokenSecret reach the Proxmox VE API, such as
+	// https://pve1:8006 with the API token user@pam!forge
+	URL         string `yaml:"url,omitempty" json:"url,omitempty"`
+	Node        string `yaml:"node,omitempty" json:"node,omitempty"`
+	TokenID     string `yaml:"token_id,omitempty" json:"token_id,omitempty"`
+	TokenSecret string `yaml:"token_secret,omitempty" json:"token_secret,omitempty"`
+
+	// Region is the AWS region; the aws CLI default is used when empty
+	Region string `yaml:"region,omitempty" json:"region,omitempty"`
+}
+
+// Validate checks the snapshot configuration
+func (c *Config) Validate() error {
+	switch c.Provider {
+	case ProviderCommand:
+		if c.Command == "" {
+			return fmt.Errorf("snapshot provider command requires command")
+		}
+	case ProviderProxmox:
+		if c.URL == "" || c.Node == "" || c.TokenID == "" || c.TokenSecret == "" {
+			return fmt.Errorf("snapshot provider proxmox requires url, node, token_id and token_secret")
+		}
+	case ProviderVSphere, ProviderAWS:
+	default:
+		return fmt.Errorf("unknown snapshot provider '%s', must be one of: %s", c.Provider, strings.Join(Providers, ", "))
+	}
+	if c.Threshold < 0 {
+		return fmt.Errorf("snapshot threshold must not be negative")
+	}
+	return nil
+}
+
+// RiskThreshold returns the plan risk score above which hosts are snapshotted
+func (c *Config) RiskThreshold() int {
+	if c.Threshold > 0 {
+		return c.Threshold
+	}
+	return DefaultThreshold
+}
+
+// VM returns the VM a host is known by to the provider
+func (c *Config) VM(host string) string {
+	if vm, ok := c.VMs[host]; ok && vm != "" {
+		return vm
+	}
+	return host
+}
+
+// Snapshot records a snapshot taken of a host
+type Snapshot struct {
+	Host      string    `json:"host"`
+	Provider  string    `json:"provider"`
+	VM        string    `json:"vm"`
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Restore describes how to roll the host back to the snapshot
+	Restore string `json:"restore,omitempty"`
+}
+
+// Snapshotter takes snapshots with one provider
+type Snapshotter interface {
+	// Snapshot snapshots a VM under a name and returns the snapshot ID
+	Snapshot(ctx context.Context, vm, name string) (string, error)
+	// Restore describes how to roll a VM back to a snapshot
+	Restore(vm, id string) string
+}
+
+// New returns the snapshotter for a configuration
+func New(config *Config) (Snapshotter, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	switch config.Provider {
+	case ProviderCommand:
+		return &commandSnapshotter{command: config.Command, restore: config.Restore}, nil
+	case ProviderProxmox:
+		return newProxmox(config), nil
+	case ProviderVSphere:
+		return &vsphereSnapshotter{}, nil
+	default:
+		return &awsSnapshotter{region: config.Region}, nil
+	}
+}
+
+// Take snapshots a host with the configured provider
+func Take(ctx context.Context, config *Config, host, name string) (*Snapshot, error) {
+	snapshotter, err := New(config)
+	if err != nil {
+		return nil, err
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	vm := config.VM(host)
+	id, err := snapshotter.Snapshot(ctx, vm, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to snapshot %s: %w", host, err)
+	}
+	return &Snapshot{
+		Host:      host,
+		Provider:  config.Provider,
+		VM:        vm,
+		ID:        id,
+		CreatedAt: time.Now(),
+		Restore:   snapshotter.Restore(vm, id),
+	}, nil
+}
+
+// runCommand runs a program on the controller and returns what it printed.
+// It is a variable so tests can stand in for the provider CLIs.
+var runCommand = func(ctx context.Context, env []string, name string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Env = append(os.Environ(), env...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("%s: %w: %s", name, err, message)
+		}
+		return "", fmt.Errorf("%s: %w", name, err)
+	}
+	return stdout.String(), nil
+}
+
+// lastLine returns the last non-empty line of output
+func lastLine(output string) string {
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	return strings.TrimSpace(lines[len(lines)-1])
+}
+
+// commandSnapshotter runs a user supplied command
+type commandSnapshotter struct {
+	command string
+	restore string
+}
+
+func (s *commandSnapshotter) Snapshot(ctx context.Context, vm, name string) (string, error) {
+	env := []string{"FORGE_VM=" + vm, "FORGE_SNAPSHOT=" + name}
+	output, err := runCommand(ctx, env, "sh", "-c", s.command)
+	if err != nil {
+		return "", err
+	}
+	if id := lastLine(output); id != "" {
+		return id, nil
+	}
+	return name, nil
+}
+
+func (s *commandSnapshotter) Restore(vm, id string) string {
+	if s.restore == "" {
+		return ""
+	}
+	return strings.NewReplacer("$FORGE_VM", vm, "$FORGE_SNAPSHOT", id).Replace(s.restore)
+}
+
+// vsphereSnapshotter uses govc, which reads the vCenter address and
+// credentials from GOVC_URL, GOVC_USERNAME and GOVC_PASSWORD
+type vsphereSnapshotter struct{}
+
+func (s *vsphereSnapshotter) Snapshot(ctx context.Context, vm, name string) (string, error) {
+	if _, err := runCommand(ctx, nil, "govc", "snapshot.create", "-vm", vm, name); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func (s *vsphereSnapshotter) Restore(vm, id string) string {
+	return fmt.Sprintf("govc snapshot.revert -vm %s %s", vm, id)
+}
+
+// awsSnapshotter snapshots every EBS volume of an instance with the aws CLI
+type awsSnapshotter struct {
+	region string
+}
+
+func (s *awsSnapshotter) Snapshot(ctx context.Context, vm, name string) (string, error) {
+	args := []string{"ec2", "create-snapshots",
+		"--instance-specification", "InstanceId=" + vm,
+		"--description", name,
+		"--query", "Snapshots[].SnapshotId",
+		"--output", "text"}
+	if s.region != "" {
+		args = append(args, "--region", s.region)
+	}
+	output, err := runCommand(ctx, nil, "aws", args...)
+	if err != nil {
+		return "", err
+	}
+	ids := strings.Fields(output)
+	if len(ids) == 0 {
+		return "", fmt.Errorf("aws returned no snapshot IDs for %s", vm)
+	}
+	return strings.Join(ids, ","), nil
+}
+
+func (s *awsSnapshotter) Restore(vm, id string) string {
+	return fmt.Sprintf("create volumes from %s and swap them into %s", id, vm)
+}
@@ -0,0 +1,167 @@
+package snapshot
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  Config
+		wantErr bool
+	}{
+		{name: "command", config: Config{Provider: ProviderCommand, Command: "echo snap-1"}},
+		{name: "command without command", config: Config{Provider: ProviderCommand}, wantErr: true},
+		{name: "proxmox", config: Config{Provider: ProviderProxmox, URL: "https://pve:8006", Node: "pve1", TokenID: "root@pam!forge", TokenSecret: "s"}},
+		{name: "proxmox without token", config: Config{Provider: ProviderProxmox, URL: "https://pve:8006", Node: "pve1"}, wantErr: true},
+		{name: "vsphere", config: Config{Provider: ProviderVSphere}},
+		{name: "aws", config: Config{Provider: ProviderAWS, Region: "eu-west-1"}},
+		{name: "unknown provider", config: Config{Provider: "xen"}, wantErr: true},
+		{name: "negative threshold", config: Config{Provider: ProviderAWS, Threshold: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTake_Command(t *testing.T) {
+	config := &Config{
+		Provider: ProviderCommand,
+		Command:  `echo "creating $FORGE_SNAPSHOT"; echo "$FORGE_VM@$FORGE_SNAPSHOT"`,
+		Restore:  "restore-vm $FORGE_VM $FORGE_SNAPSHOT",
+		VMs:      map[string]string{"web1": "vm-101"},
+	}
+
+	snapshot, err := Take(context.Background(), config, "web1", "forge-1")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if snapshot.Host != "web1" || snapshot.VM != "vm-101" || snapshot.ID != "vm-101@forge-1" {
+		t.Errorf("Take() = %+v", snapshot)
+	}
+	if snapshot.Restore != "restore-vm vm-101 vm-101@forge-1" {
+		t.Errorf("Restore = %q", snapshot.Restore)
+	}
+
+	config.Command = "echo failed >&2; exit 3"
+	if _, err := Take(context.Background(), config, "web1", "forge-1"); err == nil || !strings.Contains(err.Error(), "failed") {
+		t.Errorf("Expected the command error, got %v", err)
+	}
+}
+
+func TestTake_CLIs(t *testing.T) {
+	var calls [][]string
+	original := runCommand
+	runCommand = func(ctx context.Context, env []string, name string, args ...string) (string, error) {
+		calls = append(calls, append([]string{name}, args...))
+		if name == "aws" {
+			return "snap-0a1\tsnap-0b2\n", nil
+		}
+		return "", nil
+	}
+	defer func() { runCommand = original }()
+
+	tests := []struct {
+		name     string
+		config   Config
+		wantID   string
+		wantCall []string
+	}{
+		{
+			name:     "vsphere",
+			config:   Config{Provider: ProviderVSphere, VMs: map[string]string{"web1": "/dc/vm/web1"}},
+			wantID:   "forge-1",
+			wantCall: []string{"govc", "snapshot.create", "-vm", "/dc/vm/web1", "forge-1"},
+		},
+		{
+			name:   "aws",
+			config: Config{Provider: ProviderAWS, Region: "eu-west-1", VMs: map[string]string{"web1": "i-0abc"}},
+			wantID: "snap-0a1,snap-0b2",
+			wantCall: []string{"aws", "ec2", "create-snapshots", "--instance-specification", "InstanceId=i-0abc",
+				"--description", "forge-1", "--query", "Snapshots[].SnapshotId", "--output", "text", "--region", "eu-west-1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = nil
+			snapshot, err := Take(context.Background(), &tt.config, "web1", "forge-1")
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if snapshot.ID != tt.wantID {
+				t.Errorf("ID = %q, want %q", snapshot.ID, tt.wantID)
+			}
+			if len(calls) != 1 || !reflect.DeepEqual(calls[0], tt.wantCall) {
+				t.Errorf("calls = %v, want %v", calls, tt.wantCall)
+			}
+		})
+	}
+}
+
+func TestTake_Proxmox(t *testing.T) {
+	proxmoxPollInterval = time.Millisecond
+	defer func() { proxmoxPollInterval = 2 * time.Second }()
+
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "PVEAPIToken=root@pam!forge=secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		switch {
+		case r.Method == http.MethodPost && r.URL.Path == "/api2/json/nodes/pve1/qemu/101/snapshot":
+			r.ParseForm()
+			if r.PostForm.Get("snapname") != "forge-1" {
+				t.Errorf("snapname = %q", r.PostForm.Get("snapname"))
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": "UPID:pve1:0001"})
+		case r.Method == http.MethodGet && r.URL.Path == "/api2/json/nodes/pve1/tasks/UPID:pve1:0001/status":
+			polls++
+			status := map[string]string{"status": "running"}
+			if polls > 1 {
+				status = map[string]string{"status": "stopped", "exitstatus": "OK"}
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{"data": status})
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+
+	config := &Config{
+		Provider:    ProviderProxmox,
+		URL:         server.URL,
+		Node:        "pve1",
+		TokenID:     "root@pam!forge",
+		TokenSecret: "secret",
+		VMs:         map[string]string{"db1": "101"},
+	}
+	snapshot, err := Take(context.Background(), config, "db1", "forge-1")
+	if err != nil {
+		t.Fatalf("Take() error = %v", err)
+	}
+	if snapshot.ID != "forge-1" || snapshot.VM != "101" || polls != 2 {
+		t.Errorf("Take() = %+v after %d polls", snapshot, polls)
+	}
+	if snapshot.Restore != "qm rollback 101 forge-1 (on node pve1)" {
+		t.Errorf("Restore = %q", snapshot.Restore)
+	}
+
+	config.TokenSecret = "wrong"
+	if _, err := Take(context.Background(), config, "db1", "forge-1"); err == nil {
+		t.Error("Expected an error for a rejected token")
+	}
+}
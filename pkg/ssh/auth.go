@@ -0,0 +1,234 @@
+package ssh
+
+import (
+	"crypto/sha256"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// IdentityAgentNone disables the ssh-agent in ConnectionConfig.IdentityAgent
+const IdentityAgentNone = "none"
+
+// maxPassphraseAttempts is how many times a wrong passphrase may be entered
+const maxPassphraseAttempts = 3
+
+// defaultIdentities are the keys tried when none is configured, as OpenSSH does
+var defaultIdentities = []string{"~/.ssh/id_ed25519", "~/.ssh/id_ecdsa", "~/.ssh/id_rsa"}
+
+// PassphraseFunc asks for the passphrase of an encrypted private key
+type PassphraseFunc func(key string) ([]byte, error)
+
+var (
+	passphraseMu     sync.Mutex
+	passphrasePrompt PassphraseFunc
+	// keyring holds keys unlocked by a prompt so each is asked for once
+	keyring = make(map[[sha256.Size]byte]ssh.Signer)
+)
+
+// SetPassphrasePrompt sets how the passphrase of an encrypted key is asked
+// for when the connection does not configure one. nil disables prompting.
+func SetPassphrasePrompt(prompt PassphraseFunc) {
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+	passphrasePrompt = prompt
+}
+
+// agentSocket returns the ssh-agent socket to use, or "" when there is none
+func (c *ConnectionConfig) agentSocket() string {
+	switch c.IdentityAgent {
+	case IdentityAgentNone:
+		return ""
+	case "":
+		return os.Getenv("SSH_AUTH_SOCK")
+	default:
+		return expandHome(c.IdentityAgent)
+	}
+}
+
+// authMethods returns the ways to authenticate a connection, in the order
+// OpenSSH tries them: configured keys, then keys held by the ssh-agent, then
+// the default identities, then the password. Sources that cannot be used,
+// such as an agent that is not running or an encrypted key without a
+// passphrase, are skipped so the others can still be tried. The returned
+// closer releases the agent connection once authentication is done.
+func authMethods(config *ConnectionConfig) ([]ssh.AuthMethod, io.Closer, error) {
+	var problems []string
+
+	var keys []ssh.Signer
+	if config.PrivateKey != "" {
+		signer, err := parseKey("private_key", []byte(config.PrivateKey), config.PrivateKeyPassphrase)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			keys = append(keys, signer)
+		}
+	}
+	if config.PrivateKeyPath != "" {
+		signer, err := loadKeyFile(config.PrivateKeyPath, config.PrivateKeyPassphrase)
+		if err != nil {
+			problems = append(problems, err.Error())
+		} else {
+			keys = append(keys, signer)
+		}
+	}
+
+	var agentClient agent.ExtendedAgent
+	var agentConn net.Conn
+	if socket := config.agentSocket(); socket != "" {
+		conn, err := net.Dial("unix", socket)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("ssh-agent unavailable: %v", err))
+		} else {
+			agentConn = conn
+			agentClient = agent.NewClient(conn)
+		}
+	}
+
+	// Default identities are only tried when no key is configured; missing
+	// files are expected, so only unusable ones are reported
+	var fallback []ssh.Signer
+	if config.PrivateKey == "" && config.PrivateKeyPath == "" {
+		for _, path := range defaultIdentities {
+			if _, err := os.Stat(expandHome(path)); err != nil {
+				continue
+			}
+			signer, err := loadKeyFile(path, "")
+			if err != nil {
+				problems = append(problems, err.Error())
+				continue
+			}
+			fallback = append(fallback, signer)
+		}
+	}
+
+	var methods []ssh.AuthMethod
+	if len(keys) > 0 || agentClient != nil || len(fallback) > 0 {
+		// The client tries each method type once, so every key is offered
+		// through a single public key method
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			signers := append([]ssh.Signer(nil), keys...)
+			if agentClient != nil {
+				if agentSigners, err := agentClient.Signers(); err == nil {
+					signers = append(signers, agentSigners...)
+				}
+			}
+			return append(signers, fallback...), nil
+		}))
+	}
+	if config.Password != "" {
+		// Servers that disable password authentication often still accept
+		// the password through keyboard-interactive
+		methods = append(methods,
+			ssh.Password(config.Password),
+			ssh.KeyboardInteractive(passwordChallenge(config.Password)))
+	}
+
+	if len(methods) == 0 {
+		if agentConn != nil {
+			agentConn.Close()
+		}
+		if len(problems) == 0 {
+			return nil, nil, fmt.Errorf("no authentication methods available")
+		}
+		return nil, nil, fmt.Errorf("no authentication methods available: %s", strings.Join(problems, "; "))
+	}
+	if agentConn == nil {
+		return methods, nil, nil
+	}
+	return methods, agentConn, nil
+}
+
+// passwordChallenge answers keyboard-interactive prompts with the password
+func passwordChallenge(password string) ssh.KeyboardInteractiveChallenge {
+	return func(user, instruction string, questions []string, echos []bool) ([]string, error) {
+		answers := make([]string, len(questions))
+		for i := range questions {
+			answers[i] = password
+		}
+		return answers, nil
+	}
+}
+
+// loadKeyFile reads and parses a private key file
+func loadKeyFile(path, passphrase string) (ssh.Signer, error) {
+	data, err := os.ReadFile(expandHome(path))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key file %s: %w", path, err)
+	}
+	return parseKey(path, data, passphrase)
+}
+
+// parseKey parses a private key. An encrypted key is unlocked with the
+// configured passphrase, or else by asking for it.
+func parseKey(name string, data []byte, passphrase string) (ssh.Signer, error) {
+	signer, err := ssh.ParsePrivateKey(data)
+	var missing *ssh.PassphraseMissingError
+	if !errors.As(err, &missing) {
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key %s: %w", name, err)
+		}
+		return signer, nil
+	}
+
+	if passphrase != "" {
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(data, []byte(passphrase))
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt private key %s: %w", name, err)
+		}
+		return signer, nil
+	}
+	return unlockKey(name, data)
+}
+
+// unlockKey asks for the passphrase of an encrypted key. Prompts are asked
+// one at a time and unlocked keys are kept, so connecting to many hosts
+// with the same key asks once.
+func unlockKey(name string, data []byte) (ssh.Signer, error) {
+	passphraseMu.Lock()
+	defer passphraseMu.Unlock()
+
+	fingerprint := sha256.Sum256(data)
+	if signer, ok := keyring[fingerprint]; ok {
+		return signer, nil
+	}
+	if passphrasePrompt == nil {
+		return nil, fmt.Errorf("private key %s is encrypted and no passphrase is configured", name)
+	}
+
+	for attempt := 1; ; attempt++ {
+		passphrase, err := passphrasePrompt(name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase for %s: %w", name, err)
+		}
+		signer, err := ssh.ParsePrivateKeyWithPassphrase(data, passphrase)
+		if err == nil {
+			keyring[fingerprint] = signer
+			return signer, nil
+		}
+		if !errors.Is(err, x509.IncorrectPasswordError) || attempt == maxPassphraseAttempts {
+			return nil, fmt.Errorf("failed to decrypt private key %s: %w", name, err)
+		}
+	}
+}
+
+// expandHome expands a leading ~/ to the user's home directory
+func expandHome(path string) string {
+	if !strings.HasPrefix(path, "~/") {
+		return path
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return path
+	}
+	return filepath.Join(home, path[2:])
+}
@@ -0,0 +1,306 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// testKey generates a private key and its PEM encoding, encrypted when a
+// passphrase is given
+func testKey(t *testing.T, passphrase string) (ed25519.PrivateKey, ssh.PublicKey, []byte) {
+	t.Helper()
+	public, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var block *pem.Block
+	if passphrase == "" {
+		block, err = ssh.MarshalPrivateKey(private, "")
+	} else {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(private, "", []byte(passphrase))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	sshPublic, err := ssh.NewPublicKey(public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return private, sshPublic, pem.EncodeToMemory(block)
+}
+
+// startAgent serves an in-memory ssh-agent holding the key on a socket
+func startAgent(t *testing.T, key ed25519.PrivateKey) string {
+	t.Helper()
+	keyring := agent.NewKeyring()
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	listener, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+	return socket
+}
+
+// handshake authenticates a client against an in-process SSH server
+func handshake(t *testing.T, server *ssh.ServerConfig, config *ConnectionConfig) error {
+	t.Helper()
+	_, hostKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hostSigner, err := ssh.NewSignerFromKey(hostKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.AddHostKey(hostSigner)
+
+	auth, agentConn, err := authMethods(config)
+	if err != nil {
+		return err
+	}
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	go func() {
+		serverConn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer serverConn.Close()
+		if conn, _, _, err := ssh.NewServerConn(serverConn, server); err == nil {
+			conn.Close()
+		}
+	}()
+
+	clientConn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer clientConn.Close()
+
+	conn, _, _, err := ssh.NewClientConn(clientConn, listener.Addr().String(), &ssh.ClientConfig{
+		User:            "deploy",
+		Auth:            auth,
+		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	})
+	if err == nil {
+		conn.Close()
+	}
+	return err
+}
+
+// acceptKey is a server that only accepts one public key
+func acceptKey(key ssh.PublicKey) *ssh.ServerConfig {
+	return &ssh.ServerConfig{
+		PublicKeyCallback: func(conn ssh.ConnMetadata, offered ssh.PublicKey) (*ssh.Permissions, error) {
+			if bytes.Equal(offered.Marshal(), key.Marshal()) {
+				return nil, nil
+			}
+			return nil, errors.New("unknown key")
+		},
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	_, _, plain := testKey(t, "")
+	_, _, encrypted := testKey(t, "correct horse")
+
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		wantErr    bool
+	}{
+		{name: "unencrypted", data: plain},
+		{name: "encrypted with passphrase", data: encrypted, passphrase: "correct horse"},
+		{name: "wrong passphrase", data: encrypted, passphrase: "battery staple", wantErr: true},
+		{name: "encrypted without passphrase", data: encrypted, wantErr: true},
+		{name: "not a key", data: []byte("hello"), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			signer, err := parseKey("id_test", tt.data, tt.passphrase)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseKey() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && signer == nil {
+				t.Error("Expected a signer")
+			}
+		})
+	}
+}
+
+func TestParseKey_Prompt(t *testing.T) {
+	_, _, encrypted := testKey(t, "correct horse")
+
+	var prompts []string
+	answers := []string{"wrong", "correct horse"}
+	SetPassphrasePrompt(func(key string) ([]byte, error) {
+		prompts = append(prompts, key)
+		answer := answers[0]
+		answers = answers[1:]
+		return []byte(answer), nil
+	})
+	defer SetPassphrasePrompt(nil)
+
+	if _, err := parseKey("~/.ssh/id_test", encrypted, ""); err != nil {
+		t.Fatalf("parseKey() error = %v", err)
+	}
+	if len(prompts) != 2 || prompts[0] != "~/.ssh/id_test" {
+		t.Errorf("Expected to be asked again after a wrong passphrase, got %v", prompts)
+	}
+
+	// The unlocked key is reused rather than asked for again
+	if _, err := parseKey("~/.ssh/id_test", encrypted, ""); err != nil {
+		t.Fatalf("parseKey() error = %v", err)
+	}
+	if len(prompts) != 2 {
+		t.Errorf("Expected one prompt per key, got %d", len(prompts))
+	}
+}
+
+func TestAuthMethods(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("SSH_AUTH_SOCK", "")
+
+	agentKey, agentPublic, _ := testKey(t, "")
+	_, filePublic, fileKey := testKey(t, "")
+	_, encryptedPublic, encryptedKey := testKey(t, "secret")
+	keyFile := filepath.Join(t.TempDir(), "id_ed25519")
+	if err := os.WriteFile(keyFile, fileKey, 0600); err != nil {
+		t.Fatal(err)
+	}
+	socket := startAgent(t, agentKey)
+
+	passwordOnly := &ssh.ServerConfig{
+		KeyboardInteractiveCallback: func(conn ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client("", "", []string{"Password: "}, []bool{false})
+			if err != nil || len(answers) != 1 || answers[0] != "hunter22" {
+				return nil, errors.New("wrong password")
+			}
+			return nil, nil
+		},
+	}
+
+	tests := []struct {
+		name    string
+		server  *ssh.ServerConfig
+		config  ConnectionConfig
+		wantErr bool
+	}{
+		{
+			name:   "key file",
+			server: acceptKey(filePublic),
+			config: ConnectionConfig{PrivateKeyPath: keyFile, IdentityAgent: IdentityAgentNone},
+		},
+		{
+			name:   "agent",
+			server: acceptKey(agentPublic),
+			config: ConnectionConfig{IdentityAgent: socket},
+		},
+		{
+			name:   "falls back from key file to agent",
+			server: acceptKey(agentPublic),
+			config: ConnectionConfig{PrivateKeyPath: keyFile, IdentityAgent: socket},
+		},
+		{
+			name:   "encrypted key with passphrase",
+			server: acceptKey(encryptedPublic),
+			config: ConnectionConfig{PrivateKey: string(encryptedKey), PrivateKeyPassphrase: "secret", IdentityAgent: IdentityAgentNone},
+		},
+		{
+			name:   "skips unusable key for password",
+			server: passwordOnly,
+			config: ConnectionConfig{PrivateKey: string(encryptedKey), Password: "hunter22", IdentityAgent: socket},
+		},
+		{
+			name:    "agent not running",
+			server:  acceptKey(agentPublic),
+			config:  ConnectionConfig{IdentityAgent: filepath.Join(t.TempDir(), "missing.sock")},
+			wantErr: true,
+		},
+		{
+			name:    "agent disabled",
+			server:  acceptKey(agentPublic),
+			config:  ConnectionConfig{PrivateKeyPath: keyFile, IdentityAgent: IdentityAgentNone},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := handshake(t, tt.server, &tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("handshake error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthMethods_DefaultIdentities(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	_, public, key := testKey(t, "")
+	if err := os.MkdirAll(filepath.Join(home, ".ssh"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".ssh", "id_ed25519"), key, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	config := &ConnectionConfig{IdentityAgent: IdentityAgentNone}
+	if err := handshake(t, acceptKey(public), config); err != nil {
+		t.Errorf("Expected ~/.ssh/id_ed25519 to be tried, got %v", err)
+	}
+}
+
+func TestRealSSHConnection_ReleasesAgentWhenDialFails(t *testing.T) {
+	key, _, _ := testKey(t, "")
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := listener.Addr().(*net.TCPAddr).Port
+	listener.Close()
+
+	conn := NewRealSSHConnection(&ConnectionConfig{Host: "127.0.0.1", Port: port, User: "deploy", IdentityAgent: startAgent(t, key)})
+	conn.retries = 1
+	if err := conn.Connect(context.Background()); err == nil {
+		t.Fatal("Expected connecting to a closed port to fail")
+	}
+	if conn.agentConn != nil {
+		t.Error("Expected the ssh-agent connection to be closed after a failed dial")
+	}
+}
@@ -0,0 +1,218 @@
+package ssh
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/sudoers"
+)
+
+// Privilege escalation methods accepted in ConnectionConfig.BecomeMethod
+const (
+	BecomeSudo = "sudo"
+	BecomeSu   = "su"
+	BecomeDoas = "doas"
+)
+
+// DefaultBecomeUser is the user commands run as when become_user is unset
+const DefaultBecomeUser = "root"
+
+// Become describes how commands are escalated to another user
+type Become struct {
+	Enabled bool
+	User    string
+	Method  string
+	// Password answers the sudo prompt; it is sent on standard input
+	Password string
+	// Allowlist escalates only the privileged programs of a command with
+	// sudo, leaving the rest of it unprivileged
+	Allowlist bool
+}
+
+// BecomeSettings returns the privilege escalation configured for the target
+func (c *ConnectionConfig) BecomeSettings() Become {
+	return Become{
+		Enabled:   c.Become,
+		User:      c.BecomeUser,
+		Method:    c.BecomeMethod,
+		Password:  c.BecomePassword,
+		Allowlist: c.BecomeAllowlist,
+	}
+}
+
+// validateBecome checks the become settings of a connection
+func (c *ConnectionConfig) validateBecome() error {
+	switch c.BecomeMethod {
+	case "", BecomeSudo:
+	case BecomeSu, BecomeDoas:
+		if c.BecomePassword != "" {
+			return fmt.Errorf("become_password is only supported with become_method sudo, not %s", c.BecomeMethod)
+		}
+	default:
+		return fmt.Errorf("unknown become_method %q, must be sudo, su or doas", c.BecomeMethod)
+	}
+	if c.BecomeAllowlist {
+		if c.BecomeMethod != "" && c.BecomeMethod != BecomeSudo {
+			return fmt.Errorf("become_allowlist is only supported with become_method sudo")
+		}
+		if c.BecomePassword != "" {
+			return fmt.Errorf("become_allowlist needs passwordless sudo, remove become_password")
+		}
+	}
+	return nil
+}
+
+// BecomeOverride changes the target's privilege escalation for the commands
+// of one resource. A nil Enabled and empty fields keep the target's settings.
+type BecomeOverride struct {
+	Enabled *bool
+	User    string
+	Method  string
+}
+
+type becomeKey struct{}
+
+// WithBecome returns a context whose commands use the override
+func WithBecome(ctx context.Context, override BecomeOverride) context.Context {
+	return context.WithValue(ctx, becomeKey{}, override)
+}
+
+type privilegedKey struct{}
+
+// WithPrivileged returns a context in which become_allowlist escalates the
+// programs, those the provider running the commands declares privileged
+func WithPrivileged(ctx context.Context, programs []string) context.Context {
+	allowed := make(map[string]bool, len(programs))
+	for _, program := range programs {
+		allowed[program] = true
+	}
+	return context.WithValue(ctx, privilegedKey{}, allowed)
+}
+
+// privileged returns the programs of a context that are escalated
+func privileged(ctx context.Context) map[string]bool {
+	allowed, _ := ctx.Value(privilegedKey{}).(map[string]bool)
+	return allowed
+}
+
+// BecomeFromContext applies the context's override, if any, to the settings
+func BecomeFromContext(ctx context.Context, become Become) Become {
+	override, ok := ctx.Value(becomeKey{}).(BecomeOverride)
+	if !ok {
+		return become
+	}
+	if override.Enabled != nil {
+		become.Enabled = *override.Enabled
+	}
+	if override.User != "" {
+		become.User = override.User
+	}
+	if override.Method != "" && override.Method != become.Method {
+		become.Method = override.Method
+		// The password belongs to the target's method
+		if override.Method != BecomeSudo {
+			become.Password = ""
+		}
+	}
+	return become
+}
+
+// Wrap returns the command escalated with the configured method and the
+// input to send on its standard input, which is empty without a password.
+// su and doas read passwords from a terminal only, so they cannot be given
+// one.
+func (b Become) Wrap(command string) (string, string, error) {
+	user := b.User
+	if user == "" {
+		user = DefaultBecomeUser
+	}
+	if b.Password != "" && (b.Method == BecomeSu || b.Method == BecomeDoas) {
+		return "", "", fmt.Errorf("become_password is only supported with become_method sudo, not %s", b.Method)
+	}
+
+	switch b.Method {
+	case "", BecomeSudo:
+		if b.Password == "" {
+			return fmt.Sprintf("sudo -n -H -u %s -- sh -c %s", shellQuote(user), shellQuote(command)), "", nil
+		}
+		// sudo only reads the password when it needs one, so the command's
+		// standard input is closed to keep it from seeing the password
+		return fmt.Sprintf("sudo -S -p '' -H -u %s -- sh -c %s", shellQuote(user), shellQuote("exec </dev/null; "+command)), b.Password + "\n", nil
+	case BecomeSu:
+		return fmt.Sprintf("su %s -s /bin/sh -c %s", shellQuote(user), shellQuote(command)), "", nil
+	case BecomeDoas:
+		return fmt.Sprintf("doas -n -u %s sh -c %s", shellQuote(user), shellQuote(command)), "", nil
+	default:
+		return "", "", fmt.Errorf("unknown become method %q", b.Method)
+	}
+}
+
+// Escalate returns the command with each of the privileged programs run
+// through sudo on its own, for become_allowlist. The rest of the command
+// runs as the connecting user.
+func (b Become) Escalate(command string, privileged map[string]bool) (string, error) {
+	user := b.User
+	if user == "" {
+		user = DefaultBecomeUser
+	}
+	prefix := fmt.Sprintf("sudo -n -H -u %s -- ", shellQuote(user))
+	escalated, err := sudoers.Escalate(command, prefix, func(program string) bool { return privileged[program] })
+	if err != nil {
+		return "", fmt.Errorf("become_allowlist: %w", err)
+	}
+	return escalated, nil
+}
+
+// BecomeExecutor runs commands as another user, wrapping each one with
+// sudo, su or doas. Resources can change the escalation through WithBecome.
+type BecomeExecutor struct {
+	Executor
+	become Become
+}
+
+// NewBecomeExecutor wraps an executor with the target's privilege escalation
+func NewBecomeExecutor(executor Executor, become Become) *BecomeExecutor {
+	return &BecomeExecutor{
+		Executor: executor,
+		become:   become,
+	}
+}
+
+// Execute runs the command, escalated when become is enabled
+func (e *BecomeExecutor) Execute(ctx context.Context, command string) (*ExecuteResult, error) {
+	become := BecomeFromContext(ctx, e.become)
+	if !become.Enabled {
+		return e.Executor.Execute(ctx, command)
+	}
+
+	var wrapped, input string
+	var err error
+	if become.Allowlist && (become.Method == "" || become.Method == BecomeSudo) {
+		wrapped, err = become.Escalate(command, privileged(ctx))
+	} else {
+		wrapped, input, err = become.Wrap(command)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var result *ExecuteResult
+	if input == "" {
+		result, err = e.Executor.Execute(ctx, wrapped)
+	} else {
+		inputExecutor, ok := e.Executor.(InputExecutor)
+		if !ok {
+			return nil, fmt.Errorf("become_password is not supported by this transport")
+		}
+		result, err = inputExecutor.ExecuteWithInput(ctx, wrapped, strings.NewReader(input))
+	}
+	if result != nil {
+		result.Command = command
+	}
+	return result, err
+}
+
+// shellQuote quotes a string as a single shell word
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'"'"'`) + "'"
+}
@@ -0,0 +1,230 @@
+package ssh
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// recordingExecutor records the commands it runs and the input they are given
+type recordingExecutor struct {
+	MockExecutor
+	commands []string
+	inputs   []string
+}
+
+func (r *recordingExecutor) Execute(ctx context.Context, command string) (*ExecuteResult, error) {
+	r.commands = append(r.commands, command)
+	r.inputs = append(r.inputs, "")
+	return &ExecuteResult{Command: command}, nil
+}
+
+func (r *recordingExecutor) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
+	data, err := io.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	r.commands = append(r.commands, command)
+	r.inputs = append(r.inputs, string(data))
+	return &ExecuteResult{Command: command}, nil
+}
+
+func TestBecome_Wrap(t *testing.T) {
+	tests := []struct {
+		name      string
+		become    Become
+		wantCmd   string
+		wantInput string
+		wantErr   bool
+	}{
+		{
+			name:    "sudo to root",
+			become:  Become{Enabled: true},
+			wantCmd: `sudo -n -H -u 'root' -- sh -c 'id -u'`,
+		},
+		{
+			name:      "sudo with password",
+			become:    Become{Enabled: true, User: "postgres", Password: "s3cret"},
+			wantCmd:   `sudo -S -p '' -H -u 'postgres' -- sh -c 'exec </dev/null; id -u'`,
+			wantInput: "s3cret\n",
+		},
+		{
+			name:    "su",
+			become:  Become{Enabled: true, Method: BecomeSu, User: "app"},
+			wantCmd: `su 'app' -s /bin/sh -c 'id -u'`,
+		},
+		{
+			name:    "doas",
+			become:  Become{Enabled: true, Method: BecomeDoas},
+			wantCmd: `doas -n -u 'root' sh -c 'id -u'`,
+		},
+		{
+			name:    "su with password",
+			become:  Become{Enabled: true, Method: BecomeSu, Password: "s3cret"},
+			wantErr: true,
+		},
+		{
+			name:    "doas with password",
+			become:  Become{Enabled: true, Method: BecomeDoas, Password: "s3cret"},
+			wantErr: true,
+		},
+		{
+			name:    "unknown method",
+			become:  Become{Enabled: true, Method: "pbrun"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			command, input, err := tt.become.Wrap("id -u")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Wrap() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if command != tt.wantCmd || input != tt.wantInput {
+				t.Errorf("Wrap() = %q, %q, want %q, %q", command, input, tt.wantCmd, tt.wantInput)
+			}
+		})
+	}
+}
+
+func TestBecome_WrapQuotes(t *testing.T) {
+	command, _, err := Become{Enabled: true}.Wrap(`echo 'it''s'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `sudo -n -H -u 'root' -- sh -c 'echo '"'"'it'"'"''"'"'s'"'"''`; command != want {
+		t.Errorf("Wrap() = %q, want %q", command, want)
+	}
+}
+
+func TestBecomeExecutor_Execute(t *testing.T) {
+	disabled, enabled := false, true
+	recorder := &recordingExecutor{}
+	executor := NewBecomeExecutor(recorder, Become{Enabled: true, Password: "pw"})
+
+	result, err := executor.Execute(context.Background(), "apt-get update")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Command != "apt-get update" {
+		t.Errorf("Command = %q, want the unwrapped command", result.Command)
+	}
+	if !strings.HasPrefix(recorder.commands[0], "sudo -S") || recorder.inputs[0] != "pw\n" {
+		t.Errorf("ran %q with input %q", recorder.commands[0], recorder.inputs[0])
+	}
+
+	ctx := WithBecome(context.Background(), BecomeOverride{Enabled: &disabled})
+	if _, err := executor.Execute(ctx, "whoami"); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.commands[1] != "whoami" {
+		t.Errorf("disabled override ran %q", recorder.commands[1])
+	}
+
+	ctx = WithBecome(context.Background(), BecomeOverride{User: "postgres", Method: BecomeSu})
+	if _, err := executor.Execute(ctx, "psql -l"); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.commands[2] != `su 'postgres' -s /bin/sh -c 'psql -l'` || recorder.inputs[2] != "" {
+		t.Errorf("su override ran %q with input %q", recorder.commands[2], recorder.inputs[2])
+	}
+
+	plain := NewBecomeExecutor(recorder, Become{})
+	ctx = WithBecome(context.Background(), BecomeOverride{Enabled: &enabled})
+	if _, err := plain.Execute(ctx, "id"); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.commands[3] != `sudo -n -H -u 'root' -- sh -c 'id'` {
+		t.Errorf("enabled override ran %q", recorder.commands[3])
+	}
+}
+
+func TestBecomeExecutor_PasswordNeedsInput(t *testing.T) {
+	executor := NewBecomeExecutor(NewMockExecutor(), Become{Enabled: true, Password: "pw"})
+	if _, err := executor.Execute(context.Background(), "id"); err == nil {
+		t.Error("Expected an error for a transport without standard input")
+	}
+}
+
+func TestBecomeExecutor_Local(t *testing.T) {
+	// A stand-in sudo that checks the password and runs the command after --
+	bin := t.TempDir()
+	script := "#!/bin/sh\nread password\n[ \"$password\" = pw ] || { echo 'bad password' >&2; exit 1; }\nwhile [ \"$1\" != -- ]; do shift; done\nshift\nexec \"$@\"\n"
+	if err := os.WriteFile(filepath.Join(bin, "sudo"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	executor := NewBecomeExecutor(&LocalExecutor{}, Become{Enabled: true, Password: "pw"})
+	result, err := executor.Execute(context.Background(), "echo ran; cat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode != 0 || result.Stdout != "ran\n" {
+		t.Errorf("Execute() = %+v, want the command to run without seeing the password", result)
+	}
+
+	executor = NewBecomeExecutor(&LocalExecutor{}, Become{Enabled: true, Password: "wrong"})
+	result, err = executor.Execute(context.Background(), "echo ran")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.ExitCode == 0 || !strings.Contains(result.Stderr, "bad password") {
+		t.Errorf("Execute() = %+v, want the password to be rejected", result)
+	}
+}
+
+func TestBecomeExecutor_Allowlist(t *testing.T) {
+	recorder := &recordingExecutor{}
+	executor := NewBecomeExecutor(recorder, Become{Enabled: true, Allowlist: true})
+
+	ctx := WithPrivileged(context.Background(), []string{"systemctl", "tee"})
+	if _, err := executor.Execute(ctx, "systemctl is-active nginx || systemctl start nginx; echo ok > /etc/state"); err != nil {
+		t.Fatal(err)
+	}
+	want := `sudo -n -H -u 'root' -- systemctl is-active nginx || sudo -n -H -u 'root' -- systemctl start nginx; echo ok | sudo -n -H -u 'root' -- tee /etc/state > /dev/null`
+	if recorder.commands[0] != want {
+		t.Errorf("ran %q, want %q", recorder.commands[0], want)
+	}
+
+	// Programs the provider does not declare run as the connecting user
+	if _, err := executor.Execute(context.Background(), "systemctl start nginx"); err != nil {
+		t.Fatal(err)
+	}
+	if recorder.commands[1] != "systemctl start nginx" {
+		t.Errorf("undeclared program ran %q", recorder.commands[1])
+	}
+
+	if _, err := executor.Execute(ctx, "case $1 in start) systemctl start nginx ;; esac"); err == nil {
+		t.Error("expected an error for a command that cannot be escalated")
+	}
+}
+
+func TestConnectionConfig_ValidateBecome(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ConnectionConfig
+		wantErr bool
+	}{
+		{name: "sudo password", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomePassword: "pw"}},
+		{name: "doas", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomeMethod: BecomeDoas}},
+		{name: "su password", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomeMethod: BecomeSu, BecomePassword: "pw"}, wantErr: true},
+		{name: "unknown method", config: ConnectionConfig{Transport: TransportLocal, BecomeMethod: "runas"}, wantErr: true},
+		{name: "winrm", config: ConnectionConfig{Transport: TransportWinRM, Host: "win1", User: "admin", Password: "pw", Become: true}, wantErr: true},
+		{name: "allowlist", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomeAllowlist: true}},
+		{name: "allowlist with su", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomeMethod: BecomeSu, BecomeAllowlist: true}, wantErr: true},
+		{name: "allowlist with password", config: ConnectionConfig{Transport: TransportLocal, Become: true, BecomePassword: "pw", BecomeAllowlist: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -5,26 +5,60 @@ import (
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
 	"time"
 
+	"github.com/ataiva-software/forge/pkg/bandwidth"
 	"golang.org/x/crypto/ssh"
 )
 
-// ConnectionConfig holds SSH connection configuration
+// Transport names accepted in ConnectionConfig.Transport
+const (
+	TransportSSH     = "ssh"
+	TransportLocal   = "local"
+	TransportDocker  = "docker"
+	TransportKubectl = "kubectl"
+	TransportWinRM   = "winrm"
+)
+
+// ConnectionConfig holds SSH connection configuration. Transport selects how
+// commands reach the target; for docker and kubectl, Host names the container or pod.
 type ConnectionConfig struct {
+	Transport       string        `yaml:"transport,omitempty" json:"transport,omitempty"`
 	Host            string        `yaml:"host" json:"host"`
 	Port            int           `yaml:"port" json:"port"`
 	User            string        `yaml:"user" json:"user"`
 	Password        string        `yaml:"password,omitempty" json:"password,omitempty"`
 	PrivateKeyPath  string        `yaml:"private_key_path,omitempty" json:"private_key_path,omitempty"`
 	PrivateKey      string        `yaml:"private_key,omitempty" json:"private_key,omitempty"`
+	// PrivateKeyPassphrase unlocks an encrypted private key
+	PrivateKeyPassphrase string `yaml:"private_key_passphrase,omitempty" json:"private_key_passphrase,omitempty"`
+	// IdentityAgent is the ssh-agent socket, defaulting to SSH_AUTH_SOCK; "none" disables the agent
+	IdentityAgent string `yaml:"identity_agent,omitempty" json:"identity_agent,omitempty"`
 	Timeout         time.Duration `yaml:"timeout,omitempty" json:"timeout,omitempty"`
 	ConnectTimeout  time.Duration `yaml:"connect_timeout,omitempty" json:"connect_timeout,omitempty"`
 	KeepAlive       time.Duration `yaml:"keep_alive,omitempty" json:"keep_alive,omitempty"`
 	MaxRetries      int           `yaml:"max_retries,omitempty" json:"max_retries,omitempty"`
 	StrictHostCheck bool          `yaml:"strict_host_check,omitempty" json:"strict_host_check,omitempty"`
+	// HostKeyPolicy is strict, accept-new or off; see HostKeyStrict
+	HostKeyPolicy string `yaml:"host_key_policy,omitempty" json:"host_key_policy,omitempty"`
+	// KnownHostsFile holds trusted host keys, defaulting to ~/.ssh/known_hosts
+	KnownHostsFile string `yaml:"known_hosts_file,omitempty" json:"known_hosts_file,omitempty"`
+	// HostKeys replaces the known_hosts file as the store of trusted host keys
+	HostKeys HostKeyStore `yaml:"-" json:"-"`
+	// Become runs commands as BecomeUser (root by default) through
+	// BecomeMethod: sudo, su or doas
+	Become       bool   `yaml:"become,omitempty" json:"become,omitempty"`
+	BecomeUser   string `yaml:"become_user,omitempty" json:"become_user,omitempty"`
+	BecomeMethod string `yaml:"become_method,omitempty" json:"become_method,omitempty"`
+	// BecomePassword answers the sudo password prompt
+	BecomePassword string `yaml:"become_password,omitempty" json:"become_password,omitempty"`
+	// BecomeAllowlist runs only the programs providers declare privileged
+	// through sudo, each on its own, instead of whole commands in a root
+	// shell, so the user's sudoers rule can allow just those programs
+	BecomeAllowlist bool `yaml:"become_allowlist,omitempty" json:"become_allowlist,omitempty"`
+	Namespace       string        `yaml:"namespace,omitempty" json:"namespace,omitempty"`
+	Container       string        `yaml:"container,omitempty" json:"container,omitempty"`
+	Bandwidth       string        `yaml:"bandwidth,omitempty" json:"bandwidth,omitempty"`
 }
 
 // SetDefaults sets default values for connection config
@@ -46,20 +80,66 @@ func (c *ConnectionConfig) SetDefaults() {
 	}
 }
 
+// TransportName returns the configured transport, defaulting to ssh
+func (c *ConnectionConfig) TransportName() string {
+	if c.Transport == "" {
+		return TransportSSH
+	}
+	return c.Transport
+}
+
 // Validate validates the connection configuration
 func (c *ConnectionConfig) Validate() error {
+	if c.Bandwidth != "" {
+		if _, err := bandwidth.ParseRate(c.Bandwidth); err != nil {
+			return err
+		}
+	}
+	if err := c.validateBecome(); err != nil {
+		return err
+	}
+
+	switch c.TransportName() {
+	case TransportSSH:
+	case TransportLocal:
+		return nil
+	case TransportDocker, TransportKubectl:
+		if c.Host == "" {
+			return fmt.Errorf("host cannot be empty")
+		}
+		return nil
+	case TransportWinRM:
+		if c.Host == "" {
+			return fmt.Errorf("host cannot be empty")
+		}
+		if c.User == "" || c.Password == "" {
+			return fmt.Errorf("winrm requires user and password")
+		}
+		if c.Become {
+			return fmt.Errorf("become is not supported with winrm")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown transport %q", c.Transport)
+	}
+
 	if c.Host == "" {
 		return fmt.Errorf("host cannot be empty")
 	}
 	if c.User == "" {
 		return fmt.Errorf("user cannot be empty")
 	}
-	if c.Password == "" && c.PrivateKeyPath == "" && c.PrivateKey == "" {
-		return fmt.Errorf("must provide either password, private_key_path, or private_key")
+	if c.Password == "" && c.PrivateKeyPath == "" && c.PrivateKey == "" && c.agentSocket() == "" {
+		return fmt.Errorf("must provide either password, private_key_path, private_key, or a running ssh-agent")
 	}
 	if c.Port <= 0 || c.Port > 65535 {
 		return fmt.Errorf("port must be between 1 and 65535")
 	}
+	switch c.HostKeyPolicy {
+	case "", HostKeyStrict, HostKeyAcceptNew, HostKeyOff:
+	default:
+		return fmt.Errorf("unknown host_key_policy %q, must be strict, accept-new or off", c.HostKeyPolicy)
+	}
 	return nil
 }
 
@@ -83,10 +163,13 @@ func (c *Connection) Connect(ctx context.Context) error {
 		return fmt.Errorf("invalid connection config: %w", err)
 	}
 
-	clientConfig, err := c.buildClientConfig()
+	clientConfig, agentConn, err := c.buildClientConfig()
 	if err != nil {
 		return fmt.Errorf("failed to build SSH client config: %w", err)
 	}
+	if agentConn != nil {
+		defer agentConn.Close()
+	}
 
 	address := fmt.Sprintf("%s:%d", c.config.Host, c.config.Port)
 	
@@ -208,61 +291,23 @@ func (r *ExecuteResult) Success() bool {
 	return r.ExitCode == 0
 }
 
-// buildClientConfig creates the SSH client configuration
-func (c *Connection) buildClientConfig() (*ssh.ClientConfig, error) {
+// buildClientConfig creates the SSH client configuration. The returned
+// closer, if any, releases the ssh-agent once the handshake is done.
+func (c *Connection) buildClientConfig() (*ssh.ClientConfig, io.Closer, error) {
+	address := net.JoinHostPort(c.config.Host, fmt.Sprintf("%d", c.config.Port))
 	config := &ssh.ClientConfig{
-		User:            c.config.User,
-		Timeout:         c.config.Timeout,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(), // TODO: Implement proper host key checking
+		User:              c.config.User,
+		Timeout:           c.config.Timeout,
+		HostKeyCallback:   hostKeyCallback(c.config),
+		HostKeyAlgorithms: hostKeyAlgorithms(c.config, address),
 	}
 
 	// Add authentication methods
-	if c.config.Password != "" {
-		config.Auth = append(config.Auth, ssh.Password(c.config.Password))
-	}
-
-	if c.config.PrivateKey != "" {
-		signer, err := ssh.ParsePrivateKey([]byte(c.config.PrivateKey))
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key: %w", err)
-		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
-	}
-
-	if c.config.PrivateKeyPath != "" {
-		key, err := c.loadPrivateKey(c.config.PrivateKeyPath)
-		if err != nil {
-			return nil, fmt.Errorf("failed to load private key from %s: %w", c.config.PrivateKeyPath, err)
-		}
-		signer, err := ssh.ParsePrivateKey(key)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse private key from %s: %w", c.config.PrivateKeyPath, err)
-		}
-		config.Auth = append(config.Auth, ssh.PublicKeys(signer))
-	}
-
-	if len(config.Auth) == 0 {
-		return nil, fmt.Errorf("no authentication method configured")
-	}
-
-	return config, nil
-}
-
-// loadPrivateKey loads a private key from file
-func (c *Connection) loadPrivateKey(path string) ([]byte, error) {
-	// Expand home directory
-	if path[:2] == "~/" {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		path = filepath.Join(home, path[2:])
-	}
-
-	key, err := os.ReadFile(path)
+	auth, agentConn, err := authMethods(c.config)
 	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
+		return nil, nil, err
 	}
+	config.Auth = auth
 
-	return key, nil
+	return config, agentConn, nil
 }
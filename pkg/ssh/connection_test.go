@@ -121,12 +121,23 @@ func TestConnectionConfig_Validate(t *testing.T) {
 		{
 			name: "missing authentication",
 			config: ConnectionConfig{
-				Host: "example.com",
-				Port: 22,
-				User: "testuser",
+				Host:          "example.com",
+				Port:          22,
+				User:          "testuser",
+				IdentityAgent: IdentityAgentNone,
 			},
 			wantErr: true,
-			errMsg:  "must provide either password, private_key_path, or private_key",
+			errMsg:  "must provide either password, private_key_path, private_key, or a running ssh-agent",
+		},
+		{
+			name: "valid config with ssh-agent",
+			config: ConnectionConfig{
+				Host:          "example.com",
+				Port:          22,
+				User:          "testuser",
+				IdentityAgent: "/run/user/1000/ssh-agent.sock",
+			},
+			wantErr: false,
 		},
 		{
 			name: "invalid port - zero",
@@ -161,6 +172,45 @@ func TestConnectionConfig_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "port must be between 1 and 65535",
 		},
+		{
+			name:    "local transport needs no host",
+			config:  ConnectionConfig{Transport: TransportLocal},
+			wantErr: false,
+		},
+		{
+			name:    "docker transport requires container",
+			config:  ConnectionConfig{Transport: TransportDocker},
+			wantErr: true,
+			errMsg:  "host cannot be empty",
+		},
+		{
+			name:    "kubectl transport with pod",
+			config:  ConnectionConfig{Transport: TransportKubectl, Host: "app-0", Namespace: "prod"},
+			wantErr: false,
+		},
+		{
+			name:    "winrm transport requires credentials",
+			config:  ConnectionConfig{Transport: TransportWinRM, Host: "win1", User: "admin"},
+			wantErr: true,
+			errMsg:  "winrm requires user and password",
+		},
+		{
+			name:    "unknown transport",
+			config:  ConnectionConfig{Transport: "telnet", Host: "example.com"},
+			wantErr: true,
+			errMsg:  "unknown transport \"telnet\"",
+		},
+		{
+			name:    "local transport with bandwidth cap",
+			config:  ConnectionConfig{Transport: TransportLocal, Bandwidth: "2MB/s"},
+			wantErr: false,
+		},
+		{
+			name:    "invalid bandwidth",
+			config:  ConnectionConfig{Transport: TransportLocal, Bandwidth: "fast"},
+			wantErr: true,
+			errMsg:  "invalid bandwidth \"fast\"",
+		},
 	}
 
 	for _, tt := range tests {
@@ -0,0 +1,467 @@
+package ssh
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// Host key policies for ConnectionConfig.HostKeyPolicy
+const (
+	// HostKeyStrict only connects to hosts whose key is already trusted
+	HostKeyStrict = "strict"
+	// HostKeyAcceptNew trusts the key of a host seen for the first time,
+	// and refuses keys that differ from the trusted one
+	HostKeyAcceptNew = "accept-new"
+	// HostKeyOff skips verification; only for throwaway test hosts
+	HostKeyOff = "off"
+)
+
+// DefaultKnownHostsFile is where trusted host keys are kept unless configured otherwise
+const DefaultKnownHostsFile = "~/.ssh/known_hosts"
+
+// HostKeyStore keeps the trusted keys of hosts. Hosts are addressed as
+// "host:port".
+type HostKeyStore interface {
+	// Lookup returns the keys trusted for a host; none means it is unknown
+	Lookup(address string) ([]ssh.PublicKey, error)
+	// Add trusts a key for a host
+	Add(address string, key ssh.PublicKey) error
+}
+
+// HostKeyRevocations is implemented by stores that also keep revoked keys,
+// which are refused whatever the policy
+type HostKeyRevocations interface {
+	// Revoked returns the keys revoked for a host
+	Revoked(address string) ([]ssh.PublicKey, error)
+}
+
+// HostKeyError reports a host key that is not trusted
+type HostKeyError struct {
+	Address string
+	Key     ssh.PublicKey
+	// Changed is set when the host has a different trusted key of the same type
+	Changed bool
+	// Revoked is set when the key is revoked
+	Revoked bool
+}
+
+func (e *HostKeyError) Error() string {
+	fingerprint := ssh.FingerprintSHA256(e.Key)
+	if e.Revoked {
+		return fmt.Sprintf("host key for %s (%s %s) is revoked; this could be a man-in-the-middle attack "+
+			"or a host still using a compromised key", e.Address, e.Key.Type(), fingerprint)
+	}
+	if e.Changed {
+		return fmt.Sprintf("host key for %s has changed to %s %s; this could be a man-in-the-middle attack. "+
+			"If the change is expected, remove the old key with 'forge hostkeys remove %s'",
+			e.Address, e.Key.Type(), fingerprint, e.Address)
+	}
+	return fmt.Sprintf("host key for %s is not trusted (%s %s); verify the fingerprint and trust it with "+
+		"'forge hostkeys trust %s --fingerprint %s'",
+		e.Address, e.Key.Type(), fingerprint, e.Address, fingerprint)
+}
+
+// hostKeyPolicy returns the configured policy. Without one, strict_host_check
+// selects strict checking and otherwise new hosts are trusted on first use.
+func (c *ConnectionConfig) hostKeyPolicy() string {
+	if c.HostKeyPolicy != "" {
+		return c.HostKeyPolicy
+	}
+	if c.StrictHostCheck {
+		return HostKeyStrict
+	}
+	return HostKeyAcceptNew
+}
+
+// hostKeyStore returns the store of trusted keys for a connection
+func (c *ConnectionConfig) hostKeyStore() HostKeyStore {
+	if c.HostKeys != nil {
+		return c.HostKeys
+	}
+	return OpenKnownHosts(c.KnownHostsFile)
+}
+
+// hostKeyCallback verifies host keys according to the connection's policy
+func hostKeyCallback(config *ConnectionConfig) ssh.HostKeyCallback {
+	policy := config.hostKeyPolicy()
+	if policy == HostKeyOff {
+		return ssh.InsecureIgnoreHostKey()
+	}
+	return verifyHostKey(config.hostKeyStore(), policy)
+}
+
+// verifyHostKey refuses revoked keys, accepts trusted ones, refuses changed
+// ones, and handles keys of unknown hosts by the policy. A host is only
+// unknown for a key type it has no trusted key of, as in OpenSSH.
+func verifyHostKey(store HostKeyStore, policy string) ssh.HostKeyCallback {
+	return func(address string, remote net.Addr, key ssh.PublicKey) error {
+		if revocations, ok := store.(HostKeyRevocations); ok {
+			revoked, err := revocations.Revoked(address)
+			if err != nil {
+				return err
+			}
+			for _, known := range revoked {
+				if bytes.Equal(known.Marshal(), key.Marshal()) {
+					return &HostKeyError{Address: address, Key: key, Revoked: true}
+				}
+			}
+		}
+		trusted, err := store.Lookup(address)
+		if err != nil {
+			return err
+		}
+		changed := false
+		for _, known := range trusted {
+			if known.Type() != key.Type() {
+				continue
+			}
+			if bytes.Equal(known.Marshal(), key.Marshal()) {
+				return nil
+			}
+			changed = true
+		}
+		if changed {
+			return &HostKeyError{Address: address, Key: key, Changed: true}
+		}
+		if policy == HostKeyAcceptNew {
+			return store.Add(address, key)
+		}
+		return &HostKeyError{Address: address, Key: key}
+	}
+}
+
+// hostKeyAlgorithms asks servers for the key types already trusted for a
+// host, so a host with several keys presents one that can be verified
+func hostKeyAlgorithms(config *ConnectionConfig, address string) []string {
+	if config.hostKeyPolicy() == HostKeyOff {
+		return nil
+	}
+	trusted, err := config.hostKeyStore().Lookup(address)
+	if err != nil || len(trusted) == 0 {
+		return nil
+	}
+	var algorithms []string
+	seen := make(map[string]bool)
+	for _, key := range trusted {
+		types := []string{key.Type()}
+		if key.Type() == ssh.KeyAlgoRSA {
+			types = []string{ssh.KeyAlgoRSASHA512, ssh.KeyAlgoRSASHA256, ssh.KeyAlgoRSA}
+		}
+		for _, algorithm := range types {
+			if !seen[algorithm] {
+				seen[algorithm] = true
+				algorithms = append(algorithms, algorithm)
+			}
+		}
+	}
+	return algorithms
+}
+
+// ScanHostKey fetches the key a host presents, without authenticating
+func ScanHostKey(ctx context.Context, address string, timeout time.Duration) (ssh.PublicKey, error) {
+	dialer := &net.Dialer{Timeout: timeout}
+	conn, err := dialer.DialContext(ctx, "tcp", address)
+	if err != nil {
+		return nil, fmt.Errorf("failed to dial %s: %w", address, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	var hostKey ssh.PublicKey
+	errScanned := errors.New("host key scanned")
+	_, _, _, err = ssh.NewClientConn(conn, address, &ssh.ClientConfig{
+		User: "forge",
+		HostKeyCallback: func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			hostKey = key
+			return errScanned
+		},
+	})
+	if hostKey == nil {
+		return nil, fmt.Errorf("failed to read host key of %s: %w", address, err)
+	}
+	return hostKey, nil
+}
+
+// KnownHost is an entry of a known_hosts file
+type KnownHost struct {
+	Hosts []string
+	Key   ssh.PublicKey
+}
+
+// KnownHosts is a HostKeyStore kept in an OpenSSH known_hosts file, so keys
+// are shared with ssh and ssh-keyscan. Hashed hostnames and wildcard
+// patterns are matched. Keys on @revoked lines are refused, and
+// @cert-authority lines are ignored.
+type KnownHosts struct {
+	path string
+	mu   sync.Mutex
+}
+
+var (
+	knownHostsMu    sync.Mutex
+	knownHostsFiles = make(map[string]*KnownHosts)
+)
+
+// OpenKnownHosts returns the store for a known_hosts file, DefaultKnownHostsFile
+// if path is empty. Every connection using the same file shares one store, so
+// hosts trusted concurrently are all recorded.
+func OpenKnownHosts(path string) *KnownHosts {
+	if path == "" {
+		path = DefaultKnownHostsFile
+	}
+	path = expandHome(path)
+
+	knownHostsMu.Lock()
+	defer knownHostsMu.Unlock()
+	store, ok := knownHostsFiles[path]
+	if !ok {
+		store = &KnownHosts{path: path}
+		knownHostsFiles[path] = store
+	}
+	return store
+}
+
+// Path returns the known_hosts file
+func (k *KnownHosts) Path() string {
+	return k.path
+}
+
+// Lookup returns the keys trusted for a host
+func (k *KnownHosts) Lookup(address string) ([]ssh.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entries, _, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	return matchingKeys(entries, address), nil
+}
+
+// Revoked returns the keys revoked for a host
+func (k *KnownHosts) Revoked(address string) ([]ssh.PublicKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	_, revoked, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	return matchingKeys(revoked, address), nil
+}
+
+// matchingKeys returns the keys of the entries that apply to a host
+func matchingKeys(entries []knownHostsEntry, address string) []ssh.PublicKey {
+	normalized := knownhosts.Normalize(address)
+	var keys []ssh.PublicKey
+	for _, entry := range entries {
+		if entry.matches(normalized) {
+			keys = append(keys, entry.Key)
+		}
+	}
+	return keys
+}
+
+// Add appends a trusted key for a host
+func (k *KnownHosts) Add(address string, key ssh.PublicKey) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(k.path), 0700); err != nil {
+		return fmt.Errorf("failed to create known hosts directory: %w", err)
+	}
+	file, err := os.OpenFile(k.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open known hosts file: %w", err)
+	}
+	defer file.Close()
+
+	line := knownhosts.Line([]string{knownhosts.Normalize(address)}, key)
+	if _, err := fmt.Fprintln(file, line); err != nil {
+		return fmt.Errorf("failed to write known hosts file: %w", err)
+	}
+	return nil
+}
+
+// Remove deletes every entry that matches a host and returns how many were removed
+func (k *KnownHosts) Remove(address string) (int, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entries, _, lines, err := k.read()
+	if err != nil {
+		return 0, err
+	}
+	normalized := knownhosts.Normalize(address)
+	removed := make(map[int]bool)
+	for _, entry := range entries {
+		if entry.matches(normalized) {
+			removed[entry.line] = true
+		}
+	}
+	if len(removed) == 0 {
+		return 0, nil
+	}
+
+	var kept bytes.Buffer
+	for i, line := range lines {
+		if !removed[i] {
+			kept.WriteString(line)
+			kept.WriteByte('\n')
+		}
+	}
+	tmp := k.path + ".tmp"
+	if err := os.WriteFile(tmp, kept.Bytes(), 0600); err != nil {
+		return 0, fmt.Errorf("failed to write known hosts file: %w", err)
+	}
+	if err := os.Rename(tmp, k.path); err != nil {
+		return 0, fmt.Errorf("failed to write known hosts file: %w", err)
+	}
+	return len(removed), nil
+}
+
+// List returns every trusted key
+func (k *KnownHosts) List() ([]KnownHost, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	entries, _, _, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]KnownHost, len(entries))
+	for i, entry := range entries {
+		hosts[i] = entry.KnownHost
+	}
+	return hosts, nil
+}
+
+// knownHostsEntry is a parsed known_hosts line
+type knownHostsEntry struct {
+	KnownHost
+	line int
+}
+
+// read parses the file, returning its trusted and revoked entries and raw
+// lines. A missing file has no entries.
+func (k *KnownHosts) read() ([]knownHostsEntry, []knownHostsEntry, []string, error) {
+	data, err := os.ReadFile(k.path)
+	if os.IsNotExist(err) {
+		return nil, nil, nil, nil
+	}
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read known hosts file: %w", err)
+	}
+
+	var entries, revoked []knownHostsEntry
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		lines = append(lines, line)
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+		marker, hosts, key, _, _, err := ssh.ParseKnownHosts([]byte(trimmed))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s:%d: %w", k.path, len(lines), err)
+		}
+		entry := knownHostsEntry{KnownHost: KnownHost{Hosts: hosts, Key: key}, line: len(lines) - 1}
+		switch marker {
+		case "":
+			entries = append(entries, entry)
+		case "revoked":
+			revoked = append(revoked, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, nil, fmt.Errorf("failed to read known hosts file: %w", err)
+	}
+	return entries, revoked, lines, nil
+}
+
+// matches reports whether an entry applies to a normalized host. A negated
+// pattern that matches excludes the host.
+func (e knownHostsEntry) matches(host string) bool {
+	matched := false
+	for _, pattern := range e.Hosts {
+		negated := strings.HasPrefix(pattern, "!")
+		if negated {
+			pattern = pattern[1:]
+		}
+		if !matchHostPattern(pattern, host) {
+			continue
+		}
+		if negated {
+			return false
+		}
+		matched = true
+	}
+	return matched
+}
+
+// matchHostPattern matches a host against a plain, wildcard or hashed
+// known_hosts pattern
+func matchHostPattern(pattern, host string) bool {
+	if strings.HasPrefix(pattern, "|1|") {
+		parts := strings.Split(pattern[3:], "|")
+		if len(parts) != 2 {
+			return false
+		}
+		salt, err := base64.StdEncoding.DecodeString(parts[0])
+		if err != nil {
+			return false
+		}
+		want, err := base64.StdEncoding.DecodeString(parts[1])
+		if err != nil {
+			return false
+		}
+		mac := hmac.New(sha1.New, salt)
+		mac.Write([]byte(host))
+		return hmac.Equal(mac.Sum(nil), want)
+	}
+	return matchWildcard(pattern, host)
+}
+
+// matchWildcard matches OpenSSH patterns, where * matches any run of
+// characters and ? any single one; brackets are literal
+func matchWildcard(pattern, s string) bool {
+	for len(pattern) > 0 {
+		switch pattern[0] {
+		case '*':
+			for i := len(s); i >= 0; i-- {
+				if matchWildcard(pattern[1:], s[i:]) {
+					return true
+				}
+			}
+			return false
+		case '?':
+			if len(s) == 0 {
+				return false
+			}
+		default:
+			if len(s) == 0 || s[0] != pattern[0] {
+				return false
+			}
+		}
+		pattern, s = pattern[1:], s[1:]
+	}
+	return len(s) == 0
+}
@@ -0,0 +1,296 @@
+package ssh
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// testHostKey generates an ed25519 host key
+func testHostKey(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := ssh.NewSignerFromKey(private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signer
+}
+
+// hashHost hashes a hostname the way ssh-keygen -H does
+func hashHost(host string) string {
+	salt := []byte("0123456789abcdefghij")
+	mac := hmac.New(sha1.New, salt)
+	mac.Write([]byte(host))
+	return fmt.Sprintf("|1|%s|%s", base64.StdEncoding.EncodeToString(salt), base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+}
+
+func TestKnownHosts(t *testing.T) {
+	web := testHostKey(t).PublicKey()
+	db := testHostKey(t).PublicKey()
+	other := testHostKey(t).PublicKey()
+	wildcard := testHostKey(t).PublicKey()
+	hashed := testHostKey(t).PublicKey()
+
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	contents := strings.Join([]string{
+		"# trusted hosts",
+		"web1.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(web))),
+		"[db1.example.com]:2222 " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(db))),
+		"*.internal,!bastion.internal " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(wildcard))),
+		hashHost("10.0.0.5") + " " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(hashed))),
+		"@revoked web1.example.com " + strings.TrimSpace(string(ssh.MarshalAuthorizedKey(other))),
+		"",
+	}, "\n")
+	if err := os.WriteFile(file, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	store := OpenKnownHosts(file)
+
+	tests := []struct {
+		name    string
+		address string
+		want    []ssh.PublicKey
+	}{
+		{name: "plain", address: "web1.example.com:22", want: []ssh.PublicKey{web}},
+		{name: "non-default port", address: "db1.example.com:2222", want: []ssh.PublicKey{db}},
+		{name: "wrong port", address: "db1.example.com:22"},
+		{name: "wildcard", address: "app.internal:22", want: []ssh.PublicKey{wildcard}},
+		{name: "negated", address: "bastion.internal:22"},
+		{name: "hashed", address: "10.0.0.5:22", want: []ssh.PublicKey{hashed}},
+		{name: "unknown", address: "web2.example.com:22"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := store.Lookup(tt.address)
+			if err != nil {
+				t.Fatalf("Lookup() error = %v", err)
+			}
+			if len(keys) != len(tt.want) {
+				t.Fatalf("Lookup() = %d keys, want %d", len(keys), len(tt.want))
+			}
+			for i := range keys {
+				if string(keys[i].Marshal()) != string(tt.want[i].Marshal()) {
+					t.Errorf("Lookup() key %d does not match", i)
+				}
+			}
+		})
+	}
+
+	revoked, err := store.Revoked("web1.example.com:22")
+	if err != nil {
+		t.Fatalf("Revoked() error = %v", err)
+	}
+	if len(revoked) != 1 || string(revoked[0].Marshal()) != string(other.Marshal()) {
+		t.Errorf("Revoked() = %d keys, want the revoked key", len(revoked))
+	}
+	if revoked, _ := store.Revoked("db1.example.com:2222"); len(revoked) != 0 {
+		t.Errorf("Revoked() for another host = %d keys, want none", len(revoked))
+	}
+
+	if store != OpenKnownHosts(file) {
+		t.Error("Expected one store per file")
+	}
+
+	if err := store.Add("web2.example.com:2222", other); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if keys, _ := store.Lookup("web2.example.com:2222"); len(keys) != 1 {
+		t.Errorf("Expected added key to be found, got %d keys", len(keys))
+	}
+
+	removed, err := store.Remove("web1.example.com:22")
+	if err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if removed != 1 {
+		t.Errorf("Remove() = %d, want 1", removed)
+	}
+	hosts, err := store.List()
+	if err != nil {
+		t.Fatalf("List() error = %v", err)
+	}
+	if len(hosts) != 4 {
+		t.Errorf("List() = %d entries, want 4", len(hosts))
+	}
+	data, _ := os.ReadFile(file)
+	if !strings.HasPrefix(string(data), "# trusted hosts\n") || !strings.Contains(string(data), "@revoked") {
+		t.Errorf("Expected comments and other lines to be kept, got:\n%s", data)
+	}
+}
+
+func TestVerifyHostKey(t *testing.T) {
+	known := testHostKey(t).PublicKey()
+	changed := testHostKey(t).PublicKey()
+	revoked := testHostKey(t).PublicKey()
+	ecdsaKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherType, err := ssh.NewPublicKey(&ecdsaKey.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name        string
+		policy      string
+		address     string
+		key         ssh.PublicKey
+		wantErr     bool
+		wantChanged bool
+		wantRevoked bool
+		wantAdded   bool
+	}{
+		{name: "trusted", policy: HostKeyStrict, address: "web1:22", key: known},
+		{name: "changed", policy: HostKeyAcceptNew, address: "web1:22", key: changed, wantErr: true, wantChanged: true},
+		{name: "unknown strict", policy: HostKeyStrict, address: "web2:22", key: known, wantErr: true},
+		{name: "unknown accept-new", policy: HostKeyAcceptNew, address: "web2:22", key: known, wantAdded: true},
+		{name: "new key type", policy: HostKeyAcceptNew, address: "web1:22", key: otherType, wantAdded: true},
+		{name: "revoked strict", policy: HostKeyStrict, address: "web2:22", key: revoked, wantErr: true, wantRevoked: true},
+		{name: "revoked accept-new", policy: HostKeyAcceptNew, address: "web2:22", key: revoked, wantErr: true, wantRevoked: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := filepath.Join(t.TempDir(), "known_hosts")
+			if err := os.WriteFile(file, []byte("@revoked * "+string(ssh.MarshalAuthorizedKey(revoked))), 0600); err != nil {
+				t.Fatal(err)
+			}
+			store := OpenKnownHosts(file)
+			if err := store.Add("web1:22", known); err != nil {
+				t.Fatal(err)
+			}
+
+			before, _ := store.Lookup(tt.address)
+			err := verifyHostKey(store, tt.policy)(tt.address, nil, tt.key)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("verify error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var hostKeyErr *HostKeyError
+			if tt.wantErr && (!errors.As(err, &hostKeyErr) || hostKeyErr.Changed != tt.wantChanged || hostKeyErr.Revoked != tt.wantRevoked) {
+				t.Errorf("Expected HostKeyError with Changed = %v and Revoked = %v, got %v", tt.wantChanged, tt.wantRevoked, err)
+			}
+			after, _ := store.Lookup(tt.address)
+			if added := len(after) > len(before); added != tt.wantAdded {
+				t.Errorf("added = %v, want %v", added, tt.wantAdded)
+			}
+		})
+	}
+}
+
+// serveHostKey runs an SSH server that presents a host key and accepts any password
+func serveHostKey(t *testing.T, hostKey ssh.Signer) string {
+	t.Helper()
+	server := &ssh.ServerConfig{
+		PasswordCallback: func(conn ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			return nil, nil
+		},
+	}
+	server.AddHostKey(hostKey)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				if serverConn, _, _, err := ssh.NewServerConn(conn, server); err == nil {
+					serverConn.Close()
+				}
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestHostKeyPolicy_Connect(t *testing.T) {
+	hostKey := testHostKey(t)
+	address := serveHostKey(t, hostKey)
+	host, port, _ := net.SplitHostPort(address)
+	var portNumber int
+	fmt.Sscan(port, &portNumber)
+
+	scanned, err := ScanHostKey(context.Background(), address, 5*time.Second)
+	if err != nil {
+		t.Fatalf("ScanHostKey() error = %v", err)
+	}
+	if ssh.FingerprintSHA256(scanned) != ssh.FingerprintSHA256(hostKey.PublicKey()) {
+		t.Errorf("ScanHostKey() = %s, want %s", ssh.FingerprintSHA256(scanned), ssh.FingerprintSHA256(hostKey.PublicKey()))
+	}
+
+	knownHosts := filepath.Join(t.TempDir(), "known_hosts")
+	connect := func(policy string) error {
+		conn := NewConnection(&ConnectionConfig{
+			Host:           host,
+			Port:           portNumber,
+			User:           "deploy",
+			Password:       "secret",
+			IdentityAgent:  IdentityAgentNone,
+			HostKeyPolicy:  policy,
+			KnownHostsFile: knownHosts,
+		})
+		if err := conn.Connect(context.Background()); err != nil {
+			return err
+		}
+		conn.Close()
+		return nil
+	}
+
+	var hostKeyErr *HostKeyError
+	if err := connect(HostKeyStrict); !errors.As(err, &hostKeyErr) {
+		t.Fatalf("Expected strict policy to refuse an unknown host, got %v", err)
+	}
+	if err := connect(HostKeyAcceptNew); err != nil {
+		t.Fatalf("Expected accept-new to trust the host, got %v", err)
+	}
+	if err := connect(HostKeyStrict); err != nil {
+		t.Fatalf("Expected strict policy to accept the trusted host, got %v", err)
+	}
+}
+
+func TestConnectionConfig_HostKeyPolicy(t *testing.T) {
+	tests := []struct {
+		name   string
+		config ConnectionConfig
+		want   string
+	}{
+		{name: "default", want: HostKeyAcceptNew},
+		{name: "strict_host_check", config: ConnectionConfig{StrictHostCheck: true}, want: HostKeyStrict},
+		{name: "explicit", config: ConnectionConfig{StrictHostCheck: true, HostKeyPolicy: HostKeyOff}, want: HostKeyOff},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.config.hostKeyPolicy(); got != tt.want {
+				t.Errorf("hostKeyPolicy() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
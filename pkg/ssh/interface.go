@@ -1,6 +1,9 @@
 package ssh
 
-import "context"
+import (
+	"context"
+	"io"
+)
 
 // Executor defines the interface for executing commands remotely
 type Executor interface {
@@ -9,5 +12,18 @@ type Executor interface {
 	Close() error
 }
 
+// InputExecutor is implemented by executors that can feed data to the
+// standard input of a command, such as a password that must not appear in
+// the command line
+type InputExecutor interface {
+	ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error)
+}
+
 // Ensure Connection implements Executor
 var _ Executor = (*Connection)(nil)
+
+// Ensure the SSH and local executors can feed standard input
+var (
+	_ InputExecutor = (*RealSSHConnection)(nil)
+	_ InputExecutor = (*LocalExecutor)(nil)
+)
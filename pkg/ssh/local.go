@@ -2,25 +2,47 @@ package ssh
 
 import (
 	"context"
+	"io"
 	"os/exec"
 )
 
-// LocalExecutor executes commands locally for testing
+// LocalExecutor executes commands on the machine forge runs on, without SSH
 type LocalExecutor struct{}
 
 // Execute runs a command locally using shell
 func (l *LocalExecutor) Execute(ctx context.Context, command string) (*ExecuteResult, error) {
+	return l.ExecuteWithInput(ctx, command, nil)
+}
+
+// ExecuteWithInput runs a command locally with input on its standard input
+func (l *LocalExecutor) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
 	// Use shell to execute the command properly
 	cmd := exec.CommandContext(ctx, "/bin/sh", "-c", command)
-	
-	stdout, err := cmd.Output()
+	cmd.Stdin = input
+
+	stdout, stderr := NewOutputBuffer(ctx, StreamStdout), NewOutputBuffer(ctx, StreamStderr)
+	cmd.Stdout, cmd.Stderr = stdout, stderr
+	flush := func() {}
+	if output := outputStream(ctx); output != nil {
+		stdoutLines := &lineWriter{stream: StreamStdout, output: output}
+		stderrLines := &lineWriter{stream: StreamStderr, output: output}
+		cmd.Stdout = io.MultiWriter(stdout, stdoutLines)
+		cmd.Stderr = io.MultiWriter(stderr, stderrLines)
+		flush = func() {
+			stdoutLines.Flush()
+			stderrLines.Flush()
+		}
+	}
+
+	err := cmd.Run()
+	flush()
 	if err != nil {
 		if exitError, ok := err.(*exec.ExitError); ok {
 			return &ExecuteResult{
 				Command:  command,
 				ExitCode: exitError.ExitCode(),
-				Stdout:   string(stdout),
-				Stderr:   string(exitError.Stderr),
+				Stdout:   stdout.String(),
+				Stderr:   stderr.String(),
 			}, nil
 		}
 		return nil, err
@@ -29,8 +51,8 @@ func (l *LocalExecutor) Execute(ctx context.Context, command string) (*ExecuteRe
 	return &ExecuteResult{
 		Command:  command,
 		ExitCode: 0,
-		Stdout:   string(stdout),
-		Stderr:   "",
+		Stdout:   stdout.String(),
+		Stderr:   stderr.String(),
 	}, nil
 }
 
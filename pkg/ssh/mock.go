@@ -3,11 +3,18 @@ package ssh
 import (
 	"context"
 	"fmt"
+	"sync"
 )
 
-// MockExecutor is a mock implementation of the Executor interface for testing
+// MockResponder answers the commands run on a MockExecutor
+type MockResponder func(command string) (*ExecuteResult, error)
+
+// MockExecutor is a mock implementation of the Executor interface for testing.
+// Commands succeed with "mock output" unless a responder answers them.
 type MockExecutor struct {
+	mu        sync.Mutex
 	connected bool
+	respond   MockResponder
 }
 
 // NewMockExecutor creates a new mock executor
@@ -15,11 +22,24 @@ func NewMockExecutor() *MockExecutor {
 	return &MockExecutor{}
 }
 
+// SetResponder sets how commands are answered once connected
+func (m *MockExecutor) SetResponder(respond MockResponder) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.respond = respond
+}
+
 // Execute executes a command (mock implementation)
 func (m *MockExecutor) Execute(ctx context.Context, command string) (*ExecuteResult, error) {
-	if !m.connected {
+	m.mu.Lock()
+	connected, respond := m.connected, m.respond
+	m.mu.Unlock()
+	if !connected {
 		return nil, fmt.Errorf("not connected")
 	}
+	if respond != nil {
+		return respond(command)
+	}
 	
 	// Mock successful execution
 	return &ExecuteResult{
@@ -31,12 +51,16 @@ func (m *MockExecutor) Execute(ctx context.Context, command string) (*ExecuteRes
 
 // Connect establishes a connection (mock implementation)
 func (m *MockExecutor) Connect(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.connected = true
 	return nil
 }
 
 // Close closes the connection (mock implementation)
 func (m *MockExecutor) Close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	m.connected = false
 	return nil
 }
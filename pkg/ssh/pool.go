@@ -0,0 +1,599 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Pool defaults. OpenSSH allows 10 sessions per connection (MaxSessions), so
+// the default stays below that.
+const (
+	DefaultMaxConnectionsPerHost    = 4
+	DefaultMaxSessionsPerConnection = 8
+)
+
+// PoolConfig limits the connections a ConnectionPool opens
+type PoolConfig struct {
+	// MaxConnectionsPerHost caps the connections to one target
+	MaxConnectionsPerHost int `mapstructure:"max_connections_per_host"`
+
+	// MaxConnections caps the connections to all targets. 0 means no limit.
+	MaxConnections int `mapstructure:"max_connections"`
+
+	// MaxSessionsPerConnection caps the commands multiplexed over one connection
+	MaxSessionsPerConnection int `mapstructure:"max_sessions_per_connection"`
+
+	// ConnectRate caps the connections opened per second to all targets,
+	// and HostConnectInterval is the least time between connections opened
+	// to one target, so large runs do not look like a scan. 0 means no limit.
+	ConnectRate         float64       `mapstructure:"connect_rate"`
+	HostConnectInterval time.Duration `mapstructure:"host_connect_interval"`
+}
+
+// SetDefaults fills in unset limits and keeps the per-host limit within the global one
+func (c *PoolConfig) SetDefaults() {
+	if c.MaxConnectionsPerHost <= 0 {
+		c.MaxConnectionsPerHost = DefaultMaxConnectionsPerHost
+	}
+	if c.MaxConnections > 0 && c.MaxConnectionsPerHost > c.MaxConnections {
+		c.MaxConnectionsPerHost = c.MaxConnections
+	}
+	if c.MaxSessionsPerConnection <= 0 {
+		c.MaxSessionsPerConnection = DefaultMaxSessionsPerConnection
+	}
+}
+
+// Validate checks the limits are not negative
+func (c *PoolConfig) Validate() error {
+	if c.MaxConnectionsPerHost < 0 || c.MaxConnections < 0 || c.MaxSessionsPerConnection < 0 {
+		return fmt.Errorf("connection limits cannot be negative")
+	}
+	if c.ConnectRate < 0 || c.HostConnectInterval < 0 {
+		return fmt.Errorf("connection rates cannot be negative")
+	}
+	return nil
+}
+
+// SessionError reports that a connection refused to open a session for a
+// command, so the command never started
+type SessionError struct {
+	Err error
+}
+
+func (e *SessionError) Error() string {
+	return fmt.Sprintf("failed to create SSH session: %v", e.Err)
+}
+
+func (e *SessionError) Unwrap() error {
+	return e.Err
+}
+
+// refused reports whether the server turned the session down because the
+// connection already has as many sessions as it allows
+func (e *SessionError) refused() bool {
+	var openErr *ssh.OpenChannelError
+	return errors.As(e.Err, &openErr) && openErr.Reason == ssh.Prohibited
+}
+
+// poolClient is an open connection that runs each command in its own session
+type poolClient interface {
+	run(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error)
+	Close() error
+}
+
+// dialFunc opens a connection to a target
+type dialFunc func(ctx context.Context, config *ConnectionConfig) (poolClient, error)
+
+// dialSSH opens an SSH connection with the retries and authentication of RealSSHConnection
+func dialSSH(ctx context.Context, config *ConnectionConfig) (poolClient, error) {
+	conn := NewRealSSHConnection(config)
+	if err := conn.Connect(ctx); err != nil {
+		return nil, err
+	}
+	return conn, nil
+}
+
+// pooledClient is a connection in the pool
+type pooledClient struct {
+	client   poolClient
+	sessions int
+	capacity int
+}
+
+// hostConnections are the connections to one target
+type hostConnections struct {
+	clients []*pooledClient
+	dialing int
+	// nextDial is the earliest time another connection may be opened
+	nextDial time.Time
+}
+
+// slotWaiter is a command waiting for a connection slot under the global limit
+type slotWaiter struct {
+	key string
+}
+
+// PoolMetrics describe how a pool's connections were used
+type PoolMetrics struct {
+	// Open is the number of connections open now and Peak the most that
+	// were open at once
+	Open int
+	Peak int
+	// Dialed counts the connections opened, Evicted the idle ones closed to
+	// make room for connections to other targets
+	Dialed  int
+	Evicted int
+	// Waits counts the commands that waited for a session or connection
+	// slot, for WaitTime in total and LongestWait at most
+	Waits       int
+	WaitTime    time.Duration
+	LongestWait time.Duration
+	// Throttled counts the connections delayed by the connection rates
+	Throttled int
+}
+
+// ConnectionPool shares SSH connections between everything that runs
+// commands on a target. Commands are multiplexed as sessions over a few
+// long-lived connections per target, like OpenSSH's ControlMaster, instead
+// of each opening its own. When every connection is busy and the limits
+// allow no more, commands wait for a free session. Slots under the global
+// limit go to the waiting target with the fewest connections, so no target
+// is starved on large runs. It is safe for concurrent use.
+type ConnectionPool struct {
+	config PoolConfig
+	dial   dialFunc
+
+	mu       sync.Mutex
+	hosts    map[string]*hostConnections
+	total    int
+	changed  chan struct{}
+	waiters  []*slotWaiter
+	nextDial time.Time
+	metrics  PoolMetrics
+}
+
+// NewConnectionPool creates a connection pool with the given limits
+func NewConnectionPool(config PoolConfig) *ConnectionPool {
+	config.SetDefaults()
+	return &ConnectionPool{
+		config:  config,
+		dial:    dialSSH,
+		hosts:   make(map[string]*hostConnections),
+		changed: make(chan struct{}),
+	}
+}
+
+// poolKey identifies a target's connections
+func poolKey(config *ConnectionConfig) string {
+	port := config.Port
+	if port == 0 {
+		port = 22
+	}
+	return fmt.Sprintf("%s@%s:%d", config.User, config.Host, port)
+}
+
+// Executor returns an executor that runs commands on the target through the pool
+func (p *ConnectionPool) Executor(config *ConnectionConfig) Executor {
+	copied := *config
+	return &PooledExecutor{pool: p, config: &copied, key: poolKey(&copied)}
+}
+
+// Stats returns the number of open connections per target
+func (p *ConnectionPool) Stats() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := make(map[string]int, len(p.hosts))
+	for key, host := range p.hosts {
+		if len(host.clients) > 0 {
+			stats[key] = len(host.clients)
+		}
+	}
+	return stats
+}
+
+// Metrics returns how the pool's connections have been used so far
+func (p *ConnectionPool) Metrics() PoolMetrics {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	metrics := p.metrics
+	metrics.Open = p.total
+	return metrics
+}
+
+// acquire returns a connection to the target with a free session, dialing a
+// new one if the limits allow and waiting otherwise
+func (p *ConnectionPool) acquire(ctx context.Context, key string, config *ConnectionConfig) (*pooledClient, error) {
+	var waiter *slotWaiter
+	var waitStart time.Time
+	// done stops waiting; it must be called with the lock held
+	done := func() {
+		if waiter != nil && p.dequeue(waiter) {
+			// The waiter may have been next in line
+			p.notify()
+		}
+		waiter = nil
+		if !waitStart.IsZero() {
+			p.recordWait(time.Since(waitStart))
+		}
+	}
+
+	for {
+		p.mu.Lock()
+		host := p.host(key)
+		if client := host.available(); client != nil {
+			client.sessions++
+			done()
+			p.mu.Unlock()
+			return client, nil
+		}
+
+		if len(host.clients)+host.dialing < p.config.MaxConnectionsPerHost {
+			// Commands queued for a slot go first, fewest connections first
+			if p.next() == waiter {
+				if ok, evicted := p.reserve(key); ok {
+					host.dialing++
+					done()
+					p.mu.Unlock()
+					if evicted != nil {
+						evicted.Close()
+					}
+					return p.connect(ctx, key, config)
+				}
+			}
+			if waiter == nil {
+				waiter = &slotWaiter{key: key}
+				p.waiters = append(p.waiters, waiter)
+			}
+		}
+
+		if waitStart.IsZero() {
+			waitStart = time.Now()
+		}
+		wait := p.changed
+		p.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			p.mu.Lock()
+			done()
+			p.mu.Unlock()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// recordWait adds a command's wait to the metrics. It must be called with
+// the lock held.
+func (p *ConnectionPool) recordWait(waited time.Duration) {
+	p.metrics.Waits++
+	p.metrics.WaitTime += waited
+	if waited > p.metrics.LongestWait {
+		p.metrics.LongestWait = waited
+	}
+}
+
+// next returns the queued command whose target gets the next connection
+// slot: the one with the fewest connections, the longest waiting among
+// equals. Targets at their own limit are passed over. It must be called
+// with the lock held.
+func (p *ConnectionPool) next() *slotWaiter {
+	var best *slotWaiter
+	bestOpen := 0
+	for _, waiter := range p.waiters {
+		host := p.host(waiter.key)
+		open := len(host.clients) + host.dialing
+		if open >= p.config.MaxConnectionsPerHost {
+			continue
+		}
+		if best == nil || open < bestOpen {
+			best, bestOpen = waiter, open
+		}
+	}
+	return best
+}
+
+// dequeue removes a command from the slot queue, reporting whether it was
+// queued. It must be called with the lock held.
+func (p *ConnectionPool) dequeue(waiter *slotWaiter) bool {
+	for i, queued := range p.waiters {
+		if queued == waiter {
+			p.waiters = append(p.waiters[:i], p.waiters[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// throttle waits until the connection rates allow another connection to
+// the target and books its time
+func (p *ConnectionPool) throttle(ctx context.Context, key string) error {
+	if p.config.ConnectRate <= 0 && p.config.HostConnectInterval <= 0 {
+		return nil
+	}
+
+	p.mu.Lock()
+	now := time.Now()
+	host := p.host(key)
+	at := now
+	if p.config.ConnectRate > 0 && p.nextDial.After(at) {
+		at = p.nextDial
+	}
+	if host.nextDial.After(at) {
+		at = host.nextDial
+	}
+	if p.config.ConnectRate > 0 {
+		p.nextDial = at.Add(time.Duration(float64(time.Second) / p.config.ConnectRate))
+	}
+	host.nextDial = at.Add(p.config.HostConnectInterval)
+	delay := at.Sub(now)
+	if delay > 0 {
+		p.metrics.Throttled++
+	}
+	p.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// connect dials a connection whose slot has been reserved and adds it to the pool
+func (p *ConnectionPool) connect(ctx context.Context, key string, config *ConnectionConfig) (*pooledClient, error) {
+	err := p.throttle(ctx, key)
+	var client poolClient
+	if err == nil {
+		client, err = p.dial(ctx, config)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	host := p.host(key)
+	host.dialing--
+	defer p.notify()
+	if err != nil {
+		p.total--
+		return nil, err
+	}
+	pooled := &pooledClient{client: client, sessions: 1, capacity: p.config.MaxSessionsPerConnection}
+	host.clients = append(host.clients, pooled)
+	p.metrics.Dialed++
+	if p.total > p.metrics.Peak {
+		p.metrics.Peak = p.total
+	}
+	return pooled, nil
+}
+
+// reserve claims a connection slot under the global limit. At the limit, an
+// idle connection to another target is evicted to make room and returned
+// for the caller to close. It must be called with the lock held.
+func (p *ConnectionPool) reserve(key string) (bool, poolClient) {
+	if p.config.MaxConnections == 0 || p.total < p.config.MaxConnections {
+		p.total++
+		return true, nil
+	}
+
+	keys := make([]string, 0, len(p.hosts))
+	for other := range p.hosts {
+		keys = append(keys, other)
+	}
+	sort.Strings(keys)
+	for _, other := range keys {
+		if other == key {
+			continue
+		}
+		host := p.hosts[other]
+		for i, client := range host.clients {
+			if client.sessions == 0 {
+				host.clients = append(host.clients[:i], host.clients[i+1:]...)
+				p.metrics.Evicted++
+				return true, client.client
+			}
+		}
+	}
+	return false, nil
+}
+
+// release returns a session to the pool. A broken connection is removed
+// and returned for the caller to close.
+func (p *ConnectionPool) release(key string, client *pooledClient, broken bool) poolClient {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.notify()
+
+	client.sessions--
+	if !broken {
+		return nil
+	}
+	if p.remove(key, client) {
+		return client.client
+	}
+	return nil
+}
+
+// remove drops a connection from the pool. It must be called with the lock held.
+func (p *ConnectionPool) remove(key string, client *pooledClient) bool {
+	host := p.hosts[key]
+	if host == nil {
+		return false
+	}
+	for i, existing := range host.clients {
+		if existing == client {
+			host.clients = append(host.clients[:i], host.clients[i+1:]...)
+			p.total--
+			return true
+		}
+	}
+	return false
+}
+
+// limitSessions lowers a connection's session capacity after the server
+// refused a session, since its MaxSessions is below the pool's. It reports
+// whether other sessions are in flight, which makes retrying worthwhile.
+func (p *ConnectionPool) limitSessions(client *pooledClient) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	others := client.sessions - 1
+	if others < 1 {
+		return false
+	}
+	if others < client.capacity {
+		client.capacity = others
+	}
+	return true
+}
+
+// host returns the connections to a target. It must be called with the lock held.
+func (p *ConnectionPool) host(key string) *hostConnections {
+	host, exists := p.hosts[key]
+	if !exists {
+		host = &hostConnections{}
+		p.hosts[key] = host
+	}
+	return host
+}
+
+// available returns the least busy connection with a free session
+func (h *hostConnections) available() *pooledClient {
+	var best *pooledClient
+	for _, client := range h.clients {
+		if client.sessions < client.capacity && (best == nil || client.sessions < best.sessions) {
+			best = client
+		}
+	}
+	return best
+}
+
+// notify wakes commands waiting for a session. It must be called with the lock held.
+func (p *ConnectionPool) notify() {
+	close(p.changed)
+	p.changed = make(chan struct{})
+}
+
+// closeHost closes every connection to a target
+func (p *ConnectionPool) closeHost(key string) error {
+	p.mu.Lock()
+	host := p.hosts[key]
+	delete(p.hosts, key)
+	var clients []*pooledClient
+	if host != nil {
+		clients = host.clients
+		p.total -= len(clients)
+	}
+	p.notify()
+	p.mu.Unlock()
+
+	var errs []error
+	for _, client := range clients {
+		if err := client.client.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors closing connections to %s: %v", key, errs)
+	}
+	return nil
+}
+
+// CloseAll closes every connection in the pool
+func (p *ConnectionPool) CloseAll() error {
+	p.mu.Lock()
+	keys := make([]string, 0, len(p.hosts))
+	for key := range p.hosts {
+		keys = append(keys, key)
+	}
+	p.mu.Unlock()
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		if err := p.closeHost(key); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("errors closing connections: %v", errs)
+	}
+	return nil
+}
+
+// PooledExecutor runs commands on one target over the pool's shared connections
+type PooledExecutor struct {
+	pool   *ConnectionPool
+	config *ConnectionConfig
+	key    string
+}
+
+// Ensure PooledExecutor implements Executor and InputExecutor
+var (
+	_ Executor      = (*PooledExecutor)(nil)
+	_ InputExecutor = (*PooledExecutor)(nil)
+)
+
+// Connect makes sure a connection to the target can be opened, so
+// unreachable targets and bad credentials are reported up front
+func (e *PooledExecutor) Connect(ctx context.Context) error {
+	client, err := e.pool.acquire(ctx, e.key, e.config)
+	if err != nil {
+		return err
+	}
+	e.pool.release(e.key, client, false)
+	return nil
+}
+
+// Execute runs a command in a session on one of the target's connections
+func (e *PooledExecutor) Execute(ctx context.Context, command string) (*ExecuteResult, error) {
+	return e.ExecuteWithInput(ctx, command, nil)
+}
+
+// ExecuteWithInput runs a command like Execute, with input on its standard input
+func (e *PooledExecutor) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
+	// A connection that dropped is replaced once; the command had not started
+	redialed := false
+	for {
+		client, err := e.pool.acquire(ctx, e.key, e.config)
+		if err != nil {
+			return nil, err
+		}
+
+		result, err := client.client.run(ctx, command, input)
+		var sessionErr *SessionError
+		if !errors.As(err, &sessionErr) {
+			e.pool.release(e.key, client, false)
+			return result, err
+		}
+
+		if sessionErr.refused() && e.pool.limitSessions(client) {
+			e.pool.release(e.key, client, false)
+			continue
+		}
+		if broken := e.pool.release(e.key, client, true); broken != nil {
+			broken.Close()
+		}
+		if redialed {
+			return nil, err
+		}
+		redialed = true
+	}
+}
+
+// Close closes the target's connections
+func (e *PooledExecutor) Close() error {
+	return e.pool.closeHost(e.key)
+}
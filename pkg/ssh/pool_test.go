@@ -0,0 +1,415 @@
+package ssh
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// fakeClient runs commands by waiting on a gate, so tests control how many are in flight
+type fakeClient struct {
+	id     int
+	gate   chan struct{}
+	limit  int
+	fail   error
+	mu     sync.Mutex
+	active int
+	peak   int
+	closed bool
+}
+
+func (c *fakeClient) run(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
+	c.mu.Lock()
+	if c.fail != nil {
+		c.mu.Unlock()
+		return nil, &SessionError{Err: c.fail}
+	}
+	if c.limit > 0 && c.active >= c.limit {
+		c.mu.Unlock()
+		return nil, &SessionError{Err: &ssh.OpenChannelError{Reason: ssh.Prohibited, Message: "open failed"}}
+	}
+	c.active++
+	if c.active > c.peak {
+		c.peak = c.active
+	}
+	c.mu.Unlock()
+
+	if c.gate != nil {
+		<-c.gate
+	}
+
+	c.mu.Lock()
+	c.active--
+	c.mu.Unlock()
+	return &ExecuteResult{Command: command, Stdout: fmt.Sprintf("client %d", c.id)}, nil
+}
+
+func (c *fakeClient) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.closed = true
+	return nil
+}
+
+// fakeDialer hands out fake clients and counts dials per host
+type fakeDialer struct {
+	mu      sync.Mutex
+	gate    chan struct{}
+	limit   int
+	clients []*fakeClient
+	dials   map[string]int
+	order   []string
+	times   []time.Time
+	err     error
+}
+
+func (d *fakeDialer) dial(ctx context.Context, config *ConnectionConfig) (poolClient, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.err != nil {
+		return nil, d.err
+	}
+	if d.dials == nil {
+		d.dials = make(map[string]int)
+	}
+	d.dials[config.Host]++
+	d.order = append(d.order, config.Host)
+	d.times = append(d.times, time.Now())
+	client := &fakeClient{id: len(d.clients), gate: d.gate, limit: d.limit}
+	d.clients = append(d.clients, client)
+	return client, nil
+}
+
+func newTestPool(config PoolConfig, dialer *fakeDialer) *ConnectionPool {
+	pool := NewConnectionPool(config)
+	pool.dial = dialer.dial
+	return pool
+}
+
+// runConcurrently starts n commands on an executor at once
+func runConcurrently(t *testing.T, executor Executor, n int) (*sync.WaitGroup, []error) {
+	t.Helper()
+	var wg sync.WaitGroup
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, errs[i] = executor.Execute(context.Background(), "true")
+		}(i)
+	}
+	return &wg, errs
+}
+
+// waitFor polls until cond is true
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestPoolConfig(t *testing.T) {
+	tests := []struct {
+		name        string
+		config      PoolConfig
+		wantPerHost int
+		wantErr     bool
+	}{
+		{name: "defaults", config: PoolConfig{}, wantPerHost: DefaultMaxConnectionsPerHost},
+		{name: "global limit", config: PoolConfig{MaxConnectionsPerHost: 2, MaxConnections: 20}, wantPerHost: 2},
+		{name: "per host above global", config: PoolConfig{MaxConnections: 2}, wantPerHost: 2},
+		{name: "negative", config: PoolConfig{MaxConnections: -1}, wantErr: true},
+		{name: "negative rate", config: PoolConfig{ConnectRate: -1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.config.Validate(); (err != nil) != tt.wantErr {
+				t.Fatalf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			tt.config.SetDefaults()
+			if tt.config.MaxConnectionsPerHost != tt.wantPerHost {
+				t.Errorf("MaxConnectionsPerHost = %d, want %d", tt.config.MaxConnectionsPerHost, tt.wantPerHost)
+			}
+		})
+	}
+}
+
+func TestConnectionPool_MultiplexesSessions(t *testing.T) {
+	dialer := &fakeDialer{}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 2, MaxSessionsPerConnection: 3}, dialer)
+	executor := pool.Executor(&ConnectionConfig{Host: "web1", User: "deploy"})
+
+	if err := executor.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	for i := 0; i < 50; i++ {
+		if _, err := executor.Execute(context.Background(), "true"); err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	if dialer.dials["web1"] != 1 {
+		t.Errorf("Expected sequential commands to share one connection, got %d dials", dialer.dials["web1"])
+	}
+
+	// Executors for the same target share its connections
+	if _, err := pool.Executor(&ConnectionConfig{Host: "web1", User: "deploy", Port: 22}).Execute(context.Background(), "true"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if dialer.dials["web1"] != 1 {
+		t.Errorf("Expected executors for one target to share connections, got %d dials", dialer.dials["web1"])
+	}
+
+	if err := executor.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+	if !dialer.clients[0].closed || len(pool.Stats()) != 0 {
+		t.Error("Expected Close() to close the target's connections")
+	}
+}
+
+func TestConnectionPool_PerHostLimit(t *testing.T) {
+	dialer := &fakeDialer{gate: make(chan struct{})}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 2, MaxSessionsPerConnection: 3}, dialer)
+	executor := pool.Executor(&ConnectionConfig{Host: "web1"})
+
+	wg, errs := runConcurrently(t, executor, 10)
+	// Two connections with three sessions each; the other four wait
+	waitFor(t, func() bool {
+		dialer.mu.Lock()
+		defer dialer.mu.Unlock()
+		active := 0
+		for _, client := range dialer.clients {
+			client.mu.Lock()
+			active += client.active
+			client.mu.Unlock()
+		}
+		return active == 6
+	})
+	close(dialer.gate)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	if dialer.dials["web1"] != 2 {
+		t.Errorf("Expected 2 connections, got %d", dialer.dials["web1"])
+	}
+	for _, client := range dialer.clients {
+		if client.peak > 3 {
+			t.Errorf("Expected at most 3 sessions per connection, got %d", client.peak)
+		}
+	}
+}
+
+func TestConnectionPool_GlobalLimitEvictsIdle(t *testing.T) {
+	dialer := &fakeDialer{}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 1, MaxConnections: 2}, dialer)
+
+	for _, host := range []string{"web1", "web2", "web3"} {
+		if _, err := pool.Executor(&ConnectionConfig{Host: host}).Execute(context.Background(), "true"); err != nil {
+			t.Fatalf("Execute() on %s error = %v", host, err)
+		}
+	}
+
+	stats := pool.Stats()
+	if len(stats) != 2 || stats["@web2:22"] != 1 || stats["@web3:22"] != 1 {
+		t.Errorf("Expected 2 open connections including web3, got %v", stats)
+	}
+	if !dialer.clients[0].closed {
+		t.Error("Expected the idle web1 connection to be evicted")
+	}
+	metrics := pool.Metrics()
+	if metrics.Open != 2 || metrics.Peak != 2 || metrics.Dialed != 3 || metrics.Evicted != 1 {
+		t.Errorf("Metrics() = %+v", metrics)
+	}
+}
+
+func TestConnectionPool_GlobalLimitWaits(t *testing.T) {
+	dialer := &fakeDialer{gate: make(chan struct{})}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 1, MaxConnections: 1}, dialer)
+
+	busy, _ := runConcurrently(t, pool.Executor(&ConnectionConfig{Host: "web1"}), 1)
+	waitFor(t, func() bool {
+		dialer.mu.Lock()
+		defer dialer.mu.Unlock()
+		return len(dialer.clients) == 1
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := pool.Executor(&ConnectionConfig{Host: "web2"}).Execute(ctx, "true")
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Expected web2 to wait for a connection slot, got %v", err)
+	}
+
+	close(dialer.gate)
+	busy.Wait()
+	if _, err := pool.Executor(&ConnectionConfig{Host: "web2"}).Execute(context.Background(), "true"); err != nil {
+		t.Errorf("Expected web2 to connect once web1 was idle, got %v", err)
+	}
+	if metrics := pool.Metrics(); metrics.Waits != 1 || metrics.WaitTime < 20*time.Millisecond {
+		t.Errorf("Expected the wait to be recorded, got %+v", metrics)
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	if len(pool.waiters) != 0 {
+		t.Errorf("Expected the cancelled command to leave the queue, %d queued", len(pool.waiters))
+	}
+}
+
+func TestConnectionPool_FairSlots(t *testing.T) {
+	dialer := &fakeDialer{}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 2, MaxConnections: 2, MaxSessionsPerConnection: 1}, dialer)
+	queued := func(n int) func() bool {
+		return func() bool {
+			pool.mu.Lock()
+			defer pool.mu.Unlock()
+			return len(pool.waiters) == n
+		}
+	}
+	dialed := func(n int) func() bool {
+		return func() bool {
+			dialer.mu.Lock()
+			defer dialer.mu.Unlock()
+			return len(dialer.clients) == n
+		}
+	}
+	// start runs a command on a host whose connection, if it dials one, waits on gate
+	start := func(host string, gate chan struct{}) *sync.WaitGroup {
+		dialer.mu.Lock()
+		dialer.gate = gate
+		dialer.mu.Unlock()
+		wg, _ := runConcurrently(t, pool.Executor(&ConnectionConfig{Host: host}), 1)
+		return wg
+	}
+
+	web1, web2 := make(chan struct{}), make(chan struct{})
+	first := start("web1", web1)
+	waitFor(t, dialed(1))
+	second := start("web2", web2)
+	waitFor(t, dialed(2))
+
+	// web1 asks for a second connection before web3 asks for its first
+	third := start("web1", nil)
+	waitFor(t, queued(1))
+	fourth := start("web3", nil)
+	waitFor(t, queued(2))
+
+	close(web2)
+	for _, wg := range []*sync.WaitGroup{second, fourth, third} {
+		wg.Wait()
+	}
+	close(web1)
+	first.Wait()
+
+	want := []string{"web1", "web2", "web3", "web1"}
+	if fmt.Sprint(dialer.order) != fmt.Sprint(want) {
+		t.Errorf("Expected the target without connections to go first, dialed %v", dialer.order)
+	}
+}
+
+func TestConnectionPool_ConnectRates(t *testing.T) {
+	dialer := &fakeDialer{gate: make(chan struct{})}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 3, MaxSessionsPerConnection: 1, HostConnectInterval: 30 * time.Millisecond}, dialer)
+
+	wg, _ := runConcurrently(t, pool.Executor(&ConnectionConfig{Host: "web1"}), 3)
+	waitFor(t, func() bool {
+		dialer.mu.Lock()
+		defer dialer.mu.Unlock()
+		return len(dialer.clients) == 3
+	})
+	close(dialer.gate)
+	wg.Wait()
+	for i := 1; i < len(dialer.times); i++ {
+		if gap := dialer.times[i].Sub(dialer.times[i-1]); gap < 25*time.Millisecond {
+			t.Errorf("Expected connections to web1 30ms apart, got %v", gap)
+		}
+	}
+
+	dialer = &fakeDialer{}
+	pool = newTestPool(PoolConfig{ConnectRate: 50}, dialer)
+	for _, host := range []string{"web1", "web2", "web3"} {
+		if _, err := pool.Executor(&ConnectionConfig{Host: host}).Execute(context.Background(), "true"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := dialer.times[2].Sub(dialer.times[0]); elapsed < 35*time.Millisecond {
+		t.Errorf("Expected 50 connections a second at most, three took %v", elapsed)
+	}
+	if throttled := pool.Metrics().Throttled; throttled != 2 {
+		t.Errorf("Expected 2 throttled connections, got %d", throttled)
+	}
+}
+
+func TestConnectionPool_RefusedSessions(t *testing.T) {
+	// The server allows two sessions though the pool would multiplex eight
+	dialer := &fakeDialer{gate: make(chan struct{}), limit: 2}
+	pool := newTestPool(PoolConfig{MaxConnectionsPerHost: 1}, dialer)
+	executor := pool.Executor(&ConnectionConfig{Host: "web1"})
+
+	wg, errs := runConcurrently(t, executor, 5)
+	waitFor(t, func() bool {
+		dialer.mu.Lock()
+		defer dialer.mu.Unlock()
+		if len(dialer.clients) == 0 {
+			return false
+		}
+		client := dialer.clients[0]
+		client.mu.Lock()
+		defer client.mu.Unlock()
+		return client.active == 2
+	})
+	close(dialer.gate)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Execute() error = %v", err)
+		}
+	}
+	if len(dialer.clients) != 1 || dialer.clients[0].peak != 2 {
+		t.Errorf("Expected commands to queue on the one connection, got %d clients", len(dialer.clients))
+	}
+}
+
+func TestConnectionPool_RedialsDroppedConnection(t *testing.T) {
+	dialer := &fakeDialer{}
+	pool := newTestPool(PoolConfig{}, dialer)
+	executor := pool.Executor(&ConnectionConfig{Host: "web1"})
+
+	if _, err := executor.Execute(context.Background(), "true"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	dialer.clients[0].fail = errors.New("EOF")
+
+	result, err := executor.Execute(context.Background(), "true")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.Stdout != "client 1" || !dialer.clients[0].closed {
+		t.Errorf("Expected the dropped connection to be replaced, ran on %q", result.Stdout)
+	}
+
+	dialer.err = errors.New("connection refused")
+	dialer.clients[1].fail = errors.New("EOF")
+	if _, err := executor.Execute(context.Background(), "true"); err == nil {
+		t.Error("Expected an error when the target cannot be reached again")
+	}
+}
@@ -2,17 +2,13 @@ package ssh
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"os"
-	"path/filepath"
-	"strings"
 	"time"
 
 	"golang.org/x/crypto/ssh"
-	"golang.org/x/crypto/ssh/agent"
-	"golang.org/x/crypto/ssh/knownhosts"
 )
 
 // RealSSHConnection implements the Executor interface using real SSH connections
@@ -24,6 +20,7 @@ type RealSSHConnection struct {
 	timeout    time.Duration
 	retries    int
 	retryDelay time.Duration
+	agentConn  io.Closer
 }
 
 // NewRealSSHConnection creates a new real SSH connection
@@ -42,7 +39,7 @@ func NewRealSSHConnection(config *ConnectionConfig) *RealSSHConnection {
 }
 
 // Connect establishes the SSH connection
-func (c *RealSSHConnection) Connect(ctx context.Context) error {
+func (c *RealSSHConnection) Connect(ctx context.Context) (err error) {
 	if c.connected {
 		return nil
 	}
@@ -60,6 +57,12 @@ func (c *RealSSHConnection) Connect(ctx context.Context) error {
 	if err != nil {
 		return fmt.Errorf("failed to create SSH config: %w", err)
 	}
+	// The ssh-agent is released when no connection is made with it
+	defer func() {
+		if err != nil {
+			c.closeAgent()
+		}
+	}()
 
 	// Connect with retries
 	var lastErr error
@@ -72,6 +75,11 @@ func (c *RealSSHConnection) Connect(ctx context.Context) error {
 		}
 
 		lastErr = err
+		// An untrusted host key will not change by retrying
+		var hostKeyErr *HostKeyError
+		if errors.As(err, &hostKeyErr) {
+			return fmt.Errorf("failed to connect: %w", err)
+		}
 		if attempt < c.retries {
 			select {
 			case <-ctx.Done():
@@ -90,14 +98,35 @@ func (c *RealSSHConnection) Execute(ctx context.Context, command string) (*Execu
 	if !c.connected {
 		return nil, fmt.Errorf("not connected to SSH server")
 	}
+	return c.run(ctx, command, nil)
+}
+
+// ExecuteWithInput executes a command over SSH with input on its standard input
+func (c *RealSSHConnection) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
+	if !c.connected {
+		return nil, fmt.Errorf("not connected to SSH server")
+	}
+	return c.run(ctx, command, input)
+}
 
+// run executes a command in a new session on the connection. Failing to
+// open the session is reported as a *SessionError.
+func (c *RealSSHConnection) run(ctx context.Context, command string, input io.Reader) (*ExecuteResult, error) {
 	// Create a new session for each command
 	session, err := c.client.NewSession()
 	if err != nil {
-		return nil, fmt.Errorf("failed to create SSH session: %w", err)
+		return nil, &SessionError{Err: err}
 	}
 	defer session.Close()
 
+	return runSession(ctx, session, command, input, c.timeout)
+}
+
+// runSession runs a command in a session and collects its output. A nil
+// input leaves the command's standard input empty.
+func runSession(ctx context.Context, session *ssh.Session, command string, input io.Reader, timeout time.Duration) (*ExecuteResult, error) {
+	session.Stdin = input
+
 	// Set up pipes for stdout and stderr
 	stdout, err := session.StdoutPipe()
 	if err != nil {
@@ -124,23 +153,29 @@ func (c *RealSSHConnection) Execute(ctx context.Context, command string) (*Execu
 	stderrChan := make(chan string, 1)
 	doneChan := make(chan error, 1)
 
-	// Read stdout
+	// Read stdout, streaming it as it is read when the context asks for it
 	go func() {
-		output, err := io.ReadAll(stdout)
+		reader, flush := teeOutput(ctx, StreamStdout, stdout)
+		output := NewOutputBuffer(ctx, StreamStdout)
+		_, err := io.Copy(output, reader)
+		flush()
 		if err != nil {
 			stdoutChan <- ""
 		} else {
-			stdoutChan <- string(output)
+			stdoutChan <- output.String()
 		}
 	}()
 
 	// Read stderr
 	go func() {
-		output, err := io.ReadAll(stderr)
+		reader, flush := teeOutput(ctx, StreamStderr, stderr)
+		output := NewOutputBuffer(ctx, StreamStderr)
+		_, err := io.Copy(output, reader)
+		flush()
 		if err != nil {
 			stderrChan <- ""
 		} else {
-			stderrChan <- string(output)
+			stderrChan <- output.String()
 		}
 	}()
 
@@ -169,14 +204,16 @@ func (c *RealSSHConnection) Execute(ctx context.Context, command string) (*Execu
 		}
 
 		return result, nil
-	case <-time.After(c.timeout):
+	case <-time.After(timeout):
 		session.Signal(ssh.SIGTERM)
-		return nil, fmt.Errorf("command timed out after %v", c.timeout)
+		return nil, fmt.Errorf("command timed out after %v", timeout)
 	}
 }
 
 // Close closes the SSH connection
 func (c *RealSSHConnection) Close() error {
+	c.closeAgent()
+
 	if c.session != nil {
 		c.session.Close()
 		c.session = nil
@@ -192,127 +229,35 @@ func (c *RealSSHConnection) Close() error {
 	return nil
 }
 
+// closeAgent releases the connection to the ssh-agent, if any
+func (c *RealSSHConnection) closeAgent() {
+	if c.agentConn != nil {
+		c.agentConn.Close()
+		c.agentConn = nil
+	}
+}
+
 // createSSHConfig creates the SSH client configuration
 func (c *RealSSHConnection) createSSHConfig() (*ssh.ClientConfig, error) {
+	address := net.JoinHostPort(c.config.Host, fmt.Sprintf("%d", c.config.Port))
 	config := &ssh.ClientConfig{
-		User:            c.config.User,
-		Timeout:         c.timeout,
-		HostKeyCallback: c.createHostKeyCallback(),
+		User:              c.config.User,
+		Timeout:           c.timeout,
+		HostKeyCallback:   hostKeyCallback(c.config),
+		HostKeyAlgorithms: hostKeyAlgorithms(c.config, address),
 	}
 
 	// Set up authentication
-	auth, err := c.createAuthMethods()
+	auth, agentConn, err := authMethods(c.config)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create auth methods: %w", err)
 	}
 	config.Auth = auth
+	c.agentConn = agentConn
 
 	return config, nil
 }
 
-// createAuthMethods creates authentication methods based on configuration
-func (c *RealSSHConnection) createAuthMethods() ([]ssh.AuthMethod, error) {
-	var methods []ssh.AuthMethod
-
-	// Try SSH agent first
-	if agentAuth := c.trySSHAgent(); agentAuth != nil {
-		methods = append(methods, agentAuth)
-	}
-
-	// Try private key authentication
-	if c.config.PrivateKey != "" {
-		keyAuth, err := c.createKeyAuth(c.config.PrivateKey)
-		if err == nil {
-			methods = append(methods, keyAuth)
-		}
-	}
-
-	// Try private key file authentication
-	if c.config.PrivateKeyPath != "" {
-		keyAuth, err := c.createKeyFileAuth(c.config.PrivateKeyPath)
-		if err == nil {
-			methods = append(methods, keyAuth)
-		}
-	}
-
-	// Try password authentication (least secure)
-	if c.config.Password != "" {
-		methods = append(methods, ssh.Password(c.config.Password))
-	}
-
-	if len(methods) == 0 {
-		return nil, fmt.Errorf("no authentication methods available")
-	}
-
-	return methods, nil
-}
-
-// trySSHAgent attempts to use SSH agent for authentication
-func (c *RealSSHConnection) trySSHAgent() ssh.AuthMethod {
-	socket := os.Getenv("SSH_AUTH_SOCK")
-	if socket == "" {
-		return nil
-	}
-
-	conn, err := net.Dial("unix", socket)
-	if err != nil {
-		return nil
-	}
-
-	agentClient := agent.NewClient(conn)
-	return ssh.PublicKeysCallback(agentClient.Signers)
-}
-
-// createKeyAuth creates authentication from private key string
-func (c *RealSSHConnection) createKeyAuth(privateKey string) (ssh.AuthMethod, error) {
-	signer, err := ssh.ParsePrivateKey([]byte(privateKey))
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
-	}
-
-	return ssh.PublicKeys(signer), nil
-}
-
-// createKeyFileAuth creates authentication from private key file
-func (c *RealSSHConnection) createKeyFileAuth(keyFile string) (ssh.AuthMethod, error) {
-	// Expand home directory
-	if strings.HasPrefix(keyFile, "~/") {
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return nil, fmt.Errorf("failed to get home directory: %w", err)
-		}
-		keyFile = filepath.Join(home, keyFile[2:])
-	}
-
-	key, err := os.ReadFile(keyFile)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read private key file: %w", err)
-	}
-
-	signer, err := ssh.ParsePrivateKey(key)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse private key: %w", err)
-	}
-
-	return ssh.PublicKeys(signer), nil
-}
-
-// createHostKeyCallback creates the host key verification callback
-func (c *RealSSHConnection) createHostKeyCallback() ssh.HostKeyCallback {
-	// Try to use known_hosts file
-	knownHostsFile := filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts")
-	if _, err := os.Stat(knownHostsFile); err == nil {
-		callback, err := knownhosts.New(knownHostsFile)
-		if err == nil {
-			return callback
-		}
-	}
-
-	// Fallback to insecure callback (for development/testing)
-	// In production, you should always verify host keys
-	return ssh.InsecureIgnoreHostKey()
-}
-
 // connectWithTimeout establishes SSH connection with timeout
 func (c *RealSSHConnection) connectWithTimeout(ctx context.Context, config *ssh.ClientConfig) (*ssh.Client, error) {
 	address := net.JoinHostPort(c.config.Host, fmt.Sprintf("%d", c.config.Port))
@@ -337,55 +282,3 @@ func (c *RealSSHConnection) connectWithTimeout(ctx context.Context, config *ssh.
 
 	return ssh.NewClient(sshConn, chans, reqs), nil
 }
-
-// SSHConnectionPool manages a pool of SSH connections for efficiency
-type SSHConnectionPool struct {
-	connections map[string]*RealSSHConnection
-	maxIdle     int
-	maxActive   int
-}
-
-// NewSSHConnectionPool creates a new connection pool
-func NewSSHConnectionPool(maxIdle, maxActive int) *SSHConnectionPool {
-	return &SSHConnectionPool{
-		connections: make(map[string]*RealSSHConnection),
-		maxIdle:     maxIdle,
-		maxActive:   maxActive,
-	}
-}
-
-// GetConnection gets or creates a connection for the given configuration
-func (p *SSHConnectionPool) GetConnection(config *ConnectionConfig) (*RealSSHConnection, error) {
-	key := fmt.Sprintf("%s@%s:%d", config.User, config.Host, config.Port)
-
-	if conn, exists := p.connections[key]; exists {
-		return conn, nil
-	}
-
-	if len(p.connections) >= p.maxActive {
-		return nil, fmt.Errorf("connection pool exhausted")
-	}
-
-	conn := NewRealSSHConnection(config)
-	p.connections[key] = conn
-
-	return conn, nil
-}
-
-// CloseAll closes all connections in the pool
-func (p *SSHConnectionPool) CloseAll() error {
-	var errors []error
-
-	for key, conn := range p.connections {
-		if err := conn.Close(); err != nil {
-			errors = append(errors, fmt.Errorf("failed to close connection %s: %w", key, err))
-		}
-		delete(p.connections, key)
-	}
-
-	if len(errors) > 0 {
-		return fmt.Errorf("errors closing connections: %v", errors)
-	}
-
-	return nil
-}
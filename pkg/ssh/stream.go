@@ -0,0 +1,109 @@
+package ssh
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"sync"
+)
+
+// Output streams
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputFunc receives the lines a command prints while it runs, from the
+// stdout or stderr stream
+type OutputFunc func(stream, line string)
+
+// outputStreamKey is the context key of the OutputFunc commands stream to
+type outputStreamKey struct{}
+
+// WithOutputStream returns a context in which the SSH and local executors
+// pass each line commands print to output as it is printed, as well as
+// returning it in the result once the command finished
+func WithOutputStream(ctx context.Context, output OutputFunc) context.Context {
+	return context.WithValue(ctx, outputStreamKey{}, output)
+}
+
+// outputStream returns the OutputFunc of a context, nil when there is none
+func outputStream(ctx context.Context) OutputFunc {
+	output, _ := ctx.Value(outputStreamKey{}).(OutputFunc)
+	return output
+}
+
+// lineWriter passes what is written to it on to an OutputFunc a line at a
+// time. Flush passes on a last line without a newline.
+type lineWriter struct {
+	stream string
+	output OutputFunc
+
+	mu      sync.Mutex
+	partial []byte
+}
+
+// Write passes on the complete lines written so far
+func (w *lineWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.partial = append(w.partial, p...)
+	for {
+		end := bytes.IndexByte(w.partial, '\n')
+		if end < 0 {
+			break
+		}
+		w.output(w.stream, string(bytes.TrimSuffix(w.partial[:end], []byte("\r"))))
+		w.partial = w.partial[end+1:]
+	}
+	return len(p), nil
+}
+
+// Flush passes on the rest of the output
+func (w *lineWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.partial) > 0 {
+		w.output(w.stream, string(w.partial))
+		w.partial = nil
+	}
+}
+
+// OutputBuffer collects one stream of a command's output
+type OutputBuffer interface {
+	io.Writer
+	String() string
+}
+
+// outputBufferKey is the context key of the buffers commands collect their
+// output in
+type outputBufferKey struct{}
+
+// WithOutputBuffers returns a context in which the SSH, local and container
+// executors collect the stdout and stderr of commands in the buffers
+// newBuffer returns for each stream, such as ones that bound how much of it
+// is kept in memory
+func WithOutputBuffers(ctx context.Context, newBuffer func(stream string) OutputBuffer) context.Context {
+	return context.WithValue(ctx, outputBufferKey{}, newBuffer)
+}
+
+// NewOutputBuffer returns the buffer a stream of a command's output is
+// collected in: the context's, or one that keeps all of it
+func NewOutputBuffer(ctx context.Context, stream string) OutputBuffer {
+	if newBuffer, ok := ctx.Value(outputBufferKey{}).(func(string) OutputBuffer); ok {
+		return newBuffer(stream)
+	}
+	return &bytes.Buffer{}
+}
+
+// teeOutput returns a reader that passes what is read from r on to the
+// output stream of ctx, and a function that flushes it once r is read. r is
+// returned as is when ctx has no output stream.
+func teeOutput(ctx context.Context, stream string, r io.Reader) (io.Reader, func()) {
+	output := outputStream(ctx)
+	if output == nil {
+		return r, func() {}
+	}
+	writer := &lineWriter{stream: stream, output: output}
+	return io.TeeReader(r, writer), writer.Flush
+}
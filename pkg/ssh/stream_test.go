@@ -0,0 +1,76 @@
+package ssh
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func TestLocalExecutor_OutputStream(t *testing.T) {
+	var mu sync.Mutex
+	lines := make(map[string][]string)
+	ctx := WithOutputStream(context.Background(), func(stream, line string) {
+		mu.Lock()
+		defer mu.Unlock()
+		lines[stream] = append(lines[stream], line)
+	})
+
+	result, err := (&LocalExecutor{}).Execute(ctx, `printf 'one\ntwo\r\nthree'; echo warning >&2; exit 3`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.ExitCode != 3 || result.Stdout != "one\ntwo\r\nthree" || result.Stderr != "warning\n" {
+		t.Errorf("Execute() = %+v", result)
+	}
+	want := map[string][]string{
+		StreamStdout: {"one", "two", "three"},
+		StreamStderr: {"warning"},
+	}
+	if !reflect.DeepEqual(lines, want) {
+		t.Errorf("streamed %q, want %q", lines, want)
+	}
+}
+
+// truncated keeps the first few bytes written to it
+type truncated struct {
+	kept []byte
+}
+
+func (b *truncated) Write(p []byte) (int, error) {
+	b.kept = append(b.kept, p[:min(4-len(b.kept), len(p))]...)
+	return len(p), nil
+}
+
+func (b *truncated) String() string { return string(b.kept) }
+
+func TestLocalExecutor_OutputBuffers(t *testing.T) {
+	ctx := WithOutputBuffers(context.Background(), func(stream string) OutputBuffer {
+		return &truncated{}
+	})
+
+	result, err := (&LocalExecutor{}).Execute(ctx, `printf 'one two three'; echo warning >&2`)
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.Stdout != "one " || result.Stderr != "warn" {
+		t.Errorf("Execute() = %+v, want output from the context's buffers", result)
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	var lines []string
+	writer := &lineWriter{stream: StreamStdout, output: func(stream, line string) {
+		lines = append(lines, line)
+	}}
+	for _, chunk := range []string{"par", "tial\nwho", "le\n\nlast"} {
+		writer.Write([]byte(chunk))
+	}
+	if want := []string{"partial", "whole", ""}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("before Flush() = %q, want %q", lines, want)
+	}
+	writer.Flush()
+	if want := []string{"partial", "whole", "", "last"}; !reflect.DeepEqual(lines, want) {
+		t.Errorf("after Flush() = %q, want %q", lines, want)
+	}
+}
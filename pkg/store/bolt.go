@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// boltLockTimeout is how long Open waits for another process to release the file
+const boltLockTimeout = 2 * time.Second
+
+// Bolt keeps values in an embedded bbolt file. Only one process can have
+// the file open at a time.
+type Bolt struct {
+	db *bolt.DB
+}
+
+// OpenBolt opens or creates a bbolt file
+func OpenBolt(path string) (*Bolt, error) {
+	if path == "" {
+		path = DefaultURL
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltLockTimeout})
+	if errors.Is(err, bolt.ErrTimeout) {
+		return nil, fmt.Errorf("store %s is in use by another forge process; use a postgres:// or s3:// store to share it", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store %s: %w", path, err)
+	}
+	return &Bolt{db: db}, nil
+}
+
+// Get returns the value of a key
+func (b *Bolt) Get(bucket, key string) ([]byte, error) {
+	var value []byte
+	err := b.db.View(func(tx *bolt.Tx) error {
+		if bkt := tx.Bucket([]byte(bucket)); bkt != nil {
+			if data := bkt.Get([]byte(key)); data != nil {
+				// Values are only valid during the transaction
+				value = append([]byte{}, data...)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+	}
+	if value == nil {
+		return nil, notFound(bucket, key)
+	}
+	return value, nil
+}
+
+// Put creates or replaces the value of a key
+func (b *Bolt) Put(bucket, key string, value []byte) error {
+	if err := validate(bucket, key); err != nil {
+		return err
+	}
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt, err := tx.CreateBucketIfNotExists([]byte(bucket))
+		if err != nil {
+			return err
+		}
+		return bkt.Put([]byte(key), value)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Delete removes a key
+func (b *Bolt) Delete(bucket, key string) error {
+	found := false
+	err := b.db.Update(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil || bkt.Get([]byte(key)) == nil {
+			return nil
+		}
+		found = true
+		return bkt.Delete([]byte(key))
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	if !found {
+		return notFound(bucket, key)
+	}
+	return nil
+}
+
+// Keys lists the keys of a bucket in sorted order
+func (b *Bolt) Keys(bucket string) ([]string, error) {
+	keys := []string{}
+	err := b.db.View(func(tx *bolt.Tx) error {
+		bkt := tx.Bucket([]byte(bucket))
+		if bkt == nil {
+			return nil
+		}
+		// bbolt keeps keys in byte order
+		return bkt.ForEach(func(k, _ []byte) error {
+			keys = append(keys, string(k))
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	return keys, nil
+}
+
+// Close closes the file, releasing it for other processes
+func (b *Bolt) Close() error {
+	return b.db.Close()
+}
@@ -0,0 +1,70 @@
+package store
+
+import (
+	"sort"
+	"sync"
+)
+
+// Memory keeps values in memory; it is meant for tests and throwaway runs
+type Memory struct {
+	mu      sync.RWMutex
+	buckets map[string]map[string][]byte
+}
+
+// NewMemory creates an empty in-memory store
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]map[string][]byte)}
+}
+
+// Get returns the value of a key
+func (m *Memory) Get(bucket, key string) ([]byte, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	value, ok := m.buckets[bucket][key]
+	if !ok {
+		return nil, notFound(bucket, key)
+	}
+	return append([]byte(nil), value...), nil
+}
+
+// Put creates or replaces the value of a key
+func (m *Memory) Put(bucket, key string, value []byte) error {
+	if err := validate(bucket, key); err != nil {
+		return err
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.buckets[bucket] == nil {
+		m.buckets[bucket] = make(map[string][]byte)
+	}
+	m.buckets[bucket][key] = append([]byte(nil), value...)
+	return nil
+}
+
+// Delete removes a key
+func (m *Memory) Delete(bucket, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.buckets[bucket][key]; !ok {
+		return notFound(bucket, key)
+	}
+	delete(m.buckets[bucket], key)
+	return nil
+}
+
+// Keys lists the keys of a bucket in sorted order
+func (m *Memory) Keys(bucket string) ([]string, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	keys := make([]string, 0, len(m.buckets[bucket]))
+	for key := range m.buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close does nothing; the values stay readable
+func (m *Memory) Close() error {
+	return nil
+}
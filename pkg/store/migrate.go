@@ -0,0 +1,65 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// migrationsBucket records the data version of each component
+const migrationsBucket = "migrations"
+
+// Migration upgrades the data a component keeps in a store
+type Migration struct {
+	// Version numbers start at 1 and increase by one per migration
+	Version     int
+	Description string
+	Up          func(s Store) error
+}
+
+// Version returns the data version of a component, 0 if it never migrated
+func Version(s Store, component string) (int, error) {
+	data, err := s.Get(migrationsBucket, component)
+	if errors.Is(err, ErrNotFound) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.Atoi(string(data))
+	if err != nil {
+		return 0, fmt.Errorf("invalid data version %q of %s", data, component)
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations of a component that the store has not
+// seen yet, in order, recording the version after each one. It returns the
+// migrations it applied.
+func Migrate(s Store, component string, migrations []Migration) ([]Migration, error) {
+	current, err := Version(s, component)
+	if err != nil {
+		return nil, err
+	}
+	if current > len(migrations) {
+		return nil, fmt.Errorf("%s data has version %d, newer than this forge supports (%d)", component, current, len(migrations))
+	}
+
+	var applied []Migration
+	for i, migration := range migrations {
+		if migration.Version != i+1 {
+			return applied, fmt.Errorf("migration %d of %s has version %d", i+1, component, migration.Version)
+		}
+		if migration.Version <= current {
+			continue
+		}
+		if err := migration.Up(s); err != nil {
+			return applied, fmt.Errorf("failed to migrate %s to version %d (%s): %w", component, migration.Version, migration.Description, err)
+		}
+		if err := s.Put(migrationsBucket, component, []byte(strconv.Itoa(migration.Version))); err != nil {
+			return applied, err
+		}
+		applied = append(applied, migration)
+	}
+	return applied, nil
+}
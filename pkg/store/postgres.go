@@ -0,0 +1,153 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+// postgresTimeout bounds each statement
+const postgresTimeout = 30 * time.Second
+
+// postgresSchema creates and upgrades the tables, one statement per schema
+// version; statements are only ever appended
+var postgresSchema = []string{
+	`CREATE TABLE forge_store (
+		bucket     TEXT NOT NULL,
+		key        TEXT NOT NULL,
+		value      BYTEA NOT NULL,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+		PRIMARY KEY (bucket, key)
+	)`,
+}
+
+// Postgres keeps values in a Postgres table, so several controllers can
+// share them
+type Postgres struct {
+	db *sql.DB
+}
+
+// OpenPostgres connects to a database and brings its schema up to date
+func OpenPostgres(dsn string) (*Postgres, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open postgres store: %w", err)
+	}
+	p := &Postgres{db: db}
+	if err := p.migrate(); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return p, nil
+}
+
+// migrate applies the schema versions the database does not have yet
+func (p *Postgres) migrate() error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to connect to postgres store: %w", err)
+	}
+	defer tx.Rollback()
+
+	// The lock keeps controllers starting together from migrating twice
+	if _, err := tx.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS forge_store_schema (version INTEGER NOT NULL)`); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	if _, err := tx.ExecContext(ctx, `LOCK TABLE forge_store_schema IN EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	var version int
+	if err := tx.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM forge_store_schema`).Scan(&version); err != nil {
+		return fmt.Errorf("failed to migrate postgres store: %w", err)
+	}
+	if version > len(postgresSchema) {
+		return fmt.Errorf("postgres store has schema version %d, newer than this forge supports (%d)", version, len(postgresSchema))
+	}
+	for i := version; i < len(postgresSchema); i++ {
+		if _, err := tx.ExecContext(ctx, postgresSchema[i]); err != nil {
+			return fmt.Errorf("failed to migrate postgres store to version %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, `INSERT INTO forge_store_schema (version) VALUES ($1)`, i+1); err != nil {
+			return fmt.Errorf("failed to migrate postgres store to version %d: %w", i+1, err)
+		}
+	}
+	return tx.Commit()
+}
+
+// Get returns the value of a key
+func (p *Postgres) Get(bucket, key string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	var value []byte
+	err := p.db.QueryRowContext(ctx, `SELECT value FROM forge_store WHERE bucket = $1 AND key = $2`, bucket, key).Scan(&value)
+	if err == sql.ErrNoRows {
+		return nil, notFound(bucket, key)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+	}
+	return value, nil
+}
+
+// Put creates or replaces the value of a key
+func (p *Postgres) Put(bucket, key string, value []byte) error {
+	if err := validate(bucket, key); err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	_, err := p.db.ExecContext(ctx, `INSERT INTO forge_store (bucket, key, value) VALUES ($1, $2, $3)
+		ON CONFLICT (bucket, key) DO UPDATE SET value = EXCLUDED.value, updated_at = now()`, bucket, key, value)
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	return nil
+}
+
+// Delete removes a key
+func (p *Postgres) Delete(bucket, key string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	result, err := p.db.ExecContext(ctx, `DELETE FROM forge_store WHERE bucket = $1 AND key = $2`, bucket, key)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return notFound(bucket, key)
+	}
+	return nil
+}
+
+// Keys lists the keys of a bucket in sorted order
+func (p *Postgres) Keys(bucket string) ([]string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), postgresTimeout)
+	defer cancel()
+	// COLLATE "C" sorts by bytes, like the other backends
+	rows, err := p.db.QueryContext(ctx, `SELECT key FROM forge_store WHERE bucket = $1 ORDER BY key COLLATE "C"`, bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	defer rows.Close()
+	keys := []string{}
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+		}
+		keys = append(keys, key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+	}
+	return keys, nil
+}
+
+// Close closes the connections to the database
+func (p *Postgres) Close() error {
+	return p.db.Close()
+}
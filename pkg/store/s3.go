@@ -0,0 +1,287 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/sigv4"
+)
+
+// s3Timeout bounds each request
+const s3Timeout = 30 * time.Second
+
+// S3Config locates an S3 bucket and the credentials to reach it
+type S3Config struct {
+	Bucket string
+	// Prefix is prepended to every object key
+	Prefix string
+	// Region defaults to AWS_REGION, then us-east-1
+	Region string
+	// Endpoint is the base URL of an S3-compatible service such as MinIO;
+	// it defaults to AWS
+	Endpoint string
+	// Credentials default to AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and
+	// AWS_SESSION_TOKEN
+	AccessKey    string
+	SecretKey    string
+	SessionToken string
+	Client       *http.Client
+}
+
+// S3 keeps each value as an object in an S3 bucket, at
+// <prefix>/<bucket>/<key>, so several controllers can share them
+type S3 struct {
+	config S3Config
+	now    func() time.Time
+}
+
+// OpenS3 creates a store in an S3 bucket
+func OpenS3(config S3Config) (*S3, error) {
+	if config.Bucket == "" {
+		return nil, fmt.Errorf("an S3 store needs a bucket")
+	}
+	if config.Region == "" {
+		config.Region = os.Getenv("AWS_REGION")
+	}
+	if config.Region == "" {
+		config.Region = "us-east-1"
+	}
+	if config.Endpoint == "" {
+		config.Endpoint = "https://s3." + config.Region + ".amazonaws.com"
+	}
+	config.Endpoint = strings.TrimSuffix(config.Endpoint, "/")
+	if config.AccessKey == "" {
+		credentials := sigv4.EnvCredentials()
+		config.AccessKey = credentials.AccessKey
+		config.SecretKey = credentials.SecretKey
+		config.SessionToken = credentials.SessionToken
+	}
+	if config.AccessKey == "" || config.SecretKey == "" {
+		return nil, fmt.Errorf("an S3 store needs AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	if config.Client == nil {
+		config.Client = &http.Client{Timeout: s3Timeout}
+	}
+	return &S3{config: config, now: time.Now}, nil
+}
+
+// object returns the object key of a stored key
+func (s *S3) object(bucket, key string) string {
+	if s.config.Prefix == "" {
+		return bucket + "/" + key
+	}
+	return s.config.Prefix + "/" + bucket + "/" + key
+}
+
+// Get returns the value of a key
+func (s *S3) Get(bucket, key string) ([]byte, error) {
+	resp, err := s.do(http.MethodGet, s.object(bucket, key), nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, notFound(bucket, key)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to read %s/%s: %w", bucket, key, s3Error(resp))
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// Put creates or replaces the value of a key
+func (s *S3) Put(bucket, key string, value []byte) error {
+	if err := validate(bucket, key); err != nil {
+		return err
+	}
+	resp, err := s.do(http.MethodPut, s.object(bucket, key), nil, value)
+	if err != nil {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to write %s/%s: %w", bucket, key, s3Error(resp))
+	}
+	return nil
+}
+
+// Delete removes a key
+func (s *S3) Delete(bucket, key string) error {
+	// S3 deletes missing objects without complaint, so look first
+	resp, err := s.do(http.MethodHead, s.object(bucket, key), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return notFound(bucket, key)
+	}
+
+	resp, err = s.do(http.MethodDelete, s.object(bucket, key), nil, nil)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("failed to delete %s/%s: %w", bucket, key, s3Error(resp))
+	}
+	return nil
+}
+
+// listResult is the part of a ListObjectsV2 response that Keys reads
+type listResult struct {
+	Contents []struct {
+		Key string `xml:"Key"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// Keys lists the keys of a bucket in sorted order
+func (s *S3) Keys(bucket string) ([]string, error) {
+	prefix := s.object(bucket, "")
+	keys := []string{}
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			err := s3Error(resp)
+			resp.Body.Close()
+			return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+		}
+		var result listResult
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list %s: %w", bucket, err)
+		}
+		for _, object := range result.Contents {
+			// Objects further down, such as <bucket>/a/b, are keys too
+			keys = append(keys, strings.TrimPrefix(object.Key, prefix))
+		}
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			break
+		}
+		token = result.NextContinuationToken
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Close does nothing; S3 holds no connection open
+func (s *S3) Close() error {
+	return nil
+}
+
+// do sends a signed request for an object, or for the bucket when object is empty
+func (s *S3) do(method, object string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(s.config.Endpoint + "/" + s3Escape(s.config.Bucket) + "/" + s3Escape(object))
+	if err != nil {
+		return nil, err
+	}
+	if object == "" {
+		u.Path = strings.TrimSuffix(u.Path, "/")
+	}
+	u.RawPath = u.EscapedPath()
+	if query != nil {
+		u.RawQuery = s3Query(query)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), s3Timeout)
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+	s.sign(req, body)
+	resp, err := s.config.Client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// cancelBody releases a request's context once its response is read
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close()
+}
+
+// sign adds an AWS Signature Version 4 to a request
+func (s *S3) sign(req *http.Request, body []byte) {
+	sigv4.Sign(req, body, sigv4.Credentials{
+		AccessKey:    s.config.AccessKey,
+		SecretKey:    s.config.SecretKey,
+		SessionToken: s.config.SessionToken,
+	}, s.config.Region, "s3", s.now())
+}
+
+// s3Escape encodes an object key the way Signature Version 4 expects,
+// leaving only unreserved characters and slashes as they are
+func s3Escape(path string) string {
+	var b strings.Builder
+	for _, c := range []byte(path) {
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '_', c == '.', c == '~', c == '/':
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// s3Query encodes a query string in the sorted, strictly escaped form
+// Signature Version 4 expects
+func s3Query(query url.Values) string {
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var parts []string
+	for _, name := range names {
+		for _, value := range query[name] {
+			parts = append(parts, strings.ReplaceAll(s3Escape(name), "/", "%2F")+"="+strings.ReplaceAll(s3Escape(value), "/", "%2F"))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// s3Error describes a failed response
+func s3Error(resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	var e struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	if xml.Unmarshal(body, &e) == nil && e.Code != "" {
+		return fmt.Errorf("%s: %s: %s", resp.Status, e.Code, e.Message)
+	}
+	return fmt.Errorf("%s", resp.Status)
+}
@@ -0,0 +1,94 @@
+package store
+
+import "fmt"
+
+// DefaultSealedBuckets hold what runs record about hosts: executions with
+// their diffs, drift reports and the runs agents report to the server, and
+// approval requests with the modules they approve
+var DefaultSealedBuckets = []string{"executions", "drift_reports", "runs", "approval_requests"}
+
+// Sealer encrypts values before they are stored and decrypts them when read,
+// bound to their bucket and key. IsSealed reports whether a stored value is
+// sealed, so one written before sealing was turned on can be rekeyed.
+type Sealer interface {
+	Seal(data []byte, name string) ([]byte, error)
+	Open(data []byte, name string) ([]byte, error)
+	IsSealed(data []byte) bool
+}
+
+// Sealed encrypts the values of some buckets of a store at rest. Keys stay
+// readable so values can be listed without decrypting them.
+type Sealed struct {
+	Store
+	sealer  Sealer
+	buckets map[string]bool
+}
+
+// NewSealed wraps a store so the values of the given buckets are sealed
+func NewSealed(kv Store, sealer Sealer, buckets []string) *Sealed {
+	sealed := &Sealed{Store: kv, sealer: sealer, buckets: make(map[string]bool, len(buckets))}
+	for _, bucket := range buckets {
+		sealed.buckets[bucket] = true
+	}
+	return sealed
+}
+
+// Get returns the decrypted value of a key
+func (s *Sealed) Get(bucket, key string) ([]byte, error) {
+	data, err := s.Store.Get(bucket, key)
+	if err != nil || !s.buckets[bucket] {
+		return data, err
+	}
+	return s.open(bucket, key, data)
+}
+
+// open decrypts a value read from a bucket
+func (s *Sealed) open(bucket, key string, data []byte) ([]byte, error) {
+	value, err := s.sealer.Open(data, bucket+"/"+key)
+	if err != nil {
+		return nil, fmt.Errorf("%s/%s: %w", bucket, key, err)
+	}
+	return value, nil
+}
+
+// Put encrypts and stores the value of a key
+func (s *Sealed) Put(bucket, key string, value []byte) error {
+	if s.buckets[bucket] {
+		sealed, err := s.sealer.Seal(value, bucket+"/"+key)
+		if err != nil {
+			return fmt.Errorf("%s/%s: %w", bucket, key, err)
+		}
+		value = sealed
+	}
+	return s.Store.Put(bucket, key, value)
+}
+
+// Rekey seals every value of the sealed buckets again with the sealer's
+// current key, after a key rotation or once sealing is turned on, when the
+// values written before are sealed for the first time. It returns how many
+// values it rewrote.
+func (s *Sealed) Rekey() (int, error) {
+	count := 0
+	for bucket := range s.buckets {
+		keys, err := s.Store.Keys(bucket)
+		if err != nil {
+			return count, err
+		}
+		for _, key := range keys {
+			value, err := s.Store.Get(bucket, key)
+			if err != nil {
+				return count, err
+			}
+			if s.sealer.IsSealed(value) {
+				if value, err = s.open(bucket, key, value); err != nil {
+					return count, err
+				}
+			}
+			if err := s.Put(bucket, key, value); err != nil {
+				return count, err
+			}
+			count++
+		}
+	}
+	return count, nil
+}
@@ -0,0 +1,159 @@
+package sudoers
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// DefaultDirs are where programs are allowed from when their paths on the
+// target are not known, and the only directories a profile allows programs
+// from: they belong to root, so the connecting user cannot replace what is
+// in them
+var DefaultDirs = []string{"/usr/bin", "/usr/sbin", "/bin", "/sbin"}
+
+// launchers run other programs, so allowing one of them as root allows
+// any program
+var launchers = map[string]bool{
+	"bash": true, "busybox": true, "env": true, "find": true, "nice": true, "nohup": true,
+	"perl": true, "python": true, "python3": true, "sh": true, "su": true, "sudo": true,
+	"timeout": true, "xargs": true, "zsh": true,
+}
+
+// writers change files or system state wherever their arguments point.
+// Sudoers rules allow a program with any arguments, so allowing one of them
+// as root lets the user overwrite /etc/sudoers, install a package or start
+// a unit of their own, which is as good as allowing any program.
+var writers = map[string]bool{
+	"apt": true, "apt-get": true, "chattr": true, "chgrp": true, "chmod": true, "chown": true,
+	"cp": true, "crontab": true, "curl": true, "dd": true, "dnf": true, "dpkg": true,
+	"install": true, "ln": true, "mount": true, "mv": true, "rm": true, "rpm": true,
+	"rsync": true, "sed": true, "systemctl": true, "tar": true, "tee": true, "truncate": true,
+	"useradd": true, "usermod": true, "wget": true, "yum": true, "zypper": true,
+}
+
+// invalidPathChars are characters sudoers reads as more than one command,
+// as wildcards or as arguments
+const invalidPathChars = " \t\n,:=\\*?[]!\"'()#"
+
+// Alias is a named set of programs, such as those of one provider
+type Alias struct {
+	Name     string
+	Programs []string
+}
+
+// Profile is a sudoers rule letting User run the programs of its aliases
+// as RunAs without a password, and nothing else
+type Profile struct {
+	User    string
+	RunAs   string
+	Aliases []Alias
+}
+
+// AliasName returns the Cmnd_Alias name of a provider or resource, such as
+// FORGE_FILE_EDIT for file_edit
+func AliasName(name string) string {
+	var b strings.Builder
+	b.WriteString("FORGE_")
+	for _, r := range strings.ToUpper(name) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			b.WriteRune(r)
+		} else {
+			b.WriteByte('_')
+		}
+	}
+	return b.String()
+}
+
+// Unsafe returns the programs of the profile that can run other programs,
+// or write any file, which makes the profile no better than allowing
+// everything. Most providers need one of them, so a profile limits what
+// forge runs as root by mistake rather than what the connecting user could
+// do with it.
+func (p Profile) Unsafe() []string {
+	seen := make(map[string]bool)
+	var unsafe []string
+	for _, alias := range p.Aliases {
+		for _, program := range alias.Programs {
+			name := path.Base(program)
+			if (launchers[name] || writers[name]) && !seen[program] {
+				seen[program] = true
+				unsafe = append(unsafe, program)
+			}
+		}
+	}
+	sort.Strings(unsafe)
+	return unsafe
+}
+
+// Render returns the profile as a sudoers snippet. paths returns where a
+// program may be run from on the target; nil allows it from DefaultDirs.
+func (p Profile) Render(paths func(program string) []string) (string, error) {
+	if p.User == "" || strings.ContainsAny(p.User, " \t\n,:=\\#") {
+		return "", fmt.Errorf("invalid sudoers user %q", p.User)
+	}
+	runAs := p.RunAs
+	if runAs == "" {
+		runAs = "root"
+	}
+	if strings.ContainsAny(runAs, " \t\n,:=\\#()") {
+		return "", fmt.Errorf("invalid sudoers run-as user %q", runAs)
+	}
+	if paths == nil {
+		paths = defaultPaths
+	}
+
+	var b strings.Builder
+	var names []string
+	for _, alias := range p.Aliases {
+		if len(alias.Programs) == 0 {
+			continue
+		}
+		var commands []string
+		for _, program := range alias.Programs {
+			found := paths(program)
+			if len(found) == 0 {
+				return "", fmt.Errorf("no path to %s for %s", program, alias.Name)
+			}
+			for _, command := range found {
+				if !path.IsAbs(command) || path.Clean(command) != command || strings.ContainsAny(command, invalidPathChars) {
+					return "", fmt.Errorf("invalid path %q to %s", command, program)
+				}
+				if !trustedDir(path.Dir(command)) {
+					return "", fmt.Errorf("%s is outside %s, where the connecting user may be able to replace it", command, strings.Join(DefaultDirs, ", "))
+				}
+				commands = append(commands, command)
+			}
+		}
+		names = append(names, alias.Name)
+		fmt.Fprintf(&b, "Cmnd_Alias %s = %s\n", alias.Name, strings.Join(commands, ", \\\n    "))
+	}
+	if len(names) == 0 {
+		return "", fmt.Errorf("the profile allows no programs")
+	}
+	fmt.Fprintf(&b, "%s ALL=(%s) NOPASSWD: %s\n", p.User, runAs, strings.Join(names, ", "))
+	return b.String(), nil
+}
+
+// defaultPaths allows a program from each of DefaultDirs
+func defaultPaths(program string) []string {
+	if path.IsAbs(program) {
+		return []string{program}
+	}
+	paths := make([]string, len(DefaultDirs))
+	for i, dir := range DefaultDirs {
+		paths[i] = path.Join(dir, program)
+	}
+	return paths
+}
+
+// trustedDir reports whether programs are allowed from dir
+func trustedDir(dir string) bool {
+	for _, trusted := range DefaultDirs {
+		if dir == trusted {
+			return true
+		}
+	}
+	return false
+}
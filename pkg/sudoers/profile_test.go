@@ -0,0 +1,91 @@
+package sudoers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestAliasName(t *testing.T) {
+	tests := map[string]string{
+		"file":      "FORGE_FILE",
+		"file_edit": "FORGE_FILE_EDIT",
+		"wait-for":  "FORGE_WAIT_FOR",
+	}
+	for name, want := range tests {
+		if got := AliasName(name); got != want {
+			t.Errorf("AliasName(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestProfile_Render(t *testing.T) {
+	profile := Profile{
+		User: "deploy",
+		Aliases: []Alias{
+			{Name: "FORGE_SERVICE", Programs: []string{"systemctl", "tee"}},
+			{Name: "FORGE_EMPTY"},
+		},
+	}
+	paths := func(program string) []string { return []string{"/usr/bin/" + program} }
+
+	got, err := profile.Render(paths)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Cmnd_Alias FORGE_SERVICE = /usr/bin/systemctl, \\\n    /usr/bin/tee\n" +
+		"deploy ALL=(root) NOPASSWD: FORGE_SERVICE\n"
+	if got != want {
+		t.Errorf("Render() = %q, want %q", got, want)
+	}
+
+	got, err = Profile{User: "deploy", RunAs: "postgres", Aliases: []Alias{{Name: "FORGE_SHELL", Programs: []string{"psql"}}}}.Render(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "Cmnd_Alias FORGE_SHELL = /usr/bin/psql, \\\n    /usr/sbin/psql, \\\n    /bin/psql, \\\n    /sbin/psql\n" +
+		"deploy ALL=(postgres) NOPASSWD: FORGE_SHELL\n"
+	if got != want {
+		t.Errorf("Render(nil) = %q, want %q", got, want)
+	}
+}
+
+func TestProfile_RenderErrors(t *testing.T) {
+	aliases := []Alias{{Name: "FORGE_FILE", Programs: []string{"rm"}}}
+	tests := []struct {
+		name    string
+		profile Profile
+		paths   func(string) []string
+	}{
+		{name: "no user", profile: Profile{Aliases: aliases}},
+		{name: "invalid user", profile: Profile{User: "a,b", Aliases: aliases}},
+		{name: "invalid run-as", profile: Profile{User: "deploy", RunAs: "(root)", Aliases: aliases}},
+		{name: "no programs", profile: Profile{User: "deploy", Aliases: []Alias{{Name: "FORGE_FILE"}}}},
+		{name: "no path", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return nil }},
+		{name: "relative path", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return []string{"bin/rm"} }},
+		{name: "wildcard", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return []string{"/usr/bin/*"} }},
+		{name: "arguments", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return []string{`/usr/bin/rm\ -rf`} }},
+		{name: "unclean path", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return []string{"/usr/bin/../../home/deploy/rm"} }},
+		{name: "untrusted dir", profile: Profile{User: "deploy", Aliases: aliases}, paths: func(string) []string { return []string{"/home/deploy/bin/rm"} }},
+		{name: "absolute program outside the trusted dirs", profile: Profile{User: "deploy", Aliases: []Alias{{Name: "FORGE_SHELL", Programs: []string{"/opt/app/migrate"}}}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.profile.Render(tt.paths); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestProfile_Unsafe(t *testing.T) {
+	profile := Profile{Aliases: []Alias{
+		{Name: "FORGE_FILE", Programs: []string{"rm", "tee"}},
+		{Name: "FORGE_SHELL", Programs: []string{"xargs", "bash", "/usr/bin/env"}},
+		{Name: "FORGE_EXEC", Programs: []string{"bash"}},
+	}}
+	want := []string{"/usr/bin/env", "bash", "rm", "tee", "xargs"}
+	if got := profile.Unsafe(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Unsafe() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,479 @@
+// Package sudoers builds sudo allowlist profiles: the programs each
+// provider runs as root, rendered as a sudoers snippet, and the rewriting
+// of commands so only those programs are escalated instead of a whole
+// shell
+package sudoers
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// assignment matches a variable assignment before a command's program
+var assignment = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// builtins are run by the shell itself and cannot be escalated. echo,
+// printf, true and false are builtins of every sh that never need root.
+var builtins = map[string]bool{
+	".": true, ":": true, "alias": true, "break": true, "cd": true, "command": true,
+	"continue": true, "echo": true, "eval": true, "exec": true, "exit": true,
+	"export": true, "false": true, "getopts": true, "hash": true, "local": true,
+	"printf": true, "read": true, "readonly": true, "return": true, "set": true,
+	"shift": true, "source": true, "trap": true, "true": true, "type": true,
+	"ulimit": true, "umask": true, "unset": true, "wait": true,
+}
+
+// Reserved words the rewriting understands. Words after one of the
+// openers start a new command. Words after a closer are redirections of the
+// compound command it closes, and words after for are its loop variable and
+// list.
+var (
+	openers = map[string]bool{"if": true, "then": true, "else": true, "elif": true, "while": true, "until": true, "do": true, "!": true, "{": true}
+	closers = map[string]bool{"fi": true, "done": true, "}": true, "for": true}
+)
+
+// Escalate rewrites a shell script so each program allowed reports true for
+// runs through prefix, such as "sudo -n -u root -- ", while the script
+// itself and every other program run unprivileged. Output redirected to a
+// file is written through "tee" instead when it is allowed, so files root
+// owns can be written. Constructs it cannot rewrite safely, such as case
+// statements and functions, are an error.
+func Escalate(script, prefix string, allowed func(program string) bool) (string, error) {
+	s := &scanner{src: script, prefix: prefix, allowed: allowed, out: &strings.Builder{}, seen: make(map[string]bool)}
+	if err := s.list(0); err != nil {
+		return "", err
+	}
+	return s.out.String(), nil
+}
+
+// Programs returns the programs a shell script runs, sorted, leaving out
+// shell builtins. Writing output to a file adds tee, which Escalate writes
+// it with.
+func Programs(script string) ([]string, error) {
+	s := &scanner{src: script, allowed: func(string) bool { return false }, out: &strings.Builder{}, seen: make(map[string]bool)}
+	if err := s.list(0); err != nil {
+		return nil, err
+	}
+	programs := make([]string, 0, len(s.seen))
+	for program := range s.seen {
+		programs = append(programs, program)
+	}
+	sort.Strings(programs)
+	return programs, nil
+}
+
+// heredoc is a here-document whose body follows the current line
+type heredoc struct {
+	delimiter string
+	stripTabs bool
+}
+
+// command is the state of the simple command being scanned
+type command struct {
+	// start is set until the command's program is seen
+	start       bool
+	assignments bool
+	// tee is the file the command's output is written to through tee
+	tee       string
+	teeAppend bool
+}
+
+// scanner rewrites a script as it reads it
+type scanner struct {
+	src      string
+	pos      int
+	prefix   string
+	allowed  func(string) bool
+	out      *strings.Builder
+	heredocs []heredoc
+	seen     map[string]bool
+}
+
+// list scans commands until the end of the script or the unmatched byte
+// term, which is left unread
+func (s *scanner) list(term byte) error {
+	cmd := &command{start: true}
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch {
+		case term != 0 && c == term:
+			s.end(cmd)
+			return nil
+		case c == ' ' || c == '\t':
+			s.out.WriteByte(c)
+			s.pos++
+		case c == '\\' && s.peek(1) == '\n':
+			s.out.WriteString("\\\n")
+			s.pos += 2
+		case c == '\n':
+			s.end(cmd)
+			s.out.WriteByte(c)
+			s.pos++
+			s.heredocBodies()
+			cmd = &command{start: true}
+		case c == '#':
+			end := strings.IndexByte(s.src[s.pos:], '\n')
+			if end < 0 {
+				end = len(s.src) - s.pos
+			}
+			s.out.WriteString(s.src[s.pos : s.pos+end])
+			s.pos += end
+		case c == ';' || c == '&' || c == '|':
+			s.end(cmd)
+			op := s.src[s.pos : s.pos+1]
+			if next := s.peek(1); next == c || (c == '|' && next == '&') {
+				op += string(next)
+			}
+			if op == ";;" {
+				return fmt.Errorf("case statements cannot be escalated program by program")
+			}
+			s.out.WriteString(op)
+			s.pos += len(op)
+			cmd = &command{start: true}
+		case c == '(':
+			if !cmd.start || s.peek(1) == '(' {
+				return fmt.Errorf("unexpected ( at offset %d: functions and arithmetic commands cannot be escalated program by program", s.pos)
+			}
+			s.out.WriteByte('(')
+			s.pos++
+			if err := s.list(')'); err != nil {
+				return err
+			}
+			if s.pos >= len(s.src) {
+				return fmt.Errorf("unterminated subshell")
+			}
+			s.out.WriteByte(')')
+			s.pos++
+			cmd.start = false
+		case c == ')':
+			return fmt.Errorf("unexpected ) at offset %d", s.pos)
+		case s.redirection():
+			if err := s.redirect(cmd); err != nil {
+				return err
+			}
+		default:
+			word, literal, err := s.word()
+			if err != nil {
+				return err
+			}
+			if err := s.command(cmd, word, literal); err != nil {
+				return err
+			}
+		}
+	}
+	if term != 0 {
+		return fmt.Errorf("missing closing %q", term)
+	}
+	s.end(cmd)
+	return nil
+}
+
+// peek returns the byte offset bytes ahead, 0 past the end
+func (s *scanner) peek(offset int) byte {
+	if s.pos+offset < len(s.src) {
+		return s.src[s.pos+offset]
+	}
+	return 0
+}
+
+// command handles a word of a simple command, escalating its program
+func (s *scanner) command(cmd *command, word, literal string) error {
+	if !cmd.start {
+		s.out.WriteString(word)
+		return nil
+	}
+	if assignment.MatchString(word) {
+		cmd.assignments = true
+		s.out.WriteString(word)
+		return nil
+	}
+	switch {
+	case openers[literal] && word == literal:
+		s.out.WriteString(word)
+		return nil
+	case closers[literal] && word == literal:
+		s.out.WriteString(word)
+		cmd.start = false
+		return nil
+	case (literal == "case" || literal == "function") && word == literal:
+		return fmt.Errorf("%s cannot be escalated program by program", literal)
+	}
+
+	cmd.start = false
+	if literal == "" || builtins[literal] {
+		s.out.WriteString(word)
+		return nil
+	}
+	s.seen[literal] = true
+	if !s.allowed(literal) {
+		s.out.WriteString(word)
+		return nil
+	}
+	if cmd.assignments {
+		return fmt.Errorf("cannot escalate %s: sudo drops the variables assigned before it", literal)
+	}
+	s.out.WriteString(s.prefix)
+	s.out.WriteString(word)
+	return nil
+}
+
+// end finishes a simple command, piping its output to tee if it was
+// redirected to a file
+func (s *scanner) end(cmd *command) {
+	if cmd.tee == "" {
+		return
+	}
+	if !strings.HasSuffix(s.out.String(), " ") {
+		s.out.WriteByte(' ')
+	}
+	s.out.WriteString("| ")
+	s.out.WriteString(s.prefix)
+	s.out.WriteString("tee ")
+	if cmd.teeAppend {
+		s.out.WriteString("-a ")
+	}
+	s.out.WriteString(cmd.tee)
+	s.out.WriteString(" > /dev/null")
+	if next := s.peek(0); next != 0 && strings.IndexByte(" \t\n)`", next) < 0 {
+		s.out.WriteByte(' ')
+	}
+	cmd.tee = ""
+}
+
+// redirection reports whether a redirection starts at the current position
+func (s *scanner) redirection() bool {
+	i := s.pos
+	for i < len(s.src) && s.src[i] >= '0' && s.src[i] <= '9' {
+		i++
+	}
+	return i < len(s.src) && (s.src[i] == '<' || s.src[i] == '>')
+}
+
+// redirect handles a redirection. Output to a file is moved to tee when tee
+// is allowed; here-documents have their bodies copied after the line.
+func (s *scanner) redirect(cmd *command) error {
+	start := s.pos
+	for s.src[s.pos] >= '0' && s.src[s.pos] <= '9' {
+		s.pos++
+	}
+	fd := s.src[start:s.pos]
+	op := ""
+	for _, candidate := range []string{"<<<", "<<-", "<<", "<>", "<&", "<", ">>", ">&", ">|", ">"} {
+		if strings.HasPrefix(s.src[s.pos:], candidate) {
+			op = candidate
+			break
+		}
+	}
+	s.pos += len(op)
+	space := s.pos
+	for s.pos < len(s.src) && (s.src[s.pos] == ' ' || s.src[s.pos] == '\t') {
+		s.pos++
+	}
+	space = s.pos - space
+	target, literal, err := s.word()
+	if err != nil {
+		return err
+	}
+	if target == "" {
+		return fmt.Errorf("redirection %s%s without a target", fd, op)
+	}
+
+	switch op {
+	case "<<", "<<-":
+		s.heredocs = append(s.heredocs, heredoc{delimiter: literal, stripTabs: op == "<<-"})
+	case ">", ">>", ">|":
+		if (fd == "" || fd == "1") && literal != "/dev/null" {
+			s.seen["tee"] = true
+			if s.allowed("tee") {
+				if cmd.tee != "" {
+					return fmt.Errorf("cannot escalate a command writing to both %s and %s", cmd.tee, target)
+				}
+				cmd.tee, cmd.teeAppend = target, op == ">>"
+				for s.pos < len(s.src) && (s.src[s.pos] == ' ' || s.src[s.pos] == '\t') {
+					s.pos++
+				}
+				return nil
+			}
+		}
+	}
+	s.out.WriteString(fd + op + strings.Repeat(" ", space) + target)
+	return nil
+}
+
+// heredocBodies copies the bodies of the here-documents of the line just
+// ended
+func (s *scanner) heredocBodies() {
+	for _, doc := range s.heredocs {
+		for s.pos < len(s.src) {
+			end := strings.IndexByte(s.src[s.pos:], '\n')
+			line := s.src[s.pos:]
+			if end >= 0 {
+				line = s.src[s.pos : s.pos+end+1]
+			}
+			s.out.WriteString(line)
+			s.pos += len(line)
+			text := strings.TrimSuffix(line, "\n")
+			if doc.stripTabs {
+				text = strings.TrimLeft(text, "\t")
+			}
+			if text == doc.delimiter {
+				break
+			}
+		}
+	}
+	s.heredocs = nil
+}
+
+// word reads a word, rewriting the commands it substitutes. It returns the
+// rewritten word and its value when it has no expansions, "" otherwise.
+func (s *scanner) word() (string, string, error) {
+	outer := s.out
+	s.out = &strings.Builder{}
+	defer func() { s.out = outer }()
+
+	var literal strings.Builder
+	expanded := false
+	for s.pos < len(s.src) {
+		c := s.src[s.pos]
+		switch c {
+		case ' ', '\t', '\n', ';', '&', '|', '<', '>', '(', ')':
+			return s.wordResult(&literal, expanded)
+		case '\'':
+			end := strings.IndexByte(s.src[s.pos+1:], '\'')
+			if end < 0 {
+				return "", "", fmt.Errorf("unterminated single quote")
+			}
+			literal.WriteString(s.src[s.pos+1 : s.pos+1+end])
+			s.out.WriteString(s.src[s.pos : s.pos+end+2])
+			s.pos += end + 2
+		case '"':
+			s.out.WriteByte('"')
+			s.pos++
+			closed := false
+			for s.pos < len(s.src) && !closed {
+				switch d := s.src[s.pos]; d {
+				case '"':
+					s.out.WriteByte('"')
+					s.pos++
+					closed = true
+				case '\\':
+					if next := s.peek(1); next != 0 {
+						if strings.IndexByte("\"\\$`\n", next) < 0 {
+							literal.WriteByte('\\')
+						}
+						literal.WriteByte(next)
+						s.out.WriteString(s.src[s.pos : s.pos+2])
+						s.pos += 2
+					} else {
+						s.pos++
+					}
+				case '$', '`':
+					expanded = true
+					if err := s.expansion(); err != nil {
+						return "", "", err
+					}
+				default:
+					literal.WriteByte(d)
+					s.out.WriteByte(d)
+					s.pos++
+				}
+			}
+			if !closed {
+				return "", "", fmt.Errorf("unterminated double quote")
+			}
+		case '\\':
+			if next := s.peek(1); next != 0 {
+				if next != '\n' {
+					literal.WriteByte(next)
+				}
+				s.out.WriteString(s.src[s.pos : s.pos+2])
+				s.pos += 2
+			} else {
+				s.out.WriteByte(c)
+				s.pos++
+			}
+		case '$', '`':
+			expanded = true
+			if err := s.expansion(); err != nil {
+				return "", "", err
+			}
+		default:
+			literal.WriteByte(c)
+			s.out.WriteByte(c)
+			s.pos++
+		}
+	}
+	return s.wordResult(&literal, expanded)
+}
+
+// wordResult returns the word scanned into s.out
+func (s *scanner) wordResult(literal *strings.Builder, expanded bool) (string, string, error) {
+	if expanded {
+		return s.out.String(), "", nil
+	}
+	return s.out.String(), literal.String(), nil
+}
+
+// expansion copies a parameter expansion and rewrites a command
+// substitution, starting at its $ or backquote
+func (s *scanner) expansion() error {
+	switch {
+	case s.src[s.pos] == '`':
+		end := s.pos + 1
+		for end < len(s.src) && s.src[end] != '`' {
+			if s.src[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(s.src) {
+			return fmt.Errorf("unterminated backquote")
+		}
+		inner := &scanner{src: s.src[s.pos+1 : end], prefix: s.prefix, allowed: s.allowed, out: &strings.Builder{}, seen: s.seen}
+		if err := inner.list(0); err != nil {
+			return err
+		}
+		s.out.WriteString("`" + inner.out.String() + "`")
+		s.pos = end + 1
+	case strings.HasPrefix(s.src[s.pos:], "$(("):
+		depth := 0
+		for i := s.pos + 1; i < len(s.src); i++ {
+			switch s.src[i] {
+			case '(':
+				depth++
+			case ')':
+				depth--
+			}
+			if depth == 0 {
+				s.out.WriteString(s.src[s.pos : i+1])
+				s.pos = i + 1
+				return nil
+			}
+		}
+		return fmt.Errorf("unterminated arithmetic expansion")
+	case strings.HasPrefix(s.src[s.pos:], "$("):
+		s.out.WriteString("$(")
+		s.pos += 2
+		if err := s.list(')'); err != nil {
+			return err
+		}
+		if s.pos >= len(s.src) {
+			return fmt.Errorf("unterminated command substitution")
+		}
+		s.out.WriteByte(')')
+		s.pos++
+	case strings.HasPrefix(s.src[s.pos:], "${"):
+		end := strings.IndexByte(s.src[s.pos:], '}')
+		if end < 0 {
+			return fmt.Errorf("unterminated parameter expansion")
+		}
+		s.out.WriteString(s.src[s.pos : s.pos+end+1])
+		s.pos += end + 1
+	default:
+		s.out.WriteByte('$')
+		s.pos++
+	}
+	return nil
+}
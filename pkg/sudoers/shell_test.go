@@ -0,0 +1,69 @@
+package sudoers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestEscalate(t *testing.T) {
+	allowed := map[string]bool{"cat": true, "mkdir": true, "rm": true, "systemctl": true, "tee": true, "test": true}
+	tests := []struct {
+		name    string
+		script  string
+		want    string
+		wantErr bool
+	}{
+		{name: "program", script: "systemctl restart nginx", want: "sudo systemctl restart nginx"},
+		{name: "list", script: "mkdir -p /etc/app && cat /etc/app/conf", want: "sudo mkdir -p /etc/app && sudo cat /etc/app/conf"},
+		{name: "not allowed", script: "ls /etc; rm -f /etc/app/conf", want: "ls /etc; sudo rm -f /etc/app/conf"},
+		{name: "quoted", script: "rm -f 'a b' \"c;d\"", want: "sudo rm -f 'a b' \"c;d\""},
+		{name: "substitution", script: "echo $(cat /etc/shadow)", want: "echo $(sudo cat /etc/shadow)"},
+		{name: "if", script: "if test -f /a; then rm /a; fi", want: "if sudo test -f /a; then sudo rm /a; fi"},
+		{name: "write", script: "echo hi > /etc/motd", want: "echo hi | sudo tee /etc/motd > /dev/null"},
+		{name: "append", script: "echo hi >> /etc/motd", want: "echo hi | sudo tee -a /etc/motd > /dev/null"},
+		{name: "discarded", script: "systemctl stop a >/dev/null 2>&1", want: "sudo systemctl stop a >/dev/null 2>&1"},
+		{name: "heredoc", script: "cat > /etc/a <<'EOF'\n$body\nEOF\n", want: "sudo cat <<'EOF' | sudo tee /etc/a > /dev/null\n$body\nEOF\n"},
+		{name: "comment", script: "rm /a # rm /b", want: "sudo rm /a # rm /b"},
+		{name: "assignment", script: "LANG=C systemctl start a", wantErr: true},
+		{name: "case", script: "case $1 in a) rm /a ;; esac", wantErr: true},
+		{name: "function", script: "f() { rm /a; }; f", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Escalate(tt.script, "sudo ", func(program string) bool { return allowed[program] })
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Escalate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("Escalate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrograms(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		want   []string
+	}{
+		{name: "pipeline", script: "ls /etc | grep -v conf | sort", want: []string{"grep", "ls", "sort"}},
+		{name: "builtins", script: "cd /tmp && echo hi; true", want: []string{}},
+		{name: "redirect", script: "printf 'x' > /etc/a", want: []string{"tee"}},
+		{name: "nested", script: "test -d \"$(dirname /a/b)\" || mkdir -p /a", want: []string{"dirname", "mkdir", "test"}},
+		{name: "duplicates", script: "rm /a; rm /b", want: []string{"rm"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Programs(tt.script)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Programs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
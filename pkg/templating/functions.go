@@ -0,0 +1,262 @@
+package templating
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+	"text/template/parse"
+
+	"gopkg.in/yaml.v3"
+)
+
+// maxIncludeDepth bounds nested includes, so templates that include each
+// other fail instead of recursing forever
+const maxIncludeDepth = 16
+
+// SecretFunc returns the value of a secret reference such as
+// vault://secret/app/db
+type SecretFunc func(reference string) (string, error)
+
+var (
+	secretMu     sync.Mutex
+	secretLookup SecretFunc
+)
+
+// SetSecretLookup sets how the secret function resolves references. With
+// none set, templates calling secret fail to render.
+func SetSecretLookup(lookup SecretFunc) {
+	secretMu.Lock()
+	defer secretMu.Unlock()
+	secretLookup = lookup
+}
+
+// lookupSecret resolves a secret reference with the configured lookup
+func lookupSecret(reference string) (string, error) {
+	secretMu.Lock()
+	lookup := secretLookup
+	secretMu.Unlock()
+	if lookup == nil {
+		return "", fmt.Errorf("cannot look up secret %s: no secrets providers are configured", reference)
+	}
+	return lookup(reference)
+}
+
+// addLibraryFunctions adds the encoding, regular expression and formatting
+// functions
+func (te *TemplateEngine) addLibraryFunctions() {
+	te.functions["b64enc"] = func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+	te.functions["b64dec"] = func(s string) (string, error) {
+		decoded, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return "", fmt.Errorf("b64dec: %w", err)
+		}
+		return string(decoded), nil
+	}
+	te.functions["toJson"] = toJSON
+	te.functions["toYaml"] = toYAML
+	te.functions["regexMatch"] = func(pattern, s string) (bool, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("regexMatch: %w", err)
+		}
+		return re.MatchString(s), nil
+	}
+	te.functions["regexReplace"] = func(pattern, replacement, s string) (string, error) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return "", fmt.Errorf("regexReplace: %w", err)
+		}
+		return re.ReplaceAllString(s, replacement), nil
+	}
+	te.functions["trim"] = strings.TrimSpace
+	te.functions["split"] = func(sep, s string) []string {
+		return strings.Split(s, sep)
+	}
+	te.functions["quote"] = func(value interface{}) string {
+		return strconv.Quote(fmt.Sprint(value))
+	}
+	te.functions["indent"] = indent
+	te.functions["nindent"] = func(spaces int, s string) string {
+		return "\n" + indent(spaces, s)
+	}
+	te.functions["secret"] = lookupSecret
+}
+
+// empty reports whether default replaces a value: nil, an empty string or
+// an empty list or map
+func empty(value interface{}) bool {
+	if value == nil {
+		return true
+	}
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.String, reflect.Slice, reflect.Map, reflect.Array:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil()
+	}
+	return false
+}
+
+// toJSON encodes a value as compact JSON
+func toJSON(value interface{}) (string, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("toJson: %w", err)
+	}
+	return string(data), nil
+}
+
+// toYAML encodes a value as YAML indented by two spaces, without the
+// trailing newline so it can be piped to indent
+func toYAML(value interface{}) (string, error) {
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(value); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return "", fmt.Errorf("toYaml: %w", err)
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// indent prefixes every line of s with spaces
+func indent(spaces int, s string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(s, "\n", "\n"+pad)
+}
+
+// execute parses and runs a template. Templates it includes are read
+// relative to dir and see the same vars' facts.
+func (te *TemplateEngine) execute(name, text, dir string, data interface{}, vars map[string]interface{}, depth int) (string, error) {
+	if depth > maxIncludeDepth {
+		return "", fmt.Errorf("templates are included more than %d deep, do they include each other?", maxIncludeDepth)
+	}
+	funcs := template.FuncMap{
+		"include": func(name string, data interface{}) (string, error) {
+			path := name
+			if !filepath.IsAbs(path) {
+				path = filepath.Join(dir, path)
+			}
+			content, err := os.ReadFile(path)
+			if err != nil {
+				return "", fmt.Errorf("failed to read included template %s: %w", name, err)
+			}
+			return te.execute(name, string(content), dir, data, vars, depth+1)
+		},
+		"fact": func(name string) interface{} {
+			facts, _ := vars["facts"].(map[string]interface{})
+			return facts[name]
+		},
+	}
+	for fname, fn := range te.functions {
+		funcs[fname] = fn
+	}
+
+	tmpl, err := template.New(name).Funcs(funcs).Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse template: %w", err)
+	}
+	var buf strings.Builder
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("failed to execute template: %w", err)
+	}
+	return buf.String(), nil
+}
+
+// Includes returns the names of the templates a template includes directly,
+// so they can be packed along with it. Names computed while rendering
+// cannot be known beforehand and are an error.
+func Includes(text string) ([]string, error) {
+	tree := parse.New("template")
+	tree.Mode = parse.SkipFuncCheck
+	trees := make(map[string]*parse.Tree)
+	if _, err := tree.Parse(text, "", "", trees); err != nil {
+		return nil, fmt.Errorf("failed to parse template: %w", err)
+	}
+
+	var names []string
+	var walk func(node parse.Node) error
+	walk = func(node parse.Node) error {
+		switch n := node.(type) {
+		case *parse.ListNode:
+			if n == nil {
+				return nil
+			}
+			for _, child := range n.Nodes {
+				if err := walk(child); err != nil {
+					return err
+				}
+			}
+		case *parse.ActionNode:
+			return walk(n.Pipe)
+		case *parse.TemplateNode:
+			return walk(n.Pipe)
+		case *parse.IfNode:
+			return walkBranch(&n.BranchNode, walk)
+		case *parse.RangeNode:
+			return walkBranch(&n.BranchNode, walk)
+		case *parse.WithNode:
+			return walkBranch(&n.BranchNode, walk)
+		case *parse.PipeNode:
+			if n == nil {
+				return nil
+			}
+			for _, cmd := range n.Cmds {
+				if err := walk(cmd); err != nil {
+					return err
+				}
+			}
+		case *parse.CommandNode:
+			if ident, ok := n.Args[0].(*parse.IdentifierNode); ok && ident.Ident == "include" {
+				if len(n.Args) < 2 {
+					return fmt.Errorf("include needs the name of a template")
+				}
+				name, ok := n.Args[1].(*parse.StringNode)
+				if !ok {
+					return fmt.Errorf("include of %s: only templates named by a literal string can be included here", n.Args[1])
+				}
+				names = append(names, name.Text)
+			}
+			for _, arg := range n.Args {
+				if err := walk(arg); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for _, t := range trees {
+		if err := walk(t.Root); err != nil {
+			return nil, err
+		}
+	}
+	sort.Strings(names)
+	return slices.Compact(names), nil
+}
+
+// walkBranch walks the pipeline and both lists of an if, range or with
+func walkBranch(branch *parse.BranchNode, walk func(parse.Node) error) error {
+	if err := walk(branch.Pipe); err != nil {
+		return err
+	}
+	if err := walk(branch.List); err != nil {
+		return err
+	}
+	return walk(branch.ElseList)
+}
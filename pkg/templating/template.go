@@ -3,6 +3,7 @@ package templating
 import (
 	"fmt"
 	"os"
+	"path/filepath"
 	"strings"
 	"text/template"
 )
@@ -10,6 +11,8 @@ import (
 // TemplateEngine provides template rendering capabilities
 type TemplateEngine struct {
 	functions template.FuncMap
+	// baseDir is where included templates are read from
+	baseDir string
 }
 
 // NewTemplateEngine creates a new template engine with built-in functions
@@ -20,6 +23,7 @@ func NewTemplateEngine() *TemplateEngine {
 	
 	// Add built-in functions
 	engine.addBuiltinFunctions()
+	engine.addLibraryFunctions()
 	
 	return engine
 }
@@ -27,7 +31,7 @@ func NewTemplateEngine() *TemplateEngine {
 // addBuiltinFunctions adds commonly used template functions
 func (te *TemplateEngine) addBuiltinFunctions() {
 	te.functions["default"] = func(defaultValue interface{}, value interface{}) interface{} {
-		if value == nil || value == "" {
+		if empty(value) {
 			return defaultValue
 		}
 		return value
@@ -55,19 +59,15 @@ func (te *TemplateEngine) AddFunction(name string, fn interface{}) {
 	te.functions[name] = fn
 }
 
+// SetBaseDir sets the directory include reads relative template paths
+// from, such as the directory of the module the template belongs to
+func (te *TemplateEngine) SetBaseDir(dir string) {
+	te.baseDir = dir
+}
+
 // Render renders a template string with the given variables
 func (te *TemplateEngine) Render(templateStr string, vars map[string]interface{}) (string, error) {
-	tmpl, err := template.New("template").Funcs(te.functions).Parse(templateStr)
-	if err != nil {
-		return "", fmt.Errorf("failed to parse template: %w", err)
-	}
-	
-	var buf strings.Builder
-	if err := tmpl.Execute(&buf, vars); err != nil {
-		return "", fmt.Errorf("failed to execute template: %w", err)
-	}
-	
-	return buf.String(), nil
+	return te.execute("template", templateStr, te.baseDir, vars, vars, 0)
 }
 
 // RenderFile renders a template file with the given variables
@@ -77,7 +77,12 @@ func (te *TemplateEngine) RenderFile(filename string, vars map[string]interface{
 		return "", fmt.Errorf("failed to read template file %s: %w", filename, err)
 	}
 	
-	return te.Render(string(content), vars)
+	// Without a base directory, includes are read next to the template
+	dir := te.baseDir
+	if dir == "" {
+		dir = filepath.Dir(filename)
+	}
+	return te.execute(filepath.Base(filename), string(content), dir, vars, vars, 0)
 }
 
 // RenderToFile renders a template and writes the result to a file
@@ -1,6 +1,9 @@
 package templating
 
 import (
+	"fmt"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -222,3 +225,186 @@ func TestTemplateEngine_WithBuiltinFunctions(t *testing.T) {
 		})
 	}
 }
+
+func TestTemplateEngine_LibraryFunctions(t *testing.T) {
+	tests := []struct {
+		name     string
+		template string
+		vars     map[string]interface{}
+		want     string
+		wantErr  bool
+	}{
+		{
+			name:     "default replaces empty list",
+			template: `{{join "," (default (split "," "a,b") .items)}}`,
+			vars:     map[string]interface{}{"items": []string{}},
+			want:     "a,b",
+		},
+		{
+			name:     "default keeps false",
+			template: `{{default true .enabled}}`,
+			vars:     map[string]interface{}{"enabled": false},
+			want:     "false",
+		},
+		{
+			name:     "b64enc and b64dec",
+			template: `{{b64enc .s}} {{b64dec "aGk="}}`,
+			vars:     map[string]interface{}{"s": "hello"},
+			want:     "aGVsbG8= hi",
+		},
+		{
+			name:     "invalid base64",
+			template: `{{b64dec "!"}}`,
+			wantErr:  true,
+		},
+		{
+			name:     "toJson",
+			template: `{{toJson .m}}`,
+			vars:     map[string]interface{}{"m": map[string]interface{}{"b": []int{1, 2}, "a": "x"}},
+			want:     `{"a":"x","b":[1,2]}`,
+		},
+		{
+			name:     "toYaml with nindent",
+			template: "upstream:{{toYaml .m | nindent 2}}",
+			vars:     map[string]interface{}{"m": map[string]interface{}{"hosts": []string{"a", "b"}}},
+			want:     "upstream:\n  hosts:\n    - a\n    - b",
+		},
+		{
+			name:     "regexReplace",
+			template: `{{regexReplace "[^a-z0-9]+" "-" .name}}`,
+			vars:     map[string]interface{}{"name": "web server.01"},
+			want:     "web-server-01",
+		},
+		{
+			name:     "regexMatch",
+			template: `{{if regexMatch "^10\\." .ip}}private{{end}}`,
+			vars:     map[string]interface{}{"ip": "10.0.0.5"},
+			want:     "private",
+		},
+		{
+			name:     "invalid regex",
+			template: `{{regexMatch "(" .ip}}`,
+			vars:     map[string]interface{}{"ip": "10.0.0.5"},
+			wantErr:  true,
+		},
+		{
+			name:     "trim and quote",
+			template: `{{trim .s | quote}}`,
+			vars:     map[string]interface{}{"s": "  a \"b\"\n"},
+			want:     `"a \"b\""`,
+		},
+		{
+			name:     "fact",
+			template: `{{fact "os_family"}} {{fact "missing" | default "none"}}`,
+			vars:     map[string]interface{}{"facts": map[string]interface{}{"os_family": "linux"}},
+			want:     "linux none",
+		},
+		{
+			name:     "fact without facts",
+			template: `{{fact "os_family" | default "unknown"}}`,
+			want:     "unknown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewTemplateEngine().Render(tt.template, tt.vars)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("TemplateEngine.Render() = %q, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("TemplateEngine.Render() unexpected error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("TemplateEngine.Render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTemplateEngine_Secret(t *testing.T) {
+	defer SetSecretLookup(nil)
+
+	engine := NewTemplateEngine()
+	if _, err := engine.Render(`{{secret "vault://app/db"}}`, nil); err == nil {
+		t.Error("TemplateEngine.Render() without a secret lookup, want error")
+	}
+
+	SetSecretLookup(func(reference string) (string, error) {
+		if reference != "vault://app/db" {
+			return "", fmt.Errorf("no secret %s", reference)
+		}
+		return "s3cret", nil
+	})
+	got, err := engine.Render(`password={{secret "vault://app/db"}}`, nil)
+	if err != nil {
+		t.Fatalf("TemplateEngine.Render() unexpected error = %v", err)
+	}
+	if got != "password=s3cret" {
+		t.Errorf("TemplateEngine.Render() = %q", got)
+	}
+	if _, err := engine.Render(`{{secret "vault://other"}}`, nil); err == nil || !strings.Contains(err.Error(), "no secret vault://other") {
+		t.Errorf("TemplateEngine.Render() error = %v, want the lookup's error", err)
+	}
+}
+
+func TestTemplateEngine_Include(t *testing.T) {
+	// Without a base directory, a template file includes from its own
+	got, err := NewTemplateEngine().RenderFile("testdata/include.tmpl", map[string]interface{}{"name": "Chisel"})
+	if err != nil {
+		t.Fatalf("TemplateEngine.RenderFile() unexpected error = %v", err)
+	}
+	if got != "Hello Chisel\n" {
+		t.Errorf("TemplateEngine.RenderFile() = %q", got)
+	}
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"header.tmpl": `# {{.title}}{{include "footer.tmpl" .}}`,
+		"footer.tmpl": ` ({{fact "hostname"}})`,
+		"loop.tmpl":   `{{include "loop.tmpl" .}}`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	engine := NewTemplateEngine()
+	engine.SetBaseDir(dir)
+
+	vars := map[string]interface{}{"title": "nginx", "facts": map[string]interface{}{"hostname": "web1"}}
+	got, err = engine.Render(`{{include "header.tmpl" .}}`, vars)
+	if err != nil {
+		t.Fatalf("TemplateEngine.Render() unexpected error = %v", err)
+	}
+	if got != "# nginx (web1)" {
+		t.Errorf("TemplateEngine.Render() = %q", got)
+	}
+
+	if _, err := engine.Render(`{{include "missing.tmpl" .}}`, nil); err == nil || !strings.Contains(err.Error(), "missing.tmpl") {
+		t.Errorf("TemplateEngine.Render() error = %v, want missing include", err)
+	}
+	if _, err := engine.Render(`{{include "loop.tmpl" .}}`, nil); err == nil || !strings.Contains(err.Error(), "included more than") {
+		t.Errorf("TemplateEngine.Render() error = %v, want include depth error", err)
+	}
+}
+
+func TestIncludes(t *testing.T) {
+	names, err := Includes(`{{define "row"}}{{include "row.tmpl" .}}{{end}}` +
+		`{{if .tls}}{{include "tls.tmpl" . | indent 2}}{{else}}{{include "plain.tmpl" .}}{{end}}` +
+		`{{range .sites}}{{upper (include "site.tmpl" .)}}{{end}}{{include "tls.tmpl" .}}`)
+	if err != nil {
+		t.Fatalf("Includes() error = %v", err)
+	}
+	want := []string{"plain.tmpl", "row.tmpl", "site.tmpl", "tls.tmpl"}
+	if strings.Join(names, ",") != strings.Join(want, ",") {
+		t.Errorf("Includes() = %v, want %v", names, want)
+	}
+
+	if _, err := Includes(`{{include .name .}}`); err == nil || !strings.Contains(err.Error(), "literal string") {
+		t.Errorf("Includes() of a computed name error = %v", err)
+	}
+}
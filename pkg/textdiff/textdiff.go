@@ -0,0 +1,174 @@
+// Package textdiff compares texts line by line and formats the differences
+// as a unified diff, as diff -u and git diff print them.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+// DefaultContext is how many unchanged lines surround each change
+const DefaultContext = 3
+
+// op is what happened to a line
+type op byte
+
+const (
+	opEqual  op = ' '
+	opDelete op = '-'
+	opInsert op = '+'
+)
+
+// edit is one line of the diff
+type edit struct {
+	op   op
+	text string
+	// a and b are the line's index in the old and new text
+	a, b int
+}
+
+// Unified returns the unified diff that turns a into b, with context lines
+// around each change, or "" when they are the same
+func Unified(fromName, toName, a, b string, context int) string {
+	if a == b {
+		return ""
+	}
+	if context < 0 {
+		context = 0
+	}
+	edits := diffLines(splitLines(a), splitLines(b))
+
+	var out strings.Builder
+	fmt.Fprintf(&out, "--- %s\n+++ %s\n", fromName, toName)
+	for _, hunk := range hunks(edits, context) {
+		writeHunk(&out, hunk)
+	}
+	return out.String()
+}
+
+// splitLines splits text into lines, keeping each line's newline so a
+// missing newline at the end of the text shows up as a change
+func splitLines(text string) []string {
+	if text == "" {
+		return nil
+	}
+	lines := strings.SplitAfter(text, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+// diffLines returns the edits turning a into b along a longest common
+// subsequence of their lines
+func diffLines(a, b []string) []edit {
+	// Common leading and trailing lines keep the table small for the usual
+	// case of a few changed lines in a long file
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	midA, midB := a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]
+
+	// lcs[i][j] is the length of the longest common subsequence of
+	// midA[i:] and midB[j:]
+	lcs := make([][]int, len(midA)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(midB)+1)
+	}
+	for i := len(midA) - 1; i >= 0; i-- {
+		for j := len(midB) - 1; j >= 0; j-- {
+			if midA[i] == midB[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	edits := make([]edit, 0, len(a)+len(b))
+	for i := 0; i < prefix; i++ {
+		edits = append(edits, edit{op: opEqual, text: a[i], a: i, b: i})
+	}
+	i, j := 0, 0
+	for i < len(midA) || j < len(midB) {
+		switch {
+		case i < len(midA) && j < len(midB) && midA[i] == midB[j]:
+			edits = append(edits, edit{op: opEqual, text: midA[i], a: prefix + i, b: prefix + j})
+			i++
+			j++
+		case j < len(midB) && (i == len(midA) || lcs[i][j+1] > lcs[i+1][j]):
+			edits = append(edits, edit{op: opInsert, text: midB[j], a: prefix + i, b: prefix + j})
+			j++
+		default:
+			edits = append(edits, edit{op: opDelete, text: midA[i], a: prefix + i, b: prefix + j})
+			i++
+		}
+	}
+	for k := 0; k < suffix; k++ {
+		edits = append(edits, edit{op: opEqual, text: a[len(a)-suffix+k], a: len(a) - suffix + k, b: len(b) - suffix + k})
+	}
+	return edits
+}
+
+// hunks groups the changes with their context, merging changes whose
+// context overlaps
+func hunks(edits []edit, context int) [][]edit {
+	var groups [][]edit
+	start, end := -1, -1
+	for i, e := range edits {
+		if e.op == opEqual {
+			continue
+		}
+		from, to := max(i-context, 0), min(i+context+1, len(edits))
+		if start >= 0 && from <= end {
+			end = to
+			continue
+		}
+		if start >= 0 {
+			groups = append(groups, edits[start:end])
+		}
+		start, end = from, to
+	}
+	if start >= 0 {
+		groups = append(groups, edits[start:end])
+	}
+	return groups
+}
+
+// writeHunk writes a hunk with its @@ header
+func writeHunk(out *strings.Builder, hunk []edit) {
+	var countA, countB int
+	for _, e := range hunk {
+		if e.op != opInsert {
+			countA++
+		}
+		if e.op != opDelete {
+			countB++
+		}
+	}
+	fmt.Fprintf(out, "@@ -%s +%s @@\n", hunkRange(hunk[0].a, countA), hunkRange(hunk[0].b, countB))
+	for _, e := range hunk {
+		out.WriteByte(byte(e.op))
+		out.WriteString(e.text)
+		if !strings.HasSuffix(e.text, "\n") {
+			out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// hunkRange formats the start and length of a hunk's lines; an empty range
+// starts at the line before it
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
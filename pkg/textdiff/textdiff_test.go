@@ -0,0 +1,94 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name    string
+		a, b    string
+		context int
+		want    string
+	}{
+		{
+			name: "same",
+			a:    "a\nb\n",
+			b:    "a\nb\n",
+			want: "",
+		},
+		{
+			name:    "changed line",
+			a:       "a\nb\nc\n",
+			b:       "a\nB\nc\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+		},
+		{
+			name:    "new file",
+			a:       "",
+			b:       "a\nb\n",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -0,0 +1,2 @@\n+a\n+b\n",
+		},
+		{
+			name:    "removed file",
+			a:       "a\n",
+			b:       "",
+			context: 3,
+			want:    "--- old\n+++ new\n@@ -1 +0,0 @@\n-a\n",
+		},
+		{
+			name:    "missing newline at end",
+			a:       "a\nb\n",
+			b:       "a\nb",
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -2 +2 @@\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name:    "separate hunks",
+			a:       "1\n2\n3\n4\n5\n6\n7\n8\n",
+			b:       "one\n2\n3\n4\n5\n6\n7\neight\n",
+			context: 1,
+			want: "--- old\n+++ new\n" +
+				"@@ -1,2 +1,2 @@\n-1\n+one\n 2\n" +
+				"@@ -7,2 +7,2 @@\n 7\n-8\n+eight\n",
+		},
+		{
+			name:    "overlapping context merges hunks",
+			a:       "1\n2\n3\n4\n",
+			b:       "one\n2\n3\nfour\n",
+			context: 1,
+			want:    "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-1\n+one\n 2\n 3\n-4\n+four\n",
+		},
+		{
+			name:    "inserted lines",
+			a:       "a\nd\n",
+			b:       "a\nb\nc\nd\n",
+			context: 0,
+			want:    "--- old\n+++ new\n@@ -1,0 +2,2 @@\n+b\n+c\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("old", "new", tt.a, tt.b, tt.context); got != tt.want {
+				t.Errorf("Unified =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnified_LongFile(t *testing.T) {
+	var lines []string
+	for i := 0; i < 2000; i++ {
+		lines = append(lines, "line")
+	}
+	a := strings.Join(lines, "\n") + "\n"
+	b := strings.Replace(a, "line\n", "first\n", 1)
+
+	got := Unified("old", "new", a, b, DefaultContext)
+	if !strings.HasPrefix(got, "--- old\n+++ new\n@@ -1,4 +1,4 @@\n-line\n+first\n") {
+		t.Errorf("Unified = %q", got)
+	}
+}
@@ -0,0 +1,160 @@
+// Package topology tracks which modules are rolling out, along with the
+// modules their services depend on, so a change to a module others depend
+// on can be flagged while one of them is mid-rollout
+package topology
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+// Modes of the topology check
+const (
+	// ModeWarn prints conflicts and goes on
+	ModeWarn = "warn"
+	// ModeBlock refuses to apply a module while modules depending on it
+	// are rolling out
+	ModeBlock = "block"
+	// ModeOff neither records rollouts nor checks for conflicts
+	ModeOff = "off"
+)
+
+// bucket holds the rollouts in progress, keyed by ID
+const bucket = "rollouts"
+
+// StaleAfter is how long a rollout is considered in progress at most. A
+// forge that was killed mid-rollout never finishes its rollout, so it is
+// left out once it is this old.
+const StaleAfter = 12 * time.Hour
+
+// ValidateMode checks that a mode is one of warn, block or off
+func ValidateMode(mode string) error {
+	switch mode {
+	case ModeWarn, ModeBlock, ModeOff:
+		return nil
+	default:
+		return fmt.Errorf("unknown topology mode %q, must be one of: warn, block, off", mode)
+	}
+}
+
+// Rollout is a module being applied
+type Rollout struct {
+	ID     string `json:"id"`
+	Module string `json:"module"`
+	// DependsOn lists the modules the module's services depend on
+	DependsOn   []string  `json:"depends_on,omitempty"`
+	Hosts       []string  `json:"hosts,omitempty"`
+	TriggeredBy string    `json:"triggered_by,omitempty"`
+	Started     time.Time `json:"started"`
+}
+
+// Conflict is a module rolling out while a module it depends on is about
+// to change
+type Conflict struct {
+	// Module is the module about to change
+	Module string
+	// Dependent is the rollout of a module that depends on it
+	Dependent Rollout
+}
+
+// String describes the conflict
+func (c Conflict) String() string {
+	by := ""
+	if c.Dependent.TriggeredBy != "" {
+		by = " by " + c.Dependent.TriggeredBy
+	}
+	return fmt.Sprintf("%s depends on %s and is rolling out to %d host(s) (rollout %s, started %s%s)",
+		c.Dependent.Module, c.Module, len(c.Dependent.Hosts), c.Dependent.ID,
+		c.Dependent.Started.Local().Format("2006-01-02 15:04:05 MST"), by)
+}
+
+// Tracker records rollouts in the controller store
+type Tracker struct {
+	kv  store.Store
+	now func() time.Time
+}
+
+// NewTracker creates a tracker of the rollouts in kv
+func NewTracker(kv store.Store) *Tracker {
+	return &Tracker{kv: kv, now: time.Now}
+}
+
+// Start records that a rollout began and returns it with its ID and start
+// time set
+func (t *Tracker) Start(rollout Rollout) (Rollout, error) {
+	rollout.Started = t.now()
+	if rollout.ID == "" {
+		suffix := make([]byte, 4)
+		rand.Read(suffix)
+		rollout.ID = rollout.Started.UTC().Format("20060102T150405") + "-" + hex.EncodeToString(suffix)
+	}
+	if err := store.PutJSON(t.kv, bucket, rollout.ID, rollout); err != nil {
+		return rollout, fmt.Errorf("failed to record rollout of %s: %w", rollout.Module, err)
+	}
+	return rollout, nil
+}
+
+// Finish removes a rollout once it is done
+func (t *Tracker) Finish(id string) error {
+	if err := t.kv.Delete(bucket, id); err != nil && !errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("failed to finish rollout %s: %w", id, err)
+	}
+	return nil
+}
+
+// Active returns the rollouts in progress, oldest first. Stale rollouts
+// are removed.
+func (t *Tracker) Active() ([]Rollout, error) {
+	ids, err := t.kv.Keys(bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read rollouts: %w", err)
+	}
+	rollouts := make([]Rollout, 0, len(ids))
+	for _, id := range ids {
+		var rollout Rollout
+		if err := store.GetJSON(t.kv, bucket, id, &rollout); err != nil {
+			if errors.Is(err, store.ErrNotFound) {
+				continue
+			}
+			return nil, err
+		}
+		if t.now().Sub(rollout.Started) > StaleAfter {
+			if err := t.Finish(id); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		rollouts = append(rollouts, rollout)
+	}
+	sort.SliceStable(rollouts, func(i, j int) bool { return rollouts[i].Started.Before(rollouts[j].Started) })
+	return rollouts, nil
+}
+
+// Conflicts returns the rollouts in progress of modules that depend on
+// module, which a change to it could disrupt
+func (t *Tracker) Conflicts(module string) ([]Conflict, error) {
+	rollouts, err := t.Active()
+	if err != nil {
+		return nil, err
+	}
+	var conflicts []Conflict
+	for _, rollout := range rollouts {
+		if rollout.Module == module {
+			continue
+		}
+		for _, dependency := range rollout.DependsOn {
+			if strings.EqualFold(dependency, module) {
+				conflicts = append(conflicts, Conflict{Module: module, Dependent: rollout})
+				break
+			}
+		}
+	}
+	return conflicts, nil
+}
@@ -0,0 +1,86 @@
+package topology
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/store"
+)
+
+func TestTracker_Conflicts(t *testing.T) {
+	kv, err := store.Open("memory://")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2026, 5, 1, 12, 0, 0, 0, time.UTC)
+	tracker := NewTracker(kv)
+	tracker.now = func() time.Time { return now }
+
+	web, err := tracker.Start(Rollout{Module: "web", DependsOn: []string{"db", "cache"}, Hosts: []string{"web1", "web2"}, TriggeredBy: "alice@laptop"})
+	if err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+	if web.ID == "" || !web.Started.Equal(now) {
+		t.Errorf("Start() = %+v", web)
+	}
+	if _, err := tracker.Start(Rollout{ID: "worker-1", Module: "worker", DependsOn: []string{"queue"}}); err != nil {
+		t.Fatalf("Start() error = %v", err)
+	}
+
+	tests := []struct {
+		module string
+		want   []string
+	}{
+		{module: "db", want: []string{"web"}},
+		{module: "DB", want: []string{"web"}},
+		{module: "queue", want: []string{"worker"}},
+		{module: "web"},
+		{module: "monitoring"},
+	}
+	for _, tt := range tests {
+		conflicts, err := tracker.Conflicts(tt.module)
+		if err != nil {
+			t.Fatalf("Conflicts(%s) error = %v", tt.module, err)
+		}
+		var got []string
+		for _, conflict := range conflicts {
+			got = append(got, conflict.Dependent.Module)
+		}
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Conflicts(%s) = %v, want %v", tt.module, got, tt.want)
+		}
+	}
+
+	conflicts, _ := tracker.Conflicts("db")
+	if got := conflicts[0].String(); !strings.HasPrefix(got, "web depends on db and is rolling out to 2 host(s) (rollout "+web.ID) || !strings.HasSuffix(got, "by alice@laptop)") {
+		t.Errorf("String() = %s", got)
+	}
+
+	// Finished and stale rollouts are no longer in progress
+	if err := tracker.Finish(web.ID); err != nil {
+		t.Fatalf("Finish() error = %v", err)
+	}
+	if err := tracker.Finish(web.ID); err != nil {
+		t.Errorf("Finish() twice error = %v", err)
+	}
+	now = now.Add(StaleAfter + time.Minute)
+	active, err := tracker.Active()
+	if err != nil || len(active) != 0 {
+		t.Errorf("Active() = %v, %v, want none", active, err)
+	}
+	if keys, _ := kv.Keys(bucket); len(keys) != 0 {
+		t.Errorf("stale rollouts left in the store: %v", keys)
+	}
+}
+
+func TestValidateMode(t *testing.T) {
+	for _, mode := range []string{ModeWarn, ModeBlock, ModeOff} {
+		if err := ValidateMode(mode); err != nil {
+			t.Errorf("ValidateMode(%s) error = %v", mode, err)
+		}
+	}
+	if err := ValidateMode("strict"); err == nil {
+		t.Error("ValidateMode(strict) succeeded")
+	}
+}
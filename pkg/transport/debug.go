@@ -0,0 +1,46 @@
+package transport
+
+import (
+	"context"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/debuglog"
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// DebugTransport logs every command it executes with its exit code,
+// duration and output. Everything logged passes through the logger's
+// redactor.
+type DebugTransport struct {
+	Transport
+	logger *debuglog.Logger
+}
+
+// NewDebugTransport wraps a transport with a debug logger. Without a logger
+// the transport is returned unchanged.
+func NewDebugTransport(t Transport, logger *debuglog.Logger) Transport {
+	if logger == nil {
+		return t
+	}
+	return &DebugTransport{Transport: t, logger: logger}
+}
+
+// Execute runs the command and logs it together with its result
+func (t *DebugTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	t.logger.Printf("exec", "run %s", debuglog.Truncate(command))
+	start := time.Now()
+	result, err := t.Transport.Execute(ctx, command)
+	elapsed := time.Since(start).Round(time.Millisecond)
+	if err != nil {
+		t.logger.Printf("exec", "error after %s: %v", elapsed, err)
+		return result, err
+	}
+	t.logger.Printf("exec", "exit=%d after %s", result.ExitCode, elapsed)
+	if result.Stdout != "" {
+		t.logger.Printf("exec", "stdout: %s", debuglog.Truncate(result.Stdout))
+	}
+	if result.Stderr != "" {
+		t.logger.Printf("exec", "stderr: %s", debuglog.Truncate(result.Stderr))
+	}
+	return result, nil
+}
@@ -0,0 +1,69 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// DockerTransport runs commands inside a running container with docker exec
+type DockerTransport struct {
+	container string
+	user      string
+	binary    string
+	run       runFunc
+}
+
+// NewDockerTransport creates a transport for the named container
+func NewDockerTransport(container, user string) *DockerTransport {
+	return &DockerTransport{
+		container: container,
+		user:      user,
+		binary:    "docker",
+		run:       runCommand,
+	}
+}
+
+// Connect checks that the container exists and is running
+func (d *DockerTransport) Connect(ctx context.Context) error {
+	result, err := d.run(ctx, d.binary, "inspect", "--format", "{{.State.Running}}", d.container)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("container %s not found: %s", d.container, strings.TrimSpace(result.Stderr))
+	}
+	if strings.TrimSpace(result.Stdout) != "true" {
+		return fmt.Errorf("container %s is not running", d.container)
+	}
+	return nil
+}
+
+// Execute runs a shell command inside the container
+func (d *DockerTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	result, err := d.run(ctx, d.binary, d.execArgs(command)...)
+	if err != nil {
+		return nil, err
+	}
+	result.Command = command
+	return result, nil
+}
+
+// Close is a no-op for docker exec
+func (d *DockerTransport) Close() error {
+	return nil
+}
+
+// execArgs builds the docker exec arguments for a command
+func (d *DockerTransport) execArgs(command string) []string {
+	args := []string{"exec", "-i"}
+	if d.user != "" {
+		args = append(args, "--user", d.user)
+	}
+	return append(args, d.container, "/bin/sh", "-c", command)
+}
+
+// Ensure DockerTransport implements Transport
+var _ Transport = (*DockerTransport)(nil)
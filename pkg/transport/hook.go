@@ -0,0 +1,97 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"regexp"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// CommandHook sees every command before it is sent to the target and
+// refuses it by returning an error. types.OperationFromContext tells it the
+// resource the command runs for, when a provider runs it.
+type CommandHook func(ctx context.Context, command string) error
+
+// HookedTransport runs commands only once every hook allows them
+type HookedTransport struct {
+	Transport
+	hooks []CommandHook
+}
+
+// NewHookedTransport wraps a transport with command hooks. Without any the
+// transport is returned unchanged.
+func NewHookedTransport(t Transport, hooks ...CommandHook) Transport {
+	if len(hooks) == 0 {
+		return t
+	}
+	return &HookedTransport{Transport: t, hooks: hooks}
+}
+
+// check runs the hooks on a command
+func (t *HookedTransport) check(ctx context.Context, command string) error {
+	for _, hook := range t.hooks {
+		if err := hook(ctx, command); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Execute sends the command once every hook allows it
+func (t *HookedTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	if err := t.check(ctx, command); err != nil {
+		return nil, err
+	}
+	return t.Transport.Execute(ctx, command)
+}
+
+// ExecuteWithInput sends the command with its input once every hook allows it
+func (t *HookedTransport) ExecuteWithInput(ctx context.Context, command string, input io.Reader) (*ssh.ExecuteResult, error) {
+	executor, ok := t.Transport.(ssh.InputExecutor)
+	if !ok {
+		return nil, fmt.Errorf("transport cannot feed standard input")
+	}
+	if err := t.check(ctx, command); err != nil {
+		return nil, err
+	}
+	return executor.ExecuteWithInput(ctx, command, input)
+}
+
+// DenyCommands returns a hook refusing the commands a pattern matches, a
+// regular expression searched for anywhere in the command
+func DenyCommands(patterns []string) (CommandHook, error) {
+	denied := make([]*regexp.Regexp, len(patterns))
+	for i, pattern := range patterns {
+		compiled, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid denied command pattern %q: %w", pattern, err)
+		}
+		denied[i] = compiled
+	}
+	return func(ctx context.Context, command string) error {
+		for _, pattern := range denied {
+			if !pattern.MatchString(command) {
+				continue
+			}
+			if op, ok := types.OperationFromContext(ctx); ok {
+				return fmt.Errorf("command denied by pattern %q while %s %s", pattern, applyingVerb(op.Kind), op.Resource.ResourceID())
+			}
+			return fmt.Errorf("command denied by pattern %q", pattern)
+		}
+		return nil
+	}, nil
+}
+
+// applyingVerb describes what a provider was doing when it ran a command
+func applyingVerb(kind types.OperationKind) string {
+	switch kind {
+	case types.OperationRead:
+		return "reading"
+	case types.OperationDiff:
+		return "diffing"
+	}
+	return "applying"
+}
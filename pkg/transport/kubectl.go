@@ -0,0 +1,80 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// KubectlTransport runs commands inside a pod with kubectl exec
+type KubectlTransport struct {
+	pod       string
+	namespace string
+	container string
+	binary    string
+	run       runFunc
+}
+
+// NewKubectlTransport creates a transport for a pod. Namespace and container are optional.
+func NewKubectlTransport(pod, namespace, container string) *KubectlTransport {
+	return &KubectlTransport{
+		pod:       pod,
+		namespace: namespace,
+		container: container,
+		binary:    "kubectl",
+		run:       runCommand,
+	}
+}
+
+// Connect checks that the pod exists and is running
+func (k *KubectlTransport) Connect(ctx context.Context) error {
+	args := append(k.scopeArgs(), "get", "pod", k.pod, "-o", "jsonpath={.status.phase}")
+	result, err := k.run(ctx, k.binary, args...)
+	if err != nil {
+		return err
+	}
+	if result.ExitCode != 0 {
+		return fmt.Errorf("pod %s not found: %s", k.pod, strings.TrimSpace(result.Stderr))
+	}
+	if phase := strings.TrimSpace(result.Stdout); phase != "Running" {
+		return fmt.Errorf("pod %s is not running (phase %s)", k.pod, phase)
+	}
+	return nil
+}
+
+// Execute runs a shell command inside the pod
+func (k *KubectlTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	result, err := k.run(ctx, k.binary, k.execArgs(command)...)
+	if err != nil {
+		return nil, err
+	}
+	result.Command = command
+	return result, nil
+}
+
+// Close is a no-op for kubectl exec
+func (k *KubectlTransport) Close() error {
+	return nil
+}
+
+// scopeArgs returns the namespace arguments shared by every kubectl call
+func (k *KubectlTransport) scopeArgs() []string {
+	if k.namespace == "" {
+		return nil
+	}
+	return []string{"--namespace", k.namespace}
+}
+
+// execArgs builds the kubectl exec arguments for a command
+func (k *KubectlTransport) execArgs(command string) []string {
+	args := append(k.scopeArgs(), "exec", "-i", k.pod)
+	if k.container != "" {
+		args = append(args, "--container", k.container)
+	}
+	return append(args, "--", "/bin/sh", "-c", command)
+}
+
+// Ensure KubectlTransport implements Transport
+var _ Transport = (*KubectlTransport)(nil)
@@ -0,0 +1,40 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/ataiva-software/forge/pkg/bandwidth"
+	"github.com/ataiva-software/forge/pkg/ssh"
+)
+
+// ThrottledTransport waits on bandwidth limiters before sending each command,
+// so large uploads split into several commands are spread over time
+type ThrottledTransport struct {
+	Transport
+	limiters []*bandwidth.Limiter
+}
+
+// NewThrottledTransport wraps a transport with bandwidth limiters. Nil
+// limiters are ignored; without any the transport is returned unchanged.
+func NewThrottledTransport(t Transport, limiters ...*bandwidth.Limiter) Transport {
+	var active []*bandwidth.Limiter
+	for _, limiter := range limiters {
+		if limiter != nil {
+			active = append(active, limiter)
+		}
+	}
+	if len(active) == 0 {
+		return t
+	}
+	return &ThrottledTransport{Transport: t, limiters: active}
+}
+
+// Execute sends a command once every limiter allows its size
+func (t *ThrottledTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	for _, limiter := range t.limiters {
+		if err := limiter.Wait(ctx, len(command)); err != nil {
+			return nil, err
+		}
+	}
+	return t.Transport.Execute(ctx, command)
+}
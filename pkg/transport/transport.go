@@ -0,0 +1,68 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/winrm"
+)
+
+// Transport executes commands on a target. It shares the ssh.Executor
+// contract so providers work unchanged over any transport.
+type Transport = ssh.Executor
+
+// New creates the transport selected by the connection configuration
+func New(config *ssh.ConnectionConfig) (Transport, error) {
+	switch config.TransportName() {
+	case ssh.TransportSSH:
+		return ssh.NewRealSSHConnection(config), nil
+	case ssh.TransportLocal:
+		return &ssh.LocalExecutor{}, nil
+	case ssh.TransportDocker:
+		return NewDockerTransport(config.Host, config.User), nil
+	case ssh.TransportKubectl:
+		return NewKubectlTransport(config.Host, config.Namespace, config.Container), nil
+	case ssh.TransportWinRM:
+		return NewWinRMTransport(&winrm.ConnectionConfig{
+			Host:     config.Host,
+			Port:     config.Port,
+			User:     config.User,
+			Password: config.Password,
+			Timeout:  config.Timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown transport %q", config.Transport)
+	}
+}
+
+// runFunc runs a local program and returns its result
+type runFunc func(ctx context.Context, name string, args ...string) (*ssh.ExecuteResult, error)
+
+// runCommand runs a local program, capturing stdout, stderr and the exit code.
+// A non-zero exit is reported in the result rather than as an error.
+func runCommand(ctx context.Context, name string, args ...string) (*ssh.ExecuteResult, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+
+	stdout, stderr := ssh.NewOutputBuffer(ctx, ssh.StreamStdout), ssh.NewOutputBuffer(ctx, ssh.StreamStderr)
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+
+	result := &ssh.ExecuteResult{Command: cmd.String()}
+
+	err := cmd.Run()
+	result.Stdout = stdout.String()
+	result.Stderr = stderr.String()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		result.ExitCode = exitErr.ExitCode()
+		return result, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to run %s: %w", name, err)
+	}
+	return result, nil
+}
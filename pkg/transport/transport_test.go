@@ -0,0 +1,242 @@
+package transport
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/bandwidth"
+	"github.com/ataiva-software/forge/pkg/debuglog"
+	"github.com/ataiva-software/forge/pkg/redact"
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/types"
+)
+
+// fakeRunner records invocations and returns a canned result
+type fakeRunner struct {
+	calls  [][]string
+	result ssh.ExecuteResult
+}
+
+func (f *fakeRunner) run(ctx context.Context, name string, args ...string) (*ssh.ExecuteResult, error) {
+	f.calls = append(f.calls, append([]string{name}, args...))
+	result := f.result
+	return &result, nil
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  ssh.ConnectionConfig
+		want    string
+		wantErr bool
+	}{
+		{name: "default ssh", config: ssh.ConnectionConfig{Host: "web1"}, want: "*ssh.RealSSHConnection"},
+		{name: "local", config: ssh.ConnectionConfig{Transport: "local"}, want: "*ssh.LocalExecutor"},
+		{name: "docker", config: ssh.ConnectionConfig{Transport: "docker", Host: "app"}, want: "*transport.DockerTransport"},
+		{name: "kubectl", config: ssh.ConnectionConfig{Transport: "kubectl", Host: "app-0"}, want: "*transport.KubectlTransport"},
+		{name: "winrm", config: ssh.ConnectionConfig{Transport: "winrm", Host: "win1"}, want: "*transport.WinRMTransport"},
+		{name: "unknown", config: ssh.ConnectionConfig{Transport: "telnet"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := New(&tt.config)
+			if tt.wantErr {
+				if err == nil {
+					t.Error("Expected error for unknown transport")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			if typeName := fmt.Sprintf("%T", got); typeName != tt.want {
+				t.Errorf("New() = %s, want %s", typeName, tt.want)
+			}
+		})
+	}
+}
+
+func TestDockerTransport(t *testing.T) {
+	runner := &fakeRunner{result: ssh.ExecuteResult{Stdout: "true\n"}}
+	docker := NewDockerTransport("web", "app")
+	docker.run = runner.run
+
+	if err := docker.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+
+	result, err := docker.Execute(context.Background(), "echo hi")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.Command != "echo hi" {
+		t.Errorf("Expected command to be reported as given, got %q", result.Command)
+	}
+
+	want := "docker exec -i --user app web /bin/sh -c echo hi"
+	if got := strings.Join(runner.calls[1], " "); got != want {
+		t.Errorf("exec args = %q, want %q", got, want)
+	}
+
+	runner.result = ssh.ExecuteResult{Stdout: "false\n"}
+	if err := docker.Connect(context.Background()); err == nil {
+		t.Error("Expected error for stopped container")
+	}
+}
+
+func TestKubectlTransport(t *testing.T) {
+	runner := &fakeRunner{result: ssh.ExecuteResult{Stdout: "Running"}}
+	kubectl := NewKubectlTransport("app-0", "prod", "web")
+	kubectl.run = runner.run
+
+	if err := kubectl.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect() error = %v", err)
+	}
+	if _, err := kubectl.Execute(context.Background(), "id"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+
+	want := "kubectl --namespace prod exec -i app-0 --container web -- /bin/sh -c id"
+	if got := strings.Join(runner.calls[1], " "); got != want {
+		t.Errorf("exec args = %q, want %q", got, want)
+	}
+
+	runner.result = ssh.ExecuteResult{Stdout: "Pending"}
+	if err := kubectl.Connect(context.Background()); err == nil {
+		t.Error("Expected error for pod that is not running")
+	}
+}
+
+func TestRunCommand(t *testing.T) {
+	result, err := runCommand(context.Background(), "/bin/sh", "-c", "echo out; echo err >&2; exit 3")
+	if err != nil {
+		t.Fatalf("runCommand() error = %v", err)
+	}
+	if result.ExitCode != 3 || result.Stdout != "out\n" || result.Stderr != "err\n" {
+		t.Errorf("Unexpected result %+v", result)
+	}
+}
+
+// recordingTransport records the commands it executes
+type recordingTransport struct {
+	ssh.LocalExecutor
+	commands []string
+}
+
+func (r *recordingTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	r.commands = append(r.commands, command)
+	return &ssh.ExecuteResult{Command: command}, nil
+}
+
+func TestThrottledTransport(t *testing.T) {
+	inner := &recordingTransport{}
+	if NewThrottledTransport(inner, nil, nil) != Transport(inner) {
+		t.Error("Expected a transport without limiters to be returned unchanged")
+	}
+
+	throttled := NewThrottledTransport(inner, bandwidth.NewLimiter(1), nil)
+	if _, ok := throttled.(*ThrottledTransport); !ok {
+		t.Fatalf("Expected a ThrottledTransport, got %T", throttled)
+	}
+
+	// The first command is sent at once; the next would wait far beyond the deadline
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := throttled.Execute(ctx, "echo one"); err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if _, err := throttled.Execute(ctx, "echo two"); err == nil {
+		t.Error("Expected the second command to be held back by the limiter")
+	}
+	if len(inner.commands) != 1 {
+		t.Errorf("Expected 1 command to reach the target, got %q", inner.commands)
+	}
+}
+
+// commandProvider runs the command property of its resources
+type commandProvider struct {
+	executor Transport
+}
+
+func (p *commandProvider) Type() string                            { return "shell" }
+func (p *commandProvider) Validate(resource *types.Resource) error { return nil }
+func (p *commandProvider) Read(ctx context.Context, resource *types.Resource) (map[string]interface{}, error) {
+	return nil, nil
+}
+func (p *commandProvider) Diff(ctx context.Context, resource *types.Resource, current map[string]interface{}) (*types.ResourceDiff, error) {
+	return nil, nil
+}
+func (p *commandProvider) Apply(ctx context.Context, resource *types.Resource, diff *types.ResourceDiff) error {
+	_, err := p.executor.Execute(ctx, resource.Properties["command"].(string))
+	return err
+}
+
+func TestHookedTransport(t *testing.T) {
+	inner := &recordingTransport{}
+	if NewHookedTransport(inner) != Transport(inner) {
+		t.Error("Expected a transport without hooks to be returned unchanged")
+	}
+
+	deny, err := DenyCommands([]string{`rm -rf /($|\s)`, `curl .*\|\s*sh`})
+	if err != nil {
+		t.Fatalf("DenyCommands() error = %v", err)
+	}
+	hooked := NewHookedTransport(inner, deny)
+	ctx := context.Background()
+	for _, command := range []string{"rm -rf /tmp/build", "curl -fsSL https://example.com/install.sh -o install.sh"} {
+		if _, err := hooked.Execute(ctx, command); err != nil {
+			t.Errorf("Execute(%q) error = %v", command, err)
+		}
+	}
+	if _, err := hooked.Execute(ctx, "curl -fsSL https://example.com/install.sh | sh"); err == nil || !strings.Contains(err.Error(), "denied") {
+		t.Errorf("Expected a denied command, got %v", err)
+	}
+
+	// Commands a provider runs are denied naming the resource
+	registry := types.NewProviderRegistry()
+	registry.Register(&commandProvider{executor: hooked})
+	provider, _ := registry.WithInterceptors("web1", func(ctx context.Context, op *types.Operation, next types.Invoker) (*types.OperationResult, error) {
+		return next(ctx, op)
+	}).Get("shell")
+	err = provider.Apply(ctx, &types.Resource{Type: "shell", Name: "wipe", Properties: map[string]interface{}{"command": "rm -rf /"}}, nil)
+	if err == nil || !strings.Contains(err.Error(), "while applying shell.wipe") {
+		t.Errorf("Expected the denial to name the resource, got %v", err)
+	}
+	if len(inner.commands) != 2 {
+		t.Errorf("Expected 2 commands to reach the target, got %q", inner.commands)
+	}
+
+	if _, err := DenyCommands([]string{"("}); err == nil {
+		t.Error("Expected an invalid pattern to fail")
+	}
+}
+
+func TestDebugTransport(t *testing.T) {
+	inner := &ssh.LocalExecutor{}
+	if NewDebugTransport(inner, nil) != Transport(inner) {
+		t.Error("Expected a transport without a logger to be returned unchanged")
+	}
+
+	var log strings.Builder
+	debug := NewDebugTransport(inner, debuglog.New(&log, redact.New("hunter22")))
+	result, err := debug.Execute(context.Background(), "echo hunter22; echo token=abcdef >&2; exit 3")
+	if err != nil {
+		t.Fatalf("Execute() error = %v", err)
+	}
+	if result.Stdout != "hunter22\n" {
+		t.Errorf("Expected the result to be returned unredacted, got %q", result.Stdout)
+	}
+
+	for _, want := range []string{"exec: run echo [REDACTED]; echo token=[REDACTED]", "exec: exit=3", "exec: stdout: [REDACTED]", "exec: stderr: token=[REDACTED]"} {
+		if !strings.Contains(log.String(), want) {
+			t.Errorf("Expected log to contain %q, got:\n%s", want, log.String())
+		}
+	}
+	if strings.Contains(log.String(), "hunter22") || strings.Contains(log.String(), "abcdef") {
+		t.Errorf("Expected secrets to be redacted, got:\n%s", log.String())
+	}
+}
@@ -0,0 +1,48 @@
+package transport
+
+import (
+	"context"
+
+	"github.com/ataiva-software/forge/pkg/ssh"
+	"github.com/ataiva-software/forge/pkg/winrm"
+)
+
+// WinRMTransport adapts a WinRM connection to the Transport interface
+type WinRMTransport struct {
+	connection *winrm.WinRMConnection
+}
+
+// NewWinRMTransport creates a transport for a Windows target
+func NewWinRMTransport(config *winrm.ConnectionConfig) *WinRMTransport {
+	config.SetDefaults()
+	return &WinRMTransport{
+		connection: winrm.NewWinRMConnection(config),
+	}
+}
+
+// Connect opens the WinRM connection
+func (w *WinRMTransport) Connect(ctx context.Context) error {
+	return w.connection.Connect(ctx)
+}
+
+// Execute runs a command over WinRM
+func (w *WinRMTransport) Execute(ctx context.Context, command string) (*ssh.ExecuteResult, error) {
+	result, err := w.connection.Execute(ctx, command)
+	if err != nil {
+		return nil, err
+	}
+	return &ssh.ExecuteResult{
+		Command:  result.Command,
+		ExitCode: result.ExitCode,
+		Stdout:   result.Stdout,
+		Stderr:   result.Stderr,
+	}, nil
+}
+
+// Close closes the WinRM connection
+func (w *WinRMTransport) Close() error {
+	return w.connection.Close()
+}
+
+// Ensure WinRMTransport implements Transport
+var _ Transport = (*WinRMTransport)(nil)
@@ -0,0 +1,200 @@
+package types
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+)
+
+// DefaultStateCacheSize is the default number of Read() results kept per run
+const DefaultStateCacheSize = 1024
+
+// StateCache is a bounded, least-recently-used cache of Read() results.
+// It is meant to live for a single run and is safe for concurrent use.
+type StateCache struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List
+	entries    map[string]*list.Element
+	hits       int
+	misses     int
+}
+
+// stateCacheEntry is a cached Read() result
+type stateCacheEntry struct {
+	key        string
+	resourceID string
+	state      map[string]interface{}
+}
+
+// NewStateCache creates a state cache holding at most maxEntries results
+func NewStateCache(maxEntries int) *StateCache {
+	if maxEntries <= 0 {
+		maxEntries = DefaultStateCacheSize
+	}
+	return &StateCache{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+// stateCacheKey identifies a resource by ID and desired configuration, since
+// providers may read different attributes depending on the properties set
+func stateCacheKey(resource *Resource) string {
+	data, err := json.Marshal(resource)
+	if err != nil {
+		return resource.ResourceID()
+	}
+	sum := sha256.Sum256(data)
+	return resource.ResourceID() + "@" + hex.EncodeToString(sum[:8])
+}
+
+// Get returns a copy of the cached state for a resource
+func (c *StateCache) Get(resource *Resource) (map[string]interface{}, bool) {
+	key := stateCacheKey(resource)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, exists := c.entries[key]
+	if !exists {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(element)
+	return copyState(element.Value.(*stateCacheEntry).state), true
+}
+
+// Put stores the state read for a resource, evicting the least recently used entry if full
+func (c *StateCache) Put(resource *Resource, state map[string]interface{}) {
+	key := stateCacheKey(resource)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, exists := c.entries[key]; exists {
+		element.Value.(*stateCacheEntry).state = copyState(state)
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[key] = c.order.PushFront(&stateCacheEntry{
+		key:        key,
+		resourceID: resource.ResourceID(),
+		state:      copyState(state),
+	})
+
+	for c.order.Len() > c.maxEntries {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*stateCacheEntry).key)
+	}
+}
+
+// Invalidate drops every cached state for a resource ID
+func (c *StateCache) Invalidate(resourceID string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for element := c.order.Front(); element != nil; {
+		next := element.Next()
+		entry := element.Value.(*stateCacheEntry)
+		if entry.resourceID == resourceID {
+			c.order.Remove(element)
+			delete(c.entries, entry.key)
+		}
+		element = next
+	}
+}
+
+// Clear drops all cached state
+func (c *StateCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.order.Init()
+	c.entries = make(map[string]*list.Element)
+}
+
+// Len returns the number of cached entries
+func (c *StateCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len()
+}
+
+// Stats returns the number of cache hits and misses
+func (c *StateCache) Stats() (hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.hits, c.misses
+}
+
+// copyState returns a shallow copy so callers cannot modify cached state
+func copyState(state map[string]interface{}) map[string]interface{} {
+	if state == nil {
+		return nil
+	}
+	copied := make(map[string]interface{}, len(state))
+	for k, v := range state {
+		copied[k] = v
+	}
+	return copied
+}
+
+// CachingProvider wraps a provider so Read() results are served from a
+// StateCache until the resource is applied
+type CachingProvider struct {
+	Provider
+	cache *StateCache
+}
+
+// NewCachingProvider wraps a provider with a state cache
+func NewCachingProvider(provider Provider, cache *StateCache) *CachingProvider {
+	return &CachingProvider{
+		Provider: provider,
+		cache:    cache,
+	}
+}
+
+// Read returns the cached state, reading through to the provider on a miss
+func (p *CachingProvider) Read(ctx context.Context, resource *Resource) (map[string]interface{}, error) {
+	if state, ok := p.cache.Get(resource); ok {
+		return state, nil
+	}
+
+	state, err := p.Provider.Read(ctx, resource)
+	if err != nil {
+		return nil, err
+	}
+	p.cache.Put(resource, state)
+	return state, nil
+}
+
+// Apply applies the change and invalidates the cached state for the resource
+func (p *CachingProvider) Apply(ctx context.Context, resource *Resource, diff *ResourceDiff) error {
+	defer p.cache.Invalidate(resource.ResourceID())
+	return p.Provider.Apply(ctx, resource, diff)
+}
+
+// Capabilities returns the capabilities of the wrapped provider
+func (p *CachingProvider) Capabilities() Capabilities {
+	return ProviderCapabilities(p.Provider)
+}
+
+// WithCache returns a registry whose providers serve Read() from the given cache
+func (pr *ProviderRegistry) WithCache(cache *StateCache) *ProviderRegistry {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	cached := NewProviderRegistry()
+	for providerType, provider := range pr.providers {
+		cached.providers[providerType] = NewCachingProvider(provider, cache)
+	}
+	return cached
+}
@@ -0,0 +1,105 @@
+package types
+
+import (
+	"context"
+	"testing"
+)
+
+// readCountingProvider counts Read() calls per resource
+type readCountingProvider struct {
+	MockProvider
+	reads map[string]int
+}
+
+func (p *readCountingProvider) Read(ctx context.Context, resource *Resource) (map[string]interface{}, error) {
+	p.reads[resource.ResourceID()]++
+	return map[string]interface{}{"state": "present"}, nil
+}
+
+func TestStateCache_Eviction(t *testing.T) {
+	cache := NewStateCache(2)
+
+	a := &Resource{Type: "file", Name: "a"}
+	b := &Resource{Type: "file", Name: "b"}
+	c := &Resource{Type: "file", Name: "c"}
+
+	cache.Put(a, map[string]interface{}{"n": 1})
+	cache.Put(b, map[string]interface{}{"n": 2})
+
+	// Touch a so b becomes the least recently used entry
+	if _, ok := cache.Get(a); !ok {
+		t.Fatal("Expected a to be cached")
+	}
+	cache.Put(c, map[string]interface{}{"n": 3})
+
+	if cache.Len() != 2 {
+		t.Errorf("Expected 2 entries, got %d", cache.Len())
+	}
+	if _, ok := cache.Get(b); ok {
+		t.Error("Expected b to be evicted")
+	}
+	if _, ok := cache.Get(a); !ok {
+		t.Error("Expected a to remain cached")
+	}
+}
+
+func TestStateCache_KeyIncludesProperties(t *testing.T) {
+	cache := NewStateCache(10)
+
+	running := &Resource{Type: "service", Name: "nginx", Properties: map[string]interface{}{"state": "running"}}
+	masked := &Resource{Type: "service", Name: "nginx", Properties: map[string]interface{}{"state": "running", "masked": true}}
+
+	cache.Put(running, map[string]interface{}{"state": "running"})
+	if _, ok := cache.Get(masked); ok {
+		t.Error("Expected a resource with different properties to miss the cache")
+	}
+
+	cache.Put(masked, map[string]interface{}{"state": "running", "masked": false})
+	cache.Invalidate("service.nginx")
+	if cache.Len() != 0 {
+		t.Errorf("Expected invalidation to drop every entry for the resource, %d left", cache.Len())
+	}
+}
+
+func TestCachingProvider(t *testing.T) {
+	provider := &readCountingProvider{MockProvider: MockProvider{resourceType: "file"}, reads: make(map[string]int)}
+	registry := NewProviderRegistry()
+	if err := registry.Register(provider); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+
+	cache := NewStateCache(10)
+	cached := registry.WithCache(cache)
+	p, err := cached.Get("file")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+
+	ctx := context.Background()
+	resource := &Resource{Type: "file", Name: "config"}
+
+	state, _ := p.Read(ctx, resource)
+	state["state"] = "mutated"
+	second, _ := p.Read(ctx, resource)
+
+	if provider.reads["file.config"] != 1 {
+		t.Errorf("Expected 1 read through to the provider, got %d", provider.reads["file.config"])
+	}
+	if second["state"] != "present" {
+		t.Error("Expected cached state to be isolated from caller mutations")
+	}
+
+	// Apply invalidates the cached state
+	if err := p.Apply(ctx, resource, &ResourceDiff{Action: ActionUpdate}); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	p.Read(ctx, resource)
+	if provider.reads["file.config"] != 2 {
+		t.Errorf("Expected a fresh read after apply, got %d reads", provider.reads["file.config"])
+	}
+
+	hits, misses := cache.Stats()
+	if hits != 1 || misses != 2 {
+		t.Errorf("Expected 1 hit and 2 misses, got %d and %d", hits, misses)
+	}
+}
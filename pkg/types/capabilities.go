@@ -0,0 +1,155 @@
+package types
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// OS families reported in target facts
+const (
+	OSFamilyLinux   = "linux"
+	OSFamilyDarwin  = "darwin"
+	OSFamilyWindows = "windows"
+)
+
+// Distribution families reported in target facts, grouping Linux
+// distributions that share a package manager and package names
+const (
+	DistroDebian = "debian"
+	DistroRedHat = "redhat"
+	DistroSUSE   = "suse"
+	DistroArch   = "arch"
+	DistroAlpine = "alpine"
+)
+
+// Capabilities declares the targets a provider can manage
+type Capabilities struct {
+	// OSFamilies lists the supported OS families. Empty means any.
+	OSFamilies []string
+
+	// Commands lists the commands the provider runs on the target. An entry
+	// of alternatives separated by "|", such as "apt-get|yum", needs any one
+	// of them.
+	Commands []string
+
+	// Privileged lists the programs the provider runs that need root. With a
+	// sudo allowlist only these are run through sudo, and
+	// every other program as the connecting user.
+	Privileged []string
+}
+
+// CapabilityProvider is implemented by providers that declare their capabilities
+type CapabilityProvider interface {
+	Capabilities() Capabilities
+}
+
+// PrivilegedProvider is implemented by providers whose privileged programs
+// depend on the resource, such as the commands of shell resources
+type PrivilegedProvider interface {
+	PrivilegedPrograms(resource *Resource) ([]string, error)
+}
+
+// ProviderCapabilities returns the capabilities declared by a provider, or
+// none if it does not declare any
+func ProviderCapabilities(provider Provider) Capabilities {
+	if declarer, ok := provider.(CapabilityProvider); ok {
+		return declarer.Capabilities()
+	}
+	return Capabilities{}
+}
+
+// RequiredCommands returns every command named in the requirements, sorted
+func (c Capabilities) RequiredCommands() []string {
+	seen := make(map[string]bool)
+	var commands []string
+	for _, entry := range c.Commands {
+		for _, command := range strings.Split(entry, "|") {
+			if !seen[command] {
+				seen[command] = true
+				commands = append(commands, command)
+			}
+		}
+	}
+	sort.Strings(commands)
+	return commands
+}
+
+// Check checks the requirements against target facts and describes the first
+// one that is not met
+func (c Capabilities) Check(facts *TargetFacts) error {
+	if len(c.OSFamilies) > 0 {
+		supported := false
+		for _, family := range c.OSFamilies {
+			if family == facts.OSFamily {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return fmt.Errorf("requires %s, target runs %s", strings.Join(c.OSFamilies, " or "), facts.OSFamily)
+		}
+	}
+
+	for _, entry := range c.Commands {
+		alternatives := strings.Split(entry, "|")
+		found := false
+		for _, command := range alternatives {
+			if facts.HasCommand(command) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			if len(alternatives) == 1 {
+				return fmt.Errorf("requires command %s", entry)
+			}
+			return fmt.Errorf("requires one of the commands %s", strings.Join(alternatives, ", "))
+		}
+	}
+	return nil
+}
+
+// TargetFacts are the facts about a target that provider capabilities are
+// checked against
+type TargetFacts struct {
+	Host     string
+	OSFamily string
+
+	// Distribution is the ID of /etc/os-release, such as ubuntu or rocky, and
+	// DistroFamily the family it belongs to, such as debian or redhat. Both
+	// are empty when the target has no os-release.
+	Distribution string
+	DistroFamily string
+
+	// InitSystem is the init system running on the target, such as systemd
+	// or openrc, empty when it is none the providers support
+	InitSystem string
+
+	// Commands records which of the probed commands exist on the target
+	Commands map[string]bool
+
+	// Kernel, FreeDisk and Processes are gathered for module preflight checks.
+	// FreeDisk is in bytes by path; Processes records which of the probed
+	// process names are running.
+	Kernel    string
+	FreeDisk  map[string]int64
+	Processes map[string]bool
+
+	// ListeningPorts are the sockets accepting connections, gathered when
+	// the target has osquery
+	ListeningPorts []ListeningPort
+}
+
+// ListeningPort is a socket accepting connections on a target
+type ListeningPort struct {
+	Port     int
+	Protocol string
+	Address  string
+	Process  string
+}
+
+// HasCommand reports whether the command was found on the target
+func (f *TargetFacts) HasCommand(command string) bool {
+	return f.Commands[command]
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCapabilities_Check(t *testing.T) {
+	facts := &TargetFacts{
+		Host:     "web1",
+		OSFamily: OSFamilyLinux,
+		Commands: map[string]bool{"yum": true, "systemctl": true},
+	}
+
+	tests := []struct {
+		name         string
+		capabilities Capabilities
+		wantErr      string
+	}{
+		{name: "no requirements"},
+		{name: "supported OS", capabilities: Capabilities{OSFamilies: []string{OSFamilyLinux, OSFamilyDarwin}}},
+		{
+			name:         "unsupported OS",
+			capabilities: Capabilities{OSFamilies: []string{OSFamilyWindows}},
+			wantErr:      "requires windows, target runs linux",
+		},
+		{name: "alternative command found", capabilities: Capabilities{Commands: []string{"apt-get|yum"}}},
+		{
+			name:         "command missing",
+			capabilities: Capabilities{Commands: []string{"systemctl", "useradd"}},
+			wantErr:      "requires command useradd",
+		},
+		{
+			name:         "no alternative found",
+			capabilities: Capabilities{Commands: []string{"ufw|firewall-cmd"}},
+			wantErr:      "requires one of the commands ufw, firewall-cmd",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.capabilities.Check(facts)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Check() error = %v", err)
+				}
+				return
+			}
+			if err == nil || err.Error() != tt.wantErr {
+				t.Errorf("Check() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCapabilities_RequiredCommands(t *testing.T) {
+	capabilities := Capabilities{Commands: []string{"yum|apt-get", "systemctl", "apt-get"}}
+	want := []string{"apt-get", "systemctl", "yum"}
+	if got := capabilities.RequiredCommands(); !reflect.DeepEqual(got, want) {
+		t.Errorf("RequiredCommands() = %v, want %v", got, want)
+	}
+}
+
+func TestCachingProvider_Capabilities(t *testing.T) {
+	provider := NewCachingProvider(&MockProvider{resourceType: "file"}, NewStateCache(10))
+	if got := ProviderCapabilities(provider); !reflect.DeepEqual(got, Capabilities{}) {
+		t.Errorf("Expected no capabilities, got %+v", got)
+	}
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ValidateDependencies checks that every depends_on entry refers to another
+// resource in the set and that the dependencies do not form a cycle
+func ValidateDependencies(resources []Resource) error {
+	index := make(map[string]int, len(resources))
+	for i := range resources {
+		id := resources[i].ResourceID()
+		if _, exists := index[id]; exists {
+			return fmt.Errorf("duplicate resource %s", id)
+		}
+		index[id] = i
+	}
+
+	for i := range resources {
+		id := resources[i].ResourceID()
+		for _, dep := range resources[i].DependsOn {
+			if dep == id {
+				return fmt.Errorf("resource %s cannot depend on itself", id)
+			}
+			if _, exists := index[dep]; !exists {
+				return fmt.Errorf("resource %s depends on unknown resource %s", id, dep)
+			}
+		}
+	}
+
+	edges := make(map[int][]int, len(resources))
+	for i := range resources {
+		for _, dep := range resources[i].DependsOn {
+			edges[i] = append(edges[i], index[dep])
+		}
+	}
+	if cycle := GraphCycle(len(resources), edges); cycle != nil {
+		ids := make([]string, len(cycle))
+		for k, i := range cycle {
+			ids[k] = resources[i].ResourceID()
+		}
+		return fmt.Errorf("dependency cycle detected: %s", strings.Join(ids, " -> "))
+	}
+
+	return nil
+}
@@ -0,0 +1,79 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidateDependencies(t *testing.T) {
+	tests := []struct {
+		name      string
+		resources []Resource
+		wantErr   string
+	}{
+		{
+			name: "no dependencies",
+			resources: []Resource{
+				{Type: "pkg", Name: "nginx"},
+				{Type: "service", Name: "nginx"},
+			},
+		},
+		{
+			name: "valid chain",
+			resources: []Resource{
+				{Type: "pkg", Name: "nginx"},
+				{Type: "file", Name: "conf", DependsOn: []string{"pkg.nginx"}},
+				{Type: "service", Name: "nginx", DependsOn: []string{"pkg.nginx", "file.conf"}},
+			},
+		},
+		{
+			name: "unknown dependency",
+			resources: []Resource{
+				{Type: "service", Name: "nginx", DependsOn: []string{"pkg.nginx"}},
+			},
+			wantErr: "depends on unknown resource pkg.nginx",
+		},
+		{
+			name: "self dependency",
+			resources: []Resource{
+				{Type: "pkg", Name: "nginx", DependsOn: []string{"pkg.nginx"}},
+			},
+			wantErr: "cannot depend on itself",
+		},
+		{
+			name: "duplicate resource",
+			resources: []Resource{
+				{Type: "pkg", Name: "nginx"},
+				{Type: "pkg", Name: "nginx"},
+			},
+			wantErr: "duplicate resource pkg.nginx",
+		},
+		{
+			name: "cycle",
+			resources: []Resource{
+				{Type: "pkg", Name: "a", DependsOn: []string{"pkg.c"}},
+				{Type: "pkg", Name: "b", DependsOn: []string{"pkg.a"}},
+				{Type: "pkg", Name: "c", DependsOn: []string{"pkg.b"}},
+			},
+			wantErr: "dependency cycle detected: pkg.a -> pkg.c -> pkg.b -> pkg.a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateDependencies(tt.resources)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateDependencies() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("ValidateDependencies() expected error containing %q", tt.wantErr)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateDependencies() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package types
+
+import "sort"
+
+// GraphLevels groups the nodes of a graph of n nodes, numbered from 0, by
+// depth, each level in ascending order. edges point from a node to the
+// nodes that come after it. Nodes on a cycle, and those after one, are
+// left out.
+func GraphLevels(n int, edges map[int][]int) [][]int {
+	inDegree := make([]int, n)
+	for _, tos := range edges {
+		for _, to := range tos {
+			inDegree[to]++
+		}
+	}
+
+	var current []int
+	for i := 0; i < n; i++ {
+		if inDegree[i] == 0 {
+			current = append(current, i)
+		}
+	}
+
+	var levels [][]int
+	for len(current) > 0 {
+		levels = append(levels, current)
+
+		var next []int
+		for _, node := range current {
+			for _, to := range edges[node] {
+				inDegree[to]--
+				if inDegree[to] == 0 {
+					next = append(next, to)
+				}
+			}
+		}
+		sort.Ints(next)
+		current = next
+	}
+
+	return levels
+}
+
+// GraphCycle returns the nodes of a cycle of a graph of n nodes, numbered
+// from 0, starting and ending with the same node, or nil when it has none.
+// Nodes and their edges are followed in order, so the cycle found is the
+// same every time.
+func GraphCycle(n int, edges map[int][]int) []int {
+	// Depth-first search for back edges, remembering the path to name the cycle
+	const (
+		unvisited = iota
+		visiting
+		done
+	)
+	state := make([]int, n)
+	var path []int
+
+	var visit func(i int) []int
+	visit = func(i int) []int {
+		state[i] = visiting
+		path = append(path, i)
+
+		for _, j := range edges[i] {
+			switch state[j] {
+			case visiting:
+				start := 0
+				for k, node := range path {
+					if node == j {
+						start = k
+						break
+					}
+				}
+				return append(append([]int{}, path[start:]...), j)
+			case unvisited:
+				if cycle := visit(j); cycle != nil {
+					return cycle
+				}
+			}
+		}
+
+		path = path[:len(path)-1]
+		state[i] = done
+		return nil
+	}
+
+	for i := 0; i < n; i++ {
+		if state[i] == unvisited {
+			if cycle := visit(i); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestGraphLevels(t *testing.T) {
+	// 0 -> 2, 1 -> 2, 2 -> 3, and 4 -> 5 -> 4 on a cycle
+	edges := map[int][]int{0: {2}, 1: {2}, 2: {3}, 4: {5}, 5: {4}}
+	want := [][]int{{0, 1}, {2}, {3}}
+	if got := GraphLevels(6, edges); !reflect.DeepEqual(got, want) {
+		t.Errorf("GraphLevels() = %v, want %v", got, want)
+	}
+}
+
+func TestGraphCycle(t *testing.T) {
+	if got := GraphCycle(3, map[int][]int{0: {1}, 1: {2}}); got != nil {
+		t.Errorf("GraphCycle() of an acyclic graph = %v, want nil", got)
+	}
+	want := []int{1, 2, 3, 1}
+	if got := GraphCycle(4, map[int][]int{0: {1}, 1: {2}, 2: {3}, 3: {1}}); !reflect.DeepEqual(got, want) {
+		t.Errorf("GraphCycle() = %v, want %v", got, want)
+	}
+}
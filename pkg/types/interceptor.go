@@ -0,0 +1,149 @@
+package types
+
+import (
+	"context"
+	"time"
+)
+
+// OperationKind is the provider call an operation makes
+type OperationKind string
+
+const (
+	OperationRead  OperationKind = "read"
+	OperationDiff  OperationKind = "diff"
+	OperationApply OperationKind = "apply"
+)
+
+// Operation is a provider call passing through the interceptors: reading a
+// resource's state, diffing it against the resource, or applying the diff
+type Operation struct {
+	Kind OperationKind
+	// Host is the target the provider acts on
+	Host     string
+	Resource *Resource
+	// Current is the state a diff compares the resource against
+	Current map[string]interface{}
+	// Diff is what an apply changes
+	Diff    *ResourceDiff
+	Started time.Time
+}
+
+// OperationResult is what an operation returned: the state read, or the
+// diff computed. Applies return nothing but their error.
+type OperationResult struct {
+	State map[string]interface{}
+	Diff  *ResourceDiff
+}
+
+// Invoker carries out an operation, through the rest of the interceptors
+// and then the provider
+type Invoker func(ctx context.Context, op *Operation) (*OperationResult, error)
+
+// Interceptor sees every operation of the providers it wraps. It can look
+// at or change the operation, refuse it by returning an error without
+// calling next, or look at the result next returns, so audit logging,
+// policy checks and metrics are written once for every provider.
+type Interceptor func(ctx context.Context, op *Operation, next Invoker) (*OperationResult, error)
+
+type operationKey struct{}
+
+// OperationFromContext returns the operation a provider call runs for, so
+// hooks further down, such as those on the commands the provider runs, know
+// the resource they act for
+func OperationFromContext(ctx context.Context) (*Operation, bool) {
+	op, ok := ctx.Value(operationKey{}).(*Operation)
+	return op, ok
+}
+
+// InterceptingProvider wraps a provider so its Read, Diff and Apply calls
+// pass through a chain of interceptors, the first outermost
+type InterceptingProvider struct {
+	Provider
+	host         string
+	interceptors []Interceptor
+}
+
+// NewInterceptingProvider wraps a provider of a host with interceptors
+func NewInterceptingProvider(provider Provider, host string, interceptors ...Interceptor) *InterceptingProvider {
+	return &InterceptingProvider{Provider: provider, host: host, interceptors: interceptors}
+}
+
+// invoke runs an operation through the interceptors, then the provider
+func (p *InterceptingProvider) invoke(ctx context.Context, op *Operation) (*OperationResult, error) {
+	op.Host = p.host
+	op.Started = time.Now()
+	var call Invoker
+	call = func(ctx context.Context, op *Operation) (*OperationResult, error) {
+		ctx = context.WithValue(ctx, operationKey{}, op)
+		switch op.Kind {
+		case OperationRead:
+			state, err := p.Provider.Read(ctx, op.Resource)
+			return &OperationResult{State: state}, err
+		case OperationDiff:
+			diff, err := p.Provider.Diff(ctx, op.Resource, op.Current)
+			return &OperationResult{Diff: diff}, err
+		default:
+			return &OperationResult{}, p.Provider.Apply(ctx, op.Resource, op.Diff)
+		}
+	}
+	for i := len(p.interceptors) - 1; i >= 0; i-- {
+		interceptor, next := p.interceptors[i], call
+		call = func(ctx context.Context, op *Operation) (*OperationResult, error) {
+			return interceptor(ctx, op, next)
+		}
+	}
+	result, err := call(ctx, op)
+	if result == nil {
+		result = &OperationResult{}
+	}
+	return result, err
+}
+
+// Read reads the resource's state through the interceptors
+func (p *InterceptingProvider) Read(ctx context.Context, resource *Resource) (map[string]interface{}, error) {
+	result, err := p.invoke(ctx, &Operation{Kind: OperationRead, Resource: resource})
+	return result.State, err
+}
+
+// Diff diffs the resource through the interceptors
+func (p *InterceptingProvider) Diff(ctx context.Context, resource *Resource, current map[string]interface{}) (*ResourceDiff, error) {
+	result, err := p.invoke(ctx, &Operation{Kind: OperationDiff, Resource: resource, Current: current})
+	return result.Diff, err
+}
+
+// Apply applies the diff through the interceptors
+func (p *InterceptingProvider) Apply(ctx context.Context, resource *Resource, diff *ResourceDiff) error {
+	_, err := p.invoke(ctx, &Operation{Kind: OperationApply, Resource: resource, Diff: diff})
+	return err
+}
+
+// Capabilities returns the capabilities of the wrapped provider
+func (p *InterceptingProvider) Capabilities() Capabilities {
+	return ProviderCapabilities(p.Provider)
+}
+
+// PrivilegedPrograms returns the programs the wrapped provider runs as root
+// for the resource, when they depend on it
+func (p *InterceptingProvider) PrivilegedPrograms(resource *Resource) ([]string, error) {
+	if lister, ok := p.Provider.(PrivilegedProvider); ok {
+		return lister.PrivilegedPrograms(resource)
+	}
+	return nil, nil
+}
+
+// WithInterceptors returns a registry whose providers, acting on host, pass
+// their operations through the interceptors. Without interceptors the
+// registry is returned unchanged.
+func (pr *ProviderRegistry) WithInterceptors(host string, interceptors ...Interceptor) *ProviderRegistry {
+	if len(interceptors) == 0 {
+		return pr
+	}
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+
+	intercepted := NewProviderRegistry()
+	for providerType, provider := range pr.providers {
+		intercepted.providers[providerType] = NewInterceptingProvider(provider, host, interceptors...)
+	}
+	return intercepted
+}
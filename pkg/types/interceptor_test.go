@@ -0,0 +1,86 @@
+package types
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// contextProvider reports whether its calls carry their operation
+type contextProvider struct {
+	MockProvider
+	seen []string
+}
+
+func (p *contextProvider) Apply(ctx context.Context, resource *Resource, diff *ResourceDiff) error {
+	if op, ok := OperationFromContext(ctx); ok {
+		p.seen = append(p.seen, fmt.Sprintf("%s %s on %s", op.Kind, op.Resource.ResourceID(), op.Host))
+	}
+	return nil
+}
+
+func TestInterceptingProvider(t *testing.T) {
+	provider := &contextProvider{MockProvider: MockProvider{resourceType: "file"}}
+	registry := NewProviderRegistry()
+	if err := registry.Register(provider); err != nil {
+		t.Fatal(err)
+	}
+	if registry.WithInterceptors("web1") != registry {
+		t.Error("WithInterceptors() without interceptors changed the registry")
+	}
+
+	var calls []string
+	record := func(name string) Interceptor {
+		return func(ctx context.Context, op *Operation, next Invoker) (*OperationResult, error) {
+			calls = append(calls, name+" before "+string(op.Kind))
+			result, err := next(ctx, op)
+			calls = append(calls, name+" after "+string(op.Kind))
+			return result, err
+		}
+	}
+	denyApply := func(ctx context.Context, op *Operation, next Invoker) (*OperationResult, error) {
+		if op.Kind == OperationApply && op.Resource.Name == "shadow" {
+			return nil, fmt.Errorf("applying %s is not allowed", op.Resource.ResourceID())
+		}
+		return next(ctx, op)
+	}
+	intercepted, err := registry.WithInterceptors("web1", record("outer"), record("inner"), denyApply).Get("file")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	resource := &Resource{Type: "file", Name: "config"}
+	state, err := intercepted.Read(ctx, resource)
+	if err != nil || state == nil {
+		t.Fatalf("Read() = %v, %v", state, err)
+	}
+	diff, err := intercepted.Diff(ctx, resource, state)
+	if err != nil || diff.Action != ActionNoop {
+		t.Fatalf("Diff() = %v, %v", diff, err)
+	}
+	if err := intercepted.Apply(ctx, resource, diff); err != nil {
+		t.Fatalf("Apply() error = %v", err)
+	}
+	want := []string{
+		"outer before read", "inner before read", "inner after read", "outer after read",
+		"outer before diff", "inner before diff", "inner after diff", "outer after diff",
+		"outer before apply", "inner before apply", "inner after apply", "outer after apply",
+	}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("calls = %q, want %q", calls, want)
+	}
+	if !reflect.DeepEqual(provider.seen, []string{"apply file.config on web1"}) {
+		t.Errorf("provider saw operations %q", provider.seen)
+	}
+
+	err = intercepted.Apply(ctx, &Resource{Type: "file", Name: "shadow"}, diff)
+	if err == nil || !strings.Contains(err.Error(), "not allowed") {
+		t.Errorf("Apply() of a denied resource error = %v", err)
+	}
+	if len(provider.seen) != 1 {
+		t.Error("a denied apply reached the provider")
+	}
+}
@@ -0,0 +1,72 @@
+package types
+
+import (
+	"context"
+	"io"
+)
+
+// CommandOutput is what a resource's command printed and how it exited
+type CommandOutput struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+}
+
+type outputKey struct{}
+
+// WithOutputCapture returns a context in which the command a resource runs
+// records its output in capture
+func WithOutputCapture(ctx context.Context, capture *CommandOutput) context.Context {
+	return context.WithValue(ctx, outputKey{}, capture)
+}
+
+// CaptureOutput records a command's output in the context's capture, if it
+// has one
+func CaptureOutput(ctx context.Context, output CommandOutput) {
+	if capture, ok := ctx.Value(outputKey{}).(*CommandOutput); ok {
+		*capture = output
+	}
+}
+
+// OutputLine is a line a resource's command printed while it ran, on the
+// stdout or stderr stream
+type OutputLine struct {
+	Resource string
+	Stream   string
+	Line     string
+}
+
+type outputStreamKey struct{}
+
+// WithOutputStream returns a context in which resources that run long
+// commands pass each line the command prints to stream as it is printed
+func WithOutputStream(ctx context.Context, stream func(OutputLine)) context.Context {
+	return context.WithValue(ctx, outputStreamKey{}, stream)
+}
+
+// OutputStream returns the output stream of a context, nil when it has none
+func OutputStream(ctx context.Context) func(OutputLine) {
+	stream, _ := ctx.Value(outputStreamKey{}).(func(OutputLine))
+	return stream
+}
+
+// OutputBuffer collects one stream of what a resource's command prints
+type OutputBuffer interface {
+	io.Writer
+	String() string
+}
+
+type outputBuffersKey struct{}
+
+// WithOutputBuffers returns a context in which the commands resources run
+// collect their output in the buffers newBuffer returns for each resource
+// and stream, such as ones that bound how much of it is kept in memory
+func WithOutputBuffers(ctx context.Context, newBuffer func(resource, stream string) OutputBuffer) context.Context {
+	return context.WithValue(ctx, outputBuffersKey{}, newBuffer)
+}
+
+// OutputBuffers returns the output buffers of a context, nil when it has none
+func OutputBuffers(ctx context.Context) func(resource, stream string) OutputBuffer {
+	newBuffer, _ := ctx.Value(outputBuffersKey{}).(func(resource, stream string) OutputBuffer)
+	return newBuffer
+}
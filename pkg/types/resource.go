@@ -3,6 +3,9 @@ package types
 import (
 	"context"
 	"fmt"
+	"regexp"
+	"sort"
+	"sync"
 )
 
 // ResourceState represents the desired state of a resource
@@ -13,8 +16,19 @@ const (
 	StateAbsent  ResourceState = "absent"
 	StateRunning ResourceState = "running"
 	StateStopped ResourceState = "stopped"
+	
+	// StateRestarted and StateReloaded always act, typically from a handler
+	StateRestarted ResourceState = "restarted"
+	StateReloaded  ResourceState = "reloaded"
+
+	// StateAudit reads the resource and reports how it deviates from its
+	// other properties, but never changes it
+	StateAudit ResourceState = "audit"
 )
 
+// registerPattern matches the names output can be registered as
+var registerPattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
 // Resource represents a unit of infrastructure state
 type Resource struct {
 	Type         string                 `yaml:"type" json:"type"`
@@ -25,10 +39,67 @@ type Resource struct {
 	Notify       []string               `yaml:"notify,omitempty" json:"notify,omitempty"`
 	OnlyIf       string                 `yaml:"only_if,omitempty" json:"only_if,omitempty"`
 	NotIf        string                 `yaml:"not_if,omitempty" json:"not_if,omitempty"`
+	Export       *Export                `yaml:"export,omitempty" json:"export,omitempty"`
+	Collect      []string               `yaml:"collect,omitempty" json:"collect,omitempty"`
+
+	// When is a condition on the target's facts and the module's variables;
+	// the resource is skipped on targets where it is false
+	When string `yaml:"when,omitempty" json:"when,omitempty"`
+
+	// Register names a variable holding the output of a shell resource's
+	// command, for the resources after it in the same run
+	Register string `yaml:"register,omitempty" json:"register,omitempty"`
+
+	// Tags label the resource so runs can be limited to it with --target tag=<tag>
+	Tags []string `yaml:"tags,omitempty" json:"tags,omitempty"`
+
+	// Import is the import the resource was composed in from, such as web,
+	// or web.base for a module web imports; it prefixes the resource's name
+	// in its id so imported modules cannot clash
+	Import string `yaml:"import,omitempty" json:"import,omitempty"`
+
+	// WithItems, or its alias Loop, expands the resource into one resource
+	// per item of a list when the module's variables are resolved
+	WithItems interface{} `yaml:"with_items,omitempty" json:"with_items,omitempty"`
+	Loop      interface{} `yaml:"loop,omitempty" json:"loop,omitempty"`
+
+	// WithData loops over the entries of a data file instead, read when the
+	// module is loaded
+	WithData *DataSource `yaml:"with_data,omitempty" json:"with_data,omitempty"`
+
+	// Become, BecomeUser and BecomeMethod override the target's privilege
+	// escalation for this resource's commands
+	Become       *bool  `yaml:"become,omitempty" json:"become,omitempty"`
+	BecomeUser   string `yaml:"become_user,omitempty" json:"become_user,omitempty"`
+	BecomeMethod string `yaml:"become_method,omitempty" json:"become_method,omitempty"`
+
+	// Defaulted lists the properties filled in from configured defaults
+	Defaulted []string `yaml:"-" json:"-"`
+}
+
+// Export publishes data about a resource to a named collection so that
+// resources on other hosts can collect it
+type Export struct {
+	Collection string                 `yaml:"collection" json:"collection"`
+	Data       map[string]interface{} `yaml:"data,omitempty" json:"data,omitempty"`
 }
 
-// ResourceID returns a unique identifier for the resource
+// DataSource is a YAML, JSON or CSV file in the module's directory whose
+// entries a resource is generated from
+type DataSource struct {
+	File string `yaml:"file" json:"file"`
+	// Key picks the list under a top-level key of a YAML or JSON file
+	Key string `yaml:"key,omitempty" json:"key,omitempty"`
+	// Required lists the fields every entry must set
+	Required []string `yaml:"required,omitempty" json:"required,omitempty"`
+}
+
+// ResourceID returns a unique identifier for the resource, with the name of
+// an imported resource prefixed by its import
 func (r *Resource) ResourceID() string {
+	if r.Import != "" {
+		return fmt.Sprintf("%s.%s.%s", r.Type, r.Import, r.Name)
+	}
 	return fmt.Sprintf("%s.%s", r.Type, r.Name)
 }
 
@@ -40,6 +111,35 @@ func (r *Resource) Validate() error {
 	if r.Name == "" {
 		return fmt.Errorf("resource name cannot be empty")
 	}
+	if r.Export != nil && r.Export.Collection == "" {
+		return fmt.Errorf("export collection cannot be empty")
+	}
+	for _, collection := range r.Collect {
+		if collection == "" {
+			return fmt.Errorf("collect entries cannot be empty")
+		}
+	}
+	if r.WithData != nil {
+		if r.WithData.File == "" {
+			return fmt.Errorf("with_data file cannot be empty")
+		}
+		if r.WithItems != nil || r.Loop != nil {
+			return fmt.Errorf("with_data cannot be combined with with_items or loop")
+		}
+	}
+	if r.Register != "" {
+		if r.Type != "shell" {
+			return fmt.Errorf("register is only supported on shell resources")
+		}
+		if !registerPattern.MatchString(r.Register) {
+			return fmt.Errorf("invalid register name %q, must be a letter or underscore followed by letters, digits or underscores", r.Register)
+		}
+	}
+	switch r.BecomeMethod {
+	case "", "sudo", "su", "doas":
+	default:
+		return fmt.Errorf("unknown become_method %q, must be sudo, su or doas", r.BecomeMethod)
+	}
 	return nil
 }
 
@@ -61,6 +161,16 @@ const (
 	ActionNoop   DiffAction = "noop"
 )
 
+// ChangedKeys returns the names of the changed attributes in sorted order
+func (d *ResourceDiff) ChangedKeys() []string {
+	keys := make([]string, 0, len(d.Changes))
+	for key := range d.Changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // Provider defines the interface that all resource providers must implement
 type Provider interface {
 	// Type returns the resource type this provider handles
@@ -79,8 +189,9 @@ type Provider interface {
 	Apply(ctx context.Context, resource *Resource, diff *ResourceDiff) error
 }
 
-// ProviderRegistry manages available providers
+// ProviderRegistry manages available providers. It is safe for concurrent use.
 type ProviderRegistry struct {
+	mu        sync.RWMutex
 	providers map[string]Provider
 }
 
@@ -102,6 +213,9 @@ func (pr *ProviderRegistry) Register(provider Provider) error {
 		return fmt.Errorf("provider type cannot be empty")
 	}
 	
+	pr.mu.Lock()
+	defer pr.mu.Unlock()
+	
 	if _, exists := pr.providers[providerType]; exists {
 		return fmt.Errorf("provider for type %s already registered", providerType)
 	}
@@ -112,6 +226,9 @@ func (pr *ProviderRegistry) Register(provider Provider) error {
 
 // Get retrieves a provider for the given resource type
 func (pr *ProviderRegistry) Get(resourceType string) (Provider, error) {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	
 	provider, exists := pr.providers[resourceType]
 	if !exists {
 		return nil, fmt.Errorf("no provider registered for resource type: %s", resourceType)
@@ -121,9 +238,13 @@ func (pr *ProviderRegistry) Get(resourceType string) (Provider, error) {
 
 // Types returns all registered provider types
 func (pr *ProviderRegistry) Types() []string {
+	pr.mu.RLock()
+	defer pr.mu.RUnlock()
+	
 	types := make([]string, 0, len(pr.providers))
 	for t := range pr.providers {
 		types = append(types, t)
 	}
+	sort.Strings(types)
 	return types
 }
@@ -69,6 +69,47 @@ func TestResource_Validate(t *testing.T) {
 			wantErr: true,
 			errMsg:  "resource name cannot be empty",
 		},
+		{
+			name: "unknown become method",
+			resource: Resource{
+				Type:         "pkg",
+				Name:         "nginx",
+				BecomeMethod: "pbrun",
+			},
+			wantErr: true,
+			errMsg:  `unknown become_method "pbrun", must be sudo, su or doas`,
+		},
+		{
+			name: "export without collection",
+			resource: Resource{
+				Type:   "service",
+				Name:   "app",
+				Export: &Export{Data: map[string]interface{}{"port": 8080}},
+			},
+			wantErr: true,
+			errMsg:  "export collection cannot be empty",
+		},
+		{
+			name: "empty collect entry",
+			resource: Resource{
+				Type:    "file",
+				Name:    "lb",
+				Collect: []string{""},
+			},
+			wantErr: true,
+			errMsg:  "collect entries cannot be empty",
+		},
+		{
+			name: "data source with a loop",
+			resource: Resource{
+				Type:      "file",
+				Name:      "${item.name}",
+				WithData:  &DataSource{File: "sites.yaml"},
+				WithItems: []interface{}{"a"},
+			},
+			wantErr: true,
+			errMsg:  "with_data cannot be combined with with_items or loop",
+		},
 		{
 			name: "empty type",
 			resource: Resource{
@@ -246,28 +287,41 @@ func TestProviderRegistry_Types(t *testing.T) {
 	}
 	
 	// Add providers
-	provider1 := &MockProvider{resourceType: "file"}
-	provider2 := &MockProvider{resourceType: "service"}
+	provider1 := &MockProvider{resourceType: "service"}
+	provider2 := &MockProvider{resourceType: "file"}
 	
 	registry.Register(provider1)
 	registry.Register(provider2)
 	
 	types = registry.Types()
 	if len(types) != 2 {
-		t.Errorf("Expected 2 types, got %d", len(types))
+		t.Fatalf("Expected 2 types, got %d", len(types))
 	}
 	
-	// Check that both types are present (order doesn't matter)
-	typeMap := make(map[string]bool)
-	for _, t := range types {
-		typeMap[t] = true
+	// Types are returned in sorted order
+	if types[0] != "file" || types[1] != "service" {
+		t.Errorf("Expected [file service], got %v", types)
+	}
+}
+
+func TestResourceDiff_ChangedKeys(t *testing.T) {
+	diff := &ResourceDiff{
+		Changes: map[string]interface{}{
+			"state":   "running",
+			"content": "new",
+			"mode":    "0644",
+		},
 	}
 	
-	if !typeMap["file"] {
-		t.Error("Expected 'file' type to be present")
+	keys := diff.ChangedKeys()
+	want := []string{"content", "mode", "state"}
+	if len(keys) != len(want) {
+		t.Fatalf("Expected %d keys, got %d", len(want), len(keys))
 	}
-	if !typeMap["service"] {
-		t.Error("Expected 'service' type to be present")
+	for i := range want {
+		if keys[i] != want[i] {
+			t.Errorf("keys[%d] = %s, want %s", i, keys[i], want[i])
+		}
 	}
 }
 
@@ -0,0 +1,275 @@
+// Package update checks release channels for new versions of the binary,
+// verifies them against the release signing key and installs them in place.
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Release channels
+const (
+	ChannelStable = "stable"
+	ChannelBeta   = "beta"
+)
+
+// DefaultBaseURL is where release channels are published
+const DefaultBaseURL = "https://releases.ataiva.com/chisel"
+
+// ManifestFile is the name of a channel's release list; its detached
+// signature is published next to it with a ".sig" suffix
+const ManifestFile = "manifest.json"
+
+// ReleasePublicKey is the base64 ed25519 key releases are signed with. It is
+// set at build time with -ldflags "-X .../pkg/update.ReleasePublicKey=...".
+var ReleasePublicKey = ""
+
+// Asset is a binary for one platform
+type Asset struct {
+	OS     string `json:"os"`
+	Arch   string `json:"arch"`
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+// Release is a published version and its binaries
+type Release struct {
+	Version string  `json:"version"`
+	Assets  []Asset `json:"assets"`
+}
+
+// Manifest lists the releases on a channel
+type Manifest struct {
+	Channel  string    `json:"channel"`
+	Releases []Release `json:"releases"`
+}
+
+// Updater fetches signed manifests and binaries from a release channel
+type Updater struct {
+	BaseURL   string
+	Channel   string
+	PublicKey ed25519.PublicKey
+	Client    *http.Client
+}
+
+// ValidateChannel checks that a channel name is known
+func ValidateChannel(channel string) error {
+	switch channel {
+	case ChannelStable, ChannelBeta:
+		return nil
+	default:
+		return fmt.Errorf("invalid release channel '%s', must be one of: stable, beta", channel)
+	}
+}
+
+// ParsePublicKey decodes a base64 ed25519 public key
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, fmt.Errorf("no release signing key is configured")
+	}
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid release signing key")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// NewUpdater creates an updater for a channel
+func NewUpdater(baseURL, channel string, publicKey ed25519.PublicKey) (*Updater, error) {
+	if err := ValidateChannel(channel); err != nil {
+		return nil, err
+	}
+	if len(publicKey) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("no release signing key is configured")
+	}
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Updater{
+		BaseURL:   strings.TrimSuffix(baseURL, "/"),
+		Channel:   channel,
+		PublicKey: publicKey,
+		Client:    http.DefaultClient,
+	}, nil
+}
+
+// Manifest downloads the channel's manifest and verifies its signature
+func (u *Updater) Manifest(ctx context.Context) (*Manifest, error) {
+	manifestURL := u.channelURL() + "/" + ManifestFile
+	data, err := u.get(ctx, manifestURL)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := u.get(ctx, manifestURL+".sig")
+	if err != nil {
+		return nil, err
+	}
+	if err := VerifySignature(u.PublicKey, data, signature); err != nil {
+		return nil, fmt.Errorf("manifest for channel %s: %w", u.Channel, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("failed to parse manifest for channel %s: %w", u.Channel, err)
+	}
+	if manifest.Channel != u.Channel {
+		return nil, fmt.Errorf("manifest is for channel %s, expected %s", manifest.Channel, u.Channel)
+	}
+	return &manifest, nil
+}
+
+// Download fetches an asset and verifies it against the checksum in the signed manifest
+func (u *Updater) Download(ctx context.Context, asset Asset) ([]byte, error) {
+	assetURL, err := u.resolve(asset.URL)
+	if err != nil {
+		return nil, err
+	}
+	data, err := u.get(ctx, assetURL)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != strings.ToLower(asset.SHA256) {
+		return nil, fmt.Errorf("download %s has checksum %s, expected %s", assetURL, got, asset.SHA256)
+	}
+	return data, nil
+}
+
+// VerifySignature checks a base64 ed25519 signature over data
+func VerifySignature(publicKey ed25519.PublicKey, data, signature []byte) error {
+	decoded, err := base64.StdEncoding.DecodeString(strings.TrimSpace(string(signature)))
+	if err != nil {
+		return fmt.Errorf("invalid signature encoding: %w", err)
+	}
+	if !ed25519.Verify(publicKey, data, decoded) {
+		return fmt.Errorf("signature verification failed")
+	}
+	return nil
+}
+
+// Select returns the release to install: the given version if set, otherwise
+// the newest release. It also returns the asset for the running platform.
+func (m *Manifest) Select(version string) (*Release, *Asset, error) {
+	var selected *Release
+	var selectedVersion Version
+	for i := range m.Releases {
+		release := &m.Releases[i]
+		v, err := ParseVersion(release.Version)
+		if err != nil {
+			return nil, nil, err
+		}
+		if version != "" {
+			want, err := ParseVersion(version)
+			if err != nil {
+				return nil, nil, err
+			}
+			if v.Compare(want) == 0 {
+				selected, selectedVersion = release, v
+				break
+			}
+			continue
+		}
+		if selected == nil || v.Compare(selectedVersion) > 0 {
+			selected, selectedVersion = release, v
+		}
+	}
+	if selected == nil {
+		if version != "" {
+			return nil, nil, fmt.Errorf("version %s is not published on channel %s", version, m.Channel)
+		}
+		return nil, nil, fmt.Errorf("no releases published on channel %s", m.Channel)
+	}
+
+	for i := range selected.Assets {
+		asset := &selected.Assets[i]
+		if asset.OS == runtime.GOOS && asset.Arch == runtime.GOARCH {
+			return selected, asset, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("release %s has no binary for %s/%s", selected.Version, runtime.GOOS, runtime.GOARCH)
+}
+
+// Install replaces the executable at path with data. The new binary is
+// written next to it and renamed over it, so a failure leaves the old one.
+func Install(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".forge-update-*")
+	if err != nil {
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0755); err != nil {
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+
+	// A running executable cannot be replaced on Windows, only moved aside
+	if runtime.GOOS == "windows" {
+		old := path + ".old"
+		os.Remove(old)
+		if err := os.Rename(path, old); err != nil {
+			return fmt.Errorf("failed to install update: %w", err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to install update: %w", err)
+	}
+	return nil
+}
+
+// channelURL returns the base URL of the updater's channel
+func (u *Updater) channelURL() string {
+	return u.BaseURL + "/" + u.Channel
+}
+
+// resolve makes an asset URL absolute against the channel URL
+func (u *Updater) resolve(ref string) (string, error) {
+	base, err := url.Parse(u.channelURL() + "/")
+	if err != nil {
+		return "", fmt.Errorf("invalid release URL %s: %w", u.BaseURL, err)
+	}
+	parsed, err := url.Parse(ref)
+	if err != nil {
+		return "", fmt.Errorf("invalid asset URL %s: %w", ref, err)
+	}
+	return base.ResolveReference(parsed).String(), nil
+}
+
+// get downloads a URL
+func (u *Updater) get(ctx context.Context, rawURL string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	resp, err := u.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download %s: %s", rawURL, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download %s: %w", rawURL, err)
+	}
+	return data, nil
+}
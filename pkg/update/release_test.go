@@ -0,0 +1,166 @@
+package update
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// releaseServer publishes a signed manifest for the beta channel
+func releaseServer(t *testing.T, signer ed25519.PrivateKey, binary []byte, tamper bool) *httptest.Server {
+	t.Helper()
+	sum := sha256.Sum256(binary)
+	manifest, err := json.Marshal(Manifest{
+		Channel: ChannelBeta,
+		Releases: []Release{
+			{Version: "1.4.2", Assets: []Asset{{OS: runtime.GOOS, Arch: runtime.GOARCH, URL: "1.4.2/forge", SHA256: strings.Repeat("0", 64)}}},
+			{Version: "1.5.0-beta.1", Assets: []Asset{{OS: runtime.GOOS, Arch: runtime.GOARCH, URL: "1.5.0-beta.1/forge", SHA256: hex.EncodeToString(sum[:])}}},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature := base64.StdEncoding.EncodeToString(ed25519.Sign(signer, manifest))
+	if tamper {
+		manifest = append(manifest, ' ')
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/beta/manifest.json", func(w http.ResponseWriter, r *http.Request) { w.Write(manifest) })
+	mux.HandleFunc("/beta/manifest.json.sig", func(w http.ResponseWriter, r *http.Request) { w.Write([]byte(signature)) })
+	mux.HandleFunc("/beta/1.5.0-beta.1/forge", func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	mux.HandleFunc("/beta/1.4.2/forge", func(w http.ResponseWriter, r *http.Request) { w.Write(binary) })
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestUpdater_ManifestAndDownload(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	binary := []byte("#!/bin/sh\necho forge 1.5.0-beta.1\n")
+	server := releaseServer(t, private, binary, false)
+
+	updater, err := NewUpdater(server.URL, ChannelBeta, public)
+	if err != nil {
+		t.Fatalf("NewUpdater() error = %v", err)
+	}
+	manifest, err := updater.Manifest(context.Background())
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+
+	release, asset, err := manifest.Select("")
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if release.Version != "1.5.0-beta.1" {
+		t.Errorf("Expected the newest release, got %s", release.Version)
+	}
+	data, err := updater.Download(context.Background(), *asset)
+	if err != nil {
+		t.Fatalf("Download() error = %v", err)
+	}
+	if string(data) != string(binary) {
+		t.Error("Download() returned the wrong data")
+	}
+
+	// A pinned version is selected exactly; its checksum does not match
+	_, pinned, err := manifest.Select("v1.4.2")
+	if err != nil {
+		t.Fatalf("Select() error = %v", err)
+	}
+	if _, err := updater.Download(context.Background(), *pinned); err == nil || !strings.Contains(err.Error(), "checksum") {
+		t.Errorf("Download() error = %v, want checksum mismatch", err)
+	}
+	if _, _, err := manifest.Select("1.3.0"); err == nil {
+		t.Error("Expected error for an unpublished version")
+	}
+}
+
+func TestUpdater_RejectsBadSignatures(t *testing.T) {
+	public, private, _ := ed25519.GenerateKey(rand.Reader)
+	otherPublic, _, _ := ed25519.GenerateKey(rand.Reader)
+
+	tests := []struct {
+		name   string
+		key    ed25519.PublicKey
+		tamper bool
+	}{
+		{name: "modified manifest", key: public, tamper: true},
+		{name: "wrong key", key: otherPublic},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := releaseServer(t, private, []byte("binary"), tt.tamper)
+			updater, _ := NewUpdater(server.URL, ChannelBeta, tt.key)
+			_, err := updater.Manifest(context.Background())
+			if err == nil || !strings.Contains(err.Error(), "signature verification failed") {
+				t.Errorf("Manifest() error = %v, want signature failure", err)
+			}
+		})
+	}
+
+	// The manifest must be for the channel asked for
+	server := releaseServer(t, private, []byte("binary"), false)
+	updater, _ := NewUpdater(server.URL, ChannelBeta, public)
+	updater.Channel = ChannelStable
+	if _, err := updater.Manifest(context.Background()); err == nil {
+		t.Error("Expected error for a missing stable channel")
+	}
+}
+
+func TestNewUpdater(t *testing.T) {
+	public, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := NewUpdater("", "nightly", public); err == nil {
+		t.Error("Expected error for unknown channel")
+	}
+	if _, err := NewUpdater("", ChannelStable, nil); err == nil {
+		t.Error("Expected error without a signing key")
+	}
+
+	if _, err := ParsePublicKey(""); err == nil {
+		t.Error("Expected error for an empty key")
+	}
+	if _, err := ParsePublicKey("c2hvcnQ="); err == nil {
+		t.Error("Expected error for a key of the wrong size")
+	}
+	parsed, err := ParsePublicKey(base64.StdEncoding.EncodeToString(public))
+	if err != nil || !parsed.Equal(public) {
+		t.Errorf("ParsePublicKey() = %v, %v", parsed, err)
+	}
+}
+
+func TestInstall(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "forge")
+	if err := os.WriteFile(path, []byte("old"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(path, []byte("new")); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	data, _ := os.ReadFile(path)
+	if string(data) != "new" {
+		t.Errorf("binary = %q, want new", data)
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm()&0100 == 0 {
+		t.Errorf("Expected the new binary to be executable, mode %v", info.Mode())
+	}
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("Expected no temporary files to be left, got %d entries", len(entries))
+	}
+}
@@ -0,0 +1,180 @@
+package update
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version is a semantic version. Pre-release versions, such as those on the
+// beta channel, sort before the release they precede.
+type Version struct {
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// ParseVersion parses a version such as "1.4.2", "v1.5.0-beta.1" or "1.4"
+func ParseVersion(s string) (Version, error) {
+	value := strings.TrimPrefix(strings.TrimSpace(s), "v")
+	value, _, _ = strings.Cut(value, "+")
+	core, prerelease, _ := strings.Cut(value, "-")
+
+	parts := strings.Split(core, ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return Version{}, fmt.Errorf("invalid version %q", s)
+	}
+	numbers := make([]int, 3)
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		if err != nil || n < 0 {
+			return Version{}, fmt.Errorf("invalid version %q", s)
+		}
+		numbers[i] = n
+	}
+	return Version{Major: numbers[0], Minor: numbers[1], Patch: numbers[2], Prerelease: prerelease}, nil
+}
+
+// String returns the version without a "v" prefix
+func (v Version) String() string {
+	s := fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	return s
+}
+
+// Compare returns -1, 0 or 1 as v is older than, equal to or newer than other
+func (v Version) Compare(other Version) int {
+	for _, pair := range [][2]int{{v.Major, other.Major}, {v.Minor, other.Minor}, {v.Patch, other.Patch}} {
+		if pair[0] != pair[1] {
+			if pair[0] < pair[1] {
+				return -1
+			}
+			return 1
+		}
+	}
+	switch {
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	case v.Prerelease < other.Prerelease:
+		return -1
+	default:
+		return 1
+	}
+}
+
+// constraintTerm is a single comparison such as ">= 1.4.0"
+type constraintTerm struct {
+	op      string
+	version Version
+	// parts is how many version components were given, for "~>"
+	parts int
+}
+
+// Constraint is a set of version comparisons that must all hold, such as
+// ">= 1.4.0, < 2.0.0". Supported operators are =, !=, >, >=, <, <= and ~>,
+// which allows only the last given component to increase ("~> 1.4" means
+// ">= 1.4, < 2.0" and "~> 1.4.2" means ">= 1.4.2, < 1.5.0").
+type Constraint struct {
+	raw   string
+	terms []constraintTerm
+}
+
+// ParseConstraint parses a version constraint. A bare version means "=".
+func ParseConstraint(s string) (Constraint, error) {
+	constraint := Constraint{raw: strings.TrimSpace(s)}
+	for _, term := range strings.Split(s, ",") {
+		term = strings.TrimSpace(term)
+		if term == "" {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q", s)
+		}
+
+		op := "="
+		for _, candidate := range []string{"~>", ">=", "<=", "!=", ">", "<", "="} {
+			if strings.HasPrefix(term, candidate) {
+				op = candidate
+				term = strings.TrimSpace(strings.TrimPrefix(term, candidate))
+				break
+			}
+		}
+
+		version, err := ParseVersion(term)
+		if err != nil {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q: %w", s, err)
+		}
+		parts := len(strings.Split(strings.SplitN(strings.TrimPrefix(term, "v"), "-", 2)[0], "."))
+		if op == "~>" && parts < 2 {
+			return Constraint{}, fmt.Errorf("invalid version constraint %q: ~> needs at least major.minor", s)
+		}
+		constraint.terms = append(constraint.terms, constraintTerm{op: op, version: version, parts: parts})
+	}
+	return constraint, nil
+}
+
+// Check reports whether a version satisfies every term of the constraint
+func (c Constraint) Check(v Version) bool {
+	for _, term := range c.terms {
+		cmp := v.Compare(term.version)
+		var ok bool
+		switch term.op {
+		case "=":
+			ok = cmp == 0
+		case "!=":
+			ok = cmp != 0
+		case ">":
+			ok = cmp > 0
+		case ">=":
+			ok = cmp >= 0
+		case "<":
+			ok = cmp < 0
+		case "<=":
+			ok = cmp <= 0
+		case "~>":
+			ok = cmp >= 0 && v.Compare(term.upperBound()) < 0
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// String returns the constraint as written
+func (c Constraint) String() string {
+	return c.raw
+}
+
+// upperBound returns the first version excluded by a "~>" term
+func (t constraintTerm) upperBound() Version {
+	if t.parts == 2 {
+		return Version{Major: t.version.Major + 1}
+	}
+	return Version{Major: t.version.Major, Minor: t.version.Minor + 1}
+}
+
+// CheckRequired checks the running version against a project's required
+// version constraint. Development builds, whose version is not a release
+// number, are not checked.
+func CheckRequired(required, current string) error {
+	if strings.TrimSpace(required) == "" {
+		return nil
+	}
+	constraint, err := ParseConstraint(required)
+	if err != nil {
+		return fmt.Errorf("invalid required_version: %w", err)
+	}
+	version, err := ParseVersion(current)
+	if err != nil {
+		return nil
+	}
+	if !constraint.Check(version) {
+		return fmt.Errorf("this project requires forge %s, but this binary is version %s; run 'forge self-update' or install a matching release", constraint, version)
+	}
+	return nil
+}
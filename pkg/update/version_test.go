@@ -0,0 +1,126 @@
+package update
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseVersion(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{input: "1.4.2", want: "1.4.2"},
+		{input: "v1.5.0-beta.1", want: "1.5.0-beta.1"},
+		{input: "1.4", want: "1.4.0"},
+		{input: "2.0.0+build.7", want: "2.0.0"},
+		{input: "dev", wantErr: true},
+		{input: "1.2.3.4", wantErr: true},
+		{input: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := ParseVersion(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseVersion(%q) = %s, want error", tt.input, got)
+				}
+				return
+			}
+			if err != nil || got.String() != tt.want {
+				t.Errorf("ParseVersion(%q) = %s, %v, want %s", tt.input, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVersion_Compare(t *testing.T) {
+	ordered := []string{"1.0.0", "1.4.2", "1.5.0-beta.1", "1.5.0-beta.2", "1.5.0", "1.10.0", "2.0.0"}
+	for i := range ordered {
+		for j := range ordered {
+			a, _ := ParseVersion(ordered[i])
+			b, _ := ParseVersion(ordered[j])
+			want := 0
+			if i < j {
+				want = -1
+			} else if i > j {
+				want = 1
+			}
+			if got := a.Compare(b); got != want {
+				t.Errorf("%s.Compare(%s) = %d, want %d", a, b, got, want)
+			}
+		}
+	}
+}
+
+func TestConstraint_Check(t *testing.T) {
+	tests := []struct {
+		constraint string
+		version    string
+		want       bool
+	}{
+		{constraint: ">= 1.5.0", version: "1.5.0", want: true},
+		{constraint: ">= 1.5.0", version: "1.4.9", want: false},
+		{constraint: ">= 1.4.0, < 2.0.0", version: "1.9.3", want: true},
+		{constraint: ">= 1.4.0, < 2.0.0", version: "2.0.0", want: false},
+		{constraint: "1.4.2", version: "1.4.2", want: true},
+		{constraint: "!= 1.4.2", version: "1.4.2", want: false},
+		{constraint: "~> 1.4", version: "1.9.0", want: true},
+		{constraint: "~> 1.4", version: "2.0.0", want: false},
+		{constraint: "~> 1.4.2", version: "1.4.9", want: true},
+		{constraint: "~> 1.4.2", version: "1.5.0", want: false},
+		{constraint: "> 1.4.0", version: "1.5.0-beta.1", want: true},
+		{constraint: "<= 1.4.0", version: "1.4.0", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.constraint+"/"+tt.version, func(t *testing.T) {
+			constraint, err := ParseConstraint(tt.constraint)
+			if err != nil {
+				t.Fatalf("ParseConstraint() error = %v", err)
+			}
+			version, _ := ParseVersion(tt.version)
+			if got := constraint.Check(version); got != tt.want {
+				t.Errorf("Check(%s) = %v, want %v", tt.version, got, tt.want)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"", ">= ", ">= 1.x", "~> 1", "1.0,,2.0"} {
+		if _, err := ParseConstraint(invalid); err == nil {
+			t.Errorf("ParseConstraint(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestCheckRequired(t *testing.T) {
+	tests := []struct {
+		name     string
+		required string
+		current  string
+		wantErr  string
+	}{
+		{name: "no constraint", required: "", current: "1.0.0"},
+		{name: "satisfied", required: ">= 1.4.0", current: "1.4.2"},
+		{name: "too old", required: ">= 1.5.0", current: "1.4.2", wantErr: "this project requires forge >= 1.5.0, but this binary is version 1.4.2"},
+		{name: "development build", required: ">= 1.5.0", current: "dev"},
+		{name: "invalid constraint", required: "newest", current: "1.4.2", wantErr: "invalid required_version"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckRequired(tt.required, tt.current)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("CheckRequired() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("CheckRequired() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+// Package vault encrypts single values so they can live in module and var
+// files next to the values that need no protection. Values are sealed with
+// AES-256-GCM under a named key, so each environment can have its own.
+package vault
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+const (
+	// Tag marks an encrypted value in YAML: key: !vault |
+	Tag = "!vault"
+	// DefaultKeyID is the key values are encrypted with when none is named
+	DefaultKeyID = "default"
+	// KeySize is the length of a vault key in bytes
+	KeySize = 32
+
+	// header starts every encrypted value, followed by the key id
+	header = "$FORGE_VAULT;1;AES256-GCM;"
+	// lineLength wraps the encoded ciphertext so it reads well in YAML
+	lineLength = 64
+)
+
+// keyIDPattern is what a key id may look like
+var keyIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Keyring finds the key for a key id
+type Keyring interface {
+	Key(id string) ([]byte, error)
+}
+
+// KeyFunc adapts a function to a Keyring
+type KeyFunc func(id string) ([]byte, error)
+
+// Key returns the key for id
+func (f KeyFunc) Key(id string) ([]byte, error) {
+	return f(id)
+}
+
+// GenerateKey returns a new random key, base64 encoded
+func GenerateKey() (string, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate key: %w", err)
+	}
+	return base64.StdEncoding.EncodeToString(key), nil
+}
+
+// ParseKey decodes a base64 encoded key
+func ParseKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+	if err != nil {
+		return nil, fmt.Errorf("vault key is not base64: %w", err)
+	}
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("vault key is %d bytes, must be %d", len(key), KeySize)
+	}
+	return key, nil
+}
+
+// Encrypt seals a value under the key with the given id. The result is the
+// text to put under a !vault tag.
+func Encrypt(key []byte, keyID, plaintext string) (string, error) {
+	return encrypt(key, keyID, []byte(plaintext), []byte(keyID))
+}
+
+// encrypt seals plaintext under a key, authenticating the additional data
+// with it
+func encrypt(key []byte, keyID string, plaintext, additional []byte) (string, error) {
+	if !keyIDPattern.MatchString(keyID) {
+		return "", fmt.Errorf("invalid key id %q, must be letters, digits, '_' and '-'", keyID)
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additional)
+	encoded := base64.StdEncoding.EncodeToString(sealed)
+
+	var b strings.Builder
+	b.WriteString(header + keyID + "\n")
+	for len(encoded) > lineLength {
+		b.WriteString(encoded[:lineLength] + "\n")
+		encoded = encoded[lineLength:]
+	}
+	b.WriteString(encoded + "\n")
+	return b.String(), nil
+}
+
+// KeyID returns the id of the key a value was encrypted with
+func KeyID(value string) (string, error) {
+	first, _, _ := strings.Cut(strings.TrimSpace(value), "\n")
+	keyID, ok := strings.CutPrefix(strings.TrimSpace(first), header)
+	if !ok {
+		return "", fmt.Errorf("not a forge vault value, expected it to start with %s", header)
+	}
+	if !keyIDPattern.MatchString(keyID) {
+		return "", fmt.Errorf("invalid key id %q in vault value", keyID)
+	}
+	return keyID, nil
+}
+
+// Decrypt opens a value with the key it names from the keyring
+func Decrypt(value string, keys Keyring) (string, error) {
+	plaintext, err := decrypt(value, keys, func(keyID string) []byte { return []byte(keyID) })
+	return string(plaintext), err
+}
+
+// decrypt opens a value with the key it names, checking the additional data
+// it was sealed with
+func decrypt(value string, keys Keyring, additional func(keyID string) []byte) ([]byte, error) {
+	keyID, err := KeyID(value)
+	if err != nil {
+		return nil, err
+	}
+	_, body, _ := strings.Cut(strings.TrimSpace(value), "\n")
+	sealed, err := base64.StdEncoding.DecodeString(strings.Join(strings.Fields(body), ""))
+	if err != nil {
+		return nil, fmt.Errorf("vault value is corrupt: %w", err)
+	}
+
+	key, err := keys.Key(keyID)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("vault value is corrupt: too short")
+	}
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, additional(keyID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt vault value with key %s: wrong key or corrupt value", keyID)
+	}
+	return plaintext, nil
+}
+
+// newAEAD returns the AES-256-GCM cipher for a key
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("vault key is %d bytes, must be %d", len(key), KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// IsEncrypted reports whether data was sealed by Encrypt or a Sealer
+func IsEncrypted(data []byte) bool {
+	return strings.HasPrefix(strings.TrimSpace(string(data)), header)
+}
+
+// Contains reports whether text holds an encrypted value, whole or within
+// other text
+func Contains(text string) bool {
+	return strings.Contains(text, header)
+}
+
+// Sealer encrypts whole documents at rest, such as saved plans and stored
+// executions. Each document names the key it was sealed with, so after a
+// key rotation older documents open as long as the old key can be found.
+// Documents are sealed under a name saying what they are, such as
+// executions/<id>, and only open under the same name, so a sealed document
+// cannot be passed off as another.
+type Sealer struct {
+	keys  Keyring
+	keyID string
+}
+
+// NewSealer creates a sealer that seals with the key keyID and opens with
+// any key of the keyring. Without a key id documents are stored as they are.
+func NewSealer(keys Keyring, keyID string) *Sealer {
+	return &Sealer{keys: keys, keyID: keyID}
+}
+
+// KeyID returns the id of the key documents are sealed with, "" when
+// sealing is off
+func (s *Sealer) KeyID() string {
+	if s == nil {
+		return ""
+	}
+	return s.keyID
+}
+
+// Seal encrypts the document with the given name under the sealer's key
+func (s *Sealer) Seal(data []byte, name string) ([]byte, error) {
+	if s.KeyID() == "" {
+		return data, nil
+	}
+	key, err := s.keys.Key(s.keyID)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := encrypt(key, s.keyID, data, sealedData(s.keyID, name))
+	if err != nil {
+		return nil, err
+	}
+	return []byte(sealed), nil
+}
+
+// Open decrypts the sealed document with the given name with the key it
+// names. While sealing is on, documents that are not sealed are refused
+// rather than trusted; IsSealed tells them apart for a rekey.
+func (s *Sealer) Open(data []byte, name string) ([]byte, error) {
+	if !IsEncrypted(data) {
+		if keyID := s.KeyID(); keyID != "" {
+			return nil, fmt.Errorf("%s is not encrypted, but documents are encrypted with vault key %s", name, keyID)
+		}
+		return data, nil
+	}
+	if s == nil || s.keys == nil {
+		keyID, _ := KeyID(string(data))
+		return nil, fmt.Errorf("%s is encrypted with vault key %s, but no keys are configured", name, keyID)
+	}
+	return decrypt(string(data), s.keys, func(keyID string) []byte { return sealedData(keyID, name) })
+}
+
+// IsSealed reports whether a document is sealed
+func (s *Sealer) IsSealed(data []byte) bool {
+	return IsEncrypted(data)
+}
+
+// sealedData is what a sealed document is authenticated with: the key id
+// and the document's name. The separator keeps it apart from the key id
+// alone, which single values are sealed with.
+func sealedData(keyID, name string) []byte {
+	return []byte(keyID + "\x00" + name)
+}
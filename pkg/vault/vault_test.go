@@ -0,0 +1,168 @@
+package vault
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testKeys returns a keyring with a default and a production key
+func testKeys(t *testing.T) (map[string][]byte, Keyring) {
+	t.Helper()
+	keys := make(map[string][]byte)
+	for _, id := range []string{DefaultKeyID, "production"} {
+		encoded, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if keys[id], err = ParseKey(encoded); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return keys, KeyFunc(func(id string) ([]byte, error) {
+		key, ok := keys[id]
+		if !ok {
+			return nil, fmt.Errorf("no vault key %s", id)
+		}
+		return key, nil
+	})
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	keys, keyring := testKeys(t)
+	secret := strings.Repeat("s3cret password ", 8)
+
+	value, err := Encrypt(keys["production"], "production", secret)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	if !strings.HasPrefix(value, "$FORGE_VAULT;1;AES256-GCM;production\n") || strings.Contains(value, "s3cret") {
+		t.Errorf("value = %q", value)
+	}
+	for _, line := range strings.Split(strings.TrimSpace(value), "\n")[1:] {
+		if len(line) > lineLength {
+			t.Errorf("line %q is longer than %d", line, lineLength)
+		}
+	}
+	if id, err := KeyID(value); err != nil || id != "production" {
+		t.Errorf("KeyID = %q, %v", id, err)
+	}
+
+	// YAML block scalars may indent the value and drop the trailing newline
+	indented := "  " + strings.ReplaceAll(strings.TrimSpace(value), "\n", "\n  ")
+	got, err := Decrypt(indented, keyring)
+	if err != nil {
+		t.Fatalf("Decrypt: %v", err)
+	}
+	if got != secret {
+		t.Errorf("Decrypt = %q, want %q", got, secret)
+	}
+}
+
+func TestDecrypt_Errors(t *testing.T) {
+	keys, keyring := testKeys(t)
+	value, err := Encrypt(keys[DefaultKeyID], DefaultKeyID, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(value), "\n")
+
+	tests := []struct {
+		name  string
+		value string
+		want  string
+	}{
+		{name: "not a vault value", value: "$ANSIBLE_VAULT;1.1;AES256\n6162", want: "not a forge vault value"},
+		{name: "unknown key", value: strings.Replace(value, ";default", ";staging", 1), want: "no vault key staging"},
+		{name: "other key", value: strings.Replace(value, ";default", ";production", 1), want: "wrong key or corrupt value"},
+		{name: "tampered", value: lines[0] + "\n" + strings.Replace(lines[1], lines[1][:4], "AAAA", 1), want: "wrong key or corrupt value"},
+		{name: "not base64", value: lines[0] + "\n!!!", want: "vault value is corrupt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Decrypt(tt.value, keyring)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("Decrypt = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	if _, err := ParseKey("c2hvcnQ="); err == nil || !strings.Contains(err.Error(), "must be 32") {
+		t.Errorf("ParseKey of a short key = %v", err)
+	}
+	if _, err := ParseKey("not base64!"); err == nil {
+		t.Error("expected an error for a key that is not base64")
+	}
+	if _, err := Encrypt(make([]byte, KeySize), "prod.eu", "x"); err == nil {
+		t.Error("expected an error for an invalid key id")
+	}
+}
+
+func TestSealer(t *testing.T) {
+	keys, keyring := testKeys(t)
+	document := []byte(`{"hosts": [{"name": "web1", "diff": "password: s3cret"}]}`)
+
+	old := NewSealer(keyring, "production")
+	sealed, err := old.Seal(document, "executions/1")
+	if err != nil {
+		t.Fatalf("Seal: %v", err)
+	}
+	if !IsEncrypted(sealed) || strings.Contains(string(sealed), "s3cret") {
+		t.Fatalf("sealed = %q", sealed)
+	}
+
+	// After rotating to another key, documents sealed with the old one open
+	rotated := NewSealer(keyring, DefaultKeyID)
+	opened, err := rotated.Open(sealed, "executions/1")
+	if err != nil || string(opened) != string(document) {
+		t.Errorf("Open = %q, %v", opened, err)
+	}
+	resealed, err := rotated.Seal(opened, "executions/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id, _ := KeyID(string(resealed)); id != DefaultKeyID {
+		t.Errorf("resealed with key %q", id)
+	}
+
+	// A document only opens under the name it was sealed with, and a value
+	// encrypted on its own does not open as a document
+	if _, err := rotated.Open(sealed, "executions/2"); err == nil {
+		t.Error("Open under another name succeeded")
+	}
+	value, err := Encrypt(keys["production"], "production", string(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := rotated.Open([]byte(value), "executions/1"); err == nil {
+		t.Error("Open of a single value succeeded")
+	}
+
+	// With sealing on, documents that are not sealed are refused
+	if _, err := rotated.Open(document, "executions/1"); err == nil || !strings.Contains(err.Error(), "not encrypted") {
+		t.Errorf("Open(plaintext) = %v", err)
+	}
+	if rotated.IsSealed(document) || !rotated.IsSealed(sealed) {
+		t.Error("IsSealed does not tell sealed documents apart")
+	}
+	off := NewSealer(keyring, "")
+	if stored, err := off.Seal(document, "executions/1"); err != nil || string(stored) != string(document) {
+		t.Errorf("Seal without a key id = %q, %v", stored, err)
+	}
+	if opened, err := off.Open(document, "executions/1"); err != nil || string(opened) != string(document) {
+		t.Errorf("Open(plaintext) without a key id = %q, %v", opened, err)
+	}
+	if opened, err := off.Open(sealed, "executions/1"); err != nil || string(opened) != string(document) {
+		t.Errorf("Open without a key id = %q, %v", opened, err)
+	}
+
+	var none *Sealer
+	if _, err := none.Open(sealed, "executions/1"); err == nil || !strings.Contains(err.Error(), "encrypted with vault key production") {
+		t.Errorf("Open without keys = %v", err)
+	}
+	if _, err := NewSealer(keyring, "missing").Seal(document, "executions/1"); err == nil {
+		t.Error("Seal with an unknown key succeeded")
+	}
+}
@@ -0,0 +1,39 @@
+package webhook
+
+import (
+	"context"
+
+	"github.com/ataiva-software/forge/pkg/drift"
+)
+
+// DriftChannel sends drift reports as drift.detected webhooks. It can be
+// added to a drift.DriftNotifier alongside the other notification channels.
+type DriftChannel struct {
+	dispatcher *Dispatcher
+}
+
+// NewDriftChannel creates a drift notification channel backed by a dispatcher
+func NewDriftChannel(dispatcher *Dispatcher) *DriftChannel {
+	return &DriftChannel{dispatcher: dispatcher}
+}
+
+// Send delivers the drift report
+func (c *DriftChannel) Send(ctx context.Context, report *drift.DriftReport) error {
+	drifted := []string{}
+	for _, result := range report.Results {
+		if result.HasDrift {
+			drifted = append(drifted, result.ResourceID)
+		}
+	}
+	return c.dispatcher.Send(ctx, EventDriftDetected, report.ModuleName, map[string]interface{}{
+		"checked":   report.TotalChecked,
+		"drifted":   report.DriftDetected,
+		"errors":    report.Errors,
+		"resources": drifted,
+	})
+}
+
+// Type returns the notification channel type
+func (c *DriftChannel) Type() string {
+	return "webhook"
+}
@@ -0,0 +1,249 @@
+// Package webhook delivers run lifecycle events to external systems as signed
+// JSON payloads. Unlike notifications, which are messages for people, webhook
+// payloads have a fixed structure meant for other programs.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/clock"
+)
+
+// Lifecycle events a webhook can subscribe to
+const (
+	EventPlanCreated    = "plan.created"
+	EventApplyStarted   = "apply.started"
+	EventApplyFinished  = "apply.finished"
+	EventDriftDetected  = "drift.detected"
+	EventCanaryStarted  = "canary.started"
+	EventCanaryPromoted = "canary.promoted"
+	EventCanaryFailed   = "canary.failed"
+)
+
+// Events lists every lifecycle event
+var Events = []string{EventPlanCreated, EventApplyStarted, EventApplyFinished, EventDriftDetected, EventCanaryStarted, EventCanaryPromoted, EventCanaryFailed}
+
+// Headers set on every delivery
+const (
+	HeaderEvent     = "X-Chisel-Event"
+	HeaderDelivery  = "X-Chisel-Delivery"
+	HeaderTimestamp = "X-Chisel-Timestamp"
+	HeaderSignature = "X-Chisel-Signature"
+)
+
+const (
+	// DefaultMaxAttempts is how many times a delivery is tried
+	DefaultMaxAttempts = 3
+	// DefaultTimeout bounds a single delivery attempt
+	DefaultTimeout = 10 * time.Second
+	// retryBackoff is the wait before the first retry; it doubles for each retry after
+	retryBackoff = time.Second
+)
+
+// Endpoint is a webhook receiver and the events it subscribes to
+type Endpoint struct {
+	URL string `yaml:"url" mapstructure:"url"`
+	// Secret signs every payload with HMAC-SHA256; empty sends unsigned payloads
+	Secret string `yaml:"secret,omitempty" mapstructure:"secret"`
+	// Events to deliver; empty subscribes to every event
+	Events      []string `yaml:"events,omitempty" mapstructure:"events"`
+	MaxAttempts int      `yaml:"max_attempts,omitempty" mapstructure:"max_attempts"`
+}
+
+// Validate checks the endpoint configuration
+func (e Endpoint) Validate() error {
+	if !strings.HasPrefix(e.URL, "http://") && !strings.HasPrefix(e.URL, "https://") {
+		return fmt.Errorf("webhook url '%s' must start with http:// or https://", e.URL)
+	}
+	for _, event := range e.Events {
+		if !knownEvent(event) {
+			return fmt.Errorf("unknown webhook event '%s', must be one of: %s", event, strings.Join(Events, ", "))
+		}
+	}
+	if e.MaxAttempts < 0 {
+		return fmt.Errorf("webhook max_attempts must not be negative")
+	}
+	return nil
+}
+
+// Subscribed reports whether the endpoint receives an event
+func (e Endpoint) Subscribed(event string) bool {
+	if len(e.Events) == 0 {
+		return true
+	}
+	for _, subscribed := range e.Events {
+		if subscribed == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Payload is the JSON body of a delivery
+type Payload struct {
+	ID        string                 `json:"id"`
+	Event     string                 `json:"event"`
+	Timestamp time.Time              `json:"timestamp"`
+	Module    string                 `json:"module,omitempty"`
+	Data      map[string]interface{} `json:"data"`
+}
+
+// Dispatcher delivers events to the configured endpoints
+type Dispatcher struct {
+	endpoints []Endpoint
+	client    *http.Client
+	sleep     func(ctx context.Context, d time.Duration) error
+	now       func() time.Time
+}
+
+// NewDispatcher creates a dispatcher for the given endpoints
+func NewDispatcher(endpoints []Endpoint) (*Dispatcher, error) {
+	for _, endpoint := range endpoints {
+		if err := endpoint.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &Dispatcher{
+		endpoints: endpoints,
+		client:    &http.Client{Timeout: DefaultTimeout},
+		sleep:     clock.Sleep,
+		now:       time.Now,
+	}, nil
+}
+
+// Send delivers an event to every subscribed endpoint, retrying failed
+// deliveries. It returns an error listing the endpoints that never accepted it.
+func (d *Dispatcher) Send(ctx context.Context, event, module string, data map[string]interface{}) error {
+	if d == nil {
+		return nil
+	}
+	if data == nil {
+		data = map[string]interface{}{}
+	}
+	payload := Payload{
+		ID:        newDeliveryID(),
+		Event:     event,
+		Timestamp: d.now().UTC(),
+		Module:    module,
+		Data:      data,
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s webhook: %w", event, err)
+	}
+
+	var failures []string
+	for _, endpoint := range d.endpoints {
+		if !endpoint.Subscribed(event) {
+			continue
+		}
+		if err := d.deliver(ctx, endpoint, payload, body); err != nil {
+			failures = append(failures, fmt.Sprintf("%s: %v", endpoint.URL, err))
+		}
+	}
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to deliver %s webhook: %s", event, strings.Join(failures, "; "))
+	}
+	return nil
+}
+
+// deliver posts a payload to one endpoint until it is accepted or the attempts run out
+func (d *Dispatcher) deliver(ctx context.Context, endpoint Endpoint, payload Payload, body []byte) error {
+	attempts := endpoint.MaxAttempts
+	if attempts == 0 {
+		attempts = DefaultMaxAttempts
+	}
+
+	backoff := retryBackoff
+	var err error
+	for attempt := 1; attempt <= attempts; attempt++ {
+		var retry bool
+		retry, err = d.post(ctx, endpoint, payload, body)
+		if err == nil || !retry || attempt == attempts {
+			break
+		}
+		if sleepErr := d.sleep(ctx, backoff); sleepErr != nil {
+			return sleepErr
+		}
+		backoff *= 2
+	}
+	if err != nil {
+		return fmt.Errorf("%w after %d attempt(s)", err, attempts)
+	}
+	return nil
+}
+
+// post makes a single delivery attempt and reports whether a failure is worth retrying
+func (d *Dispatcher) post(ctx context.Context, endpoint Endpoint, payload Payload, body []byte) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	timestamp := strconv.FormatInt(payload.Timestamp.Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, payload.Event)
+	req.Header.Set(HeaderDelivery, payload.ID)
+	req.Header.Set(HeaderTimestamp, timestamp)
+	if endpoint.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(endpoint.Secret, timestamp, body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64*1024))
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return false, nil
+	}
+	// Client errors other than rate limiting will not succeed on a retry
+	retry := resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	return retry, fmt.Errorf("status %d", resp.StatusCode)
+}
+
+// Sign returns the signature header value for a payload: an HMAC-SHA256 of
+// the timestamp, a dot and the body, so a captured delivery cannot be replayed
+// with a new timestamp
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery's signature, for receivers written in Go
+func Verify(secret, timestamp string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// knownEvent reports whether an event name is a lifecycle event
+func knownEvent(event string) bool {
+	for _, known := range Events {
+		if event == known {
+			return true
+		}
+	}
+	return false
+}
+
+// newDeliveryID returns a random ID that receivers can use to drop duplicate deliveries
+func newDeliveryID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return "whd_" + hex.EncodeToString(b)
+}
@@ -0,0 +1,218 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/drift"
+)
+
+// receiver records deliveries and answers with queued status codes
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, req)
+	r.bodies = append(r.bodies, body)
+	status := http.StatusOK
+	if len(r.statuses) > 0 {
+		status = r.statuses[0]
+		r.statuses = r.statuses[1:]
+	}
+	w.WriteHeader(status)
+}
+
+// newTestDispatcher returns a dispatcher that records retry waits instead of sleeping
+func newTestDispatcher(t *testing.T, endpoints ...Endpoint) (*Dispatcher, *[]time.Duration) {
+	t.Helper()
+	dispatcher, err := NewDispatcher(endpoints)
+	if err != nil {
+		t.Fatalf("NewDispatcher() error = %v", err)
+	}
+	var waits []time.Duration
+	dispatcher.sleep = func(ctx context.Context, d time.Duration) error {
+		waits = append(waits, d)
+		return nil
+	}
+	dispatcher.now = func() time.Time { return time.Unix(1700000000, 0) }
+	return dispatcher, &waits
+}
+
+func TestEndpoint_Validate(t *testing.T) {
+	tests := []struct {
+		name     string
+		endpoint Endpoint
+		wantErr  string
+	}{
+		{name: "all events", endpoint: Endpoint{URL: "https://hooks.example.com/chisel"}},
+		{name: "some events", endpoint: Endpoint{URL: "http://ci:8080/hook", Events: []string{EventApplyFinished, EventDriftDetected}, MaxAttempts: 5}},
+		{name: "no scheme", endpoint: Endpoint{URL: "hooks.example.com"}, wantErr: "must start with http://"},
+		{name: "unknown event", endpoint: Endpoint{URL: "https://hooks.example.com", Events: []string{"apply.done"}}, wantErr: "unknown webhook event 'apply.done'"},
+		{name: "negative attempts", endpoint: Endpoint{URL: "https://hooks.example.com", MaxAttempts: -1}, wantErr: "max_attempts"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.endpoint.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("Validate() unexpected error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Validate() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestDispatcher_SendSigned(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	dispatcher, _ := newTestDispatcher(t,
+		Endpoint{URL: server.URL + "/all", Secret: "s3cret"},
+		Endpoint{URL: server.URL + "/drift", Events: []string{EventDriftDetected}},
+	)
+
+	err := dispatcher.Send(context.Background(), EventApplyFinished, "web", map[string]interface{}{"status": "succeeded"})
+	if err != nil {
+		t.Fatalf("Send() error = %v", err)
+	}
+	if len(recv.requests) != 1 {
+		t.Fatalf("Expected 1 delivery to the subscribed endpoint, got %d", len(recv.requests))
+	}
+
+	req, body := recv.requests[0], recv.bodies[0]
+	if req.URL.Path != "/all" {
+		t.Errorf("Expected delivery to /all, got %s", req.URL.Path)
+	}
+	if req.Header.Get(HeaderEvent) != EventApplyFinished || req.Header.Get(HeaderTimestamp) != "1700000000" {
+		t.Errorf("Unexpected headers: %v", req.Header)
+	}
+	if !strings.HasPrefix(req.Header.Get(HeaderDelivery), "whd_") {
+		t.Errorf("Expected a delivery ID, got %q", req.Header.Get(HeaderDelivery))
+	}
+	if !Verify("s3cret", "1700000000", body, req.Header.Get(HeaderSignature)) {
+		t.Error("Expected a valid signature")
+	}
+	if Verify("s3cret", "1700000001", body, req.Header.Get(HeaderSignature)) {
+		t.Error("Expected the signature to cover the timestamp")
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(body, &payload); err != nil {
+		t.Fatalf("Failed to parse payload: %v", err)
+	}
+	if payload.Event != EventApplyFinished || payload.Module != "web" || payload.Data["status"] != "succeeded" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+}
+
+func TestDispatcher_Retry(t *testing.T) {
+	tests := []struct {
+		name         string
+		statuses     []int
+		maxAttempts  int
+		wantRequests int
+		wantWaits    []time.Duration
+		wantErr      string
+	}{
+		{name: "succeeds after server errors", statuses: []int{503, 500, 200}, wantRequests: 3, wantWaits: []time.Duration{time.Second, 2 * time.Second}},
+		{name: "rate limited", statuses: []int{429, 204}, wantRequests: 2, wantWaits: []time.Duration{time.Second}},
+		{name: "gives up", statuses: []int{502, 502}, maxAttempts: 2, wantRequests: 2, wantWaits: []time.Duration{time.Second}, wantErr: "status 502 after 2 attempt(s)"},
+		{name: "client error is not retried", statuses: []int{401}, wantRequests: 1, wantErr: "status 401"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recv := &receiver{statuses: tt.statuses}
+			server := httptest.NewServer(recv)
+			defer server.Close()
+
+			dispatcher, waits := newTestDispatcher(t, Endpoint{URL: server.URL, MaxAttempts: tt.maxAttempts})
+			err := dispatcher.Send(context.Background(), EventPlanCreated, "web", nil)
+
+			if tt.wantErr == "" && err != nil {
+				t.Errorf("Send() unexpected error = %v", err)
+			}
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Errorf("Send() error = %v, want %q", err, tt.wantErr)
+			}
+			if len(recv.requests) != tt.wantRequests {
+				t.Errorf("Expected %d requests, got %d", tt.wantRequests, len(recv.requests))
+			}
+			if len(*waits) != len(tt.wantWaits) {
+				t.Fatalf("Expected waits %v, got %v", tt.wantWaits, *waits)
+			}
+			for i := range tt.wantWaits {
+				if (*waits)[i] != tt.wantWaits[i] {
+					t.Errorf("Expected waits %v, got %v", tt.wantWaits, *waits)
+				}
+			}
+			// Retries resend the same delivery
+			for _, req := range recv.requests[1:] {
+				if req.Header.Get(HeaderDelivery) != recv.requests[0].Header.Get(HeaderDelivery) {
+					t.Error("Expected retries to keep the delivery ID")
+				}
+			}
+		})
+	}
+}
+
+func TestDispatcher_Nil(t *testing.T) {
+	var dispatcher *Dispatcher
+	if err := dispatcher.Send(context.Background(), EventApplyStarted, "web", nil); err != nil {
+		t.Errorf("Send() on a nil dispatcher error = %v", err)
+	}
+}
+
+func TestDriftChannel(t *testing.T) {
+	recv := &receiver{}
+	server := httptest.NewServer(recv)
+	defer server.Close()
+
+	dispatcher, _ := newTestDispatcher(t, Endpoint{URL: server.URL, Events: []string{EventDriftDetected}})
+	notifier := drift.NewDriftNotifier(1)
+	notifier.AddChannel(NewDriftChannel(dispatcher))
+	notifier.Enable()
+
+	report := &drift.DriftReport{
+		ModuleName:    "web",
+		TotalChecked:  3,
+		DriftDetected: 1,
+		Results: []drift.DriftResult{
+			{ResourceID: "file.nginx-config", HasDrift: true},
+			{ResourceID: "pkg.nginx"},
+		},
+	}
+	if err := notifier.Notify(context.Background(), report); err != nil {
+		t.Fatalf("Notify() error = %v", err)
+	}
+	if len(recv.bodies) != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", len(recv.bodies))
+	}
+
+	var payload Payload
+	json.Unmarshal(recv.bodies[0], &payload)
+	resources, _ := payload.Data["resources"].([]interface{})
+	if payload.Event != EventDriftDetected || len(resources) != 1 || resources[0] != "file.nginx-config" {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+}
@@ -0,0 +1,172 @@
+package webui
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/ataiva-software/forge/pkg/update"
+)
+
+// Agent protocol versions this server speaks. The protocol version changes
+// when check-in or report payloads change incompatibly; release versions
+// change far more often and only decide whether an agent is outdated.
+const (
+	AgentProtocolMin = 1
+	AgentProtocolMax = 1
+)
+
+// Agent compatibility states shown in the UI
+const (
+	AgentCurrent      = "current"
+	AgentOutdated     = "outdated"
+	AgentIncompatible = "incompatible"
+	AgentUnknown      = "unknown"
+)
+
+// AgentCheckIn is what an agent reports to the server
+type AgentCheckIn struct {
+	Name        string `json:"name"`
+	Version     string `json:"version"`
+	ProtocolMin int    `json:"protocol_min"`
+	ProtocolMax int    `json:"protocol_max"`
+}
+
+// AgentCheckInResponse tells an agent which protocol version to use
+type AgentCheckInResponse struct {
+	ProtocolVersion int    `json:"protocol_version,omitempty"`
+	ServerVersion   string `json:"server_version"`
+	Status          string `json:"status"`
+	Message         string `json:"message,omitempty"`
+}
+
+// AgentStatus is the last check-in of an agent and its compatibility with the server
+type AgentStatus struct {
+	Name            string    `json:"name"`
+	Version         string    `json:"version"`
+	ProtocolVersion int       `json:"protocol_version,omitempty"`
+	Status          string    `json:"status"`
+	Message         string    `json:"message,omitempty"`
+	LastSeen        time.Time `json:"last_seen"`
+}
+
+// NegotiateProtocol returns the highest protocol version in both ranges
+func NegotiateProtocol(agentMin, agentMax, serverMin, serverMax int) (int, error) {
+	version := agentMax
+	if serverMax < version {
+		version = serverMax
+	}
+	floor := agentMin
+	if serverMin > floor {
+		floor = serverMin
+	}
+	if version < floor {
+		return 0, fmt.Errorf("agent speaks protocol %d-%d, server speaks %d-%d", agentMin, agentMax, serverMin, serverMax)
+	}
+	return version, nil
+}
+
+// SetVersion sets the release version the server reports and compares agents against
+func (s *WebUIServer) SetVersion(version string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.version = version
+}
+
+// CheckInAgent records an agent's check-in and negotiates its protocol version
+func (s *WebUIServer) CheckInAgent(checkIn AgentCheckIn) AgentCheckInResponse {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := AgentStatus{
+		Name:     checkIn.Name,
+		Version:  checkIn.Version,
+		LastSeen: time.Now(),
+	}
+
+	protocol, err := NegotiateProtocol(checkIn.ProtocolMin, checkIn.ProtocolMax, AgentProtocolMin, AgentProtocolMax)
+	switch {
+	case err != nil:
+		status.Status = AgentIncompatible
+		if checkIn.ProtocolMax < AgentProtocolMin {
+			status.Message = fmt.Sprintf("%s; upgrade the agent to forge %s", err, s.version)
+		} else {
+			status.Message = fmt.Sprintf("%s; upgrade the server", err)
+		}
+	default:
+		status.ProtocolVersion = protocol
+		status.Status = compareAgentVersion(checkIn.Version, s.version)
+		if status.Status == AgentOutdated {
+			status.Message = fmt.Sprintf("agent runs forge %s, server runs %s; upgrade the agent", checkIn.Version, s.version)
+		}
+	}
+	s.agents[checkIn.Name] = &status
+
+	return AgentCheckInResponse{
+		ProtocolVersion: status.ProtocolVersion,
+		ServerVersion:   s.version,
+		Status:          status.Status,
+		Message:         status.Message,
+	}
+}
+
+// Agents returns every agent's last check-in, sorted by name
+func (s *WebUIServer) Agents() []AgentStatus {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	agents := make([]AgentStatus, 0, len(s.agents))
+	for _, agent := range s.agents {
+		agents = append(agents, *agent)
+	}
+	sort.Slice(agents, func(i, j int) bool { return agents[i].Name < agents[j].Name })
+	return agents
+}
+
+// handleAgents lists agents on GET and records a check-in on POST
+func (s *WebUIServer) handleAgents(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.writeJSON(w, s.Agents())
+	case http.MethodPost:
+		var checkIn AgentCheckIn
+		if err := json.NewDecoder(r.Body).Decode(&checkIn); err != nil {
+			http.Error(w, fmt.Sprintf("invalid check-in: %v", err), http.StatusBadRequest)
+			return
+		}
+		if checkIn.Name == "" || checkIn.ProtocolMin <= 0 || checkIn.ProtocolMax < checkIn.ProtocolMin {
+			http.Error(w, "check-in must have a name and a valid protocol_min and protocol_max", http.StatusBadRequest)
+			return
+		}
+
+		response := s.CheckInAgent(checkIn)
+		if response.Status == AgentIncompatible {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusUpgradeRequired)
+			json.NewEncoder(w).Encode(response)
+			return
+		}
+		s.writeJSON(w, response)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// compareAgentVersion reports whether an agent is older than the server.
+// Development builds on either side cannot be compared.
+func compareAgentVersion(agentVersion, serverVersion string) string {
+	agent, err := update.ParseVersion(agentVersion)
+	if err != nil {
+		return AgentUnknown
+	}
+	server, err := update.ParseVersion(serverVersion)
+	if err != nil {
+		return AgentUnknown
+	}
+	if agent.Compare(server) < 0 {
+		return AgentOutdated
+	}
+	return AgentCurrent
+}
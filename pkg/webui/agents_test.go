@@ -0,0 +1,102 @@
+package webui
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateProtocol(t *testing.T) {
+	tests := []struct {
+		name                 string
+		agentMin, agentMax   int
+		serverMin, serverMax int
+		want                 int
+		wantErr              bool
+	}{
+		{name: "same range", agentMin: 1, agentMax: 1, serverMin: 1, serverMax: 1, want: 1},
+		{name: "newer agent", agentMin: 1, agentMax: 3, serverMin: 1, serverMax: 2, want: 2},
+		{name: "newer server", agentMin: 2, agentMax: 2, serverMin: 1, serverMax: 3, want: 2},
+		{name: "agent too old", agentMin: 1, agentMax: 1, serverMin: 2, serverMax: 3, wantErr: true},
+		{name: "server too old", agentMin: 3, agentMax: 4, serverMin: 1, serverMax: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NegotiateProtocol(tt.agentMin, tt.agentMax, tt.serverMin, tt.serverMax)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NegotiateProtocol() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NegotiateProtocol() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWebUIServer_AgentCheckIn(t *testing.T) {
+	server := NewWebUIServer(":8080")
+	server.SetVersion("1.5.0")
+
+	tests := []struct {
+		name       string
+		body       string
+		wantCode   int
+		wantStatus string
+	}{
+		{name: "current", body: `{"name":"web1","version":"1.5.0","protocol_min":1,"protocol_max":1}`, wantCode: http.StatusOK, wantStatus: AgentCurrent},
+		{name: "outdated", body: `{"name":"web2","version":"1.4.2","protocol_min":1,"protocol_max":1}`, wantCode: http.StatusOK, wantStatus: AgentOutdated},
+		{name: "development build", body: `{"name":"web3","version":"dev","protocol_min":1,"protocol_max":1}`, wantCode: http.StatusOK, wantStatus: AgentUnknown},
+		{name: "incompatible", body: `{"name":"web4","version":"3.0.0","protocol_min":5,"protocol_max":6}`, wantCode: http.StatusUpgradeRequired, wantStatus: AgentIncompatible},
+		{name: "missing protocol", body: `{"name":"web5","version":"1.5.0"}`, wantCode: http.StatusBadRequest},
+		{name: "invalid json", body: `{`, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/agents", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			server.handleAgents(w, req)
+
+			if w.Code != tt.wantCode {
+				t.Fatalf("Expected status %d, got %d: %s", tt.wantCode, w.Code, w.Body.String())
+			}
+			if tt.wantStatus == "" {
+				return
+			}
+			var response AgentCheckInResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatalf("Failed to parse response: %v", err)
+			}
+			if response.Status != tt.wantStatus {
+				t.Errorf("Expected status %s, got %s", tt.wantStatus, response.Status)
+			}
+			if response.ServerVersion != "1.5.0" {
+				t.Errorf("Expected server version 1.5.0, got %s", response.ServerVersion)
+			}
+			if tt.wantStatus != AgentIncompatible && response.ProtocolVersion != AgentProtocolMax {
+				t.Errorf("Expected protocol %d, got %d", AgentProtocolMax, response.ProtocolVersion)
+			}
+		})
+	}
+
+	req := httptest.NewRequest("GET", "/api/agents", nil)
+	w := httptest.NewRecorder()
+	server.handleAgents(w, req)
+
+	var agents []AgentStatus
+	if err := json.Unmarshal(w.Body.Bytes(), &agents); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(agents) != 4 {
+		t.Fatalf("Expected 4 agents, got %d", len(agents))
+	}
+	if agents[1].Name != "web2" || agents[1].Status != AgentOutdated || !strings.Contains(agents[1].Message, "upgrade the agent") {
+		t.Errorf("Expected web2 to be flagged as outdated, got %+v", agents[1])
+	}
+	if agents[3].Status != AgentIncompatible || !strings.Contains(agents[3].Message, "upgrade the server") {
+		t.Errorf("Expected web4 to be flagged as incompatible, got %+v", agents[3])
+	}
+}
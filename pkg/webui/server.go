@@ -10,6 +10,8 @@ import (
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/notifications"
 )
 
 // ExecutionRecord represents an execution record for the UI
@@ -30,6 +32,10 @@ type WebUIServer struct {
 	addr       string
 	modules    map[string]*core.Module
 	executions []*ExecutionRecord
+	health     *inventory.HealthTracker
+	notifier   *notifications.NotificationManager
+	agents     map[string]*AgentStatus
+	version    string
 	mu         sync.RWMutex
 	server     *http.Server
 }
@@ -40,11 +46,23 @@ func NewWebUIServer(addr string) *WebUIServer {
 		addr:       addr,
 		modules:    make(map[string]*core.Module),
 		executions: make([]*ExecutionRecord, 0),
+		agents:     make(map[string]*AgentStatus),
+		version:    "1.0.0",
 	}
 }
 
 // Start starts the web UI server
 func (s *WebUIServer) Start() error {
+	s.server = &http.Server{
+		Addr:    s.addr,
+		Handler: s.Handler(),
+	}
+	
+	return s.server.ListenAndServe()
+}
+
+// Handler returns the dashboard and its API, for mounting in another server
+func (s *WebUIServer) Handler() http.Handler {
 	mux := http.NewServeMux()
 	
 	// API endpoints
@@ -53,6 +71,9 @@ func (s *WebUIServer) Start() error {
 	mux.HandleFunc("/api/modules/", s.withCORS(s.handleModuleDetail))
 	mux.HandleFunc("/api/executions", s.withCORS(s.handleExecutions))
 	mux.HandleFunc("/api/statistics", s.withCORS(s.handleStatistics))
+	mux.HandleFunc("/api/inventory/health", s.withCORS(s.handleInventoryHealth))
+	mux.HandleFunc("/api/agents", s.withCORS(s.handleAgents))
+	mux.HandleFunc("/api/notifications", s.withCORS(s.handleNotifications))
 	
 	// Static files
 	mux.HandleFunc("/", s.handleIndex)
@@ -61,12 +82,7 @@ func (s *WebUIServer) Start() error {
 	// 404 handler
 	mux.HandleFunc("/api/", s.handleNotFound)
 	
-	s.server = &http.Server{
-		Addr:    s.addr,
-		Handler: mux,
-	}
-	
-	return s.server.ListenAndServe()
+	return mux
 }
 
 // Stop stops the web UI server
@@ -103,6 +119,21 @@ func (s *WebUIServer) AddExecution(execution *ExecutionRecord) {
 	}
 }
 
+// SetHealthTracker sets the tracker whose host scores are served by the inventory API
+func (s *WebUIServer) SetHealthTracker(tracker *inventory.HealthTracker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.health = tracker
+}
+
+// SetNotifications sets the notification manager whose channel deliveries
+// are served by the notifications API
+func (s *WebUIServer) SetNotifications(manager *notifications.NotificationManager) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.notifier = manager
+}
+
 // withCORS adds CORS headers to API responses
 func (s *WebUIServer) withCORS(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -121,10 +152,18 @@ func (s *WebUIServer) withCORS(handler http.HandlerFunc) http.HandlerFunc {
 
 // handleHealth handles health check requests
 func (s *WebUIServer) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	version := s.version
+	s.mu.RUnlock()
+
 	response := map[string]interface{}{
 		"status":    "healthy",
 		"timestamp": time.Now().Format(time.RFC3339),
-		"version":   "1.0.0",
+		"version":   version,
+		"agent_protocol": map[string]int{
+			"min": AgentProtocolMin,
+			"max": AgentProtocolMax,
+		},
 	}
 	
 	s.writeJSON(w, response)
@@ -137,7 +176,14 @@ func (s *WebUIServer) handleModules(w http.ResponseWriter, r *http.Request) {
 	
 	modules := make([]map[string]interface{}, 0, len(s.modules))
 	
-	for _, module := range s.modules {
+	names := make([]string, 0, len(s.modules))
+	for name := range s.modules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	
+	for _, name := range names {
+		module := s.modules[name]
 		moduleData := map[string]interface{}{
 			"name":        module.Metadata.Name,
 			"version":     module.Metadata.Version,
@@ -240,6 +286,32 @@ func (s *WebUIServer) handleStatistics(w http.ResponseWriter, r *http.Request) {
 	s.writeJSON(w, statistics)
 }
 
+// handleInventoryHealth handles host health score requests
+func (s *WebUIServer) handleInventoryHealth(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	scores := []inventory.HealthScore{}
+	if s.health != nil {
+		scores = s.health.Scores()
+	}
+
+	s.writeJSON(w, scores)
+}
+
+// handleNotifications handles notification delivery metric requests
+func (s *WebUIServer) handleNotifications(w http.ResponseWriter, r *http.Request) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	metrics := []notifications.ChannelMetrics{}
+	if s.notifier != nil {
+		metrics = s.notifier.Metrics()
+	}
+
+	s.writeJSON(w, metrics)
+}
+
 // handleIndex handles the main dashboard page
 func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
 	html := `<!DOCTYPE html>
@@ -298,6 +370,22 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
         .api-link:hover {
             text-decoration: underline;
         }
+        .badge {
+            padding: 2px 6px;
+            border-radius: 4px;
+            font-size: 0.8em;
+            color: white;
+            background-color: #999;
+        }
+        .badge.current {
+            background-color: #2e7d32;
+        }
+        .badge.outdated {
+            background-color: #ef6c00;
+        }
+        .badge.incompatible {
+            background-color: #c62828;
+        }
     </style>
 </head>
 <body>
@@ -322,6 +410,16 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             <div id="executions">Loading...</div>
         </div>
         
+        <div class="card">
+            <h2>🛰 Agents</h2>
+            <div id="agents">Loading...</div>
+        </div>
+        
+        <div class="card">
+            <h2>✉ Notifications</h2>
+            <div id="notifications">Loading...</div>
+        </div>
+        
         <div class="card">
             <h2>🔗 API Endpoints</h2>
             <ul>
@@ -329,14 +427,42 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
                 <li><a href="/api/modules" class="api-link">/api/modules</a> - List modules</li>
                 <li><a href="/api/executions" class="api-link">/api/executions</a> - List executions</li>
                 <li><a href="/api/statistics" class="api-link">/api/statistics</a> - Statistics</li>
+                <li><a href="/api/agents" class="api-link">/api/agents</a> - Agent versions</li>
+                <li><a href="/api/notifications" class="api-link">/api/notifications</a> - Notification deliveries</li>
             </ul>
         </div>
     </div>
 
     <script>
+        // A server with a token requires it on the API. It is asked for
+        // when a request is refused and kept for the browser tab.
+        const tokenKey = 'chisel-token';
+        let declined = false;
+        function load(path, retried) {
+            const token = sessionStorage.getItem(tokenKey);
+            const headers = token ? {'Authorization': 'Bearer ' + token} : {};
+            return fetch(path, {headers: headers}).then(response => {
+                if (response.status === 401 && !retried && !declined) {
+                    // Another card may have asked for the token meanwhile
+                    if (sessionStorage.getItem(tokenKey) === token) {
+                        const entered = window.prompt('API token of the Chisel server:');
+                        if (!entered) {
+                            declined = true;
+                            throw new Error('no token');
+                        }
+                        sessionStorage.setItem(tokenKey, entered);
+                    }
+                    return load(path, true);
+                }
+                if (!response.ok) {
+                    throw new Error(response.status + ' ' + response.statusText);
+                }
+                return response.json();
+            });
+        }
+
         // Load statistics
-        fetch('/api/statistics')
-            .then(response => response.json())
+        load('/api/statistics')
             .then(data => {
                 document.getElementById('stats').innerHTML = 
                     '<div class="stat">' + data.total_modules + '</div>Modules<br><br>' +
@@ -348,8 +474,7 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             });
 
         // Load modules
-        fetch('/api/modules')
-            .then(response => response.json())
+        load('/api/modules')
             .then(data => {
                 const modulesList = data.slice(0, 5).map(module => 
                     '<div><strong>' + module.name + '</strong> v' + module.version + 
@@ -362,8 +487,7 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             });
 
         // Load executions
-        fetch('/api/executions')
-            .then(response => response.json())
+        load('/api/executions')
             .then(data => {
                 const executionsList = data.slice(0, 5).map(exec => 
                     '<div><strong>' + exec.module_name + '</strong> ' + exec.action + 
@@ -374,6 +498,37 @@ func (s *WebUIServer) handleIndex(w http.ResponseWriter, r *http.Request) {
             .catch(error => {
                 document.getElementById('executions').innerHTML = 'Error loading executions';
             });
+
+        // Load agents, flagging those that need upgrading. Agents report
+        // their own names and versions, so these are escaped.
+        const escapeHTML = value => String(value).replace(/[&<>"']/g, c =>
+            ({'&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;', "'": '&#39;'})[c]);
+        load('/api/agents')
+            .then(data => {
+                const agentsList = data.map(agent => 
+                    '<div><strong>' + escapeHTML(agent.name) + '</strong> v' + escapeHTML(agent.version) + 
+                    ' <span class="badge ' + agent.status + '">' + agent.status + '</span>' +
+                    (agent.message ? '<br><small>' + escapeHTML(agent.message) + '</small>' : '') + '</div>'
+                ).join('');
+                document.getElementById('agents').innerHTML = agentsList || 'No agents';
+            })
+            .catch(error => {
+                document.getElementById('agents').innerHTML = 'Error loading agents';
+            });
+
+        // Load notification deliveries per channel, with the last error
+        load('/api/notifications')
+            .then(data => {
+                const channelsList = data.map(channel =>
+                    '<div><strong>' + escapeHTML(channel.channel) + '</strong> (' + escapeHTML(channel.type) + ') ' +
+                    channel.accepted + ' accepted, ' + channel.failed + ' failed' +
+                    (channel.last_delivery && channel.last_delivery.error ? '<br><small>' + escapeHTML(channel.last_delivery.error) + '</small>' : '') + '</div>'
+                ).join('');
+                document.getElementById('notifications').innerHTML = channelsList || 'No notifications sent';
+            })
+            .catch(error => {
+                document.getElementById('notifications').innerHTML = 'Error loading notifications';
+            });
     </script>
 </body>
 </html>`
@@ -1,7 +1,9 @@
 package webui
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"strings"
@@ -9,6 +11,8 @@ import (
 	"time"
 
 	"github.com/ataiva-software/forge/pkg/core"
+	"github.com/ataiva-software/forge/pkg/inventory"
+	"github.com/ataiva-software/forge/pkg/notifications"
 	"github.com/ataiva-software/forge/pkg/types"
 )
 
@@ -224,6 +228,67 @@ func TestWebUIServer_ExecutionsEndpoint(t *testing.T) {
 	}
 }
 
+func TestWebUIServer_InventoryHealthEndpoint(t *testing.T) {
+	server := NewWebUIServer(":8080")
+
+	tracker := inventory.NewHealthTracker(0)
+	tracker.Record("web2", false, time.Second)
+	tracker.Record("web1", true, time.Second)
+	server.SetHealthTracker(tracker)
+
+	req := httptest.NewRequest("GET", "/api/inventory/health", nil)
+	w := httptest.NewRecorder()
+
+	server.handleInventoryHealth(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Errorf("Expected status 200, got %d", w.Code)
+	}
+
+	var response []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+
+	if len(response) != 2 {
+		t.Fatalf("Expected 2 hosts, got %d", len(response))
+	}
+	if response[0]["host"] != "web1" || response[0]["success_rate"] != 1.0 {
+		t.Errorf("Unexpected first score %v", response[0])
+	}
+}
+
+// failingChannel is a notification channel whose service is down
+type failingChannel struct{}
+
+func (failingChannel) Send(ctx context.Context, notification *notifications.Notification) error {
+	return errors.New("service unavailable")
+}
+func (failingChannel) Type() string { return "email_ses" }
+func (failingChannel) Name() string { return "oncall" }
+
+func TestWebUIServer_NotificationsEndpoint(t *testing.T) {
+	server := NewWebUIServer(":8080")
+
+	manager := notifications.NewNotificationManager(nil)
+	manager.AddChannel(failingChannel{})
+	manager.SendToChannels(context.Background(), notifications.NewNotification("Alert", "web1 drifted", notifications.LevelWarning), []string{"oncall"})
+	server.SetNotifications(manager)
+
+	req := httptest.NewRequest("GET", "/api/notifications", nil)
+	w := httptest.NewRecorder()
+
+	server.handleNotifications(w, req)
+
+	var response []notifications.ChannelMetrics
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatalf("Failed to parse response: %v", err)
+	}
+	if len(response) != 1 || response[0].Channel != "oncall" || response[0].Failed != 1 || response[0].LastDelivery.Error != "service unavailable" {
+		t.Errorf("Unexpected notification metrics %+v", response)
+	}
+}
+
 func TestWebUIServer_StatisticsEndpoint(t *testing.T) {
 	server := NewWebUIServer(":8080")
 	